@@ -1,16 +1,46 @@
 package main
 
 import (
+	"context"
+	"io"
 	"log"
+	"os"
+	"piccolod/internal/cli"
+	"piccolod/internal/diag"
 	"piccolod/internal/server"
+	"piccolod/internal/state/paths"
+	"piccolod/internal/update"
 )
 
-var version = "dev"
+// Set with -ldflags -X at build time.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
 
 func main() {
 	// The main function is the entry point. Its only job is to
 	// initialize and start the Gin-based server.
-	srv, err := server.NewGinServer(server.WithGinVersion(version))
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(context.Background(), cli.Env{
+			RunDir: paths.RunDir(),
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		}, os.Args[1:]))
+	}
+	// Keep recent log lines in memory for debug bundles.
+	logs := diag.NewLogRing(diag.DefaultLogLines)
+	log.SetOutput(io.MultiWriter(os.Stderr, logs))
+	if restored, err := update.GuardStartup(update.BinaryPath()); err != nil {
+		log.Printf("WARN: self-update startup guard: %v", err)
+	} else if restored {
+		// Exit so systemd restarts into the restored binary.
+		log.Printf("ERROR: updated piccolod did not become ready; previous binary restored")
+		os.Exit(1)
+	}
+	srv, err := server.NewGinServer(server.WithGinVersion(version), server.WithGinBuildInfo(commit, buildDate), server.WithLogRing(logs))
 	if err != nil {
 		log.Fatalf("FATAL: Failed to initialize server: %v", err)
 	}
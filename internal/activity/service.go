@@ -0,0 +1,336 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+const (
+	defaultMaxRows = 5000
+	defaultMaxAge  = 30 * 24 * time.Hour
+	pruneInterval  = 100
+	maxPending     = 256
+)
+
+// Entry is a single record in the device activity log.
+type Entry struct {
+	ID       int64          `json:"id"`
+	Time     time.Time      `json:"ts"`
+	Source   string         `json:"source"`
+	Level    string         `json:"level"`
+	Message  string         `json:"message"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Query filters List results. Entries are returned newest first; Before pages
+// backwards from a previously returned entry ID.
+type Query struct {
+	Source string
+	Level  string
+	Since  time.Time
+	Before int64
+	Limit  int
+}
+
+// Recorder accepts explicit activity records from subsystems.
+type Recorder interface {
+	Record(ctx context.Context, entry Entry)
+}
+
+// Service persists activity entries in the control store. Entries recorded
+// while the store is locked (or this node is a follower) are held in memory
+// and flushed in order once writes succeed again.
+type Service struct {
+	mu      sync.Mutex
+	repo    persistence.ActivityRepo
+	pending []persistence.ActivityRecord
+	appends int
+	maxRows int
+	maxAge  time.Duration
+	now     func() time.Time
+
+	observeMu   sync.Mutex
+	volumeState map[string]string
+	remoteState string
+
+	busMu sync.RWMutex
+	bus   *events.Bus
+}
+
+// NewService constructs an activity log backed by repo.
+func NewService(repo persistence.ActivityRepo) *Service {
+	return &Service{
+		repo:        repo,
+		maxRows:     defaultMaxRows,
+		maxAge:      defaultMaxAge,
+		now:         time.Now,
+		volumeState: make(map[string]string),
+	}
+}
+
+// SetRetention overrides the row cap and maximum age used when pruning.
+func (s *Service) SetRetention(maxRows int, maxAge time.Duration) {
+	s.mu.Lock()
+	s.maxRows = maxRows
+	s.maxAge = maxAge
+	s.mu.Unlock()
+}
+
+// Record appends an entry; failures are logged rather than returned so
+// callers never fail an operation because the activity log is unavailable.
+func (s *Service) Record(ctx context.Context, entry Entry) {
+	if s == nil {
+		return
+	}
+	rec := persistence.ActivityRecord{
+		Time:     entry.Time,
+		Source:   strings.TrimSpace(entry.Source),
+		Level:    strings.TrimSpace(entry.Level),
+		Message:  strings.TrimSpace(entry.Message),
+		Metadata: entry.Metadata,
+	}
+	if rec.Source == "" || rec.Message == "" {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = s.now()
+	}
+	rec.Time = rec.Time.UTC()
+	if rec.Level == "" {
+		rec.Level = LevelInfo
+	}
+	s.publish(rec)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, rec)
+	if over := len(s.pending) - maxPending; over > 0 {
+		log.Printf("WARN: activity log dropping %d buffered entries while store unavailable", over)
+		s.pending = s.pending[over:]
+	}
+	s.flushLocked(ctx)
+}
+
+// Flush retries writing any buffered entries.
+func (s *Service) Flush(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked(ctx)
+}
+
+func (s *Service) flushLocked(ctx context.Context) {
+	if s.repo == nil {
+		return
+	}
+	for len(s.pending) > 0 {
+		_, err := s.repo.AppendActivity(ctx, s.pending[0])
+		if err != nil {
+			if errors.Is(err, persistence.ErrLocked) || errors.Is(err, persistence.ErrNotLeader) {
+				return
+			}
+			log.Printf("WARN: activity log append failed: %v", err)
+		}
+		s.pending = s.pending[1:]
+		if err == nil {
+			s.appends++
+			if s.appends%pruneInterval == 0 {
+				s.pruneLocked(ctx)
+			}
+		}
+	}
+	s.pending = nil
+}
+
+func (s *Service) pruneLocked(ctx context.Context) {
+	policy := persistence.ActivityRetention{MaxRows: s.maxRows}
+	if s.maxAge > 0 {
+		policy.OlderThan = s.now().Add(-s.maxAge)
+	}
+	if _, err := s.repo.PruneActivity(ctx, policy); err != nil {
+		log.Printf("WARN: activity log prune failed: %v", err)
+	}
+}
+
+// Prune applies the retention policy immediately.
+func (s *Service) Prune(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.repo != nil {
+		s.pruneLocked(ctx)
+	}
+}
+
+// List returns persisted entries matching q.
+func (s *Service) List(ctx context.Context, q Query) ([]Entry, error) {
+	if s == nil || s.repo == nil {
+		return nil, persistence.ErrNotImplemented
+	}
+	records, err := s.repo.ListActivity(ctx, persistence.ActivityQuery{
+		Source:   q.Source,
+		Level:    q.Level,
+		Since:    q.Since,
+		BeforeID: q.Before,
+		Limit:    q.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(records))
+	for _, rec := range records {
+		out = append(out, Entry{
+			ID:       rec.ID,
+			Time:     rec.Time,
+			Source:   rec.Source,
+			Level:    rec.Level,
+			Message:  rec.Message,
+			Metadata: rec.Metadata,
+		})
+	}
+	return out, nil
+}
+
+// publish announces a recorded entry on TopicActivity so live consumers see
+// it even while the store is locked and the entry is only buffered.
+func (s *Service) publish(rec persistence.ActivityRecord) {
+	s.busMu.RLock()
+	bus := s.bus
+	s.busMu.RUnlock()
+	if bus == nil {
+		return
+	}
+	bus.Publish(events.Event{Topic: events.TopicActivity, Payload: events.ActivityRecorded{
+		Time:     rec.Time,
+		Source:   rec.Source,
+		Level:    rec.Level,
+		Message:  rec.Message,
+		Metadata: rec.Metadata,
+	}})
+}
+
+// Observe subscribes to bus topics that describe device-level state changes
+// and records them, and republishes every recorded entry on TopicActivity.
+// Goroutines exit when the bus is closed.
+func (s *Service) Observe(bus *events.Bus) {
+	if s == nil || bus == nil {
+		return
+	}
+	s.busMu.Lock()
+	s.bus = bus
+	s.busMu.Unlock()
+	topics := []events.Topic{
+		events.TopicLockStateChanged,
+		events.TopicLeadershipRoleChanged,
+		events.TopicRemoteConfigChanged,
+		events.TopicVolumeStateChanged,
+		events.TopicAudit,
+	}
+	for _, topic := range topics {
+		ch := bus.Subscribe(topic, 32)
+		go func() {
+			for evt := range ch {
+				s.observe(evt)
+			}
+		}()
+	}
+}
+
+func (s *Service) observe(evt events.Event) {
+	ctx := context.Background()
+	switch payload := evt.Payload.(type) {
+	case events.LockStateChanged:
+		if payload.Locked {
+			s.Record(ctx, Entry{Source: "persistence", Level: LevelWarn, Message: "Storage locked"})
+			return
+		}
+		s.Record(ctx, Entry{Source: "persistence", Level: LevelInfo, Message: "Storage unlocked"})
+	case events.LeadershipChanged:
+		s.Record(ctx, Entry{
+			Source:   "cluster",
+			Level:    LevelInfo,
+			Message:  fmt.Sprintf("Leadership for %s is now %s", payload.Resource, payload.Role),
+			Metadata: map[string]any{"resource": payload.Resource, "role": string(payload.Role)},
+		})
+	case events.VolumeStateChanged:
+		s.observeVolume(ctx, payload)
+	case remote.Status:
+		s.observeRemote(ctx, payload)
+	case events.AuditEvent:
+		source := payload.Kind
+		if idx := strings.Index(source, "."); idx > 0 {
+			source = source[:idx]
+		}
+		meta := map[string]any{"kind": payload.Kind}
+		if payload.Source != "" {
+			meta["client"] = payload.Source
+		}
+		for k, v := range payload.Metadata {
+			meta[k] = v
+		}
+		s.Record(ctx, Entry{Time: payload.Time, Source: source, Level: LevelInfo, Message: payload.Kind, Metadata: meta})
+	}
+}
+
+// observeVolume records observed-state transitions only; repeated events for
+// the same state are noise.
+func (s *Service) observeVolume(ctx context.Context, v events.VolumeStateChanged) {
+	s.observeMu.Lock()
+	prev := s.volumeState[v.ID]
+	s.volumeState[v.ID] = v.Observed
+	s.observeMu.Unlock()
+	if prev == v.Observed {
+		return
+	}
+	entry := Entry{
+		Source:   "persistence",
+		Level:    LevelInfo,
+		Message:  fmt.Sprintf("Volume %s %s", v.ID, v.Observed),
+		Metadata: map[string]any{"volume": v.ID, "observed": v.Observed, "desired": v.Desired},
+	}
+	if v.Observed == "error" {
+		entry.Level = LevelError
+		if v.LastError != "" {
+			entry.Message = fmt.Sprintf("Volume %s failed: %s", v.ID, v.LastError)
+		}
+	}
+	s.Record(ctx, entry)
+}
+
+// observeRemote records remote state transitions. The first status seen is
+// the startup baseline and is not logged.
+func (s *Service) observeRemote(ctx context.Context, st remote.Status) {
+	s.observeMu.Lock()
+	prev := s.remoteState
+	s.remoteState = st.State
+	s.observeMu.Unlock()
+	if prev == "" || prev == st.State {
+		return
+	}
+	level := LevelInfo
+	if st.State == "error" || st.State == "warning" {
+		level = LevelWarn
+	}
+	s.Record(ctx, Entry{
+		Source:   "remote",
+		Level:    level,
+		Message:  fmt.Sprintf("Remote state changed to %s", st.State),
+		Metadata: map[string]any{"previous": prev, "state": st.State},
+	})
+}
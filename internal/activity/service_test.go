@@ -0,0 +1,144 @@
+package activity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+type fakeRepo struct {
+	mu      sync.Mutex
+	locked  bool
+	records []persistence.ActivityRecord
+	prunes  []persistence.ActivityRetention
+}
+
+func (f *fakeRepo) AppendActivity(ctx context.Context, rec persistence.ActivityRecord) (persistence.ActivityRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locked {
+		return rec, persistence.ErrLocked
+	}
+	rec.ID = int64(len(f.records) + 1)
+	f.records = append(f.records, rec)
+	return rec, nil
+}
+
+func (f *fakeRepo) ListActivity(ctx context.Context, q persistence.ActivityQuery) ([]persistence.ActivityRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]persistence.ActivityRecord, 0, len(f.records))
+	for i := len(f.records) - 1; i >= 0; i-- {
+		out = append(out, f.records[i])
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) PruneActivity(ctx context.Context, policy persistence.ActivityRetention) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prunes = append(f.prunes, policy)
+	return 0, nil
+}
+
+func (f *fakeRepo) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, rec := range f.records {
+		out = append(out, rec.Message)
+	}
+	return out
+}
+
+func TestServiceBuffersWhileLocked(t *testing.T) {
+	repo := &fakeRepo{locked: true}
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	svc.Record(ctx, Entry{Source: "app", Message: "first"})
+	svc.Record(ctx, Entry{Source: "app", Message: "second"})
+	if got := repo.messages(); len(got) != 0 {
+		t.Fatalf("expected nothing written while locked, got %v", got)
+	}
+
+	repo.mu.Lock()
+	repo.locked = false
+	repo.mu.Unlock()
+	svc.Record(ctx, Entry{Source: "app", Message: "third"})
+
+	got := repo.messages()
+	if len(got) != 3 || got[0] != "first" || got[1] != "second" || got[2] != "third" {
+		t.Fatalf("expected buffered entries flushed in order, got %v", got)
+	}
+	if repo.records[0].Level != LevelInfo || repo.records[0].Time.IsZero() {
+		t.Fatalf("expected defaults applied, got %+v", repo.records[0])
+	}
+}
+
+func TestServicePrunesWithRetention(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	fixed := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return fixed }
+	svc.SetRetention(10, 24*time.Hour)
+
+	for i := 0; i < pruneInterval; i++ {
+		svc.Record(context.Background(), Entry{Source: "app", Message: "tick"})
+	}
+	if len(repo.prunes) != 1 {
+		t.Fatalf("expected one prune after %d appends, got %d", pruneInterval, len(repo.prunes))
+	}
+	policy := repo.prunes[0]
+	if policy.MaxRows != 10 || !policy.OlderThan.Equal(fixed.Add(-24*time.Hour)) {
+		t.Fatalf("unexpected retention policy: %+v", policy)
+	}
+}
+
+func TestServiceObservesBusTransitions(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	bus := events.NewBus()
+	defer bus.Close()
+	svc.Observe(bus)
+
+	bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: "app-blog", Observed: "mounted"}})
+	bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: "app-blog", Observed: "mounted"}})
+	bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: "app-blog", Observed: "error", LastError: "process exited"}})
+	bus.Publish(events.Event{Topic: events.TopicAudit, Payload: events.AuditEvent{Kind: "setup.complete", Source: "10.0.0.2"}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(repo.messages()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for entries, got %v", repo.messages())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries, err := svc.List(context.Background(), Query{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var volume []Entry
+	var audit *Entry
+	for i := range entries {
+		switch entries[i].Source {
+		case "persistence":
+			volume = append(volume, entries[i])
+		case "setup":
+			audit = &entries[i]
+		}
+	}
+	if len(volume) != 2 {
+		t.Fatalf("expected duplicate volume state to be collapsed, got %+v", volume)
+	}
+	if volume[0].Level != LevelError || volume[0].Message != "Volume app-blog failed: process exited" {
+		t.Fatalf("unexpected volume failure entry: %+v", volume[0])
+	}
+	if audit == nil || audit.Metadata["client"] != "10.0.0.2" {
+		t.Fatalf("expected audit entry attributed to client, got %+v", audit)
+	}
+}
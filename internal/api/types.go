@@ -1,9 +1,13 @@
 package api
 
 import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -119,18 +123,27 @@ const (
 	ListenerProtocolRaw
 	ListenerProtocolHTTP
 	ListenerProtocolWebsocket
+	ListenerProtocolTCP
+	ListenerProtocolUDP
+	ListenerProtocolHTTPS
 )
 
 var protocolToString = map[ListenerProtocol]string{
 	ListenerProtocolRaw:       "raw",
 	ListenerProtocolHTTP:      "http",
 	ListenerProtocolWebsocket: "websocket",
+	ListenerProtocolTCP:       "tcp",
+	ListenerProtocolUDP:       "udp",
+	ListenerProtocolHTTPS:     "https",
 }
 
 var protocolFromString = map[string]ListenerProtocol{
 	"raw":       ListenerProtocolRaw,
 	"http":      ListenerProtocolHTTP,
 	"websocket": ListenerProtocolWebsocket,
+	"tcp":       ListenerProtocolTCP,
+	"udp":       ListenerProtocolUDP,
+	"https":     ListenerProtocolHTTPS,
 }
 
 // String returns the token representation of the protocol.
@@ -141,6 +154,26 @@ func (p ListenerProtocol) String() string {
 	return ""
 }
 
+// Passthrough reports whether the protocol is relayed as raw L4 traffic on a
+// dedicated remote port, bypassing HTTP middleware and TLS termination.
+func (p ListenerProtocol) Passthrough() bool {
+	return p == ListenerProtocolTCP || p == ListenerProtocolUDP
+}
+
+// HTTP reports whether the listener proxy speaks HTTP to clients: http and
+// websocket backends, and https ones it re-encrypts to.
+func (p ListenerProtocol) HTTP() bool {
+	return p == ListenerProtocolHTTP || p == ListenerProtocolWebsocket || p == ListenerProtocolHTTPS
+}
+
+// Network returns the socket network ("tcp" or "udp") used to carry the protocol.
+func (p ListenerProtocol) Network() string {
+	if p == ListenerProtocolUDP {
+		return "udp"
+	}
+	return "tcp"
+}
+
 // MarshalJSON converts the protocol enum back to its token.
 func (p ListenerProtocol) MarshalJSON() ([]byte, error) {
 	if p == ListenerProtocolUnknown {
@@ -220,6 +253,10 @@ type BackupTarget struct {
 
 // AppDefinition represents an app.yaml definition file
 type AppDefinition struct {
+	// APIVersion is the app.yaml schema version, e.g. "piccolo/v1". Files
+	// written before versioning omit it and are read as v1.
+	APIVersion string `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+
 	Name  string    `yaml:"name" json:"name"`
 	Image string    `yaml:"image,omitempty" json:"image,omitempty"`
 	Build *AppBuild `yaml:"build,omitempty" json:"build,omitempty"`
@@ -233,8 +270,18 @@ type AppDefinition struct {
 	Resources   *AppResources          `yaml:"resources,omitempty" json:"resources,omitempty"`
 	HealthCheck *AppHealthCheck        `yaml:"healthcheck,omitempty" json:"healthcheck,omitempty"`
 	DependsOn   []string               `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	Tasks       []AppTask              `yaml:"tasks,omitempty" json:"tasks,omitempty"`
 	AppConfig   interface{}            `yaml:"app_config,omitempty" json:"app_config,omitempty"`
 	Extensions  map[string]interface{} `yaml:"x-piccolo,omitempty" json:"x-piccolo,omitempty"`
+	// Capabilities declares host access beyond the default sandbox; the
+	// system app policy decides what is granted.
+	Capabilities *AppCapabilities `yaml:"capabilities,omitempty" json:"capabilities,omitempty"`
+	// Logs keeps the container's output on disk, so it outlives the
+	// container.
+	Logs *AppLogs `yaml:"logs,omitempty" json:"logs,omitempty"`
+	// Extra holds top-level keys this version does not know, so a file
+	// written by a newer daemon survives being rewritten by an older one.
+	Extra map[string]interface{} `yaml:",inline" json:"extra,omitempty"`
 }
 
 // AppListener defines a named service exposed by the app (service-oriented model)
@@ -245,6 +292,132 @@ type AppListener struct {
 	Protocol    ListenerProtocol        `yaml:"protocol,omitempty" json:"protocol,omitempty"`
 	Middleware  []AppProtocolMiddleware `yaml:"protocol_middleware,omitempty" json:"protocol_middleware,omitempty"`
 	RemotePorts []int                   `yaml:"remote_ports,omitempty" json:"remote_ports,omitempty"`
+	// RemoteSubdomain picks the label of the listener's remote hostname
+	// (<label>.<tld>); it defaults to the listener name.
+	RemoteSubdomain string `yaml:"remote_subdomain,omitempty" json:"remote_subdomain,omitempty"`
+	// PreserveHost controls whether http and websocket backends see the
+	// client's Host header (the default) or their own loopback address.
+	PreserveHost *bool `yaml:"preserve_host,omitempty" json:"preserve_host,omitempty"`
+	// BackendTLS pins the certificate of an https backend.
+	BackendTLS *ListenerBackendTLS `yaml:"backend_tls,omitempty" json:"backend_tls,omitempty"`
+	// MaxConnections caps the connections the listener's proxy holds open;
+	// MaxConnectionsPerIP caps those from one client address. Zero uses the
+	// system default.
+	MaxConnections      int `yaml:"max_connections,omitempty" json:"max_connections,omitempty"`
+	MaxConnectionsPerIP int `yaml:"max_connections_per_ip,omitempty" json:"max_connections_per_ip,omitempty"`
+	// IdleTimeout is a Go duration after which a connection with no traffic
+	// either way is closed; empty uses the system default.
+	IdleTimeout string `yaml:"idle_timeout,omitempty" json:"idle_timeout,omitempty"`
+	// PathPrefix also serves an http or websocket listener on the portal
+	// hostname under this path below /apps/, such as /apps/syncthing.
+	PathPrefix string `yaml:"path_prefix,omitempty" json:"path_prefix,omitempty"`
+	// StripPrefix controls whether the backend sees request paths without
+	// PathPrefix (the default) or unchanged.
+	StripPrefix *bool `yaml:"strip_prefix,omitempty" json:"strip_prefix,omitempty"`
+	// Public serves PathPrefix without a portal session.
+	Public bool `yaml:"public,omitempty" json:"public,omitempty"`
+	// Extra holds listener keys this version does not know.
+	Extra map[string]interface{} `yaml:",inline" json:"extra,omitempty"`
+}
+
+// ListenerBackendTLS controls how the proxy checks the certificate of an
+// https backend. Without it any certificate is accepted, since such
+// backends usually present a self-signed one.
+type ListenerBackendTLS struct {
+	// Fingerprint is the SHA-256 of the backend's leaf certificate, in hex
+	// with or without colons.
+	Fingerprint string `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+	// CA is a PEM bundle the backend's certificate must chain to. The
+	// backend is reached on loopback, so its host name is not checked.
+	CA string `yaml:"ca,omitempty" json:"ca,omitempty"`
+}
+
+// FingerprintBytes decodes Fingerprint; it is nil when none is set.
+func (t ListenerBackendTLS) FingerprintBytes() ([]byte, error) {
+	raw := strings.ReplaceAll(strings.TrimSpace(t.Fingerprint), ":", "")
+	if raw == "" {
+		return nil, nil
+	}
+	sum, err := hex.DecodeString(raw)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("fingerprint must be a hex SHA-256 digest")
+	}
+	return sum, nil
+}
+
+// CertPool parses CA; it is nil when none is set.
+func (t ListenerBackendTLS) CertPool() (*x509.CertPool, error) {
+	if strings.TrimSpace(t.CA) == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(t.CA)) {
+		return nil, fmt.Errorf("ca holds no PEM certificates")
+	}
+	return pool, nil
+}
+
+// RemoteLabel is the DNS label the listener is published under remotely.
+func (l AppListener) RemoteLabel() string {
+	if label := strings.TrimSpace(l.RemoteSubdomain); label != "" {
+		return strings.ToLower(label)
+	}
+	return strings.ToLower(strings.TrimSpace(l.Name))
+}
+
+// PreservesHost reports whether the proxy passes the original Host header
+// through to the backend.
+func (l AppListener) PreservesHost() bool {
+	return l.PreserveHost == nil || *l.PreserveHost
+}
+
+// PortalPath is PathPrefix without trailing slashes; empty when the
+// listener is not served on the portal.
+func (l AppListener) PortalPath() string {
+	return strings.TrimRight(strings.TrimSpace(l.PathPrefix), "/")
+}
+
+// StripsPrefix reports whether the portal removes PathPrefix from the
+// paths it proxies to the backend.
+func (l AppListener) StripsPrefix() bool {
+	return l.StripPrefix == nil || *l.StripPrefix
+}
+
+// PathsOverlap reports whether one of two portal paths equals or contains
+// the other, so both would claim the same requests.
+func PathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// IdleTimeoutDuration parses IdleTimeout; it is zero when none is set.
+func (l AppListener) IdleTimeoutDuration() (time.Duration, error) {
+	if strings.TrimSpace(l.IdleTimeout) == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(l.IdleTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("idle_timeout '%s' is not a duration", l.IdleTimeout)
+	}
+	return d, nil
+}
+
+// AppTask is a command run inside the app's container on a cron schedule.
+type AppTask struct {
+	Name string `yaml:"name" json:"name"`
+	// Schedule is a five-field cron expression in the device's local time,
+	// or an alias such as @daily.
+	Schedule string   `yaml:"schedule" json:"schedule"`
+	Command  []string `yaml:"command" json:"command"`
+	// Timeout is a Go duration; runs still going after it are killed.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// AppLogs configures capture of the container's output into rotating files
+// in the app's state, kept across container replacements.
+type AppLogs struct {
+	Capture bool `yaml:"capture,omitempty" json:"capture,omitempty"`
+	// MaxSize caps the files kept, e.g. "20MB"; empty uses the default.
+	MaxSize string `yaml:"max_size,omitempty" json:"max_size,omitempty"`
 }
 
 // AppProtocolMiddleware defines protocol-specific middleware entry
@@ -267,6 +440,40 @@ type AppBuild struct {
 type AppStorage struct {
 	Persistent map[string]AppVolume `yaml:"persistent,omitempty" json:"persistent,omitempty"`
 	Temporary  map[string]AppVolume `yaml:"temporary,omitempty" json:"temporary,omitempty"`
+	// HostMounts bind existing host directories, such as a media library,
+	// into the container. Host paths must sit under the admin-approved
+	// mount allowlist.
+	HostMounts []AppHostMount `yaml:"host_mounts,omitempty" json:"host_mounts,omitempty"`
+}
+
+// AppHostMount binds a host directory into the container. Mounts are
+// read-only unless read_only is false and allow_write is set as well.
+type AppHostMount struct {
+	Host       string `yaml:"host" json:"host"`
+	Container  string `yaml:"container" json:"container"`
+	ReadOnly   *bool  `yaml:"read_only,omitempty" json:"read_only,omitempty"`
+	AllowWrite bool   `yaml:"allow_write,omitempty" json:"allow_write,omitempty"`
+	// SELinux is the relabel option passed to Podman: "z" for a label
+	// shared with other containers, "Z" for a private one, empty for none.
+	SELinux string `yaml:"selinux,omitempty" json:"selinux,omitempty"`
+}
+
+// Writable reports whether the mount is bound read-write.
+func (m AppHostMount) Writable() bool {
+	return m.ReadOnly != nil && !*m.ReadOnly && m.AllowWrite
+}
+
+// AppCapabilities lists the host devices, Linux capabilities and host
+// networking an app needs, e.g. /dev/dri for hardware transcoding or
+// NET_ADMIN for a VPN.
+type AppCapabilities struct {
+	// Devices are host device paths under /dev passed into the container.
+	Devices []string `yaml:"devices,omitempty" json:"devices,omitempty"`
+	// Linux are capability names added to the container, with or without
+	// the CAP_ prefix.
+	Linux []string `yaml:"linux,omitempty" json:"linux,omitempty"`
+	// HostNetwork runs the container in the host's network namespace.
+	HostNetwork bool `yaml:"host_network,omitempty" json:"host_network,omitempty"`
 }
 
 // AppFilesystem defines filesystem persistence
@@ -340,7 +547,7 @@ type App struct {
 	Name        string `json:"name"`
 	Image       string `json:"image"`
 	Type        string `json:"type"`
-	Status      string `json:"status"` // "running", "stopped", "error"
+	Status      string `json:"status"` // "running", "paused", "stopped", "error"
 	ContainerID string `json:"container_id,omitempty"`
 	// Legacy Ports removed
 	Volumes     []AppVolume       `json:"volumes,omitempty"`
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WaitForOperationsEnv set to 1 makes a second operation on a busy app wait
+// its turn instead of failing with ErrOperationInProgress.
+const WaitForOperationsEnv = "PICCOLO_WAIT_FOR_APP_OPERATIONS"
+
+// ErrOperationInProgress is returned when an app is already being
+// installed, started, stopped, updated or removed and the manager is set to
+// fail rather than wait.
+var ErrOperationInProgress = errors.New("app manager: operation in progress")
+
+// OperationInProgressError names the app and the operation holding it.
+type OperationInProgressError struct {
+	App       string
+	Operation string
+}
+
+func (e *OperationInProgressError) Error() string {
+	return fmt.Sprintf("app %s: %s already in progress", e.App, e.Operation)
+}
+
+func (e *OperationInProgressError) Unwrap() error { return ErrOperationInProgress }
+
+// appLocks hands out one lock per app name. Entries are reference counted
+// and dropped once nobody holds or waits for them.
+type appLocks struct {
+	mu   sync.Mutex
+	held map[string]*appLock
+}
+
+type appLock struct {
+	sem  chan struct{}
+	refs int
+	op   string
+}
+
+// acquire takes the lock for name. Without wait it fails at once when the
+// lock is held; with wait it blocks until the lock frees up or ctx ends.
+func (l *appLocks) acquire(ctx context.Context, name, op string, wait bool) (func(), error) {
+	l.mu.Lock()
+	if l.held == nil {
+		l.held = make(map[string]*appLock)
+	}
+	lk := l.held[name]
+	if lk == nil {
+		lk = &appLock{sem: make(chan struct{}, 1)}
+		l.held[name] = lk
+	}
+	select {
+	case lk.sem <- struct{}{}:
+		lk.refs++
+		lk.op = op
+		l.mu.Unlock()
+		return func() { l.release(name, lk) }, nil
+	default:
+	}
+	if !wait {
+		holder := lk.op
+		l.mu.Unlock()
+		return nil, &OperationInProgressError{App: name, Operation: holder}
+	}
+	lk.refs++
+	l.mu.Unlock()
+
+	select {
+	case lk.sem <- struct{}{}:
+		l.mu.Lock()
+		lk.op = op
+		l.mu.Unlock()
+		return func() { l.release(name, lk) }, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		lk.refs--
+		if lk.refs == 0 {
+			delete(l.held, name)
+		}
+		l.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (l *appLocks) release(name string, lk *appLock) {
+	l.mu.Lock()
+	lk.refs--
+	lk.op = ""
+	if lk.refs == 0 {
+		delete(l.held, name)
+	}
+	l.mu.Unlock()
+	<-lk.sem
+}
+
+// size reports how many app names have a lock entry.
+func (l *appLocks) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.held)
+}
+
+type waitForOperationKey struct{}
+
+// waitForOperation marks ctx so lockApp waits for a busy app instead of
+// failing, e.g. for boot-time starts that must not be skipped.
+func waitForOperation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, waitForOperationKey{}, true)
+}
+
+// SetWaitForOperations chooses whether a second operation on an app that is
+// already being operated on waits its turn (true) or fails at once with
+// ErrOperationInProgress (false, the default).
+func (m *AppManager) SetWaitForOperations(wait bool) {
+	m.opMu.Lock()
+	m.opWait = wait
+	m.opMu.Unlock()
+}
+
+// lockApp serialises mutating operations on one app. The returned function
+// releases the lock.
+func (m *AppManager) lockApp(ctx context.Context, name, op string) (func(), error) {
+	m.opMu.Lock()
+	wait := m.opWait
+	m.opMu.Unlock()
+	if v, ok := ctx.Value(waitForOperationKey{}).(bool); ok && v {
+		wait = true
+	}
+	return m.appLocks.acquire(ctx, name, op, wait)
+}
+
+// commitState runs fn, which changes what List and Get report, so that no
+// snapshot sees it half done.
+func (m *AppManager) commitState(fn func() error) error {
+	m.snapshotMu.Lock()
+	defer m.snapshotMu.Unlock()
+	return fn()
+}
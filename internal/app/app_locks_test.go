@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+func lockTestApp(name string) *api.AppDefinition {
+	return &api.AppDefinition{Name: name, Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: name, GuestPort: 80}}}
+}
+
+// whileHeld runs first in the background, waits until it holds the app
+// lock, then runs second and returns both results.
+func whileHeld(t *testing.T, m *AppManager, first, second func() error) (error, error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	var firstErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		firstErr = first()
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for m.appLocks.size() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("first operation never took the app lock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	secondErr := second()
+	wg.Wait()
+	return firstErr, secondErr
+}
+
+func expectInProgress(t *testing.T, err error) {
+	t.Helper()
+	var inProgress *OperationInProgressError
+	if !errors.Is(err, ErrOperationInProgress) || !errors.As(err, &inProgress) {
+		t.Fatalf("expected ErrOperationInProgress, got %v", err)
+	}
+}
+
+func TestAppLocks_ConcurrentInstallHasOneWinner(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	mock.createDelay = 100 * time.Millisecond
+	ctx := context.Background()
+
+	first, second := whileHeld(t, manager,
+		func() error { _, err := manager.Install(ctx, lockTestApp("blog")); return err },
+		func() error { _, err := manager.Install(ctx, lockTestApp("blog")); return err },
+	)
+	if first != nil {
+		t.Fatalf("first install: %v", first)
+	}
+	expectInProgress(t, second)
+	if len(mock.containers) != 1 {
+		t.Fatalf("expected one container, got %d", len(mock.containers))
+	}
+	if eps, err := manager.serviceManager.GetByApp("blog"); err != nil || len(eps) != 1 {
+		t.Fatalf("expected one service entry, got %+v (%v)", eps, err)
+	}
+	if manager.appLocks.size() != 0 {
+		t.Fatalf("app locks leaked: %d", manager.appLocks.size())
+	}
+
+	// Unrestricted racing installs still leave exactly one app behind.
+	mock.createDelay = 0
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := manager.Install(ctx, lockTestApp("notes")); err == nil {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 || len(mock.containers) != 2 {
+		t.Fatalf("expected one winning install, got %d wins and %d containers", wins, len(mock.containers))
+	}
+}
+
+func TestAppLocks_StartRacingUninstall(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	ctx := context.Background()
+	if _, err := manager.Install(ctx, lockTestApp("blog")); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	mock.startDelay = 100 * time.Millisecond
+
+	first, second := whileHeld(t, manager,
+		func() error { return manager.Start(ctx, "blog") },
+		func() error { return manager.Uninstall(ctx, "blog") },
+	)
+	if first != nil {
+		t.Fatalf("start: %v", first)
+	}
+	expectInProgress(t, second)
+	if app, err := manager.Get(ctx, "blog"); err != nil || app.Status != "running" {
+		t.Fatalf("expected blog running, got %+v (%v)", app, err)
+	}
+	if len(mock.containers) != 1 {
+		t.Fatalf("container removed under a running start: %d left", len(mock.containers))
+	}
+}
+
+func TestAppLocks_UpsertRacingStop(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	ctx := context.Background()
+	if _, err := manager.Install(ctx, lockTestApp("blog")); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(ctx, "blog"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	mock.stopDelay = 100 * time.Millisecond
+
+	first, second := whileHeld(t, manager,
+		func() error { return manager.Stop(ctx, "blog") },
+		func() error { _, err := manager.Upsert(ctx, lockTestApp("blog")); return err },
+	)
+	if first != nil {
+		t.Fatalf("stop: %v", first)
+	}
+	expectInProgress(t, second)
+
+	// Waiting instead of failing lets both through, one after the other.
+	manager.SetWaitForOperations(true)
+	if err := manager.Start(ctx, "blog"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	first, second = whileHeld(t, manager,
+		func() error { return manager.Stop(ctx, "blog") },
+		func() error { _, err := manager.Upsert(ctx, lockTestApp("blog")); return err },
+	)
+	if first != nil || second != nil {
+		t.Fatalf("expected both to succeed when waiting, got stop=%v upsert=%v", first, second)
+	}
+	if len(mock.containers) != 1 || manager.appLocks.size() != 0 {
+		t.Fatalf("unexpected leftovers: %d containers, %d locks", len(mock.containers), manager.appLocks.size())
+	}
+}
+
+func TestAppLocks_WaitEndsWithContext(t *testing.T) {
+	var locks appLocks
+	release, err := locks.acquire(context.Background(), "blog", "start", false)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locks.acquire(ctx, "blog", "stop", true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+	if _, err := locks.acquire(context.Background(), "notes", "stop", false); err != nil {
+		t.Fatalf("another app should not be blocked: %v", err)
+	}
+	release()
+	if locks.size() != 1 {
+		t.Fatalf("expected only the notes lock left, got %d", locks.size())
+	}
+}
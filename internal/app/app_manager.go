@@ -7,16 +7,19 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/sys/unix"
 
+	"piccolod/internal/activity"
 	"piccolod/internal/api"
 	"piccolod/internal/cluster"
 	"piccolod/internal/container"
 	"piccolod/internal/events"
+	"piccolod/internal/persistence"
 	"piccolod/internal/router"
 	"piccolod/internal/services"
 	"piccolod/internal/state/paths"
@@ -27,6 +30,8 @@ type AppManager struct {
 	containerManager ContainerManager
 	stateManager     *FilesystemStateManager
 	stateBaseDir     string
+	prevStateBase    string
+	legacyStateDir   string
 	stateInitMu      sync.Mutex
 	serviceManager   *services.ServiceManager
 	routeRegistrar   router.Registrar
@@ -42,6 +47,38 @@ type AppManager struct {
 	lockOverrideMu   sync.RWMutex
 	lockOverride     *bool
 	mountVerifier    func(string) error
+	mountFaultMu     sync.RWMutex
+	mountFaults      map[string]string
+	volumePurger     VolumePurger
+	activity         activity.Recorder
+	unlockObserver   UnlockObserver
+	depMu            sync.Mutex
+	depTimeout       time.Duration
+	autostartMu      sync.Mutex
+	autostartOff     bool
+	opMu             sync.Mutex
+	opTimeouts       OperationTimeouts
+	replaceTimeouts  ReplaceTimeouts
+	readinessProbe   readinessProbe
+	publishApp       func(app string) error // nil uses serviceManager.PublishApp
+	tasksMu          sync.Mutex
+	tasksCtx         context.Context
+	tasksCancel      context.CancelFunc
+	tasksRunning     map[string]bool // "app/task" runs in flight
+	tasksWG          sync.WaitGroup
+	logMu            sync.Mutex
+	logCollectors    map[string]*logCollector // by container ID
+	logArchives      map[string]*logArchive   // by app
+	logWG            sync.WaitGroup
+	runtimeMu        sync.Mutex
+	runtimeStatus    RuntimeStatus
+	mountMu          sync.RWMutex
+	mountAllowlist   []string
+	capMu            sync.RWMutex
+	capPolicy        CapabilityPolicy
+	appLocks         appLocks
+	opWait           bool
+	snapshotMu       sync.RWMutex
 }
 
 var (
@@ -67,10 +104,14 @@ func NewAppManagerWithServices(containerManager ContainerManager, stateDir strin
 	return &AppManager{
 		containerManager: containerManager,
 		stateBaseDir:     base,
+		legacyStateDir:   paths.Root(),
 		serviceManager:   serviceManager,
 		leadershipState:  make(map[string]cluster.Role),
 		lockReader:       lockReader,
 		mountVerifier:    defaultMountVerifier,
+		mountFaults:      make(map[string]string),
+		autostartOff:     os.Getenv(DisableAutostartEnv) == "1",
+		opWait:           os.Getenv(WaitForOperationsEnv) == "1",
 	}, nil
 }
 
@@ -88,6 +129,57 @@ func (m *AppManager) SetMountVerifier(fn func(string) error) {
 	m.stateInitMu.Unlock()
 }
 
+// SetVolumePurger wires the callback used to delete managed app volumes on purge.
+func (m *AppManager) SetVolumePurger(fn VolumePurger) {
+	m.stateMu.Lock()
+	m.volumePurger = fn
+	m.stateMu.Unlock()
+}
+
+// SetActivityRecorder wires the device activity log for lifecycle records.
+func (m *AppManager) SetActivityRecorder(rec activity.Recorder) {
+	m.stateMu.Lock()
+	m.activity = rec
+	m.stateMu.Unlock()
+}
+
+// Post-unlock work the app manager reports to its UnlockObserver.
+const (
+	UnlockStepRestore   = "restore"
+	UnlockStepAutostart = "autostart"
+)
+
+// UnlockObserver hears when a piece of post-unlock work finishes; err is nil
+// when it succeeded or had nothing to do.
+type UnlockObserver func(step string, err error)
+
+// SetUnlockObserver wires the callback told when service restore and app
+// autostart finish.
+func (m *AppManager) SetUnlockObserver(fn UnlockObserver) {
+	m.stateMu.Lock()
+	m.unlockObserver = fn
+	m.stateMu.Unlock()
+}
+
+func (m *AppManager) reportUnlockStep(step string, err error) {
+	m.stateMu.RLock()
+	fn := m.unlockObserver
+	m.stateMu.RUnlock()
+	if fn != nil {
+		fn(step, err)
+	}
+}
+
+func (m *AppManager) recordActivity(ctx context.Context, level, message string, metadata map[string]any) {
+	m.stateMu.RLock()
+	rec := m.activity
+	m.stateMu.RUnlock()
+	if rec == nil {
+		return
+	}
+	rec.Record(ctx, activity.Entry{Source: "app", Level: level, Message: message, Metadata: metadata})
+}
+
 // SetStateBaseDir overrides the base directory used for filesystem-backed state.
 func (m *AppManager) SetStateBaseDir(dir string) {
 	base := dir
@@ -97,12 +189,23 @@ func (m *AppManager) SetStateBaseDir(dir string) {
 	clean := filepath.Clean(base)
 	m.stateInitMu.Lock()
 	if clean != m.stateBaseDir {
+		m.prevStateBase = m.stateBaseDir
 		m.stateBaseDir = clean
 		m.stateManager = nil
 	}
 	m.stateInitMu.Unlock()
 }
 
+// ClearStateBaseDir leaves the manager without a state directory until the
+// next SetStateBaseDir, for a daemon started without its control volume.
+// App operations fail until then.
+func (m *AppManager) ClearStateBaseDir() {
+	m.stateInitMu.Lock()
+	m.stateBaseDir = ""
+	m.stateManager = nil
+	m.stateInitMu.Unlock()
+}
+
 func (m *AppManager) currentRouter() router.Registrar {
 	m.stateMu.RLock()
 	defer m.stateMu.RUnlock()
@@ -124,17 +227,21 @@ func (m *AppManager) ObserveRuntimeEvents(bus *events.Bus) {
 
 	leaders := bus.Subscribe(events.TopicLeadershipRoleChanged, 16)
 	locks := bus.Subscribe(events.TopicLockStateChanged, 8)
+	volumes := bus.Subscribe(events.TopicVolumeStateChanged, 16)
 	loopCtx := ctx
 
 	m.eventsWG.Add(1)
 	go func() {
 		defer m.eventsWG.Done()
+		defer bus.Unsubscribe(events.TopicLeadershipRoleChanged, leaders)
+		defer bus.Unsubscribe(events.TopicLockStateChanged, locks)
+		defer bus.Unsubscribe(events.TopicVolumeStateChanged, volumes)
 		for {
 			select {
 			case evt, ok := <-leaders:
 				if !ok {
 					leaders = nil
-					if leaders == nil && locks == nil {
+					if leaders == nil && locks == nil && volumes == nil {
 						return
 					}
 					continue
@@ -145,14 +252,24 @@ func (m *AppManager) ObserveRuntimeEvents(bus *events.Bus) {
 					continue
 				}
 				m.leadershipMu.Lock()
+				previous := m.leadershipState[string(payload.Resource)]
 				m.leadershipState[string(payload.Resource)] = payload.Role
 				m.leadershipMu.Unlock()
 				log.Printf("INFO: app-manager observed leadership change resource=%s role=%s", payload.Resource, payload.Role)
 				m.handleLeadershipChange(loopCtx, payload)
+				// A node taking over from another brings up the enabled
+				// apps; at boot the unlock does that instead.
+				if payload.Resource == cluster.ResourceKernel && previous == cluster.RoleFollower && payload.Role == cluster.RoleLeader {
+					m.eventsWG.Add(1)
+					go func() {
+						defer m.eventsWG.Done()
+						m.autostart(loopCtx)
+					}()
+				}
 			case evt, ok := <-locks:
 				if !ok {
 					locks = nil
-					if leaders == nil && locks == nil {
+					if leaders == nil && locks == nil && volumes == nil {
 						return
 					}
 					continue
@@ -169,13 +286,33 @@ func (m *AppManager) ObserveRuntimeEvents(bus *events.Bus) {
 				log.Printf("INFO: app-manager observed control lock state=%s", state)
 				if payload.Locked {
 					m.markPendingRestore()
+					// The archives live on the volume being locked.
+					m.stopLogCapture()
 				} else {
-					go m.RestoreServices(loopCtx)
+					m.eventsWG.Add(1)
+					go func() {
+						defer m.eventsWG.Done()
+						m.RestoreServices(loopCtx)
+					}()
 				}
+			case evt, ok := <-volumes:
+				if !ok {
+					volumes = nil
+					if leaders == nil && locks == nil && volumes == nil {
+						return
+					}
+					continue
+				}
+				payload, ok := evt.Payload.(events.VolumeStateChanged)
+				if !ok {
+					log.Printf("WARN: app-manager received unexpected volume payload: %#v", evt.Payload)
+					continue
+				}
+				m.observeVolumeState(payload)
 			case <-ctx.Done():
 				return
 			}
-			if leaders == nil && locks == nil {
+			if leaders == nil && locks == nil && volumes == nil {
 				return
 			}
 		}
@@ -239,14 +376,43 @@ func (m *AppManager) ensureStateManager() (*FilesystemStateManager, error) {
 	if err := m.ensureMountAvailable(base); err != nil {
 		return nil, err
 	}
+	m.migrateLegacyState(base)
 	stateMgr, err := NewFilesystemStateManager(base)
 	if err != nil {
 		return nil, err
 	}
 	m.stateManager = stateMgr
+	m.reportStateRecoveries(stateMgr)
 	return stateMgr, nil
 }
 
+// migrateLegacyState brings apps installed under the legacy state root, or
+// under the base used before the last SetStateBaseDir, into base. A failed
+// migration is logged and retried on the next load; it never blocks access
+// to the apps already in base.
+func (m *AppManager) migrateLegacyState(base string) {
+	apps, err := migrateLegacyState(base, []string{m.legacyStateDir, m.prevStateBase})
+	if err != nil {
+		log.Printf("WARN: app state: %v", err)
+	}
+	if len(apps) > 0 {
+		log.Printf("INFO: app state: migrated %s into %s", strings.Join(apps, ", "), base)
+		m.recordActivity(context.Background(), activity.LevelInfo, fmt.Sprintf("Migrated %d app(s) into the control volume", len(apps)), map[string]any{"apps": apps})
+	}
+}
+
+// reportStateRecoveries surfaces what the state scan fixed after an unclean
+// shutdown in the activity log.
+func (m *AppManager) reportStateRecoveries(state *FilesystemStateManager) {
+	for _, r := range state.TakeRecoveries() {
+		msg := fmt.Sprintf("App %s state repaired after an unclean shutdown: %s", r.App, r.Detail)
+		if r.Action == "quarantined" {
+			msg = fmt.Sprintf("App %s state could not be loaded and was quarantined; uninstall and reinstall it: %s", r.App, r.Detail)
+		}
+		m.recordActivity(context.Background(), activity.LevelWarn, msg, map[string]any{"app": r.App, "action": r.Action})
+	}
+}
+
 func (m *AppManager) ensureKernelLeader() error {
 	role := m.LastObservedRole(cluster.ResourceKernel)
 	if role == cluster.RoleFollower {
@@ -271,10 +437,12 @@ func (m *AppManager) handleLeadershipChange(ctx context.Context, change events.L
 		}
 		if reg := m.currentRouter(); reg != nil {
 			mode := router.ModeLocal
+			leader := ""
 			if change.Role == cluster.RoleFollower {
 				mode = router.ModeTunnel
+				leader = change.LeaderEndpoint
 			}
-			reg.RegisterAppRoute(appName, mode, "")
+			reg.RegisterAppRoute(appName, mode, leader)
 		}
 	}
 }
@@ -291,7 +459,38 @@ func (m *AppManager) clearPendingRestore() {
 	m.restoreMu.Unlock()
 }
 
+// observeVolumeState tracks volumes whose mount failed underneath us so state
+// access refuses to touch the bare mount directory until the mount is back.
+func (m *AppManager) observeVolumeState(change events.VolumeStateChanged) {
+	if strings.TrimSpace(change.MountDir) == "" {
+		return
+	}
+	dir := filepath.Clean(change.MountDir)
+	m.mountFaultMu.Lock()
+	defer m.mountFaultMu.Unlock()
+	switch change.Observed {
+	case "error":
+		if m.mountFaults == nil {
+			m.mountFaults = make(map[string]string)
+		}
+		m.mountFaults[dir] = change.LastError
+		log.Printf("WARN: app-manager marking volume %s unavailable: %s", change.ID, change.LastError)
+	case "mounted":
+		delete(m.mountFaults, dir)
+	}
+}
+
+func (m *AppManager) mountFault(base string) (string, bool) {
+	m.mountFaultMu.RLock()
+	defer m.mountFaultMu.RUnlock()
+	reason, ok := m.mountFaults[filepath.Clean(base)]
+	return reason, ok
+}
+
 func (m *AppManager) ensureMountAvailable(base string) error {
+	if _, faulted := m.mountFault(base); faulted {
+		return ErrVolumeUnavailable
+	}
 	if m.mountVerifier == nil {
 		m.mountVerifier = defaultMountVerifier
 	}
@@ -443,22 +642,27 @@ func (m *AppManager) RestoreServices(ctx context.Context) {
 		} else {
 			log.Printf("WARN: restore services: state unavailable: %v", err)
 		}
+		m.reportUnlockStep(UnlockStepRestore, err)
 		return
 	}
 	m.clearPendingRestore()
+	var failed []string
 	apps := state.ListApps()
 	for _, app := range apps {
 		if app.ContainerID == "" {
 			continue
 		}
+		m.noteContainerExit(ctx, state, app)
 		def, err := state.GetAppDefinition(app.Name)
 		if err != nil {
 			log.Printf("WARN: restore services: failed to read app definition for %s: %v", app.Name, err)
+			failed = append(failed, app.Name)
 			continue
 		}
-		ports, err := container.InspectPublishedPorts(ctx, app.ContainerID)
+		ports, err := hostPortsFor(ctx, app.ContainerID, def)
 		if err != nil {
 			log.Printf("WARN: restore services: podman port inspect failed for %s: %v", app.Name, err)
+			failed = append(failed, app.Name)
 			continue
 		}
 		if len(ports) == 0 {
@@ -467,10 +671,21 @@ func (m *AppManager) RestoreServices(ctx context.Context) {
 		}
 		if _, err := m.serviceManager.RestoreFromPodman(app.Name, def.Listeners, ports); err != nil {
 			log.Printf("WARN: restore services: failed to restore proxies for %s: %v", app.Name, err)
+			failed = append(failed, app.Name)
 			continue
 		}
 		m.serviceManager.SetAppContainerID(app.Name, app.ContainerID)
+		current, _ := state.GetApp(app.Name)
+		m.serviceManager.SetAppPaused(app.Name, current != nil && current.Status == AppStatusPaused)
+	}
+	var restoreErr error
+	if len(failed) > 0 {
+		restoreErr = fmt.Errorf("services not restored for %s", strings.Join(failed, ", "))
 	}
+	m.reportUnlockStep(UnlockStepRestore, restoreErr)
+	m.resumeLogCapture()
+
+	m.autostart(ctx)
 }
 
 // Install installs a new application from its definition
@@ -481,99 +696,115 @@ func (m *AppManager) Install(ctx context.Context, appDef *api.AppDefinition) (*A
 	if err := m.ensureKernelLeader(); err != nil {
 		return nil, err
 	}
+	if err := CheckAPIVersion(appDef); err != nil {
+		return nil, err
+	}
 	// Set defaults then validate
 	SetDefaults(appDef)
 	if err := ValidateAppDefinition(appDef); err != nil {
 		return nil, fmt.Errorf("invalid app definition: %w", err)
 	}
+	release, err := m.lockApp(ctx, appDef.Name, "install")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return m.installLocked(ctx, appDef)
+}
 
+// installLocked installs a validated definition while its app lock is held.
+func (m *AppManager) installLocked(ctx context.Context, appDef *api.AppDefinition) (*AppInstance, error) {
 	state, err := m.ensureStateManager()
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if app already exists
-	if _, exists := state.GetApp(appDef.Name); exists {
+	// Check if app already exists; a record without a container is a
+	// failed install kept to explain the failure, or an app whose metadata
+	// was lost in an unclean shutdown, and is replaced.
+	if existing, exists := state.GetApp(appDef.Name); exists && existing.ContainerID != "" {
 		return nil, fmt.Errorf("app already exists: %s", appDef.Name)
 	}
+	if err := m.validateDependencies(state, appDef); err != nil {
+		return nil, err
+	}
+	if err := m.checkHostMounts(appDef); err != nil {
+		return nil, err
+	}
+	if err := m.CheckCapabilities(ctx, appDef); err != nil {
+		return nil, err
+	}
 
-	return m.installWithRetries(ctx, state, appDef, 0)
+	return m.install(ctx, state, appDef)
 }
 
-func (m *AppManager) installWithRetries(ctx context.Context, state *FilesystemStateManager, appDef *api.AppDefinition, attempt int) (*AppInstance, error) {
-	if attempt >= maxInstallPortRetries {
-		return nil, fmt.Errorf("failed to install %s: exhausted host-port retries", appDef.Name)
+// recordFailure sets the app's status after a failed operation and stores
+// the error with whatever Podman reports about the container's exit.
+func (m *AppManager) recordFailure(ctx context.Context, state *FilesystemStateManager, name, containerID, status string, cause error) {
+	message := cause.Error()
+	var exitCode *int
+	if containerID != "" {
+		// The operation's budget may already be spent; inspecting is cheap.
+		ictx, cancel := context.WithTimeout(context.WithoutCancel(ctx), inspectTimeout)
+		st, err := m.containerManager.Inspect(ictx, containerID)
+		cancel()
+		if err == nil && !st.Running {
+			if !st.FinishedAt.IsZero() || st.ExitCode != 0 {
+				code := st.ExitCode
+				exitCode = &code
+			}
+			if st.Error != "" && !strings.Contains(message, st.Error) {
+				message += ": " + st.Error
+			}
+		}
 	}
-
-	// Allocate services and convert to container spec
-	endpoints, err := m.serviceManager.AllocateForApp(appDef.Name, appDef.Listeners)
-	if err != nil {
-		return nil, fmt.Errorf("failed to allocate service ports: %w", err)
+	if err := state.RecordAppFailure(name, status, message, exitCode); err != nil {
+		log.Printf("WARN: app %s: recording failure: %v", name, err)
 	}
-	cleanupServices := true
-	defer func() {
-		if cleanupServices {
-			m.serviceManager.RemoveApp(appDef.Name)
-		}
-	}()
+}
 
-	containerSpec, err := m.appDefToContainerSpec(appDef, endpoints)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create container spec: %w", err)
+// noteContainerExit records an unexpected exit for an app stored as running
+// or paused whose container is no longer up. A paused container is
+// expected, not an exit.
+func (m *AppManager) noteContainerExit(ctx context.Context, state *FilesystemStateManager, app *AppInstance) {
+	if app.Status != "running" && app.Status != AppStatusPaused {
+		return
 	}
-
-	// Create container
-	containerID, err := m.containerManager.CreateContainer(ctx, containerSpec)
+	st, err := m.containerManager.Inspect(ctx, app.ContainerID)
 	if err != nil {
-		var portErr *container.PortInUseError
-		if errors.As(err, &portErr) {
-			cleanupServices = false
-			m.serviceManager.RemoveApp(appDef.Name)
-			log.Printf("WARN: retrying install for %s due to host port conflict port=%d attempt=%d", appDef.Name, portErr.Port, attempt)
-			if portErr.Port > 0 {
-				_ = m.serviceManager.ReserveHostPort(portErr.Port)
-			} else {
-				for _, ep := range endpoints {
-					_ = m.serviceManager.ReserveHostPort(ep.HostBind)
-				}
-			}
-			return m.installWithRetries(ctx, state, appDef, attempt+1)
+		log.Printf("WARN: inspect %s container: %v", app.Name, err)
+		return
+	}
+	if st.Paused {
+		return
+	}
+	if st.Running {
+		if app.Status == AppStatusPaused {
+			// Resumed outside piccolod.
+			_ = state.UpdateAppStatus(app.Name, "running")
 		}
-		return nil, fmt.Errorf("failed to create container: %w", err)
+		return
 	}
-	// Record container ID for watcher reconciliation
-	if m.serviceManager != nil {
-		m.serviceManager.SetAppContainerID(appDef.Name, containerID)
+	if st.ExitCode == 0 && !st.OOMKilled && st.Error == "" {
+		_ = state.UpdateAppStatus(app.Name, "stopped")
+		return
 	}
-
-	// Create app instance
-	now := time.Now()
-	app := &AppInstance{
-		Name:        appDef.Name,
-		Image:       appDef.Image,
-		Type:        appDef.Type,
-		Status:      "created",
-		ContainerID: containerID,
-		Environment: appDef.Environment,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+	message := fmt.Sprintf("container %s with exit code %d", st.Status, st.ExitCode)
+	if st.OOMKilled {
+		message = "container was killed after running out of memory"
 	}
-
-	// Store app to filesystem
-	if err := state.StoreApp(app, appDef); err != nil {
-		// Cleanup container if storage fails
-		_ = m.containerManager.RemoveContainer(ctx, containerID)
-		m.serviceManager.RemoveApp(appDef.Name)
-		cleanupServices = false
-		return nil, fmt.Errorf("failed to store app: %w", err)
+	if st.Error != "" {
+		message += ": " + st.Error
+	}
+	code := st.ExitCode
+	if err := state.RecordAppFailure(app.Name, "error", message, &code); err != nil {
+		log.Printf("WARN: app %s: recording exit: %v", app.Name, err)
 	}
-
-	cleanupServices = false
-
-	return app, nil
 }
 
-// Upsert installs or updates an application by name. If the app exists, it is uninstalled and reinstalled.
+// Upsert installs or updates an application by name. An existing app keeps
+// its container; listener changes are applied to it in place or by
+// recreating it, and the result's PortUpdate says which.
 func (m *AppManager) Upsert(ctx context.Context, appDef *api.AppDefinition) (*AppInstance, error) {
 	if err := m.ensureUnlocked(); err != nil {
 		return nil, err
@@ -585,39 +816,120 @@ func (m *AppManager) Upsert(ctx context.Context, appDef *api.AppDefinition) (*Ap
 	if err != nil {
 		return nil, err
 	}
-	if existing, exists := state.GetApp(appDef.Name); exists {
+	if err := CheckAPIVersion(appDef); err != nil {
+		return nil, err
+	}
+	release, err := m.lockApp(ctx, appDef.Name, "install")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if existing, exists := state.GetApp(appDef.Name); exists && existing.ContainerID != "" {
+		if existing.Status == AppStatusPaused {
+			return nil, fmt.Errorf("%w: unpause %s before updating it", ErrAppPaused, appDef.Name)
+		}
+		if err := m.validateDependencies(state, appDef); err != nil {
+			return nil, err
+		}
+		if err := m.checkHostMounts(appDef); err != nil {
+			return nil, err
+		}
+		if err := m.CheckCapabilities(ctx, appDef); err != nil {
+			return nil, err
+		}
+		previous, _ := m.serviceManager.GetByApp(appDef.Name)
+		stored, storedErr := state.GetAppDefinition(appDef.Name)
+		if storedErr == nil {
+			if err := m.checkHostNetworkChange(stored, appDef); err != nil {
+				return nil, err
+			}
+		}
 		// Reconcile listeners first
 		rec, containerChange, err := m.serviceManager.Reconcile(appDef.Name, appDef.Listeners)
 		if err != nil {
 			return nil, fmt.Errorf("failed to reconcile services: %w", err)
 		}
 
-		// Try in-place publish updates via Podman for adds/removes/guest port changes
-		// Added
-		for _, ep := range rec.Added {
-			_ = m.containerManager.(*container.PodmanCLI).UpdatePublishAdd(ctx, existing.ContainerID, ep.HostBind, ep.GuestPort)
-		}
-		// Guest port changes: add new mapping, then remove old
-		for _, ch := range rec.GuestPortChanged {
-			_ = m.containerManager.(*container.PodmanCLI).UpdatePublishAdd(ctx, existing.ContainerID, ch.New.HostBind, ch.New.GuestPort)
-			_ = m.containerManager.(*container.PodmanCLI).UpdatePublishRemove(ctx, existing.ContainerID, ch.Old.HostBind, ch.Old.GuestPort)
-		}
-		// Removed
-		for _, ep := range rec.Removed {
-			_ = m.containerManager.(*container.PodmanCLI).UpdatePublishRemove(ctx, existing.ContainerID, ep.HostBind, ep.GuestPort)
-		}
-
+		var portUpdate string
 		if containerChange {
-			// If some podman updates failed silently, a full recreate could be a fallback in future.
+			var published map[int]int
+			portUpdate, err = m.applyPortChanges(ctx, state, existing, appDef, rec)
+			if err == nil {
+				published, err = m.verifyPublishedPorts(ctx, existing.ContainerID, rec.Endpoints)
+			}
+			if err != nil {
+				m.rollbackReconcile(state, existing, previous, published)
+				return nil, fmt.Errorf("failed to update published ports: %w", err)
+			}
 		}
 
 		// Persist new app.yaml and metadata
-		if err := state.StoreApp(existing, appDef); err != nil {
+		if err := m.commitState(func() error { return state.StoreApp(existing, appDef) }); err != nil {
 			return nil, fmt.Errorf("failed to store app: %w", err)
 		}
-		return existing, nil
+		if storedErr == nil {
+			if diff := diffDefinitions(stored, appDef, &rec); diff.Changed {
+				change := DefinitionChange{At: time.Now().UTC(), Summary: diff.Summary}
+				if err := state.RecordDefinitionChange(appDef.Name, change, maxDefinitionChanges); err != nil {
+					log.Printf("WARN: record app.yaml change for %s: %v", appDef.Name, err)
+				}
+			}
+		}
+		// Capture may have been switched on or off.
+		m.syncLogCapture(appDef.Name)
+		result := *existing
+		result.PortUpdate = portUpdate
+		return &result, nil
+	}
+	SetDefaults(appDef)
+	if err := ValidateAppDefinition(appDef); err != nil {
+		return nil, fmt.Errorf("invalid app definition: %w", err)
+	}
+	return m.installLocked(ctx, appDef)
+}
+
+// DiffDefinition compares candidate with the stored app.yaml of the app it
+// names. Port consequences come from a dry run of the listener reconcile,
+// so nothing changes.
+func (m *AppManager) DiffDefinition(ctx context.Context, candidate *api.AppDefinition) (*DefinitionDiff, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := state.GetApp(candidate.Name); !exists {
+		return nil, fmt.Errorf("app not found: %s", candidate.Name)
+	}
+	current, err := state.GetAppDefinition(candidate.Name)
+	if err != nil {
+		return nil, err
+	}
+	var rec *services.ReconcileResult
+	if _, err := m.serviceManager.GetByApp(candidate.Name); err == nil {
+		plan, _, err := m.serviceManager.PlanReconcile(candidate.Name, candidate.Listeners)
+		if err != nil {
+			return nil, err
+		}
+		rec = &plan
 	}
-	return m.Install(ctx, appDef)
+	return diffDefinitions(current, candidate, rec), nil
+}
+
+// DefinitionHistory returns the app.yaml changes Upsert applied to an app,
+// newest first.
+func (m *AppManager) DefinitionHistory(ctx context.Context, name string) ([]DefinitionChange, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	app, exists := state.GetApp(name)
+	if !exists {
+		return nil, fmt.Errorf("app not found: %s", name)
+	}
+	out := make([]DefinitionChange, 0, len(app.Changes))
+	for i := len(app.Changes) - 1; i >= 0; i-- {
+		out = append(out, app.Changes[i])
+	}
+	return out, nil
 }
 
 // List returns all installed applications
@@ -626,7 +938,32 @@ func (m *AppManager) List(ctx context.Context) ([]*AppInstance, error) {
 	if err != nil {
 		return nil, err
 	}
-	return state.ListApps(), nil
+	m.snapshotMu.RLock()
+	defer m.snapshotMu.RUnlock()
+	cached := state.ListApps()
+	apps := make([]*AppInstance, 0, len(cached))
+	live := make(map[string]bool, len(cached))
+	for _, app := range cached {
+		live[app.Name] = true
+		apps = append(apps, withEnabled(state, app))
+	}
+	// Quarantined apps stay visible so they can be uninstalled.
+	for _, q := range state.ListQuarantined() {
+		if live[q.Name] {
+			continue
+		}
+		live[q.Name] = true
+		at := q.QuarantinedAt
+		apps = append(apps, &AppInstance{
+			Name:        q.Name,
+			Status:      "corrupt",
+			CreatedAt:   at,
+			UpdatedAt:   at,
+			LastError:   q.Reason,
+			LastErrorAt: &at,
+		})
+	}
+	return apps, nil
 }
 
 // Get returns a specific application by name
@@ -635,12 +972,25 @@ func (m *AppManager) Get(ctx context.Context, name string) (*AppInstance, error)
 	if err != nil {
 		return nil, err
 	}
+	m.snapshotMu.RLock()
+	defer m.snapshotMu.RUnlock()
 	app, exists := state.GetApp(name)
 	if !exists {
 		return nil, fmt.Errorf("app not found: %s", name)
 	}
 
-	return app, nil
+	return withEnabled(state, app), nil
+}
+
+// withEnabled returns a copy of a cached app with Enabled and Warnings
+// filled in.
+func withEnabled(state *FilesystemStateManager, app *AppInstance) *AppInstance {
+	cp := *app
+	cp.Enabled = state.IsAppEnabled(app.Name)
+	if err := validateName(app.Name); err != nil {
+		cp.Warnings = []string{fmt.Sprintf("app name %q is no longer allowed (%v); reinstall the app under a new name", app.Name, err)}
+	}
+	return &cp
 }
 
 // Start starts an application
@@ -651,6 +1001,11 @@ func (m *AppManager) Start(ctx context.Context, name string) error {
 	if err := m.ensureKernelLeader(); err != nil {
 		return err
 	}
+	release, err := m.lockApp(ctx, name, "start")
+	if err != nil {
+		return err
+	}
+	defer release()
 	state, err := m.ensureStateManager()
 	if err != nil {
 		return err
@@ -660,10 +1015,17 @@ func (m *AppManager) Start(ctx context.Context, name string) error {
 		return fmt.Errorf("app not found: %s", name)
 	}
 
+	if app.ContainerID == "" {
+		return fmt.Errorf("app %s has no container; reinstall it: %s", name, app.LastError)
+	}
+	if app.Status == AppStatusPaused {
+		return fmt.Errorf("%w: unpause %s instead of starting it", ErrAppPaused, name)
+	}
+
 	// Start the container
-	if err := m.containerManager.StartContainer(ctx, app.ContainerID); err != nil {
-		// Update status to error
-		_ = state.UpdateAppStatus(name, "error")
+	if err := m.startContainer(ctx, app.ContainerID); err != nil {
+		m.recordFailure(ctx, state, name, app.ContainerID, "error", err)
+		m.recordActivity(ctx, activity.LevelError, fmt.Sprintf("App %s failed to start", name), map[string]any{"app": name, "error": err.Error()})
 		return fmt.Errorf("failed to start container: %w", err)
 	}
 
@@ -671,6 +1033,8 @@ func (m *AppManager) Start(ctx context.Context, name string) error {
 	if err := state.UpdateAppStatus(name, "running"); err != nil {
 		return fmt.Errorf("failed to update app status: %w", err)
 	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s started", name), map[string]any{"app": name})
+	m.syncLogCapture(name)
 
 	// Rehydrate service proxies if they were removed while the app was stopped
 	if _, err := m.serviceManager.GetByApp(name); err != nil {
@@ -678,7 +1042,7 @@ func (m *AppManager) Start(ctx context.Context, name string) error {
 		if defErr != nil {
 			log.Printf("WARN: start app %s: failed to load app definition: %v", name, defErr)
 		} else {
-			ports, portErr := container.InspectPublishedPorts(ctx, app.ContainerID)
+			ports, portErr := hostPortsFor(ctx, app.ContainerID, def)
 			if portErr != nil {
 				log.Printf("WARN: start app %s: inspect ports failed: %v", name, portErr)
 			} else if len(ports) == 0 {
@@ -696,15 +1060,40 @@ func (m *AppManager) Start(ctx context.Context, name string) error {
 	return nil
 }
 
-// Stop stops an application
+// Stop stops an application; it refuses while running apps depend on it.
 func (m *AppManager) Stop(ctx context.Context, name string) error {
+	return m.StopWithOptions(ctx, name, StopOptions{})
+}
+
+// StopWithOptions stops an application, optionally even while running
+// dependents need it.
+func (m *AppManager) StopWithOptions(ctx context.Context, name string, opts StopOptions) error {
 	if err := m.ensureUnlocked(); err != nil {
 		return err
 	}
 	if err := m.ensureKernelLeader(); err != nil {
 		return err
 	}
-	return m.stopInternal(ctx, name)
+	release, err := m.lockApp(ctx, name, "stop")
+	if err != nil {
+		return err
+	}
+	defer release()
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return err
+	}
+	if _, exists := state.GetApp(name); !exists {
+		return fmt.Errorf("app not found: %s", name)
+	}
+	if err := m.checkDependents(ctx, state, name, true, opts.Force); err != nil {
+		return err
+	}
+	if err := m.stopInternal(ctx, name); err != nil {
+		return err
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s stopped", name), map[string]any{"app": name})
+	return nil
 }
 
 func (m *AppManager) stopInternal(ctx context.Context, name string) error {
@@ -717,14 +1106,15 @@ func (m *AppManager) stopInternal(ctx context.Context, name string) error {
 		return fmt.Errorf("app not found: %s", name)
 	}
 
-	if err := m.containerManager.StopContainer(ctx, app.ContainerID); err != nil {
-		_ = state.UpdateAppStatus(name, "error")
+	if err := m.stopContainer(ctx, app.ContainerID); err != nil {
+		m.recordFailure(ctx, state, name, app.ContainerID, "error", err)
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
 
 	if err := state.UpdateAppStatus(name, "stopped"); err != nil {
 		return fmt.Errorf("failed to update app status: %w", err)
 	}
+	m.syncLogCapture(name)
 
 	if m.serviceManager != nil {
 		m.serviceManager.RemoveApp(name)
@@ -741,50 +1131,84 @@ func (m *AppManager) Uninstall(ctx context.Context, name string) error {
 	if err := m.ensureKernelLeader(); err != nil {
 		return err
 	}
-	return m.UninstallWithOptions(ctx, name, false)
+	_, err := m.UninstallWithOptions(ctx, name, UninstallOptions{})
+	return err
 }
 
-// UninstallWithOptions removes an application; when purge is true, also deletes app data directories
-func (m *AppManager) UninstallWithOptions(ctx context.Context, name string, purge bool) error {
+// UninstallWithOptions removes an application; with Purge it also deletes
+// the app's managed volume and host paths and reports what was removed.
+// Apps other installed apps depend on are only removed with Force.
+func (m *AppManager) UninstallWithOptions(ctx context.Context, name string, opts UninstallOptions) (PurgeReport, error) {
+	purge := opts.Purge
+	var report PurgeReport
 	if err := m.ensureUnlocked(); err != nil {
-		return err
+		return report, err
 	}
 	if err := m.ensureKernelLeader(); err != nil {
-		return err
+		return report, err
+	}
+	release, err := m.lockApp(ctx, name, "uninstall")
+	if err != nil {
+		return report, err
 	}
+	defer release()
 	state, err := m.ensureStateManager()
 	if err != nil {
-		return err
+		return report, err
 	}
 	app, exists := state.GetApp(name)
 	if !exists {
-		return fmt.Errorf("app not found: %s", name)
+		var removed bool
+		err := m.commitState(func() (err error) {
+			removed, err = state.RemoveQuarantined(name)
+			return err
+		})
+		if err != nil {
+			return report, err
+		}
+		if !removed {
+			return report, fmt.Errorf("app not found: %s", name)
+		}
+		m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("Quarantined app %s removed", name), map[string]any{"app": name})
+		return report, nil
+	}
+	if err := m.checkDependents(ctx, state, name, false, opts.Force); err != nil {
+		return report, err
 	}
 
-	// Stop container first (ignore error if already stopped)
-	_ = m.containerManager.StopContainer(ctx, app.ContainerID)
+	// Repaired apps whose metadata was lost have no known container.
+	if app.ContainerID != "" {
+		// Stop container first (ignore error if already stopped)
+		_ = m.stopContainer(ctx, app.ContainerID)
 
-	// Remove container
-	if err := m.containerManager.RemoveContainer(ctx, app.ContainerID); err != nil {
-		return fmt.Errorf("failed to remove container: %w", err)
+		// Remove container
+		if err := m.containerManager.RemoveContainer(ctx, app.ContainerID); err != nil {
+			return report, fmt.Errorf("failed to remove container: %w", err)
+		}
 	}
 
-	// Stop and remove service listeners for this app
+	// Stop and remove service listeners for this app; traffic history goes
+	// with the app (stop/start keeps it).
 	if m.serviceManager != nil {
 		m.serviceManager.RemoveApp(name)
+		m.serviceManager.ForgetAppStats(name)
 	}
 
-	// Optionally purge app data (based on app definition storage)
+	// The container is gone; its collector has nothing left to read.
+	m.stopLogCapture(name)
+
+	// Purge before dropping state so the app definition is still readable.
 	if purge {
-		_ = m.purgeAppData(name)
+		report = m.purgeAppData(ctx, state, name)
 	}
 
 	// Remove from filesystem and cache (state only)
-	if err := state.RemoveApp(name); err != nil {
-		return fmt.Errorf("failed to remove app from storage: %w", err)
+	if err := m.commitState(func() error { return state.RemoveApp(name) }); err != nil {
+		return report, fmt.Errorf("failed to remove app from storage: %w", err)
 	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s uninstalled", name), map[string]any{"app": name, "purge": purge})
 
-	return nil
+	return report, nil
 }
 
 // Enable enables an application (systemctl-style)
@@ -803,7 +1227,11 @@ func (m *AppManager) Enable(ctx context.Context, name string) error {
 		return fmt.Errorf("app not found: %s", name)
 	}
 
-	return state.EnableApp(name)
+	if err := state.EnableApp(name); err != nil {
+		return err
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s enabled", name), map[string]any{"app": name})
+	return nil
 }
 
 // Disable disables an application (systemctl-style)
@@ -822,7 +1250,11 @@ func (m *AppManager) Disable(ctx context.Context, name string) error {
 		return fmt.Errorf("app not found: %s", name)
 	}
 
-	return state.DisableApp(name)
+	if err := state.DisableApp(name); err != nil {
+		return err
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s disabled", name), map[string]any{"app": name})
+	return nil
 }
 
 // IsEnabled checks if an application is enabled
@@ -855,6 +1287,11 @@ func (m *AppManager) UpdateImage(ctx context.Context, name string, tag *string)
 	if err := m.ensureKernelLeader(); err != nil {
 		return err
 	}
+	release, err := m.lockApp(ctx, name, "update")
+	if err != nil {
+		return err
+	}
+	defer release()
 	state, err := m.ensureStateManager()
 	if err != nil {
 		return err
@@ -895,27 +1332,29 @@ func (m *AppManager) UpdateImage(ctx context.Context, name string, tag *string)
 	newDef := *curDef
 	newDef.Image = newImage
 	// Backup current YAML and validate new
-	if err := ValidateAppDefinition(&newDef); err != nil {
+	if err := validateInstalledDefinition(&newDef); err != nil {
 		return fmt.Errorf("invalid new app definition: %w", err)
 	}
 	if err := state.BackupCurrentAppDefinition(name); err != nil {
 		return fmt.Errorf("backup app.yaml: %w", err)
 	}
 	// Pull image (best effort)
-	_ = m.containerManager.PullImage(ctx, newImage)
+	_ = m.PullImage(ctx, newImage, nil)
 	// Preserve endpoints
 	endpoints, _ := m.serviceManager.GetByApp(name)
 	// Stop and remove old container
-	_ = m.containerManager.StopContainer(ctx, appInst.ContainerID)
+	_ = m.stopContainer(ctx, appInst.ContainerID)
 	_ = m.containerManager.RemoveContainer(ctx, appInst.ContainerID)
 	// Create new container with same endpoints
 	spec, err := m.appDefToContainerSpec(&newDef, endpoints)
 	if err != nil {
 		return fmt.Errorf("build container spec: %w", err)
 	}
-	newCID, err := m.containerManager.CreateContainer(ctx, spec)
+	newCID, err := m.createContainer(ctx, spec)
 	if err != nil {
-		return fmt.Errorf("create container: %w", err)
+		err = fmt.Errorf("create container: %w", err)
+		m.recordFailure(ctx, state, name, "", "error", err)
+		return err
 	}
 	if m.serviceManager != nil {
 		m.serviceManager.SetAppContainerID(name, newCID)
@@ -925,9 +1364,10 @@ func (m *AppManager) UpdateImage(ctx context.Context, name string, tag *string)
 	appInst.ContainerID = newCID
 	appInst.Status = "created"
 	appInst.UpdatedAt = time.Now()
-	if err := state.StoreApp(appInst, &newDef); err != nil {
+	if err := m.commitState(func() error { return state.StoreApp(appInst, &newDef) }); err != nil {
 		return fmt.Errorf("store app: %w", err)
 	}
+	m.syncLogCapture(name)
 	return nil
 }
 
@@ -936,6 +1376,11 @@ func (m *AppManager) Revert(ctx context.Context, name string) error {
 	if err := m.ensureUnlocked(); err != nil {
 		return err
 	}
+	release, err := m.lockApp(ctx, name, "revert")
+	if err != nil {
+		return err
+	}
+	defer release()
 	state, err := m.ensureStateManager()
 	if err != nil {
 		return err
@@ -956,20 +1401,22 @@ func (m *AppManager) Revert(ctx context.Context, name string) error {
 	// Preserve endpoints
 	endpoints, _ := m.serviceManager.GetByApp(name)
 	// Stop and remove current container
-	_ = m.containerManager.StopContainer(ctx, appInst.ContainerID)
+	_ = m.stopContainer(ctx, appInst.ContainerID)
 	_ = m.containerManager.RemoveContainer(ctx, appInst.ContainerID)
 	// Pull best-effort
 	if prevDef.Image != "" {
-		_ = m.containerManager.PullImage(ctx, prevDef.Image)
+		_ = m.PullImage(ctx, prevDef.Image, nil)
 	}
 	// Create new container from prev
 	spec, err := m.appDefToContainerSpec(prevDef, endpoints)
 	if err != nil {
 		return fmt.Errorf("build container spec: %w", err)
 	}
-	newCID, err := m.containerManager.CreateContainer(ctx, spec)
+	newCID, err := m.createContainer(ctx, spec)
 	if err != nil {
-		return fmt.Errorf("create container: %w", err)
+		err = fmt.Errorf("create container: %w", err)
+		m.recordFailure(ctx, state, name, "", "error", err)
+		return err
 	}
 	if m.serviceManager != nil {
 		m.serviceManager.SetAppContainerID(name, newCID)
@@ -979,9 +1426,10 @@ func (m *AppManager) Revert(ctx context.Context, name string) error {
 	appInst.ContainerID = newCID
 	appInst.Status = "created"
 	appInst.UpdatedAt = time.Now()
-	if err := state.StoreApp(appInst, prevDef); err != nil {
+	if err := m.commitState(func() error { return state.StoreApp(appInst, prevDef) }); err != nil {
 		return fmt.Errorf("store app: %w", err)
 	}
+	m.syncLogCapture(name)
 	return nil
 }
 
@@ -1001,6 +1449,15 @@ func (m *AppManager) Logs(ctx context.Context, name string, lines int) ([]string
 	return m.containerManager.Logs(ctx, appInst.ContainerID, lines)
 }
 
+// endpointPortMapping converts a service endpoint into its container publish mapping.
+func endpointPortMapping(ep services.ServiceEndpoint) container.PortMapping {
+	return container.PortMapping{
+		Host:      ep.HostBind,
+		Container: ep.GuestPort,
+		Protocol:  ep.Protocol.Network(),
+	}
+}
+
 // appDefToContainerSpec converts an AppDefinition to a ContainerCreateSpec
 func (m *AppManager) appDefToContainerSpec(appDef *api.AppDefinition, endpoints []services.ServiceEndpoint) (container.ContainerCreateSpec, error) {
 	spec := container.ContainerCreateSpec{
@@ -1011,10 +1468,7 @@ func (m *AppManager) appDefToContainerSpec(appDef *api.AppDefinition, endpoints
 
 	// Convert listeners to port mappings using allocated endpoints
 	for _, ep := range endpoints {
-		spec.Ports = append(spec.Ports, container.PortMapping{
-			Host:      ep.HostBind,
-			Container: ep.GuestPort,
-		})
+		spec.Ports = append(spec.Ports, endpointPortMapping(ep))
 	}
 
 	// Convert resources if present
@@ -1032,10 +1486,17 @@ func (m *AppManager) appDefToContainerSpec(appDef *api.AppDefinition, endpoints
 		}
 	}
 
-	// Set restart policy for system apps
-	if appDef.Type == "system" {
-		spec.RestartPolicy = "always"
+	if err := m.applyCapabilities(appDef, &spec); err != nil {
+		return spec, err
+	}
+
+	spec.RestartPolicy = restartPolicyFor(appDef)
+
+	volumes, err := m.hostMountVolumes(appDef)
+	if err != nil {
+		return spec, err
 	}
+	spec.Volumes = append(spec.Volumes, volumes...)
 
 	// Validate the container spec
 	if err := container.ValidateContainerSpec(spec); err != nil {
@@ -1045,55 +1506,94 @@ func (m *AppManager) appDefToContainerSpec(appDef *api.AppDefinition, endpoints
 	return spec, nil
 }
 
-// purgeAppData attempts to remove persistent and temporary storage directories for an app
-func (m *AppManager) purgeAppData(name string) error {
-	if err := m.ensureUnlocked(); err != nil {
-		return err
+// restartPolicyFor returns the container restart policy for an app: system
+// apps always restart.
+func restartPolicyFor(appDef *api.AppDefinition) string {
+	if appDef.Type == "system" {
+		return "always"
 	}
-	state, err := m.ensureStateManager()
-	if err != nil {
-		return err
+	return ""
+}
+
+// purgeAppData removes the app's persistence-managed volume and any host paths
+// declared in its definition. Host mounts belong to the admin, so storage
+// paths overlapping one are left alone. Failures are collected rather than
+// aborting so the caller learns about everything that was (or was not)
+// deleted.
+func (m *AppManager) purgeAppData(ctx context.Context, state *FilesystemStateManager, name string) PurgeReport {
+	report := PurgeReport{Volumes: []string{}, Paths: []string{}}
+
+	m.stateMu.RLock()
+	purger := m.volumePurger
+	m.stateMu.RUnlock()
+	volID := AppVolumeID(name)
+	if purger != nil {
+		removed, freed, err := purger(ctx, volID)
+		if err != nil {
+			report.Failures = append(report.Failures, PurgeFailure{Target: volID, Reason: err.Error()})
+		} else {
+			report.Volumes = append(report.Volumes, volID)
+			report.Paths = append(report.Paths, removed...)
+			report.BytesFreed += freed
+		}
 	}
+
+	purgeLogArchive(state, name, &report)
+
 	appDef, err := state.GetAppDefinition(name)
 	if err != nil {
-		// If we cannot read app.yaml, fall back to default base deletion
-		return m.purgeDefaultPaths(name)
+		report.Failures = append(report.Failures, PurgeFailure{Target: name, Reason: "app definition unreadable: " + err.Error()})
+		return report
 	}
-
-	const persistentBase = "/var/piccolo/storage"
-	const temporaryBase = "/tmp/piccolo/apps"
-
-	var toRemove []string
-	if appDef.Storage != nil {
-		for volName, vol := range appDef.Storage.Persistent {
-			if vol.Host != "" {
-				toRemove = append(toRemove, vol.Host)
-			} else {
-				toRemove = append(toRemove, filepath.Join(persistentBase, name, volName))
-			}
+	mounts := hostMountPaths(appDef)
+	for _, host := range definitionHostPaths(appDef) {
+		if overlapsAny(host, mounts) {
+			continue
 		}
-		for volName, vol := range appDef.Storage.Temporary {
-			if vol.Host != "" {
-				toRemove = append(toRemove, vol.Host)
-			} else {
-				toRemove = append(toRemove, filepath.Join(temporaryBase, name, volName))
+		if _, err := os.Lstat(host); err != nil {
+			if os.IsNotExist(err) {
+				continue
 			}
+			report.Failures = append(report.Failures, PurgeFailure{Target: host, Reason: err.Error()})
+			continue
 		}
+		size := persistence.DirSize(host)
+		if err := os.RemoveAll(host); err != nil {
+			report.Failures = append(report.Failures, PurgeFailure{Target: host, Reason: err.Error()})
+			continue
+		}
+		report.Paths = append(report.Paths, host)
+		report.BytesFreed += size
 	}
-
-	for _, p := range toRemove {
-		_ = os.RemoveAll(p)
-	}
-	return nil
+	return report
 }
 
-func (m *AppManager) purgeDefaultPaths(name string) error {
-	if err := m.ensureUnlocked(); err != nil {
-		return err
+// definitionHostPaths lists the distinct host paths bound by an app's storage
+// declarations in a stable order.
+func definitionHostPaths(appDef *api.AppDefinition) []string {
+	if appDef == nil || appDef.Storage == nil {
+		return nil
 	}
-	const persistentBase = "/var/piccolo/storage"
-	const temporaryBase = "/tmp/piccolo/apps"
-	_ = os.RemoveAll(filepath.Join(persistentBase, name))
-	_ = os.RemoveAll(filepath.Join(temporaryBase, name))
-	return nil
+	seen := make(map[string]struct{})
+	var out []string
+	add := func(host string) {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			return
+		}
+		host = filepath.Clean(host)
+		if _, ok := seen[host]; ok {
+			return
+		}
+		seen[host] = struct{}{}
+		out = append(out, host)
+	}
+	for _, vol := range appDef.Storage.Persistent {
+		add(vol.Host)
+	}
+	for _, vol := range appDef.Storage.Temporary {
+		add(vol.Host)
+	}
+	sort.Strings(out)
+	return out
 }
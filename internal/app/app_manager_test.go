@@ -5,12 +5,14 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"piccolod/internal/api"
 	"piccolod/internal/cluster"
+	"piccolod/internal/container"
 	"piccolod/internal/events"
 	"piccolod/internal/router"
 	"piccolod/internal/services"
@@ -321,11 +323,14 @@ func TestAppManager_RouterUpdatesOnLeadership(t *testing.T) {
 		t.Fatalf("expected local route when leader, got %s", routeMgr.AppRoute("demo").Mode)
 	}
 
-	bus.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: cluster.ResourceForApp("demo"), Role: cluster.RoleFollower}})
+	bus.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: cluster.ResourceForApp("demo"), Role: cluster.RoleFollower, LeaderEndpoint: "10.0.0.7"}})
 
 	if !waitFor(func() bool { return routeMgr.AppRoute("demo").Mode == router.ModeTunnel }) {
 		t.Fatalf("expected tunnel route when follower, got %s", routeMgr.AppRoute("demo").Mode)
 	}
+	if leader := routeMgr.AppRoute("demo").LeaderAddr; leader != "10.0.0.7" {
+		t.Fatalf("expected tunnel route to carry leader endpoint, got %q", leader)
+	}
 }
 
 // TestAppManager_List tests listing apps from filesystem
@@ -364,7 +369,7 @@ func TestAppManager_List(t *testing.T) {
 
 	// Install two apps
 	appDef1 := &api.AppDefinition{Name: "app1", Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
-	appDef2 := &api.AppDefinition{Name: "app2", Image: "alpine:latest", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
+	appDef2 := &api.AppDefinition{Name: "app2", Image: "alpine:latest", Type: "user", Listeners: []api.AppListener{{Name: "dashboard", GuestPort: 80}}}
 
 	_, err = manager.Install(ctx, appDef1)
 	if err != nil {
@@ -413,6 +418,44 @@ func TestAppManager_RequiresMountedVolume(t *testing.T) {
 	}
 }
 
+func TestAppManager_VolumeFailureBlocksStateAccess(t *testing.T) {
+	tempDir := t.TempDir()
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+
+	bus := events.NewBus()
+	manager.ObserveRuntimeEvents(bus)
+	defer manager.StopRuntimeEvents()
+
+	waitFor := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			_, err := manager.List(context.Background())
+			if errors.Is(err, ErrVolumeUnavailable) == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for volume unavailable=%v", want)
+	}
+
+	waitFor(false)
+	bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{
+		ID: "control", MountDir: tempDir, Desired: "mounted", Observed: "error", LastError: "gocryptfs exited unexpectedly",
+	}})
+	waitFor(true)
+	bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{
+		ID: "control", MountDir: tempDir, Desired: "mounted", Observed: "mounted",
+	}})
+	waitFor(false)
+}
+
 // TestAppManager_Get tests getting specific app
 func TestAppManager_Get(t *testing.T) {
 	// Create temporary directory for test
@@ -663,6 +706,93 @@ func TestAppManager_Uninstall(t *testing.T) {
 	}
 }
 
+func TestAppManager_UninstallPurgesManagedVolume(t *testing.T) {
+	tempDir := t.TempDir()
+	mockContainer := NewMockContainerManager()
+	manager, err := NewAppManager(mockContainer, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+
+	var purged []string
+	manager.SetVolumePurger(func(ctx context.Context, volumeID string) ([]string, int64, error) {
+		purged = append(purged, volumeID)
+		return []string{"/ciphertext/" + volumeID}, 2048, nil
+	})
+
+	ctx := context.Background()
+	appDef := &api.AppDefinition{Name: "vault", Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
+	if _, err := manager.Install(ctx, appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	report, err := manager.UninstallWithOptions(ctx, "vault", UninstallOptions{Purge: true})
+	if err != nil {
+		t.Fatalf("Failed to uninstall app: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != "app-vault" {
+		t.Fatalf("expected managed volume app-vault purged, got %v", purged)
+	}
+	if len(report.Volumes) != 1 || report.Volumes[0] != "app-vault" {
+		t.Fatalf("unexpected volumes in report: %+v", report)
+	}
+	if report.BytesFreed != 2048 || len(report.Failures) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestAppManager_UninstallPurgesHostPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	mockContainer := NewMockContainerManager()
+	manager, err := NewAppManager(mockContainer, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	manager.SetVolumePurger(func(ctx context.Context, volumeID string) ([]string, int64, error) {
+		return nil, 0, errors.New("volume busy")
+	})
+
+	hostDir := filepath.Join(t.TempDir(), "data")
+	if err := os.MkdirAll(hostDir, 0o755); err != nil {
+		t.Fatalf("mkdir host dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "db.sqlite"), make([]byte, 1000), 0o644); err != nil {
+		t.Fatalf("write host file: %v", err)
+	}
+
+	ctx := context.Background()
+	appDef := &api.AppDefinition{
+		Name:      "notes",
+		Image:     "nginx:alpine",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+		Storage: &api.AppStorage{Persistent: map[string]api.AppVolume{
+			"data": {Container: "/data", Host: hostDir},
+		}},
+	}
+	if _, err := manager.Install(ctx, appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	report, err := manager.UninstallWithOptions(ctx, "notes", UninstallOptions{Purge: true})
+	if err != nil {
+		t.Fatalf("Failed to uninstall app: %v", err)
+	}
+	if _, err := os.Stat(hostDir); !os.IsNotExist(err) {
+		t.Fatalf("expected host dir removed, stat err=%v", err)
+	}
+	if len(report.Paths) != 1 || report.Paths[0] != hostDir || report.BytesFreed != 1000 {
+		t.Fatalf("unexpected report paths: %+v", report)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Target != "app-notes" || report.Failures[0].Reason != "volume busy" {
+		t.Fatalf("expected volume failure in report, got %+v", report.Failures)
+	}
+}
+
 // TestAppManager_EnableDisable tests systemctl-style enable/disable functionality
 func TestAppManager_EnableDisable(t *testing.T) {
 	// Create temporary directory for test
@@ -893,3 +1023,145 @@ func TestAppManager_BlockedWhenLocked(t *testing.T) {
 		t.Fatalf("expected ErrLocked, got %v", err)
 	}
 }
+
+func TestAppManager_StartFailureRecordsExitCode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fs_manager_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	ctx := context.Background()
+
+	inst, err := manager.Install(ctx, &api.AppDefinition{Name: "broken", Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}})
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	mock.startError = errors.New("podman start failed: exit status 125")
+	mock.states = map[string]container.ContainerState{
+		inst.ContainerID: {Status: "created", ExitCode: 127, Error: "executable file not found in $PATH"},
+	}
+	if err := manager.Start(ctx, "broken"); err == nil {
+		t.Fatalf("expected start failure")
+	}
+
+	// The failure survives a reload from disk.
+	reloaded, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	allowHostStorage(t, reloaded)
+	reloaded.ForceLockState(false)
+	got, err := reloaded.Get(ctx, "broken")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != "error" || got.ExitCode == nil || *got.ExitCode != 127 || got.LastErrorAt == nil {
+		t.Fatalf("failure not recorded: %+v", got)
+	}
+	if !strings.Contains(got.LastError, "exit status 125") || !strings.Contains(got.LastError, "executable file not found") {
+		t.Fatalf("last error = %q", got.LastError)
+	}
+
+	// A later successful start clears it.
+	mock.startError = nil
+	delete(mock.states, inst.ContainerID)
+	if err := reloaded.Start(ctx, "broken"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	got, _ = reloaded.Get(ctx, "broken")
+	if got.LastError != "" || got.ExitCode != nil {
+		t.Fatalf("failure not cleared after start: %+v", got)
+	}
+}
+
+func TestAppManager_FailedInstallKeepsCreateError(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fs_manager_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	ctx := context.Background()
+
+	def := &api.AppDefinition{Name: "wrong-arch", Image: "example/arm-only:1", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
+	mock.createError = errors.New("image platform (linux/arm64) does not match the expected platform (linux/amd64)")
+	_, err = manager.Install(ctx, def)
+	var installErr *InstallError
+	if !errors.As(err, &installErr) || installErr.Step != InstallStepCreateContainer || !strings.Contains(err.Error(), "does not match the expected platform") {
+		t.Fatalf("expected create failure, got %v", err)
+	}
+	got, err := manager.Get(ctx, "wrong-arch")
+	if err != nil {
+		t.Fatalf("failed install should stay visible: %v", err)
+	}
+	if got.Status != "created" || got.ContainerID != "" || !strings.Contains(got.LastError, "create container: image platform (linux/arm64) does not match") {
+		t.Fatalf("create error not kept: %+v", got)
+	}
+	if err := manager.Start(ctx, "wrong-arch"); err == nil || !strings.Contains(err.Error(), "no container") {
+		t.Fatalf("start without container: %v", err)
+	}
+
+	// Installing again replaces the placeholder.
+	mock.createError = nil
+	inst, err := manager.Install(ctx, def)
+	if err != nil {
+		t.Fatalf("reinstall: %v", err)
+	}
+	if inst.ContainerID == "" || inst.LastError != "" {
+		t.Fatalf("reinstall did not replace placeholder: %+v", inst)
+	}
+}
+
+func TestAppManager_NoteContainerExit(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fs_manager_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	ctx := context.Background()
+
+	inst, err := manager.Install(ctx, &api.AppDefinition{Name: "oom", Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}})
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(ctx, "oom"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	mock.states = map[string]container.ContainerState{
+		inst.ContainerID: {Status: "exited", ExitCode: 137, OOMKilled: true, FinishedAt: time.Now()},
+	}
+	state, err := manager.ensureStateManager()
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	app, _ := state.GetApp("oom")
+	manager.noteContainerExit(ctx, state, app)
+
+	got, _ := manager.Get(ctx, "oom")
+	if got.Status != "error" || got.ExitCode == nil || *got.ExitCode != 137 || !strings.Contains(got.LastError, "out of memory") {
+		t.Fatalf("dead container not noted: %+v", got)
+	}
+}
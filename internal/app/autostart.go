@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"piccolod/internal/activity"
+)
+
+// DisableAutostartEnv set to 1 stops enabled apps from being started when
+// the control store unlocks or this node becomes kernel leader.
+const DisableAutostartEnv = "PICCOLO_DISABLE_AUTOSTART"
+
+// SetAutostart turns boot-time starting of enabled apps on or off.
+func (m *AppManager) SetAutostart(enabled bool) {
+	m.autostartMu.Lock()
+	m.autostartOff = !enabled
+	m.autostartMu.Unlock()
+}
+
+// autostart starts every enabled app that is not running, in dependency
+// order, records what happened to each and reports the outcome to the
+// unlock observer. Runs are serialized, so an unlock and a leadership change
+// arriving together start each app once.
+func (m *AppManager) autostart(ctx context.Context) {
+	m.autostartMu.Lock()
+	defer m.autostartMu.Unlock()
+	m.reportUnlockStep(UnlockStepAutostart, m.startEnabledApps(ctx))
+}
+
+func (m *AppManager) startEnabledApps(ctx context.Context) error {
+	if err := m.ensureUnlocked(); err != nil {
+		return err
+	}
+	if m.ensureKernelLeader() != nil {
+		return nil
+	}
+	if m.autostartOff {
+		log.Printf("INFO: autostart: disabled; enabled apps left as they are")
+		return nil
+	}
+	results, err := m.StartApps(ctx, nil)
+	if err != nil {
+		log.Printf("WARN: autostart: start enabled apps: %v", err)
+		return err
+	}
+	var notStarted []string
+	for _, res := range results {
+		meta := map[string]any{"app": res.App, "result": res.Result}
+		switch res.Result {
+		case StartResultStarted:
+			log.Printf("INFO: autostart: %s started", res.App)
+			m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s started on boot", res.App), meta)
+		case StartResultAlreadyRunning:
+			log.Printf("INFO: autostart: %s already running", res.App)
+		case StartResultPaused:
+			log.Printf("INFO: autostart: %s paused; left as it is", res.App)
+		default:
+			log.Printf("WARN: autostart: %s %s: %s", res.App, res.Result, res.Error)
+			meta["error"] = res.Error
+			level := activity.LevelError
+			if res.Result == StartResultSkipped {
+				level = activity.LevelWarn
+			}
+			m.recordActivity(ctx, level, fmt.Sprintf("App %s was not started on boot: %s", res.App, res.Error), meta)
+			notStarted = append(notStarted, res.App)
+		}
+	}
+	if len(notStarted) > 0 {
+		return fmt.Errorf("apps not started: %s", strings.Join(notStarted, ", "))
+	}
+	return nil
+}
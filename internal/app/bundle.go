@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"piccolod/internal/api"
+)
+
+// BundleFormat identifies the app bundle layout produced by ExportBundle.
+const BundleFormat = "piccolo.app-bundle/v1"
+
+// BundlePlaceholder replaces environment values that look like secrets in an
+// exported bundle. They have to be supplied again on import.
+const BundlePlaceholder = "<required>"
+
+var secretEnvKey = regexp.MustCompile(`(?i)(secret|passw(or)?d|token|api_?key|private|credential|auth)`)
+
+// AppBundle is a shareable description of an installed app: its definition,
+// the volumes it declares (not their data) and whether it was enabled and
+// running.
+type AppBundle struct {
+	Format       string               `yaml:"format" json:"format"`
+	ExportedAt   time.Time            `yaml:"exported_at" json:"exported_at"`
+	App          *api.AppDefinition   `yaml:"app" json:"app"`
+	Enabled      bool                 `yaml:"enabled" json:"enabled"`
+	Running      bool                 `yaml:"running" json:"running"`
+	Volumes      []BundleVolume       `yaml:"volumes,omitempty" json:"volumes,omitempty"`
+	Listeners    []BundleListenerHint `yaml:"listeners,omitempty" json:"listeners,omitempty"`
+	Placeholders []string             `yaml:"placeholders,omitempty" json:"placeholders,omitempty"`
+}
+
+// BundleVolume declares a storage volume the app expects to exist.
+type BundleVolume struct {
+	Name      string `yaml:"name" json:"name"`
+	Kind      string `yaml:"kind" json:"kind"` // "persistent" or "temporary"
+	Container string `yaml:"container" json:"container"`
+	SizeLimit string `yaml:"size_limit,omitempty" json:"size_limit,omitempty"`
+}
+
+// BundleListenerHint records the ports a listener had on the exporting
+// device. Ports are reallocated on import; the hint is informational.
+type BundleListenerHint struct {
+	Name       string `yaml:"name" json:"name"`
+	GuestPort  int    `yaml:"guest_port" json:"guest_port"`
+	PublicPort int    `yaml:"public_port,omitempty" json:"public_port,omitempty"`
+}
+
+// MissingValuesError lists placeholder environment values an import still
+// needs.
+type MissingValuesError struct {
+	Keys []string
+}
+
+func (e *MissingValuesError) Error() string {
+	return "values required for: " + strings.Join(e.Keys, ", ")
+}
+
+// ExportBundle assembles a bundle for the named app with secret-looking
+// environment values replaced by BundlePlaceholder.
+func (m *AppManager) ExportBundle(ctx context.Context, name string) (*AppBundle, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	inst, exists := state.GetApp(name)
+	if !exists {
+		return nil, fmt.Errorf("app not found: %s", name)
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &AppBundle{
+		Format:     BundleFormat,
+		ExportedAt: time.Now().UTC(),
+		App:        def,
+		Enabled:    state.IsAppEnabled(name),
+		Running:    inst.Status == "running",
+	}
+	for key, value := range def.Environment {
+		if value != "" && secretEnvKey.MatchString(key) {
+			def.Environment[key] = BundlePlaceholder
+		}
+	}
+	bundle.Placeholders = placeholderKeys(def)
+	if def.Storage != nil {
+		bundle.Volumes = append(bundle.Volumes, bundleVolumes("persistent", def.Storage.Persistent)...)
+		bundle.Volumes = append(bundle.Volumes, bundleVolumes("temporary", def.Storage.Temporary)...)
+	}
+	if m.serviceManager != nil {
+		if eps, err := m.serviceManager.GetByApp(name); err == nil {
+			for _, ep := range eps {
+				bundle.Listeners = append(bundle.Listeners, BundleListenerHint{Name: ep.Name, GuestPort: ep.GuestPort, PublicPort: ep.PublicPort})
+			}
+			sort.Slice(bundle.Listeners, func(i, j int) bool { return bundle.Listeners[i].Name < bundle.Listeners[j].Name })
+		}
+	}
+	return bundle, nil
+}
+
+// Resolve fills placeholders from values and returns the validated app
+// definition. A *MissingValuesError lists any placeholders left unfilled.
+func (b *AppBundle) Resolve(values map[string]string) (*api.AppDefinition, error) {
+	if b == nil || b.App == nil {
+		return nil, errors.New("bundle has no app definition")
+	}
+	if b.Format != "" && b.Format != BundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format %q", b.Format)
+	}
+	// Work on a copy so the bundle can be resolved again with more values.
+	data, err := yaml.Marshal(b.App)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy app definition: %w", err)
+	}
+	var def api.AppDefinition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to copy app definition: %w", err)
+	}
+	for key, value := range def.Environment {
+		if value != BundlePlaceholder {
+			continue
+		}
+		if v, ok := values[key]; ok && v != BundlePlaceholder {
+			def.Environment[key] = v
+		}
+	}
+	if missing := placeholderKeys(&def); len(missing) > 0 {
+		return nil, &MissingValuesError{Keys: missing}
+	}
+	SetDefaults(&def)
+	if err := ValidateAppDefinition(&def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+func placeholderKeys(def *api.AppDefinition) []string {
+	var keys []string
+	for key, value := range def.Environment {
+		if value == BundlePlaceholder {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bundleVolumes(kind string, vols map[string]api.AppVolume) []BundleVolume {
+	names := make([]string, 0, len(vols))
+	for name := range vols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]BundleVolume, 0, len(names))
+	for _, name := range names {
+		v := vols[name]
+		out = append(out, BundleVolume{Name: name, Kind: kind, Container: v.Container, SizeLimit: v.SizeLimit})
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"piccolod/internal/api"
+)
+
+func TestAppBundle_ResolvePlaceholders(t *testing.T) {
+	bundle := &AppBundle{
+		Format: BundleFormat,
+		App: &api.AppDefinition{
+			Name:      "notes",
+			Image:     "docker.io/library/nginx:alpine",
+			Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+			Environment: map[string]string{
+				"LOG_LEVEL":   "info",
+				"DB_PASSWORD": BundlePlaceholder,
+				"API_TOKEN":   BundlePlaceholder,
+			},
+		},
+	}
+
+	_, err := bundle.Resolve(map[string]string{"API_TOKEN": "tok"})
+	var missing *MissingValuesError
+	if !errors.As(err, &missing) || strings.Join(missing.Keys, ",") != "DB_PASSWORD" {
+		t.Fatalf("expected DB_PASSWORD to be reported missing, got %v", err)
+	}
+
+	def, err := bundle.Resolve(map[string]string{"API_TOKEN": "tok", "DB_PASSWORD": "pw"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if def.Environment["DB_PASSWORD"] != "pw" || def.Environment["LOG_LEVEL"] != "info" || def.Type != "user" {
+		t.Fatalf("unexpected resolved definition: %+v", def)
+	}
+	if bundle.App.Environment["DB_PASSWORD"] != BundlePlaceholder {
+		t.Fatalf("resolve must not modify the bundle")
+	}
+
+	bundle.Format = "other/v9"
+	if _, err := bundle.Resolve(nil); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
@@ -0,0 +1,413 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+)
+
+// ErrCapabilityNotAllowed is returned when an app declares capabilities the
+// app policy denies, or that need confirmation the install did not give.
+var ErrCapabilityNotAllowed = errors.New("app manager: capability not allowed")
+
+// App policy modes. Capabilities the policy does not list are denied.
+const (
+	CapabilityDeny    = "deny"
+	CapabilityConfirm = "confirm"
+	CapabilityAllow   = "allow"
+)
+
+// Kinds of capability an app can declare.
+const (
+	CapabilityKindDevice      = "device"
+	CapabilityKindLinux       = "linux"
+	CapabilityKindHostNetwork = "host_network"
+)
+
+// linuxCapabilities are the capability names capabilities.linux accepts,
+// without the CAP_ prefix.
+var linuxCapabilities = map[string]bool{
+	"AUDIT_CONTROL": true, "AUDIT_READ": true, "AUDIT_WRITE": true,
+	"BLOCK_SUSPEND": true, "BPF": true, "CHECKPOINT_RESTORE": true,
+	"CHOWN": true, "DAC_OVERRIDE": true, "DAC_READ_SEARCH": true,
+	"FOWNER": true, "FSETID": true, "IPC_LOCK": true, "IPC_OWNER": true,
+	"KILL": true, "LEASE": true, "LINUX_IMMUTABLE": true, "MAC_ADMIN": true,
+	"MAC_OVERRIDE": true, "MKNOD": true, "NET_ADMIN": true,
+	"NET_BIND_SERVICE": true, "NET_BROADCAST": true, "NET_RAW": true,
+	"PERFMON": true, "SETFCAP": true, "SETGID": true, "SETPCAP": true,
+	"SETUID": true, "SYSLOG": true, "SYS_ADMIN": true, "SYS_BOOT": true,
+	"SYS_CHROOT": true, "SYS_MODULE": true, "SYS_NICE": true,
+	"SYS_PACCT": true, "SYS_PTRACE": true, "SYS_RAWIO": true,
+	"SYS_RESOURCE": true, "SYS_TIME": true, "SYS_TTY_CONFIG": true,
+	"WAKE_ALARM": true,
+}
+
+// broadCapabilities are Linux capabilities that hand an app control well
+// beyond its own container.
+var broadCapabilities = map[string]string{
+	"SYS_ADMIN":       "amounts to root on the host",
+	"SYS_MODULE":      "can load kernel modules",
+	"SYS_RAWIO":       "allows raw I/O to host devices and memory",
+	"SYS_PTRACE":      "can inspect other processes",
+	"SYS_BOOT":        "can reboot the host",
+	"DAC_READ_SEARCH": "bypasses file read permission checks",
+	"DAC_OVERRIDE":    "bypasses file permission checks",
+	"NET_ADMIN":       "can reconfigure networking",
+	"BPF":             "can load BPF programs",
+	"MAC_ADMIN":       "can change the mandatory access control policy",
+}
+
+// broadDevices are device path prefixes that reach past a single piece of
+// hardware.
+var broadDevices = []struct{ prefix, reason string }{
+	{"/dev/mem", "exposes host memory"},
+	{"/dev/kmem", "exposes host memory"},
+	{"/dev/port", "exposes host I/O ports"},
+	{"/dev/sd", "gives raw access to a disk"},
+	{"/dev/nvme", "gives raw access to a disk"},
+	{"/dev/mmcblk", "gives raw access to a disk"},
+	{"/dev/vd", "gives raw access to a disk"},
+	{"/dev/dm-", "gives raw access to a disk"},
+	{"/dev/bus/usb", "passes every USB device"},
+}
+
+// CapabilityPolicy decides which declared capabilities apps are granted:
+// "allow" grants them, "confirm" grants them when the install is confirmed,
+// anything else denies them.
+type CapabilityPolicy struct {
+	// Devices maps a device path, or a directory of devices such as
+	// /dev/dri, to a mode; the most specific entry wins.
+	Devices map[string]string `json:"devices"`
+	// Linux maps a capability name without the CAP_ prefix to a mode.
+	Linux       map[string]string `json:"linux"`
+	HostNetwork string            `json:"host_network"`
+}
+
+// CapabilityStatus describes a capability an app declares and what the app
+// policy says about it.
+type CapabilityStatus struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name,omitempty"`
+	Mode    string `json:"mode"`
+	Granted bool   `json:"granted"`
+}
+
+func (c CapabilityStatus) String() string {
+	if c.Name == "" {
+		return c.Kind
+	}
+	return c.Kind + " " + c.Name
+}
+
+// CapabilityError lists the capabilities that kept an app from being
+// installed.
+type CapabilityError struct {
+	App string
+	// Denied are refused by the app policy.
+	Denied []CapabilityStatus
+	// Unconfirmed need confirmation the install did not give.
+	Unconfirmed []CapabilityStatus
+}
+
+func (e *CapabilityError) Error() string {
+	if len(e.Denied) > 0 {
+		return fmt.Sprintf("%v: %s declares %s", ErrCapabilityNotAllowed, e.App, joinCapabilities(e.Denied))
+	}
+	return fmt.Sprintf("%v: %s declares %s, which must be confirmed", ErrCapabilityNotAllowed, e.App, joinCapabilities(e.Unconfirmed))
+}
+
+func (e *CapabilityError) Is(target error) bool { return target == ErrCapabilityNotAllowed }
+
+func joinCapabilities(caps []CapabilityStatus) string {
+	names := make([]string, len(caps))
+	for i, c := range caps {
+		names[i] = c.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// CanonicalCapability upper-cases a Linux capability name and drops its
+// CAP_ prefix.
+func CanonicalCapability(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CAP_")
+}
+
+// NormalizeCapabilityPolicy cleans device paths and capability names and
+// refuses unknown modes, capabilities and paths outside /dev.
+func NormalizeCapabilityPolicy(p CapabilityPolicy) (CapabilityPolicy, error) {
+	out := CapabilityPolicy{
+		Devices:     make(map[string]string, len(p.Devices)),
+		Linux:       make(map[string]string, len(p.Linux)),
+		HostNetwork: CapabilityDeny,
+	}
+	for dev, mode := range p.Devices {
+		if !validCapabilityMode(mode) {
+			return CapabilityPolicy{}, fmt.Errorf("device %q: mode must be allow, confirm or deny", dev)
+		}
+		clean := filepath.Clean(strings.TrimSpace(dev))
+		if !filepath.IsAbs(clean) || !pathWithin(clean, "/dev") {
+			return CapabilityPolicy{}, fmt.Errorf("device %q must be /dev or a path below it", dev)
+		}
+		out.Devices[clean] = mode
+	}
+	for name, mode := range p.Linux {
+		if !validCapabilityMode(mode) {
+			return CapabilityPolicy{}, fmt.Errorf("capability %q: mode must be allow, confirm or deny", name)
+		}
+		capName := CanonicalCapability(name)
+		if !linuxCapabilities[capName] {
+			return CapabilityPolicy{}, fmt.Errorf("%q is not a Linux capability", name)
+		}
+		out.Linux[capName] = mode
+	}
+	if p.HostNetwork != "" {
+		if !validCapabilityMode(p.HostNetwork) {
+			return CapabilityPolicy{}, fmt.Errorf("host_network: mode must be allow, confirm or deny")
+		}
+		out.HostNetwork = p.HostNetwork
+	}
+	return out, nil
+}
+
+func validCapabilityMode(mode string) bool {
+	return mode == CapabilityAllow || mode == CapabilityConfirm || mode == CapabilityDeny
+}
+
+// SetCapabilityPolicy replaces the app policy with a normalized one. Until
+// it is called every capability is denied.
+func (m *AppManager) SetCapabilityPolicy(p CapabilityPolicy) {
+	m.capMu.Lock()
+	m.capPolicy = p
+	m.capMu.Unlock()
+}
+
+// CapabilityPolicy returns the app policy.
+func (m *AppManager) CapabilityPolicy() CapabilityPolicy {
+	m.capMu.RLock()
+	defer m.capMu.RUnlock()
+	out := CapabilityPolicy{
+		Devices:     make(map[string]string, len(m.capPolicy.Devices)),
+		Linux:       make(map[string]string, len(m.capPolicy.Linux)),
+		HostNetwork: m.capPolicy.HostNetwork,
+	}
+	for k, v := range m.capPolicy.Devices {
+		out.Devices[k] = v
+	}
+	for k, v := range m.capPolicy.Linux {
+		out.Linux[k] = v
+	}
+	if out.HostNetwork == "" {
+		out.HostNetwork = CapabilityDeny
+	}
+	return out
+}
+
+// mode returns the policy's mode for one capability.
+func (p CapabilityPolicy) mode(kind, name string) string {
+	var mode string
+	switch kind {
+	case CapabilityKindDevice:
+		best := ""
+		for dev, m := range p.Devices {
+			if pathWithin(name, dev) && len(dev) > len(best) {
+				best, mode = dev, m
+			}
+		}
+	case CapabilityKindLinux:
+		mode = p.Linux[name]
+	case CapabilityKindHostNetwork:
+		mode = p.HostNetwork
+	}
+	if !validCapabilityMode(mode) {
+		return CapabilityDeny
+	}
+	return mode
+}
+
+// declaredCapabilities lists what an app declares in a stable order.
+func declaredCapabilities(appDef *api.AppDefinition) []CapabilityStatus {
+	if appDef == nil || appDef.Capabilities == nil {
+		return nil
+	}
+	caps := appDef.Capabilities
+	out := make([]CapabilityStatus, 0, len(caps.Devices)+len(caps.Linux)+1)
+	for _, dev := range caps.Devices {
+		out = append(out, CapabilityStatus{Kind: CapabilityKindDevice, Name: filepath.Clean(dev)})
+	}
+	for _, name := range caps.Linux {
+		out = append(out, CapabilityStatus{Kind: CapabilityKindLinux, Name: CanonicalCapability(name)})
+	}
+	if caps.HostNetwork {
+		out = append(out, CapabilityStatus{Kind: CapabilityKindHostNetwork})
+	}
+	return out
+}
+
+// evaluateCapabilities applies the app policy to what appDef declares.
+func (m *AppManager) evaluateCapabilities(appDef *api.AppDefinition) []CapabilityStatus {
+	policy := m.CapabilityPolicy()
+	out := declaredCapabilities(appDef)
+	for i := range out {
+		out[i].Mode = policy.mode(out[i].Kind, out[i].Name)
+		out[i].Granted = out[i].Mode != CapabilityDeny
+	}
+	return out
+}
+
+type confirmCapabilitiesKey struct{}
+
+// ConfirmCapabilities marks ctx so installs grant capabilities the app
+// policy only allows with confirmation.
+func ConfirmCapabilities(ctx context.Context) context.Context {
+	return context.WithValue(ctx, confirmCapabilitiesKey{}, true)
+}
+
+func capabilitiesConfirmed(ctx context.Context) bool {
+	v, ok := ctx.Value(confirmCapabilitiesKey{}).(bool)
+	return ok && v
+}
+
+// CheckCapabilities refuses an app definition declaring capabilities the
+// app policy denies, or ones it only allows with confirmation unless ctx
+// carries it. Capabilities the installed version of the app already
+// declares count as confirmed.
+func (m *AppManager) CheckCapabilities(ctx context.Context, appDef *api.AppDefinition) error {
+	statuses := m.evaluateCapabilities(appDef)
+	if len(statuses) == 0 {
+		return nil
+	}
+	confirmed := capabilitiesConfirmed(ctx)
+	installed := map[string]bool{}
+	if !confirmed {
+		if state, err := m.ensureStateManager(); err == nil {
+			if prev, err := state.GetAppDefinition(appDef.Name); err == nil {
+				for _, c := range declaredCapabilities(prev) {
+					installed[c.String()] = true
+				}
+			}
+		}
+	}
+	capErr := &CapabilityError{App: appDef.Name}
+	for _, c := range statuses {
+		switch {
+		case c.Mode == CapabilityDeny:
+			capErr.Denied = append(capErr.Denied, c)
+		case c.Mode == CapabilityConfirm && !confirmed && !installed[c.String()]:
+			capErr.Unconfirmed = append(capErr.Unconfirmed, c)
+		}
+	}
+	if len(capErr.Denied) > 0 || len(capErr.Unconfirmed) > 0 {
+		return capErr
+	}
+	return nil
+}
+
+// applyCapabilities translates an app's capabilities into the container
+// spec. Confirmation was given at install time, so only capabilities the
+// policy now denies are refused.
+func (m *AppManager) applyCapabilities(appDef *api.AppDefinition, spec *container.ContainerCreateSpec) error {
+	capErr := &CapabilityError{App: appDef.Name}
+	for _, c := range m.evaluateCapabilities(appDef) {
+		if !c.Granted {
+			capErr.Denied = append(capErr.Denied, c)
+			continue
+		}
+		switch c.Kind {
+		case CapabilityKindDevice:
+			spec.Devices = append(spec.Devices, c.Name)
+		case CapabilityKindLinux:
+			spec.CapAdd = append(spec.CapAdd, c.Name)
+		case CapabilityKindHostNetwork:
+			// The app binds its guest ports on the host itself, which is
+			// where its endpoints point; nothing is published.
+			spec.NetworkMode = "host"
+			spec.Ports = nil
+		}
+	}
+	if len(capErr.Denied) > 0 {
+		return capErr
+	}
+	return nil
+}
+
+// onHostNetwork reports whether appDef declares the host network.
+func onHostNetwork(appDef *api.AppDefinition) bool {
+	return appDef != nil && appDef.Capabilities != nil && appDef.Capabilities.HostNetwork
+}
+
+// hostPortsFor maps an app's guest ports to the host ports its proxies
+// reach: what the container publishes, or on the host network the guest
+// ports themselves.
+func hostPortsFor(ctx context.Context, containerID string, appDef *api.AppDefinition) (map[int]int, error) {
+	if onHostNetwork(appDef) {
+		ports := make(map[int]int, len(appDef.Listeners))
+		for _, l := range appDef.Listeners {
+			ports[l.GuestPort] = l.GuestPort
+		}
+		return ports, nil
+	}
+	return container.InspectPublishedPorts(ctx, containerID)
+}
+
+// checkHostNetworkChange refuses updates a host-network app cannot take in
+// place: its endpoints sit on its guest ports, so neither joining or
+// leaving the host network nor moving listeners works without a reinstall.
+func (m *AppManager) checkHostNetworkChange(stored, next *api.AppDefinition) error {
+	if !onHostNetwork(stored) && !onHostNetwork(next) {
+		return nil
+	}
+	if onHostNetwork(stored) != onHostNetwork(next) {
+		return fmt.Errorf("app %s: changing capabilities.host_network requires reinstalling the app", next.Name)
+	}
+	if _, change, err := m.serviceManager.PlanReconcile(next.Name, next.Listeners); err == nil && change {
+		return fmt.Errorf("app %s: listeners of a host-network app change only on reinstall", next.Name)
+	}
+	return nil
+}
+
+// Capabilities reports the capabilities an installed app declares and
+// whether each is granted under the current app policy.
+func (m *AppManager) Capabilities(ctx context.Context, name string) ([]CapabilityStatus, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+	out := m.evaluateCapabilities(def)
+	if out == nil {
+		out = []CapabilityStatus{}
+	}
+	return out, nil
+}
+
+// CapabilityWarnings flags declared capabilities that reach well beyond the
+// app's own container.
+func CapabilityWarnings(appDef *api.AppDefinition) []string {
+	warnings := []string{}
+	for _, c := range declaredCapabilities(appDef) {
+		switch c.Kind {
+		case CapabilityKindHostNetwork:
+			warnings = append(warnings, "capabilities.host_network shares the host's network stack, including services bound to loopback")
+		case CapabilityKindLinux:
+			if reason, ok := broadCapabilities[c.Name]; ok {
+				warnings = append(warnings, fmt.Sprintf("capabilities.linux %s %s", c.Name, reason))
+			}
+		case CapabilityKindDevice:
+			for _, b := range broadDevices {
+				if strings.HasPrefix(c.Name, b.prefix) {
+					warnings = append(warnings, fmt.Sprintf("capabilities.devices %s %s", c.Name, b.reason))
+					break
+				}
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"piccolod/internal/api"
+)
+
+func transcodeApp(name string, caps *api.AppCapabilities) *api.AppDefinition {
+	return &api.AppDefinition{
+		Name:         name,
+		Image:        "plexinc/pms-docker:latest",
+		Type:         "user",
+		Listeners:    []api.AppListener{{Name: "web", GuestPort: 32400}},
+		Capabilities: caps,
+	}
+}
+
+func TestAppManager_CapabilitiesFollowPolicy(t *testing.T) {
+	manager, _ := newMockAppManager(t)
+	ctx := context.Background()
+	def := transcodeApp("plex", &api.AppCapabilities{Devices: []string{"/dev/dri/renderD128"}, Linux: []string{"cap_net_admin"}})
+
+	// Nothing is permitted until an admin sets a policy.
+	_, err := manager.Install(ctx, def)
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) || !errors.Is(err, ErrCapabilityNotAllowed) || len(capErr.Denied) != 2 {
+		t.Fatalf("expected both capabilities denied, got %v", err)
+	}
+	if capErr.Denied[0].String() != "device /dev/dri/renderD128" || capErr.Denied[1].String() != "linux NET_ADMIN" {
+		t.Fatalf("unexpected denied list %+v", capErr.Denied)
+	}
+
+	// The most specific device entry wins.
+	policy, err := NormalizeCapabilityPolicy(CapabilityPolicy{
+		Devices: map[string]string{"/dev": "allow", "/dev/dri/": "deny"},
+		Linux:   map[string]string{"NET_ADMIN": "allow"},
+	})
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	manager.SetCapabilityPolicy(policy)
+	if _, err := manager.Install(ctx, def); !errors.As(err, &capErr) || len(capErr.Denied) != 1 || capErr.Denied[0].Kind != CapabilityKindDevice {
+		t.Fatalf("expected only the device denied, got %v", err)
+	}
+
+	policy.Devices["/dev/dri"] = CapabilityConfirm
+	manager.SetCapabilityPolicy(policy)
+	if _, err := manager.Install(ctx, def); !errors.As(err, &capErr) || len(capErr.Denied) != 0 || len(capErr.Unconfirmed) != 1 {
+		t.Fatalf("expected the device to need confirmation, got %v", err)
+	}
+	if _, err := manager.Install(ConfirmCapabilities(ctx), def); err != nil {
+		t.Fatalf("confirmed install: %v", err)
+	}
+	caps, err := manager.Capabilities(ctx, "plex")
+	if err != nil || len(caps) != 2 || !caps[0].Granted || caps[0].Mode != CapabilityConfirm || caps[1].Mode != CapabilityAllow {
+		t.Fatalf("unexpected capabilities %+v (%v)", caps, err)
+	}
+
+	// Re-applying the installed definition does not ask again.
+	if _, err := manager.Upsert(ctx, def); err != nil {
+		t.Fatalf("upsert of confirmed capabilities: %v", err)
+	}
+	// A newly declared capability does.
+	more := transcodeApp("plex", &api.AppCapabilities{Devices: []string{"/dev/dri/renderD128", "/dev/dri/card0"}, Linux: []string{"NET_ADMIN"}})
+	if _, err := manager.Upsert(ctx, more); !errors.As(err, &capErr) || len(capErr.Unconfirmed) != 1 || capErr.Unconfirmed[0].Name != "/dev/dri/card0" {
+		t.Fatalf("expected the new device to need confirmation, got %v", err)
+	}
+
+	// Tightening the policy shows up on installed apps.
+	delete(policy.Linux, "NET_ADMIN")
+	manager.SetCapabilityPolicy(policy)
+	caps, _ = manager.Capabilities(ctx, "plex")
+	if caps[1].Granted || caps[1].Mode != CapabilityDeny {
+		t.Fatalf("expected NET_ADMIN reported as denied, got %+v", caps[1])
+	}
+}
+
+func TestAppManager_CapabilitySpec(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	manager.SetCapabilityPolicy(CapabilityPolicy{
+		Devices:     map[string]string{"/dev/dri": CapabilityAllow, "/dev/net/tun": CapabilityAllow},
+		Linux:       map[string]string{"NET_ADMIN": CapabilityAllow, "SYS_TIME": CapabilityAllow},
+		HostNetwork: CapabilityAllow,
+	})
+	ctx := context.Background()
+	inst, err := manager.Install(ctx, transcodeApp("plex", &api.AppCapabilities{Devices: []string{"/dev/dri"}, Linux: []string{"SYS_TIME"}}))
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	spec := mock.containers[inst.ContainerID].Spec
+	if len(spec.Devices) != 1 || spec.Devices[0] != "/dev/dri" || len(spec.CapAdd) != 1 || spec.CapAdd[0] != "SYS_TIME" || spec.NetworkMode != "" {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	vpn := &api.AppDefinition{
+		Name:         "vpn",
+		Image:        "docker.io/qmcgaw/gluetun:latest",
+		Type:         "user",
+		Listeners:    []api.AppListener{{Name: "proxy", GuestPort: 38888}},
+		Capabilities: &api.AppCapabilities{Devices: []string{"/dev/net/tun"}, Linux: []string{"NET_ADMIN"}, HostNetwork: true},
+	}
+	inst, err = manager.Install(ctx, vpn)
+	if err != nil {
+		t.Fatalf("install vpn: %v", err)
+	}
+	spec = mock.containers[inst.ContainerID].Spec
+	if spec.NetworkMode != "host" || len(spec.Ports) != 0 || spec.CapAdd[0] != "NET_ADMIN" || spec.Devices[0] != "/dev/net/tun" {
+		t.Fatalf("unexpected vpn spec %+v", spec)
+	}
+	// The app binds its guest port on the host; its endpoint points there.
+	eps, err := manager.serviceManager.GetByApp("vpn")
+	if err != nil || len(eps) != 1 || eps[0].HostBind != 38888 {
+		t.Fatalf("unexpected vpn endpoints %+v (%v)", eps, err)
+	}
+
+	moved := *vpn
+	moved.Listeners = []api.AppListener{{Name: "proxy", GuestPort: 38889}}
+	if _, err := manager.Upsert(ctx, &moved); err == nil || !strings.Contains(err.Error(), "reinstall") {
+		t.Fatalf("expected moving a host-network listener to be refused, got %v", err)
+	}
+	bridged := *vpn
+	bridged.Capabilities = &api.AppCapabilities{Devices: []string{"/dev/net/tun"}, Linux: []string{"NET_ADMIN"}}
+	if _, err := manager.Upsert(ctx, &bridged); err == nil || !strings.Contains(err.Error(), "reinstall") {
+		t.Fatalf("expected leaving the host network to be refused, got %v", err)
+	}
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	for _, caps := range []*api.AppCapabilities{
+		{Devices: []string{"dri"}},
+		{Devices: []string{"/etc/passwd"}},
+		{Devices: []string{"/dev"}},
+		{Devices: []string{"/dev/dri", "/dev/dri/"}},
+		{Linux: []string{"NET_WIZARD"}},
+		{Linux: []string{"NET_ADMIN", "CAP_NET_ADMIN"}},
+	} {
+		if err := validateCapabilities(caps, nil); err == nil {
+			t.Fatalf("capabilities %+v accepted", caps)
+		}
+	}
+	host := &api.AppCapabilities{HostNetwork: true}
+	deny := &api.AppPermissions{Network: &api.AppNetworkPermissions{Internet: "deny"}}
+	if err := validateCapabilities(host, deny); err == nil {
+		t.Fatalf("host network without internet accepted")
+	}
+	if err := validateCapabilities(&api.AppCapabilities{Devices: []string{"/dev/dri"}, Linux: []string{"cap_sys_time"}}, nil); err != nil {
+		t.Fatalf("valid capabilities refused: %v", err)
+	}
+
+	for _, p := range []CapabilityPolicy{
+		{Devices: map[string]string{"/etc": "allow"}},
+		{Linux: map[string]string{"NET_ADMIN": "always"}},
+		{Linux: map[string]string{"NOPE": "allow"}},
+		{HostNetwork: "yes"},
+	} {
+		if _, err := NormalizeCapabilityPolicy(p); err == nil {
+			t.Fatalf("policy %+v accepted", p)
+		}
+	}
+}
+
+func TestCapabilityWarnings(t *testing.T) {
+	def := transcodeApp("broad", &api.AppCapabilities{
+		Devices:     []string{"/dev/dri", "/dev/sda"},
+		Linux:       []string{"SYS_TIME", "SYS_ADMIN"},
+		HostNetwork: true,
+	})
+	warnings := CapabilityWarnings(def)
+	if len(warnings) != 3 {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"/dev/sda", "SYS_ADMIN", "host_network"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing warning about %s in %q", want, warnings)
+		}
+	}
+	if got := CapabilityWarnings(transcodeApp("plain", nil)); len(got) != 0 {
+		t.Fatalf("warnings without capabilities: %q", got)
+	}
+}
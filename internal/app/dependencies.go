@@ -0,0 +1,402 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/api"
+)
+
+var (
+	ErrDependencyCycle   = errors.New("app manager: dependency cycle")
+	ErrMissingDependency = errors.New("app manager: dependency not installed")
+)
+
+const defaultDependencyTimeout = 2 * time.Minute
+
+// dependencyPollInterval is how often a started dependency is checked while
+// its dependents wait.
+var dependencyPollInterval = 250 * time.Millisecond
+
+// Outcomes reported per app by StartApps.
+const (
+	StartResultStarted        = "started"
+	StartResultAlreadyRunning = "already_running"
+	StartResultFailed         = "failed"
+	StartResultSkipped        = "skipped"
+	// StartResultPaused leaves a paused app as it is; unpause resumes it.
+	StartResultPaused = "paused"
+)
+
+// ContainerStateReader is implemented by container managers that can report
+// whether a container is actually running, which the stored app status may
+// not reflect after a reboot.
+type ContainerStateReader interface {
+	ContainerRunning(ctx context.Context, containerID string) (bool, error)
+}
+
+// DependentsError is returned when stopping or removing an app would break
+// apps that depend on it and the caller did not force the operation.
+type DependentsError struct {
+	App        string
+	Dependents []string
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("app %s is required by %s; use force to proceed", e.App, strings.Join(e.Dependents, ", "))
+}
+
+// StopOptions controls StopWithOptions.
+type StopOptions struct {
+	// Force stops the app even while dependents are running.
+	Force bool
+}
+
+// UninstallOptions controls UninstallWithOptions.
+type UninstallOptions struct {
+	// Purge also deletes the app's volume and host paths.
+	Purge bool
+	// Force removes the app even when installed apps depend on it.
+	Force bool
+}
+
+// DependencyStatus describes one declared dependency of an app.
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+	Status    string `json:"status,omitempty"`
+	Running   bool   `json:"running"`
+}
+
+// StartResult records what StartApps did with one app.
+type StartResult struct {
+	App    string `json:"app"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SetDependencyTimeout bounds how long StartApps waits for a dependency to
+// reach running before giving up on its dependents.
+func (m *AppManager) SetDependencyTimeout(d time.Duration) {
+	m.depMu.Lock()
+	m.depTimeout = d
+	m.depMu.Unlock()
+}
+
+func (m *AppManager) currentDependencyTimeout() time.Duration {
+	m.depMu.Lock()
+	defer m.depMu.Unlock()
+	if m.depTimeout <= 0 {
+		return defaultDependencyTimeout
+	}
+	return m.depTimeout
+}
+
+// dependencyGraph maps every installed app to its declared dependencies.
+func dependencyGraph(state *FilesystemStateManager) map[string][]string {
+	graph := make(map[string][]string)
+	for _, inst := range state.ListApps() {
+		def, err := state.GetAppDefinition(inst.Name)
+		if err != nil {
+			log.Printf("WARN: dependency graph: failed to read app definition for %s: %v", inst.Name, err)
+			graph[inst.Name] = nil
+			continue
+		}
+		graph[inst.Name] = append([]string(nil), def.DependsOn...)
+	}
+	return graph
+}
+
+// validateDependencies checks that appDef only depends on installed apps and
+// that adding (or replacing) it keeps the graph acyclic.
+func (m *AppManager) validateDependencies(state *FilesystemStateManager, appDef *api.AppDefinition) error {
+	if len(appDef.DependsOn) == 0 {
+		return nil
+	}
+	graph := dependencyGraph(state)
+	var missing []string
+	for _, dep := range appDef.DependsOn {
+		if _, ok := graph[dep]; !ok {
+			missing = append(missing, dep)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingDependency, strings.Join(missing, ", "))
+	}
+	graph[appDef.Name] = appDef.DependsOn
+	if cycle := findCycle(graph); cycle != nil {
+		return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// findCycle returns one dependency cycle (first node repeated at the end),
+// or nil when the graph is acyclic.
+func findCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	mark := make(map[string]int, len(graph))
+	var stack []string
+	var visit func(string) []string
+	visit = func(name string) []string {
+		switch mark[name] {
+		case done:
+			return nil
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return append(append([]string(nil), stack[i:]...), name)
+				}
+			}
+		}
+		mark[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range graph[name] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		mark[name] = done
+		return nil
+	}
+	for _, name := range sortedKeys(graph) {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// startOrder returns names plus their installed transitive dependencies,
+// ordered so every app comes after the apps it depends on.
+func startOrder(graph map[string][]string, names []string) ([]string, error) {
+	if cycle := findCycle(graph); cycle != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+	var order []string
+	seen := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, dep := range graph[name] {
+			if _, installed := graph[dep]; installed {
+				visit(dep)
+			}
+		}
+		order = append(order, name)
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		visit(name)
+	}
+	return order, nil
+}
+
+// dependentsOf lists installed apps that declare name as a dependency.
+func dependentsOf(graph map[string][]string, name string) []string {
+	var out []string
+	for app, deps := range graph {
+		for _, dep := range deps {
+			if dep == name {
+				out = append(out, app)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(graph map[string][]string) []string {
+	keys := make([]string, 0, len(graph))
+	for k := range graph {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appPaused(state *FilesystemStateManager, name string) bool {
+	inst, ok := state.GetApp(name)
+	return ok && inst.Status == AppStatusPaused
+}
+
+// appRunning prefers live container state and falls back to the stored status.
+func (m *AppManager) appRunning(ctx context.Context, state *FilesystemStateManager, name string) bool {
+	inst, ok := state.GetApp(name)
+	if !ok {
+		return false
+	}
+	if reader, ok := m.containerManager.(ContainerStateReader); ok && inst.ContainerID != "" {
+		running, err := reader.ContainerRunning(ctx, inst.ContainerID)
+		if err == nil {
+			return running
+		}
+		log.Printf("WARN: inspect %s container state: %v", name, err)
+	}
+	return inst.Status == "running"
+}
+
+func (m *AppManager) waitRunning(ctx context.Context, state *FilesystemStateManager, name string, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(dependencyPollInterval)
+	defer ticker.Stop()
+	for {
+		if m.appRunning(ctx, state, name) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("%s did not reach running within %s", name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartApps starts the named apps (all enabled apps when names is empty) in
+// dependency order. Each dependency must reach running within the dependency
+// timeout before its dependents are started; dependents of an app that
+// failed are skipped.
+func (m *AppManager) StartApps(ctx context.Context, names []string) ([]StartResult, error) {
+	if err := m.ensureUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := m.ensureKernelLeader(); err != nil {
+		return nil, err
+	}
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		if names, err = state.ListEnabledApps(); err != nil {
+			return nil, err
+		}
+	}
+	graph := dependencyGraph(state)
+	for _, name := range names {
+		if _, ok := graph[name]; !ok {
+			return nil, fmt.Errorf("app not found: %s", name)
+		}
+	}
+	order, err := startOrder(graph, names)
+	if err != nil {
+		return nil, err
+	}
+	waitFor := make(map[string]bool)
+	for _, name := range order {
+		for _, dep := range graph[name] {
+			waitFor[dep] = true
+		}
+	}
+
+	timeout := m.currentDependencyTimeout()
+	failed := make(map[string]bool)
+	results := make([]StartResult, 0, len(order))
+	for _, name := range order {
+		res := StartResult{App: name}
+		var blocked []string
+		for _, dep := range graph[name] {
+			if _, installed := graph[dep]; !installed || failed[dep] {
+				blocked = append(blocked, dep)
+			}
+		}
+		switch {
+		case len(blocked) > 0:
+			res.Result = StartResultSkipped
+			res.Error = "dependency not running: " + strings.Join(blocked, ", ")
+		case appPaused(state, name):
+			res.Result = StartResultPaused
+		case m.appRunning(ctx, state, name):
+			res.Result = StartResultAlreadyRunning
+		default:
+			// Queue behind an operation already running on the app
+			// rather than reporting it failed.
+			if err := m.Start(waitForOperation(ctx), name); err != nil {
+				res.Result = StartResultFailed
+				res.Error = err.Error()
+			} else if waitFor[name] {
+				if err := m.waitRunning(ctx, state, name, timeout); err != nil {
+					res.Result = StartResultFailed
+					res.Error = err.Error()
+				} else {
+					res.Result = StartResultStarted
+				}
+			} else {
+				res.Result = StartResultStarted
+			}
+		}
+		if res.Result == StartResultFailed || res.Result == StartResultSkipped {
+			failed[name] = true
+			m.recordActivity(ctx, activity.LevelWarn, fmt.Sprintf("App %s not started: %s", name, res.Error), map[string]any{"app": name})
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// Dependencies reports the declared dependencies of an app and whether each
+// is installed and running.
+func (m *AppManager) Dependencies(ctx context.Context, name string) ([]DependencyStatus, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DependencyStatus, 0, len(def.DependsOn))
+	for _, dep := range def.DependsOn {
+		st := DependencyStatus{Name: dep}
+		if inst, ok := state.GetApp(dep); ok {
+			st.Installed = true
+			st.Status = inst.Status
+			st.Running = m.appRunning(ctx, state, dep)
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// checkDependents refuses to stop or remove name while dependents exist,
+// unless forced. With runningOnly, dependents that are stopped are ignored.
+func (m *AppManager) checkDependents(ctx context.Context, state *FilesystemStateManager, name string, runningOnly, force bool) error {
+	dependents := dependentsOf(dependencyGraph(state), name)
+	if runningOnly {
+		active := dependents[:0]
+		for _, d := range dependents {
+			if m.appRunning(ctx, state, d) {
+				active = append(active, d)
+			}
+		}
+		dependents = active
+	}
+	if len(dependents) == 0 {
+		return nil
+	}
+	if !force {
+		return &DependentsError{App: name, Dependents: dependents}
+	}
+	m.recordActivity(ctx, activity.LevelWarn,
+		fmt.Sprintf("App %s forced down while required by %s", name, strings.Join(dependents, ", ")),
+		map[string]any{"app": name, "dependents": dependents})
+	return nil
+}
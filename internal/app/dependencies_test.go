@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+func newDependencyTestManager(t *testing.T, cm ContainerManager) *AppManager {
+	t.Helper()
+	manager, err := NewAppManager(cm, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewAppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	return manager
+}
+
+func installDependencyApp(t *testing.T, m *AppManager, name string, deps ...string) {
+	t.Helper()
+	def := &api.AppDefinition{
+		Name:      name,
+		Image:     "alpine:latest",
+		Type:      "user",
+		DependsOn: deps,
+		Listeners: []api.AppListener{{Name: name, GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}},
+	}
+	if _, err := m.Install(context.Background(), def); err != nil {
+		t.Fatalf("install %s: %v", name, err)
+	}
+}
+
+// stalledContainerManager starts containers but never reports them running.
+type stalledContainerManager struct {
+	*MockContainerManager
+}
+
+func (s *stalledContainerManager) ContainerRunning(ctx context.Context, containerID string) (bool, error) {
+	return false, nil
+}
+
+func TestStartOrderPlacesDependenciesFirst(t *testing.T) {
+	graph := map[string][]string{
+		"web":   {"api"},
+		"api":   {"db", "cache"},
+		"db":    nil,
+		"cache": nil,
+		"other": nil,
+	}
+	order, err := startOrder(graph, []string{"web"})
+	if err != nil {
+		t.Fatalf("startOrder: %v", err)
+	}
+	want := []string{"db", "cache", "api", "web"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+
+	graph["db"] = []string{"web"}
+	if _, err := startOrder(graph, []string{"web"}); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle, got %v", err)
+	}
+}
+
+func TestInstallRejectsMissingDependencyAndCycle(t *testing.T) {
+	m := newDependencyTestManager(t, NewMockContainerManager())
+	ctx := context.Background()
+
+	def := &api.AppDefinition{
+		Name: "web", Image: "alpine:latest", Type: "user", DependsOn: []string{"db"},
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}},
+	}
+	if _, err := m.Install(ctx, def); !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("expected ErrMissingDependency, got %v", err)
+	}
+
+	installDependencyApp(t, m, "db")
+	installDependencyApp(t, m, "web", "db")
+
+	cyclic := &api.AppDefinition{
+		Name: "db", Image: "alpine:latest", Type: "user", DependsOn: []string{"web"},
+		Listeners: []api.AppListener{{Name: "db", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}},
+	}
+	if _, err := m.Upsert(ctx, cyclic); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle, got %v", err)
+	}
+}
+
+func TestStartAppsStartsDependenciesFirst(t *testing.T) {
+	m := newDependencyTestManager(t, NewMockContainerManager())
+	installDependencyApp(t, m, "db")
+	installDependencyApp(t, m, "backend", "db")
+
+	results, err := m.StartApps(context.Background(), []string{"backend"})
+	if err != nil {
+		t.Fatalf("StartApps: %v", err)
+	}
+	want := []StartResult{
+		{App: "db", Result: StartResultStarted},
+		{App: "backend", Result: StartResultStarted},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+
+	results, err = m.StartApps(context.Background(), []string{"backend"})
+	if err != nil {
+		t.Fatalf("StartApps again: %v", err)
+	}
+	for _, r := range results {
+		if r.Result != StartResultAlreadyRunning {
+			t.Fatalf("expected already_running on second start, got %+v", r)
+		}
+	}
+}
+
+func TestStartAppsSkipsDependentsWhenDependencyTimesOut(t *testing.T) {
+	prev := dependencyPollInterval
+	dependencyPollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { dependencyPollInterval = prev })
+
+	m := newDependencyTestManager(t, &stalledContainerManager{NewMockContainerManager()})
+	m.SetDependencyTimeout(30 * time.Millisecond)
+	installDependencyApp(t, m, "db")
+	installDependencyApp(t, m, "backend", "db")
+
+	results, err := m.StartApps(context.Background(), []string{"backend"})
+	if err != nil {
+		t.Fatalf("StartApps: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if results[0].App != "db" || results[0].Result != StartResultFailed || results[0].Error == "" {
+		t.Fatalf("expected db to fail waiting, got %+v", results[0])
+	}
+	if results[1].App != "backend" || results[1].Result != StartResultSkipped {
+		t.Fatalf("expected backend to be skipped, got %+v", results[1])
+	}
+}
+
+func TestStopAndUninstallRequireForceWithDependents(t *testing.T) {
+	m := newDependencyTestManager(t, NewMockContainerManager())
+	ctx := context.Background()
+	installDependencyApp(t, m, "db")
+	installDependencyApp(t, m, "backend", "db")
+
+	// A stopped dependent does not block stopping the dependency.
+	if err := m.Start(ctx, "db"); err != nil {
+		t.Fatalf("start db: %v", err)
+	}
+	if err := m.Stop(ctx, "db"); err != nil {
+		t.Fatalf("stop db with stopped dependent: %v", err)
+	}
+
+	if _, err := m.StartApps(ctx, []string{"backend"}); err != nil {
+		t.Fatalf("StartApps: %v", err)
+	}
+	var depErr *DependentsError
+	if err := m.Stop(ctx, "db"); !errors.As(err, &depErr) {
+		t.Fatalf("expected DependentsError, got %v", err)
+	}
+	if !reflect.DeepEqual(depErr.Dependents, []string{"backend"}) {
+		t.Fatalf("dependents = %v", depErr.Dependents)
+	}
+	if err := m.StopWithOptions(ctx, "db", StopOptions{Force: true}); err != nil {
+		t.Fatalf("forced stop: %v", err)
+	}
+
+	if err := m.Uninstall(ctx, "db"); !errors.As(err, &depErr) {
+		t.Fatalf("expected DependentsError on uninstall, got %v", err)
+	}
+	if _, err := m.UninstallWithOptions(ctx, "db", UninstallOptions{Force: true}); err != nil {
+		t.Fatalf("forced uninstall: %v", err)
+	}
+	deps, err := m.Dependencies(ctx, "backend")
+	if err != nil {
+		t.Fatalf("Dependencies: %v", err)
+	}
+	if len(deps) != 1 || deps[0].Name != "db" || deps[0].Installed {
+		t.Fatalf("expected db reported as not installed, got %+v", deps)
+	}
+}
@@ -0,0 +1,325 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/services"
+)
+
+const (
+	// maxDefinitionChanges is how many applied app.yaml changes the history
+	// keeps.
+	maxDefinitionChanges = 20
+	// maskedEnvValue stands in for secret-looking environment values in
+	// diffs and history.
+	maskedEnvValue = "********"
+)
+
+// How an entry in a DefinitionDiff changed.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// DefinitionDiff describes what replacing an app's stored app.yaml with a
+// candidate changes.
+type DefinitionDiff struct {
+	App     string       `json:"app"`
+	Changed bool         `json:"changed"`
+	Image   *ValueChange `json:"image,omitempty"`
+	// Environment lists changed variables by key. Values of keys that look
+	// like secrets are masked.
+	Environment []EnvChange      `json:"environment,omitempty"`
+	Listeners   []ListenerChange `json:"listeners,omitempty"`
+	// Sections holds the other top-level sections that differ, such as
+	// storage and permissions, with their old and new values.
+	Sections []SectionChange `json:"sections,omitempty"`
+	// ContainerChange is true when applying changes the container's
+	// published ports.
+	ContainerChange bool `json:"container_change"`
+	// Summary is one line per change; it is what the history keeps.
+	Summary []string `json:"summary"`
+}
+
+// ValueChange is a scalar that changed.
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// EnvChange is one environment variable that was added, removed or changed.
+type EnvChange struct {
+	Key    string `json:"key"`
+	Change string `json:"change"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Masked bool   `json:"masked,omitempty"`
+}
+
+// ListenerChange is one listener that was added, removed or modified, with
+// what that does to its ports. Ports of an added listener are the ones
+// allocation would pick at the time of the diff.
+type ListenerChange struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	// Fields names the app.yaml fields of a modified listener that differ.
+	Fields      []string `json:"fields,omitempty"`
+	PublicPort  int      `json:"public_port,omitempty"`
+	HostBind    int      `json:"host_bind,omitempty"`
+	Consequence string   `json:"consequence,omitempty"`
+}
+
+// SectionChange is a top-level app.yaml section that differs.
+type SectionChange struct {
+	Section string `json:"section"`
+	From    any    `json:"from,omitempty"`
+	To      any    `json:"to,omitempty"`
+}
+
+// DefinitionChange is one applied app.yaml change in an app's history.
+type DefinitionChange struct {
+	At      time.Time `json:"at"`
+	Summary []string  `json:"summary"`
+}
+
+// diffDefinitions compares current with next. rec is the listener reconcile
+// for next, real or planned; without one the port consequences are left out.
+func diffDefinitions(current, next *api.AppDefinition, rec *services.ReconcileResult) *DefinitionDiff {
+	current, next = withDefaults(current), withDefaults(next)
+	d := &DefinitionDiff{App: next.Name}
+	if current.Image != next.Image {
+		d.Image = &ValueChange{From: current.Image, To: next.Image}
+		d.Summary = append(d.Summary, fmt.Sprintf("image %s -> %s", orNone(current.Image), orNone(next.Image)))
+	}
+	d.diffEnvironment(current.Environment, next.Environment)
+	d.diffListeners(current.Listeners, next.Listeners, rec)
+	d.diffSections(current, next)
+	if rec != nil {
+		d.ContainerChange = len(rec.Added) > 0 || len(rec.Removed) > 0 || len(rec.GuestPortChanged) > 0
+	}
+	d.Changed = len(d.Summary) > 0
+	if d.Summary == nil {
+		d.Summary = []string{}
+	}
+	return d
+}
+
+func (d *DefinitionDiff) diffEnvironment(current, next map[string]string) {
+	keys := make([]string, 0, len(current)+len(next))
+	for k := range current {
+		keys = append(keys, k)
+	}
+	for k := range next {
+		if _, ok := current[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		from, had := current[key]
+		to, has := next[key]
+		change := EnvChange{Key: key, From: from, To: to}
+		switch {
+		case had && !has:
+			change.Change = ChangeRemoved
+		case !had && has:
+			change.Change = ChangeAdded
+		case from != to:
+			change.Change = ChangeModified
+		default:
+			continue
+		}
+		if secretEnvKey.MatchString(key) {
+			change.Masked = true
+			if change.From != "" {
+				change.From = maskedEnvValue
+			}
+			if change.To != "" {
+				change.To = maskedEnvValue
+			}
+		}
+		d.Environment = append(d.Environment, change)
+		switch change.Change {
+		case ChangeModified:
+			if change.Masked {
+				d.Summary = append(d.Summary, fmt.Sprintf("environment %s changed", key))
+			} else {
+				d.Summary = append(d.Summary, fmt.Sprintf("environment %s %q -> %q", key, from, to))
+			}
+		default:
+			d.Summary = append(d.Summary, fmt.Sprintf("environment %s %s", key, change.Change))
+		}
+	}
+}
+
+func (d *DefinitionDiff) diffListeners(current, next []api.AppListener, rec *services.ReconcileResult) {
+	endpoints := map[string]services.ServiceEndpoint{}
+	restarted := map[string]bool{}
+	republished := map[string]bool{}
+	if rec != nil {
+		for _, ep := range rec.Endpoints {
+			endpoints[ep.Name] = ep
+		}
+		for _, ep := range rec.Removed {
+			endpoints[ep.Name] = ep
+		}
+		for _, ep := range rec.ProxyOnlyChanged {
+			restarted[ep.Name] = true
+		}
+		for _, ch := range rec.GuestPortChanged {
+			republished[ch.Old.Name] = true
+		}
+	}
+	old := make(map[string]api.AppListener, len(current))
+	for _, l := range current {
+		old[l.Name] = l
+	}
+	seen := make(map[string]bool, len(next))
+	for _, l := range next {
+		seen[l.Name] = true
+		ep := endpoints[l.Name]
+		prev, ok := old[l.Name]
+		if !ok {
+			change := ListenerChange{Name: l.Name, Change: ChangeAdded, PublicPort: ep.PublicPort, HostBind: ep.HostBind}
+			line := fmt.Sprintf("listener %s added", l.Name)
+			if ep.PublicPort != 0 {
+				change.Consequence = fmt.Sprintf("opens public port %d", ep.PublicPort)
+				line += " (" + change.Consequence + ")"
+			}
+			d.Listeners = append(d.Listeners, change)
+			d.Summary = append(d.Summary, line)
+			continue
+		}
+		fields := listenerFieldChanges(prev, l)
+		if len(fields) == 0 {
+			continue
+		}
+		change := ListenerChange{Name: l.Name, Change: ChangeModified, Fields: fields, PublicPort: ep.PublicPort, HostBind: ep.HostBind}
+		switch {
+		case republished[l.Name]:
+			change.Consequence = fmt.Sprintf("container port %d -> %d is republished", prev.GuestPort, l.GuestPort)
+		case restarted[l.Name]:
+			change.Consequence = fmt.Sprintf("proxy on public port %d restarts", ep.PublicPort)
+		}
+		line := fmt.Sprintf("listener %s changed: %s", l.Name, strings.Join(fields, ", "))
+		if change.Consequence != "" {
+			line += " (" + change.Consequence + ")"
+		}
+		d.Listeners = append(d.Listeners, change)
+		d.Summary = append(d.Summary, line)
+	}
+	for _, l := range current {
+		if seen[l.Name] {
+			continue
+		}
+		ep := endpoints[l.Name]
+		change := ListenerChange{Name: l.Name, Change: ChangeRemoved, PublicPort: ep.PublicPort, HostBind: ep.HostBind}
+		line := fmt.Sprintf("listener %s removed", l.Name)
+		if ep.PublicPort != 0 {
+			change.Consequence = fmt.Sprintf("releases public port %d", ep.PublicPort)
+			line += " (" + change.Consequence + ")"
+		}
+		d.Listeners = append(d.Listeners, change)
+		d.Summary = append(d.Summary, line)
+	}
+}
+
+// listenerFieldChanges names the app.yaml fields that differ between two
+// versions of a listener.
+func listenerFieldChanges(a, b api.AppListener) []string {
+	var fields []string
+	check := func(name string, x, y any) {
+		if !reflect.DeepEqual(x, y) {
+			fields = append(fields, name)
+		}
+	}
+	check("guest_port", a.GuestPort, b.GuestPort)
+	check("flow", a.Flow, b.Flow)
+	check("protocol", a.Protocol, b.Protocol)
+	check("protocol_middleware", a.Middleware, b.Middleware)
+	check("remote_ports", a.RemotePorts, b.RemotePorts)
+	check("remote_subdomain", a.RemoteSubdomain, b.RemoteSubdomain)
+	check("preserve_host", a.PreserveHost, b.PreserveHost)
+	check("backend_tls", a.BackendTLS, b.BackendTLS)
+	check("max_connections", a.MaxConnections, b.MaxConnections)
+	check("max_connections_per_ip", a.MaxConnectionsPerIP, b.MaxConnectionsPerIP)
+	check("idle_timeout", a.IdleTimeout, b.IdleTimeout)
+	check("path_prefix", a.PathPrefix, b.PathPrefix)
+	check("strip_prefix", a.StripPrefix, b.StripPrefix)
+	check("public", a.Public, b.Public)
+	check("extra", a.Extra, b.Extra)
+	return fields
+}
+
+func (d *DefinitionDiff) diffSections(current, next *api.AppDefinition) {
+	sections := []struct {
+		name     string
+		from, to any
+	}{
+		{"type", current.Type, next.Type},
+		{"build", current.Build, next.Build},
+		{"storage", current.Storage, next.Storage},
+		{"filesystem", current.Filesystem, next.Filesystem},
+		{"permissions", current.Permissions, next.Permissions},
+		{"capabilities", current.Capabilities, next.Capabilities},
+		{"resources", current.Resources, next.Resources},
+		{"healthcheck", current.HealthCheck, next.HealthCheck},
+		{"depends_on", current.DependsOn, next.DependsOn},
+		{"tasks", current.Tasks, next.Tasks},
+		{"logs", current.Logs, next.Logs},
+		{"app_config", current.AppConfig, next.AppConfig},
+	}
+	for _, s := range sections {
+		if sectionEmpty(s.from) && sectionEmpty(s.to) || reflect.DeepEqual(s.from, s.to) {
+			continue
+		}
+		d.Sections = append(d.Sections, SectionChange{Section: s.name, From: s.from, To: s.to})
+		d.Summary = append(d.Summary, s.name+" changed")
+	}
+}
+
+// sectionEmpty treats nil, empty strings and empty slices alike, so a
+// section written as [] is not reported against one left out.
+func sectionEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil() || (rv.Kind() != reflect.Pointer && rv.Kind() != reflect.Interface && rv.Len() == 0)
+	case reflect.String:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+// withDefaults returns a copy of def with SetDefaults applied, so a field
+// left to its default is not reported against one spelling it out.
+func withDefaults(def *api.AppDefinition) *api.AppDefinition {
+	cp := *def
+	cp.Listeners = append([]api.AppListener(nil), def.Listeners...)
+	SetDefaults(&cp)
+	return &cp
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// trimDefinitionChanges keeps the newest keep changes.
+func trimDefinitionChanges(changes []DefinitionChange, keep int) []DefinitionChange {
+	if len(changes) <= keep {
+		return changes
+	}
+	return append([]DefinitionChange(nil), changes[len(changes)-keep:]...)
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/services"
+)
+
+func TestDiffDefinitions_Categories(t *testing.T) {
+	current := publishTestDef(webListener, adminListener)
+	current.Environment = map[string]string{"MODE": "prod", "DB_PASSWORD": "hunter2", "OLD": "x"}
+	current.Storage = &api.AppStorage{Persistent: map[string]api.AppVolume{"data": {}}}
+
+	next := publishTestDef(api.AppListener{Name: "web", GuestPort: 8080}, api.AppListener{Name: "api", GuestPort: 9000})
+	next.Image = "nginx:1.27"
+	next.Environment = map[string]string{"MODE": "dev", "DB_PASSWORD": "swordfish", "NEW": "y"}
+	next.Permissions = &api.AppPermissions{Preset: "strict"}
+
+	rec := &services.ReconcileResult{
+		Endpoints: []services.ServiceEndpoint{
+			{Name: "web", GuestPort: 8080, HostBind: 15001, PublicPort: 35001},
+			{Name: "api", GuestPort: 9000, HostBind: 15003, PublicPort: 35003},
+		},
+		Added:   []services.ServiceEndpoint{{Name: "api", HostBind: 15003, PublicPort: 35003}},
+		Removed: []services.ServiceEndpoint{{Name: "admin", HostBind: 15002, PublicPort: 35002}},
+		GuestPortChanged: []struct{ Old, New services.ServiceEndpoint }{
+			{Old: services.ServiceEndpoint{Name: "web", GuestPort: 80}, New: services.ServiceEndpoint{Name: "web", GuestPort: 8080}},
+		},
+	}
+	d := diffDefinitions(current, next, rec)
+	if !d.Changed || !d.ContainerChange {
+		t.Fatalf("expected a container-changing diff: %+v", d)
+	}
+	if d.Image == nil || d.Image.From != "nginx:alpine" || d.Image.To != "nginx:1.27" {
+		t.Fatalf("image change: %+v", d.Image)
+	}
+
+	env := map[string]EnvChange{}
+	for _, e := range d.Environment {
+		env[e.Key] = e
+	}
+	if e := env["MODE"]; e.Change != ChangeModified || e.From != "prod" || e.To != "dev" || e.Masked {
+		t.Fatalf("MODE: %+v", e)
+	}
+	if e := env["DB_PASSWORD"]; e.Change != ChangeModified || !e.Masked || e.From != maskedEnvValue || e.To != maskedEnvValue {
+		t.Fatalf("DB_PASSWORD should be masked: %+v", e)
+	}
+	if env["OLD"].Change != ChangeRemoved || env["NEW"].Change != ChangeAdded || len(env) != 4 {
+		t.Fatalf("env added/removed: %+v", d.Environment)
+	}
+	for _, line := range d.Summary {
+		if strings.Contains(line, "hunter2") || strings.Contains(line, "swordfish") {
+			t.Fatalf("summary leaks a secret: %q", line)
+		}
+	}
+
+	listeners := map[string]ListenerChange{}
+	for _, l := range d.Listeners {
+		listeners[l.Name] = l
+	}
+	if l := listeners["web"]; l.Change != ChangeModified || len(l.Fields) != 1 || l.Fields[0] != "guest_port" || !strings.Contains(l.Consequence, "republished") {
+		t.Fatalf("web: %+v", l)
+	}
+	if l := listeners["api"]; l.Change != ChangeAdded || l.PublicPort != 35003 || !strings.Contains(l.Consequence, "opens public port 35003") {
+		t.Fatalf("api: %+v", l)
+	}
+	if l := listeners["admin"]; l.Change != ChangeRemoved || l.PublicPort != 35002 || !strings.Contains(l.Consequence, "releases public port 35002") {
+		t.Fatalf("admin: %+v", l)
+	}
+
+	sections := map[string]bool{}
+	for _, s := range d.Sections {
+		sections[s.Section] = true
+	}
+	if !sections["storage"] || !sections["permissions"] || len(sections) != 2 {
+		t.Fatalf("sections: %+v", d.Sections)
+	}
+}
+
+func TestDiffDefinitions_ProxyOnlyAndUnchanged(t *testing.T) {
+	current := publishTestDef(webListener)
+	if d := diffDefinitions(current, publishTestDef(webListener), nil); d.Changed || len(d.Summary) != 0 {
+		t.Fatalf("identical definitions reported changes: %+v", d)
+	}
+	empty := publishTestDef(webListener)
+	empty.DependsOn = []string{}
+	if d := diffDefinitions(current, empty, nil); d.Changed {
+		t.Fatalf("empty depends_on reported as a change: %+v", d)
+	}
+
+	next := publishTestDef(api.AppListener{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP})
+	rec := &services.ReconcileResult{
+		Endpoints:        []services.ServiceEndpoint{{Name: "web", PublicPort: 35001}},
+		ProxyOnlyChanged: []services.ServiceEndpoint{{Name: "web", PublicPort: 35001}},
+	}
+	d := diffDefinitions(current, next, rec)
+	if d.ContainerChange || len(d.Listeners) != 1 || d.Listeners[0].Consequence != "proxy on public port 35001 restarts" {
+		t.Fatalf("proxy-only change: %+v", d)
+	}
+}
+
+func TestDiffDefinition_PlansWithoutApplying(t *testing.T) {
+	manager, _ := newPublishTestManager(t)
+	installRunningBlog(t, manager)
+	before, _ := manager.serviceManager.GetAppListener("blog", "web")
+
+	d, err := manager.DiffDefinition(context.Background(), publishTestDef(adminListener))
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(d.Listeners) != 2 || !d.ContainerChange {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+	for _, l := range d.Listeners {
+		switch l.Name {
+		case "admin":
+			if l.Change != ChangeAdded || l.PublicPort == 0 {
+				t.Fatalf("admin should be added with a planned port: %+v", l)
+			}
+		case "web":
+			if l.Change != ChangeRemoved || l.PublicPort != before.PublicPort {
+				t.Fatalf("web should release %d: %+v", before.PublicPort, l)
+			}
+		}
+	}
+	if ep, ok := manager.serviceManager.GetAppListener("blog", "web"); !ok || ep.PublicPort != before.PublicPort || ep.HostBind != before.HostBind {
+		t.Fatalf("diff changed the web listener: %+v", ep)
+	}
+	if _, ok := manager.serviceManager.GetAppListener("blog", "admin"); ok {
+		t.Fatalf("diff registered the admin listener")
+	}
+
+	if _, err := manager.DiffDefinition(context.Background(), publishTestDef()); err != nil {
+		t.Fatalf("diff with no listeners: %v", err)
+	}
+	missing := publishTestDef(webListener)
+	missing.Name = "nope"
+	if _, err := manager.DiffDefinition(context.Background(), missing); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestUpsert_RecordsDefinitionHistory(t *testing.T) {
+	manager, mock := newPublishTestManager(t)
+	mock.publishUpdate = true
+	installRunningBlog(t, manager)
+	ctx := context.Background()
+
+	if _, err := manager.Upsert(ctx, publishTestDef(webListener, adminListener)); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	// Re-applying the same definition records nothing.
+	if _, err := manager.Upsert(ctx, publishTestDef(webListener, adminListener)); err != nil {
+		t.Fatalf("upsert again: %v", err)
+	}
+	def := publishTestDef(webListener, adminListener)
+	def.Image = "nginx:1.27"
+	if _, err := manager.Upsert(ctx, def); err != nil {
+		t.Fatalf("upsert image: %v", err)
+	}
+
+	history, err := manager.DefinitionHistory(ctx, "blog")
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected two changes, got %+v", history)
+	}
+	if history[0].Summary[0] != "image nginx:alpine -> nginx:1.27" || history[0].At.IsZero() {
+		t.Fatalf("newest change first: %+v", history[0])
+	}
+	if !strings.HasPrefix(history[1].Summary[0], "listener admin added (opens public port") {
+		t.Fatalf("listener change: %+v", history[1])
+	}
+
+	// The history survives a reload from disk.
+	reloaded, err := NewFilesystemStateManager(manager.stateManager.stateDir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if app, ok := reloaded.GetApp("blog"); !ok || len(app.Changes) != 2 {
+		t.Fatalf("history not persisted: %+v", app)
+	}
+}
+
+func TestRecordDefinitionChange_KeepsNewest(t *testing.T) {
+	fsm, err := NewFilesystemStateManager(newTestStateDir(t))
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	storeTestApp(t, fsm, "blog")
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxDefinitionChanges+5; i++ {
+		change := DefinitionChange{At: start.Add(time.Duration(i) * time.Minute), Summary: []string{fmt.Sprintf("change %d", i)}}
+		if err := fsm.RecordDefinitionChange("blog", change, maxDefinitionChanges); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	app, _ := fsm.GetApp("blog")
+	if len(app.Changes) != maxDefinitionChanges {
+		t.Fatalf("expected %d changes, got %d", maxDefinitionChanges, len(app.Changes))
+	}
+	if app.Changes[0].Summary[0] != "change 5" || app.Changes[len(app.Changes)-1].Summary[0] != fmt.Sprintf("change %d", maxDefinitionChanges+4) {
+		t.Fatalf("oldest changes should be dropped: first=%v last=%v", app.Changes[0], app.Changes[len(app.Changes)-1])
+	}
+}
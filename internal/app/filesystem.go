@@ -2,9 +2,13 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,14 +20,94 @@ const (
 	AppsDir    = "apps"
 	EnabledDir = "enabled"
 	CacheDir   = "cache"
+	// CorruptDir holds app directories that could not be loaded or repaired.
+	CorruptDir = "corrupt"
+	// LogsDir holds the captured container output of each app. It is kept
+	// apart from apps/ so the logs outlive an uninstall without purge.
+	LogsDir = "logs"
 )
 
+const (
+	appDefinitionFile = "app.yaml"
+	appPreviousFile   = "app.prev.yaml"
+	appMetadataFile   = "metadata.json"
+	quarantineFile    = "quarantine.json"
+
+	// Entries under apps/ starting with these prefixes are work in progress:
+	// a new app being assembled, or a removed one being deleted. App names
+	// cannot start with a dot, so they never collide with real apps.
+	stagingPrefix  = ".staging-"
+	removingPrefix = ".removing-"
+	tempFilePrefix = ".tmp-"
+)
+
+// writeStateFile replaces path atomically. Tests swap it to simulate a crash
+// between writes.
+var writeStateFile = writeFileAtomic
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes renames within dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// StateRecovery describes an app directory the startup scan had to fix.
+type StateRecovery struct {
+	App string
+	// Action is "repaired" or "quarantined".
+	Action string
+	Detail string
+}
+
+// QuarantinedApp is an app directory moved under corrupt/ because it could
+// not be loaded.
+type QuarantinedApp struct {
+	Name          string    `json:"name"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	// dir is the directory under corrupt/.
+	dir string
+}
+
 // FilesystemStateManager manages app state using filesystem as source of truth
 type FilesystemStateManager struct {
 	stateDir   string
 	appsDir    string
 	enabledDir string
 	cacheDir   string
+	corruptDir string
 
 	// In-memory cache for performance
 	cache   map[string]*AppInstance
@@ -31,16 +115,43 @@ type FilesystemStateManager struct {
 
 	// File system mutex for atomic operations
 	fsMu sync.Mutex
+
+	// recoveries lists what the startup scan fixed, until taken.
+	recoveries []StateRecovery
 }
 
 // AppMetadata represents runtime metadata stored separately from app.yaml
 type AppMetadata struct {
 	Name        string    `json:"name"`
-	Status      string    `json:"status"` // "created", "running", "stopped", "error"
+	Status      string    `json:"status"` // "created", "running", "paused", "stopped", "error"
 	ContainerID string    `json:"container_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
-	Enabled     bool      `json:"enabled"`
+	// Enabled records whether the app starts on boot. The enabled/ symlink
+	// is kept alongside it for releases that still read only the link.
+	Enabled     bool       `json:"enabled"`
+	LastError   string     `json:"last_error,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	TaskRuns    []TaskRun  `json:"task_runs,omitempty"`
+	// Changes is the app.yaml change history, oldest first.
+	Changes []DefinitionChange `json:"changes,omitempty"`
+}
+
+func metadataFor(app *AppInstance) AppMetadata {
+	return AppMetadata{
+		Name:        app.Name,
+		Status:      app.Status,
+		ContainerID: app.ContainerID,
+		CreatedAt:   app.CreatedAt,
+		UpdatedAt:   app.UpdatedAt,
+		Enabled:     app.Enabled,
+		LastError:   app.LastError,
+		ExitCode:    app.ExitCode,
+		LastErrorAt: app.LastErrorAt,
+		TaskRuns:    app.TaskRuns,
+		Changes:     app.Changes,
+	}
 }
 
 // NewFilesystemStateManager creates a new filesystem state manager
@@ -62,6 +173,7 @@ func NewFilesystemStateManager(stateDir string) (*FilesystemStateManager, error)
 		appsDir:    filepath.Join(stateDir, AppsDir),
 		enabledDir: filepath.Join(stateDir, EnabledDir),
 		cacheDir:   filepath.Join(stateDir, CacheDir),
+		corruptDir: filepath.Join(stateDir, CorruptDir),
 		cache:      make(map[string]*AppInstance),
 	}
 
@@ -91,7 +203,10 @@ func (fsm *FilesystemStateManager) initDirectories() error {
 	return nil
 }
 
-// loadCache loads all apps from filesystem into memory cache
+// loadCache loads all apps from filesystem into memory cache. It also
+// finishes or discards work an unclean shutdown interrupted: half-built and
+// half-deleted directories are removed, apps missing a file are repaired
+// where possible, and the rest are quarantined under corrupt/.
 func (fsm *FilesystemStateManager) loadCache() error {
 	entries, err := os.ReadDir(fsm.appsDir)
 	if err != nil {
@@ -102,59 +217,275 @@ func (fsm *FilesystemStateManager) loadCache() error {
 	defer fsm.cacheMu.Unlock()
 
 	for _, entry := range entries {
+		appName := entry.Name()
+		if strings.HasPrefix(appName, ".") {
+			if err := os.RemoveAll(filepath.Join(fsm.appsDir, appName)); err != nil {
+				log.Printf("WARN: app state: remove leftover %s: %v", appName, err)
+			}
+			continue
+		}
 		if !entry.IsDir() {
 			continue
 		}
 
-		appName := entry.Name()
+		removeTempFiles(filepath.Join(fsm.appsDir, appName))
 		app, err := fsm.loadAppFromDisk(appName)
-		if err != nil {
-			// Log error but continue loading other apps
-			fmt.Printf("Warning: failed to load app %s: %v\n", appName, err)
+		if err == nil {
+			fsm.syncEnabledMarker(app)
+			fsm.cache[appName] = app
 			continue
 		}
-
-		fsm.cache[appName] = app
+		app, detail, repairErr := fsm.repairApp(appName)
+		if repairErr == nil {
+			log.Printf("WARN: app state: repaired %s: %s", appName, detail)
+			fsm.recoveries = append(fsm.recoveries, StateRecovery{App: appName, Action: "repaired", Detail: detail})
+			fsm.syncEnabledMarker(app)
+			fsm.cache[appName] = app
+			continue
+		}
+		reason := fmt.Sprintf("%v; %v", err, repairErr)
+		if qerr := fsm.quarantine(appName, reason); qerr != nil {
+			// Leave it in place; the next start tries again.
+			log.Printf("WARN: app state: failed to quarantine %s: %v", appName, qerr)
+			continue
+		}
+		log.Printf("WARN: app state: quarantined %s: %s", appName, reason)
+		fsm.recoveries = append(fsm.recoveries, StateRecovery{App: appName, Action: "quarantined", Detail: reason})
 	}
 
 	return nil
 }
 
+// syncEnabledMarker reconciles the enabled flag in metadata.json with the
+// enabled/ symlink. An app enabled by either is enabled: a link left by an
+// older release is adopted into the flag, and a flagged app gets its link
+// back for releases that only read links.
+func (fsm *FilesystemStateManager) syncEnabledMarker(app *AppInstance) {
+	linkPath := filepath.Join(fsm.enabledDir, app.Name)
+	_, err := os.Lstat(linkPath)
+	linked := err == nil
+	switch {
+	case linked && !app.Enabled:
+		app.Enabled = true
+		data, err := json.MarshalIndent(metadataFor(app), "", "  ")
+		if err == nil {
+			err = writeStateFile(filepath.Join(fsm.appsDir, app.Name, appMetadataFile), data)
+		}
+		if err != nil {
+			log.Printf("WARN: app state: record enabled flag of %s: %v", app.Name, err)
+		}
+	case app.Enabled && !linked:
+		if err := os.Symlink(filepath.Join("..", AppsDir, app.Name), linkPath); err != nil && !os.IsExist(err) {
+			log.Printf("WARN: app state: recreate enabled link of %s: %v", app.Name, err)
+		}
+	}
+}
+
+// removeTempFiles drops temp files left by writes that never got renamed.
+func removeTempFiles(dir string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, tempFilePrefix+"*"))
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+}
+
 // loadAppFromDisk loads a single app from filesystem
 func (fsm *FilesystemStateManager) loadAppFromDisk(appName string) (*AppInstance, error) {
-	appDir := filepath.Join(fsm.appsDir, appName)
+	appDir, err := fsm.appDir(appName)
+	if err != nil {
+		return nil, err
+	}
+	appDef, err := readAppDefinition(filepath.Join(appDir, appDefinitionFile))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := readAppMetadata(filepath.Join(appDir, appMetadataFile))
+	if err != nil {
+		return nil, err
+	}
+	return appInstanceFrom(appDef, metadata), nil
+}
 
-	// Load app.yaml
-	appDefPath := filepath.Join(appDir, "app.yaml")
-	appDefData, err := os.ReadFile(appDefPath)
+// repairApp rebuilds an app directory that is missing app.yaml or
+// metadata.json. app.yaml comes back from app.prev.yaml; lost metadata is
+// recreated with the app marked as failed, since its container is unknown.
+func (fsm *FilesystemStateManager) repairApp(appName string) (*AppInstance, string, error) {
+	appDir, err := fsm.appDir(appName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read app.yaml: %w", err)
+		return nil, "", err
 	}
+	var fixes []string
 
-	appDef, err := ParseAppDefinition(appDefData)
+	appDef, err := readAppDefinition(filepath.Join(appDir, appDefinitionFile))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse app.yaml: %w", err)
+		prevPath := filepath.Join(appDir, appPreviousFile)
+		prev, prevErr := readAppDefinition(prevPath)
+		if prevErr != nil {
+			return nil, "", fmt.Errorf("no usable app definition: %w", prevErr)
+		}
+		data, readErr := os.ReadFile(prevPath)
+		if readErr != nil {
+			return nil, "", readErr
+		}
+		if err := writeStateFile(filepath.Join(appDir, appDefinitionFile), data); err != nil {
+			return nil, "", fmt.Errorf("restore app.yaml: %w", err)
+		}
+		appDef = prev
+		fixes = append(fixes, "app.yaml restored from app.prev.yaml")
+	}
+	if appDef.Name != appName {
+		return nil, "", fmt.Errorf("app.yaml names %q, not %q", appDef.Name, appName)
 	}
 
-	// Load metadata.json
-	metadataPath := filepath.Join(appDir, "metadata.json")
-	metadataData, err := os.ReadFile(metadataPath)
+	metaPath := filepath.Join(appDir, appMetadataFile)
+	metadata, err := readAppMetadata(metaPath)
+	if err != nil {
+		now := time.Now()
+		created := now
+		if info, statErr := os.Stat(filepath.Join(appDir, appDefinitionFile)); statErr == nil {
+			created = info.ModTime()
+		}
+		metadata = AppMetadata{
+			Name:        appName,
+			Status:      "error",
+			CreatedAt:   created,
+			UpdatedAt:   now,
+			LastError:   "app metadata was lost in an unclean shutdown; reinstall the app to recreate its container",
+			LastErrorAt: &now,
+		}
+		data, marshalErr := json.MarshalIndent(metadata, "", "  ")
+		if marshalErr != nil {
+			return nil, "", marshalErr
+		}
+		if err := writeStateFile(metaPath, data); err != nil {
+			return nil, "", fmt.Errorf("recreate metadata.json: %w", err)
+		}
+		fixes = append(fixes, "metadata.json recreated")
+	}
+	if len(fixes) == 0 {
+		return nil, "", errors.New("nothing to repair")
+	}
+	return appInstanceFrom(appDef, metadata), strings.Join(fixes, "; "), nil
+}
+
+// quarantine moves an unloadable app directory under corrupt/ with a note
+// saying why, and drops its enabled link.
+func (fsm *FilesystemStateManager) quarantine(appName, reason string) error {
+	if err := os.MkdirAll(fsm.corruptDir, 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(fsm.corruptDir, appName)
+	if _, err := os.Lstat(dest); err == nil {
+		dest = fmt.Sprintf("%s.%d", dest, time.Now().UnixNano())
+	}
+	if err := os.Rename(filepath.Join(fsm.appsDir, appName), dest); err != nil {
+		return err
+	}
+	note, err := json.MarshalIndent(QuarantinedApp{Name: appName, Reason: reason, QuarantinedAt: time.Now()}, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata.json: %w", err)
+		return err
 	}
+	if err := writeStateFile(filepath.Join(dest, quarantineFile), note); err != nil {
+		return err
+	}
+	_ = os.Remove(filepath.Join(fsm.enabledDir, appName))
+	return nil
+}
 
-	var metadata AppMetadata
-	if err := json.Unmarshal(metadataData, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to parse metadata.json: %w", err)
+// TakeRecoveries returns what the startup scan repaired or quarantined and
+// forgets it, so each recovery is reported once.
+func (fsm *FilesystemStateManager) TakeRecoveries() []StateRecovery {
+	fsm.cacheMu.Lock()
+	defer fsm.cacheMu.Unlock()
+	out := fsm.recoveries
+	fsm.recoveries = nil
+	return out
+}
+
+// ListQuarantined returns the app directories held under corrupt/.
+func (fsm *FilesystemStateManager) ListQuarantined() []QuarantinedApp {
+	entries, err := os.ReadDir(fsm.corruptDir)
+	if err != nil {
+		return nil
+	}
+	out := make([]QuarantinedApp, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(fsm.corruptDir, entry.Name())
+		q := QuarantinedApp{Name: entry.Name(), Reason: "unknown", dir: dir}
+		if data, err := os.ReadFile(filepath.Join(dir, quarantineFile)); err == nil {
+			_ = json.Unmarshal(data, &q)
+		}
+		out = append(out, q)
+	}
+	return out
+}
+
+// RemoveQuarantined deletes the quarantined copies of an app and reports
+// whether there were any.
+func (fsm *FilesystemStateManager) RemoveQuarantined(name string) (bool, error) {
+	fsm.fsMu.Lock()
+	defer fsm.fsMu.Unlock()
+	found := false
+	for _, q := range fsm.ListQuarantined() {
+		if q.Name != name {
+			continue
+		}
+		found = true
+		if err := os.RemoveAll(q.dir); err != nil {
+			return found, fmt.Errorf("failed to remove quarantined app: %w", err)
+		}
+	}
+	return found, nil
+}
+
+func readAppDefinition(path string) (*api.AppDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	appDef, err := parseInstalledAppDefinition(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return appDef, nil
+}
+
+// appDir returns the state directory of the named app. Names arrive from
+// API paths as well as from disk, so whatever validated them, a name that
+// does not resolve to a directory directly inside apps/ is refused.
+func (fsm *FilesystemStateManager) appDir(name string) (string, error) {
+	return childDir(fsm.appsDir, name)
+}
+
+func (fsm *FilesystemStateManager) logDir(name string) (string, error) {
+	return childDir(filepath.Join(fsm.stateDir, LogsDir), name)
+}
+
+func childDir(root, name string) (string, error) {
+	dir := filepath.Clean(filepath.Join(root, name))
+	if name == "" || filepath.Dir(dir) != filepath.Clean(root) {
+		return "", fmt.Errorf("invalid app name %q: outside the state directory", name)
 	}
+	return dir, nil
+}
 
-	// Check if app is enabled (symlink exists)
-	enabledPath := filepath.Join(fsm.enabledDir, appName)
-	_, err = os.Lstat(enabledPath)
-	// enabled := err == nil  // Not currently used in AppInstance
+func readAppMetadata(path string) (AppMetadata, error) {
+	var metadata AppMetadata
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return metadata, fmt.Errorf("failed to read metadata.json: %w", err)
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to parse metadata.json: %w", err)
+	}
+	return metadata, nil
+}
 
-	// Create AppInstance
-	app := &AppInstance{
+func appInstanceFrom(appDef *api.AppDefinition, metadata AppMetadata) *AppInstance {
+	return &AppInstance{
 		Name:        appDef.Name,
 		Image:       appDef.Image,
 		Type:        appDef.Type,
@@ -164,23 +495,30 @@ func (fsm *FilesystemStateManager) loadAppFromDisk(appName string) (*AppInstance
 		Environment: appDef.Environment,
 		CreatedAt:   metadata.CreatedAt,
 		UpdatedAt:   metadata.UpdatedAt,
+		Enabled:     metadata.Enabled,
+		LastError:   metadata.LastError,
+		ExitCode:    metadata.ExitCode,
+		LastErrorAt: metadata.LastErrorAt,
+		TaskRuns:    metadata.TaskRuns,
+		Changes:     metadata.Changes,
 	}
-
-	return app, nil
 }
 
 // BackupCurrentAppDefinition writes current app.yaml to app.prev.yaml for rollback
 func (fsm *FilesystemStateManager) BackupCurrentAppDefinition(name string) error {
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
-	appDir := filepath.Join(fsm.appsDir, name)
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return err
+	}
 	cur := filepath.Join(appDir, "app.yaml")
 	prev := filepath.Join(appDir, "app.prev.yaml")
 	data, err := os.ReadFile(cur)
 	if err != nil {
 		return fmt.Errorf("read current app.yaml: %w", err)
 	}
-	if err := os.WriteFile(prev, data, 0644); err != nil {
+	if err := writeStateFile(prev, data); err != nil {
 		return fmt.Errorf("write app.prev.yaml: %w", err)
 	}
 	return nil
@@ -188,13 +526,16 @@ func (fsm *FilesystemStateManager) BackupCurrentAppDefinition(name string) error
 
 // GetPreviousAppDefinition reads app.prev.yaml if present
 func (fsm *FilesystemStateManager) GetPreviousAppDefinition(name string) (*api.AppDefinition, error) {
-	appDir := filepath.Join(fsm.appsDir, name)
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return nil, err
+	}
 	prev := filepath.Join(appDir, "app.prev.yaml")
 	data, err := os.ReadFile(prev)
 	if err != nil {
 		return nil, fmt.Errorf("previous definition not found: %w", err)
 	}
-	def, err := ParseAppDefinition(data)
+	def, err := parseInstalledAppDefinition(data)
 	if err != nil {
 		return nil, fmt.Errorf("parse previous app.yaml: %w", err)
 	}
@@ -203,57 +544,75 @@ func (fsm *FilesystemStateManager) GetPreviousAppDefinition(name string) (*api.A
 
 // GetAppDefinition reads and parses app.yaml for a given app name
 func (fsm *FilesystemStateManager) GetAppDefinition(name string) (*api.AppDefinition, error) {
-	appDir := filepath.Join(fsm.appsDir, name)
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return nil, err
+	}
 	appDefPath := filepath.Join(appDir, "app.yaml")
 	data, err := os.ReadFile(appDefPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read app.yaml: %w", err)
 	}
-	appDef, err := ParseAppDefinition(data)
+	appDef, err := parseInstalledAppDefinition(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse app.yaml: %w", err)
 	}
 	return appDef, nil
 }
 
-// StoreApp saves app definition and metadata to filesystem
+// StoreApp saves app definition and metadata to filesystem. A new app is
+// assembled in a staging directory and renamed into place, so apps/ never
+// holds half of one; an existing app gets app.yaml first and metadata.json
+// last, each replaced atomically.
 func (fsm *FilesystemStateManager) StoreApp(app *AppInstance, appDef *api.AppDefinition) error {
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
 
-	appDir := filepath.Join(fsm.appsDir, app.Name)
-	if err := os.MkdirAll(appDir, 0755); err != nil {
-		return fmt.Errorf("failed to create app directory: %w", err)
-	}
+	// Enabling is not part of storing an app; keep whatever was recorded.
+	fsm.cacheMu.RLock()
+	cached, ok := fsm.cache[app.Name]
+	fsm.cacheMu.RUnlock()
+	app.Enabled = ok && cached.Enabled
 
-	// Store app.yaml
-	appDefPath := filepath.Join(appDir, "app.yaml")
 	appDefData, err := SerializeAppDefinition(appDef)
 	if err != nil {
 		return fmt.Errorf("failed to serialize app definition: %w", err)
 	}
-
-	if err := os.WriteFile(appDefPath, appDefData, 0644); err != nil {
-		return fmt.Errorf("failed to write app.yaml: %w", err)
-	}
-
-	// Store metadata.json
-	metadata := AppMetadata{
-		Name:        app.Name,
-		Status:      app.Status,
-		ContainerID: app.ContainerID,
-		CreatedAt:   app.CreatedAt,
-		UpdatedAt:   app.UpdatedAt,
-	}
-
-	metadataData, err := json.MarshalIndent(metadata, "", "  ")
+	metadataData, err := json.MarshalIndent(metadataFor(app), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to serialize metadata: %w", err)
 	}
 
-	metadataPath := filepath.Join(appDir, "metadata.json")
-	if err := os.WriteFile(metadataPath, metadataData, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata.json: %w", err)
+	appDir, err := fsm.appDir(app.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(appDir); err == nil {
+		if err := writeAppFiles(appDir, appDefData, metadataData); err != nil {
+			return err
+		}
+	} else if os.IsNotExist(err) {
+		staging, err := os.MkdirTemp(fsm.appsDir, stagingPrefix+app.Name+"-")
+		if err != nil {
+			return fmt.Errorf("failed to create app directory: %w", err)
+		}
+		if err := os.Chmod(staging, 0755); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to create app directory: %w", err)
+		}
+		if err := writeAppFiles(staging, appDefData, metadataData); err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+		if err := os.Rename(staging, appDir); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to create app directory: %w", err)
+		}
+		if err := syncDir(fsm.appsDir); err != nil {
+			return fmt.Errorf("failed to sync apps directory: %w", err)
+		}
+	} else {
+		return fmt.Errorf("failed to stat app directory: %w", err)
 	}
 
 	// Update cache
@@ -264,8 +623,82 @@ func (fsm *FilesystemStateManager) StoreApp(app *AppInstance, appDef *api.AppDef
 	return nil
 }
 
-// UpdateAppStatus updates just the app status and updated timestamp
+// writeAppFiles writes app.yaml, then metadata.json, into dir.
+func writeAppFiles(dir string, appDefData, metadataData []byte) error {
+	if err := writeStateFile(filepath.Join(dir, appDefinitionFile), appDefData); err != nil {
+		return fmt.Errorf("failed to write app.yaml: %w", err)
+	}
+	if err := writeStateFile(filepath.Join(dir, appMetadataFile), metadataData); err != nil {
+		return fmt.Errorf("failed to write metadata.json: %w", err)
+	}
+	return nil
+}
+
+// UpdateAppStatus updates just the app status and updated timestamp. A
+// running app has recovered, so its last failure is cleared.
 func (fsm *FilesystemStateManager) UpdateAppStatus(name, status string) error {
+	return fsm.updateMetadata(name, func(app *AppInstance) {
+		app.Status = status
+		if status == "running" {
+			app.LastError = ""
+			app.ExitCode = nil
+			app.LastErrorAt = nil
+		}
+	})
+}
+
+// RecordAppFailure sets the app status and remembers why it got there.
+// exitCode is nil when the runtime did not report one.
+func (fsm *FilesystemStateManager) RecordAppFailure(name, status, message string, exitCode *int) error {
+	return fsm.updateMetadata(name, func(app *AppInstance) {
+		now := time.Now()
+		app.Status = status
+		app.LastError = message
+		app.ExitCode = exitCode
+		app.LastErrorAt = &now
+	})
+}
+
+// RecordTaskRun appends run to the app's task history, keeping the newest
+// keep runs of each task. It leaves UpdatedAt alone: the app itself did not
+// change.
+func (fsm *FilesystemStateManager) RecordTaskRun(name string, run TaskRun, keep int) error {
+	return fsm.rewriteMetadata(name, false, func(app *AppInstance) {
+		app.TaskRuns = trimTaskRuns(append(app.TaskRuns, run), keep)
+	})
+}
+
+// RecordDefinitionChange appends change to the app's app.yaml history,
+// keeping the newest keep changes.
+func (fsm *FilesystemStateManager) RecordDefinitionChange(name string, change DefinitionChange, keep int) error {
+	return fsm.rewriteMetadata(name, true, func(app *AppInstance) {
+		app.Changes = trimDefinitionChanges(append(app.Changes, change), keep)
+	})
+}
+
+// trimTaskRuns drops the oldest runs of any task with more than keep.
+func trimTaskRuns(runs []TaskRun, keep int) []TaskRun {
+	counts := make(map[string]int)
+	for _, r := range runs {
+		counts[r.Task]++
+	}
+	out := make([]TaskRun, 0, len(runs))
+	for _, r := range runs {
+		if counts[r.Task] > keep {
+			counts[r.Task]--
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// updateMetadata applies fn to the cached app and rewrites metadata.json.
+func (fsm *FilesystemStateManager) updateMetadata(name string, fn func(app *AppInstance)) error {
+	return fsm.rewriteMetadata(name, true, fn)
+}
+
+func (fsm *FilesystemStateManager) rewriteMetadata(name string, touch bool, fn func(app *AppInstance)) error {
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
 
@@ -277,28 +710,26 @@ func (fsm *FilesystemStateManager) UpdateAppStatus(name, status string) error {
 		return fmt.Errorf("app not found: %s", name)
 	}
 
-	app.Status = status
-	app.UpdatedAt = time.Now()
+	fn(app)
+	if touch {
+		app.UpdatedAt = time.Now()
+	}
+	metadata := metadataFor(app)
 	fsm.cacheMu.Unlock()
 
 	// Update filesystem
-	appDir := filepath.Join(fsm.appsDir, name)
-	metadataPath := filepath.Join(appDir, "metadata.json")
-
-	metadata := AppMetadata{
-		Name:        app.Name,
-		Status:      status,
-		ContainerID: app.ContainerID,
-		CreatedAt:   app.CreatedAt,
-		UpdatedAt:   app.UpdatedAt,
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return err
 	}
+	metadataPath := filepath.Join(appDir, "metadata.json")
 
 	metadataData, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to serialize metadata: %w", err)
 	}
 
-	if err := os.WriteFile(metadataPath, metadataData, 0644); err != nil {
+	if err := writeStateFile(metadataPath, metadataData); err != nil {
 		return fmt.Errorf("failed to write metadata.json: %w", err)
 	}
 
@@ -332,9 +763,17 @@ func (fsm *FilesystemStateManager) RemoveApp(name string) error {
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
 
-	// Remove from filesystem
-	appDir := filepath.Join(fsm.appsDir, name)
-	if err := os.RemoveAll(appDir); err != nil {
+	// Rename out of the way first: if deletion is interrupted, the startup
+	// scan finishes it instead of loading a partial app.
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return err
+	}
+	tombstone := filepath.Join(fsm.appsDir, removingPrefix+name)
+	if err := os.Rename(appDir, tombstone); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove app directory: %w", err)
+	}
+	if err := os.RemoveAll(tombstone); err != nil {
 		return fmt.Errorf("failed to remove app directory: %w", err)
 	}
 
@@ -350,68 +789,75 @@ func (fsm *FilesystemStateManager) RemoveApp(name string) error {
 	return nil
 }
 
-// EnableApp creates a symlink to enable app (systemctl-style)
+// EnableApp marks an app to start on boot (systemctl-style). The flag lives
+// in metadata.json; the enabled/ symlink is kept for older releases.
 func (fsm *FilesystemStateManager) EnableApp(name string) error {
+	appDir, err := fsm.appDir(name)
+	if err != nil {
+		return err
+	}
+	if _, exists := fsm.GetApp(name); !exists {
+		return fmt.Errorf("app not found: %s", name)
+	}
+	if err := fsm.rewriteMetadata(name, false, func(app *AppInstance) { app.Enabled = true }); err != nil {
+		return err
+	}
+
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
-
-	appDir := filepath.Join(fsm.appsDir, name)
-	enabledPath := filepath.Join(fsm.enabledDir, name)
-
-	// Check if app exists
 	if _, err := os.Stat(appDir); err != nil {
 		return fmt.Errorf("app not found: %s", name)
 	}
-
-	// Create symlink (relative path for portability)
+	// Relative path for portability
 	relativePath := filepath.Join("..", AppsDir, name)
-	if err := os.Symlink(relativePath, enabledPath); err != nil {
-		if os.IsExist(err) {
-			return nil // Already enabled
-		}
+	if err := os.Symlink(relativePath, filepath.Join(fsm.enabledDir, name)); err != nil && !os.IsExist(err) {
 		return fmt.Errorf("failed to create symlink: %w", err)
 	}
-
 	return nil
 }
 
-// DisableApp removes the symlink to disable app
+// DisableApp clears the enabled flag and removes the symlink.
 func (fsm *FilesystemStateManager) DisableApp(name string) error {
+	enabledPath, err := childDir(fsm.enabledDir, name)
+	if err != nil {
+		return err
+	}
+	if _, exists := fsm.GetApp(name); exists {
+		if err := fsm.rewriteMetadata(name, false, func(app *AppInstance) { app.Enabled = false }); err != nil {
+			return err
+		}
+	}
+
 	fsm.fsMu.Lock()
 	defer fsm.fsMu.Unlock()
-
-	enabledPath := filepath.Join(fsm.enabledDir, name)
-	if err := os.Remove(enabledPath); err != nil {
-		if os.IsNotExist(err) {
-			return nil // Already disabled
-		}
+	if err := os.Remove(enabledPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove symlink: %w", err)
 	}
-
 	return nil
 }
 
-// IsAppEnabled checks if app is enabled (symlink exists)
+// IsAppEnabled reports whether an app is enabled.
 func (fsm *FilesystemStateManager) IsAppEnabled(name string) bool {
-	enabledPath := filepath.Join(fsm.enabledDir, name)
-	_, err := os.Lstat(enabledPath)
-	return err == nil
+	app, exists := fsm.GetApp(name)
+	if !exists {
+		return false
+	}
+	fsm.cacheMu.RLock()
+	defer fsm.cacheMu.RUnlock()
+	return app.Enabled
 }
 
-// ListEnabledApps returns names of all enabled apps
+// ListEnabledApps returns names of all enabled apps, sorted.
 func (fsm *FilesystemStateManager) ListEnabledApps() ([]string, error) {
-	entries, err := os.ReadDir(fsm.enabledDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read enabled directory: %w", err)
-	}
+	fsm.cacheMu.RLock()
+	defer fsm.cacheMu.RUnlock()
 
 	var enabled []string
-	for _, entry := range entries {
-		// Only count symlinks
-		if entry.Type()&os.ModeSymlink != 0 {
-			enabled = append(enabled, entry.Name())
+	for name, app := range fsm.cache {
+		if app.Enabled {
+			enabled = append(enabled, name)
 		}
 	}
-
+	sort.Strings(enabled)
 	return enabled, nil
 }
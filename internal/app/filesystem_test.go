@@ -0,0 +1,292 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+func newTestStateDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "fs-state")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// newMockAppManager returns an unlocked manager over a fresh state directory
+// and a mock runtime, with mount verification and the legacy state
+// directory out of the way.
+func newMockAppManager(t *testing.T) (*AppManager, *MockContainerManager) {
+	t.Helper()
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, newTestStateDir(t))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	manager.legacyStateDir = ""
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	return manager, mock
+}
+
+func storeTestApp(t *testing.T, fsm *FilesystemStateManager, name string) {
+	t.Helper()
+	def := &api.AppDefinition{Name: name, Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
+	now := time.Now()
+	app := &AppInstance{Name: name, Image: def.Image, Type: def.Type, Status: "running", ContainerID: "c-" + name, CreatedAt: now, UpdatedAt: now}
+	if err := fsm.StoreApp(app, def); err != nil {
+		t.Fatalf("store %s: %v", name, err)
+	}
+}
+
+func TestFilesystemState_CrashDuringInstallLeavesNoPartialApp(t *testing.T) {
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+
+	// Fail the metadata write, as if the process died after app.yaml.
+	crash := errors.New("simulated crash")
+	writeStateFile = func(path string, data []byte) error {
+		if filepath.Base(path) == appMetadataFile {
+			return crash
+		}
+		return writeFileAtomic(path, data)
+	}
+	t.Cleanup(func() { writeStateFile = writeFileAtomic })
+	def := &api.AppDefinition{Name: "half", Image: "nginx:alpine", Type: "user"}
+	if err := fsm.StoreApp(&AppInstance{Name: "half", Status: "created"}, def); !errors.Is(err, crash) {
+		t.Fatalf("expected simulated crash, got %v", err)
+	}
+	writeStateFile = writeFileAtomic
+	if _, err := os.Stat(filepath.Join(dir, AppsDir, "half")); !os.IsNotExist(err) {
+		t.Fatalf("partial app directory left in apps/: %v", err)
+	}
+
+	// Leftovers a hard crash would leave behind are cleaned on the next scan.
+	storeTestApp(t, fsm, "good")
+	for _, p := range []string{
+		filepath.Join(dir, AppsDir, stagingPrefix+"half-123", appDefinitionFile),
+		filepath.Join(dir, AppsDir, removingPrefix+"gone", appMetadataFile),
+	} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	tmp := filepath.Join(dir, AppsDir, "good", tempFilePrefix+appMetadataFile+"-1")
+	if err := os.WriteFile(tmp, []byte("{"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	reloaded, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if apps := reloaded.ListApps(); len(apps) != 1 || apps[0].Name != "good" || apps[0].Status != "running" {
+		t.Fatalf("unexpected apps after reload: %+v", apps)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, AppsDir))
+	if len(entries) != 1 {
+		t.Fatalf("leftovers not cleaned: %v", entries)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatalf("temp file not cleaned: %v", err)
+	}
+	if got := reloaded.TakeRecoveries(); len(got) != 0 {
+		t.Fatalf("unexpected recoveries %+v", got)
+	}
+}
+
+func TestFilesystemState_RepairsMissingFiles(t *testing.T) {
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	storeTestApp(t, fsm, "nometa")
+	storeTestApp(t, fsm, "nodef")
+	if err := fsm.BackupCurrentAppDefinition("nodef"); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, AppsDir, "nometa", appMetadataFile)); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, AppsDir, "nodef", appDefinitionFile), nil, 0644); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	reloaded, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	nometa, ok := reloaded.GetApp("nometa")
+	if !ok || nometa.Status != "error" || nometa.ContainerID != "" || !strings.Contains(nometa.LastError, "unclean shutdown") {
+		t.Fatalf("missing metadata not repaired: %+v", nometa)
+	}
+	nodef, ok := reloaded.GetApp("nodef")
+	if !ok || nodef.Status != "running" || nodef.ContainerID != "c-nodef" {
+		t.Fatalf("app.yaml not restored: %+v", nodef)
+	}
+	if def, err := reloaded.GetAppDefinition("nodef"); err != nil || def.Image != "nginx:alpine" {
+		t.Fatalf("restored definition unreadable: %+v %v", def, err)
+	}
+	recoveries := reloaded.TakeRecoveries()
+	if len(recoveries) != 2 {
+		t.Fatalf("expected two recoveries, got %+v", recoveries)
+	}
+	for _, r := range recoveries {
+		if r.Action != "repaired" {
+			t.Fatalf("unexpected recovery %+v", r)
+		}
+	}
+	if again := reloaded.TakeRecoveries(); len(again) != 0 {
+		t.Fatalf("recoveries reported twice: %+v", again)
+	}
+
+	// The repair is written back, so the next start is clean.
+	third, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("third load: %v", err)
+	}
+	if got := third.TakeRecoveries(); len(got) != 0 {
+		t.Fatalf("repair not persisted: %+v", got)
+	}
+}
+
+func TestAppManager_QuarantinedAppListedAndUninstallable(t *testing.T) {
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	storeTestApp(t, fsm, "broken")
+	storeTestApp(t, fsm, "fine")
+	if err := fsm.EnableApp("broken"); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	brokenDir := filepath.Join(dir, AppsDir, "broken")
+	if err := os.WriteFile(filepath.Join(brokenDir, appDefinitionFile), []byte("::not yaml"), 0644); err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+
+	manager, err := NewAppManager(NewMockContainerManager(), dir)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	ctx := context.Background()
+
+	apps, err := manager.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	statuses := map[string]*AppInstance{}
+	for _, a := range apps {
+		statuses[a.Name] = a
+	}
+	if len(apps) != 2 || statuses["fine"] == nil || statuses["broken"] == nil {
+		t.Fatalf("unexpected list %+v", apps)
+	}
+	if b := statuses["broken"]; b.Status != "corrupt" || !strings.Contains(b.LastError, "app.yaml") {
+		t.Fatalf("quarantined app not reported: %+v", b)
+	}
+	if _, err := os.Stat(brokenDir); !os.IsNotExist(err) {
+		t.Fatalf("corrupt app still under apps/: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CorruptDir, "broken", quarantineFile)); err != nil {
+		t.Fatalf("quarantine note missing: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, EnabledDir, "broken")); !os.IsNotExist(err) {
+		t.Fatalf("quarantined app still enabled: %v", err)
+	}
+
+	if err := manager.Uninstall(ctx, "broken"); err != nil {
+		t.Fatalf("uninstall quarantined: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CorruptDir, "broken")); !os.IsNotExist(err) {
+		t.Fatalf("quarantined directory not removed: %v", err)
+	}
+	if apps, _ := manager.List(ctx); len(apps) != 1 || apps[0].Name != "fine" {
+		t.Fatalf("unexpected list after uninstall %+v", apps)
+	}
+	if err := manager.Uninstall(ctx, "broken"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("second uninstall should report not found, got %v", err)
+	}
+}
+
+func TestAppManager_GrandfathersInvalidAppNames(t *testing.T) {
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	// Installed before "portal" was reserved.
+	storeTestApp(t, fsm, "portal")
+	storeTestApp(t, fsm, "blog")
+
+	manager, err := NewAppManager(NewMockContainerManager(), dir)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	ctx := context.Background()
+
+	legacy, err := manager.Get(ctx, "portal")
+	if err != nil {
+		t.Fatalf("grandfathered app did not load: %v", err)
+	}
+	if len(legacy.Warnings) != 1 || !strings.Contains(legacy.Warnings[0], "reserved") {
+		t.Fatalf("expected a name warning, got %+v", legacy.Warnings)
+	}
+	if _, err := fsm.GetAppDefinition("portal"); err != nil {
+		t.Fatalf("grandfathered definition unreadable: %v", err)
+	}
+	blog, err := manager.Get(ctx, "blog")
+	if err != nil || len(blog.Warnings) != 0 {
+		t.Fatalf("valid app: %+v %v", blog, err)
+	}
+	if _, err := manager.Install(ctx, &api.AppDefinition{Name: "control", Image: "nginx:alpine"}); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("expected a reserved name to be refused, got %v", err)
+	}
+}
+
+func TestFilesystemState_RefusesNamesOutsideAppsDir(t *testing.T) {
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	for _, name := range []string{"..", "../../etc", "a/b", "", "."} {
+		if _, err := fsm.GetAppDefinition(name); err == nil {
+			t.Fatalf("GetAppDefinition(%q) should fail", name)
+		}
+		def := &api.AppDefinition{Name: name, Image: "nginx:alpine", Type: "user"}
+		if err := fsm.StoreApp(&AppInstance{Name: name, Status: "created"}, def); err == nil {
+			t.Fatalf("StoreApp(%q) should fail", name)
+		}
+		if err := fsm.RemoveApp(name); err == nil {
+			t.Fatalf("RemoveApp(%q) should fail", name)
+		}
+		if fsm.IsAppEnabled(name) {
+			t.Fatalf("IsAppEnabled(%q) = true", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "etc")); !os.IsNotExist(err) {
+		t.Fatalf("traversal wrote outside apps/: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/state/paths"
+)
+
+// ErrHostMountNotAllowed is returned when an app binds a host path that is
+// not under the mount allowlist or that overlaps the daemon's own state.
+var ErrHostMountNotAllowed = errors.New("app manager: host mount not allowed")
+
+// protectedHostDirs can never be allowlisted or mounted, whatever the
+// allowlist says.
+var protectedHostDirs = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/root",
+	"/run", "/sbin", "/sys", "/usr", "/var/lib/containers",
+}
+
+// HostMountStatus describes a host mount of an installed app.
+type HostMountStatus struct {
+	Host        string `json:"host"`
+	Container   string `json:"container"`
+	ReadOnly    bool   `json:"read_only"`
+	SELinux     string `json:"selinux,omitempty"`
+	Allowlisted bool   `json:"allowlisted"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// SetHostMountAllowlist replaces the host directories apps may mount. Until
+// it is called no host mount is allowed.
+func (m *AppManager) SetHostMountAllowlist(dirs []string) {
+	clean := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		clean = append(clean, filepath.Clean(dir))
+	}
+	m.mountMu.Lock()
+	m.mountAllowlist = clean
+	m.mountMu.Unlock()
+}
+
+// HostMountAllowlist returns the host directories apps may mount.
+func (m *AppManager) HostMountAllowlist() []string {
+	m.mountMu.RLock()
+	defer m.mountMu.RUnlock()
+	return append([]string(nil), m.mountAllowlist...)
+}
+
+// NormalizeHostMountAllowlist cleans, sorts and deduplicates dirs, refusing
+// relative paths, system directories and anything overlapping the state
+// directory.
+func (m *AppManager) NormalizeHostMountAllowlist(dirs []string) ([]string, error) {
+	seen := make(map[string]bool, len(dirs))
+	out := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		dir = strings.TrimSpace(dir)
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("allowlist path %q must be absolute", dir)
+		}
+		dir = filepath.Clean(dir)
+		if reason := m.protectedReason(dir); reason != "" {
+			return nil, fmt.Errorf("allowlist path %q %s", dir, reason)
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			out = append(out, dir)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// stateRoots lists the directories holding daemon state, current and past.
+func (m *AppManager) stateRoots() []string {
+	m.stateInitMu.Lock()
+	roots := []string{m.stateBaseDir, m.prevStateBase, m.legacyStateDir}
+	m.stateInitMu.Unlock()
+	roots = append(roots, paths.Root())
+	out := roots[:0]
+	for _, r := range roots {
+		if r != "" {
+			out = append(out, filepath.Clean(r))
+		}
+	}
+	return out
+}
+
+// protectedReason says why dir may not be mounted into an app, or returns
+// "" when nothing forbids it.
+func (m *AppManager) protectedReason(dir string) string {
+	if dir == "/" {
+		return "is the root directory"
+	}
+	for _, p := range protectedHostDirs {
+		if pathWithin(dir, p) {
+			return "is a system directory"
+		}
+	}
+	for _, root := range m.stateRoots() {
+		if pathWithin(dir, root) || pathWithin(root, dir) {
+			return "overlaps the piccolod state directory"
+		}
+	}
+	return ""
+}
+
+// hostMountReason says why a host mount is refused, or returns "" when the
+// host path is allowlisted. Symlinks are resolved so a link inside an
+// allowlisted directory cannot point the mount elsewhere.
+func (m *AppManager) hostMountReason(mount api.AppHostMount) string {
+	host := filepath.Clean(mount.Host)
+	candidates := []string{host}
+	if resolved, err := filepath.EvalSymlinks(host); err == nil && resolved != host {
+		candidates = append(candidates, resolved)
+	}
+	for _, c := range candidates {
+		if reason := m.protectedReason(c); reason != "" {
+			return reason
+		}
+	}
+	allowlist := m.HostMountAllowlist()
+	for _, c := range candidates {
+		allowed := false
+		for _, dir := range allowlist {
+			if pathWithin(c, dir) {
+				allowed = true
+				break
+			}
+			if resolved, err := filepath.EvalSymlinks(dir); err == nil && pathWithin(c, resolved) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "is not under the mount allowlist"
+		}
+	}
+	return ""
+}
+
+// checkHostMounts refuses an app definition with any host mount that is not
+// allowed.
+func (m *AppManager) checkHostMounts(appDef *api.AppDefinition) error {
+	if appDef == nil || appDef.Storage == nil {
+		return nil
+	}
+	for _, mount := range appDef.Storage.HostMounts {
+		if reason := m.hostMountReason(mount); reason != "" {
+			return fmt.Errorf("%w: %s %s", ErrHostMountNotAllowed, mount.Host, reason)
+		}
+	}
+	return nil
+}
+
+// hostMountVolumes translates an app's host mounts into Podman volume
+// mappings, read-only unless the mount is explicitly writable.
+func (m *AppManager) hostMountVolumes(appDef *api.AppDefinition) ([]container.VolumeMapping, error) {
+	if err := m.checkHostMounts(appDef); err != nil {
+		return nil, err
+	}
+	if appDef == nil || appDef.Storage == nil {
+		return nil, nil
+	}
+	volumes := make([]container.VolumeMapping, 0, len(appDef.Storage.HostMounts))
+	for _, mount := range appDef.Storage.HostMounts {
+		options := "ro"
+		if mount.Writable() {
+			options = "rw"
+		}
+		if mount.SELinux != "" {
+			options += "," + mount.SELinux
+		}
+		volumes = append(volumes, container.VolumeMapping{
+			Host:      filepath.Clean(mount.Host),
+			Container: filepath.Clean(mount.Container),
+			Options:   options,
+		})
+	}
+	return volumes, nil
+}
+
+// HostMounts reports the host mounts of an installed app and whether each
+// is allowed under the current allowlist.
+func (m *AppManager) HostMounts(ctx context.Context, name string) ([]HostMountStatus, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+	out := []HostMountStatus{}
+	if def.Storage == nil {
+		return out, nil
+	}
+	for _, mount := range def.Storage.HostMounts {
+		reason := m.hostMountReason(mount)
+		out = append(out, HostMountStatus{
+			Host:        filepath.Clean(mount.Host),
+			Container:   filepath.Clean(mount.Container),
+			ReadOnly:    !mount.Writable(),
+			SELinux:     mount.SELinux,
+			Allowlisted: reason == "",
+			Reason:      reason,
+		})
+	}
+	return out, nil
+}
+
+// hostMountPaths lists the host directories an app mounts.
+func hostMountPaths(appDef *api.AppDefinition) []string {
+	if appDef == nil || appDef.Storage == nil {
+		return nil
+	}
+	out := make([]string, 0, len(appDef.Storage.HostMounts))
+	for _, mount := range appDef.Storage.HostMounts {
+		out = append(out, filepath.Clean(mount.Host))
+	}
+	return out
+}
+
+// overlapsAny reports whether path is one of dirs, lies below one or
+// contains one.
+func overlapsAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if pathWithin(path, dir) || pathWithin(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether path is dir or lies below it. Both must be
+// clean.
+func pathWithin(path, dir string) bool {
+	if path == dir || dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
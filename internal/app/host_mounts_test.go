@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"piccolod/internal/api"
+)
+
+func mediaApp(name string, mounts ...api.AppHostMount) *api.AppDefinition {
+	return &api.AppDefinition{
+		Name:      name,
+		Image:     "jellyfin/jellyfin:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 8096}},
+		Storage:   &api.AppStorage{HostMounts: mounts},
+	}
+}
+
+func TestAppManager_HostMountsRequireAllowlist(t *testing.T) {
+	manager, _ := newMockAppManager(t)
+	media := t.TempDir()
+	ctx := context.Background()
+	def := mediaApp("jellyfin", api.AppHostMount{Host: filepath.Join(media, "movies"), Container: "/media/movies"})
+
+	if _, err := manager.Install(ctx, def); !errors.Is(err, ErrHostMountNotAllowed) {
+		t.Fatalf("expected ErrHostMountNotAllowed without an allowlist, got %v", err)
+	}
+	manager.SetHostMountAllowlist([]string{filepath.Join(media, "music")})
+	if _, err := manager.Install(ctx, def); !errors.Is(err, ErrHostMountNotAllowed) {
+		t.Fatalf("expected sibling directory refused, got %v", err)
+	}
+
+	// A link inside an allowlisted directory cannot reach outside it.
+	outside := t.TempDir()
+	allowed := filepath.Join(media, "music")
+	if err := os.MkdirAll(allowed, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	escape := mediaApp("escape", api.AppHostMount{Host: filepath.Join(allowed, "escape"), Container: "/media"})
+	if _, err := manager.Install(ctx, escape); !errors.Is(err, ErrHostMountNotAllowed) {
+		t.Fatalf("expected symlink escape refused, got %v", err)
+	}
+
+	manager.SetHostMountAllowlist([]string{media})
+	if _, err := manager.Install(ctx, def); err != nil {
+		t.Fatalf("install under the allowlist: %v", err)
+	}
+	mounts, err := manager.HostMounts(ctx, "jellyfin")
+	if err != nil || len(mounts) != 1 || !mounts[0].Allowlisted || !mounts[0].ReadOnly {
+		t.Fatalf("unexpected host mounts %+v (%v)", mounts, err)
+	}
+
+	// Shrinking the allowlist shows up in the status of installed apps.
+	manager.SetHostMountAllowlist(nil)
+	mounts, err = manager.HostMounts(ctx, "jellyfin")
+	if err != nil || mounts[0].Allowlisted || mounts[0].Reason == "" {
+		t.Fatalf("expected mount reported as not allowlisted, got %+v (%v)", mounts, err)
+	}
+}
+
+func TestAppManager_HostMountsRefuseStateDir(t *testing.T) {
+	manager, _ := newMockAppManager(t)
+	base := manager.stateBaseDir
+	if _, err := manager.NormalizeHostMountAllowlist([]string{filepath.Dir(base)}); err == nil {
+		t.Fatalf("allowlist containing the state dir accepted")
+	}
+	for _, dir := range []string{"/etc", "/", "relative/path", filepath.Join(base, AppsDir)} {
+		if _, err := manager.NormalizeHostMountAllowlist([]string{dir}); err == nil {
+			t.Fatalf("allowlist entry %q accepted", dir)
+		}
+	}
+	got, err := manager.NormalizeHostMountAllowlist([]string{"/srv/media/", "/mnt/photos", "/srv/media"})
+	if err != nil || len(got) != 2 || got[0] != "/mnt/photos" || got[1] != "/srv/media" {
+		t.Fatalf("unexpected normalized allowlist %v (%v)", got, err)
+	}
+
+	// Even an allowlist set directly cannot expose the state dir.
+	manager.SetHostMountAllowlist([]string{filepath.Dir(base)})
+	def := mediaApp("peek", api.AppHostMount{Host: base, Container: "/state"})
+	if _, err := manager.Install(context.Background(), def); !errors.Is(err, ErrHostMountNotAllowed) {
+		t.Fatalf("expected state dir mount refused, got %v", err)
+	}
+}
+
+func TestAppManager_HostMountSpec(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	media := t.TempDir()
+	manager.SetHostMountAllowlist([]string{media})
+	no, yes := false, true
+	def := mediaApp("photos",
+		api.AppHostMount{Host: filepath.Join(media, "library"), Container: "/library"},
+		api.AppHostMount{Host: filepath.Join(media, "unapproved"), Container: "/unapproved", ReadOnly: &no},
+		api.AppHostMount{Host: filepath.Join(media, "uploads"), Container: "/uploads", ReadOnly: &no, AllowWrite: true, SELinux: "z"},
+		api.AppHostMount{Host: filepath.Join(media, "cache"), Container: "/cache", ReadOnly: &yes, AllowWrite: true, SELinux: "Z"},
+	)
+	inst, err := manager.Install(context.Background(), def)
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	got := mock.containers[inst.ContainerID].Spec.Volumes
+	want := map[string]string{"/library": "ro", "/unapproved": "ro", "/uploads": "rw,z", "/cache": "ro,Z"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected volumes %+v", got)
+	}
+	for _, v := range got {
+		if want[v.Container] != v.Options {
+			t.Fatalf("volume %s: options %q, want %q", v.Container, v.Options, want[v.Container])
+		}
+	}
+
+	bad := mediaApp("bad", api.AppHostMount{Host: media, Container: "/media", SELinux: "shared"})
+	if _, err := manager.Install(context.Background(), bad); err == nil {
+		t.Fatalf("invalid selinux option accepted")
+	}
+	dup := mediaApp("dup", api.AppHostMount{Host: media, Container: "/media"}, api.AppHostMount{Host: media, Container: "/media/"})
+	if _, err := manager.Install(context.Background(), dup); err == nil {
+		t.Fatalf("duplicate container path accepted")
+	}
+}
+
+func TestAppManager_PurgeKeepsHostMounts(t *testing.T) {
+	manager, _ := newMockAppManager(t)
+	media := t.TempDir()
+	manager.SetHostMountAllowlist([]string{media})
+	if err := os.WriteFile(filepath.Join(media, "film.mkv"), []byte("frames"), 0o644); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	def := mediaApp("jellyfin", api.AppHostMount{Host: media, Container: "/media"})
+	// A storage volume pointed at the same directory must not purge it.
+	def.Storage.Persistent = map[string]api.AppVolume{"config": {Container: "/config", Host: media}}
+	ctx := context.Background()
+	if _, err := manager.Install(ctx, def); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	report, err := manager.UninstallWithOptions(ctx, "jellyfin", UninstallOptions{Purge: true})
+	if err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(media, "film.mkv")); err != nil {
+		t.Fatalf("host mount content removed: %v", err)
+	}
+	if len(report.Paths) != 0 {
+		t.Fatalf("purge reported host mount paths: %+v", report)
+	}
+}
@@ -0,0 +1,273 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/services"
+)
+
+// Install step names, in the order they run.
+const (
+	InstallStepAllocatePorts    = "allocate ports"
+	InstallStepPullImage        = "pull image"
+	InstallStepCreateContainer  = "create container"
+	InstallStepPersistState     = "persist state"
+	InstallStepRegisterServices = "register services"
+)
+
+// Install step outcomes.
+const (
+	InstallStepOK             = "ok"
+	InstallStepFailed         = "failed"
+	InstallStepSkipped        = "skipped"
+	InstallStepRolledBack     = "rolled_back"
+	InstallStepRollbackFailed = "rollback_failed"
+)
+
+// InstallStep records what one install step did.
+type InstallStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Attempts is above one when the step's retry policy ran it again, and
+	// zero for skipped steps.
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// InstallError is returned by Install when a step fails. By the time it is
+// returned, the steps that had completed are rolled back.
+type InstallError struct {
+	App string
+	// Step is the step that failed.
+	Step  string
+	Steps []InstallStep
+	Err   error
+}
+
+func (e *InstallError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Step, e.Err)
+	var leftovers []string
+	for _, st := range e.Steps {
+		if st.Status == InstallStepRollbackFailed {
+			leftovers = append(leftovers, fmt.Sprintf("%s: %s", st.Name, st.Error))
+		}
+	}
+	if len(leftovers) > 0 {
+		msg += " (rollback incomplete: " + strings.Join(leftovers, "; ") + ")"
+	}
+	return msg
+}
+
+func (e *InstallError) Unwrap() error { return e.Err }
+
+// installStep is one stage of the install pipeline. undo reverses a
+// completed run when a later step fails; retry, when set, may repair the
+// cause of a failed run and report that it is worth running again.
+type installStep struct {
+	name        string
+	run         func(ctx context.Context) error
+	undo        func(ctx context.Context) error
+	retry       func(ctx context.Context, err error) bool
+	maxAttempts int
+}
+
+// runInstallSteps runs steps in order. When one fails, the completed steps
+// are undone in reverse order and the log of every step is returned in an
+// InstallError. Undo runs even when ctx is canceled, since a canceled install
+// must not leave anything behind either.
+func runInstallSteps(ctx context.Context, app string, steps []installStep) ([]InstallStep, error) {
+	records := make([]InstallStep, len(steps))
+	for i, st := range steps {
+		records[i] = InstallStep{Name: st.name, Status: InstallStepSkipped}
+	}
+	for i, st := range steps {
+		rec := &records[i]
+		var err error
+		for {
+			rec.Attempts++
+			if err = st.run(ctx); err == nil {
+				break
+			}
+			if st.retry == nil || rec.Attempts >= st.maxAttempts || ctx.Err() != nil || !st.retry(ctx, err) {
+				break
+			}
+		}
+		if err == nil {
+			rec.Status = InstallStepOK
+			continue
+		}
+		rec.Status, rec.Error = InstallStepFailed, err.Error()
+		undoCtx := context.WithoutCancel(ctx)
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].undo == nil {
+				continue
+			}
+			if uerr := steps[j].undo(undoCtx); uerr != nil {
+				records[j].Status, records[j].Error = InstallStepRollbackFailed, uerr.Error()
+				continue
+			}
+			records[j].Status = InstallStepRolledBack
+		}
+		return records, &InstallError{App: app, Step: st.name, Steps: records, Err: err}
+	}
+	return records, nil
+}
+
+// installSteps builds the install pipeline for appDef. The steps share the
+// allocated endpoints and the created container, so each undo reverses
+// exactly what its run did.
+func (m *AppManager) installSteps(state *FilesystemStateManager, appDef *api.AppDefinition, inst *AppInstance) []installStep {
+	var endpoints []services.ServiceEndpoint
+	allocate := func() error {
+		reserve := m.serviceManager.ReserveForApp
+		if onHostNetwork(appDef) {
+			reserve = m.serviceManager.ReserveOnGuestPorts
+		}
+		eps, err := reserve(appDef.Name, appDef.Listeners)
+		if err != nil {
+			return err
+		}
+		endpoints = eps
+		return nil
+	}
+	release := func(context.Context) error {
+		m.serviceManager.RemoveApp(appDef.Name)
+		endpoints = nil
+		return nil
+	}
+	return []installStep{
+		{
+			name: InstallStepAllocatePorts,
+			run:  func(context.Context) error { return allocate() },
+			undo: release,
+		},
+		{
+			name: InstallStepPullImage,
+			run:  func(ctx context.Context) error { return m.ensureImage(ctx, appDef.Image) },
+		},
+		{
+			name: InstallStepCreateContainer,
+			run: func(ctx context.Context) error {
+				spec, err := m.appDefToContainerSpec(appDef, endpoints)
+				if err != nil {
+					return fmt.Errorf("container spec: %w", err)
+				}
+				id, err := m.createContainer(ctx, spec)
+				if err != nil {
+					return err
+				}
+				inst.ContainerID = id
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				if err := m.containerManager.RemoveContainer(ctx, inst.ContainerID); err != nil {
+					return err
+				}
+				inst.ContainerID = ""
+				return nil
+			},
+			// Podman may find a host port taken that the allocator thought
+			// free; keep it off limits and move the app to fresh ports.
+			retry: func(ctx context.Context, err error) bool {
+				var portErr *container.PortInUseError
+				if !errors.As(err, &portErr) {
+					return false
+				}
+				log.Printf("WARN: retrying install for %s due to host port conflict port=%d", appDef.Name, portErr.Port)
+				taken := []int{portErr.Port}
+				if portErr.Port <= 0 {
+					taken = taken[:0]
+					for _, ep := range endpoints {
+						taken = append(taken, ep.HostBind)
+					}
+				}
+				_ = release(ctx)
+				for _, port := range taken {
+					_ = m.serviceManager.ReserveHostPort(port)
+				}
+				if err := allocate(); err != nil {
+					log.Printf("WARN: install %s: reallocating ports: %v", appDef.Name, err)
+					return false
+				}
+				return true
+			},
+			maxAttempts: maxInstallPortRetries,
+		},
+		{
+			name: InstallStepPersistState,
+			run: func(context.Context) error {
+				return m.commitState(func() error { return state.StoreApp(inst, appDef) })
+			},
+			undo: func(context.Context) error {
+				return m.commitState(func() error { return state.RemoveApp(appDef.Name) })
+			},
+		},
+		{
+			name: InstallStepRegisterServices,
+			run: func(context.Context) error {
+				// The watcher reconciles services by container ID.
+				m.serviceManager.SetAppContainerID(appDef.Name, inst.ContainerID)
+				publish := m.publishApp
+				if publish == nil {
+					publish = m.serviceManager.PublishApp
+				}
+				return publish(appDef.Name)
+			},
+		},
+	}
+}
+
+// install runs the install pipeline for a validated definition.
+func (m *AppManager) install(ctx context.Context, state *FilesystemStateManager, appDef *api.AppDefinition) (*AppInstance, error) {
+	now := time.Now()
+	inst := &AppInstance{
+		Name:        appDef.Name,
+		Image:       appDef.Image,
+		Type:        appDef.Type,
+		Status:      "created",
+		Environment: appDef.Environment,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := runInstallSteps(ctx, appDef.Name, m.installSteps(state, appDef, inst)); err != nil {
+		var installErr *InstallError
+		if errors.As(err, &installErr) && installErr.Step == InstallStepCreateContainer {
+			m.storeFailedInstall(state, appDef, installErr)
+		}
+		m.recordActivity(context.WithoutCancel(ctx), activity.LevelWarn, fmt.Sprintf("App %s failed to install: %v", appDef.Name, err),
+			map[string]any{"app": appDef.Name, "image": appDef.Image})
+		return nil, err
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s installed", appDef.Name), map[string]any{"app": appDef.Name, "image": appDef.Image})
+	return inst, nil
+}
+
+// storeFailedInstall keeps a container-less record of an install whose
+// container could not be created, once the rollback is done, so the app
+// shows up as "created" with the failed step and the runtime's reason
+// instead of vanishing. Installing again replaces the record.
+func (m *AppManager) storeFailedInstall(state *FilesystemStateManager, appDef *api.AppDefinition, cause *InstallError) {
+	now := time.Now()
+	app := &AppInstance{
+		Name:        appDef.Name,
+		Image:       appDef.Image,
+		Type:        appDef.Type,
+		Status:      "created",
+		Environment: appDef.Environment,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		LastError:   cause.Error(),
+		LastErrorAt: &now,
+	}
+	if err := m.commitState(func() error { return state.StoreApp(app, appDef) }); err != nil {
+		log.Printf("WARN: install %s: recording create failure: %v", appDef.Name, err)
+	}
+}
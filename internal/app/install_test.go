@@ -0,0 +1,335 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/services"
+)
+
+// faultyRuntime is a mock runtime whose pulls and creates can be made to fail.
+type faultyRuntime struct {
+	*MockContainerManager
+	pullErr error
+	// createFn runs before each create; an error fails that create.
+	createFn func(spec container.ContainerCreateSpec) error
+	creates  int
+}
+
+func (r *faultyRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	return r.pullErr == nil, nil
+}
+
+func (r *faultyRuntime) PullImageProgress(ctx context.Context, image string, report func(container.PullProgress)) error {
+	return r.pullErr
+}
+
+func (r *faultyRuntime) CreateContainer(ctx context.Context, spec container.ContainerCreateSpec) (string, error) {
+	r.creates++
+	if r.createFn != nil {
+		if err := r.createFn(spec); err != nil {
+			return "", err
+		}
+	}
+	return r.MockContainerManager.CreateContainer(ctx, spec)
+}
+
+func newInstallTestManager(t *testing.T) (*AppManager, *faultyRuntime, *services.ServiceManager, string) {
+	t.Helper()
+	dir := newTestStateDir(t)
+	rt := &faultyRuntime{MockContainerManager: NewMockContainerManager()}
+	svc := services.NewServiceManager()
+	t.Cleanup(svc.StopAll)
+	manager, err := NewAppManagerWithServices(rt, dir, svc, nil)
+	if err != nil {
+		t.Fatalf("NewAppManager: %v", err)
+	}
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	return manager, rt, svc, dir
+}
+
+func installTestDef(name string) *api.AppDefinition {
+	return &api.AppDefinition{
+		Name:      name,
+		Image:     "example/" + name + ":1",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: name + "-web", GuestPort: 80}, {Name: name + "-admin", GuestPort: 8080}},
+	}
+}
+
+// appEndpoints returns the endpoints registered for app.
+func appEndpoints(svc *services.ServiceManager, app string) []services.ServiceEndpoint {
+	var out []services.ServiceEndpoint
+	for _, ep := range svc.GetAll() {
+		if ep.App == app {
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
+// assertNothingLeft checks a failed install of app left no container, no
+// endpoints, no reserved ports and no app directory; with kept, the only
+// thing left is the container-less record explaining the failure. Public
+// ports of seen are checked for listeners only when published, since other
+// tests' proxies may hold ports the app never bound.
+func assertNothingLeft(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, dir, app string, seen []services.ServiceEndpoint, published, kept bool) {
+	t.Helper()
+	for id, c := range rt.containers {
+		if c.Spec.Image == "example/"+app+":1" {
+			t.Fatalf("container %s leaked", id)
+		}
+	}
+	if eps := appEndpoints(svc, app); len(eps) != 0 {
+		t.Fatalf("endpoints leaked: %+v", eps)
+	}
+	for _, ep := range seen {
+		if err := svc.ReserveHostPort(ep.HostBind); err != nil {
+			t.Fatalf("host port %d still reserved: %v", ep.HostBind, err)
+		}
+		if !published {
+			continue
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort("0.0.0.0", strconv.Itoa(ep.PublicPort)))
+		if err != nil {
+			t.Fatalf("public port %d still bound: %v", ep.PublicPort, err)
+		}
+		ln.Close()
+	}
+	if kept {
+		inst, err := m.Get(context.Background(), app)
+		if err != nil || inst.ContainerID != "" || inst.LastError == "" {
+			t.Fatalf("expected a container-less record with the error, got %+v (%v)", inst, err)
+		}
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, AppsDir, app)); !os.IsNotExist(err) {
+		t.Fatalf("app directory left behind: %v", err)
+	}
+	if _, err := m.Get(context.Background(), app); err == nil {
+		t.Fatalf("failed install still listed")
+	}
+}
+
+func TestInstallRollsBackEachStep(t *testing.T) {
+	cases := []struct {
+		step   string
+		inject func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint)
+		// rolledBack lists the steps undone after the failure.
+		rolledBack []string
+		published  bool
+		// kept is set for failures that leave a record explaining them.
+		kept bool
+	}{
+		{
+			step: InstallStepAllocatePorts,
+			inject: func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint) {
+				svc.SetRemoteLabelsEnforced(true)
+				other := &api.AppDefinition{Name: "other", Image: "example/other:1", Type: "user",
+					Listeners: []api.AppListener{{Name: "site", GuestPort: 80, RemoteSubdomain: "victim-web"}}}
+				if _, err := m.Install(context.Background(), other); err != nil {
+					t.Fatalf("install other: %v", err)
+				}
+			},
+		},
+		{
+			step: InstallStepPullImage,
+			inject: func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint) {
+				rt.pullErr = errors.New("manifest unknown")
+			},
+			rolledBack: []string{InstallStepAllocatePorts},
+		},
+		{
+			step: InstallStepCreateContainer,
+			inject: func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint) {
+				rt.createFn = func(container.ContainerCreateSpec) error {
+					*seen = appEndpoints(svc, "victim")
+					return errors.New("image platform (linux/arm64) does not match the expected platform (linux/amd64)")
+				}
+			},
+			rolledBack: []string{InstallStepAllocatePorts},
+			kept:       true,
+		},
+		{
+			step: InstallStepPersistState,
+			inject: func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint) {
+				rt.createFn = func(container.ContainerCreateSpec) error {
+					*seen = appEndpoints(svc, "victim")
+					return nil
+				}
+				writeStateFile = func(path string, data []byte) error {
+					if filepath.Base(path) == appMetadataFile {
+						return errors.New("disk full")
+					}
+					return writeFileAtomic(path, data)
+				}
+				t.Cleanup(func() { writeStateFile = writeFileAtomic })
+			},
+			rolledBack: []string{InstallStepAllocatePorts, InstallStepCreateContainer},
+		},
+		{
+			step: InstallStepRegisterServices,
+			inject: func(t *testing.T, m *AppManager, rt *faultyRuntime, svc *services.ServiceManager, seen *[]services.ServiceEndpoint) {
+				// Fail after the proxies are up, so rollback has to stop them.
+				m.publishApp = func(app string) error {
+					if err := svc.PublishApp(app); err != nil {
+						return err
+					}
+					*seen = appEndpoints(svc, app)
+					return errors.New("listener victim-web: bind: address already in use")
+				}
+			},
+			rolledBack: []string{InstallStepAllocatePorts, InstallStepCreateContainer, InstallStepPersistState},
+			published:  true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.step, func(t *testing.T) {
+			m, rt, svc, dir := newInstallTestManager(t)
+			var seen []services.ServiceEndpoint
+			tc.inject(t, m, rt, svc, &seen)
+
+			_, err := m.Install(context.Background(), installTestDef("victim"))
+			var installErr *InstallError
+			if !errors.As(err, &installErr) {
+				t.Fatalf("expected InstallError, got %v", err)
+			}
+			if installErr.Step != tc.step {
+				t.Fatalf("failed at %q, want %q: %v", installErr.Step, tc.step, err)
+			}
+			failed := false
+			for _, st := range installErr.Steps {
+				want := InstallStepOK
+				switch {
+				case st.Name == tc.step:
+					want, failed = InstallStepFailed, true
+				case failed:
+					want = InstallStepSkipped
+				}
+				for _, name := range tc.rolledBack {
+					if st.Name == name {
+						want = InstallStepRolledBack
+					}
+				}
+				if st.Status != want {
+					t.Fatalf("step %s: status %q, want %q (%+v)", st.Name, st.Status, want, installErr.Steps)
+				}
+			}
+			assertNothingLeft(t, m, rt, svc, dir, "victim", seen, tc.published, tc.kept)
+		})
+	}
+}
+
+func TestInstallSkipsHostPortsBoundOutsidePiccolo(t *testing.T) {
+	m, rt, svc, _ := newInstallTestManager(t)
+	svc.SetPortProbe(true)
+	// Hold the first host-bind ports of a fresh range, as an ssh tunnel
+	// squatting on them would.
+	var held []net.Listener
+	t.Cleanup(func() {
+		for _, ln := range held {
+			ln.Close()
+		}
+	})
+	base := 0
+	for attempt := 0; attempt < 20 && len(held) < 3; attempt++ {
+		for _, ln := range held {
+			ln.Close()
+		}
+		held = held[:0]
+		probe, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		base = probe.Addr().(*net.TCPAddr).Port
+		probe.Close()
+		if base+1200 > 65535 {
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(base+i)))
+			if err != nil {
+				break
+			}
+			held = append(held, ln)
+		}
+	}
+	if len(held) < 3 {
+		t.Skip("no run of free ports")
+	}
+	if err := svc.SetPortPolicy(services.PortPolicy{
+		HostBind: services.PortRange{Start: base, End: base + 99},
+		Public:   services.PortRange{Start: base + 1000, End: base + 1099},
+	}); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	rt.createFn = func(spec container.ContainerCreateSpec) error {
+		for _, p := range spec.Ports {
+			if p.Host < base+len(held) {
+				return &container.PortInUseError{Port: p.Host, Err: errors.New("bind: address already in use")}
+			}
+		}
+		return nil
+	}
+
+	if _, err := m.Install(context.Background(), installTestDef("blog")); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if rt.creates != 1 {
+		t.Fatalf("creates = %d, want 1: bound ports should be skipped before podman sees them", rt.creates)
+	}
+	if got := len(svc.OccupiedPorts()); got < len(held) {
+		t.Fatalf("occupied ports = %+v", svc.OccupiedPorts())
+	}
+}
+
+func TestInstallRetriesHostPortConflict(t *testing.T) {
+	m, rt, svc, _ := newInstallTestManager(t)
+	var taken int
+	rt.createFn = func(spec container.ContainerCreateSpec) error {
+		if taken == 0 {
+			taken = spec.Ports[0].Host
+			return &container.PortInUseError{Port: taken, Err: errors.New("bind: address already in use")}
+		}
+		for _, p := range spec.Ports {
+			if p.Host == taken {
+				t.Fatalf("retry reused conflicting host port %d", taken)
+			}
+		}
+		return nil
+	}
+	inst, err := m.Install(context.Background(), installTestDef("blog"))
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if rt.creates != 2 || inst.ContainerID == "" {
+		t.Fatalf("creates=%d instance=%+v", rt.creates, inst)
+	}
+	if eps := appEndpoints(svc, "blog"); len(eps) != 2 {
+		t.Fatalf("endpoints after retry: %+v", eps)
+	}
+
+	// A conflict that persists gives up after the retry budget.
+	rt.createFn = func(spec container.ContainerCreateSpec) error {
+		return &container.PortInUseError{Err: errors.New("bind: address already in use")}
+	}
+	_, err = m.Install(context.Background(), installTestDef("wiki"))
+	var installErr *InstallError
+	if !errors.As(err, &installErr) || installErr.Step != InstallStepCreateContainer {
+		t.Fatalf("expected create failure, got %v", err)
+	}
+	if got := installErr.Steps[2].Attempts; got != maxInstallPortRetries {
+		t.Fatalf("attempts = %d, want %d", got, maxInstallPortRetries)
+	}
+	if eps := appEndpoints(svc, "wiki"); len(eps) != 0 {
+		t.Fatalf("endpoints leaked: %+v", eps)
+	}
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// legacyMigrationFile records, in the state base, which older state
+// directories have already been migrated into it.
+const legacyMigrationFile = "legacy-migrated.json"
+
+type legacyMigrationRecord struct {
+	Sources []legacyMigrationSource `json:"sources"`
+}
+
+type legacyMigrationSource struct {
+	Dir        string    `json:"dir"`
+	MigratedAt time.Time `json:"migrated_at"`
+	Apps       []string  `json:"apps,omitempty"`
+}
+
+func (r legacyMigrationRecord) done(dir string) bool {
+	for _, s := range r.Sources {
+		if s.Dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateLegacyState copies the apps of each source state directory that
+// base has no app of the same name for into base, keeping whether they were
+// enabled. Sources are left untouched and each is migrated once. It returns
+// the names of the apps it copied.
+func migrateLegacyState(base string, sources []string) ([]string, error) {
+	recordPath := filepath.Join(base, legacyMigrationFile)
+	var record legacyMigrationRecord
+	if data, err := os.ReadFile(recordPath); err == nil {
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("read %s: %w", legacyMigrationFile, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var migrated []string
+	changed := false
+	for _, src := range sources {
+		if src == "" {
+			continue
+		}
+		src = filepath.Clean(src)
+		if src == filepath.Clean(base) || record.done(src) {
+			continue
+		}
+		apps, err := migrateStateDir(src, base)
+		if err != nil {
+			return migrated, fmt.Errorf("migrate app state from %s: %w", src, err)
+		}
+		record.Sources = append(record.Sources, legacyMigrationSource{Dir: src, MigratedAt: time.Now().UTC(), Apps: apps})
+		migrated = append(migrated, apps...)
+		changed = true
+	}
+	if !changed {
+		return migrated, nil
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return migrated, err
+	}
+	return migrated, writeStateFile(recordPath, data)
+}
+
+// migrateStateDir copies every app under src/apps that dst lacks. An app is
+// staged next to its destination and renamed into place, so a crash never
+// leaves a partial copy that looks installed.
+func migrateStateDir(src, dst string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(src, AppsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dstApps := filepath.Join(dst, AppsDir)
+	dstEnabled := filepath.Join(dst, EnabledDir)
+	for _, dir := range []string{dstApps, dstEnabled} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	var apps []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || name[0] == '.' {
+			continue
+		}
+		from := filepath.Join(src, AppsDir, name)
+		if _, err := os.Stat(filepath.Join(from, appDefinitionFile)); err != nil {
+			continue
+		}
+		to := filepath.Join(dstApps, name)
+		if _, err := os.Lstat(to); err == nil {
+			continue
+		}
+		_, err := os.Lstat(filepath.Join(src, EnabledDir, name))
+		enabled := err == nil
+		if err := copyAppDir(from, to, enabled); err != nil {
+			return apps, fmt.Errorf("app %s: %w", name, err)
+		}
+		if enabled {
+			link := filepath.Join(dstEnabled, name)
+			if err := os.Symlink(filepath.Join("..", AppsDir, name), link); err != nil && !os.IsExist(err) {
+				return apps, fmt.Errorf("app %s: %w", name, err)
+			}
+		}
+		apps = append(apps, name)
+	}
+	sort.Strings(apps)
+	return apps, syncDir(dstApps)
+}
+
+// copyAppDir copies the app directory from to to, marking the copy enabled
+// when the source was.
+func copyAppDir(from, to string, enabled bool) error {
+	staging, err := os.MkdirTemp(filepath.Dir(to), stagingPrefix+filepath.Base(to)+"-")
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(staging, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type().IsRegular():
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return writeFileAtomic(target, data)
+		}
+		return nil
+	})
+	if err == nil && enabled {
+		err = markMetadataEnabled(filepath.Join(staging, appMetadataFile))
+	}
+	if err == nil {
+		err = os.Chmod(staging, 0755)
+	}
+	if err == nil {
+		err = os.Rename(staging, to)
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+	}
+	return err
+}
+
+// markMetadataEnabled sets the enabled flag of a copied metadata.json. A
+// missing or unreadable file is left for the startup scan to repair; the
+// enabled/ link written alongside still marks the app.
+func markMetadataEnabled(path string) error {
+	metadata, err := readAppMetadata(path)
+	if err != nil || metadata.Enabled {
+		return nil
+	}
+	metadata.Enabled = true
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
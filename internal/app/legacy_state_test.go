@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newLegacyStateDir lays out state as older releases did: an app marked
+// enabled only by its enabled/ symlink, and one that is not enabled.
+func newLegacyStateDir(t *testing.T) string {
+	t.Helper()
+	dir := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(dir)
+	if err != nil {
+		t.Fatalf("legacy state: %v", err)
+	}
+	storeTestApp(t, fsm, "blog")
+	storeTestApp(t, fsm, "notes")
+	if err := os.Symlink(filepath.Join("..", AppsDir, "blog"), filepath.Join(dir, EnabledDir, "blog")); err != nil {
+		t.Fatalf("legacy enabled link: %v", err)
+	}
+	return dir
+}
+
+func newMigratingManager(t *testing.T, base, legacy string) *AppManager {
+	t.Helper()
+	manager, err := NewAppManager(NewMockContainerManager(), base)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	manager.legacyStateDir = legacy
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	return manager
+}
+
+func isEnabled(t *testing.T, m *AppManager, name string) bool {
+	t.Helper()
+	enabled, err := m.IsEnabled(context.Background(), name)
+	if err != nil {
+		t.Fatalf("is enabled %s: %v", name, err)
+	}
+	return enabled
+}
+
+func TestAppManager_MigratesLegacyState(t *testing.T) {
+	legacy := newLegacyStateDir(t)
+	base := newTestStateDir(t)
+	ctx := context.Background()
+
+	manager := newMigratingManager(t, base, legacy)
+	apps, err := manager.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("expected both legacy apps, got %+v", apps)
+	}
+	if !isEnabled(t, manager, "blog") || isEnabled(t, manager, "notes") {
+		t.Fatalf("enabled state not carried over")
+	}
+	if _, err := os.Lstat(filepath.Join(base, EnabledDir, "blog")); err != nil {
+		t.Fatalf("enabled link not recreated: %v", err)
+	}
+	metadata, err := readAppMetadata(filepath.Join(base, AppsDir, "blog", appMetadataFile))
+	if err != nil || !metadata.Enabled {
+		t.Fatalf("enabled flag not recorded in metadata: %+v (%v)", metadata, err)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, AppsDir, "blog", appDefinitionFile)); err != nil {
+		t.Fatalf("legacy state should be left in place: %v", err)
+	}
+
+	// A second run finds the tombstone and leaves a removed app removed.
+	if err := os.RemoveAll(filepath.Join(base, AppsDir, "notes")); err != nil {
+		t.Fatalf("remove notes: %v", err)
+	}
+	again := newMigratingManager(t, base, legacy)
+	apps, err = again.List(ctx)
+	if err != nil {
+		t.Fatalf("list after restart: %v", err)
+	}
+	if len(apps) != 1 || apps[0].Name != "blog" || !isEnabled(t, again, "blog") {
+		t.Fatalf("migration ran twice: %+v", apps)
+	}
+}
+
+func TestAppManager_MigrationKeepsExistingApps(t *testing.T) {
+	legacy := newLegacyStateDir(t)
+	base := newTestStateDir(t)
+	fsm, err := NewFilesystemStateManager(base)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	storeTestApp(t, fsm, "blog")
+
+	manager := newMigratingManager(t, base, legacy)
+	ctx := context.Background()
+	if apps, err := manager.List(ctx); err != nil || len(apps) != 2 {
+		t.Fatalf("expected blog and notes, got %+v (%v)", apps, err)
+	}
+	if isEnabled(t, manager, "blog") {
+		t.Fatalf("legacy enabled link overrode the app already in the base")
+	}
+}
+
+func TestAppManager_StateSurvivesBaseDirChange(t *testing.T) {
+	first := newTestStateDir(t)
+	manager := newMigratingManager(t, first, "")
+	fsm, err := manager.ensureStateManager()
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	storeTestApp(t, fsm, "blog")
+	ctx := context.Background()
+	if err := manager.Enable(ctx, "blog"); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+
+	second := newTestStateDir(t)
+	manager.SetStateBaseDir(second)
+	if !isEnabled(t, manager, "blog") {
+		t.Fatalf("enabled app lost across base dir change")
+	}
+	enabled, err := manager.ListEnabled(ctx)
+	if err != nil || len(enabled) != 1 || enabled[0] != "blog" {
+		t.Fatalf("unexpected enabled list %v (%v)", enabled, err)
+	}
+}
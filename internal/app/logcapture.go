@@ -0,0 +1,572 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/api"
+	"piccolod/internal/persistence"
+)
+
+const (
+	// defaultLogArchiveCap is how much captured output an app keeps unless
+	// its definition sets logs.max_size.
+	defaultLogArchiveCap = 20 << 20
+	minLogArchiveCap     = 256 << 10
+	maxLogArchiveCap     = 1 << 30
+	// logArchiveFiles is how many files the cap is split across; the
+	// oldest file is deleted when a new one would exceed the cap.
+	logArchiveFiles = 4
+	// logDrainGrace is how long the collector of a stopped or replaced
+	// container keeps reading before it is cut off.
+	logDrainGrace = 5 * time.Second
+	// defaultLogLines is how many lines a read returns unless asked.
+	defaultLogLines = 200
+)
+
+// Log sources served by ReadLogs.
+const (
+	LogSourceLive    = "live"
+	LogSourceArchive = "archive"
+)
+
+// LogEntry is one line of container output.
+type LogEntry struct {
+	// Time is when the container wrote the line; live lines have none.
+	Time        time.Time `json:"ts,omitzero"`
+	Stream      string    `json:"stream,omitempty"`
+	Message     string    `json:"message"`
+	ContainerID string    `json:"container_id,omitempty"`
+}
+
+// LogQuery selects lines: those written at or after Since and before
+// Until, when set, of which the newest Limit are returned.
+type LogQuery struct {
+	Source string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// logArchiveCap returns the archive cap an app's logs settings ask for.
+func logArchiveCap(logs *api.AppLogs) (int64, error) {
+	if logs == nil || strings.TrimSpace(logs.MaxSize) == "" {
+		return defaultLogArchiveCap, nil
+	}
+	n, err := parseByteSize(logs.MaxSize)
+	if err != nil || n < minLogArchiveCap || n > maxLogArchiveCap {
+		return 0, fmt.Errorf("max_size '%s' must be a size between 256KB and 1GB", logs.MaxSize)
+	}
+	return n, nil
+}
+
+// parseByteSize reads sizes such as "512KB" or "20MB"; units are powers
+// of 1024.
+func parseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		mult   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	for _, u := range units {
+		num, ok := strings.CutSuffix(v, u.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid size '%s'", s)
+		}
+		return int64(n * float64(u.mult)), nil
+	}
+	return 0, fmt.Errorf("size '%s' must end with B, KB, MB, GB, or TB", s)
+}
+
+func logCaptureEnabled(def *api.AppDefinition) bool {
+	return def != nil && def.Logs != nil && def.Logs.Capture
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// logArchive is an app's captured output: numbered JSON lines files, the
+// highest being written to.
+type logArchive struct {
+	mu   sync.Mutex
+	dir  string
+	max  int64
+	file *os.File
+	seq  int
+	size int64
+}
+
+type logFile struct {
+	seq  int
+	path string
+	size int64
+}
+
+// listLogFiles returns the archive files in dir, oldest first.
+func listLogFiles(dir string) ([]logFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []logFile
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		seq, err := strconv.Atoi(base)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{seq: seq, path: filepath.Join(dir, e.Name()), size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].seq < files[j].seq })
+	return files, nil
+}
+
+func logFileName(seq int) string {
+	return fmt.Sprintf("%08d.jsonl", seq)
+}
+
+// openLogArchive opens the archive in dir, appending to its newest file.
+func openLogArchive(dir string, max int64) (*logArchive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	files, err := listLogFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	a := &logArchive{dir: dir, max: max}
+	if len(files) > 0 {
+		last := files[len(files)-1]
+		f, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		a.file, a.seq, a.size = f, last.seq, last.size
+	}
+	return a, nil
+}
+
+func (a *logArchive) setMax(max int64) {
+	a.mu.Lock()
+	a.max = max
+	a.mu.Unlock()
+}
+
+// write appends e, starting a new file when the current one is full.
+func (a *logArchive) write(e LogEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil || (a.size > 0 && a.size+int64(len(data)) > a.max/logArchiveFiles) {
+		if err := a.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	return err
+}
+
+// rotateLocked starts the next file and deletes the oldest ones until the
+// rest and a full new file fit under the cap.
+func (a *logArchive) rotateLocked() error {
+	if a.file != nil {
+		_ = a.file.Close()
+		a.file = nil
+	}
+	files, err := listLogFiles(a.dir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for len(files) > 0 && total+a.max/logArchiveFiles > a.max {
+		if err := os.Remove(files[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= files[0].size
+		files = files[1:]
+	}
+	a.seq++
+	f, err := os.OpenFile(filepath.Join(a.dir, logFileName(a.seq)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	a.file, a.size = f, 0
+	return nil
+}
+
+func (a *logArchive) close() {
+	a.mu.Lock()
+	if a.file != nil {
+		_ = a.file.Close()
+		a.file = nil
+	}
+	a.mu.Unlock()
+}
+
+// scanLogFile calls fn with each entry in path; lines that do not decode,
+// such as one cut short by a crash, are skipped.
+func scanLogFile(path string, fn func(LogEntry)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // rotated away while listed
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e LogEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return scanner.Err()
+}
+
+// readLogArchive returns the entries in dir that q selects, oldest first.
+func readLogArchive(dir string, q LogQuery) ([]LogEntry, error) {
+	files, err := listLogFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLogLines
+	}
+	out := []LogEntry{}
+	for _, f := range files {
+		err := scanLogFile(f.path, func(e LogEntry) {
+			if (!q.Since.IsZero() && e.Time.Before(q.Since)) || (!q.Until.IsZero() && !e.Time.Before(q.Until)) {
+				return
+			}
+			out = append(out, e)
+			if len(out) > 2*limit {
+				out = append(out[:0], out[len(out)-limit:]...)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out, nil
+}
+
+// lastLogTime returns when the newest line the archive in dir holds from
+// containerID was written, or zero.
+func lastLogTime(dir, containerID string) time.Time {
+	files, _ := listLogFiles(dir)
+	short := shortContainerID(containerID)
+	for i := len(files) - 1; i >= 0; i-- {
+		var last time.Time
+		_ = scanLogFile(files[i].path, func(e LogEntry) {
+			if e.ContainerID == short && e.Time.After(last) {
+				last = e.Time
+			}
+		})
+		if !last.IsZero() {
+			return last
+		}
+	}
+	return time.Time{}
+}
+
+// logCollector copies one container's output into its app's archive.
+type logCollector struct {
+	app         string
+	containerID string
+	cancel      context.CancelFunc
+	done        chan struct{}
+	retiring    bool
+}
+
+// syncLogCapture follows the app's container while it runs with capture
+// on, and retires collectors of containers it no longer runs; those keep
+// reading for logDrainGrace so the last lines of a replaced container are
+// kept. Nothing is captured while storage is locked.
+func (m *AppManager) syncLogCapture(name string) {
+	if m.currentLockState() {
+		return
+	}
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return
+	}
+	app, exists := state.GetApp(name)
+	var def *api.AppDefinition
+	if exists {
+		def, _ = state.GetAppDefinition(name)
+	}
+	want := exists && app.ContainerID != "" && (app.Status == "running" || app.Status == AppStatusPaused) && logCaptureEnabled(def)
+
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	for id, c := range m.logCollectors {
+		if c.app != name || (want && id == app.ContainerID) || c.retiring {
+			continue
+		}
+		c.retiring = true
+		if !logCaptureEnabled(def) {
+			c.cancel()
+			continue
+		}
+		go func(c *logCollector) {
+			timer := time.NewTimer(logDrainGrace)
+			defer timer.Stop()
+			select {
+			case <-c.done:
+			case <-timer.C:
+				c.cancel()
+			}
+		}(c)
+	}
+	if !want || m.logCollectors[app.ContainerID] != nil {
+		return
+	}
+	limit, err := logArchiveCap(def.Logs)
+	if err != nil {
+		limit = defaultLogArchiveCap
+	}
+	archive := m.logArchives[name]
+	if archive == nil {
+		dir, err := state.logDir(name)
+		if err == nil {
+			archive, err = openLogArchive(dir, limit)
+		}
+		if err != nil {
+			log.Printf("WARN: log capture for app %s: %v", name, err)
+			return
+		}
+		if m.logArchives == nil {
+			m.logArchives = make(map[string]*logArchive)
+		}
+		m.logArchives[name] = archive
+	} else {
+		archive.setMax(limit)
+	}
+	m.startLogCollectorLocked(name, app.ContainerID, archive)
+}
+
+// startLogCollectorLocked follows containerID from the last line the
+// archive holds from it. logMu must be held.
+func (m *AppManager) startLogCollectorLocked(name, containerID string, archive *logArchive) {
+	since := lastLogTime(archive.dir, containerID)
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, err := m.containerManager.FollowLogs(ctx, containerID, since)
+	if err != nil {
+		cancel()
+		log.Printf("WARN: log capture for app %s: %v", name, err)
+		m.recordActivity(context.Background(), activity.LevelWarn, fmt.Sprintf("Log capture for app %s could not start", name), map[string]any{"app": name, "error": err.Error()})
+		if len(m.logCollectorsFor(name)) == 0 {
+			archive.close()
+			delete(m.logArchives, name)
+		}
+		return
+	}
+	c := &logCollector{app: name, containerID: containerID, cancel: cancel, done: make(chan struct{})}
+	if m.logCollectors == nil {
+		m.logCollectors = make(map[string]*logCollector)
+	}
+	m.logCollectors[containerID] = c
+	short := shortContainerID(containerID)
+	m.logWG.Add(1)
+	go func() {
+		defer m.logWG.Done()
+		defer close(c.done)
+		defer m.logCollectorDone(c)
+		failed := false
+		for line := range lines {
+			// A restarted follower replays what is already kept.
+			if !line.Time.After(since) {
+				continue
+			}
+			err := archive.write(LogEntry{Time: line.Time, Stream: line.Stream, Message: line.Text, ContainerID: short})
+			if err != nil && !failed {
+				failed = true
+				log.Printf("WARN: log capture for app %s: %v", name, err)
+			}
+		}
+	}()
+}
+
+// logCollectorDone drops a finished collector, closing the app's archive
+// once no collector writes to it.
+func (m *AppManager) logCollectorDone(c *logCollector) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	c.cancel()
+	if m.logCollectors[c.containerID] == c {
+		delete(m.logCollectors, c.containerID)
+	}
+	if len(m.logCollectorsFor(c.app)) == 0 {
+		if archive := m.logArchives[c.app]; archive != nil {
+			archive.close()
+			delete(m.logArchives, c.app)
+		}
+	}
+}
+
+// logCollectorsFor lists the app's collectors. logMu must be held.
+func (m *AppManager) logCollectorsFor(name string) []*logCollector {
+	var out []*logCollector
+	for _, c := range m.logCollectors {
+		if c.app == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// stopLogCapture stops the collectors of the named apps, or of every app
+// when none are named, and waits for them to finish writing.
+func (m *AppManager) stopLogCapture(names ...string) {
+	m.logMu.Lock()
+	var stopped []*logCollector
+	for _, c := range m.logCollectors {
+		if len(names) == 0 || containsName(names, c.app) {
+			c.cancel()
+			stopped = append(stopped, c)
+		}
+	}
+	m.logMu.Unlock()
+	for _, c := range stopped {
+		<-c.done
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeLogCapture starts collectors for every running app that captures
+// its logs, after unlock or a restart.
+func (m *AppManager) resumeLogCapture() {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return
+	}
+	for _, app := range state.ListApps() {
+		m.syncLogCapture(app.Name)
+	}
+}
+
+// StopLogCapture stops every log collector, for shutdown.
+func (m *AppManager) StopLogCapture() {
+	m.stopLogCapture()
+	m.logWG.Wait()
+}
+
+// ReadLogs returns the app's log lines. LogSourceLive asks the runtime for
+// the container's recent output, which goes with the container;
+// LogSourceArchive reads the captured files, which only they can filter by
+// time. An empty source reads the archive of apps that capture their logs.
+func (m *AppManager) ReadLogs(ctx context.Context, name string, q LogQuery) ([]LogEntry, string, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, "", err
+	}
+	if _, exists := state.GetApp(name); !exists {
+		return nil, "", fmt.Errorf("app not found: %s", name)
+	}
+	source := q.Source
+	if source == "" {
+		source = LogSourceLive
+		if def, err := state.GetAppDefinition(name); err == nil && logCaptureEnabled(def) {
+			source = LogSourceArchive
+		}
+	}
+	switch source {
+	case LogSourceArchive:
+		dir, err := state.logDir(name)
+		if err != nil {
+			return nil, "", err
+		}
+		entries, err := readLogArchive(dir, q)
+		if err != nil {
+			return nil, "", fmt.Errorf("read log archive: %w", err)
+		}
+		return entries, source, nil
+	case LogSourceLive:
+		if !q.Since.IsZero() || !q.Until.IsZero() {
+			return nil, "", fmt.Errorf("invalid log query: a time range needs source=%s", LogSourceArchive)
+		}
+		lines, err := m.Logs(ctx, name, q.Limit)
+		if err != nil {
+			return nil, "", err
+		}
+		entries := make([]LogEntry, 0, len(lines))
+		for _, line := range lines {
+			entries = append(entries, LogEntry{Message: line})
+		}
+		return entries, source, nil
+	}
+	return nil, "", fmt.Errorf("invalid log source '%s': use %s or %s", source, LogSourceLive, LogSourceArchive)
+}
+
+// purgeLogArchive deletes the app's captured logs; collectors must be
+// stopped.
+func purgeLogArchive(state *FilesystemStateManager, name string, report *PurgeReport) {
+	dir, err := state.logDir(name)
+	if err != nil {
+		return
+	}
+	if _, err := os.Lstat(dir); err != nil {
+		if !os.IsNotExist(err) {
+			report.Failures = append(report.Failures, PurgeFailure{Target: dir, Reason: err.Error()})
+		}
+		return
+	}
+	size := persistence.DirSize(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		report.Failures = append(report.Failures, PurgeFailure{Target: dir, Reason: err.Error()})
+		return
+	}
+	report.Paths = append(report.Paths, dir)
+	report.BytesFreed += size
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/events"
+)
+
+func capturedApp(name, maxSize string) *api.AppDefinition {
+	return &api.AppDefinition{
+		Name:      name,
+		Image:     "docker.io/library/nginx:1.27",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+		Logs:      &api.AppLogs{Capture: true, MaxSize: maxSize},
+	}
+}
+
+// waitForArchive waits until the archive's newest line is want.
+func waitForArchive(t *testing.T, manager *AppManager, name, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, _, err := manager.ReadLogs(context.Background(), name, LogQuery{Source: LogSourceArchive, Limit: 1})
+		if err == nil && len(entries) == 1 && entries[0].Message == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("archive never reached %q: %+v (%v)", want, entries, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func archiveMessages(t *testing.T, manager *AppManager, name string, q LogQuery) []string {
+	t.Helper()
+	q.Source = LogSourceArchive
+	entries, _, err := manager.ReadLogs(context.Background(), name, q)
+	if err != nil {
+		t.Fatalf("read logs: %v", err)
+	}
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.Message)
+	}
+	return out
+}
+
+func TestLogCapture_RotatesAtSizeCapAndReadsAcrossFiles(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	t.Cleanup(manager.StopLogCapture)
+	inst := installRunning(t, manager, capturedApp("web", "256KB"))
+
+	base := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	padding := strings.Repeat("x", 200)
+	const total = 3000
+	lines := make([]container.LogLine, 0, total)
+	for i := 0; i < total; i++ {
+		lines = append(lines, container.LogLine{Time: base.Add(time.Duration(i) * time.Millisecond), Text: fmt.Sprintf("line %04d %s", i, padding)})
+	}
+	mock.emitLog(inst.ContainerID, lines...)
+	last := lines[total-1].Text
+	waitForArchive(t, manager, "web", last)
+
+	dir, err := manager.stateManager.logDir("web")
+	if err != nil {
+		t.Fatalf("log dir: %v", err)
+	}
+	files, err := listLogFiles(dir)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	if len(files) < 2 || len(files) > logArchiveFiles || size > 256<<10 {
+		t.Fatalf("expected at most %d files under 256KB, got %d files, %d bytes", logArchiveFiles, len(files), size)
+	}
+	if files[0].seq == 1 {
+		t.Fatalf("expected the oldest files rotated away, still have %s", files[0].path)
+	}
+
+	kept := archiveMessages(t, manager, "web", LogQuery{Limit: total})
+	if len(kept) == 0 || len(kept) == total || kept[len(kept)-1] != last {
+		t.Fatalf("expected the newest lines kept and the oldest dropped, got %d lines", len(kept))
+	}
+	// Lines just before and after the boundary between the first two
+	// files come back in order from one query.
+	var first int
+	if err := scanLogFile(files[0].path, func(LogEntry) { first++ }); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	boundary := total - len(kept) + first
+	since, until := base.Add(time.Duration(boundary-2)*time.Millisecond), base.Add(time.Duration(boundary+2)*time.Millisecond)
+	got := archiveMessages(t, manager, "web", LogQuery{Since: since, Until: until, Limit: 100})
+	if len(got) != 4 {
+		t.Fatalf("expected four lines around the file boundary, got %d", len(got))
+	}
+	for i, msg := range got {
+		if want := fmt.Sprintf("line %04d ", boundary-2+i); !strings.HasPrefix(msg, want) {
+			t.Fatalf("line %d: got %.12q, want %q", i, msg, want)
+		}
+	}
+	if _, _, err := manager.ReadLogs(context.Background(), "web", LogQuery{Source: LogSourceLive, Since: since}); err == nil || !strings.HasPrefix(err.Error(), "invalid log query") {
+		t.Fatalf("expected a time range refused for live logs, got %v", err)
+	}
+}
+
+func TestLogCapture_PausesWhileLockedAndResumesOnUnlock(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	t.Cleanup(manager.StopLogCapture)
+	bus := events.NewBus()
+	manager.ObserveRuntimeEvents(bus)
+	t.Cleanup(manager.StopRuntimeEvents)
+	inst := installRunning(t, manager, capturedApp("db", ""))
+
+	mock.emitLog(inst.ContainerID, container.LogLine{Text: "ready"})
+	waitForArchive(t, manager, "db", "ready")
+
+	manager.ForceLockState(true)
+	bus.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: true}})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		manager.logMu.Lock()
+		active := len(manager.logCollectors) + len(manager.logArchives)
+		manager.logMu.Unlock()
+		if active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("log capture still running while locked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mock.emitLog(inst.ContainerID, container.LogLine{Text: "written while locked"})
+	manager.syncLogCapture("db")
+	manager.logMu.Lock()
+	started := len(manager.logCollectors)
+	manager.logMu.Unlock()
+	if started != 0 {
+		t.Fatalf("collector started while locked")
+	}
+
+	manager.ForceLockState(false)
+	bus.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: false}})
+	waitForArchive(t, manager, "db", "written while locked")
+	mock.emitLog(inst.ContainerID, container.LogLine{Text: "after unlock"})
+	waitForArchive(t, manager, "db", "after unlock")
+	if got := archiveMessages(t, manager, "db", LogQuery{}); strings.Join(got, ",") != "ready,written while locked,after unlock" {
+		t.Fatalf("expected each line kept once across the lock, got %q", got)
+	}
+}
+
+func TestLogCapture_KeepsReplacedContainerAndPurgeRemovesArchive(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	t.Cleanup(manager.StopLogCapture)
+	ctx := context.Background()
+	inst := installRunning(t, manager, capturedApp("shop", ""))
+	manager.SetReplaceTimeouts(ReplaceTimeouts{Ready: time.Second, Drain: 100 * time.Millisecond})
+	manager.SetReadinessProbe(func(context.Context, ReadinessTarget) error { return nil })
+	mock.emitLog(inst.ContainerID, container.LogLine{Text: "panic: bad config", Stream: container.LogStreamStderr})
+	waitForArchive(t, manager, "shop", "panic: bad config")
+
+	result, err := manager.Recreate(ctx, "shop")
+	if err != nil || result.ContainerID == inst.ContainerID {
+		t.Fatalf("recreate: %+v (%v)", result, err)
+	}
+	mock.emitLog(result.ContainerID, container.LogLine{Text: "started"})
+	waitForArchive(t, manager, "shop", "started")
+	entries, source, err := manager.ReadLogs(ctx, "shop", LogQuery{})
+	if err != nil || source != LogSourceArchive || len(entries) != 2 {
+		t.Fatalf("expected both containers' lines from the archive, got %s %+v (%v)", source, entries, err)
+	}
+	if entries[0].ContainerID != shortContainerID(inst.ContainerID) || entries[0].Stream != container.LogStreamStderr || entries[1].ContainerID != shortContainerID(result.ContainerID) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	dir, _ := manager.stateManager.logDir("shop")
+	if _, err := manager.UninstallWithOptions(ctx, "shop", UninstallOptions{Purge: true}); err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive purged, stat: %v", err)
+	}
+}
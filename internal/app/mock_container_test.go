@@ -2,6 +2,9 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"piccolod/internal/container"
 )
@@ -13,6 +16,30 @@ type MockContainerManager struct {
 	startError  error
 	stopError   error
 	removeError error
+	// Delays simulate a slow runtime; they end early when ctx is done.
+	createDelay time.Duration
+	startDelay  time.Duration
+	stopDelay   time.Duration
+	// states overrides what Inspect reports for a container ID.
+	states map[string]container.ContainerState
+	// execFn, when set, handles Exec; otherwise commands succeed at once.
+	execFn func(ctx context.Context, containerID string, argv []string) (container.ExecResult, error)
+	// publishUpdate lets the mock change published ports in place, failing
+	// each update with publishError when set.
+	publishUpdate bool
+	publishError  error
+	// published overrides what PublishedPorts reports for a container ID.
+	published map[string]map[int]int
+	// pingError, when set, makes Ping report the runtime unreachable.
+	pingError error
+
+	// logMu guards the fake log followers, which run on collector
+	// goroutines: logs holds what each container has written and follows
+	// counts FollowLogs calls.
+	logMu   sync.Mutex
+	logs    map[string][]container.LogLine
+	logWake map[string]chan struct{}
+	follows int
 }
 
 type mockContainer struct {
@@ -25,7 +52,24 @@ func NewMockContainerManager() *MockContainerManager {
 	return &MockContainerManager{containers: make(map[string]*mockContainer), nextID: 1}
 }
 
+func mockDelay(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (m *MockContainerManager) CreateContainer(ctx context.Context, spec container.ContainerCreateSpec) (string, error) {
+	if err := mockDelay(ctx, m.createDelay); err != nil {
+		return "", err
+	}
 	if m.createError != nil {
 		return "", m.createError
 	}
@@ -39,6 +83,9 @@ func (m *MockContainerManager) CreateContainer(ctx context.Context, spec contain
 }
 
 func (m *MockContainerManager) StartContainer(ctx context.Context, containerID string) error {
+	if err := mockDelay(ctx, m.startDelay); err != nil {
+		return err
+	}
 	if m.startError != nil {
 		return m.startError
 	}
@@ -50,6 +97,9 @@ func (m *MockContainerManager) StartContainer(ctx context.Context, containerID s
 }
 
 func (m *MockContainerManager) StopContainer(ctx context.Context, containerID string) error {
+	if err := mockDelay(ctx, m.stopDelay); err != nil {
+		return err
+	}
 	if m.stopError != nil {
 		return m.stopError
 	}
@@ -60,6 +110,30 @@ func (m *MockContainerManager) StopContainer(ctx context.Context, containerID st
 	return container.ErrContainerNotFound(containerID)
 }
 
+func (m *MockContainerManager) PauseContainer(ctx context.Context, containerID string) error {
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ErrContainerNotFound(containerID)
+	}
+	if c.Status != "running" {
+		return fmt.Errorf("container %s is %s, not running", containerID, c.Status)
+	}
+	c.Status = "paused"
+	return nil
+}
+
+func (m *MockContainerManager) UnpauseContainer(ctx context.Context, containerID string) error {
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ErrContainerNotFound(containerID)
+	}
+	if c.Status != "paused" {
+		return fmt.Errorf("container %s is %s, not paused", containerID, c.Status)
+	}
+	c.Status = "running"
+	return nil
+}
+
 func (m *MockContainerManager) RemoveContainer(ctx context.Context, containerID string) error {
 	if m.removeError != nil {
 		return m.removeError
@@ -71,6 +145,15 @@ func (m *MockContainerManager) RemoveContainer(ctx context.Context, containerID
 	return container.ErrContainerNotFound(containerID)
 }
 
+func (m *MockContainerManager) RenameContainer(ctx context.Context, containerID, name string) error {
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ErrContainerNotFound(containerID)
+	}
+	c.Spec.Name = name
+	return nil
+}
+
 func (m *MockContainerManager) PullImage(ctx context.Context, image string) error { return nil }
 
 func (m *MockContainerManager) Logs(ctx context.Context, containerID string, lines int) ([]string, error) {
@@ -87,6 +170,150 @@ func (m *MockContainerManager) Logs(ctx context.Context, containerID string, lin
 	return out, nil
 }
 
+// emitLog has the container write lines, stamped now unless set.
+func (m *MockContainerManager) emitLog(containerID string, lines ...container.LogLine) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if m.logs == nil {
+		m.logs = make(map[string][]container.LogLine)
+	}
+	for _, l := range lines {
+		if l.Time.IsZero() {
+			l.Time = time.Now().UTC()
+		}
+		if l.Stream == "" {
+			l.Stream = container.LogStreamStdout
+		}
+		m.logs[containerID] = append(m.logs[containerID], l)
+	}
+	if wake := m.logWake[containerID]; wake != nil {
+		close(wake)
+		delete(m.logWake, containerID)
+	}
+}
+
+// FollowLogs replays what the container wrote after since, then streams new
+// lines until ctx is done.
+func (m *MockContainerManager) FollowLogs(ctx context.Context, containerID string, since time.Time) (<-chan container.LogLine, error) {
+	m.logMu.Lock()
+	m.follows++
+	m.logMu.Unlock()
+	out := make(chan container.LogLine)
+	go func() {
+		defer close(out)
+		next := 0
+		for {
+			m.logMu.Lock()
+			pending := m.logs[containerID][next:]
+			next += len(pending)
+			var wake chan struct{}
+			if len(pending) == 0 {
+				if m.logWake == nil {
+					m.logWake = make(map[string]chan struct{})
+				}
+				if m.logWake[containerID] == nil {
+					m.logWake[containerID] = make(chan struct{})
+				}
+				wake = m.logWake[containerID]
+			}
+			m.logMu.Unlock()
+			for _, l := range pending {
+				if !since.IsZero() && !l.Time.After(since) {
+					continue
+				}
+				select {
+				case out <- l:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if wake == nil {
+				continue
+			}
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *MockContainerManager) Inspect(ctx context.Context, containerID string) (container.ContainerState, error) {
+	if st, ok := m.states[containerID]; ok {
+		return st, nil
+	}
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ContainerState{}, container.ErrContainerNotFound(containerID)
+	}
+	return container.ContainerState{Status: c.Status, Running: c.Status == "running", Paused: c.Status == "paused"}, nil
+}
+
+func (m *MockContainerManager) Exec(ctx context.Context, containerID string, argv []string, timeout time.Duration) (container.ExecResult, error) {
+	if m.execFn != nil {
+		return m.execFn(ctx, containerID, argv)
+	}
+	return container.ExecResult{Output: "ok\n"}, nil
+}
+
+func (m *MockContainerManager) Ping(ctx context.Context) (container.RuntimeInfo, error) {
+	if m.pingError != nil {
+		return container.RuntimeInfo{}, m.pingError
+	}
+	return container.RuntimeInfo{Version: "5.0.0-mock"}, nil
+}
+
+func (m *MockContainerManager) PublishUpdateSupported(ctx context.Context) bool {
+	return m.publishUpdate
+}
+
+func (m *MockContainerManager) UpdatePublishAdd(ctx context.Context, containerID string, port container.PortMapping) error {
+	if m.publishError != nil {
+		return m.publishError
+	}
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ErrContainerNotFound(containerID)
+	}
+	c.Spec.Ports = append(c.Spec.Ports, port)
+	return nil
+}
+
+func (m *MockContainerManager) UpdatePublishRemove(ctx context.Context, containerID string, port container.PortMapping) error {
+	if m.publishError != nil {
+		return m.publishError
+	}
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ErrContainerNotFound(containerID)
+	}
+	kept := c.Spec.Ports[:0]
+	for _, p := range c.Spec.Ports {
+		if p.Host != port.Host || p.Container != port.Container {
+			kept = append(kept, p)
+		}
+	}
+	c.Spec.Ports = kept
+	return nil
+}
+
+func (m *MockContainerManager) PublishedPorts(ctx context.Context, containerID string) (map[int]int, error) {
+	if ports, ok := m.published[containerID]; ok {
+		return ports, nil
+	}
+	c, ok := m.containers[containerID]
+	if !ok {
+		return nil, container.ErrContainerNotFound(containerID)
+	}
+	ports := make(map[int]int, len(c.Spec.Ports))
+	for _, p := range c.Spec.Ports {
+		ports[p.Container] = p.Host
+	}
+	return ports, nil
+}
+
 func generateMockContainerID(id int) string {
 	return "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcd" + string(rune('0'+id%10))
 }
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"piccolod/internal/container"
+)
+
+// ErrOperationTimeout is returned when a container operation exceeds its budget.
+var ErrOperationTimeout = errors.New("app manager: container operation timed out")
+
+// OperationTimeouts bounds individual container operations. Zero fields fall
+// back to DefaultOperationTimeouts.
+type OperationTimeouts struct {
+	Pull   time.Duration
+	Create time.Duration
+	Start  time.Duration
+	Stop   time.Duration
+}
+
+// DefaultOperationTimeouts are generous enough for slow disks while still
+// freeing callers stuck on a wedged podman.
+var DefaultOperationTimeouts = OperationTimeouts{
+	Pull:   30 * time.Minute,
+	Create: 2 * time.Minute,
+	Start:  time.Minute,
+	Stop:   time.Minute,
+}
+
+// inspectTimeout bounds the podman inspect run after a failed operation to
+// learn why it failed.
+const inspectTimeout = 10 * time.Second
+
+// ImagePuller is implemented by container managers that can inspect the
+// local image store and report pull progress.
+type ImagePuller interface {
+	ImageExists(ctx context.Context, image string) (bool, error)
+	PullImageProgress(ctx context.Context, image string, report func(container.PullProgress)) error
+}
+
+// SetOperationTimeouts overrides the per-operation container budgets.
+func (m *AppManager) SetOperationTimeouts(t OperationTimeouts) {
+	m.opMu.Lock()
+	m.opTimeouts = t
+	m.opMu.Unlock()
+}
+
+// OperationTimeouts returns the effective per-operation budgets.
+func (m *AppManager) OperationTimeouts() OperationTimeouts {
+	m.opMu.Lock()
+	t := m.opTimeouts
+	m.opMu.Unlock()
+	if t.Pull <= 0 {
+		t.Pull = DefaultOperationTimeouts.Pull
+	}
+	if t.Create <= 0 {
+		t.Create = DefaultOperationTimeouts.Create
+	}
+	if t.Start <= 0 {
+		t.Start = DefaultOperationTimeouts.Start
+	}
+	if t.Stop <= 0 {
+		t.Stop = DefaultOperationTimeouts.Stop
+	}
+	return t
+}
+
+// withBudget runs fn under a deadline and reports overruns as
+// ErrOperationTimeout rather than a bare context error.
+func withBudget(ctx context.Context, op string, budget time.Duration, fn func(context.Context) error) error {
+	opCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	err := fn(opCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s exceeded %s", ErrOperationTimeout, op, budget)
+	}
+	return err
+}
+
+func (m *AppManager) createContainer(ctx context.Context, spec container.ContainerCreateSpec) (string, error) {
+	var id string
+	err := withBudget(ctx, "create", m.OperationTimeouts().Create, func(ctx context.Context) error {
+		var err error
+		id, err = m.containerManager.CreateContainer(ctx, spec)
+		return err
+	})
+	return id, err
+}
+
+func (m *AppManager) startContainer(ctx context.Context, containerID string) error {
+	return withBudget(ctx, "start", m.OperationTimeouts().Start, func(ctx context.Context) error {
+		return m.containerManager.StartContainer(ctx, containerID)
+	})
+}
+
+func (m *AppManager) stopContainer(ctx context.Context, containerID string) error {
+	return withBudget(ctx, "stop", m.OperationTimeouts().Stop, func(ctx context.Context) error {
+		return m.containerManager.StopContainer(ctx, containerID)
+	})
+}
+
+func (m *AppManager) pauseContainer(ctx context.Context, containerID string) error {
+	return withBudget(ctx, "pause", m.OperationTimeouts().Stop, func(ctx context.Context) error {
+		return m.containerManager.PauseContainer(ctx, containerID)
+	})
+}
+
+func (m *AppManager) unpauseContainer(ctx context.Context, containerID string) error {
+	return withBudget(ctx, "unpause", m.OperationTimeouts().Start, func(ctx context.Context) error {
+		return m.containerManager.UnpauseContainer(ctx, containerID)
+	})
+}
+
+// ImagePresent reports whether image is available locally. Runtimes that
+// cannot tell are assumed to pull on create.
+func (m *AppManager) ImagePresent(ctx context.Context, image string) (bool, error) {
+	puller, ok := m.containerManager.(ImagePuller)
+	if !ok {
+		return true, nil
+	}
+	return puller.ImageExists(ctx, image)
+}
+
+// PullImage pulls image within the pull budget, forwarding progress when the
+// runtime reports it. Canceling ctx aborts the pull.
+func (m *AppManager) PullImage(ctx context.Context, image string, report func(container.PullProgress)) error {
+	return withBudget(ctx, "pull", m.OperationTimeouts().Pull, func(ctx context.Context) error {
+		if puller, ok := m.containerManager.(ImagePuller); ok {
+			return puller.PullImageProgress(ctx, image, report)
+		}
+		return m.containerManager.PullImage(ctx, image)
+	})
+}
+
+// ensureImage pulls a missing image up front so the create budget only
+// covers creating the container.
+func (m *AppManager) ensureImage(ctx context.Context, image string) error {
+	present, err := m.ImagePresent(ctx, image)
+	if err != nil {
+		log.Printf("WARN: check image %s: %v", image, err)
+		return nil
+	}
+	if present {
+		return nil
+	}
+	return m.PullImage(ctx, image, nil)
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+func TestAppManager_OperationTimeouts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "app_operation_timeouts")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+
+	ctx := context.Background()
+	appDef := &api.AppDefinition{Name: "slow-app", Image: "nginx:alpine", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 80}}}
+	if _, err := manager.Install(ctx, appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	manager.SetOperationTimeouts(OperationTimeouts{Start: 20 * time.Millisecond, Stop: 20 * time.Millisecond})
+	if got := manager.OperationTimeouts(); got.Create != DefaultOperationTimeouts.Create {
+		t.Fatalf("unset create budget should keep the default, got %s", got.Create)
+	}
+	mock.startDelay = time.Minute
+	began := time.Now()
+	if err := manager.Start(ctx, "slow-app"); !errors.Is(err, ErrOperationTimeout) {
+		t.Fatalf("expected ErrOperationTimeout, got %v", err)
+	}
+	if elapsed := time.Since(began); elapsed > 5*time.Second {
+		t.Fatalf("start budget not enforced; took %s", elapsed)
+	}
+	if inst, _ := manager.Get(ctx, "slow-app"); inst.Status != "error" {
+		t.Fatalf("timed out start should mark the app errored, got %q", inst.Status)
+	}
+
+	// A caller cancellation is not a budget overrun.
+	mock.startDelay = 0
+	mock.stopDelay = time.Minute
+	manager.SetOperationTimeouts(OperationTimeouts{})
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = manager.Stop(cancelCtx, "slow-app")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrOperationTimeout) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package app
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 	"piccolod/internal/api"
@@ -13,8 +15,22 @@ var (
 	// Valid app name pattern: lowercase letters, numbers, hyphens
 	// Must start with letter, end with letter or number
 	appNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$|^[a-z]$`)
+
+	// remoteSubdomainRegex is a single DNS label.
+	remoteSubdomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+	// taskNameRegex appears in API paths, so it stays URL-safe.
+	taskNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+	// pathSegmentRegex is one segment of a path_prefix, unreserved URL
+	// characters only so the prefix needs no escaping.
+	pathSegmentRegex = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
 )
 
+// portalAppsPath is the portal namespace path prefixes live under, so no
+// app can claim the API or a web UI page such as /login or /unlock.
+const portalAppsPath = "/apps"
+
 // ParseAppDefinition parses YAML content into AppDefinition struct with validation
 func ParseAppDefinition(content []byte) (*api.AppDefinition, error) {
 	var app api.AppDefinition
@@ -35,6 +51,20 @@ func ParseAppDefinition(content []byte) (*api.AppDefinition, error) {
 	return &app, nil
 }
 
+// parseInstalledAppDefinition is ParseAppDefinition for definitions read
+// back from disk, which are held to validateInstalledDefinition.
+func parseInstalledAppDefinition(content []byte) (*api.AppDefinition, error) {
+	var appDef api.AppDefinition
+	if err := yaml.Unmarshal(content, &appDef); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	SetDefaults(&appDef)
+	if err := validateInstalledDefinition(&appDef); err != nil {
+		return nil, err
+	}
+	return &appDef, nil
+}
+
 // SerializeAppDefinition serializes AppDefinition to YAML bytes
 func SerializeAppDefinition(app *api.AppDefinition) ([]byte, error) {
 	data, err := yaml.Marshal(app)
@@ -46,6 +76,11 @@ func SerializeAppDefinition(app *api.AppDefinition) ([]byte, error) {
 
 // SetDefaults sets default values for AppDefinition fields
 func SetDefaults(app *api.AppDefinition) {
+	// Unversioned files predate schema versioning and are v1.
+	if app.APIVersion == "" {
+		app.APIVersion = AppAPIVersion
+	}
+
 	// Default type is "user"
 	if app.Type == "" {
 		app.Type = "user"
@@ -64,8 +99,26 @@ func SetDefaults(app *api.AppDefinition) {
 
 // ValidateAppDefinition validates an AppDefinition struct
 func ValidateAppDefinition(app *api.AppDefinition) error {
+	return validateAppDefinition(app, validateName)
+}
+
+// validateInstalledDefinition validates the definition of an app already
+// installed. Its name only has to be usable as a directory name: apps
+// installed before the naming rules tightened keep loading, and report the
+// problem through AppInstance.Warnings.
+func validateInstalledDefinition(app *api.AppDefinition) error {
+	return validateAppDefinition(app, validateStoredName)
+}
+
+func validateAppDefinition(app *api.AppDefinition, checkName func(string) error) error {
+	if app.APIVersion != "" {
+		if err := validateAPIVersion(app.APIVersion); err != nil {
+			return err
+		}
+	}
+
 	// Validate name
-	if err := validateName(app.Name); err != nil {
+	if err := checkName(app.Name); err != nil {
 		return err
 	}
 
@@ -99,6 +152,24 @@ func ValidateAppDefinition(app *api.AppDefinition) error {
 		return err
 	}
 
+	// Validate capabilities (whether they are granted is decided by policy)
+	if err := validateCapabilities(app.Capabilities, app.Permissions); err != nil {
+		return err
+	}
+
+	// Validate dependencies (installed-app checks happen at install time)
+	if err := validateDependsOn(app.Name, app.DependsOn); err != nil {
+		return err
+	}
+
+	if err := validateTasks(app.Tasks); err != nil {
+		return err
+	}
+
+	if err := validateLogs(app.Logs); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -117,8 +188,7 @@ func validateName(name string) error {
 	}
 
 	// Reserved names check
-	reserved := []string{"api", "www", "admin", "root", "system", "piccolo"}
-	for _, r := range reserved {
+	for _, r := range reservedAppNames {
 		if name == r {
 			return fmt.Errorf("name '%s' is reserved", name)
 		}
@@ -127,6 +197,41 @@ func validateName(name string) error {
 	return nil
 }
 
+// reservedAppNames collide with Piccolo's own hostnames, API paths or
+// state directories.
+var reservedAppNames = []string{"api", "www", "admin", "root", "system", "piccolo", "control", "portal", "enabled"}
+
+// validateStoredName accepts any name that is a single path element, the
+// least an installed app's name must be to address its state directory.
+func validateStoredName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("name %q is not a valid directory name", name)
+	}
+	return nil
+}
+
+// validateDependsOn checks dependency names; whether they are installed and
+// acyclic is checked by the app manager.
+func validateDependsOn(name string, deps []string) error {
+	seen := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		if err := validateName(dep); err != nil {
+			return fmt.Errorf("depends_on: %w", err)
+		}
+		if dep == name {
+			return fmt.Errorf("depends_on: app cannot depend on itself")
+		}
+		if seen[dep] {
+			return fmt.Errorf("depends_on: duplicate dependency %s", dep)
+		}
+		seen[dep] = true
+	}
+	return nil
+}
+
 // validateImageOrBuild ensures either image or build is specified (but not both)
 func validateImageOrBuild(app *api.AppDefinition) error {
 	hasImage := app.Image != ""
@@ -167,6 +272,9 @@ func validateListeners(listeners []api.AppListener) error {
 
 	names := make(map[string]struct{})
 	guestPorts := make(map[int]string)
+	remotePorts := make(map[int]string)
+	remoteLabels := make(map[string]string)
+	var pathPrefixes []api.AppListener
 
 	for i, l := range listeners {
 		// name required
@@ -188,6 +296,16 @@ func validateListeners(listeners []api.AppListener) error {
 		}
 		guestPorts[l.GuestPort] = l.Name
 
+		if l.RemoteSubdomain != "" && !remoteSubdomainRegex.MatchString(l.RemoteLabel()) {
+			return fmt.Errorf("listener '%s' remote_subdomain '%s' must be a single DNS label", l.Name, l.RemoteSubdomain)
+		}
+		// Listener names only differing in case, or a remote_subdomain
+		// naming a sibling, would publish two listeners on one hostname.
+		if existing, ok := remoteLabels[l.RemoteLabel()]; ok {
+			return fmt.Errorf("listeners '%s' and '%s' share remote hostname label '%s'", existing, l.Name, l.RemoteLabel())
+		}
+		remoteLabels[l.RemoteLabel()] = l.Name
+
 		if l.Flow != api.FlowTCP && l.Flow != api.FlowTLS {
 			return fmt.Errorf("listener '%s' flow must be 'tcp' or 'tls'", l.Name)
 		}
@@ -195,10 +313,70 @@ func validateListeners(listeners []api.AppListener) error {
 		switch l.Protocol {
 		case api.ListenerProtocolRaw, api.ListenerProtocolHTTP, api.ListenerProtocolWebsocket:
 			// ok
+		case api.ListenerProtocolHTTPS:
+			// The device terminates client TLS and re-encrypts; flow=tls
+			// would hand the client's TLS to the backend untouched.
+			if l.Flow != api.FlowTCP {
+				return fmt.Errorf("listener '%s' protocol 'https' requires flow 'tcp'", l.Name)
+			}
+		case api.ListenerProtocolTCP, api.ListenerProtocolUDP:
+			if l.Protocol == api.ListenerProtocolUDP && l.Flow == api.FlowTLS {
+				return fmt.Errorf("listener '%s' protocol 'udp' cannot use flow 'tls'", l.Name)
+			}
+			if len(l.Middleware) > 0 {
+				return fmt.Errorf("listener '%s' protocol '%s' does not support protocol_middleware", l.Name, l.Protocol.String())
+			}
 		default:
 			return fmt.Errorf("listener '%s' protocol '%s' not supported in v1", l.Name, l.Protocol.String())
 		}
 
+		if l.PreserveHost != nil && !l.Protocol.HTTP() {
+			return fmt.Errorf("listener '%s' preserve_host applies only to http, https and websocket listeners", l.Name)
+		}
+		if l.BackendTLS != nil {
+			if l.Protocol != api.ListenerProtocolHTTPS {
+				return fmt.Errorf("listener '%s' backend_tls applies only to https listeners", l.Name)
+			}
+			if _, err := l.BackendTLS.FingerprintBytes(); err != nil {
+				return fmt.Errorf("listener '%s' backend_tls %v", l.Name, err)
+			}
+			if _, err := l.BackendTLS.CertPool(); err != nil {
+				return fmt.Errorf("listener '%s' backend_tls %v", l.Name, err)
+			}
+		}
+		if err := validateListenerLimits(l); err != nil {
+			return err
+		}
+		if err := validatePathPrefix(l); err != nil {
+			return err
+		}
+		if prefix := l.PortalPath(); prefix != "" {
+			for _, other := range pathPrefixes {
+				if api.PathsOverlap(prefix, other.PortalPath()) {
+					return fmt.Errorf("listeners '%s' and '%s' have overlapping path_prefix '%s' and '%s'", other.Name, l.Name, other.PortalPath(), prefix)
+				}
+			}
+			pathPrefixes = append(pathPrefixes, l)
+		}
+
+		for _, rp := range l.RemotePorts {
+			if rp < 1 || rp > 65535 {
+				return fmt.Errorf("listener '%s' remote port %d must be between 1 and 65535", l.Name, rp)
+			}
+			if !l.Protocol.Passthrough() {
+				continue
+			}
+			// 80/443 are routed by hostname to HTTP listeners and the portal;
+			// raw flows have no hostname to route on.
+			if rp == 80 || rp == 443 {
+				return fmt.Errorf("listener '%s' protocol '%s' cannot use remote port %d reserved for http routing", l.Name, l.Protocol.String(), rp)
+			}
+			if existing, ok := remotePorts[rp]; ok {
+				return fmt.Errorf("remote port %d used by both '%s' and '%s'", rp, existing, l.Name)
+			}
+			remotePorts[rp] = l.Name
+		}
+
 		// middleware entries: ensure names present
 		for j, m := range l.Middleware {
 			if strings.TrimSpace(m.Name) == "" {
@@ -209,6 +387,97 @@ func validateListeners(listeners []api.AppListener) error {
 	return nil
 }
 
+// validatePathPrefix checks the portal path a listener asks to be served
+// under.
+func validatePathPrefix(l api.AppListener) error {
+	raw := strings.TrimSpace(l.PathPrefix)
+	if raw == "" {
+		if l.StripPrefix != nil || l.Public {
+			return fmt.Errorf("listener '%s' strip_prefix and public apply only with path_prefix", l.Name)
+		}
+		return nil
+	}
+	if l.Protocol != api.ListenerProtocolHTTP && l.Protocol != api.ListenerProtocolWebsocket {
+		return fmt.Errorf("listener '%s' path_prefix applies only to http and websocket listeners", l.Name)
+	}
+	prefix := l.PortalPath()
+	if !strings.HasPrefix(prefix, portalAppsPath+"/") {
+		return fmt.Errorf("listener '%s' path_prefix '%s' must be under %s/, such as %s/%s", l.Name, l.PathPrefix, portalAppsPath, portalAppsPath, strings.ToLower(l.Name))
+	}
+	for _, seg := range strings.Split(prefix[1:], "/") {
+		if seg == "." || seg == ".." || !pathSegmentRegex.MatchString(seg) {
+			return fmt.Errorf("listener '%s' path_prefix '%s' has an invalid segment '%s'", l.Name, l.PathPrefix, seg)
+		}
+	}
+	return nil
+}
+
+// maxListenerIdleTimeout bounds a listener's idle_timeout.
+const maxListenerIdleTimeout = 24 * time.Hour
+
+// validateListenerLimits checks a listener's connection limits. UDP relays
+// track peers rather than connections, so the limits do not apply to them.
+func validateListenerLimits(l api.AppListener) error {
+	if l.MaxConnections == 0 && l.MaxConnectionsPerIP == 0 && l.IdleTimeout == "" {
+		return nil
+	}
+	if l.Protocol == api.ListenerProtocolUDP {
+		return fmt.Errorf("listener '%s' connection limits do not apply to udp listeners", l.Name)
+	}
+	if l.MaxConnections < 0 {
+		return fmt.Errorf("listener '%s' max_connections must not be negative", l.Name)
+	}
+	if l.MaxConnectionsPerIP < 0 {
+		return fmt.Errorf("listener '%s' max_connections_per_ip must not be negative", l.Name)
+	}
+	if l.MaxConnections > 0 && l.MaxConnectionsPerIP > l.MaxConnections {
+		return fmt.Errorf("listener '%s' max_connections_per_ip %d exceeds max_connections %d", l.Name, l.MaxConnectionsPerIP, l.MaxConnections)
+	}
+	d, err := l.IdleTimeoutDuration()
+	if err != nil {
+		return fmt.Errorf("listener '%s' %v", l.Name, err)
+	}
+	if l.IdleTimeout != "" && (d < time.Second || d > maxListenerIdleTimeout) {
+		return fmt.Errorf("listener '%s' idle_timeout '%s' must be between 1s and %s", l.Name, l.IdleTimeout, maxListenerIdleTimeout)
+	}
+	return nil
+}
+
+// validateTasks checks names, cron schedules and timeouts of scheduled tasks.
+func validateTasks(tasks []api.AppTask) error {
+	names := make(map[string]struct{}, len(tasks))
+	for i, t := range tasks {
+		if !taskNameRegex.MatchString(t.Name) {
+			return fmt.Errorf("tasks[%d] name '%s' must be lowercase letters, numbers and hyphens", i, t.Name)
+		}
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("duplicate task name '%s'", t.Name)
+		}
+		names[t.Name] = struct{}{}
+		if _, err := parseCronSchedule(t.Schedule); err != nil {
+			return fmt.Errorf("task '%s': %w", t.Name, err)
+		}
+		if len(t.Command) == 0 || strings.TrimSpace(t.Command[0]) == "" {
+			return fmt.Errorf("task '%s' command is required", t.Name)
+		}
+		if _, err := taskTimeout(t); err != nil {
+			return fmt.Errorf("task '%s': %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateLogs checks the log archive cap.
+func validateLogs(logs *api.AppLogs) error {
+	if logs == nil {
+		return nil
+	}
+	if _, err := logArchiveCap(logs); err != nil {
+		return fmt.Errorf("logs: %w", err)
+	}
+	return nil
+}
+
 // validateStorage validates storage configuration
 func validateStorage(storage *api.AppStorage) error {
 	if storage == nil {
@@ -225,6 +494,34 @@ func validateStorage(storage *api.AppStorage) error {
 		return err
 	}
 
+	return validateHostMounts(storage.HostMounts)
+}
+
+// validateHostMounts checks the shape of host mounts. Whether a host path is
+// allowed is decided against the mount allowlist at install time.
+func validateHostMounts(mounts []api.AppHostMount) error {
+	seen := make(map[string]bool, len(mounts))
+	for i, mount := range mounts {
+		if mount.Host == "" || mount.Container == "" {
+			return fmt.Errorf("host mount %d must specify host and container paths", i)
+		}
+		if !filepath.IsAbs(mount.Host) || !filepath.IsAbs(mount.Container) {
+			return fmt.Errorf("host mount '%s' paths must be absolute", mount.Host)
+		}
+		if filepath.Clean(mount.Host) == "/" || filepath.Clean(mount.Container) == "/" {
+			return fmt.Errorf("host mount '%s' cannot bind the root directory", mount.Host)
+		}
+		container := filepath.Clean(mount.Container)
+		if seen[container] {
+			return fmt.Errorf("host mount container path '%s' is used twice", mount.Container)
+		}
+		seen[container] = true
+		switch mount.SELinux {
+		case "", "z", "Z":
+		default:
+			return fmt.Errorf("host mount '%s' selinux must be z or Z", mount.Host)
+		}
+	}
 	return nil
 }
 
@@ -355,6 +652,43 @@ func validateResourcePermissions(resources *api.AppResourcePermissions) error {
 	return nil
 }
 
+// validateCapabilities checks the shape of declared capabilities. Whether
+// they are granted is decided against the app policy at install time.
+func validateCapabilities(caps *api.AppCapabilities, permissions *api.AppPermissions) error {
+	if caps == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(caps.Devices))
+	for _, dev := range caps.Devices {
+		if !filepath.IsAbs(dev) {
+			return fmt.Errorf("capabilities.devices path '%s' must be absolute", dev)
+		}
+		clean := filepath.Clean(dev)
+		if !pathWithin(clean, "/dev") || clean == "/dev" {
+			return fmt.Errorf("capabilities.devices path '%s' must be below /dev", dev)
+		}
+		if seen[clean] {
+			return fmt.Errorf("capabilities.devices path '%s' is listed twice", dev)
+		}
+		seen[clean] = true
+	}
+	seen = make(map[string]bool, len(caps.Linux))
+	for _, name := range caps.Linux {
+		capName := CanonicalCapability(name)
+		if !linuxCapabilities[capName] {
+			return fmt.Errorf("capabilities.linux '%s' is not a Linux capability", name)
+		}
+		if seen[capName] {
+			return fmt.Errorf("capabilities.linux '%s' is listed twice", name)
+		}
+		seen[capName] = true
+	}
+	if caps.HostNetwork && permissions != nil && permissions.Network != nil && permissions.Network.Internet == "deny" {
+		return fmt.Errorf("capabilities.host_network cannot be combined with permissions.network.internet: deny")
+	}
+	return nil
+}
+
 // validateBuild validates build configuration
 func validateBuild(build *api.AppBuild) error {
 	if build == nil {
@@ -2,6 +2,7 @@ package app
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"piccolod/internal/api"
@@ -182,6 +183,42 @@ func TestValidateAppDefinition(t *testing.T) {
 			expectError: true,
 			expectedErr: "name must contain only lowercase letters, numbers, and hyphens",
 		},
+		{
+			name:        "path traversal name",
+			app:         &api.AppDefinition{Name: "../../etc", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name must contain only lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:        "uppercase name",
+			app:         &api.AppDefinition{Name: "MyApp", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name must contain only lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:        "name with spaces",
+			app:         &api.AppDefinition{Name: "my app", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name must contain only lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:        "name with trailing hyphen",
+			app:         &api.AppDefinition{Name: "my-app-", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name must contain only lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:        "reserved name",
+			app:         &api.AppDefinition{Name: "portal", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name 'portal' is reserved",
+		},
+		{
+			name:        "reserved state directory name",
+			app:         &api.AppDefinition{Name: "enabled", Image: "nginx:latest"},
+			expectError: true,
+			expectedErr: "name 'enabled' is reserved",
+		},
 		{
 			name:        "name too long",
 			app:         &api.AppDefinition{Name: "this-is-a-very-long-app-name-that-exceeds-the-maximum-allowed-length", Image: "nginx:latest"},
@@ -214,6 +251,381 @@ func TestValidateAppDefinition(t *testing.T) {
 			expectError: true,
 			expectedErr: "guest_port must be between 1 and 65535",
 		},
+		{
+			name: "udp listener with remote port",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "wireguard:latest",
+				Listeners: []api.AppListener{{Name: "wg", GuestPort: 51820, Protocol: api.ListenerProtocolUDP, RemotePorts: []int{51820}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "udp listener with http middleware",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "wireguard:latest",
+				Listeners: []api.AppListener{{
+					Name:       "wg",
+					GuestPort:  51820,
+					Protocol:   api.ListenerProtocolUDP,
+					Middleware: []api.AppProtocolMiddleware{{Name: "security_headers"}},
+				}},
+			},
+			expectError: true,
+			expectedErr: "does not support protocol_middleware",
+		},
+		{
+			name: "udp listener over tls flow",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "wireguard:latest",
+				Listeners: []api.AppListener{{Name: "wg", GuestPort: 51820, Flow: api.FlowTLS, Protocol: api.ListenerProtocolUDP}},
+			},
+			expectError: true,
+			expectedErr: "cannot use flow 'tls'",
+		},
+		{
+			name: "tcp listener on http remote port",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "minecraft:latest",
+				Listeners: []api.AppListener{{Name: "game", GuestPort: 25565, Protocol: api.ListenerProtocolTCP, RemotePorts: []int{443}}},
+			},
+			expectError: true,
+			expectedErr: "reserved for http routing",
+		},
+		{
+			name: "duplicate listener name",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "nginx:latest",
+				Listeners: []api.AppListener{
+					{Name: "web", GuestPort: 80},
+					{Name: "web", GuestPort: 8080},
+				},
+			},
+			expectError: true,
+			expectedErr: "duplicate listener name 'web'",
+		},
+		{
+			name: "duplicate guest port",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "nginx:latest",
+				Listeners: []api.AppListener{
+					{Name: "web", GuestPort: 80},
+					{Name: "admin", GuestPort: 80},
+				},
+			},
+			expectError: true,
+			expectedErr: "guest_port 80 used by both 'web' and 'admin'",
+		},
+		{
+			name: "duplicate raw remote port",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "minecraft:latest",
+				Listeners: []api.AppListener{
+					{Name: "game", GuestPort: 25565, Protocol: api.ListenerProtocolTCP, RemotePorts: []int{25565}},
+					{Name: "query", GuestPort: 25566, Protocol: api.ListenerProtocolUDP, RemotePorts: []int{25565}},
+				},
+			},
+			expectError: true,
+			expectedErr: "remote port 25565 used by both",
+		},
+		{
+			name: "invalid remote subdomain",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, RemoteSubdomain: "blog.example"}},
+			},
+			expectError: true,
+			expectedErr: "must be a single DNS label",
+		},
+		{
+			name: "remote subdomain shadows sibling listener",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "nginx:latest",
+				Listeners: []api.AppListener{
+					{Name: "web", GuestPort: 80},
+					{Name: "admin", GuestPort: 8080, RemoteSubdomain: "Web"},
+				},
+			},
+			expectError: true,
+			expectedErr: "share remote hostname label 'web'",
+		},
+		{
+			name: "remote subdomain",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, RemoteSubdomain: "blog"}},
+			},
+		},
+		{
+			name: "path prefix",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/test-app/", Public: true}},
+			},
+		},
+		{
+			name: "path prefix claims an api route",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/api/v2"}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix claims acme challenges",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/.well-known"}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix claims the login page",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/login", Public: true}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix claims the unlock page",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/unlock/", Public: true}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix is the apps namespace itself",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/"}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix is the portal root",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/"}},
+			},
+			expectError: true,
+			expectedErr: "must be under /apps/",
+		},
+		{
+			name: "path prefix escapes with dot segments",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/../api"}},
+			},
+			expectError: true,
+			expectedErr: "invalid segment '..'",
+		},
+		{
+			name: "path prefix on raw listener",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, PathPrefix: "/apps/test-app"}},
+			},
+			expectError: true,
+			expectedErr: "path_prefix applies only to http and websocket listeners",
+		},
+		{
+			name: "overlapping path prefixes",
+			app: &api.AppDefinition{
+				Name:  "test-app",
+				Image: "nginx:latest",
+				Listeners: []api.AppListener{
+					{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/test"},
+					{Name: "admin", GuestPort: 8080, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/test/admin"},
+				},
+			},
+			expectError: true,
+			expectedErr: "overlapping path_prefix",
+		},
+		{
+			name: "public without path prefix",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, Public: true}},
+			},
+			expectError: true,
+			expectedErr: "apply only with path_prefix",
+		},
+		{
+			name: "preserve_host on raw tcp listener",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "db", GuestPort: 5432, Protocol: api.ListenerProtocolTCP, PreserveHost: new(bool)}},
+			},
+			expectError: true,
+			expectedErr: "preserve_host applies only to http, https and websocket listeners",
+		},
+		{
+			name: "preserve_host opt-out on http listener",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, PreserveHost: new(bool)}},
+			},
+		},
+		{
+			name: "https listener with pinned fingerprint",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 8443, Protocol: api.ListenerProtocolHTTPS, BackendTLS: &api.ListenerBackendTLS{Fingerprint: strings.Repeat("AB:", 31) + "AB"}}},
+			},
+		},
+		{
+			name: "https listener with tls flow",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 8443, Flow: api.FlowTLS, Protocol: api.ListenerProtocolHTTPS}},
+			},
+			expectError: true,
+			expectedErr: "protocol 'https' requires flow 'tcp'",
+		},
+		{
+			name: "backend_tls on http listener",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, Protocol: api.ListenerProtocolHTTP, BackendTLS: &api.ListenerBackendTLS{Fingerprint: strings.Repeat("ab", 32)}}},
+			},
+			expectError: true,
+			expectedErr: "backend_tls applies only to https listeners",
+		},
+		{
+			name: "short backend fingerprint",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 8443, Protocol: api.ListenerProtocolHTTPS, BackendTLS: &api.ListenerBackendTLS{Fingerprint: "abcd"}}},
+			},
+			expectError: true,
+			expectedErr: "fingerprint must be a hex SHA-256 digest",
+		},
+		{
+			name: "listener connection limits",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, MaxConnections: 100, MaxConnectionsPerIP: 10, IdleTimeout: "2m"}},
+			},
+		},
+		{
+			name: "per-IP cap above the listener cap",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, MaxConnections: 10, MaxConnectionsPerIP: 20}},
+			},
+			expectError: true,
+			expectedErr: "max_connections_per_ip 20 exceeds max_connections 10",
+		},
+		{
+			name: "idle timeout too short",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80, IdleTimeout: "10ms"}},
+			},
+			expectError: true,
+			expectedErr: "idle_timeout '10ms' must be between 1s and 24h0m0s",
+		},
+		{
+			name: "connection limits on udp listener",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "dns", GuestPort: 53, Protocol: api.ListenerProtocolUDP, MaxConnections: 10}},
+			},
+			expectError: true,
+			expectedErr: "connection limits do not apply to udp listeners",
+		},
+		{
+			name: "valid scheduled task",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+				Tasks:     []api.AppTask{{Name: "cron", Schedule: "*/5 * * * *", Command: []string{"php", "cron.php"}, Timeout: "2m"}},
+			},
+		},
+		{
+			name: "task with bad schedule",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+				Tasks:     []api.AppTask{{Name: "cron", Schedule: "61 * * * *", Command: []string{"true"}}},
+			},
+			expectError: true,
+			expectedErr: "minute \"61\" must be a number between 0 and 59",
+		},
+		{
+			name: "task without command",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+				Tasks:     []api.AppTask{{Name: "cron", Schedule: "@hourly"}},
+			},
+			expectError: true,
+			expectedErr: "task 'cron' command is required",
+		},
+		{
+			name: "task timeout too long",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+				Tasks:     []api.AppTask{{Name: "cron", Schedule: "@daily", Command: []string{"true"}, Timeout: "48h"}},
+			},
+			expectError: true,
+			expectedErr: "must be a duration between 1s and 24h0m0s",
+		},
+		{
+			name: "duplicate task names",
+			app: &api.AppDefinition{
+				Name:      "test-app",
+				Image:     "nginx:latest",
+				Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+				Tasks: []api.AppTask{
+					{Name: "cron", Schedule: "@daily", Command: []string{"true"}},
+					{Name: "cron", Schedule: "@hourly", Command: []string{"true"}},
+				},
+			},
+			expectError: true,
+			expectedErr: "duplicate task name 'cron'",
+		},
 	}
 
 	for _, tt := range tests {
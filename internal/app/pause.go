@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"piccolod/internal/activity"
+)
+
+// AppStatusPaused marks an app whose container is frozen in place: its
+// processes and memory are kept and its endpoints stay allocated.
+const AppStatusPaused = "paused"
+
+var (
+	// ErrAppPaused is returned when an operation needs a running container
+	// but the app is paused.
+	ErrAppPaused = errors.New("app manager: app is paused")
+	// ErrAppNotPaused is returned when unpausing an app that is not paused.
+	ErrAppNotPaused = errors.New("app manager: app not paused")
+	// ErrPauseNotAllowed is returned for apps that may not be paused, such
+	// as system apps.
+	ErrPauseNotAllowed = errors.New("app manager: app cannot be paused")
+)
+
+// Pause freezes a running app's container. Its service proxies stay bound
+// but refuse traffic until Unpause.
+func (m *AppManager) Pause(ctx context.Context, name string) error {
+	if err := m.ensureUnlocked(); err != nil {
+		return err
+	}
+	if err := m.ensureKernelLeader(); err != nil {
+		return err
+	}
+	release, err := m.lockApp(ctx, name, "pause")
+	if err != nil {
+		return err
+	}
+	defer release()
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return err
+	}
+	app, exists := state.GetApp(name)
+	if !exists {
+		return fmt.Errorf("app not found: %s", name)
+	}
+	if app.Type == "system" {
+		return fmt.Errorf("%w: %s is a system app", ErrPauseNotAllowed, name)
+	}
+	switch app.Status {
+	case AppStatusPaused:
+		return nil
+	case "running":
+	default:
+		return fmt.Errorf("%w: %s", ErrAppNotRunning, name)
+	}
+
+	if err := m.pauseContainer(ctx, app.ContainerID); err != nil {
+		return fmt.Errorf("failed to pause container: %w", err)
+	}
+	if err := state.UpdateAppStatus(name, AppStatusPaused); err != nil {
+		return fmt.Errorf("failed to update app status: %w", err)
+	}
+	if m.serviceManager != nil {
+		m.serviceManager.SetAppPaused(name, true)
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s paused", name), map[string]any{"app": name})
+	return nil
+}
+
+// Unpause resumes a paused app; its existing endpoints carry traffic again.
+func (m *AppManager) Unpause(ctx context.Context, name string) error {
+	if err := m.ensureUnlocked(); err != nil {
+		return err
+	}
+	if err := m.ensureKernelLeader(); err != nil {
+		return err
+	}
+	release, err := m.lockApp(ctx, name, "unpause")
+	if err != nil {
+		return err
+	}
+	defer release()
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return err
+	}
+	app, exists := state.GetApp(name)
+	if !exists {
+		return fmt.Errorf("app not found: %s", name)
+	}
+	switch app.Status {
+	case "running":
+		return nil
+	case AppStatusPaused:
+	default:
+		return fmt.Errorf("%w: %s", ErrAppNotPaused, name)
+	}
+
+	if err := m.unpauseContainer(ctx, app.ContainerID); err != nil {
+		return fmt.Errorf("failed to unpause container: %w", err)
+	}
+	if err := state.UpdateAppStatus(name, "running"); err != nil {
+		return fmt.Errorf("failed to update app status: %w", err)
+	}
+	if m.serviceManager != nil {
+		m.serviceManager.SetAppPaused(name, false)
+	}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s resumed", name), map[string]any{"app": name})
+	return nil
+}
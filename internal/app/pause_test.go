@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"piccolod/internal/api"
+)
+
+func TestAppManager_PauseKeepsEndpoints(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	ctx := context.Background()
+	def := &api.AppDefinition{Name: "wiki", Image: "docker.io/requarks/wiki:2", Type: "user", Listeners: []api.AppListener{{Name: "web", GuestPort: 3000}}}
+	inst, err := manager.Install(ctx, def)
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Pause(ctx, "wiki"); !errors.Is(err, ErrAppNotRunning) {
+		t.Fatalf("expected pausing a stopped app to fail, got %v", err)
+	}
+	if err := manager.Start(ctx, "wiki"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	before, _ := manager.serviceManager.GetByApp("wiki")
+
+	if err := manager.Pause(ctx, "wiki"); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if got, _ := manager.Get(ctx, "wiki"); got.Status != AppStatusPaused || mock.containers[inst.ContainerID].Status != "paused" {
+		t.Fatalf("expected app and container paused, got %q/%q", got.Status, mock.containers[inst.ContainerID].Status)
+	}
+	if err := manager.Start(ctx, "wiki"); !errors.Is(err, ErrAppPaused) {
+		t.Fatalf("expected start of a paused app to be refused, got %v", err)
+	}
+	if _, err := manager.Upsert(ctx, def); !errors.Is(err, ErrAppPaused) {
+		t.Fatalf("expected update of a paused app to be refused, got %v", err)
+	}
+	// Restoring services treats the frozen container as expected.
+	manager.RestoreServices(ctx)
+	if got, _ := manager.Get(ctx, "wiki"); got.Status != AppStatusPaused || got.LastError != "" {
+		t.Fatalf("restore disturbed the paused app: %+v", got)
+	}
+	if results, err := manager.StartApps(ctx, []string{"wiki"}); err != nil || results[0].Result != StartResultPaused {
+		t.Fatalf("expected StartApps to leave the app paused, got %+v (%v)", results, err)
+	}
+
+	if err := manager.Unpause(ctx, "wiki"); err != nil {
+		t.Fatalf("unpause: %v", err)
+	}
+	if got, _ := manager.Get(ctx, "wiki"); got.Status != "running" || mock.containers[inst.ContainerID].Status != "running" {
+		t.Fatalf("expected app running again, got %q", got.Status)
+	}
+	after, _ := manager.serviceManager.GetByApp("wiki")
+	if len(after) != 1 || after[0].HostBind != before[0].HostBind || after[0].PublicPort != before[0].PublicPort {
+		t.Fatalf("endpoints changed across pause: %+v -> %+v", before, after)
+	}
+	if err := manager.Unpause(ctx, "wiki"); err != nil {
+		t.Fatalf("unpausing a running app should be a no-op: %v", err)
+	}
+}
+
+func TestAppManager_PauseRefusesSystemApps(t *testing.T) {
+	manager, _ := newMockAppManager(t)
+	ctx := context.Background()
+	def := &api.AppDefinition{Name: "resolver", Image: "docker.io/library/unbound:latest", Type: "system", Listeners: []api.AppListener{{Name: "dns", GuestPort: 5353}}}
+	if _, err := manager.Install(ctx, def); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(ctx, "resolver"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := manager.Pause(ctx, "resolver"); !errors.Is(err, ErrPauseNotAllowed) {
+		t.Fatalf("expected system app pause to be refused, got %v", err)
+	}
+}
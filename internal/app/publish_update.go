@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/services"
+)
+
+// ErrPortMismatch is returned by Upsert when the container does not publish
+// the ports the listener reconciliation allocated.
+var ErrPortMismatch = errors.New("app manager: published ports do not match listeners")
+
+// How Upsert applied listener changes to an app's container, reported in
+// AppInstance.PortUpdate.
+const (
+	PortUpdateInPlace  = "in_place"
+	PortUpdateRecreate = "recreate"
+)
+
+// PortPublisher is implemented by container managers that can change the
+// ports a container publishes without recreating it.
+type PortPublisher interface {
+	PublishUpdateSupported(ctx context.Context) bool
+	UpdatePublishAdd(ctx context.Context, containerID string, port container.PortMapping) error
+	UpdatePublishRemove(ctx context.Context, containerID string, port container.PortMapping) error
+}
+
+// PortInspector is implemented by container managers that report the ports
+// a container actually publishes, as guest port to host port.
+type PortInspector interface {
+	PublishedPorts(ctx context.Context, containerID string) (map[int]int, error)
+}
+
+// applyPortChanges brings inst's container in line with rec. It updates the
+// published ports in place when the runtime supports it and recreates the
+// container when it does not or any update fails. It returns which of the
+// two happened.
+func (m *AppManager) applyPortChanges(ctx context.Context, state *FilesystemStateManager, inst *AppInstance, appDef *api.AppDefinition, rec services.ReconcileResult) (string, error) {
+	if publisher, ok := m.containerManager.(PortPublisher); ok && publisher.PublishUpdateSupported(ctx) {
+		err := updatePublishes(ctx, publisher, inst.ContainerID, rec)
+		if err == nil {
+			return PortUpdateInPlace, nil
+		}
+		log.Printf("WARN: app %s: in-place port update failed, recreating container: %v", inst.Name, err)
+	}
+	return PortUpdateRecreate, m.recreateContainer(ctx, state, inst, appDef, rec.Endpoints)
+}
+
+// updatePublishes applies rec as publish updates, adding a changed guest
+// port before removing the old one. Every update is attempted; the failures
+// are joined.
+func updatePublishes(ctx context.Context, publisher PortPublisher, containerID string, rec services.ReconcileResult) error {
+	var errs []error
+	add := func(ep services.ServiceEndpoint) {
+		if err := publisher.UpdatePublishAdd(ctx, containerID, endpointPortMapping(ep)); err != nil {
+			errs = append(errs, fmt.Errorf("add %s: %w", ep.Name, err))
+		}
+	}
+	remove := func(ep services.ServiceEndpoint) {
+		if err := publisher.UpdatePublishRemove(ctx, containerID, endpointPortMapping(ep)); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s: %w", ep.Name, err))
+		}
+	}
+	for _, ep := range rec.Added {
+		add(ep)
+	}
+	for _, ch := range rec.GuestPortChanged {
+		add(ch.New)
+		remove(ch.Old)
+	}
+	for _, ep := range rec.Removed {
+		remove(ep)
+	}
+	return errors.Join(errs...)
+}
+
+// recreateContainer replaces inst's container with one publishing endpoints,
+// keeping the environment and restart policy it was created with, and
+// starts it again if it was running. If the old container is gone but the
+// new one cannot be created, the app is left without a container so a
+// later install replaces it.
+func (m *AppManager) recreateContainer(ctx context.Context, state *FilesystemStateManager, inst *AppInstance, appDef *api.AppDefinition, endpoints []services.ServiceEndpoint) error {
+	spec, err := m.appDefToContainerSpec(appDef, endpoints)
+	if err != nil {
+		return fmt.Errorf("container spec: %w", err)
+	}
+	spec.Environment = inst.Environment
+	if current, err := state.GetAppDefinition(inst.Name); err == nil {
+		spec.RestartPolicy = restartPolicyFor(current)
+	}
+
+	st, err := m.containerManager.Inspect(ctx, inst.ContainerID)
+	wasRunning := err == nil && st.Running
+	if wasRunning {
+		if err := m.stopContainer(ctx, inst.ContainerID); err != nil {
+			return fmt.Errorf("stop container: %w", err)
+		}
+	}
+	if err := m.containerManager.RemoveContainer(ctx, inst.ContainerID); err != nil {
+		return fmt.Errorf("remove container: %w", err)
+	}
+	id, err := m.createContainer(ctx, spec)
+	if err != nil {
+		inst.ContainerID = ""
+		if uerr := state.updateMetadata(inst.Name, func(app *AppInstance) { app.ContainerID = "" }); uerr != nil {
+			log.Printf("WARN: app %s: clearing removed container: %v", inst.Name, uerr)
+		}
+		m.recordFailure(ctx, state, inst.Name, "", "error", fmt.Errorf("recreate container: %w", err))
+		return fmt.Errorf("create container: %w", err)
+	}
+	inst.ContainerID = id
+	if err := state.updateMetadata(inst.Name, func(app *AppInstance) { app.ContainerID = id }); err != nil {
+		log.Printf("WARN: app %s: recording new container: %v", inst.Name, err)
+	}
+	m.serviceManager.SetAppContainerID(inst.Name, id)
+	if wasRunning {
+		if err := m.startContainer(ctx, id); err != nil {
+			m.recordFailure(ctx, state, inst.Name, id, "error", err)
+			return fmt.Errorf("start container: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifyPublishedPorts checks that the container publishes exactly the host
+// binds of endpoints. It returns what the container publishes, or nil when
+// the runtime cannot report it.
+func (m *AppManager) verifyPublishedPorts(ctx context.Context, containerID string, endpoints []services.ServiceEndpoint) (map[int]int, error) {
+	inspector, ok := m.containerManager.(PortInspector)
+	if !ok {
+		return nil, nil
+	}
+	published, err := inspector.PublishedPorts(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect published ports: %w", err)
+	}
+	want := make(map[int]int, len(endpoints))
+	for _, ep := range endpoints {
+		want[ep.GuestPort] = ep.HostBind
+	}
+	if !maps.Equal(published, want) {
+		return published, fmt.Errorf("%w: want %v, container publishes %v", ErrPortMismatch, want, published)
+	}
+	return published, nil
+}
+
+// rollbackReconcile points the app's services back at its stored listeners,
+// bound to the host ports the container really publishes. Without a
+// report from the runtime the endpoints from before the reconcile are used.
+func (m *AppManager) rollbackReconcile(state *FilesystemStateManager, inst *AppInstance, previous []services.ServiceEndpoint, published map[int]int) {
+	current, err := state.GetAppDefinition(inst.Name)
+	if err != nil {
+		log.Printf("WARN: app %s: rollback services: %v", inst.Name, err)
+		return
+	}
+	if published == nil {
+		published = make(map[int]int, len(previous))
+		for _, ep := range previous {
+			published[ep.GuestPort] = ep.HostBind
+		}
+	}
+	if _, err := m.serviceManager.RestoreFromPodman(inst.Name, current.Listeners, published); err != nil {
+		log.Printf("WARN: app %s: rollback services: %v", inst.Name, err)
+	}
+	if inst.ContainerID != "" {
+		m.serviceManager.SetAppContainerID(inst.Name, inst.ContainerID)
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"piccolod/internal/api"
+)
+
+func newPublishTestManager(t *testing.T) (*AppManager, *MockContainerManager) {
+	t.Helper()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	mock := NewMockContainerManager()
+	manager, err := NewAppManager(mock, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewAppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+	return manager, mock
+}
+
+func publishTestDef(listeners ...api.AppListener) *api.AppDefinition {
+	return &api.AppDefinition{
+		Name:        "blog",
+		Image:       "nginx:alpine",
+		Type:        "user",
+		Environment: map[string]string{"MODE": "prod"},
+		Listeners:   listeners,
+	}
+}
+
+var (
+	webListener   = api.AppListener{Name: "web", GuestPort: 80}
+	adminListener = api.AppListener{Name: "admin", GuestPort: 8080}
+)
+
+func installRunningBlog(t *testing.T, manager *AppManager) *AppInstance {
+	t.Helper()
+	ctx := context.Background()
+	inst, err := manager.Install(ctx, publishTestDef(webListener))
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(ctx, inst.Name); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return inst
+}
+
+func TestUpsert_UpdatesPublishedPortsInPlace(t *testing.T) {
+	manager, mock := newPublishTestManager(t)
+	mock.publishUpdate = true
+	inst := installRunningBlog(t, manager)
+	oldID := inst.ContainerID
+
+	got, err := manager.Upsert(context.Background(), publishTestDef(webListener, adminListener))
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if got.PortUpdate != PortUpdateInPlace || got.ContainerID != oldID {
+		t.Fatalf("expected in-place update of %s, got %s on %s", oldID, got.PortUpdate, got.ContainerID)
+	}
+	if ports := mock.containers[oldID].Spec.Ports; len(ports) != 2 {
+		t.Fatalf("expected two published ports, got %+v", ports)
+	}
+}
+
+func TestUpsert_RecreatesWhenPublishUpdateFails(t *testing.T) {
+	manager, mock := newPublishTestManager(t)
+	mock.publishUpdate = true
+	mock.publishError = errors.New("unknown flag: --publish-add")
+	inst := installRunningBlog(t, manager)
+	oldID := inst.ContainerID
+
+	def := publishTestDef(webListener, adminListener)
+	def.Environment = map[string]string{"MODE": "dev"}
+	got, err := manager.Upsert(context.Background(), def)
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if got.PortUpdate != PortUpdateRecreate {
+		t.Fatalf("expected recreate, got %q", got.PortUpdate)
+	}
+	if got.ContainerID == oldID {
+		t.Fatalf("expected a new container")
+	}
+	if _, ok := mock.containers[oldID]; ok {
+		t.Fatalf("old container should be removed")
+	}
+	c := mock.containers[got.ContainerID]
+	if c == nil || c.Status != "running" {
+		t.Fatalf("recreated container should be running, got %+v", c)
+	}
+	if len(c.Spec.Ports) != 2 {
+		t.Fatalf("expected both listeners published, got %+v", c.Spec.Ports)
+	}
+	if c.Spec.Environment["MODE"] != "prod" {
+		t.Fatalf("recreate should keep the container environment, got %v", c.Spec.Environment)
+	}
+
+	stored, err := manager.Get(context.Background(), "blog")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.ContainerID != got.ContainerID || stored.PortUpdate != "" {
+		t.Fatalf("unexpected stored app %+v", stored)
+	}
+	if id, _ := manager.serviceManager.GetAppContainerID("blog"); id != got.ContainerID {
+		t.Fatalf("services track container %s, want %s", id, got.ContainerID)
+	}
+}
+
+func TestUpsert_RollsBackOnPublishedPortMismatch(t *testing.T) {
+	manager, mock := newPublishTestManager(t)
+	mock.publishUpdate = true
+	inst := installRunningBlog(t, manager)
+	web, ok := manager.serviceManager.GetAppListener("blog", "web")
+	if !ok {
+		t.Fatalf("web listener not registered")
+	}
+	// The runtime claims success but keeps publishing only the old port.
+	mock.published = map[string]map[int]int{inst.ContainerID: {80: web.HostBind}}
+
+	_, err := manager.Upsert(context.Background(), publishTestDef(webListener, adminListener))
+	if !errors.Is(err, ErrPortMismatch) {
+		t.Fatalf("expected ErrPortMismatch, got %v", err)
+	}
+	if _, ok := manager.serviceManager.GetAppListener("blog", "admin"); ok {
+		t.Fatalf("admin listener should be rolled back")
+	}
+	if ep, ok := manager.serviceManager.GetAppListener("blog", "web"); !ok || ep.HostBind != web.HostBind {
+		t.Fatalf("web listener should keep host port %d, got %+v", web.HostBind, ep)
+	}
+	state, err := manager.ensureStateManager()
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	stored, err := state.GetAppDefinition("blog")
+	if err != nil {
+		t.Fatalf("stored definition: %v", err)
+	}
+	if len(stored.Listeners) != 1 {
+		t.Fatalf("stored definition should be unchanged, got %+v", stored.Listeners)
+	}
+}
@@ -0,0 +1,480 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+	"piccolod/internal/services"
+)
+
+// How Recreate and UpdateEnvironment replaced an app's container, reported
+// in ReplaceResult.Mode. A rolling replace starts the new container next to
+// the old one and moves traffic over once it is healthy; a restart stops
+// the old container first.
+const (
+	ReplaceRolling   = "rolling"
+	ReplaceRestart   = "restart"
+	ReplaceUnchanged = "unchanged"
+)
+
+// ErrReplacementUnhealthy is returned when a replacement container does not
+// pass its readiness check. The old container keeps serving.
+var ErrReplacementUnhealthy = errors.New("app manager: replacement container is not healthy")
+
+// ReplaceResult reports how an app's container was replaced.
+type ReplaceResult struct {
+	App         string `json:"app"`
+	Mode        string `json:"mode"`
+	ContainerID string `json:"container_id,omitempty"`
+	// Drained is false when connections to the old container were still
+	// open at the drain timeout; they were cut when it was removed.
+	Drained bool  `json:"drained"`
+	DrainMS int64 `json:"drain_ms"`
+}
+
+// ReplaceTimeouts bounds a rolling replace. Zero fields fall back to
+// DefaultReplaceTimeouts.
+type ReplaceTimeouts struct {
+	// Ready is how long the replacement has to pass its readiness check.
+	Ready time.Duration
+	// Drain is how long connections to the old container may take to
+	// finish once traffic has moved.
+	Drain time.Duration
+}
+
+// DefaultReplaceTimeouts leave room for slow-starting apps and long
+// downloads.
+var DefaultReplaceTimeouts = ReplaceTimeouts{
+	Ready: 2 * time.Minute,
+	Drain: 30 * time.Second,
+}
+
+// ContainerRenamer is implemented by container managers that can rename a
+// container, so a replacement created under a temporary name takes the
+// app's name once the old container is gone.
+type ContainerRenamer interface {
+	RenameContainer(ctx context.Context, containerID, name string) error
+}
+
+// ReadinessTarget is what a readiness probe checks: the loopback port
+// publishing a guest port of the replacement, and the HTTP path of the app's
+// health check, empty for a plain TCP check.
+type ReadinessTarget struct {
+	HostPort int
+	Path     string
+	HTTPS    bool
+	Timeout  time.Duration
+}
+
+// readinessProbe checks a target once.
+type readinessProbe func(ctx context.Context, target ReadinessTarget) error
+
+const (
+	readinessInterval = 500 * time.Millisecond
+	readinessTimeout  = 5 * time.Second
+	drainInterval     = 50 * time.Millisecond
+)
+
+// SetReplaceTimeouts overrides the rolling replace budgets.
+func (m *AppManager) SetReplaceTimeouts(t ReplaceTimeouts) {
+	m.opMu.Lock()
+	m.replaceTimeouts = t
+	m.opMu.Unlock()
+}
+
+// ReplaceTimeouts returns the effective rolling replace budgets.
+func (m *AppManager) ReplaceTimeouts() ReplaceTimeouts {
+	m.opMu.Lock()
+	t := m.replaceTimeouts
+	m.opMu.Unlock()
+	if t.Ready <= 0 {
+		t.Ready = DefaultReplaceTimeouts.Ready
+	}
+	if t.Drain <= 0 {
+		t.Drain = DefaultReplaceTimeouts.Drain
+	}
+	return t
+}
+
+// SetReadinessProbe replaces the check a replacement container must pass
+// before it takes traffic; nil restores the default HTTP or TCP check.
+func (m *AppManager) SetReadinessProbe(probe func(ctx context.Context, target ReadinessTarget) error) {
+	m.opMu.Lock()
+	m.readinessProbe = probe
+	m.opMu.Unlock()
+}
+
+// Recreate replaces an app's container with a fresh one from its stored
+// definition, without dropping traffic when it can.
+func (m *AppManager) Recreate(ctx context.Context, name string) (*ReplaceResult, error) {
+	return m.replaceApp(ctx, name, "recreate", nil, nil)
+}
+
+// UpdateEnvironment sets and unsets environment variables of an app and
+// replaces its container to apply them. The stored definition only changes
+// once the new container is up.
+func (m *AppManager) UpdateEnvironment(ctx context.Context, name string, set map[string]string, unset []string) (*ReplaceResult, error) {
+	if len(set) == 0 && len(unset) == 0 {
+		return nil, fmt.Errorf("invalid environment update: nothing to change")
+	}
+	for _, key := range unset {
+		if _, ok := set[key]; ok {
+			return nil, fmt.Errorf("invalid environment update: %s is both set and unset", key)
+		}
+	}
+	return m.replaceApp(ctx, name, "update environment", set, unset)
+}
+
+func (m *AppManager) replaceApp(ctx context.Context, name, op string, set map[string]string, unset []string) (*ReplaceResult, error) {
+	if err := m.ensureUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := m.ensureKernelLeader(); err != nil {
+		return nil, err
+	}
+	release, err := m.lockApp(ctx, name, op)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	inst, exists := state.GetApp(name)
+	if !exists {
+		return nil, fmt.Errorf("app not found: %s", name)
+	}
+	if inst.ContainerID == "" {
+		return nil, fmt.Errorf("app %s has no container; reinstall it: %s", name, inst.LastError)
+	}
+	if inst.Status == AppStatusPaused {
+		return nil, fmt.Errorf("%w: unpause %s before replacing its container", ErrAppPaused, name)
+	}
+	stored, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+	next := *stored
+	next.Environment = maps.Clone(stored.Environment)
+	if next.Environment == nil {
+		next.Environment = make(map[string]string)
+	}
+	maps.Copy(next.Environment, set)
+	for _, key := range unset {
+		delete(next.Environment, key)
+	}
+	if len(next.Environment) == 0 {
+		next.Environment = nil
+	}
+	if op != "recreate" {
+		if maps.Equal(next.Environment, stored.Environment) {
+			return &ReplaceResult{App: name, Mode: ReplaceUnchanged, ContainerID: inst.ContainerID, Drained: true}, nil
+		}
+		if err := ValidateAppDefinition(&next); err != nil {
+			return nil, fmt.Errorf("invalid app definition: %w", err)
+		}
+	}
+
+	working := *inst
+	working.Environment = next.Environment
+	result, err := m.replaceContainer(ctx, state, &working, &next)
+	if err != nil {
+		return nil, err
+	}
+	// Follow the new container; the old one's collector drains.
+	defer m.syncLogCapture(name)
+	if op == "recreate" {
+		return result, nil
+	}
+	if err := m.commitState(func() error { return state.StoreApp(&working, &next) }); err != nil {
+		return nil, fmt.Errorf("failed to store app: %w", err)
+	}
+	if diff := diffDefinitions(stored, &next, nil); diff.Changed {
+		change := DefinitionChange{At: time.Now().UTC(), Summary: diff.Summary}
+		if err := state.RecordDefinitionChange(name, change, maxDefinitionChanges); err != nil {
+			log.Printf("WARN: record app.yaml change for %s: %v", name, err)
+		}
+	}
+	return result, nil
+}
+
+// replaceContainer swaps inst's container for one built from appDef with
+// inst's environment. A running app whose listeners can be retargeted gets
+// a rolling replace; anything else is recreated in place.
+func (m *AppManager) replaceContainer(ctx context.Context, state *FilesystemStateManager, inst *AppInstance, appDef *api.AppDefinition) (*ReplaceResult, error) {
+	result := &ReplaceResult{App: inst.Name, Mode: ReplaceRestart, Drained: true}
+	var endpoints []services.ServiceEndpoint
+	if m.serviceManager != nil {
+		endpoints, _ = m.serviceManager.GetByApp(inst.Name)
+	}
+	spec, err := m.appDefToContainerSpec(appDef, endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("container spec: %w", err)
+	}
+	if !canRollingReplace(inst, spec, endpoints) {
+		if err := m.recreateContainer(ctx, state, inst, appDef, endpoints); err != nil {
+			return nil, err
+		}
+		result.ContainerID = inst.ContainerID
+		m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s container recreated", inst.Name), map[string]any{"app": inst.Name, "mode": result.Mode})
+		return result, nil
+	}
+	if err := m.rollingReplace(ctx, state, inst, appDef, endpoints, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// canRollingReplace reports whether two containers of the app can run side
+// by side with the proxies moving between them: the app must be running,
+// publish its listeners on host binds and only use TCP, which the proxies
+// can retarget without rebinding.
+func canRollingReplace(inst *AppInstance, spec container.ContainerCreateSpec, endpoints []services.ServiceEndpoint) bool {
+	if inst.Status != "running" || len(endpoints) == 0 || spec.NetworkMode == "host" {
+		return false
+	}
+	for _, ep := range endpoints {
+		if ep.Protocol == api.ListenerProtocolUDP {
+			return false
+		}
+	}
+	return true
+}
+
+// rollingReplace starts the replacement on fresh host binds, waits for it to
+// pass its readiness check, points the proxies at it and retires the old
+// container once its connections have drained. Until the switch the old
+// container is untouched, so any failure leaves it serving.
+func (m *AppManager) rollingReplace(ctx context.Context, state *FilesystemStateManager, inst *AppInstance, appDef *api.AppDefinition, endpoints []services.ServiceEndpoint, result *ReplaceResult) error {
+	binds, err := m.serviceManager.ReserveReplacementBinds(inst.Name)
+	if err != nil {
+		return fmt.Errorf("reserve host ports: %w", err)
+	}
+	releaseBinds := func() { m.serviceManager.ReleaseHostBinds(slices.Collect(maps.Values(binds))) }
+	next := make([]services.ServiceEndpoint, len(endpoints))
+	for i, ep := range endpoints {
+		ep.HostBind = binds[ep.GuestPort]
+		next[i] = ep
+	}
+	spec, err := m.appDefToContainerSpec(appDef, next)
+	if err != nil {
+		releaseBinds()
+		return fmt.Errorf("container spec: %w", err)
+	}
+	spec.Environment = inst.Environment
+	spec.Name = replacementName(inst.Name)
+
+	id, err := m.createContainer(ctx, spec)
+	if err != nil {
+		releaseBinds()
+		return fmt.Errorf("create replacement container: %w", err)
+	}
+	discard := func(cause error) error {
+		// The replacement never carried traffic; drop it on a context the
+		// caller's cancellation cannot cut short.
+		cctx := context.WithoutCancel(ctx)
+		if err := m.stopContainer(cctx, id); err != nil {
+			log.Printf("WARN: app %s: stop replacement container: %v", inst.Name, err)
+		}
+		if err := m.containerManager.RemoveContainer(cctx, id); err != nil {
+			log.Printf("WARN: app %s: remove replacement container: %v", inst.Name, err)
+		}
+		releaseBinds()
+		return cause
+	}
+	if err := m.startContainer(ctx, id); err != nil {
+		return discard(fmt.Errorf("start replacement container: %w", err))
+	}
+	if err := m.awaitReady(ctx, appDef, next); err != nil {
+		m.recordActivity(ctx, activity.LevelWarn, fmt.Sprintf("App %s kept its container: replacement not healthy", inst.Name), map[string]any{"app": inst.Name, "error": err.Error()})
+		return discard(fmt.Errorf("%w: %v", ErrReplacementUnhealthy, err))
+	}
+
+	previous, err := m.serviceManager.RetargetApp(inst.Name, binds)
+	if err != nil {
+		return discard(fmt.Errorf("retarget services: %w", err))
+	}
+	oldID := inst.ContainerID
+	inst.ContainerID = id
+	if err := state.updateMetadata(inst.Name, func(app *AppInstance) { app.ContainerID = id }); err != nil {
+		log.Printf("WARN: app %s: recording new container: %v", inst.Name, err)
+	}
+	m.serviceManager.SetAppContainerID(inst.Name, id)
+	result.Mode = ReplaceRolling
+	result.ContainerID = id
+
+	started := time.Now()
+	result.Drained = m.drainBackends(ctx, previous)
+	result.DrainMS = time.Since(started).Milliseconds()
+
+	cctx := context.WithoutCancel(ctx)
+	stopErr := m.stopContainer(cctx, oldID)
+	if stopErr != nil {
+		log.Printf("WARN: app %s: stop old container: %v", inst.Name, stopErr)
+	}
+	removeErr := m.containerManager.RemoveContainer(cctx, oldID)
+	if removeErr != nil {
+		log.Printf("WARN: app %s: remove old container: %v", inst.Name, removeErr)
+	}
+	// The old ports are only free once the old container let go of them.
+	if stopErr == nil || removeErr == nil {
+		m.serviceManager.ReleaseHostBinds(previous)
+	}
+	if renamer, ok := m.containerManager.(ContainerRenamer); ok && removeErr == nil {
+		if err := renamer.RenameContainer(cctx, id, inst.Name); err != nil {
+			log.Printf("WARN: app %s: rename replacement container: %v", inst.Name, err)
+		}
+	}
+	metadata := map[string]any{"app": inst.Name, "mode": result.Mode, "drained": result.Drained}
+	m.recordActivity(ctx, activity.LevelInfo, fmt.Sprintf("App %s container replaced without downtime", inst.Name), metadata)
+	return nil
+}
+
+// replacementName is the temporary name of a replacement container. It must
+// differ from the running container's, which creating with --replace would
+// otherwise remove.
+func replacementName(app string) string {
+	return app + "-next-" + strconv.FormatInt(time.Now().UnixMilli(), 36)
+}
+
+// readinessTargets lists what the replacement must answer before it takes
+// traffic: the app's HTTP health check when it is routed through a
+// listener, otherwise a TCP check of every listener.
+func readinessTargets(appDef *api.AppDefinition, endpoints []services.ServiceEndpoint) []ReadinessTarget {
+	if hc := appDef.HealthCheck; hc != nil && hc.HTTP != nil {
+		timeout := readinessTimeout
+		if d, err := time.ParseDuration(hc.HTTP.Timeout); err == nil && d > 0 {
+			timeout = d
+		}
+		for _, ep := range endpoints {
+			if hc.HTTP.Port == ep.Name || hc.HTTP.Port == strconv.Itoa(ep.GuestPort) {
+				path := hc.HTTP.Path
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+				return []ReadinessTarget{{HostPort: ep.HostBind, Path: path, HTTPS: ep.Protocol == api.ListenerProtocolHTTPS, Timeout: timeout}}
+			}
+		}
+	}
+	targets := make([]ReadinessTarget, 0, len(endpoints))
+	for _, ep := range endpoints {
+		targets = append(targets, ReadinessTarget{HostPort: ep.HostBind, Timeout: readinessTimeout})
+	}
+	return targets
+}
+
+// awaitReady polls the replacement's readiness targets until all pass or
+// the ready budget runs out.
+func (m *AppManager) awaitReady(ctx context.Context, appDef *api.AppDefinition, endpoints []services.ServiceEndpoint) error {
+	m.opMu.Lock()
+	probe := m.readinessProbe
+	m.opMu.Unlock()
+	if probe == nil {
+		probe = probeReadiness
+	}
+	budget := m.ReplaceTimeouts().Ready
+	rctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	targets := readinessTargets(appDef, endpoints)
+	for {
+		var err error
+		for _, target := range targets {
+			if err = probe(rctx, target); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		timer := time.NewTimer(readinessInterval)
+		select {
+		case <-rctx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("not ready after %s: %w", budget, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// probeReadiness is the readinessProbe used outside tests. A TCP target
+// must accept and hold the connection: a port forwarder accepting for a
+// process that is not listening yet closes it at once.
+func probeReadiness(ctx context.Context, target ReadinessTarget) error {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(target.HostPort))
+	if target.Path == "" {
+		dialer := net.Dialer{Timeout: target.Timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		var buf [1]byte
+		if _, err := conn.Read(buf[:]); err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil
+			}
+			return fmt.Errorf("%s closed the connection: %w", addr, err)
+		}
+		return nil
+	}
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if target.HTTPS {
+		scheme = "https"
+		// Loopback backends are accepted as is, as the proxy does.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: target.Timeout}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+addr+target.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check %s returned %d", target.Path, resp.StatusCode)
+	}
+	return nil
+}
+
+// drainBackends waits for the proxies to finish the connections they hold
+// to the old host binds. It reports whether they all finished in time.
+func (m *AppManager) drainBackends(ctx context.Context, ports []int) bool {
+	deadline := time.Now().Add(m.ReplaceTimeouts().Drain)
+	for m.serviceManager.ActiveBackendConnections(ports) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		timer := time.NewTimer(drainInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+	return true
+}
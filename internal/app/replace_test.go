@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+// serveEcho stands in for a container answering on a host bind.
+func serveEcho(t *testing.T, port int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("listen on %d: %v", port, err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					if _, err := c.Write(line); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+}
+
+func echoThrough(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != msg {
+		t.Fatalf("echo %q: got %q (%v)", msg, got, err)
+	}
+}
+
+func installRunning(t *testing.T, manager *AppManager, def *api.AppDefinition) *AppInstance {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := manager.Install(ctx, def); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(ctx, def.Name); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	inst, _ := manager.Get(ctx, def.Name)
+	return inst
+}
+
+func TestAppManager_UpdateEnvironmentRollsOverWithoutDowntime(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	ctx := context.Background()
+	def := &api.AppDefinition{
+		Name:        "wiki",
+		Image:       "docker.io/requarks/wiki:2",
+		Type:        "user",
+		Listeners:   []api.AppListener{{Name: "web", GuestPort: 3000, Protocol: api.ListenerProtocolRaw}},
+		Environment: map[string]string{"DB_HOST": "db", "DEBUG": "1"},
+	}
+	inst := installRunning(t, manager, def)
+	before, _ := manager.serviceManager.GetByApp("wiki")
+	serveEcho(t, before[0].HostBind)
+	manager.SetReplaceTimeouts(ReplaceTimeouts{Ready: time.Second, Drain: 200 * time.Millisecond})
+	var probed []ReadinessTarget
+	manager.SetReadinessProbe(func(ctx context.Context, target ReadinessTarget) error {
+		probed = append(probed, target)
+		serveEcho(t, target.HostPort)
+		return nil
+	})
+
+	// A client connected before the switch stays on the old container.
+	held, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(before[0].PublicPort)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer held.Close()
+	echoThrough(t, held, "before\n")
+
+	result, err := manager.UpdateEnvironment(ctx, "wiki", map[string]string{"DB_HOST": "db2"}, []string{"DEBUG"})
+	if err != nil {
+		t.Fatalf("update environment: %v", err)
+	}
+	if result.Mode != ReplaceRolling || result.Drained || result.ContainerID == inst.ContainerID {
+		t.Fatalf("expected a rolling replace cut short by the held connection, got %+v", result)
+	}
+	after, _ := manager.serviceManager.GetByApp("wiki")
+	if len(probed) != 1 || probed[0].Path != "" || probed[0].HostPort != after[0].HostBind {
+		t.Fatalf("expected one TCP readiness check of the new host bind, got %+v", probed)
+	}
+	if after[0].PublicPort != before[0].PublicPort || after[0].HostBind == before[0].HostBind {
+		t.Fatalf("expected the listener retargeted on its public port: %+v -> %+v", before, after)
+	}
+	if _, ok := mock.containers[inst.ContainerID]; ok || len(mock.containers) != 1 {
+		t.Fatalf("expected only the replacement left, got %d containers", len(mock.containers))
+	}
+	replacement := mock.containers[result.ContainerID]
+	if replacement.Status != "running" || replacement.Spec.Name != "wiki" || replacement.Spec.Environment["DB_HOST"] != "db2" || replacement.Spec.Environment["DEBUG"] != "" {
+		t.Fatalf("unexpected replacement %+v", replacement)
+	}
+	if replacement.Spec.Ports[0].Host != after[0].HostBind {
+		t.Fatalf("replacement publishes %+v, proxy targets %d", replacement.Spec.Ports, after[0].HostBind)
+	}
+	got, _ := manager.Get(ctx, "wiki")
+	stored, _ := manager.stateManager.GetAppDefinition("wiki")
+	if got.ContainerID != result.ContainerID || got.Status != "running" || stored.Environment["DB_HOST"] != "db2" || len(stored.Environment) != 1 {
+		t.Fatalf("state not updated: %+v %+v", got, stored.Environment)
+	}
+	if len(got.Changes) != 1 {
+		t.Fatalf("expected the change recorded, got %+v", got.Changes)
+	}
+
+	// New connections reach the replacement; the held one is still counted.
+	fresh, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(before[0].PublicPort)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	echoThrough(t, fresh, "after\n")
+	_ = fresh.Close()
+	echoThrough(t, held, "still here\n")
+	if st := manager.serviceManager.EndpointStats("wiki", "web"); st.TotalConnections != 2 || st.ActiveConnections > 1 {
+		t.Fatalf("unexpected stats after the switch: %+v", st)
+	}
+	_ = held.Close()
+
+	// Nothing left to drain the second time round.
+	again, err := manager.Recreate(ctx, "wiki")
+	if err != nil || again.Mode != ReplaceRolling || !again.Drained {
+		t.Fatalf("recreate: %+v (%v)", again, err)
+	}
+	if unchanged, err := manager.UpdateEnvironment(ctx, "wiki", map[string]string{"DB_HOST": "db2"}, nil); err != nil || unchanged.Mode != ReplaceUnchanged {
+		t.Fatalf("expected a no-op update, got %+v (%v)", unchanged, err)
+	}
+}
+
+func TestAppManager_UnhealthyReplacementKeepsOldContainer(t *testing.T) {
+	manager, mock := newMockAppManager(t)
+	ctx := context.Background()
+	def := &api.AppDefinition{
+		Name:        "blog",
+		Image:       "docker.io/library/ghost:5",
+		Type:        "user",
+		Listeners:   []api.AppListener{{Name: "web", GuestPort: 2368}},
+		Environment: map[string]string{"URL": "http://blog.local"},
+		HealthCheck: &api.AppHealthCheck{HTTP: &api.AppHTTPHealthCheck{Path: "ghost/api/health", Port: "web", Timeout: "2s"}},
+	}
+	inst := installRunning(t, manager, def)
+	before, _ := manager.serviceManager.GetByApp("blog")
+	manager.SetReplaceTimeouts(ReplaceTimeouts{Ready: 100 * time.Millisecond})
+	var mu sync.Mutex
+	var probed []ReadinessTarget
+	manager.SetReadinessProbe(func(ctx context.Context, target ReadinessTarget) error {
+		mu.Lock()
+		probed = append(probed, target)
+		mu.Unlock()
+		return errors.New("503 Service Unavailable")
+	})
+
+	_, err := manager.UpdateEnvironment(ctx, "blog", map[string]string{"URL": "https://blog.example.com"}, nil)
+	if !errors.Is(err, ErrReplacementUnhealthy) {
+		t.Fatalf("expected ErrReplacementUnhealthy, got %v", err)
+	}
+	if len(probed) == 0 || probed[0].Path != "/ghost/api/health" || probed[0].Timeout != 2*time.Second || probed[0].HostPort == before[0].HostBind {
+		t.Fatalf("expected the health check probed on the replacement, got %+v", probed)
+	}
+	if len(mock.containers) != 1 || mock.containers[inst.ContainerID].Status != "running" {
+		t.Fatalf("expected the old container alone and running, got %d containers", len(mock.containers))
+	}
+	after, _ := manager.serviceManager.GetByApp("blog")
+	got, _ := manager.Get(ctx, "blog")
+	stored, _ := manager.stateManager.GetAppDefinition("blog")
+	if after[0].HostBind != before[0].HostBind || got.ContainerID != inst.ContainerID || stored.Environment["URL"] != "http://blog.local" {
+		t.Fatalf("failed replace changed the app: %+v %+v %+v", after, got, stored.Environment)
+	}
+
+	// A stopped app has no traffic to keep and is recreated in place.
+	if err := manager.Stop(ctx, "blog"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	result, err := manager.UpdateEnvironment(ctx, "blog", map[string]string{"URL": "https://blog.example.com"}, nil)
+	if err != nil || result.Mode != ReplaceRestart {
+		t.Fatalf("expected a restart-mode replace, got %+v (%v)", result, err)
+	}
+	if c := mock.containers[result.ContainerID]; c == nil || c.Status != "created" || c.Spec.Environment["URL"] != "https://blog.example.com" {
+		t.Fatalf("unexpected recreated container %+v", c)
+	}
+	if _, err := manager.UpdateEnvironment(ctx, "blog", map[string]string{"URL": "x"}, []string{"URL"}); err == nil {
+		t.Fatalf("expected a key both set and unset to be refused")
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"piccolod/internal/container"
+)
+
+// RuntimeStatus is what the last pings of the container runtime found.
+type RuntimeStatus struct {
+	container.RuntimeInfo
+	Reachable bool `json:"reachable"`
+	// LastPing is when the runtime was last checked; nil before the first
+	// check.
+	LastPing    *time.Time `json:"last_ping,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Failures counts pings in a row that did not reach the runtime.
+	Failures int `json:"consecutive_failures"`
+}
+
+// PingRuntime checks the container runtime and records the outcome. The
+// version details of the last successful ping are kept while it is down.
+func (m *AppManager) PingRuntime(ctx context.Context) RuntimeStatus {
+	info, err := m.containerManager.Ping(ctx)
+	now := time.Now().UTC()
+	m.runtimeMu.Lock()
+	defer m.runtimeMu.Unlock()
+	st := &m.runtimeStatus
+	st.LastPing = &now
+	if err != nil {
+		st.Reachable = false
+		st.LastError = err.Error()
+		st.Failures++
+		return *st
+	}
+	st.RuntimeInfo = info
+	st.Reachable = true
+	st.LastSuccess = &now
+	st.LastError = ""
+	st.Failures = 0
+	return *st
+}
+
+// RuntimeStatus returns the outcome of the last PingRuntime.
+func (m *AppManager) RuntimeStatus() RuntimeStatus {
+	m.runtimeMu.Lock()
+	defer m.runtimeMu.Unlock()
+	return m.runtimeStatus
+}
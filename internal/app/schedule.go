@@ -0,0 +1,174 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute, hour, day of
+// month, month, day of week). Each field is a bit set of allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Day matching follows Vixie cron: when both day fields are restricted,
+	// a day matches if either does.
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCronSchedule parses a five-field cron expression or one of the
+// @hourly/@daily/@weekly/@monthly/@yearly aliases. Fields accept *, numbers,
+// ranges (a-b), lists (a,b) and steps (*/n, a-b/n); day of week 7 is Sunday.
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q must have 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	s := &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s step %q must be a positive number", f.name, stepStr)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s range %q is reversed", f.name, rng)
+			}
+		default:
+			v, err := cronValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func cronValue(s string, f cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %q must be a number between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// matches reports whether the schedule fires in the minute containing t.
+func (s *cronSchedule) matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 && s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 && s.matchesDay(t)
+}
+
+// cronSearchLimit bounds next; a schedule such as "0 0 31 2 *" never fires.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// next returns the first minute after t the schedule fires, or the zero
+// time when it never does.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	cur := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+	limit := cur.Add(cronSearchLimit)
+	for cur.Before(limit) {
+		switch {
+		case s.month&(1<<uint(cur.Month())) == 0:
+			cur = time.Date(cur.Year(), cur.Month()+1, 1, 0, 0, 0, 0, cur.Location())
+		case !s.matchesDay(cur):
+			cur = time.Date(cur.Year(), cur.Month(), cur.Day()+1, 0, 0, 0, 0, cur.Location())
+		case s.hour&(1<<uint(cur.Hour())) == 0:
+			cur = time.Date(cur.Year(), cur.Month(), cur.Day(), cur.Hour()+1, 0, 0, 0, cur.Location())
+		case s.minute&(1<<uint(cur.Minute())) == 0:
+			cur = cur.Add(time.Minute)
+		default:
+			return cur
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dowOK
+	case s.dowAny:
+		return domOK
+	default:
+		return domOK || dowOK
+	}
+}
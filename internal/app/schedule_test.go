@@ -0,0 +1,68 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		"* * * *":       "must have 5 fields",
+		"60 * * * *":    "minute \"60\"",
+		"* 24 * * *":    "hour \"24\"",
+		"* * 0 * *":     "day of month \"0\"",
+		"* * * 13 *":    "month \"13\"",
+		"* * * * 8":     "day of week \"8\"",
+		"*/0 * * * *":   "step \"0\"",
+		"30-10 * * * *": "is reversed",
+		"@every 5m":     "must have 5 fields",
+	} {
+		if _, err := parseCronSchedule(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// Thursday 2026-01-01 10:07.
+	from := time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"5,50 9-11 * * *", time.Date(2026, 1, 1, 10, 50, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 15th or any Monday.
+		{"0 0 15 * 1", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// Day of week alone restricts; "*/1" still counts as unrestricted.
+		{"0 0 */1 * 1", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := parseCronSchedule(tc.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.expr, err)
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: next = %s, want %s", tc.expr, got, tc.want)
+		}
+		if !s.matches(tc.want) {
+			t.Errorf("%q: does not match its own next run %s", tc.expr, tc.want)
+		}
+	}
+
+	never, err := parseCronSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := never.next(from); !got.IsZero() {
+		t.Fatalf("impossible schedule fired at %s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"piccolod/internal/api"
+)
+
+// AppAPIVersion is the newest app.yaml schema this binary understands.
+const (
+	AppAPIVersion      = "piccolo/v1"
+	appAPIVersionMajor = 1
+)
+
+var apiVersionPattern = regexp.MustCompile(`^piccolo/v([1-9][0-9]*)$`)
+
+// UnsupportedVersionError is returned when an app.yaml declares a schema
+// newer than this binary supports.
+type UnsupportedVersionError struct {
+	Declared  string
+	Supported string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("app.yaml declares apiVersion %s but this Piccolo supports up to %s; update Piccolo to install this app", e.Declared, e.Supported)
+}
+
+// apiVersionMajor parses "piccolo/vN".
+func apiVersionMajor(version string) (int, error) {
+	m := apiVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return 0, fmt.Errorf("apiVersion %q is invalid; expected piccolo/v<N>", version)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// validateAPIVersion only checks the format: definitions already on disk
+// may come from a newer daemon and must still load after a rollback.
+func validateAPIVersion(version string) error {
+	_, err := apiVersionMajor(version)
+	return err
+}
+
+// CheckAPIVersion refuses definitions written for a newer schema. It runs
+// on install and update, where silently dropping fields would lose data.
+func CheckAPIVersion(def *api.AppDefinition) error {
+	version := def.APIVersion
+	if version == "" {
+		version = AppAPIVersion
+	}
+	major, err := apiVersionMajor(version)
+	if err != nil {
+		return err
+	}
+	if major > appAPIVersionMajor {
+		return &UnsupportedVersionError{Declared: version, Supported: AppAPIVersion}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+const testListeners = "listeners:\n  - name: web\n    guest_port: 80\n"
+
+func TestAPIVersionParsing(t *testing.T) {
+	cases := []struct {
+		name        string
+		yaml        string
+		wantVersion string
+		parseErr    bool
+		unsupported bool
+	}{
+		{name: "legacy", yaml: "name: blog\nimage: nginx:alpine\n" + testListeners, wantVersion: AppAPIVersion},
+		{name: "v1", yaml: "apiVersion: piccolo/v1\nname: blog\nimage: nginx:alpine\n" + testListeners, wantVersion: "piccolo/v1"},
+		{name: "newer", yaml: "apiVersion: piccolo/v2\nname: blog\nimage: nginx:alpine\n" + testListeners, wantVersion: "piccolo/v2", unsupported: true},
+		{name: "malformed", yaml: "apiVersion: v1\nname: blog\nimage: nginx:alpine\n" + testListeners, parseErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			def, err := ParseAppDefinition([]byte(tc.yaml))
+			if tc.parseErr {
+				if err == nil {
+					t.Fatalf("expected parse error")
+				}
+				return
+			}
+			// Newer files still parse so they load after an OS rollback.
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if def.APIVersion != tc.wantVersion {
+				t.Fatalf("apiVersion = %q, want %q", def.APIVersion, tc.wantVersion)
+			}
+			var verErr *UnsupportedVersionError
+			if got := errors.As(CheckAPIVersion(def), &verErr); got != tc.unsupported {
+				t.Fatalf("CheckAPIVersion unsupported = %v, want %v", got, tc.unsupported)
+			}
+		})
+	}
+}
+
+func TestUpsertPreservesUnknownFields(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "app_schema_roundtrip")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	manager, err := NewAppManager(NewMockContainerManager(), tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create AppManager: %v", err)
+	}
+	allowHostStorage(t, manager)
+	manager.ForceLockState(false)
+
+	const manifest = `name: blog
+image: nginx:alpine
+listeners:
+  - name: web
+    guest_port: 80
+    tls_passthrough: true
+future_field:
+  mode: strict
+  retries: 3
+`
+	ctx := context.Background()
+	for i := 0; i < 2; i++ { // install, then the update path rewrites app.yaml
+		def, err := ParseAppDefinition([]byte(manifest))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if _, err := manager.Upsert(ctx, def); err != nil {
+			t.Fatalf("upsert %d: %v", i, err)
+		}
+	}
+
+	state, err := manager.ensureStateManager()
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	stored, err := state.GetAppDefinition("blog")
+	if err != nil {
+		t.Fatalf("stored definition: %v", err)
+	}
+	future, ok := stored.Extra["future_field"].(map[string]interface{})
+	if !ok || future["mode"] != "strict" || future["retries"] != 3 {
+		t.Fatalf("future_field lost: %#v", stored.Extra)
+	}
+	if len(stored.Listeners) != 1 || stored.Listeners[0].Extra["tls_passthrough"] != true {
+		t.Fatalf("listener extra lost: %#v", stored.Listeners)
+	}
+	if stored.APIVersion != AppAPIVersion {
+		t.Fatalf("legacy file should be stored as %s, got %q", AppAPIVersion, stored.APIVersion)
+	}
+
+	def, _ := ParseAppDefinition([]byte("apiVersion: piccolo/v2\n" + manifest))
+	var verErr *UnsupportedVersionError
+	if _, err := manager.Upsert(ctx, def); !errors.As(err, &verErr) || verErr.Declared != "piccolo/v2" {
+		t.Fatalf("expected UnsupportedVersionError, got %v", err)
+	}
+}
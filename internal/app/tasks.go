@@ -0,0 +1,309 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/api"
+	"piccolod/internal/cluster"
+	"piccolod/internal/container"
+)
+
+const (
+	// defaultTaskTimeout applies to tasks that do not set a timeout.
+	defaultTaskTimeout = 10 * time.Minute
+	// maxTaskTimeout bounds task timeouts; longer jobs belong in the app.
+	maxTaskTimeout = 24 * time.Hour
+	// maxTaskRuns is how many runs of each task the history keeps.
+	maxTaskRuns = 20
+)
+
+var (
+	ErrTaskNotFound  = errors.New("app manager: task not found")
+	ErrTaskRunning   = errors.New("app manager: task already running")
+	ErrAppNotRunning = errors.New("app manager: app not running")
+)
+
+// TaskStatus describes a scheduled task and its recent runs.
+type TaskStatus struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Command  []string `json:"command"`
+	Timeout  string   `json:"timeout"`
+	// NextRun is omitted for schedules that never fire.
+	NextRun *time.Time `json:"next_run,omitempty"`
+	Running bool       `json:"running"`
+	// Runs lists the kept history, newest first.
+	Runs []TaskRun `json:"runs"`
+}
+
+// taskTimeout returns the task's timeout, or the default when unset.
+func taskTimeout(t api.AppTask) (time.Duration, error) {
+	if t.Timeout == "" {
+		return defaultTaskTimeout, nil
+	}
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil || d <= 0 || d > maxTaskTimeout {
+		return 0, fmt.Errorf("timeout '%s' must be a duration between 1s and %s", t.Timeout, maxTaskTimeout)
+	}
+	return d, nil
+}
+
+// StartTaskScheduler runs due tasks of running apps at each minute boundary
+// until StopTaskScheduler. Runs are skipped while storage is locked and on
+// nodes that follow the kernel or the app.
+func (m *AppManager) StartTaskScheduler() {
+	m.tasksMu.Lock()
+	if m.tasksCancel != nil {
+		m.tasksMu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.tasksCtx, m.tasksCancel = ctx, cancel
+	m.tasksMu.Unlock()
+
+	m.tasksWG.Add(1)
+	go func() {
+		defer m.tasksWG.Done()
+		var last time.Time
+		for {
+			now := time.Now()
+			timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			minute := time.Now().Truncate(time.Minute)
+			if !minute.After(last) {
+				continue
+			}
+			last = minute
+			m.runDueTasks(ctx, minute)
+		}
+	}()
+}
+
+// StopTaskScheduler stops the scheduler, kills runs in flight and waits for
+// them to be recorded.
+func (m *AppManager) StopTaskScheduler() {
+	m.tasksMu.Lock()
+	cancel := m.tasksCancel
+	m.tasksCancel, m.tasksCtx = nil, nil
+	m.tasksMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	m.tasksWG.Wait()
+}
+
+// runDueTasks starts every task whose schedule fires in the minute at.
+func (m *AppManager) runDueTasks(ctx context.Context, at time.Time) {
+	if m.currentLockState() || m.ensureKernelLeader() != nil {
+		return
+	}
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return
+	}
+	for _, inst := range state.ListApps() {
+		if inst.Status != "running" || inst.ContainerID == "" {
+			continue
+		}
+		if m.LastObservedRole(cluster.ResourceAppPrefix+inst.Name) == cluster.RoleFollower {
+			continue
+		}
+		def, err := state.GetAppDefinition(inst.Name)
+		if err != nil {
+			continue
+		}
+		for _, task := range def.Tasks {
+			sched, err := parseCronSchedule(task.Schedule)
+			if err != nil {
+				log.Printf("WARN: app %s task %s: %v", inst.Name, task.Name, err)
+				continue
+			}
+			if !sched.matches(at) {
+				continue
+			}
+			if err := m.startTask(ctx, state, inst.Name, inst.ContainerID, task, "schedule"); errors.Is(err, ErrTaskRunning) {
+				m.recordActivity(ctx, activity.LevelWarn, fmt.Sprintf("Task %s of app %s skipped: the previous run is still going", task.Name, inst.Name),
+					map[string]any{"app": inst.Name, "task": task.Name})
+			}
+		}
+	}
+}
+
+// RunTask starts a task of a running app now. The run happens in the
+// background; its outcome lands in the task history.
+func (m *AppManager) RunTask(ctx context.Context, name, taskName string) error {
+	if err := m.ensureUnlocked(); err != nil {
+		return err
+	}
+	if err := m.ensureKernelLeader(); err != nil {
+		return err
+	}
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return err
+	}
+	inst, ok := state.GetApp(name)
+	if !ok {
+		return fmt.Errorf("app not found: %s", name)
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return err
+	}
+	for _, task := range def.Tasks {
+		if task.Name != taskName {
+			continue
+		}
+		if inst.Status != "running" || inst.ContainerID == "" {
+			return fmt.Errorf("%w: %s", ErrAppNotRunning, name)
+		}
+		return m.startTask(m.taskContext(), state, name, inst.ContainerID, task, "manual")
+	}
+	return fmt.Errorf("%w: %s", ErrTaskNotFound, taskName)
+}
+
+// Tasks lists an app's scheduled tasks with their recent runs.
+func (m *AppManager) Tasks(ctx context.Context, name string) ([]TaskStatus, error) {
+	state, err := m.ensureStateManager()
+	if err != nil {
+		return nil, err
+	}
+	inst, ok := state.GetApp(name)
+	if !ok {
+		return nil, fmt.Errorf("app not found: %s", name)
+	}
+	def, err := state.GetAppDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]TaskStatus, 0, len(def.Tasks))
+	for _, task := range def.Tasks {
+		st := TaskStatus{
+			Name:     task.Name,
+			Schedule: task.Schedule,
+			Command:  task.Command,
+			Runs:     []TaskRun{},
+			Running:  m.taskRunning(name, task.Name),
+		}
+		if d, err := taskTimeout(task); err == nil {
+			st.Timeout = d.String()
+		}
+		if sched, err := parseCronSchedule(task.Schedule); err == nil {
+			if next := sched.next(now); !next.IsZero() {
+				st.NextRun = &next
+			}
+		}
+		for i := len(inst.TaskRuns) - 1; i >= 0; i-- {
+			if inst.TaskRuns[i].Task == task.Name {
+				st.Runs = append(st.Runs, inst.TaskRuns[i])
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// taskContext is the scheduler's context while it runs, so stopping it also
+// stops manual runs.
+func (m *AppManager) taskContext() context.Context {
+	m.tasksMu.Lock()
+	defer m.tasksMu.Unlock()
+	if m.tasksCtx != nil {
+		return m.tasksCtx
+	}
+	return context.Background()
+}
+
+func taskKey(app, task string) string { return app + "/" + task }
+
+func (m *AppManager) taskRunning(app, task string) bool {
+	m.tasksMu.Lock()
+	defer m.tasksMu.Unlock()
+	return m.tasksRunning[taskKey(app, task)]
+}
+
+// startTask runs task in the background unless a run of it is still going.
+func (m *AppManager) startTask(ctx context.Context, state *FilesystemStateManager, app, containerID string, task api.AppTask, trigger string) error {
+	timeout, err := taskTimeout(task)
+	if err != nil {
+		return err
+	}
+	key := taskKey(app, task.Name)
+	m.tasksMu.Lock()
+	if m.tasksRunning[key] {
+		m.tasksMu.Unlock()
+		return fmt.Errorf("%w: %s", ErrTaskRunning, task.Name)
+	}
+	if m.tasksRunning == nil {
+		m.tasksRunning = make(map[string]bool)
+	}
+	m.tasksRunning[key] = true
+	m.tasksWG.Add(1)
+	m.tasksMu.Unlock()
+
+	go func() {
+		defer m.tasksWG.Done()
+		defer func() {
+			m.tasksMu.Lock()
+			delete(m.tasksRunning, key)
+			m.tasksMu.Unlock()
+		}()
+		run := m.execTask(ctx, containerID, task, timeout, trigger)
+		if err := state.RecordTaskRun(app, run, maxTaskRuns); err != nil {
+			log.Printf("WARN: app %s task %s: record run: %v", app, task.Name, err)
+		}
+		if run.Error != "" || (run.ExitCode != nil && *run.ExitCode != 0) {
+			reason := run.Error
+			if reason == "" {
+				reason = fmt.Sprintf("exit code %d", *run.ExitCode)
+			}
+			m.recordActivity(context.WithoutCancel(ctx), activity.LevelWarn, fmt.Sprintf("Task %s of app %s failed: %s", task.Name, app, reason),
+				map[string]any{"app": app, "task": task.Name, "trigger": trigger})
+		}
+	}()
+	return nil
+}
+
+// execTask runs the task's command in the container, killing it after
+// timeout.
+func (m *AppManager) execTask(ctx context.Context, containerID string, task api.AppTask, timeout time.Duration, trigger string) TaskRun {
+	started := time.Now()
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res, err := m.containerManager.Exec(execCtx, containerID, task.Command, timeout)
+	run := TaskRun{
+		Task:       task.Name,
+		Trigger:    trigger,
+		StartedAt:  started,
+		DurationMS: time.Since(started).Milliseconds(),
+		Output:     outputTail(res.Output, container.ExecOutputLimit),
+	}
+	switch {
+	case errors.Is(err, container.ErrExecTimeout), errors.Is(execCtx.Err(), context.DeadlineExceeded):
+		run.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		run.Error = err.Error()
+	default:
+		code := res.ExitCode
+		run.ExitCode = &code
+	}
+	return run
+}
+
+func outputTail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[len(s)-limit:]
+}
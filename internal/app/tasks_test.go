@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/container"
+)
+
+func newTaskTestManager(t *testing.T, cm *MockContainerManager, tasks ...api.AppTask) *AppManager {
+	t.Helper()
+	manager, err := NewAppManager(cm, newTestStateDir(t))
+	if err != nil {
+		t.Fatalf("NewAppManager: %v", err)
+	}
+	manager.SetMountVerifier(func(string) error { return nil })
+	manager.ForceLockState(false)
+	t.Cleanup(manager.StopTaskScheduler)
+	def := &api.AppDefinition{
+		Name:      "blog",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+		Tasks:     tasks,
+	}
+	if _, err := manager.Install(context.Background(), def); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := manager.Start(context.Background(), "blog"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return manager
+}
+
+func TestRunTaskRecordsHistory(t *testing.T) {
+	cm := NewMockContainerManager()
+	var argv []string
+	cm.execFn = func(ctx context.Context, containerID string, a []string) (container.ExecResult, error) {
+		argv = a
+		return container.ExecResult{ExitCode: 3, Output: strings.Repeat("x", container.ExecOutputLimit) + "tail"}, nil
+	}
+	m := newTaskTestManager(t, cm, api.AppTask{Name: "cron", Schedule: "@hourly", Command: []string{"php", "cron.php"}})
+	ctx := context.Background()
+
+	if err := m.RunTask(ctx, "blog", "missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+	if err := m.RunTask(ctx, "blog", "cron"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	m.tasksWG.Wait()
+	if strings.Join(argv, " ") != "php cron.php" {
+		t.Fatalf("unexpected argv %v", argv)
+	}
+
+	tasks, err := m.Tasks(ctx, "blog")
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("tasks: %+v %v", tasks, err)
+	}
+	st := tasks[0]
+	if st.Timeout != defaultTaskTimeout.String() || st.NextRun == nil || st.Running {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if len(st.Runs) != 1 {
+		t.Fatalf("expected one run, got %+v", st.Runs)
+	}
+	run := st.Runs[0]
+	if run.Trigger != "manual" || run.ExitCode == nil || *run.ExitCode != 3 || run.Error != "" {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if len(run.Output) != container.ExecOutputLimit || !strings.HasSuffix(run.Output, "tail") {
+		t.Fatalf("output not trimmed to its tail: %d bytes", len(run.Output))
+	}
+}
+
+func TestRunTaskTimesOut(t *testing.T) {
+	cm := NewMockContainerManager()
+	cm.execFn = func(ctx context.Context, containerID string, argv []string) (container.ExecResult, error) {
+		<-ctx.Done()
+		return container.ExecResult{Output: "partial"}, container.ErrExecTimeout
+	}
+	m := newTaskTestManager(t, cm, api.AppTask{Name: "slow", Schedule: "@daily", Command: []string{"sleep", "600"}, Timeout: "50ms"})
+	ctx := context.Background()
+
+	if err := m.RunTask(ctx, "blog", "slow"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	m.tasksWG.Wait()
+	tasks, err := m.Tasks(ctx, "blog")
+	if err != nil {
+		t.Fatalf("tasks: %v", err)
+	}
+	run := tasks[0].Runs[0]
+	if run.ExitCode != nil || run.Error != "timed out after 50ms" || run.Output != "partial" {
+		t.Fatalf("unexpected run %+v", run)
+	}
+}
+
+func TestRunTaskPreventsOverlap(t *testing.T) {
+	cm := NewMockContainerManager()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cm.execFn = func(ctx context.Context, containerID string, argv []string) (container.ExecResult, error) {
+		close(started)
+		<-release
+		return container.ExecResult{}, nil
+	}
+	m := newTaskTestManager(t, cm, api.AppTask{Name: "cron", Schedule: "* * * * *", Command: []string{"true"}})
+	ctx := context.Background()
+
+	if err := m.RunTask(ctx, "blog", "cron"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	<-started
+	if err := m.RunTask(ctx, "blog", "cron"); !errors.Is(err, ErrTaskRunning) {
+		t.Fatalf("expected ErrTaskRunning, got %v", err)
+	}
+	// A scheduled tick during the run is skipped, not queued.
+	m.runDueTasks(ctx, time.Now())
+	if tasks, _ := m.Tasks(ctx, "blog"); !tasks[0].Running {
+		t.Fatalf("task not reported running")
+	}
+	close(release)
+	m.tasksWG.Wait()
+	if tasks, _ := m.Tasks(ctx, "blog"); len(tasks[0].Runs) != 1 || tasks[0].Running {
+		t.Fatalf("expected exactly one finished run, got %+v", tasks[0])
+	}
+}
+
+func TestRunDueTasksSkipsWhenLockedOrStopped(t *testing.T) {
+	cm := NewMockContainerManager()
+	calls := 0
+	cm.execFn = func(ctx context.Context, containerID string, argv []string) (container.ExecResult, error) {
+		calls++
+		return container.ExecResult{}, nil
+	}
+	m := newTaskTestManager(t, cm, api.AppTask{Name: "cron", Schedule: "0 3 * * *", Command: []string{"true"}})
+	ctx := context.Background()
+	at := time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local)
+
+	m.runDueTasks(ctx, at.Add(time.Minute))
+	m.tasksWG.Wait()
+	if calls != 0 {
+		t.Fatalf("task ran outside its schedule")
+	}
+	m.ForceLockState(true)
+	m.runDueTasks(ctx, at)
+	m.tasksWG.Wait()
+	if calls != 0 {
+		t.Fatalf("task ran while locked")
+	}
+	m.ForceLockState(false)
+	m.runDueTasks(ctx, at)
+	m.tasksWG.Wait()
+	if calls != 1 {
+		t.Fatalf("expected one scheduled run, got %d", calls)
+	}
+	tasks, _ := m.Tasks(ctx, "blog")
+	if len(tasks[0].Runs) != 1 || tasks[0].Runs[0].Trigger != "schedule" {
+		t.Fatalf("unexpected runs %+v", tasks[0].Runs)
+	}
+
+	if err := m.Stop(ctx, "blog"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	m.runDueTasks(ctx, at)
+	m.tasksWG.Wait()
+	if calls != 1 {
+		t.Fatalf("task ran for a stopped app")
+	}
+	if err := m.RunTask(ctx, "blog", "cron"); !errors.Is(err, ErrAppNotRunning) {
+		t.Fatalf("expected ErrAppNotRunning, got %v", err)
+	}
+}
+
+func TestTrimTaskRunsKeepsNewestPerTask(t *testing.T) {
+	var runs []TaskRun
+	for i := 0; i < maxTaskRuns+5; i++ {
+		runs = append(runs, TaskRun{Task: "a", DurationMS: int64(i)}, TaskRun{Task: "b", DurationMS: int64(i)})
+	}
+	trimmed := trimTaskRuns(runs, maxTaskRuns)
+	counts := map[string]int{}
+	for _, r := range trimmed {
+		counts[r.Task]++
+	}
+	if counts["a"] != maxTaskRuns || counts["b"] != maxTaskRuns {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	if first := trimmed[0]; first.DurationMS != 5 {
+		t.Fatalf("oldest runs not dropped: %+v", first)
+	}
+}
@@ -12,9 +12,18 @@ type ContainerManager interface {
 	CreateContainer(ctx context.Context, spec container.ContainerCreateSpec) (string, error)
 	StartContainer(ctx context.Context, containerID string) error
 	StopContainer(ctx context.Context, containerID string) error
+	PauseContainer(ctx context.Context, containerID string) error
+	UnpauseContainer(ctx context.Context, containerID string) error
 	RemoveContainer(ctx context.Context, containerID string) error
 	PullImage(ctx context.Context, image string) error
 	Logs(ctx context.Context, containerID string, lines int) ([]string, error)
+	// FollowLogs streams the container's output written after since until
+	// the container stops or ctx is canceled, then closes the channel.
+	FollowLogs(ctx context.Context, containerID string, since time.Time) (<-chan container.LogLine, error)
+	Inspect(ctx context.Context, containerID string) (container.ContainerState, error)
+	Exec(ctx context.Context, containerID string, argv []string, timeout time.Duration) (container.ExecResult, error)
+	// Ping checks that the runtime answers and reports its version.
+	Ping(ctx context.Context) (container.RuntimeInfo, error)
 }
 
 // AppInstance captures the runtime metadata for an installed application.
@@ -27,4 +36,61 @@ type AppInstance struct {
 	Environment map[string]string `json:"environment,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
+	// LastError explains the most recent failed create, start or stop, or
+	// an unexpected container exit; ExitCode is the container's exit code
+	// at that point when the runtime reported one.
+	LastError   string     `json:"last_error,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// Enabled reports whether the app starts on boot. The enabled/ symlink
+	// is the record; List and Get fill this in.
+	Enabled bool `json:"enabled"`
+	// PortUpdate is set on the result of an Upsert that changed published
+	// ports: PortUpdateInPlace or PortUpdateRecreate. It is not stored.
+	PortUpdate string `json:"port_update,omitempty"`
+	// Warnings flag problems that do not stop the app, such as a name
+	// installed before the naming rules tightened. List and Get fill them in.
+	Warnings []string `json:"warnings,omitempty"`
+	// TaskRuns is the scheduled task history, served by the tasks endpoint
+	// rather than with the app.
+	TaskRuns []TaskRun `json:"-"`
+	// Changes is the app.yaml change history, served by the history
+	// endpoint.
+	Changes []DefinitionChange `json:"-"`
+}
+
+// TaskRun records one execution of a scheduled task.
+type TaskRun struct {
+	Task string `json:"task"`
+	// Trigger is "schedule" or "manual".
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	// ExitCode is nil when the command did not finish (timeout, exec error).
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// VolumePurger deletes the persistence-managed volume backing an app and
+// reports which paths were removed and how many bytes were reclaimed.
+type VolumePurger func(ctx context.Context, volumeID string) (paths []string, bytesFreed int64, err error)
+
+// PurgeReport summarises the data removed by an uninstall with purge.
+type PurgeReport struct {
+	Volumes    []string       `json:"volumes"`
+	Paths      []string       `json:"paths"`
+	BytesFreed int64          `json:"bytes_freed"`
+	Failures   []PurgeFailure `json:"failures,omitempty"`
+}
+
+// PurgeFailure records a purge target that could not be removed.
+type PurgeFailure struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// AppVolumeID returns the persistence volume ID used for an app's data.
+func AppVolumeID(name string) string {
+	return "app-" + name
 }
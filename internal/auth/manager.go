@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -112,6 +113,22 @@ func (m *Manager) IsInitialized(ctx context.Context) (bool, error) {
 	return st.Initialized, nil
 }
 
+// MinPasswordLength is the shortest admin password accepted at setup or on
+// change.
+const MinPasswordLength = 8
+
+// CheckPasswordPolicy reports why password is not acceptable as an admin
+// password, or nil if it is.
+func CheckPasswordPolicy(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return errors.New("password required")
+	}
+	if len([]rune(password)) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
 // Setup initializes the admin password; allowed only once.
 func (m *Manager) Setup(ctx context.Context, password string) error {
 	if strings.TrimSpace(password) == "" {
@@ -321,16 +338,100 @@ type Session struct {
 	ID        string
 	User      string
 	CSRF      string
-	ExpiresAt int64 // unix seconds
+	ExpiresAt int64 // unix seconds; the earlier of the idle and absolute deadlines
+	CreatedAt time.Time
+	LastSeen  time.Time
+	// ClientIP and UserAgent describe the sign-in that created the session.
+	ClientIP  string
+	UserAgent string
+}
+
+// SessionPrefixLen is how much of a session ID is shown when sessions are
+// listed. The prefix names a session for revocation without handing out
+// enough of the ID to use it.
+const SessionPrefixLen = 12
+
+// Prefix returns the part of the ID that identifies the session in lists.
+func (sess *Session) Prefix() string {
+	if len(sess.ID) <= SessionPrefixLen {
+		return sess.ID
+	}
+	return sess.ID[:SessionPrefixLen]
 }
 
+// SessionPolicy bounds how long a session lives. A session ends after
+// IdleTimeout without an authenticated request, and after MaxLifetime no
+// matter how active it is.
+type SessionPolicy struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+// DefaultSessionPolicy applies until an admin stores a different one.
+var DefaultSessionPolicy = SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: 12 * time.Hour}
+
+// Bounds accepted by SessionPolicy.Validate.
+const (
+	MinSessionIdleTimeout = time.Minute
+	MaxSessionLifetime    = 30 * 24 * time.Hour
+)
+
+// Validate reports why the policy cannot be applied.
+func (p SessionPolicy) Validate() error {
+	if p.IdleTimeout < MinSessionIdleTimeout {
+		return fmt.Errorf("idle timeout must be at least %s", MinSessionIdleTimeout)
+	}
+	if p.MaxLifetime < p.IdleTimeout {
+		return errors.New("absolute lifetime must not be shorter than the idle timeout")
+	}
+	if p.MaxLifetime > MaxSessionLifetime {
+		return fmt.Errorf("absolute lifetime must be at most %s", MaxSessionLifetime)
+	}
+	return nil
+}
+
+// Errors returned by SessionStore.Lookup and Touch.
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionIdle     = errors.New("session idle timeout")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
 type SessionStore struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
+	policy   SessionPolicy
+	now      func() time.Time
 }
 
 func NewSessionStore() *SessionStore {
-	return &SessionStore{sessions: make(map[string]*Session)}
+	return &SessionStore{sessions: make(map[string]*Session), policy: DefaultSessionPolicy, now: timeNow}
+}
+
+// SetClock replaces the store's time source; tests use it to step past
+// timeouts.
+func (s *SessionStore) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	s.now = now
+	s.mu.Unlock()
+}
+
+// Policy returns the timeouts currently enforced.
+func (s *SessionStore) Policy() SessionPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// SetPolicy changes the timeouts. Existing sessions are measured against
+// the new values from their original creation and last activity.
+func (s *SessionStore) SetPolicy(p SessionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+	for _, sess := range s.sessions {
+		sess.ExpiresAt = s.deadlineLocked(sess).Unix()
+	}
 }
 
 func randString(n int) string {
@@ -339,28 +440,78 @@ func randString(n int) string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-func (s *SessionStore) Create(user string, ttlSeconds int64) *Session {
-	id := randString(32)
-	csrf := randString(16)
-	sess := &Session{ID: id, User: user, CSRF: csrf, ExpiresAt: (timeNow().Unix() + ttlSeconds)}
+// deadlineLocked is the moment sess ends if no further request arrives.
+func (s *SessionStore) deadlineLocked(sess *Session) time.Time {
+	idle := sess.LastSeen.Add(s.policy.IdleTimeout)
+	absolute := sess.CreatedAt.Add(s.policy.MaxLifetime)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// checkLocked reports whether sess is still usable at now.
+func (s *SessionStore) checkLocked(sess *Session, now time.Time) error {
+	if now.After(sess.CreatedAt.Add(s.policy.MaxLifetime)) {
+		return ErrSessionExpired
+	}
+	if now.After(sess.LastSeen.Add(s.policy.IdleTimeout)) {
+		return ErrSessionIdle
+	}
+	return nil
+}
+
+func (s *SessionStore) Create(user string) *Session {
+	return s.CreateFrom(user, "", "")
+}
+
+// CreateFrom is Create recording where the sign-in came from.
+func (s *SessionStore) CreateFrom(user, clientIP, userAgent string) *Session {
 	s.mu.Lock()
-	s.sessions[id] = sess
-	s.mu.Unlock()
-	return sess
+	defer s.mu.Unlock()
+	now := s.now()
+	sess := &Session{ID: randString(32), User: user, CSRF: randString(16), CreatedAt: now, LastSeen: now, ClientIP: clientIP, UserAgent: userAgent}
+	sess.ExpiresAt = s.deadlineLocked(sess).Unix()
+	s.sessions[sess.ID] = sess
+	copied := *sess
+	return &copied
 }
 
-func (s *SessionStore) Get(id string) (*Session, bool) {
-	s.mu.RLock()
+// Lookup returns the session without counting the call as activity.
+// Expired sessions are removed and reported as ErrSessionIdle or
+// ErrSessionExpired.
+func (s *SessionStore) Lookup(id string) (*Session, error) {
+	return s.lookup(id, false)
+}
+
+// Touch is Lookup that also records activity, sliding the idle deadline.
+func (s *SessionStore) Touch(id string) (*Session, error) {
+	return s.lookup(id, true)
+}
+
+func (s *SessionStore) lookup(id string, touch bool) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sess, ok := s.sessions[id]
-	s.mu.RUnlock()
 	if !ok {
-		return nil, false
+		return nil, ErrSessionNotFound
 	}
-	if timeNow().Unix() > sess.ExpiresAt {
-		s.Delete(id)
-		return nil, false
+	now := s.now()
+	if err := s.checkLocked(sess, now); err != nil {
+		delete(s.sessions, id)
+		return nil, err
 	}
-	return sess, true
+	if touch {
+		sess.LastSeen = now
+		sess.ExpiresAt = s.deadlineLocked(sess).Unix()
+	}
+	copied := *sess
+	return &copied, nil
+}
+
+func (s *SessionStore) Get(id string) (*Session, bool) {
+	sess, err := s.Lookup(id)
+	return sess, err == nil
 }
 
 func (s *SessionStore) Delete(id string) {
@@ -380,5 +531,83 @@ func (s *SessionStore) RotateCSRF(id string) (string, bool) {
 	return sess.CSRF, true
 }
 
+// Rotate replaces the session's ID and CSRF token, keeping its user and
+// creation time so the absolute lifetime still counts from the original
+// sign-in. The old ID stops working immediately.
+func (s *SessionStore) Rotate(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.sessions[id]
+	delete(s.sessions, id)
+	if !ok || s.checkLocked(old, s.now()) != nil {
+		return nil, false
+	}
+	sess := &Session{ID: randString(32), User: old.User, CSRF: randString(16), ExpiresAt: old.ExpiresAt, CreatedAt: old.CreatedAt, LastSeen: old.LastSeen,
+		ClientIP: old.ClientIP, UserAgent: old.UserAgent}
+	s.sessions[sess.ID] = sess
+	copied := *sess
+	return &copied, true
+}
+
+// RevokeAllExcept deletes every session other than keep and returns how many
+// were removed.
+func (s *SessionStore) RevokeAllExcept(keep string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id := range s.sessions {
+		if id != keep {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the sessions still usable, most recently active first.
+// Expired sessions found on the way are removed.
+func (s *SessionStore) List() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := make([]Session, 0, len(s.sessions))
+	for id, sess := range s.sessions {
+		if s.checkLocked(sess, now) != nil {
+			delete(s.sessions, id)
+			continue
+		}
+		out = append(out, *sess)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastSeen.Equal(out[j].LastSeen) {
+			return out[i].LastSeen.After(out[j].LastSeen)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// RevokePrefix deletes the session whose Prefix is prefix and returns it.
+// It reports false when no session, or more than one, has that prefix.
+func (s *SessionStore) RevokePrefix(prefix string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var match *Session
+	for _, sess := range s.sessions {
+		if sess.Prefix() != prefix {
+			continue
+		}
+		if match != nil {
+			return Session{}, false
+		}
+		match = sess
+	}
+	if match == nil {
+		return Session{}, false
+	}
+	delete(s.sessions, match.ID)
+	return *match, true
+}
+
 // timeNow is a small indirection for tests
 var timeNow = func() time.Time { return time.Now() }
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestManager_SetupAndVerify(t *testing.T) {
@@ -58,3 +60,155 @@ func TestManager_ChangePasswordWithRecovery(t *testing.T) {
 		t.Fatalf("expected recovered password to verify, ok=%v err=%v", ok, err)
 	}
 }
+
+func TestSessionStore_RotateAndRevokeAllExcept(t *testing.T) {
+	s := NewSessionStore()
+	a := s.Create("admin")
+	b := s.Create("admin")
+	oldCSRF := a.CSRF
+
+	rotated, ok := s.Rotate(a.ID)
+	if !ok || rotated.ID == a.ID || rotated.CSRF == oldCSRF || rotated.ExpiresAt != a.ExpiresAt {
+		t.Fatalf("unexpected rotation result %+v ok=%v", rotated, ok)
+	}
+	if _, ok := s.Get(a.ID); ok {
+		t.Fatalf("old session id still valid")
+	}
+	if n := s.RevokeAllExcept(rotated.ID); n != 1 {
+		t.Fatalf("expected 1 session revoked, got %d", n)
+	}
+	if _, ok := s.Get(b.ID); ok {
+		t.Fatalf("other session still valid")
+	}
+	if _, ok := s.Get(rotated.ID); !ok {
+		t.Fatalf("kept session revoked")
+	}
+}
+
+func TestSessionStore_ListAndRevokePrefix(t *testing.T) {
+	s, clock := newClockedStore(DefaultSessionPolicy)
+	a := s.CreateFrom("admin", "192.0.2.10", "laptop")
+	clock.advance(time.Minute)
+	b := s.CreateFrom("admin", "192.0.2.11", "phone")
+
+	list := s.List()
+	if len(list) != 2 || list[0].ID != b.ID || list[1].ClientIP != "192.0.2.10" || list[1].UserAgent != "laptop" {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	if _, ok := s.RevokePrefix("nope"); ok {
+		t.Fatalf("unknown prefix revoked a session")
+	}
+	revoked, ok := s.RevokePrefix(a.Prefix())
+	if !ok || revoked.ID != a.ID {
+		t.Fatalf("revoke: %+v ok=%v", revoked, ok)
+	}
+	if _, err := s.Lookup(a.ID); err != ErrSessionNotFound {
+		t.Fatalf("revoked session still usable: %v", err)
+	}
+	if _, err := s.Lookup(b.ID); err != nil {
+		t.Fatalf("other session lost: %v", err)
+	}
+
+	clock.advance(DefaultSessionPolicy.IdleTimeout + time.Second)
+	if list := s.List(); len(list) != 0 {
+		t.Fatalf("idle session listed: %+v", list)
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	if err := CheckPasswordPolicy("short"); err == nil {
+		t.Fatalf("expected short password to be rejected")
+	}
+	if err := CheckPasswordPolicy("        "); err == nil {
+		t.Fatalf("expected blank password to be rejected")
+	}
+	if err := CheckPasswordPolicy("pw123456"); err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+}
+
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClockedStore(policy SessionPolicy) (*SessionStore, *testClock) {
+	clock := &testClock{t: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s := NewSessionStore()
+	s.SetClock(clock.now)
+	s.SetPolicy(policy)
+	return s, clock
+}
+
+func TestSessionStore_IdleTimeout(t *testing.T) {
+	s, clock := newClockedStore(SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: 12 * time.Hour})
+	sess := s.Create("admin")
+	clock.advance(29 * time.Minute)
+	if _, err := s.Lookup(sess.ID); err != nil {
+		t.Fatalf("session within idle timeout rejected: %v", err)
+	}
+	// Lookup is not activity, so the idle deadline did not move.
+	clock.advance(2 * time.Minute)
+	if _, err := s.Lookup(sess.ID); !errors.Is(err, ErrSessionIdle) {
+		t.Fatalf("expected ErrSessionIdle, got %v", err)
+	}
+	if _, err := s.Lookup(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("idle session should be removed, got %v", err)
+	}
+}
+
+func TestSessionStore_SlidingRenewal(t *testing.T) {
+	s, clock := newClockedStore(SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: 12 * time.Hour})
+	sess := s.Create("admin")
+	for i := 0; i < 4; i++ {
+		clock.advance(20 * time.Minute)
+		touched, err := s.Touch(sess.ID)
+		if err != nil {
+			t.Fatalf("touch %d: %v", i, err)
+		}
+		if want := clock.t.Add(30 * time.Minute).Unix(); touched.ExpiresAt != want {
+			t.Fatalf("expires_at = %d, want %d", touched.ExpiresAt, want)
+		}
+	}
+	if !sess.CreatedAt.Equal(clock.t.Add(-80 * time.Minute)) {
+		t.Fatalf("created_at moved: %v", sess.CreatedAt)
+	}
+}
+
+func TestSessionStore_AbsoluteLifetime(t *testing.T) {
+	s, clock := newClockedStore(SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: time.Hour})
+	sess := s.Create("admin")
+	clock.advance(25 * time.Minute)
+	if _, err := s.Touch(sess.ID); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	clock.advance(25 * time.Minute)
+	touched, err := s.Touch(sess.ID)
+	if err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	if want := sess.CreatedAt.Add(time.Hour).Unix(); touched.ExpiresAt != want {
+		t.Fatalf("expires_at should be capped at the absolute lifetime: got %d want %d", touched.ExpiresAt, want)
+	}
+	clock.advance(11 * time.Minute)
+	if _, err := s.Touch(sess.ID); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+}
+
+func TestSessionPolicyValidate(t *testing.T) {
+	if err := DefaultSessionPolicy.Validate(); err != nil {
+		t.Fatalf("default policy invalid: %v", err)
+	}
+	bad := []SessionPolicy{
+		{IdleTimeout: time.Second, MaxLifetime: time.Hour},
+		{IdleTimeout: 2 * time.Hour, MaxLifetime: time.Hour},
+		{IdleTimeout: time.Hour, MaxLifetime: 365 * 24 * time.Hour},
+	}
+	for _, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", p)
+		}
+	}
+}
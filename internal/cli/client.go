@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runtime files written by the daemon under <state>/run so local tooling can
+// reach the secure loopback listener. All are 0600: holding the token is what
+// makes a loopback request count as an admin.
+const (
+	PortFile  = "loopback.port"
+	TokenFile = "cli.token"
+	// SocketFile is a Unix socket serving the same API as the loopback port.
+	SocketFile = "piccolod.sock"
+
+	// TokenHeader carries the CLI token on loopback requests.
+	TokenHeader = "X-Piccolo-CLI-Token"
+)
+
+// ErrDaemonNotRunning is returned when the runtime files are missing.
+var ErrDaemonNotRunning = errors.New("piccolod does not appear to be running (no loopback runtime files)")
+
+// APIError is a non-2xx response from the daemon.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("piccolod returned %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("piccolod returned %d: %s", e.Status, e.Message)
+}
+
+// Client talks to the local daemon's API over the secure loopback listener.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// Dial reads the runtime files in runDir and returns a client for the daemon
+// that wrote them. The Unix socket is preferred when the daemon bound one; the
+// loopback port is the fallback.
+func Dial(runDir string) (*Client, error) {
+	token, err := os.ReadFile(filepath.Join(runDir, TokenFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrDaemonNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cli token: %w", err)
+	}
+	client := &Client{
+		token: strings.TrimSpace(string(token)),
+		http:  &http.Client{Timeout: 2 * time.Minute},
+	}
+	socket := filepath.Join(runDir, SocketFile)
+	if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		client.baseURL = "http://piccolod"
+		client.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return client, nil
+	}
+	rawPort, err := os.ReadFile(filepath.Join(runDir, PortFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrDaemonNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read loopback port: %w", err)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(string(rawPort)))
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid loopback port file %q", strings.TrimSpace(string(rawPort)))
+	}
+	client.baseURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+	return client, nil
+}
+
+// Do sends a request to the daemon and decodes a JSON reply into out when
+// out is non-nil.
+func (c *Client) Do(ctx context.Context, method, path, contentType string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(TokenHeader, c.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("contact piccolod: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Status: resp.StatusCode, Message: errorMessage(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// JSON marshals in and sends it with Do.
+func (c *Client) JSON(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return c.Do(ctx, method, path, "application/json", body, out)
+}
+
+// errorMessage digs the human-readable message out of the error envelopes
+// the API uses ({"error": "..."} and {"error": {"message": "..."}}).
+func errorMessage(data []byte) string {
+	var envelope struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return strings.TrimSpace(string(data))
+	}
+	var s string
+	if json.Unmarshal(envelope.Error, &s) == nil && s != "" {
+		return s
+	}
+	var nested struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(envelope.Error, &nested) == nil {
+		if nested.Message != "" {
+			return nested.Message
+		}
+		if nested.Error != "" {
+			return nested.Error
+		}
+	}
+	return envelope.Message
+}
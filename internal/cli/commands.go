@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/sys/unix"
+)
+
+// Env carries the streams and runtime directory a CLI invocation uses.
+type Env struct {
+	RunDir string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+const usage = `Usage: piccolod [command]
+
+Without a command piccolod runs the daemon. Commands talk to the running
+daemon over its loopback listener and must run on the same host as a user
+that can read the runtime directory.
+
+Commands:
+  status                    Show version, lock state and health
+  unlock                    Unlock storage (password from the terminal or stdin)
+  apps list                 List installed apps
+  apps install -f app.yaml  Install or update an app ("-f -" reads stdin)
+  remote status             Show remote access status
+`
+
+// IsCommand reports whether arg names a CLI command rather than a daemon
+// invocation.
+func IsCommand(arg string) bool {
+	switch arg {
+	case "status", "unlock", "apps", "remote", "help", "-h", "--help":
+		return true
+	}
+	return false
+}
+
+// Run executes one CLI command and returns the process exit code.
+func Run(ctx context.Context, env Env, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(env.Stdout, usage)
+		return 0
+	}
+	var cmd func(context.Context, *Client, Env, []string) error
+	switch args[0] {
+	case "status":
+		cmd = runStatus
+	case "unlock":
+		cmd = runUnlock
+	case "apps":
+		cmd = runApps
+	case "remote":
+		cmd = runRemote
+	default:
+		fmt.Fprintf(env.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	client, err := Dial(env.RunDir)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err := cmd(ctx, client, env, args[1:]); err != nil {
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintf(env.Stderr, "%v\n\n%s", err, usage)
+			return 2
+		}
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func runStatus(ctx context.Context, c *Client, env Env, args []string) error {
+	if len(args) > 0 {
+		return usageError("status takes no arguments")
+	}
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/version", nil, &version); err != nil {
+		return err
+	}
+	var crypto struct {
+		Initialized bool `json:"initialized"`
+		Locked      bool `json:"locked"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/api/v1/crypto/status", nil, &crypto); err != nil {
+		return err
+	}
+	var health struct {
+		Overall    string `json:"overall"`
+		Components []struct {
+			Name    string `json:"name"`
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		} `json:"components"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/api/v1/health/detail", nil, &health); err != nil {
+		return err
+	}
+	storage := "unlocked"
+	switch {
+	case !crypto.Initialized:
+		storage = "not initialized"
+	case crypto.Locked:
+		storage = "locked"
+	}
+	fmt.Fprintf(env.Stdout, "version: %s\nstorage: %s\nhealth:  %s\n", version.Version, storage, health.Overall)
+	tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	for _, comp := range health.Components {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", comp.Name, comp.Level, comp.Message)
+	}
+	return tw.Flush()
+}
+
+func runUnlock(ctx context.Context, c *Client, env Env, args []string) error {
+	if len(args) > 0 {
+		return usageError("unlock takes no arguments")
+	}
+	var crypto struct {
+		Initialized bool `json:"initialized"`
+		Locked      bool `json:"locked"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/api/v1/crypto/status", nil, &crypto); err != nil {
+		return err
+	}
+	if !crypto.Initialized {
+		return errors.New("storage is not initialized; finish setup in the portal first")
+	}
+	if !crypto.Locked {
+		fmt.Fprintln(env.Stdout, "storage is already unlocked")
+		return nil
+	}
+	password, err := readPassword(env)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("password required")
+	}
+	if err := c.JSON(ctx, http.MethodPost, "/api/v1/crypto/unlock", map[string]string{"password": password}, nil); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			return errors.New("incorrect password")
+		}
+		return err
+	}
+	fmt.Fprintln(env.Stdout, "storage unlocked")
+	return nil
+}
+
+func runApps(ctx context.Context, c *Client, env Env, args []string) error {
+	if len(args) == 0 {
+		return usageError("apps requires a subcommand: list or install")
+	}
+	switch args[0] {
+	case "list", "ls":
+		return runAppsList(ctx, c, env, args[1:])
+	case "install":
+		return runAppsInstall(ctx, c, env, args[1:])
+	}
+	return usageError(fmt.Sprintf("unknown apps subcommand %q", args[0]))
+}
+
+func runAppsList(ctx context.Context, c *Client, env Env, args []string) error {
+	if len(args) > 0 {
+		return usageError("apps list takes no arguments")
+	}
+	var resp struct {
+		Data []struct {
+			Name   string `json:"name"`
+			Image  string `json:"image"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/api/v1/apps", nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Data) == 0 {
+		fmt.Fprintln(env.Stdout, "no apps installed")
+		return nil
+	}
+	tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tIMAGE")
+	for _, a := range resp.Data {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", a.Name, a.Status, a.Image)
+	}
+	return tw.Flush()
+}
+
+func runAppsInstall(ctx context.Context, c *Client, env Env, args []string) error {
+	fs := flag.NewFlagSet("apps install", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("f", "", "path to app.yaml, or - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if *file == "" || fs.NArg() > 0 {
+		return usageError("apps install requires -f app.yaml")
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "-" {
+		data, err = io.ReadAll(env.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("read app definition: %w", err)
+	}
+	var resp struct {
+		Data struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := c.Do(ctx, http.MethodPost, "/api/v1/apps", "application/x-yaml", data, &resp); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "installed %s (%s)\n", resp.Data.Name, resp.Data.Status)
+	return nil
+}
+
+func runRemote(ctx context.Context, c *Client, env Env, args []string) error {
+	if len(args) != 1 || args[0] != "status" {
+		return usageError("remote supports only: remote status")
+	}
+	var st struct {
+		Enabled        bool     `json:"enabled"`
+		State          string   `json:"state"`
+		Endpoint       string   `json:"endpoint"`
+		PortalHostname string   `json:"portal_hostname"`
+		Warnings       []string `json:"warnings"`
+	}
+	if err := c.JSON(ctx, http.MethodGet, "/api/v1/remote/status", nil, &st); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "enabled: %t\nstate:   %s\n", st.Enabled, st.State)
+	if st.PortalHostname != "" {
+		fmt.Fprintf(env.Stdout, "portal:  %s\n", st.PortalHostname)
+	}
+	if st.Endpoint != "" {
+		fmt.Fprintf(env.Stdout, "nexus:   %s\n", st.Endpoint)
+	}
+	for _, w := range st.Warnings {
+		fmt.Fprintf(env.Stdout, "warning: %s\n", w)
+	}
+	return nil
+}
+
+// readPassword prompts with echo disabled when stdin is a terminal and
+// otherwise reads the first line, so `echo pw | piccolod unlock` works.
+func readPassword(env Env) (string, error) {
+	if f, ok := env.Stdin.(*os.File); ok {
+		fd := int(f.Fd())
+		if old, err := unix.IoctlGetTermios(fd, unix.TCGETS); err == nil {
+			quiet := *old
+			quiet.Lflag &^= unix.ECHO
+			quiet.Lflag |= unix.ICANON | unix.ISIG
+			fmt.Fprint(env.Stderr, "Password: ")
+			if err := unix.IoctlSetTermios(fd, unix.TCSETS, &quiet); err != nil {
+				return "", fmt.Errorf("disable echo: %w", err)
+			}
+			defer func() {
+				_ = unix.IoctlSetTermios(fd, unix.TCSETS, old)
+				fmt.Fprintln(env.Stderr)
+			}()
+		}
+	}
+	line, err := bufio.NewReader(env.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
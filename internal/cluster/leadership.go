@@ -14,6 +14,9 @@ const (
 const (
 	ResourceControlPlane = "control-plane"
 	ResourceKernel       = ResourceControlPlane
+	// ResourceControlStore is held by the node allowed to attach the
+	// control volume as leader and write the control database.
+	ResourceControlStore = "control-store"
 	ResourceAppPrefix    = "app:"
 )
 
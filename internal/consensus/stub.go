@@ -10,31 +10,35 @@ import (
 
 // Stub implements a single-node consensus manager that always assumes leader role.
 type Stub struct {
-	registry *cluster.Registry
-	bus      *events.Bus
-	resource string
+	registry  *cluster.Registry
+	bus       *events.Bus
+	resources []string
 }
 
-// NewStub constructs a stub consensus manager for the given resource.
+// NewStub constructs a stub consensus manager that leads the kernel and the
+// control store.
 func NewStub(registry *cluster.Registry, bus *events.Bus) *Stub {
-	return &Stub{registry: registry, bus: bus, resource: cluster.ResourceKernel}
+	return &Stub{registry: registry, bus: bus, resources: []string{cluster.ResourceKernel, cluster.ResourceControlStore}}
 }
 
-// Start marks this node as leader and broadcasts an event.
+// Start marks this node as leader of its resources and broadcasts an event
+// for each.
 func (s *Stub) Start(ctx context.Context) error {
-	if s.registry != nil {
-		s.registry.Set(s.resource, cluster.RoleLeader)
-	}
-	if s.bus != nil {
-		s.bus.Publish(events.Event{
-			Topic: events.TopicLeadershipRoleChanged,
-			Payload: events.LeadershipChanged{
-				Resource: s.resource,
-				Role:     cluster.RoleLeader,
-			},
-		})
+	for _, resource := range s.resources {
+		if s.registry != nil {
+			s.registry.Set(resource, cluster.RoleLeader)
+		}
+		if s.bus != nil {
+			s.bus.Publish(events.Event{
+				Topic: events.TopicLeadershipRoleChanged,
+				Payload: events.LeadershipChanged{
+					Resource: resource,
+					Role:     cluster.RoleLeader,
+				},
+			})
+		}
+		log.Printf("INFO: consensus stub set resource %s role=%s", resource, cluster.RoleLeader)
 	}
-	log.Printf("INFO: consensus stub set resource %s role=%s", s.resource, cluster.RoleLeader)
 	return nil
 }
 
@@ -52,3 +56,14 @@ func (s *Stub) SetRole(resource string, role cluster.Role) {
 		s.bus.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: resource, Role: role}})
 	}
 }
+
+// SetFollower publishes a follower role for resource along with the address
+// of the node that leads it.
+func (s *Stub) SetFollower(resource, leaderEndpoint string) {
+	if s.registry != nil {
+		s.registry.Set(resource, cluster.RoleFollower)
+	}
+	if s.bus != nil {
+		s.bus.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: resource, Role: cluster.RoleFollower, LeaderEndpoint: leaderEndpoint}})
+	}
+}
@@ -0,0 +1,94 @@
+package container
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log streams a container line came from.
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// maxLogLine caps one log line; longer lines are cut.
+const maxLogLine = 64 * 1024
+
+// LogLine is one line of container output.
+type LogLine struct {
+	Time   time.Time
+	Stream string
+	Text   string
+}
+
+// FollowLogs streams the container's output from since (all of it when
+// zero) until the container stops or ctx is canceled; the channel is
+// closed then.
+func (p *PodmanCLI) FollowLogs(ctx context.Context, containerID string, since time.Time) (<-chan LogLine, error) {
+	if !isValidContainerID(containerID) {
+		return nil, fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+	args := []string{"logs", "--follow", "--timestamps"}
+	if !since.IsZero() {
+		args = append(args, "--since", since.UTC().Format(time.RFC3339Nano))
+	}
+	args = append(args, containerID)
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	cmd.WaitDelay = pullKillGrace
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("podman logs: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("podman logs: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("podman logs failed: %w", err)
+	}
+
+	out := make(chan LogLine, 64)
+	var wg sync.WaitGroup
+	scan := func(r io.Reader, stream string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), maxLogLine)
+		for scanner.Scan() {
+			line := parseLogLine(scanner.Text(), stream)
+			select {
+			case out <- line:
+			case <-ctx.Done():
+				_, _ = io.Copy(io.Discard, r)
+				return
+			}
+		}
+		_, _ = io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go scan(stdout, LogStreamStdout)
+	go scan(stderr, LogStreamStderr)
+	go func() {
+		wg.Wait()
+		_ = cmd.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+// parseLogLine splits the timestamp podman logs --timestamps puts in front
+// of each line; a line without one is stamped with the current time.
+func parseLogLine(raw, stream string) LogLine {
+	raw = strings.TrimRight(raw, "\r")
+	if ts, text, ok := strings.Cut(raw, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return LogLine{Time: t.UTC(), Stream: stream, Text: text}
+		}
+	}
+	return LogLine{Time: time.Now().UTC(), Stream: stream, Text: raw}
+}
@@ -0,0 +1,61 @@
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPodmanCLI_FollowLogsSplitsStreamsAndTimestamps(t *testing.T) {
+	dir := installFakePodman(t, `echo "$@" > "$(dirname "$0")/args"
+echo "2026-03-01T10:00:00.5+01:00 listening on :8080"
+echo "2026-03-01T10:00:01.25+01:00 database unreachable" >&2
+echo "no timestamp"
+`)
+	since := time.Date(2026, 3, 1, 8, 59, 0, 0, time.UTC)
+	lines, err := (&PodmanCLI{}).FollowLogs(context.Background(), "0123456789abcdef", since)
+	if err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	var got []LogLine
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, line)
+		case <-timeout:
+			t.Fatalf("stream not closed after podman exited; got %+v", got)
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected three lines, got %+v", got)
+	}
+	byText := map[string]LogLine{}
+	for _, l := range got {
+		byText[l.Text] = l
+	}
+	out := byText["listening on :8080"]
+	if out.Stream != LogStreamStdout || !out.Time.Equal(time.Date(2026, 3, 1, 9, 0, 0, 500_000_000, time.UTC)) {
+		t.Fatalf("unexpected stdout line %+v", out)
+	}
+	if errLine := byText["database unreachable"]; errLine.Stream != LogStreamStderr || errLine.Time.Location() != time.UTC {
+		t.Fatalf("unexpected stderr line %+v", errLine)
+	}
+	if bare := byText["no timestamp"]; bare.Time.IsZero() {
+		t.Fatalf("expected a line without timestamp stamped on arrival: %+v", bare)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if want := "logs --follow --timestamps --since 2026-03-01T08:59:00Z 0123456789abcdef"; strings.TrimSpace(string(args)) != want {
+		t.Fatalf("podman called with %q, want %q", args, want)
+	}
+	if _, err := (&PodmanCLI{}).FollowLogs(context.Background(), "nope", time.Time{}); err == nil {
+		t.Fatalf("expected an invalid container ID to be refused")
+	}
+}
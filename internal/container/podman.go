@@ -3,11 +3,15 @@ package container
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // ErrContainerNotFound returns an error for when a container is not found
@@ -31,6 +35,9 @@ var (
 
 	// Environment variable keys
 	envKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// Linux capability names, without the CAP_ prefix
+	capNamePattern = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
 )
 
 var portInUseRe = regexp.MustCompile(`:(\d+): bind: address already in use`)
@@ -109,8 +116,7 @@ func InspectPublishedPorts(ctx context.Context, containerID string) (map[int]int
 	if containerID == "" {
 		return nil, fmt.Errorf("container ID required")
 	}
-	cmd := exec.CommandContext(ctx, "podman", "port", containerID)
-	output, err := cmd.Output()
+	output, err := outputPodman(ctx, "port", containerID)
 	if err != nil {
 		return nil, fmt.Errorf("podman port failed: %w", err)
 	}
@@ -179,11 +185,26 @@ type ContainerCreateSpec struct {
 	Resources     ResourceLimits
 	NetworkMode   string
 	RestartPolicy string
+	// Devices are host device paths passed into the container.
+	Devices []string
+	// CapAdd are Linux capabilities added to the container, without the
+	// CAP_ prefix.
+	CapAdd []string
 }
 
 type PortMapping struct {
 	Host      int
 	Container int
+	Protocol  string // "tcp" (default) or "udp"
+}
+
+// publishArg renders the mapping as a loopback-only --publish value.
+func (pm PortMapping) publishArg() string {
+	arg := fmt.Sprintf("127.0.0.1:%d:%d", pm.Host, pm.Container)
+	if pm.Protocol == "udp" {
+		arg += "/udp"
+	}
+	return arg
 }
 
 type VolumeMapping struct {
@@ -205,8 +226,7 @@ func buildRunArgs(spec ContainerCreateSpec) []string {
 	}
 
 	for _, port := range spec.Ports {
-		args = append(args, "--publish",
-			fmt.Sprintf("127.0.0.1:%d:%d", port.Host, port.Container))
+		args = append(args, "--publish", port.publishArg())
 	}
 
 	for _, volume := range spec.Volumes {
@@ -232,6 +252,13 @@ func buildRunArgs(spec ContainerCreateSpec) []string {
 		args = append(args, "--network", spec.NetworkMode)
 	}
 
+	for _, device := range spec.Devices {
+		args = append(args, "--device", device)
+	}
+	for _, capName := range spec.CapAdd {
+		args = append(args, "--cap-add", capName)
+	}
+
 	if spec.RestartPolicy != "" {
 		args = append(args, "--restart", spec.RestartPolicy)
 	}
@@ -249,8 +276,7 @@ func (p *PodmanCLI) CreateContainer(ctx context.Context, spec ContainerCreateSpe
 
 	// Execute command using exec.CommandContext (no shell interpretation)
 	args := buildRunArgs(spec)
-	cmd := exec.CommandContext(ctx, "podman", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, args...)
 
 	if err != nil {
 		outStr := string(output)
@@ -285,8 +311,7 @@ func (p *PodmanCLI) StartContainer(ctx context.Context, containerID string) erro
 		return fmt.Errorf("invalid container ID format: %s", containerID)
 	}
 
-	cmd := exec.CommandContext(ctx, "podman", "start", containerID)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, "start", containerID)
 
 	if err != nil {
 		return fmt.Errorf("podman start failed: %w, output: %s", err, string(output))
@@ -301,8 +326,7 @@ func (p *PodmanCLI) StopContainer(ctx context.Context, containerID string) error
 		return fmt.Errorf("invalid container ID format: %s", containerID)
 	}
 
-	cmd := exec.CommandContext(ctx, "podman", "stop", containerID)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, "stop", containerID)
 
 	if err != nil {
 		return fmt.Errorf("podman stop failed: %w, output: %s", err, string(output))
@@ -311,14 +335,43 @@ func (p *PodmanCLI) StopContainer(ctx context.Context, containerID string) error
 	return nil
 }
 
+// PauseContainer freezes a running container's processes in place.
+func (p *PodmanCLI) PauseContainer(ctx context.Context, containerID string) error {
+	if !isValidContainerID(containerID) {
+		return fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+
+	output, err := combinedPodman(ctx, "pause", containerID)
+
+	if err != nil {
+		return fmt.Errorf("podman pause failed: %w, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// UnpauseContainer resumes a paused container.
+func (p *PodmanCLI) UnpauseContainer(ctx context.Context, containerID string) error {
+	if !isValidContainerID(containerID) {
+		return fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+
+	output, err := combinedPodman(ctx, "unpause", containerID)
+
+	if err != nil {
+		return fmt.Errorf("podman unpause failed: %w, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
 // RemoveContainer removes a container by validated ID
 func (p *PodmanCLI) RemoveContainer(ctx context.Context, containerID string) error {
 	if !isValidContainerID(containerID) {
 		return fmt.Errorf("invalid container ID format: %s", containerID)
 	}
 
-	cmd := exec.CommandContext(ctx, "podman", "rm", containerID)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, "rm", containerID)
 
 	if err != nil {
 		return fmt.Errorf("podman rm failed: %w, output: %s", err, string(output))
@@ -327,19 +380,29 @@ func (p *PodmanCLI) RemoveContainer(ctx context.Context, containerID string) err
 	return nil
 }
 
-// PullImage pulls an image by name
-func (p *PodmanCLI) PullImage(ctx context.Context, image string) error {
-	if err := ValidateContainerName(image); err != nil {
-		return fmt.Errorf("invalid image name: %w", err)
+// RenameContainer gives a container a new validated name.
+func (p *PodmanCLI) RenameContainer(ctx context.Context, containerID, name string) error {
+	if !isValidContainerID(containerID) {
+		return fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+	if err := ValidateContainerName(name); err != nil {
+		return err
 	}
-	cmd := exec.CommandContext(ctx, "podman", "pull", image)
-	output, err := cmd.CombinedOutput()
+
+	output, err := combinedPodman(ctx, "rename", containerID, name)
+
 	if err != nil {
-		return fmt.Errorf("podman pull failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("podman rename failed: %w, output: %s", err, string(output))
 	}
+
 	return nil
 }
 
+// PullImage pulls an image by name
+func (p *PodmanCLI) PullImage(ctx context.Context, image string) error {
+	return p.PullImageProgress(ctx, image, nil)
+}
+
 // Logs returns recent log lines from a container
 func (p *PodmanCLI) Logs(ctx context.Context, containerID string, lines int) ([]string, error) {
 	if !isValidContainerID(containerID) {
@@ -350,8 +413,7 @@ func (p *PodmanCLI) Logs(ctx context.Context, containerID string, lines int) ([]
 	}
 	args := []string{"logs", "--tail", fmt.Sprintf("%d", lines)}
 	args = append(args, containerID)
-	cmd := exec.CommandContext(ctx, "podman", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, args...)
 	if err != nil {
 		return nil, fmt.Errorf("podman logs failed: %w, output: %s", err, string(output))
 	}
@@ -366,20 +428,162 @@ func (p *PodmanCLI) Logs(ctx context.Context, containerID string, lines int) ([]
 	return linesOut, nil
 }
 
+// ErrExecTimeout is returned when a command run by Exec outlives its timeout.
+var ErrExecTimeout = errors.New("exec timed out")
+
+// ExecOutputLimit caps how much trailing output Exec keeps.
+const ExecOutputLimit = 4096
+
+// ExecResult is the outcome of a command run inside a container.
+type ExecResult struct {
+	ExitCode int
+	// Output is the tail of combined stdout and stderr.
+	Output string
+}
+
+// Exec runs argv inside a running container and waits up to timeout for it.
+// A non-zero exit is reported in the result, not as an error. On timeout the
+// podman exec process is killed and ErrExecTimeout returned; podman does not
+// forward the kill, so a command ignoring its closed streams may linger in
+// the container.
+func (p *PodmanCLI) Exec(ctx context.Context, containerID string, argv []string, timeout time.Duration) (ExecResult, error) {
+	if !isValidContainerID(containerID) {
+		return ExecResult{}, fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+	if len(argv) == 0 || argv[0] == "" {
+		return ExecResult{}, fmt.Errorf("exec command is required")
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	out := &tailBuffer{limit: ExecOutputLimit}
+	args := append([]string{"exec", containerID}, argv...)
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	res := ExecResult{Output: out.String()}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return res, fmt.Errorf("%w after %s", ErrExecTimeout, timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	if err != nil {
+		return res, fmt.Errorf("podman exec failed: %w", err)
+	}
+	return res, nil
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	limit int
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string { return string(b.buf) }
+
+// ContainerRunning reports whether podman sees the container as running
+func (p *PodmanCLI) ContainerRunning(ctx context.Context, containerID string) (bool, error) {
+	if !isValidContainerID(containerID) {
+		return false, fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+	output, err := combinedPodman(ctx, "inspect", "--format", "{{.State.Running}}", containerID)
+	if err != nil {
+		return false, fmt.Errorf("podman inspect failed: %w, output: %s", err, string(output))
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
+// ContainerState is the runtime state Podman reports for a container.
+type ContainerState struct {
+	Status     string    `json:"status"`
+	Running    bool      `json:"running"`
+	Paused     bool      `json:"paused"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	OOMKilled  bool      `json:"oom_killed"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Inspect returns the container's runtime state, including why it last
+// exited.
+func (p *PodmanCLI) Inspect(ctx context.Context, containerID string) (ContainerState, error) {
+	if !isValidContainerID(containerID) {
+		return ContainerState{}, fmt.Errorf("invalid container ID format: %s", containerID)
+	}
+	output, err := outputPodman(ctx, "container", "inspect", containerID)
+	if err != nil {
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		if strings.Contains(strings.ToLower(stderr), "no such container") {
+			return ContainerState{}, ErrContainerNotFound(containerID)
+		}
+		return ContainerState{}, fmt.Errorf("podman inspect failed: %w, output: %s", err, stderr)
+	}
+	return parseInspectState(output)
+}
+
+// parseInspectState reads the State block of `podman container inspect`.
+func parseInspectState(output []byte) (ContainerState, error) {
+	var records []struct {
+		State struct {
+			Status     string    `json:"Status"`
+			Running    bool      `json:"Running"`
+			Paused     bool      `json:"Paused"`
+			ExitCode   int       `json:"ExitCode"`
+			Error      string    `json:"Error"`
+			OOMKilled  bool      `json:"OOMKilled"`
+			StartedAt  time.Time `json:"StartedAt"`
+			FinishedAt time.Time `json:"FinishedAt"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(output, &records); err != nil {
+		return ContainerState{}, fmt.Errorf("parse podman inspect output: %w", err)
+	}
+	if len(records) == 0 {
+		return ContainerState{}, fmt.Errorf("podman inspect returned no containers")
+	}
+	st := records[0].State
+	return ContainerState{
+		Status:     st.Status,
+		Running:    st.Running,
+		Paused:     st.Paused || st.Status == "paused",
+		ExitCode:   st.ExitCode,
+		Error:      st.Error,
+		OOMKilled:  st.OOMKilled,
+		StartedAt:  st.StartedAt,
+		FinishedAt: st.FinishedAt,
+	}, nil
+}
+
 // UpdatePublishAdd adds a port publish mapping to a running container
-func (p *PodmanCLI) UpdatePublishAdd(ctx context.Context, containerID string, hostBind, guestPort int) error {
+func (p *PodmanCLI) UpdatePublishAdd(ctx context.Context, containerID string, port PortMapping) error {
 	if !isValidContainerID(containerID) {
 		return fmt.Errorf("invalid container ID format: %s", containerID)
 	}
-	if err := ValidatePort(hostBind); err != nil {
+	if err := ValidatePort(port.Host); err != nil {
 		return err
 	}
-	if err := ValidatePort(guestPort); err != nil {
+	if err := ValidatePort(port.Container); err != nil {
 		return err
 	}
-	mapping := fmt.Sprintf("127.0.0.1:%d:%d", hostBind, guestPort)
-	cmd := exec.CommandContext(ctx, "podman", "container", "update", "--publish-add", mapping, containerID)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, "container", "update", "--publish-add", port.publishArg(), containerID)
 	if err != nil {
 		return fmt.Errorf("podman update --publish-add failed: %w, output: %s", err, string(output))
 	}
@@ -387,25 +591,49 @@ func (p *PodmanCLI) UpdatePublishAdd(ctx context.Context, containerID string, ho
 }
 
 // UpdatePublishRemove removes a port publish mapping from a running container
-func (p *PodmanCLI) UpdatePublishRemove(ctx context.Context, containerID string, hostBind, guestPort int) error {
+func (p *PodmanCLI) UpdatePublishRemove(ctx context.Context, containerID string, port PortMapping) error {
 	if !isValidContainerID(containerID) {
 		return fmt.Errorf("invalid container ID format: %s", containerID)
 	}
-	if err := ValidatePort(hostBind); err != nil {
+	if err := ValidatePort(port.Host); err != nil {
 		return err
 	}
-	if err := ValidatePort(guestPort); err != nil {
+	if err := ValidatePort(port.Container); err != nil {
 		return err
 	}
-	mapping := fmt.Sprintf("127.0.0.1:%d:%d", hostBind, guestPort)
-	cmd := exec.CommandContext(ctx, "podman", "container", "update", "--publish-rm", mapping, containerID)
-	output, err := cmd.CombinedOutput()
+	output, err := combinedPodman(ctx, "container", "update", "--publish-rm", port.publishArg(), containerID)
 	if err != nil {
 		return fmt.Errorf("podman update --publish-rm failed: %w, output: %s", err, string(output))
 	}
 	return nil
 }
 
+// publishUpdateProbe caches whether the installed Podman supports
+// `podman container update --publish-add`.
+var publishUpdateProbe struct {
+	once      sync.Once
+	supported bool
+}
+
+// PublishUpdateSupported reports whether Podman can change a container's
+// published ports in place. It reads the `podman container update` help
+// once per process.
+func (p *PodmanCLI) PublishUpdateSupported(ctx context.Context) bool {
+	publishUpdateProbe.once.Do(func() {
+		pctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		output, err := exec.CommandContext(pctx, "podman", "container", "update", "--help").CombinedOutput()
+		publishUpdateProbe.supported = err == nil && strings.Contains(string(output), "--publish-add")
+	})
+	return publishUpdateProbe.supported
+}
+
+// PublishedPorts returns the container's published ports as guest port to
+// host port.
+func (p *PodmanCLI) PublishedPorts(ctx context.Context, containerID string) (map[int]int, error) {
+	return InspectPublishedPorts(ctx, containerID)
+}
+
 // isValidContainerID validates container ID format
 func isValidContainerID(id string) bool {
 	// Container IDs are typically 64-character hex strings (may be shortened)
@@ -441,6 +669,9 @@ func ValidateContainerSpec(spec ContainerCreateSpec) error {
 		if err := ValidatePort(port.Container); err != nil {
 			return fmt.Errorf("invalid container port at index %d: %w", i, err)
 		}
+		if port.Protocol != "" && port.Protocol != "tcp" && port.Protocol != "udp" {
+			return fmt.Errorf("invalid port protocol at index %d: %q", i, port.Protocol)
+		}
 	}
 
 	// Validate volumes
@@ -451,6 +682,15 @@ func ValidateContainerSpec(spec ContainerCreateSpec) error {
 		if err := ValidatePath(volume.Container); err != nil {
 			return fmt.Errorf("invalid container path at index %d: %w", i, err)
 		}
+		if volume.Options != "" {
+			for _, opt := range strings.Split(volume.Options, ",") {
+				switch opt {
+				case "ro", "rw", "z", "Z":
+				default:
+					return fmt.Errorf("invalid volume option at index %d: %q", i, opt)
+				}
+			}
+		}
 	}
 
 	// Validate environment variables
@@ -463,6 +703,20 @@ func ValidateContainerSpec(spec ContainerCreateSpec) error {
 		}
 	}
 
+	for i, device := range spec.Devices {
+		if err := ValidatePath(device); err != nil || !strings.HasPrefix(device, "/dev/") {
+			return fmt.Errorf("invalid device at index %d: %q", i, device)
+		}
+	}
+	for i, capName := range spec.CapAdd {
+		if !capNamePattern.MatchString(capName) {
+			return fmt.Errorf("invalid capability at index %d: %q", i, capName)
+		}
+	}
+	if spec.NetworkMode == "host" && len(spec.Ports) > 0 {
+		return fmt.Errorf("ports cannot be published on the host network")
+	}
+
 	// Validate resources
 	if spec.Resources.Memory != "" {
 		if err := ValidateResource(spec.Resources.Memory); err != nil {
@@ -3,6 +3,7 @@ package container
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -373,3 +374,80 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestBuildRunArgsPublishesUDPMappings(t *testing.T) {
+	spec := ContainerCreateSpec{
+		Name:  "wireguard",
+		Image: "docker.io/linuxserver/wireguard:latest",
+		Ports: []PortMapping{
+			{Host: 15001, Container: 8080},
+			{Host: 15002, Container: 51820, Protocol: "udp"},
+		},
+	}
+	args := strings.Join(buildRunArgs(spec), " ")
+	if !strings.Contains(args, "--publish 127.0.0.1:15001:8080 ") {
+		t.Fatalf("expected tcp mapping without suffix, got %s", args)
+	}
+	if !strings.Contains(args, "--publish 127.0.0.1:15002:51820/udp") {
+		t.Fatalf("expected udp mapping with /udp suffix, got %s", args)
+	}
+	spec.Ports[1].Protocol = "sctp"
+	if err := ValidateContainerSpec(spec); err == nil {
+		t.Fatalf("expected unsupported protocol to be rejected")
+	}
+}
+
+func TestBuildRunArgsPassesDevicesAndCapabilities(t *testing.T) {
+	spec := ContainerCreateSpec{
+		Name:        "vpn",
+		Image:       "docker.io/qmcgaw/gluetun:latest",
+		NetworkMode: "host",
+		Devices:     []string{"/dev/net/tun"},
+		CapAdd:      []string{"NET_ADMIN"},
+	}
+	if err := ValidateContainerSpec(spec); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	args := strings.Join(buildRunArgs(spec), " ")
+	for _, want := range []string{"--network host", "--device /dev/net/tun", "--cap-add NET_ADMIN"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("expected %q in %s", want, args)
+		}
+	}
+	for _, bad := range []ContainerCreateSpec{
+		{Name: "vpn", Image: "x", Devices: []string{"/etc/passwd"}},
+		{Name: "vpn", Image: "x", CapAdd: []string{"net_admin --privileged"}},
+		{Name: "vpn", Image: "x", NetworkMode: "host", Ports: []PortMapping{{Host: 15001, Container: 80}}},
+	} {
+		if err := ValidateContainerSpec(bad); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestParseInspectState(t *testing.T) {
+	out := []byte(`[{"Id":"abc","State":{"OciVersion":"1.1.0","Status":"exited","Running":false,"OOMKilled":true,"ExitCode":137,"Error":"","StartedAt":"2025-03-01T10:00:00.123456789Z","FinishedAt":"2025-03-01T10:05:00Z"}}]`)
+	st, err := parseInspectState(out)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if st.Status != "exited" || st.Running || st.ExitCode != 137 || !st.OOMKilled {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+	if st.FinishedAt.Sub(st.StartedAt) <= 4*time.Minute {
+		t.Fatalf("timestamps not parsed: %+v", st)
+	}
+
+	failed := []byte(`[{"State":{"Status":"created","ExitCode":127,"Error":"crun: executable file not found in $PATH: OCI runtime attempted to invoke a command that was not found","StartedAt":"0001-01-01T00:00:00Z","FinishedAt":"0001-01-01T00:00:00Z"}}]`)
+	st, err = parseInspectState(failed)
+	if err != nil {
+		t.Fatalf("parse failed start: %v", err)
+	}
+	if st.ExitCode != 127 || !strings.Contains(st.Error, "OCI runtime") || !st.StartedAt.IsZero() {
+		t.Fatalf("unexpected failed state: %+v", st)
+	}
+
+	if _, err := parseInspectState([]byte(`[]`)); err == nil {
+		t.Fatalf("expected error for empty inspect output")
+	}
+}
@@ -0,0 +1,159 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Pull stages reported while podman pulls an image.
+const (
+	PullStageResolving = "resolving"
+	PullStageCopying   = "copying"
+	PullStageWriting   = "writing"
+	PullStageDone      = "done"
+)
+
+// pullKillGrace bounds how long a killed pull may keep its output pipes open.
+const pullKillGrace = 5 * time.Second
+
+// PullProgress is a snapshot of a running pull parsed from podman output.
+// BlobsTotal counts the layers seen so far; podman does not announce the
+// total up front in non-interactive mode.
+type PullProgress struct {
+	Stage      string
+	BlobsDone  int
+	BlobsTotal int
+	Line       string
+}
+
+// pullProgressParser turns podman pull output lines into progress updates.
+type pullProgressParser struct {
+	seen map[string]bool
+	done map[string]bool
+	last PullProgress
+}
+
+func newPullProgressParser() *pullProgressParser {
+	return &pullProgressParser{seen: make(map[string]bool), done: make(map[string]bool)}
+}
+
+// feed consumes one output line and reports whether the progress changed.
+func (p *pullProgressParser) feed(line string) (PullProgress, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return p.last, false
+	}
+	next := p.last
+	next.Line = line
+	fields := strings.Fields(line)
+	switch {
+	case strings.HasPrefix(line, "Trying to pull"), strings.HasPrefix(line, "Resolving"):
+		next.Stage = PullStageResolving
+	case strings.HasPrefix(line, "Getting image source signatures"):
+		next.Stage = PullStageCopying
+	case strings.HasPrefix(line, "Copying blob") && len(fields) >= 3:
+		next.Stage = PullStageCopying
+		id := strings.TrimPrefix(fields[2], "sha256:")
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		p.seen[id] = true
+		if strings.Contains(line, " done") || strings.Contains(line, "skipped") || strings.Contains(line, "already exists") {
+			p.done[id] = true
+		}
+	case strings.HasPrefix(line, "Copying config"):
+		next.Stage = PullStageCopying
+	case strings.HasPrefix(line, "Writing manifest"), strings.HasPrefix(line, "Storing signatures"):
+		next.Stage = PullStageWriting
+	default:
+		return p.last, false
+	}
+	next.BlobsTotal = len(p.seen)
+	next.BlobsDone = len(p.done)
+	p.last = next
+	return next, true
+}
+
+// ImageExists reports whether image is already in the local store.
+func (p *PodmanCLI) ImageExists(ctx context.Context, image string) (bool, error) {
+	if err := ValidateContainerName(image); err != nil {
+		return false, fmt.Errorf("invalid image name: %w", err)
+	}
+	output, err := combinedPodman(ctx, "image", "exists", image)
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && ctx.Err() == nil {
+		return false, nil
+	}
+	return false, fmt.Errorf("podman image exists failed: %w, output: %s", err, string(output))
+}
+
+// PullImageProgress pulls image and calls report as podman prints progress.
+// Canceling ctx kills the podman process.
+func (p *PodmanCLI) PullImageProgress(ctx context.Context, image string, report func(PullProgress)) error {
+	if err := ValidateContainerName(image); err != nil {
+		return fmt.Errorf("invalid image name: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, "podman", "pull", image)
+	cmd.WaitDelay = pullKillGrace
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	var tail []string
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		parser := newPullProgressParser()
+		scanner := bufio.NewScanner(pr)
+		scanner.Split(scanPullLines)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if tail = append(tail, line); len(tail) > 20 {
+				tail = tail[1:]
+			}
+			if progress, ok := parser.feed(line); ok && report != nil {
+				report(progress)
+			}
+		}
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-scanned
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("podman pull %s: %w", image, ctx.Err())
+		}
+		return fmt.Errorf("podman pull failed: %w, output: %s", err, strings.Join(tail, "\n"))
+	}
+	if report != nil {
+		report(PullProgress{Stage: PullStageDone})
+	}
+	return nil
+}
+
+// scanPullLines splits on either newline or carriage return, since podman
+// redraws progress lines in place when it thinks it has a terminal.
+func scanPullLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
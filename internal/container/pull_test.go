@@ -0,0 +1,119 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPullProgressParser(t *testing.T) {
+	output := `Trying to pull docker.io/library/alpine:latest...
+Getting image source signatures
+Copying blob sha256:59bf1c3509f33515622619af21ed55bbe26d24913cedbca106468a5fb37a50c3
+Copying blob 8a49fdb3b6a5 skipped: already exists
+Copying blob 59bf1c3509f3 done   |
+Copying config c1aabb73d233 done   |
+Writing manifest to image destination
+c1aabb73d2339c5ebaa3681de2e9d9c18d57485045a4e311d9f8004bec208d67`
+	parser := newPullProgressParser()
+	var updates []PullProgress
+	for _, line := range strings.Split(output, "\n") {
+		if p, ok := parser.feed(line); ok {
+			updates = append(updates, p)
+		}
+	}
+	if len(updates) != 7 {
+		t.Fatalf("expected 7 progress updates, got %d: %+v", len(updates), updates)
+	}
+	if updates[0].Stage != PullStageResolving {
+		t.Fatalf("first stage = %q", updates[0].Stage)
+	}
+	copying := updates[4]
+	if copying.Stage != PullStageCopying || copying.BlobsTotal != 2 || copying.BlobsDone != 2 {
+		t.Fatalf("after blobs: %+v", copying)
+	}
+	if last := updates[len(updates)-1]; last.Stage != PullStageWriting {
+		t.Fatalf("last stage = %q", last.Stage)
+	}
+}
+
+// installFakePodman puts a podman script first on PATH.
+func installFakePodman(t *testing.T, script string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "fake-podman")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.WriteFile(filepath.Join(dir, "podman"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write fake podman: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPodmanCLI_PullImageProgressCancelKillsPodman(t *testing.T) {
+	dir := installFakePodman(t, `echo $$ > "$(dirname "$0")/pid"
+echo "Trying to pull docker.io/library/alpine:latest..."
+echo "Copying blob 59bf1c3509f3"
+exec sleep 60
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := make(chan PullProgress, 8)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- (&PodmanCLI{}).PullImageProgress(ctx, "alpine:latest", func(p PullProgress) { progress <- p })
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for copying := false; !copying; {
+		select {
+		case p := <-progress:
+			copying = p.Stage == PullStageCopying && p.BlobsTotal == 1
+		case <-deadline:
+			t.Fatalf("no copying progress from fake pull")
+		}
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatalf("read pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatalf("parse pid: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(pullKillGrace + time.Second):
+		t.Fatalf("pull did not return after cancel")
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("podman process %d still alive after cancel: %v", pid, err)
+	}
+}
+
+func TestPodmanCLI_ImageExists(t *testing.T) {
+	installFakePodman(t, `[ "$3" = "alpine:latest" ] && exit 0
+exit 1
+`)
+	p := &PodmanCLI{}
+	ctx := context.Background()
+	if ok, err := p.ImageExists(ctx, "alpine:latest"); err != nil || !ok {
+		t.Fatalf("present image: ok=%v err=%v", ok, err)
+	}
+	if ok, err := p.ImageExists(ctx, "nginx:latest"); err != nil || ok {
+		t.Fatalf("missing image: ok=%v err=%v", ok, err)
+	}
+}
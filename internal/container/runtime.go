@@ -0,0 +1,134 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RuntimeInfo describes the Podman installation answering Ping.
+type RuntimeInfo struct {
+	Version    string `json:"version"`
+	APIVersion string `json:"api_version,omitempty"`
+	Rootless   bool   `json:"rootless"`
+	// SocketPath is the API socket Podman reports, whether or not the
+	// service behind it is running.
+	SocketPath string `json:"socket_path,omitempty"`
+}
+
+// podmanRetryBackoff is the wait before each retry of a podman command that
+// failed to reach the runtime; a restarting Podman refuses connections for
+// a moment.
+var podmanRetryBackoff = []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second}
+
+// transientPodmanOutput marks podman failures that mean the runtime could
+// not be reached rather than that the command was rejected.
+var transientPodmanOutput = []string{
+	"connection refused",
+	"cannot connect to podman",
+	"unable to connect to podman",
+	"connection reset by peer",
+}
+
+// isTransientPodmanError reports whether a failed podman command is worth
+// retrying. output is what the command printed; stderr captured by
+// exec.Cmd.Output is checked as well.
+func isTransientPodmanError(output []byte, err error) bool {
+	if err == nil {
+		return false
+	}
+	text := strings.ToLower(string(output))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		text += strings.ToLower(string(exitErr.Stderr))
+	}
+	for _, marker := range transientPodmanOutput {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPodman runs a podman command, running it again after a short wait
+// while it fails to reach the runtime. run must build a fresh command each
+// time. The last attempt's result is returned.
+func retryPodman(ctx context.Context, run func() ([]byte, error)) ([]byte, error) {
+	output, err := run()
+	for _, wait := range podmanRetryBackoff {
+		if !isTransientPodmanError(output, err) || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return output, err
+		}
+		output, err = run()
+	}
+	return output, err
+}
+
+// combinedPodman runs podman with args and returns its combined output,
+// retrying while the runtime is unreachable.
+func combinedPodman(ctx context.Context, args ...string) ([]byte, error) {
+	return retryPodman(ctx, func() ([]byte, error) {
+		return exec.CommandContext(ctx, "podman", args...).CombinedOutput()
+	})
+}
+
+// outputPodman is combinedPodman for commands whose stdout is parsed; stderr
+// stays on the returned *exec.ExitError.
+func outputPodman(ctx context.Context, args ...string) ([]byte, error) {
+	return retryPodman(ctx, func() ([]byte, error) {
+		return exec.CommandContext(ctx, "podman", args...).Output()
+	})
+}
+
+// Ping asks Podman for its version and host details. It fails when the
+// runtime cannot be reached after the usual retries.
+func (p *PodmanCLI) Ping(ctx context.Context) (RuntimeInfo, error) {
+	output, err := outputPodman(ctx, "info", "--format", "json")
+	if err != nil {
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return RuntimeInfo{}, fmt.Errorf("podman info failed: %w, output: %s", err, stderr)
+	}
+	return parsePodmanInfo(output)
+}
+
+// parsePodmanInfo reads the fields Ping reports from `podman info`.
+func parsePodmanInfo(output []byte) (RuntimeInfo, error) {
+	var info struct {
+		Host struct {
+			Security struct {
+				Rootless bool `json:"rootless"`
+			} `json:"security"`
+			RemoteSocket struct {
+				Path string `json:"path"`
+			} `json:"remoteSocket"`
+		} `json:"host"`
+		Version struct {
+			Version    string `json:"Version"`
+			APIVersion string `json:"APIVersion"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return RuntimeInfo{}, fmt.Errorf("parse podman info output: %w", err)
+	}
+	if info.Version.Version == "" {
+		return RuntimeInfo{}, fmt.Errorf("podman info reported no version")
+	}
+	return RuntimeInfo{
+		Version:    info.Version.Version,
+		APIVersion: info.Version.APIVersion,
+		Rootless:   info.Host.Security.Rootless,
+		SocketPath: strings.TrimPrefix(info.Host.RemoteSocket.Path, "unix://"),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shortPodmanBackoff(t *testing.T) {
+	t.Helper()
+	prev := podmanRetryBackoff
+	podmanRetryBackoff = []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { podmanRetryBackoff = prev })
+}
+
+func TestPodmanCLI_PingRetriesWhileSocketRefuses(t *testing.T) {
+	shortPodmanBackoff(t)
+	// The first two calls find the socket down, as right after podman
+	// restarts.
+	dir := installFakePodman(t, `count="$(dirname "$0")/calls"
+n=$(($(cat "$count" 2>/dev/null || echo 0) + 1))
+echo $n > "$count"
+if [ $n -le 2 ]; then
+  echo 'Cannot connect to Podman: dial unix /run/podman/podman.sock: connect: connection refused' >&2
+  exit 125
+fi
+echo '{"host":{"security":{"rootless":false},"remoteSocket":{"path":"unix:///run/podman/podman.sock"}},"version":{"Version":"5.2.1","APIVersion":"5.2.1"}}'
+`)
+	info, err := (&PodmanCLI{}).Ping(context.Background())
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	want := RuntimeInfo{Version: "5.2.1", APIVersion: "5.2.1", SocketPath: "/run/podman/podman.sock"}
+	if info != want {
+		t.Fatalf("ping = %+v, want %+v", info, want)
+	}
+	calls, _ := os.ReadFile(filepath.Join(dir, "calls"))
+	if strings.TrimSpace(string(calls)) != "3" {
+		t.Fatalf("expected 3 podman calls, got %q", calls)
+	}
+}
+
+func TestPodmanCLI_RetriesStopOnPersistentOrPermanentFailure(t *testing.T) {
+	shortPodmanBackoff(t)
+	dir := installFakePodman(t, `count="$(dirname "$0")/calls"
+echo $(($(cat "$count" 2>/dev/null || echo 0) + 1)) > "$count"
+case "$1" in
+info) echo 'connect: connection refused' >&2 ;;
+*) echo 'Error: no container with name or ID "abcdef123456" found' ;;
+esac
+exit 125
+`)
+	readCalls := func() string {
+		calls, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		os.Remove(filepath.Join(dir, "calls"))
+		return strings.TrimSpace(string(calls))
+	}
+	p := &PodmanCLI{}
+	if _, err := p.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected the refused connection to surface, got %v", err)
+	}
+	if got := readCalls(); got != "4" {
+		t.Fatalf("expected 1 call and 3 retries, got %s", got)
+	}
+	if err := p.StartContainer(context.Background(), "abcdef123456"); err == nil {
+		t.Fatalf("expected start to fail")
+	}
+	if got := readCalls(); got != "1" {
+		t.Fatalf("a rejected command must not be retried, got %s calls", got)
+	}
+}
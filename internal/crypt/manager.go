@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 
 	"piccolod/internal/state/paths"
@@ -48,6 +49,9 @@ type Manager struct {
 var (
 	ErrNotInitialized = errors.New("crypt: not initialized")
 	ErrLocked         = errors.New("crypt: locked")
+	// ErrInvalidRecoveryKey is returned when a recovery key does not open the
+	// keyset, including when none has been generated.
+	ErrInvalidRecoveryKey = errors.New("crypt: invalid recovery key")
 )
 
 func NewManager(stateDir string) (*Manager, error) {
@@ -151,8 +155,7 @@ func (m *Manager) Setup(password string) error {
 		Nonce: base64.RawStdEncoding.EncodeToString(nonce),
 		KDF:   params,
 	}
-	b, _ := json.MarshalIndent(&st, "", "  ")
-	if err := os.WriteFile(m.path, b, 0o600); err != nil {
+	if err := m.writeState(&st); err != nil {
 		return err
 	}
 	m.inited = true
@@ -287,12 +290,7 @@ func (m *Manager) Rewrap(oldPassword, newPassword string) error {
 	st.SDEK = base64.RawStdEncoding.EncodeToString(newCT)
 	st.Salt = base64.RawStdEncoding.EncodeToString(newSalt)
 	st.Nonce = base64.RawStdEncoding.EncodeToString(newNonce)
-	// Save
-	nb, _ := json.MarshalIndent(&st, "", "  ")
-	if err := os.WriteFile(m.path, nb, 0o600); err != nil {
-		return err
-	}
-	return nil
+	return m.writeState(&st)
 }
 
 // RewrapUnlocked reseals the in-memory SDEK with a new password without
@@ -341,11 +339,7 @@ func (m *Manager) RewrapUnlocked(newPassword string) error {
 	st.SDEK = base64.RawStdEncoding.EncodeToString(newCT)
 	st.Salt = base64.RawStdEncoding.EncodeToString(newSalt)
 	st.Nonce = base64.RawStdEncoding.EncodeToString(newNonce)
-	nb, err := json.MarshalIndent(&st, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(m.path, nb, 0o600)
+	return m.writeState(&st)
 }
 
 // Recovery key management
@@ -409,9 +403,7 @@ func (m *Manager) GenerateRecoveryKey(force bool) ([]string, error) {
 	st.RKSalt = base64.RawStdEncoding.EncodeToString(rkSalt)
 	st.RKNonce = base64.RawStdEncoding.EncodeToString(rkNonce)
 	st.SDEKRK = base64.RawStdEncoding.EncodeToString(rkCT)
-	// Save
-	nb, _ := json.MarshalIndent(&st, "", "  ")
-	if err := os.WriteFile(m.path, nb, 0o600); err != nil {
+	if err := m.writeState(&st); err != nil {
 		return nil, err
 	}
 	return words, nil
@@ -475,8 +467,7 @@ func (m *Manager) GenerateRecoveryKeyWithPassword(password string, force bool) (
 	st.RKSalt = base64.RawStdEncoding.EncodeToString(rkSalt)
 	st.RKNonce = base64.RawStdEncoding.EncodeToString(rkNonce)
 	st.SDEKRK = base64.RawStdEncoding.EncodeToString(rkCT)
-	nb, _ := json.MarshalIndent(&st, "", "  ")
-	if err := os.WriteFile(m.path, nb, 0o600); err != nil {
+	if err := m.writeState(&st); err != nil {
 		return nil, err
 	}
 	return words, nil
@@ -520,19 +511,148 @@ func (m *Manager) UnlockWithRecoveryKey(words []string) error {
 	if err := json.Unmarshal(b, &st); err != nil {
 		return err
 	}
+	pt, err := m.openWithRecoveryKey(&st, mn)
+	if err != nil {
+		return err
+	}
+	m.sdek = pt
+	return nil
+}
+
+// openWithRecoveryKey returns the SDEK sealed under the recovery key.
+func (m *Manager) openWithRecoveryKey(st *fileState, mnemonic string) ([]byte, error) {
 	if st.SDEKRK == "" {
-		return errors.New("recovery key not set")
+		return nil, fmt.Errorf("%w: recovery key not set", ErrInvalidRecoveryKey)
 	}
 	rkSalt, _ := base64.RawStdEncoding.DecodeString(st.RKSalt)
-	rkKey := m.deriveKey(mn, rkSalt, st.KDF)
-	block, _ := aes.NewCipher(rkKey)
-	aead, _ := cipher.NewGCM(block)
+	rkKey := m.deriveKey(mnemonic, rkSalt, st.KDF)
+	block, err := aes.NewCipher(rkKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
 	rkNonce, _ := base64.RawStdEncoding.DecodeString(st.RKNonce)
 	rkCT, _ := base64.RawStdEncoding.DecodeString(st.SDEKRK)
 	pt, err := aead.Open(nil, rkNonce, rkCT, nil)
 	if err != nil {
-		return errors.New("invalid recovery key")
+		return nil, ErrInvalidRecoveryKey
+	}
+	return pt, nil
+}
+
+// ResetPassword opens the SDEK with the recovery key and reseals it under
+// newPassword. The SDEK is preserved, so volume keys wrapped under it stay
+// valid and nothing outside the keyset is rewritten; the recovery wrapper is
+// kept too. The keyset is replaced atomically, so a crash leaves either the
+// old or the new password in effect and the reset can simply be repeated.
+// The lock state is unchanged.
+func (m *Manager) ResetPassword(words []string, newPassword string) error {
+	if len(words) == 0 {
+		return errors.New("recovery_key required")
+	}
+	if newPassword == "" {
+		return errors.New("password required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.inited {
+		return ErrNotInitialized
+	}
+	st, err := m.readState()
+	if err != nil {
+		return err
+	}
+	sdek, err := m.openWithRecoveryKey(&st, strings.Join(words, " "))
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(sdek)
+	if err := m.sealPassword(&st, newPassword, sdek); err != nil {
+		return err
+	}
+	return m.writeState(&st)
+}
+
+func (m *Manager) readState() (fileState, error) {
+	var st fileState
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, err
+	}
+	if st.KDF.Alg != "argon2id" {
+		return st, fmt.Errorf("unsupported kdf: %s", st.KDF.Alg)
+	}
+	return st, nil
+}
+
+// sealPassword seals sdek under password with a fresh salt and nonce.
+func (m *Manager) sealPassword(st *fileState, password string, sdek []byte) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(m.deriveKey(password, salt, st.KDF))
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	st.SDEK = base64.RawStdEncoding.EncodeToString(aead.Seal(nil, nonce, sdek, nil))
+	st.Salt = base64.RawStdEncoding.EncodeToString(salt)
+	st.Nonce = base64.RawStdEncoding.EncodeToString(nonce)
+	return nil
+}
+
+// writeState replaces the keyset through a synced temporary file, so a crash
+// never leaves a partially written keyset behind.
+func (m *Manager) writeState(st *fileState) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(m.path)
+	tmp, err := os.CreateTemp(dir, "keyset-*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
 	}
-	m.sdek = pt
 	return nil
 }
@@ -1,6 +1,8 @@
 package crypt
 
 import (
+	"bytes"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -65,3 +67,61 @@ func TestManager_GenerateRecoveryKeyRotation(t *testing.T) {
 		t.Fatalf("expected HasRecoveryKey to remain true after rotation")
 	}
 }
+
+func TestManager_ResetPasswordKeepsSDEK(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := m.Setup("old-secret"); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	words, err := m.GenerateRecoveryKeyWithPassword("old-secret", false)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryKeyWithPassword: %v", err)
+	}
+	if err := m.Unlock("old-secret"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	var before []byte
+	_ = m.WithSDEK(func(k []byte) error { before = append([]byte(nil), k...); return nil })
+	m.Lock()
+
+	wrong := append([]string(nil), words...)
+	wrong[0], wrong[1] = words[1], words[0]
+	if words[0] == words[1] {
+		wrong[0] = "not-a-word"
+	}
+	if err := m.ResetPassword(wrong, "new-secret"); !errors.Is(err, ErrInvalidRecoveryKey) {
+		t.Fatalf("expected ErrInvalidRecoveryKey for a wrong key, got %v", err)
+	}
+	if err := m.Unlock("old-secret"); err != nil {
+		t.Fatalf("old password should survive a rejected reset: %v", err)
+	}
+	m.Lock()
+
+	if err := m.ResetPassword(words, "new-secret"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !m.IsLocked() {
+		t.Fatalf("reset should not unlock the manager")
+	}
+	if err := m.Unlock("old-secret"); err == nil {
+		t.Fatalf("expected old password to fail after reset")
+	}
+	if err := m.Unlock("new-secret"); err != nil {
+		t.Fatalf("Unlock new password: %v", err)
+	}
+	var after []byte
+	_ = m.WithSDEK(func(k []byte) error { after = append([]byte(nil), k...); return nil })
+	if !bytes.Equal(before, after) {
+		t.Fatalf("reset must preserve the SDEK")
+	}
+	if !m.HasRecoveryKey() {
+		t.Fatalf("reset should keep the recovery key")
+	}
+	if err := m.UnlockWithRecoveryKey(words); err != nil {
+		t.Fatalf("recovery key after reset: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package diag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BundleFormatVersion changes whenever the layout of the bundle does, so
+// support tooling can tell old bundles apart.
+const BundleFormatVersion = 1
+
+// ManifestName is the first entry of every bundle.
+const ManifestName = "manifest.json"
+
+// Section is one subsystem's file in the bundle.
+type Section struct {
+	// Name becomes "<name>.json".
+	Name string
+	Data any
+}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	DaemonVersion string    `json:"daemon_version"`
+	Files         []string  `json:"files"`
+	// Errors lists sections that could not be collected; the bundle is
+	// still useful without them.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// WriteBundle writes a gzip-compressed tar holding the manifest followed by
+// one JSON file per section, each passed through san.
+func WriteBundle(w io.Writer, manifest Manifest, sections []Section, san *Sanitizer) error {
+	type entry struct {
+		name string
+		body []byte
+	}
+	entries := make([]entry, 0, len(sections))
+	manifest.FormatVersion = BundleFormatVersion
+	manifest.Files = append(manifest.Files[:0:0], ManifestName)
+	for _, sec := range sections {
+		clean, err := san.Value(sec.Data)
+		if err != nil {
+			return fmt.Errorf("sanitize %s: %w", sec.Name, err)
+		}
+		body, err := json.MarshalIndent(clean, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", sec.Name, err)
+		}
+		name := sec.Name + ".json"
+		entries = append(entries, entry{name: name, body: body})
+		manifest.Files = append(manifest.Files, name)
+	}
+	cleanManifest, err := san.Value(manifest)
+	if err != nil {
+		return fmt.Errorf("sanitize manifest: %w", err)
+	}
+	body, err := json.MarshalIndent(cleanManifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	entries = append([]entry{{name: ManifestName, body: body}}, entries...)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.body)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
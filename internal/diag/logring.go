@@ -0,0 +1,66 @@
+// Package diag collects diagnostics for support: an in-memory copy of the
+// daemon log and the redacted debug bundle built from it.
+package diag
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultLogLines is how many log entries the daemon keeps in memory.
+const DefaultLogLines = 2000
+
+// maxEntryLen bounds a single stored entry.
+const maxEntryLen = 64 * 1024
+
+// LogRing keeps the most recent log entries. It is an io.Writer so it can
+// sit beside stderr behind log.SetOutput. The standard logger emits each
+// message in one Write, so an entry is one message even when it spans
+// several lines; the sanitizer then sees a whole PEM block at once.
+type LogRing struct {
+	mu      sync.Mutex
+	entries []string
+	next    int
+	full    bool
+}
+
+// NewLogRing returns a ring holding up to capacity entries.
+func NewLogRing(capacity int) *LogRing {
+	if capacity <= 0 {
+		capacity = DefaultLogLines
+	}
+	return &LogRing{entries: make([]string, capacity)}
+}
+
+// Write stores p as one entry.
+func (r *LogRing) Write(p []byte) (int, error) {
+	entry := strings.TrimSuffix(string(p), "\n")
+	if len(entry) > maxEntryLen {
+		entry = entry[:maxEntryLen]
+	}
+	r.mu.Lock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+// Lines returns up to n of the newest entries, oldest first. n <= 0
+// returns everything held.
+func (r *LogRing) Lines(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all []string
+	if r.full {
+		all = append(append(all, r.entries[r.next:]...), r.entries[:r.next]...)
+	} else {
+		all = append(all, r.entries[:r.next]...)
+	}
+	if n > 0 && len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
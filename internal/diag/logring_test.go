@@ -0,0 +1,31 @@
+package diag
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestLogRingKeepsNewestLines(t *testing.T) {
+	ring := NewLogRing(3)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(ring, "line %d\n", i)
+	}
+	if got, want := ring.Lines(0), []string{"line 3", "line 4", "line 5"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lines(0) = %q, want %q", got, want)
+	}
+	if got, want := ring.Lines(2), []string{"line 4", "line 5"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lines(2) = %q, want %q", got, want)
+	}
+}
+
+func TestLogRingKeepsMessagesWhole(t *testing.T) {
+	ring := NewLogRing(10)
+	logger := log.New(ring, "", 0)
+	logger.Printf("first")
+	logger.Printf("multi\nline")
+	if got, want := ring.Lines(0), []string{"first", "multi\nline"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package diag
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces every value the sanitizer removes.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeyParts mark JSON keys whose values never leave the device.
+var sensitiveKeyParts = []string{"secret", "password", "passphrase", "token", "credential", "private_key", "privatekey", "hash", "csrf", "cookie", "authorization"}
+
+var (
+	privateKeyPattern   = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+	passwordHashPattern = regexp.MustCompile(`\$?argon2(?:id|i|d)\$[^\s"']+|\$2[aby]\$\d{2}\$[./A-Za-z0-9]{53}`)
+)
+
+// minSecretLen keeps short values (such as "1") from being scrubbed out of
+// unrelated text.
+const minSecretLen = 4
+
+// Sanitizer strips credentials from bundle content: values under sensitive
+// keys, known secret strings wherever they appear, PEM private keys and
+// password hashes.
+type Sanitizer struct {
+	secrets []string
+}
+
+// NewSanitizer returns a sanitizer that also scrubs the given secret values.
+func NewSanitizer(secrets ...string) *Sanitizer {
+	s := &Sanitizer{}
+	for _, v := range secrets {
+		if len(v) >= minSecretLen {
+			s.secrets = append(s.secrets, v)
+		}
+	}
+	// Longest first so a secret containing another is replaced whole.
+	sort.Slice(s.secrets, func(i, j int) bool { return len(s.secrets[i]) > len(s.secrets[j]) })
+	return s
+}
+
+// String scrubs free text such as a log line.
+func (s *Sanitizer) String(text string) string {
+	text = privateKeyPattern.ReplaceAllString(text, Redacted)
+	text = passwordHashPattern.ReplaceAllString(text, Redacted)
+	for _, secret := range s.secrets {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	return text
+}
+
+// Value round-trips v through JSON and returns a copy with sensitive keys
+// redacted and every string scrubbed.
+func (s *Sanitizer) Value(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return s.walk(generic), nil
+}
+
+func (s *Sanitizer) walk(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if sensitiveKey(k) && child != nil {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = s.walk(child)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = s.walk(child)
+		}
+		return t
+	case string:
+		return s.String(t)
+	default:
+		return v
+	}
+}
+
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(k, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the network checks.
+const (
+	// DefaultClockURL is asked for its Date header; it is the ACME
+	// directory, so a failure here also means certificates cannot be
+	// issued.
+	DefaultClockURL = "https://acme-v02.api.letsencrypt.org/directory"
+	DefaultDNSHost  = "acme-v02.api.letsencrypt.org"
+
+	// Clock skew beyond these makes TLS validation and ACME unreliable.
+	clockSkewWarn  = 30 * time.Second
+	clockSkewError = 5 * time.Minute
+)
+
+// DirInfo describes the state directory.
+type DirInfo struct {
+	Mode fs.FileMode
+	// UID owns the directory; -1 when unknown.
+	UID      int
+	FSType   string
+	Mount    string
+	ReadOnly bool
+	// Writable reports whether a file could be created and removed.
+	Writable bool
+}
+
+// PortOwner identifies the process listening on a port.
+type PortOwner struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// Prober abstracts the host so the checks can be exercised without touching
+// it.
+type Prober interface {
+	LookPath(name string) (string, error)
+	// Version runs path with args and returns the first line of output.
+	Version(ctx context.Context, path string, args ...string) (string, error)
+	// OpenDevice opens path read-write and closes it again.
+	OpenDevice(path string) error
+	StatDir(path string) (DirInfo, error)
+	// Bind listens on the TCP port on all interfaces and closes it again.
+	Bind(port int) error
+	// PortOwner finds the process listening on port; ok is false when it
+	// cannot be identified.
+	PortOwner(port int) (owner PortOwner, ok bool)
+	// ServerTime returns the Date header of a request to url.
+	ServerTime(ctx context.Context, url string) (time.Time, error)
+	CgroupV2() (bool, error)
+	Resolve(ctx context.Context, host string) ([]string, error)
+}
+
+// Options configures the default battery.
+type Options struct {
+	Prober   Prober
+	StateDir string
+	// Ports are the listener ports that must be bindable or held by
+	// piccolod itself.
+	Ports    []int
+	ClockURL string
+	DNSHost  string
+	// PID is piccolod's own process id; defaults to os.Getpid.
+	PID int
+	Now func() time.Time
+}
+
+// Battery returns the default checks.
+func Battery(opts Options) []Check {
+	if opts.Prober == nil {
+		opts.Prober = Host{}
+	}
+	if opts.ClockURL == "" {
+		opts.ClockURL = DefaultClockURL
+	}
+	if opts.DNSHost == "" {
+		opts.DNSHost = DefaultDNSHost
+	}
+	if opts.PID == 0 {
+		opts.PID = os.Getpid()
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	p := opts.Prober
+	checks := []Check{
+		binaryCheck(p, "gocryptfs", []string{"gocryptfs"}, []string{"--version"},
+			"Install gocryptfs; encrypted volumes cannot be mounted without it."),
+		binaryCheck(p, "fusermount", []string{"fusermount3", "fusermount"}, []string{"-V"},
+			"Install fuse3 (fusermount3); encrypted volumes cannot be unmounted without it."),
+		binaryCheck(p, "podman", []string{"podman"}, []string{"--version"},
+			"Install podman; apps cannot run without it."),
+		{Name: "fuse_device", Run: func(ctx context.Context) Finding { return fuseDeviceCheck(p) }},
+		{Name: "cgroup_v2", Run: func(ctx context.Context) Finding { return cgroupCheck(p) }},
+		{Name: "clock", Run: func(ctx context.Context) Finding { return clockCheck(ctx, p, opts.ClockURL, opts.Now) }},
+		{Name: "dns", Run: func(ctx context.Context) Finding { return dnsCheck(ctx, p, opts.DNSHost) }},
+	}
+	if opts.StateDir != "" {
+		checks = append(checks, Check{Name: "state_dir", Run: func(ctx context.Context) Finding {
+			return stateDirCheck(p, opts.StateDir)
+		}})
+	}
+	seen := make(map[int]bool)
+	for _, port := range opts.Ports {
+		if port <= 0 || seen[port] {
+			continue
+		}
+		seen[port] = true
+		checks = append(checks, Check{Name: "port_" + strconv.Itoa(port), Run: func(ctx context.Context) Finding {
+			return portCheck(p, port, opts.PID)
+		}})
+	}
+	return checks
+}
+
+// binaryCheck looks for the first of names on PATH and reports its version.
+func binaryCheck(p Prober, check string, names, versionArgs []string, remediation string) Check {
+	return Check{Name: check, Run: func(ctx context.Context) Finding {
+		for _, name := range names {
+			path, err := p.LookPath(name)
+			if err != nil {
+				continue
+			}
+			details := map[string]any{"path": path}
+			version, err := p.Version(ctx, path, versionArgs...)
+			if err != nil {
+				details["error"] = err.Error()
+				return Finding{
+					Severity:    SeverityWarn,
+					Message:     fmt.Sprintf("%s found at %s but its version could not be read", name, path),
+					Remediation: "Check that " + path + " runs; reinstall the package if it does not.",
+					Details:     details,
+				}
+			}
+			details["version"] = version
+			return Finding{Severity: SeverityOK, Message: name + " " + version, Details: details}
+		}
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("%s not found on PATH", names[0]),
+			Remediation: remediation,
+		}
+	}}
+}
+
+func fuseDeviceCheck(p Prober) Finding {
+	const dev = "/dev/fuse"
+	err := p.OpenDevice(dev)
+	switch {
+	case err == nil:
+		return Finding{Severity: SeverityOK, Message: dev + " is accessible"}
+	case errors.Is(err, fs.ErrNotExist):
+		return Finding{
+			Severity:    SeverityError,
+			Message:     dev + " does not exist",
+			Remediation: "Load the fuse kernel module (modprobe fuse); inside a container, pass --device /dev/fuse.",
+		}
+	default:
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("%s is not accessible: %v", dev, err),
+			Remediation: "Grant piccolod read-write access to " + dev + ".",
+		}
+	}
+}
+
+func cgroupCheck(p Prober) Finding {
+	v2, err := p.CgroupV2()
+	switch {
+	case err != nil:
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("cgroup version could not be determined: %v", err),
+			Remediation: "Mount the unified cgroup hierarchy at /sys/fs/cgroup.",
+		}
+	case !v2:
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     "cgroup v2 is not available",
+			Remediation: "Boot with systemd.unified_cgroup_hierarchy=1; app resource limits need cgroup v2.",
+		}
+	}
+	return Finding{Severity: SeverityOK, Message: "cgroup v2 available"}
+}
+
+func clockCheck(ctx context.Context, p Prober, url string, now func() time.Time) Finding {
+	remote, err := p.ServerTime(ctx, url)
+	if err != nil {
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("could not read the time from %s: %v", url, err),
+			Remediation: "Check outbound HTTPS; certificate issuance needs it.",
+			Details:     map[string]any{"url": url},
+		}
+	}
+	skew := now().Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	// The Date header has one-second resolution.
+	skew = skew.Truncate(time.Second)
+	details := map[string]any{"url": url, "skew_seconds": int64(skew.Seconds())}
+	switch {
+	case skew >= clockSkewError:
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("system clock is off by %s", skew),
+			Remediation: "Enable time synchronisation (systemd-timesyncd or chrony); TLS and ACME fail with a skewed clock.",
+			Details:     details,
+		}
+	case skew >= clockSkewWarn:
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("system clock is off by %s", skew),
+			Remediation: "Enable time synchronisation (systemd-timesyncd or chrony).",
+			Details:     details,
+		}
+	}
+	return Finding{Severity: SeverityOK, Message: fmt.Sprintf("system clock within %s", clockSkewWarn), Details: details}
+}
+
+func dnsCheck(ctx context.Context, p Prober, host string) Finding {
+	addrs, err := p.Resolve(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		msg := fmt.Sprintf("%s did not resolve", host)
+		if err != nil {
+			msg = fmt.Sprintf("%s did not resolve: %v", host, err)
+		}
+		return Finding{
+			Severity:    SeverityError,
+			Message:     msg,
+			Remediation: "Check the resolvers in /etc/resolv.conf.",
+		}
+	}
+	return Finding{Severity: SeverityOK, Message: host + " resolves", Details: map[string]any{"addresses": addrs}}
+}
+
+func stateDirCheck(p Prober, dir string) Finding {
+	info, err := p.StatDir(dir)
+	if err != nil {
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("state directory %s is unusable: %v", dir, err),
+			Remediation: "Create " + dir + " owned by the piccolod user with mode 0700.",
+		}
+	}
+	details := map[string]any{
+		"path":    dir,
+		"mode":    fmt.Sprintf("%#o", info.Mode.Perm()),
+		"uid":     info.UID,
+		"fs_type": info.FSType,
+		"mount":   info.Mount,
+	}
+	switch {
+	case info.ReadOnly:
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("state directory %s is on a read-only filesystem", dir),
+			Remediation: "Mount " + info.Mount + " read-write.",
+			Details:     details,
+		}
+	case !info.Writable:
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("state directory %s is not writable", dir),
+			Remediation: "Make " + dir + " owned by the piccolod user.",
+			Details:     details,
+		}
+	case strings.HasPrefix(info.FSType, "fuse") || info.FSType == "tmpfs":
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("state directory %s is on %s", dir, info.FSType),
+			Remediation: "Move the state directory to a persistent local filesystem; encrypted volumes do not nest on FUSE and tmpfs is lost on reboot.",
+			Details:     details,
+		}
+	case info.Mode.Perm()&0o022 != 0:
+		return Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("state directory %s is writable by other users", dir),
+			Remediation: "chmod 0700 " + dir,
+			Details:     details,
+		}
+	}
+	return Finding{Severity: SeverityOK, Message: "state directory " + dir + " is writable", Details: details}
+}
+
+func portCheck(p Prober, port, pid int) Finding {
+	if err := p.Bind(port); err == nil {
+		return Finding{Severity: SeverityOK, Message: fmt.Sprintf("port %d is free", port)}
+	}
+	owner, ok := p.PortOwner(port)
+	if ok && owner.PID == pid {
+		return Finding{Severity: SeverityOK, Message: fmt.Sprintf("port %d is served by piccolod", port)}
+	}
+	if ok {
+		return Finding{
+			Severity:    SeverityError,
+			Message:     fmt.Sprintf("port %d is held by %s (pid %d)", port, owner.Name, owner.PID),
+			Remediation: fmt.Sprintf("Stop or reconfigure %s so piccolod can listen on port %d.", owner.Name, port),
+			Details:     map[string]any{"owner": owner},
+		}
+	}
+	return Finding{
+		Severity:    SeverityError,
+		Message:     fmt.Sprintf("port %d cannot be bound", port),
+		Remediation: fmt.Sprintf("Find the process on port %d (ss -ltnp) or grant piccolod CAP_NET_BIND_SERVICE.", port),
+	}
+}
@@ -0,0 +1,192 @@
+// Package doctor runs a battery of environment checks that catch the host
+// misconfigurations piccolod cannot work around: missing binaries, no FUSE,
+// a bad state directory, taken ports, clock skew and broken DNS.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCheckTimeout bounds a check that does not set its own timeout.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Severity grades a finding. The values match the health tracker levels.
+type Severity string
+
+const (
+	SeverityOK    Severity = "ok"
+	SeverityWarn  Severity = "warn"
+	SeverityError Severity = "error"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityWarn:
+		return 1
+	case SeverityError:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Finding is the outcome of one check.
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Remediation tells the operator what to change; empty when the check
+	// passed.
+	Remediation string         `json:"remediation,omitempty"`
+	Details     map[string]any `json:"details,omitempty"`
+	TimedOut    bool           `json:"timed_out,omitempty"`
+	DurationMs  int64          `json:"duration_ms"`
+}
+
+// Check is one entry of the battery. Run should honour ctx; a check that
+// outlives its timeout is reported as timed out and its result discarded.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) Finding
+}
+
+// Report is the result of running the whole battery.
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	// Worst is the highest severity among the findings.
+	Worst Severity `json:"worst"`
+	// Findings are ordered worst first, then by check name.
+	Findings []Finding `json:"findings"`
+}
+
+// WorstFinding returns the first finding at the report's worst severity.
+func (r Report) WorstFinding() (Finding, bool) {
+	if len(r.Findings) == 0 {
+		return Finding{}, false
+	}
+	return r.Findings[0], true
+}
+
+// Runner runs the battery on demand and keeps the startup and latest
+// reports.
+type Runner struct {
+	checks []Check
+	now    func() time.Time
+
+	startupOnce sync.Once
+	mu          sync.Mutex
+	startup     *Report
+	last        *Report
+}
+
+// NewRunner returns a runner for checks.
+func NewRunner(checks []Check) *Runner {
+	return &Runner{
+		checks: append([]Check(nil), checks...),
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run executes every check concurrently, each under its own timeout.
+func (r *Runner) Run(ctx context.Context) Report {
+	started := r.now()
+	findings := make([]Finding, len(r.checks))
+	var wg sync.WaitGroup
+	for i, chk := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			findings[i] = runCheck(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{StartedAt: started, Worst: SeverityOK, Findings: findings}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Severity.rank() != b.Severity.rank() {
+			return a.Severity.rank() > b.Severity.rank()
+		}
+		return a.Check < b.Check
+	})
+	if len(report.Findings) > 0 {
+		report.Worst = report.Findings[0].Severity
+	}
+	report.DurationMs = r.now().Sub(started).Milliseconds()
+
+	r.mu.Lock()
+	r.last = &report
+	r.mu.Unlock()
+	return report
+}
+
+// Startup runs the battery the first time it is called and returns that
+// report on every later call.
+func (r *Runner) Startup(ctx context.Context) Report {
+	r.startupOnce.Do(func() {
+		report := r.Run(ctx)
+		r.mu.Lock()
+		r.startup = &report
+		r.mu.Unlock()
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.startup
+}
+
+// StartupReport returns the cached startup report, if the startup run has
+// finished.
+func (r *Runner) StartupReport() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.startup == nil {
+		return Report{}, false
+	}
+	return *r.startup, true
+}
+
+// Last returns the most recent report from any run.
+func (r *Runner) Last() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return Report{}, false
+	}
+	return *r.last, true
+}
+
+func runCheck(ctx context.Context, chk Check) Finding {
+	timeout := chk.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan Finding, 1)
+	go func() { done <- chk.Run(cctx) }()
+
+	var f Finding
+	select {
+	case f = <-done:
+	case <-cctx.Done():
+		f = Finding{
+			Severity:    SeverityWarn,
+			Message:     fmt.Sprintf("check did not finish within %s", timeout),
+			Remediation: "Re-run the check; if it keeps timing out the host is overloaded or the probed service is unreachable.",
+			TimedOut:    true,
+		}
+	}
+	if f.Severity == "" {
+		f.Severity = SeverityOK
+	}
+	f.Check = chk.Name
+	f.DurationMs = time.Since(start).Milliseconds()
+	return f
+}
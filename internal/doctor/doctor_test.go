@@ -0,0 +1,303 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubProber answers every probe from its fields.
+type stubProber struct {
+	paths     map[string]string
+	versions  map[string]string
+	fuseErr   error
+	dir       DirInfo
+	dirErr    error
+	bound     map[int]bool
+	owners    map[int]PortOwner
+	server    time.Time
+	serverErr error
+	cgroupV2  bool
+	resolved  []string
+}
+
+func (p *stubProber) LookPath(name string) (string, error) {
+	if path, ok := p.paths[name]; ok {
+		return path, nil
+	}
+	return "", errors.New("not found")
+}
+
+func (p *stubProber) Version(ctx context.Context, path string, args ...string) (string, error) {
+	if v, ok := p.versions[path]; ok {
+		return v, nil
+	}
+	return "", errors.New("exit status 1")
+}
+
+func (p *stubProber) OpenDevice(string) error { return p.fuseErr }
+
+func (p *stubProber) StatDir(string) (DirInfo, error) { return p.dir, p.dirErr }
+
+func (p *stubProber) Bind(port int) error {
+	if p.bound[port] {
+		return errors.New("address already in use")
+	}
+	return nil
+}
+
+func (p *stubProber) PortOwner(port int) (PortOwner, bool) {
+	o, ok := p.owners[port]
+	return o, ok
+}
+
+func (p *stubProber) ServerTime(context.Context, string) (time.Time, error) {
+	return p.server, p.serverErr
+}
+
+func (p *stubProber) CgroupV2() (bool, error) { return p.cgroupV2, nil }
+
+func (p *stubProber) Resolve(context.Context, string) ([]string, error) {
+	if len(p.resolved) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return p.resolved, nil
+}
+
+func healthyProber(now time.Time) *stubProber {
+	return &stubProber{
+		paths: map[string]string{
+			"gocryptfs":   "/usr/bin/gocryptfs",
+			"fusermount3": "/usr/bin/fusermount3",
+			"podman":      "/usr/bin/podman",
+		},
+		versions: map[string]string{
+			"/usr/bin/gocryptfs":   "gocryptfs v2.4.0",
+			"/usr/bin/fusermount3": "fusermount3 version: 3.16.2",
+			"/usr/bin/podman":      "podman version 5.2.0",
+		},
+		dir:      DirInfo{Mode: fs.ModeDir | 0o700, FSType: "btrfs", Mount: "/var", Writable: true},
+		bound:    map[int]bool{},
+		owners:   map[int]PortOwner{},
+		server:   now,
+		cgroupV2: true,
+		resolved: []string{"172.65.32.248"},
+	}
+}
+
+func findingFor(t *testing.T, r Report, check string) Finding {
+	t.Helper()
+	for _, f := range r.Findings {
+		if f.Check == check {
+			return f
+		}
+	}
+	t.Fatalf("no finding for %s in %+v", check, r.Findings)
+	return Finding{}
+}
+
+func TestBatteryHealthyHost(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := healthyProber(now)
+	p.bound[8080] = true
+	p.owners[8080] = PortOwner{PID: 42, Name: "piccolod"}
+	r := NewRunner(Battery(Options{Prober: p, StateDir: "/srv/state", Ports: []int{80, 8080, 80}, PID: 42, Now: func() time.Time { return now }}))
+
+	report := r.Run(context.Background())
+	if report.Worst != SeverityOK {
+		t.Fatalf("expected a clean report, got %+v", report.Findings)
+	}
+	if got := len(report.Findings); got != 10 {
+		t.Fatalf("expected 10 findings (duplicate port dropped), got %d", got)
+	}
+	if f := findingFor(t, report, "port_8080"); !strings.Contains(f.Message, "served by piccolod") {
+		t.Fatalf("own listener not recognised: %+v", f)
+	}
+	if f := findingFor(t, report, "fusermount"); f.Details["version"] != "fusermount3 version: 3.16.2" {
+		t.Fatalf("unexpected fusermount finding %+v", f)
+	}
+}
+
+func TestBatteryGradesFindings(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := healthyProber(now)
+	delete(p.paths, "gocryptfs")
+	delete(p.versions, "/usr/bin/podman")
+	p.fuseErr = fs.ErrPermission
+	p.dir.Mode = fs.ModeDir | 0o777
+	p.bound[80] = true
+	p.owners[80] = PortOwner{PID: 900, Name: "nginx"}
+	p.bound[443] = true
+	p.server = now.Add(-2 * time.Minute)
+	p.cgroupV2 = false
+	r := NewRunner(Battery(Options{Prober: p, StateDir: "/srv/state", Ports: []int{80, 443}, PID: 42, Now: func() time.Time { return now }}))
+
+	report := r.Run(context.Background())
+	want := map[string]Severity{
+		"gocryptfs":   SeverityError,
+		"podman":      SeverityWarn,
+		"fusermount":  SeverityOK,
+		"fuse_device": SeverityError,
+		"state_dir":   SeverityWarn,
+		"port_80":     SeverityError,
+		"port_443":    SeverityError,
+		"clock":       SeverityWarn,
+		"cgroup_v2":   SeverityWarn,
+		"dns":         SeverityOK,
+	}
+	for check, sev := range want {
+		if f := findingFor(t, report, check); f.Severity != sev {
+			t.Errorf("%s: expected %s, got %+v", check, sev, f)
+		} else if sev != SeverityOK && f.Remediation == "" {
+			t.Errorf("%s: no remediation hint", check)
+		}
+	}
+	if report.Worst != SeverityError {
+		t.Fatalf("expected worst=error, got %s", report.Worst)
+	}
+	// Worst first, then by name.
+	if worst, _ := report.WorstFinding(); worst.Check != "fuse_device" {
+		t.Fatalf("unexpected ordering %+v", report.Findings)
+	}
+	for i := 1; i < len(report.Findings); i++ {
+		if report.Findings[i].Severity.rank() > report.Findings[i-1].Severity.rank() {
+			t.Fatalf("findings not ordered by severity: %+v", report.Findings)
+		}
+	}
+	if f := findingFor(t, report, "port_80"); !strings.Contains(f.Message, "nginx (pid 900)") {
+		t.Fatalf("conflicting process not named: %+v", f)
+	}
+
+	p.server = now.Add(10 * time.Minute)
+	if f := findingFor(t, r.Run(context.Background()), "clock"); f.Severity != SeverityError {
+		t.Fatalf("expected a 10 minute skew to be an error, got %+v", f)
+	}
+}
+
+func TestRunnerRunsChecksConcurrentlyWithTimeouts(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	checks := []Check{
+		// Only finishes once the other check has started, so a serial
+		// runner would time it out.
+		{Name: "waits", Timeout: 2 * time.Second, Run: func(ctx context.Context) Finding {
+			select {
+			case <-started:
+				return Finding{Severity: SeverityOK, Message: "saw the other check"}
+			case <-ctx.Done():
+				return Finding{Severity: SeverityError, Message: "ran alone"}
+			}
+		}},
+		{Name: "starts", Run: func(ctx context.Context) Finding {
+			close(started)
+			return Finding{Message: "started"}
+		}},
+		// Ignores its context entirely.
+		{Name: "hangs", Timeout: 50 * time.Millisecond, Run: func(ctx context.Context) Finding {
+			<-release
+			return Finding{Severity: SeverityOK}
+		}},
+	}
+	begin := time.Now()
+	report := NewRunner(checks).Run(context.Background())
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Fatalf("a hung check held up the report for %s", elapsed)
+	}
+	if f := findingFor(t, report, "waits"); f.Severity != SeverityOK {
+		t.Fatalf("checks did not run concurrently: %+v", f)
+	}
+	if f := findingFor(t, report, "starts"); f.Severity != SeverityOK {
+		t.Fatalf("empty severity not defaulted to ok: %+v", f)
+	}
+	if f := findingFor(t, report, "hangs"); !f.TimedOut || f.Severity != SeverityWarn {
+		t.Fatalf("expected a timed out warning, got %+v", f)
+	}
+	if report.Worst != SeverityWarn {
+		t.Fatalf("expected worst=warn, got %s", report.Worst)
+	}
+}
+
+func TestRunnerCachesStartupReport(t *testing.T) {
+	var runs atomic.Int32
+	r := NewRunner([]Check{{Name: "count", Run: func(ctx context.Context) Finding {
+		n := runs.Add(1)
+		if n > 1 {
+			return Finding{Severity: SeverityWarn, Message: "later run"}
+		}
+		return Finding{Severity: SeverityOK, Message: "first run"}
+	}}})
+	if _, ok := r.StartupReport(); ok {
+		t.Fatalf("startup report before the startup run")
+	}
+	if _, ok := r.Last(); ok {
+		t.Fatalf("last report before any run")
+	}
+
+	first := r.Startup(context.Background())
+	again := r.Startup(context.Background())
+	if runs.Load() != 1 || again.Worst != SeverityOK || again.StartedAt != first.StartedAt {
+		t.Fatalf("startup battery re-ran: runs=%d report=%+v", runs.Load(), again)
+	}
+
+	later := r.Run(context.Background())
+	if runs.Load() != 2 || later.Worst != SeverityWarn {
+		t.Fatalf("on-demand run did not execute: runs=%d report=%+v", runs.Load(), later)
+	}
+	if cached, _ := r.StartupReport(); cached.Worst != SeverityOK {
+		t.Fatalf("on-demand run replaced the startup report: %+v", cached)
+	}
+	if last, _ := r.Last(); last.Worst != SeverityWarn {
+		t.Fatalf("last report not updated: %+v", last)
+	}
+}
+
+func TestListeningInodes(t *testing.T) {
+	listing := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 31337 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0050 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 4242 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:01BB 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 555 1 0000000000000000 100 0 0 10 0
+`
+	got := listeningInodes(strings.NewReader(listing), 80)
+	if len(got) != 1 || got[0] != "31337" {
+		t.Fatalf("expected only the listening socket on port 80, got %v", got)
+	}
+}
+
+func TestMountForPicksLongestMount(t *testing.T) {
+	mounts := `/dev/sda2 / btrfs rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid 0 0
+/dev/sda3 /var btrfs ro,relatime 0 0
+/dev/sda4 /var/lib/piccolo\040data ext4 rw 0 0
+`
+	mount, fsType, ro := mountFor(strings.NewReader(mounts), "/var/lib/state")
+	if mount != "/var" || fsType != "btrfs" || !ro {
+		t.Fatalf("unexpected mount %q %q ro=%v", mount, fsType, ro)
+	}
+	if mount, _, _ := mountFor(strings.NewReader(mounts), "/var/lib/piccolo data/state"); mount != "/var/lib/piccolo data" {
+		t.Fatalf("escaped mount point not matched: %q", mount)
+	}
+	if mount, _, _ := mountFor(strings.NewReader(mounts), "/runner"); mount != "/" {
+		t.Fatalf("prefix without a separator matched: %q", mount)
+	}
+}
+
+func TestHostStatDirReportsWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	info, err := Host{}.StatDir(dir)
+	if err != nil || !info.Writable || info.Mode.Perm() != 0o700 {
+		t.Fatalf("unexpected dir info %+v err=%v", info, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("probe file left behind: %v", entries)
+	}
+}
@@ -0,0 +1,217 @@
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Host probes the machine piccolod runs on.
+type Host struct{}
+
+func (Host) LookPath(name string) (string, error) { return exec.LookPath(name) }
+
+func (Host) Version(ctx context.Context, path string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+func (Host) OpenDevice(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (Host) StatDir(path string) (DirInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return DirInfo{}, err
+	}
+	if !fi.IsDir() {
+		return DirInfo{}, fmt.Errorf("%s is not a directory", path)
+	}
+	info := DirInfo{Mode: fi.Mode(), UID: -1}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		info.UID = int(st.Uid)
+	}
+	if mounts, err := os.Open("/proc/self/mounts"); err == nil {
+		info.Mount, info.FSType, info.ReadOnly = mountFor(mounts, path)
+		mounts.Close()
+	}
+	if f, err := os.CreateTemp(path, ".doctor-*"); err == nil {
+		f.Close()
+		info.Writable = os.Remove(f.Name()) == nil
+	}
+	return info, nil
+}
+
+// mountFor returns the mount point, filesystem type and read-only flag of
+// the longest mount in a /proc/self/mounts listing that contains path.
+func mountFor(mounts io.Reader, path string) (mount, fsType string, readOnly bool) {
+	path = filepath.Clean(path)
+	sc := bufio.NewScanner(mounts)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		mp := unescapeMount(fields[1])
+		if mp != "/" && path != mp && !strings.HasPrefix(path, mp+"/") {
+			continue
+		}
+		if len(mp) < len(mount) {
+			continue
+		}
+		mount, fsType, readOnly = mp, fields[2], false
+		for _, opt := range strings.Split(fields[3], ",") {
+			if opt == "ro" {
+				readOnly = true
+			}
+		}
+	}
+	return mount, fsType, readOnly
+}
+
+// unescapeMount undoes the octal escaping of spaces and tabs in
+// /proc/self/mounts.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func (Host) Bind(port int) error {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return err
+	}
+	return ln.Close()
+}
+
+// PortOwner maps the listening socket's inode from /proc/net/tcp{,6} to the
+// process holding it. Processes of other users are invisible without
+// privileges.
+func (Host) PortOwner(port int) (PortOwner, bool) {
+	inodes := make(map[string]bool)
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		for _, inode := range listeningInodes(f, port) {
+			inodes[inode] = true
+		}
+		f.Close()
+	}
+	if len(inodes) == 0 {
+		return PortOwner{}, false
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return PortOwner{}, false
+	}
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			if inodes[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] {
+				comm, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+				return PortOwner{PID: pid, Name: strings.TrimSpace(string(comm))}, true
+			}
+		}
+	}
+	return PortOwner{}, false
+}
+
+// listeningInodes returns the socket inodes in a /proc/net/tcp listing that
+// listen on port.
+func listeningInodes(r io.Reader, port int) []string {
+	const stateListen = "0A"
+	var inodes []string
+	sc := bufio.NewScanner(r)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[3] != stateListen {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseUint(hexPort, 16, 16); err != nil || int(p) != port {
+			continue
+		}
+		inodes = append(inodes, fields[9])
+	}
+	return inodes
+}
+
+func (Host) ServerTime(ctx context.Context, url string) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, errors.New("response has no Date header")
+	}
+	return http.ParseTime(date)
+}
+
+func (Host) CgroupV2() (bool, error) {
+	_, err := os.Stat("/sys/fs/cgroup/cgroup.controllers")
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (Host) Resolve(ctx context.Context, host string) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
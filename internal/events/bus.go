@@ -1,7 +1,9 @@
 package events
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"piccolod/internal/cluster"
@@ -20,6 +22,13 @@ const (
 	TopicRemoteConfigChanged   Topic = "remote_config_changed"
 	TopicVolumeStateChanged    Topic = "volume_state_changed"
 	TopicAudit                 Topic = "audit"
+	TopicOSUpdate              Topic = "os_update"
+	TopicSelfUpdate            Topic = "self_update"
+	TopicActivity              Topic = "activity"
+	TopicRemoteCertProgress    Topic = "remote_cert_progress"
+	TopicServicesChanged       Topic = "services_changed"
+	TopicStorageSpace          Topic = "storage_space"
+	TopicWatchdogPing          Topic = "watchdog_ping"
 )
 
 // Event represents a message broadcast on the event bus.
@@ -30,6 +39,7 @@ type Event struct {
 
 type VolumeStateChanged struct {
 	ID          string
+	MountDir    string
 	Desired     string
 	Observed    string
 	Role        string
@@ -46,10 +56,52 @@ type AuditEvent struct {
 	Metadata map[string]any
 }
 
+// OSUpdateProgress reports a state change or output line from an OS update job.
+type OSUpdateProgress struct {
+	JobID   string
+	Kind    string
+	State   string
+	Step    string
+	Message string
+}
+
+// SelfUpdateStage reports progress of a piccolod binary self-update.
+type SelfUpdateStage struct {
+	Stage   string
+	From    string
+	To      string
+	Message string
+}
+
+// RemoteCertProgress reports a step of remote certificate issuance.
+type RemoteCertProgress struct {
+	CertID string    `json:"cert_id"`
+	Stage  string    `json:"stage"`
+	Detail string    `json:"detail,omitempty"`
+	Time   time.Time `json:"ts"`
+}
+
+// ServicesChanged announces a new service registry generation.
+type ServicesChanged struct {
+	Generation uint64
+}
+
+// ActivityRecorded mirrors an activity log entry as it is recorded.
+type ActivityRecorded struct {
+	Time     time.Time
+	Source   string
+	Level    string
+	Message  string
+	Metadata map[string]any
+}
+
 // LeadershipChanged describes a leadership role update for a resource.
 type LeadershipChanged struct {
 	Resource string
 	Role     cluster.Role
+	// LeaderEndpoint is the address (host or host:port) of the node that
+	// currently leads the resource; followers tunnel traffic to it.
+	LeaderEndpoint string
 }
 type LockStateChanged struct {
 	Locked bool
@@ -62,20 +114,47 @@ type ControlStoreCommit struct {
 	Role     cluster.Role
 }
 
-// Bus is a simple pub/sub dispatcher for intra-process events.
+// Bus is a simple pub/sub dispatcher for intra-process events. Publish
+// never blocks: when a subscriber's buffer is full its oldest queued event
+// is discarded to make room, so a stalled reader sees the latest state once
+// it catches up, and the discard is counted against that subscriber.
 type Bus struct {
 	mu     sync.RWMutex
-	subs   map[Topic][]chan Event
+	subs   map[Topic][]*subscriber
 	closed bool
+	// retired keeps the drops of unsubscribed channels so Stats stays
+	// cumulative per topic.
+	retired map[Topic]uint64
+}
+
+type subscriber struct {
+	ch      chan Event
+	dropped atomic.Uint64
+}
+
+// TopicStats describes the subscribers of one topic.
+type TopicStats struct {
+	Topic       Topic  `json:"topic"`
+	Subscribers int    `json:"subscribers"`
+	Buffered    int    `json:"buffered"`
+	Capacity    int    `json:"capacity"`
+	Dropped     uint64 `json:"dropped"`
+	// MaxDropped is the highest drop count of a current subscriber,
+	// pointing at the slowest consumer.
+	MaxDropped uint64 `json:"max_dropped"`
 }
 
 // NewBus constructs an empty event bus.
 func NewBus() *Bus {
-	return &Bus{subs: make(map[Topic][]chan Event)}
+	return &Bus{subs: make(map[Topic][]*subscriber), retired: make(map[Topic]uint64)}
 }
 
-// Subscribe registers a buffered channel for a topic.
+// Subscribe registers a buffered channel for a topic. A buffer below one is
+// raised to one so the drop-oldest policy has something to drop.
 func (b *Bus) Subscribe(topic Topic, buffer int) <-chan Event {
+	if buffer < 1 {
+		buffer = 1
+	}
 	ch := make(chan Event, buffer)
 
 	b.mu.Lock()
@@ -84,24 +163,104 @@ func (b *Bus) Subscribe(topic Topic, buffer int) <-chan Event {
 		close(ch)
 		return ch
 	}
-	b.subs[topic] = append(b.subs[topic], ch)
+	b.subs[topic] = append(b.subs[topic], &subscriber{ch: ch})
 	return ch
 }
 
-// Publish broadcasts an event to all subscribers.
+// Unsubscribe removes ch from topic and closes it, ending any range over
+// the channel. Long-lived components call it when they stop, and
+// subscribers that come and go (e.g. streaming HTTP clients) when they
+// leave.
+func (b *Bus) Unsubscribe(topic Topic, ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	subs := b.subs[topic]
+	for i, sub := range subs {
+		if sub.ch == ch {
+			b.subs[topic] = append(subs[:i:i], subs[i+1:]...)
+			b.retired[topic] += sub.dropped.Load()
+			close(sub.ch)
+			return
+		}
+	}
+}
+
+// Publish broadcasts an event to all subscribers without blocking.
 func (b *Bus) Publish(evt Event) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if b.closed {
 		return
 	}
-	for _, ch := range b.subs[evt.Topic] {
-		select {
-		case ch <- evt:
-		default:
-			// Drop when subscriber is saturated; listeners should size buffers appropriately.
+	for _, sub := range b.subs[evt.Topic] {
+		sub.offer(evt)
+	}
+}
+
+// offer queues evt, discarding the oldest queued event when the buffer is
+// full. Every event that never reaches the reader is counted once: either
+// when it is discarded from the buffer or when a concurrent publisher
+// refilled the slot first.
+func (s *subscriber) offer(evt Event) {
+	select {
+	case s.ch <- evt:
+		return
+	default:
+	}
+	select {
+	case <-s.ch:
+		s.dropped.Add(1)
+	default:
+	}
+	select {
+	case s.ch <- evt:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Stats reports subscriber counts, buffer occupancy and drops per topic,
+// sorted by topic.
+func (b *Bus) Stats() []TopicStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	byTopic := make(map[Topic]*TopicStats)
+	get := func(topic Topic) *TopicStats {
+		st, ok := byTopic[topic]
+		if !ok {
+			st = &TopicStats{Topic: topic}
+			byTopic[topic] = st
 		}
+		return st
+	}
+	for topic, dropped := range b.retired {
+		get(topic).Dropped += dropped
+	}
+	for topic, subs := range b.subs {
+		if len(subs) == 0 {
+			continue
+		}
+		st := get(topic)
+		for _, sub := range subs {
+			dropped := sub.dropped.Load()
+			st.Subscribers++
+			st.Buffered += len(sub.ch)
+			st.Capacity += cap(sub.ch)
+			st.Dropped += dropped
+			if dropped > st.MaxDropped {
+				st.MaxDropped = dropped
+			}
+		}
+	}
+	out := make([]TopicStats, 0, len(byTopic))
+	for _, st := range byTopic {
+		out = append(out, *st)
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Topic < out[j].Topic })
+	return out
 }
 
 // Close shuts down the bus and all subscriber channels.
@@ -112,9 +271,9 @@ func (b *Bus) Close() {
 		return
 	}
 	b.closed = true
-	for _, chans := range b.subs {
-		for _, ch := range chans {
-			close(ch)
+	for _, subs := range b.subs {
+		for _, sub := range subs {
+			close(sub.ch)
 		}
 	}
 	b.subs = nil
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func topicStats(t *testing.T, b *Bus, topic Topic) TopicStats {
+	t.Helper()
+	for _, st := range b.Stats() {
+		if st.Topic == topic {
+			return st
+		}
+	}
+	return TopicStats{Topic: topic}
+}
+
+func TestBusPublishNeverBlocksOnStalledSubscriber(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+	stalled := b.Subscribe(TopicVolumeStateChanged, 4)
+	live := b.Subscribe(TopicVolumeStateChanged, 1024)
+
+	const publishers, perPublisher = 16, 200
+	got := 0
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for range live {
+			got++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				b.Publish(Event{Topic: TopicVolumeStateChanged, Payload: VolumeStateChanged{Generation: p*perPublisher + i}})
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("publishers blocked on a stalled subscriber")
+	}
+
+	total := publishers * perPublisher
+	st := topicStats(t, b, TopicVolumeStateChanged)
+	if st.Subscribers != 2 {
+		t.Fatalf("subscribers = %d", st.Subscribers)
+	}
+	// The stalled subscriber holds a full buffer; every other event was
+	// dropped exactly once.
+	if len(stalled) != 4 {
+		t.Fatalf("stalled buffer holds %d events", len(stalled))
+	}
+	if st.MaxDropped != uint64(total-4) {
+		t.Fatalf("stalled subscriber drops = %d, want %d", st.MaxDropped, total-4)
+	}
+	// Whatever the live reader missed is accounted for too.
+	liveDropped := st.Dropped - st.MaxDropped
+	b.Unsubscribe(TopicVolumeStateChanged, live)
+	<-readerDone
+	if uint64(got)+liveDropped != uint64(total) {
+		t.Fatalf("live subscriber: received %d + dropped %d != published %d", got, liveDropped, total)
+	}
+}
+
+func TestBusDropsOldestAndKeepsLatest(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+	ch := b.Subscribe(TopicLockStateChanged, 2)
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Topic: TopicLockStateChanged, Payload: i})
+	}
+	first, second := (<-ch).Payload.(int), (<-ch).Payload.(int)
+	if first != 3 || second != 4 {
+		t.Fatalf("expected the two newest events, got %d and %d", first, second)
+	}
+	if st := topicStats(t, b, TopicLockStateChanged); st.Dropped != 3 || st.Buffered != 0 || st.Capacity != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestBusUnsubscribeClosesChannelAndKeepsDrops(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+	ch := b.Subscribe(TopicAudit, 1)
+	exited := make(chan struct{})
+	b.Publish(Event{Topic: TopicAudit})
+	b.Publish(Event{Topic: TopicAudit})
+	go func() {
+		for range ch {
+		}
+		close(exited)
+	}()
+	b.Unsubscribe(TopicAudit, ch)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("range over an unsubscribed channel did not end")
+	}
+	st := topicStats(t, b, TopicAudit)
+	if st.Subscribers != 0 || st.Dropped != 1 {
+		t.Fatalf("unexpected stats after unsubscribe %+v", st)
+	}
+	// Publishing to a topic without subscribers is a no-op.
+	b.Publish(Event{Topic: TopicAudit})
+}
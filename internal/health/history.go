@@ -0,0 +1,159 @@
+package health
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultHistoryLimit is how many transitions are kept per component.
+const DefaultHistoryLimit = 20
+
+// Transition is a change of a component's level.
+type Transition struct {
+	Component string
+	From      Level
+	To        Level
+	Message   string
+	At        time.Time
+	// Flapping is the component's flap state after this change.
+	Flapping bool
+}
+
+// FlapPolicy decides when a component counts as flapping: more than
+// Threshold level changes within Window. It stays flapping until its level
+// has held for CoolDown.
+type FlapPolicy struct {
+	Threshold int
+	Window    time.Duration
+	CoolDown  time.Duration
+	// BlocksReadiness makes Ready fail while a required component flaps.
+	BlocksReadiness bool
+}
+
+// DefaultFlapPolicy flags more than four changes in ten minutes and clears
+// after fifteen stable minutes.
+func DefaultFlapPolicy() FlapPolicy {
+	return FlapPolicy{Threshold: 4, Window: 10 * time.Minute, CoolDown: 15 * time.Minute}
+}
+
+// Stability summarizes a component's history.
+type Stability struct {
+	Flapping bool
+	// Transitions counts every level change since start, including those
+	// dropped from the history.
+	Transitions int
+}
+
+type componentHistory struct {
+	transitions []Transition
+	total       int
+	recent      []time.Time
+	flapping    bool
+	lastChange  time.Time
+}
+
+func (h *componentHistory) flappingAt(now time.Time, p FlapPolicy) bool {
+	return h.flapping && now.Sub(h.lastChange) < p.CoolDown
+}
+
+// SetClock replaces the time source; tests drive it by hand.
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	t.now = now
+	t.mu.Unlock()
+}
+
+// SetHistoryLimit bounds the transitions kept per component.
+func (t *Tracker) SetHistoryLimit(n int) {
+	if n < 1 {
+		n = 1
+	}
+	t.mu.Lock()
+	t.historyLimit = n
+	for _, h := range t.history {
+		if len(h.transitions) > n {
+			h.transitions = append([]Transition(nil), h.transitions[len(h.transitions)-n:]...)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// SetFlapPolicy replaces the flap detection policy.
+func (t *Tracker) SetFlapPolicy(p FlapPolicy) {
+	t.mu.Lock()
+	t.flap = p
+	t.mu.Unlock()
+}
+
+// SetTransitionHook registers fn to hear about every level change. It runs
+// outside the tracker's lock.
+func (t *Tracker) SetTransitionHook(fn func(Transition)) {
+	t.mu.Lock()
+	t.onTransition = fn
+	t.mu.Unlock()
+}
+
+func (t *Tracker) recordTransitionLocked(name string, from Level, status Status, now time.Time) *Transition {
+	h := t.history[name]
+	if h == nil {
+		h = &componentHistory{}
+		t.history[name] = h
+	}
+	h.flapping = h.flappingAt(now, t.flap)
+	cutoff := now.Add(-t.flap.Window)
+	recent := h.recent[:0]
+	for _, at := range h.recent {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	h.recent = append(recent, now)
+	if t.flap.Threshold > 0 && len(h.recent) > t.flap.Threshold {
+		h.flapping = true
+	}
+	h.lastChange = now
+	h.total++
+	tr := Transition{Component: name, From: from, To: status.Level, Message: status.Message, At: now, Flapping: h.flapping}
+	h.transitions = append(h.transitions, tr)
+	if len(h.transitions) > t.historyLimit {
+		h.transitions = h.transitions[len(h.transitions)-t.historyLimit:]
+	}
+	return &tr
+}
+
+// History returns the recorded transitions of name, oldest first, or of
+// every component when name is empty.
+func (t *Tracker) History(name string) []Transition {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var out []Transition
+	for component, h := range t.history {
+		if name == "" || component == name {
+			out = append(out, h.transitions...)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].At.Equal(out[j].At) {
+			return out[i].Component < out[j].Component
+		}
+		return out[i].At.Before(out[j].At)
+	})
+	return out
+}
+
+// Stability reports the flap state and transition count of every tracked
+// component.
+func (t *Tracker) Stability() map[string]Stability {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := t.now()
+	out := make(map[string]Stability, len(t.statuses))
+	for name := range t.statuses {
+		var st Stability
+		if h := t.history[name]; h != nil {
+			st = Stability{Flapping: h.flappingAt(now, t.flap), Transitions: h.total}
+		}
+		out[name] = st
+	}
+	return out
+}
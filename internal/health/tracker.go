@@ -38,27 +38,50 @@ func NewStatus(level Level, message string) Status {
 	return Status{Level: level, Message: message, UpdatedAt: time.Now().UTC()}
 }
 
-// Tracker maintains a thread-safe collection of component health statuses.
+// Tracker maintains a thread-safe collection of component health statuses,
+// with a bounded history of level changes per component.
 type Tracker struct {
 	mu       sync.RWMutex
 	statuses map[string]Status
+	history  map[string]*componentHistory
+
+	now          func() time.Time
+	historyLimit int
+	flap         FlapPolicy
+	onTransition func(Transition)
 }
 
 func NewTracker() *Tracker {
-	return &Tracker{statuses: make(map[string]Status)}
+	return &Tracker{
+		statuses:     make(map[string]Status),
+		history:      make(map[string]*componentHistory),
+		now:          func() time.Time { return time.Now().UTC() },
+		historyLimit: DefaultHistoryLimit,
+		flap:         DefaultFlapPolicy(),
+	}
 }
 
 func (t *Tracker) Set(name string, status Status) {
+	t.mu.Lock()
+	now := t.now()
 	if status.UpdatedAt.IsZero() {
-		status.UpdatedAt = time.Now().UTC()
+		status.UpdatedAt = now
 	}
-	t.mu.Lock()
+	prev, had := t.statuses[name]
 	t.statuses[name] = status
+	var tr *Transition
+	if had && prev.Level != status.Level {
+		tr = t.recordTransitionLocked(name, prev.Level, status, now)
+	}
+	hook := t.onTransition
 	t.mu.Unlock()
+	if tr != nil && hook != nil {
+		hook(*tr)
+	}
 }
 
 func (t *Tracker) Setf(name string, level Level, msg string) {
-	t.Set(name, Status{Level: level, Message: msg, UpdatedAt: time.Now().UTC()})
+	t.Set(name, Status{Level: level, Message: msg})
 }
 
 func (t *Tracker) Status(name string) (Status, bool) {
@@ -90,6 +113,8 @@ func (t *Tracker) Overall() Level {
 	return worst
 }
 
+// Ready reports whether every required component is ok. When the flap
+// policy says so, a flapping required component is not ready either.
 func (t *Tracker) Ready(required ...string) (bool, map[string]Status) {
 	snapshot := t.Snapshot()
 	if len(required) == 0 {
@@ -102,5 +127,17 @@ func (t *Tracker) Ready(required ...string) (bool, map[string]Status) {
 			ok = false
 		}
 	}
+	if ok {
+		t.mu.RLock()
+		if t.flap.BlocksReadiness {
+			now := t.now()
+			for _, name := range required {
+				if h := t.history[name]; h != nil && h.flappingAt(now, t.flap) {
+					ok = false
+				}
+			}
+		}
+		t.mu.RUnlock()
+	}
 	return ok, snapshot
 }
@@ -1,6 +1,10 @@
 package health
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"time"
+)
 
 func TestTrackerSetAndSnapshot(t *testing.T) {
 	tracker := NewTracker()
@@ -42,3 +46,119 @@ func TestTrackerOverall(t *testing.T) {
 		t.Fatalf("expected overall error")
 	}
 }
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newClockedTracker() (*Tracker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tracker := NewTracker()
+	tracker.SetClock(clock.now)
+	tracker.SetFlapPolicy(FlapPolicy{Threshold: 3, Window: time.Minute, CoolDown: 5 * time.Minute, BlocksReadiness: true})
+	return tracker, clock
+}
+
+// flip alternates name between ok and error n times, step apart.
+func flip(tracker *Tracker, clock *fakeClock, name string, n int, step time.Duration) {
+	for i := 0; i < n; i++ {
+		clock.advance(step)
+		level := LevelError
+		if i%2 == 1 {
+			level = LevelOK
+		}
+		tracker.Setf(name, level, fmt.Sprintf("flip %d", i))
+	}
+}
+
+func TestTrackerFlapDetectionAndCoolDown(t *testing.T) {
+	tracker, clock := newClockedTracker()
+	var hooked []Transition
+	tracker.SetTransitionHook(func(tr Transition) { hooked = append(hooked, tr) })
+	tracker.Setf("remote", LevelOK, "connected")
+	tracker.Setf("remote", LevelOK, "still connected")
+	if len(tracker.History("remote")) != 0 {
+		t.Fatalf("same-level updates must not count as transitions")
+	}
+
+	// Three changes within the window stay under the threshold.
+	flip(tracker, clock, "remote", 3, 10*time.Second)
+	if tracker.Stability()["remote"].Flapping {
+		t.Fatalf("three changes should not count as flapping")
+	}
+	// Changes spread wider than the window never flap.
+	flip(tracker, clock, "remote", 4, 2*time.Minute)
+	if tracker.Stability()["remote"].Flapping {
+		t.Fatalf("slow changes should not count as flapping")
+	}
+
+	tracker.Setf("remote", LevelOK, "connected")
+	flip(tracker, clock, "remote", 4, 10*time.Second)
+	st := tracker.Stability()["remote"]
+	if !st.Flapping || st.Transitions != 10 {
+		t.Fatalf("expected flapping after a burst with 10 transitions, got %+v", st)
+	}
+	if last := hooked[len(hooked)-1]; !last.Flapping || last.Component != "remote" || last.To != LevelOK {
+		t.Fatalf("hook missed the flapping transition: %+v", last)
+	}
+	if ready, _ := tracker.Ready("remote"); ready {
+		t.Fatalf("flapping required component should block readiness")
+	}
+
+	// Holds through a cool-down that a new change restarts.
+	clock.advance(4 * time.Minute)
+	tracker.Setf("remote", LevelWarn, "reconnecting")
+	clock.advance(4 * time.Minute)
+	if !tracker.Stability()["remote"].Flapping {
+		t.Fatalf("flapping cleared before a full stable cool-down")
+	}
+	tracker.Setf("remote", LevelOK, "connected")
+	clock.advance(5 * time.Minute)
+	if tracker.Stability()["remote"].Flapping {
+		t.Fatalf("flapping kept after a stable cool-down")
+	}
+	if ready, _ := tracker.Ready("remote"); !ready {
+		t.Fatalf("stable component should be ready again")
+	}
+
+	tracker.SetFlapPolicy(FlapPolicy{Threshold: 3, Window: time.Minute, CoolDown: 5 * time.Minute})
+	flip(tracker, clock, "remote", 4, time.Second)
+	if !tracker.Stability()["remote"].Flapping {
+		t.Fatalf("expected flapping again")
+	}
+	if ready, _ := tracker.Ready("remote"); !ready {
+		t.Fatalf("flapping should not affect readiness unless the policy asks")
+	}
+}
+
+func TestTrackerHistoryIsBounded(t *testing.T) {
+	tracker, clock := newClockedTracker()
+	tracker.SetHistoryLimit(5)
+	tracker.Setf("volume", LevelOK, "mounted")
+	tracker.Setf("other", LevelOK, "fine")
+	flip(tracker, clock, "volume", 8, time.Second)
+	clock.advance(time.Second)
+	tracker.Setf("other", LevelWarn, "degraded")
+
+	history := tracker.History("volume")
+	if len(history) != 5 {
+		t.Fatalf("expected 5 transitions, got %d", len(history))
+	}
+	if history[0].Message != "flip 3" || history[4].Message != "flip 7" {
+		t.Fatalf("expected the newest transitions oldest first, got %+v", history)
+	}
+	if history[0].From != LevelError || history[0].To != LevelOK {
+		t.Fatalf("unexpected transition levels: %+v", history[0])
+	}
+	if got := tracker.Stability()["volume"].Transitions; got != 8 {
+		t.Fatalf("transition count should include truncated entries, got %d", got)
+	}
+	all := tracker.History("")
+	if len(all) != 6 || all[5].Component != "other" {
+		t.Fatalf("expected merged history ending with other, got %+v", all)
+	}
+	tracker.SetHistoryLimit(2)
+	if got := len(tracker.History("volume")); got != 2 {
+		t.Fatalf("lowering the limit should trim history, got %d", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Package identity owns the device name: the label advertised over mDNS as
+// <name>.local and offered as the default portal subdomain.
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"piccolod/internal/persistence"
+)
+
+// DefaultName is used until a name is configured.
+const DefaultName = "piccolo"
+
+const maxLabelLength = 63
+
+// ErrInvalidName reports a name that is not a usable DNS label.
+var ErrInvalidName = errors.New("identity: invalid device name")
+
+// Identity is the device identity as reported over the API.
+type Identity struct {
+	Name         string     `json:"name"`
+	MDNSHostname string     `json:"mdns_hostname"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+type bootstrapCopy struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Manager keeps the device name in the control store and mirrors it to the
+// bootstrap volume, which is readable before unlock.
+type Manager struct {
+	repo persistence.IdentityRepo
+	path string
+	now  func() time.Time
+
+	mu        sync.RWMutex
+	name      string
+	updatedAt time.Time
+}
+
+// NewManager loads the bootstrap copy from bootstrapDir, falling back to
+// DefaultName. The control store is consulted on ReloadFromStorage.
+func NewManager(repo persistence.IdentityRepo, bootstrapDir string) *Manager {
+	m := &Manager{repo: repo, now: time.Now, name: DefaultName}
+	if bootstrapDir != "" {
+		m.path = filepath.Join(bootstrapDir, "identity", "device.json")
+		if data, err := os.ReadFile(m.path); err == nil {
+			var boot bootstrapCopy
+			if json.Unmarshal(data, &boot) == nil && ValidateName(boot.Name) == nil {
+				m.name = boot.Name
+				m.updatedAt = boot.UpdatedAt
+			}
+		}
+	}
+	return m
+}
+
+// NormalizeName lower-cases and trims name.
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ValidateName reports whether name is a single DNS label: 1-63 lowercase
+// letters, digits or hyphens, not starting or ending with a hyphen.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name required", ErrInvalidName)
+	}
+	if len(name) > maxLabelLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrInvalidName, maxLabelLength)
+	}
+	if name[0] == '-' || name[len(name)-1] == '-' {
+		return fmt.Errorf("%w: must not start or end with a hyphen", ErrInvalidName)
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return fmt.Errorf("%w: only lowercase letters, digits and hyphens are allowed", ErrInvalidName)
+		}
+	}
+	return nil
+}
+
+// Name returns the current device name.
+func (m *Manager) Name() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.name
+}
+
+// Current returns the identity for API responses.
+func (m *Manager) Current() Identity {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id := Identity{Name: m.name, MDNSHostname: m.name + ".local"}
+	if !m.updatedAt.IsZero() {
+		t := m.updatedAt
+		id.UpdatedAt = &t
+	}
+	return id
+}
+
+// Rename validates and stores name, returning the previous name. The
+// control store must be unlocked.
+func (m *Manager) Rename(ctx context.Context, name string) (string, error) {
+	name = NormalizeName(name)
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous := m.name
+	if m.repo == nil {
+		return "", persistence.ErrNotImplemented
+	}
+	now := m.now().UTC()
+	if err := m.repo.SaveIdentity(ctx, persistence.DeviceIdentity{Name: name, UpdatedAt: now}); err != nil {
+		return "", err
+	}
+	m.name = name
+	m.updatedAt = now
+	m.writeBootstrapLocked()
+	return previous, nil
+}
+
+// ReloadFromStorage adopts the name from the control store once it is
+// readable and refreshes the bootstrap copy.
+func (m *Manager) ReloadFromStorage() error {
+	if m.repo == nil {
+		return nil
+	}
+	stored, err := m.repo.CurrentIdentity(context.Background())
+	if errors.Is(err, persistence.ErrNotFound) || errors.Is(err, persistence.ErrNotImplemented) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ValidateName(stored.Name) != nil {
+		return fmt.Errorf("identity: stored device name %q is invalid", stored.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored.Name == m.name && stored.UpdatedAt.Equal(m.updatedAt) {
+		return nil
+	}
+	m.name = stored.Name
+	m.updatedAt = stored.UpdatedAt
+	m.writeBootstrapLocked()
+	return nil
+}
+
+func (m *Manager) writeBootstrapLocked() {
+	if m.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(bootstrapCopy{Name: m.name, UpdatedAt: m.updatedAt}, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(m.path, data)
+	}
+	if err != nil {
+		// The control store holds the authoritative name; a stale copy
+		// only affects what is advertised before the next unlock.
+		log.Printf("WARN: failed to write bootstrap device name: %v", err)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".device-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
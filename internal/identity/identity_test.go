@@ -0,0 +1,81 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"piccolod/internal/persistence"
+)
+
+type fakeRepo struct {
+	stored *persistence.DeviceIdentity
+	err    error
+}
+
+func (r *fakeRepo) CurrentIdentity(ctx context.Context) (persistence.DeviceIdentity, error) {
+	if r.err != nil {
+		return persistence.DeviceIdentity{}, r.err
+	}
+	if r.stored == nil {
+		return persistence.DeviceIdentity{}, persistence.ErrNotFound
+	}
+	return *r.stored, nil
+}
+
+func (r *fakeRepo) SaveIdentity(ctx context.Context, id persistence.DeviceIdentity) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.stored = &id
+	return nil
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"a", "piccolo", "node-2", "0abc"} {
+		if err := ValidateName(name); err != nil {
+			t.Fatalf("ValidateName(%q) = %v", name, err)
+		}
+	}
+	long := make([]byte, maxLabelLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	for _, name := range []string{"", "-a", "a-", "A", "a.b", "a_b", string(long)} {
+		if err := ValidateName(name); !errors.Is(err, ErrInvalidName) {
+			t.Fatalf("ValidateName(%q) = %v, want ErrInvalidName", name, err)
+		}
+	}
+}
+
+func TestManagerReloadRefreshesBootstrapCopy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "identity-reload")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := &fakeRepo{err: persistence.ErrLocked}
+	m := NewManager(repo, dir)
+	if _, err := m.Rename(context.Background(), "kitchen"); !errors.Is(err, persistence.ErrLocked) {
+		t.Fatalf("Rename while locked = %v", err)
+	}
+	if m.Name() != DefaultName {
+		t.Fatalf("failed rename changed name to %q", m.Name())
+	}
+
+	// Another node renamed the device while this one was sealed.
+	repo.err = nil
+	repo.stored = &persistence.DeviceIdentity{Name: "garage", UpdatedAt: time.Now().UTC()}
+	if err := m.ReloadFromStorage(); err != nil {
+		t.Fatalf("ReloadFromStorage: %v", err)
+	}
+	if m.Name() != "garage" {
+		t.Fatalf("Name() = %q after reload", m.Name())
+	}
+	if got := NewManager(nil, dir).Name(); got != "garage" {
+		t.Fatalf("bootstrap copy = %q, want garage", got)
+	}
+}
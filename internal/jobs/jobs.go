@@ -0,0 +1,260 @@
+// Package jobs tracks long-running operations that outlive the HTTP request
+// that started them, so clients can poll their progress or cancel them.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle position of a job.
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// DefaultRetention is how many finished jobs a registry keeps for polling.
+const DefaultRetention = 100
+
+var (
+	ErrNotFound = errors.New("jobs: not found")
+	ErrFinished = errors.New("jobs: already finished")
+)
+
+// Progress is the latest step a job reported. Current and Total are
+// optional counters (for example image layers copied so far).
+type Progress struct {
+	Stage   string `json:"stage,omitempty"`
+	Current int    `json:"current,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Job is the pollable record of one operation.
+type Job struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	State      State     `json:"state"`
+	Progress   Progress  `json:"progress"`
+	Result     any       `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Details    any       `json:"details,omitempty"` // structured context for a DetailedError
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Done reports whether the job reached a terminal state.
+func (j Job) Done() bool { return j.State != StateRunning }
+
+// Func is the body of a job. It must return promptly once ctx is done and
+// may call report any number of times.
+type Func func(ctx context.Context, report func(Progress)) (any, error)
+
+// DetailedError is a job failure that carries structured details alongside
+// its message, such as the step log of a failed install.
+type DetailedError struct {
+	Err     error
+	Details any
+}
+
+func (e *DetailedError) Error() string { return e.Err.Error() }
+
+func (e *DetailedError) Unwrap() error { return e.Err }
+
+type entry struct {
+	job      Job
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+}
+
+// Registry runs jobs and keeps their records in memory.
+type Registry struct {
+	mu       sync.Mutex
+	jobs     map[string]*entry
+	finished []string
+	keep     int
+	wg       sync.WaitGroup
+}
+
+// NewRegistry returns an empty registry keeping DefaultRetention finished jobs.
+func NewRegistry() *Registry {
+	return &Registry{jobs: make(map[string]*entry), keep: DefaultRetention}
+}
+
+// Start runs fn in the background and returns its initial record. The job
+// context is detached from the caller's so it survives the request; a
+// positive timeout bounds the whole job.
+func (r *Registry) Start(kind string, timeout time.Duration, fn Func) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, timeout)
+		base := cancel
+		cancel = func() { stop(); base() }
+	}
+	now := time.Now().UTC()
+	e := &entry{
+		job:    Job{ID: newID(), Kind: kind, State: StateRunning, StartedAt: now, UpdatedAt: now},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.jobs[e.job.ID] = e
+	job := e.job
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		result, err := fn(ctx, func(p Progress) { r.report(e, p) })
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		r.finish(e, result, err, timeout)
+	}()
+	return job
+}
+
+// Record stores an operation that already completed synchronously so it can
+// be polled alongside background jobs.
+func (r *Registry) Record(kind string, result any, err error) Job {
+	now := time.Now().UTC()
+	e := &entry{
+		job:  Job{ID: newID(), Kind: kind, State: StateRunning, StartedAt: now, UpdatedAt: now},
+		done: make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.jobs[e.job.ID] = e
+	r.mu.Unlock()
+	r.finish(e, result, err, 0)
+	job, _ := r.Get(e.job.ID)
+	return job
+}
+
+// Get returns the current record for id.
+func (r *Registry) Get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// Cancel stops a running job. The job's context is canceled immediately;
+// its record turns canceled once fn returns.
+func (r *Registry) Cancel(id string) (Job, error) {
+	r.mu.Lock()
+	e, ok := r.jobs[id]
+	if !ok {
+		r.mu.Unlock()
+		return Job{}, ErrNotFound
+	}
+	if e.job.Done() {
+		job := e.job
+		r.mu.Unlock()
+		return job, ErrFinished
+	}
+	e.canceled = true
+	cancel := e.cancel
+	job := e.job
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return job, nil
+}
+
+// Wait blocks until the job finishes or ctx is done.
+func (r *Registry) Wait(ctx context.Context, id string) (Job, error) {
+	r.mu.Lock()
+	e, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	select {
+	case <-e.done:
+		job, _ := r.Get(id)
+		return job, nil
+	case <-ctx.Done():
+		job, _ := r.Get(id)
+		return job, ctx.Err()
+	}
+}
+
+// Close cancels running jobs and waits for them to return.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	for _, e := range r.jobs {
+		if !e.job.Done() && e.cancel != nil {
+			e.canceled = true
+			e.cancel()
+		}
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+func (r *Registry) report(e *entry, p Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.job.Done() {
+		return
+	}
+	e.job.Progress = p
+	e.job.UpdatedAt = time.Now().UTC()
+}
+
+func (r *Registry) finish(e *entry, result any, err error, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	e.job.UpdatedAt = now
+	e.job.FinishedAt = now
+	switch {
+	case err == nil:
+		e.job.State = StateSucceeded
+		e.job.Result = result
+	case e.canceled:
+		e.job.State = StateCanceled
+		e.job.Error = "canceled"
+	case errors.Is(err, context.DeadlineExceeded) && timeout > 0:
+		e.job.State = StateFailed
+		e.job.Error = fmt.Sprintf("timed out after %s", timeout)
+	default:
+		e.job.State = StateFailed
+		e.job.Error = err.Error()
+		var detailed *DetailedError
+		if errors.As(err, &detailed) {
+			e.job.Details = detailed.Details
+		}
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+	close(e.done)
+	r.finished = append(r.finished, e.job.ID)
+	for len(r.finished) > r.keep {
+		delete(r.jobs, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
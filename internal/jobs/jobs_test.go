@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func waitJob(t *testing.T, r *Registry, id string) Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	job, err := r.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("wait %s: %v (state %s)", id, err, job.State)
+	}
+	return job
+}
+
+func TestRegistryRunsAndReportsProgress(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+	release := make(chan struct{})
+	job := r.Start("test", 0, func(ctx context.Context, report func(Progress)) (any, error) {
+		report(Progress{Stage: "copying", Current: 1, Total: 3})
+		<-release
+		return "ok", nil
+	})
+	if job.State != StateRunning || job.ID == "" {
+		t.Fatalf("initial job: %+v", job)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, _ := r.Get(job.ID)
+		if got.Progress.Stage == "copying" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("progress never reported: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	done := waitJob(t, r, job.ID)
+	if done.State != StateSucceeded || done.Result != "ok" || done.FinishedAt.IsZero() {
+		t.Fatalf("finished job: %+v", done)
+	}
+	if _, err := r.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Fatalf("cancel finished job: %v", err)
+	}
+}
+
+func TestRegistryCancelAndTimeout(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+	blocked := func(ctx context.Context, report func(Progress)) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	job := r.Start("test", 0, blocked)
+	if _, err := r.Cancel(job.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got := waitJob(t, r, job.ID); got.State != StateCanceled {
+		t.Fatalf("canceled job state = %s", got.State)
+	}
+
+	job = r.Start("test", 20*time.Millisecond, blocked)
+	if got := waitJob(t, r, job.ID); got.State != StateFailed || got.Error != "timed out after 20ms" {
+		t.Fatalf("timed out job: %+v", got)
+	}
+
+	if _, err := r.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("cancel unknown job: %v", err)
+	}
+}
+
+func TestRegistryRecordAndRetention(t *testing.T) {
+	r := NewRegistry()
+	r.keep = 2
+	first := r.Record("export", "a", nil)
+	failed := r.Record("export", nil, errors.New("disk full"))
+	r.Record("export", "c", nil)
+	if _, ok := r.Get(first.ID); ok {
+		t.Fatalf("oldest finished job should be pruned")
+	}
+	got, ok := r.Get(failed.ID)
+	if !ok || got.State != StateFailed || got.Error != "disk full" {
+		t.Fatalf("recorded failure: %+v ok=%v", got, ok)
+	}
+
+	detailed := r.Record("export", nil, fmt.Errorf("export: %w", &DetailedError{Err: errors.New("disk full"), Details: map[string]string{"step": "write"}}))
+	if detailed.Error != "export: disk full" || detailed.Details.(map[string]string)["step"] != "write" {
+		t.Fatalf("detailed failure: %+v", detailed)
+	}
+}
@@ -20,6 +20,28 @@ var (
 	}
 )
 
+// selectAddrs picks the IPv4 and IPv6 address advertised for an interface
+// from its addresses.
+func selectAddrs(addrs []net.Addr) (ipv4Addr, ipv6Addr net.IP) {
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if ipv4 := ipnet.IP.To4(); ipv4 != nil {
+				// IPv4 address - skip link-local
+				if !ipnet.IP.IsLinkLocalUnicast() {
+					ipv4Addr = ipv4
+				}
+			} else if ipv6 := ipnet.IP.To16(); ipv6 != nil {
+				// IPv6 address - accept link-local (required by RFC 6762), skip only loopback
+				// RFC 6762 Section 15: "Multicast DNS operates over link-local scope"
+				if !ipnet.IP.IsLoopback() {
+					ipv6Addr = ipv6
+				}
+			}
+		}
+	}
+	return ipv4Addr, ipv6Addr
+}
+
 // discoverInterfaces finds and sets up all suitable network interfaces
 func (m *Manager) discoverInterfaces() error {
 	interfaces, err := listNetworkInterfaces()
@@ -66,25 +88,8 @@ func (m *Manager) setupInterface(iface *net.Interface) error {
 		return err
 	}
 
-	var ipv4Addr, ipv6Addr net.IP
-
 	// Find IPv4 and IPv6 addresses
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok {
-			if ipv4 := ipnet.IP.To4(); ipv4 != nil {
-				// IPv4 address - skip link-local
-				if !ipnet.IP.IsLinkLocalUnicast() {
-					ipv4Addr = ipv4
-				}
-			} else if ipv6 := ipnet.IP.To16(); ipv6 != nil {
-				// IPv6 address - accept link-local (required by RFC 6762), skip only loopback
-				// RFC 6762 Section 15: "Multicast DNS operates over link-local scope"
-				if !ipnet.IP.IsLoopback() {
-					ipv6Addr = ipv6
-				}
-			}
-		}
-	}
+	ipv4Addr, ipv6Addr := selectAddrs(addrs)
 
 	// Need at least one IP stack
 	if ipv4Addr == nil && ipv6Addr == nil {
@@ -292,23 +297,6 @@ func (m *Manager) createIPv6Socket(iface *net.Interface) (*net.UDPConn, error) {
 	return conn, nil
 }
 
-// networkMonitor continuously monitors network interface changes
-func (m *Manager) networkMonitor() {
-	defer m.wg.Done()
-
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-m.stopCh:
-			return
-		case <-ticker.C:
-			m.checkInterfaceChanges()
-		}
-	}
-}
-
 // checkInterfaceChanges detects and handles interface changes
 func (m *Manager) checkInterfaceChanges() {
 	interfaces, err := listNetworkInterfaces()
@@ -370,21 +358,7 @@ func (m *Manager) hasIPChanged(iface *net.Interface, state *InterfaceState) bool
 		return true // Assume changed if we can't check
 	}
 
-	var newIPv4, newIPv6 net.IP
-
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok {
-			if ipv4 := ipnet.IP.To4(); ipv4 != nil {
-				if !ipnet.IP.IsLinkLocalUnicast() {
-					newIPv4 = ipv4
-				}
-			} else if ipv6 := ipnet.IP.To16(); ipv6 != nil {
-				if !ipnet.IP.IsLoopback() {
-					newIPv6 = ipv6
-				}
-			}
-		}
-	}
+	newIPv4, newIPv6 := selectAddrs(addrs)
 
 	ipv4Changed := !state.IPv4.Equal(newIPv4)
 	ipv6Changed := !state.IPv6.Equal(newIPv6)
@@ -75,6 +75,11 @@ func NewManager() *Manager {
 
 	manager.ipv4SocketFactory = manager.createIPv4Socket
 	manager.ipv6SocketFactory = manager.createIPv6Socket
+	manager.addresses = currentAddresses
+	manager.records = socketAnnouncer{manager}
+	manager.openChangeWatch = openNetlinkWatch
+	manager.watchPoll = defaultWatchPoll
+	manager.watchDebounce = defaultWatchDebounce
 
 	return manager
 }
@@ -83,14 +88,26 @@ func NewManager() *Manager {
 func (m *Manager) Start() error {
 	log.Printf("INFO: Starting multi-interface mDNS manager (machine ID: %s)", m.machineID)
 
+	// A restart after Stop begins from fresh interfaces; Stop has already
+	// waited for every goroutine reading the old stop channel.
+	select {
+	case <-m.stopCh:
+		m.mutex.Lock()
+		m.interfaces = make(map[string]*InterfaceState)
+		m.stopCh = make(chan struct{})
+		m.mutex.Unlock()
+	default:
+	}
+
 	// Discover and setup all network interfaces
 	if err := m.discoverInterfaces(); err != nil {
 		return fmt.Errorf("failed to discover network interfaces: %w", err)
 	}
 
-	// Start network monitor for interface changes
+	// Watch for interface and address changes
+	m.startAddressWatch()
 	m.wg.Add(1)
-	go m.networkMonitor()
+	go m.watchAddresses()
 
 	// Start announcement routine
 	m.wg.Add(1)
@@ -129,6 +146,9 @@ func (m *Manager) Start() error {
 
 // Stop shuts down the mDNS server
 func (m *Manager) Stop() error {
+	// Say goodbye while the sockets are still open
+	m.stopAddressWatch()
+
 	close(m.stopCh)
 
 	// Close all interface connections
@@ -224,3 +244,48 @@ func (m *Manager) currentServiceName() string {
 	defer m.mutex.RUnlock()
 	return m.finalName
 }
+
+// Name returns the advertised name without the .local suffix.
+func (m *Manager) Name() string {
+	return m.currentServiceName()
+}
+
+// SetName re-registers the device under name. Any conflict suffix applied
+// to the old name is dropped and the new name is probed and announced.
+func (m *Manager) SetName(name string) {
+	m.mutex.Lock()
+	if m.baseName == name {
+		m.mutex.Unlock()
+		return
+	}
+	oldName := m.finalName
+	m.baseName = name
+	m.hostname = name
+	m.finalName = name
+	m.mutex.Unlock()
+
+	m.conflictDetector.mutex.Lock()
+	m.conflictDetector.ConflictDetected = false
+	m.conflictDetector.CurrentSuffix = ""
+	m.conflictDetector.ConflictingSources = make(map[string]ConflictingHost)
+	m.conflictDetector.mutex.Unlock()
+
+	log.Printf("INFO: mDNS name changed from %s.local to %s.local", oldName, name)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if m.detectNameConflicts() {
+			m.resolveNameConflict()
+		}
+		for i := 0; i < 3; i++ {
+			select {
+			case <-m.stopCh:
+				return
+			default:
+				m.sendMultiInterfaceAnnouncements()
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
@@ -406,3 +406,27 @@ func TestGoroutineDeadlockRegression(t *testing.T) {
 		t.Error("REGRESSION: Manager.Stop() hung - deadlock detected!")
 	}
 }
+
+func TestManagerSetNameDropsConflictSuffix(t *testing.T) {
+	manager := NewManager()
+	manager.resolveNameConflict()
+	if manager.Name() == "piccolo" {
+		t.Fatalf("expected conflict suffix before rename")
+	}
+
+	manager.SetName("kitchen")
+	if got := manager.Name(); got != "kitchen" {
+		t.Fatalf("Name() = %q, want kitchen", got)
+	}
+	if manager.baseName != "kitchen" || manager.conflictDetector.CurrentSuffix != "" {
+		t.Fatalf("rename kept stale state: base=%q suffix=%q", manager.baseName, manager.conflictDetector.CurrentSuffix)
+	}
+
+	// A later conflict suffixes the new base name.
+	manager.resolveNameConflict()
+	if got, want := manager.Name(), "kitchen-"+manager.machineID; got != want {
+		t.Fatalf("Name() after conflict = %q, want %q", got, want)
+	}
+	close(manager.stopCh)
+	manager.wg.Wait()
+}
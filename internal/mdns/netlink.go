@@ -0,0 +1,68 @@
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// netlinkWatch receives link and address notifications from the kernel's
+// route netlink groups.
+type netlinkWatch struct {
+	fd  int
+	buf []byte
+}
+
+// openNetlinkWatch subscribes to link and IPv4/IPv6 address changes.
+func openNetlinkWatch() (changeWatch, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("netlink bind: %w", err)
+	}
+	// Wake up every second so the watcher notices Stop.
+	tv := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("netlink receive timeout: %w", err)
+	}
+	return &netlinkWatch{fd: fd, buf: make([]byte, 1<<16)}, nil
+}
+
+func (w *netlinkWatch) wait() (bool, error) {
+	n, _, err := syscall.Recvfrom(w.fd, w.buf, 0)
+	if err != nil {
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return false, nil
+		}
+		if errors.Is(err, syscall.ENOBUFS) {
+			// Notifications were dropped; assume something changed.
+			return true, nil
+		}
+		return false, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(w.buf[:n])
+	if err != nil {
+		return true, nil
+	}
+	for _, msg := range msgs {
+		switch msg.Header.Type {
+		case syscall.RTM_NEWLINK, syscall.RTM_DELLINK, syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (w *netlinkWatch) close() {
+	syscall.Close(w.fd)
+}
@@ -11,6 +11,23 @@ import (
 	"github.com/miekg/dns"
 )
 
+// DiscoveryPath is the device's unauthenticated status endpoint, advertised
+// in the TXT record of the host name so LAN clients can find it.
+const DiscoveryPath = "/api/v1/discovery"
+
+// discoveryTXT returns the TXT record advertising DiscoveryPath for name.
+func discoveryTXT(name string) *dns.TXT {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    120,
+		},
+		Txt: []string{"path=" + DiscoveryPath},
+	}
+}
+
 // interfaceResponder handles dual-stack mDNS queries on a specific interface
 func (m *Manager) interfaceResponder(state *InterfaceState) {
 	defer m.wg.Done()
@@ -235,6 +252,10 @@ func (m *Manager) handleDualStackQuery(data []byte, clientAddr *net.UDPAddr, sta
 				log.Printf("DEBUG: [%s-%s] Adding AAAA record: %s -> %s",
 					state.Interface.Name, stack, serviceName, state.IPv6.String())
 			}
+
+			if q.Qtype == dns.TypeTXT || q.Qtype == dns.TypeANY {
+				response.Answer = append(response.Answer, discoveryTXT(q.Name))
+			}
 		}
 	}
 
@@ -350,7 +371,7 @@ func (m *Manager) sendIPv4Announcement(name string, state *InterfaceState, servi
 		},
 		A: state.IPv4,
 	}
-	msg.Answer = append(msg.Answer, rr)
+	msg.Answer = append(msg.Answer, rr, discoveryTXT(serviceName+".local."))
 
 	if data, err := msg.Pack(); err == nil {
 		multicastAddr := &net.UDPAddr{
@@ -384,7 +405,7 @@ func (m *Manager) sendIPv6Announcement(name string, state *InterfaceState, servi
 		},
 		AAAA: state.IPv6,
 	}
-	msg.Answer = append(msg.Answer, rr)
+	msg.Answer = append(msg.Answer, rr, discoveryTXT(serviceName+".local."))
 
 	if data, err := msg.Pack(); err == nil {
 		multicastAddr := &net.UDPAddr{
@@ -293,3 +293,47 @@ func TestIPv6LinkLocal_mDNSCompliance(t *testing.T) {
 		t.Fatalf("stored IPv6 address mismatch: got %v, want %v", state.IPv6, linkLocalIP)
 	}
 }
+
+func TestHandleDualStackQuery_AdvertisesDiscoveryPath(t *testing.T) {
+	manager := NewManager()
+	state := createMockInterfaceState("eth0", true, false)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	state.IPv4Conn = conn
+	manager.interfaces["eth0"] = state
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen client: %v", err)
+	}
+	defer client.Close()
+
+	query := dns.Msg{}
+	query.SetQuestion(manager.finalName+".local.", dns.TypeTXT)
+	data, err := query.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack DNS query: %v", err)
+	}
+	manager.handleDualStackQuery(data, client.LocalAddr().(*net.UDPAddr), state, "IPv4")
+
+	buf := make([]byte, 1500)
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("no response: %v", err)
+	}
+	var resp dns.Msg
+	if err := resp.Unpack(buf[:n]); err != nil {
+		t.Fatalf("unpack response: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("answers = %v, want one TXT record", resp.Answer)
+	}
+	txt, ok := resp.Answer[0].(*dns.TXT)
+	if !ok || len(txt.Txt) != 1 || txt.Txt[0] != "path="+DiscoveryPath {
+		t.Fatalf("unexpected answer %v", resp.Answer[0])
+	}
+}
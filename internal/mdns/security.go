@@ -133,7 +133,7 @@ func (m *Manager) validateDNSMessage(msg *dns.Msg) error {
 			return fmt.Errorf("unsupported query class: %d", q.Qclass)
 		}
 
-		if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA && q.Qtype != dns.TypeANY {
+		if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA && q.Qtype != dns.TypeTXT && q.Qtype != dns.TypeANY {
 			return fmt.Errorf("unsupported query type: %d", q.Qtype)
 		}
 
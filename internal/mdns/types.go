@@ -155,4 +155,12 @@ type Manager struct {
 	// Socket factories (overrideable for tests)
 	ipv4SocketFactory func(*net.Interface) (*net.UDPConn, error)
 	ipv6SocketFactory func(*net.Interface) (*net.UDPConn, error)
+
+	// Address change watching (overrideable for tests)
+	addresses       addressProvider
+	records         recordAnnouncer
+	openChangeWatch func() (changeWatch, error)
+	watchPoll       time.Duration
+	watchDebounce   time.Duration
+	watch           watchState
 }
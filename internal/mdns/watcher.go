@@ -0,0 +1,419 @@
+package mdns
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultWatchPoll is how often addresses are compared when no change
+	// notification arrives; it is the only trigger without netlink.
+	defaultWatchPoll = 10 * time.Second
+	// defaultWatchDebounce is how long addresses must stay put before they
+	// are re-announced, so a flapping link is announced once it settles.
+	defaultWatchDebounce = 2 * time.Second
+)
+
+// Address watcher modes reported in AddressStatus.
+const (
+	WatchNetlink = "netlink"
+	WatchPoll    = "poll"
+)
+
+// ErrNotRunning is returned when re-announcing before Start or after Stop.
+var ErrNotRunning = errors.New("mdns: manager not running")
+
+// Address is one address the device name is advertised under.
+type Address struct {
+	Interface string `json:"interface"`
+	IP        string `json:"ip"`
+}
+
+// AddressStatus reports what the manager currently advertises.
+type AddressStatus struct {
+	Name           string     `json:"name"`
+	Running        bool       `json:"running"`
+	Watcher        string     `json:"watcher,omitempty"`
+	Addresses      []Address  `json:"addresses"`
+	LastReannounce *time.Time `json:"last_reannounce,omitempty"`
+	Reannounces    uint64     `json:"reannounces"`
+}
+
+// addressProvider lists the addresses the device should be advertised
+// under right now.
+type addressProvider func() ([]Address, error)
+
+// recordAnnouncer publishes the device's address records. The default sends
+// them on the manager's sockets; tests substitute a fake.
+type recordAnnouncer interface {
+	// withdraw sends goodbye records (TTL 0) for addresses no longer held.
+	withdraw(addrs []Address)
+	// reannounce reopens sockets for the current addresses and announces them.
+	reannounce(addrs []Address)
+	// refresh retries interfaces whose sockets could not be set up.
+	refresh()
+}
+
+// changeWatch delivers kernel notifications of link and address changes.
+type changeWatch interface {
+	// wait blocks for a notification for up to about a second and reports
+	// whether one arrived.
+	wait() (bool, error)
+	close()
+}
+
+// watchState is the address watcher's view of what is advertised.
+type watchState struct {
+	mu             sync.Mutex
+	running        bool
+	mode           string
+	advertised     []Address
+	lastReannounce time.Time
+	reannounces    uint64
+	onReannounce   func(AddressStatus)
+}
+
+// currentAddresses lists the address selected on every interface that
+// setupInterface would accept.
+func currentAddresses() ([]Address, error) {
+	interfaces, err := listNetworkInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []Address
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		ifaceCopy := iface
+		addrs, err := interfaceAddrs(&ifaceCopy)
+		if err != nil {
+			continue
+		}
+		ipv4Addr, ipv6Addr := selectAddrs(addrs)
+		if ipv4Addr != nil {
+			out = append(out, Address{Interface: iface.Name, IP: ipv4Addr.String()})
+		}
+		if ipv6Addr != nil {
+			out = append(out, Address{Interface: iface.Name, IP: ipv6Addr.String()})
+		}
+	}
+	return sortAddresses(out), nil
+}
+
+func sortAddresses(addrs []Address) []Address {
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Interface != addrs[j].Interface {
+			return addrs[i].Interface < addrs[j].Interface
+		}
+		return addrs[i].IP < addrs[j].IP
+	})
+	return addrs
+}
+
+// missingAddresses returns the addresses in from that are not in in.
+func missingAddresses(from, in []Address) []Address {
+	held := make(map[Address]bool, len(in))
+	for _, a := range in {
+		held[a] = true
+	}
+	var out []Address
+	for _, a := range from {
+		if !held[a] {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// SetReannounceHook registers fn to be called with the new status after
+// every re-announcement.
+func (m *Manager) SetReannounceHook(fn func(AddressStatus)) {
+	m.watch.mu.Lock()
+	m.watch.onReannounce = fn
+	m.watch.mu.Unlock()
+}
+
+// Addresses reports the advertised addresses and when they were last
+// re-announced.
+func (m *Manager) Addresses() AddressStatus {
+	m.watch.mu.Lock()
+	defer m.watch.mu.Unlock()
+	return m.addressStatusLocked()
+}
+
+func (m *Manager) addressStatusLocked() AddressStatus {
+	st := AddressStatus{
+		Name:        m.currentServiceName(),
+		Running:     m.watch.running,
+		Watcher:     m.watch.mode,
+		Addresses:   append([]Address{}, m.watch.advertised...),
+		Reannounces: m.watch.reannounces,
+	}
+	if !m.watch.lastReannounce.IsZero() {
+		t := m.watch.lastReannounce
+		st.LastReannounce = &t
+	}
+	return st
+}
+
+// Reannounce announces the current addresses now, withdrawing any that
+// went away, whether or not the watcher noticed a change.
+func (m *Manager) Reannounce() (AddressStatus, error) {
+	m.watch.mu.Lock()
+	running := m.watch.running
+	m.watch.mu.Unlock()
+	if !running {
+		return m.Addresses(), ErrNotRunning
+	}
+	return m.reconcileAddresses(true), nil
+}
+
+// startAddressWatch records the addresses set up by discoverInterfaces as
+// advertised; the announcer goroutine sends the first announcements.
+func (m *Manager) startAddressWatch() {
+	addrs, err := m.addresses()
+	if err != nil {
+		log.Printf("WARN: Failed to list mDNS addresses: %v", err)
+	}
+	m.watch.mu.Lock()
+	m.watch.running = true
+	m.watch.mode = ""
+	m.watch.advertised = addrs
+	m.watch.mu.Unlock()
+}
+
+// stopAddressWatch withdraws every advertised address so peers drop the
+// name at once instead of waiting out the TTL.
+func (m *Manager) stopAddressWatch() {
+	m.watch.mu.Lock()
+	defer m.watch.mu.Unlock()
+	if m.watch.running && len(m.watch.advertised) > 0 {
+		m.records.withdraw(m.watch.advertised)
+	}
+	m.watch.running = false
+	m.watch.advertised = nil
+}
+
+// watchAddresses re-announces the device whenever its addresses change. It
+// listens for netlink notifications where available and polls as a fallback;
+// either way a change is only acted on once addresses have been stable for
+// watchDebounce.
+func (m *Manager) watchAddresses() {
+	defer m.wg.Done()
+
+	changes := make(chan struct{}, 1)
+	mode := WatchPoll
+	if w, err := m.openChangeWatch(); err != nil {
+		log.Printf("INFO: mDNS address watcher polling every %s (netlink unavailable: %v)", m.watchPoll, err)
+	} else {
+		mode = WatchNetlink
+		m.wg.Add(1)
+		go m.forwardChanges(w, changes)
+	}
+	m.watch.mu.Lock()
+	m.watch.mode = mode
+	m.watch.mu.Unlock()
+
+	ticker := time.NewTicker(m.watchPoll)
+	defer ticker.Stop()
+
+	var settle *time.Timer
+	var settled <-chan time.Time
+	arm := func() {
+		if settle == nil {
+			settle = time.NewTimer(m.watchDebounce)
+		} else {
+			if !settle.Stop() {
+				select {
+				case <-settle.C:
+				default:
+				}
+			}
+			settle.Reset(m.watchDebounce)
+		}
+		settled = settle.C
+	}
+	defer func() {
+		if settle != nil {
+			settle.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-changes:
+			arm()
+		case <-ticker.C:
+			// A pending change is already waiting to settle; only
+			// notifications push it back.
+			if settled != nil {
+				continue
+			}
+			if m.addressesChanged() {
+				arm()
+			} else {
+				m.records.refresh()
+			}
+		case <-settled:
+			settled = nil
+			m.reconcileAddresses(false)
+		}
+	}
+}
+
+// forwardChanges turns netlink notifications into change signals until the
+// manager stops.
+func (m *Manager) forwardChanges(w changeWatch, changes chan<- struct{}) {
+	defer m.wg.Done()
+	defer w.close()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		default:
+		}
+		got, err := w.wait()
+		if err != nil {
+			log.Printf("WARN: mDNS netlink watch failed, falling back to polling: %v", err)
+			m.watch.mu.Lock()
+			m.watch.mode = WatchPoll
+			m.watch.mu.Unlock()
+			return
+		}
+		if got {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// addressesChanged reports whether the current addresses differ from the
+// advertised ones.
+func (m *Manager) addressesChanged() bool {
+	current, err := m.addresses()
+	if err != nil {
+		return false
+	}
+	m.watch.mu.Lock()
+	defer m.watch.mu.Unlock()
+	return len(missingAddresses(current, m.watch.advertised)) > 0 ||
+		len(missingAddresses(m.watch.advertised, current)) > 0
+}
+
+// reconcileAddresses withdraws addresses that went away and re-announces the
+// current ones. Without force nothing is sent unless the addresses changed.
+func (m *Manager) reconcileAddresses(force bool) AddressStatus {
+	current, err := m.addresses()
+
+	m.watch.mu.Lock()
+	if err != nil {
+		log.Printf("WARN: Failed to list mDNS addresses: %v", err)
+		if !force {
+			st := m.addressStatusLocked()
+			m.watch.mu.Unlock()
+			return st
+		}
+		current = m.watch.advertised
+	}
+	removed := missingAddresses(m.watch.advertised, current)
+	added := missingAddresses(current, m.watch.advertised)
+	if !force && len(removed) == 0 && len(added) == 0 {
+		st := m.addressStatusLocked()
+		m.watch.mu.Unlock()
+		return st
+	}
+	if len(removed) > 0 {
+		m.records.withdraw(removed)
+	}
+	m.records.reannounce(current)
+	m.watch.advertised = current
+	m.watch.lastReannounce = time.Now()
+	m.watch.reannounces++
+	st := m.addressStatusLocked()
+	hook := m.watch.onReannounce
+	m.watch.mu.Unlock()
+
+	log.Printf("INFO: Re-announced %s.local on %d addresses (%d added, %d withdrawn)",
+		st.Name, len(current), len(added), len(removed))
+	if hook != nil {
+		hook(st)
+	}
+	return st
+}
+
+// socketAnnouncer is the recordAnnouncer writing to the manager's sockets.
+type socketAnnouncer struct {
+	m *Manager
+}
+
+func (a socketAnnouncer) withdraw(addrs []Address) {
+	a.m.sendGoodbyes(addrs)
+}
+
+func (a socketAnnouncer) reannounce([]Address) {
+	a.m.checkInterfaceChanges()
+	a.m.sendMultiInterfaceAnnouncements()
+}
+
+func (a socketAnnouncer) refresh() {
+	a.m.checkInterfaceChanges()
+}
+
+// sendGoodbyes announces each address with a zero TTL on the interface it
+// was advertised on, telling peers to flush it (RFC 6762 section 10.1).
+func (m *Manager) sendGoodbyes(addrs []Address) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	serviceName := m.finalName
+	for _, addr := range addrs {
+		state, ok := m.interfaces[addr.Interface]
+		ip := net.ParseIP(addr.IP)
+		if !ok || ip == nil {
+			continue
+		}
+
+		hdr := dns.RR_Header{Name: serviceName + ".local.", Class: dns.ClassINET, Ttl: 0}
+		var rr dns.RR
+		var conn *net.UDPConn
+		var group net.IP
+		if ipv4 := ip.To4(); ipv4 != nil {
+			hdr.Rrtype = dns.TypeA
+			rr = &dns.A{Hdr: hdr, A: ipv4}
+			conn, group = state.IPv4Conn, net.IPv4(224, 0, 0, 251)
+		} else {
+			hdr.Rrtype = dns.TypeAAAA
+			rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+			conn, group = state.IPv6Conn, net.ParseIP("ff02::fb")
+		}
+		if conn == nil {
+			continue
+		}
+
+		msg := &dns.Msg{}
+		msg.Response = true
+		msg.Authoritative = true
+		msg.Opcode = dns.OpcodeQuery
+		msg.Answer = append(msg.Answer, rr)
+		data, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteToUDP(data, &net.UDPAddr{IP: group, Port: 5353}); err == nil {
+			log.Printf("DEBUG: [%s] Withdrew %s.local -> %s", addr.Interface, serviceName, addr.IP)
+		} else {
+			log.Printf("WARN: Failed to withdraw %s on %s: %v", addr.IP, addr.Interface, err)
+		}
+	}
+}
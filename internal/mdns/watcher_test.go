@@ -0,0 +1,227 @@
+package mdns
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAddresses is an addressProvider whose answer the test changes.
+type fakeAddresses struct {
+	mu    sync.Mutex
+	addrs []Address
+}
+
+func (f *fakeAddresses) set(addrs ...Address) {
+	f.mu.Lock()
+	f.addrs = addrs
+	f.mu.Unlock()
+}
+
+func (f *fakeAddresses) list() ([]Address, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortAddresses(append([]Address(nil), f.addrs...)), nil
+}
+
+// fakeRecords is a recordAnnouncer recording what it was asked to send.
+type fakeRecords struct {
+	mu        sync.Mutex
+	announced [][]Address
+	withdrawn [][]Address
+	refreshes int
+}
+
+func (f *fakeRecords) withdraw(addrs []Address) {
+	f.mu.Lock()
+	f.withdrawn = append(f.withdrawn, addrs)
+	f.mu.Unlock()
+}
+
+func (f *fakeRecords) reannounce(addrs []Address) {
+	f.mu.Lock()
+	f.announced = append(f.announced, addrs)
+	f.mu.Unlock()
+}
+
+func (f *fakeRecords) refresh() {
+	f.mu.Lock()
+	f.refreshes++
+	f.mu.Unlock()
+}
+
+func (f *fakeRecords) calls() (announced, withdrawn [][]Address) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]Address(nil), f.announced...), append([][]Address(nil), f.withdrawn...)
+}
+
+// fakeChangeWatch delivers a notification per send on its channel.
+type fakeChangeWatch struct {
+	notify chan struct{}
+}
+
+func (f *fakeChangeWatch) wait() (bool, error) {
+	select {
+	case <-f.notify:
+		return true, nil
+	case <-time.After(10 * time.Millisecond):
+		return false, nil
+	}
+}
+
+func (f *fakeChangeWatch) close() {}
+
+func newWatchedManager(t *testing.T, watch changeWatch, poll time.Duration) (*Manager, *fakeAddresses, *fakeRecords) {
+	t.Helper()
+	m := NewManager()
+	provider := &fakeAddresses{}
+	provider.set(Address{Interface: "eth0", IP: "192.168.1.10"})
+	records := &fakeRecords{}
+	m.addresses = provider.list
+	m.records = records
+	m.openChangeWatch = func() (changeWatch, error) {
+		if watch == nil {
+			return nil, errors.New("no netlink")
+		}
+		return watch, nil
+	}
+	m.watchPoll = poll
+	m.watchDebounce = 100 * time.Millisecond
+
+	m.startAddressWatch()
+	m.wg.Add(1)
+	go m.watchAddresses()
+	t.Cleanup(func() {
+		select {
+		case <-m.stopCh:
+		default:
+			close(m.stopCh)
+		}
+		m.wg.Wait()
+	})
+	return m, provider, records
+}
+
+func waitForCondition(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAddressWatcher_DebouncesFlappingAddress(t *testing.T) {
+	watch := &fakeChangeWatch{notify: make(chan struct{})}
+	m, provider, records := newWatchedManager(t, watch, time.Hour)
+
+	var hooked []AddressStatus
+	var hookMu sync.Mutex
+	m.SetReannounceHook(func(st AddressStatus) {
+		hookMu.Lock()
+		hooked = append(hooked, st)
+		hookMu.Unlock()
+	})
+
+	// DHCP hands out a new lease, drops it and settles on a third address.
+	for _, ip := range []string{"192.168.1.20", "192.168.1.30", "192.168.1.40"} {
+		provider.set(Address{Interface: "eth0", IP: ip})
+		watch.notify <- struct{}{}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	waitForCondition(t, "re-announcement", func() bool {
+		announced, _ := records.calls()
+		return len(announced) > 0
+	})
+	time.Sleep(300 * time.Millisecond)
+
+	announced, withdrawn := records.calls()
+	if len(announced) != 1 {
+		t.Fatalf("flapping announced %d times, want once: %v", len(announced), announced)
+	}
+	if len(announced[0]) != 1 || announced[0][0].IP != "192.168.1.40" {
+		t.Fatalf("announced %v, want the settled address", announced[0])
+	}
+	if len(withdrawn) != 1 || len(withdrawn[0]) != 1 || withdrawn[0][0].IP != "192.168.1.10" {
+		t.Fatalf("withdrew %v, want the original address", withdrawn)
+	}
+
+	st := m.Addresses()
+	if st.Watcher != WatchNetlink || st.Reannounces != 1 || st.LastReannounce == nil {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if len(st.Addresses) != 1 || st.Addresses[0].IP != "192.168.1.40" {
+		t.Fatalf("advertised %v", st.Addresses)
+	}
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	if len(hooked) != 1 || hooked[0].Reannounces != 1 {
+		t.Fatalf("hook calls: %+v", hooked)
+	}
+}
+
+func TestAddressWatcher_PollsWithoutNetlink(t *testing.T) {
+	m, provider, records := newWatchedManager(t, nil, 20*time.Millisecond)
+
+	// A USB ethernet adapter comes up after boot.
+	provider.set(
+		Address{Interface: "eth0", IP: "192.168.1.10"},
+		Address{Interface: "usb0", IP: "10.0.0.5"},
+	)
+	waitForCondition(t, "re-announcement", func() bool {
+		announced, _ := records.calls()
+		return len(announced) > 0
+	})
+
+	announced, withdrawn := records.calls()
+	if len(announced[0]) != 2 || announced[0][1].Interface != "usb0" {
+		t.Fatalf("announced %v, want both interfaces", announced[0])
+	}
+	if len(withdrawn) != 0 {
+		t.Fatalf("nothing went away but withdrew %v", withdrawn)
+	}
+	if st := m.Addresses(); st.Watcher != WatchPoll {
+		t.Fatalf("watcher = %q, want poll", st.Watcher)
+	}
+
+	// Polls without a change only retry interface setup.
+	waitForCondition(t, "refresh", func() bool {
+		records.mu.Lock()
+		defer records.mu.Unlock()
+		return records.refreshes > 0
+	})
+	if announced, _ := records.calls(); len(announced) != 1 {
+		t.Fatalf("re-announced %d times without a change", len(announced))
+	}
+}
+
+func TestReannounce_ForcesAnnouncementAndStopWithdraws(t *testing.T) {
+	m, _, records := newWatchedManager(t, nil, time.Hour)
+
+	st, err := m.Reannounce()
+	if err != nil {
+		t.Fatalf("reannounce: %v", err)
+	}
+	if st.Reannounces != 1 || len(st.Addresses) != 1 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	announced, withdrawn := records.calls()
+	if len(announced) != 1 || len(withdrawn) != 0 {
+		t.Fatalf("announced %v, withdrew %v", announced, withdrawn)
+	}
+
+	// Stop says goodbye for everything still advertised.
+	m.stopAddressWatch()
+	_, withdrawn = records.calls()
+	if len(withdrawn) != 1 || withdrawn[0][0].IP != "192.168.1.10" {
+		t.Fatalf("stop withdrew %v", withdrawn)
+	}
+	if _, err := m.Reannounce(); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("reannounce after stop: %v", err)
+	}
+}
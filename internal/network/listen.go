@@ -0,0 +1,302 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// BindAddressesEnv lists the IPs or interface names the admin HTTP listener
+// binds, separated by commas or spaces. Empty binds every interface.
+const BindAddressesEnv = "PICCOLO_BIND_ADDRESSES"
+
+// DisablePlainHTTPEnv set to 1 stops serving plaintext HTTP off loopback.
+const DisablePlainHTTPEnv = "PICCOLO_DISABLE_PLAIN_HTTP"
+
+// ACMEHTTPPort is where HTTP-01 challenges arrive.
+const ACMEHTTPPort = "80"
+
+// ACMEHTTPPortEnv overrides the port the HTTP-01 listener binds, for hosts
+// that forward port 80 elsewhere.
+const ACMEHTTPPortEnv = "PICCOLO_ACME_HTTP_PORT"
+
+// maxBindAddresses bounds the configured list.
+const maxBindAddresses = 16
+
+// ListenSettings says where the admin HTTP listener binds. A loopback
+// listener is always kept: the TLS mux and the Nexus tunnel reach the portal
+// through 127.0.0.1.
+type ListenSettings struct {
+	// BindAddresses are IP literals or interface names; empty means all
+	// interfaces.
+	BindAddresses []string `json:"bind_addresses"`
+	// DisablePlainHTTP leaves only the loopback listener (plus an ACME-only
+	// listener when HTTP-01 issuance needs one).
+	DisablePlainHTTP bool `json:"disable_plain_http"`
+}
+
+// Listener is one socket the daemon should hold.
+type Listener struct {
+	Addr string `json:"addr"`
+	// ACMEOnly listeners answer HTTP-01 challenges and nothing else.
+	ACMEOnly bool `json:"acme_only,omitempty"`
+	// Redirect marks ACME-only listeners that send every other request to
+	// HTTPS instead of refusing it.
+	Redirect bool `json:"redirect,omitempty"`
+}
+
+// ACMEHTTPPortFromEnv is the HTTP-01 port, PICCOLO_ACME_HTTP_PORT or 80.
+func ACMEHTTPPortFromEnv() string {
+	if p := strings.TrimSpace(os.Getenv(ACMEHTTPPortEnv)); p != "" {
+		return p
+	}
+	return ACMEHTTPPort
+}
+
+// hostAddrs lists the host's addresses; swapped in tests.
+var hostAddrs = net.InterfaceAddrs
+
+// ParseBindAddresses splits a comma or space separated list.
+func ParseBindAddresses(spec string) []string {
+	return strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// ListenSettingsFromEnv reads PICCOLO_BIND_ADDRESSES and
+// PICCOLO_DISABLE_PLAIN_HTTP.
+func ListenSettingsFromEnv() (ListenSettings, error) {
+	s := ListenSettings{
+		BindAddresses:    ParseBindAddresses(os.Getenv(BindAddressesEnv)),
+		DisablePlainHTTP: os.Getenv(DisablePlainHTTPEnv) == "1",
+	}
+	s, err := s.Normalize()
+	if err != nil {
+		return ListenSettings{}, fmt.Errorf("%s: %w", BindAddressesEnv, err)
+	}
+	return s, nil
+}
+
+// Normalize trims and de-duplicates the bind list, canonicalizes IPs and
+// checks that every interface name exists.
+func (s ListenSettings) Normalize() (ListenSettings, error) {
+	out := ListenSettings{BindAddresses: []string{}, DisablePlainHTTP: s.DisablePlainHTTP}
+	seen := map[string]bool{}
+	for _, raw := range s.BindAddresses {
+		entry := strings.TrimSpace(raw)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			entry = ip.String()
+		} else if _, err := net.InterfaceByName(entry); err != nil {
+			return ListenSettings{}, fmt.Errorf("bind address %q is neither an IP nor a network interface", entry)
+		}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		out.BindAddresses = append(out.BindAddresses, entry)
+	}
+	if len(out.BindAddresses) > maxBindAddresses {
+		return ListenSettings{}, fmt.Errorf("at most %d bind addresses are allowed", maxBindAddresses)
+	}
+	return out, nil
+}
+
+// resolveIPs expands interface names into their addresses. IPv6 link-local
+// addresses are skipped because they need a zone to bind.
+func (s ListenSettings) resolveIPs() ([]net.IP, error) {
+	var ips []net.IP
+	for _, entry := range s.BindAddresses {
+		if ip := net.ParseIP(entry); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		iface, err := net.InterfaceByName(entry)
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %w", entry, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %w", entry, err)
+		}
+		found := false
+		for _, ip := range prefixIPs(addrs) {
+			if ip.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ip)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("interface %s has no usable address", entry)
+		}
+	}
+	return ips, nil
+}
+
+func prefixIPs(addrs []net.Addr) []net.IP {
+	out := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		switch v := a.(type) {
+		case *net.IPNet:
+			out = append(out, v.IP)
+		case *net.IPAddr:
+			out = append(out, v.IP)
+		}
+	}
+	return out
+}
+
+// Serves reports whether a request arriving at local address ip would still
+// reach the admin listener under s. Loopback is always served.
+func (s ListenSettings) Serves(ip net.IP) (bool, error) {
+	if ip == nil || ip.IsLoopback() {
+		return true, nil
+	}
+	if s.DisablePlainHTTP {
+		return false, nil
+	}
+	if len(s.BindAddresses) == 0 {
+		return true, nil
+	}
+	ips, err := s.resolveIPs()
+	if err != nil {
+		return false, err
+	}
+	for _, bound := range ips {
+		if bound.Equal(ip) || bound.Equal(net.IPv6unspecified) || (bound.Equal(net.IPv4zero) && ip.To4() != nil) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LoopbackOnly reports whether s leaves the admin UI reachable only from the
+// device itself (and so only through the remote path).
+func (s ListenSettings) LoopbackOnly() (bool, error) {
+	if s.DisablePlainHTTP {
+		return true, nil
+	}
+	if len(s.BindAddresses) == 0 {
+		return false, nil
+	}
+	ips, err := s.resolveIPs()
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Plan lists the sockets to hold for the admin port. acmeHTTP01 asks for
+// listeners on acmePort so HTTP-01 challenges still get answered: ACME-only
+// ones when plain HTTP is disabled, and ones that also redirect to HTTPS
+// when the admin port is not acmePort.
+func (s ListenSettings) Plan(port, acmePort string, acmeHTTP01 bool) ([]Listener, error) {
+	if port == "" {
+		return nil, errors.New("listen port required")
+	}
+	if acmePort == "" {
+		acmePort = ACMEHTTPPort
+	}
+	loopback := Listener{Addr: net.JoinHostPort("127.0.0.1", port)}
+	if s.DisablePlainHTTP {
+		plan := []Listener{loopback}
+		if !acmeHTTP01 {
+			return plan, nil
+		}
+		acme, err := s.acmeListeners(acmePort, false)
+		if err != nil {
+			return nil, err
+		}
+		return append(plan, acme...), nil
+	}
+	plan, err := s.adminListeners(port, loopback)
+	if err != nil {
+		return nil, err
+	}
+	if !acmeHTTP01 || acmePort == port {
+		return plan, nil
+	}
+	acme, err := s.acmeListeners(acmePort, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(plan, acme...), nil
+}
+
+// acmeListeners lists one ACME-only listener on acmePort per bound address;
+// with plain HTTP enabled and no bind list, one wildcard listener.
+func (s ListenSettings) acmeListeners(acmePort string, redirect bool) ([]Listener, error) {
+	if redirect && len(s.BindAddresses) == 0 {
+		return []Listener{{Addr: ":" + acmePort, ACMEOnly: true, Redirect: true}}, nil
+	}
+	ips, err := s.resolveIPs()
+	if err != nil {
+		return nil, err
+	}
+	if len(s.BindAddresses) == 0 {
+		all, err := hostAddrs()
+		if err != nil {
+			return nil, err
+		}
+		ips = prefixIPs(all)
+	}
+	var out []Listener
+	seen := map[string]bool{}
+	for _, ip := range ips {
+		if ip.IsUnspecified() {
+			return []Listener{{Addr: net.JoinHostPort(ip.String(), acmePort), ACMEOnly: true, Redirect: redirect}}, nil
+		}
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		addr := net.JoinHostPort(ip.String(), acmePort)
+		if !seen[addr] {
+			seen[addr] = true
+			out = append(out, Listener{Addr: addr, ACMEOnly: true, Redirect: redirect})
+		}
+	}
+	return out, nil
+}
+
+// adminListeners lists the full admin listeners for the bind list.
+func (s ListenSettings) adminListeners(port string, loopback Listener) ([]Listener, error) {
+	if len(s.BindAddresses) == 0 {
+		return []Listener{{Addr: ":" + port}}, nil
+	}
+	ips, err := s.resolveIPs()
+	if err != nil {
+		return nil, err
+	}
+	var plan []Listener
+	seen := map[string]bool{}
+	coversLoopback := false
+	for _, ip := range ips {
+		if ip.IsUnspecified() {
+			// A wildcard bind covers every address, loopback included;
+			// binding a specific address beside it would collide.
+			return []Listener{{Addr: net.JoinHostPort(ip.String(), port)}}, nil
+		}
+		addr := net.JoinHostPort(ip.String(), port)
+		if ip.Equal(net.IPv4(127, 0, 0, 1)) {
+			coversLoopback = true
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			plan = append(plan, Listener{Addr: addr})
+		}
+	}
+	if !coversLoopback {
+		plan = append([]Listener{loopback}, plan...)
+	}
+	return plan, nil
+}
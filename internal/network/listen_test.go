@@ -0,0 +1,90 @@
+package network
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListenSettingsNormalize(t *testing.T) {
+	s, err := ListenSettings{BindAddresses: []string{" 192.168.1.10 ", "lo", "::FFFF:10.0.0.1", "192.168.1.10", ""}}.Normalize()
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if want := []string{"192.168.1.10", "lo", "10.0.0.1"}; !reflect.DeepEqual(s.BindAddresses, want) {
+		t.Fatalf("BindAddresses = %q, want %q", s.BindAddresses, want)
+	}
+	if _, err := (ListenSettings{BindAddresses: []string{"no-such-iface0"}}).Normalize(); err == nil || !strings.Contains(err.Error(), "neither an IP nor a network interface") {
+		t.Fatalf("expected unknown interface error, got %v", err)
+	}
+}
+
+func TestListenSettingsPlan(t *testing.T) {
+	orig := hostAddrs
+	hostAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+	defer func() { hostAddrs = orig }()
+
+	cases := []struct {
+		name     string
+		settings ListenSettings
+		acme     bool
+		want     []Listener
+	}{
+		{"all interfaces", ListenSettings{}, false, []Listener{{Addr: ":8080"}}},
+		{"lan only keeps loopback", ListenSettings{BindAddresses: []string{"192.168.1.10"}}, false,
+			[]Listener{{Addr: "127.0.0.1:8080"}, {Addr: "192.168.1.10:8080"}}},
+		{"loopback only", ListenSettings{BindAddresses: []string{"127.0.0.1"}}, false, []Listener{{Addr: "127.0.0.1:8080"}}},
+		{"wildcard wins", ListenSettings{BindAddresses: []string{"192.168.1.10", "0.0.0.0"}}, false, []Listener{{Addr: "0.0.0.0:8080"}}},
+		{"plain http disabled", ListenSettings{DisablePlainHTTP: true}, false, []Listener{{Addr: "127.0.0.1:8080"}}},
+		{"plain http disabled with http-01", ListenSettings{DisablePlainHTTP: true}, true,
+			[]Listener{{Addr: "127.0.0.1:8080"}, {Addr: "192.168.1.10:80", ACMEOnly: true}}},
+		{"http-01 on another port", ListenSettings{}, true,
+			[]Listener{{Addr: ":8080"}, {Addr: ":80", ACMEOnly: true, Redirect: true}}},
+		{"http-01 on another port, lan only", ListenSettings{BindAddresses: []string{"192.168.1.10"}}, true,
+			[]Listener{{Addr: "127.0.0.1:8080"}, {Addr: "192.168.1.10:8080"}, {Addr: "192.168.1.10:80", ACMEOnly: true, Redirect: true}}},
+	}
+	for _, tc := range cases {
+		got, err := tc.settings.Plan("8080", "80", tc.acme)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: plan = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+	// The admin listener already owns the ACME port.
+	got, err := ListenSettings{}.Plan("80", "80", true)
+	if err != nil || !reflect.DeepEqual(got, []Listener{{Addr: ":80"}}) {
+		t.Fatalf("admin on port 80: plan = %+v, %v", got, err)
+	}
+}
+
+func TestListenSettingsReachability(t *testing.T) {
+	lan := net.ParseIP("192.168.1.10")
+	other := net.ParseIP("10.0.0.5")
+	s := ListenSettings{BindAddresses: []string{"192.168.1.10"}}
+	if ok, _ := s.Serves(lan); !ok {
+		t.Fatalf("bound address must be served")
+	}
+	if ok, _ := s.Serves(other); ok {
+		t.Fatalf("unbound address must not be served")
+	}
+	if ok, _ := s.Serves(net.ParseIP("127.0.0.1")); !ok {
+		t.Fatalf("loopback is always served")
+	}
+	if only, _ := s.LoopbackOnly(); only {
+		t.Fatalf("lan binding is not loopback-only")
+	}
+	for _, ls := range []ListenSettings{{BindAddresses: []string{"127.0.0.1", "lo"}}, {DisablePlainHTTP: true}} {
+		if only, _ := ls.LoopbackOnly(); !only {
+			t.Fatalf("%+v should be loopback-only", ls)
+		}
+	}
+}
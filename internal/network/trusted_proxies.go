@@ -0,0 +1,189 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TrustedProxiesEnv lists extra proxy CIDRs (or bare IPs) whose forwarding
+// headers are honoured, separated by commas or spaces.
+const TrustedProxiesEnv = "PICCOLO_TRUSTED_PROXIES"
+
+// forwardHeaders are stripped from requests whose peer is not trusted.
+var forwardHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// TrustedProxies decides whose X-Forwarded-* headers to believe. Loopback is
+// always trusted, but the TLS mux and the Nexus adapter also reach local
+// listeners over 127.0.0.1 with raw client bytes, so servers behind them
+// judge those connections by the relay's connection hint first. A nil
+// *TrustedProxies behaves like the loopback-only default.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+var (
+	loopbackNets = []string{"127.0.0.0/8", "::1/128"}
+	loopbackOnly = DefaultTrustedProxies()
+)
+
+// DefaultTrustedProxies trusts loopback peers only.
+func DefaultTrustedProxies() *TrustedProxies {
+	t, _ := ParseTrustedProxies("")
+	return t
+}
+
+// ParseTrustedProxies parses a comma or space separated CIDR list on top of
+// the loopback default.
+func ParseTrustedProxies(spec string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	entries := append(append([]string(nil), loopbackNets...), strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})...)
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q: not an IP or CIDR", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		if seen[ipnet.String()] {
+			continue
+		}
+		seen[ipnet.String()] = true
+		t.nets = append(t.nets, ipnet)
+	}
+	return t, nil
+}
+
+// TrustedProxiesFromEnv reads PICCOLO_TRUSTED_PROXIES.
+func TrustedProxiesFromEnv() (*TrustedProxies, error) {
+	return ParseTrustedProxies(os.Getenv(TrustedProxiesEnv))
+}
+
+// CIDRs returns the trusted networks in CIDR notation.
+func (t *TrustedProxies) CIDRs() []string {
+	t = t.orDefault()
+	out := make([]string, 0, len(t.nets))
+	for _, n := range t.nets {
+		out = append(out, n.String())
+	}
+	return out
+}
+
+// Contains reports whether ip belongs to a trusted network.
+func (t *TrustedProxies) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.orDefault().nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustsPeer reports whether the immediate peer of r is a trusted proxy.
+func (t *TrustedProxies) TrustsPeer(r *http.Request) bool {
+	return t.Contains(net.ParseIP(peerHost(r.RemoteAddr)))
+}
+
+// ClientIP returns the originating client address. Forwarded headers are
+// only consulted when the peer is trusted; X-Forwarded-For is walked from
+// the right so a client cannot choose its address by prepending entries.
+func (t *TrustedProxies) ClientIP(r *http.Request) string {
+	peer := peerHost(r.RemoteAddr)
+	if !t.Contains(net.ParseIP(peer)) {
+		return peer
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				hops = append(hops, part)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(peerHost(hops[i]))
+		if ip == nil {
+			// Malformed entry: stop at the last address we can vouch for.
+			break
+		}
+		if !t.Contains(ip) || i == 0 {
+			return ip.String()
+		}
+	}
+	if len(hops) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); ip != nil {
+			return ip.String()
+		}
+	}
+	return peer
+}
+
+// ForwardedProto returns the scheme reported by a trusted proxy, or "".
+func (t *TrustedProxies) ForwardedProto(r *http.Request) string {
+	if !t.TrustsPeer(r) {
+		return ""
+	}
+	return strings.ToLower(lastListValue(r.Header.Get("X-Forwarded-Proto")))
+}
+
+// ForwardedHost returns the host reported by a trusted proxy, or "".
+func (t *TrustedProxies) ForwardedHost(r *http.Request) string {
+	if !t.TrustsPeer(r) {
+		return ""
+	}
+	return lastListValue(r.Header.Get("X-Forwarded-Host"))
+}
+
+// StripForwardHeaders removes client-supplied forwarding headers.
+func StripForwardHeaders(h http.Header) {
+	for _, k := range forwardHeaders {
+		h.Del(k)
+	}
+}
+
+func (t *TrustedProxies) orDefault() *TrustedProxies {
+	if t == nil || len(t.nets) == 0 {
+		return loopbackOnly
+	}
+	return t
+}
+
+// lastListValue returns the entry appended by the nearest proxy.
+func lastListValue(v string) string {
+	if i := strings.LastIndex(v, ","); i != -1 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
+
+func peerHost(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func forwardedRequest(remote, xff, proto string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://piccolo.example/", nil)
+	req.RemoteAddr = remote
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	if proto != "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	return req
+}
+
+func TestTrustedProxiesIgnoreUntrustedPeers(t *testing.T) {
+	var tp *TrustedProxies // nil behaves as loopback-only
+	req := forwardedRequest("192.168.1.20:5000", "10.9.9.9", "https")
+	if got := tp.ClientIP(req); got != "192.168.1.20" {
+		t.Fatalf("expected peer address for untrusted peer, got %q", got)
+	}
+	if got := tp.ForwardedProto(req); got != "" {
+		t.Fatalf("expected spoofed proto ignored, got %q", got)
+	}
+}
+
+func TestTrustedProxiesWalkForwardedChain(t *testing.T) {
+	tp, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	cases := []struct {
+		name, remote, xff, want string
+	}{
+		{"loopback proxy", "127.0.0.1:4000", "203.0.113.7", "203.0.113.7"},
+		{"client-prepended hop ignored", "192.168.1.1:4000", "6.6.6.6, 203.0.113.7, 10.1.2.3", "203.0.113.7"},
+		{"all hops trusted", "10.0.0.1:4000", "10.0.0.2, 10.0.0.3", "10.0.0.2"},
+		{"malformed hop", "10.0.0.1:4000", "garbage", "10.0.0.1"},
+		{"ipv6 loopback", "[::1]:4000", "2001:db8::5", "2001:db8::5"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tp.ClientIP(forwardedRequest(tc.remote, tc.xff, "")); got != tc.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	if got := tp.ForwardedProto(forwardedRequest("192.168.1.1:4000", "", "http, HTTPS")); got != "https" {
+		t.Fatalf("expected nearest proxy's proto, got %q", got)
+	}
+	if tp.TrustsPeer(forwardedRequest("192.168.1.2:4000", "", "")) {
+		t.Fatalf("bare IP entry must not trust its neighbours")
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8,not-an-ip"); err == nil {
+		t.Fatalf("expected error for invalid entry")
+	}
+	tp, err := ParseTrustedProxies("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tp.CIDRs(); len(got) != 2 || got[0] != "127.0.0.0/8" || got[1] != "::1/128" {
+		t.Fatalf("expected loopback default, got %v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification is one event offered to every target. Topic is the activity
+// source ("remote", "apps", "persistence", ...) targets filter on.
+type Notification struct {
+	Topic    string         `json:"topic"`
+	Level    string         `json:"level"`
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Time     time.Time      `json:"time"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// deliveryError records whether a failed attempt is worth retrying.
+type deliveryError struct {
+	err       error
+	permanent bool
+}
+
+func (e *deliveryError) Error() string { return e.err.Error() }
+func (e *deliveryError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return &deliveryError{err: err, permanent: true} }
+
+func isPermanent(err error) bool {
+	de, ok := err.(*deliveryError)
+	return ok && de.permanent
+}
+
+// sendSMTPFunc matches smtp.SendMail so tests can replace it.
+type sendSMTPFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+func (m *Manager) send(ctx context.Context, t Target, n Notification) error {
+	switch t.Type {
+	case TypeWebhook:
+		return m.sendWebhook(ctx, t, n)
+	case TypeNtfy:
+		return m.sendNtfy(ctx, t, n)
+	case TypeSMTP:
+		return m.sendEmail(t, n)
+	}
+	return permanent(fmt.Errorf("unsupported target type %q", t.Type))
+}
+
+func (m *Manager) sendWebhook(ctx context.Context, t Target, n Notification) error {
+	var (
+		body        []byte
+		contentType string
+	)
+	if t.Format == FormatText {
+		body = []byte(textLine(n))
+		contentType = "text/plain; charset=utf-8"
+	} else {
+		payload := struct {
+			Notification
+			Source string `json:"source"`
+			Text   string `json:"text"`
+		}{Notification: n, Source: "piccolod", Text: textLine(n)}
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return permanent(err)
+		}
+		contentType = "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	return m.doHTTP(req)
+}
+
+func (m *Manager) sendNtfy(ctx context.Context, t Target, n Notification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, strings.NewReader(n.Message))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Title", n.Title)
+	req.Header.Set("Tags", n.Topic)
+	switch n.Level {
+	case LevelError:
+		req.Header.Set("Priority", "5")
+	case LevelWarn:
+		req.Header.Set("Priority", "4")
+	default:
+		req.Header.Set("Priority", "3")
+	}
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	return m.doHTTP(req)
+}
+
+func (m *Manager) doHTTP(req *http.Request) error {
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("receiver returned %d", resp.StatusCode)
+	// Rate limiting and server errors are transient; other 4xx mean the
+	// target is misconfigured and retrying will not help.
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanent(err)
+}
+
+func (m *Manager) sendEmail(t Target, n Notification) error {
+	cfg := t.SMTP
+	if cfg == nil {
+		return permanent(fmt.Errorf("smtp settings missing"))
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerSafe(n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(textLine(n))
+	msg.WriteString("\r\n")
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	return m.sendSMTP(addr, auth, cfg.From, cfg.To, msg.Bytes())
+}
+
+// textLine is the compact one-line rendering used by text payloads.
+func textLine(n Notification) string {
+	return fmt.Sprintf("[%s] %s: %s", strings.ToUpper(n.Level), n.Topic, n.Message)
+}
+
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
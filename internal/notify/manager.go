@@ -0,0 +1,476 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"sync"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+const (
+	queueSize   = 256
+	workerCount = 4
+	sendTimeout = 15 * time.Second
+)
+
+// defaultRetryDelays spaces out the retries after a failed first attempt.
+var defaultRetryDelays = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+type delivery struct {
+	targetID string
+	n        Notification
+}
+
+type storedConfig struct {
+	Targets []Target `json:"targets"`
+}
+
+// Manager owns notification targets and delivers notifications to them.
+// Dispatch only enqueues, so publishers never wait on slow receivers; a full
+// queue drops the notification and counts it against the target.
+type Manager struct {
+	repo persistence.NotificationRepo
+	now  func() time.Time
+
+	client      *http.Client
+	sendSMTP    sendSMTPFunc
+	retryDelays []time.Duration
+
+	mu      sync.RWMutex
+	targets map[string]Target
+	stats   map[string]*Stats
+	loaded  bool
+
+	queue     chan delivery
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+
+	healthMu   sync.Mutex
+	lastHealth persistence.ControlHealthStatus
+}
+
+// NewManager constructs a notification manager backed by repo.
+func NewManager(repo persistence.NotificationRepo) *Manager {
+	return &Manager{
+		repo:        repo,
+		now:         time.Now,
+		client:      &http.Client{Timeout: sendTimeout},
+		sendSMTP:    smtp.SendMail,
+		retryDelays: defaultRetryDelays,
+		targets:     make(map[string]Target),
+		stats:       make(map[string]*Stats),
+		queue:       make(chan delivery, queueSize),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start launches the delivery workers.
+func (m *Manager) Start() {
+	m.startOnce.Do(func() {
+		for i := 0; i < workerCount; i++ {
+			m.wg.Add(1)
+			go m.worker()
+		}
+	})
+}
+
+// Stop abandons queued deliveries and waits for in-flight ones to finish.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.wg.Wait()
+}
+
+// ReloadFromStorage reloads targets once the control store is readable.
+func (m *Manager) ReloadFromStorage() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loaded = false
+	return m.loadLocked(context.Background())
+}
+
+func (m *Manager) loadLocked(ctx context.Context) error {
+	if m.loaded {
+		return nil
+	}
+	if m.repo == nil {
+		m.loaded = true
+		return nil
+	}
+	cfg, err := m.repo.CurrentConfig(ctx)
+	if errors.Is(err, persistence.ErrNotFound) || errors.Is(err, persistence.ErrNotImplemented) {
+		m.targets = make(map[string]Target)
+		m.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var stored storedConfig
+	if err := json.Unmarshal(cfg.Payload, &stored); err != nil {
+		return fmt.Errorf("decode notification targets: %w", err)
+	}
+	m.targets = make(map[string]Target, len(stored.Targets))
+	for _, t := range stored.Targets {
+		m.targets[t.ID] = t
+	}
+	m.loaded = true
+	return nil
+}
+
+func (m *Manager) saveLocked(ctx context.Context, targets map[string]Target) error {
+	stored := storedConfig{Targets: make([]Target, 0, len(targets))}
+	for _, id := range sortedIDs(targets) {
+		stored.Targets = append(stored.Targets, targets[id])
+	}
+	payload, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if m.repo == nil {
+		return errors.New("notify: storage unavailable")
+	}
+	if err := m.repo.SaveConfig(ctx, persistence.NotificationConfig{Payload: payload}); err != nil {
+		return err
+	}
+	m.targets = targets
+	return nil
+}
+
+func (m *Manager) copyTargetsLocked() map[string]Target {
+	out := make(map[string]Target, len(m.targets)+1)
+	for id, t := range m.targets {
+		out[id] = t
+	}
+	return out
+}
+
+func (m *Manager) viewLocked(t Target) TargetView {
+	view := TargetView{Target: t.masked()}
+	if st := m.stats[t.ID]; st != nil {
+		view.Stats = *st
+	}
+	return view
+}
+
+// List returns all targets with secrets masked.
+func (m *Manager) List(ctx context.Context) ([]TargetView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(ctx); err != nil {
+		return nil, err
+	}
+	out := make([]TargetView, 0, len(m.targets))
+	for _, id := range sortedIDs(m.targets) {
+		out = append(out, m.viewLocked(m.targets[id]))
+	}
+	return out, nil
+}
+
+// Get returns one target with secrets masked.
+func (m *Manager) Get(ctx context.Context, id string) (TargetView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(ctx); err != nil {
+		return TargetView{}, err
+	}
+	t, ok := m.targets[id]
+	if !ok {
+		return TargetView{}, ErrTargetNotFound
+	}
+	return m.viewLocked(t), nil
+}
+
+// Create validates and stores a new target.
+func (m *Manager) Create(ctx context.Context, t Target) (TargetView, error) {
+	if err := t.normalize(); err != nil {
+		return TargetView{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(ctx); err != nil {
+		return TargetView{}, err
+	}
+	now := m.now().UTC()
+	t.ID = newTargetID()
+	t.Created, t.Updated = now, now
+	targets := m.copyTargetsLocked()
+	targets[t.ID] = t.clone()
+	if err := m.saveLocked(ctx, targets); err != nil {
+		return TargetView{}, err
+	}
+	return m.viewLocked(t), nil
+}
+
+// Update replaces a target. Secrets sent back masked or left empty keep their
+// stored values.
+func (m *Manager) Update(ctx context.Context, id string, t Target) (TargetView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(ctx); err != nil {
+		return TargetView{}, err
+	}
+	prev, ok := m.targets[id]
+	if !ok {
+		return TargetView{}, ErrTargetNotFound
+	}
+	t.keepSecrets(prev)
+	if err := t.normalize(); err != nil {
+		return TargetView{}, err
+	}
+	t.ID, t.Created, t.Updated = id, prev.Created, m.now().UTC()
+	targets := m.copyTargetsLocked()
+	targets[id] = t.clone()
+	if err := m.saveLocked(ctx, targets); err != nil {
+		return TargetView{}, err
+	}
+	return m.viewLocked(t), nil
+}
+
+// Delete removes a target.
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(ctx); err != nil {
+		return err
+	}
+	if _, ok := m.targets[id]; !ok {
+		return ErrTargetNotFound
+	}
+	targets := m.copyTargetsLocked()
+	delete(targets, id)
+	if err := m.saveLocked(ctx, targets); err != nil {
+		return err
+	}
+	delete(m.stats, id)
+	return nil
+}
+
+// Test sends a test message to one target synchronously, without retries,
+// and reports the result. Disabled targets can be tested too.
+func (m *Manager) Test(ctx context.Context, id string) error {
+	m.mu.Lock()
+	if err := m.loadLocked(ctx); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	t, ok := m.targets[id]
+	m.mu.Unlock()
+	if !ok {
+		return ErrTargetNotFound
+	}
+	n := Notification{
+		Topic:   "notifications",
+		Level:   LevelInfo,
+		Title:   "Piccolo test notification",
+		Message: fmt.Sprintf("Test message for notification target %q", t.Name),
+		Time:    m.now().UTC(),
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	err := m.send(sendCtx, t.clone(), n)
+	m.record(id, func(st *Stats) {
+		st.LastAttemptAt = m.now().UTC()
+		if err != nil {
+			st.LastError = err.Error()
+			return
+		}
+		st.LastSuccessAt = st.LastAttemptAt
+		st.LastError = ""
+	})
+	return err
+}
+
+// Dispatch queues n for every target that wants it and returns immediately.
+func (m *Manager) Dispatch(n Notification) {
+	if n.Time.IsZero() {
+		n.Time = m.now()
+	}
+	n.Time = n.Time.UTC()
+	if n.Level == "" {
+		n.Level = LevelInfo
+	}
+	if n.Title == "" {
+		n.Title = fmt.Sprintf("Piccolo %s %s", n.Topic, n.Level)
+	}
+	m.mu.RLock()
+	var ids []string
+	for id, t := range m.targets {
+		if t.wants(n) {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.RUnlock()
+	for _, id := range ids {
+		select {
+		case m.queue <- delivery{targetID: id, n: n}:
+		default:
+			log.Printf("WARN: notification queue full; dropping %s notification for target %s", n.Topic, id)
+			m.record(id, func(st *Stats) { st.Dropped++ })
+		}
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case d := <-m.queue:
+			m.deliver(d)
+		}
+	}
+}
+
+// deliver attempts d once plus one retry per configured delay, then counts a
+// dead letter.
+func (m *Manager) deliver(d delivery) {
+	var lastErr error
+	for attempt := 0; attempt <= len(m.retryDelays); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-m.stop:
+				return
+			case <-time.After(m.retryDelays[attempt-1]):
+			}
+			m.record(d.targetID, func(st *Stats) { st.Retries++ })
+		}
+		m.mu.RLock()
+		t, ok := m.targets[d.targetID]
+		m.mu.RUnlock()
+		if !ok {
+			// Deleted while queued.
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		lastErr = m.send(ctx, t.clone(), d.n)
+		cancel()
+		now := m.now().UTC()
+		if lastErr == nil {
+			m.record(d.targetID, func(st *Stats) {
+				st.Delivered++
+				st.LastAttemptAt, st.LastSuccessAt = now, now
+				st.LastError = ""
+			})
+			return
+		}
+		m.record(d.targetID, func(st *Stats) {
+			st.LastAttemptAt = now
+			st.LastError = lastErr.Error()
+		})
+		if isPermanent(lastErr) {
+			break
+		}
+	}
+	log.Printf("WARN: notification to target %s failed: %v", d.targetID, lastErr)
+	m.record(d.targetID, func(st *Stats) { st.DeadLetters++ })
+}
+
+func (m *Manager) record(id string, fn func(*Stats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.stats[id]
+	if st == nil {
+		st = &Stats{}
+		m.stats[id] = st
+	}
+	fn(st)
+}
+
+// Observe turns activity entries and control-store health changes into
+// notifications. Goroutines exit when the bus is closed.
+func (m *Manager) Observe(bus *events.Bus) {
+	if bus == nil {
+		return
+	}
+	activityCh := bus.Subscribe(events.TopicActivity, 64)
+	go func() {
+		for evt := range activityCh {
+			if rec, ok := evt.Payload.(events.ActivityRecorded); ok {
+				m.Dispatch(Notification{
+					Topic:    rec.Source,
+					Level:    rec.Level,
+					Message:  rec.Message,
+					Time:     rec.Time,
+					Metadata: rec.Metadata,
+				})
+			}
+		}
+	}()
+	healthCh := bus.Subscribe(events.TopicControlHealth, 8)
+	go func() {
+		for evt := range healthCh {
+			if report, ok := evt.Payload.(persistence.ControlHealthReport); ok {
+				m.observeHealth(report)
+			}
+		}
+	}()
+}
+
+// observeHealth notifies on control-store health transitions only; checks
+// run periodically and repeat the same status. Unknown (store locked or
+// check unavailable) is not a transition.
+func (m *Manager) observeHealth(report persistence.ControlHealthReport) {
+	if report.Status == persistence.ControlHealthStatusUnknown {
+		return
+	}
+	m.healthMu.Lock()
+	prev := m.lastHealth
+	m.lastHealth = report.Status
+	m.healthMu.Unlock()
+	if prev == report.Status || (prev == "" && report.Status == persistence.ControlHealthStatusOK) {
+		return
+	}
+	n := Notification{
+		Topic:    "storage",
+		Level:    LevelInfo,
+		Title:    "Piccolo storage health",
+		Message:  fmt.Sprintf("Control store health is %s", report.Status),
+		Time:     report.CheckedAt,
+		Metadata: map[string]any{"status": string(report.Status)},
+	}
+	if report.Message != "" {
+		n.Message += ": " + report.Message
+	}
+	switch report.Status {
+	case persistence.ControlHealthStatusError:
+		n.Level = LevelError
+	case persistence.ControlHealthStatusDegraded, persistence.ControlHealthStatusBusy:
+		n.Level = LevelWarn
+	}
+	m.Dispatch(n)
+}
+
+func sortedIDs(targets map[string]Target) []string {
+	ids := make([]string, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := targets[ids[i]], targets[ids[j]]
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func newTargetID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
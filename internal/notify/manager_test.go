@@ -0,0 +1,280 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+type memoryNotificationRepo struct {
+	mu      sync.Mutex
+	payload []byte
+	locked  bool
+}
+
+func (r *memoryNotificationRepo) CurrentConfig(ctx context.Context) (persistence.NotificationConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locked {
+		return persistence.NotificationConfig{}, persistence.ErrLocked
+	}
+	if r.payload == nil {
+		return persistence.NotificationConfig{}, persistence.ErrNotFound
+	}
+	return persistence.NotificationConfig{Payload: append([]byte(nil), r.payload...)}, nil
+}
+
+func (r *memoryNotificationRepo) SaveConfig(ctx context.Context, cfg persistence.NotificationConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locked {
+		return persistence.ErrLocked
+	}
+	r.payload = append([]byte(nil), cfg.Payload...)
+	return nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *memoryNotificationRepo) {
+	t.Helper()
+	repo := &memoryNotificationRepo{}
+	m := NewManager(repo)
+	m.retryDelays = []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}
+	m.Start()
+	t.Cleanup(m.Stop)
+	return m, repo
+}
+
+func waitStats(t *testing.T, m *Manager, id string, ok func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		view, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get target: %v", err)
+		}
+		if ok(view.Stats) {
+			return view.Stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for stats, last=%+v", view.Stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookRetriesOn500ThenSucceeds(t *testing.T) {
+	var calls atomic.Int32
+	bodies := make(chan map[string]any, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer s3cret" {
+			t.Errorf("authorization header = %q", got)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	m, _ := newTestManager(t)
+	view, err := m.Create(context.Background(), Target{
+		Name:    "hook",
+		Type:    TypeWebhook,
+		Enabled: true,
+		URL:     receiver.URL + "/hook",
+		Token:   "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	m.Dispatch(Notification{Topic: "remote", Level: LevelError, Message: "certificate renewal failed"})
+
+	stats := waitStats(t, m, view.ID, func(s Stats) bool { return s.Delivered == 1 })
+	if calls.Load() != 2 || stats.Retries != 1 || stats.DeadLetters != 0 || stats.LastError != "" {
+		t.Fatalf("unexpected delivery: calls=%d stats=%+v", calls.Load(), stats)
+	}
+	body := <-bodies
+	if body["topic"] != "remote" || body["level"] != "error" || body["source"] != "piccolod" {
+		t.Fatalf("unexpected payload: %v", body)
+	}
+	if text, _ := body["text"].(string); !strings.Contains(text, "certificate renewal failed") {
+		t.Fatalf("payload text = %q", text)
+	}
+}
+
+func TestPermanentFailureCountsDeadLetterWithoutRetry(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer receiver.Close()
+
+	m, _ := newTestManager(t)
+	view, err := m.Create(context.Background(), Target{Name: "gone", Type: TypeWebhook, Enabled: true, URL: receiver.URL, MinLevel: LevelInfo})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	m.Dispatch(Notification{Topic: "apps", Level: LevelInfo, Message: "installed blog"})
+
+	stats := waitStats(t, m, view.ID, func(s Stats) bool { return s.DeadLetters == 1 })
+	if calls.Load() != 1 || stats.Retries != 0 || !strings.Contains(stats.LastError, "404") {
+		t.Fatalf("unexpected stats: calls=%d stats=%+v", calls.Load(), stats)
+	}
+}
+
+func TestTargetFiltersByTopicAndLevel(t *testing.T) {
+	target := Target{Name: "t", Type: TypeNtfy, Enabled: true, URL: "https://ntfy.sh/piccolo", Topics: []string{"remote"}}
+	if err := target.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	cases := []struct {
+		n    Notification
+		want bool
+	}{
+		{Notification{Topic: "remote", Level: LevelWarn}, true},
+		{Notification{Topic: "remote", Level: LevelError}, true},
+		{Notification{Topic: "remote", Level: LevelInfo}, false},
+		{Notification{Topic: "apps", Level: LevelError}, false},
+	}
+	for _, tc := range cases {
+		if got := target.wants(tc.n); got != tc.want {
+			t.Fatalf("wants(%+v) = %v, want %v", tc.n, got, tc.want)
+		}
+	}
+	target.Enabled = false
+	if target.wants(Notification{Topic: "remote", Level: LevelError}) {
+		t.Fatalf("disabled target should not receive notifications")
+	}
+}
+
+func TestSecretsMaskedAndPreservedOnUpdate(t *testing.T) {
+	m, repo := newTestManager(t)
+	ctx := context.Background()
+	created, err := m.Create(ctx, Target{
+		Name:    "mail",
+		Type:    TypeSMTP,
+		Enabled: true,
+		SMTP:    &SMTPConfig{Host: "smtp.example.com", Username: "me", Password: "hunter2", From: "box@example.com", To: []string{"me@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.SMTP.Password != SecretMask || created.SMTP.Port != 587 {
+		t.Fatalf("unexpected view: %+v", created.SMTP)
+	}
+
+	update := created.Target
+	update.Name = "mail (renamed)"
+	if _, err := m.Update(ctx, created.ID, update); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	var sent []byte
+	m.sendSMTP = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || from != "box@example.com" {
+			t.Errorf("unexpected smtp call addr=%s from=%s", addr, from)
+		}
+		sent = msg
+		return nil
+	}
+	if err := m.Test(ctx, created.ID); err != nil {
+		t.Fatalf("test send: %v", err)
+	}
+	if !strings.Contains(string(sent), "Subject: Piccolo test notification") {
+		t.Fatalf("unexpected message: %s", sent)
+	}
+
+	if !strings.Contains(string(repo.payload), "hunter2") {
+		t.Fatalf("stored password lost on masked update: %s", repo.payload)
+	}
+
+	// A fresh manager reads the same targets back.
+	reloaded := NewManager(repo)
+	views, err := reloaded.List(ctx)
+	if err != nil || len(views) != 1 || views[0].Name != "mail (renamed)" {
+		t.Fatalf("reload: views=%+v err=%v", views, err)
+	}
+}
+
+func TestWebhookURLMasked(t *testing.T) {
+	m, _ := newTestManager(t)
+	view, err := m.Create(context.Background(), Target{Name: "slack", Type: TypeWebhook, Enabled: true, URL: "https://hooks.slack.com/services/T000/B000/XXXX", Format: FormatText})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if view.URL != "https://hooks.slack.com/"+SecretMask {
+		t.Fatalf("url not masked: %s", view.URL)
+	}
+	if _, err := m.Create(context.Background(), Target{Name: "bad", Type: TypeWebhook, URL: "ftp://example.com"}); !errors.Is(err, ErrInvalidTarget) {
+		t.Fatalf("expected invalid target, got %v", err)
+	}
+}
+
+func TestLockedStoreSurfacesErrLocked(t *testing.T) {
+	m, repo := newTestManager(t)
+	repo.locked = true
+	if _, err := m.List(context.Background()); !errors.Is(err, persistence.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+}
+
+func TestObserveForwardsActivityAndHealthTransitions(t *testing.T) {
+	received := make(chan string, 8)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer receiver.Close()
+
+	m, _ := newTestManager(t)
+	if _, err := m.Create(context.Background(), Target{Name: "hook", Type: TypeWebhook, Enabled: true, URL: receiver.URL, Format: FormatText}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	bus := events.NewBus()
+	defer bus.Close()
+	m.Observe(bus)
+
+	bus.Publish(events.Event{Topic: events.TopicActivity, Payload: events.ActivityRecorded{Source: "apps", Level: "info", Message: "ignored below min level"}})
+	bus.Publish(events.Event{Topic: events.TopicControlHealth, Payload: persistence.ControlHealthReport{Status: persistence.ControlHealthStatusOK}})
+	bus.Publish(events.Event{Topic: events.TopicControlHealth, Payload: persistence.ControlHealthReport{Status: persistence.ControlHealthStatusError, Message: "integrity check failed"}})
+	bus.Publish(events.Event{Topic: events.TopicActivity, Payload: events.ActivityRecorded{Source: "remote", Level: "warn", Message: "tunnel down"}})
+
+	want := map[string]bool{
+		"[ERROR] storage: Control store health is error: integrity check failed": false,
+		"[WARN] remote: tunnel down": false,
+	}
+	for i := 0; i < len(want); i++ {
+		select {
+		case body := <-received:
+			if _, ok := want[body]; !ok {
+				t.Fatalf("unexpected notification %q", body)
+			}
+			want[body] = true
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for notifications, got %v", want)
+		}
+	}
+	select {
+	case body := <-received:
+		t.Fatalf("unexpected extra notification %q", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
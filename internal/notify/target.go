@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Target types.
+const (
+	TypeWebhook = "webhook"
+	TypeNtfy    = "ntfy"
+	TypeSMTP    = "email-smtp"
+)
+
+// Payload formats for webhook targets.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Severity levels, matching the activity log.
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// SecretMask replaces credentials in API responses. Sending it back on update
+// keeps the stored value.
+const SecretMask = "********"
+
+var (
+	ErrTargetNotFound = errors.New("notify: target not found")
+	ErrInvalidTarget  = errors.New("notify: invalid target")
+)
+
+// Target is a configured notification destination. URL, Token and the SMTP
+// password are secrets: webhook URLs for Slack or Discord embed their own
+// credentials.
+type Target struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Enabled  bool        `json:"enabled"`
+	URL      string      `json:"url,omitempty"`
+	Token    string      `json:"token,omitempty"`
+	Format   string      `json:"format,omitempty"`
+	SMTP     *SMTPConfig `json:"smtp,omitempty"`
+	Topics   []string    `json:"topics,omitempty"`
+	MinLevel string      `json:"min_level,omitempty"`
+	Created  time.Time   `json:"created_at"`
+	Updated  time.Time   `json:"updated_at"`
+}
+
+// SMTPConfig describes an email-smtp target.
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// Stats counts deliveries to a target since the daemon started.
+type Stats struct {
+	Delivered     int64     `json:"delivered"`
+	Retries       int64     `json:"retries"`
+	DeadLetters   int64     `json:"dead_letters"`
+	Dropped       int64     `json:"dropped"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastAttemptAt time.Time `json:"last_attempt_at,omitzero"`
+	LastSuccessAt time.Time `json:"last_success_at,omitzero"`
+}
+
+// TargetView is a target as returned by the API: secrets masked, stats added.
+type TargetView struct {
+	Target
+	Stats Stats `json:"stats"`
+}
+
+func levelRank(level string) int {
+	switch level {
+	case LevelError:
+		return 2
+	case LevelWarn:
+		return 1
+	}
+	return 0
+}
+
+// normalize fills defaults and validates t.
+func (t *Target) normalize() error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Type = strings.TrimSpace(strings.ToLower(t.Type))
+	t.URL = strings.TrimSpace(t.URL)
+	t.MinLevel = strings.TrimSpace(strings.ToLower(t.MinLevel))
+	t.Format = strings.TrimSpace(strings.ToLower(t.Format))
+	if t.Name == "" {
+		return fmt.Errorf("%w: name required", ErrInvalidTarget)
+	}
+	switch t.MinLevel {
+	case "":
+		t.MinLevel = LevelWarn
+	case LevelInfo, LevelWarn, LevelError:
+	default:
+		return fmt.Errorf("%w: min_level must be info, warn or error", ErrInvalidTarget)
+	}
+	topics := t.Topics[:0]
+	for _, topic := range t.Topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	t.Topics = topics
+
+	switch t.Type {
+	case TypeWebhook, TypeNtfy:
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidTarget)
+		}
+		t.SMTP = nil
+		if t.Type == TypeNtfy {
+			t.Format = ""
+			break
+		}
+		switch t.Format {
+		case "":
+			t.Format = FormatJSON
+		case FormatJSON, FormatText:
+		default:
+			return fmt.Errorf("%w: format must be json or text", ErrInvalidTarget)
+		}
+	case TypeSMTP:
+		if t.SMTP == nil {
+			return fmt.Errorf("%w: smtp settings required", ErrInvalidTarget)
+		}
+		t.URL, t.Token, t.Format = "", "", ""
+		s := t.SMTP
+		s.Host = strings.TrimSpace(s.Host)
+		if s.Host == "" {
+			return fmt.Errorf("%w: smtp host required", ErrInvalidTarget)
+		}
+		if s.Port == 0 {
+			s.Port = 587
+		}
+		if s.Port < 1 || s.Port > 65535 {
+			return fmt.Errorf("%w: smtp port out of range", ErrInvalidTarget)
+		}
+		if _, err := mail.ParseAddress(s.From); err != nil {
+			return fmt.Errorf("%w: smtp from address: %v", ErrInvalidTarget, err)
+		}
+		if len(s.To) == 0 {
+			return fmt.Errorf("%w: smtp recipients required", ErrInvalidTarget)
+		}
+		for _, to := range s.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("%w: smtp recipient %q: %v", ErrInvalidTarget, to, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: type must be webhook, ntfy or email-smtp", ErrInvalidTarget)
+	}
+	return nil
+}
+
+// keepSecrets carries stored secrets over into an update that sent them back
+// masked (or omitted them).
+func (t *Target) keepSecrets(prev Target) {
+	if t.URL == "" || t.URL == maskURL(prev.URL) {
+		t.URL = prev.URL
+	}
+	if t.Token == SecretMask {
+		t.Token = prev.Token
+	}
+	if t.SMTP != nil && prev.SMTP != nil && (t.SMTP.Password == "" || t.SMTP.Password == SecretMask) {
+		t.SMTP.Password = prev.SMTP.Password
+	}
+}
+
+// masked returns a copy safe to show in API responses.
+func (t Target) masked() Target {
+	t.URL = maskURL(t.URL)
+	if t.Token != "" {
+		t.Token = SecretMask
+	}
+	t.Topics = append([]string(nil), t.Topics...)
+	if t.SMTP != nil {
+		smtp := *t.SMTP
+		smtp.To = append([]string(nil), smtp.To...)
+		if smtp.Password != "" {
+			smtp.Password = SecretMask
+		}
+		t.SMTP = &smtp
+	}
+	return t
+}
+
+// maskURL keeps the scheme and host so the operator can tell targets apart.
+func maskURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return SecretMask
+	}
+	return u.Scheme + "://" + u.Host + "/" + SecretMask
+}
+
+func (t Target) clone() Target {
+	t.Topics = append([]string(nil), t.Topics...)
+	if t.SMTP != nil {
+		smtp := *t.SMTP
+		smtp.To = append([]string(nil), smtp.To...)
+		t.SMTP = &smtp
+	}
+	return t
+}
+
+// wants reports whether t subscribes to n.
+func (t Target) wants(n Notification) bool {
+	if !t.Enabled || levelRank(n.Level) < levelRank(t.MinLevel) {
+		return false
+	}
+	if len(t.Topics) == 0 {
+		return true
+	}
+	for _, topic := range t.Topics {
+		if topic == n.Topic {
+			return true
+		}
+	}
+	return false
+}
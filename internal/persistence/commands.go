@@ -14,6 +14,7 @@ const (
 	CommandRecordLockState  = "persistence.record_lock_state"
 	CommandRunControlExport = "persistence.run_control_export"
 	CommandRunFullExport    = "persistence.run_full_export"
+	CommandRemoveVolume     = "persistence.remove_volume"
 )
 
 // EnsureVolumeCommand requests creation (or retrieval) of a volume matching
@@ -45,6 +46,13 @@ type RecordLockStateCommand struct {
 
 func (c RecordLockStateCommand) Name() string { return CommandRecordLockState }
 
+// RemoveVolumeCommand destroys a volume and its encrypted contents.
+type RemoveVolumeCommand struct {
+	ID string
+}
+
+func (c RemoveVolumeCommand) Name() string { return CommandRemoveVolume }
+
 // RunControlExportCommand triggers a control-plane-only PCV export.
 type RunControlExportCommand struct{}
 
@@ -78,6 +86,18 @@ func (m *Module) handleAttachVolume(ctx context.Context, cmd commands.Command) (
 	return nil, nil
 }
 
+func (m *Module) handleRemoveVolume(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	request, ok := cmd.(RemoveVolumeCommand)
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	removal, err := m.volumes.Remove(ctx, VolumeHandle{ID: request.ID})
+	if err != nil {
+		return nil, err
+	}
+	return removal, nil
+}
+
 func (m *Module) handleRecordLockState(ctx context.Context, cmd commands.Command) (commands.Response, error) {
 	request, ok := cmd.(RecordLockStateCommand)
 	if !ok {
@@ -94,7 +114,7 @@ func (m *Module) handleRunControlExport(ctx context.Context, cmd commands.Comman
 	if _, ok := cmd.(RunControlExportCommand); !ok {
 		return nil, ErrInvalidCommand
 	}
-	artifact, err := m.runExportWithLock(ctx, false, m.exports.RunControlPlane)
+	artifact, err := m.runControlExport(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -444,6 +444,57 @@ func TestSQLiteControlStoreAuthStalenessPersists(t *testing.T) {
 	}
 }
 
+func TestSQLiteControlStoreSetupCompletionPersists(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	if _, err := store.Auth().SetupCompletedAt(context.Background()); err != ErrLocked {
+		t.Fatalf("expected ErrLocked before unlock, got %v", err)
+	}
+	if err := store.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	at, err := store.Auth().SetupCompletedAt(context.Background())
+	if err != nil {
+		t.Fatalf("SetupCompletedAt: %v", err)
+	}
+	if !at.IsZero() {
+		t.Fatalf("expected setup incomplete initially, got %v", at)
+	}
+
+	ts := time.Date(2025, time.December, 1, 9, 30, 0, 0, time.UTC)
+	if err := store.Auth().MarkSetupComplete(context.Background(), ts); err != nil {
+		t.Fatalf("MarkSetupComplete: %v", err)
+	}
+	// A second completion must not move the original timestamp.
+	if err := store.Auth().MarkSetupComplete(context.Background(), ts.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkSetupComplete repeat: %v", err)
+	}
+
+	store2, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore restart: %v", err)
+	}
+	defer store2.Close(context.Background())
+	if err := store2.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock restart: %v", err)
+	}
+	at, err = store2.Auth().SetupCompletedAt(context.Background())
+	if err != nil {
+		t.Fatalf("SetupCompletedAt restart: %v", err)
+	}
+	if !at.Equal(ts) {
+		t.Fatalf("expected setup completion %v after restart, got %v", ts, at)
+	}
+}
+
 func prepareControlCipherDir(t *testing.T, root string) {
 	t.Helper()
 	cipherDir := filepath.Join(root, "ciphertext", "control")
@@ -466,3 +517,744 @@ func prepareControlCipherDir(t *testing.T, root string) {
 		t.Fatalf("write metadata: %v", err)
 	}
 }
+
+func TestSQLiteControlStoreActivityLog(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	ctx := context.Background()
+	if _, err := store.Activity().AppendActivity(ctx, ActivityRecord{Source: "app", Message: "x"}); err != ErrLocked {
+		t.Fatalf("expected ErrLocked before unlock, got %v", err)
+	}
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	revBefore, _, _ := store.Revision(ctx)
+
+	base := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	entries := []ActivityRecord{
+		{Time: base, Source: "app", Level: "info", Message: "App blog installed", Metadata: map[string]any{"app": "blog"}},
+		{Time: base.Add(time.Minute), Source: "persistence", Level: "warn", Message: "Storage locked"},
+		{Time: base.Add(2 * time.Minute), Source: "remote", Level: "info", Message: "Remote configuration saved"},
+	}
+	for _, rec := range entries {
+		saved, err := store.Activity().AppendActivity(ctx, rec)
+		if err != nil {
+			t.Fatalf("AppendActivity: %v", err)
+		}
+		if saved.ID == 0 {
+			t.Fatalf("expected assigned id")
+		}
+	}
+	if rev, _, _ := store.Revision(ctx); rev != revBefore {
+		t.Fatalf("activity appends must not bump control revision: %d -> %d", revBefore, rev)
+	}
+
+	all, err := store.Activity().ListActivity(ctx, ActivityQuery{})
+	if err != nil {
+		t.Fatalf("ListActivity: %v", err)
+	}
+	if len(all) != 3 || all[0].Message != "Remote configuration saved" || all[2].Metadata["app"] != "blog" {
+		t.Fatalf("unexpected activity listing: %+v", all)
+	}
+
+	page, err := store.Activity().ListActivity(ctx, ActivityQuery{BeforeID: all[0].ID, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].ID != all[1].ID {
+		t.Fatalf("unexpected page: %+v err=%v", page, err)
+	}
+	filtered, err := store.Activity().ListActivity(ctx, ActivityQuery{Level: "warn"})
+	if err != nil || len(filtered) != 1 || filtered[0].Source != "persistence" {
+		t.Fatalf("unexpected level filter: %+v err=%v", filtered, err)
+	}
+	since, err := store.Activity().ListActivity(ctx, ActivityQuery{Since: base.Add(time.Minute)})
+	if err != nil || len(since) != 2 {
+		t.Fatalf("unexpected since filter: %+v err=%v", since, err)
+	}
+
+	removed, err := store.Activity().PruneActivity(ctx, ActivityRetention{MaxRows: 2, OlderThan: base.Add(90 * time.Second)})
+	if err != nil {
+		t.Fatalf("PruneActivity: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 pruned rows, got %d", removed)
+	}
+	left, _ := store.Activity().ListActivity(ctx, ActivityQuery{})
+	if len(left) != 1 || left[0].Source != "remote" {
+		t.Fatalf("unexpected rows after prune: %+v", left)
+	}
+}
+
+func TestSQLiteControlStoreServiceStatsSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	ctx := context.Background()
+	if _, err := store.ServiceStats().LoadServiceStats(ctx); err != ErrLocked {
+		t.Fatalf("expected ErrLocked before unlock, got %v", err)
+	}
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	revBefore, _, _ := store.Revision(ctx)
+
+	last := time.Date(2025, time.April, 2, 8, 0, 0, 0, time.UTC)
+	first := []ServiceStatsRecord{
+		{App: "blog", Listener: "web", BytesIn: 100, BytesOut: 2000, TotalConnections: 3, LastActivity: last},
+		{App: "game", Listener: "srv", BytesIn: 5},
+	}
+	if err := store.ServiceStats().SaveServiceStats(ctx, first); err != nil {
+		t.Fatalf("SaveServiceStats: %v", err)
+	}
+	if rev, _, _ := store.Revision(ctx); rev != revBefore {
+		t.Fatalf("stats snapshots must not bump control revision: %d -> %d", revBefore, rev)
+	}
+	got, err := store.ServiceStats().LoadServiceStats(ctx)
+	if err != nil {
+		t.Fatalf("LoadServiceStats: %v", err)
+	}
+	if len(got) != 2 || got[0] != first[0] || !got[1].LastActivity.IsZero() {
+		t.Fatalf("unexpected snapshot: %+v", got)
+	}
+
+	// A later snapshot replaces the previous one (e.g. after an uninstall).
+	if err := store.ServiceStats().SaveServiceStats(ctx, first[:1]); err != nil {
+		t.Fatalf("SaveServiceStats replace: %v", err)
+	}
+	got, err = store.ServiceStats().LoadServiceStats(ctx)
+	if err != nil {
+		t.Fatalf("LoadServiceStats: %v", err)
+	}
+	if len(got) != 1 || got[0].App != "blog" {
+		t.Fatalf("expected snapshot replacement, got %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreOSUpdateJobSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := store.OSUpdates().CurrentJob(ctx); err != ErrLocked {
+		t.Fatalf("expected ErrLocked before unlock, got %v", err)
+	}
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.OSUpdates().CurrentJob(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound without a job, got %v", err)
+	}
+	revBefore, _, _ := store.Revision(ctx)
+	if err := store.OSUpdates().SaveJob(ctx, OSUpdateJob{Payload: []byte(`{"state":"running"}`)}); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+	if err := store.OSUpdates().SaveJob(ctx, OSUpdateJob{Payload: []byte(`{"state":"pending_reboot"}`)}); err != nil {
+		t.Fatalf("SaveJob update: %v", err)
+	}
+	if rev, _, _ := store.Revision(ctx); rev != revBefore+2 {
+		t.Fatalf("expected job saves to advance the revision: %d -> %d", revBefore, rev)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	job, err := reopened.OSUpdates().CurrentJob(ctx)
+	if err != nil {
+		t.Fatalf("CurrentJob: %v", err)
+	}
+	if string(job.Payload) != `{"state":"pending_reboot"}` {
+		t.Fatalf("unexpected job payload %q", job.Payload)
+	}
+}
+
+func TestSQLiteControlStoreSelfUpdateStateSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.SelfUpdate().CurrentState(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	payload := `{"channel":"beta","last":{"from":"1.0.0","to":"1.1.0","state":"restarting"}}`
+	if err := store.SelfUpdate().SaveState(ctx, SelfUpdateState{Payload: []byte(payload)}); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	state, err := reopened.SelfUpdate().CurrentState(ctx)
+	if err != nil {
+		t.Fatalf("CurrentState: %v", err)
+	}
+	if string(state.Payload) != payload {
+		t.Fatalf("unexpected state payload %q", state.Payload)
+	}
+}
+
+func TestSQLiteControlStoreIdentitySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.Identity().CurrentIdentity(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	saved := DeviceIdentity{Name: "kitchen", UpdatedAt: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)}
+	if err := store.Identity().SaveIdentity(ctx, saved); err != nil {
+		t.Fatalf("SaveIdentity: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.Identity().CurrentIdentity(ctx)
+	if err != nil {
+		t.Fatalf("CurrentIdentity: %v", err)
+	}
+	if got.Name != saved.Name || !got.UpdatedAt.Equal(saved.UpdatedAt) {
+		t.Fatalf("unexpected identity %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreSessionPolicySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.SessionPolicy().CurrentPolicy(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	saved := SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 8 * time.Hour}
+	if err := store.SessionPolicy().SavePolicy(ctx, saved); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.SessionPolicy().CurrentPolicy(ctx)
+	if err != nil {
+		t.Fatalf("CurrentPolicy: %v", err)
+	}
+	if got.IdleTimeout != saved.IdleTimeout || got.MaxLifetime != saved.MaxLifetime || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected policy %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreNetworkSettingsSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.NetworkSettings().CurrentSettings(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	saved := NetworkSettings{BindAddresses: []string{"eth0", "192.168.1.10"}, DisablePlainHTTP: true}
+	if err := store.NetworkSettings().SaveSettings(ctx, saved); err != nil {
+		t.Fatalf("SaveSettings: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.NetworkSettings().CurrentSettings(ctx)
+	if err != nil {
+		t.Fatalf("CurrentSettings: %v", err)
+	}
+	if len(got.BindAddresses) != 2 || got.BindAddresses[0] != "eth0" || got.BindAddresses[1] != "192.168.1.10" || !got.DisablePlainHTTP || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected settings %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreCORSPolicySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.CORSPolicy().CurrentPolicy(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	saved := CORSPolicy{
+		AllowedOrigins:   []string{"https://dash.example.com", "https://*.example.org"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+	}
+	if err := store.CORSPolicy().SavePolicy(ctx, saved); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.CORSPolicy().CurrentPolicy(ctx)
+	if err != nil {
+		t.Fatalf("CurrentPolicy: %v", err)
+	}
+	if len(got.AllowedOrigins) != 2 || got.AllowedOrigins[1] != "https://*.example.org" || len(got.AllowedHeaders) != 1 ||
+		!got.AllowCredentials || got.IncludeDeviceHosts || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected policy %+v", got)
+	}
+}
+
+func TestSQLiteControlStorePortPolicySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.PortPolicy().CurrentPolicy(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	saved := PortPolicy{HostBindStart: 20000, HostBindEnd: 20999, PublicStart: 30000, PublicEnd: 30999, ExcludedPorts: []int{20080, 30443},
+		ConnectionLimits: &ConnectionLimits{MaxConnections: 200, MaxConnectionsPerIP: 20, IdleTimeout: 90 * time.Second}}
+	if err := store.PortPolicy().SavePolicy(ctx, saved); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	seen := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	occupied := []OccupiedPort{
+		{Port: 20022, Network: "tcp", Range: "host_bind", FirstSeen: seen, LastSeen: seen.Add(time.Hour)},
+		{Port: 30053, Network: "udp", Range: "public", FirstSeen: seen, LastSeen: seen},
+	}
+	if err := store.PortPolicy().SaveOccupiedPorts(ctx, occupied); err != nil {
+		t.Fatalf("SaveOccupiedPorts: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.PortPolicy().CurrentPolicy(ctx)
+	if err != nil {
+		t.Fatalf("CurrentPolicy: %v", err)
+	}
+	if got.HostBindStart != 20000 || got.HostBindEnd != 20999 || got.PublicStart != 30000 || got.PublicEnd != 30999 ||
+		len(got.ExcludedPorts) != 2 || got.ExcludedPorts[1] != 30443 || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected policy %+v", got)
+	}
+	if got.ConnectionLimits == nil || *got.ConnectionLimits != *saved.ConnectionLimits {
+		t.Fatalf("unexpected connection limits %+v", got.ConnectionLimits)
+	}
+	ports, err := reopened.PortPolicy().OccupiedPorts(ctx)
+	if err != nil {
+		t.Fatalf("OccupiedPorts: %v", err)
+	}
+	if len(ports) != 2 || ports[0] != occupied[0] || ports[1] != occupied[1] {
+		t.Fatalf("unexpected occupied ports %+v", ports)
+	}
+}
+
+func TestSQLiteControlStoreMountAllowlistSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.MountAllowlist().CurrentAllowlist(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	if err := store.MountAllowlist().SaveAllowlist(ctx, MountAllowlist{Paths: []string{"/mnt/media", "/srv/photos"}}); err != nil {
+		t.Fatalf("SaveAllowlist: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.MountAllowlist().CurrentAllowlist(ctx)
+	if err != nil {
+		t.Fatalf("CurrentAllowlist: %v", err)
+	}
+	if len(got.Paths) != 2 || got.Paths[0] != "/mnt/media" || got.Paths[1] != "/srv/photos" || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected allowlist %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreAppPolicySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.AppPolicy().CurrentPolicy(ctx); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound before any save, got %v", err)
+	}
+	policy := AppPolicy{
+		Devices:     map[string]string{"/dev/dri": "confirm"},
+		Linux:       map[string]string{"NET_ADMIN": "allow"},
+		HostNetwork: "deny",
+	}
+	if err := store.AppPolicy().SavePolicy(ctx, policy); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	got, err := reopened.AppPolicy().CurrentPolicy(ctx)
+	if err != nil {
+		t.Fatalf("CurrentPolicy: %v", err)
+	}
+	if got.Devices["/dev/dri"] != "confirm" || got.Linux["NET_ADMIN"] != "allow" || got.HostNetwork != "deny" || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected policy %+v", got)
+	}
+}
+
+func TestSQLiteControlStoreAPITokens(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	repo := store.APITokens()
+	if _, err := repo.TokenByHash(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tok := APIToken{ID: "tok1", Name: "backup", Hash: "abc123", Scope: "read-only", ExpiresAt: expires}
+	if err := repo.CreateToken(ctx, tok); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if err := repo.CreateToken(ctx, APIToken{ID: "tok2", Name: "dup", Hash: "abc123", Scope: "read-only"}); err == nil {
+		t.Fatalf("expected duplicate hash to be rejected")
+	}
+	used := time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := repo.TouchToken(ctx, "tok1", used); err != nil {
+		t.Fatalf("TouchToken: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close(context.Background())
+	if err := reopened.Unlock(ctx); err != nil {
+		t.Fatalf("unlock reopened: %v", err)
+	}
+	repo = reopened.APITokens()
+	got, err := repo.TokenByHash(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("TokenByHash: %v", err)
+	}
+	if got.ID != "tok1" || got.Name != "backup" || got.Scope != "read-only" || !got.ExpiresAt.Equal(expires) || !got.LastUsedAt.Equal(used) || got.CreatedAt.IsZero() {
+		t.Fatalf("unexpected token %+v", got)
+	}
+	if err := repo.DeleteToken(ctx, "tok1"); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if err := repo.DeleteToken(ctx, "tok1"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if list, err := repo.ListTokens(ctx); err != nil || len(list) != 0 {
+		t.Fatalf("ListTokens after delete: %v %+v", err, list)
+	}
+}
+
+func newUnlockedTestStore(t *testing.T) *sqliteControlStore {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close(context.Background()) })
+	if err := store.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	// One connection without a busy timeout, so a held lock surfaces as
+	// SQLITE_BUSY straight away.
+	store.db.SetMaxOpenConns(1)
+	if _, err := store.db.Exec(`PRAGMA busy_timeout=0;`); err != nil {
+		t.Fatalf("busy_timeout: %v", err)
+	}
+	return store
+}
+
+// holdWriteLock takes the database write lock from a second connection and
+// returns a func releasing it.
+func holdWriteLock(t *testing.T, path string) func() {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open second connection: %v", err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), `BEGIN IMMEDIATE`); err != nil {
+		t.Fatalf("begin immediate: %v", err)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), `COMMIT`); err != nil {
+			t.Errorf("commit: %v", err)
+		}
+		conn.Close()
+		db.Close()
+	}
+}
+
+func TestSQLiteControlStoreRetriesBusyWrites(t *testing.T) {
+	store := newUnlockedTestStore(t)
+	var hooked int
+	store.onBusy = func(error) { hooked++ }
+
+	release := holdWriteLock(t, store.path)
+	time.AfterFunc(60*time.Millisecond, release)
+
+	if err := store.Auth().SetInitialized(context.Background()); err != nil {
+		t.Fatalf("SetInitialized while another writer finishes: %v", err)
+	}
+	if hooked != 0 || store.busyError() != nil {
+		t.Fatalf("expected the retry to resolve without a busy report, hook=%d err=%v", hooked, store.busyError())
+	}
+}
+
+func TestSQLiteControlStoreReportsPersistentBusy(t *testing.T) {
+	store := newUnlockedTestStore(t)
+	store.busyBase = time.Millisecond
+	var reports []error
+	store.onBusy = func(err error) { reports = append(reports, err) }
+
+	release := holdWriteLock(t, store.path)
+	err := store.Auth().SetInitialized(context.Background())
+	if !isBusyError(err) {
+		release()
+		t.Fatalf("expected busy error, got %v", err)
+	}
+	report, _ := store.QuickCheck(context.Background())
+	release()
+	if report.Status != ControlHealthStatusBusy {
+		t.Fatalf("expected busy health, got %+v", report)
+	}
+
+	if err := store.Auth().SetInitialized(context.Background()); err != nil {
+		t.Fatalf("SetInitialized after release: %v", err)
+	}
+	if len(reports) != 2 || reports[0] == nil || reports[1] != nil {
+		t.Fatalf("expected busy then recovered reports, got %v", reports)
+	}
+	if report, _ := store.QuickCheck(context.Background()); report.Status != ControlHealthStatusOK {
+		t.Fatalf("expected ok health after recovery, got %+v", report)
+	}
+}
+
+func TestSQLiteControlStoreCloseCheckpointsWAL(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	store.checkpointFn = nil
+	if err := store.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := store.Auth().SetInitialized(context.Background()); err != nil {
+		t.Fatalf("SetInitialized: %v", err)
+	}
+	wal := store.path + "-wal"
+	if info, err := os.Stat(wal); err != nil || info.Size() == 0 {
+		t.Fatalf("expected a populated WAL before close, stat err %v", err)
+	}
+	if err := store.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(wal); !os.IsNotExist(err) {
+		t.Fatalf("expected WAL removed after close, stat err %v", err)
+	}
+
+	// A follower on a read-only mount may still find an empty WAL.
+	if err := os.WriteFile(wal, nil, 0o600); err != nil {
+		t.Fatalf("write empty wal: %v", err)
+	}
+	origDetector := detectReadOnlyMount
+	detectReadOnlyMount = func(string) (bool, error) { return true, nil }
+	t.Cleanup(func() { detectReadOnlyMount = origDetector })
+	follower, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore follower: %v", err)
+	}
+	defer follower.Close(context.Background())
+	if err := follower.Unlock(context.Background()); err != nil {
+		t.Fatalf("follower unlock with empty WAL: %v", err)
+	}
+	if init, err := follower.Auth().IsInitialized(context.Background()); err != nil || !init {
+		t.Fatalf("follower IsInitialized = %v, %v", init, err)
+	}
+}
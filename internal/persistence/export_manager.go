@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -17,23 +18,63 @@ import (
 	"piccolod/internal/state/paths"
 )
 
+// exportManifestVersion is bumped when the manifest layout changes.
+const exportManifestVersion = 1
+
+// exportManifest is embedded in every .pcv so an import can check it is
+// compatible before touching anything.
+type exportManifest struct {
+	FormatVersion int        `json:"format_version"`
+	Kind          ExportKind `json:"kind"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Components    []string   `json:"components"`
+	// The fields below are set when the export carries a control snapshot;
+	// SnapshotPath is relative to the control volume and is the copy an
+	// import should restore rather than the live database files.
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	Revision      uint64 `json:"revision,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+	SnapshotPath  string `json:"snapshot_path,omitempty"`
+}
+
+// controlSnapshotExporter packages a control snapshot taken while the store
+// stays online.
+type controlSnapshotExporter interface {
+	RunControlSnapshot(ctx context.Context, snap ControlSnapshot) (ExportArtifact, error)
+}
+
 type fileExportManager struct {
-	root string
+	root    string
+	statfs  statfsFunc
+	minFree uint64
 }
 
 func newFileExportManager(root string) *fileExportManager {
 	if root == "" {
 		root = paths.Root()
 	}
-	return &fileExportManager{root: root}
+	return &fileExportManager{root: root, statfs: statFilesystem, minFree: minFreeBytesFromEnv()}
 }
 
 func (m *fileExportManager) RunControlPlane(ctx context.Context) (ExportArtifact, error) {
-	return m.streamExport(ctx, ExportKindControlOnly, []string{"control"}, filepath.Join(m.root, "exports", "control", "control-plane.pcv"))
+	return m.streamExport(ctx, ExportKindControlOnly, []string{"control"}, m.controlDest(), nil)
+}
+
+// RunControlSnapshot exports the control volume together with snap, which
+// must already sit inside it, and records the snapshot in the manifest.
+func (m *fileExportManager) RunControlSnapshot(ctx context.Context, snap ControlSnapshot) (ExportArtifact, error) {
+	if snap.VolumePath == "" {
+		return ExportArtifact{}, fmt.Errorf("persistence: control snapshot path required")
+	}
+	return m.streamExport(ctx, ExportKindControlOnly, []string{"control"}, m.controlDest(), &snap)
 }
 
 func (m *fileExportManager) RunFullData(ctx context.Context) (ExportArtifact, error) {
-	return m.streamExport(ctx, ExportKindFullData, []string{"control", "bootstrap"}, filepath.Join(m.root, "exports", "full", "full-data.pcv"))
+	return m.streamExport(ctx, ExportKindFullData, []string{"control", "bootstrap"}, filepath.Join(m.root, "exports", "full", "full-data.pcv"), nil)
+}
+
+func (m *fileExportManager) controlDest() string {
+	return filepath.Join(m.root, "exports", "control", "control-plane.pcv")
 }
 
 func (m *fileExportManager) ImportControlPlane(ctx context.Context, artifact ExportArtifact, opts ImportOptions) error {
@@ -44,15 +85,34 @@ func (m *fileExportManager) ImportFullData(ctx context.Context, artifact ExportA
 	return ErrNotImplemented
 }
 
-func (m *fileExportManager) streamExport(ctx context.Context, kind ExportKind, volumes []string, dest string) (ExportArtifact, error) {
+func (m *fileExportManager) streamExport(ctx context.Context, kind ExportKind, volumes []string, dest string, snap *ControlSnapshot) (ExportArtifact, error) {
 	if err := ctx.Err(); err != nil {
 		return ExportArtifact{}, err
 	}
 	if len(volumes) == 0 {
 		return ExportArtifact{}, fmt.Errorf("persistence: no volumes requested")
 	}
+	if err := m.checkRoom(volumes); err != nil {
+		return ExportArtifact{}, err
+	}
 
 	modTime := time.Now().UTC().Round(time.Second)
+	manifest := exportManifest{
+		FormatVersion: exportManifestVersion,
+		Kind:          kind,
+		CreatedAt:     modTime,
+		Components:    append([]string(nil), volumes...),
+	}
+	if snap != nil {
+		manifest.SchemaVersion = snap.SchemaVersion
+		manifest.Revision = snap.Revision
+		manifest.Checksum = snap.Checksum
+		manifest.SnapshotPath = snap.VolumePath
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return ExportArtifact{}, err
+	}
 
 	tarFile, err := os.CreateTemp(m.root, "piccolo-export-*.tar")
 	if err != nil {
@@ -116,8 +176,8 @@ func (m *fileExportManager) streamExport(ctx context.Context, kind ExportKind, v
 		}
 	}()
 
-	if _, err := fmt.Fprintf(out, "{\n  \"kind\": \"%s\",\n  \"generated_at\": \"%s\",\n  \"sha256\": \"%x\",\n  \"blob_b64\": \"",
-		kind, modTime.Format(time.RFC3339), sum); err != nil {
+	if _, err := fmt.Fprintf(out, "{\n  \"kind\": \"%s\",\n  \"generated_at\": \"%s\",\n  \"manifest\": %s,\n  \"sha256\": \"%x\",\n  \"blob_b64\": \"",
+		kind, modTime.Format(time.RFC3339), manifestJSON, sum); err != nil {
 		return ExportArtifact{}, err
 	}
 
@@ -149,7 +209,32 @@ func (m *fileExportManager) streamExport(ctx context.Context, kind ExportKind, v
 	return ExportArtifact{Path: dest, Kind: kind}, nil
 }
 
-var _ ExportManager = (*fileExportManager)(nil)
+// checkRoom refuses an export whose working files would not fit above the
+// free-space floor. The export needs the uncompressed tar and its base64
+// copy on disk at the same time, about 7/3 of the ciphertext size.
+func (m *fileExportManager) checkRoom(volumes []string) error {
+	if m.statfs == nil {
+		return nil
+	}
+	var size int64
+	for _, volumeID := range volumes {
+		size += DirSize(filepath.Join(m.root, "ciphertext", volumeID))
+	}
+	need := uint64(size)*7/3 + m.minFree
+	st, err := m.statfs(m.root)
+	if err != nil {
+		return fmt.Errorf("persistence: check export destination: %w", err)
+	}
+	if st.AvailableBytes < need {
+		return fmt.Errorf("%w: export needs about %d bytes but %d are available", ErrNoSpace, need, st.AvailableBytes)
+	}
+	return nil
+}
+
+var (
+	_ ExportManager           = (*fileExportManager)(nil)
+	_ controlSnapshotExporter = (*fileExportManager)(nil)
+)
 
 func (m *fileExportManager) writeVolumeToTar(ctx context.Context, tw *tar.Writer, volumeID string, modTime time.Time) (int, error) {
 	if volumeID == "" {
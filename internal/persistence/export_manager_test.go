@@ -5,20 +5,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 type exportPayload struct {
-	Kind        ExportKind `json:"kind"`
-	GeneratedAt time.Time  `json:"generated_at"`
-	Sha256      string     `json:"sha256"`
-	Blob        string     `json:"blob_b64"`
+	Kind        ExportKind     `json:"kind"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Manifest    exportManifest `json:"manifest"`
+	Sha256      string         `json:"sha256"`
+	Blob        string         `json:"blob_b64"`
 }
 
 func TestFileExportManager_RunControlPlane(t *testing.T) {
@@ -44,12 +48,108 @@ func TestFileExportManager_RunControlPlane(t *testing.T) {
 	if payload.Kind != ExportKindControlOnly {
 		t.Fatalf("payload kind mismatch: %s", payload.Kind)
 	}
+	if m := payload.Manifest; m.FormatVersion != exportManifestVersion || m.Kind != ExportKindControlOnly || len(m.Components) != 1 || m.Components[0] != "control" || m.SnapshotPath != "" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
 	files := untarPayload(t, payload.Blob)
 	if data, ok := files["control/control.db"]; !ok || string(data) != string(sample) {
 		t.Fatalf("tar missing control/control.db or mismatch")
 	}
 }
 
+func TestModuleControlExportSnapshotsDuringWrites(t *testing.T) {
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	dir := t.TempDir()
+	prepareControlCipherDir(t, dir)
+	// Stand in for the gocryptfs mount: what the store writes under the mount
+	// shows up in the ciphertext tree the export walks.
+	if err := os.MkdirAll(filepath.Join(dir, "mounts"), 0o700); err != nil {
+		t.Fatalf("mkdir mounts: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "ciphertext", "control"), filepath.Join(dir, "mounts", "control")); err != nil {
+		t.Fatalf("symlink mount: %v", err)
+	}
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	ctx := context.Background()
+	if err := store.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := store.Auth().SetInitialized(ctx); err != nil {
+		t.Fatalf("SetInitialized: %v", err)
+	}
+
+	mod := &Module{control: store, exports: newFileExportManager(dir)}
+
+	stop := make(chan struct{})
+	writerDone := make(chan error, 1)
+	var writes atomic.Int64
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				writerDone <- nil
+				return
+			default:
+			}
+			if err := store.Auth().SavePasswordHash(ctx, fmt.Sprintf("hash-%d", i)); err != nil {
+				writerDone <- err
+				return
+			}
+			writes.Add(1)
+		}
+	}()
+	for writes.Load() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+
+	before, _, err := store.Revision(ctx)
+	if err != nil {
+		t.Fatalf("revision: %v", err)
+	}
+	art, err := mod.runControlExport(ctx)
+	close(stop)
+	// The store stays online throughout, so no write may hit ErrLocked.
+	if werr := <-writerDone; werr != nil {
+		t.Fatalf("write during export failed: %v", werr)
+	}
+	if err != nil {
+		t.Fatalf("runControlExport: %v", err)
+	}
+
+	payload := readPayload(t, art.Path)
+	manifest := payload.Manifest
+	if manifest.SnapshotPath != controlSnapshotPath || manifest.SchemaVersion != sqliteSchemaVersion || manifest.Checksum == "" {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	if manifest.Revision < before {
+		t.Fatalf("snapshot revision %d predates export start %d", manifest.Revision, before)
+	}
+	files := untarPayload(t, payload.Blob)
+	data, ok := files["control/"+controlSnapshotPath]
+	if !ok {
+		t.Fatalf("artifact missing control snapshot")
+	}
+	extracted := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := os.WriteFile(extracted, data, 0o600); err != nil {
+		t.Fatalf("write extracted snapshot: %v", err)
+	}
+	snap, err := verifyControlSnapshot(ctx, extracted)
+	if err != nil {
+		t.Fatalf("embedded snapshot not intact: %v", err)
+	}
+	if snap.Revision != manifest.Revision || snap.Checksum != manifest.Checksum {
+		t.Fatalf("manifest %+v disagrees with embedded snapshot %+v", manifest, snap)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mounts", "control", filepath.FromSlash(controlSnapshotPath))); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("snapshot left behind in the volume: %v", err)
+	}
+}
+
 func TestFileExportManager_RunFullData(t *testing.T) {
 	root := t.TempDir()
 	controlCipher := filepath.Join(root, "ciphertext", "control")
@@ -117,12 +217,7 @@ func readPayload(t *testing.T, path string) exportPayload {
 	if err != nil {
 		t.Fatalf("read export: %v", err)
 	}
-	var payload struct {
-		Kind        ExportKind `json:"kind"`
-		GeneratedAt time.Time  `json:"generated_at"`
-		Sha256      string     `json:"sha256"`
-		Blob        string     `json:"blob_b64"`
-	}
+	var payload exportPayload
 	if err := json.Unmarshal(data, &payload); err != nil {
 		t.Fatalf("unmarshal payload: %v", err)
 	}
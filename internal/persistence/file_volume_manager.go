@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -123,6 +124,33 @@ func (p *execMountProcess) Pid() int {
 	return p.cmd.Process.Pid
 }
 
+// monitoredProcess fans a mount process exit out to every waiter. The raw
+// process only reports its exit once, but both the death watcher and Detach
+// need to observe it.
+type monitoredProcess struct {
+	mountProcess
+	done chan struct{}
+	err  error
+}
+
+func newMonitoredProcess(proc mountProcess) *monitoredProcess {
+	m := &monitoredProcess{mountProcess: proc, done: make(chan struct{})}
+	go func() {
+		m.err = <-proc.Wait()
+		close(m.done)
+	}()
+	return m
+}
+
+func (m *monitoredProcess) Wait() <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		<-m.done
+		ch <- m.err
+	}()
+	return ch
+}
+
 // FileVolumeManager orchestrates gocryptfs-backed volumes rooted in PICCOLO_STATE_DIR.
 type fileVolumeManager struct {
 	root           string
@@ -136,8 +164,17 @@ type fileVolumeManager struct {
 	stateRoot      string
 	bus            *events.Bus
 	roleChecker    func(string, VolumeRole) bool
+	// spaceGate refuses creating volumes while the disk is nearly full.
+	spaceGate      func() error
 	bypassMount    bool
-	mu             sync.RWMutex
+	remountTries   int
+	remountBackoff time.Duration
+	// remountCtx is cancelled by stopRemounts; remounts tracks the remount
+	// loops still running so it can wait for them.
+	remountCtx    context.Context
+	remountCancel context.CancelFunc
+	remounts      sync.WaitGroup
+	mu            sync.RWMutex
 }
 
 type volumeEntry struct {
@@ -147,6 +184,9 @@ type volumeEntry struct {
 	metadataReady bool
 	role          VolumeRole
 	process       mountProcess
+	detaching     bool
+	// cancelRemount stops a remount loop in progress for this volume.
+	cancelRemount context.CancelFunc
 	metaMu        sync.Mutex
 }
 
@@ -174,6 +214,9 @@ const (
 	volumeStateUnmounted = "unmounted"
 	volumeStatePending   = "pending"
 	volumeStateError     = "error"
+
+	defaultRemountTries   = 3
+	defaultRemountBackoff = 2 * time.Second
 )
 
 var mountPointReplacer = strings.NewReplacer(
@@ -192,6 +235,7 @@ func newFileVolumeManager(root string, crypto *crypt.Manager, bus *events.Bus) *
 	if bypass {
 		waiter = func(string, time.Duration) error { return nil }
 	}
+	remountCtx, remountCancel := context.WithCancel(context.Background())
 	return &fileVolumeManager{
 		root:           root,
 		crypto:         crypto,
@@ -205,6 +249,10 @@ func newFileVolumeManager(root string, crypto *crypt.Manager, bus *events.Bus) *
 		bus:            bus,
 		roleChecker:    func(string, VolumeRole) bool { return true },
 		bypassMount:    bypass,
+		remountTries:   defaultRemountTries,
+		remountBackoff: defaultRemountBackoff,
+		remountCtx:     remountCtx,
+		remountCancel:  remountCancel,
 	}
 }
 
@@ -287,6 +335,11 @@ func (f *fileVolumeManager) EnsureVolume(ctx context.Context, req VolumeRequest)
 		return entry.handle, nil
 	}
 
+	if f.spaceGate != nil {
+		if err := f.spaceGate(); err != nil {
+			return VolumeHandle{}, fmt.Errorf("ensure volume %s: %w", req.ID, err)
+		}
+	}
 	cipherDir := filepath.Join(f.root, "ciphertext", req.ID)
 	if err := os.MkdirAll(cipherDir, 0o700); err != nil {
 		return VolumeHandle{}, fmt.Errorf("ensure volume %s ciphertext: %w", req.ID, err)
@@ -362,6 +415,12 @@ func (f *fileVolumeManager) Attach(ctx context.Context, handle VolumeHandle, opt
 		return err
 	}
 
+	// The mount directory may have been sealed after a previous mount process
+	// died; gocryptfs needs it accessible again before mounting over it.
+	if err := os.Chmod(entry.handle.MountDir, 0o700); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("prepare mount dir %s: %w", handle.ID, err)
+	}
+
 	args := []string{"-f", "-q", "-passfile", "/dev/stdin"}
 	if opts.Role == VolumeRoleFollower {
 		args = append(args, "-ro")
@@ -396,11 +455,14 @@ func (f *fileVolumeManager) Attach(ctx context.Context, handle VolumeHandle, opt
 		return err
 	}
 
+	monitored := newMonitoredProcess(proc)
 	f.mu.Lock()
 	entry.role = opts.Role
 	entry.metadataReady = true
-	entry.process = proc
+	entry.process = monitored
+	entry.detaching = false
 	f.mu.Unlock()
+	go f.watchMountProcess(entry, monitored)
 	if err := f.recordVolumeState(handle.ID, volumeStateMounted, volumeStateMounted, opts.Role, nil); err != nil {
 		return err
 	}
@@ -419,16 +481,22 @@ func (f *fileVolumeManager) Detach(ctx context.Context, handle VolumeHandle) err
 		return f.recordVolumeState(handle.ID, volumeStateUnmounted, volumeStateUnmounted, role, nil)
 	}
 	role := VolumeRoleUnknown
-	f.mu.RLock()
-	if entry, ok := f.volumes[handle.ID]; ok {
+	f.mu.Lock()
+	entry, ok := f.volumes[handle.ID]
+	if ok {
 		role = entry.role
+		// Tell the death watcher the upcoming process exit is expected.
+		entry.detaching = true
+		stopRemountLocked(entry)
 	}
-	f.mu.RUnlock()
+	f.mu.Unlock()
 	if err := f.recordVolumeState(handle.ID, volumeStateUnmounted, volumeStatePending, role, nil); err != nil {
+		f.clearDetaching(entry)
 		return err
 	}
 	args := []string{"-u", handle.MountDir}
 	if err := f.runner.Run(ctx, f.fusermountPath, args, nil); err != nil {
+		f.clearDetaching(entry)
 		_ = f.recordVolumeState(handle.ID, volumeStateUnmounted, volumeStateError, role, err)
 		return fmt.Errorf("detach volume %s: %w", handle.ID, err)
 	}
@@ -439,6 +507,186 @@ func (f *fileVolumeManager) Detach(ctx context.Context, handle VolumeHandle) err
 	return nil
 }
 
+// Remove destroys a volume: it is detached if still mounted, then its
+// ciphertext, mount point and recorded state are deleted.
+func (f *fileVolumeManager) Remove(ctx context.Context, handle VolumeHandle) (VolumeRemoval, error) {
+	if handle.ID == "" {
+		return VolumeRemoval{}, errors.New("remove: volume id required")
+	}
+	switch handle.ID {
+	case "bootstrap", "control":
+		return VolumeRemoval{}, fmt.Errorf("remove: volume %s is required by the system", handle.ID)
+	}
+	entry := f.getOrCreateEntry(handle.ID)
+	if mounted, err := isMountPoint(entry.handle.MountDir); err != nil {
+		return VolumeRemoval{}, err
+	} else if mounted {
+		if err := f.Detach(ctx, entry.handle); err != nil {
+			return VolumeRemoval{}, err
+		}
+	}
+
+	removal := VolumeRemoval{ID: handle.ID}
+	targets := []string{entry.cipherDir, entry.handle.MountDir, filepath.Join(f.stateRoot, handle.ID)}
+	for _, dir := range targets {
+		if _, err := os.Lstat(dir); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return removal, err
+		}
+		if dir == entry.cipherDir {
+			removal.BytesFreed = DirSize(dir)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removal, fmt.Errorf("remove volume %s: %w", handle.ID, err)
+		}
+		removal.Paths = append(removal.Paths, dir)
+	}
+
+	f.mu.Lock()
+	stopRemountLocked(entry)
+	delete(f.volumes, handle.ID)
+	f.mu.Unlock()
+	return removal, nil
+}
+
+// DirSize sums regular file sizes below root; errors are ignored because the
+// figure is informational only. App purges use it to report bytes freed.
+func DirSize(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+func (f *fileVolumeManager) clearDetaching(entry *volumeEntry) {
+	if entry == nil {
+		return
+	}
+	f.mu.Lock()
+	entry.detaching = false
+	f.mu.Unlock()
+}
+
+// watchMountProcess waits for the gocryptfs foreground process behind an
+// attached volume. An exit that Detach did not ask for means the mount has
+// vanished underneath us: record the failure, seal the bare mount directory so
+// nothing writes plaintext into it, and try to bring the mount back.
+func (f *fileVolumeManager) watchMountProcess(entry *volumeEntry, proc *monitoredProcess) {
+	<-proc.done
+	f.mu.Lock()
+	if entry.process != proc || entry.detaching {
+		f.mu.Unlock()
+		return
+	}
+	entry.process = nil
+	role := entry.role
+	handle := entry.handle
+	f.mu.Unlock()
+
+	cause := errors.New("gocryptfs exited unexpectedly")
+	if proc.err != nil {
+		cause = fmt.Errorf("gocryptfs exited unexpectedly: %w", proc.err)
+	}
+	log.Printf("WARN: volume %s lost its mount: %v", handle.ID, cause)
+
+	// Clear any stale FUSE endpoint so the directory can be sealed.
+	if err := f.runner.Run(context.Background(), f.fusermountPath, []string{"-u", "-z", handle.MountDir}, nil); err != nil {
+		log.Printf("WARN: lazy unmount of %s failed: %v", handle.MountDir, err)
+	}
+	if err := os.Chmod(handle.MountDir, 0); err != nil {
+		log.Printf("WARN: failed to seal mount dir %s: %v", handle.MountDir, err)
+	}
+	if err := f.recordVolumeState(handle.ID, volumeStateMounted, volumeStateError, role, cause); err != nil {
+		log.Printf("WARN: failed to record volume %s failure: %v", handle.ID, err)
+	}
+	if role == VolumeRoleUnknown {
+		return
+	}
+	f.mu.Lock()
+	if f.remountCtx.Err() != nil || entry.detaching {
+		f.mu.Unlock()
+		return
+	}
+	stopRemountLocked(entry)
+	ctx, cancel := context.WithCancel(f.remountCtx)
+	entry.cancelRemount = cancel
+	f.remounts.Add(1)
+	f.mu.Unlock()
+	defer f.remounts.Done()
+	defer cancel()
+	f.remountAfterDeath(ctx, entry, role)
+}
+
+// remountAfterDeath retries Attach a bounded number of times, provided the
+// SDEK is still available and we still hold the role the volume was mounted
+// with. It gives up as soon as ctx is cancelled by Detach, Remove or
+// stopRemounts.
+func (f *fileVolumeManager) remountAfterDeath(ctx context.Context, entry *volumeEntry, role VolumeRole) {
+	id := entry.handle.ID
+	for attempt := 1; attempt <= f.remountTries; attempt++ {
+		timer := time.NewTimer(f.remountBackoff * time.Duration(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if f.crypto == nil || f.crypto.IsLocked() {
+			log.Printf("INFO: volume %s remount skipped; crypto locked", id)
+			return
+		}
+		if state, err := f.readVolumeState(id); err == nil && state.Desired != volumeStateMounted {
+			return
+		}
+		f.mu.RLock()
+		checker := f.roleChecker
+		current := entry.process
+		f.mu.RUnlock()
+		if current != nil {
+			return
+		}
+		if checker != nil && !checker(id, role) {
+			log.Printf("INFO: volume %s remount skipped; role %s no longer held", id, role)
+			return
+		}
+		if err := f.Attach(ctx, entry.handle, AttachOptions{Role: role}); err != nil {
+			log.Printf("WARN: volume %s remount attempt %d/%d failed: %v", id, attempt, f.remountTries, err)
+			continue
+		}
+		log.Printf("INFO: volume %s remounted after mount process exit", id)
+		return
+	}
+}
+
+// stopRemountLocked cancels the remount loop of entry, if any; f.mu must be
+// held.
+func stopRemountLocked(entry *volumeEntry) {
+	if entry.cancelRemount != nil {
+		entry.cancelRemount()
+		entry.cancelRemount = nil
+	}
+}
+
+// stopRemounts cancels every remount loop, refuses new ones and waits for
+// those running to return.
+func (f *fileVolumeManager) stopRemounts() {
+	f.mu.Lock()
+	f.remountCancel()
+	f.mu.Unlock()
+	f.remounts.Wait()
+}
+
 func (f *fileVolumeManager) RoleStream(volumeID string) (<-chan VolumeRole, error) {
 	ch := make(chan VolumeRole)
 	close(ch)
@@ -571,10 +819,17 @@ func (f *fileVolumeManager) publishVolumeEvent(volumeID string, state volumeStat
 	if f.bus == nil {
 		return
 	}
+	mountDir := filepath.Join(f.root, "mounts", volumeID)
+	f.mu.RLock()
+	if entry, ok := f.volumes[volumeID]; ok {
+		mountDir = entry.handle.MountDir
+	}
+	f.mu.RUnlock()
 	f.bus.Publish(events.Event{
 		Topic: events.TopicVolumeStateChanged,
 		Payload: events.VolumeStateChanged{
 			ID:          volumeID,
+			MountDir:    mountDir,
 			Desired:     state.Desired,
 			Observed:    state.Observed,
 			Role:        state.Role,
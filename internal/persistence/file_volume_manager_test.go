@@ -260,6 +260,48 @@ func TestFileVolumeManagerDetach(t *testing.T) {
 	}
 }
 
+func TestFileVolumeManagerRemove(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	runner := &fakeRunner{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", nil, nil)
+
+	h, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: "app-gamma", Class: VolumeClassApplication})
+	if err != nil {
+		t.Fatalf("EnsureVolume: %v", err)
+	}
+	cipherDir := filepath.Join(root, "ciphertext", "app-gamma")
+	if err := os.WriteFile(filepath.Join(cipherDir, "blob"), make([]byte, 4096), 0o600); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+
+	removal, err := mgr.Remove(context.Background(), h)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if removal.ID != "app-gamma" || removal.BytesFreed < 4096 {
+		t.Fatalf("unexpected removal report: %+v", removal)
+	}
+	for _, dir := range []string{cipherDir, h.MountDir} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, stat err=%v", dir, err)
+		}
+		found := false
+		for _, p := range removal.Paths {
+			if p == dir {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected %s in removal paths %v", dir, removal.Paths)
+		}
+	}
+
+	if _, err := mgr.Remove(context.Background(), VolumeHandle{ID: "control"}); err == nil {
+		t.Fatalf("expected control volume removal to be refused")
+	}
+}
+
 func TestFileVolumeManagerAttachDetectsCorruptedMetadata(t *testing.T) {
 	root := t.TempDir()
 	cryptoMgr := newUnlockedCrypto(t, root)
@@ -865,3 +907,259 @@ func TestFileVolumeManagerIntegration(t *testing.T) {
 		t.Fatalf("Detach: %v", err)
 	}
 }
+
+func waitForVolumeEvent(t *testing.T, sub <-chan events.Event, id, observed string) events.VolumeStateChanged {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case evt := <-sub:
+			state, ok := evt.Payload.(events.VolumeStateChanged)
+			if !ok || state.ID != id || state.Observed != observed {
+				continue
+			}
+			return state
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s event on volume %s", observed, id)
+		}
+	}
+}
+
+func TestFileVolumeManagerMountProcessDeathSealsAndFlags(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.TopicVolumeStateChanged, 32)
+
+	runner := &fakeRunner{}
+	launcher := &fakeMountLauncher{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", launcher, func(string, time.Duration) error { return nil })
+	mgr.bus = bus
+	mgr.remountBackoff = 10 * time.Millisecond
+
+	handle, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: "fragile", Class: VolumeClassApplication})
+	if err != nil {
+		t.Fatalf("EnsureVolume: %v", err)
+	}
+	if err := mgr.Attach(context.Background(), handle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	waitForVolumeEvent(t, sub, "fragile", volumeStateMounted)
+
+	// Locking crypto keeps the watcher from remounting so the error state sticks.
+	cryptoMgr.Lock()
+	launcher.processes[0].done <- errors.New("signal: killed")
+
+	failed := waitForVolumeEvent(t, sub, "fragile", volumeStateError)
+	if !failed.NeedsRepair || !strings.Contains(failed.LastError, "exited unexpectedly") {
+		t.Fatalf("unexpected failure event: %+v", failed)
+	}
+	if failed.MountDir != handle.MountDir {
+		t.Fatalf("expected mount dir %s in event, got %s", handle.MountDir, failed.MountDir)
+	}
+	info, err := os.Stat(handle.MountDir)
+	if err != nil {
+		t.Fatalf("stat mount dir: %v", err)
+	}
+	if info.Mode().Perm() != 0 {
+		t.Fatalf("expected sealed mount dir, got mode %v", info.Mode().Perm())
+	}
+	state, err := mgr.readVolumeState("fragile")
+	if err != nil {
+		t.Fatalf("readVolumeState: %v", err)
+	}
+	if state.Observed != volumeStateError || !state.NeedsRepair {
+		t.Fatalf("expected persisted error state, got %+v", state)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(launcher.calls) != 1 {
+		t.Fatalf("expected no remount while locked, got %d launches", len(launcher.calls))
+	}
+}
+
+func TestFileVolumeManagerRemountsAfterProcessDeath(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.TopicVolumeStateChanged, 32)
+
+	runner := &fakeRunner{}
+	launcher := &fakeMountLauncher{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", launcher, func(string, time.Duration) error { return nil })
+	mgr.bus = bus
+	mgr.remountBackoff = 10 * time.Millisecond
+
+	handle, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: "phoenix", Class: VolumeClassApplication})
+	if err != nil {
+		t.Fatalf("EnsureVolume: %v", err)
+	}
+	if err := mgr.Attach(context.Background(), handle, AttachOptions{Role: VolumeRoleFollower}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	waitForVolumeEvent(t, sub, "phoenix", volumeStateMounted)
+
+	launcher.processes[0].done <- errors.New("signal: killed")
+	waitForVolumeEvent(t, sub, "phoenix", volumeStateError)
+	remounted := waitForVolumeEvent(t, sub, "phoenix", volumeStateMounted)
+	if remounted.NeedsRepair || remounted.Role != string(VolumeRoleFollower) {
+		t.Fatalf("unexpected remount event: %+v", remounted)
+	}
+	if len(launcher.calls) != 2 || !containsArgs(launcher.calls[1].args, []string{"-ro"}) {
+		t.Fatalf("expected follower remount launch, got %+v", launcher.calls)
+	}
+	info, err := os.Stat(handle.MountDir)
+	if err != nil {
+		t.Fatalf("stat mount dir: %v", err)
+	}
+	if info.Mode().Perm() != 0o700 {
+		t.Fatalf("expected mount dir reopened for remount, got %v", info.Mode().Perm())
+	}
+}
+
+func TestFileVolumeManagerStopRemountsCancelsBackoff(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.TopicVolumeStateChanged, 32)
+
+	runner := &fakeRunner{}
+	launcher := &fakeMountLauncher{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", launcher, func(string, time.Duration) error { return nil })
+	mgr.bus = bus
+	mgr.remountBackoff = time.Minute
+
+	handle, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: "stuck", Class: VolumeClassApplication})
+	if err != nil {
+		t.Fatalf("EnsureVolume: %v", err)
+	}
+	if err := mgr.Attach(context.Background(), handle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	waitForVolumeEvent(t, sub, "stuck", volumeStateMounted)
+
+	launcher.processes[0].done <- errors.New("signal: killed")
+	waitForVolumeEvent(t, sub, "stuck", volumeStateError)
+
+	// The remount loop is now waiting out a minute of backoff; shutting the
+	// manager down must end it at once rather than after the wait.
+	stopped := make(chan struct{})
+	go func() {
+		mgr.stopRemounts()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("stopRemounts did not cancel the remount backoff")
+	}
+	if len(launcher.calls) != 1 {
+		t.Fatalf("expected no remount after stop, got %d launches", len(launcher.calls))
+	}
+}
+
+func TestFileVolumeManagerDetachDoesNotTriggerRemount(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	runner := &fakeRunner{}
+	launcher := &fakeMountLauncher{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", launcher, func(string, time.Duration) error { return nil })
+	mgr.remountBackoff = 10 * time.Millisecond
+
+	handle, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: "calm", Class: VolumeClassApplication})
+	if err != nil {
+		t.Fatalf("EnsureVolume: %v", err)
+	}
+	if err := mgr.Attach(context.Background(), handle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	// The fake process only exits once Detach kills it; the watcher must
+	// treat that exit as expected.
+	if err := mgr.Detach(context.Background(), handle); err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	state, err := mgr.readVolumeState("calm")
+	if err != nil {
+		t.Fatalf("readVolumeState: %v", err)
+	}
+	if state.Observed != volumeStateUnmounted || state.NeedsRepair {
+		t.Fatalf("expected clean unmounted state, got %+v", state)
+	}
+	if len(launcher.calls) != 1 {
+		t.Fatalf("expected no remount after detach, got %d launches", len(launcher.calls))
+	}
+}
+
+// newVolumesWithPassphrases creates the named volumes and returns the passphrase each
+// was initialised with.
+func newVolumesWithPassphrases(t *testing.T, mgr *fileVolumeManager, runner *fakeRunner, ids ...string) map[string]string {
+	t.Helper()
+	passphrases := make(map[string]string)
+	for _, id := range ids {
+		runner.calls = runner.calls[:0]
+		if _, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: id, Class: VolumeClassApplication}); err != nil {
+			t.Fatalf("EnsureVolume %s: %v", id, err)
+		}
+		if len(runner.calls) != 1 {
+			t.Fatalf("expected gocryptfs init for %s, got %d calls", id, len(runner.calls))
+		}
+		passphrases[id] = runner.calls[0].stdin
+	}
+	return passphrases
+}
+
+// restartVolumes simulates a restart: a fresh crypto manager unlocked with
+// password and a fresh volume manager over the same state directory.
+func restartVolumes(t *testing.T, root, password string) (*fileVolumeManager, *fakeMountLauncher) {
+	t.Helper()
+	cryptoMgr, err := crypt.NewManager(root)
+	if err != nil {
+		t.Fatalf("new crypto manager: %v", err)
+	}
+	if password != "" {
+		if err := cryptoMgr.Unlock(password); err != nil {
+			t.Fatalf("unlock: %v", err)
+		}
+	}
+	launcher := &fakeMountLauncher{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, &fakeRunner{}, "gocryptfs", "fusermount3", launcher, func(string, time.Duration) error { return nil })
+	return mgr, launcher
+}
+
+// expectMountedWith attaches every volume and checks gocryptfs receives the
+// passphrase it was created with.
+func expectMountedWith(t *testing.T, mgr *fileVolumeManager, launcher *fakeMountLauncher, passphrases map[string]string) {
+	t.Helper()
+	for id, want := range passphrases {
+		launcher.calls = launcher.calls[:0]
+		handle, err := mgr.EnsureVolume(context.Background(), VolumeRequest{ID: id, Class: VolumeClassApplication})
+		if err != nil {
+			t.Fatalf("EnsureVolume %s: %v", id, err)
+		}
+		if err := mgr.Attach(context.Background(), handle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
+			t.Fatalf("attach %s: %v", id, err)
+		}
+		if len(launcher.calls) != 1 || launcher.calls[0].stdin != want {
+			t.Fatalf("volume %s mounted with the wrong passphrase", id)
+		}
+	}
+}
+
+func TestFileVolumeManagerAttachAfterPasswordReset(t *testing.T) {
+	root := t.TempDir()
+	cryptoMgr := newUnlockedCrypto(t, root)
+	runner := &fakeRunner{}
+	mgr := newFileVolumeManagerWithDeps(root, cryptoMgr, runner, "gocryptfs", "fusermount3", nil, nil)
+	passphrases := newVolumesWithPassphrases(t, mgr, runner, "alpha", "beta")
+	words, err := cryptoMgr.GenerateRecoveryKey(false)
+	if err != nil {
+		t.Fatalf("generate recovery key: %v", err)
+	}
+	cryptoMgr.Lock()
+	if err := cryptoMgr.ResetPassword(words, "reset-passphrase"); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+
+	restarted, launcher := restartVolumes(t, root, "reset-passphrase")
+	expectMountedWith(t, restarted, launcher, passphrases)
+}
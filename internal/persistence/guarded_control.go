@@ -16,8 +16,11 @@ type guardedControlStore struct {
 	health interface {
 		QuickCheck(context.Context) (ControlHealthReport, error)
 	}
-	leader   func() bool
-	onCommit func(context.Context)
+	snapshots controlSnapshotter
+	leader    func() bool
+	onCommit  func(context.Context)
+	// space refuses writes while the disk is nearly full; nil allows them.
+	space func() error
 }
 
 func newGuardedControlStore(inner ControlStore, leader func() bool, onCommit func(context.Context)) ControlStore {
@@ -44,7 +47,8 @@ func newGuardedControlStore(inner ControlStore, leader func() bool, onCommit fun
 	}); ok {
 		health = h
 	}
-	return &guardedControlStore{inner: inner, lockable: lockable, revision: rev, health: health, leader: leader, onCommit: onCommit}
+	snapshots, _ := inner.(controlSnapshotter)
+	return &guardedControlStore{inner: inner, lockable: lockable, revision: rev, health: health, snapshots: snapshots, leader: leader, onCommit: onCommit}
 }
 
 func (g *guardedControlStore) Auth() AuthRepo {
@@ -56,6 +60,45 @@ func (g *guardedControlStore) Remote() RemoteRepo {
 func (g *guardedControlStore) AppState() AppStateRepo {
 	return &guardedAppStateRepo{store: g, repo: g.inner.AppState()}
 }
+func (g *guardedControlStore) Activity() ActivityRepo {
+	return &guardedActivityRepo{store: g, repo: g.inner.Activity()}
+}
+func (g *guardedControlStore) ServiceStats() ServiceStatsRepo {
+	return &guardedServiceStatsRepo{store: g, repo: g.inner.ServiceStats()}
+}
+func (g *guardedControlStore) OSUpdates() OSUpdateRepo {
+	return &guardedOSUpdateRepo{store: g, repo: g.inner.OSUpdates()}
+}
+func (g *guardedControlStore) SelfUpdate() SelfUpdateRepo {
+	return &guardedSelfUpdateRepo{store: g, repo: g.inner.SelfUpdate()}
+}
+func (g *guardedControlStore) Notifications() NotificationRepo {
+	return &guardedNotificationRepo{store: g, repo: g.inner.Notifications()}
+}
+func (g *guardedControlStore) Identity() IdentityRepo {
+	return &guardedIdentityRepo{store: g, repo: g.inner.Identity()}
+}
+func (g *guardedControlStore) SessionPolicy() SessionPolicyRepo {
+	return &guardedSessionPolicyRepo{store: g, repo: g.inner.SessionPolicy()}
+}
+func (g *guardedControlStore) NetworkSettings() NetworkSettingsRepo {
+	return &guardedNetworkSettingsRepo{store: g, repo: g.inner.NetworkSettings()}
+}
+func (g *guardedControlStore) CORSPolicy() CORSPolicyRepo {
+	return &guardedCORSPolicyRepo{store: g, repo: g.inner.CORSPolicy()}
+}
+func (g *guardedControlStore) PortPolicy() PortPolicyRepo {
+	return &guardedPortPolicyRepo{store: g, repo: g.inner.PortPolicy()}
+}
+func (g *guardedControlStore) MountAllowlist() MountAllowlistRepo {
+	return &guardedMountAllowlistRepo{store: g, repo: g.inner.MountAllowlist()}
+}
+func (g *guardedControlStore) AppPolicy() AppPolicyRepo {
+	return &guardedAppPolicyRepo{store: g, repo: g.inner.AppPolicy()}
+}
+func (g *guardedControlStore) APITokens() APITokenRepo {
+	return &guardedAPITokenRepo{store: g, repo: g.inner.APITokens()}
+}
 func (g *guardedControlStore) Close(ctx context.Context) error { return g.inner.Close(ctx) }
 
 func (g *guardedControlStore) Lock() {
@@ -85,6 +128,26 @@ func (g *guardedControlStore) QuickCheck(ctx context.Context) (ControlHealthRepo
 	return g.health.QuickCheck(ctx)
 }
 
+// Snapshot is read-only, so followers may take one too.
+func (g *guardedControlStore) Snapshot(ctx context.Context) (ControlSnapshot, error) {
+	if g.snapshots == nil {
+		return ControlSnapshot{}, ErrNotImplemented
+	}
+	return g.snapshots.Snapshot(ctx)
+}
+
+// writable reports why a write must be refused: a follower may not write,
+// and nobody may while free space is below the floor.
+func (g *guardedControlStore) writable() error {
+	if g.leader != nil && !g.leader() {
+		return ErrNotLeader
+	}
+	if g.space != nil {
+		return g.space()
+	}
+	return nil
+}
+
 func (g *guardedControlStore) notifyCommit(ctx context.Context, err error) error {
 	if err == nil && g.onCommit != nil {
 		g.onCommit(ctx)
@@ -107,6 +170,71 @@ type guardedAppStateRepo struct {
 	repo  AppStateRepo
 }
 
+type guardedActivityRepo struct {
+	store *guardedControlStore
+	repo  ActivityRepo
+}
+
+type guardedServiceStatsRepo struct {
+	store *guardedControlStore
+	repo  ServiceStatsRepo
+}
+
+type guardedOSUpdateRepo struct {
+	store *guardedControlStore
+	repo  OSUpdateRepo
+}
+
+type guardedSelfUpdateRepo struct {
+	store *guardedControlStore
+	repo  SelfUpdateRepo
+}
+
+type guardedNotificationRepo struct {
+	store *guardedControlStore
+	repo  NotificationRepo
+}
+
+type guardedIdentityRepo struct {
+	store *guardedControlStore
+	repo  IdentityRepo
+}
+
+type guardedSessionPolicyRepo struct {
+	store *guardedControlStore
+	repo  SessionPolicyRepo
+}
+
+type guardedNetworkSettingsRepo struct {
+	store *guardedControlStore
+	repo  NetworkSettingsRepo
+}
+
+type guardedCORSPolicyRepo struct {
+	store *guardedControlStore
+	repo  CORSPolicyRepo
+}
+
+type guardedPortPolicyRepo struct {
+	store *guardedControlStore
+	repo  PortPolicyRepo
+}
+
+type guardedMountAllowlistRepo struct {
+	store *guardedControlStore
+	repo  MountAllowlistRepo
+}
+
+type guardedAppPolicyRepo struct {
+	store *guardedControlStore
+	repo  AppPolicyRepo
+}
+
+type guardedAPITokenRepo struct {
+	store *guardedControlStore
+	repo  APITokenRepo
+}
+
 func (r *guardedAuthRepo) IsInitialized(ctx context.Context) (bool, error) {
 	return r.repo.IsInitialized(ctx)
 }
@@ -118,33 +246,44 @@ func (r *guardedAuthRepo) Staleness(ctx context.Context) (AuthStaleness, error)
 }
 
 func (r *guardedAuthRepo) SetInitialized(ctx context.Context) error {
-	if r.store.leader != nil && !r.store.leader() {
-		return ErrNotLeader
+	if err := r.store.writable(); err != nil {
+		return err
 	}
 	return r.store.notifyCommit(ctx, r.repo.SetInitialized(ctx))
 }
 
 func (r *guardedAuthRepo) SavePasswordHash(ctx context.Context, hash string) error {
-	if r.store.leader != nil && !r.store.leader() {
-		return ErrNotLeader
+	if err := r.store.writable(); err != nil {
+		return err
 	}
 	return r.store.notifyCommit(ctx, r.repo.SavePasswordHash(ctx, hash))
 }
 
 func (r *guardedAuthRepo) UpdateStaleness(ctx context.Context, update AuthStalenessUpdate) error {
-	if r.store.leader != nil && !r.store.leader() {
-		return ErrNotLeader
+	if err := r.store.writable(); err != nil {
+		return err
 	}
 	return r.store.notifyCommit(ctx, r.repo.UpdateStaleness(ctx, update))
 }
 
+func (r *guardedAuthRepo) SetupCompletedAt(ctx context.Context) (time.Time, error) {
+	return r.repo.SetupCompletedAt(ctx)
+}
+
+func (r *guardedAuthRepo) MarkSetupComplete(ctx context.Context, at time.Time) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.MarkSetupComplete(ctx, at))
+}
+
 func (r *guardedRemoteRepo) CurrentConfig(ctx context.Context) (RemoteConfig, error) {
 	return r.repo.CurrentConfig(ctx)
 }
 
 func (r *guardedRemoteRepo) SaveConfig(ctx context.Context, cfg RemoteConfig) error {
-	if r.store.leader != nil && !r.store.leader() {
-		return ErrNotLeader
+	if err := r.store.writable(); err != nil {
+		return err
 	}
 	return r.store.notifyCommit(ctx, r.repo.SaveConfig(ctx, cfg))
 }
@@ -154,8 +293,189 @@ func (r *guardedAppStateRepo) ListApps(ctx context.Context) ([]AppRecord, error)
 }
 
 func (r *guardedAppStateRepo) UpsertApp(ctx context.Context, record AppRecord) error {
-	if r.store.leader != nil && !r.store.leader() {
-		return ErrNotLeader
+	if err := r.store.writable(); err != nil {
+		return err
 	}
 	return r.store.notifyCommit(ctx, r.repo.UpsertApp(ctx, record))
 }
+
+func (r *guardedActivityRepo) ListActivity(ctx context.Context, query ActivityQuery) ([]ActivityRecord, error) {
+	return r.repo.ListActivity(ctx, query)
+}
+
+// Activity writes skip notifyCommit: they do not change the control revision.
+func (r *guardedActivityRepo) AppendActivity(ctx context.Context, record ActivityRecord) (ActivityRecord, error) {
+	if err := r.store.writable(); err != nil {
+		return record, err
+	}
+	return r.repo.AppendActivity(ctx, record)
+}
+
+func (r *guardedActivityRepo) PruneActivity(ctx context.Context, policy ActivityRetention) (int, error) {
+	if err := r.store.writable(); err != nil {
+		return 0, err
+	}
+	return r.repo.PruneActivity(ctx, policy)
+}
+
+func (r *guardedServiceStatsRepo) LoadServiceStats(ctx context.Context) ([]ServiceStatsRecord, error) {
+	return r.repo.LoadServiceStats(ctx)
+}
+
+func (r *guardedServiceStatsRepo) SaveServiceStats(ctx context.Context, records []ServiceStatsRecord) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.repo.SaveServiceStats(ctx, records)
+}
+
+func (r *guardedOSUpdateRepo) CurrentJob(ctx context.Context) (OSUpdateJob, error) {
+	return r.repo.CurrentJob(ctx)
+}
+
+func (r *guardedOSUpdateRepo) SaveJob(ctx context.Context, job OSUpdateJob) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveJob(ctx, job))
+}
+
+func (r *guardedSelfUpdateRepo) CurrentState(ctx context.Context) (SelfUpdateState, error) {
+	return r.repo.CurrentState(ctx)
+}
+
+func (r *guardedSelfUpdateRepo) SaveState(ctx context.Context, state SelfUpdateState) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveState(ctx, state))
+}
+
+func (r *guardedNotificationRepo) CurrentConfig(ctx context.Context) (NotificationConfig, error) {
+	return r.repo.CurrentConfig(ctx)
+}
+
+func (r *guardedNotificationRepo) SaveConfig(ctx context.Context, cfg NotificationConfig) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveConfig(ctx, cfg))
+}
+
+func (r *guardedIdentityRepo) CurrentIdentity(ctx context.Context) (DeviceIdentity, error) {
+	return r.repo.CurrentIdentity(ctx)
+}
+
+func (r *guardedIdentityRepo) SaveIdentity(ctx context.Context, identity DeviceIdentity) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveIdentity(ctx, identity))
+}
+
+func (r *guardedSessionPolicyRepo) CurrentPolicy(ctx context.Context) (SessionPolicy, error) {
+	return r.repo.CurrentPolicy(ctx)
+}
+
+func (r *guardedSessionPolicyRepo) SavePolicy(ctx context.Context, policy SessionPolicy) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SavePolicy(ctx, policy))
+}
+
+func (r *guardedNetworkSettingsRepo) CurrentSettings(ctx context.Context) (NetworkSettings, error) {
+	return r.repo.CurrentSettings(ctx)
+}
+
+func (r *guardedNetworkSettingsRepo) SaveSettings(ctx context.Context, settings NetworkSettings) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveSettings(ctx, settings))
+}
+
+func (r *guardedCORSPolicyRepo) CurrentPolicy(ctx context.Context) (CORSPolicy, error) {
+	return r.repo.CurrentPolicy(ctx)
+}
+
+func (r *guardedCORSPolicyRepo) SavePolicy(ctx context.Context, policy CORSPolicy) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SavePolicy(ctx, policy))
+}
+
+func (r *guardedPortPolicyRepo) CurrentPolicy(ctx context.Context) (PortPolicy, error) {
+	return r.repo.CurrentPolicy(ctx)
+}
+
+func (r *guardedPortPolicyRepo) SavePolicy(ctx context.Context, policy PortPolicy) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SavePolicy(ctx, policy))
+}
+
+func (r *guardedPortPolicyRepo) OccupiedPorts(ctx context.Context) ([]OccupiedPort, error) {
+	return r.repo.OccupiedPorts(ctx)
+}
+
+func (r *guardedPortPolicyRepo) SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.repo.SaveOccupiedPorts(ctx, ports)
+}
+
+func (r *guardedMountAllowlistRepo) CurrentAllowlist(ctx context.Context) (MountAllowlist, error) {
+	return r.repo.CurrentAllowlist(ctx)
+}
+
+func (r *guardedMountAllowlistRepo) SaveAllowlist(ctx context.Context, allowlist MountAllowlist) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SaveAllowlist(ctx, allowlist))
+}
+
+func (r *guardedAppPolicyRepo) CurrentPolicy(ctx context.Context) (AppPolicy, error) {
+	return r.repo.CurrentPolicy(ctx)
+}
+
+func (r *guardedAppPolicyRepo) SavePolicy(ctx context.Context, policy AppPolicy) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.SavePolicy(ctx, policy))
+}
+
+func (r *guardedAPITokenRepo) ListTokens(ctx context.Context) ([]APIToken, error) {
+	return r.repo.ListTokens(ctx)
+}
+
+func (r *guardedAPITokenRepo) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	return r.repo.TokenByHash(ctx, hash)
+}
+
+func (r *guardedAPITokenRepo) CreateToken(ctx context.Context, token APIToken) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.CreateToken(ctx, token))
+}
+
+func (r *guardedAPITokenRepo) DeleteToken(ctx context.Context, id string) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.store.notifyCommit(ctx, r.repo.DeleteToken(ctx, id))
+}
+
+// Token use skips notifyCommit: it does not change the control revision.
+func (r *guardedAPITokenRepo) TouchToken(ctx context.Context, id string, at time.Time) error {
+	if err := r.store.writable(); err != nil {
+		return err
+	}
+	return r.repo.TouchToken(ctx, id, at)
+}
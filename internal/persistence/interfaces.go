@@ -18,6 +18,10 @@ type Service interface {
 	Consensus() ConsensusManager
 	BootstrapVolume() VolumeHandle
 	ControlVolume() VolumeHandle
+	StorageUsage(ctx context.Context) (StorageUsage, error)
+	// Close checkpoints and closes the control store, then detaches the
+	// core volumes.
+	Close(ctx context.Context) error
 }
 
 // BootstrapStore manages the device-local bootstrap shard lifecycle.
@@ -32,6 +36,19 @@ type ControlStore interface {
 	Auth() AuthRepo
 	Remote() RemoteRepo
 	AppState() AppStateRepo
+	Activity() ActivityRepo
+	ServiceStats() ServiceStatsRepo
+	OSUpdates() OSUpdateRepo
+	SelfUpdate() SelfUpdateRepo
+	Notifications() NotificationRepo
+	Identity() IdentityRepo
+	SessionPolicy() SessionPolicyRepo
+	NetworkSettings() NetworkSettingsRepo
+	CORSPolicy() CORSPolicyRepo
+	PortPolicy() PortPolicyRepo
+	MountAllowlist() MountAllowlistRepo
+	AppPolicy() AppPolicyRepo
+	APITokens() APITokenRepo
 	Close(ctx context.Context) error
 	Revision(ctx context.Context) (uint64, string, error)
 	QuickCheck(ctx context.Context) (ControlHealthReport, error)
@@ -42,6 +59,7 @@ type VolumeManager interface {
 	EnsureVolume(ctx context.Context, req VolumeRequest) (VolumeHandle, error)
 	Attach(ctx context.Context, handle VolumeHandle, opts AttachOptions) error
 	Detach(ctx context.Context, handle VolumeHandle) error
+	Remove(ctx context.Context, handle VolumeHandle) (VolumeRemoval, error)
 	RoleStream(volumeID string) (<-chan VolumeRole, error)
 }
 
@@ -80,6 +98,8 @@ type AuthRepo interface {
 	SavePasswordHash(ctx context.Context, hash string) error
 	Staleness(ctx context.Context) (AuthStaleness, error)
 	UpdateStaleness(ctx context.Context, update AuthStalenessUpdate) error
+	SetupCompletedAt(ctx context.Context) (time.Time, error)
+	MarkSetupComplete(ctx context.Context, at time.Time) error
 }
 
 type RemoteRepo interface {
@@ -92,6 +112,117 @@ type AppStateRepo interface {
 	UpsertApp(ctx context.Context, record AppRecord) error
 }
 
+// ActivityRepo stores the device activity log. Entries are operational history
+// rather than control-plane configuration, so appends do not advance the
+// control revision.
+type ActivityRepo interface {
+	AppendActivity(ctx context.Context, record ActivityRecord) (ActivityRecord, error)
+	ListActivity(ctx context.Context, query ActivityQuery) ([]ActivityRecord, error)
+	PruneActivity(ctx context.Context, policy ActivityRetention) (int, error)
+}
+
+// ServiceStatsRepo keeps periodic snapshots of per-listener proxy counters so
+// traffic history survives restarts. Like the activity log, snapshots are
+// telemetry and do not advance the control revision.
+type ServiceStatsRepo interface {
+	LoadServiceStats(ctx context.Context) ([]ServiceStatsRecord, error)
+	// SaveServiceStats replaces the stored snapshot with records.
+	SaveServiceStats(ctx context.Context, records []ServiceStatsRecord) error
+}
+
+// OSUpdateRepo keeps the most recent OS update job so its outcome can still be
+// reported after the reboot that completes (or interrupts) it.
+type OSUpdateRepo interface {
+	// CurrentJob returns ErrNotFound when no update has been started yet.
+	CurrentJob(ctx context.Context) (OSUpdateJob, error)
+	SaveJob(ctx context.Context, job OSUpdateJob) error
+}
+
+// SelfUpdateRepo stores the piccolod self-update channel and the outcome of
+// the last binary swap, which the restarted daemon confirms after unlock.
+type SelfUpdateRepo interface {
+	// CurrentState returns ErrNotFound before any channel or update is recorded.
+	CurrentState(ctx context.Context) (SelfUpdateState, error)
+	SaveState(ctx context.Context, state SelfUpdateState) error
+}
+
+// NotificationRepo stores notification targets, including their delivery
+// credentials; the control volume keeps them encrypted at rest.
+type NotificationRepo interface {
+	// CurrentConfig returns ErrNotFound before any target is saved.
+	CurrentConfig(ctx context.Context) (NotificationConfig, error)
+	SaveConfig(ctx context.Context, cfg NotificationConfig) error
+}
+
+// IdentityRepo stores the device name. Callers keep their own bootstrap copy
+// so the name is known before unlock.
+type IdentityRepo interface {
+	// CurrentIdentity returns ErrNotFound before a name is saved.
+	CurrentIdentity(ctx context.Context) (DeviceIdentity, error)
+	SaveIdentity(ctx context.Context, identity DeviceIdentity) error
+}
+
+// SessionPolicyRepo stores the admin session timeouts.
+type SessionPolicyRepo interface {
+	// CurrentPolicy returns ErrNotFound until a policy is saved.
+	CurrentPolicy(ctx context.Context) (SessionPolicy, error)
+	SavePolicy(ctx context.Context, policy SessionPolicy) error
+}
+
+// NetworkSettingsRepo stores where the admin HTTP listener binds.
+type NetworkSettingsRepo interface {
+	// CurrentSettings returns ErrNotFound until settings are saved.
+	CurrentSettings(ctx context.Context) (NetworkSettings, error)
+	SaveSettings(ctx context.Context, settings NetworkSettings) error
+}
+
+// CORSPolicyRepo stores which cross-origin callers the API answers.
+type CORSPolicyRepo interface {
+	// CurrentPolicy returns ErrNotFound until a policy is saved.
+	CurrentPolicy(ctx context.Context) (CORSPolicy, error)
+	SavePolicy(ctx context.Context, policy CORSPolicy) error
+}
+
+// PortPolicyRepo stores where the service allocator hands out ports.
+type PortPolicyRepo interface {
+	// CurrentPolicy returns ErrNotFound until a policy is saved.
+	CurrentPolicy(ctx context.Context) (PortPolicy, error)
+	SavePolicy(ctx context.Context, policy PortPolicy) error
+	// OccupiedPorts lists ports the allocator skipped because a process
+	// outside Piccolo held them.
+	OccupiedPorts(ctx context.Context) ([]OccupiedPort, error)
+	// SaveOccupiedPorts replaces the recorded occupied ports.
+	SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error
+}
+
+// MountAllowlistRepo stores the host directories apps may bind mount.
+type MountAllowlistRepo interface {
+	// CurrentAllowlist returns ErrNotFound until an allowlist is saved.
+	CurrentAllowlist(ctx context.Context) (MountAllowlist, error)
+	SaveAllowlist(ctx context.Context, allowlist MountAllowlist) error
+}
+
+// AppPolicyRepo stores which app capabilities are permitted.
+type AppPolicyRepo interface {
+	// CurrentPolicy returns ErrNotFound until a policy is saved.
+	CurrentPolicy(ctx context.Context) (AppPolicy, error)
+	SavePolicy(ctx context.Context, policy AppPolicy) error
+}
+
+// APITokenRepo stores long-lived automation tokens. Only a hash of each
+// secret is kept.
+type APITokenRepo interface {
+	ListTokens(ctx context.Context) ([]APIToken, error)
+	// TokenByHash returns ErrNotFound when no token has that hash.
+	TokenByHash(ctx context.Context, hash string) (APIToken, error)
+	CreateToken(ctx context.Context, token APIToken) error
+	// DeleteToken returns ErrNotFound for an unknown id.
+	DeleteToken(ctx context.Context, id string) error
+	// TouchToken records a use. Like activity appends it does not advance
+	// the control revision.
+	TouchToken(ctx context.Context, id string, at time.Time) error
+}
+
 // Data structures -----------------------------------------------------------
 
 type VolumeRequest struct {
@@ -105,6 +236,13 @@ type VolumeHandle struct {
 	MountDir string
 }
 
+// VolumeRemoval reports what was deleted when a volume was destroyed.
+type VolumeRemoval struct {
+	ID         string
+	Paths      []string
+	BytesFreed int64
+}
+
 type AttachOptions struct {
 	Role VolumeRole
 }
@@ -172,10 +310,155 @@ type RemoteConfig struct {
 	Payload []byte
 }
 
+// OSUpdateJob is an opaque, update-module-encoded job document.
+type OSUpdateJob struct {
+	Payload []byte
+}
+
+// SelfUpdateState is an opaque, update-module-encoded document.
+type SelfUpdateState struct {
+	Payload []byte
+}
+
+// NotificationConfig is an opaque, notify-module-encoded target list.
+type NotificationConfig struct {
+	Payload []byte
+}
+
+// DeviceIdentity names the device on the local network and in the portal.
+type DeviceIdentity struct {
+	Name      string
+	UpdatedAt time.Time
+}
+
+// SessionPolicy holds the idle timeout and absolute lifetime applied to
+// admin sessions.
+type SessionPolicy struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+	UpdatedAt   time.Time
+}
+
+// NetworkSettings lists the addresses or interfaces the admin listener binds
+// (empty means all) and whether plaintext HTTP is served off loopback.
+type NetworkSettings struct {
+	BindAddresses    []string
+	DisablePlainHTTP bool
+	UpdatedAt        time.Time
+}
+
+// CORSPolicy lists the origins allowed to call the API beyond same-origin,
+// the request headers they may send, and whether credentials are shared.
+// IncludeDeviceHosts also admits the device's mDNS name and remote portal
+// hostname.
+type CORSPolicy struct {
+	AllowedOrigins     []string
+	AllowedHeaders     []string
+	AllowCredentials   bool
+	IncludeDeviceHosts bool
+	UpdatedAt          time.Time
+}
+
+// PortPolicy holds the inclusive host-bind and public port ranges the
+// service allocator draws from, and ports it must never hand out.
+type PortPolicy struct {
+	HostBindStart int
+	HostBindEnd   int
+	PublicStart   int
+	PublicEnd     int
+	ExcludedPorts []int
+	// ConnectionLimits are the default limits on listener proxies; nil
+	// until configured.
+	ConnectionLimits *ConnectionLimits
+	UpdatedAt        time.Time
+}
+
+// MountAllowlist holds the host directories an admin approved for app host
+// mounts.
+type MountAllowlist struct {
+	Paths     []string
+	UpdatedAt time.Time
+}
+
+// AppPolicy holds the modes (allow, confirm or deny) an admin set for the
+// devices, Linux capabilities and host networking apps may declare.
+type AppPolicy struct {
+	Devices     map[string]string `json:"devices"`
+	Linux       map[string]string `json:"linux"`
+	HostNetwork string            `json:"host_network"`
+	UpdatedAt   time.Time         `json:"-"`
+}
+
+// ConnectionLimits bound the connections a listener proxy holds open. Zero
+// fields are unlimited.
+type ConnectionLimits struct {
+	MaxConnections      int           `json:"max_connections"`
+	MaxConnectionsPerIP int           `json:"max_connections_per_ip"`
+	IdleTimeout         time.Duration `json:"idle_timeout_ns"`
+}
+
+// OccupiedPort is a port found bound by another process when the allocator
+// probed it. Range is "host_bind" or "public"; Network is "tcp" or "udp".
+type OccupiedPort struct {
+	Port      int
+	Network   string
+	Range     string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// APIToken is an automation credential. Hash is the hex SHA-256 of the
+// secret; a zero ExpiresAt never expires.
+type APIToken struct {
+	ID         string
+	Name       string
+	Hash       string
+	Scope      string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
 type AppRecord struct {
 	Name string
 }
 
+// ActivityRecord is a single entry in the device activity log.
+type ActivityRecord struct {
+	ID       int64
+	Time     time.Time
+	Source   string
+	Level    string
+	Message  string
+	Metadata map[string]any
+}
+
+// ActivityQuery filters ListActivity results. Records are returned newest
+// first; BeforeID pages backwards from a previously returned ID.
+type ActivityQuery struct {
+	Source   string
+	Level    string
+	Since    time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// ActivityRetention bounds the activity log by row count and age.
+type ActivityRetention struct {
+	MaxRows   int
+	OlderThan time.Time
+}
+
+// ServiceStatsRecord is the persisted cumulative traffic for one app listener.
+type ServiceStatsRecord struct {
+	App              string
+	Listener         string
+	BytesIn          int64
+	BytesOut         int64
+	TotalConnections int64
+	LastActivity     time.Time
+}
+
 type ControlHealthStatus string
 
 const (
@@ -183,6 +466,9 @@ const (
 	ControlHealthStatusDegraded ControlHealthStatus = "degraded"
 	ControlHealthStatusError    ControlHealthStatus = "error"
 	ControlHealthStatusUnknown  ControlHealthStatus = "unknown"
+	// ControlHealthStatusBusy means operations keep failing because another
+	// connection holds the database lock past every retry.
+	ControlHealthStatusBusy ControlHealthStatus = "busy"
 )
 
 type ControlHealthReport struct {
@@ -31,6 +31,9 @@ type Options struct {
 	Dispatcher     *commands.Dispatcher
 	Crypto         *crypt.Manager
 	StateDir       string
+	// AdoptedDisks lists mount points of adopted disks whose free space is
+	// reported alongside the state dir.
+	AdoptedDisks []string
 }
 
 // Module implements the Service interface using pluggable sub-components.
@@ -57,6 +60,8 @@ type Module struct {
 	healthMu           sync.Mutex
 	healthCancel       context.CancelFunc
 	healthInterval     time.Duration
+	space              *spaceMonitor
+	spaceCancel        context.CancelFunc
 }
 
 // Ensure Module satisfies the Service interface.
@@ -94,6 +99,7 @@ func NewService(opts Options) (*Module, error) {
 	if mod.leadership == nil {
 		mod.leadership = cluster.NewRegistry()
 	}
+	mod.space = newSpaceMonitor(stateDir, opts.AdoptedDisks, mod.events)
 	if mod.bootstrap == nil {
 		mod.bootstrap = newNoopBootstrapStore()
 	}
@@ -105,6 +111,10 @@ func NewService(opts Options) (*Module, error) {
 		if err != nil {
 			return nil, err
 		}
+		if sq, ok := store.(*sqliteControlStore); ok {
+			sq.onBusy = mod.onControlBusy
+			sq.role = mod.controlStoreRole
+		}
 		mod.control = newGuardedControlStore(store, func() bool {
 			if mod.leadership == nil {
 				return true
@@ -112,6 +122,9 @@ func NewService(opts Options) (*Module, error) {
 			return mod.leadership.Current(cluster.ResourceKernel) != cluster.RoleFollower
 		}, mod.onControlCommit)
 	}
+	if g, ok := mod.control.(*guardedControlStore); ok {
+		g.space = mod.space.checkWritable
+	}
 	if mod.volumes == nil {
 		if mod.crypto == nil {
 			return nil, ErrCryptoUnavailable
@@ -122,15 +135,13 @@ func NewService(opts Options) (*Module, error) {
 		if fm.bus == nil {
 			fm.bus = mod.events
 		}
+		fm.spaceGate = mod.space.checkWritable
 		fm.setRoleChecker(func(volumeID string, role VolumeRole) bool {
 			if role != VolumeRoleLeader {
 				return true
 			}
 			if volumeID == "control" {
-				if mod.leadership == nil {
-					return false
-				}
-				return mod.leadership.Current(cluster.ResourceKernel) == cluster.RoleLeader
+				return mod.controlStoreRole() == cluster.RoleLeader
 			}
 			return true
 		})
@@ -162,6 +173,7 @@ func NewService(opts Options) (*Module, error) {
 	}
 	mod.startRevisionPoller()
 	mod.startControlHealthMonitor()
+	mod.startSpaceMonitor()
 
 	if opts.Dispatcher != nil {
 		mod.registerHandlers(opts.Dispatcher)
@@ -205,10 +217,8 @@ func (m *Module) attachControlVolume(ctx context.Context) error {
 		return fmt.Errorf("control volume handle unavailable")
 	}
 	role := VolumeRoleLeader
-	if m.leadership != nil {
-		if current := m.leadership.Current(cluster.ResourceKernel); current == cluster.RoleFollower {
-			role = VolumeRoleFollower
-		}
+	if m.controlStoreRole() == cluster.RoleFollower {
+		role = VolumeRoleFollower
 	}
 	attachCtx := context.WithoutCancel(ctx)
 	if err := m.volumes.Attach(attachCtx, m.controlHandle, AttachOptions{Role: role}); err != nil {
@@ -244,6 +254,7 @@ func (m *Module) registerHandlers(dispatcher *commands.Dispatcher) {
 	dispatcher.Register(CommandEnsureVolume, commands.HandlerFunc(m.handleEnsureVolume))
 	dispatcher.Register(CommandAttachVolume, commands.HandlerFunc(m.handleAttachVolume))
 	dispatcher.Register(CommandRecordLockState, commands.HandlerFunc(m.handleRecordLockState))
+	dispatcher.Register(CommandRemoveVolume, commands.HandlerFunc(m.handleRemoveVolume))
 	dispatcher.Register(CommandRunControlExport, commands.HandlerFunc(m.handleRunControlExport))
 	dispatcher.Register(CommandRunFullExport, commands.HandlerFunc(m.handleRunFullExport))
 }
@@ -264,14 +275,28 @@ func (m *Module) observeLeadership() {
 			if !ok {
 				continue
 			}
-			if payload.Resource != cluster.ResourceKernel {
-				continue
+			switch payload.Resource {
+			case cluster.ResourceKernel:
+				log.Printf("INFO: persistence observed control-plane role=%s", payload.Role)
+			case cluster.ResourceControlStore:
+				// The registry is the one authority control volume attaches
+				// and control store writes consult; keep it in step with
+				// whoever announced the change.
+				m.leadership.Set(cluster.ResourceControlStore, payload.Role)
+				log.Printf("INFO: persistence observed control-store role=%s", payload.Role)
 			}
-			log.Printf("INFO: persistence observed control-plane role=%s", payload.Role)
 		}
 	}()
 }
 
+// controlStoreRole is this node's role for the control store.
+func (m *Module) controlStoreRole() cluster.Role {
+	if m.leadership == nil {
+		return cluster.RoleUnknown
+	}
+	return m.leadership.Current(cluster.ResourceControlStore)
+}
+
 func (m *Module) Bootstrap() BootstrapStore {
 	return m.bootstrap
 }
@@ -420,6 +445,34 @@ func (m *Module) runExportWithLock(ctx context.Context, includeBootstrap bool, f
 	return artifact, nil
 }
 
+// runControlExport exports the control plane from a consistent snapshot while
+// the store stays online. Stores or export managers without snapshot support,
+// and a store that is already sealed, fall back to exporting under the lock.
+func (m *Module) runControlExport(ctx context.Context) (ExportArtifact, error) {
+	exporter, canExport := m.exports.(controlSnapshotExporter)
+	snapshots, canSnapshot := m.control.(controlSnapshotter)
+	if canExport && canSnapshot && !m.ControlLocked() {
+		artifact, err := m.exportControlSnapshot(ctx, snapshots, exporter)
+		if !errors.Is(err, ErrNotImplemented) && !errors.Is(err, ErrLocked) {
+			return artifact, err
+		}
+	}
+	return m.runExportWithLock(ctx, false, m.exports.RunControlPlane)
+}
+
+func (m *Module) exportControlSnapshot(ctx context.Context, snapshots controlSnapshotter, exporter controlSnapshotExporter) (ExportArtifact, error) {
+	m.exportMu.Lock()
+	defer m.exportMu.Unlock()
+	snap, err := snapshots.Snapshot(ctx)
+	if err != nil {
+		return ExportArtifact{}, err
+	}
+	// The artifact holds its own copy once the export returns; drop the
+	// snapshot so the volume does not keep a stale duplicate.
+	defer os.Remove(snap.Path)
+	return exporter.RunControlSnapshot(ctx, snap)
+}
+
 // SwapBootstrap allows wiring a real bootstrap store after construction.
 func (m *Module) SwapBootstrap(store BootstrapStore) {
 	if store != nil {
@@ -469,8 +522,14 @@ func (m *Module) SwapConsensus(manager ConsensusManager) {
 	}
 }
 
-// Shutdown terminates sub-components that require cleanup.
+// Shutdown is Close.
 func (m *Module) Shutdown(ctx context.Context) error {
+	return m.Close(ctx)
+}
+
+// Close stops the monitors, checkpoints and closes the control store, and
+// only then detaches the control and bootstrap volumes.
+func (m *Module) Close(ctx context.Context) error {
 	m.commitMu.Lock()
 	if m.pollCancel != nil {
 		m.pollCancel()
@@ -482,9 +541,21 @@ func (m *Module) Shutdown(ctx context.Context) error {
 		m.healthCancel()
 		m.healthCancel = nil
 	}
+	if m.spaceCancel != nil {
+		m.spaceCancel()
+		m.spaceCancel = nil
+	}
 	m.healthMu.Unlock()
+	// A volume remounting after its mount died would race the detaches below.
+	if fm, ok := m.volumes.(*fileVolumeManager); ok {
+		fm.stopRemounts()
+	}
+	var closeErr error
 	if m.control != nil {
-		_ = m.control.Close(ctx)
+		if err := m.control.Close(ctx); err != nil {
+			log.Printf("WARN: persistence failed to close control store: %v", err)
+			closeErr = err
+		}
 	}
 	if err := m.detachVolumeIfMounted(ctx, m.controlHandle); err != nil {
 		log.Printf("WARN: persistence failed to detach control volume: %v", err)
@@ -493,7 +564,7 @@ func (m *Module) Shutdown(ctx context.Context) error {
 		log.Printf("WARN: persistence failed to detach bootstrap volume: %v", err)
 	}
 	// Other sub-components expose explicit Stop methods when implemented.
-	return nil
+	return closeErr
 }
 
 func (m *Module) detachVolumeIfMounted(ctx context.Context, handle VolumeHandle) error {
@@ -562,6 +633,28 @@ func (m *Module) revisionSource() revisionReporter {
 	return nil
 }
 
+// onControlBusy publishes a busy control health report when operations
+// start giving up on a locked database, and a fresh check once one
+// succeeds again. The store may hold its lock here, so the check runs
+// apart.
+func (m *Module) onControlBusy(err error) {
+	if m.events == nil {
+		return
+	}
+	if err == nil {
+		go m.runControlHealth(m.controlHealthSource())
+		return
+	}
+	m.events.Publish(events.Event{
+		Topic: events.TopicControlHealth,
+		Payload: ControlHealthReport{
+			Status:    ControlHealthStatusBusy,
+			Message:   err.Error(),
+			CheckedAt: time.Now().UTC(),
+		},
+	})
+}
+
 func (m *Module) onControlCommit(ctx context.Context) {
 	rep := m.revisionSource()
 	if rep == nil {
@@ -699,3 +792,32 @@ func (m *Module) runControlHealth(rep healthReporter) {
 		Payload: report,
 	})
 }
+
+// startSpaceMonitor samples free space now and then every minute. The first
+// sample runs after the core volumes exist so a full disk cannot keep them
+// from being created at boot.
+func (m *Module) startSpaceMonitor() {
+	if m.space == nil {
+		return
+	}
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	if m.spaceCancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.spaceCancel = cancel
+	go m.space.run(ctx, defaultSpaceInterval)
+}
+
+// StorageUsage returns the latest free-space sample of the state dir, every
+// volume's ciphertext and adopted disks.
+func (m *Module) StorageUsage(ctx context.Context) (StorageUsage, error) {
+	if m.space == nil {
+		return StorageUsage{}, ErrNotImplemented
+	}
+	if err := ctx.Err(); err != nil {
+		return StorageUsage{}, err
+	}
+	return m.space.Usage(), nil
+}
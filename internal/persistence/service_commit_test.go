@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"testing"
 	"time"
 
@@ -103,3 +104,57 @@ func TestModulePublishesControlHealth(t *testing.T) {
 		t.Fatalf("timed out waiting for control health event")
 	}
 }
+
+func TestControlStoreRefusesWritesWhileFollower(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	prepareControlCipherDir(t, dir)
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	if err := store.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	bus := events.NewBus()
+	mod := &Module{events: bus, leadership: cluster.NewRegistry()}
+	store.role = mod.controlStoreRole
+	mod.observeLeadership()
+	ctx := context.Background()
+	setRole := func(role cluster.Role) {
+		t.Helper()
+		bus.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: cluster.ResourceControlStore, Role: role}})
+		deadline := time.Now().Add(time.Second)
+		for mod.controlStoreRole() != role {
+			if time.Now().After(deadline) {
+				t.Fatalf("role %s not observed", role)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	setRole(cluster.RoleFollower)
+	if err := store.Auth().SetInitialized(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader while follower, got %v", err)
+	}
+	if err := store.Auth().SavePasswordHash(ctx, "hash"); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader while follower, got %v", err)
+	}
+	if rev, _, err := store.Revision(ctx); err != nil || rev != 0 {
+		t.Fatalf("follower window wrote data: revision %d (%v)", rev, err)
+	}
+	if initialized, err := store.Auth().IsInitialized(ctx); err != nil || initialized {
+		t.Fatalf("reads should keep working while follower: %v %v", initialized, err)
+	}
+
+	setRole(cluster.RoleLeader)
+	if err := store.Auth().SetInitialized(ctx); err != nil {
+		t.Fatalf("write after promotion: %v", err)
+	}
+	if rev, _, err := store.Revision(ctx); err != nil || rev != 1 {
+		t.Fatalf("expected revision 1 after promotion, got %d (%v)", rev, err)
+	}
+}
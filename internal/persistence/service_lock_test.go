@@ -97,6 +97,58 @@ func (s *stubLockableControl) AppState() AppStateRepo {
 	return nil
 }
 
+func (s *stubLockableControl) Activity() ActivityRepo {
+	return nil
+}
+
+func (s *stubLockableControl) ServiceStats() ServiceStatsRepo {
+	return nil
+}
+
+func (s *stubLockableControl) OSUpdates() OSUpdateRepo {
+	return nil
+}
+
+func (s *stubLockableControl) SelfUpdate() SelfUpdateRepo {
+	return nil
+}
+
+func (s *stubLockableControl) Notifications() NotificationRepo {
+	return nil
+}
+
+func (s *stubLockableControl) Identity() IdentityRepo {
+	return nil
+}
+
+func (s *stubLockableControl) SessionPolicy() SessionPolicyRepo {
+	return nil
+}
+
+func (s *stubLockableControl) NetworkSettings() NetworkSettingsRepo {
+	return nil
+}
+
+func (s *stubLockableControl) CORSPolicy() CORSPolicyRepo {
+	return nil
+}
+
+func (s *stubLockableControl) PortPolicy() PortPolicyRepo {
+	return nil
+}
+
+func (s *stubLockableControl) MountAllowlist() MountAllowlistRepo {
+	return nil
+}
+
+func (s *stubLockableControl) AppPolicy() AppPolicyRepo {
+	return nil
+}
+
+func (s *stubLockableControl) APITokens() APITokenRepo {
+	return nil
+}
+
 func (s *stubLockableControl) Close(context.Context) error {
 	return nil
 }
@@ -137,6 +189,10 @@ func (s *stubVolumeManager) Detach(ctx context.Context, handle VolumeHandle) err
 	return nil
 }
 
+func (s *stubVolumeManager) Remove(ctx context.Context, handle VolumeHandle) (VolumeRemoval, error) {
+	return VolumeRemoval{ID: handle.ID}, nil
+}
+
 func (s *stubVolumeManager) RoleStream(id string) (<-chan VolumeRole, error) {
 	if s.onStream != nil {
 		return s.onStream(id)
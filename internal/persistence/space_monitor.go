@@ -0,0 +1,312 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"piccolod/internal/events"
+)
+
+// minFreeBytesEnv overrides the free-space floor below which the control
+// store and volume manager refuse writes.
+const minFreeBytesEnv = "PICCOLO_STORAGE_MIN_FREE_BYTES"
+
+const (
+	defaultMinFreeBytes  uint64 = 256 << 20
+	spaceWarnPercent            = 85
+	spaceErrorPercent           = 95
+	defaultSpaceInterval        = time.Minute
+	// dirSizeTTL is how long a measured ciphertext size is reused before the
+	// directory is walked again.
+	dirSizeTTL = 10 * time.Minute
+)
+
+// SpaceStatus grades how full a filesystem is.
+type SpaceStatus string
+
+const (
+	SpaceStatusOK    SpaceStatus = "ok"
+	SpaceStatusWarn  SpaceStatus = "warn"
+	SpaceStatusError SpaceStatus = "error"
+)
+
+// Kinds of monitored paths.
+const (
+	SpaceKindStateRoot  = "state_root"
+	SpaceKindCiphertext = "ciphertext"
+	SpaceKindDisk       = "disk"
+)
+
+// FilesystemStat is what statfs reports for the filesystem holding a path.
+// AvailableBytes is what an unprivileged writer may still use.
+type FilesystemStat struct {
+	TotalBytes     uint64
+	FreeBytes      uint64
+	AvailableBytes uint64
+}
+
+type statfsFunc func(path string) (FilesystemStat, error)
+
+func statFilesystem(path string) (FilesystemStat, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return FilesystemStat{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return FilesystemStat{TotalBytes: st.Blocks * bsize, FreeBytes: st.Bfree * bsize, AvailableBytes: st.Bavail * bsize}, nil
+}
+
+// VolumeUsage is the space picture of one monitored path: the state root,
+// a volume's ciphertext directory, or an adopted disk.
+type VolumeUsage struct {
+	Name           string  `json:"name"`
+	Kind           string  `json:"kind"`
+	Path           string  `json:"path"`
+	App            string  `json:"app,omitempty"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	UsedBytes      uint64  `json:"used_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+	// SizeBytes is the size of a ciphertext directory; it may be up to
+	// dirSizeTTL old.
+	SizeBytes int64       `json:"size_bytes,omitempty"`
+	Status    SpaceStatus `json:"status"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// StorageUsage is one sample of every monitored path. RefusingWrites is set
+// while the state root or a ciphertext directory has less than MinFreeBytes
+// available.
+type StorageUsage struct {
+	Status         SpaceStatus   `json:"status"`
+	Message        string        `json:"message"`
+	Volumes        []VolumeUsage `json:"volumes"`
+	MinFreeBytes   uint64        `json:"min_free_bytes"`
+	RefusingWrites bool          `json:"refusing_writes"`
+	CheckedAt      time.Time     `json:"checked_at"`
+}
+
+// minFreeBytesFromEnv returns the free-space floor, minFreeBytesEnv or the
+// default.
+func minFreeBytesFromEnv() uint64 {
+	v := strings.TrimSpace(os.Getenv(minFreeBytesEnv))
+	if v == "" {
+		return defaultMinFreeBytes
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		log.Printf("WARN: persistence: ignoring %s=%q; using %d", minFreeBytesEnv, v, defaultMinFreeBytes)
+		return defaultMinFreeBytes
+	}
+	return n
+}
+
+// spaceMonitor samples free space under the state root and keeps the last
+// sample, which gates control store and volume writes.
+type spaceMonitor struct {
+	root    string
+	disks   []string
+	statfs  statfsFunc
+	minFree uint64
+	bus     *events.Bus
+	now     func() time.Time
+
+	mu      sync.Mutex
+	last    StorageUsage
+	sampled bool
+	sizes   map[string]cachedSize
+}
+
+type cachedSize struct {
+	bytes int64
+	at    time.Time
+}
+
+func newSpaceMonitor(root string, disks []string, bus *events.Bus) *spaceMonitor {
+	return &spaceMonitor{
+		root:    root,
+		disks:   append([]string(nil), disks...),
+		statfs:  statFilesystem,
+		minFree: minFreeBytesFromEnv(),
+		bus:     bus,
+		now:     func() time.Time { return time.Now().UTC() },
+		sizes:   make(map[string]cachedSize),
+	}
+}
+
+// Usage returns the last sample, taking one first if none exists yet.
+func (s *spaceMonitor) Usage() StorageUsage {
+	s.mu.Lock()
+	last, ok := s.last, s.sampled
+	s.mu.Unlock()
+	if ok {
+		return last
+	}
+	return s.Sample()
+}
+
+// checkWritable returns ErrNoSpace while the last sample refuses writes.
+func (s *spaceMonitor) checkWritable() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.last.RefusingWrites {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNoSpace, s.last.Message)
+}
+
+// Sample measures every monitored path, stores the result and publishes it.
+func (s *spaceMonitor) Sample() StorageUsage {
+	now := s.now()
+	usage := StorageUsage{Status: SpaceStatusOK, MinFreeBytes: s.minFree, CheckedAt: now}
+	usage.Volumes = append(usage.Volumes, s.measure("state", SpaceKindStateRoot, s.root, ""))
+	for _, id := range s.ciphertextIDs() {
+		app := ""
+		if name, ok := strings.CutPrefix(id, "app-"); ok {
+			app = name
+		}
+		vol := s.measure(id, SpaceKindCiphertext, filepath.Join(s.root, "ciphertext", id), app)
+		if vol.Error == "" {
+			vol.SizeBytes = s.cachedDirSize(vol.Path, now)
+		}
+		usage.Volumes = append(usage.Volumes, vol)
+	}
+	for _, disk := range s.disks {
+		usage.Volumes = append(usage.Volumes, s.measure(filepath.Base(disk), SpaceKindDisk, disk, ""))
+	}
+
+	var worst *VolumeUsage
+	for i := range usage.Volumes {
+		vol := &usage.Volumes[i]
+		if vol.Kind != SpaceKindDisk && vol.Error == "" && vol.AvailableBytes < s.minFree {
+			usage.RefusingWrites = true
+		}
+		if worst == nil || spaceStatusRank(vol.Status) > spaceStatusRank(worst.Status) {
+			worst = vol
+		}
+	}
+	switch {
+	case usage.RefusingWrites:
+		usage.Status = SpaceStatusError
+		usage.Message = fmt.Sprintf("less than %d bytes free under the state dir; refusing writes", s.minFree)
+	case worst != nil && worst.Status != SpaceStatusOK:
+		usage.Status = worst.Status
+		if worst.Error != "" {
+			usage.Message = fmt.Sprintf("%s: %s", worst.Path, worst.Error)
+		} else {
+			usage.Message = fmt.Sprintf("%s is %.0f%% full", worst.Path, worst.UsedPercent)
+		}
+	default:
+		usage.Message = "storage space ok"
+	}
+
+	s.mu.Lock()
+	wasRefusing := s.last.RefusingWrites
+	s.last, s.sampled = usage, true
+	s.mu.Unlock()
+	if usage.RefusingWrites != wasRefusing {
+		if usage.RefusingWrites {
+			log.Printf("ERROR: persistence: %s", usage.Message)
+		} else {
+			log.Printf("INFO: persistence: free space recovered; accepting writes again")
+		}
+	}
+	if s.bus != nil {
+		s.bus.Publish(events.Event{Topic: events.TopicStorageSpace, Payload: usage})
+	}
+	return usage
+}
+
+func (s *spaceMonitor) measure(name, kind, path, app string) VolumeUsage {
+	vol := VolumeUsage{Name: name, Kind: kind, Path: path, App: app, Status: SpaceStatusOK}
+	st, err := s.statfs(path)
+	if err != nil {
+		vol.Status = SpaceStatusWarn
+		vol.Error = err.Error()
+		return vol
+	}
+	vol.TotalBytes = st.TotalBytes
+	vol.AvailableBytes = st.AvailableBytes
+	if st.TotalBytes > st.FreeBytes {
+		vol.UsedBytes = st.TotalBytes - st.FreeBytes
+	}
+	// Like df, reserved blocks count as neither used nor available.
+	if capacity := vol.UsedBytes + st.AvailableBytes; capacity > 0 {
+		vol.UsedPercent = float64(vol.UsedBytes) * 100 / float64(capacity)
+	}
+	switch {
+	case vol.UsedPercent >= spaceErrorPercent:
+		vol.Status = SpaceStatusError
+	case vol.UsedPercent >= spaceWarnPercent:
+		vol.Status = SpaceStatusWarn
+	}
+	return vol
+}
+
+func (s *spaceMonitor) ciphertextIDs() []string {
+	entries, err := os.ReadDir(filepath.Join(s.root, "ciphertext"))
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// cachedDirSize returns the bytes under path, walking it at most once per
+// dirSizeTTL.
+func (s *spaceMonitor) cachedDirSize(path string, now time.Time) int64 {
+	s.mu.Lock()
+	cached, ok := s.sizes[path]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.at) < dirSizeTTL {
+		return cached.bytes
+	}
+	size := DirSize(path)
+	s.mu.Lock()
+	s.sizes[path] = cachedSize{bytes: size, at: now}
+	s.mu.Unlock()
+	return size
+}
+
+func spaceStatusRank(status SpaceStatus) int {
+	switch status {
+	case SpaceStatusError:
+		return 2
+	case SpaceStatusWarn:
+		return 1
+	}
+	return 0
+}
+
+func (s *spaceMonitor) run(ctx context.Context, interval time.Duration) {
+	s.Sample()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sample()
+		}
+	}
+}
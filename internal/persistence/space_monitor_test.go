@@ -0,0 +1,180 @@
+package persistence
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+)
+
+// fakeStatfs answers every path with the same configurable numbers.
+type fakeStatfs struct {
+	mu sync.Mutex
+	st FilesystemStat
+}
+
+func (f *fakeStatfs) set(total, avail uint64) {
+	f.mu.Lock()
+	f.st = FilesystemStat{TotalBytes: total, FreeBytes: avail, AvailableBytes: avail}
+	f.mu.Unlock()
+}
+
+func (f *fakeStatfs) stat(string) (FilesystemStat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.st, nil
+}
+
+func newTestSpaceMonitor(t *testing.T, root string, bus *events.Bus) (*spaceMonitor, *fakeStatfs) {
+	t.Helper()
+	fs := &fakeStatfs{}
+	fs.set(1000<<20, 900<<20)
+	mon := newSpaceMonitor(root, nil, bus)
+	mon.statfs = fs.stat
+	mon.minFree = 64 << 20
+	return mon, fs
+}
+
+func TestSpaceMonitor_Thresholds(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "ciphertext", "app-blog"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "ciphertext", "app-blog", "blob"), make([]byte, 4096), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	mon, fs := newTestSpaceMonitor(t, root, nil)
+
+	cases := []struct {
+		avail uint64
+		want  SpaceStatus
+	}{
+		{avail: 200 << 20, want: SpaceStatusOK},
+		{avail: 150 << 20, want: SpaceStatusWarn},
+		{avail: 50 << 20, want: SpaceStatusError},
+	}
+	for _, tc := range cases {
+		fs.set(1000<<20, tc.avail)
+		usage := mon.Sample()
+		if usage.Status != tc.want {
+			t.Fatalf("avail %d: expected %s, got %s (%s)", tc.avail, tc.want, usage.Status, usage.Message)
+		}
+	}
+
+	usage := mon.Usage()
+	if len(usage.Volumes) != 2 {
+		t.Fatalf("expected state root and one ciphertext dir, got %+v", usage.Volumes)
+	}
+	vol := usage.Volumes[1]
+	if vol.Kind != SpaceKindCiphertext || vol.App != "blog" || vol.SizeBytes != 4096 {
+		t.Fatalf("unexpected ciphertext usage %+v", vol)
+	}
+}
+
+func TestSpaceMonitor_RefusesWritesBelowFloor(t *testing.T) {
+	bus := events.NewBus()
+	ch := bus.Subscribe(events.TopicStorageSpace, 4)
+	mon, fs := newTestSpaceMonitor(t, t.TempDir(), bus)
+
+	if err := mon.checkWritable(); err != nil {
+		t.Fatalf("expected writes allowed before the first sample, got %v", err)
+	}
+	fs.set(1000<<20, 32<<20)
+	if usage := mon.Sample(); !usage.RefusingWrites {
+		t.Fatalf("expected refusing writes, got %+v", usage)
+	}
+	if err := mon.checkWritable(); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace, got %v", err)
+	}
+	select {
+	case evt := <-ch:
+		usage, ok := evt.Payload.(StorageUsage)
+		if !ok || !usage.RefusingWrites {
+			t.Fatalf("unexpected event payload %#v", evt.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected storage space event")
+	}
+
+	fs.set(1000<<20, 500<<20)
+	mon.Sample()
+	if err := mon.checkWritable(); err != nil {
+		t.Fatalf("expected writes allowed after recovery, got %v", err)
+	}
+}
+
+func TestSpaceMonitor_GatesControlAndVolumeWrites(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	key, _ := hex.DecodeString("7f1c8a6c3b5d7e91aabbccddeeff00112233445566778899aabbccddeeff0011")
+	store, err := newSQLiteControlStore(dir, staticKeyProvider{key: key})
+	if err != nil {
+		t.Fatalf("newSQLiteControlStore: %v", err)
+	}
+	defer store.Close(context.Background())
+	prepareControlCipherDir(t, dir)
+	if err := store.Unlock(context.Background()); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	mon, fs := newTestSpaceMonitor(t, dir, nil)
+	guard := newGuardedControlStore(store, func() bool { return true }, nil).(*guardedControlStore)
+	guard.space = mon.checkWritable
+	vm := newFileVolumeManager(dir, nil, nil)
+	vm.spaceGate = mon.checkWritable
+
+	fs.set(1000<<20, 16<<20)
+	mon.Sample()
+	if err := guard.Auth().SetInitialized(context.Background()); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace on SetInitialized, got %v", err)
+	}
+	if err := guard.AppState().UpsertApp(context.Background(), AppRecord{Name: "a"}); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace on UpsertApp, got %v", err)
+	}
+	if _, err := vm.EnsureVolume(context.Background(), VolumeRequest{ID: "app-new"}); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace on EnsureVolume, got %v", err)
+	}
+	if _, err := guard.Auth().IsInitialized(context.Background()); err != nil {
+		t.Fatalf("reads should still work while refusing writes: %v", err)
+	}
+
+	fs.set(1000<<20, 500<<20)
+	mon.Sample()
+	if err := guard.Auth().SetInitialized(context.Background()); err != nil {
+		t.Fatalf("SetInitialized after recovery: %v", err)
+	}
+}
+
+func TestFileExportManager_RefusesWithoutRoom(t *testing.T) {
+	root := t.TempDir()
+	cipherDir := filepath.Join(root, "ciphertext", "control")
+	if err := os.MkdirAll(cipherDir, 0o700); err != nil {
+		t.Fatalf("mkdir control ciphertext: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cipherDir, "control.db"), make([]byte, 3000), 0o600); err != nil {
+		t.Fatalf("write db: %v", err)
+	}
+	fs := &fakeStatfs{}
+	mgr := newFileExportManager(root)
+	mgr.statfs = fs.stat
+	mgr.minFree = 1000
+
+	fs.set(1<<20, 7000+999)
+	if _, err := mgr.RunControlPlane(context.Background()); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace, got %v", err)
+	}
+	if _, err := os.Stat(mgr.controlDest()); !os.IsNotExist(err) {
+		t.Fatalf("expected no export written, stat err %v", err)
+	}
+
+	fs.set(1<<20, 8000)
+	if _, err := mgr.RunControlPlane(context.Background()); err != nil {
+		t.Fatalf("export with room: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyRetryAttempts bounds how often a statement or transaction runs while
+// SQLite reports the database busy; the waits between runs double from
+// busyRetryBase.
+const (
+	busyRetryAttempts = 5
+	busyRetryBase     = 25 * time.Millisecond
+)
+
+// isBusyError reports whether err is SQLite refusing an operation because
+// another connection holds a conflicting lock.
+func isBusyError(err error) bool {
+	var sqErr *sqlite.Error
+	if !errors.As(err, &sqErr) {
+		return false
+	}
+	switch sqErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+// retryBusy runs fn until it succeeds, fails with something other than a
+// busy error, or runs out of attempts. The busy_timeout pragma only applies
+// to the pooled connection it ran on and does not cover every lock upgrade,
+// so each statement or transaction against the database goes through here.
+func (s *sqliteControlStore) retryBusy(ctx context.Context, fn func() error) error {
+	wait := s.busyBase
+	if wait <= 0 {
+		wait = busyRetryBase
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !isBusyError(err) {
+			return err
+		}
+		if attempt >= busyRetryAttempts {
+			s.noteBusy(err)
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// retryWrite is retryBusy for operations that take the write lock; one
+// succeeding ends a busy condition. Reads go on succeeding in WAL mode
+// while writers are shut out, so they do not.
+func (s *sqliteControlStore) retryWrite(ctx context.Context, fn func() error) error {
+	err := s.retryBusy(ctx, fn)
+	if err == nil {
+		s.noteBusy(nil)
+	}
+	return err
+}
+
+// noteBusy records whether the last operation gave up on a busy database
+// and tells onBusy when that starts or stops being the case.
+func (s *sqliteControlStore) noteBusy(err error) {
+	s.busyMu.Lock()
+	was := s.busyErr != nil
+	s.busyErr = err
+	hook := s.onBusy
+	s.busyMu.Unlock()
+	if was == (err != nil) {
+		return
+	}
+	if err != nil {
+		log.Printf("WARN: control-store: database still busy after %d attempts: %v", busyRetryAttempts, err)
+	} else {
+		log.Printf("INFO: control-store: database no longer busy")
+	}
+	if hook != nil {
+		hook(err)
+	}
+}
+
+// busyError returns the error of the last operation that gave up on a busy
+// database, or nil once an operation has succeeded since.
+func (s *sqliteControlStore) busyError() error {
+	s.busyMu.Lock()
+	defer s.busyMu.Unlock()
+	return s.busyErr
+}
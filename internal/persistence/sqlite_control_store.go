@@ -19,6 +19,7 @@ import (
 	"golang.org/x/sys/unix"
 	_ "modernc.org/sqlite"
 
+	"piccolod/internal/cluster"
 	"piccolod/internal/state/paths"
 )
 
@@ -48,6 +49,7 @@ type controlPayload struct {
 	RecoveryStale   bool          `json:"recovery_stale,omitempty"`
 	RecoveryStaleAt string        `json:"recovery_stale_at,omitempty"`
 	RecoveryAckAt   string        `json:"recovery_ack_at,omitempty"`
+	SetupCompleted  string        `json:"setup_completed_at,omitempty"`
 	Revision        uint64        `json:"revision"`
 	Checksum        string        `json:"checksum"`
 }
@@ -65,6 +67,18 @@ type sqliteControlStore struct {
 	checkpointInterval time.Duration
 	lastCheckpoint     time.Time
 	state              controlState
+
+	// busyBase overrides busyRetryBase. busyErr is set while operations
+	// give up on a busy database; onBusy hears when that starts (non-nil)
+	// and stops (nil).
+	busyBase time.Duration
+	busyMu   sync.Mutex
+	busyErr  error
+	onBusy   func(error)
+
+	// role reports this node's role for cluster.ResourceControlStore; nil
+	// treats the node as leader.
+	role func() cluster.Role
 }
 
 type keyProvider interface {
@@ -82,6 +96,7 @@ type controlState struct {
 	recoveryStale   bool
 	recoveryStaleAt time.Time
 	recoveryAckAt   time.Time
+	setupCompleted  time.Time
 	revision        uint64
 	checksum        string
 }
@@ -199,6 +214,101 @@ func applyMigrations(db *sql.DB) error {
 			payload BLOB NOT NULL,
 			updated_at TEXT NOT NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS activity (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			level TEXT NOT NULL,
+			message TEXT NOT NULL,
+			metadata BLOB
+		);`,
+		`CREATE INDEX IF NOT EXISTS activity_ts ON activity (ts);`,
+		`CREATE TABLE IF NOT EXISTS service_stats (
+			app TEXT NOT NULL,
+			listener TEXT NOT NULL,
+			bytes_in INTEGER NOT NULL DEFAULT 0,
+			bytes_out INTEGER NOT NULL DEFAULT 0,
+			total_conns INTEGER NOT NULL DEFAULT 0,
+			last_activity INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (app, listener)
+		);`,
+		`CREATE TABLE IF NOT EXISTS os_update_job (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			payload BLOB NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS self_update (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			payload BLOB NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS notification_config (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			payload BLOB NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS device_identity (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			name TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS session_policy (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			idle_timeout_seconds INTEGER NOT NULL,
+			max_lifetime_seconds INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS network_settings (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			bind_addresses TEXT NOT NULL,
+			disable_plain_http INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS cors_policy (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			allowed_origins TEXT NOT NULL,
+			allowed_headers TEXT NOT NULL,
+			allow_credentials INTEGER NOT NULL,
+			include_device_hosts INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS port_policy (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			host_bind_start INTEGER NOT NULL,
+			host_bind_end INTEGER NOT NULL,
+			public_start INTEGER NOT NULL,
+			public_end INTEGER NOT NULL,
+			excluded_ports TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			connection_limits TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS occupied_ports (
+			port INTEGER NOT NULL,
+			network TEXT NOT NULL,
+			range_name TEXT NOT NULL,
+			first_seen TEXT NOT NULL,
+			last_seen TEXT NOT NULL,
+			PRIMARY KEY (port, network)
+		);`,
+		`CREATE TABLE IF NOT EXISTS mount_allowlist (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			paths TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS app_policy (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			policy TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scope TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL DEFAULT '',
+			last_used_at TEXT NOT NULL DEFAULT ''
+		);`,
 		`INSERT INTO meta (id, revision, checksum, updated_at)
 			VALUES (1, 0, '', '')
 			ON CONFLICT(id) DO NOTHING;`,
@@ -215,6 +325,9 @@ func applyMigrations(db *sql.DB) error {
 	if err := ensureAuthStateColumns(tx); err != nil {
 		return err
 	}
+	if err := ensurePortPolicyColumns(tx); err != nil {
+		return err
+	}
 	err = tx.Commit()
 	return err
 }
@@ -266,34 +379,91 @@ func ensureAuthStateColumns(tx *sql.Tx) error {
 	if err := addColumn("recovery_ack_at", "TEXT NOT NULL DEFAULT ''"); err != nil {
 		return err
 	}
+	if err := addColumn("setup_completed_at", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (s *sqliteControlStore) Close(ctx context.Context) error {
-	_ = ctx
-	s.Lock()
-	if s.db != nil {
-		err := s.db.Close()
-		s.db = nil
+// ensurePortPolicyColumns adds the columns port_policy gained after it was
+// first created.
+func ensurePortPolicyColumns(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA table_info(port_policy);`)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, "connection_limits") {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`ALTER TABLE port_policy ADD COLUMN connection_limits TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// Close folds the WAL back into the database and closes it, so the volume
+// can be detached and opened read-only elsewhere without a log to replay.
+func (s *sqliteControlStore) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db != nil && !s.readOnly {
+		if err := s.checkpointTruncateLocked(ctx); err != nil {
+			log.Printf("WARN: control-store: checkpoint on close failed: %v", err)
+		}
+	}
+	return s.lockLocked()
+}
+
+// checkpointTruncateLocked copies the whole WAL into the database and
+// truncates it. SQLite reports a checkpoint blocked by a reader as busy in
+// the result row rather than as an error.
+func (s *sqliteControlStore) checkpointTruncateLocked(ctx context.Context) error {
+	return s.retryBusy(ctx, func() error {
+		var busy, logFrames, checkpointed int
+		if err := s.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+			return err
+		}
+		if busy != 0 {
+			return fmt.Errorf("wal checkpoint incomplete: %d of %d frames copied", checkpointed, logFrames)
+		}
+		return nil
+	})
 }
 
 func (s *sqliteControlStore) Lock() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	_ = s.lockLocked()
+}
+
+func (s *sqliteControlStore) lockLocked() error {
 	s.loaded = false
 	s.state = controlState{apps: make(map[string]AppRecord)}
 	s.readOnly = false
-	if s.db != nil {
-		_ = s.db.Close()
-		s.db = nil
+	if s.db == nil {
+		return nil
 	}
+	err := s.db.Close()
+	s.db = nil
+	return err
 }
 
 func (s *sqliteControlStore) Unlock(ctx context.Context) error {
-	_ = ctx
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.loaded {
@@ -316,8 +486,12 @@ func (s *sqliteControlStore) Unlock(ctx context.Context) error {
 	if err := s.openDB(); err != nil {
 		return err
 	}
-	state, err := s.loadState()
-	if err != nil {
+	var state controlState
+	if err := s.retryBusy(ctx, func() error {
+		var err error
+		state, err = s.loadState()
+		return err
+	}); err != nil {
 		return err
 	}
 	s.state = state
@@ -355,9 +529,10 @@ func (s *sqliteControlStore) loadState() (controlState, error) {
 		recoveryStaleInt sql.NullInt64
 		recoveryStaleAt  sql.NullString
 		recoveryAckAt    sql.NullString
+		setupCompletedAt sql.NullString
 		authUpdated      string
 	)
-	err = s.db.QueryRow(`SELECT initialized, password_hash, password_stale, password_stale_at, password_ack_at, recovery_stale, recovery_stale_at, recovery_ack_at, updated_at FROM auth_state WHERE id=1`).Scan(
+	err = s.db.QueryRow(`SELECT initialized, password_hash, password_stale, password_stale_at, password_ack_at, recovery_stale, recovery_stale_at, recovery_ack_at, setup_completed_at, updated_at FROM auth_state WHERE id=1`).Scan(
 		&initInt,
 		&passwordHash,
 		&passwordStaleInt,
@@ -366,6 +541,7 @@ func (s *sqliteControlStore) loadState() (controlState, error) {
 		&recoveryStaleInt,
 		&recoveryStaleAt,
 		&recoveryAckAt,
+		&setupCompletedAt,
 		&authUpdated,
 	)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
@@ -393,6 +569,9 @@ func (s *sqliteControlStore) loadState() (controlState, error) {
 	if v := strings.TrimSpace(recoveryAckAt.String); v != "" {
 		state.recoveryAckAt = parseTimestamp(v)
 	}
+	if v := strings.TrimSpace(setupCompletedAt.String); v != "" {
+		state.setupCompleted = parseTimestamp(v)
+	}
 
 	var payload []byte
 	var remoteUpdated string
@@ -451,38 +630,83 @@ func (s *sqliteControlStore) QuickCheck(ctx context.Context) (ControlHealthRepor
 	if err := s.openDB(); err != nil {
 		return ControlHealthReport{Status: ControlHealthStatusError, Message: err.Error(), CheckedAt: now}, err
 	}
-	rows, err := s.db.QueryContext(ctx, "PRAGMA quick_check")
-	if err != nil {
-		return ControlHealthReport{Status: ControlHealthStatusError, Message: err.Error(), CheckedAt: now}, err
-	}
-	defer rows.Close()
 	var issues []string
-	for rows.Next() {
-		var line string
-		if err := rows.Scan(&line); err != nil {
-			return ControlHealthReport{Status: ControlHealthStatusError, Message: err.Error(), CheckedAt: now}, err
-		}
-		if strings.EqualFold(strings.TrimSpace(line), "ok") {
-			continue
+	err := s.retryBusy(ctx, func() error {
+		issues = nil
+		rows, err := s.db.QueryContext(ctx, "PRAGMA quick_check")
+		if err != nil {
+			return err
 		}
-		if trimmed := strings.TrimSpace(line); trimmed != "" {
-			issues = append(issues, trimmed)
+		defer rows.Close()
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			if strings.EqualFold(strings.TrimSpace(line), "ok") {
+				continue
+			}
+			if trimmed := strings.TrimSpace(line); trimmed != "" {
+				issues = append(issues, trimmed)
+			}
 		}
-	}
-	if err := rows.Err(); err != nil {
+		return rows.Err()
+	})
+	if err != nil {
 		return ControlHealthReport{Status: ControlHealthStatusError, Message: err.Error(), CheckedAt: now}, err
 	}
-	if len(issues) == 0 {
-		return ControlHealthReport{Status: ControlHealthStatusOK, Message: "ok", CheckedAt: now}, nil
+	if len(issues) > 0 {
+		return ControlHealthReport{Status: ControlHealthStatusDegraded, Message: strings.Join(issues, "; "), CheckedAt: now}, nil
 	}
-	return ControlHealthReport{Status: ControlHealthStatusDegraded, Message: strings.Join(issues, "; "), CheckedAt: now}, nil
+	if busy := s.busyError(); busy != nil {
+		return ControlHealthReport{Status: ControlHealthStatusBusy, Message: busy.Error(), CheckedAt: now}, nil
+	}
+	return ControlHealthReport{Status: ControlHealthStatusOK, Message: "ok", CheckedAt: now}, nil
 }
 
 func (s *sqliteControlStore) Auth() AuthRepo         { return &sqliteAuthRepo{store: s} }
 func (s *sqliteControlStore) Remote() RemoteRepo     { return &sqliteRemoteRepo{store: s} }
 func (s *sqliteControlStore) AppState() AppStateRepo { return &sqliteAppStateRepo{store: s} }
+func (s *sqliteControlStore) Activity() ActivityRepo { return &sqliteActivityRepo{store: s} }
+func (s *sqliteControlStore) ServiceStats() ServiceStatsRepo {
+	return &sqliteServiceStatsRepo{store: s}
+}
+func (s *sqliteControlStore) OSUpdates() OSUpdateRepo    { return &sqliteOSUpdateRepo{store: s} }
+func (s *sqliteControlStore) SelfUpdate() SelfUpdateRepo { return &sqliteSelfUpdateRepo{store: s} }
+func (s *sqliteControlStore) Notifications() NotificationRepo {
+	return &sqliteNotificationRepo{store: s}
+}
+func (s *sqliteControlStore) Identity() IdentityRepo { return &sqliteIdentityRepo{store: s} }
+func (s *sqliteControlStore) SessionPolicy() SessionPolicyRepo {
+	return &sqliteSessionPolicyRepo{store: s}
+}
+func (s *sqliteControlStore) NetworkSettings() NetworkSettingsRepo {
+	return &sqliteNetworkSettingsRepo{store: s}
+}
+func (s *sqliteControlStore) CORSPolicy() CORSPolicyRepo {
+	return &sqliteCORSPolicyRepo{store: s}
+}
+func (s *sqliteControlStore) PortPolicy() PortPolicyRepo {
+	return &sqlitePortPolicyRepo{store: s}
+}
+
+func (s *sqliteControlStore) MountAllowlist() MountAllowlistRepo {
+	return &sqliteMountAllowlistRepo{store: s}
+}
+
+func (s *sqliteControlStore) AppPolicy() AppPolicyRepo {
+	return &sqliteAppPolicyRepo{store: s}
+}
+
+func (s *sqliteControlStore) APITokens() APITokenRepo {
+	return &sqliteAPITokenRepo{store: s}
+}
 
 func (s *sqliteControlStore) ensureWritableLocked() error {
+	// A follower never writes, even if its volume was mounted read-write.
+	if s.role != nil && s.role() == cluster.RoleFollower {
+		return ErrNotLeader
+	}
 	if err := s.volumeReady(); err != nil {
 		return err
 	}
@@ -518,6 +742,11 @@ func (s *sqliteControlStore) withWrite(mutator func(tx *sql.Tx) error) error {
 	if err := s.ensureWritableLocked(); err != nil {
 		return err
 	}
+	return s.retryWrite(context.Background(), func() error { return s.writeTx(mutator) })
+}
+
+// writeTx runs mutator and bumps the revision in one transaction.
+func (s *sqliteControlStore) writeTx(mutator func(tx *sql.Tx) error) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -546,6 +775,9 @@ func (s *sqliteControlStore) withWrite(mutator func(tx *sql.Tx) error) error {
 	if !s.state.recoveryAckAt.IsZero() {
 		payload.RecoveryAckAt = formatTimestamp(s.state.recoveryAckAt)
 	}
+	if !s.state.setupCompleted.IsZero() {
+		payload.SetupCompleted = formatTimestamp(s.state.setupCompleted)
+	}
 	if s.state.remoteConfig != nil {
 		rc := cloneRemoteConfig(*s.state.remoteConfig)
 		payload.Remote = &rc
@@ -658,6 +890,19 @@ func (s *sqliteControlStore) updateAuthStaleness(update AuthStalenessUpdate) err
 	})
 }
 
+func (s *sqliteControlStore) updateSetupCompleted(at time.Time) error {
+	return s.withWrite(func(tx *sql.Tx) error {
+		canon := canonicalTime(at)
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		if _, err := tx.Exec(`UPDATE auth_state SET setup_completed_at=?, updated_at=? WHERE id=1`,
+			formatTimestamp(canon), now); err != nil {
+			return err
+		}
+		s.state.setupCompleted = canon
+		return nil
+	})
+}
+
 func (s *sqliteControlStore) upsertRemoteConfig(payload []byte) error {
 	return s.withWrite(func(tx *sql.Tx) error {
 		now := time.Now().UTC().Format(time.RFC3339Nano)
@@ -705,6 +950,17 @@ func (s *sqliteControlStore) maybeCheckpointLocked() {
 	s.lastCheckpoint = time.Now().UTC()
 }
 
+// execContext is db.ExecContext retried while the database is busy.
+func (s *sqliteControlStore) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := s.retryWrite(ctx, func() error {
+		var err error
+		res, err = s.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
 func (s *sqliteControlStore) openDB() error {
 	if s.db != nil {
 		return nil
@@ -719,21 +975,24 @@ func (s *sqliteControlStore) openDB() error {
 	}
 	dsn := s.path
 	if s.readOnly {
-		dsn = buildSQLiteDSN(s.path, true)
+		dsn = readOnlyDSN(s.path)
 	}
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return err
 	}
-	if err := configureSQLite(db, s.readOnly); err != nil {
-		db.Close()
-		return err
-	}
-	if !s.readOnly {
-		if err := applyMigrations(db); err != nil {
-			db.Close()
+	err = s.retryBusy(context.Background(), func() error {
+		if err := configureSQLite(db, s.readOnly); err != nil {
 			return err
 		}
+		if s.readOnly {
+			return nil
+		}
+		return applyMigrations(db)
+	})
+	if err != nil {
+		db.Close()
+		return err
 	}
 	s.db = db
 	return nil
@@ -794,6 +1053,19 @@ func buildSQLiteDSN(path string, readOnly bool) string {
 	return u.String()
 }
 
+// readOnlyDSN opens path read-only. SQLite needs the -wal and -shm files
+// beside a WAL database, creating them when missing, which a read-only
+// mount refuses. When the WAL is absent or empty, as after a checkpoint on
+// close, there is nothing to replay and the file is opened immutable.
+func readOnlyDSN(path string) string {
+	dsn := buildSQLiteDSN(path, true)
+	info, err := os.Stat(path + "-wal")
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		dsn += "&immutable=1"
+	}
+	return dsn
+}
+
 var (
 	_ ControlStore         = (*sqliteControlStore)(nil)
 	_ lockableControlStore = (*sqliteControlStore)(nil)
@@ -865,6 +1137,27 @@ func (r *sqliteAuthRepo) UpdateStaleness(ctx context.Context, update AuthStalene
 	return r.store.updateAuthStaleness(update)
 }
 
+func (r *sqliteAuthRepo) SetupCompletedAt(ctx context.Context) (time.Time, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded {
+		return time.Time{}, ErrLocked
+	}
+	return r.store.state.setupCompleted, nil
+}
+
+func (r *sqliteAuthRepo) MarkSetupComplete(ctx context.Context, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return err
+	}
+	if !r.store.state.setupCompleted.IsZero() {
+		return nil
+	}
+	return r.store.updateSetupCompleted(at)
+}
+
 type sqliteRemoteRepo struct{ store *sqliteControlStore }
 
 func (r *sqliteRemoteRepo) CurrentConfig(ctx context.Context) (RemoteConfig, error) {
@@ -916,3 +1209,852 @@ func (r *sqliteAppStateRepo) UpsertApp(ctx context.Context, record AppRecord) er
 	}
 	return r.store.upsertApp(record)
 }
+
+type sqliteActivityRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteActivityRepo) AppendActivity(ctx context.Context, record ActivityRecord) (ActivityRecord, error) {
+	if strings.TrimSpace(record.Source) == "" || strings.TrimSpace(record.Message) == "" {
+		return record, errors.New("activity source and message required")
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = canonicalTime(record.Time)
+	var meta []byte
+	if len(record.Metadata) > 0 {
+		data, err := json.Marshal(record.Metadata)
+		if err != nil {
+			return record, err
+		}
+		meta = data
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return record, err
+	}
+	var res sql.Result
+	err := r.store.retryWrite(ctx, func() error {
+		var err error
+		res, err = r.store.db.ExecContext(ctx, `INSERT INTO activity (ts, source, level, message, metadata) VALUES (?, ?, ?, ?, ?)`,
+			record.Time.UnixNano(), record.Source, record.Level, record.Message, meta)
+		return err
+	})
+	if err != nil {
+		return record, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return record, err
+	}
+	record.ID = id
+	return record, nil
+}
+
+func (r *sqliteActivityRepo) ListActivity(ctx context.Context, query ActivityQuery) ([]ActivityRecord, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return nil, ErrLocked
+	}
+	var (
+		where []string
+		args  []any
+	)
+	if query.Source != "" {
+		where = append(where, "source=?")
+		args = append(args, query.Source)
+	}
+	if query.Level != "" {
+		where = append(where, "level=?")
+		args = append(args, query.Level)
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "ts>=?")
+		args = append(args, query.Since.UTC().UnixNano())
+	}
+	if query.BeforeID > 0 {
+		where = append(where, "id<?")
+		args = append(args, query.BeforeID)
+	}
+	stmt := `SELECT id, ts, source, level, message, metadata FROM activity`
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY id DESC"
+	if query.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+	var out []ActivityRecord
+	err := r.store.retryBusy(ctx, func() error {
+		out = nil
+		rows, err := r.store.db.QueryContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				rec  ActivityRecord
+				ts   int64
+				meta []byte
+			)
+			if err := rows.Scan(&rec.ID, &ts, &rec.Source, &rec.Level, &rec.Message, &meta); err != nil {
+				return err
+			}
+			rec.Time = time.Unix(0, ts).UTC()
+			if len(meta) > 0 {
+				if err := json.Unmarshal(meta, &rec.Metadata); err != nil {
+					return err
+				}
+			}
+			out = append(out, rec)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *sqliteActivityRepo) PruneActivity(ctx context.Context, policy ActivityRetention) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return 0, err
+	}
+	var removed int64
+	if !policy.OlderThan.IsZero() {
+		res, err := r.store.execContext(ctx, `DELETE FROM activity WHERE ts<?`, policy.OlderThan.UTC().UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+	if policy.MaxRows > 0 {
+		res, err := r.store.execContext(ctx, `DELETE FROM activity WHERE id NOT IN (SELECT id FROM activity ORDER BY id DESC LIMIT ?)`, policy.MaxRows)
+		if err != nil {
+			return int(removed), err
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+	return int(removed), nil
+}
+
+type sqliteServiceStatsRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteServiceStatsRepo) LoadServiceStats(ctx context.Context) ([]ServiceStatsRecord, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return nil, ErrLocked
+	}
+	var out []ServiceStatsRecord
+	err := r.store.retryBusy(ctx, func() error {
+		out = nil
+		rows, err := r.store.db.QueryContext(ctx, `SELECT app, listener, bytes_in, bytes_out, total_conns, last_activity FROM service_stats ORDER BY app, listener`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				rec  ServiceStatsRecord
+				last int64
+			)
+			if err := rows.Scan(&rec.App, &rec.Listener, &rec.BytesIn, &rec.BytesOut, &rec.TotalConnections, &last); err != nil {
+				return err
+			}
+			if last > 0 {
+				rec.LastActivity = time.Unix(0, last).UTC()
+			}
+			out = append(out, rec)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *sqliteServiceStatsRepo) SaveServiceStats(ctx context.Context, records []ServiceStatsRecord) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return err
+	}
+	return r.store.retryWrite(ctx, func() error { return r.saveStatsTx(ctx, records) })
+}
+
+func (r *sqliteServiceStatsRepo) saveStatsTx(ctx context.Context, records []ServiceStatsRecord) (err error) {
+	tx, err := r.store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.ExecContext(ctx, `DELETE FROM service_stats`); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		var last int64
+		if !rec.LastActivity.IsZero() {
+			last = rec.LastActivity.UTC().UnixNano()
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO service_stats (app, listener, bytes_in, bytes_out, total_conns, last_activity) VALUES (?, ?, ?, ?, ?, ?)`,
+			rec.App, rec.Listener, rec.BytesIn, rec.BytesOut, rec.TotalConnections, last); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqliteOSUpdateRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteOSUpdateRepo) CurrentJob(ctx context.Context) (OSUpdateJob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return OSUpdateJob{}, ErrLocked
+	}
+	var payload []byte
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT payload FROM os_update_job WHERE id=1`).Scan(&payload)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return OSUpdateJob{}, ErrNotFound
+	}
+	if err != nil {
+		return OSUpdateJob{}, err
+	}
+	return OSUpdateJob{Payload: payload}, nil
+}
+
+func (r *sqliteOSUpdateRepo) SaveJob(ctx context.Context, job OSUpdateJob) error {
+	if len(job.Payload) == 0 {
+		return errors.New("os update job payload required")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		_, err := tx.Exec(`INSERT INTO os_update_job (id, payload, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET payload=excluded.payload, updated_at=excluded.updated_at`,
+			append([]byte{}, job.Payload...), now)
+		return err
+	})
+}
+
+type sqliteSelfUpdateRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteSelfUpdateRepo) CurrentState(ctx context.Context) (SelfUpdateState, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return SelfUpdateState{}, ErrLocked
+	}
+	var payload []byte
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT payload FROM self_update WHERE id=1`).Scan(&payload)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return SelfUpdateState{}, ErrNotFound
+	}
+	if err != nil {
+		return SelfUpdateState{}, err
+	}
+	return SelfUpdateState{Payload: payload}, nil
+}
+
+func (r *sqliteSelfUpdateRepo) SaveState(ctx context.Context, state SelfUpdateState) error {
+	if len(state.Payload) == 0 {
+		return errors.New("self-update state payload required")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		_, err := tx.Exec(`INSERT INTO self_update (id, payload, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET payload=excluded.payload, updated_at=excluded.updated_at`,
+			append([]byte{}, state.Payload...), now)
+		return err
+	})
+}
+
+type sqliteNotificationRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteNotificationRepo) CurrentConfig(ctx context.Context) (NotificationConfig, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return NotificationConfig{}, ErrLocked
+	}
+	var payload []byte
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT payload FROM notification_config WHERE id=1`).Scan(&payload)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationConfig{}, ErrNotFound
+	}
+	if err != nil {
+		return NotificationConfig{}, err
+	}
+	return NotificationConfig{Payload: payload}, nil
+}
+
+func (r *sqliteNotificationRepo) SaveConfig(ctx context.Context, cfg NotificationConfig) error {
+	if len(cfg.Payload) == 0 {
+		return errors.New("notification config payload required")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		_, err := tx.Exec(`INSERT INTO notification_config (id, payload, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET payload=excluded.payload, updated_at=excluded.updated_at`,
+			append([]byte{}, cfg.Payload...), now)
+		return err
+	})
+}
+
+type sqliteIdentityRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteIdentityRepo) CurrentIdentity(ctx context.Context) (DeviceIdentity, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return DeviceIdentity{}, ErrLocked
+	}
+	var name, updated string
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT name, updated_at FROM device_identity WHERE id=1`).Scan(&name, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeviceIdentity{}, ErrNotFound
+	}
+	if err != nil {
+		return DeviceIdentity{}, err
+	}
+	return DeviceIdentity{Name: name, UpdatedAt: parseTimestamp(updated)}, nil
+}
+
+func (r *sqliteIdentityRepo) SaveIdentity(ctx context.Context, identity DeviceIdentity) error {
+	if strings.TrimSpace(identity.Name) == "" {
+		return errors.New("device name required")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := identity.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO device_identity (id, name, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET name=excluded.name, updated_at=excluded.updated_at`,
+			identity.Name, formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqliteSessionPolicyRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteSessionPolicyRepo) CurrentPolicy(ctx context.Context) (SessionPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return SessionPolicy{}, ErrLocked
+	}
+	var idle, lifetime int64
+	var updated string
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT idle_timeout_seconds, max_lifetime_seconds, updated_at FROM session_policy WHERE id=1`).Scan(&idle, &lifetime, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return SessionPolicy{}, err
+	}
+	return SessionPolicy{
+		IdleTimeout: time.Duration(idle) * time.Second,
+		MaxLifetime: time.Duration(lifetime) * time.Second,
+		UpdatedAt:   parseTimestamp(updated),
+	}, nil
+}
+
+func (r *sqliteSessionPolicyRepo) SavePolicy(ctx context.Context, policy SessionPolicy) error {
+	if policy.IdleTimeout <= 0 || policy.MaxLifetime <= 0 {
+		return errors.New("session timeouts must be positive")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := policy.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO session_policy (id, idle_timeout_seconds, max_lifetime_seconds, updated_at) VALUES (1, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET idle_timeout_seconds=excluded.idle_timeout_seconds,
+				max_lifetime_seconds=excluded.max_lifetime_seconds, updated_at=excluded.updated_at`,
+			int64(policy.IdleTimeout/time.Second), int64(policy.MaxLifetime/time.Second), formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqliteNetworkSettingsRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteNetworkSettingsRepo) CurrentSettings(ctx context.Context) (NetworkSettings, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return NetworkSettings{}, ErrLocked
+	}
+	var addrs, updated string
+	var disablePlain int
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT bind_addresses, disable_plain_http, updated_at FROM network_settings WHERE id=1`).Scan(&addrs, &disablePlain, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return NetworkSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return NetworkSettings{}, err
+	}
+	settings := NetworkSettings{DisablePlainHTTP: disablePlain != 0, UpdatedAt: parseTimestamp(updated)}
+	if err := json.Unmarshal([]byte(addrs), &settings.BindAddresses); err != nil {
+		return NetworkSettings{}, fmt.Errorf("decode bind addresses: %w", err)
+	}
+	return settings, nil
+}
+
+func (r *sqliteNetworkSettingsRepo) SaveSettings(ctx context.Context, settings NetworkSettings) error {
+	addrs := settings.BindAddresses
+	if addrs == nil {
+		addrs = []string{}
+	}
+	encoded, err := json.Marshal(addrs)
+	if err != nil {
+		return err
+	}
+	disablePlain := 0
+	if settings.DisablePlainHTTP {
+		disablePlain = 1
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := settings.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO network_settings (id, bind_addresses, disable_plain_http, updated_at) VALUES (1, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET bind_addresses=excluded.bind_addresses,
+				disable_plain_http=excluded.disable_plain_http, updated_at=excluded.updated_at`,
+			string(encoded), disablePlain, formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqliteCORSPolicyRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteCORSPolicyRepo) CurrentPolicy(ctx context.Context) (CORSPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return CORSPolicy{}, ErrLocked
+	}
+	var origins, headers, updated string
+	var credentials, deviceHosts int
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT allowed_origins, allowed_headers, allow_credentials, include_device_hosts, updated_at FROM cors_policy WHERE id=1`).Scan(&origins, &headers, &credentials, &deviceHosts, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return CORSPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return CORSPolicy{}, err
+	}
+	policy := CORSPolicy{AllowCredentials: credentials != 0, IncludeDeviceHosts: deviceHosts != 0, UpdatedAt: parseTimestamp(updated)}
+	if err := json.Unmarshal([]byte(origins), &policy.AllowedOrigins); err != nil {
+		return CORSPolicy{}, fmt.Errorf("decode allowed origins: %w", err)
+	}
+	if err := json.Unmarshal([]byte(headers), &policy.AllowedHeaders); err != nil {
+		return CORSPolicy{}, fmt.Errorf("decode allowed headers: %w", err)
+	}
+	return policy, nil
+}
+
+func (r *sqliteCORSPolicyRepo) SavePolicy(ctx context.Context, policy CORSPolicy) error {
+	origins, err := json.Marshal(nonNilStrings(policy.AllowedOrigins))
+	if err != nil {
+		return err
+	}
+	headers, err := json.Marshal(nonNilStrings(policy.AllowedHeaders))
+	if err != nil {
+		return err
+	}
+	credentials, deviceHosts := 0, 0
+	if policy.AllowCredentials {
+		credentials = 1
+	}
+	if policy.IncludeDeviceHosts {
+		deviceHosts = 1
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := policy.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO cors_policy (id, allowed_origins, allowed_headers, allow_credentials, include_device_hosts, updated_at) VALUES (1, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET allowed_origins=excluded.allowed_origins,
+				allowed_headers=excluded.allowed_headers, allow_credentials=excluded.allow_credentials,
+				include_device_hosts=excluded.include_device_hosts, updated_at=excluded.updated_at`,
+			string(origins), string(headers), credentials, deviceHosts, formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqlitePortPolicyRepo struct{ store *sqliteControlStore }
+
+func (r *sqlitePortPolicyRepo) CurrentPolicy(ctx context.Context) (PortPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return PortPolicy{}, ErrLocked
+	}
+	var policy PortPolicy
+	var excluded, limits, updated string
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT host_bind_start, host_bind_end, public_start, public_end, excluded_ports, connection_limits, updated_at FROM port_policy WHERE id=1`).Scan(
+			&policy.HostBindStart, &policy.HostBindEnd, &policy.PublicStart, &policy.PublicEnd, &excluded, &limits, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return PortPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return PortPolicy{}, err
+	}
+	if err := json.Unmarshal([]byte(excluded), &policy.ExcludedPorts); err != nil {
+		return PortPolicy{}, fmt.Errorf("decode excluded ports: %w", err)
+	}
+	if limits != "" {
+		policy.ConnectionLimits = &ConnectionLimits{}
+		if err := json.Unmarshal([]byte(limits), policy.ConnectionLimits); err != nil {
+			return PortPolicy{}, fmt.Errorf("decode connection limits: %w", err)
+		}
+	}
+	policy.UpdatedAt = parseTimestamp(updated)
+	return policy, nil
+}
+
+func (r *sqlitePortPolicyRepo) SavePolicy(ctx context.Context, policy PortPolicy) error {
+	excluded := policy.ExcludedPorts
+	if excluded == nil {
+		excluded = []int{}
+	}
+	encoded, err := json.Marshal(excluded)
+	if err != nil {
+		return err
+	}
+	limits := ""
+	if policy.ConnectionLimits != nil {
+		raw, err := json.Marshal(policy.ConnectionLimits)
+		if err != nil {
+			return err
+		}
+		limits = string(raw)
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := policy.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO port_policy (id, host_bind_start, host_bind_end, public_start, public_end, excluded_ports, connection_limits, updated_at) VALUES (1, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET host_bind_start=excluded.host_bind_start, host_bind_end=excluded.host_bind_end,
+				public_start=excluded.public_start, public_end=excluded.public_end,
+				excluded_ports=excluded.excluded_ports, connection_limits=excluded.connection_limits, updated_at=excluded.updated_at`,
+			policy.HostBindStart, policy.HostBindEnd, policy.PublicStart, policy.PublicEnd, string(encoded), limits, formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+func (r *sqlitePortPolicyRepo) OccupiedPorts(ctx context.Context) ([]OccupiedPort, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return nil, ErrLocked
+	}
+	var out []OccupiedPort
+	err := r.store.retryBusy(ctx, func() error {
+		out = nil
+		rows, err := r.store.db.QueryContext(ctx, `SELECT port, network, range_name, first_seen, last_seen FROM occupied_ports ORDER BY port, network`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				rec         OccupiedPort
+				first, last string
+			)
+			if err := rows.Scan(&rec.Port, &rec.Network, &rec.Range, &first, &last); err != nil {
+				return err
+			}
+			rec.FirstSeen = parseTimestamp(first)
+			rec.LastSeen = parseTimestamp(last)
+			out = append(out, rec)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SaveOccupiedPorts is operational state like service stats: it is written
+// without bumping the control revision.
+func (r *sqlitePortPolicyRepo) SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return err
+	}
+	return r.store.retryWrite(ctx, func() error { return r.saveOccupiedTx(ctx, ports) })
+}
+
+func (r *sqlitePortPolicyRepo) saveOccupiedTx(ctx context.Context, ports []OccupiedPort) (err error) {
+	tx, err := r.store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.ExecContext(ctx, `DELETE FROM occupied_ports`); err != nil {
+		return err
+	}
+	for _, rec := range ports {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO occupied_ports (port, network, range_name, first_seen, last_seen) VALUES (?, ?, ?, ?, ?)`,
+			rec.Port, rec.Network, rec.Range, formatTimestamp(rec.FirstSeen), formatTimestamp(rec.LastSeen)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func nonNilStrings(v []string) []string {
+	if v == nil {
+		return []string{}
+	}
+	return v
+}
+
+type sqliteMountAllowlistRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteMountAllowlistRepo) CurrentAllowlist(ctx context.Context) (MountAllowlist, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return MountAllowlist{}, ErrLocked
+	}
+	var encoded, updated string
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT paths, updated_at FROM mount_allowlist WHERE id=1`).Scan(&encoded, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return MountAllowlist{}, ErrNotFound
+	}
+	if err != nil {
+		return MountAllowlist{}, err
+	}
+	var allowlist MountAllowlist
+	if err := json.Unmarshal([]byte(encoded), &allowlist.Paths); err != nil {
+		return MountAllowlist{}, fmt.Errorf("decode mount allowlist: %w", err)
+	}
+	allowlist.UpdatedAt = parseTimestamp(updated)
+	return allowlist, nil
+}
+
+func (r *sqliteMountAllowlistRepo) SaveAllowlist(ctx context.Context, allowlist MountAllowlist) error {
+	encoded, err := json.Marshal(nonNilStrings(allowlist.Paths))
+	if err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := allowlist.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO mount_allowlist (id, paths, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET paths=excluded.paths, updated_at=excluded.updated_at`,
+			string(encoded), formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqliteAppPolicyRepo struct{ store *sqliteControlStore }
+
+func (r *sqliteAppPolicyRepo) CurrentPolicy(ctx context.Context) (AppPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return AppPolicy{}, ErrLocked
+	}
+	var encoded, updated string
+	err := r.store.retryBusy(ctx, func() error {
+		return r.store.db.QueryRowContext(ctx, `SELECT policy, updated_at FROM app_policy WHERE id=1`).Scan(&encoded, &updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return AppPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return AppPolicy{}, err
+	}
+	var policy AppPolicy
+	if err := json.Unmarshal([]byte(encoded), &policy); err != nil {
+		return AppPolicy{}, fmt.Errorf("decode app policy: %w", err)
+	}
+	policy.UpdatedAt = parseTimestamp(updated)
+	return policy, nil
+}
+
+func (r *sqliteAppPolicyRepo) SavePolicy(ctx context.Context, policy AppPolicy) error {
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		updated := policy.UpdatedAt
+		if updated.IsZero() {
+			updated = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO app_policy (id, policy, updated_at) VALUES (1, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET policy=excluded.policy, updated_at=excluded.updated_at`,
+			string(encoded), formatTimestamp(canonicalTime(updated)))
+		return err
+	})
+}
+
+type sqliteAPITokenRepo struct{ store *sqliteControlStore }
+
+const apiTokenColumns = `id, name, token_hash, scope, created_at, expires_at, last_used_at`
+
+func scanAPIToken(row interface{ Scan(...any) error }) (APIToken, error) {
+	var tok APIToken
+	var created, expires, lastUsed string
+	if err := row.Scan(&tok.ID, &tok.Name, &tok.Hash, &tok.Scope, &created, &expires, &lastUsed); err != nil {
+		return APIToken{}, err
+	}
+	tok.CreatedAt = parseTimestamp(created)
+	tok.ExpiresAt = parseTimestamp(expires)
+	tok.LastUsedAt = parseTimestamp(lastUsed)
+	return tok, nil
+}
+
+func (r *sqliteAPITokenRepo) ListTokens(ctx context.Context) ([]APIToken, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return nil, ErrLocked
+	}
+	var out []APIToken
+	err := r.store.retryBusy(ctx, func() error {
+		out = nil
+		rows, err := r.store.db.QueryContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens ORDER BY created_at, id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			tok, err := scanAPIToken(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, tok)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *sqliteAPITokenRepo) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if !r.store.loaded || r.store.db == nil {
+		return APIToken{}, ErrLocked
+	}
+	var tok APIToken
+	err := r.store.retryBusy(ctx, func() error {
+		var err error
+		tok, err = scanAPIToken(r.store.db.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash=?`, hash))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrNotFound
+	}
+	return tok, err
+}
+
+func (r *sqliteAPITokenRepo) CreateToken(ctx context.Context, token APIToken) error {
+	if strings.TrimSpace(token.ID) == "" || strings.TrimSpace(token.Hash) == "" {
+		return errors.New("api token id and hash required")
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		created := token.CreatedAt
+		if created.IsZero() {
+			created = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO api_tokens (`+apiTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, '')`,
+			token.ID, token.Name, token.Hash, token.Scope, formatTimestamp(created), formatTimestamp(token.ExpiresAt))
+		return err
+	})
+}
+
+func (r *sqliteAPITokenRepo) DeleteToken(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.withWrite(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM api_tokens WHERE id=?`, id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *sqliteAPITokenRepo) TouchToken(ctx context.Context, id string, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.store.ensureWritableLocked(); err != nil {
+		return err
+	}
+	_, err := r.store.execContext(ctx, `UPDATE api_tokens SET last_used_at=? WHERE id=?`, formatTimestamp(canonicalTime(at)), id)
+	return err
+}
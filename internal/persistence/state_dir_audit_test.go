@@ -78,7 +78,7 @@ func TestPersistenceStateDirHasNoPlaintextArtifacts(t *testing.T) {
 	}
 
 	if err := mod.Volumes().Attach(ctx, controlHandle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
-		mod.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+		mod.leadership.Set(cluster.ResourceControlStore, cluster.RoleLeader)
 		if err := mod.Volumes().Attach(ctx, controlHandle, AttachOptions{Role: VolumeRoleLeader}); err != nil {
 			t.Fatalf("attach control volume: %v", err)
 		}
@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var (
@@ -13,6 +14,9 @@ var (
 	ErrCryptoUnavailable       = errors.New("persistence: crypto unavailable")
 	ErrNotFound                = errors.New("persistence: not found")
 	ErrVolumeMetadataCorrupted = errors.New("persistence: volume metadata corrupted")
+	// ErrNoSpace refuses a write while free space under the state dir is
+	// below the configured floor.
+	ErrNoSpace = errors.New("persistence: insufficient storage")
 )
 
 // Bootstrap -----------------------------------------------------------------
@@ -28,23 +32,76 @@ func (n *noopBootstrapStore) IsMounted() bool                   { return false }
 // Control -------------------------------------------------------------------
 
 type noopControlStore struct {
-	auth    AuthRepo
-	remote  RemoteRepo
-	appRepo AppStateRepo
+	auth     AuthRepo
+	remote   RemoteRepo
+	appRepo  AppStateRepo
+	activity ActivityRepo
+	stats    ServiceStatsRepo
+	updates  OSUpdateRepo
+	self     SelfUpdateRepo
+	notify   NotificationRepo
+	identity IdentityRepo
+	sessions SessionPolicyRepo
+	network  NetworkSettingsRepo
+	cors     CORSPolicyRepo
+	ports    PortPolicyRepo
+	mounts   MountAllowlistRepo
+	policy   AppPolicyRepo
+	tokens   APITokenRepo
 }
 
 func newNoopControlStore() *noopControlStore {
 	return &noopControlStore{
-		auth:    &noopAuthRepo{},
-		remote:  &noopRemoteRepo{},
-		appRepo: &noopAppStateRepo{},
+		auth:     &noopAuthRepo{},
+		remote:   &noopRemoteRepo{},
+		appRepo:  &noopAppStateRepo{},
+		activity: &noopActivityRepo{},
+		stats:    &noopServiceStatsRepo{},
+		updates:  &noopOSUpdateRepo{},
+		self:     &noopSelfUpdateRepo{},
+		notify:   &noopNotificationRepo{},
+		identity: &noopIdentityRepo{},
+		sessions: &noopSessionPolicyRepo{},
+		network:  &noopNetworkSettingsRepo{},
+		cors:     &noopCORSPolicyRepo{},
+		ports:    &noopPortPolicyRepo{},
+		mounts:   &noopMountAllowlistRepo{},
+		policy:   &noopAppPolicyRepo{},
+		tokens:   &noopAPITokenRepo{},
 	}
 }
 
 func (n *noopControlStore) Auth() AuthRepo                  { return n.auth }
 func (n *noopControlStore) Remote() RemoteRepo              { return n.remote }
 func (n *noopControlStore) AppState() AppStateRepo          { return n.appRepo }
+func (n *noopControlStore) Activity() ActivityRepo          { return n.activity }
+func (n *noopControlStore) ServiceStats() ServiceStatsRepo  { return n.stats }
+func (n *noopControlStore) OSUpdates() OSUpdateRepo         { return n.updates }
+func (n *noopControlStore) SelfUpdate() SelfUpdateRepo      { return n.self }
+func (n *noopControlStore) Notifications() NotificationRepo { return n.notify }
+func (n *noopControlStore) Identity() IdentityRepo          { return n.identity }
 func (n *noopControlStore) Close(ctx context.Context) error { return nil }
+func (n *noopControlStore) SessionPolicy() SessionPolicyRepo {
+	return n.sessions
+}
+func (n *noopControlStore) NetworkSettings() NetworkSettingsRepo {
+	return n.network
+}
+func (n *noopControlStore) CORSPolicy() CORSPolicyRepo {
+	return n.cors
+}
+func (n *noopControlStore) PortPolicy() PortPolicyRepo {
+	return n.ports
+}
+func (n *noopControlStore) MountAllowlist() MountAllowlistRepo {
+	return n.mounts
+}
+func (n *noopControlStore) AppPolicy() AppPolicyRepo {
+	return n.policy
+}
+func (n *noopControlStore) APITokens() APITokenRepo {
+	return n.tokens
+}
 func (n *noopControlStore) Revision(ctx context.Context) (uint64, string, error) {
 	return 0, "", ErrNotImplemented
 }
@@ -67,6 +124,12 @@ func (n *noopAuthRepo) Staleness(ctx context.Context) (AuthStaleness, error) {
 func (n *noopAuthRepo) UpdateStaleness(ctx context.Context, update AuthStalenessUpdate) error {
 	return ErrNotImplemented
 }
+func (n *noopAuthRepo) SetupCompletedAt(ctx context.Context) (time.Time, error) {
+	return time.Time{}, ErrNotImplemented
+}
+func (n *noopAuthRepo) MarkSetupComplete(ctx context.Context, at time.Time) error {
+	return ErrNotImplemented
+}
 
 type noopRemoteRepo struct{}
 
@@ -88,6 +151,160 @@ func (n *noopAppStateRepo) UpsertApp(ctx context.Context, record AppRecord) erro
 	return ErrNotImplemented
 }
 
+type noopActivityRepo struct{}
+
+func (n *noopActivityRepo) AppendActivity(ctx context.Context, record ActivityRecord) (ActivityRecord, error) {
+	return record, ErrNotImplemented
+}
+
+func (n *noopActivityRepo) ListActivity(ctx context.Context, query ActivityQuery) ([]ActivityRecord, error) {
+	return nil, ErrNotImplemented
+}
+
+func (n *noopActivityRepo) PruneActivity(ctx context.Context, policy ActivityRetention) (int, error) {
+	return 0, ErrNotImplemented
+}
+
+type noopServiceStatsRepo struct{}
+
+func (n *noopServiceStatsRepo) LoadServiceStats(ctx context.Context) ([]ServiceStatsRecord, error) {
+	return nil, ErrNotImplemented
+}
+
+func (n *noopServiceStatsRepo) SaveServiceStats(ctx context.Context, records []ServiceStatsRecord) error {
+	return ErrNotImplemented
+}
+
+type noopOSUpdateRepo struct{}
+
+func (n *noopOSUpdateRepo) CurrentJob(ctx context.Context) (OSUpdateJob, error) {
+	return OSUpdateJob{}, ErrNotImplemented
+}
+
+func (n *noopOSUpdateRepo) SaveJob(ctx context.Context, job OSUpdateJob) error {
+	return ErrNotImplemented
+}
+
+type noopSelfUpdateRepo struct{}
+
+func (n *noopSelfUpdateRepo) CurrentState(ctx context.Context) (SelfUpdateState, error) {
+	return SelfUpdateState{}, ErrNotImplemented
+}
+
+func (n *noopSelfUpdateRepo) SaveState(ctx context.Context, state SelfUpdateState) error {
+	return ErrNotImplemented
+}
+
+type noopNotificationRepo struct{}
+
+func (n *noopNotificationRepo) CurrentConfig(ctx context.Context) (NotificationConfig, error) {
+	return NotificationConfig{}, ErrNotImplemented
+}
+
+func (n *noopNotificationRepo) SaveConfig(ctx context.Context, cfg NotificationConfig) error {
+	return ErrNotImplemented
+}
+
+type noopIdentityRepo struct{}
+
+func (n *noopIdentityRepo) CurrentIdentity(ctx context.Context) (DeviceIdentity, error) {
+	return DeviceIdentity{}, ErrNotImplemented
+}
+
+func (n *noopIdentityRepo) SaveIdentity(ctx context.Context, identity DeviceIdentity) error {
+	return ErrNotImplemented
+}
+
+type noopSessionPolicyRepo struct{}
+
+func (n *noopSessionPolicyRepo) CurrentPolicy(ctx context.Context) (SessionPolicy, error) {
+	return SessionPolicy{}, ErrNotImplemented
+}
+
+func (n *noopSessionPolicyRepo) SavePolicy(ctx context.Context, policy SessionPolicy) error {
+	return ErrNotImplemented
+}
+
+type noopNetworkSettingsRepo struct{}
+
+func (n *noopNetworkSettingsRepo) CurrentSettings(ctx context.Context) (NetworkSettings, error) {
+	return NetworkSettings{}, ErrNotImplemented
+}
+
+func (n *noopNetworkSettingsRepo) SaveSettings(ctx context.Context, settings NetworkSettings) error {
+	return ErrNotImplemented
+}
+
+type noopCORSPolicyRepo struct{}
+
+func (n *noopCORSPolicyRepo) CurrentPolicy(ctx context.Context) (CORSPolicy, error) {
+	return CORSPolicy{}, ErrNotImplemented
+}
+
+func (n *noopCORSPolicyRepo) SavePolicy(ctx context.Context, policy CORSPolicy) error {
+	return ErrNotImplemented
+}
+
+type noopPortPolicyRepo struct{}
+
+func (n *noopPortPolicyRepo) CurrentPolicy(ctx context.Context) (PortPolicy, error) {
+	return PortPolicy{}, ErrNotImplemented
+}
+
+func (n *noopPortPolicyRepo) SavePolicy(ctx context.Context, policy PortPolicy) error {
+	return ErrNotImplemented
+}
+
+func (n *noopPortPolicyRepo) OccupiedPorts(ctx context.Context) ([]OccupiedPort, error) {
+	return nil, ErrNotImplemented
+}
+
+func (n *noopPortPolicyRepo) SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error {
+	return ErrNotImplemented
+}
+
+type noopMountAllowlistRepo struct{}
+
+func (n *noopMountAllowlistRepo) CurrentAllowlist(ctx context.Context) (MountAllowlist, error) {
+	return MountAllowlist{}, ErrNotImplemented
+}
+
+func (n *noopMountAllowlistRepo) SaveAllowlist(ctx context.Context, allowlist MountAllowlist) error {
+	return ErrNotImplemented
+}
+
+type noopAppPolicyRepo struct{}
+
+func (n *noopAppPolicyRepo) CurrentPolicy(ctx context.Context) (AppPolicy, error) {
+	return AppPolicy{}, ErrNotImplemented
+}
+
+func (n *noopAppPolicyRepo) SavePolicy(ctx context.Context, policy AppPolicy) error {
+	return ErrNotImplemented
+}
+
+type noopAPITokenRepo struct{}
+
+func (n *noopAPITokenRepo) ListTokens(ctx context.Context) ([]APIToken, error) {
+	return nil, ErrNotImplemented
+}
+
+func (n *noopAPITokenRepo) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	return APIToken{}, ErrNotImplemented
+}
+
+func (n *noopAPITokenRepo) CreateToken(ctx context.Context, token APIToken) error {
+	return ErrNotImplemented
+}
+
+func (n *noopAPITokenRepo) DeleteToken(ctx context.Context, id string) error {
+	return ErrNotImplemented
+}
+
+func (n *noopAPITokenRepo) TouchToken(ctx context.Context, id string, at time.Time) error {
+	return ErrNotImplemented
+}
+
 // Volume --------------------------------------------------------------------
 
 type noopVolumeManager struct{}
@@ -106,6 +323,10 @@ func (n *noopVolumeManager) Detach(ctx context.Context, handle VolumeHandle) err
 	return ErrNotImplemented
 }
 
+func (n *noopVolumeManager) Remove(ctx context.Context, handle VolumeHandle) (VolumeRemoval, error) {
+	return VolumeRemoval{}, ErrNotImplemented
+}
+
 func (n *noopVolumeManager) RoleStream(volumeID string) (<-chan VolumeRole, error) {
 	ch := make(chan VolumeRole)
 	close(ch)
@@ -0,0 +1,338 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	acmepkg "golang.org/x/crypto/acme"
+)
+
+// accountFormat is the version of the AccountRecord layout; records with a
+// newer format are refused rather than misread.
+const accountFormat = 1
+
+const accountRecordFile = "account-record.json"
+
+// ErrNoAccount is returned when no ACME account has been registered yet.
+var ErrNoAccount = errors.New("acme: no account registered")
+
+// AccountRecord is the persisted ACME account. KeyPEM is the key the CA
+// knows the account by; Generation counts key rotations.
+type AccountRecord struct {
+	Format     int       `json:"format"`
+	Generation int       `json:"generation"`
+	Directory  string    `json:"directory"`
+	URL        string    `json:"url"`
+	KeyPEM     string    `json:"key_pem"`
+	CreatedAt  time.Time `json:"created_at"`
+	// PendingKeyPEM is a replacement key the CA has been asked to switch
+	// to but has not confirmed yet. KeyPEM stays authoritative until then.
+	PendingKeyPEM string `json:"pending_key_pem,omitempty"`
+}
+
+// AccountInfo describes the account without its key.
+type AccountInfo struct {
+	Directory string `json:"directory"`
+	URL       string `json:"url"`
+	ID        string `json:"id"`
+	// KeyFingerprint is the RFC 7638 JWK thumbprint of the account key.
+	KeyFingerprint string    `json:"key_fingerprint"`
+	CreatedAt      time.Time `json:"created_at"`
+	Generation     int       `json:"generation"`
+}
+
+func (r *AccountRecord) key() (*ecdsa.PrivateKey, error) {
+	return parseECKey([]byte(r.KeyPEM))
+}
+
+func (r *AccountRecord) info() (AccountInfo, error) {
+	key, err := r.key()
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	thumb, err := acmepkg.JWKThumbprint(key.Public())
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	return AccountInfo{
+		Directory:      r.Directory,
+		URL:            r.URL,
+		ID:             path.Base(strings.TrimRight(r.URL, "/")),
+		KeyFingerprint: thumb,
+		CreatedAt:      r.CreatedAt,
+		Generation:     r.Generation,
+	}, nil
+}
+
+func parseECKey(b []byte) (*ecdsa.PrivateKey, error) {
+	key, err := certcrypto.ParsePEMPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("unsupported key format")
+	}
+	return ec, nil
+}
+
+func newAccountKey() (*ecdsa.PrivateKey, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := pemEncodeEC(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, string(b), nil
+}
+
+// SetAccountObserver registers fn to be called with the record each time
+// the account is registered or its key changes, so it can be kept with the
+// rest of the configuration.
+func (m *Manager) SetAccountObserver(fn func(AccountRecord)) {
+	m.recordMu.Lock()
+	m.observer = fn
+	m.recordMu.Unlock()
+}
+
+func (m *Manager) notifyAccount(rec *AccountRecord) {
+	if m.observer != nil {
+		m.observer(*rec)
+	}
+}
+
+// loadRecord reads the account record, converting the files written before
+// records were versioned. recordMu must be held.
+func (m *Manager) loadRecord() (*AccountRecord, error) {
+	data, err := os.ReadFile(filepath.Join(m.baseDir, accountRecordFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return m.migrateLegacyAccount()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec AccountRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("acme: decode account record: %w", err)
+	}
+	if rec.Format > accountFormat {
+		return nil, fmt.Errorf("acme: account record format %d is newer than supported %d", rec.Format, accountFormat)
+	}
+	return &rec, nil
+}
+
+// saveRecord replaces the account record atomically. recordMu must be held.
+func (m *Manager) saveRecord(rec *AccountRecord) error {
+	if err := m.ensureDirs(); err != nil {
+		return err
+	}
+	rec.Format = accountFormat
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(m.baseDir, accountRecordFile)
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// migrateLegacyAccount turns the account.key/account.json pair into a
+// record. recordMu must be held.
+func (m *Manager) migrateLegacyAccount() (*AccountRecord, error) {
+	keyPath, regPath := m.accountPaths()
+	keyPEM, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseECKey(keyPEM); err != nil {
+		return nil, err
+	}
+	var reg struct {
+		URI string `json:"uri"`
+	}
+	if data, err := os.ReadFile(regPath); err == nil {
+		_ = json.Unmarshal(data, &reg)
+	}
+	if reg.URI == "" {
+		// Never registered; start over.
+		_ = m.resetAccountCache()
+		return nil, ErrNoAccount
+	}
+	created := time.Now().UTC()
+	if fi, err := os.Stat(keyPath); err == nil {
+		created = fi.ModTime().UTC()
+	}
+	rec := &AccountRecord{Generation: 1, URL: reg.URI, KeyPEM: string(keyPEM), CreatedAt: created}
+	if err := m.saveRecord(rec); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(keyPath)
+	_ = os.Remove(regPath)
+	log.Printf("INFO: ACME account %s moved to a versioned record", rec.URL)
+	m.notifyAccount(rec)
+	return rec, nil
+}
+
+// Account describes the registered account, or returns ErrNoAccount.
+func (m *Manager) Account() (AccountInfo, error) {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	rec, err := m.loadRecord()
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	info, err := rec.info()
+	if err == nil && info.Directory == "" {
+		info.Directory = m.directory
+	}
+	return info, err
+}
+
+// ExportAccount returns the account record, key included, or ErrNoAccount.
+func (m *Manager) ExportAccount() (*AccountRecord, error) {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	return m.loadRecord()
+}
+
+// ImportAccount replaces the local account with rec, typically one kept in
+// a restored configuration, so a reinstalled device keeps its account.
+func (m *Manager) ImportAccount(rec AccountRecord) error {
+	if rec.Format > accountFormat {
+		return fmt.Errorf("acme: account record format %d is newer than supported %d", rec.Format, accountFormat)
+	}
+	if rec.URL == "" {
+		return errors.New("acme: account record has no account URL")
+	}
+	if _, err := rec.key(); err != nil {
+		return fmt.Errorf("acme: account record key: %w", err)
+	}
+	if !m.sameCA(rec.URL) {
+		return fmt.Errorf("acme: account %s is not registered with %s", rec.URL, m.directory)
+	}
+	m.rotateMu.Lock()
+	defer m.rotateMu.Unlock()
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	return m.saveRecord(&rec)
+}
+
+// sameCA reports whether accountURL belongs to the configured directory.
+func (m *Manager) sameCA(accountURL string) bool {
+	regHost, dirHost := hostFromURL(accountURL), hostFromURL(m.directory)
+	return regHost == "" || dirHost == "" || strings.EqualFold(regHost, dirHost)
+}
+
+// RotateAccountKey replaces the account key. The new key is recorded as
+// pending before the CA is asked to switch and only replaces the old one
+// once the CA confirms, so a failed change leaves the account usable. An
+// account the CA no longer knows is registered again under the new key.
+// Issuance in progress finishes before the key changes.
+func (m *Manager) RotateAccountKey(ctx context.Context) (AccountInfo, error) {
+	m.rotateMu.Lock()
+	defer m.rotateMu.Unlock()
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	rec, err := m.loadRecord()
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	oldKey, err := rec.key()
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	newKey, newPEM, err := newAccountKey()
+	if err != nil {
+		return AccountInfo{}, err
+	}
+	rec.PendingKeyPEM = newPEM
+	if err := m.saveRecord(rec); err != nil {
+		return AccountInfo{}, err
+	}
+
+	accountURL := rec.URL
+	client := &acmepkg.Client{Key: oldKey, KID: acmepkg.KeyID(rec.URL), DirectoryURL: m.directory}
+	err = client.AccountKeyRollover(ctx, newKey)
+	if isAccountDoesNotExist(err) {
+		log.Printf("WARN: ACME account %s no longer exists; registering a new one", rec.URL)
+		accountURL, err = m.register(newKey)
+	}
+	if err != nil {
+		rec.PendingKeyPEM = ""
+		if serr := m.saveRecord(rec); serr != nil {
+			log.Printf("WARN: ACME drop pending account key: %v", serr)
+		}
+		return AccountInfo{}, fmt.Errorf("acme: rotate account key: %w", err)
+	}
+	rec.commitPending(accountURL, m.directory)
+	if err := m.saveRecord(rec); err != nil {
+		// The CA already uses the new key and it is only in memory now.
+		return AccountInfo{}, fmt.Errorf("acme: save rotated account key: %w", err)
+	}
+	log.Printf("INFO: ACME account %s key rotated (generation %d)", rec.URL, rec.Generation)
+	m.notifyAccount(rec)
+	return rec.info()
+}
+
+func (r *AccountRecord) commitPending(accountURL, directory string) {
+	r.URL = accountURL
+	r.Directory = directory
+	r.KeyPEM = r.PendingKeyPEM
+	r.PendingKeyPEM = ""
+	r.Generation++
+	r.CreatedAt = time.Now().UTC()
+}
+
+// settlePendingKey finishes a rotation interrupted before its outcome was
+// recorded: the pending key becomes the account key if the CA already knows
+// the account by it, and is dropped if it does not. recordMu must be held.
+func (m *Manager) settlePendingKey(ctx context.Context, rec *AccountRecord) {
+	pending, err := parseECKey([]byte(rec.PendingKeyPEM))
+	if err != nil {
+		rec.PendingKeyPEM = ""
+		_ = m.saveRecord(rec)
+		return
+	}
+	client := &acmepkg.Client{Key: pending, DirectoryURL: m.directory}
+	acc, err := client.GetReg(ctx, "")
+	switch {
+	case err == nil && acc.URI == rec.URL:
+		rec.commitPending(rec.URL, m.directory)
+		log.Printf("INFO: ACME account %s completed an interrupted key rotation", rec.URL)
+	case err == nil, errors.Is(err, acmepkg.ErrNoAccount):
+		rec.PendingKeyPEM = ""
+	default:
+		// Cannot tell yet; keep both and ask again next time.
+		log.Printf("WARN: ACME check pending account key: %v", err)
+		return
+	}
+	if err := m.saveRecord(rec); err != nil {
+		log.Printf("WARN: ACME save account record: %v", err)
+		return
+	}
+	m.notifyAccount(rec)
+}
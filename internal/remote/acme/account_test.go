@@ -0,0 +1,410 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	acmepkg "golang.org/x/crypto/acme"
+)
+
+// fakeCA implements the parts of an RFC 8555 directory that account
+// management uses: newNonce, newAccount and keyChange. It tracks which key
+// each account is known by but does not verify signatures.
+type fakeCA struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	accounts      map[string]string // account URL -> key thumbprint
+	registrations int
+	keyChanges    int
+	failKeyChange bool
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	t.Helper()
+	ca := &fakeCA{accounts: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		base := ca.srv.URL
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   base + "/nonce",
+			"newAccount": base + "/account",
+			"newOrder":   base + "/order",
+			"revokeCert": base + "/revoke",
+			"keyChange":  base + "/key-change",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.Header().Set("Cache-Control", "no-store")
+	})
+	mux.HandleFunc("/account", ca.handleAccount)
+	mux.HandleFunc("/key-change", ca.handleKeyChange)
+	ca.srv = httptest.NewServer(mux)
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) directoryURL() string { return ca.srv.URL + "/directory" }
+
+type fakeJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+}
+
+type fakeHeader struct {
+	JWK json.RawMessage `json:"jwk"`
+	KID string          `json:"kid"`
+}
+
+func decodeJWS(data []byte) (fakeHeader, []byte, error) {
+	var jws fakeJWS
+	if err := json.Unmarshal(data, &jws); err != nil {
+		return fakeHeader{}, nil, err
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return fakeHeader{}, nil, err
+	}
+	var h fakeHeader
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return fakeHeader{}, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return h, payload, err
+}
+
+func jwkThumbprint(raw json.RawMessage) (string, error) {
+	var jwk struct{ X, Y string }
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", err
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return "", err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return "", err
+	}
+	return acmepkg.JWKThumbprint(&ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)})
+}
+
+func problem(w http.ResponseWriter, status int, kind, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:" + kind, "detail": detail})
+}
+
+func (ca *fakeCA) handleAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	body := readBody(r)
+	h, payload, err := decodeJWS(body)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	thumb, err := jwkThumbprint(h.JWK)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	var req struct {
+		OnlyReturnExisting bool `json:"onlyReturnExisting"`
+	}
+	_ = json.Unmarshal(payload, &req)
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	for url, known := range ca.accounts {
+		if known == thumb {
+			w.Header().Set("Location", url)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+			return
+		}
+	}
+	if req.OnlyReturnExisting {
+		problem(w, http.StatusBadRequest, "accountDoesNotExist", "no account for key")
+		return
+	}
+	ca.registrations++
+	url := fmt.Sprintf("%s/acct/%d", ca.srv.URL, ca.registrations)
+	ca.accounts[url] = thumb
+	w.Header().Set("Location", url)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(`{"status":"valid"}`))
+}
+
+func (ca *fakeCA) handleKeyChange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	outer, payload, err := decodeJWS(readBody(r))
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	inner, innerPayload, err := decodeJWS(payload)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	var change struct {
+		Account string          `json:"account"`
+		OldKey  json.RawMessage `json:"oldKey"`
+	}
+	if err := json.Unmarshal(innerPayload, &change); err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	oldThumb, err := jwkThumbprint(change.OldKey)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	newThumb, err := jwkThumbprint(inner.JWK)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	known, ok := ca.accounts[outer.KID]
+	switch {
+	case !ok:
+		problem(w, http.StatusBadRequest, "accountDoesNotExist", "unknown account")
+	case ca.failKeyChange:
+		problem(w, http.StatusForbidden, "unauthorized", "key change refused")
+	case change.Account != outer.KID || known != oldThumb:
+		problem(w, http.StatusForbidden, "unauthorized", "old key does not match")
+	default:
+		ca.accounts[outer.KID] = newThumb
+		ca.keyChanges++
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	}
+}
+
+func readBody(r *http.Request) []byte {
+	defer r.Body.Close()
+	b, _ := io.ReadAll(r.Body)
+	return b
+}
+
+func (ca *fakeCA) keyFor(url string) string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.accounts[url]
+}
+
+func registeredManager(t *testing.T, ca *fakeCA) (*Manager, AccountInfo) {
+	t.Helper()
+	m := NewManager(t.TempDir(), nil, "", ca.directoryURL())
+	if _, _, err := m.EnsureAccount(); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	info, err := m.Account()
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	return m, info
+}
+
+func TestAccountRegistrationIsRecorded(t *testing.T) {
+	ca := newFakeCA(t)
+	m := NewManager(t.TempDir(), nil, "", ca.directoryURL())
+	if _, err := m.Account(); !errors.Is(err, ErrNoAccount) {
+		t.Fatalf("expected ErrNoAccount before registration, got %v", err)
+	}
+	var observed []AccountRecord
+	m.SetAccountObserver(func(rec AccountRecord) { observed = append(observed, rec) })
+	if _, _, err := m.EnsureAccount(); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	info, err := m.Account()
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	if info.URL != ca.srv.URL+"/acct/1" || info.ID != "1" || info.Directory != ca.directoryURL() || info.Generation != 1 || info.CreatedAt.IsZero() {
+		t.Fatalf("unexpected account %+v", info)
+	}
+	if info.KeyFingerprint != ca.keyFor(info.URL) {
+		t.Fatalf("fingerprint %s does not match the key the CA knows", info.KeyFingerprint)
+	}
+	if len(observed) != 1 || observed[0].URL != info.URL {
+		t.Fatalf("observer not told about the registration: %+v", observed)
+	}
+	if _, _, err := m.EnsureAccount(); err != nil || ca.registrations != 1 {
+		t.Fatalf("cached account not reused: registrations=%d err=%v", ca.registrations, err)
+	}
+}
+
+func TestRotateAccountKey(t *testing.T) {
+	ca := newFakeCA(t)
+	m, before := registeredManager(t, ca)
+	var observed []AccountRecord
+	m.SetAccountObserver(func(rec AccountRecord) { observed = append(observed, rec) })
+
+	after, err := m.RotateAccountKey(context.Background())
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if after.URL != before.URL || after.Generation != 2 || after.KeyFingerprint == before.KeyFingerprint {
+		t.Fatalf("unexpected rotated account %+v (was %+v)", after, before)
+	}
+	if ca.keyChanges != 1 || ca.keyFor(after.URL) != after.KeyFingerprint {
+		t.Fatalf("CA not switched to the new key: changes=%d", ca.keyChanges)
+	}
+	if len(observed) != 1 || observed[0].Generation != 2 || observed[0].PendingKeyPEM != "" {
+		t.Fatalf("observer not told about the rotation: %+v", observed)
+	}
+
+	// A restart reads the rotated key and does not register again.
+	restarted := NewManager(filepath.Dir(filepath.Dir(m.baseDir)), nil, "", ca.directoryURL())
+	if info, err := restarted.Account(); err != nil || info.KeyFingerprint != after.KeyFingerprint {
+		t.Fatalf("rotated key not persisted: %+v err=%v", info, err)
+	}
+	if _, _, err := restarted.EnsureAccount(); err != nil || ca.registrations != 1 {
+		t.Fatalf("rotated account not reused: registrations=%d err=%v", ca.registrations, err)
+	}
+}
+
+func TestRotateAccountKeyRollsBackOnFailure(t *testing.T) {
+	ca := newFakeCA(t)
+	m, before := registeredManager(t, ca)
+	ca.failKeyChange = true
+
+	if _, err := m.RotateAccountKey(context.Background()); err == nil {
+		t.Fatalf("expected the refused key change to fail")
+	}
+	info, err := m.Account()
+	if err != nil || info.KeyFingerprint != before.KeyFingerprint || info.Generation != 1 {
+		t.Fatalf("old key not kept: %+v err=%v", info, err)
+	}
+	rec, _ := m.ExportAccount()
+	if rec.PendingKeyPEM != "" {
+		t.Fatalf("pending key left behind after rollback")
+	}
+	if ca.keyFor(before.URL) != before.KeyFingerprint {
+		t.Fatalf("CA key changed despite the failure")
+	}
+}
+
+func TestInterruptedRotationSettlesOnNextUse(t *testing.T) {
+	ca := newFakeCA(t)
+	m, before := registeredManager(t, ca)
+	stale, _ := m.ExportAccount()
+	if _, err := m.RotateAccountKey(context.Background()); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	rotated, _ := m.ExportAccount()
+
+	// The CA switched keys but the daemon stopped before recording it.
+	interrupted := *stale
+	interrupted.PendingKeyPEM = rotated.KeyPEM
+	if err := m.ImportAccount(interrupted); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if _, _, err := m.EnsureAccount(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	info, _ := m.Account()
+	if info.KeyFingerprint != ca.keyFor(before.URL) || info.Generation != 2 {
+		t.Fatalf("confirmed pending key not adopted: %+v", info)
+	}
+
+	// A pending key the CA never accepted is dropped.
+	_, unknownPEM, _ := newAccountKey()
+	current, _ := m.ExportAccount()
+	current.PendingKeyPEM = unknownPEM
+	if err := m.ImportAccount(*current); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if _, _, err := m.EnsureAccount(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if rec, _ := m.ExportAccount(); rec.PendingKeyPEM != "" || rec.KeyPEM != current.KeyPEM {
+		t.Fatalf("unconfirmed pending key not dropped")
+	}
+}
+
+func TestAccountExportImportRoundTrip(t *testing.T) {
+	ca := newFakeCA(t)
+	m, before := registeredManager(t, ca)
+	rec, err := m.ExportAccount()
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reinstalled device starts with an empty state directory.
+	reinstalled := NewManager(t.TempDir(), nil, "", ca.directoryURL())
+	var restored AccountRecord
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := reinstalled.ImportAccount(restored); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if info, err := reinstalled.Account(); err != nil || info != before {
+		t.Fatalf("imported account differs: %+v err=%v, want %+v", info, err, before)
+	}
+	if _, _, err := reinstalled.EnsureAccount(); err != nil || ca.registrations != 1 {
+		t.Fatalf("imported account not reused: registrations=%d err=%v", ca.registrations, err)
+	}
+	if _, err := reinstalled.RotateAccountKey(context.Background()); err != nil {
+		t.Fatalf("rotate imported account: %v", err)
+	}
+
+	other := NewManager(t.TempDir(), nil, "", "https://acme-staging-v02.api.letsencrypt.org/directory")
+	if err := other.ImportAccount(restored); err == nil {
+		t.Fatalf("expected an account from another CA to be refused")
+	}
+}
+
+func TestLegacyAccountFilesAreMigrated(t *testing.T) {
+	ca := newFakeCA(t)
+	m := NewManager(t.TempDir(), nil, "", ca.directoryURL())
+	key, keyPEM, err := newAccountKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ensureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	keyPath, regPath := m.accountPaths()
+	url := ca.srv.URL + "/acct/legacy"
+	if err := os.WriteFile(keyPath, []byte(keyPEM), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(regPath, []byte(`{"uri":"`+url+`","body":{"status":"valid"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := m.Account()
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	want, _ := acmepkg.JWKThumbprint(key.Public())
+	if info.URL != url || info.KeyFingerprint != want || info.Generation != 1 {
+		t.Fatalf("legacy account not migrated: %+v", info)
+	}
+	for _, p := range []string{keyPath, regPath} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("legacy file %s kept: %v", p, err)
+		}
+	}
+}
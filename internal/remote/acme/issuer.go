@@ -1,13 +1,11 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"log"
@@ -16,6 +14,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
@@ -28,15 +28,32 @@ import (
 type ChallengeSink interface {
 	Handler() http.Handler
 	Put(token, value string)
-	Delete(token string)
+	Remove(token string)
 }
 
 // Manager orchestrates ACME account and issuance via lego with HTTP-01.
 type Manager struct {
 	baseDir   string
 	directory string
-	email     string
 	sink      ChallengeSink
+	writeKey  KeyWriter
+
+	// rotateMu is held shared by issuance and exclusively by a key
+	// rotation; recordMu guards the account record and observer.
+	rotateMu sync.RWMutex
+	recordMu sync.Mutex
+	observer func(AccountRecord)
+
+	// emailMu guards email, which config saves update while issuance runs.
+	emailMu sync.Mutex
+	email   string
+}
+
+// KeyWriter persists the private key issued for certificate name in dir.
+type KeyWriter func(dir, name string, keyPEM []byte) error
+
+func writePlaintextKey(dir, name string, keyPEM []byte) error {
+	return os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600)
 }
 
 // NewManager constructs a lego-backed ACME manager.
@@ -70,67 +87,17 @@ func (a *account) GetPrivateKey() crypto.PrivateKey        { return a.key }
 
 func (m *Manager) ensureDirs() error { return os.MkdirAll(m.baseDir, 0o700) }
 
+// accountPaths are the files accounts were kept in before AccountRecord.
 func (m *Manager) accountPaths() (keyPath, regPath string) {
 	return filepath.Join(m.baseDir, "account.key"), filepath.Join(m.baseDir, "account.json")
 }
 
-func (m *Manager) loadAccount() (*account, error) {
-	if err := m.ensureDirs(); err != nil {
-		return nil, err
-	}
-	keyPath, regPath := m.accountPaths()
-	b, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, err
-	}
-	key, err := certcrypto.ParsePEMPrivateKey(b)
-	if err != nil {
-		return nil, err
-	}
-	a := &account{Email: m.email}
-	if data, err := os.ReadFile(regPath); err == nil {
-		var res registration.Resource
-		if e := json.Unmarshal(data, &res); e == nil {
-			a.Registration = &res
-		}
-	}
-	// key may be any; cast to *ecdsa.PrivateKey if possible, else wrap
-	switch k := key.(type) {
-	case *ecdsa.PrivateKey:
-		a.key = k
-	default:
-		// regenerate to be safe
-		return nil, errors.New("unsupported key format")
-	}
-	return a, nil
-}
-
-func (m *Manager) saveAccount(a *account) error {
-	if err := m.ensureDirs(); err != nil {
-		return err
-	}
-	keyPath, regPath := m.accountPaths()
-	b, err := pemEncodeEC(a.key)
-	if err != nil {
-		return err
-	}
-	if err := os.WriteFile(keyPath, b, 0o600); err != nil {
-		return err
-	}
-	if a.Registration != nil {
-		data, _ := json.MarshalIndent(a.Registration, "", "  ")
-		_ = os.WriteFile(regPath, data, 0o600)
-	}
-	return nil
-}
-
 func (m *Manager) resetAccountCache() error {
 	keyPath, regPath := m.accountPaths()
-	if err := os.Remove(keyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
-	}
-	if err := os.Remove(regPath); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
+	for _, p := range []string{keyPath, regPath, filepath.Join(m.baseDir, accountRecordFile)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
 	return nil
 }
@@ -159,122 +126,235 @@ func (m *Manager) SetEmail(email string) {
 	if email == "" {
 		return
 	}
+	m.emailMu.Lock()
 	m.email = email
+	m.emailMu.Unlock()
+}
+
+func (m *Manager) contactEmail() string {
+	m.emailMu.Lock()
+	defer m.emailMu.Unlock()
+	return m.email
+}
+
+// SetKeyWriter overrides how issued private keys are stored; by default they
+// are written as plaintext <name>.key files.
+func (m *Manager) SetKeyWriter(w KeyWriter) {
+	m.writeKey = w
 }
 
 // EnsureAccount loads or creates a new ACME account (P-256), accepts TOS.
 func (m *Manager) EnsureAccount() (*lego.Client, *account, error) {
-	if acc, err := m.loadAccount(); err == nil {
-		if acc != nil && acc.Registration != nil && acc.Registration.URI != "" {
-			if regHost, dirHost := hostFromURL(acc.Registration.URI), hostFromURL(m.directory); regHost != "" && dirHost != "" && !strings.EqualFold(regHost, dirHost) {
-				log.Printf("INFO: ACME cached account host %s differs from directory %s; resetting", regHost, dirHost)
-				if err := m.resetAccountCache(); err != nil {
-					return nil, nil, err
-				}
-				acc = nil
-			}
+	return m.ensureAccount(context.Background(), newHTTP01Provider(m.sink))
+}
+
+func (m *Manager) ensureAccount(ctx context.Context, prov *http01Provider) (*lego.Client, *account, error) {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	rec, err := m.loadRecord()
+	if err == nil && !m.sameCA(rec.URL) {
+		log.Printf("INFO: ACME cached account %s is not from directory %s; resetting", rec.URL, m.directory)
+		if err := m.resetAccountCache(); err != nil {
+			return nil, nil, err
 		}
-		if acc != nil {
-			cfg := lego.NewConfig(acc)
-			cfg.CADirURL = m.directory
-			cfg.Certificate.KeyType = certcrypto.EC256
-			cli, err := lego.NewClient(cfg)
-			if err != nil {
-				return nil, nil, err
-			}
-			prov := &http01Provider{sink: m.sink}
-			_ = cli.Challenge.SetHTTP01Provider(prov)
-			if acc.Registration != nil {
-				log.Printf("INFO: ACME loaded cached account %s", acc.Registration.URI)
-			}
-			return cli, acc, nil
+		rec, err = nil, ErrNoAccount
+	}
+	if err != nil && !errors.Is(err, ErrNoAccount) {
+		log.Printf("WARN: ACME account record unreadable, registering a new account: %v", err)
+	}
+	if rec != nil {
+		if rec.PendingKeyPEM != "" {
+			m.settlePendingKey(ctx, rec)
+		}
+		key, err := rec.key()
+		if err != nil {
+			return nil, nil, err
 		}
+		acc := &account{Email: m.contactEmail(), key: key, Registration: &registration.Resource{URI: rec.URL}}
+		cli, err := m.newClient(acc, prov)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("INFO: ACME loaded cached account %s", rec.URL)
+		return cli, acc, nil
 	}
 	// Create new
-	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	acc := &account{Email: m.email, key: key}
-	cfg := lego.NewConfig(acc)
-	cfg.CADirURL = m.directory
-	cfg.Certificate.KeyType = certcrypto.EC256
-	cli, err := lego.NewClient(cfg)
+	key, keyPEM, err := newAccountKey()
 	if err != nil {
 		return nil, nil, err
 	}
-	// HTTP-01 via our sink: use a custom provider that calls sink.Put/Delete
-	prov := &http01Provider{sink: m.sink}
-	if err := cli.Challenge.SetHTTP01Provider(prov); err != nil {
-		return nil, nil, err
-	}
-	// New registration with TOS
-	reg, err := cli.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	accountURL, err := m.register(key)
 	if err != nil {
 		return nil, nil, err
 	}
-	acc.Registration = reg
-	if err := m.saveAccount(acc); err != nil {
+	rec = &AccountRecord{Generation: 1, Directory: m.directory, URL: accountURL, KeyPEM: keyPEM, CreatedAt: time.Now().UTC()}
+	if err := m.saveRecord(rec); err != nil {
 		return nil, nil, err
 	}
-	if acc.Registration != nil {
-		log.Printf("INFO: ACME registered new account %s", acc.Registration.URI)
+	log.Printf("INFO: ACME registered new account %s", accountURL)
+	m.notifyAccount(rec)
+	acc := &account{Email: m.contactEmail(), key: key, Registration: &registration.Resource{URI: accountURL}}
+	cli, err := m.newClient(acc, prov)
+	if err != nil {
+		return nil, nil, err
 	}
 	return cli, acc, nil
 }
 
+func (m *Manager) newClient(acc *account, prov *http01Provider) (*lego.Client, error) {
+	cfg := lego.NewConfig(acc)
+	cfg.CADirURL = m.directory
+	cfg.Certificate.KeyType = certcrypto.EC256
+	cli, err := lego.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if prov != nil {
+		// HTTP-01 via our sink: use a custom provider that calls sink.Put/Remove
+		if err := cli.Challenge.SetHTTP01Provider(prov); err != nil {
+			return nil, err
+		}
+	}
+	return cli, nil
+}
+
+// register creates an account for key, accepting the terms of service, and
+// returns its URL.
+func (m *Manager) register(key *ecdsa.PrivateKey) (string, error) {
+	cli, err := m.newClient(&account{Email: m.contactEmail(), key: key}, nil)
+	if err != nil {
+		return "", err
+	}
+	reg, err := cli.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if err != nil {
+		return "", err
+	}
+	return reg.URI, nil
+}
+
 // Issue writes certificate and key files for the given commonName and SANs.
-func (m *Manager) Issue(commonName string, sans []string, outName string, certDir string) (*tls.Certificate, error) {
+// progress, when non-nil, is called as issuance moves through each Stage.
+//
+// Cancelling ctx aborts the issuance at the next step; a request already
+// sent to the CA runs to completion but its result is discarded.
+func (m *Manager) Issue(ctx context.Context, commonName string, sans []string, outName string, certDir string, progress ProgressFunc) (*tls.Certificate, error) {
+	// lego skips CleanUp on some failure paths; drop whatever this issuance
+	// published once it is over either way.
+	prov := newHTTP01Provider(m.sink)
+	prov.ctx = ctx
+	prov.progress = progress
+	defer prov.removeAll()
+	// A key rotation waits for issuance that already holds the old key.
+	m.rotateMu.RLock()
+	defer m.rotateMu.RUnlock()
 	for attempt := 0; attempt < 2; attempt++ {
-		cli, _, err := m.EnsureAccount()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.report(StageAccount, m.contactEmail())
+		cli, acc, err := m.ensureAccount(ctx, prov)
 		if err != nil {
 			return nil, err
 		}
+		if err := m.withProgress(cli, acc, progress); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		req := certificate.ObtainRequest{Domains: append([]string{commonName}, sans...), Bundle: true}
 		certRes, err := cli.Certificate.Obtain(req)
 		if err != nil {
 			if attempt == 0 && isAccountDoesNotExist(err) {
 				log.Printf("WARN: ACME account invalid, resetting cache and retrying: %v", err)
+				m.recordMu.Lock()
 				if err := m.resetAccountCache(); err != nil {
 					log.Printf("WARN: failed to reset ACME cache: %v", err)
 				}
+				m.recordMu.Unlock()
 				continue
 			}
 			return nil, err
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if err := os.MkdirAll(certDir, 0o700); err != nil {
 			return nil, err
 		}
-		crtPath := filepath.Join(certDir, outName+".crt")
-		keyPath := filepath.Join(certDir, outName+".key")
-		if err := os.WriteFile(crtPath, certRes.Certificate, 0o600); err != nil {
+		writeKey := m.writeKey
+		if writeKey == nil {
+			writeKey = writePlaintextKey
+		}
+		if err := writeKey(certDir, outName, certRes.PrivateKey); err != nil {
 			return nil, err
 		}
-		if err := os.WriteFile(keyPath, certRes.PrivateKey, 0o600); err != nil {
+		crtPath := filepath.Join(certDir, outName+".crt")
+		if err := os.WriteFile(crtPath, certRes.Certificate, 0o600); err != nil {
 			return nil, err
 		}
 		pair, err := tls.X509KeyPair(certRes.Certificate, certRes.PrivateKey)
 		if err != nil {
 			return nil, err
 		}
+		progress.report(StageDownloaded, crtPath)
 		return &pair, nil
 	}
 	return nil, errors.New("acme: failed to obtain certificate after retry")
 }
 
-// http01Provider bridges lego HTTP-01 to our ChallengeSink.
-type http01Provider struct{ sink ChallengeSink }
+// http01Provider bridges lego HTTP-01 to our ChallengeSink. Each issuance
+// gets its own provider so it only removes the tokens it published.
+type http01Provider struct {
+	ctx      context.Context
+	sink     ChallengeSink
+	progress ProgressFunc
+
+	mu     sync.Mutex
+	tokens map[string]struct{}
+}
+
+func newHTTP01Provider(sink ChallengeSink) *http01Provider {
+	return &http01Provider{ctx: context.Background(), sink: sink, tokens: make(map[string]struct{})}
+}
 
 func (p *http01Provider) Present(domain, token, keyAuth string) error {
 	if p.sink == nil {
 		return errors.New("acme: sink unavailable")
 	}
+	// Refusing the challenge is the only way to stop lego mid-order.
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.tokens[token] = struct{}{}
+	p.mu.Unlock()
 	p.sink.Put(token, keyAuth)
+	p.progress.report(StageChallengePresented, domain)
 	return nil
 }
 func (p *http01Provider) CleanUp(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	delete(p.tokens, token)
+	p.mu.Unlock()
 	if p.sink != nil {
-		p.sink.Delete(token)
+		p.sink.Remove(token)
 	}
 	return nil
 }
+
+func (p *http01Provider) removeAll() {
+	p.mu.Lock()
+	tokens := p.tokens
+	p.tokens = make(map[string]struct{})
+	p.mu.Unlock()
+	if p.sink == nil {
+		return
+	}
+	for token := range tokens {
+		p.sink.Remove(token)
+	}
+}
 func (p *http01Provider) GetType() string { return "http-01" }
 
 // PEM encode helper for EC keys
@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"fmt"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/acme/api"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge/resolver"
+	lego "github.com/go-acme/lego/v4/lego"
+)
+
+// Stage names a step of certificate issuance reported to a ProgressFunc.
+type Stage string
+
+const (
+	StageAccount            Stage = "account"
+	StageOrderCreated       Stage = "order_created"
+	StageChallengePresented Stage = "challenge_presented"
+	StageChallengeValid     Stage = "challenge_valid"
+	StageFinalizing         Stage = "finalizing"
+	StageDownloaded         Stage = "downloaded"
+)
+
+// ProgressFunc receives issuance stages in order. detail is a short
+// human-readable note (a domain, an authorization count) and may be empty.
+type ProgressFunc func(stage Stage, detail string)
+
+func (f ProgressFunc) report(stage Stage, detail string) {
+	if f != nil {
+		f(stage, detail)
+	}
+}
+
+// stagedResolver wraps lego's challenge resolver: it runs once the order
+// and its authorizations exist and returns once every challenge is valid.
+type stagedResolver struct {
+	inner    *resolver.Prober
+	progress ProgressFunc
+}
+
+func (r *stagedResolver) Solve(authz []legoacme.Authorization) error {
+	r.progress.report(StageOrderCreated, fmt.Sprintf("%d authorization(s)", len(authz)))
+	if err := r.inner.Solve(authz); err != nil {
+		return err
+	}
+	r.progress.report(StageChallengeValid, "")
+	r.progress.report(StageFinalizing, "")
+	return nil
+}
+
+// withProgress swaps the client's certifier for one that reports stages.
+// lego keeps its API core private, so a second core is built from the
+// same account.
+func (m *Manager) withProgress(cli *lego.Client, acc *account, progress ProgressFunc) error {
+	if progress == nil {
+		return nil
+	}
+	cfg := lego.NewConfig(acc)
+	cfg.CADirURL = m.directory
+	cfg.Certificate.KeyType = certcrypto.EC256
+	kid := ""
+	if acc.Registration != nil {
+		kid = acc.Registration.URI
+	}
+	core, err := api.New(cfg.HTTPClient, cfg.UserAgent, cfg.CADirURL, kid, acc.key)
+	if err != nil {
+		return err
+	}
+	staged := &stagedResolver{inner: resolver.NewProber(cli.Challenge), progress: progress}
+	cli.Certificate = certificate.NewCertifier(core, staged, certificate.CertifierOptions{KeyType: cfg.Certificate.KeyType, Timeout: cfg.Certificate.Timeout})
+	return nil
+}
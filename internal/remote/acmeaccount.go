@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"piccolod/internal/remote/acme"
+)
+
+// ErrNoACMEAccount is returned before the device has registered with the CA.
+var ErrNoACMEAccount = acme.ErrNoAccount
+
+// acmeAccounts is implemented by issuers that hold an ACME account;
+// *acme.Manager outside tests.
+type acmeAccounts interface {
+	Account() (acme.AccountInfo, error)
+	RotateAccountKey(ctx context.Context) (acme.AccountInfo, error)
+	ExportAccount() (*acme.AccountRecord, error)
+	ImportAccount(rec acme.AccountRecord) error
+	SetAccountObserver(fn func(acme.AccountRecord))
+}
+
+func (m *Manager) accounts() (acmeAccounts, bool) {
+	a, ok := m.issuer().(acmeAccounts)
+	return a, ok
+}
+
+func cloneACMEAccount(rec *acme.AccountRecord) *acme.AccountRecord {
+	if rec == nil {
+		return nil
+	}
+	out := *rec
+	return &out
+}
+
+// watchACMEAccount keeps Config.ACMEAccount in step with the issuer's
+// account and restores a stored account the issuer does not have.
+func (m *Manager) watchACMEAccount() {
+	accounts, ok := m.accounts()
+	if !ok {
+		return
+	}
+	accounts.SetAccountObserver(m.recordACMEAccount)
+	m.syncACMEAccount()
+}
+
+func (m *Manager) recordACMEAccount(rec acme.AccountRecord) {
+	err := m.update(func(cfg *Config) error {
+		if cfg.ACMEAccount != nil && *cfg.ACMEAccount == rec {
+			return errNoChange
+		}
+		cfg.ACMEAccount = &rec
+		return nil
+	})
+	if err != nil {
+		log.Printf("WARN: remote: record ACME account: %v", err)
+	}
+}
+
+// syncACMEAccount reconciles the stored account with the issuer's once the
+// encrypted half of the config is readable. The stored account wins when
+// the two name different accounts, since it is what a restored control
+// export carries; for the same account the later key generation wins.
+func (m *Manager) syncACMEAccount() {
+	accounts, ok := m.accounts()
+	if !ok || m.secretsLocked.Load() {
+		return
+	}
+	stored := m.currentConfig().ACMEAccount
+	local, err := accounts.ExportAccount()
+	if err != nil && !errors.Is(err, acme.ErrNoAccount) {
+		log.Printf("WARN: remote: read ACME account: %v", err)
+		return
+	}
+	switch {
+	case stored != nil && (local == nil || stored.URL != local.URL || stored.Generation > local.Generation):
+		if err := accounts.ImportAccount(*stored); err != nil {
+			log.Printf("WARN: remote: restore ACME account %s: %v", stored.URL, err)
+			return
+		}
+		log.Printf("INFO: remote: restored ACME account %s from the stored configuration", stored.URL)
+	case local != nil && (stored == nil || local.Generation > stored.Generation):
+		m.recordACMEAccount(*local)
+	}
+}
+
+// ACMEAccount describes the ACME account certificates are issued under.
+func (m *Manager) ACMEAccount() (acme.AccountInfo, error) {
+	accounts, ok := m.accounts()
+	if !ok {
+		return acme.AccountInfo{}, ErrNoACMEAccount
+	}
+	return accounts.Account()
+}
+
+// RotateACMEAccountKey replaces the ACME account key with a new one; see
+// acme.Manager.RotateAccountKey. The new key is stored in encrypted storage,
+// so the remote credentials must be unlocked.
+func (m *Manager) RotateACMEAccountKey(ctx context.Context) (acme.AccountInfo, error) {
+	if err := m.requireSecrets(); err != nil {
+		return acme.AccountInfo{}, err
+	}
+	accounts, ok := m.accounts()
+	if !ok {
+		return acme.AccountInfo{}, ErrNoACMEAccount
+	}
+	info, err := accounts.RotateAccountKey(ctx)
+	level, msg := "info", fmt.Sprintf("ACME account key rotated (generation %d)", info.Generation)
+	if err != nil {
+		if errors.Is(err, acme.ErrNoAccount) {
+			return acme.AccountInfo{}, err
+		}
+		level, msg = "error", fmt.Sprintf("ACME account key rotation failed; the previous key is still in use: %v", err)
+	}
+	_ = m.update(func(cfg *Config) error {
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     level,
+			Source:    "remote",
+			Message:   msg,
+		})
+		return nil
+	})
+	return info, err
+}
@@ -0,0 +1,174 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"testing"
+
+	"piccolod/internal/remote/acme"
+)
+
+// accountIssuer keeps an ACME account in memory.
+type accountIssuer struct {
+	mu         sync.Mutex
+	rec        *acme.AccountRecord
+	observer   func(acme.AccountRecord)
+	rotateErr  error
+	imported   int
+	rotateKeys []string
+}
+
+func (a *accountIssuer) Issue(context.Context, string, []string, string, string, acme.ProgressFunc) (*tls.Certificate, error) {
+	return nil, errors.New("not issuing")
+}
+func (a *accountIssuer) SetEmail(string)             {}
+func (a *accountIssuer) SetKeyWriter(acme.KeyWriter) {}
+
+func (a *accountIssuer) register(rec acme.AccountRecord) {
+	a.mu.Lock()
+	a.rec = &rec
+	observer := a.observer
+	a.mu.Unlock()
+	observer(rec)
+}
+
+func (a *accountIssuer) Account() (acme.AccountInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rec == nil {
+		return acme.AccountInfo{}, acme.ErrNoAccount
+	}
+	return acme.AccountInfo{URL: a.rec.URL, KeyFingerprint: a.rec.KeyPEM, Generation: a.rec.Generation}, nil
+}
+
+func (a *accountIssuer) RotateAccountKey(ctx context.Context) (acme.AccountInfo, error) {
+	a.mu.Lock()
+	if a.rec == nil {
+		a.mu.Unlock()
+		return acme.AccountInfo{}, acme.ErrNoAccount
+	}
+	if a.rotateErr != nil {
+		a.mu.Unlock()
+		return acme.AccountInfo{}, a.rotateErr
+	}
+	next := *a.rec
+	next.Generation++
+	next.KeyPEM = a.rotateKeys[0]
+	a.rotateKeys = a.rotateKeys[1:]
+	a.rec = &next
+	a.mu.Unlock()
+	a.observer(next)
+	return a.Account()
+}
+
+func (a *accountIssuer) ExportAccount() (*acme.AccountRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rec == nil {
+		return nil, acme.ErrNoAccount
+	}
+	rec := *a.rec
+	return &rec, nil
+}
+
+func (a *accountIssuer) ImportAccount(rec acme.AccountRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rec = &rec
+	a.imported++
+	return nil
+}
+
+func (a *accountIssuer) SetAccountObserver(fn func(acme.AccountRecord)) {
+	a.mu.Lock()
+	a.observer = fn
+	a.mu.Unlock()
+}
+
+func withAccountIssuer(m *Manager) *accountIssuer {
+	issuer := &accountIssuer{rotateKeys: []string{"key-2", "key-3"}}
+	m.acmeMgr = issuer
+	m.watchACMEAccount()
+	return issuer
+}
+
+func TestManager_ACMEAccountKeptInEncryptedConfig(t *testing.T) {
+	m, _ := newClockedManager(t)
+	issuer := withAccountIssuer(m)
+	if _, err := m.ACMEAccount(); !errors.Is(err, ErrNoACMEAccount) {
+		t.Fatalf("expected ErrNoACMEAccount before registration, got %v", err)
+	}
+	if _, err := m.RotateACMEAccountKey(context.Background()); !errors.Is(err, ErrNoACMEAccount) {
+		t.Fatalf("expected ErrNoACMEAccount rotating without an account, got %v", err)
+	}
+
+	issuer.register(acme.AccountRecord{Generation: 1, URL: "https://ca.example/acct/1", KeyPEM: "key-1"})
+	stored, err := m.storage.Load(context.Background())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if stored.ACMEAccount == nil || stored.ACMEAccount.KeyPEM != "key-1" {
+		t.Fatalf("registration not mirrored into the config: %+v", stored.ACMEAccount)
+	}
+	if !stored.HasSecrets() || stored.WithoutSecrets().ACMEAccount != nil {
+		t.Fatalf("account key not treated as an encrypted-only field")
+	}
+
+	info, err := m.RotateACMEAccountKey(context.Background())
+	if err != nil || info.Generation != 2 {
+		t.Fatalf("rotate: %+v err=%v", info, err)
+	}
+	if got := m.currentConfig().ACMEAccount; got == nil || got.KeyPEM != "key-2" || got.Generation != 2 {
+		t.Fatalf("rotated key not mirrored: %+v", got)
+	}
+	if !hasEvent(m, "ACME account key rotated (generation 2)") {
+		t.Fatalf("rotation not recorded: %+v", m.ListEvents())
+	}
+
+	issuer.rotateErr = errors.New("key change refused")
+	if _, err := m.RotateACMEAccountKey(context.Background()); err == nil {
+		t.Fatalf("expected the failed rotation to be reported")
+	}
+	if got := m.currentConfig().ACMEAccount; got.KeyPEM != "key-2" {
+		t.Fatalf("failed rotation changed the stored key: %+v", got)
+	}
+	if !hasEvent(m, "the previous key is still in use") {
+		t.Fatalf("failed rotation not recorded: %+v", m.ListEvents())
+	}
+
+	m.secretsLocked.Store(true)
+	if _, err := m.RotateACMEAccountKey(context.Background()); !errors.Is(err, ErrUnlockRequired) {
+		t.Fatalf("expected ErrUnlockRequired while locked, got %v", err)
+	}
+}
+
+func TestManager_ACMEAccountRestoredFromConfig(t *testing.T) {
+	m, _ := newClockedManager(t)
+	issuer := withAccountIssuer(m)
+	issuer.register(acme.AccountRecord{Generation: 3, URL: "https://ca.example/acct/7", KeyPEM: "key-3"})
+
+	// A reinstalled device with a restored control store: same config, no
+	// local account.
+	restored, err := newManagerWithDeps(m.storage, t.TempDir(), &stubDialer{}, &stubResolver{}, m.now)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = restored.Close(context.Background()) })
+	fresh := withAccountIssuer(restored)
+	if fresh.imported != 1 || fresh.rec == nil || *fresh.rec != *issuer.rec {
+		t.Fatalf("stored account not restored: %+v", fresh.rec)
+	}
+
+	// A local account ahead of the stored one is written back instead.
+	ahead := *issuer.rec
+	ahead.Generation = 4
+	ahead.KeyPEM = "key-4"
+	local := &accountIssuer{rec: &ahead}
+	restored.acmeMgr = local
+	restored.watchACMEAccount()
+	if local.imported != 0 || restored.currentConfig().ACMEAccount.KeyPEM != "key-4" {
+		t.Fatalf("newer local key not recorded: imported=%d stored=%+v", local.imported, restored.currentConfig().ACMEAccount)
+	}
+}
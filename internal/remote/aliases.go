@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxAliasesEnv overrides how many aliases may be configured. Every alias
+// costs a certificate order, so the cap keeps a runaway client from tripping
+// the CA's rate limits for the whole domain.
+const maxAliasesEnv = "PICCOLO_REMOTE_MAX_ALIASES"
+
+const defaultMaxAliases = 50
+
+// AliasOptions are the optional settings of a new alias.
+type AliasOptions struct {
+	// RedirectTo answers requests for the alias with a 308 to this hostname
+	// instead of serving the listener. With IncludeWWW it may name the
+	// alias or its www variant, in which case only the other name redirects.
+	RedirectTo string
+	// IncludeWWW also serves www.<hostname>, on the same certificate.
+	IncludeWWW bool
+}
+
+// ErrRedirectLoop is returned when an alias redirect would lead back to
+// itself.
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// ErrAliasLimit is returned when adding an alias would exceed the cap.
+var ErrAliasLimit = errors.New("remote: alias limit reached")
+
+// AliasExistsError is returned when an alias for the hostname already
+// exists; ID names it.
+type AliasExistsError struct {
+	Hostname string
+	ID       string
+}
+
+func (e *AliasExistsError) Error() string {
+	return fmt.Sprintf("alias %s already exists", e.Hostname)
+}
+
+// maxAliasesFromEnv returns the alias cap, maxAliasesEnv or the default.
+func maxAliasesFromEnv() int {
+	v := strings.TrimSpace(os.Getenv(maxAliasesEnv))
+	if v == "" {
+		return defaultMaxAliases
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("WARN: remote: ignoring %s=%q; using %d", maxAliasesEnv, v, defaultMaxAliases)
+		return defaultMaxAliases
+	}
+	return n
+}
+
+// checkNewAlias validates a new alias for hostname against cfg. Names under
+// the managed domain are refused: listener hostnames and the wildcard cover
+// them already, and a second certificate for one only spends CA quota. The
+// domain itself is not covered and stays allowed.
+func (m *Manager) checkNewAlias(cfg *Config, hostname string) error {
+	for _, a := range cfg.Aliases {
+		if strings.EqualFold(a.Hostname, hostname) {
+			return &AliasExistsError{Hostname: hostname, ID: a.ID}
+		}
+	}
+	if strings.EqualFold(hostname, cfg.PortalHostname) {
+		return &HostnameError{Field: "hostname", Input: hostname, Reason: fmt.Sprintf("%s is the portal hostname", hostname)}
+	}
+	if cfg.TLD != "" && strings.HasSuffix(hostname, "."+strings.ToLower(cfg.TLD)) {
+		log.Printf("WARN: remote: refusing alias %s under the managed domain %s", hostname, cfg.TLD)
+		return &HostnameError{Field: "hostname", Input: hostname, Reason: fmt.Sprintf("%s is under %s, which listener hostnames and the wildcard already cover", hostname, cfg.TLD)}
+	}
+	if len(cfg.Aliases) >= m.maxAliases {
+		return fmt.Errorf("%w: %d aliases configured; remove one before adding another", ErrAliasLimit, len(cfg.Aliases))
+	}
+	return nil
+}
+
+// Names lists the hostnames the alias answers for: its hostname and, with
+// IncludeWWW, the www variant.
+func (a Alias) Names() []string {
+	if a.IncludeWWW {
+		return []string{a.Hostname, "www." + a.Hostname}
+	}
+	return []string{a.Hostname}
+}
+
+// RedirectFor returns where requests for host are redirected, or "" when
+// host is served by the listener.
+func (a Alias) RedirectFor(host string) string {
+	if a.RedirectTo == "" || strings.EqualFold(host, a.RedirectTo) {
+		return ""
+	}
+	return a.RedirectTo
+}
+
+// normalizeAliasOptions validates opts for an alias on hostname.
+func normalizeAliasOptions(hostname string, opts AliasOptions) (AliasOptions, error) {
+	if opts.IncludeWWW && strings.HasPrefix(hostname, "www.") {
+		return AliasOptions{}, &HostnameError{Field: "include_www", Input: hostname, Reason: fmt.Sprintf("%s already is a www hostname", hostname)}
+	}
+	if strings.TrimSpace(opts.RedirectTo) == "" {
+		opts.RedirectTo = ""
+		return opts, nil
+	}
+	target, _, err := normalizeHostname("redirect_to", opts.RedirectTo)
+	if err != nil {
+		return AliasOptions{}, err
+	}
+	if target == hostname && !opts.IncludeWWW {
+		return AliasOptions{}, fmt.Errorf("%w: %s redirects to itself", ErrRedirectLoop, hostname)
+	}
+	opts.RedirectTo = target
+	return opts, nil
+}
+
+// checkAliasRedirects rejects candidate when one of its names is already in
+// use or when following redirects from it comes back around. The portal
+// hostname never redirects, so a chain reaching it ends there.
+func checkAliasRedirects(cfg *Config, candidate Alias) error {
+	next := make(map[string]string)
+	taken := map[string]string{strings.ToLower(cfg.PortalHostname): "the portal hostname"}
+	for _, a := range cfg.Aliases {
+		for _, name := range a.Names() {
+			taken[name] = "alias " + a.Hostname
+			if target := a.RedirectFor(name); target != "" {
+				next[name] = target
+			}
+		}
+	}
+	for _, name := range candidate.Names() {
+		if owner, ok := taken[name]; ok {
+			return fmt.Errorf("%s is already used by %s", name, owner)
+		}
+		if target := candidate.RedirectFor(name); target != "" {
+			next[name] = target
+		}
+	}
+	for _, start := range candidate.Names() {
+		path := []string{start}
+		seen := map[string]bool{start: true}
+		for host := next[start]; host != ""; host = next[host] {
+			path = append(path, host)
+			if seen[host] {
+				return fmt.Errorf("%w: %s", ErrRedirectLoop, strings.Join(path, " -> "))
+			}
+			seen[host] = true
+		}
+	}
+	return nil
+}
+
+// certDomainsMatch reports whether certificate id covers exactly names, so a
+// certificate kept from an alias added without its www variant is not
+// reclaimed for one added with it, or the other way around.
+func certDomainsMatch(cfg *Config, id string, names []string) bool {
+	for _, c := range cfg.Certificates {
+		if c.ID != id {
+			continue
+		}
+		if len(c.Domains) != len(names) {
+			return false
+		}
+		for i := range names {
+			if !strings.EqualFold(c.Domains[i], names[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
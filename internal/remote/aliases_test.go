@@ -0,0 +1,220 @@
+package remote
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddAliasWithWWWIssuesOneCertificateForBothNames(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	alias, err := m.AddAlias("portal", "shop.example.net", AliasOptions{IncludeWWW: true, RedirectTo: "Shop.Example.Net."})
+	if err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	if alias.RedirectTo != "shop.example.net" || !alias.IncludeWWW {
+		t.Fatalf("unexpected alias: %+v", alias)
+	}
+	if got := alias.RedirectFor("www.shop.example.net"); got != "shop.example.net" {
+		t.Fatalf("www variant should redirect to the bare name, got %q", got)
+	}
+	if got := alias.RedirectFor("shop.example.net"); got != "" {
+		t.Fatalf("bare name should be served, got redirect to %q", got)
+	}
+
+	cert, ok := settledCertificates(t, m)["alias:shop.example.net"]
+	if !ok || cert.Status != "ok" {
+		t.Fatalf("alias certificate not issued: %+v", cert)
+	}
+	want := []string{"shop.example.net", "www.shop.example.net"}
+	if !reflect.DeepEqual(cert.Domains, want) {
+		t.Fatalf("expected domains %v, got %v", want, cert.Domains)
+	}
+
+	prov := NewFileCertProvider(m.certDir())
+	for _, host := range want {
+		tlsCert, err := prov.GetCertificate(host)
+		if err != nil {
+			t.Fatalf("no certificate for %s: %v", host, err)
+		}
+		leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		for _, name := range want {
+			if err := leaf.VerifyHostname(name); err != nil {
+				t.Fatalf("certificate served for %s does not cover %s: %v", host, name, err)
+			}
+		}
+	}
+
+	listed := m.ListAliases()
+	if len(listed) != 1 || listed[0].RedirectTo != "shop.example.net" || !listed[0].IncludeWWW {
+		t.Fatalf("alias fields not persisted: %+v", listed)
+	}
+}
+
+func TestAddAliasRejectsRedirectLoops(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	if _, err := m.AddAlias("portal", "a.example.net", AliasOptions{RedirectTo: "b.example.net"}); err != nil {
+		t.Fatalf("redirect to a name not yet served: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "b.example.net", AliasOptions{RedirectTo: "a.example.net"}); !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("expected loop between aliases to be rejected, got %v", err)
+	}
+	if _, err := m.AddAlias("portal", "c.example.net", AliasOptions{RedirectTo: "c.example.net"}); !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("expected self redirect to be rejected, got %v", err)
+	}
+	// www.d redirects to d and d to www.d.
+	if _, err := m.AddAlias("portal", "d.example.net", AliasOptions{IncludeWWW: true, RedirectTo: "www.d.example.net"}); err != nil {
+		t.Fatalf("bare name redirecting to its www variant: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "www.d.example.net", AliasOptions{}); err == nil {
+		t.Fatalf("expected the www variant of an existing alias to be refused")
+	}
+	if _, err := m.AddAlias("portal", "e.example.net", AliasOptions{RedirectTo: "portal.example.com"}); err != nil {
+		t.Fatalf("redirect to the portal: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "f.example.net", AliasOptions{RedirectTo: "e.example.net"}); err != nil {
+		t.Fatalf("chain ending at the portal: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "example.com", AliasOptions{IncludeWWW: true}); err != nil {
+		t.Fatalf("apex with www: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "www.example.org", AliasOptions{IncludeWWW: true}); err == nil {
+		t.Fatalf("expected include_www on a www hostname to be refused")
+	}
+	if got := len(m.ListAliases()); got != 5 {
+		t.Fatalf("expected five aliases, got %d: %+v", got, m.ListAliases())
+	}
+}
+
+func TestAddAliasRejectsDuplicatesAndManagedNames(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	first, err := m.AddAlias("portal", "shop.example.net", AliasOptions{})
+	if err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	var exists *AliasExistsError
+	if _, err := m.AddAlias("portal", "Shop.Example.NET.", AliasOptions{}); !errors.As(err, &exists) || exists.ID != first.ID {
+		t.Fatalf("expected duplicate to name %s, got %v", first.ID, err)
+	}
+
+	var hostErr *HostnameError
+	for _, host := range []string{"portal.example.com", "blog.example.com", "a.b.Example.com"} {
+		if _, err := m.AddAlias("portal", host, AliasOptions{}); !errors.As(err, &hostErr) || hostErr.Field != "hostname" {
+			t.Fatalf("%s: expected hostname error, got %v", host, err)
+		}
+	}
+	for _, host := range []string{"bad_name.example.net", "-shop.example.net", "co.uk"} {
+		if _, err := m.AddAlias("portal", host, AliasOptions{}); !errors.As(err, &hostErr) {
+			t.Fatalf("%s: expected hostname error, got %v", host, err)
+		}
+	}
+	alias, err := m.AddAlias("portal", "bücher.example.net", AliasOptions{})
+	if err != nil || alias.Hostname != "xn--bcher-kva.example.net" {
+		t.Fatalf("expected punycode alias, got %+v err=%v", alias, err)
+	}
+	if got := len(m.ListAliases()); got != 2 {
+		t.Fatalf("expected two aliases, got %d: %+v", got, m.ListAliases())
+	}
+}
+
+func TestAddAliasEnforcesCap(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	m.maxAliases = 2
+	for _, host := range []string{"a.example.net", "b.example.net"} {
+		if _, err := m.AddAlias("portal", host, AliasOptions{}); err != nil {
+			t.Fatalf("add %s: %v", host, err)
+		}
+	}
+	if _, err := m.AddAlias("portal", "c.example.net", AliasOptions{}); !errors.Is(err, ErrAliasLimit) {
+		t.Fatalf("expected alias limit, got %v", err)
+	}
+	var exists *AliasExistsError
+	if _, err := m.AddAlias("portal", "a.example.net", AliasOptions{}); !errors.As(err, &exists) {
+		t.Fatalf("duplicate at the cap should still report the existing alias, got %v", err)
+	}
+	if err := m.RemoveAlias(m.ListAliases()[0].ID); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := m.AddAlias("portal", "c.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("add after removal: %v", err)
+	}
+}
+
+func TestMaxAliasesFromEnv(t *testing.T) {
+	for value, want := range map[string]int{"": defaultMaxAliases, "5": 5, "0": defaultMaxAliases, "many": defaultMaxAliases} {
+		t.Setenv(maxAliasesEnv, value)
+		if got := maxAliasesFromEnv(); got != want {
+			t.Fatalf("%s=%q: got %d, want %d", maxAliasesEnv, value, got, want)
+		}
+	}
+}
+
+func TestAddAliasConcurrentSameHostname(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.AddAlias("portal", "race.example.net", AliasOptions{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	added := 0
+	for err := range errs {
+		var exists *AliasExistsError
+		switch {
+		case err == nil:
+			added++
+		case !errors.As(err, &exists):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if added != 1 || len(m.ListAliases()) != 1 {
+		t.Fatalf("expected exactly one alias, added=%d listed=%+v", added, m.ListAliases())
+	}
+	settledCertificates(t, m)
+}
+
+func TestIssuanceIsNotStartedTwiceForOneCertificate(t *testing.T) {
+	issuer := &blockingIssuer{started: make(chan string, 4)}
+	m, _ := newCloseTestManager(t, issuer)
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+
+	domains := []string{"shop.example.net"}
+	m.enqueueIssuance("alias:shop.example.net", domains, "shop.example.net")
+	select {
+	case <-issuer.started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("issuance did not start")
+	}
+	for i := 0; i < 3; i++ {
+		m.enqueueIssuance("alias:shop.example.net", domains, "shop.example.net")
+		m.startIssuance("alias:shop.example.net", domains, "shop.example.net")
+	}
+	m.enqueueIssuance("alias:other.example.net", []string{"other.example.net"}, "other.example.net")
+	select {
+	case cn := <-issuer.started:
+		if cn != "other.example.net" {
+			t.Fatalf("second issuance started for %s", cn)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("issuance for another certificate did not start")
+	}
+	select {
+	case cn := <-issuer.started:
+		t.Fatalf("parallel issuance started for %s", cn)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
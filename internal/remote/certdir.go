@@ -0,0 +1,343 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Certificate storage classes, reported in Status and kept in
+// Config.CertStorage. An empty Config.CertStorage is the bootstrap default,
+// which moves into the encrypted volume once one is attached.
+const (
+	// CertStorageBootstrap is <bootstrap>/remote/certs, readable before
+	// unlock and not encrypted at rest.
+	CertStorageBootstrap = "bootstrap-plaintext"
+	// CertStorageEncrypted is <encrypted volume>/remote/certs.
+	CertStorageEncrypted = "encrypted"
+	// CertStorageCustom is a directory chosen with SetCertDirectory.
+	CertStorageCustom = "custom"
+)
+
+// CertStorage is where certificate material currently lives.
+type CertStorage struct {
+	Path  string `json:"path"`
+	Class string `json:"class"`
+	// Ready is false while the directory is inside an encrypted volume that
+	// has not been unlocked yet; issuance waits for it.
+	Ready bool `json:"ready"`
+}
+
+// ErrCertDirNotEmpty is returned when the target of a certificate move
+// already holds files.
+var ErrCertDirNotEmpty = errors.New("remote: certificate directory not empty")
+
+// certFileExts are the per-certificate files issuance writes.
+var certFileExts = []string{".crt", plaintextKeyExt, sealedKeyExt, ".pem"}
+
+func (m *Manager) bootstrapCertDir() string {
+	return filepath.Join(m.base(), "remote", "certs")
+}
+
+// encryptedCertDir returns <root>/remote/certs once an encrypted root has
+// been attached.
+func (m *Manager) encryptedCertDir() string {
+	m.certDirMu.Lock()
+	root := m.encryptedRoot
+	m.certDirMu.Unlock()
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, "remote", "certs")
+}
+
+// certStorage resolves the certificate directory from cfg. The default
+// locations are derived from the current state directory rather than the
+// path recorded in cfg, so they follow PICCOLO_STATE_DIR; the recorded path
+// is only used for an encrypted location before unlock.
+func (m *Manager) certStorage(cfg *Config) CertStorage {
+	switch cfg.CertStorage {
+	case CertStorageEncrypted:
+		if dir := m.encryptedCertDir(); dir != "" {
+			return CertStorage{Path: dir, Class: CertStorageEncrypted, Ready: true}
+		}
+		return CertStorage{Path: cfg.CertDir, Class: CertStorageEncrypted}
+	case CertStorageCustom:
+		if cfg.CertDir != "" {
+			return CertStorage{Path: cfg.CertDir, Class: CertStorageCustom, Ready: true}
+		}
+	}
+	return CertStorage{Path: m.bootstrapCertDir(), Class: CertStorageBootstrap, Ready: true}
+}
+
+// CertStorage reports where certificate material lives.
+func (m *Manager) CertStorage() CertStorage {
+	return m.certStorage(m.currentConfig())
+}
+
+// certStorageReady reports whether certificates can be written now.
+func (m *Manager) certStorageReady() bool {
+	cfg := m.cfg.Load()
+	if cfg == nil {
+		return true
+	}
+	return m.certStorage(cfg).Ready
+}
+
+// AttachCertProvider hands the manager the provider serving its
+// certificates so a move can switch it to the new directory.
+func (m *Manager) AttachCertProvider(p *FileCertProvider) {
+	m.certDirMu.Lock()
+	m.certProvider = p
+	m.certDirMu.Unlock()
+	if p != nil {
+		p.SetBase(m.CertStorage().Path)
+	}
+}
+
+// SetEncryptedRoot records where the encrypted volume is mounted, once it
+// is unlocked. Certificates still at the bootstrap default move into it.
+func (m *Manager) SetEncryptedRoot(root string) error {
+	root = strings.TrimSpace(root)
+	if root == "" {
+		return nil
+	}
+	m.certDirMu.Lock()
+	m.encryptedRoot = filepath.Clean(root)
+	m.certDirMu.Unlock()
+	if m.currentConfig().CertStorage != "" {
+		// A chosen location stays put; an encrypted one just became ready.
+		m.publishConfigChanged()
+		return nil
+	}
+	return m.moveCertStorage(CertStorageEncrypted, "")
+}
+
+// SetCertDirectory moves certificate material to dir. An empty dir returns
+// it to the default: the encrypted volume when one is attached, the
+// bootstrap volume otherwise.
+func (m *Manager) SetCertDirectory(dir string) error {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		class := ""
+		if m.encryptedCertDir() != "" {
+			class = CertStorageEncrypted
+		}
+		return m.moveCertStorage(class, "")
+	}
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("certificate directory must be an absolute path")
+	}
+	dir = filepath.Clean(dir)
+	switch dir {
+	case m.bootstrapCertDir():
+		return m.moveCertStorage(CertStorageBootstrap, "")
+	case m.encryptedCertDir():
+		return m.moveCertStorage(CertStorageEncrypted, "")
+	}
+	return m.moveCertStorage(CertStorageCustom, dir)
+}
+
+// moveCertStorage copies the certificate directory to its new location,
+// switches the config and the provider over, then removes the old copy.
+// Issuance still writing into the old directory is settled by endIssue.
+func (m *Manager) moveCertStorage(class, custom string) error {
+	m.certMoveMu.Lock()
+	defer m.certMoveMu.Unlock()
+	from := m.certStorage(m.currentConfig())
+	to := m.certStorage(&Config{CertStorage: class, CertDir: custom})
+	if from.Path == to.Path {
+		return m.update(func(cfg *Config) error {
+			if cfg.CertStorage == class && cfg.CertDir == to.Path {
+				return errNoChange
+			}
+			cfg.CertStorage, cfg.CertDir = class, to.Path
+			return nil
+		})
+	}
+	if !from.Ready {
+		return fmt.Errorf("%w: certificates are in an encrypted volume that is not unlocked", ErrLocked)
+	}
+	if err := copyCertTree(from.Path, to.Path); err != nil {
+		return fmt.Errorf("move certificates to %s: %w", to.Path, err)
+	}
+	err := m.update(func(cfg *Config) error {
+		cfg.CertStorage, cfg.CertDir = class, to.Path
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificates moved from %s to %s (%s)", from.Path, to.Path, class),
+		})
+		return nil
+	})
+	if err != nil {
+		_ = os.RemoveAll(to.Path)
+		return err
+	}
+	m.certDirMu.Lock()
+	provider := m.certProvider
+	m.certDirMu.Unlock()
+	if provider != nil {
+		provider.SetBase(to.Path)
+	}
+	m.issueMu.Lock()
+	if m.issuingIn[from.Path] > 0 {
+		m.retiredCertDirs[from.Path] = true
+	} else if err := os.RemoveAll(from.Path); err != nil {
+		log.Printf("WARN: remote: remove old certificate directory %s: %v", from.Path, err)
+	}
+	m.issueMu.Unlock()
+	m.publishConfigChanged()
+	return nil
+}
+
+// beginIssue returns the directory issuance should write to and marks it
+// in use until endIssue.
+func (m *Manager) beginIssue() string {
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+	dir := m.certDir()
+	m.issuingIn[dir]++
+	return dir
+}
+
+// endIssue moves the files of an issuance that wrote to a directory which
+// has since been retired, so certificates issued across a move still land
+// in the new location.
+func (m *Manager) endIssue(dir, outName string) {
+	m.certMoveMu.Lock()
+	defer m.certMoveMu.Unlock()
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+	m.issuingIn[dir]--
+	if m.issuingIn[dir] <= 0 {
+		delete(m.issuingIn, dir)
+	}
+	current := m.certDir()
+	if dir == current {
+		return
+	}
+	if err := os.MkdirAll(current, 0o700); err != nil {
+		log.Printf("WARN: remote: create %s: %v", current, err)
+		return
+	}
+	for _, ext := range certFileExts {
+		src := filepath.Join(dir, outName+ext)
+		if !fileExists(src) {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(current, outName+ext)); err != nil {
+			log.Printf("WARN: remote: move %s to %s: %v", src, current, err)
+			continue
+		}
+		_ = os.Remove(src)
+	}
+	if m.retiredCertDirs[dir] && m.issuingIn[dir] == 0 {
+		delete(m.retiredCertDirs, dir)
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("WARN: remote: remove old certificate directory %s: %v", dir, err)
+		}
+	}
+}
+
+// copyCertTree copies from into a staging directory next to to and renames
+// it into place, so to appears complete or not at all. to must be missing or
+// empty. A missing from leaves an empty to.
+func copyCertTree(from, to string) error {
+	if entries, err := os.ReadDir(to); err == nil {
+		if len(entries) > 0 {
+			return ErrCertDirNotEmpty
+		}
+		if err := os.Remove(to); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	parent := filepath.Dir(to)
+	if err := os.MkdirAll(parent, 0o700); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(to)+"-move-")
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == from {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(staging, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dst, 0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			// Export links are relative, so they stay valid.
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dst)
+		case d.Type().IsRegular():
+			return copyFile(path, dst)
+		}
+		return nil
+	})
+	if err == nil {
+		err = os.Chmod(staging, 0o700)
+	}
+	if err == nil {
+		err = os.Rename(staging, to)
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return err
+	}
+	return nil
+}
+
+// copyFile copies src to dst atomically, keeping its permissions.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"piccolod/internal/remote/acme"
+)
+
+func TestManager_CertStorageMovesExistingFiles(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	if st := m.Status().CertStorage; st.Class != CertStorageBootstrap || st.Path != m.bootstrapCertDir() || !st.Ready {
+		t.Fatalf("unexpected initial storage %+v", st)
+	}
+	if _, err := m.SetCertificateExport("portal", CertExportRequest{Enabled: true}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	chain, _ := m.CertificateChain("portal")
+	oldDir := m.certDir()
+
+	// The provider has never loaded the certificate, so serving it after
+	// the move proves it reads from the new directory.
+	provider := NewFileCertProvider(oldDir)
+	provider.SetPortalHostname("portal.example.com")
+	m.AttachCertProvider(provider)
+
+	root := t.TempDir()
+	if err := m.SetEncryptedRoot(root); err != nil {
+		t.Fatalf("attach encrypted root: %v", err)
+	}
+	st := m.Status().CertStorage
+	if st.Class != CertStorageEncrypted || st.Path != filepath.Join(root, "remote", "certs") || !st.Ready {
+		t.Fatalf("unexpected storage after unlock %+v", st)
+	}
+	if _, err := os.Stat(oldDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("old certificate directory kept: %v", err)
+	}
+	if moved, err := m.CertificateChain("portal"); err != nil || !bytes.Equal(moved, chain) {
+		t.Fatalf("certificate not moved: %v", err)
+	}
+	if provider.Base() != st.Path {
+		t.Fatalf("provider still reads %s", provider.Base())
+	}
+	if cert, err := provider.GetCertificate("portal.example.com"); err != nil || cert == nil {
+		t.Fatalf("provider lost the portal certificate: %v", err)
+	}
+	if live := readLive(t, m, "portal", "fullchain.pem"); !bytes.Equal(live, chain) {
+		t.Fatalf("export link broken by the move")
+	}
+	if !hasEvent(m, "Certificates moved from "+oldDir) {
+		t.Fatalf("move not recorded: %+v", m.ListEvents())
+	}
+
+	// A non-empty target is refused and nothing changes.
+	busy := t.TempDir()
+	if err := os.WriteFile(filepath.Join(busy, "other.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetCertDirectory(busy); !errors.Is(err, ErrCertDirNotEmpty) {
+		t.Fatalf("expected ErrCertDirNotEmpty, got %v", err)
+	}
+	if m.certDir() != st.Path {
+		t.Fatalf("failed move changed the directory to %s", m.certDir())
+	}
+
+	custom := filepath.Join(t.TempDir(), "certs")
+	if err := m.SetCertDirectory(custom); err != nil {
+		t.Fatalf("custom directory: %v", err)
+	}
+	if st := m.Status().CertStorage; st.Class != CertStorageCustom || st.Path != custom {
+		t.Fatalf("unexpected custom storage %+v", st)
+	}
+	if err := m.SetCertDirectory("relative/certs"); err == nil {
+		t.Fatalf("expected a relative directory to be refused")
+	}
+	// A chosen directory is not moved by a later unlock.
+	if err := m.SetEncryptedRoot(root); err != nil || m.certDir() != custom {
+		t.Fatalf("unlock moved a chosen directory: dir=%s err=%v", m.certDir(), err)
+	}
+	if err := m.SetCertDirectory(""); err != nil || m.certDir() != filepath.Join(root, "remote", "certs") {
+		t.Fatalf("reset to default: dir=%s err=%v", m.certDir(), err)
+	}
+}
+
+func TestManager_CertStorageWaitsForEncryptedVolume(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	root := t.TempDir()
+	if err := m.SetEncryptedRoot(root); err != nil {
+		t.Fatalf("attach encrypted root: %v", err)
+	}
+	// A restart forgets the root until the next unlock.
+	m.certDirMu.Lock()
+	m.encryptedRoot = ""
+	m.certDirMu.Unlock()
+	st := m.Status().CertStorage
+	if st.Class != CertStorageEncrypted || st.Ready || st.Path != filepath.Join(root, "remote", "certs") {
+		t.Fatalf("unexpected storage before unlock %+v", st)
+	}
+	if m.canIssue("portal.example.com") {
+		t.Fatalf("issuance allowed before the encrypted volume is unlocked")
+	}
+	if err := m.SetCertDirectory(filepath.Join(t.TempDir(), "certs")); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked moving out of a locked volume, got %v", err)
+	}
+}
+
+// gatedIssuer writes a self-signed certificate once release is closed.
+type gatedIssuer struct {
+	started chan string
+	release chan struct{}
+}
+
+func (g *gatedIssuer) Issue(ctx context.Context, commonName string, sans []string, outName, certDir string, progress acme.ProgressFunc) (*tls.Certificate, error) {
+	g.started <- certDir
+	<-g.release
+	if _, err := writeSelfSignedCertificate(certDir, outName, commonName, []string{commonName}, func(dir, name string, keyPEM []byte) error {
+		return writePrivateKey(dir, name, keyPEM, nil)
+	}); err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{}, nil
+}
+
+func (g *gatedIssuer) SetEmail(string)             {}
+func (g *gatedIssuer) SetKeyWriter(acme.KeyWriter) {}
+
+func TestManager_IssuanceDuringCertMoveLandsInNewDirectory(t *testing.T) {
+	m, _, advance := newPruneTestManager(t)
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "0")
+	before, _ := m.CertificateChain("portal")
+	// Let the initial issuance finish saving before swapping the issuer.
+	m.workers.Wait()
+	issuer := &gatedIssuer{started: make(chan string, 1), release: make(chan struct{})}
+	m.acmeMgr = issuer
+
+	advance(time.Hour)
+	if err := m.RenewCertificate("portal"); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	var oldDir string
+	select {
+	case oldDir = <-issuer.started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("issuance did not start")
+	}
+	newDir := filepath.Join(t.TempDir(), "certs")
+	if err := m.SetCertDirectory(newDir); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if _, err := os.Stat(oldDir); err != nil {
+		t.Fatalf("old directory removed while issuance still writes to it: %v", err)
+	}
+	close(issuer.release)
+	if certs := settledCertificates(t, m); certs["portal"].Status != "ok" {
+		t.Fatalf("renewal failed: %+v", certs["portal"])
+	}
+
+	renewed, err := os.ReadFile(filepath.Join(newDir, "portal.crt"))
+	if err != nil || bytes.Equal(renewed, before) {
+		t.Fatalf("renewed certificate did not land in the new directory: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(filepath.Join(newDir, "portal.crt"), filepath.Join(newDir, "portal.key")); err != nil {
+		t.Fatalf("moved certificate and key do not match: %v", err)
+	}
+	if _, err := os.Stat(oldDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("old directory kept after issuance finished: %v", err)
+	}
+}
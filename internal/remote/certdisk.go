@@ -0,0 +1,203 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CertificateFile describes the certificate chain found on disk for an
+// inventory entry. The leaf is the first certificate in the file.
+type CertificateFile struct {
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	SANs         []string  `json:"sans"`
+	KeyType      string    `json:"key_type"`
+	KeyBits      int       `json:"key_bits,omitempty"`
+	// ChainLength counts the certificates in the file, leaf included.
+	ChainLength int `json:"chain_length"`
+}
+
+// certFileEntry is a parsed certificate file and the modification time and
+// size it was parsed at.
+type certFileEntry struct {
+	modTime time.Time
+	size    int64
+	file    *CertificateFile
+	err     error
+}
+
+// expiryTolerance absorbs the sub-second precision lost when expiry times
+// are stored.
+const expiryTolerance = time.Second
+
+// overlayCertificateFiles replaces the recorded expiry of each certificate
+// with the one in its file when they differ, and flags entries whose file
+// is missing or disagrees with the inventory. Parsed files are cached by
+// modification time, so polling the inventory only stats the files.
+func (m *Manager) overlayCertificateFiles(certs []Certificate) {
+	dir := m.certDir()
+	if dir == "" {
+		return
+	}
+	m.certFileMu.Lock()
+	defer m.certFileMu.Unlock()
+	seen := make(map[string]bool, len(certs))
+	for i := range certs {
+		c := &certs[i]
+		name := certFileName(*c)
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name+".crt")
+		seen[path] = true
+		entry, err := m.certFileLocked(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Entries that were never issued have no file to miss.
+			c.MissingOnDisk = c.ExpiresAt != nil || c.Status == "ok"
+			continue
+		}
+		if err == nil {
+			err = entry.err
+		}
+		if err != nil {
+			c.DiskError = err.Error()
+			c.DiskMatchesInventory = boolPtr(false)
+			continue
+		}
+		file := *entry.file
+		file.SANs = append([]string(nil), entry.file.SANs...)
+		c.Disk = &file
+		c.DiskMatchesInventory = boolPtr(certFileMatches(*c, file))
+		if !sameExpiry(c.ExpiresAt, file.NotAfter) {
+			expires := file.NotAfter
+			c.ExpiresAt = &expires
+		}
+	}
+	for path := range m.certFiles {
+		if !seen[path] {
+			delete(m.certFiles, path)
+		}
+	}
+}
+
+// certFileLocked returns the parsed file at path, reparsing it when its
+// modification time or size changed. certFileMu must be held.
+func (m *Manager) certFileLocked(path string) (certFileEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(m.certFiles, path)
+		return certFileEntry{}, err
+	}
+	if entry, ok := m.certFiles[path]; ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry, nil
+	}
+	entry := certFileEntry{modTime: info.ModTime(), size: info.Size()}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return certFileEntry{}, err
+	}
+	entry.file, entry.err = parseCertificateFile(data)
+	if m.certFiles == nil {
+		m.certFiles = make(map[string]certFileEntry)
+	}
+	m.certFiles[path] = entry
+	return entry, nil
+}
+
+// parseCertificateFile reads the PEM chain in data.
+func parseCertificateFile(data []byte) (*CertificateFile, error) {
+	var leaf *x509.Certificate
+	count := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate %d: %w", count+1, err)
+		}
+		if leaf == nil {
+			leaf = cert
+		}
+		count++
+	}
+	if leaf == nil {
+		return nil, errors.New("no certificate in file")
+	}
+	file := &CertificateFile{
+		NotBefore:    leaf.NotBefore.UTC(),
+		NotAfter:     leaf.NotAfter.UTC(),
+		Issuer:       leaf.Issuer.CommonName,
+		SerialNumber: leaf.SerialNumber.Text(16),
+		SANs:         append([]string(nil), leaf.DNSNames...),
+		ChainLength:  count,
+	}
+	if file.Issuer == "" {
+		file.Issuer = leaf.Issuer.String()
+	}
+	for _, ip := range leaf.IPAddresses {
+		file.SANs = append(file.SANs, ip.String())
+	}
+	switch key := leaf.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		file.KeyType, file.KeyBits = "ECDSA", key.Curve.Params().BitSize
+	case *rsa.PublicKey:
+		file.KeyType, file.KeyBits = "RSA", key.N.BitLen()
+	case ed25519.PublicKey:
+		file.KeyType = "Ed25519"
+	default:
+		file.KeyType = leaf.PublicKeyAlgorithm.String()
+	}
+	return file, nil
+}
+
+// certFileMatches reports whether the file has the expiry the inventory
+// recorded and covers every inventory domain.
+func certFileMatches(c Certificate, file CertificateFile) bool {
+	if !sameExpiry(c.ExpiresAt, file.NotAfter) {
+		return false
+	}
+	for _, domain := range c.Domains {
+		covered := false
+		for _, san := range file.SANs {
+			if strings.EqualFold(san, domain) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// sameExpiry reports whether recorded is notAfter, give or take
+// expiryTolerance.
+func sameExpiry(recorded *time.Time, notAfter time.Time) bool {
+	if recorded == nil {
+		return false
+	}
+	diff := recorded.Sub(notAfter)
+	return diff <= expiryTolerance && diff >= -expiryTolerance
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeChain writes a leaf for domains signed by a throwaway CA, followed
+// by the CA certificate, to path.
+func writeChain(t *testing.T, path string, notAfter time.Time, domains ...string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ca key: %v", err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Intermediate R9"},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("ca: %v", err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("leaf key: %v", err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(0xbeef),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("leaf: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write chain: %v", err)
+	}
+}
+
+func portalCertificate(t *testing.T, m *Manager) Certificate {
+	t.Helper()
+	for _, c := range m.ListCertificates() {
+		if c.ID == "portal" {
+			return c
+		}
+	}
+	t.Fatalf("no portal certificate")
+	return Certificate{}
+}
+
+func TestManager_ListCertificatesReadsFilesOnDisk(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	issued := portalCertificate(t, m)
+	if issued.Disk == nil || issued.DiskMatchesInventory == nil || !*issued.DiskMatchesInventory || issued.MissingOnDisk {
+		t.Fatalf("expected the issued file to match the inventory: %+v", issued)
+	}
+	if issued.Disk.ChainLength != 1 || issued.Disk.KeyType != "ECDSA" || issued.Disk.KeyBits != 256 || issued.Disk.SerialNumber == "" {
+		t.Fatalf("unexpected file details %+v", issued.Disk)
+	}
+
+	// A file replaced behind the manager's back wins over the inventory.
+	path := filepath.Join(m.certDir(), "portal.crt")
+	notAfter := time.Date(2031, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeChain(t, path, notAfter, "portal.example.com", "www.portal.example.com")
+	replaced := portalCertificate(t, m)
+	if replaced.DiskMatchesInventory == nil || *replaced.DiskMatchesInventory || !replaced.ExpiresAt.Equal(notAfter) {
+		t.Fatalf("expected the replaced file to be reported: %+v", replaced)
+	}
+	disk := replaced.Disk
+	if disk.ChainLength != 2 || disk.Issuer != "Test Intermediate R9" || disk.SerialNumber != "beef" || disk.KeyType != "RSA" || disk.KeyBits != 2048 {
+		t.Fatalf("unexpected chain details %+v", disk)
+	}
+	if len(disk.SANs) != 2 || disk.SANs[1] != "www.portal.example.com" || !disk.NotBefore.Equal(notAfter.Add(-90*24*time.Hour)) {
+		t.Fatalf("unexpected leaf details %+v", disk)
+	}
+	if stored := m.currentConfig().Certificates; stored[0].Disk != nil || stored[0].ExpiresAt.Equal(notAfter) {
+		t.Fatalf("overlay leaked into the stored inventory: %+v", stored[0])
+	}
+
+	// Parsing is cached by modification time: an unchanged stat is not
+	// read again.
+	info, _ := os.Stat(path)
+	garbage := make([]byte, info.Size())
+	if err := os.WriteFile(path, garbage, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if cached := portalCertificate(t, m); cached.Disk == nil || cached.Disk.SerialNumber != "beef" {
+		t.Fatalf("expected the cached parse, got %+v", cached)
+	}
+	if err := os.Chtimes(path, info.ModTime().Add(time.Second), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if broken := portalCertificate(t, m); broken.Disk != nil || broken.DiskError == "" || *broken.DiskMatchesInventory {
+		t.Fatalf("expected an unreadable file to be reported, got %+v", broken)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	missing := portalCertificate(t, m)
+	if !missing.MissingOnDisk || missing.Disk != nil || missing.DiskMatchesInventory != nil || !missing.ExpiresAt.Equal(*m.currentConfig().Certificates[0].ExpiresAt) {
+		t.Fatalf("expected the missing file to be flagged: %+v", missing)
+	}
+}
@@ -0,0 +1,375 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrCertificateNotFound is returned for an unknown certificate ID, or one
+// whose files have not been written yet.
+var ErrCertificateNotFound = errors.New("remote: certificate not found")
+
+const (
+	defaultHookTimeout = 60 * time.Second
+	maxHookTimeout     = 10 * time.Minute
+	// maxHookOutput bounds the hook output kept on the certificate entry.
+	maxHookOutput = 4096
+)
+
+// CertExport publishes a certificate for software outside Piccolo. An
+// exported certificate is kept under certs/live/<id>/ as fullchain.pem and
+// privkey.pem, and DeployHook runs after every successful renewal.
+type CertExport struct {
+	DeployHook         string         `json:"deploy_hook,omitempty"`
+	HookTimeoutSeconds int            `json:"hook_timeout_seconds,omitempty"`
+	LastHook           *DeployHookRun `json:"last_hook,omitempty"`
+}
+
+// DeployHookRun records the outcome of the latest deploy hook.
+type DeployHookRun struct {
+	At         time.Time `json:"at"`
+	Success    bool      `json:"success"`
+	ExitCode   int       `json:"exit_code"`
+	TimedOut   bool      `json:"timed_out,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// CertExportRequest enables or disables the export of a certificate.
+type CertExportRequest struct {
+	Enabled            bool
+	DeployHook         string
+	HookTimeoutSeconds int
+}
+
+func (e *CertExport) hookTimeout() time.Duration {
+	if e == nil || e.HookTimeoutSeconds <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(e.HookTimeoutSeconds) * time.Second
+}
+
+// certFileName is the base name of c's certificate and key files in the
+// certificate directory.
+func certFileName(c Certificate) string {
+	_, cn, _ := strings.Cut(c.ID, ":")
+	if cn == "" && len(c.Domains) > 0 {
+		cn = c.Domains[0]
+	}
+	name := outNameFor(c.ID, cn)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	return name
+}
+
+// validLiveID reports whether id can name a directory under certs/live.
+func validLiveID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+// LiveDirectory returns the stable path that holds fullchain.pem and
+// privkey.pem for an exported certificate.
+func (m *Manager) LiveDirectory(id string) string {
+	return filepath.Join(m.certDir(), "live", id)
+}
+
+func (m *Manager) findCertificate(id string) (Certificate, bool) {
+	for _, c := range m.currentConfig().Certificates {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Certificate{}, false
+}
+
+// CertificateChain returns the PEM certificate chain of id.
+func (m *Manager) CertificateChain(id string) ([]byte, error) {
+	c, ok := m.findCertificate(id)
+	name := certFileName(c)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, id)
+	}
+	data, err := os.ReadFile(filepath.Join(m.certDir(), name+".crt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s has not been issued", ErrCertificateNotFound, id)
+	}
+	return data, err
+}
+
+// CertificateKey returns the PEM private key of id. A sealed key needs
+// unlocked storage and fails with ErrKeySealed otherwise.
+func (m *Manager) CertificateKey(id string) ([]byte, error) {
+	c, ok := m.findCertificate(id)
+	name := certFileName(c)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, id)
+	}
+	key, err := readPrivateKey(m.certDir(), name, m.keySealer)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s has not been issued", ErrCertificateNotFound, id)
+	}
+	return key, err
+}
+
+// SetCertificateExport enables, reconfigures or disables the export of id.
+// Enabling publishes the current certificate right away; disabling removes
+// its live directory.
+func (m *Manager) SetCertificateExport(id string, req CertExportRequest) (Certificate, error) {
+	req.DeployHook = strings.TrimSpace(req.DeployHook)
+	if req.HookTimeoutSeconds < 0 || time.Duration(req.HookTimeoutSeconds)*time.Second > maxHookTimeout {
+		return Certificate{}, fmt.Errorf("hook_timeout_seconds must be between 0 and %d", int(maxHookTimeout/time.Second))
+	}
+	if !validLiveID(id) {
+		return Certificate{}, fmt.Errorf("%w: %s", ErrCertificateNotFound, id)
+	}
+	var updated Certificate
+	err := m.update(func(cfg *Config) error {
+		for i := range cfg.Certificates {
+			c := &cfg.Certificates[i]
+			if c.ID != id {
+				continue
+			}
+			msg := fmt.Sprintf("Certificate %s export disabled", id)
+			if req.Enabled {
+				if isRetired(*c) {
+					return fmt.Errorf("certificate %s is %s and cannot be exported", id, c.Status)
+				}
+				export := &CertExport{DeployHook: req.DeployHook, HookTimeoutSeconds: req.HookTimeoutSeconds}
+				if c.Export != nil {
+					export.LastHook = c.Export.LastHook
+				}
+				c.Export = export
+				msg = fmt.Sprintf("Certificate %s exported to %s", id, m.LiveDirectory(id))
+				if req.DeployHook != "" {
+					msg += " with a deploy hook"
+				}
+			} else if c.Export == nil {
+				updated = *c
+				return errNoChange
+			} else {
+				c.Export = nil
+			}
+			m.appendEvent(cfg, Event{Timestamp: m.now(), Level: "info", Source: "remote", Message: msg})
+			updated = *c
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrCertificateNotFound, id)
+	})
+	if err != nil {
+		return Certificate{}, err
+	}
+	if updated.Export == nil {
+		m.removeLiveFiles(id)
+		return updated, nil
+	}
+	if updated.IssuedAt != nil {
+		if err := m.publishLive(updated); err != nil {
+			return updated, fmt.Errorf("publish %s: %w", id, err)
+		}
+	}
+	return updated, nil
+}
+
+// publishLive writes c's chain and key into a new version directory under
+// certs/archive/<id>/ and then repoints the certs/live/<id> symlink at it,
+// so readers always see a matching pair. The previous version is kept for
+// readers that still hold it open; older ones are removed.
+func (m *Manager) publishLive(c Certificate) error {
+	if !validLiveID(c.ID) {
+		return fmt.Errorf("certificate id %q cannot be exported", c.ID)
+	}
+	chain, err := m.CertificateChain(c.ID)
+	if err != nil {
+		return err
+	}
+	key, err := m.CertificateKey(c.ID)
+	if err != nil {
+		return err
+	}
+	archive := filepath.Join(m.certDir(), "archive", c.ID)
+	if err := os.MkdirAll(archive, 0o700); err != nil {
+		return err
+	}
+	version, err := os.MkdirTemp(archive, m.now().UTC().Format("20060102T150405Z")+"-")
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(version, 0o700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(version, "fullchain.pem"), chain); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(version, "privkey.pem"), key); err != nil {
+		return err
+	}
+	live := m.LiveDirectory(c.ID)
+	if err := os.MkdirAll(filepath.Dir(live), 0o700); err != nil {
+		return err
+	}
+	target, err := filepath.Rel(filepath.Dir(live), version)
+	if err != nil {
+		return err
+	}
+	previous, _ := os.Readlink(live)
+	tmp := live + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, live); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	pruneArchive(archive, filepath.Base(version), filepath.Base(previous))
+	return nil
+}
+
+// pruneArchive removes the versions in dir other than current and
+// previous.
+func pruneArchive(dir, current, previous string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if name := e.Name(); name != current && name != previous {
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				log.Printf("WARN: remote: prune %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// removeLiveFiles deletes the live link and archived versions of id.
+func (m *Manager) removeLiveFiles(id string) {
+	if !validLiveID(id) {
+		return
+	}
+	for _, path := range []string{m.LiveDirectory(id), filepath.Join(m.certDir(), "archive", id)} {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("WARN: remote: remove %s: %v", path, err)
+		}
+	}
+}
+
+// deployCertificate republishes an exported certificate after issuance and
+// runs its deploy hook. It runs on the issuance worker.
+func (m *Manager) deployCertificate(id string) {
+	c, ok := m.findCertificate(id)
+	if !ok || c.Export == nil || isRetired(c) {
+		return
+	}
+	if err := m.publishLive(c); err != nil {
+		m.recordDeploy(id, nil, fmt.Sprintf("Certificate %s renewed but not exported: %v", id, err))
+		return
+	}
+	if c.Export.DeployHook == "" {
+		return
+	}
+	run := m.runDeployHook(c, c.Export.hookTimeout())
+	msg := fmt.Sprintf("Deploy hook for %s succeeded", id)
+	switch {
+	case run.TimedOut:
+		msg = fmt.Sprintf("Deploy hook for %s timed out after %s", id, c.Export.hookTimeout())
+	case !run.Success:
+		msg = fmt.Sprintf("Deploy hook for %s failed: %s", id, run.Error)
+	}
+	m.recordDeploy(id, &run, msg)
+}
+
+// recordDeploy stores run on id's export and logs msg; a nil run or a
+// failed one is logged as a warning.
+func (m *Manager) recordDeploy(id string, run *DeployHookRun, msg string) {
+	level := "info"
+	if run == nil || !run.Success {
+		level = "warn"
+	}
+	_ = m.update(func(cfg *Config) error {
+		for i := range cfg.Certificates {
+			c := &cfg.Certificates[i]
+			if c.ID == id && c.Export != nil && run != nil {
+				export := *c.Export
+				export.LastHook = run
+				c.Export = &export
+			}
+		}
+		m.appendEvent(cfg, Event{Timestamp: m.now(), Level: level, Source: "remote", Message: msg})
+		return nil
+	})
+}
+
+// runDeployHook runs the hook through /bin/sh in the live directory. The
+// hook and everything it starts are killed when timeout passes or the
+// manager closes.
+func (m *Manager) runDeployHook(c Certificate, timeout time.Duration) DeployHookRun {
+	ctx, cancel := context.WithTimeout(m.workCtx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.Export.DeployHook)
+	cmd.Dir = m.LiveDirectory(c.ID)
+	cmd.Env = append(os.Environ(),
+		"PICCOLO_CERT_ID="+c.ID,
+		"PICCOLO_CERT_DOMAINS="+strings.Join(c.Domains, " "),
+		"PICCOLO_CERT_LIVE_DIR="+m.LiveDirectory(c.ID),
+	)
+	out := &cappedBuffer{limit: maxHookOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	run := DeployHookRun{
+		At:         m.now(),
+		Success:    err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+		Output:     out.String(),
+	}
+	if cmd.ProcessState != nil {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		run.Error = err.Error()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			run.TimedOut = true
+			run.Error = "timed out"
+		}
+	}
+	return run
+}
+
+// cappedBuffer keeps the first limit bytes written to it.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
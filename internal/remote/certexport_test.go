@@ -0,0 +1,140 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lastHook waits for the deploy hook of id to record a run at or after
+// since.
+func lastHook(t *testing.T, m *Manager, id string, since time.Time) *DeployHookRun {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		for _, c := range m.ListCertificates() {
+			if c.ID == id && c.Export != nil && c.Export.LastHook != nil && !c.Export.LastHook.At.Before(since) {
+				return c.Export.LastHook
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deploy hook for %s did not run", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readLive(t *testing.T, m *Manager, id, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.LiveDirectory(id), file))
+	if err != nil {
+		t.Fatalf("read live %s: %v", file, err)
+	}
+	return data
+}
+
+func TestManager_ExportedCertificateFollowsRenewal(t *testing.T) {
+	m, _, advance := newPruneTestManager(t)
+	if _, err := m.CertificateChain("nope"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Fatalf("expected ErrCertificateNotFound, got %v", err)
+	}
+
+	marker := filepath.Join(t.TempDir(), "deployed")
+	cert, err := m.SetCertificateExport("portal", CertExportRequest{
+		Enabled:    true,
+		DeployHook: `echo "$PICCOLO_CERT_ID $PICCOLO_CERT_DOMAINS" > ` + marker,
+	})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if cert.Export == nil || cert.Export.DeployHook == "" {
+		t.Fatalf("export not recorded: %+v", cert)
+	}
+	chain, _ := m.CertificateChain("portal")
+	key, _ := m.CertificateKey("portal")
+	if !bytes.Equal(readLive(t, m, "portal", "fullchain.pem"), chain) || !bytes.Equal(readLive(t, m, "portal", "privkey.pem"), key) {
+		t.Fatalf("live files do not match the issued certificate")
+	}
+	if _, err := os.Stat(marker); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("deploy hook ran before a renewal: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		advance(time.Hour)
+		since := m.now()
+		if err := m.RenewCertificate("portal"); err != nil {
+			t.Fatalf("renew: %v", err)
+		}
+		settledCertificates(t, m)
+		if run := lastHook(t, m, "portal", since); !run.Success || run.ExitCode != 0 {
+			t.Fatalf("deploy hook failed: %+v", run)
+		}
+	}
+	renewed, _ := m.CertificateChain("portal")
+	renewedKey, _ := m.CertificateKey("portal")
+	if bytes.Equal(renewed, chain) {
+		t.Fatalf("renewal did not replace the certificate")
+	}
+	if !bytes.Equal(readLive(t, m, "portal", "fullchain.pem"), renewed) || !bytes.Equal(readLive(t, m, "portal", "privkey.pem"), renewedKey) {
+		t.Fatalf("live files not updated by the renewal")
+	}
+	if fi, err := os.Lstat(m.LiveDirectory("portal")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected live/portal to be a symlink: %v", err)
+	}
+	if versions, _ := os.ReadDir(filepath.Join(m.certDir(), "archive", "portal")); len(versions) != 2 {
+		t.Fatalf("expected the current and previous versions archived, got %d", len(versions))
+	}
+	if out, err := os.ReadFile(marker); err != nil || !strings.HasPrefix(string(out), "portal portal.example.com") {
+		t.Fatalf("deploy hook saw unexpected environment: %q %v", out, err)
+	}
+
+	if _, err := m.SetCertificateExport("portal", CertExportRequest{}); err != nil {
+		t.Fatalf("disable export: %v", err)
+	}
+	if _, err := os.Lstat(m.LiveDirectory("portal")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("live directory kept after export was disabled: %v", err)
+	}
+	if _, err := m.CertificateChain("portal"); err != nil {
+		t.Fatalf("disabling export removed the certificate: %v", err)
+	}
+}
+
+func TestManager_DeployHookTimeout(t *testing.T) {
+	m, _, advance := newPruneTestManager(t)
+	if _, err := m.SetCertificateExport("portal", CertExportRequest{Enabled: true, HookTimeoutSeconds: 3600}); err == nil {
+		t.Fatalf("expected an excessive hook timeout to be refused")
+	}
+	if _, err := m.SetCertificateExport("portal", CertExportRequest{
+		Enabled:            true,
+		DeployHook:         "echo started; sleep 30",
+		HookTimeoutSeconds: 1,
+	}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	advance(time.Hour)
+	since := m.now()
+	start := time.Now()
+	if err := m.RenewCertificate("portal"); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	run := lastHook(t, m, "portal", since)
+	if !run.TimedOut || run.Success || !strings.Contains(run.Output, "started") {
+		t.Fatalf("expected a timed out run with its output, got %+v", run)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("hook outlived its timeout: %s", elapsed)
+	}
+	if !hasEvent(m, "Deploy hook for portal timed out") {
+		t.Fatalf("timeout not recorded: %+v", m.ListEvents())
+	}
+	// The certificate itself renewed and was published.
+	chain, _ := m.CertificateChain("portal")
+	if !bytes.Equal(readLive(t, m, "portal", "fullchain.pem"), chain) {
+		t.Fatalf("live certificate not updated despite the hook failure")
+	}
+}
@@ -0,0 +1,254 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// orphanGraceEnv overrides how long an orphaned certificate is kept before
+// its entry and files are deleted, as a Go duration such as "72h".
+const orphanGraceEnv = "PICCOLO_REMOTE_CERT_ORPHAN_GRACE"
+
+const defaultOrphanGrace = 7 * 24 * time.Hour
+
+// CertStatusOrphaned marks a certificate whose hostname no longer routes
+// anywhere. It is not renewed and is deleted once the grace period ends,
+// unless the hostname comes back first.
+const CertStatusOrphaned = "orphaned"
+
+// CertStatusUnsupported marks a wildcard left behind by a switch away from
+// dns-01, and CertStatusSuperseded a per-host certificate the wildcard took
+// over after a switch to dns-01. Neither is renewed; both are deleted once
+// they expire.
+const (
+	CertStatusUnsupported = "unsupported"
+	CertStatusSuperseded  = "superseded"
+)
+
+// ErrCertificateInUse is returned when forgetting a certificate whose
+// hostname still routes somewhere.
+var ErrCertificateInUse = errors.New("remote: certificate still in use")
+
+// orphanGraceFromEnv returns the orphan grace period, orphanGraceEnv or the
+// default.
+func orphanGraceFromEnv() time.Duration {
+	v := strings.TrimSpace(os.Getenv(orphanGraceEnv))
+	if v == "" {
+		return defaultOrphanGrace
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("WARN: remote: ignoring %s=%q; using %s", orphanGraceEnv, v, defaultOrphanGrace)
+		return defaultOrphanGrace
+	}
+	return d
+}
+
+func isOrphaned(c Certificate) bool {
+	return strings.EqualFold(c.Status, CertStatusOrphaned)
+}
+
+// isRetired reports whether c is only kept until it is deleted.
+func isRetired(c Certificate) bool {
+	switch strings.ToLower(c.Status) {
+	case CertStatusOrphaned, CertStatusUnsupported, CertStatusSuperseded:
+		return true
+	}
+	return false
+}
+
+// retireCertificate gives id a retired status on cfg and stops its
+// renewals, reporting whether it changed.
+func retireCertificate(cfg *Config, id, status string) bool {
+	for i := range cfg.Certificates {
+		c := &cfg.Certificates[i]
+		if c.ID != id || strings.EqualFold(c.Status, status) {
+			continue
+		}
+		c.Status = status
+		c.NextRenewal = nil
+		c.Covers = nil
+		return true
+	}
+	return false
+}
+
+// orphanCertificate marks id orphaned on cfg, reporting whether it changed.
+func (m *Manager) orphanCertificate(cfg *Config, id, reason string, now time.Time) bool {
+	for i := range cfg.Certificates {
+		c := &cfg.Certificates[i]
+		if c.ID != id || isOrphaned(*c) {
+			continue
+		}
+		c.Status = CertStatusOrphaned
+		c.OrphanedAt = timePtr(now)
+		c.NextRenewal = nil
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate %s orphaned: %s; deleting after %s unless reclaimed", id, reason, m.orphanGrace),
+		})
+		return true
+	}
+	return false
+}
+
+// reclaimCertificate returns an orphaned id to service on cfg. It reports
+// false when id is not orphaned or has no usable lifetime left, in which
+// case the caller issues a fresh certificate.
+func (m *Manager) reclaimCertificate(cfg *Config, id string, now time.Time) bool {
+	for i := range cfg.Certificates {
+		c := &cfg.Certificates[i]
+		if c.ID != id || !isOrphaned(*c) {
+			continue
+		}
+		if c.ExpiresAt == nil || !c.ExpiresAt.After(now.Add(24*time.Hour)) {
+			return false
+		}
+		c.Status = "ok"
+		c.OrphanedAt = nil
+		if c.IssuedAt != nil {
+			c.NextRenewal = timePtr(renewAt(*c.IssuedAt, *c.ExpiresAt, cfg.renewalLead()))
+		} else {
+			c.NextRenewal = timePtr(now)
+		}
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate %s reclaimed", id),
+		})
+		return true
+	}
+	return false
+}
+
+// PruneCertificates orphans per-host certificates whose listener hostname
+// is no longer published, reclaims orphaned ones whose hostname is back, and
+// deletes those orphaned for longer than the grace period as well as expired
+// unsupported and superseded ones. The renewal scheduler runs it on every
+// scan.
+func (m *Manager) PruneCertificates() {
+	if m == nil || m.secretsLocked.Load() || m.needsReload.Load() {
+		return
+	}
+	now := m.now()
+	var expired []Certificate
+	_ = m.update(func(cfg *Config) error {
+		expired = nil
+		changed := false
+		for _, c := range cfg.Certificates {
+			host, ok := strings.CutPrefix(c.ID, "host:")
+			if !ok {
+				continue
+			}
+			published, known := m.listenerHostPublished(cfg, host)
+			switch {
+			case !known:
+			case !published && !isOrphaned(c):
+				changed = m.orphanCertificate(cfg, c.ID, "no listener publishes "+host, now) || changed
+			case published && isOrphaned(c):
+				changed = m.reclaimCertificate(cfg, c.ID, now) || changed
+			}
+		}
+		kept := cfg.Certificates[:0]
+		for _, c := range cfg.Certificates {
+			if isOrphaned(c) && c.OrphanedAt != nil && !now.Before(c.OrphanedAt.Add(m.orphanGrace)) {
+				expired = append(expired, c)
+				m.appendEvent(cfg, Event{
+					Timestamp: now,
+					Level:     "info",
+					Source:    "remote",
+					Message:   fmt.Sprintf("Certificate %s deleted after its grace period", c.ID),
+				})
+				continue
+			}
+			if isRetired(c) && !isOrphaned(c) && (c.ExpiresAt == nil || !now.Before(*c.ExpiresAt)) {
+				expired = append(expired, c)
+				m.appendEvent(cfg, Event{
+					Timestamp: now,
+					Level:     "info",
+					Source:    "remote",
+					Message:   fmt.Sprintf("Certificate %s (%s) deleted after it expired", c.ID, c.Status),
+				})
+				continue
+			}
+			kept = append(kept, c)
+		}
+		cfg.Certificates = kept
+		if !changed && len(expired) == 0 {
+			return errNoChange
+		}
+		return nil
+	})
+	for _, c := range expired {
+		m.removeCertFiles(c)
+	}
+}
+
+// listenerHostPublished reports whether host, a listener hostname
+// <label>.<tld>, is still published by an app. known is false for
+// hostnames this check cannot judge.
+func (m *Manager) listenerHostPublished(cfg *Config, host string) (published, known bool) {
+	if m.listeners == nil || cfg.TLD == "" {
+		return false, false
+	}
+	label, ok := strings.CutSuffix(host, "."+cfg.TLD)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return false, false
+	}
+	return m.listeners.HasRemoteLabel(label), true
+}
+
+// ForgetCertificate deletes an orphaned certificate and its files without
+// waiting for the grace period.
+func (m *Manager) ForgetCertificate(id string) error {
+	var forgotten Certificate
+	err := m.update(func(cfg *Config) error {
+		for i, c := range cfg.Certificates {
+			if c.ID != id {
+				continue
+			}
+			if !isOrphaned(c) {
+				return fmt.Errorf("%w: %s", ErrCertificateInUse, id)
+			}
+			forgotten = c
+			cfg.Certificates = append(cfg.Certificates[:i], cfg.Certificates[i+1:]...)
+			m.appendEvent(cfg, Event{
+				Timestamp: m.now(),
+				Level:     "info",
+				Source:    "remote",
+				Message:   fmt.Sprintf("Certificate %s forgotten", id),
+			})
+			return nil
+		}
+		return errors.New("certificate not found")
+	})
+	if err != nil {
+		return err
+	}
+	m.removeCertFiles(forgotten)
+	return nil
+}
+
+// removeCertFiles deletes the certificate and private key stored for c,
+// along with any exported copies.
+func (m *Manager) removeCertFiles(c Certificate) {
+	m.removeLiveFiles(c.ID)
+	name := certFileName(c)
+	if name == "" {
+		return
+	}
+	dir := m.certDir()
+	for _, ext := range []string{".crt", plaintextKeyExt, sealedKeyExt} {
+		if err := os.Remove(filepath.Join(dir, name+ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("WARN: remote: remove %s%s: %v", name, ext, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type labelLookup struct {
+	mu     sync.Mutex
+	labels map[string]bool
+}
+
+func (l *labelLookup) HasListener(name string) bool { return l.HasRemoteLabel(name) }
+
+func (l *labelLookup) HasRemoteLabel(label string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.labels[label]
+}
+
+func (l *labelLookup) set(label string, published bool) {
+	l.mu.Lock()
+	l.labels[label] = published
+	l.mu.Unlock()
+}
+
+// newClockedManager returns a manager issuing self-signed certificates,
+// with a clock the test moves by hand.
+func newClockedManager(t *testing.T) (*Manager, func(time.Duration)) {
+	t.Helper()
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir := t.TempDir()
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	var clock atomic.Int64
+	clock.Store(time.Unix(1_000_000, 0).UnixNano())
+	now := func() time.Time { return time.Unix(0, clock.Load()).UTC() }
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, now)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	return m, func(d time.Duration) { clock.Add(int64(d)) }
+}
+
+// newPruneTestManager returns a clocked manager configured for http-01.
+func newPruneTestManager(t *testing.T) (*Manager, *labelLookup, func(time.Duration)) {
+	t.Helper()
+	m, advance := newClockedManager(t)
+	m.orphanGrace = 48 * time.Hour
+	lookup := &labelLookup{labels: map[string]bool{}}
+	m.SetListenerLookup(lookup)
+	if err := m.Configure(ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	settledCertificates(t, m)
+	return m, lookup, advance
+}
+
+func hasEvent(m *Manager, fragment string) bool {
+	for _, evt := range m.ListEvents() {
+		if strings.Contains(evt.Message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestManager_RemovedAliasCertificateIsDeletedAfterGrace(t *testing.T) {
+	m, _, advance := newPruneTestManager(t)
+	alias, err := m.AddAlias("portal", "shop.example.net", AliasOptions{})
+	if err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	if certs := settledCertificates(t, m); certs["alias:shop.example.net"].Status != "ok" {
+		t.Fatalf("alias certificate not issued: %+v", certs)
+	}
+	certFile := filepath.Join(m.certDir(), "shop.example.net.crt")
+	if _, err := os.Stat(certFile); err != nil {
+		t.Fatalf("certificate file missing: %v", err)
+	}
+
+	if err := m.RemoveAlias(alias.ID); err != nil {
+		t.Fatalf("remove alias: %v", err)
+	}
+	cert := settledCertificates(t, m)["alias:shop.example.net"]
+	if cert.Status != CertStatusOrphaned || cert.OrphanedAt == nil || cert.NextRenewal != nil {
+		t.Fatalf("expected orphaned certificate, got %+v", cert)
+	}
+	if !hasEvent(m, "Certificate alias:shop.example.net orphaned") {
+		t.Fatalf("orphan not recorded: %+v", m.ListEvents())
+	}
+	if err := m.RenewCertificate("alias:shop.example.net"); err == nil {
+		t.Fatalf("expected renewal of an orphaned certificate to be refused")
+	}
+
+	// Past the renewal date but inside the grace period: neither renewed
+	// nor deleted.
+	advance(47 * time.Hour)
+	m.scanAndQueueRenewals()
+	if cert := settledCertificates(t, m)["alias:shop.example.net"]; cert.Status != CertStatusOrphaned {
+		t.Fatalf("orphaned certificate touched inside the grace period: %+v", cert)
+	}
+
+	advance(time.Hour)
+	m.scanAndQueueRenewals()
+	if _, ok := settledCertificates(t, m)["alias:shop.example.net"]; ok {
+		t.Fatalf("orphaned certificate kept past the grace period")
+	}
+	for _, ext := range []string{".crt", ".key", ".key.enc"} {
+		if _, err := os.Stat(filepath.Join(m.certDir(), "shop.example.net"+ext)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s left on disk: %v", ext, err)
+		}
+	}
+	if !hasEvent(m, "Certificate alias:shop.example.net deleted after its grace period") {
+		t.Fatalf("deletion not recorded: %+v", m.ListEvents())
+	}
+	if _, ok := settledCertificates(t, m)["portal"]; !ok {
+		t.Fatalf("portal certificate pruned")
+	}
+}
+
+func TestManager_ReaddedHostnamesReclaimOrphanedCertificates(t *testing.T) {
+	m, lookup, advance := newPruneTestManager(t)
+	alias, err := m.AddAlias("portal", "shop.example.net", AliasOptions{})
+	if err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	issued := settledCertificates(t, m)["alias:shop.example.net"]
+	if err := m.RemoveAlias(alias.ID); err != nil {
+		t.Fatalf("remove alias: %v", err)
+	}
+	if err := m.ForgetCertificate("portal"); !errors.Is(err, ErrCertificateInUse) {
+		t.Fatalf("expected ErrCertificateInUse forgetting the portal certificate, got %v", err)
+	}
+
+	advance(24 * time.Hour)
+	if _, err := m.AddAlias("portal", "shop.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("re-add alias: %v", err)
+	}
+	var reclaimed Certificate
+	for _, c := range m.ListCertificates() {
+		if c.ID == "alias:shop.example.net" {
+			reclaimed = c
+		}
+	}
+	if reclaimed.Status != "ok" || reclaimed.OrphanedAt != nil || reclaimed.NextRenewal == nil || !reclaimed.IssuedAt.Equal(*issued.IssuedAt) {
+		t.Fatalf("expected the existing certificate back, got %+v (issued %+v)", reclaimed, issued)
+	}
+	if !hasEvent(m, "Certificate alias:shop.example.net reclaimed") {
+		t.Fatalf("reclaim not recorded: %+v", m.ListEvents())
+	}
+
+	// Listener hostnames follow the published listeners.
+	lookup.set("blog", true)
+	m.QueueHostnameCertificate("blog.example.com")
+	if certs := settledCertificates(t, m); certs["host:blog.example.com"].Status != "ok" {
+		t.Fatalf("listener certificate not issued: %+v", certs)
+	}
+	lookup.set("blog", false)
+	m.PruneCertificates()
+	if cert := settledCertificates(t, m)["host:blog.example.com"]; cert.Status != CertStatusOrphaned {
+		t.Fatalf("expected listener certificate orphaned, got %+v", cert)
+	}
+	lookup.set("blog", true)
+	m.PruneCertificates()
+	if cert := settledCertificates(t, m)["host:blog.example.com"]; cert.Status != "ok" {
+		t.Fatalf("expected listener certificate reclaimed, got %+v", cert)
+	}
+
+	lookup.set("blog", false)
+	m.PruneCertificates()
+	if err := m.ForgetCertificate("host:blog.example.com"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if _, ok := settledCertificates(t, m)["host:blog.example.com"]; ok {
+		t.Fatalf("forgotten certificate still listed")
+	}
+	if _, err := os.Stat(filepath.Join(m.certDir(), "blog.example.com.crt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("forgotten certificate file left on disk: %v", err)
+	}
+}
@@ -10,18 +10,22 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"piccolod/internal/services"
 	"piccolod/internal/state/paths"
 )
 
 // FileCertProvider loads certificates from an on-disk store under the encrypted
-// control volume. It implements services.CertProvider.
+// control volume. It implements services.CertProvider. Wrapped private keys
+// are opened in memory; while storage is locked only certificates already in
+// the cache can be served.
 type FileCertProvider struct {
 	base       string
 	mu         sync.RWMutex
 	cache      map[string]*tls.Certificate
 	portalHost string
+	sealer     KeySealer
 }
 
 // NewFileCertProvider constructs a provider rooted at <control>/remote/certs when
@@ -50,14 +54,26 @@ func (p *FileCertProvider) GetCertificate(host string) (*tls.Certificate, error)
 			return cert, nil
 		}
 	}
-	// Always prefer fresh load from disk, then fall back to cache.
-	if cert := p.tryLoad(host); cert != nil {
+	// Always prefer fresh load from disk, then fall back to cache. An
+	// expired per-host certificate left behind gives way to the wildcard.
+	if cert := p.tryLoad(host); cert != nil && !expired(cert) {
 		p.toCache(host, cert)
 		return cert, nil
 	}
-	if cert := p.fromCache(host); cert != nil {
+	if cert := p.fromCache(host); cert != nil && !expired(cert) {
 		return cert, nil
 	}
+	// An alias added with its www variant keeps both names on the
+	// certificate filed under the bare hostname.
+	if apex, ok := strings.CutPrefix(host, "www."); ok {
+		if cert := p.tryLoad(apex); cert != nil && !expired(cert) && covers(cert, host) {
+			p.toCache(apex, cert)
+			return cert, nil
+		}
+		if cert := p.fromCache(apex); cert != nil && !expired(cert) && covers(cert, host) {
+			return cert, nil
+		}
+	}
 	// Wildcard fallback: *.domain
 	if i := strings.Index(host, "."); i != -1 {
 		domain := host[i+1:]
@@ -75,6 +91,26 @@ func (p *FileCertProvider) GetCertificate(host string) (*tls.Certificate, error)
 	return nil, services.ErrNoCert
 }
 
+func expired(cert *tls.Certificate) bool {
+	return cert.Leaf != nil && time.Now().After(cert.Leaf.NotAfter)
+}
+
+// covers reports whether cert is valid for host.
+func covers(cert *tls.Certificate, host string) bool {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return false
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return false
+		}
+		leaf = parsed
+	}
+	return leaf.VerifyHostname(host) == nil
+}
+
 func (p *FileCertProvider) fromCache(key string) *tls.Certificate {
 	p.mu.RLock()
 	c := p.cache[key]
@@ -95,17 +131,51 @@ func (p *FileCertProvider) SetPortalHostname(host string) {
 	p.mu.Unlock()
 }
 
+// SetKeySealer supplies the storage key used to open wrapped private keys.
+func (p *FileCertProvider) SetKeySealer(s KeySealer) {
+	p.mu.Lock()
+	p.sealer = s
+	p.mu.Unlock()
+}
+
+// SetBase points the provider at another certificate directory. Cached
+// certificates are kept, so handshakes in flight during a move of the
+// directory still find one.
+func (p *FileCertProvider) SetBase(base string) {
+	if strings.TrimSpace(base) == "" {
+		return
+	}
+	p.mu.Lock()
+	p.base = base
+	p.mu.Unlock()
+}
+
+// Base returns the directory certificates are loaded from.
+func (p *FileCertProvider) Base() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.base
+}
+
 func (p *FileCertProvider) tryLoad(name string) *tls.Certificate {
+	p.mu.RLock()
+	sealer := p.sealer
+	base := p.base
+	p.mu.RUnlock()
 	// Prefer separate CRT/KEY pair
-	crt := filepath.Join(p.base, name+".crt")
-	key := filepath.Join(p.base, name+".key")
-	if fileExists(crt) && fileExists(key) {
-		if c, err := tls.LoadX509KeyPair(crt, key); err == nil {
-			return &c
+	crt := filepath.Join(base, name+".crt")
+	if fileExists(crt) {
+		if keyPEM, err := readPrivateKey(base, name, sealer); err == nil {
+			defer clear(keyPEM)
+			if certPEM, err := os.ReadFile(crt); err == nil {
+				if c, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+					return &c
+				}
+			}
 		}
 	}
 	// Fallback to PEM bundle (cert + key in one file)
-	pemPath := filepath.Join(p.base, name+".pem")
+	pemPath := filepath.Join(base, name+".pem")
 	if fileExists(pemPath) {
 		if c, err := loadPEMBundle(pemPath); err == nil {
 			return c
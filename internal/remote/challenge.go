@@ -1,57 +1,209 @@
 package remote
 
 import (
-    "net/http"
-    "strings"
-    "sync"
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// defaultChallengeTTL outlives a normal ACME validation by a wide margin;
+	// tokens left behind by an aborted issuance go away on their own.
+	defaultChallengeTTL = 10 * time.Minute
+	// defaultMaxChallenges bounds memory if issuances keep failing before
+	// cleanup. The least recently registered tokens are evicted first.
+	defaultMaxChallenges = 256
+)
+
+// ChallengeStats counts HTTP-01 requests served since startup.
+type ChallengeStats struct {
+	Active  int   `json:"active"`
+	Served  int64 `json:"served"`
+	Unknown int64 `json:"unknown"`
+	Expired int64 `json:"expired"`
+	Evicted int64 `json:"evicted"`
+}
+
+type challengeEntry struct {
+	token   string
+	value   string
+	expires time.Time
+}
+
 // ChallengeManager stores HTTP-01 token payloads and serves them over HTTP.
+// Tokens from concurrent issuances are independent entries, each with its
+// own expiry.
 type ChallengeManager struct {
-    mu     sync.RWMutex
-    tokens map[string]string
+	ttl   time.Duration
+	limit int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front = most recently registered
+	janitor bool
+
+	served  atomic.Int64
+	unknown atomic.Int64
+	expired atomic.Int64
+	evicted atomic.Int64
 }
 
 func NewChallengeManager() *ChallengeManager {
-    return &ChallengeManager{tokens: make(map[string]string)}
+	return &ChallengeManager{
+		ttl:     defaultChallengeTTL,
+		limit:   defaultMaxChallenges,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
 }
 
 // Put registers a token->keyAuthorization mapping.
 func (m *ChallengeManager) Put(token, value string) {
-    if token == "" { return }
-    m.mu.Lock()
-    m.tokens[token] = value
-    m.mu.Unlock()
+	if !validChallengeToken(token) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := &challengeEntry{token: token, value: value, expires: m.now().Add(m.ttl)}
+	if el, ok := m.entries[token]; ok {
+		el.Value = entry
+		m.order.MoveToFront(el)
+	} else {
+		m.entries[token] = m.order.PushFront(entry)
+	}
+	for m.order.Len() > m.limit {
+		m.removeElement(m.order.Back())
+		m.evicted.Add(1)
+	}
+	if !m.janitor {
+		m.janitor = true
+		go m.runJanitor()
+	}
 }
 
-// Delete removes a token mapping.
-func (m *ChallengeManager) Delete(token string) {
-    if token == "" { return }
-    m.mu.Lock()
-    delete(m.tokens, token)
-    m.mu.Unlock()
+// Remove drops a token mapping once its issuance has finished.
+func (m *ChallengeManager) Remove(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[token]; ok {
+		m.removeElement(el)
+	}
+}
+
+// Stats returns the current counters.
+func (m *ChallengeManager) Stats() ChallengeStats {
+	m.mu.Lock()
+	active := len(m.entries)
+	m.mu.Unlock()
+	return ChallengeStats{
+		Active:  active,
+		Served:  m.served.Load(),
+		Unknown: m.unknown.Load(),
+		Expired: m.expired.Load(),
+		Evicted: m.evicted.Load(),
+	}
+}
+
+func (m *ChallengeManager) lookup(token string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[token]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*challengeEntry)
+	if !m.now().Before(entry.expires) {
+		m.removeElement(el)
+		m.expired.Add(1)
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (m *ChallengeManager) removeElement(el *list.Element) {
+	entry := m.order.Remove(el).(*challengeEntry)
+	delete(m.entries, entry.token)
+}
+
+// sweep drops expired tokens and reports whether any remain.
+func (m *ChallengeManager) sweep() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for el := m.order.Back(); el != nil; {
+		prev := el.Prev()
+		if entry := el.Value.(*challengeEntry); !now.Before(entry.expires) {
+			m.removeElement(el)
+			m.expired.Add(1)
+		}
+		el = prev
+	}
+	if len(m.entries) == 0 {
+		m.janitor = false
+		return false
+	}
+	return true
+}
+
+// runJanitor sweeps while tokens are registered and exits once none remain;
+// the next Put starts it again.
+func (m *ChallengeManager) runJanitor() {
+	interval := m.ttl / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !m.sweep() {
+			return
+		}
+	}
+}
+
+// validChallengeToken accepts the base64url alphabet ACME tokens use.
+func validChallengeToken(token string) bool {
+	if token == "" || len(token) > 256 {
+		return false
+	}
+	for _, r := range token {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // Handler returns an http.Handler that serves /.well-known/acme-challenge/*.
+// Only stored key authorizations are ever written; misses get a fixed 404.
 func (m *ChallengeManager) Handler() http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        // Expect path like "/.well-known/acme-challenge/<token>"
-        p := r.URL.Path
-        idx := strings.LastIndex(p, "/")
-        if idx == -1 || idx+1 >= len(p) {
-            http.NotFound(w, r)
-            return
-        }
-        token := p[idx+1:]
-        m.mu.RLock()
-        val, ok := m.tokens[token]
-        m.mu.RUnlock()
-        if !ok {
-            http.NotFound(w, r)
-            return
-        }
-        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-        _, _ = w.Write([]byte(val))
-    })
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Expect path like "/.well-known/acme-challenge/<token>"
+		p := r.URL.Path
+		idx := strings.LastIndex(p, "/")
+		token := ""
+		if idx != -1 {
+			token = p[idx+1:]
+		}
+		val, ok := "", false
+		if validChallengeToken(token) {
+			val, ok = m.lookup(token)
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if !ok {
+			m.unknown.Add(1)
+			http.NotFound(w, r)
+			return
+		}
+		m.served.Add(1)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(val))
+	})
 }
-
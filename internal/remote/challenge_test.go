@@ -0,0 +1,120 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func serveChallenge(m *ChallengeManager, token string) (int, string) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/"+token, nil)
+	m.Handler().ServeHTTP(w, r)
+	body, _ := io.ReadAll(w.Body)
+	return w.Code, string(body)
+}
+
+func TestChallengeManager_ConcurrentRegistrationAndServing(t *testing.T) {
+	m := NewChallengeManager()
+	const n = 64
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			serveChallenge(m, fmt.Sprintf("tok%d", i%n))
+			_ = m.Stats()
+		}
+	}()
+	var writers sync.WaitGroup
+	for i := 0; i < n; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			m.Put(fmt.Sprintf("tok%d", i), fmt.Sprintf("tok%d.key", i))
+		}(i)
+	}
+	writers.Wait()
+	close(stop)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		code, body := serveChallenge(m, fmt.Sprintf("tok%d", i))
+		if code != http.StatusOK || body != fmt.Sprintf("tok%d.key", i) {
+			t.Fatalf("token %d: code=%d body=%q", i, code, body)
+		}
+	}
+	if st := m.Stats(); st.Active != n || st.Served < n {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	m.Remove("tok0")
+	if code, _ := serveChallenge(m, "tok0"); code != http.StatusNotFound {
+		t.Fatalf("removed token still served: %d", code)
+	}
+}
+
+func TestChallengeManager_ExpiryAndEviction(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	var mu sync.Mutex
+	m := NewChallengeManager()
+	m.now = func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	m.limit = 3
+	advance := func(d time.Duration) { mu.Lock(); now = now.Add(d); mu.Unlock() }
+
+	m.Put("old", "old.key")
+	advance(m.ttl / 2)
+	m.Put("fresh", "fresh.key")
+	advance(m.ttl/2 + time.Second)
+
+	if code, _ := serveChallenge(m, "old"); code != http.StatusNotFound {
+		t.Fatalf("expired token served: %d", code)
+	}
+	if code, body := serveChallenge(m, "fresh"); code != http.StatusOK || body != "fresh.key" {
+		t.Fatalf("live token: code=%d body=%q", code, body)
+	}
+
+	advance(m.ttl)
+	if m.sweep() {
+		t.Fatalf("sweep should report no tokens left")
+	}
+	if st := m.Stats(); st.Active != 0 || st.Expired != 2 {
+		t.Fatalf("unexpected stats after sweep: %+v", st)
+	}
+
+	for _, tok := range []string{"a", "b", "c", "d"} {
+		m.Put(tok, tok+".key")
+	}
+	if code, _ := serveChallenge(m, "a"); code != http.StatusNotFound {
+		t.Fatalf("oldest token should be evicted past the cap")
+	}
+	if st := m.Stats(); st.Active != 3 || st.Evicted != 1 {
+		t.Fatalf("unexpected stats after eviction: %+v", st)
+	}
+}
+
+func TestChallengeManager_NeverReflectsRequest(t *testing.T) {
+	m := NewChallengeManager()
+	for _, token := range []string{"<script>alert(1)</script>", "missing-token", ""} {
+		code, body := serveChallenge(m, token)
+		if code != http.StatusNotFound || strings.Contains(body, "script") || strings.Contains(body, "missing") {
+			t.Fatalf("token %q: code=%d body=%q", token, code, body)
+		}
+	}
+	m.Put("bad/token", "x")
+	if st := m.Stats(); st.Active != 0 || st.Unknown != 3 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
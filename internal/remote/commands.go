@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 
+	"piccolod/internal/remote/acme"
+	"piccolod/internal/remote/nexusclient"
 	"piccolod/internal/runtime/commands"
 )
 
@@ -12,10 +14,17 @@ const (
 	CommandDisable      = "remote.disable"
 	CommandRotateSecret = "remote.rotate_secret"
 	CommandRunPreflight = "remote.run_preflight"
+	CommandRunProbe     = "remote.run_probe"
 	CommandAddAlias     = "remote.add_alias"
 	CommandRemoveAlias  = "remote.remove_alias"
 	CommandRenewCert    = "remote.renew_certificate"
+	CommandRenewAll     = "remote.renew_all_certificates"
+	CommandRenewalLead  = "remote.set_renewal_lead"
+	CommandForgetCert   = "remote.forget_certificate"
+	CommandExportCert   = "remote.export_certificate"
 	CommandGuideVerify  = "remote.guide_verify"
+	CommandRotateACME   = "remote.rotate_acme_account_key"
+	CommandReconnect    = "remote.reconnect"
 )
 
 var ErrInvalidCommand = errors.New("remote: invalid command")
@@ -28,6 +37,12 @@ func (ConfigureCommand) Name() string { return CommandConfigure }
 
 type ConfigureResponse struct {
 	Status Status
+	// Plan is set instead of applying the request when Req.DryRun is true.
+	Plan *ConfigurePlan
+	// Probe reports the endpoint check when Req.Probe is set.
+	Probe *PreflightCheck
+	// Migration reports the certificates reconciled after a solver change.
+	Migration *SolverMigration
 }
 
 type DisableCommand struct{}
@@ -54,9 +69,18 @@ type RunPreflightResponse struct {
 	Result PreflightResult
 }
 
+type RunProbeCommand struct{}
+
+func (RunProbeCommand) Name() string { return CommandRunProbe }
+
+type RunProbeResponse struct {
+	Result ProbeResult
+}
+
 type AddAliasCommand struct {
 	Listener string
 	Hostname string
+	Options  AliasOptions
 }
 
 func (AddAliasCommand) Name() string { return CommandAddAlias }
@@ -77,12 +101,61 @@ type RenewCertCommand struct {
 
 func (RenewCertCommand) Name() string { return CommandRenewCert }
 
+type RenewAllCommand struct {
+	Force bool
+}
+
+func (RenewAllCommand) Name() string { return CommandRenewAll }
+
+type RenewAllResponse struct {
+	Queued []string
+}
+
+type SetRenewalLeadCommand struct {
+	Days int
+}
+
+func (SetRenewalLeadCommand) Name() string { return CommandRenewalLead }
+
+type ForgetCertCommand struct {
+	ID string
+}
+
+func (ForgetCertCommand) Name() string { return CommandForgetCert }
+
+type ExportCertCommand struct {
+	ID  string
+	Req CertExportRequest
+}
+
+func (ExportCertCommand) Name() string { return CommandExportCert }
+
+type ExportCertResponse struct {
+	Certificate Certificate
+}
+
 type GuideVerifyCommand struct {
 	Verification GuideVerification
 }
 
 func (GuideVerifyCommand) Name() string { return CommandGuideVerify }
 
+type RotateACMEKeyCommand struct{}
+
+func (RotateACMEKeyCommand) Name() string { return CommandRotateACME }
+
+type RotateACMEKeyResponse struct {
+	Account acme.AccountInfo
+}
+
+type ReconnectCommand struct{}
+
+func (ReconnectCommand) Name() string { return CommandReconnect }
+
+type ReconnectResponse struct {
+	Tunnel nexusclient.Stats
+}
+
 func RegisterHandlers(dispatcher *commands.Dispatcher, manager *Manager) {
 	if dispatcher == nil || manager == nil {
 		return
@@ -91,10 +164,17 @@ func RegisterHandlers(dispatcher *commands.Dispatcher, manager *Manager) {
 	dispatcher.Register(CommandDisable, commands.HandlerFunc(manager.handleDisableCommand))
 	dispatcher.Register(CommandRotateSecret, commands.HandlerFunc(manager.handleRotateSecretCommand))
 	dispatcher.Register(CommandRunPreflight, commands.HandlerFunc(manager.handleRunPreflightCommand))
+	dispatcher.Register(CommandRunProbe, commands.HandlerFunc(manager.handleRunProbeCommand))
 	dispatcher.Register(CommandAddAlias, commands.HandlerFunc(manager.handleAddAliasCommand))
 	dispatcher.Register(CommandRemoveAlias, commands.HandlerFunc(manager.handleRemoveAliasCommand))
 	dispatcher.Register(CommandRenewCert, commands.HandlerFunc(manager.handleRenewCertCommand))
+	dispatcher.Register(CommandRenewAll, commands.HandlerFunc(manager.handleRenewAllCommand))
+	dispatcher.Register(CommandRenewalLead, commands.HandlerFunc(manager.handleSetRenewalLeadCommand))
+	dispatcher.Register(CommandForgetCert, commands.HandlerFunc(manager.handleForgetCertCommand))
+	dispatcher.Register(CommandExportCert, commands.HandlerFunc(manager.handleExportCertCommand))
 	dispatcher.Register(CommandGuideVerify, commands.HandlerFunc(manager.handleGuideVerifyCommand))
+	dispatcher.Register(CommandRotateACME, commands.HandlerFunc(manager.handleRotateACMEKeyCommand))
+	dispatcher.Register(CommandReconnect, commands.HandlerFunc(manager.handleReconnectCommand))
 }
 
 func (m *Manager) handleConfigureCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
@@ -102,10 +182,18 @@ func (m *Manager) handleConfigureCommand(ctx context.Context, cmd commands.Comma
 	if !ok {
 		return nil, ErrInvalidCommand
 	}
-	if err := m.Configure(request.Req); err != nil {
+	if request.Req.DryRun {
+		plan, err := m.PlanConfigure(request.Req)
+		if err != nil {
+			return nil, err
+		}
+		return ConfigureResponse{Status: m.Status(), Plan: &plan}, nil
+	}
+	plan, err := m.ConfigureWithPlan(request.Req)
+	if err != nil {
 		return nil, err
 	}
-	return ConfigureResponse{Status: m.Status()}, nil
+	return ConfigureResponse{Status: m.Status(), Probe: plan.Probe, Migration: plan.Migration}, nil
 }
 
 func (m *Manager) handleDisableCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
@@ -133,19 +221,30 @@ func (m *Manager) handleRunPreflightCommand(ctx context.Context, cmd commands.Co
 	if _, ok := cmd.(RunPreflightCommand); !ok {
 		return nil, ErrInvalidCommand
 	}
-	result, err := m.RunPreflight()
+	result, err := m.RunPreflight(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return RunPreflightResponse{Result: result}, nil
 }
 
+func (m *Manager) handleRunProbeCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	if _, ok := cmd.(RunProbeCommand); !ok {
+		return nil, ErrInvalidCommand
+	}
+	result, err := m.RunProbe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return RunProbeResponse{Result: result}, nil
+}
+
 func (m *Manager) handleAddAliasCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
 	request, ok := cmd.(AddAliasCommand)
 	if !ok {
 		return nil, ErrInvalidCommand
 	}
-	alias, err := m.AddAlias(request.Listener, request.Hostname)
+	alias, err := m.AddAlias(request.Listener, request.Hostname, request.Options)
 	if err != nil {
 		return nil, err
 	}
@@ -174,6 +273,48 @@ func (m *Manager) handleRenewCertCommand(ctx context.Context, cmd commands.Comma
 	return nil, nil
 }
 
+func (m *Manager) handleRenewAllCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	request, ok := cmd.(RenewAllCommand)
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	return RenewAllResponse{Queued: m.RenewAll(request.Force)}, nil
+}
+
+func (m *Manager) handleSetRenewalLeadCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	request, ok := cmd.(SetRenewalLeadCommand)
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	if err := m.SetRenewalLead(request.Days); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (m *Manager) handleForgetCertCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	request, ok := cmd.(ForgetCertCommand)
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	if err := m.ForgetCertificate(request.ID); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (m *Manager) handleExportCertCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	request, ok := cmd.(ExportCertCommand)
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	cert, err := m.SetCertificateExport(request.ID, request.Req)
+	if err != nil {
+		return nil, err
+	}
+	return ExportCertResponse{Certificate: cert}, nil
+}
+
 func (m *Manager) handleGuideVerifyCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
 	request, ok := cmd.(GuideVerifyCommand)
 	if !ok {
@@ -184,3 +325,25 @@ func (m *Manager) handleGuideVerifyCommand(ctx context.Context, cmd commands.Com
 	}
 	return nil, nil
 }
+
+func (m *Manager) handleRotateACMEKeyCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	if _, ok := cmd.(RotateACMEKeyCommand); !ok {
+		return nil, ErrInvalidCommand
+	}
+	info, err := m.RotateACMEAccountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return RotateACMEKeyResponse{Account: info}, nil
+}
+
+func (m *Manager) handleReconnectCommand(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+	if _, ok := cmd.(ReconnectCommand); !ok {
+		return nil, ErrInvalidCommand
+	}
+	stats, err := m.ReconnectTunnel()
+	if err != nil {
+		return nil, err
+	}
+	return ReconnectResponse{Tunnel: stats}, nil
+}
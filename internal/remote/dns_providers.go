@@ -0,0 +1,325 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNoLiveCheck is returned by CheckDNSCredentials for providers whose
+// credentials can only be checked against the schema.
+var ErrNoLiveCheck = errors.New("remote: provider does not support live credential checks")
+
+// CredentialField describes one credential a DNS provider needs.
+type CredentialField struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Secret   bool   `json:"secret,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	// Pattern is the regular expression a submitted value must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// dnsCredentialCheck performs a live check and returns a short description
+// of what was verified.
+type dnsCredentialCheck func(ctx context.Context, creds map[string]string, zone string) (string, error)
+
+// DNSProvider is an entry in the DNS-01 provider registry. The registry is
+// the single list of provider IDs: the API, Configure and dns-01 solver
+// drivers all look providers up here.
+type DNSProvider struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	DocsURL   string            `json:"docs_url"`
+	Fields    []CredentialField `json:"fields"`
+	LiveCheck bool              `json:"live_check"`
+
+	check dnsCredentialCheck
+}
+
+// cloudflareAPI is the Cloudflare v4 API base; tests point it at a fake.
+var cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+var dnsCheckHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+var dnsProviders = []DNSProvider{
+	{
+		ID:      "cloudflare",
+		Name:    "Cloudflare",
+		DocsURL: "https://go-acme.github.io/lego/dns/cloudflare/",
+		Fields: []CredentialField{
+			{ID: "api_token", Label: "API Token", Secret: true, Pattern: `^[A-Za-z0-9_-]{40}$`},
+		},
+		check: checkCloudflare,
+	},
+	{
+		ID:      "route53",
+		Name:    "AWS Route53",
+		DocsURL: "https://go-acme.github.io/lego/dns/route53/",
+		Fields: []CredentialField{
+			{ID: "access_key", Label: "Access Key ID", Pattern: `^(AKIA|ASIA)[A-Z0-9]{16}$`},
+			{ID: "secret_key", Label: "Secret Access Key", Secret: true, Pattern: `^[A-Za-z0-9/+=]{40}$`},
+			{ID: "region", Label: "Region", Optional: true, Pattern: `^[a-z]{2}(-[a-z]+)+-[0-9]$`},
+			{ID: "hosted_zone_id", Label: "Hosted Zone ID", Optional: true, Pattern: `^Z[A-Z0-9]{1,31}$`},
+		},
+	},
+	{
+		ID:      "rfc2136",
+		Name:    "RFC 2136 (dynamic DNS with TSIG)",
+		DocsURL: "https://go-acme.github.io/lego/dns/rfc2136/",
+		Fields: []CredentialField{
+			{ID: "nameserver", Label: "Nameserver (host or host:port)", Pattern: `^[A-Za-z0-9.:\[\]-]+$`},
+			{ID: "tsig_key", Label: "TSIG Key Name", Pattern: `^[A-Za-z0-9._-]+$`},
+			{ID: "tsig_secret", Label: "TSIG Secret (base64)", Secret: true, Pattern: `^[A-Za-z0-9+/]+={0,2}$`},
+			{ID: "tsig_algorithm", Label: "TSIG Algorithm", Optional: true, Pattern: `^hmac-(sha1|sha224|sha256|sha384|sha512)\.?$`},
+		},
+		check: checkRFC2136,
+	},
+}
+
+func init() {
+	for i := range dnsProviders {
+		p := &dnsProviders[i]
+		p.LiveCheck = p.check != nil
+		for j := range p.Fields {
+			if p.Fields[j].Pattern != "" {
+				p.Fields[j].re = regexp.MustCompile(p.Fields[j].Pattern)
+			}
+		}
+	}
+}
+
+// DNSProviders lists the registry in display order.
+func DNSProviders() []DNSProvider {
+	out := make([]DNSProvider, len(dnsProviders))
+	copy(out, dnsProviders)
+	return out
+}
+
+// LookupDNSProvider returns the registry entry for id.
+func LookupDNSProvider(id string) (DNSProvider, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, p := range dnsProviders {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return DNSProvider{}, false
+}
+
+// CredentialError reports per-field problems with submitted DNS credentials.
+type CredentialError struct {
+	Provider string
+	// Fields maps a credential field (or "dns_provider") to its problem.
+	Fields map[string]string
+}
+
+func (e *CredentialError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+": "+e.Fields[k])
+	}
+	return "invalid dns credentials: " + strings.Join(parts, "; ")
+}
+
+// ValidateDNSCredentials checks creds against the schema of the provider.
+// Unknown fields, missing required fields and values that do not match the
+// field pattern are reported together as a *CredentialError. Secret values
+// are never echoed back.
+func ValidateDNSCredentials(providerID string, creds map[string]string) error {
+	provider, ok := LookupDNSProvider(providerID)
+	if !ok {
+		return &CredentialError{Provider: providerID, Fields: map[string]string{"dns_provider": fmt.Sprintf("unsupported provider %q", providerID)}}
+	}
+	problems := map[string]string{}
+	known := make(map[string]bool, len(provider.Fields))
+	for _, f := range provider.Fields {
+		known[f.ID] = true
+		value := strings.TrimSpace(creds[f.ID])
+		switch {
+		case value == "":
+			if !f.Optional {
+				problems[f.ID] = "required"
+			}
+		case f.re != nil && !f.re.MatchString(value):
+			problems[f.ID] = "invalid format for " + f.Label
+		}
+	}
+	for k := range creds {
+		if !known[k] {
+			problems[k] = "unknown field for " + provider.Name
+		}
+	}
+	if len(problems) > 0 {
+		return &CredentialError{Provider: provider.ID, Fields: problems}
+	}
+	return nil
+}
+
+// validateConfigureDNS applies the provider schema to a configure request.
+// http-01 setups may omit the provider entirely.
+func validateConfigureDNS(solver string, req ConfigureRequest) error {
+	provider := strings.TrimSpace(req.DNSProvider)
+	if provider == "" {
+		if solver == "dns-01" {
+			return errors.New("dns_provider required for dns-01")
+		}
+		if len(req.DNSCredentials) > 0 {
+			return &CredentialError{Fields: map[string]string{"dns_provider": "required when dns_credentials are set"}}
+		}
+		return nil
+	}
+	return ValidateDNSCredentials(provider, req.DNSCredentials)
+}
+
+// CheckDNSCredentials validates creds and, where the provider supports it,
+// asks the provider whether they work for zone. It returns a description of
+// what was verified, or ErrNoLiveCheck after a successful schema check.
+func CheckDNSCredentials(ctx context.Context, providerID string, creds map[string]string, zone string) (string, error) {
+	if err := ValidateDNSCredentials(providerID, creds); err != nil {
+		return "", err
+	}
+	provider, _ := LookupDNSProvider(providerID)
+	if provider.check == nil {
+		return "", ErrNoLiveCheck
+	}
+	trimmed := make(map[string]string, len(creds))
+	for k, v := range creds {
+		trimmed[k] = strings.TrimSpace(v)
+	}
+	return provider.check(ctx, trimmed, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(zone)), "."))
+}
+
+// zoneCandidates lists zone and its parents down to two labels, since the
+// configured TLD is often a subdomain of the zone the provider hosts.
+func zoneCandidates(zone string) []string {
+	labels := strings.Split(zone, ".")
+	var out []string
+	for i := 0; i+2 <= len(labels); i++ {
+		out = append(out, strings.Join(labels[i:], "."))
+	}
+	return out
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func cloudflareGet(ctx context.Context, token, path string) (cloudflareResponse, error) {
+	var out cloudflareResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareAPI+path, nil)
+	if err != nil {
+		return out, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := dnsCheckHTTPClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("cloudflare unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return out, fmt.Errorf("cloudflare: unexpected response (HTTP %d)", resp.StatusCode)
+	}
+	if !out.Success || resp.StatusCode != http.StatusOK {
+		msgs := make([]string, 0, len(out.Errors))
+		for _, e := range out.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		if len(msgs) == 0 {
+			msgs = append(msgs, http.StatusText(resp.StatusCode))
+		}
+		return out, fmt.Errorf("cloudflare rejected the token: %s", strings.Join(msgs, "; "))
+	}
+	return out, nil
+}
+
+// checkCloudflare verifies the token and, with a zone, that the token can
+// see it.
+func checkCloudflare(ctx context.Context, creds map[string]string, zone string) (string, error) {
+	token := creds["api_token"]
+	if zone == "" {
+		if _, err := cloudflareGet(ctx, token, "/user/tokens/verify"); err != nil {
+			return "", err
+		}
+		return "token is active", nil
+	}
+	for _, candidate := range zoneCandidates(zone) {
+		resp, err := cloudflareGet(ctx, token, "/zones?name="+url.QueryEscape(candidate))
+		if err != nil {
+			return "", err
+		}
+		var zones []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(resp.Result, &zones); err != nil {
+			return "", fmt.Errorf("cloudflare: unexpected zone list: %w", err)
+		}
+		if len(zones) > 0 {
+			return "token can access zone " + zones[0].Name, nil
+		}
+	}
+	return "", fmt.Errorf("token cannot access a zone for %s", zone)
+}
+
+// checkRFC2136 sends a TSIG-signed SOA query for the zone; a server that
+// does not know the key answers NOTAUTH or returns an unverifiable signature.
+func checkRFC2136(ctx context.Context, creds map[string]string, zone string) (string, error) {
+	if zone == "" {
+		return "", errors.New("zone required for rfc2136 checks")
+	}
+	server := creds["nameserver"]
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	keyName := dns.Fqdn(strings.ToLower(creds["tsig_key"]))
+	algorithm := dns.HmacSHA256
+	if alg := creds["tsig_algorithm"]; alg != "" {
+		algorithm = dns.Fqdn(strings.ToLower(alg))
+	}
+	client := &dns.Client{Timeout: 10 * time.Second, TsigSecret: map[string]string{keyName: creds["tsig_secret"]}}
+	for _, candidate := range zoneCandidates(zone) {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(candidate), dns.TypeSOA)
+		msg.SetTsig(keyName, algorithm, 300, time.Now().Unix())
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		if err != nil {
+			if errors.Is(err, dns.ErrSig) || errors.Is(err, dns.ErrSecret) {
+				return "", fmt.Errorf("nameserver did not accept the TSIG key: %w", err)
+			}
+			return "", fmt.Errorf("nameserver %s unreachable: %w", server, err)
+		}
+		switch resp.Rcode {
+		case dns.RcodeNotAuth:
+			return "", errors.New("nameserver rejected the TSIG key")
+		case dns.RcodeSuccess:
+			for _, rr := range resp.Answer {
+				if soa, ok := rr.(*dns.SOA); ok {
+					return "TSIG key accepted for zone " + strings.TrimSuffix(soa.Hdr.Name, "."), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("nameserver is not authoritative for %s", zone)
+}
@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// allowInsecureEndpointEnv permits ws:// Nexus endpoints, for lab setups
+// without a certificate on the Nexus host.
+const allowInsecureEndpointEnv = "PICCOLO_REMOTE_ALLOW_INSECURE_WS"
+
+// endpointProbeTimeout bounds each step of an endpoint check.
+const endpointProbeTimeout = 5 * time.Second
+
+// EndpointError explains why a Nexus endpoint URL was rejected.
+type EndpointError struct {
+	Input  string
+	Reason string
+}
+
+func (e *EndpointError) Error() string { return e.Reason }
+
+// parseEndpoint validates a Nexus endpoint URL. Only wss:// and https:// are
+// accepted (ws:// too when allowInsecureEndpointEnv is set); credentials,
+// query strings and fragments are refused because the adapter would drop
+// or mangle them.
+func parseEndpoint(raw string) (*url.URL, error) {
+	trimmed := strings.TrimSpace(raw)
+	fail := func(format string, args ...any) (*url.URL, error) {
+		return nil, &EndpointError{Input: raw, Reason: fmt.Sprintf(format, args...)}
+	}
+	if trimmed == "" {
+		return fail("endpoint required")
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return fail("endpoint is not a valid URL")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "wss", "https":
+	case "ws":
+		if os.Getenv(allowInsecureEndpointEnv) != "1" {
+			return fail("endpoint must use wss:// (ws:// is only allowed with %s=1)", allowInsecureEndpointEnv)
+		}
+	case "":
+		return fail("endpoint must start with wss://")
+	default:
+		return fail("endpoint scheme %s:// is not supported; use wss://", u.Scheme)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.User != nil {
+		return fail("endpoint must not include credentials; use the device secret instead")
+	}
+	if u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return fail("endpoint must not include a query string or fragment")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fail("endpoint host required")
+	}
+	if net.ParseIP(host) == nil {
+		if _, _, err := normalizeHostname("endpoint", host); err != nil {
+			return fail("endpoint host %s is not a valid domain name", host)
+		}
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return fail("endpoint port %s is out of range (1-65535)", port)
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return fail("endpoint port is empty")
+	}
+	return u, nil
+}
+
+// endpointAddress is the host:port the endpoint connects to.
+func endpointAddress(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "ws" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// endpointProbe is the outcome of probing an endpoint: a preflight check
+// plus the measured connect latency when it passed.
+type endpointProbe struct {
+	Check   PreflightCheck
+	Latency time.Duration
+}
+
+// checkEndpoint connects to the endpoint over TCP and, for TLS schemes,
+// completes a TLS handshake against its hostname. Each step has
+// endpointProbeTimeout, within ctx.
+func (m *Manager) checkEndpoint(ctx context.Context, endpoint string) endpointProbe {
+	const name = "Nexus endpoint reachable"
+	u, err := parseEndpoint(endpoint)
+	if err != nil {
+		return endpointProbe{Check: PreflightCheck{Name: name, Status: "fail", Detail: err.Error(), NextStep: "Reconfigure remote access with a wss:// endpoint"}}
+	}
+	start := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+	conn, err := m.dialer.DialContext(dialCtx, "tcp", endpointAddress(u))
+	if err != nil {
+		if dialCtx.Err() != nil {
+			return endpointProbe{Check: timedOutCheck(dialCtx, name)}
+		}
+		return endpointProbe{Check: PreflightCheck{Name: name, Status: "fail", Detail: err.Error(), NextStep: "Verify firewall and DNS"}}
+	}
+	defer conn.Close()
+	latency := time.Since(start)
+	if u.Scheme != "ws" {
+		hsCtx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+		defer cancel()
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), RootCAs: m.probeRoots, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+			if hsCtx.Err() != nil {
+				return endpointProbe{Check: timedOutCheck(hsCtx, name)}
+			}
+			return endpointProbe{Check: PreflightCheck{Name: name, Status: "fail", Detail: "TLS handshake failed: " + err.Error(), NextStep: "Check the certificate served by the Nexus host"}}
+		}
+	}
+	return endpointProbe{
+		Check:   PreflightCheck{Name: name, Status: "pass", Detail: fmt.Sprintf("Latency %d ms", latency.Milliseconds())},
+		Latency: latency,
+	}
+}
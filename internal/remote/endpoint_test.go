@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEndpointRejects(t *testing.T) {
+	cases := []struct {
+		endpoint string
+		reason   string
+	}{
+		{"", "endpoint required"},
+		{"nexus.example.com", "must start with wss://"},
+		{"http://nexus.example.com", "scheme http:// is not supported"},
+		{"ftp://nexus.example.com", "scheme ftp:// is not supported"},
+		{"ws://nexus.example.com", "ws:// is only allowed"},
+		{"wss://user:pw@nexus.example.com", "must not include credentials"},
+		{"wss://nexus.example.com/connect?token=x", "query string"},
+		{"wss://nexus.example.com/connect#frag", "query string or fragment"},
+		{"wss://nexus.example.com:0", "out of range"},
+		{"wss://nexus.example.com:70000", "out of range"},
+		{"wss://nexus.example.com:", "port is empty"},
+		{"wss:///connect", "host required"},
+		{"wss://nexus_bad.example.com", "not a valid domain name"},
+	}
+	for _, tc := range cases {
+		_, err := parseEndpoint(tc.endpoint)
+		var endpointErr *EndpointError
+		if !errors.As(err, &endpointErr) || !strings.Contains(endpointErr.Reason, tc.reason) {
+			t.Errorf("%q: got %v, want reason containing %q", tc.endpoint, err, tc.reason)
+		}
+	}
+}
+
+func TestParseEndpointAccepts(t *testing.T) {
+	for _, endpoint := range []string{"wss://nexus.example.com/connect", "HTTPS://nexus.example.com:8443", "wss://10.0.0.7"} {
+		if _, err := parseEndpoint(endpoint); err != nil {
+			t.Errorf("%q rejected: %v", endpoint, err)
+		}
+	}
+	t.Setenv(allowInsecureEndpointEnv, "1")
+	u, err := parseEndpoint("ws://nexus.lab.example:8080/connect")
+	if err != nil {
+		t.Fatalf("ws:// with %s=1: %v", allowInsecureEndpointEnv, err)
+	}
+	if got := endpointAddress(u); got != "nexus.lab.example:8080" {
+		t.Fatalf("endpointAddress = %q", got)
+	}
+}
+
+func newProbeTestManager(t *testing.T, d dialer) *Manager {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "remote-probe")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, d, &stubResolver{}, fixedNow(time.Unix(10, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	return m
+}
+
+func TestConfigureProbeReportsResult(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	nexus := httptest.NewTLSServer(http.NotFoundHandler())
+	defer nexus.Close()
+	_, port, _ := net.SplitHostPort(nexus.Listener.Addr().String())
+
+	m := newProbeTestManager(t, netDialer{})
+	m.probeRoots = nexus.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	req := ConfigureRequest{
+		Endpoint:       "wss://127.0.0.1:" + port + "/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+		Probe:          true,
+	}
+	plan, err := m.ConfigureWithPlan(req)
+	if err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if plan.Probe == nil || plan.Probe.Status != "pass" {
+		t.Fatalf("expected passing probe, got %+v", plan.Probe)
+	}
+	if !m.currentConfig().LastHandshake.IsZero() {
+		t.Fatalf("configure must not record a handshake")
+	}
+
+	// Without the test CA the certificate is untrusted.
+	m.probeRoots = nil
+	plan, err = m.ConfigureWithPlan(req)
+	if err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if plan.Probe == nil || plan.Probe.Status != "fail" || !strings.Contains(plan.Probe.Detail, "TLS handshake failed") {
+		t.Fatalf("expected TLS failure, got %+v", plan.Probe)
+	}
+
+	failing := newProbeTestManager(t, &stubDialer{err: errors.New("connection refused")})
+	plan, err = failing.ConfigureWithPlan(req)
+	if err != nil {
+		t.Fatalf("a failed probe must not block configure: %v", err)
+	}
+	if plan.Probe == nil || plan.Probe.Status != "fail" || plan.Probe.Detail != "connection refused" {
+		t.Fatalf("expected dial failure, got %+v", plan.Probe)
+	}
+
+	req.Probe = false
+	if plan, err = failing.ConfigureWithPlan(req); err != nil || plan.Probe != nil {
+		t.Fatalf("probe should be opt-in: plan=%+v err=%v", plan.Probe, err)
+	}
+}
@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MarshalJSON writes the timestamp in UTC whatever zone it was recorded in;
+// events saved by older versions may carry a local offset.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	out := plain(e)
+	out.Timestamp = out.Timestamp.UTC()
+	return json.Marshal(out)
+}
+
+// numberEvents gives every event without a sequence number the next one.
+// Events saved before numbering existed are numbered in their stored order.
+func numberEvents(cfg *Config) {
+	for i := range cfg.Events {
+		if cfg.Events[i].Seq == 0 {
+			cfg.EventSeq++
+			cfg.Events[i].Seq = cfg.EventSeq
+		}
+	}
+}
+
+// stampFreshness sets GeneratedAt and AgeSeconds on st and moves every
+// timestamp in it to UTC. The clones Status is built from share their time
+// pointers with the config, so times are replaced rather than written
+// through.
+func stampFreshness(st *Status, now time.Time) {
+	now = now.UTC()
+	st.GeneratedAt = now
+	ages := map[string]int64{}
+	age := func(name string, t *time.Time) *time.Time {
+		t = utcPtr(t)
+		if t != nil {
+			ages[name] = int64(now.Sub(*t) / time.Second)
+		}
+		return t
+	}
+	st.LastHandshake = age("last_handshake", st.LastHandshake)
+	st.NextRenewal = age("next_renewal", st.NextRenewal)
+	st.ExpiresAt = age("expires_at", st.ExpiresAt)
+	st.GuideVerifiedAt = age("guide_verified_at", st.GuideVerifiedAt)
+	if st.LastProbe != nil && !st.LastProbe.RanAt.IsZero() {
+		st.LastProbe.RanAt = *age("last_probe", &st.LastProbe.RanAt)
+	}
+	if len(ages) > 0 {
+		st.AgeSeconds = ages
+	}
+
+	for i := range st.Aliases {
+		st.Aliases[i].LastChecked = utcPtr(st.Aliases[i].LastChecked)
+	}
+	for i := range st.Certificates {
+		c := &st.Certificates[i]
+		c.IssuedAt = utcPtr(c.IssuedAt)
+		c.ExpiresAt = utcPtr(c.ExpiresAt)
+		c.NextRenewal = utcPtr(c.NextRenewal)
+		c.OrphanedAt = utcPtr(c.OrphanedAt)
+		if c.Export != nil && c.Export.LastHook != nil {
+			export, hook := *c.Export, *c.Export.LastHook
+			hook.At = hook.At.UTC()
+			export.LastHook = &hook
+			c.Export = &export
+		}
+	}
+}
+
+// utcPtr returns a copy of t in UTC, or nil.
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
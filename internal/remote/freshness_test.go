@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusSerializesUTCWithAges(t *testing.T) {
+	m, advance := newClockedManager(t)
+	local := time.FixedZone("CEST", 2*60*60)
+	handshake := m.now().Add(-3 * time.Minute).In(local)
+	renewal := m.now().Add(48 * time.Hour).In(local)
+	if err := m.update(func(cfg *Config) error {
+		cfg.LastHandshake = handshake
+		cfg.NextRenewal = renewal
+		return nil
+	}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	advance(30 * time.Second)
+
+	raw, err := json.Marshal(m.Status())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out struct {
+		GeneratedAt   string           `json:"generated_at"`
+		LastHandshake string           `json:"last_handshake"`
+		NextRenewal   string           `json:"next_renewal"`
+		AgeSeconds    map[string]int64 `json:"age_seconds"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out.GeneratedAt != "1970-01-12T13:47:10Z" {
+		t.Fatalf("generated_at = %q", out.GeneratedAt)
+	}
+	if out.LastHandshake != "1970-01-12T13:43:40Z" || out.NextRenewal != "1970-01-14T13:46:40Z" {
+		t.Fatalf("times not in UTC: last_handshake=%q next_renewal=%q", out.LastHandshake, out.NextRenewal)
+	}
+	if got := out.AgeSeconds["last_handshake"]; got != 210 {
+		t.Fatalf("last_handshake age = %d, want 210", got)
+	}
+	if got := out.AgeSeconds["next_renewal"]; got != -(48*60*60 - 30) {
+		t.Fatalf("next_renewal age = %d", got)
+	}
+	if _, ok := out.AgeSeconds["expires_at"]; ok {
+		t.Fatalf("unset timestamps must not get an age: %v", out.AgeSeconds)
+	}
+	// The stored config keeps the zone it was given.
+	if m.currentConfig().LastHandshake.Location() != local {
+		t.Fatalf("status normalization leaked into the config")
+	}
+}
+
+func TestEventsGetSequenceNumbers(t *testing.T) {
+	m, _ := newClockedManager(t)
+	// Events saved before numbering existed, with colliding timestamps.
+	legacy := time.Unix(1_000_000, 0).In(time.FixedZone("PDT", -7*60*60))
+	if err := m.update(func(cfg *Config) error {
+		cfg.Events = []Event{
+			{Timestamp: legacy, Level: "info", Source: "remote", Message: "first"},
+			{Timestamp: legacy, Level: "info", Source: "remote", Message: "second"},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := m.ListEvents(); got[0].Seq != 2 || got[1].Seq != 1 {
+		t.Fatalf("legacy events not numbered in stored order: %+v", got)
+	}
+	for _, msg := range []string{"third", "fourth"} {
+		if err := m.update(func(cfg *Config) error {
+			m.appendEvent(cfg, Event{Level: "info", Source: "remote", Message: msg})
+			return nil
+		}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	evts := m.ListEvents()
+	want := []string{"fourth", "third", "second", "first"}
+	for i, evt := range evts {
+		if evt.Message != want[i] || evt.Seq != uint64(len(want)-i) {
+			t.Fatalf("event %d = %+v, want %s with seq %d", i, evt, want[i], len(want)-i)
+		}
+	}
+	if !evts[0].Timestamp.Equal(m.now()) {
+		t.Fatalf("event without a timestamp should get m.now(), got %s", evts[0].Timestamp)
+	}
+	raw, err := json.Marshal(evts[3])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(raw), `"seq":1,"ts":"1970-01-12T13:46:40Z"`) {
+		t.Fatalf("legacy event not serialized in UTC: %s", raw)
+	}
+}
@@ -0,0 +1,96 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+const maxHostnameLength = 253
+
+// HostnameError explains why a configured domain name was rejected. Field
+// names the request field ("tld", "portal_hostname" or "hostname").
+type HostnameError struct {
+	Field  string
+	Input  string
+	Reason string
+}
+
+func (e *HostnameError) Error() string { return e.Reason }
+
+// normalizeHostname lowercases name, drops a trailing dot and converts
+// Unicode labels to punycode. It returns the ASCII form used for
+// certificates and DNS alongside the Unicode form for display.
+func normalizeHostname(field, name string) (ascii, display string, err error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if trimmed == "" {
+		return "", "", &HostnameError{Field: field, Input: name, Reason: field + " required"}
+	}
+	ascii, err = idna.Lookup.ToASCII(trimmed)
+	if err != nil {
+		return "", "", &HostnameError{Field: field, Input: name, Reason: fmt.Sprintf("%s is not a valid domain name: %v", trimmed, err)}
+	}
+	ascii = strings.ToLower(ascii)
+	if len(ascii) > maxHostnameLength {
+		return "", "", &HostnameError{Field: field, Input: name, Reason: fmt.Sprintf("%s is longer than %d characters", trimmed, maxHostnameLength)}
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if !validHostnameLabel(label) {
+			return "", "", &HostnameError{Field: field, Input: name, Reason: fmt.Sprintf("%s is not a valid domain name: bad label %q", trimmed, label)}
+		}
+	}
+	display, err = idna.Display.ToUnicode(ascii)
+	if err != nil {
+		display = ascii
+	}
+	return ascii, display, nil
+}
+
+// normalizeRegistrable is normalizeHostname for names a certificate will be
+// requested for: they must be a registrable domain (eTLD+1) or below one,
+// since a CA will not issue for a bare public suffix such as "co.uk".
+func normalizeRegistrable(field, name string) (ascii, display string, err error) {
+	ascii, display, err = normalizeHostname(field, name)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := publicsuffix.EffectiveTLDPlusOne(ascii); err != nil {
+		return "", "", &HostnameError{Field: field, Input: name, Reason: fmt.Sprintf("%s is a public suffix; enter a domain you own", display)}
+	}
+	return ascii, display, nil
+}
+
+// normalizeTLD validates the domain remote hostnames are issued under.
+func normalizeTLD(tld string) (ascii, display string, err error) {
+	return normalizeRegistrable("tld", tld)
+}
+
+// normalizePortalHost resolves the portal hostname against tld: a single
+// label becomes a subdomain of tld, anything longer is taken as given.
+func normalizePortalHost(tld, portal string) (ascii, display string, err error) {
+	host := strings.TrimSuffix(strings.TrimSpace(portal), ".")
+	tld = strings.TrimSuffix(strings.TrimSpace(tld), ".")
+	if host != "" && tld != "" && !strings.Contains(host, ".") {
+		host = host + "." + tld
+	}
+	return normalizeRegistrable("portal_hostname", host)
+}
+
+func validHostnameLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		ch := label[i]
+		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' {
+			continue
+		}
+		return false
+	}
+	return true
+}
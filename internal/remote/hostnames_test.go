@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+type hostnameCase struct {
+	name        string
+	input       string
+	wantASCII   string
+	wantDisplay string
+	wantErr     string
+}
+
+var registrableCases = []hostnameCase{
+	{name: "plain", input: "example.com", wantASCII: "example.com", wantDisplay: "example.com"},
+	{name: "mixed case", input: "Home.Example.COM", wantASCII: "home.example.com", wantDisplay: "home.example.com"},
+	{name: "trailing dot", input: "example.com.", wantASCII: "example.com", wantDisplay: "example.com"},
+	{name: "surrounding space", input: "  example.org ", wantASCII: "example.org", wantDisplay: "example.org"},
+	{name: "idn", input: "Bücher.example", wantASCII: "xn--bcher-kva.example", wantDisplay: "bücher.example"},
+	{name: "punycode input", input: "xn--bcher-kva.example", wantASCII: "xn--bcher-kva.example", wantDisplay: "bücher.example"},
+	{name: "under multi-label suffix", input: "example.co.uk", wantASCII: "example.co.uk", wantDisplay: "example.co.uk"},
+	{name: "bare label", input: "example", wantErr: "example is a public suffix; enter a domain you own"},
+	{name: "suffix only", input: "co.uk", wantErr: "co.uk is a public suffix; enter a domain you own"},
+	{name: "suffix with trailing dot", input: "COM.", wantErr: "com is a public suffix; enter a domain you own"},
+	{name: "idn suffix", input: "公司.cn", wantErr: "公司.cn is a public suffix; enter a domain you own"},
+	{name: "wildcard", input: "*.example.com", wantErr: "not a valid domain name"},
+	{name: "space inside", input: "exa mple.com", wantErr: "not a valid domain name"},
+	{name: "empty", input: " ", wantErr: "required"},
+}
+
+func checkHostnameCase(t *testing.T, tc hostnameCase, ascii, display string, err error) {
+	t.Helper()
+	if tc.wantErr != "" {
+		var hostErr *HostnameError
+		if !errors.As(err, &hostErr) || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%q: expected HostnameError containing %q, got %v", tc.input, tc.wantErr, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("%q: unexpected error %v", tc.input, err)
+	}
+	if ascii != tc.wantASCII || display != tc.wantDisplay {
+		t.Fatalf("%q: got (%q, %q), want (%q, %q)", tc.input, ascii, display, tc.wantASCII, tc.wantDisplay)
+	}
+}
+
+func newHostnameTestManager(t *testing.T) *Manager {
+	t.Helper()
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir, err := os.MkdirTemp("", "remote-hostnames")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	return m
+}
+
+func TestConfigureNormalizesTLD(t *testing.T) {
+	for _, tc := range registrableCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newHostnameTestManager(t)
+			err := m.Configure(ConfigureRequest{
+				Endpoint:       "wss://nexus.example.com/connect",
+				DeviceSecret:   "secret",
+				Solver:         "http-01",
+				TLD:            tc.input,
+				PortalHostname: "portal",
+			})
+			st := m.Status()
+			checkHostnameCase(t, tc, st.TLD, st.TLDDisplay, err)
+			if tc.wantErr != "" {
+				if st.Enabled {
+					t.Fatalf("rejected configure must not enable remote")
+				}
+				return
+			}
+			if st.PortalHostname != "portal."+tc.wantASCII || st.PortalHostnameDisplay != "portal."+tc.wantDisplay {
+				t.Fatalf("portal hostname = (%q, %q)", st.PortalHostname, st.PortalHostnameDisplay)
+			}
+		})
+	}
+}
+
+func TestAddAliasNormalizesHostname(t *testing.T) {
+	for _, tc := range registrableCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newHostnameTestManager(t)
+			alias, err := m.AddAlias("portal", tc.input, AliasOptions{})
+			checkHostnameCase(t, tc, alias.Hostname, alias.HostnameDisplay, err)
+			if tc.wantErr == "" && len(m.ListAliases()) != 1 {
+				t.Fatalf("alias not stored")
+			}
+		})
+	}
+}
+
+func TestNormalizePortalHost(t *testing.T) {
+	cases := []struct {
+		tld string
+		hostnameCase
+	}{
+		{"example.com", hostnameCase{name: "label joins tld", input: "Portal", wantASCII: "portal.example.com", wantDisplay: "portal.example.com"}},
+		{"example.com", hostnameCase{name: "full name kept", input: "PORTAL.example.com.", wantASCII: "portal.example.com", wantDisplay: "portal.example.com"}},
+		{"example.com", hostnameCase{name: "tld itself", input: "example.com", wantASCII: "example.com", wantDisplay: "example.com"}},
+		{"example.com", hostnameCase{name: "other domain", input: "home.example.net", wantASCII: "home.example.net", wantDisplay: "home.example.net"}},
+		{"xn--bcher-kva.example", hostnameCase{name: "idn label under punycode tld", input: "Café", wantASCII: "xn--caf-dma.xn--bcher-kva.example", wantDisplay: "café.bücher.example"}},
+		{"example.com", hostnameCase{name: "public suffix", input: "co.uk", wantErr: "co.uk is a public suffix; enter a domain you own"}},
+		{"", hostnameCase{name: "label without tld", input: "portal", wantErr: "portal is a public suffix"}},
+		{"example.com", hostnameCase{name: "empty", input: "", wantErr: "required"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ascii, display, err := normalizePortalHost(tc.tld, tc.input)
+			checkHostnameCase(t, tc.hostnameCase, ascii, display, err)
+		})
+	}
+}
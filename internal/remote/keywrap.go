@@ -0,0 +1,238 @@
+package remote
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"piccolod/internal/crypt"
+)
+
+const (
+	plaintextKeyExt = ".key"
+	sealedKeyExt    = ".key.enc"
+	sealedKeyFormat = 1
+
+	// PlaintextKeysEnv disables wrapping certificate private keys even when
+	// the crypt manager is initialized.
+	PlaintextKeysEnv = "PICCOLO_REMOTE_PLAINTEXT_KEYS"
+)
+
+// ErrKeySealed reports a wrapped private key that cannot be opened while
+// storage is locked.
+var ErrKeySealed = errors.New("remote: certificate key sealed; unlock required")
+
+// KeySealer exposes the storage encryption key used to wrap certificate
+// private keys. crypt.Manager satisfies it.
+type KeySealer interface {
+	IsInitialized() bool
+	WithSDEK(fn func([]byte) error) error
+}
+
+// sealedKeyFile is the on-disk form of a wrapped private key. The certificate
+// name is bound as additional data so files cannot be swapped between names.
+type sealedKeyFile struct {
+	Version    int    `json:"version"`
+	Nonce      string `json:"nonce"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// keyProtectionEnabled reports whether new keys should be written wrapped.
+func keyProtectionEnabled(s KeySealer) bool {
+	if s == nil || !s.IsInitialized() {
+		return false
+	}
+	return os.Getenv(PlaintextKeysEnv) != "1"
+}
+
+func withKeyAEAD(s KeySealer, fn func(cipher.AEAD) error) error {
+	err := s.WithSDEK(func(sdek []byte) error {
+		block, err := aes.NewCipher(sdek)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		return fn(aead)
+	})
+	if errors.Is(err, crypt.ErrLocked) {
+		return ErrKeySealed
+	}
+	return err
+}
+
+func sealPrivateKey(s KeySealer, name string, keyPEM []byte) ([]byte, error) {
+	var out sealedKeyFile
+	err := withKeyAEAD(s, func(aead cipher.AEAD) error {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := aead.Seal(nil, nonce, keyPEM, []byte(name))
+		out = sealedKeyFile{
+			Version:    sealedKeyFormat,
+			Nonce:      base64.StdEncoding.EncodeToString(nonce),
+			WrappedKey: base64.StdEncoding.EncodeToString(sealed),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+func openPrivateKey(s KeySealer, name string, data []byte) ([]byte, error) {
+	if s == nil {
+		return nil, ErrKeySealed
+	}
+	var in sealedKeyFile
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("decode sealed key: %w", err)
+	}
+	if in.Version != sealedKeyFormat {
+		return nil, fmt.Errorf("unsupported sealed key version %d", in.Version)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(in.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("decode nonce: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(in.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped key: %w", err)
+	}
+	var keyPEM []byte
+	err = withKeyAEAD(s, func(aead cipher.AEAD) error {
+		if len(nonce) != aead.NonceSize() {
+			return fmt.Errorf("invalid nonce length %d", len(nonce))
+		}
+		out, err := aead.Open(nil, nonce, sealed, []byte(name))
+		if err != nil {
+			return fmt.Errorf("unwrap key: %w", err)
+		}
+		keyPEM = out
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keyPEM, nil
+}
+
+// writePrivateKey stores the private key for certificate name in dir, wrapped
+// when protection is enabled. A wrapped write removes any plaintext leftover.
+func writePrivateKey(dir, name string, keyPEM []byte, s KeySealer) error {
+	if !keyProtectionEnabled(s) {
+		return writeFileAtomic(filepath.Join(dir, name+plaintextKeyExt), keyPEM)
+	}
+	sealed, err := sealPrivateKey(s, name, keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, name+sealedKeyExt), sealed); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, name+plaintextKeyExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// readPrivateKey returns the PEM key for certificate name, preferring the
+// wrapped file and falling back to a legacy plaintext one.
+func readPrivateKey(dir, name string, s KeySealer) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name+sealedKeyExt))
+	if err == nil {
+		return openPrivateKey(s, name, data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(dir, name+plaintextKeyExt))
+}
+
+// sealPlaintextKeys wraps legacy plaintext keys left in dir. It needs the
+// storage key and is run once storage is unlocked.
+func sealPlaintextKeys(dir string, s KeySealer) (int, error) {
+	if !keyProtectionEnabled(s) {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	sealed := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), plaintextKeyExt) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), plaintextKeyExt)
+		keyPEM, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return sealed, err
+		}
+		if err := writePrivateKey(dir, name, keyPEM, s); err != nil {
+			return sealed, err
+		}
+		sealed++
+	}
+	return sealed, nil
+}
+
+// protectStoredKeys seals plaintext certificate keys once the storage key is
+// available. Failures are logged; the keys stay usable either way.
+func (m *Manager) protectStoredKeys() {
+	if m == nil || m.keySealer == nil {
+		return
+	}
+	n, err := sealPlaintextKeys(m.certDir(), m.keySealer)
+	if err != nil {
+		if !errors.Is(err, ErrKeySealed) {
+			log.Printf("WARN: remote: sealing certificate keys failed: %v", err)
+		}
+		return
+	}
+	if n > 0 {
+		log.Printf("INFO: remote: sealed %d plaintext certificate key(s)", n)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	cryptoRand "crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
@@ -16,9 +17,9 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -47,9 +48,44 @@ type Config struct {
 	LatencyMS       int               `json:"latency_ms,omitempty"`
 	GuideVerifiedAt *time.Time        `json:"guide_verified_at,omitempty"`
 	LastPreflight   *time.Time        `json:"last_preflight,omitempty"`
+	LastProbe       *ProbeResult      `json:"last_probe,omitempty"`
 	Aliases         []Alias           `json:"aliases,omitempty"`
 	Certificates    []Certificate     `json:"certificates,omitempty"`
 	Events          []Event           `json:"events,omitempty"`
+	// EventSeq is the sequence number given to the latest event.
+	EventSeq uint64 `json:"event_seq,omitempty"`
+
+	// TLDDisplay and PortalHostnameDisplay keep the Unicode spelling of
+	// internationalized names; TLD and PortalHostname hold punycode.
+	TLDDisplay            string `json:"tld_display,omitempty"`
+	PortalHostnameDisplay string `json:"portal_hostname_display,omitempty"`
+
+	// CertStorage is the class of the certificate directory (see
+	// CertStorageEncrypted); empty is the bootstrap default. CertDir is the
+	// directory it resolved to when last moved.
+	CertStorage string `json:"cert_storage,omitempty"`
+	CertDir     string `json:"cert_dir,omitempty"`
+
+	// ACMEAccount mirrors the ACME account record, key included, so it
+	// travels with control exports and a restored device keeps its account.
+	ACMEAccount *acme.AccountRecord `json:"acme_account,omitempty"`
+
+	// RenewalLead is how many days before expiry certificates are renewed;
+	// zero means DefaultRenewalLeadDays.
+	RenewalLead int `json:"renewal_lead_days,omitempty"`
+
+	// TunnelFailures is how many connection attempts in a row the tunnel
+	// has failed, kept so the warning and backoff outlast a restart.
+	TunnelFailures int `json:"tunnel_failures,omitempty"`
+
+	// Issuances is the ledger of recent issuance attempts, checked against
+	// the CA's rate limits before ordering.
+	Issuances []IssuanceRecord `json:"issuances,omitempty"`
+
+	// Revision counts saves. Storage.Save only accepts a config carrying the
+	// revision currently stored, so a writer working from a stale copy is
+	// told instead of overwriting newer changes.
+	Revision uint64 `json:"revision,omitempty"`
 }
 
 func init() {
@@ -64,6 +100,11 @@ type Alias struct {
 	Status      string     `json:"status"`
 	LastChecked *time.Time `json:"last_checked,omitempty"`
 	Message     string     `json:"message,omitempty"`
+	// HostnameDisplay is the Unicode form of an internationalized Hostname.
+	HostnameDisplay string `json:"hostname_display,omitempty"`
+	// RedirectTo and IncludeWWW are described on AliasOptions.
+	RedirectTo string `json:"redirect_to,omitempty"`
+	IncludeWWW bool   `json:"include_www,omitempty"`
 }
 
 // Certificate captures basic certificate metadata for the inventory table.
@@ -76,10 +117,33 @@ type Certificate struct {
 	NextRenewal   *time.Time `json:"next_renewal,omitempty"`
 	Status        string     `json:"status,omitempty"`
 	FailureReason string     `json:"failure_reason,omitempty"`
+	// LastStage is the latest issuance step reached (see acme.Stage), kept
+	// after a failure to show where issuance stopped.
+	LastStage string `json:"last_stage,omitempty"`
+	// Covers lists the listener hostnames served by the wildcard instead of
+	// their own certificate; set on the wildcard entry only.
+	Covers []string `json:"covers,omitempty"`
+	// OrphanedAt is when the certificate's hostname stopped routing; the
+	// entry is deleted once the orphan grace period has passed.
+	OrphanedAt *time.Time `json:"orphaned_at,omitempty"`
+	// Export is set when the certificate is published for software outside
+	// Piccolo.
+	Export *CertExport `json:"export,omitempty"`
+	// DeferredUntil is when a deferred certificate is ordered again.
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+	// Disk, DiskMatchesInventory, DiskError and MissingOnDisk are filled in
+	// by ListCertificates from the certificate file; they are not stored.
+	Disk                 *CertificateFile `json:"disk,omitempty"`
+	DiskMatchesInventory *bool            `json:"disk_matches_inventory,omitempty"`
+	DiskError            string           `json:"disk_error,omitempty"`
+	MissingOnDisk        bool             `json:"missing_on_disk,omitempty"`
 }
 
 // Event is surfaced in the activity log for remote actions.
 type Event struct {
+	// Seq numbers events in the order they were recorded, so clients can
+	// page without relying on timestamps, which may collide.
+	Seq       uint64    `json:"seq"`
 	Timestamp time.Time `json:"ts"`
 	Level     string    `json:"level"`
 	Source    string    `json:"source"`
@@ -108,9 +172,34 @@ type Status struct {
 	ExpiresAt       *time.Time        `json:"expires_at,omitempty"`
 	Warnings        []string          `json:"warnings,omitempty"`
 	GuideVerifiedAt *time.Time        `json:"guide_verified_at,omitempty"`
+	LastProbe       *ProbeResult      `json:"last_probe,omitempty"`
 	Listeners       []ListenerSummary `json:"listeners,omitempty"`
 	Aliases         []Alias           `json:"aliases,omitempty"`
 	Certificates    []Certificate     `json:"certificates,omitempty"`
+	Challenges      *ChallengeStats   `json:"challenges,omitempty"`
+	// DefaultPortalLabel is the subdomain offered when no portal hostname
+	// has been chosen yet; it follows the device name.
+	DefaultPortalLabel string `json:"default_portal_label,omitempty"`
+	// TLDDisplay and PortalHostnameDisplay are the Unicode forms of TLD and
+	// PortalHostname for internationalized domains.
+	TLDDisplay            string `json:"tld_display,omitempty"`
+	PortalHostnameDisplay string `json:"portal_hostname_display,omitempty"`
+	// PortalURL is where the portal is reached remotely; empty while remote
+	// access is off or no portal hostname is set.
+	PortalURL string `json:"portal_url,omitempty"`
+	// CertStorage is where certificates and keys are kept.
+	CertStorage CertStorage `json:"cert_storage"`
+	// RenewalLeadDays is how many days before expiry certificates renew.
+	RenewalLeadDays int `json:"renewal_lead_days"`
+	// Tunnel is the live connection state and retry schedule while remote
+	// access is enabled.
+	Tunnel *nexusclient.Stats `json:"tunnel,omitempty"`
+	// GeneratedAt is when the status was assembled. AgeSeconds gives, for
+	// each top-level timestamp set, how many seconds before GeneratedAt it
+	// lies (negative for times ahead, such as next_renewal), so clients need
+	// not trust their own clock.
+	GeneratedAt time.Time        `json:"generated_at"`
+	AgeSeconds  map[string]int64 `json:"age_seconds,omitempty"`
 }
 
 // PreflightCheck represents a single validation step.
@@ -128,7 +217,7 @@ type PreflightResult struct {
 }
 
 type dialer interface {
-	DialTimeout(network, address string, timeout time.Duration) (net.Conn, error)
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
 type resolver interface {
@@ -138,33 +227,175 @@ type resolver interface {
 
 var ErrLocked = errors.New("remote: storage locked")
 
+// ErrUnlockRequired reports that the connection settings are available but
+// the credentials kept in encrypted storage are not. It matches ErrLocked.
+var ErrUnlockRequired = fmt.Errorf("%w: unlock required for remote credentials", ErrLocked)
+
+// ErrUnknownListener is returned when an alias names a listener no installed
+// app exposes.
+var ErrUnknownListener = errors.New("remote: unknown listener")
+
+// ErrClosed is returned by writes attempted after Close.
+var ErrClosed = errors.New("remote: manager closed")
+
+// ErrConflict is returned by Storage.Save when the stored config has moved
+// past the revision the caller loaded.
+var ErrConflict = errors.New("remote: config changed by another writer")
+
+// errNoChange ends an update without saving.
+var errNoChange = errors.New("remote: no change")
+
+// saveAttempts bounds how often update re-applies a mutation after losing a
+// race with another writer.
+const saveAttempts = 5
+
+// ListenerLookup reports whether an app listener with the given name exists,
+// and whether one is published under a remote hostname label. The service
+// manager satisfies it.
+type ListenerLookup interface {
+	HasListener(name string) bool
+	HasRemoteLabel(label string) bool
+}
+
+// Storage persists the remote configuration. Load may return a usable config
+// together with ErrUnlockRequired when only the non-secret half is readable;
+// Save returns ErrUnlockRequired when it could persist only that half.
+//
+// Save is a compare-and-swap on Config.Revision: it stores cfg with the
+// revision incremented when the stored revision still equals cfg.Revision,
+// and returns ErrConflict otherwise.
 type Storage interface {
 	Load(ctx context.Context) (Config, error)
 	Save(ctx context.Context, cfg Config) error
 }
 
+// WithoutSecrets returns a copy of c with credentials that must only live in
+// encrypted storage removed. The rest is enough to bring the tunnel up before
+// unlock.
+func (c Config) WithoutSecrets() Config {
+	c.DNSCredentials = nil
+	c.ACMEAccount = nil
+	return c
+}
+
+// HasSecrets reports whether c carries any encrypted-only fields.
+func (c Config) HasSecrets() bool {
+	return len(c.DNSCredentials) > 0 || c.ACMEAccount != nil
+}
+
+// MergeSecrets copies the encrypted-only fields of src into c.
+func (c *Config) MergeSecrets(src Config) {
+	c.DNSCredentials = cloneCredentials(src.DNSCredentials)
+	c.ACMEAccount = cloneACMEAccount(src.ACMEAccount)
+}
+
 type Manager struct {
-	storage       Storage
-	cfg           *Config
+	// storageMu guards storage, baseDir and acmeMgr, which AttachStorage
+	// replaces on a manager started without its bootstrap volume.
+	storageMu   sync.RWMutex
+	storage     Storage
+	unavailable atomic.Pointer[string]
+	// cfg is the last loaded or saved config. It is replaced, never
+	// modified in place; changes go through update.
+	cfg           atomic.Pointer[Config]
+	updateMu      sync.Mutex
 	dialer        dialer
 	resolver      resolver
 	now           func() time.Time
 	adapter       nexusclient.Adapter
 	adapterMu     sync.Mutex
 	adapterCancel context.CancelFunc
+	tunnelTracked atomic.Bool
 	challenges    *ChallengeManager
-	acmeMgr       *acme.Manager
+	acmeMgr       certIssuer
 	renewCancel   context.CancelFunc
 	needsReload   atomic.Bool
+	secretsLocked atomic.Bool
 	eventsBus     *events.Bus
+	activitySink  func(Event)
+	listeners     ListenerLookup
+	keySealer     KeySealer
+	portalLabel   func() string
+	http01Check   func() error
 	baseDir       string
-}
+
+	// preflightTimeout bounds a whole RunPreflight.
+	preflightTimeout time.Duration
+
+	// orphanGrace is how long an orphaned certificate is kept.
+	orphanGrace time.Duration
+	// maxAliases caps the number of aliases.
+	maxAliases int
+	// issuanceLimits are the CA rate limits checked before ordering.
+	issuanceLimits IssuanceLimits
+
+	// probeRoots verifies the endpoint certificate during probes; nil uses
+	// the system roots.
+	probeRoots *x509.CertPool
+
+	// probeURL and probeClient reach the outside prober used by RunProbe;
+	// probeTokens correlates its fetch of the portal.
+	probeURL    string
+	probeClient *http.Client
+	probeTokens probeTokens
+
+	// workers tracks the renew scheduler and issuance goroutines so Close
+	// can wait for them; workCtx is cancelled by Close to abort issuance.
+	// workMu orders workers.Add against closed.
+	workMu     sync.Mutex
+	workers    sync.WaitGroup
+	workCtx    context.Context
+	workCancel context.CancelFunc
+	closed     atomic.Bool
+
+	// certDirMu guards encryptedRoot and certProvider. certMoveMu
+	// serialises moves of the certificate directory; issueMu guards the
+	// directories in-flight issuance writes to, the retired ones it still
+	// holds open and the IDs of the certificates being issued.
+	certDirMu       sync.Mutex
+	encryptedRoot   string
+	certProvider    *FileCertProvider
+	certMoveMu      sync.Mutex
+	issueMu         sync.Mutex
+	issuingIn       map[string]int
+	retiredCertDirs map[string]bool
+	issuingCerts    map[string]bool
+
+	// statusMu serialises Status computations so concurrent polls share
+	// statusSnap; statusGen advances whenever the config changes.
+	statusMu   sync.Mutex
+	statusSnap *statusSnapshot
+	statusGen  atomic.Uint64
+
+	// certFileMu guards certFiles, the parsed certificate files by path.
+	certFileMu sync.Mutex
+	certFiles  map[string]certFileEntry
+}
+
+// certIssuer obtains certificates; *acme.Manager outside tests.
+type certIssuer interface {
+	Issue(ctx context.Context, commonName string, sans []string, outName, certDir string, progress acme.ProgressFunc) (*tls.Certificate, error)
+	SetEmail(email string)
+	SetKeyWriter(w acme.KeyWriter)
+}
+
+// CertStageFailed is published when issuance stops with an error. It is not
+// stored as LastStage, which keeps the last step that was reached.
+const CertStageFailed = "failed"
+
+// wildcardMinValidity is how much lifetime the wildcard needs left before
+// listener hostnames stop relying on it and get their own certificates.
+const wildcardMinValidity = 7 * 24 * time.Hour
 
 func (m *Manager) certDir() string {
 	if m == nil {
 		return ""
 	}
-	return filepath.Join(m.baseDir, "remote", "certs")
+	cfg := m.cfg.Load()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	return m.certStorage(cfg).Path
 }
 
 // CertDirectory returns the directory where certificate material is stored.
@@ -197,30 +428,41 @@ func newManagerWithDeps(storage Storage, baseDir string, d dialer, r resolver, n
 		resolver: r,
 		now:      now,
 		baseDir:  baseDir,
+		probeURL: strings.TrimSpace(os.Getenv(probeURLEnv)),
+
+		issuingIn:       make(map[string]int),
+		retiredCertDirs: make(map[string]bool),
+		issuingCerts:    make(map[string]bool),
 	}
+	m.preflightTimeout = preflightTimeoutFromEnv()
+	m.orphanGrace = orphanGraceFromEnv()
+	m.maxAliases = maxAliasesFromEnv()
+	m.issuanceLimits = issuanceLimitsFromEnv()
+	m.workCtx, m.workCancel = context.WithCancel(context.Background())
 	m.challenges = NewChallengeManager()
 	// ACME manager (wire later on configure)
 	m.acmeMgr = acme.NewManager(baseDir, m.challenges, "", os.Getenv("PICCOLO_ACME_DIR_URL"))
 	if storage != nil {
 		cfg, err := storage.Load(context.Background())
-		if err != nil {
-			if errors.Is(err, ErrLocked) {
-				m.needsReload.Store(true)
-			} else {
-				return nil, err
+		switch {
+		case err == nil, errors.Is(err, ErrUnlockRequired):
+			if cfg.DNSCredentials == nil {
+				cfg.DNSCredentials = map[string]string{}
 			}
-		} else {
-			m.cfg = &cfg
-			if m.cfg.DNSCredentials == nil {
-				m.cfg.DNSCredentials = map[string]string{}
-			}
-			m.needsReload.Store(false)
+			m.cfg.Store(&cfg)
+			m.secretsLocked.Store(err != nil)
+			m.needsReload.Store(err != nil)
+		case errors.Is(err, ErrLocked):
+			m.needsReload.Store(true)
+		default:
+			return nil, err
 		}
 	}
-	if m.cfg == nil {
-		m.cfg = &Config{}
+	if m.cfg.Load() == nil {
+		m.cfg.Store(&Config{})
 	}
-	m.updateACMEEmail(m.cfg)
+	m.updateACMEEmail(m.cfg.Load())
+	m.watchACMEAccount()
 	return m, nil
 }
 
@@ -239,14 +481,66 @@ func (m *Manager) SetEventsBus(bus *events.Bus) {
 	m.publishConfigChanged()
 }
 
+// SetActivitySink forwards remote events to the device activity log in
+// addition to the manager's own event list.
+func (m *Manager) SetActivitySink(sink func(Event)) {
+	m.activitySink = sink
+}
+
+// SetListenerLookup wires the listener inventory aliases are validated
+// against.
+func (m *Manager) SetListenerLookup(l ListenerLookup) {
+	m.listeners = l
+}
+
+// SetDefaultPortalLabel supplies the label suggested as the portal
+// subdomain. It is only a hint; configured hostnames are never rewritten.
+func (m *Manager) SetDefaultPortalLabel(fn func() string) {
+	m.portalLabel = fn
+}
+
+// SetHTTP01ListenerCheck supplies the check preflight runs while the
+// http-01 solver is selected; it reports why port 80 cannot answer
+// challenges, or nil when it can.
+func (m *Manager) SetHTTP01ListenerCheck(fn func() error) {
+	m.http01Check = fn
+}
+
+// SetKeySealer enables wrapping certificate private keys with the storage
+// encryption key. Plaintext keys already on disk are sealed as soon as the
+// key is available.
+func (m *Manager) SetKeySealer(s KeySealer) {
+	m.keySealer = s
+	if issuer := m.issuer(); issuer != nil {
+		issuer.SetKeyWriter(m.writeCertKey)
+	}
+	m.protectStoredKeys()
+}
+
+func (m *Manager) writeCertKey(dir, name string, keyPEM []byte) error {
+	return writePrivateKey(dir, name, keyPEM, m.keySealer)
+}
+
+// appendEvent records evt on cfg. The activity sink hears about it once the
+// update that added it is saved.
+func (m *Manager) appendEvent(cfg *Config, evt Event) {
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = m.now()
+	}
+	evt.Timestamp = evt.Timestamp.UTC()
+	numberEvents(cfg)
+	cfg.EventSeq++
+	evt.Seq = cfg.EventSeq
+	cfg.Events = append(cfg.Events, evt)
+}
+
 type netDialer struct{}
 
 type persistentConn struct{ net.Conn }
 
-func (netDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+func (netDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	var d net.Dialer
-	d.Timeout = timeout
-	return d.Dial(network, address)
+	return d.DialContext(ctx, network, address)
 }
 
 type netResolver struct{}
@@ -262,6 +556,7 @@ func (netResolver) LookupCNAME(ctx context.Context, host string) (string, error)
 }
 
 type fileStorage struct {
+	mu   sync.Mutex
 	path string
 }
 
@@ -278,6 +573,12 @@ func newFileStorage(baseDir string) (*fileStorage, error) {
 
 func (s *fileStorage) Load(ctx context.Context) (Config, error) {
 	_ = ctx
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *fileStorage) load() (Config, error) {
 	data, err := os.ReadFile(s.path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -294,6 +595,16 @@ func (s *fileStorage) Load(ctx context.Context) (Config, error) {
 
 func (s *fileStorage) Save(ctx context.Context, cfg Config) error {
 	_ = ctx
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.load()
+	if err != nil {
+		return err
+	}
+	if stored.Revision != cfg.Revision {
+		return fmt.Errorf("%w: stored revision %d, saving over %d", ErrConflict, stored.Revision, cfg.Revision)
+	}
+	cfg.Revision++
 	if cfg.DNSCredentials == nil {
 		cfg.DNSCredentials = map[string]string{}
 	}
@@ -308,19 +619,36 @@ func (m *Manager) save(cfg *Config) error {
 	if cfg == nil {
 		return errors.New("config cannot be nil")
 	}
+	if m.closed.Load() {
+		return ErrClosed
+	}
+	if reason, down := m.storageUnavailable(); down {
+		return fmt.Errorf("%w: %s", ErrStorageUnavailable, reason)
+	}
 	if cfg.DNSCredentials == nil {
 		cfg.DNSCredentials = map[string]string{}
 	}
-	if m.storage != nil {
-		if err := m.storage.Save(context.Background(), *cfg); err != nil {
-			if errors.Is(err, ErrLocked) {
+	partial := false
+	if storage := m.store(); storage != nil {
+		m.mergeStoredSecrets(cfg)
+		if err := storage.Save(context.Background(), *cfg); err != nil {
+			switch {
+			case errors.Is(err, ErrUnlockRequired):
+				// Only the non-secret half was written; pick the
+				// credentials up again after unlock.
+				partial = true
+			case errors.Is(err, ErrLocked):
 				m.needsReload.Store(true)
+				return err
+			default:
+				return err
 			}
-			return err
 		}
+		cfg.Revision++
 	}
-	m.cfg = cfg
-	m.needsReload.Store(false)
+	m.cfg.Store(cfg)
+	m.needsReload.Store(partial)
+	m.secretsLocked.Store(partial)
 	m.applyAdapterState()
 	m.updateACMEEmail(cfg)
 	m.publishConfigChanged()
@@ -328,12 +656,14 @@ func (m *Manager) save(cfg *Config) error {
 }
 
 func (m *Manager) reloadFromStorage() error {
-	if m.storage == nil {
+	storage := m.store()
+	if storage == nil {
 		m.needsReload.Store(false)
 		return nil
 	}
-	cfg, err := m.storage.Load(context.Background())
-	if err != nil {
+	cfg, err := storage.Load(context.Background())
+	partial := errors.Is(err, ErrUnlockRequired)
+	if err != nil && !partial {
 		if errors.Is(err, ErrLocked) {
 			m.needsReload.Store(true)
 		}
@@ -342,14 +672,38 @@ func (m *Manager) reloadFromStorage() error {
 	if cfg.DNSCredentials == nil {
 		cfg.DNSCredentials = map[string]string{}
 	}
-	m.cfg = &cfg
-	m.needsReload.Store(false)
+	m.cfg.Store(&cfg)
+	m.needsReload.Store(partial)
+	m.secretsLocked.Store(partial)
 	m.applyAdapterState()
 	m.updateACMEEmail(&cfg)
 	m.publishConfigChanged()
 	return nil
 }
 
+// mergeStoredSecrets fills in credentials cfg was loaded without, so a save
+// made once storage is unlocked does not overwrite them with nothing.
+func (m *Manager) mergeStoredSecrets(cfg *Config) {
+	if !m.secretsLocked.Load() || cfg.HasSecrets() {
+		return
+	}
+	stored, err := m.store().Load(context.Background())
+	if err != nil {
+		return
+	}
+	cfg.MergeSecrets(stored)
+}
+
+// requireSecrets fails with ErrUnlockRequired while the remote credentials
+// are still sealed in encrypted storage.
+func (m *Manager) requireSecrets() error {
+	m.ensureConfigHydrated()
+	if m.secretsLocked.Load() {
+		return ErrUnlockRequired
+	}
+	return nil
+}
+
 func (m *Manager) ensureConfigHydrated() {
 	if m == nil {
 		return
@@ -367,15 +721,75 @@ func (m *Manager) currentConfig() *Config {
 		return &Config{}
 	}
 	m.ensureConfigHydrated()
-	if m.cfg == nil {
-		m.cfg = &Config{}
+	cfg := m.cfg.Load()
+	if cfg == nil {
+		m.cfg.CompareAndSwap(nil, &Config{})
+		cfg = m.cfg.Load()
+	}
+	return cfg
+}
+
+// update applies mutate to a copy of the current config and saves it. When
+// another writer saved first, the config is reloaded and mutate runs again on
+// the fresh copy, up to saveAttempts times; mutate must therefore derive its
+// changes from the cfg it is handed. Returning errNoChange skips the save.
+func (m *Manager) update(mutate func(cfg *Config) error) error {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+	for attempt := 1; ; attempt++ {
+		base := m.currentConfig()
+		next := base.clone()
+		if err := mutate(next); err != nil {
+			if errors.Is(err, errNoChange) {
+				return nil
+			}
+			return err
+		}
+		err := m.save(next)
+		if err == nil {
+			m.forwardEvents(next.Events[min(len(base.Events), len(next.Events)):])
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt == saveAttempts {
+			return err
+		}
+		if err := m.reloadFromStorage(); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Manager) forwardEvents(evts []Event) {
+	if m.activitySink == nil {
+		return
 	}
-	return m.cfg
+	for _, evt := range evts {
+		m.activitySink(evt)
+	}
+}
+
+// clone returns a copy of c that shares no slices or maps with it.
+func (c *Config) clone() *Config {
+	out := *c
+	out.DNSCredentials = cloneCredentials(c.DNSCredentials)
+	out.ACMEAccount = cloneACMEAccount(c.ACMEAccount)
+	out.LastProbe = cloneProbe(c.LastProbe)
+	out.Aliases = cloneAliases(c.Aliases)
+	out.Certificates = cloneCertificates(c.Certificates)
+	out.Events = append([]Event(nil), c.Events...)
+	out.Issuances = cloneIssuances(c.Issuances)
+	return &out
 }
 
-func (m *Manager) Status() Status {
+// computeStatus builds a Status from the current config. Callers go through
+// Status, which shares recent results.
+func (m *Manager) computeStatus() Status {
 	cfg := m.currentConfig()
-	warnings := computeWarnings(cfg)
+	warnings := computeWarnings(cfg, m.now())
+	tunnel := m.tunnelStats(cfg)
+	if w := m.tunnelWarning(tunnel); w != "" {
+		warnings = append(warnings, w)
+	}
 
 	var latency *int
 	if cfg.LatencyMS > 0 {
@@ -397,7 +811,23 @@ func (m *Manager) Status() Status {
 		state = "provisioning"
 	}
 
-	return Status{
+	if reason, down := m.storageUnavailable(); down {
+		state = StateStorageUnavailable
+		warnings = append(warnings, "bootstrap volume unavailable: "+reason)
+	}
+
+	var challenges *ChallengeStats
+	if m.challenges != nil {
+		st := m.challenges.Stats()
+		challenges = &st
+	}
+
+	var portalLabel string
+	if m.portalLabel != nil {
+		portalLabel = m.portalLabel()
+	}
+
+	st := Status{
 		Enabled:         cfg.Enabled,
 		State:           state,
 		Solver:          cfg.Solver,
@@ -411,10 +841,24 @@ func (m *Manager) Status() Status {
 		ExpiresAt:       timePtr(cfg.ExpiresAt),
 		Warnings:        warnings,
 		GuideVerifiedAt: cfg.GuideVerifiedAt,
+		LastProbe:       cloneProbe(cfg.LastProbe),
 		Listeners:       buildListeners(cfg),
 		Aliases:         cloneAliases(cfg.Aliases),
 		Certificates:    cloneCertificates(cfg.Certificates),
+		Challenges:      challenges,
+
+		DefaultPortalLabel:    portalLabel,
+		TLDDisplay:            cfg.TLDDisplay,
+		PortalHostnameDisplay: cfg.PortalHostnameDisplay,
+		CertStorage:           m.certStorage(cfg),
+		RenewalLeadDays:       cfg.RenewalLeadDays(),
+		Tunnel:                tunnel,
 	}
+	if cfg.Enabled && cfg.PortalHostname != "" {
+		st.PortalURL = "https://" + cfg.PortalHostname
+	}
+	stampFreshness(&st, m.now())
+	return st
 }
 
 // ReloadFromStorage attempts to refresh the in-memory configuration from the backing storage.
@@ -422,12 +866,14 @@ func (m *Manager) ReloadFromStorage() error {
 	if m == nil {
 		return nil
 	}
+	m.protectStoredKeys()
 	if err := m.reloadFromStorage(); err != nil {
 		if errors.Is(err, ErrLocked) {
 			return nil
 		}
 		return err
 	}
+	m.syncACMEAccount()
 	return nil
 }
 
@@ -440,114 +886,293 @@ type ConfigureRequest struct {
 	PortalHostname string            `json:"portal_hostname"`
 	DNSProvider    string            `json:"dns_provider"`
 	DNSCredentials map[string]string `json:"dns_credentials"`
+	// DryRun asks the configure command for the plan only; see PlanConfigure.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Probe connects to the endpoint (TCP and TLS) before answering and
+	// reports the outcome; a failed probe does not block the configuration.
+	Probe bool `json:"probe,omitempty"`
+	// ListenerNames are app listeners under the TLD: covered by the wildcard
+	// with dns-01, given their own certificate otherwise.
+	ListenerNames []string `json:"-"`
+}
+
+// PlannedCertificate is a certificate Configure would queue for issuance.
+type PlannedCertificate struct {
+	ID         string   `json:"id"`
+	Domains    []string `json:"domains"`
+	CommonName string   `json:"common_name"`
+	// Action is "issue" for a new inventory entry and "reissue" when one
+	// with the same ID already exists.
+	Action string `json:"action"`
+}
+
+// ConfigurePlan describes what Configure would do with a request.
+type ConfigurePlan struct {
+	Endpoint       string               `json:"endpoint"`
+	Solver         string               `json:"solver"`
+	TLD            string               `json:"tld"`
+	PortalHostname string               `json:"portal_hostname"`
+	ACMEEmail      string               `json:"acme_email"`
+	Certificates   []PlannedCertificate `json:"certificates"`
+	RestartAdapter bool                 `json:"restart_adapter"`
+	Warnings       []string             `json:"warnings"`
+
+	// Migration is set when the solver changes and existing certificates
+	// are retired or replaced.
+	Migration *SolverMigration `json:"migration,omitempty"`
+
+	// Probe is the endpoint check, present when the request asked for one.
+	Probe *PreflightCheck `json:"probe,omitempty"`
+}
+
+// PlanConfigure validates req and reports the configuration, certificate
+// issuance and adapter changes Configure would make, without persisting
+// anything.
+func (m *Manager) PlanConfigure(req ConfigureRequest) (ConfigurePlan, error) {
+	plan, _, err := m.planConfigure(req, m.currentConfig())
+	if err != nil {
+		return ConfigurePlan{}, err
+	}
+	m.attachProbe(&plan, req)
+	return plan, nil
 }
 
-// Configure persists a new remote configuration.
-func (m *Manager) Configure(req ConfigureRequest) error {
-	endpoint := strings.TrimSpace(req.Endpoint)
-	if endpoint == "" {
-		return errors.New("endpoint required")
-	}
-	if _, err := url.ParseRequestURI(endpoint); err != nil {
-		return fmt.Errorf("invalid endpoint: %w", err)
+// planConfigure validates req and derives the plan and the config that
+// replaces current.
+func (m *Manager) planConfigure(req ConfigureRequest, current *Config) (ConfigurePlan, Config, error) {
+	endpointURL, err := parseEndpoint(req.Endpoint)
+	if err != nil {
+		return ConfigurePlan{}, Config{}, err
 	}
+	endpoint := endpointURL.String()
 
 	solver := strings.ToLower(strings.TrimSpace(req.Solver))
 	if solver == "" {
 		solver = "http-01"
 	}
 	if solver != "http-01" && solver != "dns-01" {
-		return fmt.Errorf("unsupported solver %q", solver)
+		return ConfigurePlan{}, Config{}, fmt.Errorf("unsupported solver %q", solver)
 	}
 
-	tld := strings.TrimSpace(req.TLD)
-	if tld == "" || !strings.Contains(tld, ".") {
-		return errors.New("tld required")
+	tld, tldDisplay, err := normalizeTLD(req.TLD)
+	if err != nil {
+		return ConfigurePlan{}, Config{}, err
 	}
 
-	rawPortal := strings.TrimSpace(req.PortalHostname)
-	if rawPortal == "" {
-		return errors.New("portal hostname required")
+	if strings.TrimSpace(req.PortalHostname) == "" {
+		return ConfigurePlan{}, Config{}, errors.New("portal hostname required")
 	}
-	portalHost := normalizePortalHost(tld, rawPortal)
-	if portalHost == "" {
-		return errors.New("portal hostname invalid")
+	portalHost, portalDisplay, err := normalizePortalHost(tld, req.PortalHostname)
+	if err != nil {
+		return ConfigurePlan{}, Config{}, err
 	}
 
-	email := deriveACMEEmail(tld, portalHost)
-	if m.acmeMgr != nil {
-		m.acmeMgr.SetEmail(email)
+	if err := m.requireSecrets(); err != nil {
+		return ConfigurePlan{}, Config{}, err
 	}
-
-	if solver == "dns-01" && strings.TrimSpace(req.DNSProvider) == "" {
-		return errors.New("dns_provider required for dns-01")
+	if err := validateConfigureDNS(solver, req); err != nil {
+		return ConfigurePlan{}, Config{}, err
 	}
 
 	now := m.now()
-	expires := now.Add(90 * 24 * time.Hour)
-	nextRenewal := now.Add(60 * 24 * time.Hour)
+	next := *current
+	next.Endpoint = endpoint
+	next.DeviceSecret = strings.TrimSpace(req.DeviceSecret)
+	next.Solver = solver
+	next.TLD = tld
+	next.TLDDisplay = tldDisplay
+	next.PortalHostname = portalHost
+	next.PortalHostnameDisplay = portalDisplay
+	next.DNSProvider = strings.ToLower(strings.TrimSpace(req.DNSProvider))
+	next.DNSCredentials = cloneCredentials(req.DNSCredentials)
+	next.Enabled = true
+	next.Issuer = "Let's Encrypt"
+	next.ExpiresAt = now.Add(90 * 24 * time.Hour)
+	next.NextRenewal = renewAt(now, next.ExpiresAt, next.renewalLead())
+	if next.Endpoint != current.Endpoint {
+		next.LastHandshake = time.Time{}
+		next.LatencyMS = 0
+	}
+	next.LastPreflight = nil
+	next.Certificates = defaultCertificates(&next, now)
+	if current.TLD == tld {
+		next.Certificates = append(next.Certificates, carriedCertificates(current.Certificates, next.Certificates)...)
+		keepExports(next.Certificates, current.Certificates)
+	}
 
-	cfg := m.currentConfig()
-	cfg.Endpoint = endpoint
-	cfg.DeviceSecret = strings.TrimSpace(req.DeviceSecret)
-	cfg.Solver = solver
-	cfg.TLD = tld
-	cfg.PortalHostname = portalHost
-	cfg.DNSProvider = strings.TrimSpace(req.DNSProvider)
-	cfg.DNSCredentials = cloneCredentials(req.DNSCredentials)
-	cfg.Enabled = true
-	cfg.Issuer = "Let's Encrypt"
-	cfg.ExpiresAt = expires
-	cfg.NextRenewal = nextRenewal
-	cfg.LastHandshake = now
-	cfg.LatencyMS = 0
-	cfg.LastPreflight = nil
-	// Queue background ACME issuance and surface events/inventory.
-	cfg.Certificates = defaultCertificates(cfg, now)
-	m.enqueueIssuance("portal", []string{cfg.PortalHostname}, cfg.PortalHostname)
-	if cfg.TLD != "" && strings.EqualFold(cfg.Solver, "dns-01") {
-		m.enqueueIssuance("wildcard", []string{"*." + cfg.TLD}, "*."+cfg.TLD)
+	m.adapterMu.Lock()
+	hasAdapter := m.adapter != nil
+	m.adapterMu.Unlock()
+
+	plan := ConfigurePlan{
+		Endpoint:       endpoint,
+		Solver:         solver,
+		TLD:            tld,
+		PortalHostname: portalHost,
+		ACMEEmail:      deriveACMEEmail(tld, portalHost),
+		Certificates:   []PlannedCertificate{},
+		RestartAdapter: hasAdapter && next.Endpoint != "" && next.DeviceSecret != "" && next.PortalHostname != "",
+		Warnings:       computeWarnings(&next, m.now()),
+	}
+	addCert := func(id, cn string) {
+		action := "issue"
+		for _, c := range current.Certificates {
+			if c.ID == id {
+				action = "reissue"
+				break
+			}
+		}
+		plan.Certificates = append(plan.Certificates, PlannedCertificate{ID: id, Domains: []string{cn}, CommonName: cn, Action: action})
+	}
+	addCert("portal", portalHost)
+	// Listener hostnames, plus those the previous wildcard covered so a
+	// switch away from dns-01 leaves none of them without a certificate.
+	var hosts []string
+	seen := map[string]bool{}
+	addHost := func(host string) {
+		if seen[host] || host == portalHost {
+			return
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
 	}
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   "Remote configuration saved",
-		NextStep:  "Run preflight",
-	})
+	for _, name := range req.ListenerNames {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			addHost(name + "." + tld)
+		}
+	}
+	for _, c := range current.Certificates {
+		if c.ID != "wildcard" {
+			continue
+		}
+		for _, h := range c.Covers {
+			if label, ok := strings.CutSuffix(h, "."+tld); ok && label != "" && !strings.Contains(label, ".") {
+				addHost(h)
+			}
+		}
+	}
+	if solver == "dns-01" {
+		addCert("wildcard", "*."+tld)
+		for i := range next.Certificates {
+			if next.Certificates[i].ID == "wildcard" && len(hosts) > 0 {
+				next.Certificates[i].Covers = append([]string(nil), hosts...)
+				sort.Strings(next.Certificates[i].Covers)
+			}
+		}
+	} else {
+		for _, host := range hosts {
+			addCert("host:"+host, host)
+		}
+	}
+	if current.Solver != "" && current.Solver != solver && current.TLD == tld {
+		plan.Migration = migrateSolver(&next, current.Solver, &plan)
+	}
+	if current.PortalHostname != "" && current.PortalHostname != portalHost {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Portal hostname changes from %s to %s", current.PortalHostname, portalHost))
+	}
+	if next.DeviceSecret == "" {
+		plan.Warnings = append(plan.Warnings, "Device secret missing; the tunnel will not start")
+	}
+	return plan, next, nil
+}
 
-	return m.save(cfg)
+// attachProbe checks the planned endpoint when req asks for it.
+func (m *Manager) attachProbe(plan *ConfigurePlan, req ConfigureRequest) {
+	if req.Probe {
+		probe := m.checkEndpoint(context.Background(), plan.Endpoint)
+		plan.Probe = &probe.Check
+	}
+}
+
+// Configure persists a new remote configuration and queues the certificate
+// issuance described by PlanConfigure.
+func (m *Manager) Configure(req ConfigureRequest) error {
+	_, err := m.ConfigureWithPlan(req)
+	return err
+}
+
+// ConfigureWithPlan is Configure that also returns the applied plan, which
+// carries the endpoint probe result when req.Probe is set.
+func (m *Manager) ConfigureWithPlan(req ConfigureRequest) (ConfigurePlan, error) {
+	var plan ConfigurePlan
+	err := m.update(func(cfg *Config) error {
+		p, next, err := m.planConfigure(req, cfg)
+		if err != nil {
+			return err
+		}
+		plan = p
+		*cfg = next
+		// Surface the queued issuance in the inventory and events.
+		for _, pc := range plan.Certificates {
+			if m.canIssue(pc.CommonName) {
+				m.ensureCertPending(cfg, pc.ID, pc.Domains, m.now())
+			}
+		}
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   "Remote configuration saved",
+			NextStep:  "Run preflight",
+		})
+		if plan.Migration != nil {
+			m.appendEvent(cfg, Event{
+				Timestamp: m.now(),
+				Level:     "info",
+				Source:    "remote",
+				Message:   plan.Migration.summary(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return ConfigurePlan{}, err
+	}
+	if issuer := m.issuer(); issuer != nil {
+		issuer.SetEmail(plan.ACMEEmail)
+	}
+	for _, pc := range plan.Certificates {
+		if m.canIssue(pc.CommonName) {
+			m.startIssuance(pc.ID, pc.Domains, pc.CommonName)
+		}
+	}
+	m.resetTunnelBackoff()
+	m.attachProbe(&plan, req)
+	return plan, nil
 }
 
 // Disable switches remote access off but retains configuration.
 func (m *Manager) Disable() error {
-	cfg := m.currentConfig()
-	cfg.Enabled = false
-	now := m.now()
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   "Remote access disabled",
+	return m.update(func(cfg *Config) error {
+		cfg.Enabled = false
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   "Remote access disabled",
+		})
+		return nil
 	})
-	return m.save(cfg)
 }
 
 // Rotate generates a placeholder device secret for testing.
 func (m *Manager) Rotate() (string, error) {
-	cfg := m.currentConfig()
-	if cfg.Endpoint == "" {
-		return "", errors.New("remote not configured")
-	}
-	newSecret := fmt.Sprintf("secret-%d", time.Now().UnixNano())
-	cfg.DeviceSecret = newSecret
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: m.now(),
-		Level:     "info",
-		Source:    "remote",
-		Message:   "Remote device secret rotated",
+	newSecret := fmt.Sprintf("secret-%d", m.now().UnixNano())
+	err := m.update(func(cfg *Config) error {
+		if cfg.Endpoint == "" {
+			return errors.New("remote not configured")
+		}
+		cfg.DeviceSecret = newSecret
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   "Remote device secret rotated",
+		})
+		return nil
 	})
-	if err := m.save(cfg); err != nil {
+	if err != nil {
 		return "", err
 	}
 	return newSecret, nil
@@ -558,72 +1183,117 @@ func (m *Manager) ListAliases() []Alias {
 	return cloneAliases(m.currentConfig().Aliases)
 }
 
-// AddAlias appends a new alias entry.
-func (m *Manager) AddAlias(listener, hostname string) (Alias, error) {
-	hostname = strings.TrimSpace(hostname)
-	if hostname == "" || !strings.Contains(hostname, ".") {
-		return Alias{}, errors.New("hostname required")
+// AddAlias attaches a custom hostname to a listener. The listener must be
+// the portal or one exposed by an installed app; a certificate for the
+// hostname, and its www variant when opts asks for it, is queued once the
+// alias is saved.
+func (m *Manager) AddAlias(listener, hostname string, opts AliasOptions) (Alias, error) {
+	hostname, display, err := normalizeRegistrable("hostname", hostname)
+	if err != nil {
+		return Alias{}, err
 	}
+	opts, err = normalizeAliasOptions(hostname, opts)
+	if err != nil {
+		return Alias{}, err
+	}
+	listener = strings.TrimSpace(listener)
 	if listener == "" {
 		listener = "portal"
 	}
-	cfg := m.currentConfig()
+	if listener != "portal" && (m.listeners == nil || !m.listeners.HasListener(listener)) {
+		return Alias{}, fmt.Errorf("%w: %s", ErrUnknownListener, listener)
+	}
 	alias := Alias{
-		ID:       fmt.Sprintf("alias-%d", time.Now().UnixNano()+rand.Int63n(1000)),
+		ID:       fmt.Sprintf("alias-%d", m.now().UnixNano()+rand.Int63n(1000)),
 		Hostname: hostname,
 		Listener: listener,
 		Status:   "pending",
 		Message:  "Awaiting DNS verification",
+
+		HostnameDisplay: display,
+		RedirectTo:      opts.RedirectTo,
+		IncludeWWW:      opts.IncludeWWW,
 	}
-	cfg.Aliases = append(cfg.Aliases, alias)
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: m.now(),
-		Level:     "info",
-		Source:    "remote",
-		Message:   fmt.Sprintf("Alias %s queued for listener %s", hostname, listener),
+	reclaimed := false
+	err = m.update(func(cfg *Config) error {
+		if err := m.checkNewAlias(cfg, hostname); err != nil {
+			return err
+		}
+		if err := checkAliasRedirects(cfg, alias); err != nil {
+			return err
+		}
+		cfg.Aliases = append(cfg.Aliases, alias)
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Alias %s queued for listener %s", hostname, listener),
+		})
+		if certDomainsMatch(cfg, "alias:"+hostname, alias.Names()) {
+			reclaimed = m.reclaimCertificate(cfg, "alias:"+hostname, m.now())
+		}
+		return nil
 	})
-	if err := m.save(cfg); err != nil {
+	if err != nil {
 		return Alias{}, err
 	}
-	// Queue issuance for the alias hostname (listener-specific cert)
-	m.enqueueIssuance("alias:"+strings.ToLower(hostname), []string{strings.ToLower(hostname)}, strings.ToLower(hostname))
+	// Queue issuance for the alias names (one listener-specific cert) unless
+	// the certificate kept from an earlier removal is still good.
+	if !reclaimed {
+		m.enqueueIssuance("alias:"+hostname, alias.Names(), hostname)
+	}
 	return alias, nil
 }
 
-// RemoveAlias deletes an alias by ID.
+// RemoveAlias deletes an alias by ID. Its certificate is orphaned rather
+// than deleted, so re-adding the alias within the grace period reuses it.
 func (m *Manager) RemoveAlias(id string) error {
-	cfg := m.currentConfig()
-	idx := -1
-	for i, a := range cfg.Aliases {
-		if a.ID == id {
-			idx = i
-			break
+	return m.update(func(cfg *Config) error {
+		idx := -1
+		for i, a := range cfg.Aliases {
+			if a.ID == id {
+				idx = i
+				break
+			}
 		}
-	}
-	if idx == -1 {
-		return errors.New("alias not found")
-	}
-	removed := cfg.Aliases[idx]
-	cfg.Aliases = append(cfg.Aliases[:idx], cfg.Aliases[idx+1:]...)
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: m.now(),
-		Level:     "info",
-		Source:    "remote",
-		Message:   fmt.Sprintf("Alias %s removed", removed.Hostname),
+		if idx == -1 {
+			return errors.New("alias not found")
+		}
+		removed := cfg.Aliases[idx]
+		cfg.Aliases = append(cfg.Aliases[:idx], cfg.Aliases[idx+1:]...)
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Alias %s removed", removed.Hostname),
+		})
+		m.orphanCertificate(cfg, "alias:"+removed.Hostname, "alias removed", m.now())
+		return nil
 	})
-	return m.save(cfg)
 }
 
-// ListCertificates returns the synthetic certificate inventory.
+// ListCertificates returns the certificate inventory, with expiry and
+// chain details taken from the certificate files on disk.
 func (m *Manager) ListCertificates() []Certificate {
-	return cloneCertificates(m.currentConfig().Certificates)
+	certs := cloneCertificates(m.currentConfig().Certificates)
+	m.overlayCertificateFiles(certs)
+	return certs
+}
+
+// RefreshAdapter restarts an active nexus connection so it re-reads
+// listener-driven port mappings. It is a no-op while remote is disabled.
+func (m *Manager) RefreshAdapter() {
+	if m == nil || !m.currentConfig().Enabled {
+		return
+	}
+	m.applyAdapterState()
 }
 
 func (m *Manager) applyAdapterState() {
 	m.adapterMu.Lock()
 	adapter := m.adapter
 	cancel := m.adapterCancel
-	cfg := m.cfg
+	cfg := m.cfg.Load()
 	m.adapterMu.Unlock()
 
 	if adapter == nil {
@@ -642,6 +1312,7 @@ func (m *Manager) applyAdapterState() {
 	if err := adapter.Configure(adapterCfg); err != nil {
 		log.Printf("WARN: remote: configure nexus adapter failed: %v", err)
 	}
+	m.trackTunnelFailures(cfg)
 
 	if !cfg.Enabled || cfg.Endpoint == "" || cfg.DeviceSecret == "" || cfg.PortalHostname == "" {
 		m.stopAdapter()
@@ -672,10 +1343,16 @@ func (m *Manager) applyAdapterState() {
 }
 
 func (m *Manager) publishConfigChanged() {
-	if m == nil || m.eventsBus == nil {
+	if m == nil {
+		return
+	}
+	m.invalidateStatus()
+	if m.eventsBus == nil {
 		return
 	}
-	status := m.Status()
+	// Not Status: a reload triggered while Status computes lands here with
+	// statusMu held.
+	status := m.computeStatus()
 	m.eventsBus.Publish(events.Event{
 		Topic:   events.TopicRemoteConfigChanged,
 		Payload: status,
@@ -683,11 +1360,14 @@ func (m *Manager) publishConfigChanged() {
 }
 
 func (m *Manager) updateACMEEmail(cfg *Config) {
-	if m == nil || m.acmeMgr == nil || cfg == nil {
+	if m == nil || cfg == nil {
 		return
 	}
-	email := deriveACMEEmail(cfg.TLD, cfg.PortalHostname)
-	m.acmeMgr.SetEmail(email)
+	issuer := m.issuer()
+	if issuer == nil {
+		return
+	}
+	issuer.SetEmail(deriveACMEEmail(cfg.TLD, cfg.PortalHostname))
 }
 
 // HTTPChallengeHandler exposes a read-only handler for ACME HTTP-01 tokens.
@@ -720,9 +1400,55 @@ func (m *Manager) startRenewScheduler() {
 	if m.renewCancel != nil {
 		return
 	}
-	ctx, cancel := context.WithCancel(context.Background())
+	if !m.addWorker() {
+		return
+	}
+	ctx, cancel := context.WithCancel(m.workCtx)
 	m.renewCancel = cancel
-	go m.runRenewScheduler(ctx)
+	go func() {
+		defer m.workers.Done()
+		m.runRenewScheduler(ctx)
+	}()
+}
+
+// addWorker registers a background goroutine with Close. It fails once the
+// manager is closed.
+func (m *Manager) addWorker() bool {
+	m.workMu.Lock()
+	defer m.workMu.Unlock()
+	if m.closed.Load() {
+		return false
+	}
+	m.workers.Add(1)
+	return true
+}
+
+// Close stops the nexus adapter and the renew scheduler, aborts pending
+// certificate issuance and waits for those goroutines until ctx expires.
+// Saves attempted afterwards fail with ErrClosed.
+func (m *Manager) Close(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.workMu.Lock()
+	already := m.closed.Swap(true)
+	m.workMu.Unlock()
+	if !already {
+		m.workCancel()
+		m.stopRenewScheduler()
+		m.stopAdapter()
+	}
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("remote: waiting for background work: %w", ctx.Err())
+	}
 }
 
 func (m *Manager) stopRenewScheduler() {
@@ -752,59 +1478,29 @@ func (m *Manager) runRenewScheduler(ctx context.Context) {
 }
 
 func (m *Manager) scanAndQueueRenewals() {
-	cfg := m.currentConfig()
+	m.PruneCertificates()
 	now := m.now()
-	for _, c := range cfg.Certificates {
-		if strings.EqualFold(c.Status, "pending") {
-			continue // avoid duplicate queueing
-		}
-		if c.NextRenewal == nil || c.ExpiresAt == nil {
-			continue
-		}
-		// Renew when due or if within 24h of expiry as a safety net
-		if now.After(*c.NextRenewal) || now.Add(24*time.Hour).After(*c.ExpiresAt) {
-			switch c.ID {
-			case "portal":
-				if cfg.PortalHostname != "" {
-					m.enqueueIssuance("portal", []string{cfg.PortalHostname}, cfg.PortalHostname)
-				}
-			case "wildcard":
-				if cfg.TLD != "" && strings.EqualFold(cfg.Solver, "dns-01") {
-					cn := "*." + cfg.TLD
-					m.enqueueIssuance("wildcard", []string{cn}, cn)
-				}
-			default:
-				if strings.HasPrefix(c.ID, "alias:") || strings.HasPrefix(c.ID, "host:") {
-					// ID suffix is the hostname for our queued entries
-					parts := strings.SplitN(c.ID, ":", 2)
-					if len(parts) == 2 && parts[1] != "" {
-						h := parts[1]
-						m.enqueueIssuance(c.ID, []string{h}, h)
-					}
-				}
-			}
-		}
-	}
+	m.renewWhere(func(cfg *Config, c Certificate) bool {
+		return renewalDue(cfg, c, now) || deferralOver(c, now)
+	}, RenewedByScheduler)
 }
 
-// RenewCertificate simulates a manual renewal.
+// RenewCertificate queues renewal of certificate id at the user's request.
 func (m *Manager) RenewCertificate(id string) error {
 	cfg := m.currentConfig()
-	// Find target cert and queue issuance
 	for _, c := range cfg.Certificates {
 		if c.ID == id {
-			domains := append([]string(nil), c.Domains...)
-			cn := domains[0]
-			if id == "portal" && cfg.PortalHostname != "" {
-				cn = cfg.PortalHostname
+			if isOrphaned(c) {
+				return fmt.Errorf("certificate %s is orphaned; re-add its hostname or forget it", id)
 			}
-			if id == "wildcard" && cfg.TLD != "" {
-				if !strings.EqualFold(cfg.Solver, "dns-01") {
-					return errors.New("wildcard renewals require dns-01 solver")
-				}
-				cn = "*." + cfg.TLD
+			if isRetired(c) {
+				return fmt.Errorf("certificate %s is %s by the %s solver and is no longer renewed", id, c.Status, cfg.Solver)
 			}
-			m.enqueueIssuance(id, domains, cn)
+			domains, cn, err := m.renewalTarget(cfg, c)
+			if err != nil {
+				return err
+			}
+			m.enqueueRenewal(id, domains, cn, RenewedByUser)
 			return nil
 		}
 	}
@@ -812,56 +1508,182 @@ func (m *Manager) RenewCertificate(id string) error {
 }
 
 // QueueHostnameCertificate requests background issuance for a specific hostname.
-// Useful for per-listener certs when wildcard isn't available/supported.
+// A hostname directly under the TLD is instead recorded as covered by the
+// wildcard while that one is usable.
 func (m *Manager) QueueHostnameCertificate(hostname string) {
 	h := strings.TrimSpace(strings.ToLower(hostname))
 	if h == "" {
 		return
 	}
-	m.enqueueIssuance("host:"+h, []string{h}, h)
+	covered, reclaimed := false, false
+	_ = m.update(func(cfg *Config) error {
+		i := wildcardCovering(cfg, h, m.now())
+		covered = i >= 0
+		if !covered {
+			reclaimed = m.reclaimCertificate(cfg, "host:"+h, m.now())
+			if !reclaimed {
+				return errNoChange
+			}
+			return nil
+		}
+		if !addCover(&cfg.Certificates[i], h) {
+			return errNoChange
+		}
+		return nil
+	})
+	if !covered && !reclaimed {
+		m.enqueueIssuance("host:"+h, []string{h}, h)
+	}
+}
+
+// wildcardCovering returns the index of the wildcard entry that serves host,
+// or -1. The wildcard counts while it is being issued or is ok with at least
+// wildcardMinValidity left; only dns-01 can issue or renew it.
+func wildcardCovering(cfg *Config, host string, now time.Time) int {
+	if cfg.TLD == "" || !strings.EqualFold(cfg.Solver, "dns-01") {
+		return -1
+	}
+	label, ok := strings.CutSuffix(host, "."+cfg.TLD)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return -1
+	}
+	for i, c := range cfg.Certificates {
+		if c.ID != "wildcard" {
+			continue
+		}
+		switch {
+		case strings.EqualFold(c.Status, "pending"):
+			return i
+		case strings.EqualFold(c.Status, "ok") && c.ExpiresAt != nil && c.ExpiresAt.After(now.Add(wildcardMinValidity)):
+			return i
+		}
+		return -1
+	}
+	return -1
+}
+
+// addCover records host on the wildcard entry, reporting whether it was new.
+func addCover(c *Certificate, host string) bool {
+	for _, h := range c.Covers {
+		if h == host {
+			return false
+		}
+	}
+	c.Covers = append(c.Covers, host)
+	sort.Strings(c.Covers)
+	return true
 }
 
 // enqueueIssuance starts background issuance for the given id/domains/commonName
 // and records progress into the config certificates inventory and events.
 func (m *Manager) enqueueIssuance(id string, domains []string, commonName string) {
-	if m.acmeMgr == nil || commonName == "" {
+	if !m.canIssue(commonName) || m.issuing(id) {
 		return
 	}
-	cfg := m.currentConfig()
-	now := m.now()
 	// Ensure inventory entry exists and mark pending
-	m.ensureCertPending(cfg, id, domains, now)
-	_ = m.save(cfg)
+	_ = m.update(func(cfg *Config) error {
+		m.ensureCertPending(cfg, id, domains, m.now())
+		return nil
+	})
+	m.startIssuance(id, domains, commonName)
+}
+
+// canIssue reports whether issuance for commonName can start.
+func (m *Manager) canIssue(commonName string) bool {
+	return m.issuer() != nil && commonName != "" && !m.closed.Load() && m.certStorageReady()
+}
 
+// startIssuance issues the certificate in the background; the inventory
+// entry must already be pending. Issuance that would exceed the CA's rate
+// limits is deferred instead.
+func (m *Manager) startIssuance(id string, domains []string, commonName string) {
 	fakeACME := os.Getenv("PICCOLO_REMOTE_FAKE_ACME") == "1"
-	// Fire and forget
+	if !m.claimIssuance(id) {
+		return
+	}
+	if m.deferIssuance(id, domains) {
+		m.releaseIssuance(id)
+		return
+	}
+	if !m.addWorker() {
+		m.releaseIssuance(id)
+		return
+	}
 	go func(id string, domains []string, cn string) {
-		certDir := m.certDir()
+		defer m.workers.Done()
+		defer m.releaseIssuance(id)
+		certDir := m.beginIssue()
 		outName := outNameFor(id, cn)
+		progress := m.certProgress(id)
 		if fakeACME {
-			expires, err := writeSelfSignedCertificate(certDir, outName, cn, domains)
+			if m.workCtx.Err() != nil {
+				return
+			}
+			expires, err := writeSelfSignedCertificate(certDir, outName, cn, domains, m.writeCertKey)
+			m.endIssue(certDir, outName)
 			if err != nil {
-				m.updateCertFailure(id, err.Error())
+				m.updateCertFailure(id, domains, err.Error())
 				return
 			}
-			m.updateCertSuccess(id, expires)
+			progress(acme.StageDownloaded, "self-signed")
+			m.updateCertSuccess(id, domains, expires)
 			return
 		}
-		_, err := m.acmeMgr.Issue(cn, nil, outName, certDir)
+		_, err := m.issuer().Issue(m.workCtx, cn, extraSANs(cn, domains), outName, certDir, progress)
 		if err != nil {
-			m.updateCertFailure(id, err.Error())
+			m.endIssue(certDir, outName)
+			m.updateCertFailure(id, domains, err.Error())
 			return
 		}
 		// Try to read expiry from on-disk certificate
-		if exp, ok := readCertExpiry(filepath.Join(certDir, outName+".crt")); ok {
-			m.updateCertSuccess(id, exp)
+		exp, ok := readCertExpiry(filepath.Join(certDir, outName+".crt"))
+		m.endIssue(certDir, outName)
+		if ok {
+			m.updateCertSuccess(id, domains, exp)
 		} else {
 			// Fallback: 90d expiry
-			m.updateCertSuccess(id, m.now().Add(90*24*time.Hour))
+			m.updateCertSuccess(id, domains, m.now().Add(90*24*time.Hour))
 		}
 	}(id, append([]string(nil), domains...), commonName)
 }
 
+// claimIssuance marks certificate id as being issued. It returns false when
+// an issuance for id is already running, so retries do not order the same
+// certificate twice in parallel.
+func (m *Manager) claimIssuance(id string) bool {
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+	if m.issuingCerts[id] {
+		return false
+	}
+	m.issuingCerts[id] = true
+	return true
+}
+
+func (m *Manager) releaseIssuance(id string) {
+	m.issueMu.Lock()
+	delete(m.issuingCerts, id)
+	m.issueMu.Unlock()
+}
+
+// issuing reports whether certificate id is being issued.
+func (m *Manager) issuing(id string) bool {
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+	return m.issuingCerts[id]
+}
+
+// extraSANs lists the domains besides the common name.
+func extraSANs(cn string, domains []string) []string {
+	var sans []string
+	for _, d := range domains {
+		if !strings.EqualFold(d, cn) {
+			sans = append(sans, d)
+		}
+	}
+	return sans
+}
+
 func outNameFor(id, cn string) string {
 	// For wildcard we want the actual CN as filename (e.g., *.example.com)
 	if id == "wildcard" {
@@ -875,15 +1697,30 @@ func outNameFor(id, cn string) string {
 }
 
 func (m *Manager) ensureCertPending(cfg *Config, id string, domains []string, now time.Time) {
+	markCertPending(cfg, id, domains)
+	m.appendEvent(cfg, Event{
+		Timestamp: now,
+		Level:     "info",
+		Source:    "remote",
+		Message:   fmt.Sprintf("Certificate issuance started (%s)", id),
+	})
+}
+
+// markCertPending adds or resets the inventory entry for id as pending.
+func markCertPending(cfg *Config, id string, domains []string) {
 	found := false
 	for i := range cfg.Certificates {
 		if cfg.Certificates[i].ID == id {
 			cfg.Certificates[i].Domains = append([]string(nil), domains...)
 			cfg.Certificates[i].Status = "pending"
 			cfg.Certificates[i].FailureReason = ""
+			cfg.Certificates[i].LastStage = ""
 			cfg.Certificates[i].IssuedAt = nil
 			cfg.Certificates[i].ExpiresAt = nil
 			cfg.Certificates[i].NextRenewal = nil
+			cfg.Certificates[i].OrphanedAt = nil
+			cfg.Certificates[i].DeferredUntil = nil
+			cfg.Certificates[i].Solver = cfg.Solver
 			found = true
 			break
 		}
@@ -892,61 +1729,122 @@ func (m *Manager) ensureCertPending(cfg *Config, id string, domains []string, no
 		cfg.Certificates = append(cfg.Certificates, Certificate{
 			ID:      id,
 			Domains: append([]string(nil), domains...),
+			Solver:  cfg.Solver,
 			Status:  "pending",
 		})
 	}
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   fmt.Sprintf("Certificate issuance started (%s)", id),
+}
+
+// certProgress returns the issuance callback for certificate id: each stage
+// is stored as the certificate's LastStage and published on the bus.
+func (m *Manager) certProgress(id string) acme.ProgressFunc {
+	return func(stage acme.Stage, detail string) {
+		_ = m.update(func(cfg *Config) error {
+			for i := range cfg.Certificates {
+				if cfg.Certificates[i].ID == id {
+					cfg.Certificates[i].LastStage = string(stage)
+					break
+				}
+			}
+			return nil
+		})
+		m.publishCertProgress(id, string(stage), detail)
+	}
+}
+
+func (m *Manager) publishCertProgress(id, stage, detail string) {
+	if m.eventsBus == nil {
+		return
+	}
+	m.eventsBus.Publish(events.Event{
+		Topic:   events.TopicRemoteCertProgress,
+		Payload: events.RemoteCertProgress{CertID: id, Stage: stage, Detail: detail, Time: m.now()},
 	})
 }
 
-func (m *Manager) updateCertSuccess(id string, expiresAt time.Time) {
-	cfg := m.currentConfig()
+func (m *Manager) updateCertSuccess(id string, domains []string, expiresAt time.Time) {
 	now := m.now()
-	next := now.Add(60 * 24 * time.Hour)
-	for i := range cfg.Certificates {
-		if cfg.Certificates[i].ID == id {
-			cfg.Certificates[i].IssuedAt = timePtr(now)
-			cfg.Certificates[i].ExpiresAt = timePtr(expiresAt)
-			cfg.Certificates[i].NextRenewal = timePtr(next)
-			cfg.Certificates[i].Status = "ok"
-			cfg.Certificates[i].FailureReason = ""
-			break
+	_ = m.update(func(cfg *Config) error {
+		recordIssuance(cfg, id, domains, IssuanceIssued, m.issuanceLimits, now)
+		next := renewAt(now, expiresAt, cfg.renewalLead())
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == id {
+				cfg.Certificates[i].IssuedAt = timePtr(now)
+				cfg.Certificates[i].ExpiresAt = timePtr(expiresAt)
+				cfg.Certificates[i].FailureReason = ""
+				// Issuance that finishes after the entry was retired
+				// leaves it retired.
+				if isRetired(cfg.Certificates[i]) {
+					break
+				}
+				cfg.Certificates[i].NextRenewal = timePtr(next)
+				cfg.Certificates[i].Status = "ok"
+				break
+			}
 		}
-	}
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   fmt.Sprintf("Certificate issuance succeeded (%s)", id),
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate issuance succeeded (%s)", id),
+		})
+		return nil
 	})
-	_ = m.save(cfg)
+	m.deployCertificate(id)
 }
 
-func (m *Manager) updateCertFailure(id string, reason string) {
-	cfg := m.currentConfig()
+func (m *Manager) updateCertFailure(id string, domains []string, reason string) {
 	now := m.now()
-	for i := range cfg.Certificates {
-		if cfg.Certificates[i].ID == id {
-			cfg.Certificates[i].Status = "error"
-			cfg.Certificates[i].FailureReason = reason
-			break
+	_ = m.update(func(cfg *Config) error {
+		recordIssuance(cfg, id, domains, IssuanceFailed, m.issuanceLimits, now)
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == id {
+				if !isRetired(cfg.Certificates[i]) {
+					cfg.Certificates[i].Status = "error"
+				}
+				cfg.Certificates[i].FailureReason = reason
+				break
+			}
 		}
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "warn",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate issuance failed (%s): %s", id, reason),
+			NextStep:  "Verify DNS/Nexus reachability and retry",
+		})
+		return nil
+	})
+	m.publishCertProgress(id, CertStageFailed, reason)
+	if id == "wildcard" {
+		m.fallBackFromWildcard()
 	}
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "warn",
-		Source:    "remote",
-		Message:   fmt.Sprintf("Certificate issuance failed (%s): %s", id, reason),
-		NextStep:  "Verify DNS/Nexus reachability and retry",
+}
+
+// fallBackFromWildcard queues per-host certificates for the hostnames the
+// wildcard was meant to cover once it can no longer serve them.
+func (m *Manager) fallBackFromWildcard() {
+	var hosts []string
+	_ = m.update(func(cfg *Config) error {
+		hosts = nil
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == "wildcard" {
+				hosts = cfg.Certificates[i].Covers
+				cfg.Certificates[i].Covers = nil
+				break
+			}
+		}
+		if len(hosts) == 0 {
+			return errNoChange
+		}
+		return nil
 	})
-	_ = m.save(cfg)
+	for _, h := range hosts {
+		m.enqueueIssuance("host:"+h, []string{h}, h)
+	}
 }
 
-func writeSelfSignedCertificate(dir, outName, commonName string, domains []string) (time.Time, error) {
+func writeSelfSignedCertificate(dir, outName, commonName string, domains []string, writeKey func(dir, name string, keyPEM []byte) error) (time.Time, error) {
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return time.Time{}, err
 	}
@@ -994,12 +1892,11 @@ func writeSelfSignedCertificate(dir, outName, commonName string, domains []strin
 	if err != nil {
 		return time.Time{}, err
 	}
-	certPath := filepath.Join(dir, outName+".crt")
-	keyPath := filepath.Join(dir, outName+".key")
-	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+	if err := writeKey(dir, outName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})); err != nil {
 		return time.Time{}, err
 	}
-	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600); err != nil {
+	certPath := filepath.Join(dir, outName+".crt")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
 		return time.Time{}, err
 	}
 	return expires, nil
@@ -1025,59 +1922,33 @@ func readCertExpiry(path string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
-// RunPreflight performs validation checks for the remote configuration.
-func (m *Manager) RunPreflight() (PreflightResult, error) {
-	cfg := m.currentConfig()
-	if cfg.Endpoint == "" || cfg.TLD == "" || cfg.PortalHostname == "" {
-		return PreflightResult{}, errors.New("remote not configured")
-	}
-
-	now := m.now()
-	var checks []PreflightCheck
-
-	endpointCheck := m.checkEndpoint(cfg)
-	checks = append(checks, endpointCheck)
-
-	dnsStatus, dnsDetail := m.checkDNS(cfg)
-	checks = append(checks, PreflightCheck{Name: "DNS records", Status: dnsStatus, Detail: dnsDetail})
-
-	checks = append(checks, PreflightCheck{Name: "ACME solver", Status: "pass", Detail: fmt.Sprintf("Using %s", strings.ToUpper(cfg.Solver))})
-
-	if len(cfg.Aliases) > 0 {
-		status := "pass"
-		detail := "All aliases verified"
-		for _, alias := range cfg.Aliases {
-			if alias.Status != "active" {
-				status = "warn"
-				detail = "One or more aliases pending verification"
-				break
-			}
-		}
-		checks = append(checks, PreflightCheck{Name: "Alias coverage", Status: status, Detail: detail})
-	}
-
-	cfg.LastPreflight = &now
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   "Preflight completed",
-	})
-	if err := m.save(cfg); err != nil {
-		return PreflightResult{}, err
-	}
-	return PreflightResult{Checks: checks, RanAt: now}, nil
-}
-
-// ListEvents returns the persisted remote-related events.
+// ListEvents returns the persisted remote-related events, newest first.
 func (m *Manager) ListEvents() []Event {
-	events := append([]Event(nil), m.currentConfig().Events...)
+	cfg := m.currentConfig()
+	events := append([]Event(nil), cfg.Events...)
+	numberEvents(&Config{Events: events, EventSeq: cfg.EventSeq})
 	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
 		events[i], events[j] = events[j], events[i]
 	}
 	return events
 }
 
+// SecretValues returns the stored credentials (device secret and DNS
+// provider credentials) so diagnostics can scrub them from free text.
+func (m *Manager) SecretValues() []string {
+	cfg := m.currentConfig()
+	out := make([]string, 0, 1+len(cfg.DNSCredentials))
+	if cfg.DeviceSecret != "" {
+		out = append(out, cfg.DeviceSecret)
+	}
+	for _, v := range cfg.DNSCredentials {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // GuideVerification carries helper verification metadata.
 type GuideVerification struct {
 	Endpoint       string `json:"endpoint"`
@@ -1088,32 +1959,41 @@ type GuideVerification struct {
 
 // MarkGuideVerified stores the helper verification timestamp and optional seed data.
 func (m *Manager) MarkGuideVerified(info GuideVerification) error {
-	cfg := m.currentConfig()
-	if info.Endpoint != "" {
-		cfg.Endpoint = strings.TrimSpace(info.Endpoint)
-	}
-	if info.JWTSecret != "" {
-		cfg.DeviceSecret = strings.TrimSpace(info.JWTSecret)
-	}
-	if info.TLD != "" {
-		cfg.TLD = strings.TrimSpace(info.TLD)
-	}
-	if info.PortalHostname != "" {
-		host := normalizePortalHost(cfg.TLD, info.PortalHostname)
-		if host == "" {
-			return errors.New("portal hostname invalid")
+	return m.update(func(cfg *Config) error {
+		if info.Endpoint != "" {
+			u, err := parseEndpoint(info.Endpoint)
+			if err != nil {
+				return err
+			}
+			cfg.Endpoint = u.String()
 		}
-		cfg.PortalHostname = host
-	}
-	now := m.now()
-	cfg.GuideVerifiedAt = &now
-	cfg.Events = append(cfg.Events, Event{
-		Timestamp: now,
-		Level:     "info",
-		Source:    "remote",
-		Message:   "Nexus helper verified",
+		if info.JWTSecret != "" {
+			cfg.DeviceSecret = strings.TrimSpace(info.JWTSecret)
+		}
+		if info.TLD != "" {
+			tld, display, err := normalizeTLD(info.TLD)
+			if err != nil {
+				return err
+			}
+			cfg.TLD, cfg.TLDDisplay = tld, display
+		}
+		if info.PortalHostname != "" {
+			host, display, err := normalizePortalHost(cfg.TLD, info.PortalHostname)
+			if err != nil {
+				return err
+			}
+			cfg.PortalHostname, cfg.PortalHostnameDisplay = host, display
+		}
+		now := m.now()
+		cfg.GuideVerifiedAt = &now
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "info",
+			Source:    "remote",
+			Message:   "Nexus helper verified",
+		})
+		return nil
 	})
-	return m.save(cfg)
 }
 
 // GuideInfo returns static helper information along with verification timestamp.
@@ -1143,61 +2023,6 @@ func (m *Manager) GuideInfo() GuideInfo {
 	}
 }
 
-func (m *Manager) checkEndpoint(cfg *Config) PreflightCheck {
-	host, port := endpointHostPort(cfg.Endpoint)
-	if host == "" {
-		return PreflightCheck{Name: "Nexus endpoint reachable", Status: "fail", Detail: "invalid endpoint"}
-	}
-	if port == "" {
-		port = "443"
-	}
-	address := net.JoinHostPort(host, port)
-	start := time.Now()
-	conn, err := m.dialer.DialTimeout("tcp", address, 5*time.Second)
-	if err != nil {
-		return PreflightCheck{Name: "Nexus endpoint reachable", Status: "fail", Detail: err.Error(), NextStep: "Verify firewall and DNS"}
-	}
-	latency := int(time.Since(start).Milliseconds())
-	_ = conn.Close()
-	cfg.LastHandshake = m.now()
-	cfg.LatencyMS = latency
-	return PreflightCheck{Name: "Nexus endpoint reachable", Status: "pass", Detail: fmt.Sprintf("Latency %d ms", latency)}
-}
-
-func (m *Manager) checkDNS(cfg *Config) (string, string) {
-	host := cfg.PortalHostname
-	if host == "" {
-		return "fail", "portal hostname not configured"
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cname, cnameErr := m.resolver.LookupCNAME(ctx, host)
-	addresses, addrErr := m.resolver.LookupHost(ctx, host)
-
-	detail := fmt.Sprintf("%s resolves to %v", host, addresses)
-	if cnameErr == nil && cname != "" {
-		detail = fmt.Sprintf("%s CNAME %s", host, strings.TrimSuffix(cname, "."))
-	}
-
-	status := "pass"
-	if addrErr != nil {
-		status = "warn"
-		detail = fmt.Sprintf("portal host lookup failed: %v", addrErr)
-	}
-
-	if cfg.TLD != "" && cfg.PortalHostname != cfg.TLD {
-		sample := fmt.Sprintf("app.%s", cfg.TLD)
-		if _, err := m.resolver.LookupHost(ctx, sample); err != nil {
-			status = "warn"
-			detail = detail + "; wildcard host unresolved"
-		} else {
-			detail = detail + "; wildcard host resolves"
-		}
-	}
-	return status, detail
-}
-
 func buildListeners(cfg *Config) []ListenerSummary {
 	if cfg.PortalHostname == "" {
 		return []ListenerSummary{}
@@ -1205,9 +2030,9 @@ func buildListeners(cfg *Config) []ListenerSummary {
 	return []ListenerSummary{{Name: "portal", RemoteHost: cfg.PortalHostname}}
 }
 
-func computeWarnings(cfg *Config) []string {
+func computeWarnings(cfg *Config, now time.Time) []string {
 	var warnings []string
-	if !cfg.NextRenewal.IsZero() && cfg.NextRenewal.Before(time.Now().Add(7*24*time.Hour)) {
+	if !cfg.NextRenewal.IsZero() && cfg.NextRenewal.Before(now.Add(7*24*time.Hour)) {
 		warnings = append(warnings, "Certificate renewal due soon")
 	}
 	if cfg.PortalHostname == "" {
@@ -1218,12 +2043,17 @@ func computeWarnings(cfg *Config) []string {
 			warnings = append(warnings, fmt.Sprintf("Alias %s is %s", alias.Hostname, alias.Status))
 		}
 	}
+	// The tunnel can be up while the outside world still cannot reach the
+	// portal (DNS, Nexus forwarding); only a probe tells the two apart.
+	if cfg.Enabled && cfg.LastProbe != nil && !cfg.LastProbe.Reachable {
+		warnings = append(warnings, "Portal unreachable from the internet: "+cfg.LastProbe.Error)
+	}
 	return warnings
 }
 
 func defaultCertificates(cfg *Config, now time.Time) []Certificate {
 	exp := now.Add(90 * 24 * time.Hour)
-	next := now.Add(60 * 24 * time.Hour)
+	next := renewAt(now, exp, cfg.renewalLead())
 	certificates := []Certificate{}
 	if cfg.PortalHostname != "" {
 		certificates = append(certificates, Certificate{
@@ -1259,12 +2089,35 @@ func cloneAliases(in []Alias) []Alias {
 	return out
 }
 
+func cloneProbe(in *ProbeResult) *ProbeResult {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
+
 func cloneCertificates(in []Certificate) []Certificate {
 	if len(in) == 0 {
 		return []Certificate{}
 	}
 	out := make([]Certificate, len(in))
 	copy(out, in)
+	for i := range out {
+		out[i].Covers = append([]string(nil), in[i].Covers...)
+	}
+	return out
+}
+
+func cloneIssuances(in []IssuanceRecord) []IssuanceRecord {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]IssuanceRecord, len(in))
+	copy(out, in)
+	for i := range out {
+		out[i].RegisteredDomains = append([]string(nil), in[i].RegisteredDomains...)
+	}
 	return out
 }
 
@@ -1279,35 +2132,6 @@ func cloneCredentials(in map[string]string) map[string]string {
 	return out
 }
 
-func endpointHostPort(endpoint string) (string, string) {
-	if endpoint == "" {
-		return "", ""
-	}
-	if u, err := url.Parse(endpoint); err == nil {
-		host := u.Hostname()
-		port := u.Port()
-		if port == "" {
-			if u.Scheme == "http" || u.Scheme == "ws" {
-				port = "80"
-			} else {
-				port = "443"
-			}
-		}
-		return host, port
-	}
-	stripped := strings.TrimPrefix(endpoint, "wss://")
-	stripped = strings.TrimPrefix(stripped, "https://")
-	stripped = strings.TrimPrefix(stripped, "ws://")
-	stripped = strings.TrimPrefix(stripped, "http://")
-	parts := strings.SplitN(stripped, "/", 2)
-	hostPort := parts[0]
-	host, port, err := net.SplitHostPort(hostPort)
-	if err != nil {
-		return hostPort, ""
-	}
-	return host, port
-}
-
 func deriveACMEEmail(tld, portal string) string {
 	host := strings.TrimSpace(strings.ToLower(portal))
 	if host == "" {
@@ -1320,24 +2144,6 @@ func deriveACMEEmail(tld, portal string) string {
 	return fmt.Sprintf("admin@%s", host)
 }
 
-func normalizePortalHost(tld, portal string) string {
-	tld = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(tld)), ".")
-	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(portal)), ".")
-	if host == "" {
-		return ""
-	}
-	if tld == "" {
-		return host
-	}
-	if host == tld || strings.HasSuffix(host, "."+tld) {
-		return host
-	}
-	if !strings.Contains(host, ".") {
-		return host + "." + tld
-	}
-	return host
-}
-
 func stringPtr(s string) *string {
 	if s == "" {
 		return nil
@@ -2,11 +2,19 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"piccolod/internal/events"
+	"piccolod/internal/remote/acme"
 	"piccolod/internal/remote/nexusclient"
 )
 
@@ -14,7 +22,7 @@ type stubDialer struct {
 	err error
 }
 
-func (s *stubDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+func (s *stubDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
@@ -67,6 +75,7 @@ func TestRunPreflightSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
 
 	err = m.Configure(ConfigureRequest{
 		Endpoint:       "wss://nexus.example.com/connect",
@@ -79,7 +88,7 @@ func TestRunPreflightSuccess(t *testing.T) {
 		t.Fatalf("configure failed: %v", err)
 	}
 
-	result, err := m.RunPreflight()
+	result, err := m.RunPreflight(context.Background())
 	if err != nil {
 		t.Fatalf("preflight failed: %v", err)
 	}
@@ -94,6 +103,9 @@ func TestRunPreflightSuccess(t *testing.T) {
 	if st.PortalHostname != "portal.example.com" {
 		t.Fatalf("unexpected portal host %s", st.PortalHostname)
 	}
+	if st.PortalURL != "https://portal.example.com" {
+		t.Fatalf("unexpected portal url %q", st.PortalURL)
+	}
 }
 
 type fakeAdapter struct {
@@ -147,6 +159,7 @@ func TestManager_NexusAdapterLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("manager: %v", err)
 	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
 	adapter := newFakeAdapter()
 	m.SetNexusAdapter(adapter)
 
@@ -190,6 +203,7 @@ func TestRunPreflightFailures(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
 
 	_ = m.Configure(ConfigureRequest{
 		Endpoint:       "wss://nexus.example.com/connect",
@@ -198,9 +212,10 @@ func TestRunPreflightFailures(t *testing.T) {
 		TLD:            "example.com",
 		PortalHostname: "portal.example.com",
 		DNSProvider:    "cloudflare",
+		DNSCredentials: map[string]string{"api_token": strings.Repeat("t", 40)},
 	})
 
-	result, err := m.RunPreflight()
+	result, err := m.RunPreflight(context.Background())
 	if err != nil {
 		t.Fatalf("preflight failed: %v", err)
 	}
@@ -215,3 +230,624 @@ func TestRunPreflightFailures(t *testing.T) {
 		t.Fatalf("expected failure check, got %+v", result.Checks)
 	}
 }
+
+func TestManager_PlanConfigureMatchesApply(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir := t.TempDir()
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(5, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	m.SetNexusAdapter(newFakeAdapter())
+
+	req := ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		TLD:            "example.com",
+		PortalHostname: "Portal",
+		ListenerNames:  []string{"web", "WEB", "portal"},
+	}
+	if _, err := m.PlanConfigure(ConfigureRequest{Endpoint: req.Endpoint, TLD: "example.com"}); err == nil {
+		t.Fatalf("expected validation error for missing portal hostname")
+	}
+	plan, err := m.PlanConfigure(req)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if _, err := os.Stat(storage.path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("dry run must not write config: %v", err)
+	}
+	if st := m.Status(); st.Enabled || len(st.Certificates) != 0 {
+		t.Fatalf("dry run must not change state: %+v", st)
+	}
+	if plan.PortalHostname != "portal.example.com" || plan.Solver != "http-01" || plan.ACMEEmail != "admin@portal.example.com" || !plan.RestartAdapter {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	var ids []string
+	for _, c := range plan.Certificates {
+		if c.Action != "issue" {
+			t.Fatalf("fresh config should only issue, got %+v", c)
+		}
+		ids = append(ids, c.ID)
+	}
+	if strings.Join(ids, ",") != "portal,host:web.example.com" {
+		t.Fatalf("unexpected planned certificates %v", ids)
+	}
+
+	if err := m.Configure(req); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	st := m.Status()
+	if st.PortalHostname != plan.PortalHostname || st.Solver != plan.Solver {
+		t.Fatalf("apply diverged from plan: %+v", st)
+	}
+	got := map[string]bool{}
+	for _, c := range st.Certificates {
+		got[c.ID] = true
+	}
+	for _, c := range plan.Certificates {
+		if !got[c.ID] {
+			t.Fatalf("planned certificate %s missing after apply: %+v", c.ID, st.Certificates)
+		}
+	}
+
+	req.PortalHostname = "home"
+	again, err := m.PlanConfigure(req)
+	if err != nil {
+		t.Fatalf("second plan: %v", err)
+	}
+	if again.Certificates[0].ID != "portal" || again.Certificates[0].Action != "reissue" {
+		t.Fatalf("expected portal reissue, got %+v", again.Certificates)
+	}
+	found := false
+	for _, w := range again.Warnings {
+		if strings.Contains(w, "portal.example.com to home.example.com") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected portal change warning, got %v", again.Warnings)
+	}
+	if st := m.Status(); st.PortalHostname != "portal.example.com" {
+		t.Fatalf("dry run changed portal hostname to %s", st.PortalHostname)
+	}
+}
+
+// stagedIssuer reports every issuance stage in order, failing before failAt
+// when set.
+type stagedIssuer struct {
+	failAt acme.Stage
+}
+
+func (f *stagedIssuer) Issue(ctx context.Context, commonName string, sans []string, outName, certDir string, progress acme.ProgressFunc) (*tls.Certificate, error) {
+	for _, stage := range []acme.Stage{acme.StageAccount, acme.StageOrderCreated, acme.StageChallengePresented, acme.StageChallengeValid, acme.StageFinalizing, acme.StageDownloaded} {
+		if stage == f.failAt {
+			return nil, errors.New("acme: challenge rejected")
+		}
+		progress(stage, commonName)
+	}
+	return &tls.Certificate{}, nil
+}
+
+func (f *stagedIssuer) SetEmail(string)             {}
+func (f *stagedIssuer) SetKeyWriter(acme.KeyWriter) {}
+
+func TestManager_CertIssuancePublishesAndPersistsStages(t *testing.T) {
+	// run issues a certificate for host with issuer and returns the first n
+	// progress events together with the persisted inventory entry once it
+	// leaves pending.
+	run := func(issuer certIssuer, host string, n int) ([]events.RemoteCertProgress, Certificate) {
+		t.Helper()
+		dir := t.TempDir()
+		storage, err := newFileStorage(dir)
+		if err != nil {
+			t.Fatalf("storage: %v", err)
+		}
+		m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(7, 0)))
+		if err != nil {
+			t.Fatalf("manager: %v", err)
+		}
+		t.Cleanup(func() { _ = m.Close(context.Background()) })
+		m.acmeMgr = issuer
+		bus := events.NewBus()
+		progress := bus.Subscribe(events.TopicRemoteCertProgress, 32)
+		m.SetEventsBus(bus)
+		m.QueueHostnameCertificate(host)
+
+		var got []events.RemoteCertProgress
+		for len(got) < n {
+			select {
+			case evt := <-progress:
+				got = append(got, evt.Payload.(events.RemoteCertProgress))
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out after %d progress events: %+v", len(got), got)
+			}
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			// The issuer goroutine may be mid-save; retry on a torn read.
+			cfg, err := storage.Load(context.Background())
+			if err == nil {
+				for _, c := range cfg.Certificates {
+					if c.ID == "host:"+host && c.Status != "pending" {
+						return got, c
+					}
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("certificate for %s never left pending (last load err=%v)", host, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	stages := func(evts []events.RemoteCertProgress) string {
+		names := make([]string, len(evts))
+		for i, e := range evts {
+			names[i] = e.Stage
+		}
+		return strings.Join(names, ",")
+	}
+
+	got, cert := run(&stagedIssuer{}, "app.example.com", 6)
+	if want := "account,order_created,challenge_presented,challenge_valid,finalizing,downloaded"; stages(got) != want {
+		t.Fatalf("stages out of order: got %s want %s", stages(got), want)
+	}
+	for _, e := range got {
+		if e.CertID != "host:app.example.com" || e.Detail != "app.example.com" {
+			t.Fatalf("unexpected progress payload %+v", e)
+		}
+	}
+	if cert.Status != "ok" || cert.LastStage != string(acme.StageDownloaded) {
+		t.Fatalf("expected last stage persisted, got %+v", cert)
+	}
+
+	got, cert = run(&stagedIssuer{failAt: acme.StageChallengeValid}, "stuck.example.com", 4)
+	if want := "account,order_created,challenge_presented," + CertStageFailed; stages(got) != want {
+		t.Fatalf("failure stages: got %s want %s", stages(got), want)
+	}
+	if cert.Status != "error" || cert.LastStage != string(acme.StageChallengePresented) {
+		t.Fatalf("expected failure to keep last reached stage, got %+v", cert)
+	}
+}
+
+// blockingIssuer holds each issuance until its context is cancelled, or
+// until release is closed when ignoreCtx is set.
+type blockingIssuer struct {
+	started   chan string
+	release   chan struct{}
+	ignoreCtx bool
+	returned  atomic.Int32
+}
+
+func (b *blockingIssuer) Issue(ctx context.Context, commonName string, sans []string, outName, certDir string, progress acme.ProgressFunc) (*tls.Certificate, error) {
+	defer b.returned.Add(1)
+	b.started <- commonName
+	if b.ignoreCtx {
+		<-b.release
+		return nil, errors.New("released")
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingIssuer) SetEmail(string)             {}
+func (b *blockingIssuer) SetKeyWriter(acme.KeyWriter) {}
+
+// countingStorage counts the saves that reach storage.
+type countingStorage struct {
+	Storage
+	saves atomic.Int32
+}
+
+func (s *countingStorage) Save(ctx context.Context, cfg Config) error {
+	s.saves.Add(1)
+	return s.Storage.Save(ctx, cfg)
+}
+
+func newCloseTestManager(t *testing.T, issuer *blockingIssuer) (*Manager, *countingStorage) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "remote-close")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	files, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	storage := &countingStorage{Storage: files}
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(9, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	m.acmeMgr = issuer
+	return m, storage
+}
+
+func TestManager_CloseAbortsIssuanceAndRejectsSaves(t *testing.T) {
+	issuer := &blockingIssuer{started: make(chan string, 8)}
+	m, storage := newCloseTestManager(t, issuer)
+	hosts := []string{"a.example.com", "b.example.com", "c.example.com"}
+	for _, h := range hosts {
+		m.QueueHostnameCertificate(h)
+	}
+	for range hosts {
+		select {
+		case <-issuer.started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("issuance did not start")
+		}
+	}
+
+	savesBefore := storage.saves.Load()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := issuer.returned.Load(); got != int32(len(hosts)) {
+		t.Fatalf("%d of %d issuances still running after Close", len(hosts)-int(got), len(hosts))
+	}
+	if got := storage.saves.Load(); got != savesBefore {
+		t.Fatalf("%d saves reached storage after Close", got-savesBefore)
+	}
+	if err := m.save(m.currentConfig()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("save after close: %v", err)
+	}
+
+	m.QueueHostnameCertificate("d.example.com")
+	select {
+	case h := <-issuer.started:
+		t.Fatalf("issuance for %s started after Close", h)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := m.Close(ctx); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestManager_CloseTimesOutOnStuckIssuance(t *testing.T) {
+	issuer := &blockingIssuer{started: make(chan string, 1), release: make(chan struct{}), ignoreCtx: true}
+	m, storage := newCloseTestManager(t, issuer)
+	m.QueueHostnameCertificate("stuck.example.com")
+	<-issuer.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	savesBefore := storage.saves.Load()
+	close(issuer.release)
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatalf("close after release: %v", err)
+	}
+	if got := storage.saves.Load(); got != savesBefore {
+		t.Fatalf("late issuance result was saved after Close")
+	}
+}
+
+// settledCertificates waits for every queued issuance to leave pending.
+func settledCertificates(t *testing.T, m *Manager) map[string]Certificate {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		certs := map[string]Certificate{}
+		pending := false
+		for _, c := range m.ListCertificates() {
+			certs[c.ID] = c
+			pending = pending || c.Status == "pending"
+		}
+		if !pending {
+			return certs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("certificates still pending: %+v", certs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManager_WildcardCoversListenerHostnames(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir, err := os.MkdirTemp("", "remote-wildcard")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(5, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	req := ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "dns-01",
+		TLD:            "example.com",
+		PortalHostname: "portal",
+		DNSProvider:    "cloudflare",
+		DNSCredentials: map[string]string{"api_token": strings.Repeat("t", 40)},
+		ListenerNames:  []string{"web"},
+	}
+	plan, err := m.ConfigureWithPlan(req)
+	if err != nil {
+		t.Fatalf("configure dns-01: %v", err)
+	}
+	for _, c := range plan.Certificates {
+		if strings.HasPrefix(c.ID, "host:") {
+			t.Fatalf("dns-01 planned a per-host certificate: %+v", plan.Certificates)
+		}
+	}
+	settledCertificates(t, m)
+
+	// dns-01: hostnames under the TLD ride on the wildcard.
+	m.QueueHostnameCertificate("Blog.example.com")
+	certs := settledCertificates(t, m)
+	if _, ok := certs["host:blog.example.com"]; ok {
+		t.Fatalf("wildcard-covered hostname got its own certificate: %+v", certs)
+	}
+	if got := strings.Join(certs["wildcard"].Covers, ","); got != "blog.example.com,web.example.com" {
+		t.Fatalf("wildcard covers = %q", got)
+	}
+
+	// A nested name is outside the wildcard.
+	m.QueueHostnameCertificate("a.b.example.com")
+	if certs := settledCertificates(t, m); certs["host:a.b.example.com"].Status != "ok" {
+		t.Fatalf("nested hostname not issued: %+v", certs)
+	}
+
+	// A wildcard close to expiry no longer counts.
+	if err := m.update(func(cfg *Config) error {
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == "wildcard" {
+				cfg.Certificates[i].ExpiresAt = timePtr(m.now().Add(time.Hour))
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("expire wildcard: %v", err)
+	}
+	m.QueueHostnameCertificate("late.example.com")
+	if certs := settledCertificates(t, m); certs["host:late.example.com"].Status != "ok" {
+		t.Fatalf("expected per-host issuance beside an expiring wildcard: %+v", certs)
+	}
+
+	// Switching to http-01 queues the previously covered hostnames.
+	req.Solver = "http-01"
+	req.DNSProvider = ""
+	req.DNSCredentials = nil
+	req.ListenerNames = nil
+	plan, err = m.ConfigureWithPlan(req)
+	if err != nil {
+		t.Fatalf("configure http-01: %v", err)
+	}
+	var ids []string
+	for _, c := range plan.Certificates {
+		ids = append(ids, c.ID)
+	}
+	if got := strings.Join(ids, ","); got != "portal,host:blog.example.com,host:web.example.com" {
+		t.Fatalf("switch plan = %s", got)
+	}
+	certs = settledCertificates(t, m)
+	if w := certs["wildcard"]; w.Status != CertStatusUnsupported || w.NextRenewal != nil {
+		t.Fatalf("wildcard not retired after switching to http-01: %+v", w)
+	}
+	for _, h := range []string{"blog.example.com", "web.example.com"} {
+		if certs["host:"+h].Status != "ok" {
+			t.Fatalf("%s not issued after switch: %+v", h, certs)
+		}
+	}
+
+	// http-01: every hostname gets its own certificate.
+	m.QueueHostnameCertificate("new.example.com")
+	if certs := settledCertificates(t, m); certs["host:new.example.com"].Status != "ok" {
+		t.Fatalf("http-01 hostname not issued: %+v", certs)
+	}
+}
+
+// newSharedStorageManager returns a manager over storage that does not issue
+// certificates, so only the writes under test reach storage.
+func newSharedStorageManager(t *testing.T, storage Storage, dir string) *Manager {
+	t.Helper()
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(11, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	m.acmeMgr = nil
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	return m
+}
+
+func TestFileStorage_SaveRejectsStaleRevision(t *testing.T) {
+	dir, err := os.MkdirTemp("", "remote-cas")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	ctx := context.Background()
+	if err := storage.Save(ctx, Config{TLD: "example.com"}); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	if err := storage.Save(ctx, Config{TLD: "example.org"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a stale revision, got %v", err)
+	}
+	cfg, err := storage.Load(ctx)
+	if err != nil || cfg.Revision != 1 || cfg.TLD != "example.com" {
+		t.Fatalf("unexpected stored config %+v err=%v", cfg, err)
+	}
+	cfg.TLD = "example.org"
+	if err := storage.Save(ctx, cfg); err != nil {
+		t.Fatalf("save at current revision: %v", err)
+	}
+	if cfg, _ = storage.Load(ctx); cfg.Revision != 2 || cfg.TLD != "example.org" {
+		t.Fatalf("unexpected stored config %+v", cfg)
+	}
+}
+
+func TestManager_ConcurrentWritersKeepEachOthersChanges(t *testing.T) {
+	dir, err := os.MkdirTemp("", "remote-writers")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	first := newSharedStorageManager(t, storage, dir)
+	second := newSharedStorageManager(t, storage, dir)
+	var sunk atomic.Int32
+	second.SetActivitySink(func(Event) { sunk.Add(1) })
+
+	if err := first.Configure(ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		TLD:            "example.com",
+		PortalHostname: "portal",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	// second still holds the empty config it started with.
+	if err := second.MarkGuideVerified(GuideVerification{}); err != nil {
+		t.Fatalf("guide verified over a stale copy: %v", err)
+	}
+	if sunk.Load() != 1 {
+		t.Fatalf("retried mutation forwarded %d events, want 1", sunk.Load())
+	}
+	if _, err := first.AddAlias("portal", "first.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("alias from stale first: %v", err)
+	}
+
+	// Both managers keep writing at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		m := first
+		if i%2 == 1 {
+			m = second
+		}
+		wg.Add(1)
+		go func(m *Manager, host string) {
+			defer wg.Done()
+			if _, err := m.AddAlias("portal", host, AliasOptions{}); err != nil {
+				t.Errorf("alias %s: %v", host, err)
+			}
+		}(m, fmt.Sprintf("host%d.example.net", i))
+	}
+	wg.Wait()
+
+	fresh := newSharedStorageManager(t, storage, dir)
+	cfg := fresh.currentConfig()
+	if !cfg.Enabled || cfg.PortalHostname != "portal.example.com" || cfg.GuideVerifiedAt == nil {
+		t.Fatalf("lost an update: enabled=%v portal=%q guide=%v", cfg.Enabled, cfg.PortalHostname, cfg.GuideVerifiedAt)
+	}
+	if len(cfg.Aliases) != 9 {
+		t.Fatalf("expected 9 aliases, got %d: %+v", len(cfg.Aliases), cfg.Aliases)
+	}
+	if cfg.Revision != 11 {
+		t.Fatalf("expected 11 saves, got revision %d", cfg.Revision)
+	}
+}
+
+// conflictingStorage reports every save as lost to another writer.
+type conflictingStorage struct {
+	saves atomic.Int32
+}
+
+func (s *conflictingStorage) Load(context.Context) (Config, error) { return Config{}, nil }
+
+func (s *conflictingStorage) Save(context.Context, Config) error {
+	s.saves.Add(1)
+	return ErrConflict
+}
+
+func TestManager_UpdateGivesUpAfterRepeatedConflicts(t *testing.T) {
+	storage := &conflictingStorage{}
+	m := newSharedStorageManager(t, storage, t.TempDir())
+	if err := m.Disable(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if got := storage.saves.Load(); got != saveAttempts {
+		t.Fatalf("expected %d attempts, got %d", saveAttempts, got)
+	}
+}
+
+// lockedStorage counts loads and fails them all as locked, so every config
+// read wants to retry the reload.
+type lockedStorage struct {
+	loads atomic.Int32
+}
+
+func (s *lockedStorage) Load(context.Context) (Config, error) {
+	s.loads.Add(1)
+	return Config{}, ErrLocked
+}
+
+func (s *lockedStorage) Save(context.Context, Config) error { return ErrLocked }
+
+func TestManager_StatusSharedUnderPollingLoad(t *testing.T) {
+	storage := &lockedStorage{}
+	m, err := newManagerWithDeps(storage, t.TempDir(), &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(5, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	before := storage.loads.Load()
+	var wg sync.WaitGroup
+	etags := make([]string, 100)
+	for i := range etags {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, etags[i] = m.StatusWithETag()
+		}()
+	}
+	wg.Wait()
+	if got := storage.loads.Load() - before; got > 1 {
+		t.Fatalf("expected concurrent polls to share one load, got %d", got)
+	}
+	for _, etag := range etags {
+		if etag == "" || etag != etags[0] {
+			t.Fatalf("polls saw different snapshots: %q vs %q", etag, etags[0])
+		}
+	}
+}
+
+func TestManager_ConfigureInvalidatesStatusETag(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir := t.TempDir()
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(5, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	m.SetNexusAdapter(newFakeAdapter())
+
+	_, first := m.StatusWithETag()
+	if _, again := m.StatusWithETag(); again != first {
+		t.Fatalf("etag changed without a config change")
+	}
+	if err := m.Configure(ConfigureRequest{Endpoint: "wss://nexus.example.com/connect", DeviceSecret: "secret", TLD: "example.com", PortalHostname: "portal"}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	st, next := m.StatusWithETag()
+	if next == first || !st.Enabled {
+		t.Fatalf("configure did not invalidate the status snapshot (enabled=%v)", st.Enabled)
+	}
+}
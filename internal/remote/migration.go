@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SolverMigration describes how Configure reconciles the certificate
+// inventory when the ACME solver changes.
+type SolverMigration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Retired lists the certificates that stop renewing and the status
+	// they are given.
+	Retired []RetiredCertificate `json:"retired"`
+	// Queued lists the certificates issued in their place.
+	Queued []string `json:"queued"`
+}
+
+// RetiredCertificate is a certificate a solver migration stops renewing.
+type RetiredCertificate struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func (s *SolverMigration) summary() string {
+	return fmt.Sprintf("Solver changed from %s to %s: %d certificate(s) retired, %d queued", s.From, s.To, len(s.Retired), len(s.Queued))
+}
+
+// carriedCertificates returns the entries of current that defaults does not
+// recreate, such as alias and listener hostname certificates.
+func carriedCertificates(current, defaults []Certificate) []Certificate {
+	have := make(map[string]bool, len(defaults))
+	for _, c := range defaults {
+		have[c.ID] = true
+	}
+	var out []Certificate
+	for _, c := range cloneCertificates(current) {
+		if !have[c.ID] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// keepExports copies the export settings of current onto the recreated
+// entries of next.
+func keepExports(next, current []Certificate) {
+	for i := range next {
+		if next[i].Export != nil {
+			continue
+		}
+		for _, c := range current {
+			if c.ID == next[i].ID && c.Export != nil {
+				export := *c.Export
+				next[i].Export = &export
+			}
+		}
+	}
+}
+
+// migrateSolver retires the certificates on next that its new solver no
+// longer renews. Leaving dns-01 marks the wildcard unsupported; the
+// hostnames it covered are already planned as per-host certificates.
+// Moving to dns-01 marks per-host certificates the wildcard now covers as
+// superseded; they keep serving until they expire.
+func migrateSolver(next *Config, from string, plan *ConfigurePlan) *SolverMigration {
+	mig := &SolverMigration{From: from, To: next.Solver, Retired: []RetiredCertificate{}, Queued: []string{}}
+	retire := func(id, status string) {
+		if retireCertificate(next, id, status) {
+			mig.Retired = append(mig.Retired, RetiredCertificate{ID: id, Status: status})
+		}
+	}
+	if next.Solver != "dns-01" {
+		retire("wildcard", CertStatusUnsupported)
+		for _, pc := range plan.Certificates {
+			if strings.HasPrefix(pc.ID, "host:") {
+				mig.Queued = append(mig.Queued, pc.ID)
+			}
+		}
+		return mig
+	}
+	wildcard := -1
+	for i := range next.Certificates {
+		if next.Certificates[i].ID == "wildcard" {
+			wildcard = i
+		}
+	}
+	if wildcard < 0 {
+		return mig
+	}
+	mig.Queued = append(mig.Queued, "wildcard")
+	for _, c := range append([]Certificate(nil), next.Certificates...) {
+		host, ok := strings.CutPrefix(c.ID, "host:")
+		if !ok || isRetired(c) {
+			continue
+		}
+		label, ok := strings.CutSuffix(host, "."+next.TLD)
+		if !ok || label == "" || strings.Contains(label, ".") {
+			continue
+		}
+		retire(c.ID, CertStatusSuperseded)
+		addCover(&next.Certificates[wildcard], host)
+	}
+	return mig
+}
@@ -0,0 +1,157 @@
+package remote
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func migrationRequest(solver string, listeners ...string) ConfigureRequest {
+	req := ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         solver,
+		TLD:            "example.com",
+		PortalHostname: "portal",
+		ListenerNames:  listeners,
+	}
+	if solver == "dns-01" {
+		req.DNSProvider = "cloudflare"
+		req.DNSCredentials = map[string]string{"api_token": strings.Repeat("t", 40)}
+	}
+	return req
+}
+
+func retiredIDs(mig *SolverMigration) string {
+	var out []string
+	for _, r := range mig.Retired {
+		out = append(out, r.ID+"="+r.Status)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestManager_SolverMigrationFromDNS01(t *testing.T) {
+	m, advance := newClockedManager(t)
+	if err := m.Configure(migrationRequest("dns-01", "web")); err != nil {
+		t.Fatalf("configure dns-01: %v", err)
+	}
+	settledCertificates(t, m)
+	if _, err := m.AddAlias("portal", "shop.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	settledCertificates(t, m)
+	// Seed: the wildcard also serves blog and has 30 days left.
+	_ = m.update(func(cfg *Config) error {
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == "wildcard" {
+				addCover(&cfg.Certificates[i], "blog.example.com")
+				cfg.Certificates[i].ExpiresAt = timePtr(m.now().Add(30 * 24 * time.Hour))
+			}
+		}
+		return nil
+	})
+
+	plan, err := m.ConfigureWithPlan(migrationRequest("http-01", "web"))
+	if err != nil {
+		t.Fatalf("configure http-01: %v", err)
+	}
+	mig := plan.Migration
+	if mig == nil || mig.From != "dns-01" || mig.To != "http-01" {
+		t.Fatalf("expected a dns-01 to http-01 migration, got %+v", mig)
+	}
+	if got := retiredIDs(mig); got != "wildcard=unsupported" {
+		t.Fatalf("retired = %s", got)
+	}
+	if got := strings.Join(mig.Queued, ","); got != "host:web.example.com,host:blog.example.com" {
+		t.Fatalf("queued = %s", got)
+	}
+	certs := settledCertificates(t, m)
+	if w := certs["wildcard"]; w.Status != CertStatusUnsupported || w.NextRenewal != nil || len(w.Covers) != 0 {
+		t.Fatalf("wildcard not retired: %+v", w)
+	}
+	for _, id := range []string{"host:web.example.com", "host:blog.example.com"} {
+		if c := certs[id]; c.Status != "ok" || c.Solver != "http-01" {
+			t.Fatalf("%s not issued with http-01: %+v", id, c)
+		}
+	}
+	if certs["alias:shop.example.net"].Status != "ok" {
+		t.Fatalf("alias certificate lost in the migration: %+v", certs)
+	}
+	if !hasEvent(m, "Solver changed from dns-01 to http-01: 1 certificate(s) retired, 2 queued") {
+		t.Fatalf("migration summary not recorded: %+v", m.ListEvents())
+	}
+	if err := m.RenewCertificate("wildcard"); err == nil {
+		t.Fatalf("expected renewal of an unsupported wildcard to be refused")
+	}
+
+	// Due for renewal, but unsupported: left alone until it expires.
+	advance(29 * 24 * time.Hour)
+	m.scanAndQueueRenewals()
+	if w := settledCertificates(t, m)["wildcard"]; w.Status != CertStatusUnsupported {
+		t.Fatalf("unsupported wildcard requeued: %+v", w)
+	}
+	advance(24 * time.Hour)
+	m.scanAndQueueRenewals()
+	if _, ok := settledCertificates(t, m)["wildcard"]; ok {
+		t.Fatalf("expired unsupported wildcard kept")
+	}
+	if _, err := os.Stat(filepath.Join(m.certDir(), "*.example.com.crt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wildcard certificate file left on disk: %v", err)
+	}
+}
+
+func TestManager_SolverMigrationToDNS01(t *testing.T) {
+	m, advance := newClockedManager(t)
+	if err := m.Configure(migrationRequest("http-01", "web")); err != nil {
+		t.Fatalf("configure http-01: %v", err)
+	}
+	m.QueueHostnameCertificate("blog.example.com")
+	m.QueueHostnameCertificate("a.b.example.com")
+	settledCertificates(t, m)
+
+	plan, err := m.ConfigureWithPlan(migrationRequest("dns-01", "web"))
+	if err != nil {
+		t.Fatalf("configure dns-01: %v", err)
+	}
+	mig := plan.Migration
+	if mig == nil || mig.From != "http-01" || mig.To != "dns-01" {
+		t.Fatalf("expected an http-01 to dns-01 migration, got %+v", mig)
+	}
+	if got := retiredIDs(mig); got != "host:web.example.com=superseded,host:blog.example.com=superseded" {
+		t.Fatalf("retired = %s", got)
+	}
+	if got := strings.Join(mig.Queued, ","); got != "wildcard" {
+		t.Fatalf("queued = %s", got)
+	}
+	certs := settledCertificates(t, m)
+	if w := certs["wildcard"]; w.Status != "ok" || w.Solver != "dns-01" || strings.Join(w.Covers, ",") != "blog.example.com,web.example.com" {
+		t.Fatalf("wildcard not issued over the superseded hostnames: %+v", w)
+	}
+	for _, id := range []string{"host:web.example.com", "host:blog.example.com"} {
+		if c := certs[id]; c.Status != CertStatusSuperseded || c.NextRenewal != nil || c.ExpiresAt == nil {
+			t.Fatalf("%s not superseded: %+v", id, c)
+		}
+	}
+	if c := certs["host:a.b.example.com"]; c.Status != "ok" {
+		t.Fatalf("nested hostname outside the wildcard was retired: %+v", c)
+	}
+
+	// Superseded certificates are not renewed.
+	advance(61 * 24 * time.Hour)
+	m.scanAndQueueRenewals()
+	certs = settledCertificates(t, m)
+	for _, id := range []string{"host:web.example.com", "host:blog.example.com"} {
+		if c := certs[id]; c.Status != CertStatusSuperseded {
+			t.Fatalf("superseded %s renewed: %+v", id, c)
+		}
+	}
+
+	// The same solver again is not a migration.
+	plan, err = m.ConfigureWithPlan(migrationRequest("dns-01", "web"))
+	if err != nil || plan.Migration != nil {
+		t.Fatalf("unexpected migration on reconfigure: %+v err=%v", plan.Migration, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"strings"
 	"sync"
@@ -39,7 +40,9 @@ const (
 
 // BackendAdapter bridges piccolod with the nexus proxy backend client. It now uses
 // the upstream token provider hook so that every connection attempt receives a
-// freshly minted JWT without custom reconnect loops on our side.
+// freshly minted JWT. The upstream client only connects once a probe of the
+// endpoint succeeds; failed probes back off exponentially behind a circuit
+// breaker instead of the client's fixed retry loop.
 type BackendAdapter struct {
 	mu       sync.Mutex
 	cfg      Config
@@ -48,13 +51,32 @@ type BackendAdapter struct {
 
 	factory clientFactory
 	cancel  context.CancelFunc
+	done    chan struct{}
 	client  backendClient
+
+	// Reconnect policy (overrideable for tests)
+	dial           func(ctx context.Context, network, addr string) (net.Conn, error)
+	jitter         func() float64
+	backoffBase    time.Duration
+	healthInterval time.Duration
+
+	retry      retryState
+	wake       chan struct{}
+	onFailures func(int)
+	notifyMu   sync.Mutex
 }
 
 func NewBackendAdapter(r *router.Manager, resolver RemoteResolver) *BackendAdapter {
+	var d net.Dialer
 	return &BackendAdapter{
-		router:   r,
-		resolver: resolver,
+		router:         r,
+		resolver:       resolver,
+		dial:           d.DialContext,
+		jitter:         rand.Float64,
+		backoffBase:    defaultBackoffBase,
+		healthInterval: defaultHealthInterval,
+		retry:          retryState{breaker: BreakerClosed},
+		wake:           make(chan struct{}, 1),
 		factory: func(cfg backend.ClientBackendConfig, handler backend.ConnectHandler) (backendClient, error) {
 			client, err := backend.New(cfg, backend.WithConnectHandler(handler))
 			if err != nil {
@@ -67,10 +89,24 @@ func NewBackendAdapter(r *router.Manager, resolver RemoteResolver) *BackendAdapt
 	}
 }
 
+// Configure sets the connection settings. A running adapter reconnects
+// with them; a new endpoint also starts a fresh retry schedule.
 func (a *BackendAdapter) Configure(cfg Config) error {
 	a.mu.Lock()
+	prev := a.cfg
 	a.cfg = cfg
+	running := a.cancel != nil
+	reset := false
+	if prev.Endpoint != cfg.Endpoint {
+		reset = a.resetRetryLocked()
+	}
 	a.mu.Unlock()
+	if running && prev != cfg {
+		a.signalWake()
+	}
+	if reset {
+		a.notifyFailures()
+	}
 
 	if updater, ok := a.resolver.(interface{ UpdateConfig(Config) }); ok {
 		updater.UpdateConfig(cfg)
@@ -90,16 +126,30 @@ func (a *BackendAdapter) Start(ctx context.Context) error {
 		log.Printf("WARN: nexus adapter start skipped, missing configuration")
 		return nil
 	}
+	client, err := a.newClient(cfg)
+	if err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	a.cancel = cancel
+	a.done = done
+	a.mu.Unlock()
+
+	go a.run(runCtx, client, cfg, done)
+	return nil
+}
+
+// newClient builds an upstream client for cfg; it connects once started.
+func (a *BackendAdapter) newClient(cfg Config) (backendClient, error) {
 	hosts := buildHostnameList(cfg)
 	backendCfg := backend.ClientBackendConfig{
 		Name:         "piccolo-portal",
 		Hostnames:    hosts,
 		NexusAddress: cfg.Endpoint,
 		Weight:       1,
-		PortMappings: map[int]backend.PortMapping{
-			443: {Default: "127.0.0.1:443"},
-			80:  {Default: "127.0.0.1:80"},
-		},
+		PortMappings: a.portMappings(),
 		Attestation: backend.AttestationOptions{
 			HMACSecret:                 strings.TrimSpace(cfg.DeviceSecret),
 			TokenTTL:                   attestationTokenTTL,
@@ -110,35 +160,32 @@ func (a *BackendAdapter) Start(ctx context.Context) error {
 			MaintenanceGraceCapSeconds: attestationMaintenanceCapSec,
 		},
 	}
-	handler := a.connectHandler()
-
-	client, err := a.factory(backendCfg, handler)
+	client, err := a.factory(backendCfg, a.connectHandler())
 	if err != nil {
-		a.mu.Unlock()
-		return fmt.Errorf("construct backend client: %w", err)
+		return nil, fmt.Errorf("construct backend client: %w", err)
 	}
-	runCtx, cancel := context.WithCancel(ctx)
-	a.client = client
-	a.cancel = cancel
-	a.mu.Unlock()
-
-	go client.Start(runCtx)
-	return nil
+	return client, nil
 }
 
+// Stop disconnects and waits for the connection loop to exit. The retry
+// schedule is kept for the next Start.
 func (a *BackendAdapter) Stop(ctx context.Context) error {
 	a.mu.Lock()
 	cancel := a.cancel
-	client := a.client
+	done := a.done
 	a.cancel = nil
-	a.client = nil
+	a.done = nil
 	a.mu.Unlock()
 
 	if cancel != nil {
 		cancel()
 	}
-	if client != nil {
-		client.Stop()
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	return nil
 }
@@ -146,8 +193,10 @@ func (a *BackendAdapter) Stop(ctx context.Context) error {
 func (a *BackendAdapter) connectHandler() backend.ConnectHandler {
 	return func(ctx context.Context, req backend.ConnectRequest) (net.Conn, error) {
 		if a.router != nil {
+			// With a known leader the local listener proxy splices the
+			// connection through to it; without one there is nowhere to go.
 			route := a.router.DecideAppRoute(req.Hostname)
-			if route.Mode == router.ModeTunnel {
+			if route.Mode == router.ModeTunnel && route.LeaderAddr == "" {
 				return nil, backend.ErrNoRoute
 			}
 		}
@@ -171,15 +220,50 @@ func (a *BackendAdapter) connectHandler() backend.ConnectHandler {
 		if err != nil {
 			return nil, err
 		}
-		if recorder, ok := a.resolver.(interface{ RecordConnectionHint(int, int, int, bool) }); ok {
+		if recorder, ok := a.resolver.(ConnectionHintRecorder); ok {
 			if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
-				recorder.RecordConnectionHint(localPort, addr.Port, req.Port, req.IsTLS)
+				recorder.RecordConnectionHint(localPort, addr.Port, req.Port, req.IsTLS, req.ClientIP)
+				sourcePort := addr.Port
+				return &hintedConn{Conn: conn, release: func() { recorder.ForgetConnectionHint(localPort, sourcePort) }}, nil
 			}
 		}
 		return conn, nil
 	}
 }
 
+// hintedConn releases the connection hint recorded for it on Close.
+type hintedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *hintedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// portMappings returns the default web ports plus any listener-requested
+// remote ports exposed by the resolver.
+func (a *BackendAdapter) portMappings() map[int]backend.PortMapping {
+	mappings := map[int]backend.PortMapping{
+		443: {Default: "127.0.0.1:443"},
+		80:  {Default: "127.0.0.1:80"},
+	}
+	source, ok := a.resolver.(PortMappingSource)
+	if !ok {
+		return mappings
+	}
+	for remotePort, localPort := range source.RemotePortMappings() {
+		if _, reserved := mappings[remotePort]; reserved || localPort <= 0 {
+			continue
+		}
+		mappings[remotePort] = backend.PortMapping{Default: fmt.Sprintf("127.0.0.1:%d", localPort)}
+	}
+	return mappings
+}
+
 func (a *BackendAdapter) currentConfig() Config {
 	a.mu.Lock()
 	cfg := a.cfg
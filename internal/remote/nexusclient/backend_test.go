@@ -3,8 +3,10 @@ package nexusclient
 import (
 	"context"
 	"errors"
+	"net"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,8 +30,18 @@ func (f *fakeClient) Stop() {
 	}
 }
 
+// reachable makes the adapter's endpoint probes succeed.
+func reachable(adapter *BackendAdapter) {
+	adapter.dial = func(context.Context, string, string) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return c1, nil
+	}
+}
+
 func TestStartConfiguresAttestation(t *testing.T) {
 	adapter := NewBackendAdapter(nil, nil)
+	reachable(adapter)
 	cfg := Config{
 		Endpoint:       "wss://nexus.example.com/connect",
 		DeviceSecret:   "  secret-value  ",
@@ -111,3 +123,104 @@ func TestStartPropagatesFactoryError(t *testing.T) {
 		t.Fatalf("expected factory error to propagate, got %v", err)
 	}
 }
+
+type mappingResolver map[int]int
+
+func (m mappingResolver) Resolve(hostname string, remotePort int, isTLS bool) (int, bool) {
+	return 0, false
+}
+
+func (m mappingResolver) RemotePortMappings() map[int]int { return m }
+
+func TestStartAdvertisesListenerRemotePorts(t *testing.T) {
+	adapter := NewBackendAdapter(nil, mappingResolver{25565: 35001, 443: 35002})
+	reachable(adapter)
+	if err := adapter.Configure(Config{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+
+	captured := make(chan backend.ClientBackendConfig, 1)
+	adapter.factory = func(cfg backend.ClientBackendConfig, handler backend.ConnectHandler) (backendClient, error) {
+		captured <- cfg
+		return &fakeClient{}, nil
+	}
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = adapter.Stop(context.Background()) })
+
+	cfg := <-captured
+	if got := cfg.PortMappings[25565].Default; got != "127.0.0.1:35001" {
+		t.Fatalf("expected listener port mapping, got %q", got)
+	}
+	if got := cfg.PortMappings[443].Default; got != "127.0.0.1:443" {
+		t.Fatalf("listener must not override web port mapping, got %q", got)
+	}
+}
+
+type hintResolver struct {
+	port      int
+	mu        sync.Mutex
+	recorded  [][2]int
+	forgotten [][2]int
+	clientIPs []string
+}
+
+func (r *hintResolver) Resolve(hostname string, remotePort int, isTLS bool) (int, bool) {
+	return r.port, true
+}
+
+func (r *hintResolver) RecordConnectionHint(localPort, sourcePort, remotePort int, isTLS bool, clientIP string) {
+	r.mu.Lock()
+	r.recorded = append(r.recorded, [2]int{localPort, sourcePort})
+	r.clientIPs = append(r.clientIPs, clientIP)
+	r.mu.Unlock()
+}
+
+func (r *hintResolver) ForgetConnectionHint(localPort, sourcePort int) {
+	r.mu.Lock()
+	r.forgotten = append(r.forgotten, [2]int{localPort, sourcePort})
+	r.mu.Unlock()
+}
+
+func TestConnectHandlerForgetsHintOnClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	res := &hintResolver{port: ln.Addr().(*net.TCPAddr).Port}
+	adapter := NewBackendAdapter(nil, res)
+	conn, err := adapter.connectHandler()(context.Background(), backend.ConnectRequest{Hostname: "app.example.com", Port: 443, IsTLS: true, ClientIP: "203.0.113.10"})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	_ = conn.Close()
+	_ = conn.Close()
+
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if len(res.recorded) != 1 {
+		t.Fatalf("expected one recorded hint, got %v", res.recorded)
+	}
+	if res.clientIPs[0] != "203.0.113.10" {
+		t.Fatalf("expected client IP passed to the hint, got %q", res.clientIPs[0])
+	}
+	if !reflect.DeepEqual(res.forgotten, res.recorded) {
+		t.Fatalf("expected hint %v forgotten exactly once, got %v", res.recorded, res.forgotten)
+	}
+}
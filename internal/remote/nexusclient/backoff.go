@@ -0,0 +1,328 @@
+package nexusclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultBackoffBase is the wait after the first failed attempt; each
+	// further failure doubles it up to maxBackoff.
+	defaultBackoffBase = time.Second
+	maxBackoff         = 5 * time.Minute
+	// backoffJitter spreads each wait by up to ±20% so devices behind the
+	// same outage do not retry in lockstep.
+	backoffJitter = 0.2
+	// breakerThreshold consecutive failures open the breaker.
+	breakerThreshold = 3
+	// defaultHealthInterval is how often the endpoint is probed while
+	// connected; the upstream client retries every 5s on its own, so a
+	// failed probe hands reconnects back to the backoff.
+	defaultHealthInterval = 30 * time.Second
+	probeTimeout          = 10 * time.Second
+)
+
+// retryState is the adapter's connection attempt bookkeeping. It lives on
+// the adapter rather than a run, so Stop and Start keep the schedule.
+type retryState struct {
+	failures    int
+	breaker     BreakerState
+	connected   bool
+	attempting  bool
+	lastErr     string
+	lastAttempt time.Time
+	next        time.Time
+}
+
+// backoffDelay is the wait after failures consecutive failures; jitter in
+// [0,1) picks a point in the ±backoffJitter band, 0.5 being the midpoint.
+func backoffDelay(failures int, base time.Duration, jitter float64) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	d := maxBackoff
+	if shift := failures - 1; shift < 20 {
+		if scaled := base << shift; scaled > 0 && scaled < maxBackoff {
+			d = scaled
+		}
+	}
+	d = time.Duration(float64(d) * (1 - backoffJitter + 2*backoffJitter*jitter))
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// endpointAddress turns the Nexus websocket URL into the host:port dialed
+// by probes.
+func endpointAddress(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parse endpoint: %w", err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "ws" || u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Stats reports the connection and its retry schedule.
+func (a *BackendAdapter) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := Stats{
+		Connected:           a.retry.connected,
+		Breaker:             a.retry.breaker,
+		ConsecutiveFailures: a.retry.failures,
+		LastError:           a.retry.lastErr,
+	}
+	if st.Breaker == "" {
+		st.Breaker = BreakerClosed
+	}
+	if !a.retry.lastAttempt.IsZero() {
+		t := a.retry.lastAttempt
+		st.LastAttempt = &t
+	}
+	if !a.retry.next.IsZero() && !a.retry.connected {
+		t := a.retry.next
+		st.NextAttempt = &t
+	}
+	return st
+}
+
+// ReconnectNow drops the backoff so the next attempt happens at once.
+func (a *BackendAdapter) ReconnectNow() {
+	a.mu.Lock()
+	if a.retry.connected || a.retry.attempting {
+		a.mu.Unlock()
+		return
+	}
+	reset := a.resetRetryLocked()
+	a.mu.Unlock()
+	a.signalWake()
+	if reset {
+		a.notifyFailures()
+	}
+}
+
+// TrackFailures seeds the failure count and registers fn for changes.
+func (a *BackendAdapter) TrackFailures(count int, fn func(int)) {
+	a.mu.Lock()
+	a.onFailures = fn
+	if !a.retry.connected && count > a.retry.failures {
+		a.retry.failures = count
+		if count >= breakerThreshold {
+			a.retry.breaker = BreakerOpen
+		}
+	}
+	a.mu.Unlock()
+}
+
+// resetRetryLocked clears the failure streak and reports whether there was
+// one.
+func (a *BackendAdapter) resetRetryLocked() bool {
+	had := a.retry.failures > 0
+	a.retry.failures = 0
+	a.retry.lastErr = ""
+	a.retry.next = time.Time{}
+	a.retry.breaker = BreakerClosed
+	return had
+}
+
+func (a *BackendAdapter) signalWake() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyFailures hands the current failure count to the registered hook.
+// The hook persists it, which reconfigures this adapter, so it runs on its
+// own goroutine; notifyMu keeps the last write the latest count.
+func (a *BackendAdapter) notifyFailures() {
+	go func() {
+		a.notifyMu.Lock()
+		defer a.notifyMu.Unlock()
+		a.mu.Lock()
+		fn := a.onFailures
+		n := a.retry.failures
+		a.mu.Unlock()
+		if fn != nil {
+			fn(n)
+		}
+	}()
+}
+
+// waitForAttempt blocks until the next attempt is due, returning false once
+// ctx ends. A wake re-reads the schedule, which ReconnectNow has cleared.
+func (a *BackendAdapter) waitForAttempt(ctx context.Context) bool {
+	for {
+		a.mu.Lock()
+		next := a.retry.next
+		a.mu.Unlock()
+		wait := time.Until(next)
+		if wait <= 0 {
+			return ctx.Err() == nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-a.wake:
+			timer.Stop()
+		case <-timer.C:
+			return ctx.Err() == nil
+		}
+	}
+}
+
+// beginAttempt marks an attempt in flight; past an open breaker's backoff
+// that attempt is the single half-open probe.
+func (a *BackendAdapter) beginAttempt() {
+	a.mu.Lock()
+	a.retry.attempting = true
+	a.retry.lastAttempt = time.Now()
+	if a.retry.breaker == BreakerOpen {
+		a.retry.breaker = BreakerHalfOpen
+	}
+	a.mu.Unlock()
+	// The attempt uses the current configuration; an earlier wake is moot.
+	select {
+	case <-a.wake:
+	default:
+	}
+}
+
+func (a *BackendAdapter) recordFailure(err error) {
+	a.mu.Lock()
+	a.retry.attempting = false
+	a.retry.connected = false
+	a.retry.failures++
+	a.retry.lastErr = err.Error()
+	delay := backoffDelay(a.retry.failures, a.backoffBase, a.jitter())
+	a.retry.next = time.Now().Add(delay)
+	if a.retry.failures >= breakerThreshold {
+		a.retry.breaker = BreakerOpen
+	} else {
+		a.retry.breaker = BreakerClosed
+	}
+	failures := a.retry.failures
+	a.mu.Unlock()
+
+	log.Printf("WARN: nexus tunnel failed to connect (%d in a row): %v; next attempt in %s", failures, err, delay.Round(time.Second))
+	a.notifyFailures()
+}
+
+func (a *BackendAdapter) recordSuccess() {
+	a.mu.Lock()
+	a.retry.attempting = false
+	a.retry.connected = true
+	a.retry.lastErr = ""
+	reset := a.resetRetryLocked()
+	a.mu.Unlock()
+	if reset {
+		log.Printf("INFO: nexus tunnel endpoint reachable again")
+		a.notifyFailures()
+	}
+}
+
+// probe checks that the Nexus endpoint accepts connections.
+func (a *BackendAdapter) probe(ctx context.Context) error {
+	addr, err := endpointAddress(a.currentConfig().Endpoint)
+	if err != nil {
+		return err
+	}
+	dctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	conn, err := a.dial(dctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// run connects whenever the schedule allows: probe the endpoint, then hand
+// the connection to the upstream client until a probe fails or the
+// configuration changes.
+func (a *BackendAdapter) run(ctx context.Context, client backendClient, clientCfg Config, done chan struct{}) {
+	defer close(done)
+	for {
+		if !a.waitForAttempt(ctx) {
+			return
+		}
+		a.beginAttempt()
+		if err := a.probe(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.recordFailure(err)
+			continue
+		}
+		if cfg := a.currentConfig(); client == nil || cfg != clientCfg {
+			var err error
+			if client, err = a.newClient(cfg); err != nil {
+				a.recordFailure(err)
+				continue
+			}
+			clientCfg = cfg
+		}
+		a.recordSuccess()
+		if !a.serve(ctx, client) {
+			return
+		}
+		// The upstream client is not reused once stopped.
+		client = nil
+	}
+}
+
+// serve runs client while probes keep succeeding. It reports false once ctx
+// ends and true when the adapter should connect again.
+func (a *BackendAdapter) serve(ctx context.Context, client backendClient) bool {
+	runCtx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.client = client
+	a.mu.Unlock()
+	go client.Start(runCtx)
+	defer func() {
+		cancel()
+		client.Stop()
+		a.mu.Lock()
+		a.client = nil
+		a.retry.connected = false
+		a.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(a.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-a.wake:
+			log.Printf("INFO: nexus tunnel reconnecting with the new configuration")
+			return true
+		case <-ticker.C:
+			if err := a.probe(ctx); err != nil {
+				if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+					return false
+				}
+				a.recordFailure(err)
+				return true
+			}
+		}
+	}
+}
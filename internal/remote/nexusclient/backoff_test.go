@@ -0,0 +1,277 @@
+package nexusclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	backend "github.com/AtDexters-Lab/nexus-proxy-backend-client/client"
+)
+
+// fakeDial fails the first failures calls, then succeeds. With hold set,
+// calls after the failures block until it is closed.
+type fakeDial struct {
+	mu       sync.Mutex
+	calls    []time.Time
+	failures int
+	hold     chan struct{}
+}
+
+func (f *fakeDial) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, time.Now())
+	fail := len(f.calls) <= f.failures
+	hold := f.hold
+	f.mu.Unlock()
+	if fail {
+		return nil, errors.New("connection refused")
+	}
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return c1, nil
+}
+
+func (f *fakeDial) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+func (f *fakeDial) gaps() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []time.Duration
+	for i := 1; i < len(f.calls); i++ {
+		out = append(out, f.calls[i].Sub(f.calls[i-1]))
+	}
+	return out
+}
+
+// newBackoffAdapter returns a configured adapter dialing through dial, with
+// jitter pinned to the midpoint so waits are exactly base * 2^n.
+func newBackoffAdapter(t *testing.T, dial *fakeDial, base time.Duration) (*BackendAdapter, chan struct{}) {
+	t.Helper()
+	adapter := NewBackendAdapter(nil, nil)
+	adapter.dial = dial.dial
+	adapter.jitter = func() float64 { return 0.5 }
+	adapter.backoffBase = base
+	adapter.healthInterval = time.Hour
+	started := make(chan struct{}, 8)
+	adapter.factory = func(backend.ClientBackendConfig, backend.ConnectHandler) (backendClient, error) {
+		return &fakeClient{start: func(context.Context) { started <- struct{}{} }}, nil
+	}
+	if err := adapter.Configure(Config{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	t.Cleanup(func() { _ = adapter.Stop(context.Background()) })
+	return adapter, started
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestBackoffDelaySchedule(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		0:  0,
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		8:  128 * time.Second,
+		9:  256 * time.Second,
+		10: maxBackoff,
+		50: maxBackoff,
+	} {
+		if got := backoffDelay(failures, time.Second, 0.5); got != want {
+			t.Fatalf("%d failures: %s, want %s", failures, got, want)
+		}
+	}
+	// Jitter stays within ±20% and never passes the cap.
+	if got := backoffDelay(3, time.Second, 0); got != 3200*time.Millisecond {
+		t.Fatalf("low jitter: %s", got)
+	}
+	if got := backoffDelay(3, time.Second, 0.999); got <= 4*time.Second || got > 4800*time.Millisecond {
+		t.Fatalf("high jitter: %s", got)
+	}
+	if got := backoffDelay(20, time.Second, 0.999); got != maxBackoff {
+		t.Fatalf("jitter above the cap: %s", got)
+	}
+}
+
+func TestAdapterBacksOffThenConnects(t *testing.T) {
+	dial := &fakeDial{failures: 3}
+	adapter, started := newBackoffAdapter(t, dial, 40*time.Millisecond)
+
+	var mu sync.Mutex
+	var reported []int
+	adapter.TrackFailures(0, func(n int) {
+		mu.Lock()
+		reported = append(reported, n)
+		mu.Unlock()
+	})
+
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("client never started")
+	}
+
+	if n := dial.count(); n != 4 {
+		t.Fatalf("dialed %d times, want 3 failures and a success", n)
+	}
+	for i, gap := range dial.gaps() {
+		want := 40 * time.Millisecond << i
+		if gap < want {
+			t.Fatalf("attempt %d came after %s, want at least %s", i+2, gap, want)
+		}
+	}
+	st := adapter.Stats()
+	if !st.Connected || st.Breaker != BreakerClosed || st.ConsecutiveFailures != 0 || st.NextAttempt != nil {
+		t.Fatalf("unexpected stats after connecting: %+v", st)
+	}
+	waitFor(t, "failure count reset", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) > 0 && reported[len(reported)-1] == 0
+	})
+}
+
+func TestAdapterReconnectNowSkipsBackoff(t *testing.T) {
+	dial := &fakeDial{failures: 1}
+	adapter, started := newBackoffAdapter(t, dial, time.Hour)
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitFor(t, "first failure", func() bool { return adapter.Stats().ConsecutiveFailures == 1 })
+	st := adapter.Stats()
+	if st.NextAttempt == nil || time.Until(*st.NextAttempt) < 4*time.Minute {
+		t.Fatalf("expected the next attempt at the cap: %+v", st)
+	}
+	if st.LastError != "connection refused" {
+		t.Fatalf("last error = %q", st.LastError)
+	}
+
+	adapter.ReconnectNow()
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("reconnect-now did not connect")
+	}
+	if n := dial.count(); n != 2 {
+		t.Fatalf("dialed %d times", n)
+	}
+}
+
+func TestAdapterHalfOpenProbesOnce(t *testing.T) {
+	dial := &fakeDial{failures: breakerThreshold, hold: make(chan struct{})}
+	adapter, started := newBackoffAdapter(t, dial, 5*time.Millisecond)
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// After the threshold the breaker opens; once the wait runs out one
+	// probe goes out and the breaker is half-open while it runs.
+	waitFor(t, "half-open probe", func() bool { return dial.count() == breakerThreshold+1 })
+	if st := adapter.Stats(); st.Breaker != BreakerHalfOpen {
+		t.Fatalf("breaker %q during the probe, want half-open", st.Breaker)
+	}
+	for i := 0; i < 3; i++ {
+		adapter.ReconnectNow()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := dial.count(); n != breakerThreshold+1 {
+		t.Fatalf("%d probes while half-open, want one", n-breakerThreshold)
+	}
+
+	close(dial.hold)
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("client never started after the probe succeeded")
+	}
+	if st := adapter.Stats(); st.Breaker != BreakerClosed || !st.Connected {
+		t.Fatalf("unexpected stats after the probe: %+v", st)
+	}
+}
+
+func TestAdapterKeepsBackoffAcrossRestart(t *testing.T) {
+	dial := &fakeDial{failures: 1}
+	adapter, started := newBackoffAdapter(t, dial, time.Hour)
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitFor(t, "first failure", func() bool { return adapter.Stats().ConsecutiveFailures == 1 })
+
+	// Reapplying the same endpoint, as a config save does, keeps waiting.
+	cfg := adapter.currentConfig()
+	_ = adapter.Stop(context.Background())
+	cfg.TLD = "example.com"
+	_ = adapter.Configure(cfg)
+	if err := adapter.Start(context.Background()); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n, st := dial.count(), adapter.Stats(); n != 1 || st.ConsecutiveFailures != 1 {
+		t.Fatalf("restart dropped the backoff: %d dials, %+v", n, st)
+	}
+
+	// A new endpoint starts over.
+	cfg.Endpoint = "wss://nexus2.example.com/connect"
+	_ = adapter.Configure(cfg)
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("new endpoint was not tried at once")
+	}
+	if st := adapter.Stats(); st.ConsecutiveFailures != 0 {
+		t.Fatalf("failures not reset for a new endpoint: %+v", st)
+	}
+}
+
+func TestTrackFailuresSeedsCount(t *testing.T) {
+	adapter := NewBackendAdapter(nil, nil)
+	adapter.TrackFailures(12, nil)
+	st := adapter.Stats()
+	if st.ConsecutiveFailures != 12 || st.Breaker != BreakerOpen || st.NextAttempt != nil {
+		t.Fatalf("unexpected seeded stats: %+v", st)
+	}
+}
+
+func TestEndpointAddress(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"wss://nexus.example.com/connect":      "nexus.example.com:443",
+		"ws://nexus.example.com/connect":       "nexus.example.com:80",
+		"wss://nexus.example.com:8443/connect": "nexus.example.com:8443",
+	} {
+		if got, err := endpointAddress(endpoint); err != nil || got != want {
+			t.Fatalf("%s: %q, %v", endpoint, got, err)
+		}
+	}
+	if _, err := endpointAddress("nexus.example.com"); err == nil {
+		t.Fatalf("expected an error for an endpoint without scheme")
+	}
+}
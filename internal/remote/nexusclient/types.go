@@ -1,6 +1,9 @@
 package nexusclient
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Config represents the minimum information needed to connect to the nexus proxy.
 type Config struct {
@@ -22,6 +25,16 @@ type RemoteResolver interface {
 	Resolve(hostname string, remotePort int, isTLS bool) (int, bool)
 }
 
+// ConnectionHintRecorder is an optional resolver extension told the source
+// port of each connection dialed to a local listener, so the listener can
+// recover the original remote port, TLS state and client address (empty
+// when Nexus did not report one). ForgetConnectionHint is called once that
+// connection closes.
+type ConnectionHintRecorder interface {
+	RecordConnectionHint(localPort, sourcePort, remotePort int, isTLS bool, clientIP string)
+	ForgetConnectionHint(localPort, sourcePort int)
+}
+
 // PortController is an optional extension. Implementers may choose to take
 // explicit action when a local public port is no longer available (e.g.,
 // proactively refuse or unregister routes).
@@ -34,3 +47,46 @@ type PortController interface {
 type PortPublisher interface {
 	RegisterPublicPort(port int)
 }
+
+// PortMappingSource is an optional resolver extension listing additional
+// remote ports (beyond 80/443) that should be forwarded to local ports,
+// keyed by remote port.
+type PortMappingSource interface {
+	RemotePortMappings() map[int]int
+}
+
+// BreakerState is the adapter's circuit breaker state.
+type BreakerState string
+
+const (
+	// BreakerClosed: connected, or retrying after only a few failures.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen: enough attempts failed that the adapter waits out the
+	// backoff before trying again.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen: the backoff ran out and a single probe is deciding
+	// whether to close the breaker or open it again.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// Stats reports the adapter's connection and its retry schedule.
+type Stats struct {
+	Connected           bool         `json:"connected"`
+	Breaker             BreakerState `json:"breaker"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastAttempt         *time.Time   `json:"last_attempt,omitempty"`
+	NextAttempt         *time.Time   `json:"next_attempt,omitempty"`
+}
+
+// Reconnector is an optional Adapter extension for adapters that back off
+// between failed connection attempts.
+type Reconnector interface {
+	Stats() Stats
+	// ReconnectNow drops the backoff and tries to connect at once. It does
+	// nothing while connected or while a half-open probe is in flight.
+	ReconnectNow()
+	// TrackFailures seeds the consecutive failure count, e.g. from before a
+	// restart, and reports every later change of it to fn.
+	TrackFailures(count int, fn func(int))
+}
@@ -0,0 +1,186 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// preflightTimeoutEnv overrides how long a whole preflight run may take, as a
+// Go duration such as "20s".
+const preflightTimeoutEnv = "PICCOLO_REMOTE_PREFLIGHT_TIMEOUT"
+
+const (
+	defaultPreflightTimeout = 15 * time.Second
+	// dnsCheckTimeout bounds the lookups of the DNS check.
+	dnsCheckTimeout = 5 * time.Second
+)
+
+// preflightStatusTimeout is the status of a check that ran out of time
+// before it could pass or fail.
+const preflightStatusTimeout = "timeout"
+
+// preflightTimeoutFromEnv returns the preflight ceiling, preflightTimeoutEnv
+// or the default.
+func preflightTimeoutFromEnv() time.Duration {
+	v := strings.TrimSpace(os.Getenv(preflightTimeoutEnv))
+	if v == "" {
+		return defaultPreflightTimeout
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("WARN: remote: ignoring %s=%q; using %s", preflightTimeoutEnv, v, defaultPreflightTimeout)
+		return defaultPreflightTimeout
+	}
+	return d
+}
+
+// timedOutCheck reports a check cut short by ctx.
+func timedOutCheck(ctx context.Context, name string) PreflightCheck {
+	detail := "No answer before the time limit"
+	if errors.Is(ctx.Err(), context.Canceled) {
+		detail = "Canceled"
+	}
+	return PreflightCheck{Name: name, Status: preflightStatusTimeout, Detail: detail, NextStep: "Run preflight again; if it keeps timing out, check the device's network and DNS"}
+}
+
+// RunPreflight performs validation checks for the remote configuration.
+// Each check has its own budget and the run as a whole is bounded by the
+// preflight timeout; checks that run out of time are reported with status
+// "timeout" next to the ones that finished. When ctx itself is canceled the
+// run stops and returns ctx's error without recording anything.
+func (m *Manager) RunPreflight(ctx context.Context) (PreflightResult, error) {
+	cfg := m.currentConfig()
+	if cfg.Endpoint == "" || cfg.TLD == "" || cfg.PortalHostname == "" {
+		return PreflightResult{}, errors.New("remote not configured")
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, m.preflightTimeout)
+	defer cancel()
+
+	now := m.now()
+	var checks []PreflightCheck
+
+	probe := m.checkEndpoint(ctx, cfg.Endpoint)
+	checks = append(checks, probe.Check)
+
+	checks = append(checks, m.checkDNS(ctx, cfg))
+
+	checks = append(checks, PreflightCheck{Name: "ACME solver", Status: "pass", Detail: fmt.Sprintf("Using %s", strings.ToUpper(cfg.Solver))})
+	if cfg.Solver == "http-01" && m.http01Check != nil {
+		checks = append(checks, m.checkHTTP01Listener())
+	}
+
+	if len(cfg.Aliases) > 0 {
+		checks = append(checks, m.checkAliases(ctx, cfg))
+	}
+
+	if err := parent.Err(); err != nil {
+		return PreflightResult{}, err
+	}
+
+	evt := Event{Timestamp: now, Level: "info", Source: "remote", Message: "Preflight completed"}
+	for _, check := range checks {
+		if check.Status == preflightStatusTimeout {
+			evt.Level, evt.Message = "warn", "Preflight completed; some checks timed out"
+			break
+		}
+	}
+	err := m.update(func(cfg *Config) error {
+		if probe.Check.Status == "pass" {
+			cfg.LastHandshake = now
+			cfg.LatencyMS = int(probe.Latency.Milliseconds())
+		}
+		cfg.LastPreflight = &now
+		m.appendEvent(cfg, evt)
+		return nil
+	})
+	if err != nil {
+		return PreflightResult{}, err
+	}
+	return PreflightResult{Checks: checks, RanAt: now}, nil
+}
+
+// checkAliases reports alias verification and looks up every name an alias
+// answers for, the www variant included.
+func (m *Manager) checkAliases(ctx context.Context, cfg *Config) PreflightCheck {
+	const name = "Alias coverage"
+	ctx, cancel := context.WithTimeout(ctx, dnsCheckTimeout)
+	defer cancel()
+
+	status := "pass"
+	detail := "All aliases verified"
+	var unresolved []string
+	for _, alias := range cfg.Aliases {
+		if alias.Status != "active" {
+			status = "warn"
+			detail = "One or more aliases pending verification"
+		}
+		for _, host := range alias.Names() {
+			if _, err := m.resolver.LookupHost(ctx, host); err != nil {
+				unresolved = append(unresolved, host)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return timedOutCheck(ctx, name)
+	}
+	if len(unresolved) > 0 {
+		status = "warn"
+		detail = detail + "; unresolved: " + strings.Join(unresolved, ", ")
+	}
+	return PreflightCheck{Name: name, Status: status, Detail: detail}
+}
+
+func (m *Manager) checkDNS(ctx context.Context, cfg *Config) PreflightCheck {
+	const name = "DNS records"
+	host := cfg.PortalHostname
+	if host == "" {
+		return PreflightCheck{Name: name, Status: "fail", Detail: "portal hostname not configured"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsCheckTimeout)
+	defer cancel()
+
+	cname, cnameErr := m.resolver.LookupCNAME(ctx, host)
+	addresses, addrErr := m.resolver.LookupHost(ctx, host)
+
+	detail := fmt.Sprintf("%s resolves to %v", host, addresses)
+	if cnameErr == nil && cname != "" {
+		detail = fmt.Sprintf("%s CNAME %s", host, strings.TrimSuffix(cname, "."))
+	}
+
+	status := "pass"
+	if addrErr != nil {
+		status = "warn"
+		detail = fmt.Sprintf("portal host lookup failed: %v", addrErr)
+	}
+
+	if cfg.TLD != "" && cfg.PortalHostname != cfg.TLD {
+		sample := fmt.Sprintf("app.%s", cfg.TLD)
+		if _, err := m.resolver.LookupHost(ctx, sample); err != nil {
+			status = "warn"
+			detail = detail + "; wildcard host unresolved"
+		} else {
+			detail = detail + "; wildcard host resolves"
+		}
+	}
+	if ctx.Err() != nil {
+		return timedOutCheck(ctx, name)
+	}
+	return PreflightCheck{Name: name, Status: status, Detail: detail}
+}
+
+// checkHTTP01Listener reports whether port 80 is ours to answer http-01
+// challenges on.
+func (m *Manager) checkHTTP01Listener() PreflightCheck {
+	const name = "HTTP-01 listener"
+	if err := m.http01Check(); err != nil {
+		return PreflightCheck{Name: name, Status: "fail", Detail: err.Error(), NextStep: "Free port 80 or point PICCOLO_ACME_HTTP_PORT at a port forwarded from 80, then restart piccolod"}
+	}
+	return PreflightCheck{Name: name, Status: "pass", Detail: "Port 80 answers ACME challenges"}
+}
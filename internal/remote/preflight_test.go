@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// blockingDialer and blockingResolver never answer; they return only when
+// their context ends.
+type blockingDialer struct{}
+
+func (blockingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type blockingResolver struct{}
+
+func (blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func newPreflightTestManager(t *testing.T, d dialer, r resolver) *Manager {
+	t.Helper()
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	dir, err := os.MkdirTemp("", "remote-preflight")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, d, r, fixedNow(time.Unix(20, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	err = m.Configure(ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+	})
+	if err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	return m
+}
+
+func TestRunPreflightReportsTimeoutsWithinBudget(t *testing.T) {
+	m := newPreflightTestManager(t, blockingDialer{}, blockingResolver{})
+	m.preflightTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	result, err := m.RunPreflight(context.Background())
+	if err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("preflight took %s with a 200ms budget", elapsed)
+	}
+	want := map[string]string{
+		"Nexus endpoint reachable": preflightStatusTimeout,
+		"DNS records":              preflightStatusTimeout,
+		"ACME solver":              "pass",
+	}
+	if len(result.Checks) != len(want) {
+		t.Fatalf("checks = %+v", result.Checks)
+	}
+	for _, check := range result.Checks {
+		if check.Status != want[check.Name] {
+			t.Fatalf("check %q: status %q, want %q", check.Name, check.Status, want[check.Name])
+		}
+	}
+	cfg := m.currentConfig()
+	if cfg.LastPreflight == nil || !cfg.LastHandshake.IsZero() {
+		t.Fatalf("preflight not recorded as run without a handshake: %+v", cfg)
+	}
+	if evt := cfg.Events[len(cfg.Events)-1]; evt.Level != "warn" {
+		t.Fatalf("timed out preflight logged as %+v", evt)
+	}
+}
+
+func TestRunPreflightStopsWhenCanceled(t *testing.T) {
+	m := newPreflightTestManager(t, blockingDialer{}, blockingResolver{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := m.RunPreflight(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("canceled preflight took %s", elapsed)
+	}
+	if m.currentConfig().LastPreflight != nil {
+		t.Fatalf("canceled preflight was recorded")
+	}
+}
+
+func TestPreflightTimeoutFromEnv(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      defaultPreflightTimeout,
+		"20s":   20 * time.Second,
+		"bogus": defaultPreflightTimeout,
+		"-1s":   defaultPreflightTimeout,
+	} {
+		t.Setenv(preflightTimeoutEnv, value)
+		if got := preflightTimeoutFromEnv(); got != want {
+			t.Fatalf("%s=%q: got %s, want %s", preflightTimeoutEnv, value, got, want)
+		}
+	}
+}
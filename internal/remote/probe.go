@@ -0,0 +1,226 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeURLEnv overrides the outside prober, which otherwise is the Nexus
+// helper behind the configured endpoint.
+const probeURLEnv = "PICCOLO_REMOTE_PROBE_URL"
+
+// ProbeTokenHeader carries the probe token on the prober's request to the
+// portal; the device echoes it back when the token is live.
+const ProbeTokenHeader = "X-Piccolo-Probe-Token"
+
+const (
+	// probeTokenTTL bounds how long the portal answers for a probe token.
+	probeTokenTTL = 60 * time.Second
+	// probeTimeout bounds the whole round trip through the prober.
+	probeTimeout = 30 * time.Second
+	// probePath is where the prober fetches the portal.
+	probePath = "/api/v1/health/live"
+)
+
+// ProbeResult is the outcome of an outside-in fetch of the portal.
+type ProbeResult struct {
+	URL        string    `json:"url"`
+	RanAt      time.Time `json:"ran_at"`
+	Reachable  bool      `json:"reachable"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMS  int       `json:"latency_ms,omitempty"`
+	TLSIssuer  string    `json:"tls_issuer,omitempty"`
+	ResolvedIP string    `json:"resolved_ip,omitempty"`
+	// Correlated is set when this device answered the prober's request,
+	// rather than whatever else the hostname points at.
+	Correlated bool   `json:"correlated"`
+	Error      string `json:"error,omitempty"`
+}
+
+// proberRequest is sent to the prober. It only ever names this device's
+// portal, so the prober cannot be steered at arbitrary hosts from here.
+type proberRequest struct {
+	URL    string `json:"url"`
+	Header string `json:"header"`
+	Token  string `json:"token"`
+}
+
+// proberResponse is what the prober observed fetching proberRequest.URL.
+type proberResponse struct {
+	StatusCode int    `json:"status_code"`
+	LatencyMS  int    `json:"latency_ms"`
+	TLSIssuer  string `json:"tls_issuer"`
+	ResolvedIP string `json:"resolved_ip"`
+	Error      string `json:"error"`
+}
+
+// probeTokens holds the token of the probe in flight.
+type probeTokens struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	seen    bool
+}
+
+func (p *probeTokens) issue(now time.Time) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate probe token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	p.mu.Lock()
+	p.token, p.expires, p.seen = token, now.Add(probeTokenTTL), false
+	p.mu.Unlock()
+	return token, nil
+}
+
+func (p *probeTokens) observe(token string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == "" || token == "" || now.After(p.expires) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		return false
+	}
+	p.seen = true
+	return true
+}
+
+// finish retires token and reports whether the portal saw it.
+func (p *probeTokens) finish(token string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != token {
+		return false
+	}
+	seen := p.seen
+	p.token, p.seen = "", false
+	return seen
+}
+
+// ObserveProbeToken records that the portal served a request carrying the
+// live probe token. It reports whether the token matched.
+func (m *Manager) ObserveProbeToken(token string) bool {
+	return m.probeTokens.observe(strings.TrimSpace(token), m.now())
+}
+
+// proberURL returns where probe requests go: probeURLEnv when set,
+// otherwise /probe on the Nexus endpoint host.
+func (m *Manager) proberURL(cfg *Config) (string, error) {
+	if m.probeURL != "" {
+		return m.probeURL, nil
+	}
+	u, err := parseEndpoint(cfg.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	scheme := "https"
+	if u.Scheme == "ws" {
+		scheme = "http"
+	}
+	return (&url.URL{Scheme: scheme, Host: u.Host, Path: "/probe"}).String(), nil
+}
+
+// RunProbe asks the outside prober to fetch the portal's liveness endpoint
+// and stores the result, which feeds Status warnings.
+func (m *Manager) RunProbe(ctx context.Context) (ProbeResult, error) {
+	cfg := m.currentConfig()
+	if !cfg.Enabled || cfg.PortalHostname == "" {
+		return ProbeResult{}, errors.New("remote not configured")
+	}
+	prober, err := m.proberURL(cfg)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	now := m.now()
+	result := ProbeResult{
+		URL:   (&url.URL{Scheme: "https", Host: cfg.PortalHostname, Path: probePath}).String(),
+		RanAt: now,
+	}
+	token, err := m.probeTokens.issue(now)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	observed, probeErr := m.callProber(ctx, prober, proberRequest{URL: result.URL, Header: ProbeTokenHeader, Token: token})
+	result.Correlated = m.probeTokens.finish(token)
+	switch {
+	case probeErr != nil:
+		result.Error = fmt.Sprintf("prober unavailable: %v", probeErr)
+	default:
+		result.StatusCode = observed.StatusCode
+		result.LatencyMS = observed.LatencyMS
+		result.TLSIssuer = observed.TLSIssuer
+		result.ResolvedIP = observed.ResolvedIP
+		result.Error = observed.Error
+		switch {
+		case result.Error != "":
+		case result.StatusCode != http.StatusOK:
+			result.Error = fmt.Sprintf("portal answered %d", result.StatusCode)
+		case !result.Correlated:
+			result.Error = "portal hostname answered, but not from this device"
+		default:
+			result.Reachable = true
+		}
+	}
+
+	evt := Event{Timestamp: now, Level: "info", Source: "remote", Message: fmt.Sprintf("Portal reachable from the internet (%d ms)", result.LatencyMS)}
+	if !result.Reachable {
+		evt.Level = "warn"
+		evt.Message = "Portal unreachable from the internet: " + result.Error
+		evt.NextStep = "Check the DNS records and that the Nexus host forwards ports 80 and 443."
+	}
+	err = m.update(func(cfg *Config) error {
+		cfg.LastProbe = cloneProbe(&result)
+		m.appendEvent(cfg, evt)
+		return nil
+	})
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	return result, nil
+}
+
+func (m *Manager) callProber(ctx context.Context, prober string, req proberRequest) (proberResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	body, err := json.Marshal(req)
+	if err != nil {
+		return proberResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, prober, bytes.NewReader(body))
+	if err != nil {
+		return proberResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	client := m.probeClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return proberResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return proberResponse{}, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out proberResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return proberResponse{}, fmt.Errorf("decode prober response: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProber stands in for the outside prober. When answer is set it
+// "fetches" the portal by presenting the token to the device.
+func fakeProber(t *testing.T, m *Manager, answer bool, seen *proberRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req proberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*seen = req
+		if answer && !m.ObserveProbeToken(req.Token) {
+			t.Errorf("device rejected its own probe token")
+		}
+		_ = json.NewEncoder(w).Encode(proberResponse{StatusCode: 200, LatencyMS: 42, TLSIssuer: "R11", ResolvedIP: "203.0.113.7"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestManager_RunProbe(t *testing.T) {
+	dir, err := os.MkdirTemp("", "remote-probe")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(5, 0)))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+
+	if _, err := m.RunProbe(context.Background()); err == nil {
+		t.Fatalf("probe before configure should fail")
+	}
+	if err := m.Configure(ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if got, _ := m.proberURL(m.currentConfig()); got != "https://nexus.example.com/probe" {
+		t.Fatalf("default prober url = %q", got)
+	}
+
+	var seen proberRequest
+	m.probeURL = fakeProber(t, m, true, &seen).URL
+	res, err := m.RunProbe(context.Background())
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if seen.URL != "https://portal.example.com/api/v1/health/live" || seen.Header != ProbeTokenHeader {
+		t.Fatalf("prober asked to fetch %+v", seen)
+	}
+	if !res.Reachable || !res.Correlated || res.StatusCode != 200 || res.LatencyMS != 42 || res.TLSIssuer != "R11" || res.ResolvedIP != "203.0.113.7" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	// The token dies with the probe.
+	if m.ObserveProbeToken(seen.Token) {
+		t.Fatalf("probe token still accepted after the probe")
+	}
+	st := m.Status()
+	if st.LastProbe == nil || !st.LastProbe.Reachable {
+		t.Fatalf("status missing probe: %+v", st.LastProbe)
+	}
+	for _, w := range st.Warnings {
+		if strings.Contains(w, "unreachable") {
+			t.Fatalf("unexpected warning %q", w)
+		}
+	}
+
+	// Something answered for the hostname, but not this device.
+	m.probeURL = fakeProber(t, m, false, &seen).URL
+	res, err = m.RunProbe(context.Background())
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if res.Reachable || res.Correlated {
+		t.Fatalf("uncorrelated answer counted as reachable: %+v", res)
+	}
+	found := false
+	for _, w := range m.Status().Warnings {
+		found = found || strings.Contains(w, "Portal unreachable from the internet")
+	}
+	if !found {
+		t.Fatalf("missing unreachable warning: %v", m.Status().Warnings)
+	}
+
+	// A failing prober is reported, and the result survives a reload.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	m.probeURL = down.URL
+	if res, err = m.RunProbe(context.Background()); err != nil || !strings.Contains(res.Error, "prober unavailable") {
+		t.Fatalf("expected prober failure, got %+v err=%v", res, err)
+	}
+	reloaded, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(time.Unix(6, 0)))
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	t.Cleanup(func() { _ = reloaded.Close(context.Background()) })
+	if lp := reloaded.Status().LastProbe; lp == nil || !strings.Contains(lp.Error, "overloaded") {
+		t.Fatalf("last probe not persisted: %+v", lp)
+	}
+}
@@ -0,0 +1,337 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CertStatusDeferred marks a certificate whose issuance would exceed the
+// CA's rate limits. It is ordered by the renewal scheduler once
+// DeferredUntil has passed.
+const CertStatusDeferred = "deferred"
+
+// Issuance outcomes recorded in the ledger.
+const (
+	IssuanceIssued = "issued"
+	IssuanceFailed = "failed"
+)
+
+// Usage limit kinds reported by IssuanceUsage.
+const (
+	LimitRegisteredDomain = "registered_domain"
+	LimitDuplicate        = "duplicate"
+)
+
+// certsPerDomainEnv and duplicateCertsEnv override how many certificates
+// may be issued per registered domain, and for the same set of names, in a
+// week. Let's Encrypt allows 50 and 5.
+const (
+	certsPerDomainEnv = "PICCOLO_REMOTE_CERTS_PER_DOMAIN"
+	duplicateCertsEnv = "PICCOLO_REMOTE_DUPLICATE_CERTS"
+)
+
+const (
+	defaultCertsPerDomain = 50
+	defaultDuplicateCerts = 5
+	issuanceLimitWindow   = 7 * 24 * time.Hour
+)
+
+// IssuanceLimits mirrors the CA's policy on certificates issued per
+// registered domain and for an identical set of names.
+type IssuanceLimits struct {
+	PerRegisteredDomain int
+	PerDomainWindow     time.Duration
+	Duplicate           int
+	DuplicateWindow     time.Duration
+}
+
+// DefaultIssuanceLimits returns the Let's Encrypt production limits.
+func DefaultIssuanceLimits() IssuanceLimits {
+	return IssuanceLimits{
+		PerRegisteredDomain: defaultCertsPerDomain,
+		PerDomainWindow:     issuanceLimitWindow,
+		Duplicate:           defaultDuplicateCerts,
+		DuplicateWindow:     issuanceLimitWindow,
+	}
+}
+
+// issuanceLimitsFromEnv returns the default limits with the counts from
+// certsPerDomainEnv and duplicateCertsEnv.
+func issuanceLimitsFromEnv() IssuanceLimits {
+	limits := DefaultIssuanceLimits()
+	limits.PerRegisteredDomain = positiveIntFromEnv(certsPerDomainEnv, defaultCertsPerDomain)
+	limits.Duplicate = positiveIntFromEnv(duplicateCertsEnv, defaultDuplicateCerts)
+	return limits
+}
+
+func positiveIntFromEnv(name string, def int) int {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("WARN: remote: ignoring %s=%q; using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// longestWindow is how long ledger records are kept.
+func (l IssuanceLimits) longestWindow() time.Duration {
+	if l.DuplicateWindow > l.PerDomainWindow {
+		return l.DuplicateWindow
+	}
+	return l.PerDomainWindow
+}
+
+// IssuanceRecord is one issuance attempt in the ledger kept to stay under
+// the CA's rate limits.
+type IssuanceRecord struct {
+	At     time.Time `json:"at"`
+	CertID string    `json:"cert_id"`
+	// DomainsHash identifies the set of names, regardless of order or case.
+	DomainsHash       string   `json:"domains_hash"`
+	RegisteredDomains []string `json:"registered_domains"`
+	Outcome           string   `json:"outcome"`
+}
+
+// IssuanceUsage is how much of one rate limit window is used. Key is the
+// registered domain, or the certificate ID for duplicate limits.
+type IssuanceUsage struct {
+	Limit         string `json:"limit"`
+	Key           string `json:"key"`
+	Used          int    `json:"used"`
+	Max           int    `json:"max"`
+	WindowSeconds int64  `json:"window_seconds"`
+	// ResetsAt is when the oldest issuance counted leaves the window.
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// domainsHash returns the hash identifying a set of names.
+func domainsHash(domains []string) string {
+	names := make([]string, 0, len(domains))
+	seen := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		names = append(names, d)
+	}
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, ",")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// registeredDomains returns the registered domains (eTLD+1) the names fall
+// under; a name without one counts as its own.
+func registeredDomains(domains []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), ".")), "*.")
+		if d == "" {
+			continue
+		}
+		reg, err := publicsuffix.EffectiveTLDPlusOne(d)
+		if err != nil {
+			reg = d
+		}
+		if !seen[reg] {
+			seen[reg] = true
+			out = append(out, reg)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pruneIssuances drops ledger records older than the longest limit window.
+func pruneIssuances(cfg *Config, limits IssuanceLimits, now time.Time) bool {
+	cutoff := now.Add(-limits.longestWindow())
+	kept := cfg.Issuances[:0]
+	for _, r := range cfg.Issuances {
+		if r.At.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	pruned := len(kept) != len(cfg.Issuances)
+	cfg.Issuances = kept
+	return pruned
+}
+
+// issuedWithin returns the times of issued records match selects that fall
+// inside window before now, oldest first.
+func issuedWithin(records []IssuanceRecord, window time.Duration, now time.Time, match func(IssuanceRecord) bool) []time.Time {
+	cutoff := now.Add(-window)
+	var times []time.Time
+	for _, r := range records {
+		if r.Outcome == IssuanceIssued && r.At.After(cutoff) && match(r) {
+			times = append(times, r.At)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// slidesAt returns when enough of times leave window for one more issuance
+// to stay under max; times is sorted and holds at least max entries.
+func slidesAt(times []time.Time, max int, window time.Duration) time.Time {
+	return times[len(times)-max].Add(window)
+}
+
+// issuanceDeferral reports when issuing domains stops exceeding limits,
+// and why; a zero time means it can be issued now.
+func issuanceDeferral(records []IssuanceRecord, domains []string, limits IssuanceLimits, now time.Time) (time.Time, string) {
+	var until time.Time
+	var reason string
+	hash := domainsHash(domains)
+	if limits.Duplicate > 0 {
+		times := issuedWithin(records, limits.DuplicateWindow, now, func(r IssuanceRecord) bool {
+			return r.DomainsHash == hash
+		})
+		if len(times) >= limits.Duplicate {
+			until = slidesAt(times, limits.Duplicate, limits.DuplicateWindow)
+			reason = fmt.Sprintf("%d certificates for the same names issued in the last %s", len(times), limits.DuplicateWindow)
+		}
+	}
+	if limits.PerRegisteredDomain > 0 {
+		for _, reg := range registeredDomains(domains) {
+			times := issuedWithin(records, limits.PerDomainWindow, now, func(r IssuanceRecord) bool {
+				return containsString(r.RegisteredDomains, reg)
+			})
+			if len(times) < limits.PerRegisteredDomain {
+				continue
+			}
+			if at := slidesAt(times, limits.PerRegisteredDomain, limits.PerDomainWindow); at.After(until) {
+				until = at
+				reason = fmt.Sprintf("%d certificates for %s issued in the last %s", len(times), reg, limits.PerDomainWindow)
+			}
+		}
+	}
+	return until, reason
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// deferIssuance checks the ledger before certificate id is ordered. When
+// ordering would exceed a rate limit the entry is marked deferred until the
+// window slides and it reports true.
+func (m *Manager) deferIssuance(id string, domains []string) bool {
+	deferred := false
+	_ = m.update(func(cfg *Config) error {
+		now := m.now()
+		pruned := pruneIssuances(cfg, m.issuanceLimits, now)
+		until, reason := issuanceDeferral(cfg.Issuances, domains, m.issuanceLimits, now)
+		deferred = !until.IsZero()
+		if !deferred {
+			if !pruned {
+				return errNoChange
+			}
+			return nil
+		}
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == id {
+				cfg.Certificates[i].Status = CertStatusDeferred
+				cfg.Certificates[i].DeferredUntil = timePtr(until)
+				break
+			}
+		}
+		m.appendEvent(cfg, Event{
+			Timestamp: now,
+			Level:     "warn",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate issuance deferred (%s): %s; retrying after %s", id, reason, until.UTC().Format(time.RFC3339)),
+			NextStep:  "Issuance resumes automatically once the CA rate limit window slides",
+		})
+		return nil
+	})
+	return deferred
+}
+
+// recordIssuance adds an attempt for certificate id to the ledger.
+func recordIssuance(cfg *Config, id string, domains []string, outcome string, limits IssuanceLimits, now time.Time) {
+	pruneIssuances(cfg, limits, now)
+	cfg.Issuances = append(cfg.Issuances, IssuanceRecord{
+		At:                now,
+		CertID:            id,
+		DomainsHash:       domainsHash(domains),
+		RegisteredDomains: registeredDomains(domains),
+		Outcome:           outcome,
+	})
+}
+
+// deferralOver reports whether c was deferred and its window has slid.
+func deferralOver(c Certificate, now time.Time) bool {
+	return strings.EqualFold(c.Status, CertStatusDeferred) && (c.DeferredUntil == nil || !now.Before(*c.DeferredUntil))
+}
+
+// IssuanceUsage returns the usage of every rate limit window that applies
+// to the certificates in the inventory or to recent issuances.
+func (m *Manager) IssuanceUsage() []IssuanceUsage {
+	cfg := m.currentConfig()
+	limits := m.issuanceLimits
+	now := m.now()
+	usage := []IssuanceUsage{}
+	window := func(kind, key string, max int, span time.Duration, match func(IssuanceRecord) bool) {
+		times := issuedWithin(cfg.Issuances, span, now, match)
+		u := IssuanceUsage{Limit: kind, Key: key, Used: len(times), Max: max, WindowSeconds: int64(span / time.Second)}
+		if len(times) > 0 {
+			u.ResetsAt = timePtr(times[0].Add(span))
+		}
+		usage = append(usage, u)
+	}
+
+	domains := map[string]bool{}
+	for _, r := range cfg.Issuances {
+		for _, reg := range r.RegisteredDomains {
+			domains[reg] = true
+		}
+	}
+	for _, c := range cfg.Certificates {
+		if isRetired(c) {
+			continue
+		}
+		for _, reg := range registeredDomains(c.Domains) {
+			domains[reg] = true
+		}
+	}
+	regs := make([]string, 0, len(domains))
+	for reg := range domains {
+		regs = append(regs, reg)
+	}
+	sort.Strings(regs)
+	for _, reg := range regs {
+		window(LimitRegisteredDomain, reg, limits.PerRegisteredDomain, limits.PerDomainWindow, func(r IssuanceRecord) bool {
+			return containsString(r.RegisteredDomains, reg)
+		})
+	}
+	for _, c := range cfg.Certificates {
+		if isRetired(c) || len(c.Domains) == 0 {
+			continue
+		}
+		hash := domainsHash(c.Domains)
+		window(LimitDuplicate, c.ID, limits.Duplicate, limits.DuplicateWindow, func(r IssuanceRecord) bool {
+			return r.DomainsHash == hash
+		})
+	}
+	return usage
+}
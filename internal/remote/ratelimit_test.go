@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"testing"
+	"time"
+)
+
+func usageFor(m *Manager, limit, key string) IssuanceUsage {
+	for _, u := range m.IssuanceUsage() {
+		if u.Limit == limit && u.Key == key {
+			return u
+		}
+	}
+	return IssuanceUsage{}
+}
+
+func TestManager_IssuanceBurstIsDeferredAtRateLimits(t *testing.T) {
+	m, lookup, advance := newPruneTestManager(t)
+	week := 7 * 24 * time.Hour
+	m.issuanceLimits = IssuanceLimits{PerRegisteredDomain: 4, PerDomainWindow: week, Duplicate: 2, DuplicateWindow: week}
+	for _, label := range []string{"blog", "wiki", "shop"} {
+		lookup.set(label, true)
+	}
+	start := m.now()
+	if ledger := m.currentConfig().Issuances; len(ledger) != 1 || ledger[0].CertID != "portal" || ledger[0].Outcome != IssuanceIssued || ledger[0].RegisteredDomains[0] != "example.com" {
+		t.Fatalf("expected the portal issuance in the ledger, got %+v", ledger)
+	}
+
+	// Duplicate limit: the third certificate for the same names in a week
+	// waits for the first to leave the window.
+	advance(time.Hour)
+	if err := m.RenewCertificate("portal"); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if cert := settledCertificates(t, m)["portal"]; cert.Status != "ok" {
+		t.Fatalf("second portal certificate not issued: %+v", cert)
+	}
+	advance(time.Hour)
+	if err := m.RenewCertificate("portal"); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	portal := settledCertificates(t, m)["portal"]
+	if portal.Status != CertStatusDeferred || portal.DeferredUntil == nil || !portal.DeferredUntil.Equal(start.Add(week)) {
+		t.Fatalf("expected the portal deferred until %s, got %+v", start.Add(week), portal)
+	}
+	if !hasEvent(m, "Certificate issuance deferred (portal): 2 certificates for the same names") {
+		t.Fatalf("expected a deferral event, got %+v", m.ListEvents())
+	}
+
+	// Registered domain limit: blog and wiki bring example.com to four.
+	for _, host := range []string{"blog.example.com", "wiki.example.com", "shop.example.com"} {
+		advance(time.Minute)
+		m.QueueHostnameCertificate(host)
+		settledCertificates(t, m)
+	}
+	certs := settledCertificates(t, m)
+	if certs["host:blog.example.com"].Status != "ok" || certs["host:wiki.example.com"].Status != "ok" {
+		t.Fatalf("expected the first hosts issued: %+v", certs)
+	}
+	shop := certs["host:shop.example.com"]
+	if shop.Status != CertStatusDeferred || !shop.DeferredUntil.Equal(start.Add(week)) {
+		t.Fatalf("expected shop deferred at the registered domain limit, got %+v", shop)
+	}
+	if !hasEvent(m, "4 certificates for example.com issued") {
+		t.Fatalf("expected the registered domain named in the event")
+	}
+	if len(m.currentConfig().Issuances) != 4 {
+		t.Fatalf("deferred certificates must not be recorded as attempts: %+v", m.currentConfig().Issuances)
+	}
+
+	domain := usageFor(m, LimitRegisteredDomain, "example.com")
+	if domain.Used != 4 || domain.Max != 4 || domain.WindowSeconds != int64(week/time.Second) || !domain.ResetsAt.Equal(start.Add(week)) {
+		t.Fatalf("unexpected registered domain usage %+v", domain)
+	}
+	if dup := usageFor(m, LimitDuplicate, "portal"); dup.Used != 2 || dup.Max != 2 {
+		t.Fatalf("unexpected duplicate usage %+v", dup)
+	}
+	if dup := usageFor(m, LimitDuplicate, "host:shop.example.com"); dup.Used != 0 || dup.ResetsAt != nil {
+		t.Fatalf("unexpected duplicate usage for a deferred certificate %+v", dup)
+	}
+
+	// The scheduler leaves deferred certificates alone until the window
+	// slides, then orders them.
+	advance(week - 3*time.Hour)
+	m.scanAndQueueRenewals()
+	if certs := settledCertificates(t, m); certs["portal"].Status != CertStatusDeferred || certs["host:shop.example.com"].Status != CertStatusDeferred {
+		t.Fatalf("deferred certificates ordered early: %+v", certs)
+	}
+	advance(time.Hour)
+	m.scanAndQueueRenewals()
+	certs = settledCertificates(t, m)
+	if certs["portal"].Status != "ok" || certs["host:shop.example.com"].Status != "ok" || certs["portal"].DeferredUntil != nil {
+		t.Fatalf("expected deferred certificates issued once the window slid: %+v", certs)
+	}
+	ledger := m.currentConfig().Issuances
+	if len(ledger) != 5 {
+		t.Fatalf("expected the first issuance pruned and two added, got %+v", ledger)
+	}
+	for _, r := range ledger {
+		if !r.At.After(start) {
+			t.Fatalf("record older than the window kept: %+v", r)
+		}
+	}
+	if domain := usageFor(m, LimitRegisteredDomain, "example.com"); domain.Used != 5 {
+		t.Fatalf("expected five issuances counted, got %+v", domain)
+	}
+}
+
+func TestIssuanceDeferral_CountsOnlyIssuedAttempts(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	limits := DefaultIssuanceLimits()
+	var records []IssuanceRecord
+	for i := 0; i < 10; i++ {
+		records = append(records, IssuanceRecord{
+			At:                now.Add(-time.Duration(i) * time.Hour),
+			DomainsHash:       domainsHash([]string{"a.example.org"}),
+			RegisteredDomains: []string{"example.org"},
+			Outcome:           IssuanceFailed,
+		})
+	}
+	if until, _ := issuanceDeferral(records, []string{"A.example.org."}, limits, now); !until.IsZero() {
+		t.Fatalf("failed attempts counted against the limits: %s", until)
+	}
+	for i := range records[:5] {
+		records[i].Outcome = IssuanceIssued
+	}
+	until, reason := issuanceDeferral(records, []string{"a.example.org"}, limits, now)
+	if !until.Equal(now.Add(-4*time.Hour + limits.DuplicateWindow)) {
+		t.Fatalf("unexpected deferral %s (%s)", until, reason)
+	}
+	if until, _ := issuanceDeferral(records, []string{"b.example.org"}, limits, now); !until.IsZero() {
+		t.Fatalf("other names deferred: %s", until)
+	}
+	if got := registeredDomains([]string{"*.example.co.uk", "www.example.co.uk", "example.com"}); len(got) != 2 || got[0] != "example.co.uk" || got[1] != "example.com" {
+		t.Fatalf("unexpected registered domains %v", got)
+	}
+}
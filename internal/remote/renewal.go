@@ -0,0 +1,208 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultRenewalLeadDays is how many days before expiry a certificate is
+// renewed unless the renewal window is configured.
+const DefaultRenewalLeadDays = 30
+
+// MaxRenewalLeadDays bounds the renewal window; Let's Encrypt certificates
+// last 90 days.
+const MaxRenewalLeadDays = 60
+
+// Renewal triggers recorded in the event log.
+const (
+	RenewedByScheduler = "scheduler"
+	RenewedByUser      = "user"
+)
+
+// ErrInvalidRenewalLead is returned for a renewal window outside
+// 1..MaxRenewalLeadDays days.
+var ErrInvalidRenewalLead = fmt.Errorf("remote: renewal lead must be between 1 and %d days", MaxRenewalLeadDays)
+
+// RenewalLeadDays returns the configured renewal window in days.
+func (c *Config) RenewalLeadDays() int {
+	if c.RenewalLead <= 0 {
+		return DefaultRenewalLeadDays
+	}
+	return c.RenewalLead
+}
+
+func (c *Config) renewalLead() time.Duration {
+	return time.Duration(c.RenewalLeadDays()) * 24 * time.Hour
+}
+
+// effectiveLead caps lead at two thirds of the certificate lifetime, so a
+// short-lived certificate is not due again the moment it is issued.
+func effectiveLead(issued, expires time.Time, lead time.Duration) time.Duration {
+	if issued.IsZero() || !expires.After(issued) {
+		return lead
+	}
+	if limit := expires.Sub(issued) * 2 / 3; lead > limit {
+		return limit
+	}
+	return lead
+}
+
+// renewAt is when a certificate issued at issued and expiring at expires
+// should be renewed.
+func renewAt(issued, expires time.Time, lead time.Duration) time.Time {
+	return expires.Add(-effectiveLead(issued, expires, lead))
+}
+
+// renewalDue reports whether c should be renewed now: past its renewal date
+// or inside the renewal window before expiry. The scheduler and RenewAll
+// both go through it so they agree on what is due.
+func renewalDue(cfg *Config, c Certificate, now time.Time) bool {
+	if c.NextRenewal == nil || c.ExpiresAt == nil {
+		return false
+	}
+	var issued time.Time
+	if c.IssuedAt != nil {
+		issued = *c.IssuedAt
+	}
+	if now.After(*c.NextRenewal) {
+		return true
+	}
+	return now.Add(effectiveLead(issued, *c.ExpiresAt, cfg.renewalLead())).After(*c.ExpiresAt)
+}
+
+// SetRenewalLead sets how many days before expiry certificates are renewed
+// and moves the renewal date of every issued certificate accordingly.
+func (m *Manager) SetRenewalLead(days int) error {
+	if days < 1 || days > MaxRenewalLeadDays {
+		return ErrInvalidRenewalLead
+	}
+	return m.update(func(cfg *Config) error {
+		if cfg.RenewalLeadDays() == days {
+			return errNoChange
+		}
+		cfg.RenewalLead = days
+		lead := cfg.renewalLead()
+		for i := range cfg.Certificates {
+			c := &cfg.Certificates[i]
+			if c.NextRenewal == nil || c.ExpiresAt == nil || c.IssuedAt == nil {
+				continue
+			}
+			c.NextRenewal = timePtr(renewAt(*c.IssuedAt, *c.ExpiresAt, lead))
+		}
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificates now renew %d days before expiry", days),
+		})
+		return nil
+	})
+}
+
+// RenewAll queues renewal of every certificate that is due, failed or past
+// its deferral, or of every renewable certificate when force is set. Certificates already being
+// issued are left alone. It returns the IDs queued.
+func (m *Manager) RenewAll(force bool) []string {
+	m.ensureConfigHydrated()
+	now := m.now()
+	return m.renewWhere(func(cfg *Config, c Certificate) bool {
+		return force || strings.EqualFold(c.Status, "error") || renewalDue(cfg, c, now) || deferralOver(c, now)
+	}, RenewedByUser)
+}
+
+// renewWhere queues renewal of the certificates pick selects, skipping those
+// pending, being issued or retired. Per-host certificates the wildcard now
+// serves are superseded rather than renewed.
+func (m *Manager) renewWhere(pick func(cfg *Config, c Certificate) bool, by string) []string {
+	cfg := m.currentConfig()
+	now := m.now()
+	queued := []string{}
+	var covered []string
+	for _, c := range cfg.Certificates {
+		if strings.EqualFold(c.Status, "pending") || m.issuing(c.ID) {
+			continue // avoid duplicate queueing
+		}
+		if isRetired(c) {
+			continue // orphaned, or replaced after a solver change
+		}
+		if !pick(cfg, c) {
+			continue
+		}
+		if h, ok := strings.CutPrefix(c.ID, "host:"); ok && wildcardCovering(cfg, h, now) >= 0 {
+			covered = append(covered, h)
+			continue
+		}
+		domains, cn, err := m.renewalTarget(cfg, c)
+		if err != nil {
+			continue
+		}
+		if m.enqueueRenewal(c.ID, domains, cn, by) {
+			queued = append(queued, c.ID)
+		}
+	}
+	for _, h := range covered {
+		_ = m.update(func(cfg *Config) error {
+			if !retireCertificate(cfg, "host:"+h, CertStatusSuperseded) {
+				return errNoChange
+			}
+			return nil
+		})
+		m.QueueHostnameCertificate(h)
+	}
+	return queued
+}
+
+// renewalTarget returns the domains and common name to renew c with.
+func (m *Manager) renewalTarget(cfg *Config, c Certificate) ([]string, string, error) {
+	domains := append([]string(nil), c.Domains...)
+	switch c.ID {
+	case "portal":
+		if cfg.PortalHostname == "" {
+			return nil, "", errors.New("portal hostname not set")
+		}
+		return []string{cfg.PortalHostname}, cfg.PortalHostname, nil
+	case "wildcard":
+		if cfg.TLD == "" || !strings.EqualFold(cfg.Solver, "dns-01") {
+			return nil, "", errors.New("wildcard renewals require dns-01 solver")
+		}
+		// dns-01 needs the provider credentials; wait for unlock.
+		if err := m.requireSecrets(); err != nil {
+			return nil, "", err
+		}
+		cn := "*." + cfg.TLD
+		return []string{cn}, cn, nil
+	}
+	if _, h, ok := strings.Cut(c.ID, ":"); ok && h != "" {
+		// The ID suffix is the hostname for host: and alias: entries.
+		if len(domains) == 0 {
+			domains = []string{h}
+		}
+		return domains, h, nil
+	}
+	if len(domains) == 0 {
+		return nil, "", fmt.Errorf("certificate %s has no domains", c.ID)
+	}
+	return domains, domains[0], nil
+}
+
+// enqueueRenewal is enqueueIssuance for an issued certificate, recording
+// who asked for the renewal. It reports whether issuance started.
+func (m *Manager) enqueueRenewal(id string, domains []string, commonName, by string) bool {
+	if !m.canIssue(commonName) || m.issuing(id) {
+		return false
+	}
+	_ = m.update(func(cfg *Config) error {
+		markCertPending(cfg, id, domains)
+		m.appendEvent(cfg, Event{
+			Timestamp: m.now(),
+			Level:     "info",
+			Source:    "remote",
+			Message:   fmt.Sprintf("Certificate renewal started (%s, by %s)", id, by),
+		})
+		return nil
+	})
+	m.startIssuance(id, domains, commonName)
+	return true
+}
@@ -0,0 +1,168 @@
+package remote
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func TestRenewalWindowMath(t *testing.T) {
+	issued := time.Unix(1_000_000, 0).UTC()
+	expires := issued.Add(90 * day)
+	for _, tc := range []struct {
+		lead time.Duration
+		want time.Time
+	}{
+		{30 * day, issued.Add(60 * day)},
+		{60 * day, issued.Add(30 * day)},
+	} {
+		if got := renewAt(issued, expires, tc.lead); !got.Equal(tc.want) {
+			t.Fatalf("lead %s: renew at %s, want %s", tc.lead, got, tc.want)
+		}
+	}
+	// Never more than two thirds of the lifetime ahead of expiry.
+	short := issued.Add(6 * day)
+	if got := renewAt(issued, short, 30*day); !got.Equal(issued.Add(2 * day)) {
+		t.Fatalf("six day certificate renews at %s", got)
+	}
+
+	cfg := &Config{}
+	if cfg.RenewalLeadDays() != DefaultRenewalLeadDays {
+		t.Fatalf("default lead = %d", cfg.RenewalLeadDays())
+	}
+	// A certificate whose stored renewal date predates a wider window is
+	// due once inside that window.
+	c := Certificate{IssuedAt: &issued, ExpiresAt: &expires, NextRenewal: timePtr(issued.Add(80 * day))}
+	if renewalDue(cfg, c, issued.Add(59*day)) {
+		t.Fatalf("due 31 days before expiry with a 30 day window")
+	}
+	if !renewalDue(cfg, c, issued.Add(61*day)) {
+		t.Fatalf("not due 29 days before expiry with a 30 day window")
+	}
+	cfg.RenewalLead = 40
+	if !renewalDue(cfg, c, issued.Add(51*day)) {
+		t.Fatalf("not due 39 days before expiry with a 40 day window")
+	}
+	if renewalDue(cfg, Certificate{Status: "error"}, issued) {
+		t.Fatalf("certificate without dates reported due")
+	}
+}
+
+func TestManager_SetRenewalLead(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	for _, days := range []int{0, -1, MaxRenewalLeadDays + 1} {
+		if err := m.SetRenewalLead(days); !errors.Is(err, ErrInvalidRenewalLead) {
+			t.Fatalf("lead %d: expected ErrInvalidRenewalLead, got %v", days, err)
+		}
+	}
+	portal := settledCertificates(t, m)["portal"]
+	if want := portal.ExpiresAt.Add(-30 * day); !portal.NextRenewal.Equal(want) {
+		t.Fatalf("next renewal %s, want %s", portal.NextRenewal, want)
+	}
+	if err := m.SetRenewalLead(45); err != nil {
+		t.Fatalf("set lead: %v", err)
+	}
+	portal = settledCertificates(t, m)["portal"]
+	if want := portal.ExpiresAt.Add(-45 * day); !portal.NextRenewal.Equal(want) {
+		t.Fatalf("next renewal %s after widening, want %s", portal.NextRenewal, want)
+	}
+	if got := m.Status().RenewalLeadDays; got != 45 {
+		t.Fatalf("status lead = %d", got)
+	}
+	if !hasEvent(m, "Certificates now renew 45 days before expiry") {
+		t.Fatalf("lead change not recorded: %+v", m.ListEvents())
+	}
+}
+
+func queuedIDs(ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func TestManager_RenewAllSelection(t *testing.T) {
+	m, _, advance := newPruneTestManager(t)
+	if _, err := m.AddAlias("portal", "shop.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	settledCertificates(t, m)
+
+	if got := m.RenewAll(false); len(got) != 0 {
+		t.Fatalf("fresh certificates queued: %v", got)
+	}
+
+	// A failed certificate is picked up without force.
+	_ = m.update(func(cfg *Config) error {
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].ID == "alias:shop.example.net" {
+				cfg.Certificates[i].Status = "error"
+				cfg.Certificates[i].NextRenewal = nil
+				cfg.Certificates[i].ExpiresAt = nil
+			}
+		}
+		return nil
+	})
+	if got := queuedIDs(m.RenewAll(false)); got != "alias:shop.example.net" {
+		t.Fatalf("queued %q, want the failed alias", got)
+	}
+	if c := settledCertificates(t, m)["alias:shop.example.net"]; c.Status != "ok" {
+		t.Fatalf("alias not reissued: %+v", c)
+	}
+	if !hasEvent(m, "Certificate renewal started (alias:shop.example.net, by user)") {
+		t.Fatalf("user renewal not recorded: %+v", m.ListEvents())
+	}
+
+	if got := queuedIDs(m.RenewAll(true)); got != "alias:shop.example.net,portal" {
+		t.Fatalf("forced renew-all queued %q", got)
+	}
+	settledCertificates(t, m)
+
+	// Past the renewal date both are due, for the scheduler and renew-all
+	// alike.
+	intoWindow := func() {
+		portal := settledCertificates(t, m)["portal"]
+		advance(portal.NextRenewal.Sub(m.now()) + time.Hour)
+	}
+	intoWindow()
+	if got := queuedIDs(m.RenewAll(false)); got != "alias:shop.example.net,portal" {
+		t.Fatalf("due renew-all queued %q", got)
+	}
+	intoWindow()
+	m.scanAndQueueRenewals()
+	settledCertificates(t, m)
+	if !hasEvent(m, "Certificate renewal started (portal, by scheduler)") {
+		t.Fatalf("scheduler renewal not recorded: %+v", m.ListEvents())
+	}
+}
+
+func TestManager_RenewAllSkipsPending(t *testing.T) {
+	m, _, _ := newPruneTestManager(t)
+	if _, err := m.AddAlias("portal", "shop.example.net", AliasOptions{}); err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	settledCertificates(t, m)
+
+	// One entry pending in the inventory, the other mid-issuance.
+	_ = m.update(func(cfg *Config) error {
+		markCertPending(cfg, "alias:shop.example.net", []string{"shop.example.net"})
+		return nil
+	})
+	if !m.claimIssuance("portal") {
+		t.Fatalf("claim portal issuance")
+	}
+	if got := m.RenewAll(true); len(got) != 0 {
+		t.Fatalf("pending certificates queued again: %v", got)
+	}
+	m.releaseIssuance("portal")
+	if got := queuedIDs(m.RenewAll(true)); got != "portal" {
+		t.Fatalf("queued %q, want only portal", got)
+	}
+	// Queued once; asking again while it runs adds nothing.
+	if got := m.RenewAll(true); len(got) != 0 {
+		t.Fatalf("portal queued twice: %v", got)
+	}
+}
@@ -0,0 +1,61 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// statusMaxAge bounds how long a Status snapshot is shared. Config changes
+// drop it at once; the age limit picks up what changes without a save, such
+// as challenge counters and certificate ages.
+const statusMaxAge = 2 * time.Second
+
+type statusSnapshot struct {
+	status  Status
+	etag    string
+	gen     uint64
+	takenAt time.Time
+}
+
+// Status reports the remote access state. Results are shared between
+// callers for up to statusMaxAge, so the slices it holds must be treated as
+// read-only.
+func (m *Manager) Status() Status {
+	st, _ := m.StatusWithETag()
+	return st
+}
+
+// StatusWithETag returns Status along with a strong ETag that changes
+// whenever anything but the generation time and ages in it changes.
+func (m *Manager) StatusWithETag() (Status, string) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	gen := m.statusGen.Load()
+	if snap := m.statusSnap; snap != nil && snap.gen == gen && time.Since(snap.takenAt) < statusMaxAge {
+		return snap.status, snap.etag
+	}
+	st := m.computeStatus()
+	// A save while computing advances statusGen, so a snapshot of the older
+	// config is never served after it.
+	snap := &statusSnapshot{status: st, etag: statusETag(st), gen: gen, takenAt: time.Now()}
+	m.statusSnap = snap
+	return snap.status, snap.etag
+}
+
+// invalidateStatus drops the shared Status snapshot.
+func (m *Manager) invalidateStatus() {
+	m.statusGen.Add(1)
+}
+
+func statusETag(st Status) string {
+	st.GeneratedAt = time.Time{}
+	st.AgeSeconds = nil
+	data, err := json.Marshal(st)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"errors"
+	"os"
+
+	"piccolod/internal/remote/acme"
+	"piccolod/internal/state/paths"
+)
+
+// ErrStorageUnavailable is returned by writes while the manager runs without
+// its bootstrap volume.
+var ErrStorageUnavailable = errors.New("remote: storage unavailable")
+
+// StateStorageUnavailable is the Status state of a manager started without
+// its bootstrap volume.
+const StateStorageUnavailable = "storage_unavailable"
+
+// NewManagerWithoutStorage starts a manager for a device whose bootstrap
+// volume is missing or read-only. It reports StateStorageUnavailable, with
+// reason among the warnings, and refuses changes until AttachStorage.
+func NewManagerWithoutStorage(reason string) (*Manager, error) {
+	m, err := NewManagerWithStorage(nil, "")
+	if err != nil {
+		return nil, err
+	}
+	m.unavailable.Store(&reason)
+	return m, nil
+}
+
+// AttachStorage hands a manager started by NewManagerWithoutStorage its
+// storage once the bootstrap volume is mounted at baseDir, and loads the
+// config from it.
+func (m *Manager) AttachStorage(storage Storage, baseDir string) error {
+	if baseDir == "" {
+		baseDir = paths.Root()
+	}
+	issuer := acme.NewManager(baseDir, m.challenges, "", os.Getenv("PICCOLO_ACME_DIR_URL"))
+	if m.keySealer != nil {
+		issuer.SetKeyWriter(m.writeCertKey)
+	}
+	m.storageMu.Lock()
+	m.storage = storage
+	m.baseDir = baseDir
+	m.acmeMgr = issuer
+	m.storageMu.Unlock()
+	m.unavailable.Store(nil)
+	m.needsReload.Store(true)
+	defer m.invalidateStatus()
+
+	if err := m.ReloadFromStorage(); err != nil {
+		return err
+	}
+	m.watchACMEAccount()
+	m.certDirMu.Lock()
+	provider := m.certProvider
+	m.certDirMu.Unlock()
+	if provider != nil {
+		provider.SetBase(m.CertStorage().Path)
+	}
+	return nil
+}
+
+func (m *Manager) storageUnavailable() (string, bool) {
+	if reason := m.unavailable.Load(); reason != nil {
+		return *reason, true
+	}
+	return "", false
+}
+
+func (m *Manager) store() Storage {
+	m.storageMu.RLock()
+	defer m.storageMu.RUnlock()
+	return m.storage
+}
+
+func (m *Manager) issuer() certIssuer {
+	m.storageMu.RLock()
+	defer m.storageMu.RUnlock()
+	return m.acmeMgr
+}
+
+func (m *Manager) base() string {
+	m.storageMu.RLock()
+	defer m.storageMu.RUnlock()
+	return m.baseDir
+}
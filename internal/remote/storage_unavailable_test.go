@@ -0,0 +1,42 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestManagerWithoutStorageWaitsForAttach(t *testing.T) {
+	m, err := NewManagerWithoutStorage("bootstrap volume is read-only")
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+
+	st := m.Status()
+	if st.State != StateStorageUnavailable || len(st.Warnings) == 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if err := m.Disable(); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("expected writes refused, got %v", err)
+	}
+
+	dir := t.TempDir()
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	if err := storage.Save(context.Background(), Config{Endpoint: "wss://nexus.example.com/connect", TLD: "example.com"}); err != nil {
+		t.Fatalf("seed config: %v", err)
+	}
+	if err := m.AttachStorage(storage, dir); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	st = m.Status()
+	if st.State == StateStorageUnavailable || st.TLD != "example.com" || st.CertStorage.Path != dir+"/remote/certs" {
+		t.Fatalf("unexpected status after attach %+v", st)
+	}
+	if err := m.Disable(); err != nil {
+		t.Fatalf("disable after attach: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"piccolod/internal/remote/nexusclient"
+)
+
+// ErrTunnelInactive is returned by ReconnectTunnel while remote access is
+// off or the adapter does not manage reconnects.
+var ErrTunnelInactive = errors.New("remote: tunnel not active")
+
+// reconnector returns the adapter's reconnect controls, if it has any.
+func (m *Manager) reconnector() (nexusclient.Reconnector, bool) {
+	m.adapterMu.Lock()
+	defer m.adapterMu.Unlock()
+	rc, ok := m.adapter.(nexusclient.Reconnector)
+	return rc, ok
+}
+
+// trackTunnelFailures hands the persisted failure count to the adapter once
+// the config has been loaded, and persists the count as it changes.
+func (m *Manager) trackTunnelFailures(cfg *Config) {
+	rc, ok := m.reconnector()
+	if !ok || m.needsReload.Load() || !m.tunnelTracked.CompareAndSwap(false, true) {
+		return
+	}
+	rc.TrackFailures(cfg.TunnelFailures, m.recordTunnelFailures)
+}
+
+// recordTunnelFailures persists the consecutive failure count so the status
+// warning and the backoff survive a restart.
+func (m *Manager) recordTunnelFailures(n int) {
+	err := m.update(func(cfg *Config) error {
+		if cfg.TunnelFailures == n {
+			return errNoChange
+		}
+		cfg.TunnelFailures = n
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrLocked) {
+		log.Printf("WARN: remote: persist tunnel failure count: %v", err)
+	}
+}
+
+// tunnelStats reports the live connection state while remote is enabled.
+func (m *Manager) tunnelStats(cfg *Config) *nexusclient.Stats {
+	if !cfg.Enabled {
+		return nil
+	}
+	rc, ok := m.reconnector()
+	if !ok {
+		return nil
+	}
+	st := rc.Stats()
+	return &st
+}
+
+// tunnelWarning describes a tunnel that keeps failing to connect.
+func (m *Manager) tunnelWarning(st *nexusclient.Stats) string {
+	if st == nil || st.Connected || st.ConsecutiveFailures == 0 {
+		return ""
+	}
+	msg := fmt.Sprintf("Tunnel has failed to connect %d times", st.ConsecutiveFailures)
+	if st.ConsecutiveFailures == 1 {
+		msg = "Tunnel has failed to connect once"
+	}
+	if st.NextAttempt != nil {
+		if wait := st.NextAttempt.Sub(m.now()); wait > 0 {
+			msg += fmt.Sprintf("; next attempt in %ds", int(math.Ceil(wait.Seconds())))
+		}
+	}
+	return msg
+}
+
+// resetTunnelBackoff makes the adapter retry at once, e.g. after the user
+// saved new settings.
+func (m *Manager) resetTunnelBackoff() {
+	if rc, ok := m.reconnector(); ok {
+		rc.ReconnectNow()
+	}
+}
+
+// ReconnectTunnel drops the reconnect backoff so the tunnel is tried again
+// now, and reports the connection state.
+func (m *Manager) ReconnectTunnel() (nexusclient.Stats, error) {
+	if m == nil || !m.currentConfig().Enabled {
+		return nexusclient.Stats{}, ErrTunnelInactive
+	}
+	rc, ok := m.reconnector()
+	if !ok {
+		return nexusclient.Stats{}, ErrTunnelInactive
+	}
+	rc.ReconnectNow()
+	m.invalidateStatus()
+	return rc.Stats(), nil
+}
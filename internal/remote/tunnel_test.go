@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/remote/nexusclient"
+)
+
+type reconnectingAdapter struct {
+	*fakeAdapter
+	mu         sync.Mutex
+	stats      nexusclient.Stats
+	seeded     int
+	onFailures func(int)
+	reconnects int
+}
+
+func (r *reconnectingAdapter) Stats() nexusclient.Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *reconnectingAdapter) ReconnectNow() {
+	r.mu.Lock()
+	r.reconnects++
+	r.mu.Unlock()
+}
+
+func (r *reconnectingAdapter) TrackFailures(count int, fn func(int)) {
+	r.mu.Lock()
+	r.seeded = count
+	r.onFailures = fn
+	r.mu.Unlock()
+}
+
+func (r *reconnectingAdapter) reconnectCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reconnects
+}
+
+func TestManager_TunnelFailuresPersistAndWarn(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	if err := storage.Save(context.Background(), Config{TunnelFailures: 4}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	m, err := newManagerWithDeps(storage, dir, &stubDialer{}, &stubResolver{}, fixedNow(now))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+
+	adapter := &reconnectingAdapter{fakeAdapter: newFakeAdapter()}
+	m.SetNexusAdapter(adapter)
+	if adapter.seeded != 4 || adapter.onFailures == nil {
+		t.Fatalf("adapter not seeded from the stored count: %d", adapter.seeded)
+	}
+
+	if _, err := m.ReconnectTunnel(); !errors.Is(err, ErrTunnelInactive) {
+		t.Fatalf("reconnect while disabled: %v", err)
+	}
+	if err := m.Configure(ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if n := adapter.reconnectCount(); n != 1 {
+		t.Fatalf("saving the config should reset the backoff, got %d resets", n)
+	}
+	if _, err := m.RunPreflight(context.Background()); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+
+	adapter.onFailures(12)
+	if got := m.currentConfig().TunnelFailures; got != 12 {
+		t.Fatalf("persisted failures = %d", got)
+	}
+	reloaded, err := storage.Load(context.Background())
+	if err != nil || reloaded.TunnelFailures != 12 {
+		t.Fatalf("stored failures = %d (%v)", reloaded.TunnelFailures, err)
+	}
+
+	next := now.Add(87 * time.Second)
+	adapter.mu.Lock()
+	adapter.stats = nexusclient.Stats{Breaker: nexusclient.BreakerOpen, ConsecutiveFailures: 12, NextAttempt: &next}
+	adapter.mu.Unlock()
+	m.invalidateStatus()
+	st := m.Status()
+	if st.State != "warning" || st.Tunnel == nil || st.Tunnel.Breaker != nexusclient.BreakerOpen {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	want := "Tunnel has failed to connect 12 times; next attempt in 87s"
+	found := false
+	for _, w := range st.Warnings {
+		found = found || w == want
+	}
+	if !found {
+		t.Fatalf("missing %q in %v", want, st.Warnings)
+	}
+
+	stats, err := m.ReconnectTunnel()
+	if err != nil || stats.ConsecutiveFailures != 12 {
+		t.Fatalf("reconnect: %+v, %v", stats, err)
+	}
+	if n := adapter.reconnectCount(); n != 2 {
+		t.Fatalf("reconnect did not reach the adapter: %d", n)
+	}
+
+	adapter.mu.Lock()
+	adapter.stats = nexusclient.Stats{Connected: true, Breaker: nexusclient.BreakerClosed}
+	adapter.mu.Unlock()
+	m.invalidateStatus()
+	for _, w := range m.Status().Warnings {
+		if w == want {
+			t.Fatalf("warning kept after connecting")
+		}
+	}
+}
@@ -43,6 +43,12 @@ func (d *Dispatcher) Register(name string, h Handler) {
 	d.handlers[name] = h
 }
 
+// Registered reports whether a handler exists for the command name.
+func (d *Dispatcher) Registered(name string) bool {
+	_, ok := d.handlers[name]
+	return ok
+}
+
 // Middleware is a function that can intercept command handling.
 // It receives the next handler in the chain and may short‑circuit.
 type Middleware func(ctx context.Context, cmd Command, next Handler) (Response, error)
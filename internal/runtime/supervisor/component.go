@@ -1,17 +1,62 @@
 package supervisor
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // ComponentFunc wraps simple start/stop functions into a Component.
 type ComponentFunc struct {
 	name  string
 	start func(ctx context.Context) error
 	stop  func(ctx context.Context) error
+	opts  componentOptions
+}
+
+// componentOptions are the startup rules set with ComponentOption.
+type componentOptions struct {
+	dependsOn    []string
+	critical     bool
+	startTimeout time.Duration
+}
+
+// ComponentOption configures how the supervisor starts a component.
+type ComponentOption func(*componentOptions)
+
+// DependsOn names components that must be running before this one starts.
+// They are stopped after it.
+func DependsOn(names ...string) ComponentOption {
+	return func(o *componentOptions) {
+		o.dependsOn = append(o.dependsOn, names...)
+	}
+}
+
+// Critical makes a failed or timed-out start abort Supervisor.Start. Other
+// components are marked failed and the rest of the boot goes on.
+func Critical() ComponentOption {
+	return func(o *componentOptions) {
+		o.critical = true
+	}
+}
+
+// StartTimeout overrides Options.StartTimeout for one component.
+func StartTimeout(d time.Duration) ComponentOption {
+	return func(o *componentOptions) {
+		o.startTimeout = d
+	}
 }
 
 // NewComponent creates a Component from callbacks.
-func NewComponent(name string, start func(ctx context.Context) error, stop func(ctx context.Context) error) Component {
-	return &ComponentFunc{name: name, start: start, stop: stop}
+func NewComponent(name string, start func(ctx context.Context) error, stop func(ctx context.Context) error, opts ...ComponentOption) Component {
+	return newComponentFunc(name, start, stop, opts)
+}
+
+func newComponentFunc(name string, start, stop func(ctx context.Context) error, opts []ComponentOption) *ComponentFunc {
+	c := &ComponentFunc{name: name, start: start, stop: stop}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
 }
 
 func (c *ComponentFunc) Name() string { return c.name }
@@ -29,3 +74,58 @@ func (c *ComponentFunc) Stop(ctx context.Context) error {
 	}
 	return c.stop(ctx)
 }
+
+func (c *ComponentFunc) options() componentOptions { return c.opts }
+
+// reportingComponent is a ComponentFunc that can report runtime failures.
+type reportingComponent struct {
+	*ComponentFunc
+	failures chan error
+}
+
+// NewReportingComponent is NewComponent for work that can fail after start
+// returned. Calling the returned report function hands the failure to the
+// supervisor, which restarts the component with backoff; a failure reported
+// while an earlier one is still pending is dropped.
+func NewReportingComponent(name string, start func(ctx context.Context) error, stop func(ctx context.Context) error, opts ...ComponentOption) (Component, func(error)) {
+	c := &reportingComponent{
+		ComponentFunc: newComponentFunc(name, start, stop, opts),
+		failures:      make(chan error, 1),
+	}
+	return c, func(err error) {
+		select {
+		case c.failures <- err:
+		default:
+		}
+	}
+}
+
+func (c *reportingComponent) Failures() <-chan error { return c.failures }
+
+// onceComponent marks a component Restart refuses.
+type onceComponent struct {
+	Component
+}
+
+// Once wraps c so it is only started and stopped with the supervisor, for
+// components whose Stop releases what a second Start cannot rebuild.
+func Once(c Component) Component {
+	return onceComponent{Component: c}
+}
+
+func restartable(c Component) bool {
+	_, once := c.(onceComponent)
+	return !once
+}
+
+// optionsOf returns the startup rules of c; components not built with
+// NewComponent have none.
+func optionsOf(c Component) componentOptions {
+	if once, ok := c.(onceComponent); ok {
+		c = once.Component
+	}
+	if o, ok := c.(interface{ options() componentOptions }); ok {
+		return o.options()
+	}
+	return componentOptions{}
+}
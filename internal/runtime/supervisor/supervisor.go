@@ -2,7 +2,12 @@ package supervisor
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Component represents a unit of work managed by the supervisor.
@@ -12,68 +17,629 @@ type Component interface {
 	Stop(ctx context.Context) error
 }
 
+// Reporter is implemented by components that can fail after Start has
+// returned. An error received from Failures marks the component failed and
+// schedules an automatic restart.
+type Reporter interface {
+	Failures() <-chan error
+}
+
+// State is the lifecycle state of a registered component.
+type State string
+
+const (
+	StateStopped State = "stopped"
+	StateRunning State = "running"
+	StateFailed  State = "failed"
+)
+
+var (
+	// ErrUnknownComponent is returned by Restart for a name that was never
+	// registered.
+	ErrUnknownComponent = errors.New("unknown component")
+	// ErrNotRestartable is returned by Restart for components wrapped with
+	// Once.
+	ErrNotRestartable = errors.New("component cannot be restarted")
+	// ErrNotStarted is returned by Restart before Start or after Stop.
+	ErrNotStarted = errors.New("supervisor not started")
+	// ErrStartPending is returned by Restart while a start that timed out
+	// at boot has not returned yet.
+	ErrStartPending = errors.New("component start still pending")
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultStartTimeout   = 30 * time.Second
+)
+
+// Options configures a Supervisor.
+type Options struct {
+	// InitialBackoff is the wait before the first automatic restart of a
+	// failed component; it doubles with each failure in a row up to
+	// MaxBackoff. Zero means one second.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between automatic restarts. A component that
+	// stays up this long starts over at InitialBackoff. Zero means a minute.
+	MaxBackoff time.Duration
+	// StartTimeout bounds the Start of each component at boot; the
+	// StartTimeout option overrides it per component. Zero means 30
+	// seconds.
+	StartTimeout time.Duration
+}
+
+// ComponentStatus is the supervisor's view of one component.
+type ComponentStatus struct {
+	Name        string     `json:"name"`
+	State       State      `json:"state"`
+	Restartable bool       `json:"restartable"`
+	Restarts    int        `json:"restarts"`
+	LastError   string     `json:"last_error,omitempty"`
+	Since       *time.Time `json:"since,omitempty"`
+	NextRestart *time.Time `json:"next_restart,omitempty"`
+	DependsOn   []string   `json:"depends_on,omitempty"`
+	Critical    bool       `json:"critical,omitempty"`
+	// StartOrder is when the component began starting at boot, from 1.
+	// Components started in parallel may finish in another order.
+	StartOrder      int   `json:"start_order,omitempty"`
+	StartDurationMS int64 `json:"start_duration_ms"`
+	// TimedOut is set when the boot start ran past its timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+}
+
+type entry struct {
+	comp Component
+	opts componentOptions
+	// lifecycle serializes Start and Stop of this component.
+	lifecycle sync.Mutex
+
+	// Guarded by Supervisor.mu.
+	state       State
+	stopped     bool // Stop ran and no Start has succeeded since
+	restarts    int
+	lastErr     string
+	since       time.Time
+	startedAt   time.Time
+	failures    int // automatic restarts in a row
+	retry       *time.Timer
+	nextRestart time.Time
+	// Boot start bookkeeping; startPending is set while a start that
+	// timed out has not returned.
+	startOrder    int
+	startDuration time.Duration
+	timedOut      bool
+	startPending  bool
+}
+
 // Supervisor coordinates the lifecycle of registered components.
 type Supervisor struct {
-	mu         sync.Mutex
-	components []Component
-	started    bool
+	mu      sync.Mutex
+	opts    Options
+	entries []*entry
+	// order is entries in start order, set by Start.
+	order    []*entry
+	startSeq int
+	started  bool
+	// ctx is the context Start was called with; restarted components get
+	// it rather than the caller's, which may end with a request.
+	ctx    context.Context
+	stopCh chan struct{}
+	now    func() time.Time
 }
 
 // New creates an empty supervisor.
-func New() *Supervisor {
-	return &Supervisor{}
+func New(opts Options) *Supervisor {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		opts.MaxBackoff = opts.InitialBackoff
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = defaultStartTimeout
+	}
+	return &Supervisor{opts: opts, now: time.Now}
 }
 
 // Register adds a component to the supervisor. Registration is only allowed
-// before Start is called.
+// before Start is called. Registering a name twice or a dependency that
+// closes a cycle is a programming error and panics; dependencies may name
+// components registered later.
 func (s *Supervisor) Register(c Component) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.started {
 		panic("supervisor: cannot register component after start")
 	}
-	s.components = append(s.components, c)
+	e := &entry{comp: c, opts: optionsOf(c), state: StateStopped}
+	for _, other := range s.entries {
+		if other.comp.Name() == c.Name() {
+			panic(fmt.Sprintf("supervisor: component %s registered twice", c.Name()))
+		}
+	}
+	if cycle := s.cycleThrough(e); cycle != nil {
+		panic(fmt.Sprintf("supervisor: dependency cycle %s", strings.Join(cycle, " -> ")))
+	}
+	s.entries = append(s.entries, e)
+}
+
+// cycleThrough returns the dependency path from e back to itself when
+// registering e would close a cycle. Callers hold s.mu.
+func (s *Supervisor) cycleThrough(e *entry) []string {
+	deps := map[string][]string{e.comp.Name(): e.opts.dependsOn}
+	for _, other := range s.entries {
+		deps[other.comp.Name()] = other.opts.dependsOn
+	}
+	origin := e.comp.Name()
+	visited := make(map[string]bool)
+	var walk func(name string, path []string) []string
+	walk = func(name string, path []string) []string {
+		for _, dep := range deps[name] {
+			next := append(append([]string(nil), path...), dep)
+			if dep == origin {
+				return next
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if cycle := walk(dep, next); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return walk(origin, []string{origin})
+}
+
+// startOrder sorts the entries so every component follows its
+// dependencies, keeping registration order otherwise. Callers hold s.mu.
+func (s *Supervisor) startOrder() ([]*entry, error) {
+	known := make(map[string]bool, len(s.entries))
+	for _, e := range s.entries {
+		known[e.comp.Name()] = true
+	}
+	for _, e := range s.entries {
+		for _, dep := range e.opts.dependsOn {
+			if !known[dep] {
+				return nil, fmt.Errorf("supervisor: %s depends on unknown component %s", e.comp.Name(), dep)
+			}
+		}
+	}
+	placed := make(map[string]bool, len(s.entries))
+	order := make([]*entry, 0, len(s.entries))
+	for len(order) < len(s.entries) {
+		progress := false
+		for _, e := range s.entries {
+			if placed[e.comp.Name()] || !allPlaced(e.opts.dependsOn, placed) {
+				continue
+			}
+			placed[e.comp.Name()] = true
+			order = append(order, e)
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, errors.New("supervisor: dependency cycle")
+		}
+	}
+	return order, nil
 }
 
-// Start iterates components in registration order and invokes Start on each.
-// If any component fails, previously started components are stopped in reverse
-// order and the error is returned.
+func allPlaced(names []string, placed map[string]bool) bool {
+	for _, name := range names {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// bootSlot is the outcome of one component's start at boot; err is set
+// before done is closed.
+type bootSlot struct {
+	done chan struct{}
+	err  error
+}
+
+// Start starts the components in dependency order. A component starts as
+// soon as its dependencies are running, so independent components start in
+// parallel, each bounded by its start timeout. A component that fails or
+// times out is marked failed, and so are the components depending on it.
+// If any of them is critical, the components already started are stopped
+// in reverse order and the error is returned.
 func (s *Supervisor) Start(ctx context.Context) error {
 	s.mu.Lock()
 	if s.started {
 		s.mu.Unlock()
 		return nil
 	}
+	order, err := s.startOrder()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.order = order
+	s.startSeq = 0
 	s.started = true
-	comps := append([]Component(nil), s.components...)
+	s.ctx = ctx
+	s.stopCh = make(chan struct{})
+	stopCh := s.stopCh
 	s.mu.Unlock()
 
-	started := make([]Component, 0, len(comps))
-	for _, c := range comps {
-		if err := c.Start(ctx); err != nil {
-			for i := len(started) - 1; i >= 0; i-- {
-				_ = started[i].Stop(ctx)
+	slots := make(map[string]*bootSlot, len(order))
+	for _, e := range order {
+		slots[e.comp.Name()] = &bootSlot{done: make(chan struct{})}
+	}
+	var wg sync.WaitGroup
+	for _, e := range order {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			slot := slots[e.comp.Name()]
+			defer close(slot.done)
+			for _, dep := range e.opts.dependsOn {
+				<-slots[dep].done
+				if slots[dep].err != nil {
+					slot.err = fmt.Errorf("dependency %s is not running", dep)
+					s.failBoot(e, slot.err)
+					return
+				}
+			}
+			slot.err = s.bootEntry(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+
+	var critical error
+	for _, e := range order {
+		err := slots[e.comp.Name()].err
+		if err == nil {
+			continue
+		}
+		if !e.opts.critical {
+			log.Printf("WARN: supervisor: %s failed to start: %v", e.comp.Name(), err)
+			continue
+		}
+		if critical == nil {
+			critical = fmt.Errorf("%s: %w", e.comp.Name(), err)
+		}
+	}
+	if critical != nil {
+		for i := len(order) - 1; i >= 0; i-- {
+			if slots[order[i].comp.Name()].err == nil {
+				s.stopEntry(ctx, order[i])
 			}
-			return err
 		}
-		started = append(started, c)
+		s.mu.Lock()
+		s.started = false
+		close(s.stopCh)
+		s.mu.Unlock()
+		return critical
+	}
+	for _, e := range order {
+		if r, ok := e.comp.(Reporter); ok {
+			go s.watch(e, r.Failures(), stopCh)
+		}
 	}
 	return nil
 }
 
-// Stop stops all components in reverse registration order. It is safe to call
-// even if Start was never invoked.
+// Stop stops all components in reverse start order, or reverse
+// registration order before the first Start. It is safe to call even if
+// Start was never invoked.
 func (s *Supervisor) Stop(ctx context.Context) error {
 	s.mu.Lock()
-	comps := append([]Component(nil), s.components...)
+	entries := s.list()
+	if s.started {
+		close(s.stopCh)
+	}
 	s.started = false
+	for _, e := range entries {
+		e.cancelRetry()
+	}
 	s.mu.Unlock()
 
 	var firstErr error
-	for i := len(comps) - 1; i >= 0; i-- {
-		if err := comps[i].Stop(ctx); err != nil && firstErr == nil {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := s.stopEntry(ctx, entries[i]); err != nil && firstErr == nil {
 			firstErr = err
 		}
 	}
 	return firstErr
 }
+
+// list returns the entries in start order once Start has sorted them.
+// Callers hold s.mu.
+func (s *Supervisor) list() []*entry {
+	if s.order != nil {
+		return append([]*entry(nil), s.order...)
+	}
+	return append([]*entry(nil), s.entries...)
+}
+
+// Restart stops and starts the named component on its own, leaving the
+// others running. A component that failed to start stays failed and the
+// error is returned.
+func (s *Supervisor) Restart(ctx context.Context, name string) error {
+	e, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+	if !restartable(e.comp) {
+		return fmt.Errorf("%w: %s", ErrNotRestartable, name)
+	}
+	s.mu.Lock()
+	e.cancelRetry()
+	e.failures = 0
+	s.mu.Unlock()
+	return s.restart(ctx, e)
+}
+
+// Status reports every component in start order.
+func (s *Supervisor) Status() []ComponentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.list()
+	out := make([]ComponentStatus, 0, len(entries))
+	for _, e := range entries {
+		st := ComponentStatus{
+			Name:            e.comp.Name(),
+			State:           e.state,
+			Restartable:     restartable(e.comp),
+			Restarts:        e.restarts,
+			LastError:       e.lastErr,
+			DependsOn:       append([]string(nil), e.opts.dependsOn...),
+			Critical:        e.opts.critical,
+			StartOrder:      e.startOrder,
+			StartDurationMS: e.startDuration.Milliseconds(),
+			TimedOut:        e.timedOut,
+		}
+		if !e.since.IsZero() {
+			since := e.since
+			st.Since = &since
+		}
+		if e.retry != nil {
+			next := e.nextRestart
+			st.NextRestart = &next
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func (s *Supervisor) lookup(name string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return nil, ErrNotStarted
+	}
+	for _, e := range s.entries {
+		if e.comp.Name() == name {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownComponent, name)
+}
+
+// restart stops e unless it already is stopped and starts it with the
+// supervisor's context.
+func (s *Supervisor) restart(ctx context.Context, e *entry) error {
+	s.mu.Lock()
+	pending := e.startPending
+	s.mu.Unlock()
+	if pending {
+		return fmt.Errorf("%w: %s", ErrStartPending, e.comp.Name())
+	}
+	e.lifecycle.Lock()
+	defer e.lifecycle.Unlock()
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return ErrNotStarted
+	}
+	runCtx := s.ctx
+	stopped := e.stopped
+	e.restarts++
+	s.mu.Unlock()
+
+	name := e.comp.Name()
+	if !stopped {
+		if err := e.comp.Stop(ctx); err != nil {
+			log.Printf("WARN: supervisor: stop %s before restart: %v", name, err)
+		}
+	}
+	if err := e.comp.Start(runCtx); err != nil {
+		s.setState(e, StateFailed, err)
+		log.Printf("WARN: supervisor: restart %s failed: %v", name, err)
+		return err
+	}
+	s.setState(e, StateRunning, nil)
+	log.Printf("INFO: supervisor: restarted %s", name)
+	return nil
+}
+
+// bootEntry starts e at boot, giving up on it after its start timeout.
+func (s *Supervisor) bootEntry(ctx context.Context, e *entry) error {
+	timeout := e.opts.startTimeout
+	if timeout <= 0 {
+		timeout = s.opts.StartTimeout
+	}
+	s.mu.Lock()
+	s.startSeq++
+	e.startOrder = s.startSeq
+	s.mu.Unlock()
+
+	begin := time.Now()
+	e.lifecycle.Lock()
+	result := make(chan error, 1)
+	go func() { result <- e.comp.Start(ctx) }()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		e.lifecycle.Unlock()
+		s.mu.Lock()
+		e.startDuration = time.Since(begin)
+		s.mu.Unlock()
+		if err != nil {
+			s.failBoot(e, err)
+			return err
+		}
+		s.setState(e, StateRunning, nil)
+		return nil
+	case <-timer.C:
+		err := fmt.Errorf("start timed out after %s", timeout)
+		s.mu.Lock()
+		e.startDuration = timeout
+		e.timedOut = true
+		e.startPending = true
+		s.mu.Unlock()
+		s.failBoot(e, err)
+		go s.finishAbandonedStart(e, result)
+		return err
+	}
+}
+
+// finishAbandonedStart waits for a start that ran past its timeout. It
+// holds e.lifecycle until then. A start that still succeeds is undone, so
+// the component stays failed until it is restarted.
+func (s *Supervisor) finishAbandonedStart(e *entry, result <-chan error) {
+	defer e.lifecycle.Unlock()
+	err := <-result
+	s.mu.Lock()
+	e.startPending = false
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("WARN: supervisor: late start of %s failed: %v", e.comp.Name(), err)
+		return
+	}
+	log.Printf("WARN: supervisor: %s started after its timeout; stopping it", e.comp.Name())
+	if err := e.comp.Stop(context.Background()); err != nil {
+		log.Printf("WARN: supervisor: stop %s after late start: %v", e.comp.Name(), err)
+	}
+}
+
+// failBoot marks e failed without having started, so Stop leaves it alone.
+func (s *Supervisor) failBoot(e *entry, err error) {
+	s.setState(e, StateFailed, err)
+	s.mu.Lock()
+	e.stopped = true
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) stopEntry(ctx context.Context, e *entry) error {
+	s.mu.Lock()
+	pending := e.startPending
+	s.mu.Unlock()
+	if pending {
+		// finishAbandonedStart stops the component if its start succeeds.
+		return nil
+	}
+	e.lifecycle.Lock()
+	defer e.lifecycle.Unlock()
+	s.mu.Lock()
+	stopped := e.stopped
+	s.mu.Unlock()
+	if stopped {
+		return nil
+	}
+	err := e.comp.Stop(ctx)
+	s.mu.Lock()
+	e.stopped = true
+	e.state = StateStopped
+	e.since = s.now()
+	e.startedAt = time.Time{}
+	s.mu.Unlock()
+	return err
+}
+
+func (s *Supervisor) setState(e *entry, state State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.state = state
+	e.since = s.now()
+	if err != nil {
+		e.lastErr = err.Error()
+	}
+	if state == StateRunning {
+		e.stopped = false
+		e.startedAt = e.since
+	} else {
+		e.startedAt = time.Time{}
+	}
+}
+
+// watch turns runtime failures reported by e into automatic restarts.
+func (s *Supervisor) watch(e *entry, failures <-chan error, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case err, ok := <-failures:
+			if !ok {
+				return
+			}
+			if err == nil {
+				err = errors.New("component reported failure")
+			}
+			s.fail(e, err)
+		}
+	}
+}
+
+// fail marks e failed and schedules its restart after the backoff for the
+// failures in a row so far.
+func (s *Supervisor) fail(e *entry, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return
+	}
+	now := s.now()
+	if !e.startedAt.IsZero() && now.Sub(e.startedAt) >= s.opts.MaxBackoff {
+		e.failures = 0
+	}
+	e.failures++
+	e.state = StateFailed
+	e.since = now
+	e.startedAt = time.Time{}
+	e.lastErr = err.Error()
+	delay := s.backoff(e.failures)
+	e.cancelRetry()
+	e.nextRestart = now.Add(delay)
+	e.retry = time.AfterFunc(delay, func() { s.autoRestart(e) })
+	log.Printf("WARN: supervisor: %s failed (%d in a row): %v; restarting in %s", e.comp.Name(), e.failures, err, delay)
+}
+
+func (s *Supervisor) autoRestart(e *entry) {
+	s.mu.Lock()
+	e.retry = nil
+	s.mu.Unlock()
+	if err := s.restart(context.Background(), e); err != nil && !errors.Is(err, ErrNotStarted) {
+		s.fail(e, err)
+	}
+}
+
+func (s *Supervisor) backoff(failures int) time.Duration {
+	d := s.opts.InitialBackoff
+	for i := 1; i < failures && d < s.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.opts.MaxBackoff {
+		d = s.opts.MaxBackoff
+	}
+	return d
+}
+
+// cancelRetry drops a pending automatic restart. Callers hold
+// Supervisor.mu.
+func (e *entry) cancelRetry() {
+	if e.retry != nil {
+		e.retry.Stop()
+		e.retry = nil
+	}
+}
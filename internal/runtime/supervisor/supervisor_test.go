@@ -0,0 +1,397 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeComponent counts its starts and stops and fails Start on demand.
+type fakeComponent struct {
+	mu       sync.Mutex
+	starts   int
+	stops    int
+	startErr error
+	running  bool
+	ctx      context.Context
+}
+
+func (f *fakeComponent) start(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starts++
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.running = true
+	f.ctx = ctx
+	return nil
+}
+
+func (f *fakeComponent) stop(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stops++
+	f.running = false
+	return nil
+}
+
+func (f *fakeComponent) failStart(err error) {
+	f.mu.Lock()
+	f.startErr = err
+	f.mu.Unlock()
+}
+
+func (f *fakeComponent) counts() (starts, stops int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.starts, f.stops
+}
+
+func statusOf(t *testing.T, s *Supervisor, name string) ComponentStatus {
+	t.Helper()
+	for _, st := range s.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	t.Fatalf("no status for %s", name)
+	return ComponentStatus{}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestRestartLeavesOtherComponentsAlone(t *testing.T) {
+	a, b := &fakeComponent{}, &fakeComponent{}
+	s := New(Options{})
+	s.Register(NewComponent("a", a.start, a.stop))
+	s.Register(NewComponent("b", b.start, b.stop))
+	if err := s.Restart(context.Background(), "a"); !errors.Is(err, ErrNotStarted) {
+		t.Fatalf("expected ErrNotStarted before Start, got %v", err)
+	}
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(base); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	if err := s.Restart(reqCtx, "a"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	reqCancel()
+	if starts, stops := a.counts(); starts != 2 || stops != 1 {
+		t.Fatalf("expected a stopped once and started twice, got starts=%d stops=%d", starts, stops)
+	}
+	if a.ctx != base {
+		t.Fatalf("restarted component should run on the supervisor context, not the caller's")
+	}
+	if starts, stops := b.counts(); starts != 1 || stops != 0 {
+		t.Fatalf("restart of a touched b: starts=%d stops=%d", starts, stops)
+	}
+	if st := statusOf(t, s, "a"); st.State != StateRunning || st.Restarts != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if err := s.Restart(context.Background(), "missing"); !errors.Is(err, ErrUnknownComponent) {
+		t.Fatalf("expected ErrUnknownComponent, got %v", err)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, stops := a.counts(); stops != 2 {
+		t.Fatalf("expected a stopped on shutdown, got %d stops", stops)
+	}
+}
+
+func TestRestartFailureIsReportedAndRecoverable(t *testing.T) {
+	a := &fakeComponent{}
+	s := New(Options{})
+	s.Register(NewComponent("a", a.start, a.stop))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	a.failStart(errors.New("socket busy"))
+	if err := s.Restart(context.Background(), "a"); err == nil {
+		t.Fatalf("expected restart error")
+	}
+	if st := statusOf(t, s, "a"); st.State != StateFailed || st.LastError != "socket busy" {
+		t.Fatalf("expected failed status, got %+v", st)
+	}
+
+	a.failStart(nil)
+	if err := s.Restart(context.Background(), "a"); err != nil {
+		t.Fatalf("second restart: %v", err)
+	}
+	// The failed Start may have left partial state behind, so it is
+	// stopped again before the next attempt.
+	if starts, stops := a.counts(); starts != 3 || stops != 2 {
+		t.Fatalf("unexpected lifecycle calls: starts=%d stops=%d", starts, stops)
+	}
+	if st := statusOf(t, s, "a"); st.State != StateRunning || st.Restarts != 2 || st.LastError != "socket busy" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestOnceComponentsRefuseRestart(t *testing.T) {
+	a := &fakeComponent{}
+	s := New(Options{})
+	s.Register(Once(NewComponent("a", a.start, a.stop)))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop(context.Background())
+	if err := s.Restart(context.Background(), "a"); !errors.Is(err, ErrNotRestartable) {
+		t.Fatalf("expected ErrNotRestartable, got %v", err)
+	}
+	if st := statusOf(t, s, "a"); st.Restartable || st.State != StateRunning {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestReportedFailureRestartsWithBackoff(t *testing.T) {
+	a, b := &fakeComponent{}, &fakeComponent{}
+	s := New(Options{InitialBackoff: 20 * time.Millisecond, MaxBackoff: time.Second})
+	comp, report := NewReportingComponent("a", a.start, a.stop)
+	s.Register(comp)
+	s.Register(NewComponent("b", b.start, b.stop))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	// The restart keeps failing: each retry waits twice as long.
+	a.failStart(errors.New("still wedged"))
+	report(errors.New("announcer stalled"))
+	waitFor(t, "failed state", func() bool { return statusOf(t, s, "a").State == StateFailed })
+
+	var retries []time.Time
+	deadline := time.Now().Add(2 * time.Second)
+	for len(retries) < 3 && time.Now().Before(deadline) {
+		if starts, _ := a.counts(); starts-1 > len(retries) {
+			retries = append(retries, time.Now())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(retries) < 3 {
+		t.Fatalf("expected three automatic restarts, got %d", len(retries))
+	}
+	first, second := retries[1].Sub(retries[0]), retries[2].Sub(retries[1])
+	if first < 30*time.Millisecond || second < 70*time.Millisecond {
+		t.Fatalf("expected growing backoff, got %s then %s", first, second)
+	}
+	st := statusOf(t, s, "a")
+	if st.State != StateFailed || st.LastError != "still wedged" || st.NextRestart == nil {
+		t.Fatalf("unexpected status while retrying: %+v", st)
+	}
+
+	a.failStart(nil)
+	waitFor(t, "recovery", func() bool { return statusOf(t, s, "a").State == StateRunning })
+	if starts, stops := b.counts(); starts != 1 || stops != 0 {
+		t.Fatalf("failures of a touched b: starts=%d stops=%d", starts, stops)
+	}
+	if st := statusOf(t, s, "b"); st.State != StateRunning || st.Restarts != 0 {
+		t.Fatalf("unexpected status for b: %+v", st)
+	}
+}
+
+func TestManualRestartCancelsPendingRetry(t *testing.T) {
+	a := &fakeComponent{}
+	s := New(Options{InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	comp, report := NewReportingComponent("a", a.start, a.stop)
+	s.Register(comp)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	report(errors.New("lost multicast socket"))
+	waitFor(t, "scheduled retry", func() bool { return statusOf(t, s, "a").NextRestart != nil })
+	if err := s.Restart(context.Background(), "a"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if st := statusOf(t, s, "a"); st.State != StateRunning || st.NextRestart != nil {
+		t.Fatalf("manual restart left a retry pending: %+v", st)
+	}
+}
+
+// timeline records when components start and stop.
+type timeline struct {
+	mu     sync.Mutex
+	starts map[string][2]time.Time
+	stops  []string
+}
+
+func (tl *timeline) component(name string, took time.Duration, opts ...ComponentOption) Component {
+	return NewComponent(name, func(context.Context) error {
+		begin := time.Now()
+		time.Sleep(took)
+		tl.mu.Lock()
+		tl.starts[name] = [2]time.Time{begin, time.Now()}
+		tl.mu.Unlock()
+		return nil
+	}, func(context.Context) error {
+		tl.mu.Lock()
+		tl.stops = append(tl.stops, name)
+		tl.mu.Unlock()
+		return nil
+	}, opts...)
+}
+
+func TestStartFollowsDependencies(t *testing.T) {
+	tl := &timeline{starts: map[string][2]time.Time{}}
+	s := New(Options{})
+	// Dependencies may be registered after the components needing them.
+	s.Register(tl.component("api", 0, DependsOn("store")))
+	s.Register(tl.component("store", 10*time.Millisecond, DependsOn("disk", "network")))
+	s.Register(tl.component("disk", 50*time.Millisecond))
+	s.Register(tl.component("network", 50*time.Millisecond))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	disk, network, store, api := tl.starts["disk"], tl.starts["network"], tl.starts["store"], tl.starts["api"]
+	if !network[0].Before(disk[1]) || !disk[0].Before(network[1]) {
+		t.Fatalf("independent components did not start in parallel: disk %v, network %v", disk, network)
+	}
+	if store[0].Before(disk[1]) || store[0].Before(network[1]) || api[0].Before(store[1]) {
+		t.Fatalf("a component started before its dependencies")
+	}
+	var names []string
+	for _, st := range s.Status() {
+		names = append(names, st.Name)
+		if st.State != StateRunning || st.StartOrder == 0 {
+			t.Fatalf("unexpected status %+v", st)
+		}
+	}
+	if got := strings.Join(names, ","); got != "disk,network,store,api" {
+		t.Fatalf("status order %s", got)
+	}
+	if st := statusOf(t, s, "disk"); st.StartDurationMS < 50 {
+		t.Fatalf("start duration not recorded: %+v", st)
+	}
+	if st := statusOf(t, s, "store"); st.StartOrder != 3 || len(st.DependsOn) != 2 {
+		t.Fatalf("unexpected store status %+v", st)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := strings.Join(tl.stops, ","); got != "api,store,network,disk" {
+		t.Fatalf("stop order %s", got)
+	}
+}
+
+func TestRegisterRejectsCycles(t *testing.T) {
+	register := func(s *Supervisor, c Component) (msg string) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = r.(string)
+			}
+		}()
+		s.Register(c)
+		return ""
+	}
+	s := New(Options{})
+	register(s, NewComponent("a", nil, nil, DependsOn("b")))
+	register(s, NewComponent("b", nil, nil, DependsOn("c")))
+	if msg := register(s, Once(NewComponent("c", nil, nil, DependsOn("a")))); !strings.Contains(msg, "c -> a -> b -> c") {
+		t.Fatalf("expected cycle to be rejected, got %q", msg)
+	}
+	if msg := register(s, NewComponent("self", nil, nil, DependsOn("self"))); !strings.Contains(msg, "self -> self") {
+		t.Fatalf("expected self-dependency to be rejected, got %q", msg)
+	}
+	if msg := register(s, NewComponent("a", nil, nil)); !strings.Contains(msg, "twice") {
+		t.Fatalf("expected duplicate name to be rejected, got %q", msg)
+	}
+	// The cycle never made it in; b still waits for an unregistered c.
+	if err := s.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown component c") {
+		t.Fatalf("expected unknown dependency error, got %v", err)
+	}
+}
+
+// hangingComponent blocks in Start until released.
+type hangingComponent struct {
+	release chan struct{}
+	stopped chan struct{}
+}
+
+func newHangingComponent() *hangingComponent {
+	return &hangingComponent{release: make(chan struct{}), stopped: make(chan struct{}, 1)}
+}
+
+func (h *hangingComponent) start(context.Context) error {
+	<-h.release
+	return nil
+}
+
+func (h *hangingComponent) stop(context.Context) error {
+	h.stopped <- struct{}{}
+	return nil
+}
+
+func TestStartTimeoutFailsOnlyCriticalBoot(t *testing.T) {
+	hang, after, other := newHangingComponent(), &fakeComponent{}, &fakeComponent{}
+	s := New(Options{StartTimeout: time.Hour})
+	s.Register(NewComponent("mdns", hang.start, hang.stop, StartTimeout(20*time.Millisecond)))
+	s.Register(NewComponent("announcer", after.start, after.stop, DependsOn("mdns")))
+	s.Register(NewComponent("store", other.start, other.stop, Critical()))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("a non-critical timeout aborted the boot: %v", err)
+	}
+	if st := statusOf(t, s, "mdns"); st.State != StateFailed || !st.TimedOut || !strings.Contains(st.LastError, "timed out") || st.StartDurationMS != 20 {
+		t.Fatalf("unexpected mdns status %+v", st)
+	}
+	if st := statusOf(t, s, "announcer"); st.State != StateFailed || st.LastError != "dependency mdns is not running" {
+		t.Fatalf("unexpected announcer status %+v", st)
+	}
+	if starts, _ := after.counts(); starts != 0 {
+		t.Fatalf("dependent of a failed component was started")
+	}
+	if st := statusOf(t, s, "store"); st.State != StateRunning {
+		t.Fatalf("unexpected store status %+v", st)
+	}
+	if err := s.Restart(context.Background(), "mdns"); !errors.Is(err, ErrStartPending) {
+		t.Fatalf("expected ErrStartPending, got %v", err)
+	}
+	// A start that returns after its timeout is undone.
+	close(hang.release)
+	select {
+	case <-hang.stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("late start was not stopped")
+	}
+	waitFor(t, "restartable mdns", func() bool { return s.Restart(context.Background(), "mdns") == nil })
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, stops := after.counts(); stops != 0 {
+		t.Fatalf("stop called on a component that never started")
+	}
+
+	hang, first := newHangingComponent(), &fakeComponent{}
+	defer close(hang.release)
+	s = New(Options{StartTimeout: 20 * time.Millisecond})
+	s.Register(NewComponent("first", first.start, first.stop))
+	s.Register(NewComponent("consensus", hang.start, hang.stop, Critical(), DependsOn("first")))
+	if err := s.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "consensus: start timed out") {
+		t.Fatalf("expected a critical timeout to abort the boot, got %v", err)
+	}
+	if starts, stops := first.counts(); starts != 1 || stops != 1 {
+		t.Fatalf("expected started components rolled back, got starts=%d stops=%d", starts, stops)
+	}
+}
@@ -0,0 +1,177 @@
+// Package watchdog keeps the systemd service watchdog satisfied while the
+// daemon's liveness probes pass. When the probes keep failing it stops
+// notifying, so systemd restarts a daemon that is up but wedged.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// DefaultMaxFailures is how many probe rounds in a row may fail before the
+// watchdog stops notifying.
+const DefaultMaxFailures = 3
+
+// Notifier sends a state line to the service manager.
+type Notifier interface {
+	Notify(state string) (bool, error)
+}
+
+// SystemdNotifier notifies systemd over $NOTIFY_SOCKET.
+type SystemdNotifier struct{}
+
+// Notify sends state with sd_notify.
+func (SystemdNotifier) Notify(state string) (bool, error) {
+	return daemon.SdNotify(false, state)
+}
+
+// Probe checks that one part of the daemon still answers. Check should
+// return once ctx is done, but a probe that hangs is still counted as failed.
+type Probe interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// ProbeFunc wraps a check function into a Probe.
+type ProbeFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// NewProbe creates a Probe from a check function.
+func NewProbe(name string, check func(ctx context.Context) error) Probe {
+	return &ProbeFunc{name: name, check: check}
+}
+
+func (p *ProbeFunc) Name() string { return p.name }
+
+func (p *ProbeFunc) Check(ctx context.Context) error { return p.check(ctx) }
+
+// Interval returns the watchdog timeout systemd set for this process
+// through WATCHDOG_USEC, or zero when the watchdog is off.
+func Interval() (time.Duration, error) {
+	return daemon.SdWatchdogEnabled(false)
+}
+
+// Options configures a Watchdog.
+type Options struct {
+	// Interval is the systemd watchdog timeout; the probes run and the
+	// watchdog is notified every half interval.
+	Interval time.Duration
+	Notifier Notifier
+	Probes   []Probe
+	// ProbeTimeout bounds one probe round; zero means a quarter interval.
+	ProbeTimeout time.Duration
+	// MaxFailures is how many failed rounds in a row stop the
+	// notifications; zero means DefaultMaxFailures.
+	MaxFailures int
+}
+
+// Watchdog runs the probes and notifies systemd while they pass.
+type Watchdog struct {
+	opts     Options
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a watchdog; Start begins the notifications.
+func New(opts Options) *Watchdog {
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = opts.Interval / 4
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = DefaultMaxFailures
+	}
+	return &Watchdog{opts: opts, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start runs the watchdog loop in the background.
+func (w *Watchdog) Start() {
+	go w.run()
+}
+
+// Stop ends the loop and waits for it to exit.
+func (w *Watchdog) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// Done is closed once the loop has exited, either through Stop or because
+// the probes kept failing.
+func (w *Watchdog) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.Interval / 2)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		if err := w.check(); err != nil {
+			failures++
+			if failures >= w.opts.MaxFailures {
+				log.Printf("ERROR: watchdog: liveness probes failed %d times in a row; no longer notifying systemd so it restarts piccolod: %v", failures, err)
+				return
+			}
+			// A failed round still notifies; systemd only needs to
+			// hear from us once per interval.
+			log.Printf("WARN: watchdog: liveness probe failed (%d of %d): %v", failures, w.opts.MaxFailures, err)
+		} else if failures > 0 {
+			log.Printf("INFO: watchdog: liveness probes healthy again after %d failures", failures)
+			failures = 0
+		}
+		if _, err := w.opts.Notifier.Notify(daemon.SdNotifyWatchdog); err != nil {
+			log.Printf("WARN: watchdog: notify systemd: %v", err)
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs every probe at once and reports the failures. Each probe runs
+// on its own goroutine so a deadlocked one is caught by the timeout rather
+// than stalling the loop.
+func (w *Watchdog) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.ProbeTimeout)
+	defer cancel()
+	probes := w.opts.Probes
+	results := make([]chan error, len(probes))
+	for i, p := range probes {
+		results[i] = make(chan error, 1)
+		go func(p Probe, out chan<- error) {
+			out <- p.Check(ctx)
+		}(p, results[i])
+	}
+	var failed []string
+	for i, p := range probes {
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-ctx.Done():
+			select {
+			case err = <-results[i]:
+			default:
+				err = fmt.Errorf("no answer within %s", w.opts.ProbeTimeout)
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", p.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
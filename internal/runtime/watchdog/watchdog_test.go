@@ -0,0 +1,150 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (n *recordingNotifier) Notify(state string) (bool, error) {
+	n.mu.Lock()
+	n.states = append(n.states, state)
+	n.mu.Unlock()
+	return true, nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.states)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchdogNotifiesWhileProbesPass(t *testing.T) {
+	notifier := &recordingNotifier{}
+	var checks atomic.Int32
+	w := New(Options{
+		Interval: 40 * time.Millisecond,
+		Notifier: notifier,
+		Probes: []Probe{NewProbe("ok", func(context.Context) error {
+			checks.Add(1)
+			return nil
+		})},
+	})
+	w.Start()
+	defer w.Stop()
+
+	waitFor(t, "three notifications", func() bool { return notifier.count() >= 3 })
+	notifier.mu.Lock()
+	for _, state := range notifier.states {
+		if state != "WATCHDOG=1" {
+			t.Fatalf("unexpected notification %q", state)
+		}
+	}
+	notifier.mu.Unlock()
+	if int(checks.Load()) < notifier.count() {
+		t.Fatalf("notified %d times after only %d probe rounds", notifier.count(), checks.Load())
+	}
+}
+
+func TestWatchdogStopsNotifyingWhenProbesKeepFailing(t *testing.T) {
+	notifier := &recordingNotifier{}
+	var broken atomic.Bool
+	hang := make(chan struct{})
+	defer close(hang)
+	w := New(Options{
+		Interval:     40 * time.Millisecond,
+		ProbeTimeout: 10 * time.Millisecond,
+		MaxFailures:  2,
+		Notifier:     notifier,
+		Probes: []Probe{
+			NewProbe("events", func(context.Context) error {
+				if broken.Load() {
+					return errors.New("ping not delivered")
+				}
+				return nil
+			}),
+			// A deadlocked probe that ignores its context.
+			NewProbe("dispatcher", func(context.Context) error {
+				if broken.Load() {
+					<-hang
+				}
+				return nil
+			}),
+		},
+	})
+	w.Start()
+	defer w.Stop()
+
+	waitFor(t, "a healthy notification", func() bool { return notifier.count() >= 1 })
+	broken.Store(true)
+	select {
+	case <-w.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("watchdog kept running with failing probes")
+	}
+	notified := notifier.count()
+	time.Sleep(60 * time.Millisecond)
+	if got := notifier.count(); got != notified {
+		t.Fatalf("notified after giving up: %d -> %d", notified, got)
+	}
+}
+
+func TestWatchdogRecoversFromASingleFailure(t *testing.T) {
+	notifier := &recordingNotifier{}
+	var rounds atomic.Int32
+	w := New(Options{
+		Interval:    40 * time.Millisecond,
+		MaxFailures: 2,
+		Notifier:    notifier,
+		Probes: []Probe{NewProbe("flaky", func(context.Context) error {
+			// Every other round fails, which never reaches two in a row.
+			if rounds.Add(1)%2 == 0 {
+				return errors.New("slow")
+			}
+			return nil
+		})},
+	})
+	w.Start()
+	defer w.Stop()
+
+	waitFor(t, "five rounds", func() bool { return rounds.Load() >= 5 })
+	select {
+	case <-w.Done():
+		t.Fatalf("watchdog gave up on isolated failures")
+	default:
+	}
+	if notifier.count() < 4 {
+		t.Fatalf("expected failed rounds to still notify, got %d notifications", notifier.count())
+	}
+}
+
+func TestIntervalFromEnvironment(t *testing.T) {
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	if d, err := Interval(); err != nil || d != 0 {
+		t.Fatalf("expected no watchdog without WATCHDOG_USEC, got %s err=%v", d, err)
+	}
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	if d, err := Interval(); err != nil || d != 30*time.Second {
+		t.Fatalf("expected 30s, got %s err=%v", d, err)
+	}
+}
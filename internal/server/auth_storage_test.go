@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"piccolod/internal/auth"
 	"piccolod/internal/persistence"
@@ -17,6 +18,7 @@ type fakeAuthRepo struct {
 	loadErr     error
 	saveErr     error
 	staleness   persistence.AuthStaleness
+	setupAt     time.Time
 }
 
 func (f *fakeAuthRepo) IsInitialized(ctx context.Context) (bool, error) {
@@ -80,6 +82,21 @@ func (f *fakeAuthRepo) UpdateStaleness(ctx context.Context, update persistence.A
 	return nil
 }
 
+func (f *fakeAuthRepo) SetupCompletedAt(ctx context.Context) (time.Time, error) {
+	if f.loadErr != nil {
+		return time.Time{}, f.loadErr
+	}
+	return f.setupAt, nil
+}
+
+func (f *fakeAuthRepo) MarkSetupComplete(ctx context.Context, at time.Time) error {
+	if f.saveErr != nil {
+		return f.saveErr
+	}
+	f.setupAt = at
+	return nil
+}
+
 func TestPersistenceAuthStorage_LoadAndSave(t *testing.T) {
 	repo := &fakeAuthRepo{hash: "argon2", initialized: true}
 	storage := newPersistenceAuthStorage(repo)
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/events"
+	"piccolod/internal/health"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+// IDs of the core volumes the server is wired to at startup.
+const (
+	volumeControl   = "control"
+	volumeBootstrap = "bootstrap"
+)
+
+// coreVolumes records where the core volumes are mounted and why any of
+// them could not be used. A missing or read-only volume degrades the
+// server instead of stopping it, so the unlock UI stays reachable.
+type coreVolumes struct {
+	mu          sync.Mutex
+	dirs        map[string]string
+	unavailable map[string]string
+}
+
+func (v *coreVolumes) set(id, dir string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.dirs == nil {
+		v.dirs = make(map[string]string)
+		v.unavailable = make(map[string]string)
+	}
+	if err != nil {
+		delete(v.dirs, id)
+		v.unavailable[id] = err.Error()
+		return
+	}
+	v.dirs[id] = dir
+	delete(v.unavailable, id)
+}
+
+func (v *coreVolumes) dir(id string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.dirs[id]
+}
+
+func (v *coreVolumes) pending(id string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.unavailable[id]
+	return ok
+}
+
+// problems lists the unavailable volumes as "id: reason", sorted.
+func (v *coreVolumes) problems() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := make([]string, 0, len(v.unavailable))
+	for id, reason := range v.unavailable {
+		out = append(out, id+": "+reason)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkVolumeDir reports why dir cannot hold a core volume: it is unset,
+// missing, or refuses writes.
+func checkVolumeDir(dir string) error {
+	if strings.TrimSpace(dir) == "" {
+		return errors.New("volume mount unavailable")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".piccolo-write-check-*")
+	if err != nil {
+		return fmt.Errorf("volume is read-only: %w", err)
+	}
+	name := probe.Name()
+	probe.Close()
+	return os.Remove(name)
+}
+
+// checkCoreVolume records whether the core volume id can be used at dir and
+// updates the storage health component.
+func (s *GinServer) checkCoreVolume(id, dir string) bool {
+	err := checkVolumeDir(dir)
+	if err != nil {
+		log.Printf("WARN: %s volume unavailable: %v", id, err)
+	}
+	s.coreVolumes.set(id, dir, err)
+	s.reportCoreVolumes()
+	return err == nil
+}
+
+func (s *GinServer) reportCoreVolumes() {
+	if s.healthTracker == nil {
+		return
+	}
+	if problems := s.coreVolumes.problems(); len(problems) > 0 {
+		s.healthTracker.Set("storage", health.Status{
+			Level:   health.LevelError,
+			Message: "core volumes unavailable: " + strings.Join(problems, "; "),
+			Details: map[string]any{"unavailable": problems},
+		})
+		return
+	}
+	s.healthTracker.Setf("storage", health.LevelOK, "core volumes mounted")
+}
+
+// remoteRepo is the control-store half of the remote config, or nil when
+// persistence is not wired.
+func (s *GinServer) remoteRepo() persistence.RemoteRepo {
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().Remote()
+}
+
+// wireCoreVolumes points the app state at the control volume and starts
+// the remote manager on the bootstrap volume. Either may be unavailable;
+// observeCoreVolumes finishes the wiring once it is mounted.
+func (s *GinServer) wireCoreVolumes() error {
+	if dir := s.persistence.ControlVolume().MountDir; s.checkCoreVolume(volumeControl, dir) {
+		// Apps installed under the state root before app state moved into the
+		// control volume are migrated on the first unlocked load (see
+		// app.migrateLegacyState).
+		s.appManager.SetStateBaseDir(dir)
+	} else {
+		// Not the legacy state root: an unlock meanwhile must not load or
+		// migrate app state from there.
+		s.appManager.ClearStateBaseDir()
+	}
+	var (
+		rm  *remote.Manager
+		err error
+	)
+	if dir := s.persistence.BootstrapVolume().MountDir; s.checkCoreVolume(volumeBootstrap, dir) {
+		rm, err = remote.NewManagerWithStorage(newBootstrapRemoteStorage(s.remoteRepo(), dir), dir)
+	} else {
+		rm, err = remote.NewManagerWithoutStorage(strings.Join(s.coreVolumes.problems(), "; "))
+	}
+	if err != nil {
+		return fmt.Errorf("remote manager init: %w", err)
+	}
+	s.remoteManager = rm
+	return nil
+}
+
+// coreVolumeMounted finishes wiring a core volume that was unavailable at
+// startup; requests needing it are refused until that is done. Once every
+// core volume is in place, services of apps that kept running are restored
+// as after a restart.
+func (s *GinServer) coreVolumeMounted(id, dir string) {
+	if !s.coreVolumes.pending(id) {
+		return
+	}
+	if err := checkVolumeDir(dir); err != nil {
+		log.Printf("WARN: %s volume reported mounted but unusable: %v", id, err)
+		return
+	}
+	log.Printf("INFO: %s volume mounted at %s; finishing startup wiring", id, dir)
+	switch id {
+	case volumeControl:
+		s.appManager.SetStateBaseDir(dir)
+		if s.cryptoManager != nil && !s.cryptoManager.IsLocked() && s.remoteManager != nil {
+			if err := s.remoteManager.SetEncryptedRoot(dir); err != nil {
+				log.Printf("WARN: move certificates into the control volume: %v", err)
+			}
+		}
+	case volumeBootstrap:
+		if err := s.remoteManager.AttachStorage(newBootstrapRemoteStorage(s.remoteRepo(), dir), dir); err != nil {
+			log.Printf("WARN: remote storage attach: %v", err)
+		}
+		if s.healthTracker != nil {
+			s.healthTracker.Setf("remote", health.LevelOK, "remote manager ready")
+		}
+		s.refreshRemoteRuntime()
+	}
+	s.coreVolumes.set(id, dir, nil)
+	s.reportCoreVolumes()
+	if len(s.coreVolumes.problems()) == 0 {
+		s.appManager.RestoreServices(context.Background())
+	}
+}
+
+// observeCoreVolumes retries the wiring of unavailable core volumes when
+// the volume manager reports them mounted.
+func (s *GinServer) observeCoreVolumes(bus *events.Bus) {
+	if bus == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicVolumeStateChanged, 16)
+	go func() {
+		for evt := range ch {
+			payload, ok := evt.Payload.(events.VolumeStateChanged)
+			if !ok || payload.Observed != "mounted" {
+				continue
+			}
+			s.coreVolumeMounted(payload.ID, payload.MountDir)
+		}
+	}()
+}
+
+// requireStorage refuses requests that need a core volume the server
+// started without.
+func (s *GinServer) requireStorage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if problems := s.coreVolumes.problems(); len(problems) > 0 {
+			env := newErrorEnvelope(c, errorCodeStorageUnavailable,
+				"storage unavailable: "+strings.Join(problems, "; "), gin.H{"unavailable": problems})
+			env.Error.Hint = "Check the disk holding the Piccolo state directory; Piccolo resumes once the volume mounts."
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, env)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+	"piccolod/internal/remote/nexusclient"
+)
+
+// volumePersistence reports fixed core volume handles and no control store.
+type volumePersistence struct {
+	persistence.Service
+	control, bootstrap persistence.VolumeHandle
+}
+
+func (p *volumePersistence) ControlVolume() persistence.VolumeHandle   { return p.control }
+func (p *volumePersistence) BootstrapVolume() persistence.VolumeHandle { return p.bootstrap }
+func (p *volumePersistence) Control() persistence.ControlStore         { return nil }
+
+func TestCoreVolumes_StartsDegradedAndRecoversWhenBootstrapMounts(t *testing.T) {
+	dir := t.TempDir()
+	srv := createGinTestServer(t, dir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	controlDir := filepath.Join(dir, "mounts", "control")
+	if err := os.MkdirAll(controlDir, 0o700); err != nil {
+		t.Fatalf("control dir: %v", err)
+	}
+	srv.persistence = &volumePersistence{
+		control:   persistence.VolumeHandle{ID: volumeControl, MountDir: controlDir},
+		bootstrap: persistence.VolumeHandle{ID: volumeBootstrap},
+	}
+	if err := srv.wireCoreVolumes(); err != nil {
+		t.Fatalf("wire core volumes: %v", err)
+	}
+	srv.remoteManager.SetNexusAdapter(nexusclient.NewStub())
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+	t.Cleanup(func() { _ = srv.remoteManager.Close(context.Background()) })
+	srv.observeCoreVolumes(srv.events)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/api/v1/health/ready"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ready":false`) {
+		t.Fatalf("readiness while degraded: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/crypto/status"); w.Code != http.StatusOK {
+		t.Fatalf("crypto status while degraded: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/remote/status"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"state":"storage_unavailable"`) {
+		t.Fatalf("remote status while degraded: %d body=%s", w.Code, w.Body.String())
+	}
+	for _, req := range [][2]string{{http.MethodGet, "/api/v1/apps"}, {http.MethodPost, "/api/v1/remote/disable"}} {
+		if w := do(req[0], req[1]); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), errorCodeStorageUnavailable) {
+			t.Fatalf("%s %s while degraded: %d body=%s", req[0], req[1], w.Code, w.Body.String())
+		}
+	}
+
+	// The bootstrap remote storage only writes inside a mounted volume.
+	bootstrapDir := filepath.Join(dir, "mounts", "bootstrap")
+	if err := os.MkdirAll(filepath.Join(bootstrapDir, ".cipher"), 0o700); err != nil {
+		t.Fatalf("bootstrap dir: %v", err)
+	}
+	srv.events.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{
+		ID: volumeBootstrap, MountDir: bootstrapDir, Observed: "mounted",
+	}})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.coreVolumes.problems()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bootstrap volume never wired: %v", srv.coreVolumes.problems())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if w := do(http.MethodGet, "/api/v1/remote/status"); strings.Contains(w.Body.String(), "storage_unavailable") {
+		t.Fatalf("remote status after mount: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/apps"); w.Code != http.StatusOK {
+		t.Fatalf("apps after mount: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/remote/disable"); w.Code != http.StatusOK {
+		t.Fatalf("remote disable after mount: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/health/ready"); !strings.Contains(w.Body.String(), `"ready":true`) {
+		t.Fatalf("readiness after mount: %d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestCheckVolumeDirRefusesReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0o700) })
+	if err := checkVolumeDir(dir); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if err := checkVolumeDir(""); err == nil {
+		t.Fatalf("expected empty mount dir refused")
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/remote"
+	"piccolod/internal/remote/acme"
+)
+
+// handleRemoteACMEAccount: GET /api/v1/remote/acme/account
+func (s *GinServer) handleRemoteACMEAccount(c *gin.Context) {
+	info, err := s.remoteManager.ACMEAccount()
+	if err != nil {
+		writeACMEAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"account": info})
+}
+
+// handleRemoteACMEAccountRotate: POST /api/v1/remote/acme/account/rotate
+func (s *GinServer) handleRemoteACMEAccountRotate(c *gin.Context) {
+	var info acme.AccountInfo
+	var err error
+	if s.dispatcher != nil {
+		var resp any
+		resp, err = s.dispatcher.Dispatch(c.Request.Context(), remote.RotateACMEKeyCommand{})
+		if r, ok := resp.(remote.RotateACMEKeyResponse); ok {
+			info = r.Account
+		}
+	} else {
+		info, err = s.remoteManager.RotateACMEAccountKey(c.Request.Context())
+	}
+	if err != nil {
+		writeACMEAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"account": info})
+}
+
+func writeACMEAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, remote.ErrNoACMEAccount):
+		writeGinError(c, http.StatusNotFound, "no ACME account registered yet; one is created with the first certificate")
+	case errors.Is(err, remote.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+	default:
+		writeGinError(c, http.StatusBadGateway, err.Error())
+	}
+}
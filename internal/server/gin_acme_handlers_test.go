@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"piccolod/internal/remote"
+)
+
+func TestRemoteACMEAccount_NotFoundBeforeRegistration(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/remote/acme/account"},
+		{http.MethodPost, "/api/v1/remote/acme/account/rotate"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: expected 404, got %d body=%s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/health"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+const (
+	defaultActivityPageSize = 50
+	maxActivityPageSize     = 500
+)
+
+// attachActivityLog wires the activity service into the subsystems that emit
+// records and starts observing bus topics.
+func (s *GinServer) attachActivityLog(act *activity.Service) {
+	if act == nil {
+		return
+	}
+	s.activity = act
+	if s.healthTracker != nil {
+		s.healthTracker.SetTransitionHook(func(tr health.Transition) {
+			level := activity.LevelInfo
+			if tr.To == health.LevelError || tr.Flapping {
+				level = activity.LevelWarn
+			}
+			msg := fmt.Sprintf("Health of %s changed from %s to %s: %s", tr.Component, tr.From, tr.To, tr.Message)
+			if tr.Flapping {
+				msg += " (flapping)"
+			}
+			act.Record(context.Background(), activity.Entry{
+				Time:     tr.At,
+				Source:   "health",
+				Level:    level,
+				Message:  msg,
+				Metadata: map[string]any{"component": tr.Component, "from": tr.From.String(), "to": tr.To.String(), "flapping": tr.Flapping},
+			})
+		})
+	}
+	if s.appManager != nil {
+		s.appManager.SetActivityRecorder(act)
+	}
+	if s.remoteManager != nil {
+		s.remoteManager.SetActivitySink(func(evt remote.Event) {
+			var meta map[string]any
+			if evt.NextStep != "" {
+				meta = map[string]any{"next_step": evt.NextStep}
+			}
+			act.Record(context.Background(), activity.Entry{
+				Time:     evt.Timestamp,
+				Source:   evt.Source,
+				Level:    evt.Level,
+				Message:  evt.Message,
+				Metadata: meta,
+			})
+		})
+	}
+	act.Observe(s.events)
+}
+
+// recordActivity adds an explicit entry attributed to the requesting client.
+func (s *GinServer) recordActivity(c *gin.Context, source, level, message string) {
+	if s.activity == nil {
+		return
+	}
+	meta := map[string]any{"client": requestClientIP(c)}
+	if tok, ok := apiTokenFromContext(c); ok {
+		meta["token"] = tok.Name
+	}
+	s.activity.Record(c.Request.Context(), activity.Entry{
+		Source:   source,
+		Level:    level,
+		Message:  message,
+		Metadata: meta,
+	})
+}
+
+// handleActivityList: GET /api/v1/activity
+func (s *GinServer) handleActivityList(c *gin.Context) {
+	if s.activity == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "activity log unavailable")
+		return
+	}
+	q := activity.Query{
+		Source: strings.TrimSpace(c.Query("source")),
+		Level:  strings.TrimSpace(c.Query("level")),
+		Limit:  defaultActivityPageSize,
+	}
+	if raw := strings.TrimSpace(c.Query("since")); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeGinError(c, http.StatusBadRequest, "since must be an RFC3339 timestamp")
+			return
+		}
+		q.Since = since
+	}
+	if raw := strings.TrimSpace(c.Query("before")); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			writeGinError(c, http.StatusBadRequest, "before must be a positive entry id")
+			return
+		}
+		q.Before = before
+	}
+	if raw := strings.TrimSpace(c.Query("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			writeGinError(c, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if limit > maxActivityPageSize {
+			limit = maxActivityPageSize
+		}
+		q.Limit = limit
+	}
+
+	entries, err := s.activity.List(c.Request.Context(), q)
+	if err != nil {
+		if errors.Is(err, persistence.ErrLocked) {
+			writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+			return
+		}
+		writeGinError(c, http.StatusInternalServerError, "failed to read activity log")
+		return
+	}
+	resp := gin.H{"entries": entries}
+	if len(entries) == q.Limit {
+		resp["next_before"] = entries[len(entries)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
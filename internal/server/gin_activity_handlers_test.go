@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/events"
+	"piccolod/internal/health"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+	"piccolod/internal/runtime/commands"
+)
+
+type memoryActivityRepo struct {
+	mu      sync.Mutex
+	locked  bool
+	nextID  int64
+	records []persistence.ActivityRecord
+}
+
+func (m *memoryActivityRepo) setLocked(locked bool) {
+	m.mu.Lock()
+	m.locked = locked
+	m.mu.Unlock()
+}
+
+func (m *memoryActivityRepo) AppendActivity(ctx context.Context, record persistence.ActivityRecord) (persistence.ActivityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked {
+		return record, persistence.ErrLocked
+	}
+	m.nextID++
+	record.ID = m.nextID
+	m.records = append(m.records, record)
+	return record, nil
+}
+
+func (m *memoryActivityRepo) ListActivity(ctx context.Context, query persistence.ActivityQuery) ([]persistence.ActivityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked {
+		return nil, persistence.ErrLocked
+	}
+	var out []persistence.ActivityRecord
+	for i := len(m.records) - 1; i >= 0; i-- {
+		rec := m.records[i]
+		if query.Source != "" && rec.Source != query.Source {
+			continue
+		}
+		if query.Level != "" && rec.Level != query.Level {
+			continue
+		}
+		if !query.Since.IsZero() && rec.Time.Before(query.Since) {
+			continue
+		}
+		if query.BeforeID > 0 && rec.ID >= query.BeforeID {
+			continue
+		}
+		out = append(out, rec)
+		if query.Limit > 0 && len(out) == query.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryActivityRepo) PruneActivity(ctx context.Context, policy persistence.ActivityRetention) (int, error) {
+	return 0, nil
+}
+
+func (m *memoryActivityRepo) hasMessage(msg string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range m.records {
+		if rec.Message == msg {
+			return true
+		}
+	}
+	return false
+}
+
+type activityListResponse struct {
+	Entries    []activity.Entry `json:"entries"`
+	NextBefore int64            `json:"next_before"`
+}
+
+func fetchActivity(t *testing.T, srv *GinServer, cookie *http.Cookie, csrf, query string) activityListResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/activity"+query, nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("activity%s: %d body=%s", query, w.Code, w.Body.String())
+	}
+	var resp activityListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode activity: %v", err)
+	}
+	return resp
+}
+
+func TestActivity_InstallLockRemoteSequence(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	if err := srv.cryptoManager.Setup("TestPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+	if err := srv.cryptoManager.Unlock("TestPass123!"); err != nil {
+		t.Fatalf("crypto unlock: %v", err)
+	}
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+
+	repo := &memoryActivityRepo{}
+	srv.dispatcher.Use(func(ctx context.Context, cmd commands.Command, next commands.Handler) (commands.Response, error) {
+		if record, ok := cmd.(persistence.RecordLockStateCommand); ok {
+			repo.setLocked(record.Locked)
+			srv.events.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: record.Locked}})
+		}
+		return next.Handle(ctx, cmd)
+	})
+	srv.attachActivityLog(activity.NewService(repo))
+
+	payload := "name: blog\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: web\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("install: %d body=%s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/crypto/lock", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("lock: %d body=%s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/crypto/unlock", strings.NewReader(`{"password":"TestPass123!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d body=%s", w.Code, w.Body.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !repo.hasMessage("Storage unlocked") {
+		if time.Now().After(deadline) {
+			t.Fatalf("lock transitions never reached the activity log")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"endpoint":        "wss://nexus.example.com/connect",
+		"device_secret":   "super-secret",
+		"solver":          "http-01",
+		"tld":             "example.com",
+		"portal_hostname": "portal.example.com",
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/remote/configure", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("remote configure: %d body=%s", w.Code, w.Body.String())
+	}
+
+	resp := fetchActivity(t, srv, cookie, csrf, "")
+	want := []string{"App blog installed", "Storage locked", "Storage unlocked", "Remote configuration saved"}
+	idx := 0
+	for i := len(resp.Entries) - 1; i >= 0 && idx < len(want); i-- {
+		if resp.Entries[i].Message == want[idx] {
+			idx++
+		}
+	}
+	if idx != len(want) {
+		var got []string
+		for _, e := range resp.Entries {
+			got = append(got, e.Message)
+		}
+		t.Fatalf("expected ordered entries %v (oldest first), got newest-first %v", want, got)
+	}
+
+	remoteOnly := fetchActivity(t, srv, cookie, csrf, "?source=remote")
+	if len(remoteOnly.Entries) == 0 {
+		t.Fatalf("expected remote entries")
+	}
+	for _, e := range remoteOnly.Entries {
+		if e.Source != "remote" {
+			t.Fatalf("source filter leaked %+v", e)
+		}
+	}
+	warns := fetchActivity(t, srv, cookie, csrf, "?level=warn")
+	if len(warns.Entries) != 1 || warns.Entries[0].Message != "Storage locked" {
+		t.Fatalf("unexpected warn entries: %+v", warns.Entries)
+	}
+
+	page := fetchActivity(t, srv, cookie, csrf, "?limit=2")
+	if len(page.Entries) != 2 || page.NextBefore != page.Entries[1].ID {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	next := fetchActivity(t, srv, cookie, csrf, "?limit=2&before="+strconv.FormatInt(page.NextBefore, 10))
+	if len(next.Entries) == 0 || next.Entries[0].ID >= page.NextBefore {
+		t.Fatalf("unexpected second page: %+v", next)
+	}
+}
+
+func TestActivity_RejectsBadQuery(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.attachActivityLog(activity.NewService(&memoryActivityRepo{}))
+
+	for _, q := range []string{"?since=yesterday", "?limit=0", "?before=abc"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/activity"+q, nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestHealthHistory_ReportsFlappingAndActivity(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	repo := &memoryActivityRepo{}
+	srv.attachActivityLog(activity.NewService(repo))
+
+	srv.healthTracker.Setf("remote", health.LevelOK, "connected")
+	for i := 0; i < 5; i++ {
+		level := health.LevelError
+		if i%2 == 1 {
+			level = health.LevelOK
+		}
+		srv.healthTracker.Setf("remote", level, "reconnect "+strconv.Itoa(i))
+	}
+
+	get := func(path string, out any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d body=%s", path, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+	var history struct {
+		Transitions []struct {
+			Component string `json:"component"`
+			From      string `json:"from"`
+			To        string `json:"to"`
+			Flapping  bool   `json:"flapping"`
+		} `json:"transitions"`
+	}
+	get("/api/v1/health/history?component=remote", &history)
+	if len(history.Transitions) != 5 {
+		t.Fatalf("expected 5 transitions, got %+v", history.Transitions)
+	}
+	last := history.Transitions[4]
+	if last.Component != "remote" || last.From != "ok" || last.To != "error" || !last.Flapping {
+		t.Fatalf("unexpected last transition %+v", last)
+	}
+
+	var detail struct {
+		Components []struct {
+			Name        string `json:"name"`
+			Level       string `json:"level"`
+			Flapping    bool   `json:"flapping"`
+			Transitions int    `json:"transitions"`
+		} `json:"components"`
+	}
+	get("/api/v1/health/detail", &detail)
+	found := false
+	for _, c := range detail.Components {
+		if c.Name == "remote" {
+			found = true
+			if c.Level != "error" || !c.Flapping || c.Transitions != 5 {
+				t.Fatalf("unexpected remote component %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("remote missing from health detail: %+v", detail.Components)
+	}
+	if !repo.hasMessage("Health of remote changed from ok to error: reconnect 4 (flapping)") {
+		t.Fatalf("flapping transition missing from the activity log: %+v", repo.records)
+	}
+}
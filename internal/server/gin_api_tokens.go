@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	authpkg "piccolod/internal/auth"
+	"piccolod/internal/persistence"
+)
+
+// ctxAPITokenKey holds the persistence.APIToken that authenticated a
+// request.
+const ctxAPITokenKey = "piccolo.api_token"
+
+// Error codes for bearer-token authentication.
+const (
+	errorCodeTokenInvalid = "token_invalid"
+	errorCodeTokenExpired = "token_expired"
+	errorCodeTokenScope   = "token_scope"
+)
+
+// maxAPITokenName bounds the label shown in the token list and activity log.
+const maxAPITokenName = 64
+
+// apiTokenPayload is the JSON form of a stored token; the secret is never
+// part of it.
+type apiTokenPayload struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newAPITokenPayload(t persistence.APIToken) apiTokenPayload {
+	p := apiTokenPayload{ID: t.ID, Name: t.Name, Scope: t.Scope, CreatedAt: t.CreatedAt}
+	if !t.ExpiresAt.IsZero() {
+		exp := t.ExpiresAt
+		p.ExpiresAt = &exp
+	}
+	if !t.LastUsedAt.IsZero() {
+		used := t.LastUsedAt
+		p.LastUsedAt = &used
+	}
+	return p
+}
+
+// apiTokenRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set apiTokens directly).
+func (s *GinServer) apiTokenRepo() persistence.APITokenRepo {
+	if s.apiTokens != nil {
+		return s.apiTokens
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().APITokens()
+}
+
+// bearerToken returns the token from an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authenticateAPIToken checks a bearer token against the store and its
+// scope against the request method, writing the error response itself when
+// the request must stop.
+func (s *GinServer) authenticateAPIToken(c *gin.Context, secret string) bool {
+	repo := s.apiTokenRepo()
+	if repo == nil {
+		writeGinErrorCode(c, http.StatusUnauthorized, errorCodeTokenInvalid, "api tokens are unavailable")
+		return false
+	}
+	tok, err := repo.TokenByHash(c.Request.Context(), authpkg.HashAPIToken(secret))
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinErrorCode(c, http.StatusLocked, errorCodeLocked, "storage locked; unlock Piccolo to use api tokens")
+		return false
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		writeGinErrorCode(c, http.StatusUnauthorized, errorCodeTokenInvalid, "unknown or revoked api token")
+		return false
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	now := time.Now().UTC()
+	if !tok.ExpiresAt.IsZero() && !now.Before(tok.ExpiresAt) {
+		writeGinErrorCode(c, http.StatusUnauthorized, errorCodeTokenExpired, "api token expired")
+		return false
+	}
+	if !authpkg.ScopeAllows(tok.Scope, c.Request.Method) {
+		writeGinErrorCode(c, http.StatusForbidden, errorCodeTokenScope, fmt.Sprintf("token %q is %s", tok.Name, tok.Scope))
+		return false
+	}
+	// Followers cannot write; a missed last-used stamp is not worth failing
+	// the request for.
+	if err := repo.TouchToken(c.Request.Context(), tok.ID, now); err != nil && !errors.Is(err, persistence.ErrNotLeader) {
+		log.Printf("WARN: api token %s: record use: %v", tok.ID, err)
+	}
+	tok.LastUsedAt = now
+	c.Set(ctxAPITokenKey, tok)
+	return true
+}
+
+// apiTokenFromContext returns the token that authenticated c, if any.
+func apiTokenFromContext(c *gin.Context) (persistence.APIToken, bool) {
+	v, ok := c.Get(ctxAPITokenKey)
+	if !ok {
+		return persistence.APIToken{}, false
+	}
+	tok, ok := v.(persistence.APIToken)
+	return tok, ok
+}
+
+// recordAPITokenRequest logs a state-changing token request under source
+// "api_token", the way cliAccessMiddleware logs CLI requests.
+func (s *GinServer) recordAPITokenRequest(c *gin.Context, tok persistence.APIToken) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	if s.activity == nil {
+		return
+	}
+	level := activity.LevelInfo
+	if c.Writer.Status() >= http.StatusBadRequest {
+		level = activity.LevelWarn
+	}
+	s.activity.Record(context.WithoutCancel(c.Request.Context()), activity.Entry{
+		Source:  "api_token",
+		Level:   level,
+		Message: fmt.Sprintf("API token %q: %s %s returned %d", tok.Name, c.Request.Method, c.Request.URL.Path, c.Writer.Status()),
+		Metadata: map[string]any{
+			"client": requestClientIP(c),
+			"token":  tok.Name,
+			"status": c.Writer.Status(),
+		},
+	})
+}
+
+// requireBrowserSession keeps token management, password changes, recovery
+// keys and locking to signed-in admins, so a leaked token cannot mint or
+// revoke others, take over the admin account or lock the device.
+func (s *GinServer) requireBrowserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := apiTokenFromContext(c); ok {
+			writeGinErrorCode(c, http.StatusForbidden, errorCodeTokenScope, "api tokens cannot manage credentials")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func newAPITokenID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeAPITokenStoreError maps repository errors onto responses.
+func writeAPITokenStoreError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+	case errors.Is(err, persistence.ErrNotFound):
+		writeGinError(c, http.StatusNotFound, "token not found")
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// handleAPITokenList: GET /api/v1/auth/tokens
+func (s *GinServer) handleAPITokenList(c *gin.Context) {
+	repo := s.apiTokenRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "api token storage unavailable")
+		return
+	}
+	tokens, err := repo.ListTokens(c.Request.Context())
+	if err != nil && !errors.Is(err, persistence.ErrNotImplemented) {
+		writeAPITokenStoreError(c, err)
+		return
+	}
+	out := make([]apiTokenPayload, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, newAPITokenPayload(t))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": out})
+}
+
+// handleAPITokenCreate: POST /api/v1/auth/tokens
+func (s *GinServer) handleAPITokenCreate(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name"`
+		Scope     string     `json:"scope"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPITokenName {
+		writeGinError(c, http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", maxAPITokenName))
+		return
+	}
+	if !authpkg.ValidScope(req.Scope) {
+		writeGinError(c, http.StatusBadRequest, fmt.Sprintf("scope must be %s or %s", authpkg.ScopeReadOnly, authpkg.ScopeReadWrite))
+		return
+	}
+	now := time.Now().UTC()
+	tok := persistence.APIToken{Name: name, Scope: req.Scope, CreatedAt: now}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			writeGinError(c, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		tok.ExpiresAt = req.ExpiresAt.UTC()
+	}
+	repo := s.apiTokenRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "api token storage unavailable")
+		return
+	}
+	id, err := newAPITokenID()
+	if err != nil {
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	secret, hash, err := authpkg.NewAPIToken()
+	if err != nil {
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tok.ID, tok.Hash = id, hash
+	if err := repo.CreateToken(c.Request.Context(), tok); err != nil {
+		writeAPITokenStoreError(c, err)
+		return
+	}
+	s.recordActivity(c, "auth", activity.LevelInfo, fmt.Sprintf("API token %q created (%s)", name, tok.Scope))
+	c.JSON(http.StatusCreated, gin.H{"token": newAPITokenPayload(tok), "secret": secret})
+}
+
+// handleAPITokenDelete: DELETE /api/v1/auth/tokens/:id
+func (s *GinServer) handleAPITokenDelete(c *gin.Context) {
+	repo := s.apiTokenRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "api token storage unavailable")
+		return
+	}
+	id := c.Param("id")
+	name := id
+	if tokens, err := repo.ListTokens(c.Request.Context()); err == nil {
+		for _, t := range tokens {
+			if t.ID == id {
+				name = t.Name
+				break
+			}
+		}
+	}
+	if err := repo.DeleteToken(c.Request.Context(), id); err != nil {
+		writeAPITokenStoreError(c, err)
+		return
+	}
+	s.recordActivity(c, "auth", activity.LevelInfo, fmt.Sprintf("API token %q revoked", name))
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
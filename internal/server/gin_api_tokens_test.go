@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/activity"
+	authpkg "piccolod/internal/auth"
+	"piccolod/internal/persistence"
+)
+
+type memoryAPITokenRepo struct {
+	mu     sync.Mutex
+	tokens []persistence.APIToken
+}
+
+func (r *memoryAPITokenRepo) ListTokens(ctx context.Context) ([]persistence.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]persistence.APIToken(nil), r.tokens...), nil
+}
+
+func (r *memoryAPITokenRepo) TokenByHash(ctx context.Context, hash string) (persistence.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return persistence.APIToken{}, persistence.ErrNotFound
+}
+
+func (r *memoryAPITokenRepo) CreateToken(ctx context.Context, token persistence.APIToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryAPITokenRepo) DeleteToken(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.tokens {
+		if t.ID == id {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return persistence.ErrNotFound
+}
+
+func (r *memoryAPITokenRepo) TouchToken(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.tokens {
+		if r.tokens[i].ID == id {
+			r.tokens[i].LastUsedAt = at
+		}
+	}
+	return nil
+}
+
+type createdAPIToken struct {
+	Token  apiTokenPayload `json:"token"`
+	Secret string          `json:"secret"`
+}
+
+func createAPIToken(t *testing.T, srv *GinServer, cookie *http.Cookie, csrf, body string) createdAPIToken {
+	t.Helper()
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/auth/tokens", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp createdAPIToken
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp
+}
+
+// doBearerRequest sends a request authenticated only by an API token: no
+// session cookie and no CSRF header.
+func doBearerRequest(srv *GinServer, secret, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func newAPITokenTestServer(t *testing.T) (*GinServer, *memoryAPITokenRepo, *memoryActivityRepo, *http.Cookie, string) {
+	t.Helper()
+	tempDir, err := os.MkdirTemp("", "api-tokens")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tempDir) })
+	srv := createGinTestServer(t, tempDir)
+	repo := &memoryAPITokenRepo{}
+	srv.apiTokens = repo
+	srv.sessionPolicies = &memorySessionPolicyRepo{}
+	acts := &memoryActivityRepo{}
+	srv.attachActivityLog(activity.NewService(acts))
+	cookie, csrf := setupTestAdminSession(t, srv)
+	return srv, repo, acts, cookie, csrf
+}
+
+func TestAPITokens_CreateStoresOnlyHash(t *testing.T) {
+	srv, repo, _, cookie, csrf := newAPITokenTestServer(t)
+
+	for _, body := range []string{
+		`{"name":"","scope":"read-only"}`,
+		`{"name":"x","scope":"admin"}`,
+		`{"name":"x","scope":"read-only","expires_at":"2001-01-01T00:00:00Z"}`,
+	} {
+		if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/auth/tokens", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	created := createAPIToken(t, srv, cookie, csrf, `{"name":"backup script","scope":"read-write","expires_at":"2099-01-01T00:00:00Z"}`)
+	if !strings.HasPrefix(created.Secret, "pct_") || created.Token.Name != "backup script" || created.Token.ExpiresAt == nil {
+		t.Fatalf("unexpected create response %+v", created)
+	}
+	stored, _ := repo.ListTokens(context.Background())
+	if len(stored) != 1 {
+		t.Fatalf("expected one stored token, got %+v", stored)
+	}
+	if stored[0].Hash != authpkg.HashAPIToken(created.Secret) {
+		t.Fatalf("stored hash does not match secret")
+	}
+	for _, field := range []string{stored[0].ID, stored[0].Name, stored[0].Hash, stored[0].Scope} {
+		if strings.Contains(field, strings.TrimPrefix(created.Secret, "pct_")) {
+			t.Fatalf("secret persisted in token record: %+v", stored[0])
+		}
+	}
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/tokens", "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Secret) || strings.Contains(w.Body.String(), stored[0].Hash) {
+		t.Fatalf("list leaked credentials or failed: %d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"backup script"`) {
+		t.Fatalf("list missing token: %s", w.Body.String())
+	}
+}
+
+func TestAPITokens_ScopeAndRevocation(t *testing.T) {
+	srv, repo, acts, cookie, csrf := newAPITokenTestServer(t)
+	ro := createAPIToken(t, srv, cookie, csrf, `{"name":"dashboard","scope":"read-only"}`)
+	rw := createAPIToken(t, srv, cookie, csrf, `{"name":"automation","scope":"read-write"}`)
+	policy := `{"idle_timeout_seconds":3600,"max_lifetime_seconds":86400}`
+
+	if w := doBearerRequest(srv, ro.Secret, http.MethodGet, "/api/v1/auth/session-policy", ""); w.Code != http.StatusOK {
+		t.Fatalf("read-only GET: %d body=%s", w.Code, w.Body.String())
+	}
+	w := doBearerRequest(srv, ro.Secret, http.MethodPut, "/api/v1/auth/session-policy", policy)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), errorCodeTokenScope) {
+		t.Fatalf("read-only PUT: expected 403, got %d body=%s", w.Code, w.Body.String())
+	}
+	// Token requests skip CSRF.
+	if w := doBearerRequest(srv, rw.Secret, http.MethodPut, "/api/v1/auth/session-policy", policy); w.Code != http.StatusOK {
+		t.Fatalf("read-write PUT: %d body=%s", w.Code, w.Body.String())
+	}
+	if !acts.hasMessage(`API token "automation": PUT /api/v1/auth/session-policy returned 200`) {
+		t.Fatalf("token use missing from activity log: %+v", acts.records)
+	}
+	if tok, _ := repo.TokenByHash(context.Background(), authpkg.HashAPIToken(rw.Secret)); tok.LastUsedAt.IsZero() {
+		t.Fatalf("last_used not recorded: %+v", tok)
+	}
+
+	// Tokens cannot manage tokens.
+	if w := doBearerRequest(srv, rw.Secret, http.MethodPost, "/api/v1/auth/tokens", `{"name":"x","scope":"read-write"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("token minted a token: %d body=%s", w.Code, w.Body.String())
+	}
+	// Nor rotate the recovery key, which resets the admin password, or lock.
+	for _, path := range []string{"/api/v1/crypto/recovery-key/generate", "/api/v1/crypto/lock"} {
+		w := doBearerRequest(srv, rw.Secret, http.MethodPost, path, "")
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), errorCodeTokenScope) {
+			t.Fatalf("read-write token on %s: expected 403, got %d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+	if w := doBearerRequest(srv, "pct_bogus", http.MethodGet, "/api/v1/auth/session-policy", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: expected 401, got %d", w.Code)
+	}
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodDelete, "/api/v1/auth/tokens/"+rw.Token.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d body=%s", w.Code, w.Body.String())
+	}
+	w = doBearerRequest(srv, rw.Secret, http.MethodGet, "/api/v1/auth/session-policy", "")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), errorCodeTokenInvalid) {
+		t.Fatalf("revoked token still accepted: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodDelete, "/api/v1/auth/tokens/"+rw.Token.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("second revoke: expected 404, got %d", w.Code)
+	}
+}
+
+func TestAPITokens_ExpiredTokenRejected(t *testing.T) {
+	srv, repo, _, _, _ := newAPITokenTestServer(t)
+	secret, hash, err := authpkg.NewAPIToken()
+	if err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+	_ = repo.CreateToken(context.Background(), persistence.APIToken{
+		ID: "old", Name: "old", Hash: hash, Scope: authpkg.ScopeReadWrite,
+		CreatedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	w := doBearerRequest(srv, secret, http.MethodGet, "/api/v1/auth/session-policy", "")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), errorCodeTokenExpired) {
+		t.Fatalf("expired token: %d body=%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"piccolod/internal/app"
+)
+
+// appImportRequest is an exported bundle plus values for its placeholders.
+type appImportRequest struct {
+	app.AppBundle `yaml:",inline"`
+	Values        map[string]string `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+// handleGinAppExport handles GET /api/v1/apps/:name/export - download a
+// shareable bundle (YAML by default, JSON with ?format=json).
+func (s *GinServer) handleGinAppExport(c *gin.Context) {
+	appName := c.Param("name")
+	bundle, err := s.appManager.ExportBundle(c.Request.Context(), appName)
+	if err != nil {
+		if handleAppManagerError(c, err, "export app") {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinError(c, http.StatusNotFound, err.Error())
+		} else {
+			writeGinError(c, http.StatusInternalServerError, "Failed to export app: "+err.Error())
+		}
+		return
+	}
+	if strings.EqualFold(c.Query("format"), "json") {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", appName+".piccolo.json"))
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+	data, err := yaml.Marshal(bundle)
+	if err != nil {
+		writeGinError(c, http.StatusInternalServerError, "Failed to encode bundle: "+err.Error())
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", appName+".piccolo.yaml"))
+	c.Data(http.StatusOK, "application/x-yaml; charset=utf-8", data)
+}
+
+// handleGinAppImport handles POST /api/v1/apps/import - install an app from an
+// exported bundle. Placeholder values missing from "values" are reported with
+// 422 so the client can prompt for them and retry.
+func (s *GinServer) handleGinAppImport(c *gin.Context) {
+	contentType := c.GetHeader("Content-Type")
+	isJSON := strings.Contains(contentType, "application/json")
+	if !isJSON && !strings.Contains(contentType, "application/x-yaml") && !strings.Contains(contentType, "text/yaml") {
+		writeGinError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/x-yaml or text/yaml or application/json")
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil || len(body) == 0 {
+		writeGinError(c, http.StatusBadRequest, "Request body cannot be empty")
+		return
+	}
+	var req appImportRequest
+	if isJSON {
+		err = json.Unmarshal(body, &req)
+	} else {
+		err = yaml.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, "Invalid bundle: "+err.Error())
+		return
+	}
+
+	appDef, err := req.Resolve(req.Values)
+	if err != nil {
+		var missing *app.MissingValuesError
+		if errors.As(err, &missing) {
+			writeGinErrorDetails(c, http.StatusUnprocessableEntity, errorCodeValuesRequired, err.Error(), gin.H{"missing": missing.Keys})
+			return
+		}
+		writeGinError(c, http.StatusBadRequest, "Invalid bundle: "+err.Error())
+		return
+	}
+
+	if err := s.ensureAppVolume(c.Request.Context(), appDef); err != nil {
+		if handleAppManagerError(c, err, "import app") {
+			return
+		}
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	appInstance, err := s.appManager.Install(c.Request.Context(), appDef)
+	if err != nil {
+		if handleAppManagerError(c, err, "import app") {
+			return
+		}
+		if strings.Contains(err.Error(), "already exists") {
+			writeGinError(c, http.StatusConflict, err.Error())
+		} else {
+			writeGinError(c, http.StatusInternalServerError, "Failed to import app: "+err.Error())
+		}
+		return
+	}
+	s.queueAppRemoteCertificates(appInstance.Name)
+	s.syncRemotePortMappings()
+
+	message := "App '" + appInstance.Name + "' imported successfully"
+	if req.Enabled {
+		if err := s.appManager.Enable(c.Request.Context(), appInstance.Name); err != nil {
+			message += "; enable failed: " + err.Error()
+		}
+	}
+	if req.Running {
+		if err := s.appManager.Start(c.Request.Context(), appInstance.Name); err != nil {
+			message += "; start failed: " + err.Error()
+		} else if refreshed, err := s.appManager.Get(c.Request.Context(), appInstance.Name); err == nil {
+			appInstance = refreshed
+		}
+	}
+	c.JSON(http.StatusCreated, GinAppResponse{Data: appInstance, Message: message})
+}
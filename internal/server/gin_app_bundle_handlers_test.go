@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"piccolod/internal/app"
+)
+
+func TestAppBundle_ExportImportRoundTrip(t *testing.T) {
+	newServer := func(prefix string) (*GinServer, func(method, path, contentType, body string) *httptest.ResponseRecorder) {
+		dir, err := os.MkdirTemp("", prefix)
+		if err != nil {
+			t.Fatalf("temp dir: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		srv := createGinTestServer(t, dir)
+		cookie, csrf := setupTestAdminSession(t, srv)
+		do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, path, strings.NewReader(body))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			attachAuth(req, cookie, csrf)
+			srv.router.ServeHTTP(w, req)
+			return w
+		}
+		return srv, do
+	}
+
+	src, srcDo := newServer("bundle_src")
+	const appYAML = `name: notes
+image: docker.io/library/nginx:alpine
+type: user
+listeners:
+  - name: web
+    guest_port: 80
+    flow: tcp
+    protocol: http
+environment:
+  LOG_LEVEL: debug
+  DB_PASSWORD: hunter2
+  API_TOKEN: abc123
+storage:
+  persistent:
+    data:
+      container: /var/lib/notes
+`
+	if w := srcDo(http.MethodPost, "/api/v1/apps", "application/x-yaml", appYAML); w.Code != http.StatusCreated {
+		t.Fatalf("install: %d body=%s", w.Code, w.Body.String())
+	}
+	if err := src.appManager.Enable(t.Context(), "notes"); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if w := srcDo(http.MethodPost, "/api/v1/apps/notes/start", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("start: %d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := srcDo(http.MethodGet, "/api/v1/apps/missing/export", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("export missing app: expected 404, got %d", w.Code)
+	}
+	w := srcDo(http.MethodGet, "/api/v1/apps/notes/export", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: %d body=%s", w.Code, w.Body.String())
+	}
+	exported := w.Body.String()
+	if strings.Contains(exported, "hunter2") || strings.Contains(exported, "abc123") {
+		t.Fatalf("export leaked secret values:\n%s", exported)
+	}
+	var bundle app.AppBundle
+	if err := yaml.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	if !bundle.Enabled || !bundle.Running {
+		t.Fatalf("expected enabled/running state in bundle: %+v", bundle)
+	}
+	if strings.Join(bundle.Placeholders, ",") != "API_TOKEN,DB_PASSWORD" {
+		t.Fatalf("unexpected placeholders %v", bundle.Placeholders)
+	}
+	if len(bundle.Volumes) != 1 || bundle.Volumes[0].Name != "data" || bundle.Volumes[0].Container != "/var/lib/notes" {
+		t.Fatalf("unexpected volume declarations %+v", bundle.Volumes)
+	}
+	if len(bundle.Listeners) != 1 || bundle.Listeners[0].Name != "web" || bundle.Listeners[0].PublicPort == 0 {
+		t.Fatalf("unexpected listener hints %+v", bundle.Listeners)
+	}
+	if w := srcDo(http.MethodGet, "/api/v1/apps/notes/export?format=json", "", ""); w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("json export: %d body=%s", w.Code, w.Body.String())
+	}
+
+	dst, dstDo := newServer("bundle_dst")
+	w = dstDo(http.MethodPost, "/api/v1/apps/import", "application/x-yaml", exported)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("import without values: expected 422, got %d body=%s", w.Code, w.Body.String())
+	}
+	var missing struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Missing []string `json:"missing"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &missing); err != nil {
+		t.Fatalf("decode 422: %v", err)
+	}
+	if missing.Error.Code != errorCodeValuesRequired || strings.Join(missing.Error.Details.Missing, ",") != "API_TOKEN,DB_PASSWORD" {
+		t.Fatalf("unexpected missing-values response: %s", w.Body.String())
+	}
+
+	withValues := exported + "values:\n  DB_PASSWORD: s3cret\n  API_TOKEN: tok\n"
+	if w := dstDo(http.MethodPost, "/api/v1/apps/import", "application/x-yaml", withValues); w.Code != http.StatusCreated {
+		t.Fatalf("import: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := dstDo(http.MethodPost, "/api/v1/apps/import", "application/x-yaml", withValues); w.Code != http.StatusConflict {
+		t.Fatalf("second import: expected 409, got %d", w.Code)
+	}
+
+	dstBundle, err := dst.appManager.ExportBundle(t.Context(), "notes")
+	if err != nil {
+		t.Fatalf("export imported app: %v", err)
+	}
+	if !dstBundle.Enabled || !dstBundle.Running {
+		t.Fatalf("imported app should be enabled and running: %+v", dstBundle)
+	}
+	if !reflect.DeepEqual(dstBundle.App, bundle.App) {
+		t.Fatalf("definitions differ after round trip:\nsource: %+v\nimported: %+v", bundle.App, dstBundle.App)
+	}
+	inst, err := dst.appManager.Get(t.Context(), "notes")
+	if err != nil {
+		t.Fatalf("get imported app: %v", err)
+	}
+	if inst.Environment["DB_PASSWORD"] != "s3cret" || inst.Environment["LOG_LEVEL"] != "debug" {
+		t.Fatalf("imported environment not applied: %v", inst.Environment)
+	}
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"piccolod/internal/api"
 	"piccolod/internal/app"
+	"piccolod/internal/events"
 	"piccolod/internal/persistence"
-	"piccolod/internal/remote"
+	"piccolod/internal/services"
 )
 
 func determineScheme(flow api.ListenerFlow, protocol api.ListenerProtocol) string {
@@ -28,6 +32,10 @@ func determineScheme(flow api.ListenerFlow, protocol api.ListenerProtocol) strin
 			return "wss"
 		}
 		return "ws"
+	case api.ListenerProtocolHTTPS:
+		return "https"
+	case api.ListenerProtocolTCP, api.ListenerProtocolUDP:
+		return protocol.String()
 	default:
 		if flow == api.FlowTLS {
 			return "https"
@@ -44,9 +52,6 @@ func (s *GinServer) queueAppRemoteCertificates(appName string) {
 	if !status.Enabled {
 		return
 	}
-	if !strings.EqualFold(status.Solver, "http-01") {
-		return
-	}
 	tld := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(status.TLD)), ".")
 	if tld == "" {
 		return
@@ -61,21 +66,18 @@ func (s *GinServer) queueAppRemoteCertificates(appName string) {
 		if ep.Flow == api.FlowTLS {
 			continue
 		}
-		switch ep.Protocol {
-		case api.ListenerProtocolHTTP, api.ListenerProtocolWebsocket:
-			// allowed
-		default:
+		if !ep.Protocol.HTTP() {
 			continue
 		}
-		name := strings.ToLower(strings.TrimSpace(ep.Name))
-		if name == "" {
+		label := ep.RemoteLabel()
+		if label == "" {
 			continue
 		}
-		if !isValidDNSLabel(name) {
+		if !isValidDNSLabel(label) {
 			log.Printf("WARN: remote: skipping remote certificate queue for listener %q on app %q (not DNS-safe)", ep.Name, appName)
 			continue
 		}
-		host := name + "." + tld
+		host := label + "." + tld
 		hosts[host] = struct{}{}
 	}
 	for h := range hosts {
@@ -100,30 +102,13 @@ func isValidDNSLabel(label string) bool {
 	return true
 }
 
-// APIError represents a structured API error response
-type APIError struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Message string `json:"message,omitempty"`
-}
-
 // GinAppResponse represents the standardized API response format
 type GinAppResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
-	Error   *APIError   `json:"error,omitempty"`
-}
-
-// writeGinError writes a structured error response using Gin
-func writeGinError(c *gin.Context, statusCode int, message string) {
-	response := GinAppResponse{
-		Error: &APIError{
-			Error:   http.StatusText(statusCode),
-			Code:    statusCode,
-			Message: message,
-		},
-	}
-	c.JSON(statusCode, response)
+	// Error is only filled when decoding: failures are written as an
+	// errorEnvelope, whose error key this shares.
+	Error *APIError `json:"error,omitempty"`
 }
 
 // writeGinSuccess writes a successful response using Gin
@@ -139,7 +124,7 @@ func writeGinSuccess(c *gin.Context, data interface{}, message string) {
 func (s *GinServer) handleGinAppValidate(c *gin.Context) {
 	contentType := c.GetHeader("Content-Type")
 	if !strings.Contains(contentType, "application/x-yaml") && !strings.Contains(contentType, "text/yaml") && !strings.Contains(contentType, "application/json") {
-		writeGinError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/x-yaml or text/yaml or application/json")
+		writeGinMessage(c, http.StatusUnsupportedMediaType, msgContentType, msgParams{"types": "application/x-yaml, text/yaml or application/json"})
 		return
 	}
 	var yamlData []byte
@@ -149,23 +134,41 @@ func (s *GinServer) handleGinAppValidate(c *gin.Context) {
 			AppDefinition string `json:"app_definition"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.AppDefinition) == "" {
-			writeGinError(c, http.StatusBadRequest, "Invalid JSON body; expected {app_definition}")
+			writeGinMessage(c, http.StatusBadRequest, msgAppDefinitionJSON, nil)
 			return
 		}
 		yamlData = []byte(req.AppDefinition)
 	} else {
 		body, err := c.GetRawData()
 		if err != nil || len(body) == 0 {
-			writeGinError(c, http.StatusBadRequest, "Request body cannot be empty")
+			writeGinMessage(c, http.StatusBadRequest, msgEmptyBody, nil)
 			return
 		}
 		yamlData = body
 	}
-	if _, err := app.ParseAppDefinition(yamlData); err != nil {
-		writeGinError(c, http.StatusBadRequest, "Invalid app.yaml: "+err.Error())
+	def, err := app.ParseAppDefinition(yamlData)
+	if err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAppYAML, msgParams{"reason": err.Error()})
+		return
+	}
+	if err := app.CheckAPIVersion(def); err != nil {
+		if !handleAppManagerError(c, err, "validate app") {
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAppYAML, msgParams{"reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"valid": true, "api_version": def.APIVersion, "supported_api_version": app.AppAPIVersion, "warnings": app.CapabilityWarnings(def)}, "valid")
+}
+
+// syncRemotePortMappings reconnects the nexus adapter when raw tcp listeners
+// have added or dropped remote ports since it last connected.
+func (s *GinServer) syncRemotePortMappings() {
+	if s == nil || s.remoteResolver == nil || s.remoteManager == nil {
 		return
 	}
-	writeGinSuccess(c, gin.H{"valid": true}, "valid")
+	if s.remoteResolver.PortMappingsStale() {
+		s.remoteManager.RefreshAdapter()
+	}
 }
 
 // handleGinCatalogTemplate handles GET /api/v1/catalog/:name/template - return YAML template for a catalog app
@@ -176,7 +179,7 @@ func (s *GinServer) handleGinCatalogTemplate(c *gin.Context) {
 	case "wordpress":
 		yaml = "name: wordpress\nimage: docker.io/library/wordpress:6\nlisteners:\n  - name: http\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
 	default:
-		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		writeGinMessage(c, http.StatusNotFound, msgTemplateNotFound, msgParams{"name": name})
 		return
 	}
 	c.Data(http.StatusOK, "application/x-yaml; charset=utf-8", []byte(yaml))
@@ -187,45 +190,89 @@ func (s *GinServer) handleGinAppInstall(c *gin.Context) {
 	// Check Content-Type
 	contentType := c.GetHeader("Content-Type")
 	if !strings.Contains(contentType, "application/x-yaml") && !strings.Contains(contentType, "text/yaml") {
-		writeGinError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/x-yaml or text/yaml")
+		writeGinMessage(c, http.StatusUnsupportedMediaType, msgContentType, msgParams{"types": "application/x-yaml or text/yaml"})
 		return
 	}
 
 	// Read request body
 	yamlData, err := c.GetRawData()
 	if err != nil {
-		writeGinError(c, http.StatusBadRequest, "Failed to read request body: "+err.Error())
+		writeGinMessage(c, http.StatusBadRequest, msgReadBody, msgParams{"reason": err.Error()})
 		return
 	}
 
 	if len(yamlData) == 0 {
-		writeGinError(c, http.StatusBadRequest, "Request body cannot be empty")
+		writeGinMessage(c, http.StatusBadRequest, msgEmptyBody, nil)
 		return
 	}
 
 	// Parse app.yaml
 	appDef, err := app.ParseAppDefinition(yamlData)
 	if err != nil {
-		writeGinError(c, http.StatusBadRequest, "Invalid app.yaml: "+err.Error())
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAppYAML, msgParams{"reason": err.Error()})
+		return
+	}
+	if err := app.CheckAPIVersion(appDef); err != nil {
+		if !handleAppManagerError(c, err, "install app") {
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAppYAML, msgParams{"reason": err.Error()})
+		}
+		return
+	}
+	ctx := c.Request.Context()
+	confirmCaps := queryFlag(c, "confirm_capabilities")
+	if confirmCaps {
+		ctx = app.ConfirmCapabilities(ctx)
+	}
+	// Refuse before pulling an image or creating a volume.
+	if s.serviceManager != nil {
+		if err := s.serviceManager.CheckRemoteLabels(appDef.Name, appDef.Listeners); err != nil {
+			handleAppManagerError(c, err, "install app")
+			return
+		}
+		if err := s.serviceManager.CheckPathPrefixes(appDef.Name, appDef.Listeners); err != nil {
+			handleAppManagerError(c, err, "install app")
+			return
+		}
+	}
+	if err := s.appManager.CheckCapabilities(ctx, appDef); err != nil {
+		handleAppManagerError(c, err, "install app")
 		return
 	}
 
 	if err := s.ensureAppVolume(c.Request.Context(), appDef); err != nil {
-		writeGinError(c, http.StatusInternalServerError, err.Error())
+		if handleAppManagerError(c, err, "install app") {
+			return
+		}
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "prepare app storage", "reason": err.Error()})
+		return
+	}
+
+	// Large images can take minutes to pull; do that in a job the client
+	// polls instead of holding the request open.
+	if present, err := s.appManager.ImagePresent(c.Request.Context(), appDef.Image); err != nil {
+		log.Printf("WARN: check image %s: %v", appDef.Image, err)
+	} else if !present {
+		job := s.startAppInstallJob(appDef, confirmCaps)
+		c.Header("Location", "/api/v1/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, GinAppResponse{
+			Data:    gin.H{"job": job},
+			Message: "Pulling image " + appDef.Image + " for app '" + appDef.Name + "'",
+		})
 		return
 	}
 
 	// Install or update (upsert) the app
-	appInstance, err := s.appManager.Upsert(c.Request.Context(), appDef)
+	appInstance, err := s.appManager.Upsert(ctx, appDef)
 	if err != nil {
 		if handleAppManagerError(c, err, "install app") {
 			return
 		}
-		writeGinError(c, http.StatusInternalServerError, "Failed to install app: "+err.Error())
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "install app", "reason": err.Error()})
 		return
 	}
 
 	s.queueAppRemoteCertificates(appInstance.Name)
+	s.syncRemotePortMappings()
 
 	response := GinAppResponse{
 		Data:    appInstance,
@@ -241,7 +288,7 @@ func (s *GinServer) handleGinAppList(c *gin.Context) {
 		if handleAppManagerError(c, err, "list apps") {
 			return
 		}
-		writeGinError(c, http.StatusInternalServerError, "Failed to list apps: "+err.Error())
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "list apps", "reason": err.Error()})
 		return
 	}
 
@@ -258,74 +305,243 @@ func (s *GinServer) handleGinAppGet(c *gin.Context) {
 			return
 		}
 		if strings.Contains(err.Error(), "not found") {
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
 		} else {
-			writeGinError(c, http.StatusInternalServerError, "Failed to get app: "+err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "get app", "reason": err.Error()})
 		}
 		return
 	}
 
 	// Include services inline
-	services, _ := s.serviceManager.GetByApp(appName)
-	serviceStatus := make([]gin.H, 0, len(services))
-	var remoteStatus *remote.Status
-	if s.remoteManager != nil {
-		st := s.remoteManager.Status()
-		remoteStatus = &st
-	}
-	for _, ep := range services {
-		remoteHost := s.remoteServiceHostname(remoteStatus, ep)
-		var remoteHostValue interface{}
-		if remoteHost != "" {
-			remoteHostValue = remoteHost
-		}
-		serviceStatus = append(serviceStatus, gin.H{
-			"app":          ep.App,
-			"name":         ep.Name,
-			"guest_port":   ep.GuestPort,
-			"host_port":    ep.HostBind,
-			"public_port":  ep.PublicPort,
-			"remote_ports": ep.RemotePorts,
-			"remote_host":  remoteHostValue,
-			"flow":         ep.Flow,
-			"protocol":     ep.Protocol,
-			"middleware":   ep.Middleware,
-			"scheme":       determineScheme(ep.Flow, ep.Protocol),
-		})
+	serviceStatus, _ := s.services().current().app(appName, s.serviceManager)
+	if serviceStatus == nil {
+		serviceStatus = []serviceEntry{}
+	}
+	deps, err := s.appManager.Dependencies(c.Request.Context(), appName)
+	if err != nil {
+		deps = []app.DependencyStatus{}
+	}
+	mounts, err := s.appManager.HostMounts(c.Request.Context(), appName)
+	if err != nil {
+		mounts = []app.HostMountStatus{}
+	}
+	caps, err := s.appManager.Capabilities(c.Request.Context(), appName)
+	if err != nil {
+		caps = []app.CapabilityStatus{}
+	}
+	writeGinSuccess(c, gin.H{"app": appInstance, "services": serviceStatus, "dependencies": deps, "host_mounts": mounts, "capabilities": caps}, "")
+}
+
+// handleGinAppDiff handles POST /api/v1/apps/:name/diff - Preview what
+// installing the posted app.yaml over the app would change
+func (s *GinServer) handleGinAppDiff(c *gin.Context) {
+	appName := c.Param("name")
+	contentType := c.GetHeader("Content-Type")
+	if !strings.Contains(contentType, "application/x-yaml") && !strings.Contains(contentType, "text/yaml") {
+		writeGinMessage(c, http.StatusUnsupportedMediaType, msgContentType, msgParams{"types": "application/x-yaml or text/yaml"})
+		return
+	}
+	yamlData, err := c.GetRawData()
+	if err != nil || len(yamlData) == 0 {
+		writeGinMessage(c, http.StatusBadRequest, msgEmptyBody, nil)
+		return
+	}
+	appDef, err := app.ParseAppDefinition(yamlData)
+	if err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAppYAML, msgParams{"reason": err.Error()})
+		return
+	}
+	if appDef.Name != appName {
+		writeGinMessage(c, http.StatusBadRequest, msgAppNameMismatch, msgParams{"manifest": appDef.Name, "app": appName})
+		return
+	}
+	diff, err := s.appManager.DiffDefinition(c.Request.Context(), appDef)
+	if err != nil {
+		if handleAppManagerError(c, err, "diff app") {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		} else {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "diff app", "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, diff, "")
+}
+
+// handleGinAppHistory handles GET /api/v1/apps/:name/history - Recent
+// app.yaml changes, newest first
+func (s *GinServer) handleGinAppHistory(c *gin.Context) {
+	appName := c.Param("name")
+	changes, err := s.appManager.DefinitionHistory(c.Request.Context(), appName)
+	if err != nil {
+		if handleAppManagerError(c, err, "fetch app history") {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		} else {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "fetch app history", "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"changes": changes}, "")
+}
+
+// maxAppLogLines caps how many log lines one request returns.
+const maxAppLogLines = 5000
+
+// handleGinAppLogs handles GET /api/v1/apps/:name/logs - Recent container
+// output, or the captured archive filtered by time
+func (s *GinServer) handleGinAppLogs(c *gin.Context) {
+	appName := c.Param("name")
+	q := app.LogQuery{Source: strings.TrimSpace(c.Query("source"))}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		raw := strings.TrimSpace(c.Query(p.name))
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeGinMessage(c, http.StatusBadRequest, msgTimestampParam, msgParams{"param": p.name})
+			return
+		}
+		*p.dst = t
+	}
+	if raw := strings.TrimSpace(c.Query("lines")); raw != "" {
+		lines, err := strconv.Atoi(raw)
+		if err != nil || lines <= 0 {
+			writeGinMessage(c, http.StatusBadRequest, msgPositiveIntParam, msgParams{"param": "lines"})
+			return
+		}
+		q.Limit = min(lines, maxAppLogLines)
+	}
+	entries, source, err := s.appManager.ReadLogs(c.Request.Context(), appName, q)
+	if err != nil {
+		if handleAppManagerError(c, err, "read app logs") {
+			return
+		}
+		switch {
+		case strings.HasPrefix(err.Error(), "invalid "):
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "read app logs", "reason": err.Error()})
+		case strings.Contains(err.Error(), "not found"):
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		default:
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "read app logs", "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"app": appName, "source": source, "entries": entries}, "")
+}
+
+// handleGinAppTasks handles GET /api/v1/apps/:name/tasks - Scheduled tasks
+// with their recent runs
+func (s *GinServer) handleGinAppTasks(c *gin.Context) {
+	appName := c.Param("name")
+	tasks, err := s.appManager.Tasks(c.Request.Context(), appName)
+	if err != nil {
+		if handleAppManagerError(c, err, "list app tasks") {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		} else {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "list app tasks", "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"tasks": tasks}, "")
+}
+
+// handleGinAppTaskRun handles POST /api/v1/apps/:name/tasks/:task/run - Run
+// a scheduled task now; the outcome lands in the task history
+func (s *GinServer) handleGinAppTaskRun(c *gin.Context) {
+	appName, taskName := c.Param("name"), c.Param("task")
+	err := s.appManager.RunTask(c.Request.Context(), appName, taskName)
+	switch {
+	case err == nil:
+	case handleAppManagerError(c, err, "run app task"):
+		return
+	case errors.Is(err, app.ErrTaskRunning), errors.Is(err, app.ErrAppNotRunning):
+		writeGinMessage(c, http.StatusConflict, msgConflictAction, msgParams{"action": "run app task", "reason": err.Error()})
+		return
+	case errors.Is(err, app.ErrTaskNotFound), strings.Contains(err.Error(), "not found"):
+		writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "run app task", "reason": err.Error()})
+		return
+	default:
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "run app task", "reason": err.Error()})
+		return
 	}
-	writeGinSuccess(c, gin.H{"app": appInstance, "services": serviceStatus}, "")
+	c.JSON(http.StatusAccepted, GinAppResponse{Message: "Task '" + taskName + "' of app '" + appName + "' started"})
 }
 
 // handleGinAppUninstall handles DELETE /api/v1/apps/:name - Uninstall app completely
 func (s *GinServer) handleGinAppUninstall(c *gin.Context) {
 	appName := c.Param("name")
-	// Optional purge=true to delete app data
-	purge := false
-	switch c.Query("purge") {
-	case "1", "true", "yes", "on":
-		purge = true
+	// Optional purge=true to delete app data; requires confirm=<app-name>
+	purge := queryFlag(c, "purge")
+	if purge && c.Query("confirm") != appName {
+		writeGinMessage(c, http.StatusBadRequest, msgPurgeConfirm, msgParams{"app": appName})
+		return
 	}
 
-	err := s.appManager.UninstallWithOptions(c.Request.Context(), appName, purge)
+	report, err := s.appManager.UninstallWithOptions(c.Request.Context(), appName, app.UninstallOptions{
+		Purge: purge,
+		Force: queryFlag(c, "force"),
+	})
 	if err != nil {
 		if handleAppManagerError(c, err, "uninstall app") {
 			return
 		}
 		if strings.Contains(err.Error(), "not found") {
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
 		} else {
-			writeGinError(c, http.StatusInternalServerError, "Failed to uninstall app: "+err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "uninstall app", "reason": err.Error()})
 		}
 		return
 	}
+	s.syncRemotePortMappings()
+	if s.remoteManager != nil {
+		s.remoteManager.PruneCertificates()
+	}
 
 	if purge {
-		writeGinSuccess(c, nil, "App '"+appName+"' uninstalled and data purged successfully")
+		s.publishPurgeReport(c, appName, report)
+		msg := "App '" + appName + "' uninstalled and data purged successfully"
+		if len(report.Failures) > 0 {
+			msg = "App '" + appName + "' uninstalled; some data could not be purged"
+		}
+		writeGinSuccess(c, gin.H{"purge": report}, msg)
 	} else {
 		writeGinSuccess(c, nil, "App '"+appName+"' uninstalled successfully")
 	}
 }
 
+func (s *GinServer) publishPurgeReport(c *gin.Context, appName string, report app.PurgeReport) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(events.Event{
+		Topic: events.TopicAudit,
+		Payload: events.AuditEvent{
+			Kind:   "app.purge",
+			Time:   time.Now().UTC(),
+			Source: requestClientIP(c),
+			Metadata: map[string]any{
+				"app":         appName,
+				"volumes":     report.Volumes,
+				"paths":       report.Paths,
+				"bytes_freed": report.BytesFreed,
+				"failures":    report.Failures,
+			},
+		},
+	})
+}
+
 // handleGinAppStart handles POST /api/v1/apps/:name/start - Start app container
 func (s *GinServer) handleGinAppStart(c *gin.Context) {
 	appName := c.Param("name")
@@ -341,9 +557,9 @@ func (s *GinServer) handleGinAppStart(c *gin.Context) {
 			return
 		}
 		if strings.Contains(err.Error(), "not found") {
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
 		} else {
-			writeGinError(c, http.StatusInternalServerError, "Failed to start app: "+err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "start app", "reason": err.Error()})
 		}
 		return
 	}
@@ -351,6 +567,71 @@ func (s *GinServer) handleGinAppStart(c *gin.Context) {
 	writeGinSuccess(c, nil, "App '"+appName+"' started successfully")
 }
 
+// handleGinAppEnable handles POST /api/v1/apps/:name/enable - Start the app on boot
+func (s *GinServer) handleGinAppEnable(c *gin.Context) {
+	s.setAppEnabled(c, true)
+}
+
+// handleGinAppDisable handles POST /api/v1/apps/:name/disable - Stop starting the app on boot
+func (s *GinServer) handleGinAppDisable(c *gin.Context) {
+	s.setAppEnabled(c, false)
+}
+
+// setAppEnabled marks an app enabled or disabled. It does not start or stop
+// the app; that happens on the next boot.
+func (s *GinServer) setAppEnabled(c *gin.Context, enabled bool) {
+	appName := c.Param("name")
+	action, verb := "enable app", "enabled"
+	if !enabled {
+		action, verb = "disable app", "disabled"
+	}
+	var err error
+	if enabled {
+		err = s.appManager.Enable(c.Request.Context(), appName)
+	} else {
+		err = s.appManager.Disable(c.Request.Context(), appName)
+	}
+	if err != nil {
+		if handleAppManagerError(c, err, action) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		} else {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": action, "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"app": appName, "enabled": enabled}, "App '"+appName+"' "+verb)
+}
+
+type appBatchStartRequest struct {
+	Apps []string `json:"apps"`
+}
+
+// handleGinAppStartBatch handles POST /api/v1/apps/start - Start several apps
+// (all enabled apps when none are listed) in dependency order.
+func (s *GinServer) handleGinAppStartBatch(c *gin.Context) {
+	var req appBatchStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
+		return
+	}
+	results, err := s.appManager.StartApps(c.Request.Context(), req.Apps)
+	if err != nil {
+		if handleAppManagerError(c, err, "start apps") {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "start apps", "reason": err.Error()})
+		} else {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "start apps", "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"results": results}, "")
+}
+
 // handleGinAppStop handles POST /api/v1/apps/:name/stop - Stop app container
 func (s *GinServer) handleGinAppStop(c *gin.Context) {
 	appName := c.Param("name")
@@ -360,15 +641,15 @@ func (s *GinServer) handleGinAppStop(c *gin.Context) {
 		return
 	}
 
-	err := s.appManager.Stop(c.Request.Context(), appName)
+	err := s.appManager.StopWithOptions(c.Request.Context(), appName, app.StopOptions{Force: queryFlag(c, "force")})
 	if err != nil {
 		if handleAppManagerError(c, err, "stop app") {
 			return
 		}
 		if strings.Contains(err.Error(), "not found") {
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
 		} else {
-			writeGinError(c, http.StatusInternalServerError, "Failed to stop app: "+err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "stop app", "reason": err.Error()})
 		}
 		return
 	}
@@ -376,6 +657,95 @@ func (s *GinServer) handleGinAppStop(c *gin.Context) {
 	writeGinSuccess(c, nil, "App '"+appName+"' stopped successfully")
 }
 
+// handleGinAppPause handles POST /api/v1/apps/:name/pause - Freeze the app's
+// container, keeping its endpoints allocated.
+func (s *GinServer) handleGinAppPause(c *gin.Context) {
+	s.pauseApp(c, true)
+}
+
+// handleGinAppUnpause handles POST /api/v1/apps/:name/unpause - Resume a
+// paused app.
+func (s *GinServer) handleGinAppUnpause(c *gin.Context) {
+	s.pauseApp(c, false)
+}
+
+func (s *GinServer) pauseApp(c *gin.Context, pause bool) {
+	appName := c.Param("name")
+	action, verb, op := "unpause app", "resumed", s.appManager.Unpause
+	if pause {
+		action, verb, op = "pause app", "paused", s.appManager.Pause
+	}
+	if err := op(c.Request.Context(), appName); err != nil {
+		if handleAppManagerError(c, err, action) {
+			return
+		}
+		switch {
+		case errors.Is(err, app.ErrPauseNotAllowed):
+			writeGinMessage(c, http.StatusForbidden, msgSystemAppPause, msgParams{"app": appName})
+		case errors.Is(err, app.ErrAppNotRunning):
+			writeGinMessage(c, http.StatusConflict, msgAppNotRunning, msgParams{"action": action, "app": appName})
+		case errors.Is(err, app.ErrAppNotPaused):
+			writeGinMessage(c, http.StatusConflict, msgAppNotPaused, msgParams{"action": action, "app": appName})
+		case strings.Contains(err.Error(), "not found"):
+			writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+		default:
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": action, "reason": err.Error()})
+		}
+		return
+	}
+	writeGinSuccess(c, gin.H{"app": appName, "paused": pause}, "App '"+appName+"' "+verb)
+}
+
+type appEnvRequest struct {
+	Set   map[string]string `json:"set"`
+	Unset []string          `json:"unset"`
+}
+
+// handleGinAppEnv handles PATCH /api/v1/apps/:name/env - Set or unset
+// environment variables and replace the container to apply them.
+func (s *GinServer) handleGinAppEnv(c *gin.Context) {
+	appName := c.Param("name")
+	var req appEnvRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
+		return
+	}
+	result, err := s.appManager.UpdateEnvironment(c.Request.Context(), appName, req.Set, req.Unset)
+	if err != nil {
+		writeReplaceError(c, appName, "update app environment", err)
+		return
+	}
+	writeGinSuccess(c, result, "App '"+appName+"' environment updated")
+}
+
+// handleGinAppRecreate handles POST /api/v1/apps/:name/recreate - Replace
+// the app's container with a fresh one from its stored definition.
+func (s *GinServer) handleGinAppRecreate(c *gin.Context) {
+	appName := c.Param("name")
+	result, err := s.appManager.Recreate(c.Request.Context(), appName)
+	if err != nil {
+		writeReplaceError(c, appName, "recreate app", err)
+		return
+	}
+	writeGinSuccess(c, result, "App '"+appName+"' container replaced")
+}
+
+func writeReplaceError(c *gin.Context, appName, action string, err error) {
+	if handleAppManagerError(c, err, action) {
+		return
+	}
+	switch {
+	case errors.Is(err, app.ErrReplacementUnhealthy):
+		writeGinMessage(c, http.StatusUnprocessableEntity, msgReplaceUnhealthy, msgParams{"action": action, "app": appName, "reason": err.Error()})
+	case strings.Contains(err.Error(), "not found"):
+		writeGinMessage(c, http.StatusNotFound, msgAppNotFound, msgParams{"app": appName})
+	case strings.HasPrefix(err.Error(), "invalid "):
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": action, "reason": err.Error()})
+	default:
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": action, "reason": err.Error()})
+	}
+}
+
 // handleGinCatalog handles GET /api/v1/catalog - returns curated catalog.
 func (s *GinServer) handleGinCatalog(c *gin.Context) {
 	apps := []gin.H{
@@ -389,10 +759,108 @@ func (s *GinServer) handleGinCatalog(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"apps": apps})
 }
 
+// handleAppManagerError translates app manager and persistence sentinels into
+// responses. It reports false when err needs handler-specific treatment.
 func handleAppManagerError(c *gin.Context, err error, action string) bool {
-	if errors.Is(err, app.ErrLocked) {
-		msg := fmt.Sprintf("Unable to %s while storage is locked. Unlock Piccolo to continue.", action)
-		writeGinError(c, http.StatusLocked, msg)
+	switch {
+	case errors.Is(err, app.ErrLocked), errors.Is(err, persistence.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, msgLockedAction, msgParams{"action": action})
+		return true
+	case errors.Is(err, app.ErrNotLeader), errors.Is(err, persistence.ErrNotLeader):
+		writeGinMessage(c, http.StatusConflict, msgNotLeaderAction, msgParams{"action": action})
+		return true
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return true
+	case errors.Is(err, app.ErrVolumeUnavailable):
+		writeGinMessage(c, http.StatusServiceUnavailable, msgVolumeAction, msgParams{"action": action})
+		return true
+	case errors.Is(err, app.ErrAppPaused):
+		env := newMessageEnvelope(c, msgAppPaused, msgParams{"action": action}, nil)
+		env.Error.Hint = "Unpause the app with POST /api/v1/apps/{name}/unpause first."
+		c.JSON(http.StatusConflict, env)
+		return true
+	case errors.Is(err, app.ErrOperationTimeout):
+		writeGinMessageDetails(c, http.StatusGatewayTimeout, msgTimeoutAction, msgParams{"action": action, "reason": err.Error()}, installErrorDetails(err))
+		return true
+	}
+	var busyErr *app.OperationInProgressError
+	if errors.As(err, &busyErr) {
+		writeGinMessageDetails(c, http.StatusConflict, msgBusyAction, msgParams{"action": action, "app": busyErr.App, "operation": busyErr.Operation},
+			gin.H{"app": busyErr.App, "operation": busyErr.Operation})
+		return true
+	}
+	var verErr *app.UnsupportedVersionError
+	if errors.As(err, &verErr) {
+		writeGinMessageDetails(c, http.StatusBadRequest, msgUnsupportedVersion, msgParams{"action": action, "reason": err.Error()},
+			gin.H{"api_version": verErr.Declared, "supported_api_version": verErr.Supported})
+		return true
+	}
+	var hostErr *services.RemoteHostConflictError
+	if errors.As(err, &hostErr) {
+		env := newMessageEnvelope(c, msgRemoteHostConflict, msgParams{"action": action, "reason": err.Error()},
+			gin.H{"remote_host_conflict": gin.H{
+				"listener":             hostErr.Listener,
+				"remote_label":         hostErr.Label,
+				"conflicting_app":      hostErr.OtherApp,
+				"conflicting_listener": hostErr.OtherListener,
+			}})
+		env.Error.Hint = "Set remote_subdomain on the listener to publish it under another hostname."
+		c.JSON(http.StatusConflict, env)
+		return true
+	}
+	var pathErr *services.PathPrefixConflictError
+	if errors.As(err, &pathErr) {
+		env := newMessageEnvelope(c, msgPathPrefixConflict, msgParams{"action": action, "reason": err.Error()},
+			gin.H{"path_prefix_conflict": gin.H{
+				"listener":             pathErr.Listener,
+				"path_prefix":          pathErr.Prefix,
+				"conflicting_app":      pathErr.OtherApp,
+				"conflicting_listener": pathErr.OtherListener,
+				"conflicting_prefix":   pathErr.OtherPrefix,
+			}})
+		env.Error.Hint = "Set another path_prefix on the listener."
+		c.JSON(http.StatusConflict, env)
+		return true
+	}
+	var depErr *app.DependentsError
+	if errors.As(err, &depErr) {
+		writeGinMessageDetails(c, http.StatusConflict, msgConflictAction, msgParams{"action": action, "reason": err.Error()}, gin.H{"dependents": depErr.Dependents})
+		return true
+	}
+	var capErr *app.CapabilityError
+	if errors.As(err, &capErr) {
+		writeCapabilityError(c, capErr, action)
+		return true
+	}
+	if errors.Is(err, app.ErrHostMountNotAllowed) {
+		writeGinMessage(c, http.StatusForbidden, msgForbiddenAction, msgParams{"action": action, "reason": err.Error()})
+		return true
+	}
+	if errors.Is(err, app.ErrMissingDependency) || errors.Is(err, app.ErrDependencyCycle) {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": action, "reason": err.Error()})
+		return true
+	}
+	if details := installErrorDetails(err); details != nil {
+		writeGinMessageDetails(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": action, "reason": err.Error()}, details)
+		return true
+	}
+	return false
+}
+
+// installErrorDetails returns the step log of a failed install, or nil.
+func installErrorDetails(err error) any {
+	var installErr *app.InstallError
+	if !errors.As(err, &installErr) {
+		return nil
+	}
+	return gin.H{"step": installErr.Step, "steps": installErr.Steps}
+}
+
+// queryFlag reports whether a boolean query parameter is set.
+func queryFlag(c *gin.Context, key string) bool {
+	switch c.Query(key) {
+	case "1", "true", "yes", "on":
 		return true
 	}
 	return false
@@ -402,7 +870,7 @@ func (s *GinServer) ensureAppVolume(ctx context.Context, appDef *api.AppDefiniti
 	if s.dispatcher == nil || appDef == nil {
 		return nil
 	}
-	volID := fmt.Sprintf("app-%s", appDef.Name)
+	volID := app.AppVolumeID(appDef.Name)
 	req := persistence.VolumeRequest{ID: volID, Class: persistence.VolumeClassApplication, ClusterMode: persistence.ClusterModeStateful}
 	resp, err := s.dispatcher.Dispatch(ctx, persistence.EnsureVolumeCommand{Req: req})
 	if err != nil {
@@ -413,3 +881,20 @@ func (s *GinServer) ensureAppVolume(ctx context.Context, appDef *api.AppDefiniti
 	}
 	return nil
 }
+
+// purgeAppVolume removes a persistence-managed app volume through the
+// dispatcher so the volume manager can detach it before deleting data.
+func (s *GinServer) purgeAppVolume(ctx context.Context, volumeID string) ([]string, int64, error) {
+	if s.dispatcher == nil {
+		return nil, 0, fmt.Errorf("persistence dispatcher unavailable")
+	}
+	resp, err := s.dispatcher.Dispatch(ctx, persistence.RemoveVolumeCommand{ID: volumeID})
+	if err != nil {
+		return nil, 0, err
+	}
+	removal, ok := resp.(persistence.VolumeRemoval)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected response from persistence for volume %s", volumeID)
+	}
+	return removal.Paths, removal.BytesFreed, nil
+}
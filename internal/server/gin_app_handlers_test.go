@@ -3,12 +3,14 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -271,7 +273,7 @@ func TestGinAppServices_RemoteHost(t *testing.T) {
 	if strings.TrimSpace(status.TLD) == "" {
 		t.Fatalf("remote status missing tld: %+v", status)
 	}
-	if host := srv.remoteServiceHostname(&status, services.ServiceEndpoint{Name: "web"}); host == "" {
+	if host := remoteServiceHostname(&status, services.ServiceEndpoint{Name: "web"}); host == "" {
 		t.Fatalf("remote hostname derivation failed")
 	}
 	srv.refreshRemoteRuntime()
@@ -495,6 +497,223 @@ func TestGinAppAPI_AppActions(t *testing.T) {
 	}
 }
 
+func TestGinAppAPI_EnableDisable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tempDir, err := os.MkdirTemp("", "gin_app_api_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	server := createGinTestServer(t, tempDir)
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+
+	appDef := &api.AppDefinition{
+		Name:      "test-app",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+	}
+	if _, err := server.appManager.Install(context.Background(), appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	do := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	enabledInGet := func() bool {
+		t.Helper()
+		w := do(http.MethodGet, "/api/v1/apps/test-app")
+		var resp struct {
+			Data struct {
+				App struct {
+					Enabled bool `json:"enabled"`
+				} `json:"app"`
+			} `json:"data"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("get app: %d body=%s", w.Code, w.Body.String())
+		}
+		return resp.Data.App.Enabled
+	}
+	enabledInList := func() bool {
+		t.Helper()
+		w := do(http.MethodGet, "/api/v1/apps")
+		var resp struct {
+			Data []struct {
+				Name    string `json:"name"`
+				Enabled bool   `json:"enabled"`
+			} `json:"data"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || len(resp.Data) != 1 {
+			t.Fatalf("list apps: %d body=%s", w.Code, w.Body.String())
+		}
+		return resp.Data[0].Enabled
+	}
+
+	if enabledInGet() || enabledInList() {
+		t.Fatalf("new app should not be enabled")
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/enable"); w.Code != http.StatusOK {
+		t.Fatalf("enable: %d body=%s", w.Code, w.Body.String())
+	}
+	if !enabledInGet() || !enabledInList() {
+		t.Fatalf("expected app reported enabled")
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/disable"); w.Code != http.StatusOK {
+		t.Fatalf("disable: %d body=%s", w.Code, w.Body.String())
+	}
+	if enabledInGet() || enabledInList() {
+		t.Fatalf("expected app reported disabled")
+	}
+	for _, action := range []string{"enable", "disable"} {
+		if w := do(http.MethodPost, "/api/v1/apps/nonexistent/"+action); w.Code != http.StatusNotFound {
+			t.Fatalf("%s missing app: expected 404, got %d", action, w.Code)
+		}
+	}
+}
+
+func TestGinAppAPI_PauseUnpause(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := createGinTestServer(t, t.TempDir())
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+
+	appDef := &api.AppDefinition{
+		Name:      "test-app",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+	}
+	if _, err := server.appManager.Install(context.Background(), appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	do := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	status := func() string {
+		t.Helper()
+		w := do(http.MethodGet, "/api/v1/apps/test-app")
+		var resp struct {
+			Data struct {
+				App struct {
+					Status string `json:"status"`
+				} `json:"app"`
+			} `json:"data"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("get app: %d body=%s", w.Code, w.Body.String())
+		}
+		return resp.Data.App.Status
+	}
+
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/pause"); w.Code != http.StatusConflict {
+		t.Fatalf("pause of a stopped app: expected 409, got %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/start"); w.Code != http.StatusOK {
+		t.Fatalf("start: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/pause"); w.Code != http.StatusOK {
+		t.Fatalf("pause: %d body=%s", w.Code, w.Body.String())
+	}
+	if got := status(); got != "paused" {
+		t.Fatalf("expected status paused, got %q", got)
+	}
+	w := do(http.MethodPost, "/api/v1/apps/test-app/start")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "unpause") {
+		t.Fatalf("start while paused: expected 409 pointing at unpause, got %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/unpause"); w.Code != http.StatusOK {
+		t.Fatalf("unpause: %d body=%s", w.Code, w.Body.String())
+	}
+	if got := status(); got != "running" {
+		t.Fatalf("expected status running, got %q", got)
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/nonexistent/pause"); w.Code != http.StatusNotFound {
+		t.Fatalf("pause missing app: expected 404, got %d", w.Code)
+	}
+}
+
+func TestGinAppAPI_EnvUpdateAndRecreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := createGinTestServer(t, t.TempDir())
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+
+	appDef := &api.AppDefinition{
+		Name:        "test-app",
+		Image:       "alpine:latest",
+		Type:        "user",
+		Listeners:   []api.AppListener{{Name: "web", GuestPort: 80}},
+		Environment: map[string]string{"MODE": "dev"},
+	}
+	if _, err := server.appManager.Install(context.Background(), appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+	if err := server.appManager.Start(context.Background(), "test-app"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	server.appManager.SetReplaceTimeouts(app.ReplaceTimeouts{Ready: 100 * time.Millisecond})
+	healthy := true
+	server.appManager.SetReadinessProbe(func(ctx context.Context, target app.ReadinessTarget) error {
+		if !healthy {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	var resp struct {
+		Data app.ReplaceResult `json:"data"`
+	}
+	w := do(http.MethodPatch, "/api/v1/apps/test-app/env", `{"set":{"MODE":"prod"}}`)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Data.Mode != app.ReplaceRolling || resp.Data.ContainerID == "" {
+		t.Fatalf("env update: %d body=%s", w.Code, w.Body.String())
+	}
+	if inst, _ := server.appManager.Get(context.Background(), "test-app"); inst.Environment["MODE"] != "prod" || inst.ContainerID != resp.Data.ContainerID {
+		t.Fatalf("expected the new environment and container, got %+v", inst)
+	}
+
+	healthy = false
+	w = do(http.MethodPatch, "/api/v1/apps/test-app/env", `{"set":{"MODE":"broken"}}`)
+	apiErr := checkErrorEnvelope(t, "unhealthy replacement", w, http.StatusUnprocessableEntity, errorCodeReplaceUnhealthy)
+	if apiErr.MessageKey != msgReplaceUnhealthy || apiErr.Params["app"] != "test-app" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+	if inst, _ := server.appManager.Get(context.Background(), "test-app"); inst.Environment["MODE"] != "prod" || inst.ContainerID != resp.Data.ContainerID {
+		t.Fatalf("failed update changed the app: %+v", inst)
+	}
+
+	healthy = true
+	if w := do(http.MethodPost, "/api/v1/apps/test-app/recreate", ""); w.Code != http.StatusOK {
+		t.Fatalf("recreate: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/api/v1/apps/test-app/env", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty env update: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/api/v1/apps/test-app/env", `{"set":`); w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed env update: expected 400, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/apps/nonexistent/recreate", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("recreate missing app: expected 404, got %d", w.Code)
+	}
+}
+
 // TestGinAppAPI_FullLifecycle tests complete app lifecycle via Gin HTTP API
 func TestGinAppAPI_FullLifecycle(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -674,6 +893,294 @@ func TestGinAppAPI_Uninstall(t *testing.T) {
 	}
 }
 
+func TestGinAppAPI_UninstallPurgeRequiresConfirm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tempDir := t.TempDir()
+	server := createGinTestServer(t, tempDir)
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+	sub := server.events.Subscribe(events.TopicAudit, 4)
+
+	appDef := &api.AppDefinition{
+		Name:      "purge-me",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+	}
+	if err := server.ensureAppVolume(context.Background(), appDef); err != nil {
+		t.Fatalf("ensure volume: %v", err)
+	}
+	if _, err := server.appManager.Install(context.Background(), appDef); err != nil {
+		t.Fatalf("Failed to install app: %v", err)
+	}
+
+	for _, url := range []string{"/api/v1/apps/purge-me?purge=true", "/api/v1/apps/purge-me?purge=true&confirm=other"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, url, nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d body=%s", url, w.Code, w.Body.String())
+		}
+	}
+	if _, err := server.appManager.Get(context.Background(), "purge-me"); err != nil {
+		t.Fatalf("app must survive rejected purge: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/api/v1/apps/purge-me?purge=true&confirm=purge-me", nil)
+	attachAuth(req, sessionCookie, csrfToken)
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("purge: expected 200, got %d body=%s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Purge app.PurgeReport `json:"purge"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	mountDir := filepath.Join(tempDir, "mounts", "app-purge-me")
+	report := response.Data.Purge
+	if len(report.Volumes) != 1 || report.Volumes[0] != "app-purge-me" || len(report.Paths) != 1 || report.Paths[0] != mountDir {
+		t.Fatalf("unexpected purge report: %+v", report)
+	}
+	if _, err := os.Stat(mountDir); !os.IsNotExist(err) {
+		t.Fatalf("expected managed volume removed, stat err=%v", err)
+	}
+
+	select {
+	case evt := <-sub:
+		audit, ok := evt.Payload.(events.AuditEvent)
+		if !ok || audit.Kind != "app.purge" || audit.Metadata["app"] != "purge-me" {
+			t.Fatalf("unexpected audit event: %+v", evt.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected app.purge audit event")
+	}
+}
+
+func TestGinAppAPI_Tasks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := createGinTestServer(t, t.TempDir())
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+	ctx := context.Background()
+
+	appDef := &api.AppDefinition{
+		Name:      "cron-app",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+		Tasks:     []api.AppTask{{Name: "cleanup", Schedule: "@daily", Command: []string{"sh", "-c", "echo done"}}},
+	}
+	if err := server.ensureAppVolume(ctx, appDef); err != nil {
+		t.Fatalf("ensure volume: %v", err)
+	}
+	if _, err := server.appManager.Install(ctx, appDef); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+
+	run := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps/cron-app/tasks/cleanup/run", nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := run(); code != http.StatusConflict {
+		t.Fatalf("run on stopped app: expected 409, got %d", code)
+	}
+	if err := server.appManager.Start(ctx, "cron-app"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if code := run(); code != http.StatusAccepted {
+		t.Fatalf("run: expected 202, got %d", code)
+	}
+
+	var tasks []app.TaskStatus
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/apps/cron-app/tasks", nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list tasks: expected 200, got %d body=%s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data struct {
+				Tasks []app.TaskStatus `json:"tasks"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		tasks = response.Data.Tasks
+		if len(tasks) == 1 && len(tasks[0].Runs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run not recorded: %+v", tasks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := tasks[0].Runs[0]
+	if got.Trigger != "manual" || got.ExitCode == nil || *got.ExitCode != 0 || !strings.Contains(got.Output, "echo done") {
+		t.Fatalf("unexpected run %+v", got)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps/cron-app/tasks/nope/run", nil)
+	attachAuth(req, sessionCookie, csrfToken)
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown task: expected 404, got %d", w.Code)
+	}
+}
+
+func TestGinAppAPI_Logs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := createGinTestServer(t, t.TempDir())
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+	ctx := context.Background()
+
+	appDef := &api.AppDefinition{
+		Name:      "log-app",
+		Image:     "alpine:latest",
+		Type:      "user",
+		Listeners: []api.AppListener{{Name: "web", GuestPort: 80}},
+	}
+	if err := server.ensureAppVolume(ctx, appDef); err != nil {
+		t.Fatalf("ensure volume: %v", err)
+	}
+	if _, err := server.appManager.Install(ctx, appDef); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+
+	get := func(path string) (int, string, []app.LogEntry) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		var response struct {
+			Data struct {
+				Source  string         `json:"source"`
+				Entries []app.LogEntry `json:"entries"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data.Source, response.Data.Entries
+	}
+
+	code, source, entries := get("/api/v1/apps/log-app/logs?lines=3")
+	if code != http.StatusOK || source != app.LogSourceLive || len(entries) != 3 || entries[0].Message != "demo log entry" {
+		t.Fatalf("live logs: %d %s %+v", code, source, entries)
+	}
+	code, source, entries = get("/api/v1/apps/log-app/logs?source=archive&since=2026-01-01T00:00:00Z&until=2026-01-02T00:00:00Z")
+	if code != http.StatusOK || source != app.LogSourceArchive || entries == nil || len(entries) != 0 {
+		t.Fatalf("empty archive: %d %s %+v", code, source, entries)
+	}
+	for _, path := range []string{
+		"/api/v1/apps/log-app/logs?source=journal",
+		"/api/v1/apps/log-app/logs?since=yesterday",
+		"/api/v1/apps/log-app/logs?lines=0",
+		"/api/v1/apps/log-app/logs?source=live&since=2026-01-01T00:00:00Z",
+	} {
+		if code, _, _ := get(path); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", path, code)
+		}
+	}
+	if code, _, _ := get("/api/v1/apps/nope/logs"); code != http.StatusNotFound {
+		t.Fatalf("unknown app: expected 404, got %d", code)
+	}
+}
+
+func TestGinAppAPI_DiffAndHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := createGinTestServer(t, t.TempDir())
+	sessionCookie, csrfToken := setupTestAdminSession(t, server)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, sessionCookie, csrfToken)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	original := `name: diff-app
+image: docker.io/library/nginx:alpine
+type: user
+listeners:
+  - name: web
+    guest_port: 80
+environment:
+  MODE: prod
+  API_TOKEN: abc123`
+	updated := `name: diff-app
+image: docker.io/library/nginx:1.27
+type: user
+listeners:
+  - name: web
+    guest_port: 80
+  - name: admin
+    guest_port: 9000
+environment:
+  MODE: prod
+  API_TOKEN: xyz789`
+	if w := post("/api/v1/apps", original); w.Code != http.StatusCreated {
+		t.Fatalf("install: status %d body=%s", w.Code, w.Body.String())
+	}
+
+	w := post("/api/v1/apps/diff-app/diff", updated)
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff: expected 200, got %d body=%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "xyz789") || strings.Contains(w.Body.String(), "abc123") {
+		t.Fatalf("diff leaks a secret: %s", w.Body.String())
+	}
+	var diffResp struct {
+		Data app.DefinitionDiff `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &diffResp); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	d := diffResp.Data
+	if !d.Changed || d.Image == nil || len(d.Environment) != 1 || !d.Environment[0].Masked || len(d.Listeners) != 1 || d.Listeners[0].Name != "admin" {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+
+	if w := post("/api/v1/apps/other/diff", updated); w.Code != http.StatusBadRequest {
+		t.Fatalf("name mismatch: expected 400, got %d", w.Code)
+	}
+	if w := post("/api/v1/apps/nope/diff", strings.Replace(updated, "diff-app", "nope", 1)); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown app: expected 404, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := post("/api/v1/apps", updated); w.Code != http.StatusCreated {
+		t.Fatalf("upsert: status %d body=%s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/apps/diff-app/history", nil)
+	attachAuth(req, sessionCookie, csrfToken)
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history: expected 200, got %d body=%s", w.Code, w.Body.String())
+	}
+	var historyResp struct {
+		Data struct {
+			Changes []app.DefinitionChange `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &historyResp); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if changes := historyResp.Data.Changes; len(changes) != 1 || len(changes[0].Summary) != 3 {
+		t.Fatalf("unexpected history: %+v", changes)
+	}
+}
+
 // TestInvalidRoutes tests invalid route handling with Gin
 func TestInvalidRoutes(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -801,6 +1308,9 @@ func TestHandlePersistenceFullExport(t *testing.T) {
 				Path string `json:"path"`
 				Kind string `json:"kind"`
 			} `json:"artifact"`
+			Job struct {
+				ID string `json:"id"`
+			} `json:"job"`
 		} `json:"data"`
 		Message string `json:"message"`
 	}
@@ -816,18 +1326,34 @@ func TestHandlePersistenceFullExport(t *testing.T) {
 	if resp.Message == "" {
 		t.Fatalf("expected success message")
 	}
+
+	// The export is recorded as a job pollable alongside image pulls.
+	if resp.Data.Job.ID == "" {
+		t.Fatalf("expected export job reference, body=%s", w.Body.String())
+	}
+	w = doAuthedRequest(server, sessionCookie, csrfToken, http.MethodGet, "/api/v1/jobs/"+resp.Data.Job.ID, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"kind":"export.full"`) || !strings.Contains(w.Body.String(), `"state":"succeeded"`) {
+		t.Fatalf("export job lookup: %d %s", w.Code, w.Body.String())
+	}
 }
 
 // createGinTestServer creates a Gin test server instance with filesystem state management
 func createGinTestServer(t *testing.T, tempDir string) *GinServer {
 	t.Helper()
-	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
-	ensureTestControlMetadata(t, tempDir)
 	// Create mock container manager for app manager
 	mockContainer := &GinMockContainerManager{
 		containers: make(map[string]*MockContainer),
 		nextID:     1,
 	}
+	return createGinTestServerWithContainers(t, tempDir, mockContainer)
+}
+
+// createGinTestServerWithContainers is createGinTestServer with a caller-owned
+// container mock, for tests that inject delays or missing images.
+func createGinTestServerWithContainers(t *testing.T, tempDir string, mockContainer *GinMockContainerManager) *GinServer {
+	t.Helper()
+	t.Setenv("PICCOLO_ALLOW_UNMOUNTED_TESTS", "1")
+	ensureTestControlMetadata(t, tempDir)
 
 	// Create filesystem app manager with service manager
 	svcMgr := services.NewServiceManager()
@@ -839,6 +1365,9 @@ func createGinTestServer(t *testing.T, tempDir string) *GinServer {
 	appMgr.SetMountVerifier(func(string) error { return nil })
 	eventsBus := events.NewBus()
 	appMgr.ObserveRuntimeEvents(eventsBus)
+	// The unlock below restores services in the background; wait for it
+	// before the caller's temp dir is removed.
+	t.Cleanup(appMgr.StopRuntimeEvents)
 	eventsBus.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: false}})
 	appMgr.ForceLockState(false)
 
@@ -873,6 +1402,17 @@ func createGinTestServer(t *testing.T, tempDir string) *GinServer {
 	dispatch.Register(persistence.CommandRecordLockState, commands.HandlerFunc(func(context.Context, commands.Command) (commands.Response, error) {
 		return nil, nil
 	}))
+	dispatch.Register(persistence.CommandRemoveVolume, commands.HandlerFunc(func(ctx context.Context, cmd commands.Command) (commands.Response, error) {
+		req, ok := cmd.(persistence.RemoveVolumeCommand)
+		if !ok {
+			return nil, fmt.Errorf("unexpected command type %T", cmd)
+		}
+		mountDir := filepath.Join(tempDir, "mounts", req.ID)
+		if err := os.RemoveAll(mountDir); err != nil {
+			return nil, err
+		}
+		return persistence.VolumeRemoval{ID: req.ID, Paths: []string{mountDir}}, nil
+	}))
 
 	// Create minimal server instance for testing
 	rm, err := remote.NewManager(tempDir)
@@ -880,6 +1420,7 @@ func createGinTestServer(t *testing.T, tempDir string) *GinServer {
 		t.Fatalf("remote mgr: %v", err)
 	}
 	rm.SetNexusAdapter(nexusclient.NewStub())
+	rm.SetListenerLookup(svcMgr)
 	tlsMux := services.NewTlsMux(svcMgr)
 	remoteResolver := newServiceRemoteResolver(svcMgr)
 	server := &GinServer{
@@ -897,17 +1438,21 @@ func createGinTestServer(t *testing.T, tempDir string) *GinServer {
 		remoteResolver: remoteResolver,
 	}
 	server.events = eventsBus
+	appMgr.SetVolumePurger(server.purgeAppVolume)
 	server.healthTracker.Setf("app-manager", health.LevelOK, "test app manager ready")
 	server.healthTracker.Setf("service-manager", health.LevelOK, "test service manager ready")
 	server.healthTracker.Setf("mdns", health.LevelOK, "mdns stub")
 	server.healthTracker.Setf("remote", health.LevelOK, "remote stub")
 	server.healthTracker.Setf("persistence", health.LevelOK, "stub persistence ready")
-	server.registerUnlockReloader(rm)
+	server.healthTracker.Setf("storage", health.LevelOK, "stub volumes mounted")
+	server.registerUnlockReloader("remote", rm)
 	server.observeRemoteConfig(eventsBus)
 	rm.SetEventsBus(eventsBus)
+	rm.SetHTTP01ListenerCheck(server.acmeListenerCheck)
 
 	// Setup Gin routes
 	server.setupGinRoutes()
+	server.capabilities = server.buildCapabilities()
 	if err := server.initSecureLoopback(); err != nil {
 		t.Fatalf("secure loopback init: %v", err)
 	}
@@ -1018,6 +1563,21 @@ func attachAuth(req *http.Request, cookie *http.Cookie, csrfToken string) {
 	}
 }
 
+// doAuthedRequest serves a request with an optional JSON body, signed in
+// with cookie and csrf unless cookie is nil.
+func doAuthedRequest(srv *GinServer, cookie *http.Cookie, csrf, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cookie != nil {
+		attachAuth(req, cookie, csrf)
+	}
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
 // MockContainer represents a mock container for testing
 type MockContainer struct {
 	ID     string
@@ -1040,9 +1600,51 @@ type GinMockContainerManager struct {
 	startError  error
 	stopError   error
 	removeError error
+	// createDelay simulates a slow runtime and ends early when ctx is done.
+	createDelay time.Duration
+	// states overrides what Inspect reports for a container ID.
+	states map[string]container.ContainerState
+
+	imagesMu sync.Mutex
+	// missingImages are absent locally until pulled.
+	missingImages map[string]bool
+	// pullGate, when set, holds pulls until it is closed or ctx is done.
+	pullGate     chan struct{}
+	pullCanceled bool
+
+	pingMu sync.Mutex
+	// pingError, when set, makes Ping report the runtime unreachable.
+	pingError error
+}
+
+func (m *GinMockContainerManager) setPingError(err error) {
+	m.pingMu.Lock()
+	m.pingError = err
+	m.pingMu.Unlock()
+}
+
+func (m *GinMockContainerManager) Ping(ctx context.Context) (container.RuntimeInfo, error) {
+	m.pingMu.Lock()
+	defer m.pingMu.Unlock()
+	if m.pingError != nil {
+		return container.RuntimeInfo{}, m.pingError
+	}
+	return container.RuntimeInfo{Version: "5.0.0-mock", SocketPath: "/run/podman/podman.sock"}, nil
+}
+
+// Exec echoes the command back as its output.
+func (m *GinMockContainerManager) Exec(ctx context.Context, containerID string, argv []string, timeout time.Duration) (container.ExecResult, error) {
+	return container.ExecResult{Output: strings.Join(argv, " ") + "\n"}, nil
 }
 
 func (m *GinMockContainerManager) CreateContainer(ctx context.Context, spec container.ContainerCreateSpec) (string, error) {
+	if m.createDelay > 0 {
+		select {
+		case <-time.After(m.createDelay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
 	if m.createError != nil {
 		return "", m.createError
 	}
@@ -1090,6 +1692,22 @@ func (m *GinMockContainerManager) StopContainer(ctx context.Context, containerID
 	return container.ErrContainerNotFound(containerID)
 }
 
+func (m *GinMockContainerManager) PauseContainer(ctx context.Context, containerID string) error {
+	if container, exists := m.containers[containerID]; exists {
+		container.Status = "paused"
+		return nil
+	}
+	return container.ErrContainerNotFound(containerID)
+}
+
+func (m *GinMockContainerManager) UnpauseContainer(ctx context.Context, containerID string) error {
+	if container, exists := m.containers[containerID]; exists {
+		container.Status = "running"
+		return nil
+	}
+	return container.ErrContainerNotFound(containerID)
+}
+
 func (m *GinMockContainerManager) RemoveContainer(ctx context.Context, containerID string) error {
 	if m.removeError != nil {
 		return m.removeError
@@ -1103,9 +1721,51 @@ func (m *GinMockContainerManager) RemoveContainer(ctx context.Context, container
 }
 
 func (m *GinMockContainerManager) PullImage(ctx context.Context, image string) error {
+	return m.PullImageProgress(ctx, image, nil)
+}
+
+func (m *GinMockContainerManager) ImageExists(ctx context.Context, image string) (bool, error) {
+	m.imagesMu.Lock()
+	defer m.imagesMu.Unlock()
+	return !m.missingImages[image], nil
+}
+
+func (m *GinMockContainerManager) PullImageProgress(ctx context.Context, image string, report func(container.PullProgress)) error {
+	if report != nil {
+		report(container.PullProgress{Stage: container.PullStageCopying, BlobsDone: 1, BlobsTotal: 2, Line: "Copying blob 59bf1c3509f3 done"})
+	}
+	m.imagesMu.Lock()
+	gate := m.pullGate
+	m.imagesMu.Unlock()
+	if gate != nil {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			m.imagesMu.Lock()
+			m.pullCanceled = true
+			m.imagesMu.Unlock()
+			return ctx.Err()
+		}
+	}
+	m.imagesMu.Lock()
+	delete(m.missingImages, image)
+	m.imagesMu.Unlock()
+	if report != nil {
+		report(container.PullProgress{Stage: container.PullStageDone})
+	}
 	return nil
 }
 
+// FollowLogs streams nothing until ctx is done.
+func (m *GinMockContainerManager) FollowLogs(ctx context.Context, containerID string, since time.Time) (<-chan container.LogLine, error) {
+	out := make(chan container.LogLine)
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+	return out, nil
+}
+
 func (m *GinMockContainerManager) Logs(ctx context.Context, containerID string, lines int) ([]string, error) {
 	if _, ok := m.containers[containerID]; !ok {
 		return nil, container.ErrContainerNotFound(containerID)
@@ -1119,3 +1779,254 @@ func (m *GinMockContainerManager) Logs(ctx context.Context, containerID string,
 	}
 	return out, nil
 }
+
+func (m *GinMockContainerManager) Inspect(ctx context.Context, containerID string) (container.ContainerState, error) {
+	if st, ok := m.states[containerID]; ok {
+		return st, nil
+	}
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.ContainerState{}, container.ErrContainerNotFound(containerID)
+	}
+	return container.ContainerState{Status: c.Status, Running: c.Status == "running", Paused: c.Status == "paused"}, nil
+}
+
+func TestAppErrors_StorageSentinelsMapToStatusAndCode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gin_app_errors_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	const manifest = "name: blog\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: web\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
+	call := func(endpoint string) *httptest.ResponseRecorder {
+		var req *http.Request
+		switch endpoint {
+		case "install":
+			req, _ = http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(manifest))
+			req.Header.Set("Content-Type", "application/x-yaml")
+		case "list":
+			req, _ = http.NewRequest(http.MethodGet, "/api/v1/apps", nil)
+		case "start":
+			req, _ = http.NewRequest(http.MethodPost, "/api/v1/apps/blog/start", nil)
+		}
+		attachAuth(req, cookie, csrf)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	expect := func(endpoint string, status int, code string) {
+		t.Helper()
+		w := call(endpoint)
+		var resp errorEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+			t.Fatalf("%s: undecodable error body %q (%v)", endpoint, w.Body.String(), err)
+		}
+		if w.Code != status || resp.Error.Code != code {
+			t.Fatalf("%s: got %d/%q, want %d/%q body=%s", endpoint, w.Code, resp.Error.Code, status, code, w.Body.String())
+		}
+		wantHint := ""
+		if code == errorCodeLocked {
+			wantHint = unlockHintURL
+		}
+		if resp.Error.Hint != wantHint {
+			t.Fatalf("%s: hint = %q, want %q", endpoint, resp.Error.Hint, wantHint)
+		}
+	}
+
+	if w := call("install"); w.Code != http.StatusCreated {
+		t.Fatalf("install: %d body=%s", w.Code, w.Body.String())
+	}
+
+	srv.appManager.ForceLockState(true)
+	for _, endpoint := range []string{"install", "list", "start"} {
+		expect(endpoint, http.StatusLocked, errorCodeLocked)
+	}
+	srv.appManager.ForceLockState(false)
+
+	srv.appManager.SetMountVerifier(func(string) error { return app.ErrVolumeUnavailable })
+	for _, endpoint := range []string{"install", "list", "start"} {
+		expect(endpoint, http.StatusServiceUnavailable, errorCodeVolumeUnavailable)
+	}
+	srv.appManager.SetMountVerifier(func(string) error { return nil })
+
+	srv.events.Publish(events.Event{Topic: events.TopicLeadershipRoleChanged, Payload: events.LeadershipChanged{Resource: cluster.ResourceKernel, Role: cluster.RoleFollower}})
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.appManager.LastObservedRole(cluster.ResourceKernel) != cluster.RoleFollower {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower role never observed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, endpoint := range []string{"install", "start"} {
+		expect(endpoint, http.StatusConflict, errorCodeNotLeader)
+	}
+	if w := call("list"); w.Code != http.StatusOK {
+		t.Fatalf("list on follower: expected 200, got %d", w.Code)
+	}
+
+	// The route guard reports a locked control store the same way.
+	if err := srv.cryptoManager.Setup("TestPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+	expect("start", http.StatusLocked, errorCodeLocked)
+}
+
+func TestGinAppInstall_RejectsNewerAPIVersion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gin_app_version_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	const body = "name: blog\nimage: docker.io/library/nginx:alpine\nlisteners:\n  - name: web\n    guest_port: 80\n"
+	post := func(path, manifest string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, cookie, csrf)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	type versionInfo struct {
+		Valid               bool   `json:"valid"`
+		APIVersion          string `json:"api_version"`
+		SupportedAPIVersion string `json:"supported_api_version"`
+	}
+	type versionResponse struct {
+		Data  versionInfo `json:"data"`
+		Error *struct {
+			Code    string      `json:"code"`
+			Details versionInfo `json:"details"`
+		} `json:"error"`
+	}
+
+	w := post("/api/v1/apps/validate", body)
+	var resp versionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("validate legacy: %d %s", w.Code, w.Body.String())
+	}
+	if !resp.Data.Valid || resp.Data.APIVersion != app.AppAPIVersion || resp.Data.SupportedAPIVersion != app.AppAPIVersion {
+		t.Fatalf("validate should report the detected version: %s", w.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/apps/validate", "/api/v1/apps"} {
+		w = post(path, "apiVersion: piccolo/v2\n"+body)
+		resp = versionResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusBadRequest || resp.Error == nil {
+			t.Fatalf("%s: expected structured 400, got %d %s", path, w.Code, w.Body.String())
+		}
+		if resp.Error.Code != errorCodeUnsupportedVersion || resp.Error.Details.APIVersion != "piccolo/v2" || resp.Error.Details.SupportedAPIVersion != app.AppAPIVersion {
+			t.Fatalf("%s: unexpected error body %s", path, w.Body.String())
+		}
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("rejected install must not create the app, got %d", w.Code)
+	}
+}
+
+func TestGinAppGet_SurfacesContainerFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gin_app_failure_test")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mock := &GinMockContainerManager{containers: make(map[string]*MockContainer), nextID: 1}
+	srv := createGinTestServerWithContainers(t, tempDir, mock)
+	t.Cleanup(srv.serviceManager.StopAll)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	install := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(jobTestManifest))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A create failure is rolled back and answered with the step log; the
+	// app stays visible with the failed step and the runtime's reason.
+	mock.createError = errors.New("choosing an image from manifest list: no image found for architecture amd64")
+	w := install()
+	apiErr := checkErrorEnvelope(t, "install with create failure", w, http.StatusInternalServerError, errorCodeInternal)
+	var details struct {
+		Step  string            `json:"step"`
+		Steps []app.InstallStep `json:"steps"`
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	if err := json.Unmarshal(raw, &details); err != nil || details.Step != app.InstallStepCreateContainer || len(details.Steps) != 5 {
+		t.Fatalf("install error details: %s (%v)", raw, err)
+	}
+	if st := details.Steps[2]; st.Status != app.InstallStepFailed || !strings.Contains(st.Error, "no image found for architecture") {
+		t.Fatalf("create step: %+v", st)
+	}
+	if st := details.Steps[0]; st.Name != app.InstallStepAllocatePorts || st.Status != app.InstallStepRolledBack {
+		t.Fatalf("allocate step: %+v", st)
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"created"`) || !strings.Contains(w.Body.String(), "create container: choosing an image from manifest list: no image found for architecture") {
+		t.Fatalf("get after failed install: %d body=%s", w.Code, w.Body.String())
+	}
+
+	// A start failure reports the exit code Podman recorded.
+	mock.createError = nil
+	if w := install(); w.Code != http.StatusCreated {
+		t.Fatalf("install: %d body=%s", w.Code, w.Body.String())
+	}
+	mock.startError = errors.New("podman start failed: exit status 125")
+	mock.states = map[string]container.ContainerState{
+		"mock-container-1": {Status: "created", ExitCode: 126, Error: "crun: permission denied: OCI permission denied"},
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/apps/blog/start", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("start: %d body=%s", w.Code, w.Body.String())
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", "")
+	body := w.Body.String()
+	if !strings.Contains(body, `"status":"error"`) || !strings.Contains(body, `"exit_code":126`) || !strings.Contains(body, "OCI permission denied") {
+		t.Fatalf("get after failed start: %d body=%s", w.Code, body)
+	}
+}
+
+func TestGinAppInstall_ConcurrentInstallAnswers409(t *testing.T) {
+	mock := &GinMockContainerManager{containers: make(map[string]*MockContainer), nextID: 1, createDelay: time.Second}
+	srv := createGinTestServerWithContainers(t, t.TempDir(), mock)
+	t.Cleanup(srv.serviceManager.StopAll)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	install := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(jobTestManifest))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- install() }()
+	// Ports are allocated under the app lock, before the slow create.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := srv.serviceManager.GetByApp("blog"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first install never allocated ports")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	apiErr := checkErrorEnvelope(t, "second install", install(), http.StatusConflict, errorCodeOperationBusy)
+	raw, _ := json.Marshal(apiErr.Details)
+	if !strings.Contains(string(raw), `"operation":"install"`) {
+		t.Fatalf("unexpected details %s", raw)
+	}
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Fatalf("first install: %d body=%s", w.Code, w.Body.String())
+	}
+}
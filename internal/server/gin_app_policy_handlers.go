@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/app"
+	"piccolod/internal/persistence"
+)
+
+// errorCodeCapabilityDenied and errorCodeCapabilityConfirm mark installs
+// refused for the capabilities an app declares.
+const (
+	errorCodeCapabilityDenied  = "capability_denied"
+	errorCodeCapabilityConfirm = "capability_confirmation_required"
+)
+
+// appPolicyRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set appPolicies directly).
+func (s *GinServer) appPolicyRepo() persistence.AppPolicyRepo {
+	if s.appPolicies != nil {
+		return s.appPolicies
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().AppPolicy()
+}
+
+// reloadAppPolicy hands the stored app policy to the app manager once the
+// control store is readable. Until then every capability is denied.
+func (s *GinServer) reloadAppPolicy() error {
+	repo := s.appPolicyRepo()
+	if repo == nil || s.appManager == nil {
+		return nil
+	}
+	stored, err := repo.CurrentPolicy(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	policy, err := app.NormalizeCapabilityPolicy(app.CapabilityPolicy{Devices: stored.Devices, Linux: stored.Linux, HostNetwork: stored.HostNetwork})
+	if err != nil {
+		return err
+	}
+	s.appManager.SetCapabilityPolicy(policy)
+	return nil
+}
+
+func (s *GinServer) appPolicyResponse() app.CapabilityPolicy {
+	if s.appManager == nil {
+		return app.CapabilityPolicy{Devices: map[string]string{}, Linux: map[string]string{}, HostNetwork: app.CapabilityDeny}
+	}
+	return s.appManager.CapabilityPolicy()
+}
+
+// handleSystemAppPolicyGet: GET /api/v1/system/app-policy
+func (s *GinServer) handleSystemAppPolicyGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.appPolicyResponse())
+}
+
+// handleSystemAppPolicyUpdate: PUT /api/v1/system/app-policy
+func (s *GinServer) handleSystemAppPolicyUpdate(c *gin.Context) {
+	if s.appManager == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "app manager unavailable")
+		return
+	}
+	var req app.CapabilityPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	policy, err := app.NormalizeCapabilityPolicy(req)
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	repo := s.appPolicyRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "app policy storage unavailable")
+		return
+	}
+	err = repo.SavePolicy(c.Request.Context(), persistence.AppPolicy{
+		Devices:     policy.Devices,
+		Linux:       policy.Linux,
+		HostNetwork: policy.HostNetwork,
+		UpdatedAt:   time.Now().UTC(),
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.appManager.SetCapabilityPolicy(policy)
+
+	s.recordActivity(c, "system", activity.LevelInfo, "App capability policy updated")
+	c.JSON(http.StatusOK, s.appPolicyResponse())
+}
+
+// writeCapabilityError answers an install refused for the capabilities the
+// app declares: 403 listing what the policy denies, or what needs the
+// confirm_capabilities flag.
+func writeCapabilityError(c *gin.Context, capErr *app.CapabilityError, action string) {
+	details := gin.H{"denied": nonNilStatuses(capErr.Denied), "needs_confirmation": nonNilStatuses(capErr.Unconfirmed)}
+	msg := "Unable to " + action + ": " + capErr.Error()
+	if len(capErr.Denied) > 0 {
+		env := newErrorEnvelope(c, errorCodeCapabilityDenied, msg, details)
+		env.Error.Hint = "An admin can permit these in PUT /api/v1/system/app-policy."
+		c.JSON(http.StatusForbidden, env)
+		return
+	}
+	env := newErrorEnvelope(c, errorCodeCapabilityConfirm, msg, details)
+	env.Error.Hint = "Repeat the request with confirm_capabilities=true to grant them."
+	c.JSON(http.StatusForbidden, env)
+}
+
+func nonNilStatuses(v []app.CapabilityStatus) []app.CapabilityStatus {
+	if v == nil {
+		return []app.CapabilityStatus{}
+	}
+	return v
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"piccolod/internal/app"
+	"piccolod/internal/persistence"
+)
+
+type memoryAppPolicyRepo struct {
+	mu    sync.Mutex
+	saved *persistence.AppPolicy
+}
+
+func (r *memoryAppPolicyRepo) CurrentPolicy(ctx context.Context) (persistence.AppPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.AppPolicy{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryAppPolicyRepo) SavePolicy(ctx context.Context, policy persistence.AppPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &policy
+	return nil
+}
+
+const transcoderYAML = `name: transcoder
+image: docker.io/library/nginx:alpine
+type: user
+listeners:
+  - name: web
+    guest_port: 80
+    flow: tcp
+    protocol: http
+capabilities:
+  devices:
+    - /dev/dri
+  linux:
+    - sys_admin
+`
+
+func TestSystemAppPolicy_GatesInstall(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryAppPolicyRepo{}
+	srv.appPolicies = repo
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) (string, map[string]json.RawMessage) {
+		var env struct {
+			Error struct {
+				Code    string                     `json:"code"`
+				Details map[string]json.RawMessage `json:"details"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &env)
+		return env.Error.Code, env.Error.Details
+	}
+
+	w := do(http.MethodPost, "/api/v1/apps/validate", "application/x-yaml", transcoderYAML)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SYS_ADMIN") {
+		t.Fatalf("validate: expected a SYS_ADMIN warning, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	// Nothing is permitted by default.
+	w = do(http.MethodPost, "/api/v1/apps", "application/x-yaml", transcoderYAML)
+	if code, details := errorCode(w); w.Code != http.StatusForbidden || code != errorCodeCapabilityDenied || !strings.Contains(string(details["denied"]), "/dev/dri") {
+		t.Fatalf("install: expected capability_denied, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{`{"devices":{"/etc":"allow"}}`, `{"linux":{"SYS_ADMIN":"sometimes"}}`, `not json`} {
+		if w := do(http.MethodPut, "/api/v1/system/app-policy", "application/json", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d body=%s", body, w.Code, w.Body.String())
+		}
+	}
+	if repo.saved != nil {
+		t.Fatalf("refused policy was persisted: %+v", repo.saved)
+	}
+	w = do(http.MethodPut, "/api/v1/system/app-policy", "application/json", `{"devices":{"/dev/dri":"allow"},"linux":{"cap_sys_admin":"confirm"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	var policy app.CapabilityPolicy
+	if err := json.Unmarshal(w.Body.Bytes(), &policy); err != nil || policy.Linux["SYS_ADMIN"] != app.CapabilityConfirm || policy.HostNetwork != app.CapabilityDeny {
+		t.Fatalf("unexpected policy %s (%v)", w.Body.String(), err)
+	}
+	if repo.saved == nil || repo.saved.Devices["/dev/dri"] != app.CapabilityAllow {
+		t.Fatalf("policy not persisted: %+v", repo.saved)
+	}
+
+	w = do(http.MethodPost, "/api/v1/apps", "application/x-yaml", transcoderYAML)
+	if code, details := errorCode(w); w.Code != http.StatusForbidden || code != errorCodeCapabilityConfirm || !strings.Contains(string(details["needs_confirmation"]), "SYS_ADMIN") {
+		t.Fatalf("install: expected confirmation required, got %d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/apps?confirm_capabilities=true", "application/x-yaml", transcoderYAML); w.Code != http.StatusCreated {
+		t.Fatalf("confirmed install: %d body=%s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/api/v1/apps/transcoder", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"capabilities"`) || !strings.Contains(w.Body.String(), `"granted":true`) {
+		t.Fatalf("get app: %d body=%s", w.Code, w.Body.String())
+	}
+
+	// The stored policy is adopted when the control store unlocks.
+	srv.appManager.SetCapabilityPolicy(app.CapabilityPolicy{})
+	if err := srv.reloadAppPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	w = do(http.MethodGet, "/api/v1/system/app-policy", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/dev/dri") {
+		t.Fatalf("get after reload: %d body=%s", w.Code, w.Body.String())
+	}
+}
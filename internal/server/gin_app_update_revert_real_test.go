@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 )
 
@@ -59,3 +60,61 @@ func TestAppServicesDiscovery_RealHandlers(t *testing.T) {
 		t.Fatalf("expected at least one app service, got 0")
 	}
 }
+
+func TestServiceHints_ListsLiveHints(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "service_hints_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	srv := createGinTestServer(t, tempDir)
+	sessionCookie, csrfToken := setupTestAdminSession(t, srv)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/services/hints", nil)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+
+	body := []byte("name: demo\nimage: alpine:3.18\ntype: user\nlisteners:\n - name: web\n   guest_port: 80\n")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/apps", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	attachAuth(req, sessionCookie, csrfToken)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("install status %d body=%s", w.Code, w.Body.String())
+	}
+	ep, ok := srv.serviceManager.GetAppListener("demo", "web")
+	if !ok {
+		t.Fatalf("expected web listener")
+	}
+	srv.serviceManager.RegisterProxyHint(ep.PublicPort, 50001, 443, true, "")
+	srv.serviceManager.RegisterProxyHint(ep.PublicPort, 50002, 80, false, "")
+	srv.serviceManager.ForgetProxyHint(ep.PublicPort, 50002)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/services/hints", nil)
+	attachAuth(req, sessionCookie, csrfToken)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("hints status %d", w.Code)
+	}
+	var resp struct {
+		Hints []map[string]any `json:"hints"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Hints) != 1 {
+		t.Fatalf("expected one live hint, got %v", resp.Hints)
+	}
+	h := resp.Hints[0]
+	if h["app"] != "demo" || h["listener"] != "web" || h["source_port"] != float64(50001) || h["tls"] != true {
+		t.Fatalf("unexpected hint %v", h)
+	}
+	if _, ok := h["age_ms"]; !ok {
+		t.Fatalf("expected hint age, got %v", h)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"piccolod/internal/activity"
+	"piccolod/internal/auth"
 	"piccolod/internal/crypt"
 	"piccolod/internal/events"
 	"piccolod/internal/persistence"
@@ -20,7 +23,7 @@ const sessionCookieName = "piccolo_session"
 func (s *GinServer) setSessionCookie(c *gin.Context, id string, ttl time.Duration) {
 	secure := false
 	if s != nil {
-		secure = s.isSecureRequest(c.Request)
+		secure = s.requestSecure(c)
 	}
 	// Prefer SameSite=Lax for session cookie
 	c.SetSameSite(http.SameSiteLaxMode)
@@ -95,6 +98,8 @@ func (s *GinServer) handleAuthSession(c *gin.Context) {
 				"authenticated":  true,
 				"user":           sess.User,
 				"expires_at":     time.Unix(sess.ExpiresAt, 0).UTC().Format(time.RFC3339),
+				"created_at":     sess.CreatedAt.UTC().Format(time.RFC3339),
+				"last_seen":      sess.LastSeen.UTC().Format(time.RFC3339),
 				"volumes_locked": locked,
 				"password_stale": passwordStale,
 				"recovery_stale": recoveryStale,
@@ -118,35 +123,43 @@ func (s *GinServer) handleAuthSession(c *gin.Context) {
 
 // handleAuthSetup: POST /api/v1/auth/setup
 func (s *GinServer) handleAuthSetup(c *gin.Context) {
+	if s.rejectIfSetupComplete(c) {
+		return
+	}
 	var body struct {
 		Password string `json:"password"`
 	}
 	if err := c.BindJSON(&body); err != nil || body.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
+		return
+	}
+	if err := auth.CheckPasswordPolicy(body.Password); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordPolicy, msgParams{"reason": err.Error()})
 		return
 	}
 	ctx := c.Request.Context()
 	initialized, err := s.authManager.IsInitialized(ctx)
 	if err != nil {
 		if errors.Is(err, persistence.ErrLocked) {
-			c.JSON(http.StatusLocked, gin.H{"error": "storage locked; unlock Piccolo to continue"})
+			writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read auth state"})
+		writeGinMessage(c, http.StatusInternalServerError, msgAuthState, nil)
 		return
 	}
 	if initialized {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "already initialized"})
+		writeGinMessage(c, http.StatusBadRequest, msgAlreadyInitialized, nil)
 		return
 	}
 	if err := s.authManager.Setup(ctx, body.Password); err != nil {
 		if errors.Is(err, persistence.ErrLocked) {
-			c.JSON(http.StatusLocked, gin.H{"error": "storage locked; unlock Piccolo to continue"})
+			writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 			return
 		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "set the admin password", "reason": err.Error()})
 		return
 	}
+	s.recordActivity(c, "auth", activity.LevelInfo, "Admin password set")
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
 }
 
@@ -154,12 +167,12 @@ func (s *GinServer) handleAuthSetup(c *gin.Context) {
 func (s *GinServer) handleAuthLogin(c *gin.Context) {
 	var body struct{ Username, Password string }
 	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
 		return
 	}
 	username := strings.TrimSpace(body.Username)
 	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username required"})
+		writeGinMessage(c, http.StatusBadRequest, msgUsernameRequired, nil)
 		return
 	}
 	// Single local admin account; verify password only
@@ -169,14 +182,14 @@ func (s *GinServer) handleAuthLogin(c *gin.Context) {
 		if errors.Is(err, persistence.ErrLocked) && s.cryptoManager != nil {
 			if unlockErr := s.cryptoManager.Unlock(body.Password); unlockErr != nil {
 				if errors.Is(unlockErr, crypt.ErrNotInitialized) {
-					c.JSON(http.StatusBadRequest, gin.H{"error": "not initialized"})
+					writeGinMessage(c, http.StatusBadRequest, msgNotInitialized, nil)
 					return
 				}
 				if s.recordLoginFailure() {
 					c.Header("Retry-After", "5")
-					c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too Many Requests"})
+					writeGinMessage(c, http.StatusTooManyRequests, errorCodeRateLimited, nil)
 				} else {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+					writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 				}
 				return
 			}
@@ -187,25 +200,27 @@ func (s *GinServer) handleAuthLogin(c *gin.Context) {
 		}
 		if err != nil {
 			if errors.Is(err, persistence.ErrLocked) {
-				c.JSON(http.StatusLocked, gin.H{"error": "storage locked; unlock Piccolo to continue"})
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify credentials"})
+			writeGinMessage(c, http.StatusInternalServerError, msgVerifyCredentials, nil)
 			return
 		}
 	}
 	if !ok {
+		s.recordActivity(c, "auth", activity.LevelWarn, "Login failed")
 		if s.recordLoginFailure() {
 			c.Header("Retry-After", "5")
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too Many Requests"})
+			writeGinMessage(c, http.StatusTooManyRequests, errorCodeRateLimited, nil)
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		}
 		return
 	}
 	s.resetLoginFailures()
-	sess := s.sessions.Create("admin", 3600) // 1h default
-	s.setSessionCookie(c, sess.ID, time.Hour)
+	sess := s.sessions.CreateFrom("admin", requestClientIP(c), c.Request.UserAgent())
+	s.setSessionCookie(c, sess.ID, s.sessions.Policy().MaxLifetime)
+	s.recordActivity(c, "auth", activity.LevelInfo, "Admin signed in")
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
 }
 
@@ -215,60 +230,79 @@ func (s *GinServer) handleAuthLogout(c *gin.Context) {
 		s.sessions.Delete(id)
 	}
 	s.clearSessionCookie(c)
+	s.recordActivity(c, "auth", activity.LevelInfo, "Admin signed out")
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
 }
 
 // handleAuthPassword: POST /api/v1/auth/password
+// Changes the admin password after checking the current one. The caller's
+// session is reissued under a new ID and CSRF token; every other session is
+// signed out.
 func (s *GinServer) handleAuthPassword(c *gin.Context) {
 	id, ok := s.getSession(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		return
 	}
 	if _, ok := s.sessions.Get(id); !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		return
 	}
 	var body struct {
-		OldPassword string `json:"old_password"`
-		NewPassword string `json:"new_password"`
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BindJSON(&body); err != nil || body.CurrentPassword == "" || body.NewPassword == "" {
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordChangeFields, nil)
+		return
 	}
-	if err := c.BindJSON(&body); err != nil || body.OldPassword == "" || body.NewPassword == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+	if err := auth.CheckPasswordPolicy(body.NewPassword); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordPolicy, msgParams{"reason": err.Error()})
 		return
 	}
-	if err := s.authManager.ChangePassword(c.Request.Context(), body.OldPassword, body.NewPassword); err != nil {
+	if err := s.authManager.ChangePassword(c.Request.Context(), body.CurrentPassword, body.NewPassword); err != nil {
 		if errors.Is(err, persistence.ErrLocked) {
-			c.JSON(http.StatusLocked, gin.H{"error": "storage locked; unlock Piccolo to continue"})
+			writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 			return
 		}
 		switch err.Error() {
 		case "invalid credentials":
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		case "not initialized":
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			s.recordActivity(c, "auth", activity.LevelWarn, "Password change rejected: current password incorrect")
+			writeGinMessage(c, http.StatusForbidden, msgCurrentPassword, nil)
 		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "change the password", "reason": err.Error()})
 		}
 		return
 	}
 	// Rewrap crypto SDEK if initialized
 	if s.cryptoManager != nil && s.cryptoManager.IsInitialized() {
-		if err := s.cryptoManager.Rewrap(body.OldPassword, body.NewPassword); err != nil {
+		if err := s.cryptoManager.Rewrap(body.CurrentPassword, body.NewPassword); err != nil {
 			// Surface as 400 but keep auth changed; user can recover via recovery key
-			c.JSON(http.StatusBadRequest, gin.H{"error": "crypto rewrap failed: " + err.Error()})
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "rewrap the storage keys", "reason": err.Error()})
 			return
 		}
 	}
+	now := time.Now().UTC()
 	update := persistence.AuthStalenessUpdate{
 		PasswordStale:   boolPtr(false),
 		PasswordStaleAt: timePtr(time.Time{}),
-		PasswordAckAt:   timePtr(time.Time{}),
+		PasswordAckAt:   timePtr(now),
 	}
 	if err := s.applyStalenessUpdate(c.Request.Context(), update); err != nil {
 		log.Printf("WARN: failed to clear password staleness: %v", err)
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+
+	sess, ok := s.sessions.Rotate(id)
+	if !ok {
+		s.sessions.RevokeAllExcept("")
+		s.clearSessionCookie(c)
+		writeGinMessage(c, http.StatusUnauthorized, msgPasswordChanged, nil)
+		return
+	}
+	revoked := s.sessions.RevokeAllExcept(sess.ID)
+	s.setSessionCookie(c, sess.ID, time.Until(sess.CreatedAt.Add(s.sessions.Policy().MaxLifetime)))
+	s.recordActivity(c, "auth", activity.LevelInfo, fmt.Sprintf("Admin password changed; %d other session(s) signed out", revoked))
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "csrf_token": sess.CSRF})
 }
 
 // handleAuthStalenessAck: POST /api/v1/auth/staleness/ack
@@ -278,11 +312,11 @@ func (s *GinServer) handleAuthStalenessAck(c *gin.Context) {
 		Recovery bool `json:"recovery"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
 		return
 	}
 	if !body.Password && !body.Recovery {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no flags selected"})
+		writeGinMessage(c, http.StatusBadRequest, msgNoFlags, nil)
 		return
 	}
 	ctx := c.Request.Context()
@@ -299,7 +333,7 @@ func (s *GinServer) handleAuthStalenessAck(c *gin.Context) {
 	}
 	if err := s.applyStalenessUpdate(ctx, update); err != nil {
 		log.Printf("WARN: staleness ack failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update staleness"})
+		writeGinMessage(c, http.StatusInternalServerError, msgUpdateStaleness, nil)
 		return
 	}
 	if s.events != nil {
@@ -315,7 +349,7 @@ func (s *GinServer) handleAuthStalenessAck(c *gin.Context) {
 			Payload: events.AuditEvent{
 				Kind:   "auth.staleness_ack",
 				Time:   now,
-				Source: c.ClientIP(),
+				Source: requestClientIP(c),
 				Metadata: map[string]any{
 					"flags": targets,
 				},
@@ -329,14 +363,14 @@ func (s *GinServer) handleAuthStalenessAck(c *gin.Context) {
 func (s *GinServer) handleAuthCSRF(c *gin.Context) {
 	id, ok := s.getSession(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		return
 	}
 	if sess, ok := s.sessions.Get(id); ok {
 		c.JSON(http.StatusOK, gin.H{"token": sess.CSRF})
 		return
 	}
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 }
 
 // handleAuthInitialized: GET /api/v1/auth/initialized
@@ -344,10 +378,10 @@ func (s *GinServer) handleAuthInitialized(c *gin.Context) {
 	init, err := s.authManager.IsInitialized(c.Request.Context())
 	if err != nil {
 		if errors.Is(err, persistence.ErrLocked) {
-			c.JSON(http.StatusLocked, gin.H{"error": "storage locked; unlock Piccolo to continue"})
+			writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read auth state"})
+		writeGinMessage(c, http.StatusInternalServerError, msgAuthState, nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"initialized": init})
@@ -49,6 +49,7 @@ type memoryAuthRepo struct {
 	initialized bool
 	hash        string
 	staleness   persistence.AuthStaleness
+	setupAt     time.Time
 }
 
 func newMemoryAuthRepo() *memoryAuthRepo {
@@ -111,6 +112,21 @@ func (m *memoryAuthRepo) UpdateStaleness(ctx context.Context, update persistence
 	return nil
 }
 
+func (m *memoryAuthRepo) SetupCompletedAt(ctx context.Context) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setupAt, nil
+}
+
+func (m *memoryAuthRepo) MarkSetupComplete(ctx context.Context, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.setupAt.IsZero() {
+		m.setupAt = at
+	}
+	return nil
+}
+
 func TestAuth_Setup_Login_Session_Logout(t *testing.T) {
 	srv := setupAuthTestServer(t)
 
@@ -189,20 +205,20 @@ func TestAuth_Setup_Login_Session_Logout(t *testing.T) {
 	_ = json.Unmarshal(w.Body.Bytes(), &csrf)
 	token := csrf["token"]
 
-	// 7) change password wrong old -> 401
+	// 7) change password wrong current -> 403
 	w = httptest.NewRecorder()
-	req, _ = http.NewRequest("POST", "/api/v1/auth/password", strings.NewReader(`{"old_password":"bad","new_password":"pw234567"}`))
+	req, _ = http.NewRequest("POST", "/api/v1/auth/password", strings.NewReader(`{"current_password":"bad","new_password":"pw234567"}`))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Cookie", sessionCookieName+"="+sessCookie)
 	req.Header.Set("X-CSRF-Token", token)
 	srv.router.ServeHTTP(w, req)
-	if w.Code != http.StatusUnauthorized {
-		t.Fatalf("password expected 401, got %d", w.Code)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("password expected 403, got %d", w.Code)
 	}
 
-	// 8) correct change password -> 200
+	// 8) correct change password -> 200 with a rotated session
 	w = httptest.NewRecorder()
-	req, _ = http.NewRequest("POST", "/api/v1/auth/password", strings.NewReader(`{"old_password":"pw123456","new_password":"pw234567"}`))
+	req, _ = http.NewRequest("POST", "/api/v1/auth/password", strings.NewReader(`{"current_password":"pw123456","new_password":"pw234567"}`))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Cookie", sessionCookieName+"="+sessCookie)
 	req.Header.Set("X-CSRF-Token", token)
@@ -210,6 +226,13 @@ func TestAuth_Setup_Login_Session_Logout(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("password change status %d", w.Code)
 	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			sessCookie = c.Value
+		}
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &csrf)
+	token = csrf["csrf_token"]
 
 	// 9) logout
 	w = httptest.NewRecorder()
@@ -350,6 +373,73 @@ func TestAuthStalenessAckClearsFlags(t *testing.T) {
 	}
 }
 
+func TestAuthPasswordChangeRevokesOtherSessions(t *testing.T) {
+	srv := setupAuthTestServer(t)
+	cookieA, csrfA := setupTestAdminSession(t, srv)
+	cookieB, _ := setupTestAdminSession(t, srv)
+
+	changePassword := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/password", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		attachAuth(req, cookieA, csrfA)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := changePassword(`{"current_password":"wrong-password","new_password":"NewPass456!"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: expected 403, got %d body=%s", w.Code, w.Body.String())
+	}
+	w := changePassword(`{"current_password":"TestPass123!","new_password":"short"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "at least 8 characters") {
+		t.Fatalf("weak password: expected 400 with policy, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	w = changePassword(`{"current_password":"TestPass123!","new_password":"NewPass456!"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	var rotated *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			rotated = c
+		}
+	}
+	if rotated == nil || rotated.Value == cookieA.Value {
+		t.Fatalf("expected rotated session cookie, got %+v", rotated)
+	}
+	if resp["csrf_token"] == "" || resp["csrf_token"] == csrfA {
+		t.Fatalf("expected rotated csrf token, got %q", resp["csrf_token"])
+	}
+
+	sessionStatus := func(cookie *http.Cookie) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/auth/csrf", nil)
+		attachAuth(req, cookie, "")
+		srv.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := sessionStatus(cookieB); code != http.StatusUnauthorized {
+		t.Fatalf("other session still valid: %d", code)
+	}
+	if code := sessionStatus(cookieA); code != http.StatusUnauthorized {
+		t.Fatalf("pre-rotation session id still valid: %d", code)
+	}
+	if code := sessionStatus(rotated); code != http.StatusOK {
+		t.Fatalf("rotated session rejected: %d", code)
+	}
+
+	state, err := srv.authRepo.Staleness(context.Background())
+	if err != nil {
+		t.Fatalf("staleness: %v", err)
+	}
+	if state.PasswordStale || state.PasswordAckAt.IsZero() {
+		t.Fatalf("expected password staleness cleared and acknowledged, got %+v", state)
+	}
+}
+
 func TestCryptoRecoveryStatusStale(t *testing.T) {
 	srv := setupAuthTestServer(t)
 	// Setup auth to ensure repo initialized to avoid ErrLocked
@@ -454,6 +544,46 @@ func TestCryptoResetPasswordFlow(t *testing.T) {
 	}
 }
 
+func TestCryptoResetPasswordRejectsWrongRecoveryKey(t *testing.T) {
+	srv := setupAuthTestServer(t)
+	if err := srv.cryptoManager.Setup("OrigPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+	if err := srv.authManager.Setup(context.Background(), "OrigPass123!"); err != nil {
+		t.Fatalf("auth setup: %v", err)
+	}
+	words, err := srv.cryptoManager.GenerateRecoveryKeyWithPassword("OrigPass123!", false)
+	if err != nil {
+		t.Fatalf("generate recovery key: %v", err)
+	}
+	wrong := append([]string(nil), words...)
+	wrong[len(wrong)-1] = "notaword"
+	body := fmt.Sprintf(`{"recovery_key":%q,"new_password":"NewPass456!"}`, strings.Join(wrong, " "))
+
+	for i := 1; i <= 5; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/crypto/reset-password", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(w, req)
+		want := http.StatusUnauthorized
+		if i == 5 {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("attempt %d: expected %d, got %d body=%s", i, want, w.Code, w.Body.String())
+		}
+	}
+	if !srv.cryptoManager.IsLocked() {
+		t.Fatalf("rejected resets must leave crypto locked")
+	}
+	if err := srv.cryptoManager.Unlock("OrigPass123!"); err != nil {
+		t.Fatalf("original password should still unlock: %v", err)
+	}
+	if ok, _ := srv.authManager.Verify(context.Background(), "admin", "OrigPass123!"); !ok {
+		t.Fatalf("original admin password should still verify")
+	}
+}
+
 func TestCryptoRecoveryKeyGenerateRotatesAndClearsStaleness(t *testing.T) {
 	srv := setupAuthTestServer(t)
 	sessionCookie, csrf := setupTestAdminSession(t, srv)
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/app"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+// WithGinBuildInfo sets the commit and build date reported by /version,
+// normally injected with -ldflags alongside the version.
+func WithGinBuildInfo(commit, date string) GinServerOption {
+	return func(s *GinServer) {
+		s.buildCommit = commit
+		s.buildDate = date
+	}
+}
+
+// commit returns the injected commit, falling back to the VCS revision
+// Go stamps into the binary.
+func (s *GinServer) commit() string {
+	if s.buildCommit != "" {
+		return s.buildCommit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+func (s *GinServer) handleGinVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":     s.version,
+		"commit":      s.commit(),
+		"build_date":  s.buildDate,
+		"go_version":  runtime.Version(),
+		"service":     "piccolod",
+		"device_name": s.deviceName(),
+	})
+}
+
+// buildCapabilities reports what this daemon can do, from the components
+// actually wired up. It runs once the routes are set up; features added
+// later must add a check here rather than a constant.
+func (s *GinServer) buildCapabilities() map[string]any {
+	caps := map[string]any{
+		"api":                "v1",
+		"apps":               s.appManager != nil,
+		"app_bundle":         false,
+		"exports":            s.commandsRegistered(persistence.CommandRunControlExport, persistence.CommandRunFullExport),
+		"remote":             s.remoteManager != nil,
+		"remote_dns01":       false,
+		"mdns":               s.mdnsManager != nil,
+		"tls_mux":            s.tlsMux != nil,
+		"metrics":            s.routeRegistered(http.MethodGet, "/metrics") || s.routeRegistered(http.MethodGet, "/api/v1/metrics"),
+		"os_updates":         s.osUpdates != nil,
+		"self_update":        s.selfUpdate != nil && s.selfUpdate.Enabled(),
+		"cli":                s.runtimeDir != "",
+		"openapi_validation": s.apiValidator != nil,
+	}
+	if s.appManager != nil && s.routeRegistered(http.MethodGet, "/api/v1/apps/:name/export") {
+		caps["app_bundle"] = app.BundleFormat
+	}
+	if s.remoteManager != nil && s.commandsRegistered(remote.CommandConfigure) {
+		ids := []string{}
+		for _, p := range remote.DNSProviders() {
+			ids = append(ids, p.ID)
+		}
+		caps["remote_dns01"] = len(ids) > 0
+		caps["remote_dns_providers"] = ids
+	}
+	return caps
+}
+
+// commandsRegistered reports whether the dispatcher handles every name.
+func (s *GinServer) commandsRegistered(names ...string) bool {
+	if s.dispatcher == nil {
+		return false
+	}
+	for _, name := range names {
+		if !s.dispatcher.Registered(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *GinServer) routeRegistered(method, path string) bool {
+	if s.router == nil {
+		return false
+	}
+	for _, r := range s.router.Routes() {
+		if r.Method == method && r.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCapabilities: GET /api/v1/capabilities
+func (s *GinServer) handleCapabilities(c *gin.Context) {
+	caps := s.capabilities
+	if caps == nil {
+		caps = map[string]any{}
+	}
+	c.JSON(http.StatusOK, gin.H{"capabilities": caps})
+}
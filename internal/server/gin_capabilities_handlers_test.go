@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+	"piccolod/internal/runtime/commands"
+)
+
+func getCapabilities(t *testing.T, srv *GinServer) map[string]any {
+	t.Helper()
+	w := doAuthedRequest(srv, nil, "", http.MethodGet, "/api/v1/capabilities", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("capabilities without a session: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.Capabilities
+}
+
+func TestCapabilities_FollowWiredComponents(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+
+	caps := getCapabilities(t, srv)
+	for key, want := range map[string]any{
+		"api":          "v1",
+		"apps":         true,
+		"exports":      false,
+		"remote":       true,
+		"remote_dns01": false,
+		"mdns":         true,
+		"tls_mux":      true,
+		"metrics":      false,
+		"self_update":  false,
+	} {
+		if caps[key] != want {
+			t.Fatalf("%s = %v, want %v (all: %v)", key, caps[key], want, caps)
+		}
+	}
+	if caps["app_bundle"] != "piccolo.app-bundle/v1" {
+		t.Fatalf("app_bundle = %v", caps["app_bundle"])
+	}
+
+	// Registering the export and remote handlers and dropping mDNS flips
+	// the matching capabilities.
+	noop := commands.HandlerFunc(func(context.Context, commands.Command) (commands.Response, error) { return nil, nil })
+	srv.dispatcher.Register(persistence.CommandRunControlExport, noop)
+	srv.dispatcher.Register(persistence.CommandRunFullExport, noop)
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+	srv.mdnsManager = nil
+	srv.capabilities = srv.buildCapabilities()
+
+	caps = getCapabilities(t, srv)
+	if caps["exports"] != true || caps["remote_dns01"] != true || caps["mdns"] != false {
+		t.Fatalf("capabilities did not follow the wiring: %v", caps)
+	}
+	providers, _ := caps["remote_dns_providers"].([]any)
+	if len(providers) != len(remote.DNSProviders()) {
+		t.Fatalf("remote_dns_providers = %v", caps["remote_dns_providers"])
+	}
+
+	srv.dispatcher = nil
+	if srv.buildCapabilities()["exports"] != false {
+		t.Fatalf("exports reported without a dispatcher")
+	}
+}
+
+func TestVersion_ReportsBuildInfo(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+	WithGinBuildInfo("0123abc", "2026-01-02T03:04:05Z")(srv)
+
+	w := doAuthedRequest(srv, nil, "", http.MethodGet, "/version", "")
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["version"] != "test-gin" || resp["commit"] != "0123abc" || resp["build_date"] != "2026-01-02T03:04:05Z" || resp["go_version"] != runtime.Version() {
+		t.Fatalf("unexpected version body: %v", resp)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+// certDownloadRequest is the optional body of a certificate download. The
+// private key is only included with the admin password, even for a caller
+// that already holds a session.
+type certDownloadRequest struct {
+	Password   string `json:"password"`
+	IncludeKey bool   `json:"include_key"`
+}
+
+// certExportRequest is the PUT /remote/certificates/:id/export body.
+// Enabling export writes the private key in the clear and the deploy hook
+// runs as the daemon, so it needs the admin password.
+type certExportRequest struct {
+	Enabled            bool   `json:"enabled"`
+	DeployHook         string `json:"deploy_hook"`
+	HookTimeoutSeconds int    `json:"hook_timeout_seconds"`
+	Password           string `json:"password"`
+}
+
+// reauthenticate checks password against the admin account and writes the
+// error response when it does not match.
+func (s *GinServer) reauthenticate(c *gin.Context, password, action string) bool {
+	if password == "" {
+		writeGinError(c, http.StatusUnauthorized, "password required to "+action)
+		return false
+	}
+	ok, err := s.authManager.Verify(c.Request.Context(), "admin", password)
+	switch {
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return false
+	case err != nil:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return false
+	case !ok:
+		s.recordActivity(c, "auth", activity.LevelWarn, "Password confirmation failed for an attempt to "+action)
+		if s.recordLoginFailure() {
+			c.Header("Retry-After", "5")
+			writeGinError(c, http.StatusTooManyRequests, "Too Many Requests")
+		} else {
+			writeGinError(c, http.StatusForbidden, "password incorrect")
+		}
+		return false
+	}
+	return true
+}
+
+// handleRemoteCertificateDownload: GET or POST
+// /api/v1/remote/certificates/:id/download
+func (s *GinServer) handleRemoteCertificateDownload(c *gin.Context) {
+	id := c.Param("id")
+	var req certDownloadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeGinError(c, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	if v := c.Query("include_key"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			writeGinError(c, http.StatusBadRequest, "include_key must be true or false")
+			return
+		}
+		req.IncludeKey = req.IncludeKey || include
+	}
+	chain, err := s.remoteManager.CertificateChain(id)
+	if err != nil {
+		writeCertExportError(c, err)
+		return
+	}
+	filename := id + "-fullchain.pem"
+	body := chain
+	if req.IncludeKey {
+		if !s.reauthenticate(c, req.Password, "download the private key of "+id) {
+			return
+		}
+		key, err := s.remoteManager.CertificateKey(id)
+		if err != nil {
+			writeCertExportError(c, err)
+			return
+		}
+		body = append(append([]byte(nil), chain...), key...)
+		filename = id + "-bundle.pem"
+		s.recordActivity(c, "remote", activity.LevelWarn, fmt.Sprintf("Private key of certificate %s downloaded", id))
+		if s.events != nil {
+			s.events.Publish(events.Event{
+				Topic: events.TopicAudit,
+				Payload: events.AuditEvent{
+					Kind:     "remote.certificate_key_download",
+					Time:     time.Now().UTC(),
+					Source:   requestClientIP(c),
+					Metadata: map[string]any{"certificate": id},
+				},
+			})
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/x-pem-file", body)
+}
+
+// handleRemoteCertificateExport: PUT /api/v1/remote/certificates/:id/export
+func (s *GinServer) handleRemoteCertificateExport(c *gin.Context) {
+	id := c.Param("id")
+	var req certExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if req.Enabled && !s.reauthenticate(c, req.Password, "export certificate "+id) {
+		return
+	}
+	exportReq := remote.CertExportRequest{Enabled: req.Enabled, DeployHook: req.DeployHook, HookTimeoutSeconds: req.HookTimeoutSeconds}
+	var cert remote.Certificate
+	var err error
+	if s.dispatcher != nil {
+		var resp any
+		resp, err = s.dispatcher.Dispatch(c.Request.Context(), remote.ExportCertCommand{ID: id, Req: exportReq})
+		if r, ok := resp.(remote.ExportCertResponse); ok {
+			cert = r.Certificate
+		}
+	} else {
+		cert, err = s.remoteManager.SetCertificateExport(id, exportReq)
+	}
+	if err != nil {
+		writeCertExportError(c, err)
+		return
+	}
+	resp := gin.H{"certificate": cert}
+	if cert.Export != nil {
+		resp["live_dir"] = s.remoteManager.LiveDirectory(id)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func writeCertExportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, remote.ErrCertificateNotFound):
+		writeGinError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, remote.ErrLocked), errors.Is(err, remote.ErrKeySealed):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+	default:
+		writeGinError(c, http.StatusBadRequest, err.Error())
+	}
+}
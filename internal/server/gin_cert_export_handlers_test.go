@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/remote"
+)
+
+func doCertRequest(srv *GinServer, cookie *http.Cookie, csrf, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRemoteCertificateDownloadAndExport(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryActivityRepo{}
+	srv.attachActivityLog(activity.NewService(repo))
+
+	w := doCertRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/remote/configure", `{"endpoint":"wss://nexus.example.com/connect","device_secret":"super-secret","solver":"http-01","tld":"example.com","portal_hostname":"portal.example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("configure: %d body=%s", w.Code, w.Body.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		chain, err := srv.remoteManager.CertificateChain("portal")
+		if err == nil && len(chain) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("portal certificate never issued: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w = doCertRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/remote/certificates/portal/download", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "BEGIN CERTIFICATE") || strings.Contains(w.Body.String(), "PRIVATE KEY") {
+		t.Fatalf("chain download: %d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "portal-fullchain.pem") {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	if w := doCertRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/remote/certificates/unknown/download", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown certificate: expected 404, got %d", w.Code)
+	}
+
+	// The session alone does not release the key.
+	if w := doCertRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/remote/certificates/portal/download?include_key=true", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("key without password: expected 401, got %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doCertRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/remote/certificates/portal/download", `{"include_key":true,"password":"wrong"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("key with wrong password: expected 403, got %d body=%s", w.Code, w.Body.String())
+	}
+	w = doCertRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/remote/certificates/portal/download", `{"include_key":true,"password":"TestPass123!"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "BEGIN CERTIFICATE") || !strings.Contains(w.Body.String(), "PRIVATE KEY") {
+		t.Fatalf("key download: %d body=%s", w.Code, w.Body.String())
+	}
+	if !repo.hasMessage("Private key of certificate portal downloaded") {
+		t.Fatalf("key download not recorded: %+v", repo.records)
+	}
+
+	body := `{"enabled":true,"deploy_hook":"true"}`
+	if w := doCertRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/remote/certificates/portal/export", body); w.Code != http.StatusUnauthorized {
+		t.Fatalf("export without password: expected 401, got %d body=%s", w.Code, w.Body.String())
+	}
+	w = doCertRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/remote/certificates/portal/export", `{"enabled":true,"deploy_hook":"true","password":"TestPass123!"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Certificate remote.Certificate `json:"certificate"`
+		LiveDir     string             `json:"live_dir"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Certificate.Export == nil || resp.Certificate.Export.DeployHook != "true" || resp.LiveDir == "" {
+		t.Fatalf("unexpected export response %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(resp.LiveDir, "privkey.pem")); err != nil {
+		t.Fatalf("live key missing: %v", err)
+	}
+	if w := doCertRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/remote/certificates/portal/export", `{"enabled":false}`); w.Code != http.StatusOK {
+		t.Fatalf("disable export: %d body=%s", w.Code, w.Body.String())
+	}
+	if _, err := os.Lstat(resp.LiveDir); !os.IsNotExist(err) {
+		t.Fatalf("live directory kept after export was disabled: %v", err)
+	}
+}
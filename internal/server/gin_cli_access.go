@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/cli"
+)
+
+// ctxCLIKey marks requests authenticated by the local CLI token.
+const ctxCLIKey = "piccolo.cli"
+
+// writeLoopbackRuntime publishes the secure loopback port and a fresh CLI
+// token so `piccolod <command>` can reach the daemon without a session.
+func (s *GinServer) writeLoopbackRuntime() error {
+	if s.runtimeDir == "" || s.securePort == 0 {
+		return nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generate cli token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(s.runtimeDir, 0o700); err != nil {
+		return err
+	}
+	// Token first: a CLI that sees the new port must also see its token.
+	if err := writeFileAtomic(filepath.Join(s.runtimeDir, cli.TokenFile), []byte(token+"\n")); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.runtimeDir, cli.PortFile), []byte(strconv.Itoa(s.securePort)+"\n")); err != nil {
+		return err
+	}
+	s.cliToken = token
+	return nil
+}
+
+func (s *GinServer) removeLoopbackRuntime() {
+	s.cliToken = ""
+	if s.runtimeDir == "" {
+		return
+	}
+	for _, name := range []string{cli.PortFile, cli.TokenFile} {
+		if err := os.Remove(filepath.Join(s.runtimeDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("WARN: remove %s: %v", name, err)
+		}
+	}
+}
+
+// listenSecureSocket binds the Unix socket in runtimeDir, replacing a socket
+// left behind by a daemon that did not shut down cleanly. Anything other
+// than a socket at that path is left alone.
+func (s *GinServer) listenSecureSocket() (net.Listener, error) {
+	if s.runtimeDir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(s.runtimeDir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(s.runtimeDir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.runtimeDir, cli.SocketFile)
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	s.secureSocketPath = path
+	return ln, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isCLIRequest accepts the CLI token only on connections to the secure
+// loopback listener from a loopback peer or over its Unix socket. The TLS mux
+// also forwards remote traffic to that listener, so the token, not the
+// address, is what grants access.
+func (s *GinServer) isCLIRequest(r *http.Request) bool {
+	if s == nil || s.cliToken == "" {
+		return false
+	}
+	if v, _ := r.Context().Value(secureContextKeyInstance).(bool); !v {
+		return false
+	}
+	if v, _ := r.Context().Value(unixSocketContextKey{}).(bool); !v {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return false
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return false
+		}
+	}
+	token := r.Header.Get(cli.TokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cliToken)) == 1
+}
+
+// cliAccessMiddleware lets token-bearing CLI requests act as the admin and
+// records state-changing ones in the activity log under source "cli".
+func (s *GinServer) cliAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.isCLIRequest(c.Request) {
+			c.Next()
+			return
+		}
+		c.Set(ctxCLIKey, true)
+		c.Next()
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		if s.activity == nil {
+			return
+		}
+		level := activity.LevelInfo
+		if c.Writer.Status() >= http.StatusBadRequest {
+			level = activity.LevelWarn
+		}
+		// Detach from the request context: the handler may have finished it.
+		s.activity.Record(context.WithoutCancel(c.Request.Context()), activity.Entry{
+			Source:  "cli",
+			Level:   level,
+			Message: fmt.Sprintf("CLI %s %s returned %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status()),
+			Metadata: map[string]any{
+				"client": requestClientIP(c),
+				"status": c.Writer.Status(),
+			},
+		})
+	}
+}
+
+// cliAuthenticated reports whether cliAccessMiddleware accepted the request.
+func cliAuthenticated(c *gin.Context) bool {
+	return c.GetBool(ctxCLIKey)
+}
+
+// secureLoopbackPurpose explains the listener in GET /system/loopback.
+const secureLoopbackPurpose = "Loopback-only listener whose requests count as secure. The TLS mux hands decrypted remote traffic to it, and local tooling reaches the API on it with the CLI token."
+
+// handleSystemLoopback: GET /api/v1/system/loopback
+func (s *GinServer) handleSystemLoopback(c *gin.Context) {
+	payload := gin.H{
+		"active":        s.secureActive,
+		"port":          s.securePort,
+		"socket_active": s.secureSocket != nil,
+		"purpose":       secureLoopbackPurpose,
+	}
+	if s.secureSocketPath != "" {
+		payload["socket_path"] = s.secureSocketPath
+	}
+	c.JSON(http.StatusOK, payload)
+}
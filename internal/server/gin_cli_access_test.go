@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/cli"
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+	"piccolod/internal/runtime/commands"
+)
+
+// startCLITestServer serves the secure loopback listener of a test server and
+// publishes its runtime files in a temp dir.
+func startCLITestServer(t *testing.T) (*GinServer, string, *memoryActivityRepo) {
+	t.Helper()
+	srv := createGinTestServer(t, t.TempDir())
+	repo := &memoryActivityRepo{}
+	srv.dispatcher.Use(func(ctx context.Context, cmd commands.Command, next commands.Handler) (commands.Response, error) {
+		if record, ok := cmd.(persistence.RecordLockStateCommand); ok {
+			repo.setLocked(record.Locked)
+			srv.events.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: record.Locked}})
+		}
+		return next.Handle(ctx, cmd)
+	})
+	srv.attachActivityLog(activity.NewService(repo))
+
+	srv.runtimeDir = filepath.Join(t.TempDir(), "run")
+	if err := srv.writeLoopbackRuntime(); err != nil {
+		t.Fatalf("write runtime: %v", err)
+	}
+	srv.startSecureLoopback()
+	t.Cleanup(srv.stopSecureLoopback)
+	return srv, srv.runtimeDir, repo
+}
+
+func runCLI(t *testing.T, runDir, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := cli.Run(context.Background(), cli.Env{
+		RunDir: runDir,
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI_RuntimeFilesArePrivate(t *testing.T) {
+	srv, runDir, _ := startCLITestServer(t)
+	for _, name := range []string{cli.PortFile, cli.TokenFile} {
+		info, err := os.Stat(filepath.Join(runDir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("%s perms = %o, want 600", name, perm)
+		}
+	}
+	port, _ := os.ReadFile(filepath.Join(runDir, cli.PortFile))
+	if strings.TrimSpace(string(port)) != fmt.Sprint(srv.securePort) {
+		t.Fatalf("port file %q does not match listener %d", port, srv.securePort)
+	}
+
+	srv.stopSecureLoopback()
+	if _, err := os.Stat(filepath.Join(runDir, cli.TokenFile)); !os.IsNotExist(err) {
+		t.Fatalf("token file should be removed on shutdown, stat err=%v", err)
+	}
+	if code, _, stderr := runCLI(t, runDir, "", "status"); code != 1 || !strings.Contains(stderr, "not appear to be running") {
+		t.Fatalf("expected daemon-not-running error, code=%d stderr=%s", code, stderr)
+	}
+}
+
+func TestCLI_UnlockInstallAndList(t *testing.T) {
+	srv, runDir, repo := startCLITestServer(t)
+	if err := srv.cryptoManager.Setup("TestPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+	srv.cryptoManager.Lock()
+	repo.setLocked(true)
+
+	code, stdout, stderr := runCLI(t, runDir, "", "status")
+	if code != 0 || !strings.Contains(stdout, "version: test-gin") || !strings.Contains(stdout, "storage: locked") {
+		t.Fatalf("status: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+
+	if code, _, stderr := runCLI(t, runDir, "wrong\n", "unlock"); code != 1 || !strings.Contains(stderr, "incorrect password") {
+		t.Fatalf("unlock with wrong password: code=%d stderr=%s", code, stderr)
+	}
+	if code, stdout, stderr := runCLI(t, runDir, "TestPass123!\n", "unlock"); code != 0 || !strings.Contains(stdout, "storage unlocked") {
+		t.Fatalf("unlock: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+	if srv.cryptoManager.IsLocked() {
+		t.Fatalf("storage still locked after cli unlock")
+	}
+
+	appYAML := filepath.Join(t.TempDir(), "app.yaml")
+	payload := "name: blog\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: web\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
+	if err := os.WriteFile(appYAML, []byte(payload), 0o644); err != nil {
+		t.Fatalf("write app.yaml: %v", err)
+	}
+	if code, stdout, stderr := runCLI(t, runDir, "", "apps", "install", "-f", appYAML); code != 0 || !strings.Contains(stdout, "installed blog") {
+		t.Fatalf("apps install: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+	code, stdout, stderr = runCLI(t, runDir, "", "apps", "list")
+	if code != 0 || !strings.Contains(stdout, "blog") || !strings.Contains(stdout, "nginx:alpine") {
+		t.Fatalf("apps list: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+	if code, stdout, stderr := runCLI(t, runDir, "", "remote", "status"); code != 0 || !strings.Contains(stdout, "enabled: false") {
+		t.Fatalf("remote status: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !repo.hasMessage("CLI POST /api/v1/apps returned 201") {
+		if time.Now().After(deadline) {
+			t.Fatalf("cli install never reached the activity log")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCLI_TokenOnlyHonouredOnSecureLoopback(t *testing.T) {
+	srv, runDir, _ := startCLITestServer(t)
+	token, err := os.ReadFile(filepath.Join(runDir, cli.TokenFile))
+	if err != nil {
+		t.Fatalf("read token: %v", err)
+	}
+
+	// Wrong token over the loopback listener.
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/api/v1/apps", srv.securePort), nil)
+	req.Header.Set(cli.TokenHeader, "not-the-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("loopback request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token status = %d, want 401", resp.StatusCode)
+	}
+
+	// Right token on the main router (LAN listener) is ignored.
+	w := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/apps", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set(cli.TokenHeader, strings.TrimSpace(string(token)))
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("token outside loopback listener status = %d, want 401", w.Code)
+	}
+}
+
+func TestCLI_UnixSocketServesSecureHandler(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "run")
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	// A socket left behind by a daemon that did not shut down cleanly.
+	stale, err := net.Listen("unix", filepath.Join(runDir, cli.SocketFile))
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	srv := createGinTestServer(t, t.TempDir())
+	srv.runtimeDir = runDir
+	if err := srv.writeLoopbackRuntime(); err != nil {
+		t.Fatalf("write runtime: %v", err)
+	}
+	srv.router.GET("/test/secure-context", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"secure": srv.isSecureRequest(c.Request), "cli": cliAuthenticated(c)})
+	})
+	srv.startSecureLoopback()
+	t.Cleanup(srv.stopSecureLoopback)
+
+	socket := filepath.Join(runDir, cli.SocketFile)
+	if srv.secureSocket == nil || srv.secureSocketPath != socket {
+		t.Fatalf("socket not bound over the stale one: path=%q", srv.secureSocketPath)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket stat err=%v mode=%v, want 600", err, info.Mode())
+	}
+	if info, err := os.Stat(runDir); err != nil || info.Mode().Perm() != 0o700 {
+		t.Fatalf("run dir stat err=%v mode=%v, want 700", err, info.Mode())
+	}
+
+	token, err := os.ReadFile(filepath.Join(runDir, cli.TokenFile))
+	if err != nil {
+		t.Fatalf("read token: %v", err)
+	}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	probe := func(client *http.Client, base string) (bool, bool) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+"/test/secure-context", nil)
+		req.Header.Set(cli.TokenHeader, strings.TrimSpace(string(token)))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request %s: %v", base, err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Secure bool `json:"secure"`
+			CLI    bool `json:"cli"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode %s: %v", base, err)
+		}
+		return body.Secure, body.CLI
+	}
+	tcpSecure, tcpCLI := probe(http.DefaultClient, fmt.Sprintf("http://127.0.0.1:%d", srv.securePort))
+	sockSecure, sockCLI := probe(unixClient, "http://piccolod")
+	if !tcpSecure || !tcpCLI {
+		t.Fatalf("tcp loopback secure=%v cli=%v, want both true", tcpSecure, tcpCLI)
+	}
+	if sockSecure != tcpSecure || sockCLI != tcpCLI {
+		t.Fatalf("unix socket secure=%v cli=%v, want to match tcp loopback", sockSecure, sockCLI)
+	}
+
+	// The CLI prefers the socket and still works with the port file gone.
+	if err := os.Remove(filepath.Join(runDir, cli.PortFile)); err != nil {
+		t.Fatalf("remove port file: %v", err)
+	}
+	if code, stdout, stderr := runCLI(t, runDir, "", "status"); code != 0 || !strings.Contains(stdout, "version: test-gin") {
+		t.Fatalf("status over socket: code=%d stdout=%s stderr=%s", code, stdout, stderr)
+	}
+
+	srv.stopSecureLoopback()
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Fatalf("socket should be removed on shutdown, lstat err=%v", err)
+	}
+}
+
+func TestSystemLoopbackReportsListeners(t *testing.T) {
+	srv, runDir, _ := startCLITestServer(t)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	get := func() map[string]any {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/system/loopback", nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("loopback status = %d body=%s", w.Code, w.Body.String())
+		}
+		var out map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out
+	}
+	out := get()
+	if out["active"] != true || int(out["port"].(float64)) != srv.securePort || out["port"].(float64) == 0 {
+		t.Fatalf("unexpected loopback listener: %v", out)
+	}
+	if out["socket_active"] != true || out["socket_path"] != filepath.Join(runDir, cli.SocketFile) {
+		t.Fatalf("unexpected loopback socket: %v", out)
+	}
+	if s, _ := out["purpose"].(string); s == "" {
+		t.Fatalf("purpose missing: %v", out)
+	}
+
+	srv.stopSecureLoopback()
+	if out := get(); out["active"] != false || out["socket_active"] != false {
+		t.Fatalf("loopback should report inactive after stop: %v", out)
+	}
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/system/loopback", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated loopback status = %d, want 401", w.Code)
+	}
+}
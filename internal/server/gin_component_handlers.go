@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/events"
+	"piccolod/internal/health"
+	"piccolod/internal/runtime/supervisor"
+)
+
+// runtimeComponents is the supervisor view shown in health detail.
+func (s *GinServer) runtimeComponents() []supervisor.ComponentStatus {
+	if s.supervisor == nil {
+		return []supervisor.ComponentStatus{}
+	}
+	return s.supervisor.Status()
+}
+
+// reportRuntimeStartup marks the components that failed or timed out at
+// boot in the health tracker.
+func (s *GinServer) reportRuntimeStartup() {
+	if s.healthTracker == nil {
+		return
+	}
+	for _, st := range s.runtimeComponents() {
+		if st.State != supervisor.StateFailed {
+			continue
+		}
+		s.healthTracker.Setf(st.Name, health.LevelError, st.Name+" failed to start: "+st.LastError)
+	}
+}
+
+// handleSystemComponentRestart: POST /api/v1/system/components/:name/restart
+func (s *GinServer) handleSystemComponentRestart(c *gin.Context) {
+	name := c.Param("name")
+	if s.supervisor == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "runtime supervisor unavailable")
+		return
+	}
+	err := s.supervisor.Restart(c.Request.Context(), name)
+	s.publishComponentRestart(c, name, err)
+	switch {
+	case err == nil:
+	case errors.Is(err, supervisor.ErrUnknownComponent):
+		writeGinError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, supervisor.ErrNotRestartable), errors.Is(err, supervisor.ErrStartPending):
+		writeGinError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, supervisor.ErrNotStarted):
+		writeGinError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	default:
+		writeGinErrorDetails(c, http.StatusInternalServerError, errorCodeForStatus(http.StatusInternalServerError), "restart "+name+" failed: "+err.Error(), gin.H{"component": s.componentStatus(name)})
+		return
+	}
+	writeGinSuccess(c, gin.H{"component": s.componentStatus(name)}, "Component '"+name+"' restarted")
+}
+
+func (s *GinServer) componentStatus(name string) *supervisor.ComponentStatus {
+	for _, st := range s.supervisor.Status() {
+		if st.Name == name {
+			return &st
+		}
+	}
+	return nil
+}
+
+func (s *GinServer) publishComponentRestart(c *gin.Context, name string, err error) {
+	if s.events == nil || errors.Is(err, supervisor.ErrUnknownComponent) {
+		return
+	}
+	meta := map[string]any{"component": name, "result": "restarted"}
+	if err != nil {
+		meta["result"] = "failed"
+		meta["error"] = err.Error()
+	}
+	s.events.Publish(events.Event{
+		Topic: events.TopicAudit,
+		Payload: events.AuditEvent{
+			Kind:     "system.component_restart",
+			Time:     time.Now().UTC(),
+			Source:   requestClientIP(c),
+			Metadata: meta,
+		},
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/runtime/supervisor"
+)
+
+func TestSystemComponentRestart(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	starts := map[string]int{}
+	failMDNS := false
+	component := func(name string) supervisor.Component {
+		return supervisor.NewComponent(name, func(context.Context) error {
+			starts[name]++
+			if name == "mdns" && failMDNS {
+				return errors.New("no multicast interface")
+			}
+			return nil
+		}, nil)
+	}
+	srv.supervisor = supervisor.New(supervisor.Options{})
+	srv.supervisor.Register(component("mdns"))
+	srv.supervisor.Register(component("consensus"))
+	srv.supervisor.Register(supervisor.Once(component("service-manager")))
+	if err := srv.supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.supervisor.Stop(context.Background())
+
+	audit := srv.events.Subscribe(events.TopicAudit, 8)
+	defer srv.events.Unsubscribe(events.TopicAudit, audit)
+
+	restart := func(name string, withCSRF bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/system/components/"+name+"/restart", nil)
+		if withCSRF {
+			attachAuth(req, cookie, csrf)
+		} else {
+			req.AddCookie(cookie)
+		}
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := restart("mdns", false); w.Code != http.StatusForbidden {
+		t.Fatalf("restart without CSRF: expected 403, got %d", w.Code)
+	}
+	if w := restart("mdns", true); w.Code != http.StatusOK {
+		t.Fatalf("restart mdns: %d body=%s", w.Code, w.Body.String())
+	}
+	if starts["mdns"] != 2 || starts["consensus"] != 1 {
+		t.Fatalf("unexpected starts %v", starts)
+	}
+	select {
+	case evt := <-audit:
+		payload, ok := evt.Payload.(events.AuditEvent)
+		if !ok || payload.Kind != "system.component_restart" || payload.Metadata["component"] != "mdns" || payload.Metadata["result"] != "restarted" {
+			t.Fatalf("unexpected audit event: %+v", evt.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a restart audit event")
+	}
+
+	if w := restart("missing", true); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown component: expected 404, got %d", w.Code)
+	}
+	if w := restart("service-manager", true); w.Code != http.StatusConflict {
+		t.Fatalf("service-manager: expected 409, got %d", w.Code)
+	}
+
+	failMDNS = true
+	if w := restart("mdns", true); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failing restart: expected 500, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/health/detail", nil))
+	var detail struct {
+		Runtime []supervisor.ComponentStatus `json:"runtime"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("decode health detail: %v", err)
+	}
+	if len(detail.Runtime) != 3 {
+		t.Fatalf("expected three runtime components, got %+v", detail.Runtime)
+	}
+	mdns := detail.Runtime[0]
+	if mdns.Name != "mdns" || mdns.State != supervisor.StateFailed || mdns.Restarts != 2 || mdns.LastError != "no multicast interface" {
+		t.Fatalf("unexpected mdns status %+v", mdns)
+	}
+	if st := detail.Runtime[1]; st.State != supervisor.StateRunning || st.Restarts != 0 {
+		t.Fatalf("unexpected consensus status %+v", st)
+	}
+}
+
+func TestRuntimeStartupTimeoutShowsInHealth(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	release := make(chan struct{})
+	defer close(release)
+	srv.supervisor = supervisor.New(supervisor.Options{})
+	srv.supervisor.Register(supervisor.NewComponent("consensus", nil, nil, supervisor.Critical()))
+	srv.supervisor.Register(supervisor.NewComponent("mdns", func(context.Context) error {
+		<-release
+		return nil
+	}, nil, supervisor.StartTimeout(10*time.Millisecond), supervisor.DependsOn("consensus")))
+	if err := srv.supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.supervisor.Stop(context.Background())
+	srv.reportRuntimeStartup()
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/health/detail", nil))
+	var detail struct {
+		Components []struct {
+			Name    string `json:"name"`
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		} `json:"components"`
+		Runtime []supervisor.ComponentStatus `json:"runtime"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("decode health detail: %v", err)
+	}
+	if len(detail.Runtime) != 2 || detail.Runtime[0].StartOrder != 1 || !detail.Runtime[0].Critical {
+		t.Fatalf("unexpected runtime %+v", detail.Runtime)
+	}
+	if mdns := detail.Runtime[1]; !mdns.TimedOut || mdns.StartOrder != 2 || mdns.StartDurationMS != 10 || mdns.DependsOn[0] != "consensus" {
+		t.Fatalf("unexpected mdns status %+v", mdns)
+	}
+	for _, comp := range detail.Components {
+		if comp.Name == "mdns" {
+			if comp.Level != "error" || comp.Message != "mdns failed to start: start timed out after 10ms" {
+				t.Fatalf("unexpected mdns health %+v", comp)
+			}
+			return
+		}
+	}
+	t.Fatalf("mdns missing from health components: %+v", detail.Components)
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http/httpguts"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/persistence"
+)
+
+// Where the active CORS policy came from.
+const (
+	corsSourceDefault = "default"
+	corsSourceStored  = "stored"
+)
+
+// defaultCORSHeaders are the request headers the portal itself sends.
+var defaultCORSHeaders = []string{"Origin", "Content-Type", "Authorization", "X-Requested-With", "X-CSRF-Token"}
+
+// corsPolicy decides which cross-origin callers the API answers. Same-origin
+// requests are always allowed; IncludeDeviceHosts adds the device's mDNS
+// name and the remote portal hostname.
+type corsPolicy struct {
+	AllowedOrigins     []string `json:"allowed_origins"`
+	AllowedHeaders     []string `json:"allowed_headers"`
+	AllowCredentials   bool     `json:"allow_credentials"`
+	IncludeDeviceHosts bool     `json:"include_device_hosts"`
+}
+
+func defaultCORSPolicy() corsPolicy {
+	return corsPolicy{
+		AllowedOrigins:     []string{},
+		AllowedHeaders:     append([]string(nil), defaultCORSHeaders...),
+		AllowCredentials:   true,
+		IncludeDeviceHosts: true,
+	}
+}
+
+// corsPolicyRequest is the PUT /system/cors body. IncludeDeviceHosts
+// defaults to true so a client that does not know the field keeps the
+// device's own origins working.
+type corsPolicyRequest struct {
+	AllowedOrigins     []string `json:"allowed_origins"`
+	AllowedHeaders     []string `json:"allowed_headers"`
+	AllowCredentials   bool     `json:"allow_credentials"`
+	IncludeDeviceHosts *bool    `json:"include_device_hosts"`
+}
+
+// corsPolicyPayload is the GET/PUT /system/cors response.
+type corsPolicyPayload struct {
+	Policy      corsPolicy `json:"policy"`
+	Source      string     `json:"source"`
+	DeviceHosts []string   `json:"device_hosts"`
+}
+
+// originPattern is a parsed allowed origin. A wildcard host "*.example.com"
+// matches any subdomain of example.com but not example.com itself; any
+// matches every origin.
+type originPattern struct {
+	any      bool
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+// parseOriginPattern accepts "*" or scheme://host[:port] with an optional
+// leading "*." label. Default ports are dropped, as browsers omit them from
+// the Origin header.
+func parseOriginPattern(raw string) (originPattern, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "*" {
+		return originPattern{any: true}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Opaque != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || (u.Path != "" && u.Path != "/") {
+		return originPattern{}, fmt.Errorf("invalid origin %q: want scheme://host[:port]", raw)
+	}
+	p := originPattern{scheme: strings.ToLower(u.Scheme), host: strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), port: u.Port()}
+	if p.scheme != "http" && p.scheme != "https" {
+		return originPattern{}, fmt.Errorf("invalid origin %q: scheme must be http or https", raw)
+	}
+	if (p.scheme == "http" && p.port == "80") || (p.scheme == "https" && p.port == "443") {
+		p.port = ""
+	}
+	if rest, ok := strings.CutPrefix(p.host, "*."); ok {
+		p.host, p.wildcard = rest, true
+	}
+	if p.host == "" || strings.Contains(p.host, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin %q: a wildcard may only replace the leftmost label", raw)
+	}
+	return p, nil
+}
+
+func (p originPattern) String() string {
+	if p.any {
+		return "*"
+	}
+	host := p.host
+	if p.wildcard {
+		host = "*." + host
+	}
+	if p.port != "" {
+		host += ":" + p.port
+	}
+	return p.scheme + "://" + host
+}
+
+// matches reports whether the concrete origin o is covered by p.
+func (p originPattern) matches(o originPattern) bool {
+	if p.any {
+		return true
+	}
+	if p.scheme != o.scheme || p.port != o.port {
+		return false
+	}
+	if p.wildcard {
+		return strings.HasSuffix(o.host, "."+p.host)
+	}
+	return p.host == o.host
+}
+
+// normalize validates the policy and returns it in canonical form. An empty
+// header list means the defaults.
+func (p corsPolicy) normalize() (corsPolicy, error) {
+	out := corsPolicy{
+		AllowedOrigins:     []string{},
+		AllowedHeaders:     []string{},
+		AllowCredentials:   p.AllowCredentials,
+		IncludeDeviceHosts: p.IncludeDeviceHosts,
+	}
+	seen := make(map[string]bool)
+	for _, raw := range p.AllowedOrigins {
+		pattern, err := parseOriginPattern(raw)
+		if err != nil {
+			return corsPolicy{}, err
+		}
+		if pattern.any && p.AllowCredentials {
+			return corsPolicy{}, fmt.Errorf("allowed origin \"*\" cannot be combined with allow_credentials")
+		}
+		if origin := pattern.String(); !seen[origin] {
+			seen[origin] = true
+			out.AllowedOrigins = append(out.AllowedOrigins, origin)
+		}
+	}
+	seen = make(map[string]bool)
+	for _, raw := range p.AllowedHeaders {
+		name := strings.TrimSpace(raw)
+		if !httpguts.ValidHeaderFieldName(name) {
+			return corsPolicy{}, fmt.Errorf("invalid header name %q", raw)
+		}
+		if name = http.CanonicalHeaderKey(name); !seen[name] {
+			seen[name] = true
+			out.AllowedHeaders = append(out.AllowedHeaders, name)
+		}
+	}
+	if len(out.AllowedHeaders) == 0 {
+		out.AllowedHeaders = append(out.AllowedHeaders, defaultCORSHeaders...)
+	}
+	return out, nil
+}
+
+// patterns parses the allowed origins of a normalized policy.
+func (p corsPolicy) patterns() []originPattern {
+	out := make([]originPattern, 0, len(p.AllowedOrigins))
+	for _, raw := range p.AllowedOrigins {
+		if pattern, err := parseOriginPattern(raw); err == nil {
+			out = append(out, pattern)
+		}
+	}
+	return out
+}
+
+// corsPolicyRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set corsPolicies directly).
+func (s *GinServer) corsPolicyRepo() persistence.CORSPolicyRepo {
+	if s.corsPolicies != nil {
+		return s.corsPolicies
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().CORSPolicy()
+}
+
+// currentCORS returns the active policy and its parsed origins; the default
+// applies until one is set.
+func (s *GinServer) currentCORS() (corsPolicy, []originPattern, string) {
+	s.corsMu.RLock()
+	defer s.corsMu.RUnlock()
+	if s.corsSource == "" {
+		return defaultCORSPolicy(), nil, corsSourceDefault
+	}
+	return s.corsActive, s.corsPatterns, s.corsSource
+}
+
+func (s *GinServer) setCORSPolicy(policy corsPolicy, source string) {
+	patterns := policy.patterns()
+	s.corsMu.Lock()
+	s.corsActive, s.corsPatterns, s.corsSource = policy, patterns, source
+	s.corsMu.Unlock()
+}
+
+// reloadCORSPolicy adopts the stored policy once the control store is
+// readable. Until then, and when none was saved, the default applies.
+func (s *GinServer) reloadCORSPolicy() error {
+	repo := s.corsPolicyRepo()
+	if repo == nil {
+		return nil
+	}
+	stored, err := repo.CurrentPolicy(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	policy, err := corsPolicy{
+		AllowedOrigins:     stored.AllowedOrigins,
+		AllowedHeaders:     stored.AllowedHeaders,
+		AllowCredentials:   stored.AllowCredentials,
+		IncludeDeviceHosts: stored.IncludeDeviceHosts,
+	}.normalize()
+	if err != nil {
+		return fmt.Errorf("stored cors policy: %w", err)
+	}
+	s.setCORSPolicy(policy, corsSourceStored)
+	return nil
+}
+
+// isDeviceHost reports whether host is the device's mDNS name or the remote
+// portal hostname. App listener hostnames and aliases are not device hosts:
+// pages an app serves must not get credentialed access to the API. The
+// resolver follows remote config changes, so the portal origin tracks
+// Configure without a policy update.
+func (s *GinServer) isDeviceHost(host string) bool {
+	for _, h := range s.deviceHosts() {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceHosts lists the hostnames isDeviceHost admits.
+func (s *GinServer) deviceHosts() []string {
+	hosts := []string{strings.ToLower(s.deviceName()) + ".local"}
+	if s.remoteResolver != nil {
+		if portal := s.remoteResolver.PortalHostname(); portal != "" {
+			hosts = append(hosts, portal)
+		}
+	}
+	return hosts
+}
+
+// originAllowed applies policy to the Origin header of r.
+func (s *GinServer) originAllowed(r *http.Request, origin string, policy corsPolicy, patterns []originPattern) bool {
+	o, err := parseOriginPattern(origin)
+	if err != nil || o.any || o.wildcard {
+		return false
+	}
+	// Same-origin: the origin's host[:port] is the host the request was sent to.
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if policy.IncludeDeviceHosts && s.isDeviceHost(o.host) {
+		return true
+	}
+	for _, p := range patterns {
+		if p.matches(o) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *GinServer) corsPayload() corsPolicyPayload {
+	policy, _, source := s.currentCORS()
+	return corsPolicyPayload{Policy: policy, Source: source, DeviceHosts: s.deviceHosts()}
+}
+
+// handleSystemCORSGet: GET /api/v1/system/cors
+func (s *GinServer) handleSystemCORSGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.corsPayload())
+}
+
+// handleSystemCORSUpdate: PUT /api/v1/system/cors
+func (s *GinServer) handleSystemCORSUpdate(c *gin.Context) {
+	var req corsPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	includeDevice := true
+	if req.IncludeDeviceHosts != nil {
+		includeDevice = *req.IncludeDeviceHosts
+	}
+	next, err := corsPolicy{
+		AllowedOrigins:     req.AllowedOrigins,
+		AllowedHeaders:     req.AllowedHeaders,
+		AllowCredentials:   req.AllowCredentials,
+		IncludeDeviceHosts: includeDevice,
+	}.normalize()
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	repo := s.corsPolicyRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "cors policy storage unavailable")
+		return
+	}
+	err = repo.SavePolicy(c.Request.Context(), persistence.CORSPolicy{
+		AllowedOrigins:     next.AllowedOrigins,
+		AllowedHeaders:     next.AllowedHeaders,
+		AllowCredentials:   next.AllowCredentials,
+		IncludeDeviceHosts: next.IncludeDeviceHosts,
+		UpdatedAt:          time.Now().UTC(),
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.setCORSPolicy(next, corsSourceStored)
+
+	msg := "CORS restricted to same-origin"
+	switch {
+	case len(next.AllowedOrigins) > 0:
+		msg = "CORS allows " + strings.Join(next.AllowedOrigins, ", ")
+	case next.IncludeDeviceHosts:
+		msg = "CORS restricted to the device's own hostnames"
+	}
+	s.recordActivity(c, "system", activity.LevelInfo, msg)
+	c.JSON(http.StatusOK, s.corsPayload())
+}
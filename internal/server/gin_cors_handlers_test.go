@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+type memoryCORSPolicyRepo struct {
+	mu    sync.Mutex
+	saved *persistence.CORSPolicy
+}
+
+func (r *memoryCORSPolicyRepo) CurrentPolicy(ctx context.Context) (persistence.CORSPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.CORSPolicy{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryCORSPolicyRepo) SavePolicy(ctx context.Context, p persistence.CORSPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &p
+	return nil
+}
+
+// preflight sends an unauthenticated CORS preflight from origin.
+func preflight(srv *GinServer, origin string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodOptions, "/api/v1/system/cors", nil)
+	req.Host = "piccolo-test.internal"
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func doCORSUpdate(srv *GinServer, cookie *http.Cookie, csrf, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/system/cors", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOriginPatternMatching(t *testing.T) {
+	cases := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://dash.example.com", "https://dash.example.com", true},
+		{"https://dash.example.com", "https://DASH.example.com:443", true},
+		{"https://dash.example.com", "http://dash.example.com", false},
+		{"https://dash.example.com", "https://dash.example.com:8443", false},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"*", "https://anything.test", true},
+	}
+	for _, tc := range cases {
+		p, err := parseOriginPattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.pattern, err)
+		}
+		o, err := parseOriginPattern(tc.origin)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.origin, err)
+		}
+		if got := p.matches(o); got != tc.want {
+			t.Fatalf("%q matches %q = %v, want %v", tc.pattern, tc.origin, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"dash.example.com", "ftp://example.com", "https://a.*.example.com", "https://*", "https://example.com/app", "https://example.com?x=1"} {
+		if _, err := parseOriginPattern(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := (corsPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}).normalize(); err == nil {
+		t.Fatalf("expected * with credentials to be rejected")
+	}
+	if _, err := (corsPolicy{AllowedHeaders: []string{"bad header"}}).normalize(); err == nil {
+		t.Fatalf("expected invalid header name to be rejected")
+	}
+}
+
+func TestSystemCORS_UpdateAppliesPolicy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cors-policy")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryCORSPolicyRepo{}
+	srv.corsPolicies = repo
+
+	if w := preflight(srv, "https://app.example.org"); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("default policy allowed a foreign origin: %d %v", w.Code, w.Header())
+	}
+	if w := preflight(srv, "http://piccolo-test.internal"); w.Code != http.StatusOK {
+		t.Fatalf("same-origin preflight: expected 200, got %d", w.Code)
+	}
+
+	w := doCORSUpdate(srv, cookie, csrf, `{"allowed_origins":["*"],"allow_credentials":true}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("* with credentials: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+	if repo.saved != nil {
+		t.Fatalf("rejected policy was persisted: %+v", repo.saved)
+	}
+
+	w = doCORSUpdate(srv, cookie, csrf, `{"allowed_origins":["https://*.example.org","https://dash.example.com:443/"],"allowed_headers":["content-type","x-csrf-token"],"allow_credentials":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp corsPolicyPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Source != corsSourceStored || len(resp.Policy.AllowedOrigins) != 2 || resp.Policy.AllowedOrigins[1] != "https://dash.example.com" || !resp.Policy.IncludeDeviceHosts {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if repo.saved == nil || len(repo.saved.AllowedHeaders) != 2 || repo.saved.AllowedHeaders[1] != "X-Csrf-Token" {
+		t.Fatalf("policy not persisted: %+v", repo.saved)
+	}
+
+	// Preflights carry no session cookie.
+	w = preflight(srv, "https://app.example.org")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.org" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("allowed origin: %d %v", w.Code, w.Header())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-Csrf-Token" {
+		t.Fatalf("allowed headers = %q", got)
+	}
+	for _, origin := range []string{"https://example.org", "http://app.example.org", "https://evil.test"} {
+		if w := preflight(srv, origin); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("%s: expected refusal, got %d %v", origin, w.Code, w.Header())
+		}
+	}
+
+	// A disallowed origin's simple request gets no CORS grant.
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/health/live", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	srv.router.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("disallowed origin granted on simple request: %v", w.Header())
+	}
+
+	// A fresh server adopts the stored policy on unlock.
+	srv.setCORSPolicy(defaultCORSPolicy(), corsSourceDefault)
+	if err := srv.reloadCORSPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if policy, _, source := srv.currentCORS(); source != corsSourceStored || len(policy.AllowedOrigins) != 2 {
+		t.Fatalf("stored policy not adopted: %+v (%s)", policy, source)
+	}
+}
+
+func TestSystemCORS_IncludesRemoteHostnamesAfterConfigure(t *testing.T) {
+	t.Setenv("PICCOLO_REMOTE_FAKE_ACME", "1")
+
+	tempDir, err := os.MkdirTemp("", "cors-remote")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	srv := createGinTestServer(t, tempDir)
+	defer srv.tlsMux.Stop()
+	remote.RegisterHandlers(srv.dispatcher, srv.remoteManager)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.corsPolicies = &memoryCORSPolicyRepo{}
+
+	const portal = "https://portal.example.com"
+	if w := preflight(srv, portal); w.Code != http.StatusForbidden {
+		t.Fatalf("portal origin allowed before remote was configured: %d", w.Code)
+	}
+	if w := preflight(srv, "http://"+srv.deviceName()+".local"); w.Code != http.StatusOK {
+		t.Fatalf("mDNS origin: expected 200, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/remote/configure", strings.NewReader(`{"endpoint":"wss://nexus.example.com/connect","device_secret":"super-secret","solver":"http-01","tld":"example.com","portal_hostname":"portal.example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("configure: %d body=%s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for preflight(srv, portal).Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("portal origin never allowed after configure")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Pages served by app listeners share the TLD but must not reach the
+	// API with the admin's session.
+	for _, origin := range []string{"https://blog.example.com", "https://example.com"} {
+		w := preflight(srv, origin)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d", origin, w.Code)
+		}
+		for name := range w.Header() {
+			if strings.HasPrefix(name, "Access-Control-Allow-") {
+				t.Fatalf("%s: got %s on a refused origin", origin, name)
+			}
+		}
+	}
+	if w := preflight(srv, "https://portal.example.net"); w.Code != http.StatusForbidden {
+		t.Fatalf("unrelated origin: expected 403, got %d", w.Code)
+	}
+
+	if w := doCORSUpdate(srv, cookie, csrf, `{"include_device_hosts":false,"allow_credentials":true}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := preflight(srv, portal); w.Code != http.StatusForbidden {
+		t.Fatalf("portal origin still allowed with device hosts excluded: %d", w.Code)
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"piccolod/internal/auth"
+	"piccolod/internal/crypt"
 	"piccolod/internal/events"
 	"piccolod/internal/persistence"
 )
@@ -34,20 +36,27 @@ func (s *GinServer) handleCryptoStatus(c *gin.Context) {
 
 // handleCryptoSetup: POST /api/v1/crypto/setup { password }
 func (s *GinServer) handleCryptoSetup(c *gin.Context) {
+	if s.rejectIfSetupComplete(c) {
+		return
+	}
 	var body struct {
 		Password string `json:"password"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil || body.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
+		return
+	}
+	if err := auth.CheckPasswordPolicy(body.Password); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordPolicy, msgParams{"reason": err.Error()})
 		return
 	}
 	if err := s.cryptoManager.Setup(body.Password); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "set up encryption", "reason": err.Error()})
 		return
 	}
 	if err := s.notifyPersistenceLockState(c.Request.Context(), true); err != nil {
 		log.Printf("WARN: failed to propagate lock state: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update persistence state"})
+		writeGinMessage(c, http.StatusInternalServerError, msgPersistenceState, nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
@@ -59,25 +68,28 @@ func (s *GinServer) handleCryptoUnlock(c *gin.Context) {
 		Password string `json:"password"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
 		return
 	}
 	if !s.cryptoManager.IsInitialized() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "not initialized"})
+		writeGinMessage(c, http.StatusBadRequest, msgNotInitialized, nil)
 		return
 	}
 	password := strings.TrimSpace(body.Password)
 	if password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "password required"})
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordRequired, nil)
 		return
 	}
 	if err := s.cryptoManager.Unlock(password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		return
 	}
-	if err := s.notifyPersistenceLockState(c.Request.Context(), false); err != nil {
+	trackerID := s.unlockProgress.begin(s.unlockReloaderNames())
+	err := s.notifyPersistenceLockState(c.Request.Context(), false)
+	s.unlockProgress.storeUnlocked(err)
+	if err != nil {
 		log.Printf("WARN: failed to propagate unlock state: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update persistence state"})
+		writeGinMessageDetails(c, http.StatusInternalServerError, msgPersistenceState, nil, gin.H{"tracker_id": trackerID})
 		return
 	}
 	// Best-effort: verify admin credentials and create a session automatically.
@@ -96,12 +108,26 @@ func (s *GinServer) handleCryptoUnlock(c *gin.Context) {
 		}
 		if init {
 			if ok, err := s.authManager.Verify(ctx, "admin", password); err == nil && ok {
-				sess := s.sessions.Create("admin", 3600)
-				s.setSessionCookie(c, sess.ID, time.Hour)
+				sess := s.sessions.CreateFrom("admin", requestClientIP(c), c.Request.UserAgent())
+				s.setSessionCookie(c, sess.ID, s.sessions.Policy().MaxLifetime)
 			}
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "tracker_id": trackerID})
+}
+
+// handleCryptoUnlockStatus: GET /api/v1/crypto/unlock/status[?id=]
+func (s *GinServer) handleCryptoUnlockStatus(c *gin.Context) {
+	progress, ok := s.unlockProgress.snapshot()
+	if !ok {
+		writeGinMessage(c, http.StatusNotFound, msgNoUnlock, nil)
+		return
+	}
+	if id := c.Query("id"); id != "" && id != progress.ID {
+		writeGinMessage(c, http.StatusNotFound, msgUnlockNotFound, msgParams{"id": id})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
 }
 
 // handleCryptoResetPassword: POST /api/v1/crypto/reset-password
@@ -111,44 +137,64 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 		NewPassword string `json:"new_password"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidBody, nil)
 		return
 	}
 	recoveryKey := strings.TrimSpace(body.RecoveryKey)
 	newPassword := body.NewPassword
 	if recoveryKey == "" || newPassword == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "recovery_key and new_password required"})
+		writeGinMessage(c, http.StatusBadRequest, msgResetFields, nil)
 		return
 	}
 	if s.cryptoManager == nil || !s.cryptoManager.IsInitialized() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "not initialized"})
+		writeGinMessage(c, http.StatusBadRequest, msgNotInitialized, nil)
 		return
 	}
 	if s.authManager == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "auth unavailable"})
+		writeGinMessage(c, http.StatusInternalServerError, msgAuthUnavailable, nil)
+		return
+	}
+
+	if err := auth.CheckPasswordPolicy(newPassword); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgPasswordPolicy, msgParams{"reason": err.Error()})
 		return
 	}
 
 	ctx := c.Request.Context()
 	words := strings.Fields(recoveryKey)
-	wasLocked := s.cryptoManager.IsLocked()
-	needRelock := wasLocked
 
-	if err := s.cryptoManager.UnlockWithRecoveryKey(words); err != nil {
+	// The keyset is rewrapped first, atomically and keeping the SDEK, so
+	// existing volumes stay mountable. The recovery key still works
+	// afterwards, so if a later step fails the reset can be repeated.
+	if err := s.cryptoManager.ResetPassword(words, newPassword); err != nil {
+		if !errors.Is(err, crypt.ErrInvalidRecoveryKey) {
+			log.Printf("ERROR: reset-password rewrap failed: %v", err)
+			writeGinMessage(c, http.StatusInternalServerError, msgRewrapKeys, nil)
+			return
+		}
 		if s.recordResetFailure() {
 			c.Header("Retry-After", "5")
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too Many Requests"})
+			writeGinMessage(c, http.StatusTooManyRequests, errorCodeRateLimited, nil)
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			writeGinMessage(c, http.StatusUnauthorized, errorCodeUnauthorized, nil)
 		}
 		return
 	}
 	s.resetResetFailures()
 
+	wasLocked := s.cryptoManager.IsLocked()
+	needRelock := wasLocked
+
 	if wasLocked {
+		if err := s.cryptoManager.Unlock(newPassword); err != nil {
+			log.Printf("ERROR: reset-password unlock failed: %v", err)
+			writeGinMessage(c, http.StatusInternalServerError, msgUnlockPersistence, nil)
+			return
+		}
 		if err := s.notifyPersistenceLockState(ctx, false); err != nil {
+			s.cryptoManager.Lock()
 			log.Printf("WARN: reset-password unlock notify failed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock persistence"})
+			writeGinMessage(c, http.StatusInternalServerError, msgUnlockPersistence, nil)
 			return
 		}
 		defer func() {
@@ -162,13 +208,7 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 	}
 
 	if err := s.authManager.ChangePasswordWithRecovery(ctx, newPassword); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	if err := s.cryptoManager.RewrapUnlocked(newPassword); err != nil {
-		log.Printf("ERROR: reset-password rewrap failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rewrap keys"})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "reset the password", "reason": err.Error()})
 		return
 	}
 
@@ -183,7 +223,7 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 	}
 	if err := s.applyStalenessUpdate(ctx, update); err != nil {
 		log.Printf("WARN: failed to mark staleness: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark staleness"})
+		writeGinMessage(c, http.StatusInternalServerError, msgUpdateStaleness, nil)
 		return
 	}
 
@@ -191,7 +231,7 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 		s.cryptoManager.Lock()
 		if err := s.notifyPersistenceLockState(ctx, true); err != nil {
 			log.Printf("WARN: reset-password relock notify failed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to relock persistence"})
+			writeGinMessage(c, http.StatusInternalServerError, msgRelockPersistence, nil)
 			return
 		}
 		needRelock = false
@@ -203,7 +243,7 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 			Payload: events.AuditEvent{
 				Kind:   "auth.reset_with_recovery",
 				Time:   now,
-				Source: c.ClientIP(),
+				Source: requestClientIP(c),
 				Metadata: map[string]any{
 					"was_locked": wasLocked,
 				},
@@ -217,13 +257,13 @@ func (s *GinServer) handleCryptoResetPassword(c *gin.Context) {
 // handleCryptoLock: POST /api/v1/crypto/lock
 func (s *GinServer) handleCryptoLock(c *gin.Context) {
 	if !s.cryptoManager.IsInitialized() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "not initialized"})
+		writeGinMessage(c, http.StatusBadRequest, msgNotInitialized, nil)
 		return
 	}
 	s.cryptoManager.Lock()
 	if err := s.notifyPersistenceLockState(c.Request.Context(), true); err != nil {
 		log.Printf("WARN: failed to propagate lock state: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update persistence state"})
+		writeGinMessage(c, http.StatusInternalServerError, msgPersistenceState, nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
@@ -245,7 +285,7 @@ func (s *GinServer) handleCryptoRecoveryStatus(c *gin.Context) {
 // handleCryptoRecoveryGenerate: POST /api/v1/crypto/recovery-key/generate
 func (s *GinServer) handleCryptoRecoveryGenerate(c *gin.Context) {
 	if s.cryptoManager == nil || !s.cryptoManager.IsInitialized() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "not initialized"})
+		writeGinMessage(c, http.StatusBadRequest, msgNotInitialized, nil)
 		return
 	}
 	// Optional body: { password }
@@ -262,11 +302,11 @@ func (s *GinServer) handleCryptoRecoveryGenerate(c *gin.Context) {
 	} else if strings.TrimSpace(body.Password) != "" {
 		words, err = s.cryptoManager.GenerateRecoveryKeyWithPassword(body.Password, rotating)
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unlock required"})
+		writeGinMessage(c, http.StatusBadRequest, msgUnlockRequired, nil)
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "generate a recovery key", "reason": err.Error()})
 		return
 	}
 	if err := s.applyStalenessUpdate(c.Request.Context(), persistence.AuthStalenessUpdate{
@@ -282,7 +322,7 @@ func (s *GinServer) handleCryptoRecoveryGenerate(c *gin.Context) {
 			Payload: events.AuditEvent{
 				Kind:   "auth.recovery_key_generate",
 				Time:   time.Now().UTC(),
-				Source: c.ClientIP(),
+				Source: requestClientIP(c),
 				Metadata: map[string]any{
 					"rotated": rotating,
 				},
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+	"piccolod/internal/runtime/commands"
+)
+
+// fakeUnlockVolumes stands in for the persistence volume manager during
+// unlock: it publishes the volume state changes an attach produces and fails
+// the volumes listed in failures.
+type fakeUnlockVolumes struct {
+	bus      *events.Bus
+	failures map[string]string
+}
+
+func (f *fakeUnlockVolumes) middleware(ctx context.Context, cmd commands.Command, next commands.Handler) (commands.Response, error) {
+	record, ok := cmd.(persistence.RecordLockStateCommand)
+	if !ok || record.Locked {
+		return next.Handle(ctx, cmd)
+	}
+	for _, id := range []string{"control", "bootstrap"} {
+		f.bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: id, Desired: "mounted", Observed: "pending"}})
+		if reason, failed := f.failures[id]; failed {
+			f.bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: id, Desired: "mounted", Observed: "error", LastError: reason}})
+			return nil, errors.New("attach " + id + " volume: " + reason)
+		}
+		f.bus.Publish(events.Event{Topic: events.TopicVolumeStateChanged, Payload: events.VolumeStateChanged{ID: id, Desired: "mounted", Observed: "mounted"}})
+	}
+	f.bus.Publish(events.Event{Topic: events.TopicLockStateChanged, Payload: events.LockStateChanged{Locked: false}})
+	return next.Handle(ctx, cmd)
+}
+
+// newUnlockProgressServer returns a test server with crypto set up and locked
+// whose unlock runs through fake volumes.
+func newUnlockProgressServer(t *testing.T, failures map[string]string) (*GinServer, *http.Cookie, string) {
+	t.Helper()
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	if err := srv.cryptoManager.Setup("TestPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+	vols := &fakeUnlockVolumes{bus: srv.events, failures: failures}
+	srv.dispatcher.Use(vols.middleware)
+	srv.unlockProgress = newUnlockTracker("control", "bootstrap")
+	srv.appManager.SetUnlockObserver(srv.unlockProgress.observeApp)
+	srv.observeLockState(srv.events)
+	srv.observeUnlockVolumes(srv.events)
+	t.Cleanup(srv.unsubscribeAll)
+	return srv, cookie, csrf
+}
+
+func postUnlock(t *testing.T, srv *GinServer) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/crypto/unlock", strings.NewReader(`{"password":"TestPass123!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+// waitUnlockPhase polls the unlock status until it leaves the running phase.
+func waitUnlockPhase(t *testing.T, srv *GinServer, cookie *http.Cookie, csrf, id string) unlockProgress {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/crypto/unlock/status?id="+id, nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unlock status: %d body=%s", w.Code, w.Body.String())
+		}
+		var progress unlockProgress
+		if err := json.Unmarshal(w.Body.Bytes(), &progress); err != nil {
+			t.Fatalf("decode unlock status: %v", err)
+		}
+		if progress.Phase != unlockPhaseRunning {
+			return progress
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unlock still running: %+v", progress)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func unlockStepByName(t *testing.T, progress unlockProgress, name string) unlockStep {
+	t.Helper()
+	for _, step := range progress.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	t.Fatalf("no %s step in %+v", name, progress.Steps)
+	return unlockStep{}
+}
+
+func TestCryptoUnlockStatus_TracksStepsToCompletion(t *testing.T) {
+	srv, cookie, csrf := newUnlockProgressServer(t, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/crypto/unlock/status", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before any unlock, got %d", w.Code)
+	}
+
+	w = postUnlock(t, srv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		TrackerID string `json:"tracker_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.TrackerID == "" {
+		t.Fatalf("unlock response missing tracker_id: %s", w.Body.String())
+	}
+
+	progress := waitUnlockPhase(t, srv, cookie, csrf, resp.TrackerID)
+	if progress.Phase != unlockPhaseSucceeded || progress.Completed != progress.Total {
+		t.Fatalf("expected a completed unlock, got %+v", progress)
+	}
+	var names []string
+	for _, step := range progress.Steps {
+		names = append(names, step.Name)
+		if step.State != unlockStepDone {
+			t.Fatalf("step %s ended %s: %s", step.Name, step.State, step.Error)
+		}
+	}
+	want := "volume:control,volume:bootstrap,control-store,reload:remote,restore-services,autostart"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("steps = %s, want %s", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/crypto/unlock/status?id=unknown", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown tracker, got %d", w.Code)
+	}
+}
+
+func TestCryptoUnlockStatus_SurfacesVolumeFailure(t *testing.T) {
+	srv, cookie, csrf := newUnlockProgressServer(t, map[string]string{"bootstrap": "gocryptfs: ciphertext corrupt"})
+
+	w := postUnlock(t, srv)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected unlock to fail, got %d body=%s", w.Code, w.Body.String())
+	}
+	var env struct {
+		Error struct {
+			Details struct {
+				TrackerID string `json:"tracker_id"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || env.Error.Details.TrackerID == "" {
+		t.Fatalf("failed unlock missing tracker_id: %s", w.Body.String())
+	}
+
+	progress := waitUnlockPhase(t, srv, cookie, csrf, env.Error.Details.TrackerID)
+	if progress.Phase != unlockPhaseFailed {
+		t.Fatalf("expected failed phase, got %+v", progress)
+	}
+	// The error event may land just after the command fails.
+	deadline := time.Now().Add(2 * time.Second)
+	for unlockStepByName(t, progress, "volume:bootstrap").State != unlockStepFailed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		progress, _ = srv.unlockProgress.snapshot()
+	}
+	if step := unlockStepByName(t, progress, "volume:bootstrap"); step.State != unlockStepFailed || step.Error != "gocryptfs: ciphertext corrupt" {
+		t.Fatalf("bootstrap failure not surfaced: %+v", step)
+	}
+	if step := unlockStepByName(t, progress, "volume:control"); step.State != unlockStepDone {
+		t.Fatalf("control volume should have attached: %+v", step)
+	}
+	if step := unlockStepByName(t, progress, "control-store"); step.State != unlockStepFailed || !strings.Contains(step.Error, "ciphertext corrupt") {
+		t.Fatalf("control store step should carry the failure: %+v", step)
+	}
+	for _, name := range []string{"reload:remote", "restore-services", "autostart"} {
+		if step := unlockStepByName(t, progress, name); step.State != unlockStepSkipped {
+			t.Fatalf("step %s should be skipped, got %+v", name, step)
+		}
+	}
+}
+
+func TestUnlockTracker_TimeoutFailsUnfinishedSteps(t *testing.T) {
+	tracker := newUnlockTracker("control")
+	tracker.stepTimeout = time.Hour
+	tracker.appsTimeout = 20 * time.Millisecond
+	tracker.begin([]string{"remote"})
+	tracker.observeVolume(events.VolumeStateChanged{ID: "control", Observed: "mounted"})
+	tracker.storeUnlocked(nil)
+	tracker.finish(unlockReloadStep("remote"), nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		progress, _ := tracker.snapshot()
+		if progress.Phase != unlockPhaseRunning {
+			if progress.Phase != unlockPhaseFailed {
+				t.Fatalf("expected failed phase, got %+v", progress)
+			}
+			for _, name := range []string{"restore-services", "autostart"} {
+				if step := unlockStepByName(t, progress, name); step.State != unlockStepFailed || !strings.Contains(step.Error, "timed out") {
+					t.Fatalf("step %s not timed out: %+v", name, step)
+				}
+			}
+			if step := unlockStepByName(t, progress, "control-store"); step.State != unlockStepDone {
+				t.Fatalf("finished step changed by the timeout: %+v", step)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unlock never timed out: %+v", progress)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
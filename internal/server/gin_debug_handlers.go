@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/diag"
+)
+
+const (
+	// debugBundleInterval is the minimum gap between two bundles; building
+	// one walks every subsystem.
+	debugBundleInterval = 30 * time.Second
+	// debugBundleLogLines and debugBundleActivityLimit cap how much history
+	// a bundle carries.
+	debugBundleLogLines      = 500
+	debugBundleActivityLimit = 200
+)
+
+// WithLogRing hands the server the in-memory copy of the daemon log that
+// debug bundles include.
+func WithLogRing(ring *diag.LogRing) GinServerOption {
+	return func(s *GinServer) {
+		s.logRing = ring
+	}
+}
+
+// reserveDebugBundle claims the next bundle slot, or reports how long the
+// caller has to wait for it.
+func (s *GinServer) reserveDebugBundle(now time.Time) time.Duration {
+	s.debugBundleMu.Lock()
+	defer s.debugBundleMu.Unlock()
+	if !s.lastDebugBundle.IsZero() {
+		if wait := s.lastDebugBundle.Add(debugBundleInterval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	s.lastDebugBundle = now
+	return 0
+}
+
+// debugSanitizer scrubs the credentials this device knows about.
+func (s *GinServer) debugSanitizer() *diag.Sanitizer {
+	var secrets []string
+	if s.remoteManager != nil {
+		secrets = append(secrets, s.remoteManager.SecretValues()...)
+	}
+	return diag.NewSanitizer(secrets...)
+}
+
+// handleDebugBundle: GET /api/v1/debug/bundle
+func (s *GinServer) handleDebugBundle(c *gin.Context) {
+	if wait := s.reserveDebugBundle(time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeGinError(c, http.StatusTooManyRequests, "a debug bundle was generated recently; try again shortly")
+		return
+	}
+	now := time.Now().UTC()
+	sections, errs := s.collectDebugSections(c.Request.Context())
+	manifest := diag.Manifest{CreatedAt: now, DaemonVersion: s.version, Errors: errs}
+	var buf bytes.Buffer
+	if err := diag.WriteBundle(&buf, manifest, sections, s.debugSanitizer()); err != nil {
+		log.Printf("WARN: debug bundle: %v", err)
+		writeGinError(c, http.StatusInternalServerError, "failed to build debug bundle")
+		return
+	}
+	s.recordActivity(c, "system", activity.LevelInfo, "Debug bundle downloaded")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="piccolo-debug-%s.tar.gz"`, now.Format("20060102-150405")))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/gzip", buf.Bytes())
+}
+
+// collectDebugSections gathers one section per subsystem. A subsystem that
+// fails is reported in the manifest instead of failing the whole bundle.
+func (s *GinServer) collectDebugSections(ctx context.Context) ([]diag.Section, map[string]string) {
+	errs := map[string]string{}
+	sections := []diag.Section{
+		{Name: "versions", Data: gin.H{
+			"daemon_version": s.version,
+			"go_version":     runtime.Version(),
+			"os":             runtime.GOOS,
+			"arch":           runtime.GOARCH,
+			"device_name":    s.deviceName(),
+		}},
+		{Name: "health", Data: s.debugHealth()},
+		{Name: "activity", Data: s.debugActivity(ctx, errs)},
+		{Name: "remote", Data: s.debugRemote()},
+		{Name: "apps", Data: s.debugApps(ctx, errs)},
+		{Name: "services", Data: s.debugServices()},
+		{Name: "volumes", Data: s.debugVolumes()},
+		{Name: "logs", Data: s.debugLogs()},
+	}
+	if len(errs) == 0 {
+		errs = nil
+	}
+	return sections, errs
+}
+
+func (s *GinServer) debugHealth() gin.H {
+	if s.healthTracker == nil {
+		return gin.H{"overall": "unknown", "components": []gin.H{}}
+	}
+	components := flattenHealth(s.healthTracker.Snapshot(), s.healthTracker.Stability())
+	sort.Slice(components, func(i, j int) bool {
+		return fmt.Sprint(components[i]["name"]) < fmt.Sprint(components[j]["name"])
+	})
+	return gin.H{"overall": s.healthTracker.Overall().String(), "components": components}
+}
+
+func (s *GinServer) debugActivity(ctx context.Context, errs map[string]string) gin.H {
+	if s.activity == nil {
+		return gin.H{"entries": []activity.Entry{}}
+	}
+	entries, err := s.activity.List(ctx, activity.Query{Limit: debugBundleActivityLimit})
+	if err != nil {
+		errs["activity"] = err.Error()
+	}
+	if entries == nil {
+		entries = []activity.Entry{}
+	}
+	return gin.H{"entries": entries}
+}
+
+func (s *GinServer) debugRemote() gin.H {
+	if s.remoteManager == nil {
+		return gin.H{"configured": false}
+	}
+	return gin.H{"status": s.remoteManager.Status(), "events": s.remoteManager.ListEvents()}
+}
+
+// debugApps lists apps with their status. Environment values often hold
+// app credentials, so only the variable names are included.
+func (s *GinServer) debugApps(ctx context.Context, errs map[string]string) []gin.H {
+	out := []gin.H{}
+	if s.appManager == nil {
+		return out
+	}
+	apps, err := s.appManager.List(ctx)
+	if err != nil {
+		errs["apps"] = err.Error()
+		return out
+	}
+	for _, a := range apps {
+		envNames := make([]string, 0, len(a.Environment))
+		for k := range a.Environment {
+			envNames = append(envNames, k)
+		}
+		sort.Strings(envNames)
+		out = append(out, gin.H{
+			"name":         a.Name,
+			"image":        a.Image,
+			"type":         a.Type,
+			"status":       a.Status,
+			"container_id": a.ContainerID,
+			"environment":  envNames,
+			"created_at":   a.CreatedAt,
+			"updated_at":   a.UpdatedAt,
+		})
+	}
+	return out
+}
+
+func (s *GinServer) debugServices() []gin.H {
+	out := []gin.H{}
+	if s.serviceManager == nil {
+		return out
+	}
+	for _, ep := range s.serviceManager.GetAll() {
+		out = append(out, gin.H{
+			"app":          ep.App,
+			"name":         ep.Name,
+			"guest_port":   ep.GuestPort,
+			"host_port":    ep.HostBind,
+			"public_port":  ep.PublicPort,
+			"flow":         ep.Flow,
+			"protocol":     ep.Protocol,
+			"remote_ports": ep.RemotePorts,
+		})
+	}
+	return out
+}
+
+func (s *GinServer) debugVolumes() gin.H {
+	cryptoState := gin.H{"initialized": false, "locked": false}
+	if s.cryptoManager != nil && s.cryptoManager.IsInitialized() {
+		cryptoState = gin.H{"initialized": true, "locked": s.cryptoManager.IsLocked()}
+	}
+	out := gin.H{"crypto": cryptoState}
+	if s.persistence != nil {
+		out["bootstrap"] = s.persistence.BootstrapVolume()
+		out["control"] = s.persistence.ControlVolume()
+		if b := s.persistence.Bootstrap(); b != nil {
+			out["bootstrap_mounted"] = b.IsMounted()
+		}
+	}
+	return out
+}
+
+func (s *GinServer) debugLogs() gin.H {
+	if s.logRing == nil {
+		return gin.H{"captured": false, "lines": []string{}}
+	}
+	return gin.H{"captured": true, "lines": s.logRing.Lines(debugBundleLogLines)}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// remotePortalHTTPSPort is where the remote portal answers TLS.
+const remotePortalHTTPSPort = 443
+
+// discoveryInfo is served without a session to anything on the LAN, so it
+// carries only what a companion app needs to label a device before login.
+// Every field added here is public.
+type discoveryInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// SetupComplete is read from encrypted storage; a locked device reports
+	// false, so clients check Locked first.
+	SetupComplete bool           `json:"setup_complete"`
+	Locked        bool           `json:"locked"`
+	Ports         discoveryPorts `json:"ports"`
+}
+
+// discoveryPorts are zero when the device does not serve them.
+type discoveryPorts struct {
+	// HTTPS is the remote portal's TLS port, once remote access is enabled.
+	HTTPS int `json:"https"`
+	// Local is the plaintext admin listener on the LAN.
+	Local int `json:"local"`
+}
+
+// handleDiscovery: GET /api/v1/discovery
+func (s *GinServer) handleDiscovery(c *gin.Context) {
+	status := s.buildSetupStatus(c.Request.Context())
+	info := discoveryInfo{
+		Name:          s.deviceName(),
+		Version:       s.version,
+		SetupComplete: status.Completed,
+		Locked:        status.Locked,
+	}
+	s.networkMu.Lock()
+	if !s.listenSettings.DisablePlainHTTP {
+		info.Ports.Local, _ = strconv.Atoi(s.listenPort)
+	}
+	s.networkMu.Unlock()
+	if s.remoteManager != nil && s.remoteManager.Status().Enabled {
+		info.Ports.HTTPS = remotePortalHTTPSPort
+	}
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"piccolod/internal/mdns"
+	"piccolod/internal/network"
+)
+
+func getDiscovery(t *testing.T, srv *GinServer) (map[string]json.RawMessage, discoveryInfo) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, mdns.DiscoveryPath, nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("discovery: status %d body=%s", w.Code, w.Body.String())
+	}
+	var raw map[string]json.RawMessage
+	var info discoveryInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return raw, info
+}
+
+func jsonKeys(m map[string]json.RawMessage) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestDiscovery_ExactFieldsWithoutSession(t *testing.T) {
+	srv := createGinTestServer(t, newErrorTestDir(t))
+	srv.version = "1.2.3"
+	srv.listenPort = "8080"
+
+	raw, info := getDiscovery(t, srv)
+	if got := jsonKeys(raw); got != "locked,name,ports,setup_complete,version" {
+		t.Fatalf("fields = %s", got)
+	}
+	var ports map[string]json.RawMessage
+	if err := json.Unmarshal(raw["ports"], &ports); err != nil {
+		t.Fatalf("decode ports: %v", err)
+	}
+	if got := jsonKeys(ports); got != "https,local" {
+		t.Fatalf("port fields = %s", got)
+	}
+	if info.Name != srv.deviceName() || info.Version != "1.2.3" || info.Ports.Local != 8080 || info.Ports.HTTPS != 0 {
+		t.Fatalf("unexpected discovery info %+v", info)
+	}
+
+	srv.listenSettings = network.ListenSettings{DisablePlainHTTP: true}
+	if _, info = getDiscovery(t, srv); info.Ports.Local != 0 {
+		t.Fatalf("local port advertised with plain HTTP disabled: %+v", info)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/doctor"
+	"piccolod/internal/health"
+	"piccolod/internal/state/paths"
+)
+
+// startupDoctorTimeout bounds the startup battery as a whole; each check
+// also has its own timeout.
+const startupDoctorTimeout = 30 * time.Second
+
+// doctorResponse is the GET /doctor body.
+type doctorResponse struct {
+	Report  doctor.Report  `json:"report"`
+	Startup *doctor.Report `json:"startup,omitempty"`
+}
+
+// newDoctor builds the runner for the default battery: the state directory
+// and the ports piccolod listens on.
+func (s *GinServer) newDoctor() *doctor.Runner {
+	ports := []int{80, 443}
+	if p, err := strconv.Atoi(s.listenPort); err == nil {
+		ports = append(ports, p)
+	}
+	return doctor.NewRunner(doctor.Battery(doctor.Options{StateDir: paths.Root(), Ports: ports}))
+}
+
+// runStartupDoctor runs the battery once, logs what it found and feeds the
+// worst finding into the health tracker. The report is cached for GET
+// /doctor?cached=true.
+func (s *GinServer) runStartupDoctor() {
+	ctx, cancel := context.WithTimeout(context.Background(), startupDoctorTimeout)
+	defer cancel()
+	report := s.doctor.Startup(ctx)
+	for _, f := range report.Findings {
+		switch f.Severity {
+		case doctor.SeverityError:
+			log.Printf("ERROR: doctor %s: %s; %s", f.Check, f.Message, f.Remediation)
+		case doctor.SeverityWarn:
+			log.Printf("WARN: doctor %s: %s; %s", f.Check, f.Message, f.Remediation)
+		}
+	}
+	log.Printf("INFO: doctor ran %d checks at startup, worst=%s", len(report.Findings), report.Worst)
+	s.recordDoctorHealth(report)
+}
+
+func (s *GinServer) recordDoctorHealth(report doctor.Report) {
+	if s.healthTracker == nil {
+		return
+	}
+	level := health.LevelOK
+	switch report.Worst {
+	case doctor.SeverityWarn:
+		level = health.LevelWarn
+	case doctor.SeverityError:
+		level = health.LevelError
+	}
+	status := health.NewStatus(level, fmt.Sprintf("all %d checks passed", len(report.Findings)))
+	if worst, ok := report.WorstFinding(); ok && level != health.LevelOK {
+		status.Message = worst.Check + ": " + worst.Message
+		status.Details = map[string]interface{}{"check": worst.Check, "remediation": worst.Remediation}
+	}
+	s.healthTracker.Set("doctor", status)
+}
+
+// handleDoctor: GET /api/v1/doctor. Runs the battery unless ?cached=true,
+// which returns the latest report without probing again.
+func (s *GinServer) handleDoctor(c *gin.Context) {
+	if s.doctor == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "doctor unavailable")
+		return
+	}
+	var resp doctorResponse
+	if startup, ok := s.doctor.StartupReport(); ok {
+		resp.Startup = &startup
+	}
+	if cached, _ := strconv.ParseBool(c.Query("cached")); cached {
+		report, ok := s.doctor.Last()
+		if !ok {
+			writeGinError(c, http.StatusNotFound, "no doctor report yet")
+			return
+		}
+		resp.Report = report
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	resp.Report = s.doctor.Run(c.Request.Context())
+	s.recordDoctorHealth(resp.Report)
+	c.JSON(http.StatusOK, resp)
+}
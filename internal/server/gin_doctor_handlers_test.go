@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"piccolod/internal/doctor"
+	"piccolod/internal/health"
+)
+
+func TestDoctor_StartupReportFeedsHealth(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	var runs atomic.Int32
+	srv.doctor = doctor.NewRunner([]doctor.Check{
+		{Name: "podman", Run: func(ctx context.Context) doctor.Finding {
+			if runs.Add(1) == 1 {
+				return doctor.Finding{Severity: doctor.SeverityError, Message: "podman not found on PATH", Remediation: "Install podman"}
+			}
+			return doctor.Finding{Severity: doctor.SeverityOK, Message: "podman version 5.2.0"}
+		}},
+		{Name: "dns", Run: func(ctx context.Context) doctor.Finding {
+			return doctor.Finding{Severity: doctor.SeverityWarn, Message: "slow resolver"}
+		}},
+	})
+
+	get := func(path string) doctorResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d body=%s", path, w.Code, w.Body.String())
+		}
+		var resp doctorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/doctor?cached=true", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("cached report before any run: expected 404, got %d", w.Code)
+	}
+
+	srv.runStartupDoctor()
+	if st := srv.healthTracker.Snapshot()["doctor"]; st.Level != health.LevelError || st.Message != "podman: podman not found on PATH" {
+		t.Fatalf("worst finding not fed into health: %+v", st)
+	}
+	cached := get("/api/v1/doctor?cached=true")
+	if runs.Load() != 1 || cached.Report.Worst != doctor.SeverityError || cached.Startup == nil {
+		t.Fatalf("cached read re-ran the battery or lost the startup report: runs=%d %+v", runs.Load(), cached)
+	}
+
+	fresh := get("/api/v1/doctor")
+	if runs.Load() != 2 || fresh.Report.Worst != doctor.SeverityWarn {
+		t.Fatalf("on-demand run: runs=%d %+v", runs.Load(), fresh.Report)
+	}
+	if fresh.Startup == nil || fresh.Startup.Worst != doctor.SeverityError {
+		t.Fatalf("startup report not kept: %+v", fresh.Startup)
+	}
+	if st := srv.healthTracker.Snapshot()["doctor"]; st.Level != health.LevelWarn || st.Message != "dns: slow resolver" {
+		t.Fatalf("health not updated by the on-demand run: %+v", st)
+	}
+}
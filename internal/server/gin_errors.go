@@ -0,0 +1,295 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every API failure answers with one envelope:
+//
+//	{"error": {"code": "...", "message": "...", "details": ..., "request_id": "..."}}
+//
+// code is one of errorCatalog and is what clients branch on; message is for
+// people and may change. Messages rendered from the catalog in
+// gin_messages.go also carry message_key and params.
+
+// Generic error codes, derived from the status when a handler does not name
+// a more specific one.
+const (
+	errorCodeValidationFailed = "validation_failed"
+	errorCodeUnauthorized     = "unauthorized"
+	errorCodeForbidden        = "forbidden"
+	errorCodeNotFound         = "not_found"
+	errorCodeConflict         = "conflict"
+	errorCodeLocked           = "locked"
+	errorCodeNotLeader        = "not_leader"
+	errorCodeRateLimited      = "rate_limited"
+	errorCodeUnavailable      = "unavailable"
+	errorCodeInternal         = "internal"
+)
+
+// Specific error codes for failures clients handle on their own, such as
+// "unlock first" as opposed to a real fault.
+const (
+	errorCodeVolumeUnavailable  = "volume_unavailable"
+	errorCodeValuesRequired     = "values_required"
+	errorCodeInvalidCredentials = "invalid_credentials"
+	errorCodeOperationTimeout   = "operation_timeout"
+	errorCodeInvalidHostname    = "invalid_hostname"
+	errorCodeInvalidEndpoint    = "invalid_endpoint"
+	errorCodeUnsupportedVersion = "unsupported_app_version"
+	errorCodeRemoteHostConflict = "remote_host_conflict"
+	errorCodeNoSpace            = "insufficient_storage"
+	errorCodeOperationBusy      = "operation_in_progress"
+	errorCodeStorageUnavailable = "storage_unavailable"
+	errorCodeReplaceUnhealthy   = "replacement_unhealthy"
+	errorCodePathPrefixConflict = "path_prefix_conflict"
+
+	unlockHintURL = "/api/v1/crypto/unlock"
+)
+
+// errorCatalog lists every code the API emits. Codes are stable: add new
+// ones, never rename them. docs/api/openapi.yaml mirrors this list.
+var errorCatalog = map[string]bool{
+	errorCodeValidationFailed:   true,
+	errorCodeUnauthorized:       true,
+	errorCodeForbidden:          true,
+	errorCodeNotFound:           true,
+	errorCodeConflict:           true,
+	errorCodeLocked:             true,
+	errorCodeNotLeader:          true,
+	errorCodeRateLimited:        true,
+	errorCodeUnavailable:        true,
+	errorCodeInternal:           true,
+	errorCodeVolumeUnavailable:  true,
+	errorCodeValuesRequired:     true,
+	errorCodeInvalidCredentials: true,
+	errorCodeOperationTimeout:   true,
+	errorCodeInvalidHostname:    true,
+	errorCodeInvalidEndpoint:    true,
+	errorCodeUnsupportedVersion: true,
+	errorCodeRemoteHostConflict: true,
+	errorCodePathPrefixConflict: true,
+	errorCodeNoSpace:            true,
+	errorCodeTokenInvalid:       true,
+	errorCodeTokenExpired:       true,
+	errorCodeTokenScope:         true,
+	errorCodeSessionIdle:        true,
+	errorCodeSessionExpired:     true,
+	errorCodeLockoutRisk:        true,
+	errorCodePortsInUse:         true,
+	errorCodeOperationBusy:      true,
+	errorCodeStorageUnavailable: true,
+	errorCodeReplaceUnhealthy:   true,
+	errorCodeCapabilityDenied:   true,
+	errorCodeCapabilityConfirm:  true,
+}
+
+// APIError is the body of the error envelope.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details carries structured context, such as per-field problems.
+	Details any `json:"details,omitempty"`
+	// Hint points at the endpoint that resolves the error, when there is one.
+	Hint      string `json:"hint,omitempty"`
+	RequestID string `json:"request_id"`
+	// MessageKey and Params name the catalog template Message was rendered
+	// from, so clients can show the message in their own language.
+	MessageKey string            `json:"message_key,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+}
+
+// errorEnvelope is the JSON document of every error response.
+type errorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+// errorCodeForStatus returns the generic code for an HTTP status.
+func errorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return errorCodeValidationFailed
+	case http.StatusUnauthorized:
+		return errorCodeUnauthorized
+	case http.StatusForbidden:
+		return errorCodeForbidden
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return errorCodeNotFound
+	case http.StatusConflict, http.StatusGone, http.StatusPreconditionFailed:
+		return errorCodeConflict
+	case http.StatusLocked:
+		return errorCodeLocked
+	case http.StatusTooManyRequests:
+		return errorCodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return errorCodeUnavailable
+	case http.StatusGatewayTimeout:
+		return errorCodeOperationTimeout
+	case http.StatusInsufficientStorage:
+		return errorCodeNoSpace
+	}
+	if status >= http.StatusInternalServerError {
+		return errorCodeInternal
+	}
+	return errorCodeValidationFailed
+}
+
+// writeGinError writes an error envelope with the generic code for
+// statusCode.
+func writeGinError(c *gin.Context, statusCode int, message string) {
+	writeGinErrorDetails(c, statusCode, errorCodeForStatus(statusCode), message, nil)
+}
+
+// writeGinErrorCode writes an error envelope with a specific code. Locked
+// responses point the client at the unlock endpoint.
+func writeGinErrorCode(c *gin.Context, statusCode int, code, message string) {
+	writeGinErrorDetails(c, statusCode, code, message, nil)
+}
+
+// writeGinErrorDetails writes an error envelope carrying structured details.
+func writeGinErrorDetails(c *gin.Context, statusCode int, code, message string, details any) {
+	c.JSON(statusCode, newErrorEnvelope(c, code, message, details))
+}
+
+// writeNoSpaceError answers a write the persistence layer refused because
+// free space is below the floor.
+func writeNoSpaceError(c *gin.Context, err error) {
+	writeGinErrorCode(c, http.StatusInsufficientStorage, errorCodeNoSpace, "Not enough free storage; free up space and retry: "+err.Error())
+}
+
+// abortGinError writes an error envelope and stops the handler chain.
+func abortGinError(c *gin.Context, statusCode int, message string) {
+	writeGinError(c, statusCode, message)
+	c.Abort()
+}
+
+func newErrorEnvelope(c *gin.Context, code, message string, details any) errorEnvelope {
+	apiErr := &APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(c),
+	}
+	if code == errorCodeLocked {
+		apiErr.Hint = unlockHintURL
+	}
+	return errorEnvelope{Error: apiErr}
+}
+
+// ctxRequestIDKey holds the request ID assigned by requestIDMiddleware.
+const ctxRequestIDKey = "piccolo.request_id"
+
+// requestIDHeader carries the request ID both ways; a well-formed ID sent by
+// the client is kept so its logs and ours line up.
+const requestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 64
+
+// requestIDMiddleware assigns every request an ID, echoed in the response
+// header and in error envelopes.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(ctxRequestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+func requestID(c *gin.Context) string {
+	if id := c.GetString(ctxRequestIDKey); id != "" {
+		return id
+	}
+	// Handlers mounted without the middleware, as in some tests.
+	id := newRequestID()
+	c.Set(ctxRequestIDKey, id)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// errorMiddleware answers panics and errors attached with c.Error with the
+// error envelope, when the handler has not written a response itself.
+// Panics are logged with their stack and reported as internal errors
+// without leaking the panic value.
+func errorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := c.Writer
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			log.Printf("ERROR: panic serving %s %s: %v\n%s", c.Request.Method, c.Request.URL.Path, rec, debug.Stack())
+			if c.Writer = w; w.Size() <= 0 {
+				w.Header().Del("Content-Encoding")
+				abortGinError(c, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			c.Abort()
+		}()
+		c.Next()
+
+		// AbortWithError sends the status line without a body, so only a
+		// written body means the handler answered itself.
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Size() > 0 {
+			return
+		}
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest {
+			status = http.StatusInternalServerError
+			if last.IsType(gin.ErrorTypeBind) {
+				status = http.StatusBadRequest
+			}
+		}
+		// Private errors may carry internals; only public and bind errors
+		// reach the client verbatim.
+		message := http.StatusText(status)
+		if last.IsType(gin.ErrorTypePublic) || last.IsType(gin.ErrorTypeBind) {
+			message = last.Error()
+		}
+		c.Writer = w
+		w.Header().Del("Content-Encoding")
+		writeGinError(c, status, message)
+	}
+}
+
+// isAPIPath reports whether path is under /api/, where unmatched routes
+// answer with the error envelope instead of the web UI.
+func isAPIPath(path string) bool {
+	return path == "/api" || strings.HasPrefix(path, "/api/")
+}
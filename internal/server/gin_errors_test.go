@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/cluster"
+)
+
+// checkErrorEnvelope asserts w carries exactly the error envelope with code
+// and the request ID from the response header.
+func checkErrorEnvelope(t *testing.T, name string, w *httptest.ResponseRecorder, status int, code string) *APIError {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("%s: status %d, want %d body=%s", name, w.Code, status, w.Body.String())
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil || len(raw) != 1 || raw["error"] == nil {
+		t.Fatalf("%s: not an error envelope: %q (%v)", name, w.Body.String(), err)
+	}
+	var env errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || env.Error == nil {
+		t.Fatalf("%s: undecodable envelope: %q (%v)", name, w.Body.String(), err)
+	}
+	if !errorCatalog[env.Error.Code] || env.Error.Code != code {
+		t.Fatalf("%s: code %q, want %q", name, env.Error.Code, code)
+	}
+	if env.Error.Message == "" {
+		t.Fatalf("%s: empty message", name)
+	}
+	if id := w.Header().Get(requestIDHeader); id == "" || env.Error.RequestID != id {
+		t.Fatalf("%s: request_id %q, header %q", name, env.Error.RequestID, id)
+	}
+	return env.Error
+}
+
+// newErrorTestDir is removed without failing the test; background workers
+// of the test server may still be writing to it.
+func newErrorTestDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "gin-errors")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestErrorEnvelope_Sweep(t *testing.T) {
+	srv := createGinTestServer(t, newErrorTestDir(t))
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.leadership = cluster.NewRegistry()
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+
+	srv.router.GET("/api/v1/test/panic", func(c *gin.Context) { panic("secret panic value") })
+	srv.router.GET("/api/v1/test/error", func(c *gin.Context) { _ = c.Error(errors.New("secret internals")) })
+	srv.router.POST("/api/v1/test/bind", func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if c.BindJSON(&body) == nil {
+			c.Status(http.StatusNoContent)
+		}
+	})
+
+	cases := []struct {
+		name         string
+		method, path string
+		body         string
+		auth         bool
+		noCSRF       bool
+		header       map[string]string
+		setup        func()
+		status       int
+		code         string
+	}{
+		{name: "unknown api route", method: http.MethodGet, path: "/api/v1/nope", auth: true, status: http.StatusNotFound, code: errorCodeNotFound},
+		{name: "unknown api route without session", method: http.MethodPost, path: "/api/v2/apps", status: http.StatusNotFound, code: errorCodeNotFound},
+		{name: "no session", method: http.MethodGet, path: "/api/v1/apps", status: http.StatusUnauthorized, code: errorCodeUnauthorized},
+		{name: "bad bearer token", method: http.MethodGet, path: "/api/v1/apps", header: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusUnauthorized, code: errorCodeTokenInvalid},
+		{name: "missing csrf", method: http.MethodPost, path: "/api/v1/apps/blog/start", auth: true, noCSRF: true, status: http.StatusForbidden, code: errorCodeForbidden},
+		{name: "cross-origin preflight", method: http.MethodOptions, path: "/api/v1/apps", header: map[string]string{"Origin": "https://evil.example"}, status: http.StatusForbidden, code: errorCodeForbidden},
+		{name: "malformed json", method: http.MethodPost, path: "/api/v1/auth/login", body: "{", status: http.StatusBadRequest, code: errorCodeValidationFailed},
+		{name: "missing app", method: http.MethodGet, path: "/api/v1/apps/nope", auth: true, status: http.StatusNotFound, code: errorCodeNotFound},
+		{name: "missing remote alias", method: http.MethodDelete, path: "/api/v1/remote/aliases/nope", auth: true, status: http.StatusNotFound, code: errorCodeNotFound},
+		{name: "locked", method: http.MethodGet, path: "/api/v1/apps", auth: true, status: http.StatusLocked, code: errorCodeLocked,
+			setup: func() { srv.appManager.ForceLockState(true) }},
+		{name: "not leader", method: http.MethodPost, path: "/api/v1/updates/os/check", auth: true, status: http.StatusConflict, code: errorCodeNotLeader,
+			setup: func() {
+				srv.appManager.ForceLockState(false)
+				srv.leadership.Set(cluster.ResourceKernel, cluster.RoleFollower)
+			}},
+		{name: "rate limited", method: http.MethodGet, path: "/api/v1/debug/bundle", auth: true, status: http.StatusTooManyRequests, code: errorCodeRateLimited,
+			setup: func() {
+				srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+				if w := getDebugBundle(srv, cookie, csrf); w.Code != http.StatusOK {
+					t.Fatalf("first bundle: %d", w.Code)
+				}
+			}},
+		{name: "panic", method: http.MethodGet, path: "/api/v1/test/panic", status: http.StatusInternalServerError, code: errorCodeInternal},
+		{name: "c.Error", method: http.MethodGet, path: "/api/v1/test/error", status: http.StatusInternalServerError, code: errorCodeInternal},
+		{name: "bind error", method: http.MethodPost, path: "/api/v1/test/bind", body: `{}`, status: http.StatusBadRequest, code: errorCodeValidationFailed},
+	}
+	for _, tc := range cases {
+		if tc.setup != nil {
+			tc.setup()
+		}
+		req, _ := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		if tc.auth {
+			req.AddCookie(cookie)
+			if !tc.noCSRF {
+				req.Header.Set("X-CSRF-Token", csrf)
+			}
+		}
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		apiErr := checkErrorEnvelope(t, tc.name, w, tc.status, tc.code)
+		if strings.Contains(apiErr.Message, "secret") {
+			t.Fatalf("%s: message leaks internals: %q", tc.name, apiErr.Message)
+		}
+	}
+}
+
+func TestErrorEnvelope_KeepsClientRequestID(t *testing.T) {
+	srv := createGinTestServer(t, newErrorTestDir(t))
+	for id, keep := range map[string]bool{"trace-42.a_b": true, "bad id with spaces": false, strings.Repeat("x", maxRequestIDLen+1): false} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/nope", nil)
+		req.Header.Set(requestIDHeader, id)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		apiErr := checkErrorEnvelope(t, id, w, http.StatusNotFound, errorCodeNotFound)
+		if (apiErr.RequestID == id) != keep {
+			t.Fatalf("request id %q: got %q, keep=%v", id, apiErr.RequestID, keep)
+		}
+	}
+}
+
+func TestErrorEnvelope_OpenAPIValidator(t *testing.T) {
+	srv := createGinTestServer(t, newErrorTestDir(t))
+	v, err := newOpenAPIValidator()
+	if err != nil {
+		t.Fatalf("validator: %v", err)
+	}
+	srv.apiValidator = v
+	srv.setupGinRoutes()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/not-in-spec", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	apiErr := checkErrorEnvelope(t, "validator", w, http.StatusBadRequest, errorCodeValidationFailed)
+	if details, ok := apiErr.Details.(map[string]any); !ok || details["detail"] == "" {
+		t.Fatalf("validator details missing: %+v", apiErr.Details)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/identity"
+	"piccolod/internal/persistence"
+)
+
+// deviceNameAdvertiser publishes the device name on the local network;
+// *mdns.Manager satisfies it.
+type deviceNameAdvertiser interface {
+	SetName(name string)
+}
+
+// deviceName is the configured device name, or the default before one is set.
+func (s *GinServer) deviceName() string {
+	if s.identity == nil {
+		return identity.DefaultName
+	}
+	return s.identity.Name()
+}
+
+func (s *GinServer) advertiseDeviceName() {
+	if s.nameAdvertiser != nil {
+		s.nameAdvertiser.SetName(s.deviceName())
+	}
+}
+
+// reloadIdentity adopts the stored name after unlock; the bootstrap copy may
+// be stale if the last rename happened on another node.
+func (s *GinServer) reloadIdentity() error {
+	if s.identity == nil {
+		return nil
+	}
+	if err := s.identity.ReloadFromStorage(); err != nil {
+		return err
+	}
+	s.advertiseDeviceName()
+	return nil
+}
+
+// remoteHostnameWarnings lists configured remote hostnames still derived from
+// the previous device name. They are left alone because changing them would
+// break existing links and certificates.
+func (s *GinServer) remoteHostnameWarnings(previous string) []string {
+	if s.remoteManager == nil || previous == "" {
+		return nil
+	}
+	portal := s.remoteManager.Status().PortalHostname
+	if portal == "" || !strings.HasPrefix(strings.ToLower(portal), previous+".") {
+		return nil
+	}
+	return []string{fmt.Sprintf("remote portal hostname %s still uses the previous name; reconfigure remote access to change it", portal)}
+}
+
+// handleSystemIdentityGet: GET /api/v1/system/identity
+func (s *GinServer) handleSystemIdentityGet(c *gin.Context) {
+	if s.identity == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "identity unavailable")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identity": s.identity.Current()})
+}
+
+// handleSystemIdentityUpdate: PUT /api/v1/system/identity
+func (s *GinServer) handleSystemIdentityUpdate(c *gin.Context) {
+	if s.identity == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "identity unavailable")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	previous, err := s.identity.Rename(c.Request.Context(), req.Name)
+	switch {
+	case err == nil:
+	case errors.Is(err, identity.ErrInvalidName):
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	current := s.identity.Current()
+	warnings := []string{}
+	if previous != current.Name {
+		s.advertiseDeviceName()
+		warnings = append(warnings, s.remoteHostnameWarnings(previous)...)
+		for _, w := range warnings {
+			log.Printf("WARN: device rename: %s", w)
+		}
+		s.recordActivity(c, "system", activity.LevelInfo, "Device renamed from "+previous+" to "+current.Name)
+	}
+	c.JSON(http.StatusOK, gin.H{"identity": current, "warnings": warnings})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"piccolod/internal/cluster"
+	"piccolod/internal/identity"
+	"piccolod/internal/persistence"
+)
+
+type memoryIdentityRepo struct {
+	mu    sync.Mutex
+	saved *persistence.DeviceIdentity
+}
+
+func (r *memoryIdentityRepo) CurrentIdentity(ctx context.Context) (persistence.DeviceIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.DeviceIdentity{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryIdentityRepo) SaveIdentity(ctx context.Context, id persistence.DeviceIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &id
+	return nil
+}
+
+type recordingAdvertiser struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (a *recordingAdvertiser) SetName(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.names = append(a.names, name)
+}
+
+func (a *recordingAdvertiser) last() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.names) == 0 {
+		return ""
+	}
+	return a.names[len(a.names)-1]
+}
+
+func TestSystemIdentity_RenamePropagatesToMDNS(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "identity-rename")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.leadership = cluster.NewRegistry()
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+	bootstrapDir := filepath.Join(tempDir, "bootstrap")
+	srv.identity = identity.NewManager(&memoryIdentityRepo{}, bootstrapDir)
+	advertiser := &recordingAdvertiser{}
+	srv.nameAdvertiser = advertiser
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/system/identity", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"piccolo"`) {
+		t.Fatalf("get default identity: %d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/system/identity", `{"name":"Kitchen-Box"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Identity identity.Identity `json:"identity"`
+		Warnings []string          `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Identity.Name != "kitchen-box" || resp.Identity.MDNSHostname != "kitchen-box.local" {
+		t.Fatalf("unexpected identity: %+v", resp.Identity)
+	}
+	if got := advertiser.last(); got != "kitchen-box" {
+		t.Fatalf("mDNS advertiser got %q, want kitchen-box", got)
+	}
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/version", "")
+	if !strings.Contains(w.Body.String(), `"device_name":"kitchen-box"`) {
+		t.Fatalf("version should report device name: %s", w.Body.String())
+	}
+
+	// The bootstrap copy lets a fresh manager advertise the name before unlock.
+	if got := identity.NewManager(nil, bootstrapDir).Name(); got != "kitchen-box" {
+		t.Fatalf("bootstrap copy name = %q", got)
+	}
+}
+
+func TestSystemIdentity_RejectsInvalidLabels(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "identity-invalid")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.leadership = cluster.NewRegistry()
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+	srv.identity = identity.NewManager(&memoryIdentityRepo{}, filepath.Join(tempDir, "bootstrap"))
+	advertiser := &recordingAdvertiser{}
+	srv.nameAdvertiser = advertiser
+
+	for _, name := range []string{"", "-edge", "edge-", "has space", "under_score", "café", strings.Repeat("a", 64)} {
+		body, _ := json.Marshal(map[string]string{"name": name})
+		w := doAuthedRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/system/identity", string(body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("name %q: expected 400, got %d body=%s", name, w.Code, w.Body.String())
+		}
+	}
+	if got := advertiser.last(); got != "" {
+		t.Fatalf("invalid names must not reach mDNS, got %q", got)
+	}
+	if got := srv.identity.Name(); got != identity.DefaultName {
+		t.Fatalf("name changed to %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/api"
+	"piccolod/internal/app"
+	"piccolod/internal/container"
+	"piccolod/internal/jobs"
+)
+
+// Job kinds exposed through /api/v1/jobs.
+const (
+	jobKindAppInstall    = "app.install"
+	jobKindControlExport = "export.control"
+	jobKindFullExport    = "export.full"
+)
+
+// jobCancelWait is how long a cancel request waits for the job to wind down
+// before answering with its still-running record.
+const jobCancelWait = 5 * time.Second
+
+// jobs returns the job registry, creating it on first use.
+func (s *GinServer) jobs() *jobs.Registry {
+	s.jobsOnce.Do(func() {
+		s.jobRegistry = jobs.NewRegistry()
+	})
+	return s.jobRegistry
+}
+
+// handleJobGet handles GET /api/v1/jobs/:id.
+func (s *GinServer) handleJobGet(c *gin.Context) {
+	id := c.Param("id")
+	job, ok := s.jobs().Get(id)
+	if !ok {
+		writeGinError(c, http.StatusNotFound, "job not found: "+id)
+		return
+	}
+	c.JSON(http.StatusOK, GinAppResponse{Data: gin.H{"job": job}})
+}
+
+// handleJobCancel handles POST /api/v1/jobs/:id/cancel.
+func (s *GinServer) handleJobCancel(c *gin.Context) {
+	id := c.Param("id")
+	job, err := s.jobs().Cancel(id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeGinError(c, http.StatusNotFound, "job not found: "+id)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		writeGinError(c, http.StatusConflict, fmt.Sprintf("job %s already %s", id, job.State))
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), jobCancelWait)
+	defer cancel()
+	if done, err := s.jobs().Wait(ctx, id); err == nil {
+		job = done
+	}
+	status := http.StatusOK
+	if !job.Done() {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, GinAppResponse{Data: gin.H{"job": job}, Message: "job " + id + " canceled"})
+}
+
+// startAppInstallJob pulls the app image in the background and installs the
+// app once the image is local.
+func (s *GinServer) startAppInstallJob(appDef *api.AppDefinition, confirmCaps bool) jobs.Job {
+	return s.jobs().Start(jobKindAppInstall, 0, func(ctx context.Context, report func(jobs.Progress)) (any, error) {
+		if confirmCaps {
+			ctx = app.ConfirmCapabilities(ctx)
+		}
+		err := s.appManager.PullImage(ctx, appDef.Image, func(p container.PullProgress) {
+			report(jobs.Progress{Stage: p.Stage, Current: p.BlobsDone, Total: p.BlobsTotal, Message: p.Line})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("pull %s: %w", appDef.Image, err)
+		}
+		report(jobs.Progress{Stage: "installing", Message: "Installing " + appDef.Name})
+		inst, err := s.appManager.Upsert(ctx, appDef)
+		if err != nil {
+			err = fmt.Errorf("install %s: %w", appDef.Name, err)
+			if details := installErrorDetails(err); details != nil {
+				return nil, &jobs.DetailedError{Err: err, Details: details}
+			}
+			return nil, err
+		}
+		s.queueAppRemoteCertificates(inst.Name)
+		s.syncRemotePortMappings()
+		return inst, nil
+	})
+}
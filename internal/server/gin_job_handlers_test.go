@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"piccolod/internal/app"
+	"piccolod/internal/jobs"
+)
+
+const jobTestManifest = "name: blog\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: web\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
+
+type jobEnvelope struct {
+	Data struct {
+		Job jobs.Job `json:"job"`
+	} `json:"data"`
+}
+
+func newPullJobTestServer(t *testing.T) (*GinServer, *GinMockContainerManager, *http.Cookie, string) {
+	t.Helper()
+	tempDir, err := os.MkdirTemp("", "gin_jobs_test")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	mock := &GinMockContainerManager{
+		containers:    make(map[string]*MockContainer),
+		nextID:        1,
+		missingImages: map[string]bool{"docker.io/library/nginx:alpine": true},
+		pullGate:      make(chan struct{}),
+	}
+	srv := createGinTestServerWithContainers(t, tempDir, mock)
+	t.Cleanup(srv.jobs().Close)
+	t.Cleanup(srv.serviceManager.StopAll)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	return srv, mock, cookie, csrf
+}
+
+func startInstallJob(t *testing.T, srv *GinServer, cookie *http.Cookie, csrf string) jobs.Job {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(jobTestManifest))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for missing image, got %d body=%s", w.Code, w.Body.String())
+	}
+	var resp jobEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Data.Job.ID == "" || resp.Data.Job.Kind != jobKindAppInstall {
+		t.Fatalf("unexpected job: %+v", resp.Data.Job)
+	}
+	if loc := w.Header().Get("Location"); loc != "/api/v1/jobs/"+resp.Data.Job.ID {
+		t.Fatalf("Location = %q", loc)
+	}
+	return resp.Data.Job
+}
+
+func pollJob(t *testing.T, srv *GinServer, cookie *http.Cookie, csrf, id string, until func(jobs.Job) bool) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/jobs/"+id, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get job: %d %s", w.Code, w.Body.String())
+		}
+		var resp jobEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if until(resp.Data.Job) {
+			return resp.Data.Job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s never reached the expected state: %+v", id, resp.Data.Job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAppInstall_MissingImagePullsInJob(t *testing.T) {
+	srv, mock, cookie, csrf := newPullJobTestServer(t)
+	job := startInstallJob(t, srv, cookie, csrf)
+
+	progress := pollJob(t, srv, cookie, csrf, job.ID, func(j jobs.Job) bool { return j.Progress.Stage == "copying" })
+	if progress.State != jobs.StateRunning || progress.Progress.Current != 1 || progress.Progress.Total != 2 {
+		t.Fatalf("pull progress: %+v", progress)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("app should not exist before the pull finishes, got %d", w.Code)
+	}
+
+	close(mock.pullGate)
+	done := pollJob(t, srv, cookie, csrf, job.ID, jobs.Job.Done)
+	if done.State != jobs.StateSucceeded {
+		t.Fatalf("install job: %+v", done)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", ""); w.Code != http.StatusOK {
+		t.Fatalf("app missing after job: %d %s", w.Code, w.Body.String())
+	}
+
+	// With the image now local, reinstalling answers synchronously.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(jobTestManifest))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with image present, got %d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestAppInstall_CancelPullJob(t *testing.T) {
+	srv, mock, cookie, csrf := newPullJobTestServer(t)
+	job := startInstallJob(t, srv, cookie, csrf)
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/jobs/"+job.ID+"/cancel", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", w.Code, w.Body.String())
+	}
+	var resp jobEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Data.Job.State != jobs.StateCanceled {
+		t.Fatalf("canceled job: %+v", resp.Data.Job)
+	}
+	mock.imagesMu.Lock()
+	canceled, stillMissing := mock.pullCanceled, mock.missingImages["docker.io/library/nginx:alpine"]
+	mock.imagesMu.Unlock()
+	if !canceled || !stillMissing {
+		t.Fatalf("pull was not aborted: canceled=%v missing=%v", canceled, stillMissing)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("canceled install left an app behind: %d", w.Code)
+	}
+
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/jobs/"+job.ID+"/cancel", ""); w.Code != http.StatusConflict {
+		t.Fatalf("second cancel: expected 409, got %d", w.Code)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/jobs/nope", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: expected 404, got %d", w.Code)
+	}
+}
+
+func TestAppInstall_FailedJobKeepsStepDetails(t *testing.T) {
+	srv, mock, cookie, csrf := newPullJobTestServer(t)
+	mock.createError = errors.New("no space left on device")
+	job := startInstallJob(t, srv, cookie, csrf)
+
+	close(mock.pullGate)
+	done := pollJob(t, srv, cookie, csrf, job.ID, jobs.Job.Done)
+	if done.State != jobs.StateFailed || !strings.Contains(done.Error, "no space left on device") {
+		t.Fatalf("install job: %+v", done)
+	}
+	details, _ := done.Details.(map[string]any)
+	steps, _ := details["steps"].([]any)
+	if details["step"] != app.InstallStepCreateContainer || len(steps) == 0 {
+		t.Fatalf("expected the failed step in the job details, got %+v", done.Details)
+	}
+	var failed map[string]any
+	for _, st := range steps {
+		if st := st.(map[string]any); st["name"] == app.InstallStepCreateContainer {
+			failed = st
+		}
+	}
+	if failed == nil || !strings.Contains(failed["error"].(string), "no space left on device") {
+		t.Fatalf("failed step output missing: %+v", steps)
+	}
+}
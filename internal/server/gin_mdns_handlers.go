@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/health"
+	"piccolod/internal/mdns"
+)
+
+// mdnsAddressReporter reports and refreshes the addresses the device name
+// is advertised under; *mdns.Manager satisfies it.
+type mdnsAddressReporter interface {
+	Addresses() mdns.AddressStatus
+	Reannounce() (mdns.AddressStatus, error)
+}
+
+// reportMDNSAddresses mirrors the advertised addresses into the mdns health
+// entry.
+func (s *GinServer) reportMDNSAddresses(st mdns.AddressStatus) {
+	if s.healthTracker == nil {
+		return
+	}
+	status := health.NewStatus(health.LevelOK, fmt.Sprintf("advertising %s.local on %d addresses", st.Name, len(st.Addresses)))
+	if len(st.Addresses) == 0 {
+		status = health.NewStatus(health.LevelWarn, fmt.Sprintf("no addresses to advertise %s.local on", st.Name))
+	}
+	status.Details = map[string]interface{}{
+		"addresses":   st.Addresses,
+		"watcher":     st.Watcher,
+		"reannounces": st.Reannounces,
+	}
+	if st.LastReannounce != nil {
+		status.Details["last_reannounce"] = *st.LastReannounce
+	}
+	s.healthTracker.Set("mdns", status)
+}
+
+// handleSystemMDNSGet: GET /api/v1/system/mdns
+func (s *GinServer) handleSystemMDNSGet(c *gin.Context) {
+	if s.mdnsAddresses == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "mdns disabled")
+		return
+	}
+	c.JSON(http.StatusOK, s.mdnsAddresses.Addresses())
+}
+
+// handleSystemMDNSReannounce: POST /api/v1/system/mdns/reannounce
+func (s *GinServer) handleSystemMDNSReannounce(c *gin.Context) {
+	if s.mdnsAddresses == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "mdns disabled")
+		return
+	}
+	st, err := s.mdnsAddresses.Reannounce()
+	if err != nil {
+		// Only mdns.ErrNotRunning: the supervisor has not started it.
+		writeGinError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	s.recordActivity(c, "mdns", activity.LevelInfo, fmt.Sprintf("Re-announced %s.local on %d addresses", st.Name, len(st.Addresses)))
+	writeGinSuccess(c, st, "mDNS addresses re-announced")
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"piccolod/internal/health"
+	"piccolod/internal/mdns"
+)
+
+type fakeMDNSAddresses struct {
+	status  mdns.AddressStatus
+	running bool
+}
+
+func (f *fakeMDNSAddresses) Addresses() mdns.AddressStatus { return f.status }
+
+func (f *fakeMDNSAddresses) Reannounce() (mdns.AddressStatus, error) {
+	if !f.running {
+		return f.status, mdns.ErrNotRunning
+	}
+	now := time.Now().UTC()
+	f.status.Reannounces++
+	f.status.LastReannounce = &now
+	return f.status, nil
+}
+
+func TestSystemMDNS_StatusAndReannounce(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/system/mdns", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("mdns disabled: expected 503, got %d", w.Code)
+	}
+
+	fake := &fakeMDNSAddresses{status: mdns.AddressStatus{
+		Name:      "piccolo",
+		Running:   true,
+		Watcher:   mdns.WatchNetlink,
+		Addresses: []mdns.Address{{Interface: "eth0", IP: "192.168.1.40"}},
+	}}
+	srv.mdnsAddresses = fake
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/system/mdns", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get mdns: %d body=%s", w.Code, w.Body.String())
+	}
+	var st mdns.AddressStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(st.Addresses) != 1 || st.Addresses[0].IP != "192.168.1.40" || st.Watcher != "netlink" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/system/mdns/reannounce", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("reannounce while stopped: expected 503, got %d", w.Code)
+	}
+	fake.running = true
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/system/mdns/reannounce", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reannounce: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data mdns.AddressStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Data.Reannounces != 1 || resp.Data.LastReannounce == nil {
+		t.Fatalf("unexpected reannounce result: %+v", resp.Data)
+	}
+}
+
+func TestReportMDNSAddresses_SetsHealthDetails(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv.reportMDNSAddresses(mdns.AddressStatus{
+		Name:           "piccolo",
+		Watcher:        mdns.WatchPoll,
+		Addresses:      []mdns.Address{{Interface: "usb0", IP: "10.0.0.5"}},
+		LastReannounce: &at,
+		Reannounces:    2,
+	})
+	st, ok := srv.healthTracker.Status("mdns")
+	if !ok || st.Level != health.LevelOK {
+		t.Fatalf("mdns health: %+v", st)
+	}
+	if addrs, _ := st.Details["addresses"].([]mdns.Address); len(addrs) != 1 || addrs[0].Interface != "usb0" {
+		t.Fatalf("addresses detail: %+v", st.Details)
+	}
+	if st.Details["last_reannounce"] != at {
+		t.Fatalf("last_reannounce detail: %+v", st.Details)
+	}
+
+	srv.reportMDNSAddresses(mdns.AddressStatus{Name: "piccolo"})
+	if st, _ := srv.healthTracker.Status("mdns"); st.Level != health.LevelWarn {
+		t.Fatalf("no addresses should warn: %+v", st)
+	}
+}
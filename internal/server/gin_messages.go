@@ -0,0 +1,306 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error messages rendered from the catalog are keyed by error code, or by
+// "code.variant" where one code covers several situations. The response
+// carries the key and the parameters next to the rendered message so
+// clients can localize it themselves; the English text is the fallback for
+// every locale.
+
+// Message keys for the app, remote, crypto and auth error paths.
+const (
+	msgInvalidBody          = "validation_failed.invalid_body"
+	msgInvalidJSON          = "validation_failed.invalid_json"
+	msgEmptyBody            = "validation_failed.empty_body"
+	msgInvalidAppYAML       = "validation_failed.app_yaml"
+	msgNotInitialized       = "validation_failed.not_initialized"
+	msgAlreadyInitialized   = "validation_failed.already_initialized"
+	msgPasswordRequired     = "validation_failed.password_required"
+	msgUsernameRequired     = "validation_failed.username_required"
+	msgPasswordChangeFields = "validation_failed.password_change_fields"
+	msgResetFields          = "validation_failed.reset_fields"
+	msgUnlockRequired       = "validation_failed.unlock_required"
+	msgPasswordChanged      = "unauthorized.password_changed"
+	msgCurrentPassword      = "forbidden.current_password"
+	msgSystemAppPause       = "forbidden.system_app_pause"
+	msgAppNotFound          = "not_found.app"
+	msgUnlockNotFound       = "not_found.unlock"
+	msgNoUnlock             = "not_found.no_unlock"
+	msgAppPaused            = "conflict.app_paused"
+	msgAppNotRunning        = "conflict.app_not_running"
+	msgAppNotPaused         = "conflict.app_not_paused"
+	msgRemoteNotEnabled     = "conflict.remote_not_enabled"
+	msgCertificateInUse     = "conflict.certificate_in_use"
+	msgLockedAction         = "locked.action"
+	msgNotLeaderAction      = "not_leader.action"
+	msgPersistenceState     = "internal.persistence_state"
+	msgAuthState            = "internal.auth_state"
+	msgRemoteDispatcher     = "internal.remote_dispatcher"
+	msgVolumeAction         = "volume_unavailable.action"
+	msgTimeoutAction        = "operation_timeout.action"
+	msgBusyAction           = "operation_in_progress.action"
+	msgReplaceUnhealthy     = "replacement_unhealthy.action"
+
+	msgContentType        = "validation_failed.content_type"
+	msgAppDefinitionJSON  = "validation_failed.app_definition_json"
+	msgReadBody           = "validation_failed.read_body"
+	msgAppNameMismatch    = "validation_failed.app_name_mismatch"
+	msgTimestampParam     = "validation_failed.timestamp_param"
+	msgPositiveIntParam   = "validation_failed.positive_integer_param"
+	msgBooleanParam       = "validation_failed.boolean_param"
+	msgEventSeqParam      = "validation_failed.event_seq_param"
+	msgPurgeConfirm       = "validation_failed.purge_confirm"
+	msgNoFlags            = "validation_failed.no_flags"
+	msgPasswordPolicy     = "validation_failed.password_policy"
+	msgInvalidAction      = "validation_failed.action"
+	msgTemplateNotFound   = "not_found.template"
+	msgNotFoundAction     = "not_found.action"
+	msgConflictAction     = "conflict.action"
+	msgForbiddenAction    = "forbidden.action"
+	msgFailedAction       = "internal.action"
+	msgAuthUnavailable    = "internal.auth_unavailable"
+	msgRewrapKeys         = "internal.rewrap_keys"
+	msgUnlockPersistence  = "internal.unlock_persistence"
+	msgRelockPersistence  = "internal.relock_persistence"
+	msgUpdateStaleness    = "internal.update_staleness"
+	msgVerifyCredentials  = "internal.verify_credentials"
+	msgEventStream        = "unavailable.event_stream"
+	msgUnsupportedVersion = "unsupported_app_version.action"
+	msgRemoteHostConflict = "remote_host_conflict.action"
+	msgPathPrefixConflict = "path_prefix_conflict.action"
+	msgCredentialFields   = "invalid_credentials.fields"
+	msgHostnameField      = "invalid_hostname.field"
+	msgEndpointField      = "invalid_endpoint.field"
+)
+
+// defaultLocale is the catalog every other locale falls back to.
+const defaultLocale = "en"
+
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// messages is the embedded catalog; a catalog that does not validate stops
+// the daemon at startup.
+var messages = mustLoadMessageCatalog(messageFiles)
+
+// strictMessages makes rendering an unknown key or a template without its
+// parameters panic instead of logging; tests turn it on.
+var strictMessages bool
+
+// msgParams are the named values a message template interpolates.
+type msgParams map[string]string
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// messageCatalog holds the templates of each locale by message key.
+type messageCatalog struct {
+	locales map[string]map[string]string
+}
+
+func mustLoadMessageCatalog(fsys fs.FS) *messageCatalog {
+	catalog, err := loadMessageCatalog(fsys)
+	if err != nil {
+		panic(fmt.Sprintf("error message catalog: %v", err))
+	}
+	return catalog
+}
+
+// loadMessageCatalog reads messages/<locale>.json and checks that every
+// error code has an English template, that every key names a known code,
+// and that translations use the same parameters as the English text.
+func loadMessageCatalog(fsys fs.FS) (*messageCatalog, error) {
+	names, err := fs.Glob(fsys, "messages/*.json")
+	if err != nil {
+		return nil, err
+	}
+	catalog := &messageCatalog{locales: make(map[string]map[string]string)}
+	for _, name := range names {
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		templates := make(map[string]string)
+		if err := json.Unmarshal(raw, &templates); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		catalog.locales[strings.TrimSuffix(path.Base(name), ".json")] = templates
+	}
+	base, ok := catalog.locales[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("no %s catalog", defaultLocale)
+	}
+	var problems []string
+	for code := range errorCatalog {
+		if base[code] == "" {
+			problems = append(problems, fmt.Sprintf("%s: no template for code %q", defaultLocale, code))
+		}
+	}
+	for locale, templates := range catalog.locales {
+		for key, text := range templates {
+			if !errorCatalog[messageCode(key)] {
+				problems = append(problems, fmt.Sprintf("%s: key %q names no error code", locale, key))
+				continue
+			}
+			if err := checkTemplate(text); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %v", locale, key, err))
+				continue
+			}
+			if locale == defaultLocale {
+				continue
+			}
+			want, ok := base[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: key %q has no %s template", locale, key, defaultLocale))
+			} else if strings.Join(placeholders(text), ",") != strings.Join(placeholders(want), ",") {
+				problems = append(problems, fmt.Sprintf("%s: %s uses %v, %s uses %v", locale, key, placeholders(text), defaultLocale, placeholders(want)))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return catalog, nil
+}
+
+// checkTemplate refuses empty templates and braces outside placeholders.
+func checkTemplate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("empty template")
+	}
+	if rest := placeholderPattern.ReplaceAllString(text, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("malformed placeholder in %q", text)
+	}
+	return nil
+}
+
+// placeholders returns the sorted parameter names text uses.
+func placeholders(text string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// messageCode returns the error code a message key belongs to.
+func messageCode(key string) string {
+	code, _, _ := strings.Cut(key, ".")
+	return code
+}
+
+// render returns the message for key in locale, falling back to English
+// when the locale has no translation, and the locale it used.
+func (mc *messageCatalog) render(locale, key string, params msgParams) (string, string, error) {
+	text, ok := mc.locales[locale][key]
+	if !ok {
+		locale = defaultLocale
+		if text, ok = mc.locales[locale][key]; !ok {
+			return "", "", fmt.Errorf("unknown message key %q", key)
+		}
+	}
+	var missing []string
+	out := placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		name := m[1 : len(m)-1]
+		v, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", "", fmt.Errorf("message %q: missing parameters %v", key, missing)
+	}
+	return out, locale, nil
+}
+
+// negotiateLocale picks the catalog locale that best matches an
+// Accept-Language header, by quality and then order.
+func (mc *messageCatalog) negotiateLocale(header string) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+			q = parsed
+		}
+		choices = append(choices, choice{tag: tag, q: q})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, ch := range choices {
+		if _, ok := mc.locales[ch.tag]; ok {
+			return ch.tag
+		}
+		primary, _, _ := strings.Cut(ch.tag, "-")
+		if _, ok := mc.locales[primary]; ok {
+			return primary
+		}
+	}
+	return defaultLocale
+}
+
+// writeGinMessage writes an error envelope whose message is rendered from
+// the catalog in the client's language.
+func writeGinMessage(c *gin.Context, statusCode int, key string, params msgParams) {
+	c.JSON(statusCode, newMessageEnvelope(c, key, params, nil))
+}
+
+// writeGinMessageDetails is writeGinMessage with structured details.
+func writeGinMessageDetails(c *gin.Context, statusCode int, key string, params msgParams, details any) {
+	c.JSON(statusCode, newMessageEnvelope(c, key, params, details))
+}
+
+// newMessageEnvelope builds the envelope for a catalog message; the code is
+// the key's error code.
+func newMessageEnvelope(c *gin.Context, key string, params msgParams, details any) errorEnvelope {
+	text, locale, err := messages.render(messages.negotiateLocale(c.GetHeader("Accept-Language")), key, params)
+	if err != nil {
+		if strictMessages {
+			panic(err)
+		}
+		log.Printf("ERROR: %v", err)
+		text, locale = key, defaultLocale
+	}
+	code := messageCode(key)
+	if !errorCatalog[code] {
+		code = errorCodeInternal
+	}
+	c.Header("Content-Language", locale)
+	env := newErrorEnvelope(c, code, text, details)
+	env.Error.MessageKey = key
+	if len(params) > 0 {
+		env.Error.Params = params
+	}
+	return env
+}
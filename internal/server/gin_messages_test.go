@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	// A message key without a template, or a template rendered without its
+	// parameters, fails the test that hit it instead of logging.
+	strictMessages = true
+}
+
+// TestMessageCatalog_CoversCodeReferences walks the package source: every
+// errorCode constant must be in errorCatalog and every msg constant, or
+// literal key handed to the catalog, must have an English template. The
+// handler files in catalogOnlyFiles may not write raw error text at all.
+func TestMessageCatalog_CoversCodeReferences(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("parse package: %v", err)
+	}
+	catalogOnlyFiles := map[string]bool{
+		"gin_app_handlers.go":    false,
+		"gin_auth_handlers.go":   false,
+		"gin_crypto_handlers.go": false,
+		"gin_remote_handlers.go": false,
+	}
+	rawWriters := map[string]bool{
+		"writeGinError":        true,
+		"writeGinErrorCode":    true,
+		"writeGinErrorDetails": true,
+		"newErrorEnvelope":     true,
+		"abortGinError":        true,
+	}
+	en := messages.locales[defaultLocale]
+	consts := 0
+	for _, pkg := range pkgs {
+		for path, file := range pkg.Files {
+			base := filepath.Base(path)
+			_, catalogOnly := catalogOnlyFiles[base]
+			if catalogOnly {
+				catalogOnlyFiles[base] = true
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.ValueSpec:
+					for i, name := range n.Names {
+						if i >= len(n.Values) {
+							continue
+						}
+						lit, ok := n.Values[i].(*ast.BasicLit)
+						if !ok || lit.Kind != token.STRING {
+							continue
+						}
+						value, _ := strconv.Unquote(lit.Value)
+						switch {
+						case strings.HasPrefix(name.Name, "errorCode"):
+							consts++
+							if !errorCatalog[value] {
+								t.Errorf("%s = %q is not in errorCatalog", name.Name, value)
+							}
+						case strings.HasPrefix(name.Name, "msg"):
+							consts++
+							if en[value] == "" {
+								t.Errorf("%s = %q has no %s template", name.Name, value, defaultLocale)
+							}
+						}
+					}
+				case *ast.CallExpr:
+					fn, ok := n.Fun.(*ast.Ident)
+					if ok && catalogOnly && rawWriters[fn.Name] {
+						t.Errorf("%s: %s writes raw error text; use a catalog key", fset.Position(n.Pos()), fn.Name)
+					}
+					if !ok || (fn.Name != "writeGinMessage" && fn.Name != "writeGinMessageDetails" && fn.Name != "newMessageEnvelope") {
+						return true
+					}
+					keyArg := 2
+					if fn.Name == "newMessageEnvelope" {
+						keyArg = 1
+					}
+					if len(n.Args) <= keyArg {
+						return true
+					}
+					if lit, ok := n.Args[keyArg].(*ast.BasicLit); ok {
+						value, _ := strconv.Unquote(lit.Value)
+						if en[value] == "" {
+							t.Errorf("%s: message key %q has no %s template", fset.Position(lit.Pos()), value, defaultLocale)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	if consts == 0 {
+		t.Fatalf("found no error code or message constants")
+	}
+	for name, seen := range catalogOnlyFiles {
+		if !seen {
+			t.Errorf("catalog-only handler file %s not found", name)
+		}
+	}
+}
+
+func TestMessageCatalog_Render(t *testing.T) {
+	got, locale, err := messages.render("en", msgLockedAction, msgParams{"action": "stop app"})
+	if err != nil || locale != "en" || got != "Unable to stop app while storage is locked. Unlock Piccolo to continue." {
+		t.Fatalf("render: %q %q %v", got, locale, err)
+	}
+	got, locale, err = messages.render("de", msgAppNotFound, msgParams{"app": "blog"})
+	if err != nil || locale != "de" || got != "App nicht gefunden: blog" {
+		t.Fatalf("render de: %q %q %v", got, locale, err)
+	}
+	// A key without a translation falls back to English.
+	got, locale, err = messages.render("de", msgResetFields, nil)
+	if err != nil || locale != "en" || got != "recovery_key and new_password required" {
+		t.Fatalf("fallback: %q %q %v", got, locale, err)
+	}
+	if _, _, err := messages.render("en", msgAppNotFound, nil); err == nil || !strings.Contains(err.Error(), "app") {
+		t.Fatalf("expected missing parameter error, got %v", err)
+	}
+	if _, _, err := messages.render("en", "not_found.nothing", nil); err == nil {
+		t.Fatalf("expected unknown key error")
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected an unknown key to panic in tests")
+		}
+	}()
+	newMessageEnvelope(c, "not_found.nothing", nil, nil)
+}
+
+func TestMessageCatalog_NegotiatesLocale(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                           "en",
+		"de":                         "de",
+		"de-AT,de;q=0.9,en;q=0.8":    "de",
+		"fr-CH, fr;q=0.9, en;q=0.8":  "en",
+		"fr":                         "en",
+		"en;q=0.5, de;q=0.9":         "de",
+		"de;q=0, en":                 "en",
+		"*;q=0.5, DE-de;q=0.7, xx-y": "de",
+	} {
+		if got := messages.negotiateLocale(header); got != want {
+			t.Errorf("Accept-Language %q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestMessageCatalog_RejectsBadCatalogs(t *testing.T) {
+	full := make(map[string]string)
+	for code := range errorCatalog {
+		full[code] = "text"
+	}
+	encode := func(m map[string]string) *fstest.MapFile {
+		raw, _ := json.Marshal(m)
+		return &fstest.MapFile{Data: raw}
+	}
+	with := func(extra map[string]string) map[string]string {
+		out := make(map[string]string, len(full)+len(extra))
+		for k, v := range full {
+			out[k] = v
+		}
+		for k, v := range extra {
+			out[k] = v
+		}
+		return out
+	}
+	if _, err := loadMessageCatalog(fstest.MapFS{"messages/en.json": encode(full)}); err != nil {
+		t.Fatalf("minimal catalog refused: %v", err)
+	}
+	missing := with(nil)
+	delete(missing, errorCodeLocked)
+	for name, fsys := range map[string]fstest.MapFS{
+		"no english":        {"messages/de.json": encode(full)},
+		"missing code":      {"messages/en.json": encode(missing)},
+		"unknown code":      {"messages/en.json": encode(with(map[string]string{"nope.thing": "x"}))},
+		"malformed":         {"messages/en.json": encode(with(map[string]string{"conflict.x": "Unable to {Action}"}))},
+		"empty":             {"messages/en.json": encode(with(map[string]string{"conflict.x": " "}))},
+		"parameter differs": {"messages/en.json": encode(with(map[string]string{"conflict.x": "{app} busy"})), "messages/de.json": encode(map[string]string{"conflict.x": "{name} belegt"})},
+		"untranslatable":    {"messages/en.json": encode(full), "messages/de.json": encode(map[string]string{"conflict.x": "neu"})},
+	} {
+		if _, err := loadMessageCatalog(fsys); err == nil {
+			t.Errorf("%s: catalog accepted", name)
+		}
+	}
+}
+
+func TestMessageCatalog_ResponsesCarryKeyAndParams(t *testing.T) {
+	srv := createGinTestServer(t, newErrorTestDir(t))
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	for lang, want := range map[string]string{"de-DE,de;q=0.9": "App nicht gefunden: ghost", "fr": "App not found: ghost"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/apps/ghost", nil)
+		req.Header.Set("Accept-Language", lang)
+		attachAuth(req, cookie, csrf)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		apiErr := checkErrorEnvelope(t, lang, w, http.StatusNotFound, errorCodeNotFound)
+		if apiErr.Message != want || apiErr.MessageKey != msgAppNotFound || apiErr.Params["app"] != "ghost" {
+			t.Fatalf("%s: unexpected error %+v", lang, apiErr)
+		}
+		if got, wantLang := w.Header().Get("Content-Language"), messages.negotiateLocale(lang); got != wantLang {
+			t.Fatalf("%s: Content-Language %q, want %q", lang, got, wantLang)
+		}
+	}
+}
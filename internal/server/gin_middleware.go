@@ -1,60 +1,156 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/cluster"
+	"piccolod/internal/network"
 )
 
-// corsMiddleware adds CORS headers for web UI access
+// corsMiddleware answers cross-origin requests according to the active
+// CORS policy. It runs ahead of the session checks, so preflights need no
+// cookie.
 func (s *GinServer) corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Strict same-origin CORS policy with credentials allowed only for same-origin
+		policy, patterns, _ := s.currentCORS()
 		origin := c.GetHeader("Origin")
-		reqHost := c.Request.Host // may include :port
-		allow := false
-		if origin != "" {
-			// Compare origin host to request host
-			// Origin format: scheme://host[:port]
-			// Cheap parse: strip scheme and compare host:port suffix
-			// Note: in reverse proxy deployments, host should be preserved for same-origin.
-			if strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://") {
-				o := origin
-				if i := strings.Index(o, "://"); i >= 0 {
-					o = o[i+3:]
-				}
-				// o now 'host[:port]'
-				if o == reqHost {
-					allow = true
-				}
-			}
-		}
+		allow := origin != "" && s.originAllowed(c.Request, origin, policy, patterns)
 		if allow {
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Vary", "Origin")
-			c.Header("Access-Control-Allow-Credentials", "true")
+			if policy.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
 		}
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Requested-With, X-CSRF-Token")
 
 		// Handle preflight requests
 		if c.Request.Method == "OPTIONS" {
 			if allow {
 				c.AbortWithStatus(http.StatusOK)
 			} else {
-				// Not same-origin: deny preflight
-				c.AbortWithStatus(http.StatusForbidden)
+				abortGinError(c, http.StatusForbidden, "origin not allowed")
 			}
 			return
 		}
+		c.Next()
+	}
+}
 
+// Gin context keys set by clientContextMiddleware.
+const (
+	ctxClientIPKey = "piccolo.client_ip"
+	ctxSecureKey   = "piccolo.secure"
+)
+
+// clientContextMiddleware resolves the client address and whether the request
+// arrived over TLS once per request, honouring forwarded headers only when the
+// immediate peer is a trusted proxy.
+func (s *GinServer) clientContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxClientIPKey, s.clientIP(c.Request))
+		c.Set(ctxSecureKey, s.isSecureRequest(c.Request))
 		c.Next()
 	}
 }
 
+// clientIP returns the originating client of r. The TLS mux and the Nexus
+// adapter relay raw client bytes over loopback, so headers on a loopback
+// connection are the client's own: its address comes from the connection
+// hint the relay registered, or is the loopback peer itself.
+func (s *GinServer) clientIP(r *http.Request) string {
+	if peer, loopback := loopbackPeer(r); loopback {
+		if ip, _, ok := s.relayHint(r); ok && ip != "" {
+			return ip
+		}
+		return peer
+	}
+	var trusted *network.TrustedProxies
+	if s != nil {
+		trusted = s.trustedProxies
+	}
+	return trusted.ClientIP(r)
+}
+
+// loopbackPeer returns the immediate peer of r and whether it is loopback.
+func loopbackPeer(r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return host, ip != nil && ip.IsLoopback()
+}
+
+// relayedConn is a portal connection accepted from loopback. Its hint is
+// looked up on the first request rather than on accept: the relay registers
+// it after dialing, but always before sending the client's bytes.
+type relayedConn struct {
+	listenerPort int
+	sourcePort   int
+
+	once     sync.Once
+	clientIP string
+	isTLS    bool
+	ok       bool
+}
+
+type relayedConnKey struct{}
+
+// portalConnContext marks loopback connections to the portal so requests on
+// them can be matched to the hint of the relay that opened them.
+func (s *GinServer) portalConnContext(ctx context.Context, c net.Conn) context.Context {
+	local, ok := c.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return ctx
+	}
+	peer, ok := c.RemoteAddr().(*net.TCPAddr)
+	if !ok || !peer.IP.IsLoopback() {
+		return ctx
+	}
+	return context.WithValue(ctx, relayedConnKey{}, &relayedConn{listenerPort: local.Port, sourcePort: peer.Port})
+}
+
+// relayHint reports the client address and TLS state a relay registered for
+// the connection r arrived on.
+func (s *GinServer) relayHint(r *http.Request) (clientIP string, isTLS bool, ok bool) {
+	rc, _ := r.Context().Value(relayedConnKey{}).(*relayedConn)
+	if rc == nil || s == nil || s.serviceManager == nil {
+		return "", false, false
+	}
+	rc.once.Do(func() {
+		rc.clientIP, rc.isTLS, rc.ok = s.serviceManager.ConsumeProxyHint(rc.listenerPort, rc.sourcePort)
+	})
+	return rc.clientIP, rc.isTLS, rc.ok
+}
+
+// requestClientIP returns the client address resolved by clientContextMiddleware.
+func requestClientIP(c *gin.Context) string {
+	if ip := c.GetString(ctxClientIPKey); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
+
+// requestSecure reports whether the request arrived over TLS, directly or via
+// a trusted proxy.
+func (s *GinServer) requestSecure(c *gin.Context) bool {
+	if v, ok := c.Get(ctxSecureKey); ok {
+		secure, _ := v.(bool)
+		return secure
+	}
+	return s.isSecureRequest(c.Request)
+}
+
 // securityHeadersMiddleware adds security headers
 func (s *GinServer) securityHeadersMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -63,10 +159,10 @@ func (s *GinServer) securityHeadersMiddleware() gin.HandlerFunc {
 		c.Header("X-Frame-Options", "DENY")
 		c.Header("X-XSS-Protection", "1; mode=block")
 		host := canonicalHost(c.Request.Host)
-		if host == "" {
-			host = canonicalHost(c.GetHeader("X-Forwarded-Host"))
+		if _, loopback := loopbackPeer(c.Request); host == "" && s != nil && !loopback {
+			host = canonicalHost(s.trustedProxies.ForwardedHost(c.Request))
 		}
-		if s != nil && s.isSecureRequest(c.Request) && host != "localhost" && host != "127.0.0.1" {
+		if s != nil && s.requestSecure(c) && host != "localhost" && host != "127.0.0.1" {
 			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 		}
 		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
@@ -135,7 +231,7 @@ func (s *GinServer) requestLoggingMiddleware() gin.HandlerFunc {
 func (s *GinServer) requireUnlocked() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if s != nil && s.cryptoManager != nil && s.cryptoManager.IsInitialized() && s.cryptoManager.IsLocked() {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			writeGinErrorCode(c, http.StatusLocked, errorCodeLocked, "storage locked; unlock Piccolo to continue")
 			c.Abort()
 			return
 		}
@@ -143,17 +239,53 @@ func (s *GinServer) requireUnlocked() gin.HandlerFunc {
 	}
 }
 
-// requireSession ensures a valid session cookie is present and not expired
+// requireKernelLeader rejects requests on nodes that do not lead the kernel
+// resource; host-level operations must only run on the leader.
+func (s *GinServer) requireKernelLeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s != nil && s.leadership != nil && s.leadership.Current(cluster.ResourceKernel) != cluster.RoleLeader {
+			writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireSession ensures a valid session cookie is present and not expired.
+// Each request renews the idle timeout except event streams, which stay open
+// without the user doing anything. An Authorization: Bearer API token is
+// accepted instead of the cookie.
 func (s *GinServer) requireSession() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if cliAuthenticated(c) {
+			c.Next()
+			return
+		}
+		if secret, ok := bearerToken(c.Request); ok {
+			if !s.authenticateAPIToken(c, secret) {
+				c.Abort()
+				return
+			}
+			c.Next()
+			tok, _ := apiTokenFromContext(c)
+			s.recordAPITokenRequest(c, tok)
+			return
+		}
 		id, ok := s.getSession(c)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			writeGinError(c, http.StatusUnauthorized, "Unauthorized")
 			c.Abort()
 			return
 		}
-		if _, ok := s.sessions.Get(id); !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		var err error
+		if isEventStream(c) {
+			_, err = s.sessions.Lookup(id)
+		} else {
+			_, err = s.sessions.Touch(id)
+		}
+		if err != nil {
+			s.writeSessionError(c, err)
 			c.Abort()
 			return
 		}
@@ -170,24 +302,40 @@ func (s *GinServer) csrfMiddleware() gin.HandlerFunc {
 			c.Next()
 			return
 		}
-		id, ok := s.getSession(c)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-		sess, ok := s.sessions.Get(id)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-		token := c.GetHeader("X-CSRF-Token")
-		if token == "" || token != sess.CSRF {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-			c.Abort()
-			return
-		}
+		s.enforceCSRF(c)
+	}
+}
+
+// requireCSRFToken enforces X-CSRF-Token regardless of method, for GET
+// endpoints that hand out sensitive downloads.
+func (s *GinServer) requireCSRFToken() gin.HandlerFunc {
+	return s.enforceCSRF
+}
+
+func (s *GinServer) enforceCSRF(c *gin.Context) {
+	// The CLI and API tokens are sent explicitly, so they cannot be forged
+	// cross-site.
+	if _, ok := apiTokenFromContext(c); ok || cliAuthenticated(c) {
 		c.Next()
+		return
+	}
+	id, ok := s.getSession(c)
+	if !ok {
+		writeGinError(c, http.StatusUnauthorized, "Unauthorized")
+		c.Abort()
+		return
+	}
+	sess, ok := s.sessions.Get(id)
+	if !ok {
+		writeGinError(c, http.StatusUnauthorized, "Unauthorized")
+		c.Abort()
+		return
+	}
+	token := c.GetHeader("X-CSRF-Token")
+	if token == "" || token != sess.CSRF {
+		writeGinError(c, http.StatusForbidden, "Forbidden")
+		c.Abort()
+		return
 	}
+	c.Next()
 }
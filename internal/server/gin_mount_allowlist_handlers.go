@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/persistence"
+)
+
+// mountAllowlistPayload is the GET/PUT /system/mount-allowlist document.
+type mountAllowlistPayload struct {
+	Paths []string `json:"paths"`
+}
+
+// mountAllowlistRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set mountAllowlists directly).
+func (s *GinServer) mountAllowlistRepo() persistence.MountAllowlistRepo {
+	if s.mountAllowlists != nil {
+		return s.mountAllowlists
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().MountAllowlist()
+}
+
+// reloadMountAllowlist hands the stored allowlist to the app manager once the
+// control store is readable. Until then no host mount is allowed.
+func (s *GinServer) reloadMountAllowlist() error {
+	repo := s.mountAllowlistRepo()
+	if repo == nil || s.appManager == nil {
+		return nil
+	}
+	stored, err := repo.CurrentAllowlist(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	s.appManager.SetHostMountAllowlist(stored.Paths)
+	return nil
+}
+
+func (s *GinServer) mountAllowlistResponse() mountAllowlistPayload {
+	paths := []string{}
+	if s.appManager != nil {
+		paths = append(paths, s.appManager.HostMountAllowlist()...)
+	}
+	return mountAllowlistPayload{Paths: paths}
+}
+
+// handleSystemMountAllowlistGet: GET /api/v1/system/mount-allowlist
+func (s *GinServer) handleSystemMountAllowlistGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.mountAllowlistResponse())
+}
+
+// handleSystemMountAllowlistUpdate: PUT /api/v1/system/mount-allowlist
+func (s *GinServer) handleSystemMountAllowlistUpdate(c *gin.Context) {
+	if s.appManager == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "app manager unavailable")
+		return
+	}
+	var req mountAllowlistPayload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	paths, err := s.appManager.NormalizeHostMountAllowlist(req.Paths)
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	repo := s.mountAllowlistRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "mount allowlist storage unavailable")
+		return
+	}
+	err = repo.SaveAllowlist(c.Request.Context(), persistence.MountAllowlist{Paths: paths, UpdatedAt: time.Now().UTC()})
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.appManager.SetHostMountAllowlist(paths)
+
+	msg := "Apps may no longer mount host directories"
+	if len(paths) > 0 {
+		msg = "Apps may mount host directories under " + strings.Join(paths, ", ")
+	}
+	s.recordActivity(c, "system", activity.LevelInfo, msg)
+	c.JSON(http.StatusOK, s.mountAllowlistResponse())
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"piccolod/internal/persistence"
+)
+
+type memoryMountAllowlistRepo struct {
+	mu    sync.Mutex
+	saved *persistence.MountAllowlist
+}
+
+func (r *memoryMountAllowlistRepo) CurrentAllowlist(ctx context.Context) (persistence.MountAllowlist, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.MountAllowlist{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryMountAllowlistRepo) SaveAllowlist(ctx context.Context, allowlist persistence.MountAllowlist) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &allowlist
+	return nil
+}
+
+func TestSystemMountAllowlist_UpdateAndReload(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryMountAllowlistRepo{}
+	srv.mountAllowlists = repo
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/system/mount-allowlist", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	for _, body := range []string{`{"paths":["/etc"]}`, `{"paths":["media"]}`, `{"paths":["/"]}`} {
+		if w := put(body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d body=%s", body, w.Code, w.Body.String())
+		}
+	}
+	if repo.saved != nil {
+		t.Fatalf("refused allowlist was persisted: %+v", repo.saved)
+	}
+
+	media := t.TempDir()
+	w := put(`{"paths":["` + media + `/","` + media + `"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp mountAllowlistPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Paths) != 1 || resp.Paths[0] != media {
+		t.Fatalf("unexpected response %s (%v)", w.Body.String(), err)
+	}
+	if repo.saved == nil || len(repo.saved.Paths) != 1 || len(srv.appManager.HostMountAllowlist()) != 1 {
+		t.Fatalf("allowlist not persisted and applied: %+v", repo.saved)
+	}
+
+	// The stored allowlist is adopted when the control store unlocks.
+	srv.appManager.SetHostMountAllowlist(nil)
+	if err := srv.reloadMountAllowlist(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/system/mount-allowlist", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), media) {
+		t.Fatalf("get after reload: %d body=%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/network"
+	"piccolod/internal/persistence"
+)
+
+// errorCodeLockoutRisk marks a network change refused because it would cut
+// off the only confirmed way back into the portal.
+const errorCodeLockoutRisk = "lockout_risk"
+
+// Where the active listen settings came from.
+const (
+	listenSourceDefault = "default"
+	listenSourceEnv     = "env"
+	listenSourceStored  = "stored"
+)
+
+// networkSettingsPayload is the GET/PUT /system/network response.
+type networkSettingsPayload struct {
+	Settings        network.ListenSettings `json:"settings"`
+	Source          string                 `json:"source"`
+	Listeners       []network.Listener     `json:"listeners"`
+	RemoteConfirmed bool                   `json:"remote_confirmed"`
+}
+
+// listenPortFromEnv is the admin port, PORT or 80.
+func listenPortFromEnv() string {
+	if p := strings.TrimSpace(os.Getenv("PORT")); p != "" {
+		return p
+	}
+	return "80"
+}
+
+// initListenSettings takes the boot-time settings from the environment. A
+// bad value falls back to all interfaces rather than keeping the daemon off
+// the network.
+func (s *GinServer) initListenSettings() {
+	s.listenPort = listenPortFromEnv()
+	s.acmePort = network.ACMEHTTPPortFromEnv()
+	settings, err := network.ListenSettingsFromEnv()
+	if err != nil {
+		log.Printf("WARN: ignoring listen settings: %v", err)
+		settings = network.ListenSettings{BindAddresses: []string{}}
+	}
+	s.listenSettings = settings
+	s.listenSource = listenSourceDefault
+	if len(settings.BindAddresses) > 0 || settings.DisablePlainHTTP {
+		s.listenSource = listenSourceEnv
+	}
+}
+
+// networkSettingsRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set networkSettings directly).
+func (s *GinServer) networkSettingsRepo() persistence.NetworkSettingsRepo {
+	if s.networkSettings != nil {
+		return s.networkSettings
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().NetworkSettings()
+}
+
+// reloadNetworkSettings adopts the stored settings once the control store
+// is readable; they take precedence over the environment.
+func (s *GinServer) reloadNetworkSettings() error {
+	repo := s.networkSettingsRepo()
+	if repo == nil {
+		return nil
+	}
+	stored, err := repo.CurrentSettings(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	settings, err := network.ListenSettings{
+		BindAddresses:    stored.BindAddresses,
+		DisablePlainHTTP: stored.DisablePlainHTTP,
+	}.Normalize()
+	if err != nil {
+		return fmt.Errorf("stored network settings: %w", err)
+	}
+	s.networkMu.Lock()
+	defer s.networkMu.Unlock()
+	previous, previousSource := s.listenSettings, s.listenSource
+	s.listenSettings, s.listenSource = settings, listenSourceStored
+	if err := s.applyListenSettingsLocked(); err != nil {
+		s.listenSettings, s.listenSource = previous, previousSource
+		return err
+	}
+	return nil
+}
+
+// acmeHTTP01Active reports whether remote issuance answers HTTP-01
+// challenges, which need port 80 reachable even without plain HTTP.
+func (s *GinServer) acmeHTTP01Active() bool {
+	if s.remoteManager == nil {
+		return false
+	}
+	st := s.remoteManager.Status()
+	return st.Enabled && st.Solver == "http-01"
+}
+
+// httpsRedirectHost picks where a plain HTTP request for host arriving on
+// the ACME port is sent: the alias target, the host itself when it is one
+// of the remote names, otherwise the portal.
+func (s *GinServer) httpsRedirectHost(host string) string {
+	if s.remoteResolver != nil && host != "" {
+		if target := s.remoteResolver.RedirectTarget(host); target != "" {
+			return target
+		}
+		if s.remoteResolver.IsRemoteHostname(host) {
+			return host
+		}
+	}
+	if s.remoteManager == nil {
+		return ""
+	}
+	return s.remoteManager.Status().PortalHostname
+}
+
+// applyListenSettingsLocked rebinds the admin listeners to the current
+// settings. It is a no-op until Start has created the listener set.
+// Callers hold networkMu.
+func (s *GinServer) applyListenSettingsLocked() error {
+	if s.listeners == nil {
+		return nil
+	}
+	plan, err := s.listenSettings.Plan(s.listenPort, s.acmePort, s.acmeHTTP01Active())
+	if err != nil {
+		return err
+	}
+	err = s.listeners.Apply(plan)
+	s.acmeListenErr = nil
+	if err == nil {
+		return nil
+	}
+	// Something else may own the ACME port; the admin listeners must not
+	// depend on it. Preflight reports the failure instead.
+	var admin []network.Listener
+	for _, l := range plan {
+		if !l.Redirect {
+			admin = append(admin, l)
+		}
+	}
+	if len(admin) == len(plan) {
+		return err
+	}
+	if aerr := s.listeners.Apply(admin); aerr != nil {
+		return aerr
+	}
+	log.Printf("WARN: HTTP-01 listener unavailable: %v", err)
+	s.acmeListenErr = err
+	return nil
+}
+
+// acmeListenerCheck reports whether HTTP-01 challenges can be answered on
+// the ACME port; remote preflight shows it as a check.
+func (s *GinServer) acmeListenerCheck() error {
+	s.networkMu.Lock()
+	defer s.networkMu.Unlock()
+	if s.acmeListenErr != nil {
+		return fmt.Errorf("cannot bind port %s for HTTP-01 challenges: %w", s.acmePort, s.acmeListenErr)
+	}
+	if s.listeners == nil || s.acmePort == s.listenPort || s.acmeHTTP01Active() {
+		return nil
+	}
+	// Preflight runs before remote is enabled, while nothing holds the ACME
+	// port yet; make sure it could be bound.
+	ln, err := net.Listen("tcp", ":"+s.acmePort)
+	if err != nil {
+		return fmt.Errorf("cannot bind port %s for HTTP-01 challenges: %w", s.acmePort, err)
+	}
+	return ln.Close()
+}
+
+// refreshListeners re-plans after a remote change that may add or drop the
+// ACME-only listener.
+func (s *GinServer) refreshListeners() {
+	s.networkMu.Lock()
+	defer s.networkMu.Unlock()
+	if err := s.applyListenSettingsLocked(); err != nil {
+		log.Printf("WARN: listener refresh failed: %v", err)
+	}
+}
+
+// remoteAccessConfirmed reports whether the portal is known to be reachable
+// other than over the local plaintext listener: the request itself came in
+// through a remote hostname, or remote access is active and its endpoint
+// answered the last preflight.
+func (s *GinServer) remoteAccessConfirmed(c *gin.Context) bool {
+	if s.remoteResolver != nil && s.remoteResolver.IsRemoteHostname(canonicalHost(c.Request.Host)) {
+		return true
+	}
+	if s.remoteManager == nil {
+		return false
+	}
+	st := s.remoteManager.Status()
+	return st.Enabled && st.State == "active" && st.LastHandshake != nil
+}
+
+// requestLocalIP is the local address the request arrived on.
+func requestLocalIP(r *http.Request) net.IP {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+func (s *GinServer) networkPayload(c *gin.Context) networkSettingsPayload {
+	s.networkMu.Lock()
+	payload := networkSettingsPayload{
+		Settings:  s.listenSettings,
+		Source:    s.listenSource,
+		Listeners: []network.Listener{},
+	}
+	s.networkMu.Unlock()
+	if s.listeners != nil {
+		payload.Listeners = s.listeners.Addrs()
+	}
+	payload.RemoteConfirmed = s.remoteAccessConfirmed(c)
+	return payload
+}
+
+// handleSystemNetworkGet: GET /api/v1/system/network
+func (s *GinServer) handleSystemNetworkGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.networkPayload(c))
+}
+
+// handleSystemNetworkUpdate: PUT /api/v1/system/network
+func (s *GinServer) handleSystemNetworkUpdate(c *gin.Context) {
+	var req network.ListenSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	next, err := req.Normalize()
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	loopbackOnly, err := next.LoopbackOnly()
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	servesCaller, err := next.Serves(requestLocalIP(c.Request))
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (loopbackOnly || !servesCaller) && !s.remoteAccessConfirmed(c) {
+		writeGinErrorCode(c, http.StatusConflict, errorCodeLockoutRisk, "change would lock you out; confirm remote access works before limiting the local listener")
+		return
+	}
+	repo := s.networkSettingsRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "network settings storage unavailable")
+		return
+	}
+
+	s.networkMu.Lock()
+	previous, previousSource := s.listenSettings, s.listenSource
+	s.listenSettings, s.listenSource = next, listenSourceStored
+	if err := s.applyListenSettingsLocked(); err != nil {
+		s.listenSettings, s.listenSource = previous, previousSource
+		s.networkMu.Unlock()
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = repo.SaveSettings(c.Request.Context(), persistence.NetworkSettings{
+		BindAddresses:    next.BindAddresses,
+		DisablePlainHTTP: next.DisablePlainHTTP,
+		UpdatedAt:        time.Now().UTC(),
+	})
+	if err != nil {
+		s.listenSettings, s.listenSource = previous, previousSource
+		if rerr := s.applyListenSettingsLocked(); rerr != nil {
+			log.Printf("WARN: restoring listeners after failed save: %v", rerr)
+		}
+	}
+	s.networkMu.Unlock()
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	bind := "all interfaces"
+	if len(next.BindAddresses) > 0 {
+		bind = strings.Join(next.BindAddresses, ", ")
+	}
+	msg := "Admin listener bound to " + bind
+	if next.DisablePlainHTTP {
+		msg = "Plain HTTP disabled; admin listener on loopback only"
+	}
+	s.recordActivity(c, "system", activity.LevelInfo, msg)
+	c.JSON(http.StatusOK, s.networkPayload(c))
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/network"
+	"piccolod/internal/persistence"
+	"piccolod/internal/remote"
+)
+
+type memoryNetworkSettingsRepo struct {
+	mu    sync.Mutex
+	saved *persistence.NetworkSettings
+}
+
+func (r *memoryNetworkSettingsRepo) CurrentSettings(ctx context.Context) (persistence.NetworkSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.NetworkSettings{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryNetworkSettingsRepo) SaveSettings(ctx context.Context, s persistence.NetworkSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &s
+	return nil
+}
+
+func freeLoopbackPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func getBody(addr string) (string, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://" + addr + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// doNetworkRequest sends an authenticated request as if it arrived on the
+// local address localIP.
+func doNetworkRequest(srv *GinServer, cookie *http.Cookie, csrf, method, body, localIP string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, "/api/v1/system/network", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	attachAuth(req, cookie, csrf)
+	local := &net.TCPAddr{IP: net.ParseIP(localIP), Port: 80}
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHTTPListenerSetRebindsWithoutRestart(t *testing.T) {
+	port := freeLoopbackPort(t)
+	ls := newHTTPListenerSet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "portal")
+	}), http.NotFoundHandler())
+	defer ls.Close()
+
+	first := net.JoinHostPort("127.0.0.1", port)
+	second := net.JoinHostPort("127.0.0.2", port)
+	if err := ls.Apply([]network.Listener{{Addr: first}}); err != nil {
+		t.Fatalf("apply first: %v", err)
+	}
+	if body, err := getBody(first); err != nil || body != "portal" {
+		t.Fatalf("first listener: %q %v", body, err)
+	}
+	if err := ls.Apply([]network.Listener{{Addr: second}}); err != nil {
+		t.Fatalf("apply second: %v", err)
+	}
+	if body, err := getBody(second); err != nil || body != "portal" {
+		t.Fatalf("second listener: %q %v", body, err)
+	}
+	if _, err := getBody(first); err == nil {
+		t.Fatalf("dropped listener still accepting")
+	}
+	if got := ls.Addrs(); len(got) != 1 || got[0].Addr != second {
+		t.Fatalf("Addrs = %+v", got)
+	}
+
+	// A plan that cannot be bound leaves the current listener in place.
+	blocker, err := net.Listen("tcp", "127.0.0.3:0")
+	if err != nil {
+		t.Fatalf("blocker: %v", err)
+	}
+	defer blocker.Close()
+	if err := ls.Apply([]network.Listener{{Addr: blocker.Addr().String()}}); err == nil {
+		t.Fatalf("expected bind failure")
+	}
+	if body, err := getBody(second); err != nil || body != "portal" {
+		t.Fatalf("listener not restored after failed rebind: %q %v", body, err)
+	}
+}
+
+func TestHTTPListenerSetACMEOnly(t *testing.T) {
+	port := freeLoopbackPort(t)
+	challenges := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "key-auth")
+	})
+	ls := newHTTPListenerSet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "portal")
+	}), acmeOnlyHandler(challenges))
+	defer ls.Close()
+	addr := net.JoinHostPort("127.0.0.1", port)
+	if err := ls.Apply([]network.Listener{{Addr: addr, ACMEOnly: true}}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	resp, err := http.Get("http://" + addr + "/.well-known/acme-challenge/token")
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "key-auth" {
+		t.Fatalf("challenge body = %q", body)
+	}
+	resp, err = http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("portal: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("ACME-only listener served the portal: %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPListenerSetACMERedirect(t *testing.T) {
+	challenges := remote.NewChallengeManager()
+	challenges.Put("tok-123", "tok-123.key-auth")
+	ls := newHTTPListenerSet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "portal")
+	}), http.NotFoundHandler()).withRedirect(acmeRedirectHandler(challenges.Handler(), func(host string) string {
+		if host == "blog.example.com" {
+			return host
+		}
+		return "portal.example.com"
+	}))
+	defer ls.Close()
+	admin := net.JoinHostPort("127.0.0.1", freeLoopbackPort(t))
+	acme := net.JoinHostPort("127.0.0.1", freeLoopbackPort(t))
+	if err := ls.Apply([]network.Listener{{Addr: admin}, {Addr: acme, ACMEOnly: true, Redirect: true}}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	client := &http.Client{
+		Timeout:       2 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get("http://" + acme + "/.well-known/acme-challenge/tok-123")
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "tok-123.key-auth" {
+		t.Fatalf("challenge: %d %q", resp.StatusCode, body)
+	}
+	if body, err := getBody(admin); err != nil || body != "portal" {
+		t.Fatalf("admin listener: %q %v", body, err)
+	}
+
+	for host, want := range map[string]string{
+		"":                 "https://portal.example.com/apps?tab=1",
+		"blog.example.com": "https://blog.example.com/apps?tab=1",
+		"10.0.0.5":         "https://portal.example.com/apps?tab=1",
+	} {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+acme+"/apps?tab=1", nil)
+		if host != "" {
+			req.Host = host
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("redirect for %q: %v", host, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != want {
+			t.Fatalf("redirect for %q: %d Location=%q", host, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+}
+
+func TestSystemNetwork_ACMEListenerFallsBackWhenPortTaken(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "network-acme")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	defer srv.tlsMux.Stop()
+	if err := srv.remoteManager.Configure(remote.ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("configure remote: %v", err)
+	}
+	blocker, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("blocker: %v", err)
+	}
+	defer blocker.Close()
+	srv.listenPort = freeLoopbackPort(t)
+	srv.acmePort = fmt.Sprint(blocker.Addr().(*net.TCPAddr).Port)
+	srv.listenSettings = network.ListenSettings{}
+	srv.listeners = newHTTPListenerSet(srv.router, http.NotFoundHandler())
+	defer srv.listeners.Close()
+
+	srv.networkMu.Lock()
+	err = srv.applyListenSettingsLocked()
+	srv.networkMu.Unlock()
+	if err != nil {
+		t.Fatalf("admin listeners must not depend on the ACME port: %v", err)
+	}
+	if got := srv.listeners.Addrs(); len(got) != 1 || got[0].ACMEOnly {
+		t.Fatalf("listeners = %+v", got)
+	}
+	if err := srv.acmeListenerCheck(); err == nil || !strings.Contains(err.Error(), "cannot bind port "+srv.acmePort) {
+		t.Fatalf("listener check = %v", err)
+	}
+	res, err := srv.remoteManager.RunPreflight(context.Background())
+	if err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	var check *remote.PreflightCheck
+	for i := range res.Checks {
+		if res.Checks[i].Name == "HTTP-01 listener" {
+			check = &res.Checks[i]
+		}
+	}
+	if check == nil || check.Status != "fail" || check.NextStep == "" {
+		t.Fatalf("preflight check = %+v", check)
+	}
+
+	blocker.Close()
+	srv.networkMu.Lock()
+	err = srv.applyListenSettingsLocked()
+	srv.networkMu.Unlock()
+	if err != nil {
+		t.Fatalf("reapply: %v", err)
+	}
+	got := srv.listeners.Addrs()
+	redirects := 0
+	for _, l := range got {
+		if l.Redirect && l.Addr == ":"+srv.acmePort {
+			redirects++
+		}
+	}
+	if len(got) != 2 || redirects != 1 {
+		t.Fatalf("listeners after freeing the port = %+v", got)
+	}
+	if err := srv.acmeListenerCheck(); err != nil {
+		t.Fatalf("listener check after freeing the port: %v", err)
+	}
+}
+
+func TestSystemNetwork_LockoutGuard(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "network-guard")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryNetworkSettingsRepo{}
+	srv.networkSettings = repo
+
+	cases := []struct {
+		name, body, localIP string
+	}{
+		{"loopback only", `{"bind_addresses":["127.0.0.1"]}`, "127.0.0.1"},
+		{"plain http disabled", `{"disable_plain_http":true}`, "192.168.1.10"},
+		{"drops the caller's address", `{"bind_addresses":["10.9.9.9"]}`, "192.168.1.10"},
+	}
+	for _, tc := range cases {
+		w := doNetworkRequest(srv, cookie, csrf, http.MethodPut, tc.body, tc.localIP)
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), errorCodeLockoutRisk) {
+			t.Fatalf("%s: expected lockout refusal, got %d body=%s", tc.name, w.Code, w.Body.String())
+		}
+	}
+	if repo.saved != nil {
+		t.Fatalf("refused change was persisted: %+v", repo.saved)
+	}
+
+	w := doNetworkRequest(srv, cookie, csrf, http.MethodPut, `{"bind_addresses":["no-such-iface0"]}`, "192.168.1.10")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown interface: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestSystemNetwork_UpdateRebindsListeners(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "network-rebind")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryNetworkSettingsRepo{}
+	srv.networkSettings = repo
+	srv.listenPort = freeLoopbackPort(t)
+	srv.listenSettings = network.ListenSettings{BindAddresses: []string{"127.0.0.1"}}
+	srv.listeners = newHTTPListenerSet(srv.router, http.NotFoundHandler())
+	defer srv.listeners.Close()
+	srv.networkMu.Lock()
+	err = srv.applyListenSettingsLocked()
+	srv.networkMu.Unlock()
+	if err != nil {
+		t.Fatalf("initial bind: %v", err)
+	}
+	loopback := net.JoinHostPort("127.0.0.1", srv.listenPort)
+	if got := srv.listeners.Addrs(); len(got) != 1 || got[0].Addr != loopback {
+		t.Fatalf("initial listeners = %+v", got)
+	}
+
+	w := doNetworkRequest(srv, cookie, csrf, http.MethodPut, `{"bind_addresses":["0.0.0.0"]}`, "127.0.0.1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp networkSettingsPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	wildcard := net.JoinHostPort("0.0.0.0", srv.listenPort)
+	if resp.Source != listenSourceStored || len(resp.Listeners) != 1 || resp.Listeners[0].Addr != wildcard {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if repo.saved == nil || len(repo.saved.BindAddresses) != 1 || repo.saved.BindAddresses[0] != "0.0.0.0" {
+		t.Fatalf("settings not persisted: %+v", repo.saved)
+	}
+	client := &http.Client{Timeout: 2 * time.Second}
+	r, err := client.Get("http://" + loopback + "/api/v1/health/live")
+	if err != nil {
+		t.Fatalf("portal unreachable after rebind: %v", err)
+	}
+	r.Body.Close()
+
+	// A fresh server adopts the stored settings on unlock.
+	srv.listenSettings = network.ListenSettings{}
+	if err := srv.reloadNetworkSettings(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if srv.listenSource != listenSourceStored || srv.listenSettings.BindAddresses[0] != "0.0.0.0" {
+		t.Fatalf("stored settings not adopted: %+v (%s)", srv.listenSettings, srv.listenSource)
+	}
+}
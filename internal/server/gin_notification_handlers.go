@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/notify"
+	"piccolod/internal/persistence"
+)
+
+func (s *GinServer) notificationsAvailable(c *gin.Context) bool {
+	if s.notifications == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "notifications unavailable")
+		return false
+	}
+	return true
+}
+
+func writeNotificationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, notify.ErrInvalidTarget):
+		writeGinError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, notify.ErrTargetNotFound):
+		writeGinError(c, http.StatusNotFound, "notification target not found")
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// handleNotificationTargetsList: GET /api/v1/notifications/targets
+func (s *GinServer) handleNotificationTargetsList(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	targets, err := s.notifications.List(c.Request.Context())
+	if err != nil {
+		writeNotificationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": targets})
+}
+
+// handleNotificationTargetGet: GET /api/v1/notifications/targets/:id
+func (s *GinServer) handleNotificationTargetGet(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	target, err := s.notifications.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeNotificationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"target": target})
+}
+
+// handleNotificationTargetCreate: POST /api/v1/notifications/targets
+func (s *GinServer) handleNotificationTargetCreate(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	var req notify.Target
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	target, err := s.notifications.Create(c.Request.Context(), req)
+	if err != nil {
+		writeNotificationError(c, err)
+		return
+	}
+	s.recordActivity(c, "notifications", activity.LevelInfo, "Notification target "+target.Name+" added")
+	c.JSON(http.StatusCreated, gin.H{"target": target})
+}
+
+// handleNotificationTargetUpdate: PUT /api/v1/notifications/targets/:id
+// Masked secrets sent back unchanged keep their stored values.
+func (s *GinServer) handleNotificationTargetUpdate(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	var req notify.Target
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	target, err := s.notifications.Update(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeNotificationError(c, err)
+		return
+	}
+	s.recordActivity(c, "notifications", activity.LevelInfo, "Notification target "+target.Name+" updated")
+	c.JSON(http.StatusOK, gin.H{"target": target})
+}
+
+// handleNotificationTargetDelete: DELETE /api/v1/notifications/targets/:id
+func (s *GinServer) handleNotificationTargetDelete(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	target, err := s.notifications.Get(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		err = s.notifications.Delete(c.Request.Context(), target.ID)
+	}
+	if err != nil {
+		writeNotificationError(c, err)
+		return
+	}
+	s.recordActivity(c, "notifications", activity.LevelInfo, "Notification target "+target.Name+" removed")
+	c.Status(http.StatusNoContent)
+}
+
+// handleNotificationTargetTest: POST /api/v1/notifications/targets/:id/test
+// sends one message synchronously and reports the receiver's answer.
+func (s *GinServer) handleNotificationTargetTest(c *gin.Context) {
+	if !s.notificationsAvailable(c) {
+		return
+	}
+	err := s.notifications.Test(c.Request.Context(), c.Param("id"))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"delivered": true})
+	case errors.Is(err, notify.ErrTargetNotFound), errors.Is(err, persistence.ErrLocked):
+		writeNotificationError(c, err)
+	default:
+		writeGinErrorDetails(c, http.StatusBadGateway, errorCodeUnavailable, err.Error(), gin.H{"delivered": false})
+	}
+}
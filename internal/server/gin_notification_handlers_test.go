@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"piccolod/internal/cluster"
+	"piccolod/internal/notify"
+	"piccolod/internal/persistence"
+)
+
+type memoryNotificationRepo struct {
+	mu      sync.Mutex
+	payload []byte
+}
+
+func (r *memoryNotificationRepo) CurrentConfig(ctx context.Context) (persistence.NotificationConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.payload == nil {
+		return persistence.NotificationConfig{}, persistence.ErrNotFound
+	}
+	return persistence.NotificationConfig{Payload: r.payload}, nil
+}
+
+func (r *memoryNotificationRepo) SaveConfig(ctx context.Context, cfg persistence.NotificationConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payload = append([]byte(nil), cfg.Payload...)
+	return nil
+}
+
+func TestNotificationTargets_CRUDMasksSecretsAndTests(t *testing.T) {
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer receiver.Close()
+
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.leadership = cluster.NewRegistry()
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+	srv.notifications = notify.NewManager(&memoryNotificationRepo{})
+
+	if w := doAuthedRequest(srv, nil, "", http.MethodGet, "/api/v1/notifications/targets", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/notifications/targets", `{"name":"x","type":"pager"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown type, got %d", w.Code)
+	}
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/notifications/targets",
+		`{"name":"hook","type":"webhook","enabled":true,"url":"`+receiver.URL+`/secret-path","token":"s3cret","topics":["remote"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d body=%s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Target notify.TargetView `json:"target"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	id := created.Target.ID
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/notifications/targets", "")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Contains(body, "s3cret") || strings.Contains(body, "secret-path") || !strings.Contains(body, notify.SecretMask) {
+		t.Fatalf("list should mask secrets: %d body=%s", w.Code, body)
+	}
+
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/notifications/targets/"+id+"/test", ""); w.Code != http.StatusOK {
+		t.Fatalf("test send: %d body=%s", w.Code, w.Body.String())
+	}
+	if received.Load() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", received.Load())
+	}
+
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleFollower)
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodDelete, "/api/v1/notifications/targets/"+id, ""); w.Code != http.StatusConflict {
+		t.Fatalf("delete on follower: expected 409, got %d", w.Code)
+	}
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodDelete, "/api/v1/notifications/targets/"+id, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/notifications/targets/"+id, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+}
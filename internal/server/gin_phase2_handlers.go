@@ -1,32 +1,89 @@
 package server
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/persistence"
 )
 
 // handleOSUpdateStatus returns a read-only snapshot of OS update info.
 func (s *GinServer) handleOSUpdateStatus(c *gin.Context) {
-	// Placeholder: in future, query update manager/transactional-update
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"current_version":   s.version,
 		"available_version": s.version,
 		"pending":           false,
 		"requires_reboot":   false,
 		"last_checked":      time.Now().UTC().Format(time.RFC3339),
-	})
+	}
+	if s.osUpdates != nil {
+		st := s.osUpdates.Status(c.Request.Context())
+		resp["requires_reboot"] = st.PendingReboot
+		if st.LastCheck != nil {
+			resp["pending"] = len(st.LastCheck.Packages) > 0
+			resp["last_checked"] = st.LastCheck.CheckedAt.Format(time.RFC3339)
+			resp["packages"] = st.LastCheck.Packages
+		}
+		if st.Job != nil {
+			resp["job"] = st.Job
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // handleRemoteStatus returns basic remote access status (device-terminated TLS).
+// The UI polls it, so it carries an ETag and answers a matching
+// If-None-Match with 304.
 func (s *GinServer) handleRemoteStatus(c *gin.Context) {
-	st := s.remoteManager.Status()
+	st, etag := s.remoteManager.StatusWithETag()
+	if etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", cacheControlRevalidate)
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, st)
 }
 
+// etagMatches reports whether an If-None-Match header names etag. Weak
+// validators match too, as If-None-Match uses weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // handleStorageDisks lists physical disks (read-only); returns an empty list if unknown.
 func (s *GinServer) handleStorageDisks(c *gin.Context) {
 	// Placeholder: storage manager not yet implemented; return empty list.
 	c.JSON(http.StatusOK, gin.H{"disks": []gin.H{}})
 }
+
+// handleStorageUsage reports free space for the state dir, each volume's
+// ciphertext (app volumes carry their app name) and adopted disks.
+func (s *GinServer) handleStorageUsage(c *gin.Context) {
+	if s.persistence == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "storage monitor unavailable")
+		return
+	}
+	usage, err := s.persistence.StorageUsage(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotImplemented) {
+			writeGinError(c, http.StatusServiceUnavailable, "storage monitor unavailable")
+			return
+		}
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
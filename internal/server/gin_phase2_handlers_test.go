@@ -6,6 +6,10 @@ import (
     "net/http/httptest"
     "os"
     "testing"
+    "time"
+    "piccolod/internal/events"
+    "piccolod/internal/health"
+    "piccolod/internal/persistence"
     "piccolod/internal/remote"
 )
 
@@ -24,11 +28,25 @@ func setupBasicServer(t *testing.T) *GinServer {
     return srv
 }
 
-func TestOSUpdateStatus_OK(t *testing.T) {
-    srv := setupBasicServer(t)
+// getWithAndWithoutSession checks path answers 401 without a session and
+// returns the response to an authenticated request.
+func getWithAndWithoutSession(t *testing.T, srv *GinServer, path string) *httptest.ResponseRecorder {
+    t.Helper()
     w := httptest.NewRecorder()
-    req, _ := http.NewRequest("GET", "/api/v1/updates/os", nil)
+    req, _ := http.NewRequest("GET", path, nil)
     srv.router.ServeHTTP(w, req)
+    checkErrorEnvelope(t, path, w, http.StatusUnauthorized, errorCodeUnauthorized)
+    cookie, csrf := setupTestAdminSession(t, srv)
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", path, nil)
+    attachAuth(req, cookie, csrf)
+    srv.router.ServeHTTP(w, req)
+    return w
+}
+
+func TestOSUpdateStatus_OK(t *testing.T) {
+    srv := setupBasicServer(t)
+    w := getWithAndWithoutSession(t, srv, "/api/v1/updates/os")
     if w.Code != http.StatusOK { t.Fatalf("status %d", w.Code) }
     var m map[string]any
     _ = json.Unmarshal(w.Body.Bytes(), &m)
@@ -37,16 +55,40 @@ func TestOSUpdateStatus_OK(t *testing.T) {
 
 func TestRemoteStatus_OK(t *testing.T) {
     srv := setupBasicServer(t)
-    w := httptest.NewRecorder()
-    req, _ := http.NewRequest("GET", "/api/v1/remote/status", nil)
-    srv.router.ServeHTTP(w, req)
+    w := getWithAndWithoutSession(t, srv, "/api/v1/remote/status")
     if w.Code != http.StatusOK { t.Fatalf("status %d", w.Code) }
 }
 
 func TestStorageDisks_OK(t *testing.T) {
     srv := setupBasicServer(t)
-    w := httptest.NewRecorder()
-    req, _ := http.NewRequest("GET", "/api/v1/storage/disks", nil)
-    srv.router.ServeHTTP(w, req)
+    w := getWithAndWithoutSession(t, srv, "/api/v1/storage/disks")
     if w.Code != http.StatusOK { t.Fatalf("status %d", w.Code) }
 }
+
+func TestStorageUsage_UnavailableWithoutPersistence(t *testing.T) {
+    srv := setupBasicServer(t)
+    w := getWithAndWithoutSession(t, srv, "/api/v1/storage/usage")
+    checkErrorEnvelope(t, "/api/v1/storage/usage", w, http.StatusServiceUnavailable, errorCodeUnavailable)
+}
+
+func TestObserveStorageSpace_SetsHealth(t *testing.T) {
+    srv := setupBasicServer(t)
+    bus := events.NewBus()
+    srv.observeStorageSpace(bus)
+    waitLevel := func(want health.Level) {
+        t.Helper()
+        deadline := time.Now().Add(time.Second)
+        for time.Now().Before(deadline) {
+            if st, ok := srv.healthTracker.Status("storage"); ok && st.Level == want { return }
+            time.Sleep(10 * time.Millisecond)
+        }
+        st, _ := srv.healthTracker.Status("storage")
+        t.Fatalf("expected storage %s, got %+v", want, st)
+    }
+    bus.Publish(events.Event{Topic: events.TopicStorageSpace, Payload: persistence.StorageUsage{Status: persistence.SpaceStatusWarn, Message: "86% full"}})
+    waitLevel(health.LevelWarn)
+    bus.Publish(events.Event{Topic: events.TopicStorageSpace, Payload: persistence.StorageUsage{Status: persistence.SpaceStatusError, RefusingWrites: true}})
+    waitLevel(health.LevelError)
+    bus.Publish(events.Event{Topic: events.TopicStorageSpace, Payload: persistence.StorageUsage{Status: persistence.SpaceStatusOK}})
+    waitLevel(health.LevelOK)
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/persistence"
+	"piccolod/internal/services"
+)
+
+// errorCodePortsInUse marks a port policy change refused because endpoints
+// still hold ports it would stop handing out.
+const errorCodePortsInUse = "ports_in_use"
+
+// Where the active port policy came from.
+const (
+	portPolicySourceDefault = "default"
+	portPolicySourceStored  = "stored"
+)
+
+type portRangePayload struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// portPolicyPayload is the GET/PUT /system/ports document.
+type portPolicyPayload struct {
+	HostBindRange portRangePayload `json:"host_bind_range"`
+	PublicRange   portRangePayload `json:"public_range"`
+	ExcludedPorts []int            `json:"excluded_ports"`
+	// ConnectionLimits are the defaults for listener proxies. A PUT without
+	// them keeps the current ones.
+	ConnectionLimits *services.ConnectionLimits `json:"connection_limits,omitempty"`
+}
+
+func (p portPolicyPayload) policy() services.PortPolicy {
+	return services.PortPolicy{
+		HostBind: services.PortRange{Start: p.HostBindRange.Start, End: p.HostBindRange.End},
+		Public:   services.PortRange{Start: p.PublicRange.Start, End: p.PublicRange.End},
+		Excluded: p.ExcludedPorts,
+	}
+}
+
+func newPortPolicyPayload(p services.PortPolicy) portPolicyPayload {
+	excluded := p.Excluded
+	if excluded == nil {
+		excluded = []int{}
+	}
+	return portPolicyPayload{
+		HostBindRange: portRangePayload{Start: p.HostBind.Start, End: p.HostBind.End},
+		PublicRange:   portRangePayload{Start: p.Public.Start, End: p.Public.End},
+		ExcludedPorts: excluded,
+	}
+}
+
+// portPolicyResponse is the GET/PUT /system/ports response.
+type portPolicyResponse struct {
+	Policy       portPolicyPayload `json:"policy"`
+	Source       string            `json:"source"`
+	MinRangeSize int               `json:"min_range_size"`
+	// Probe says whether allocation test-binds ports first; OccupiedPorts
+	// are the ones it found bound by other software.
+	Probe         services.PortProbeStatus `json:"probe"`
+	OccupiedPorts []services.OccupiedPort  `json:"occupied_ports"`
+}
+
+// portPolicyRepo returns the control-store repository, or nil when
+// persistence is not wired (tests set portPolicies directly).
+func (s *GinServer) portPolicyRepo() persistence.PortPolicyRepo {
+	if s.portPolicies != nil {
+		return s.portPolicies
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().PortPolicy()
+}
+
+// reloadPortPolicy adopts the stored policy once the control store is
+// readable. Endpoints restored before it loads keep their ports even when
+// the policy excludes them; GET /services flags them.
+func (s *GinServer) reloadPortPolicy() error {
+	repo := s.portPolicyRepo()
+	if repo == nil || s.serviceManager == nil {
+		return nil
+	}
+	occupied, err := repo.OccupiedPorts(context.Background())
+	switch {
+	case err == nil:
+		ports := make([]services.OccupiedPort, 0, len(occupied))
+		for _, rec := range occupied {
+			ports = append(ports, services.OccupiedPort(rec))
+		}
+		s.serviceManager.RestoreOccupiedPorts(ports)
+	case errors.Is(err, persistence.ErrNotImplemented):
+	default:
+		return err
+	}
+	stored, err := repo.CurrentPolicy(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	err = s.serviceManager.SetPortPolicy(services.PortPolicy{
+		HostBind: services.PortRange{Start: stored.HostBindStart, End: stored.HostBindEnd},
+		Public:   services.PortRange{Start: stored.PublicStart, End: stored.PublicEnd},
+		Excluded: stored.ExcludedPorts,
+	})
+	if err != nil {
+		return fmt.Errorf("stored port policy: %w", err)
+	}
+	if stored.ConnectionLimits != nil {
+		if err := s.serviceManager.SetConnectionLimits(services.ConnectionLimits(*stored.ConnectionLimits)); err != nil {
+			return fmt.Errorf("stored connection limits: %w", err)
+		}
+	}
+	s.setPortPolicySource(portPolicySourceStored)
+	return nil
+}
+
+// occupiedPortStore saves the ports the allocator found bound outside
+// Piccolo to the port policy repo.
+type occupiedPortStore struct{ s *GinServer }
+
+func (o occupiedPortStore) SaveOccupiedPorts(ctx context.Context, ports []services.OccupiedPort) error {
+	repo := o.s.portPolicyRepo()
+	if repo == nil {
+		return services.ErrOccupiedPortStoreUnavailable
+	}
+	records := make([]persistence.OccupiedPort, 0, len(ports))
+	for _, p := range ports {
+		records = append(records, persistence.OccupiedPort(p))
+	}
+	err := repo.SaveOccupiedPorts(ctx, records)
+	if errors.Is(err, persistence.ErrLocked) || errors.Is(err, persistence.ErrNotLeader) || errors.Is(err, persistence.ErrNotImplemented) {
+		return services.ErrOccupiedPortStoreUnavailable
+	}
+	return err
+}
+
+func (s *GinServer) setPortPolicySource(source string) {
+	s.portPolicyMu.Lock()
+	s.portPolicySource = source
+	s.portPolicyMu.Unlock()
+}
+
+func (s *GinServer) portPolicyPayload() portPolicyResponse {
+	s.portPolicyMu.Lock()
+	source := s.portPolicySource
+	s.portPolicyMu.Unlock()
+	if source == "" {
+		source = portPolicySourceDefault
+	}
+	policy := newPortPolicyPayload(s.serviceManager.PortPolicy())
+	limits := s.serviceManager.ConnectionLimits()
+	policy.ConnectionLimits = &limits
+	return portPolicyResponse{
+		Policy:        policy,
+		Source:        source,
+		MinRangeSize:  services.MinPortRangeSize,
+		Probe:         s.serviceManager.PortProbe(),
+		OccupiedPorts: s.serviceManager.OccupiedPorts(),
+	}
+}
+
+// handleSystemPortsGet: GET /api/v1/system/ports
+func (s *GinServer) handleSystemPortsGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.portPolicyPayload())
+}
+
+// handleSystemPortsUpdate: PUT /api/v1/system/ports
+func (s *GinServer) handleSystemPortsUpdate(c *gin.Context) {
+	var req portPolicyPayload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	next, err := req.policy().Normalize()
+	if err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	limits := s.serviceManager.ConnectionLimits()
+	if req.ConnectionLimits != nil {
+		limits = *req.ConnectionLimits
+		if err := limits.Validate(); err != nil {
+			writeGinError(c, http.StatusBadRequest, "connection_limits: "+err.Error())
+			return
+		}
+	}
+	// Limits never changed from the built-in defaults are not stored, so
+	// they follow the defaults of later versions.
+	var storedLimits *persistence.ConnectionLimits
+	if limits != services.DefaultConnectionLimits() {
+		converted := persistence.ConnectionLimits(limits)
+		storedLimits = &converted
+	}
+	if err := s.serviceManager.CheckPortPolicy(next); err != nil {
+		var inUse *services.PortsInUseError
+		if errors.As(err, &inUse) {
+			details := make([]gin.H, 0, len(inUse.Endpoints))
+			for _, ep := range inUse.Endpoints {
+				details = append(details, gin.H{"app": ep.App, "listener": ep.Name, "host_port": ep.HostBind, "public_port": ep.PublicPort})
+			}
+			writeGinErrorDetails(c, http.StatusConflict, errorCodePortsInUse, err.Error()+"; move or uninstall those apps first", details)
+			return
+		}
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	repo := s.portPolicyRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "port policy storage unavailable")
+		return
+	}
+	err = repo.SavePolicy(c.Request.Context(), persistence.PortPolicy{
+		HostBindStart:    next.HostBind.Start,
+		HostBindEnd:      next.HostBind.End,
+		PublicStart:      next.Public.Start,
+		PublicEnd:        next.Public.End,
+		ExcludedPorts:    next.Excluded,
+		ConnectionLimits: storedLimits,
+		UpdatedAt:        time.Now().UTC(),
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNotLeader):
+		writeGinErrorCode(c, http.StatusConflict, errorCodeNotLeader, "not kernel leader")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.serviceManager.SetPortPolicy(next); err != nil {
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	previousLimits := s.serviceManager.ConnectionLimits()
+	if err := s.serviceManager.SetConnectionLimits(limits); err != nil {
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.setPortPolicySource(portPolicySourceStored)
+
+	msg := fmt.Sprintf("Service ports now allocated from %d-%d (host) and %d-%d (public)",
+		next.HostBind.Start, next.HostBind.End, next.Public.Start, next.Public.End)
+	if len(next.Excluded) > 0 {
+		ports := make([]string, 0, len(next.Excluded))
+		for _, p := range next.Excluded {
+			ports = append(ports, strconv.Itoa(p))
+		}
+		msg += ", excluding " + strings.Join(ports, ", ")
+	}
+	if limits != previousLimits {
+		msg += fmt.Sprintf("; listeners default to %s", describeConnectionLimits(limits))
+	}
+	s.recordActivity(c, "system", activity.LevelInfo, msg)
+	c.JSON(http.StatusOK, s.portPolicyPayload())
+}
+
+// describeConnectionLimits spells out connection limits for the activity log.
+func describeConnectionLimits(l services.ConnectionLimits) string {
+	count := func(n int) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(n)
+	}
+	idle := "no idle timeout"
+	if l.IdleTimeout > 0 {
+		idle = "idle timeout " + l.IdleTimeout.String()
+	}
+	return fmt.Sprintf("%s connections, %s per client, %s", count(l.MaxConnections), count(l.MaxConnectionsPerIP), idle)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/persistence"
+	"piccolod/internal/services"
+)
+
+type memoryPortPolicyRepo struct {
+	mu       sync.Mutex
+	saved    *persistence.PortPolicy
+	occupied []persistence.OccupiedPort
+}
+
+func (r *memoryPortPolicyRepo) CurrentPolicy(ctx context.Context) (persistence.PortPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.PortPolicy{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memoryPortPolicyRepo) SavePolicy(ctx context.Context, p persistence.PortPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &p
+	return nil
+}
+
+func (r *memoryPortPolicyRepo) OccupiedPorts(ctx context.Context) ([]persistence.OccupiedPort, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]persistence.OccupiedPort(nil), r.occupied...), nil
+}
+
+func (r *memoryPortPolicyRepo) SaveOccupiedPorts(ctx context.Context, ports []persistence.OccupiedPort) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.occupied = append([]persistence.OccupiedPort(nil), ports...)
+	return nil
+}
+
+func doPortsUpdate(srv *GinServer, cookie *http.Cookie, csrf, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/system/ports", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSystemPorts_UpdateRefusesOrphanedPorts(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryPortPolicyRepo{}
+	srv.portPolicies = repo
+
+	eps, err := srv.serviceManager.ReserveForApp("blog", []api.AppListener{{Name: "web", GuestPort: 80}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	w := doPortsUpdate(srv, cookie, csrf, `{"host_bind_range":{"start":15000,"end":15050},"public_range":{"start":35000,"end":45000}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("undersized range: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doPortsUpdate(srv, cookie, csrf, `{"host_bind_range":{"start":50000,"end":50999},"public_range":{"start":35000,"end":45000}}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("orphaning change: expected 409, got %d body=%s", w.Code, w.Body.String())
+	}
+	var env errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || env.Error == nil || env.Error.Code != errorCodePortsInUse {
+		t.Fatalf("expected %s envelope, got %s", errorCodePortsInUse, w.Body.String())
+	}
+	if !strings.Contains(env.Error.Message, "blog/web") || repo.saved != nil {
+		t.Fatalf("unexpected refusal %q (saved %+v)", env.Error.Message, repo.saved)
+	}
+
+	w = doPortsUpdate(srv, cookie, csrf, `{"host_bind_range":{"start":15000,"end":25000},"public_range":{"start":35000,"end":45000},"excluded_ports":[15080,15080]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp portPolicyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Source != portPolicySourceStored || len(resp.Policy.ExcludedPorts) != 1 || resp.MinRangeSize == 0 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if repo.saved == nil || len(repo.saved.ExcludedPorts) != 1 || repo.saved.ExcludedPorts[0] != 15080 {
+		t.Fatalf("policy not persisted: %+v", repo.saved)
+	}
+
+	// A stored policy is adopted on unlock even when restored endpoints
+	// fall outside it; the services list flags them.
+	repo.saved = &persistence.PortPolicy{HostBindStart: 50000, HostBindEnd: 50999, PublicStart: 35000, PublicEnd: 45000}
+	if err := srv.reloadPortPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/services", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	var list struct {
+		Services []serviceEntry `json:"services"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode services: %v", err)
+	}
+	if len(list.Services) != 1 || list.Services[0].HostPort != eps[0].HostBind || !list.Services[0].OutsidePortRange {
+		t.Fatalf("expected the endpoint flagged outside the port range, got %+v", list.Services)
+	}
+}
+
+func TestSystemPorts_ListsPortsOccupiedOutsidePiccolo(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	seen := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo := &memoryPortPolicyRepo{occupied: []persistence.OccupiedPort{
+		{Port: 15022, Network: "tcp", Range: "host_bind", FirstSeen: seen, LastSeen: seen},
+	}}
+	srv.portPolicies = repo
+	if err := srv.reloadPortPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/system/ports", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp portPolicyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.OccupiedPorts) != 1 || resp.OccupiedPorts[0].Port != 15022 || !resp.OccupiedPorts[0].FirstSeen.Equal(seen) {
+		t.Fatalf("unexpected occupied ports %+v", resp.OccupiedPorts)
+	}
+	if resp.Probe.Enabled == (resp.Probe.DisabledReason != "") {
+		t.Fatalf("unexpected probe status %+v", resp.Probe)
+	}
+}
+
+func TestSystemPorts_ConnectionLimits(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	repo := &memoryPortPolicyRepo{}
+	srv.portPolicies = repo
+	listeners := []api.AppListener{
+		{Name: "web", GuestPort: 80, MaxConnections: 10},
+		{Name: "dns", GuestPort: 53, Protocol: api.ListenerProtocolUDP},
+	}
+	if _, err := srv.serviceManager.ReserveForApp("blog", listeners); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	ranges := `"host_bind_range":{"start":15000,"end":25000},"public_range":{"start":35000,"end":45000}`
+
+	w := doPortsUpdate(srv, cookie, csrf, `{`+ranges+`,"connection_limits":{"max_connections":50,"max_connections_per_ip":60}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("per-IP above overall: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+	w = doPortsUpdate(srv, cookie, csrf, `{`+ranges+`,"connection_limits":{"max_connections":500,"max_connections_per_ip":20,"idle_timeout":"90s"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d body=%s", w.Code, w.Body.String())
+	}
+	want := services.ConnectionLimits{MaxConnections: 500, MaxConnectionsPerIP: 20, IdleTimeout: 90 * time.Second}
+	if repo.saved == nil || repo.saved.ConnectionLimits == nil || services.ConnectionLimits(*repo.saved.ConnectionLimits) != want {
+		t.Fatalf("limits not persisted: %+v", repo.saved)
+	}
+	// A PUT without limits keeps them.
+	w = doPortsUpdate(srv, cookie, csrf, `{`+ranges+`}`)
+	var resp portPolicyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Policy.ConnectionLimits == nil || *resp.Policy.ConnectionLimits != want {
+		t.Fatalf("limits not kept: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/services", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	var list struct {
+		Services []serviceEntry `json:"services"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode services: %v", err)
+	}
+	for _, svc := range list.Services {
+		switch svc.Name {
+		case "web":
+			// The listener's own cap wins; the per-IP and idle defaults fill in.
+			if svc.Limits == nil || *svc.Limits != (services.ConnectionLimits{MaxConnections: 10, MaxConnectionsPerIP: 10, IdleTimeout: 90 * time.Second}) {
+				t.Fatalf("unexpected web limits %+v", svc.Limits)
+			}
+		case "dns":
+			if svc.Limits != nil {
+				t.Fatalf("udp listener reported limits %+v", svc.Limits)
+			}
+		}
+	}
+
+	// Stored limits are adopted on reload.
+	fresh := createGinTestServer(t, t.TempDir())
+	fresh.portPolicies = repo
+	if err := fresh.reloadPortPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := fresh.serviceManager.ConnectionLimits(); got != want {
+		t.Fatalf("reloaded limits %+v", got)
+	}
+}
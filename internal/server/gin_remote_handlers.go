@@ -1,16 +1,22 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"piccolod/internal/activity"
 	"piccolod/internal/api"
+	"piccolod/internal/events"
 	"piccolod/internal/remote"
+	"piccolod/internal/remote/nexusclient"
 )
 
 type remoteConfigureRequest struct {
@@ -21,15 +27,22 @@ type remoteConfigureRequest struct {
 	PortalHostname string            `json:"portal_hostname"`
 	DNSProvider    string            `json:"dns_provider"`
 	DNSCredentials map[string]string `json:"dns_credentials"`
+	DryRun         bool              `json:"dry_run"`
+	Probe          bool              `json:"probe"`
 }
 
-// handleRemoteConfigure handles POST /api/v1/remote/configure
+// handleRemoteConfigure handles POST /api/v1/remote/configure. With
+// dry_run set (in the body or as ?dry_run=1) it returns the derived plan and
+// persists nothing.
 func (s *GinServer) handleRemoteConfigure(c *gin.Context) {
 	var req remoteConfigureRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
 		return
 	}
+	if v, err := strconv.ParseBool(c.Query("dry_run")); err == nil && v {
+		req.DryRun = true
+	}
 	configureReq := remote.ConfigureRequest{
 		Endpoint:       req.Endpoint,
 		DeviceSecret:   req.DeviceSecret,
@@ -38,55 +51,82 @@ func (s *GinServer) handleRemoteConfigure(c *gin.Context) {
 		PortalHostname: req.PortalHostname,
 		DNSProvider:    req.DNSProvider,
 		DNSCredentials: req.DNSCredentials,
+		DryRun:         req.DryRun,
+		Probe:          req.Probe,
+		ListenerNames:  s.remoteCertListenerNames(),
 	}
+	var plan *remote.ConfigurePlan
+	var probe *remote.PreflightCheck
+	var migration *remote.SolverMigration
 	if s.dispatcher != nil {
 		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.ConfigureCommand{Req: configureReq})
 		if err != nil {
-			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
-				return
-			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeRemoteConfigureError(c, err)
 			return
 		}
-		if _, ok := resp.(remote.ConfigureResponse); !ok {
-			writeGinError(c, http.StatusInternalServerError, "unexpected response from remote dispatcher")
+		out, ok := resp.(remote.ConfigureResponse)
+		if !ok {
+			writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
+			return
+		}
+		plan = out.Plan
+		probe = out.Probe
+		migration = out.Migration
+	} else if configureReq.DryRun {
+		p, err := s.remoteManager.PlanConfigure(configureReq)
+		if err != nil {
+			writeRemoteConfigureError(c, err)
 			return
 		}
+		plan = &p
 	} else {
-		if err := s.remoteManager.Configure(configureReq); err != nil {
-			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
-				return
-			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+		applied, err := s.remoteManager.ConfigureWithPlan(configureReq)
+		if err != nil {
+			writeRemoteConfigureError(c, err)
 			return
 		}
+		probe = applied.Probe
+		migration = applied.Migration
+	}
+	if configureReq.DryRun {
+		if plan == nil {
+			writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "plan": plan})
+		return
 	}
 	s.refreshRemoteRuntime()
-	// For HTTP-01 solver (wildcard unsupported), proactively issue per-listener certs
-	if strings.EqualFold(configureReq.Solver, "http-01") && configureReq.TLD != "" && s.remoteManager != nil {
-		hosts := map[string]struct{}{}
-		for _, ep := range s.serviceManager.GetAll() {
-			if ep.Flow == api.FlowTLS {
-				continue
-			}
-			switch ep.Protocol {
-			case api.ListenerProtocolHTTP, api.ListenerProtocolWebsocket:
-			default:
-				continue
-			}
-			if ep.Name == "" {
-				continue
-			}
-			host := strings.ToLower(ep.Name + "." + configureReq.TLD)
-			hosts[host] = struct{}{}
+	resp := gin.H{"message": "remote configured"}
+	if probe != nil {
+		resp["probe"] = probe
+	}
+	if migration != nil {
+		resp["migration"] = migration
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// remoteCertListenerNames lists the app listeners served under the remote
+// TLD, by the wildcard or by their own certificates.
+func (s *GinServer) remoteCertListenerNames() []string {
+	if s.serviceManager == nil {
+		return nil
+	}
+	var names []string
+	for _, ep := range s.serviceManager.GetAll() {
+		if ep.Flow == api.FlowTLS {
+			continue
 		}
-		for h := range hosts {
-			s.remoteManager.QueueHostnameCertificate(h)
+		if !ep.Protocol.HTTP() {
+			continue
+		}
+		if label := ep.RemoteLabel(); label != "" {
+			names = append(names, label)
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "remote configured"})
+	sort.Strings(names)
+	return names
 }
 
 func (s *GinServer) resolvePortalPort() int {
@@ -106,19 +146,19 @@ func (s *GinServer) handleRemoteDisable(c *gin.Context) {
 	if s.dispatcher != nil {
 		if _, err := s.dispatcher.Dispatch(c.Request.Context(), remote.DisableCommand{}); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusInternalServerError, err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "disable remote access", "reason": err.Error()})
 			return
 		}
 	} else {
 		if err := s.remoteManager.Disable(); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusInternalServerError, err.Error())
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "disable remote access", "reason": err.Error()})
 			return
 		}
 	}
@@ -133,15 +173,15 @@ func (s *GinServer) handleRemoteRotate(c *gin.Context) {
 		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.RotateSecretCommand{})
 		if err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "rotate the device secret", "reason": err.Error()})
 			return
 		}
 		rotateResp, ok := resp.(remote.RotateSecretResponse)
 		if !ok {
-			writeGinError(c, http.StatusInternalServerError, "unexpected response from remote dispatcher")
+			writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
 			return
 		}
 		secret = rotateResp.Secret
@@ -149,10 +189,10 @@ func (s *GinServer) handleRemoteRotate(c *gin.Context) {
 		resp, err := s.remoteManager.Rotate()
 		if err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "rotate the device secret", "reason": err.Error()})
 			return
 		}
 		secret = resp
@@ -167,26 +207,26 @@ func (s *GinServer) handleRemotePreflight(c *gin.Context) {
 		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.RunPreflightCommand{})
 		if err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "run the preflight", "reason": err.Error()})
 			return
 		}
 		preResp, ok := resp.(remote.RunPreflightResponse)
 		if !ok {
-			writeGinError(c, http.StatusInternalServerError, "unexpected response from remote dispatcher")
+			writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
 			return
 		}
 		result = preResp.Result
 	} else {
-		resp, err := s.remoteManager.RunPreflight()
+		resp, err := s.remoteManager.RunPreflight(c.Request.Context())
 		if err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "run the preflight", "reason": err.Error()})
 			return
 		}
 		result = resp
@@ -197,6 +237,66 @@ func (s *GinServer) handleRemotePreflight(c *gin.Context) {
 	})
 }
 
+// handleRemoteProbe asks the outside prober to fetch the portal and returns
+// what it saw.
+func (s *GinServer) handleRemoteProbe(c *gin.Context) {
+	var result remote.ProbeResult
+	var err error
+	if s.dispatcher != nil {
+		var resp any
+		resp, err = s.dispatcher.Dispatch(c.Request.Context(), remote.RunProbeCommand{})
+		if err == nil {
+			probeResp, ok := resp.(remote.RunProbeResponse)
+			if !ok {
+				writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
+				return
+			}
+			result = probeResp.Result
+		}
+	} else {
+		result, err = s.remoteManager.RunProbe(c.Request.Context())
+	}
+	if err != nil {
+		if errors.Is(err, remote.ErrLocked) {
+			writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+			return
+		}
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "probe the portal", "reason": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"probe": result})
+}
+
+// handleRemoteReconnect drops the tunnel's reconnect backoff so it is tried
+// again at once.
+func (s *GinServer) handleRemoteReconnect(c *gin.Context) {
+	var stats nexusclient.Stats
+	var err error
+	if s.dispatcher != nil {
+		var resp any
+		resp, err = s.dispatcher.Dispatch(c.Request.Context(), remote.ReconnectCommand{})
+		if r, ok := resp.(remote.ReconnectResponse); ok {
+			stats = r.Tunnel
+		}
+	} else {
+		stats, err = s.remoteManager.ReconnectTunnel()
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, remote.ErrTunnelInactive):
+		writeGinMessage(c, http.StatusConflict, msgRemoteNotEnabled, nil)
+		return
+	case errors.Is(err, remote.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+		return
+	default:
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "reconnect the tunnel", "reason": err.Error()})
+		return
+	}
+	s.recordActivity(c, "remote", activity.LevelInfo, "Tunnel reconnect requested")
+	c.JSON(http.StatusOK, gin.H{"tunnel": stats})
+}
+
 // handleRemoteAliasesList returns the current alias inventory.
 func (s *GinServer) handleRemoteAliasesList(c *gin.Context) {
 	aliases := s.remoteManager.ListAliases()
@@ -204,42 +304,37 @@ func (s *GinServer) handleRemoteAliasesList(c *gin.Context) {
 }
 
 type remoteAliasRequest struct {
-	Listener string `json:"listener"`
-	Hostname string `json:"hostname"`
+	Listener   string `json:"listener"`
+	Hostname   string `json:"hostname"`
+	RedirectTo string `json:"redirect_to"`
+	IncludeWWW bool   `json:"include_www"`
 }
 
 // handleRemoteAliasesCreate appends a new alias.
 func (s *GinServer) handleRemoteAliasesCreate(c *gin.Context) {
 	var req remoteAliasRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
 		return
 	}
+	opts := remote.AliasOptions{RedirectTo: req.RedirectTo, IncludeWWW: req.IncludeWWW}
 	var alias remote.Alias
 	if s.dispatcher != nil {
-		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.AddAliasCommand{Listener: req.Listener, Hostname: req.Hostname})
+		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.AddAliasCommand{Listener: req.Listener, Hostname: req.Hostname, Options: opts})
 		if err != nil {
-			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
-				return
-			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeRemoteAliasError(c, err)
 			return
 		}
 		aliasResp, ok := resp.(remote.AddAliasResponse)
 		if !ok {
-			writeGinError(c, http.StatusInternalServerError, "unexpected response from remote dispatcher")
+			writeGinMessage(c, http.StatusInternalServerError, msgRemoteDispatcher, nil)
 			return
 		}
 		alias = aliasResp.Alias
 	} else {
-		resp, err := s.remoteManager.AddAlias(req.Listener, req.Hostname)
+		resp, err := s.remoteManager.AddAlias(req.Listener, req.Hostname, opts)
 		if err != nil {
-			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
-				return
-			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeRemoteAliasError(c, err)
 			return
 		}
 		alias = resp
@@ -247,35 +342,56 @@ func (s *GinServer) handleRemoteAliasesCreate(c *gin.Context) {
 	c.JSON(http.StatusOK, alias)
 }
 
+// writeRemoteAliasError maps AddAlias failures to responses: a duplicate is
+// a conflict naming the existing alias, the alias cap is 422 and hostname
+// problems carry per-field messages like configure.
+func writeRemoteAliasError(c *gin.Context, err error) {
+	var exists *remote.AliasExistsError
+	var hostErr *remote.HostnameError
+	switch {
+	case errors.Is(err, remote.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+	case errors.As(err, &exists):
+		writeGinMessageDetails(c, http.StatusConflict, msgConflictAction, msgParams{"action": "add the alias", "reason": err.Error()}, gin.H{"existing_id": exists.ID})
+	case errors.Is(err, remote.ErrAliasLimit):
+		writeGinMessage(c, http.StatusUnprocessableEntity, msgInvalidAction, msgParams{"action": "add the alias", "reason": err.Error()})
+	case errors.As(err, &hostErr):
+		writeGinMessageDetails(c, http.StatusBadRequest, msgHostnameField, msgParams{"reason": err.Error()}, gin.H{"fields": map[string]string{hostErr.Field: hostErr.Reason}})
+	default:
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "add the alias", "reason": err.Error()})
+	}
+}
+
 // handleRemoteAliasesDelete removes an alias by ID.
 func (s *GinServer) handleRemoteAliasesDelete(c *gin.Context) {
 	id := c.Param("id")
 	if s.dispatcher != nil {
 		if _, err := s.dispatcher.Dispatch(c.Request.Context(), remote.RemoveAliasCommand{ID: id}); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "remove the alias", "reason": err.Error()})
 			return
 		}
 	} else {
 		if err := s.remoteManager.RemoveAlias(id); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "remove the alias", "reason": err.Error()})
 			return
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "alias removed"})
 }
 
-// handleRemoteCertificatesList returns certificate metadata.
+// handleRemoteCertificatesList returns certificate metadata, checked against
+// the certificate files on disk, and the usage of each CA rate limit window.
 func (s *GinServer) handleRemoteCertificatesList(c *gin.Context) {
 	certs := s.remoteManager.ListCertificates()
-	c.JSON(http.StatusOK, gin.H{"certificates": certs})
+	c.JSON(http.StatusOK, gin.H{"certificates": certs, "issuance_usage": s.remoteManager.IssuanceUsage()})
 }
 
 // handleRemoteCertificateRenew triggers a manual renewal.
@@ -284,28 +400,184 @@ func (s *GinServer) handleRemoteCertificateRenew(c *gin.Context) {
 	if s.dispatcher != nil {
 		if _, err := s.dispatcher.Dispatch(c.Request.Context(), remote.RenewCertCommand{ID: id}); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "renew the certificate", "reason": err.Error()})
 			return
 		}
 	} else {
 		if err := s.remoteManager.RenewCertificate(id); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusNotFound, err.Error())
+			writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "renew the certificate", "reason": err.Error()})
 			return
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "renewal queued"})
 }
 
-// handleRemoteEvents returns the activity log.
+// handleRemoteCertificatesRenewAll queues renewal of every certificate that
+// is due or failed; ?force=true renews all of them.
+func (s *GinServer) handleRemoteCertificatesRenewAll(c *gin.Context) {
+	force := false
+	if v := c.Query("force"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeGinMessage(c, http.StatusBadRequest, msgBooleanParam, msgParams{"param": "force"})
+			return
+		}
+		force = b
+	}
+	var queued []string
+	if s.dispatcher != nil {
+		resp, err := s.dispatcher.Dispatch(c.Request.Context(), remote.RenewAllCommand{Force: force})
+		if err != nil {
+			writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "queue certificate renewals", "reason": err.Error()})
+			return
+		}
+		if r, ok := resp.(remote.RenewAllResponse); ok {
+			queued = r.Queued
+		}
+	} else {
+		queued = s.remoteManager.RenewAll(force)
+	}
+	if queued == nil {
+		queued = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"queued": queued})
+}
+
+// handleRemoteRenewalWindow sets how many days before expiry certificates
+// are renewed.
+func (s *GinServer) handleRemoteRenewalWindow(c *gin.Context) {
+	var req struct {
+		LeadDays int `json:"lead_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
+		return
+	}
+	var err error
+	if s.dispatcher != nil {
+		_, err = s.dispatcher.Dispatch(c.Request.Context(), remote.SetRenewalLeadCommand{Days: req.LeadDays})
+	} else {
+		err = s.remoteManager.SetRenewalLead(req.LeadDays)
+	}
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"lead_days": req.LeadDays})
+	case errors.Is(err, remote.ErrInvalidRenewalLead):
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "set the renewal window", "reason": err.Error()})
+	case errors.Is(err, remote.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+	default:
+		writeGinMessage(c, http.StatusInternalServerError, msgFailedAction, msgParams{"action": "set the renewal window", "reason": err.Error()})
+	}
+}
+
+// handleRemoteCertificateForget deletes an orphaned certificate and its
+// files now instead of after the grace period.
+func (s *GinServer) handleRemoteCertificateForget(c *gin.Context) {
+	id := c.Param("id")
+	var err error
+	if s.dispatcher != nil {
+		_, err = s.dispatcher.Dispatch(c.Request.Context(), remote.ForgetCertCommand{ID: id})
+	} else {
+		err = s.remoteManager.ForgetCertificate(id)
+	}
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "certificate forgotten"})
+	case errors.Is(err, remote.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+	case errors.Is(err, remote.ErrCertificateInUse):
+		writeGinMessage(c, http.StatusConflict, msgCertificateInUse, nil)
+	default:
+		writeGinMessage(c, http.StatusNotFound, msgNotFoundAction, msgParams{"action": "forget the certificate", "reason": err.Error()})
+	}
+}
+
+// listRemoteEvents returns the event log newest first. ?before=<seq> and
+// ?limit=<n> page through it by sequence number.
+func (s *GinServer) listRemoteEvents(c *gin.Context) {
+	var before uint64
+	if v := c.Query("before"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n == 0 {
+			writeGinMessage(c, http.StatusBadRequest, msgEventSeqParam, msgParams{"param": "before"})
+			return
+		}
+		before = n
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeGinMessage(c, http.StatusBadRequest, msgPositiveIntParam, msgParams{"param": "limit"})
+			return
+		}
+		limit = n
+	}
+	evts := s.remoteManager.ListEvents()
+	if before > 0 {
+		i := 0
+		for i < len(evts) && evts[i].Seq >= before {
+			i++
+		}
+		evts = evts[i:]
+	}
+	if limit > 0 && len(evts) > limit {
+		evts = evts[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"events": evts})
+}
+
+// remoteEventsHeartbeat keeps idle event streams from being cut by proxies.
+const remoteEventsHeartbeat = 15 * time.Second
+
+// handleRemoteEvents returns the remote event log. With ?follow=1 it instead
+// streams certificate issuance progress as server-sent "cert_progress"
+// events until the client disconnects.
 func (s *GinServer) handleRemoteEvents(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"events": s.remoteManager.ListEvents()})
+	if follow, err := strconv.ParseBool(c.Query("follow")); err != nil || !follow {
+		s.listRemoteEvents(c)
+		return
+	}
+	if s.events == nil {
+		writeGinMessage(c, http.StatusServiceUnavailable, msgEventStream, nil)
+		return
+	}
+	ch := s.events.Subscribe(events.TopicRemoteCertProgress, 32)
+	defer s.events.Unsubscribe(events.TopicRemoteCertProgress, ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(remoteEventsHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case evt, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if progress, ok := evt.Payload.(events.RemoteCertProgress); ok {
+				c.SSEvent("cert_progress", progress)
+			}
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
 }
 
 type guideVerifyRequest struct {
@@ -319,7 +591,7 @@ type guideVerifyRequest struct {
 func (s *GinServer) handleRemoteGuideVerify(c *gin.Context) {
 	var req guideVerifyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
 		return
 	}
 	verification := remote.GuideVerification{
@@ -331,19 +603,19 @@ func (s *GinServer) handleRemoteGuideVerify(c *gin.Context) {
 	if s.dispatcher != nil {
 		if _, err := s.dispatcher.Dispatch(c.Request.Context(), remote.GuideVerifyCommand{Verification: verification}); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "verify the nexus helper", "reason": err.Error()})
 			return
 		}
 	} else {
 		if err := s.remoteManager.MarkGuideVerified(verification); err != nil {
 			if errors.Is(err, remote.ErrLocked) {
-				writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+				writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
 				return
 			}
-			writeGinError(c, http.StatusBadRequest, err.Error())
+			writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "verify the nexus helper", "reason": err.Error()})
 			return
 		}
 	}
@@ -360,26 +632,64 @@ func (s *GinServer) handleRemoteGuideInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, info)
 }
 
-// handleRemoteDNSProviders returns the supported DNS provider metadata.
+// handleRemoteDNSProviders returns the DNS provider registry, including the
+// credential schema of each provider.
 func (s *GinServer) handleRemoteDNSProviders(c *gin.Context) {
-	providers := []gin.H{
-		{
-			"id":       "cloudflare",
-			"name":     "Cloudflare",
-			"docs_url": "https://go-acme.github.io/lego/dns/cloudflare/",
-			"fields": []gin.H{
-				{"id": "api_token", "label": "API Token", "secret": true},
-			},
-		},
-		{
-			"id":       "route53",
-			"name":     "AWS Route53",
-			"docs_url": "https://go-acme.github.io/lego/dns/route53/",
-			"fields": []gin.H{
-				{"id": "access_key", "label": "Access Key ID"},
-				{"id": "secret_key", "label": "Secret Access Key", "secret": true},
-			},
-		},
-	}
-	c.JSON(http.StatusOK, gin.H{"providers": providers})
+	c.JSON(http.StatusOK, gin.H{"providers": remote.DNSProviders()})
+}
+
+type remoteDNSValidateRequest struct {
+	DNSProvider    string            `json:"dns_provider"`
+	DNSCredentials map[string]string `json:"dns_credentials"`
+	// Zone defaults to the configured TLD.
+	Zone string `json:"zone"`
+}
+
+// handleRemoteDNSValidate handles POST /api/v1/remote/dns/validate. Schema
+// problems are a 400 with field-level errors; the live check result is
+// reported in the body because a rejected token is an answer, not a fault.
+func (s *GinServer) handleRemoteDNSValidate(c *gin.Context) {
+	var req remoteDNSValidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidJSON, nil)
+		return
+	}
+	zone := strings.TrimSpace(req.Zone)
+	if zone == "" && s.remoteManager != nil {
+		zone = s.remoteManager.Status().TLD
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+	detail, err := remote.CheckDNSCredentials(ctx, req.DNSProvider, req.DNSCredentials, zone)
+	var credErr *remote.CredentialError
+	switch {
+	case errors.As(err, &credErr):
+		writeRemoteConfigureError(c, err)
+	case errors.Is(err, remote.ErrNoLiveCheck):
+		c.JSON(http.StatusOK, gin.H{"valid": true, "live_checked": false, "detail": "credentials match the provider schema; this provider has no live check"})
+	case err != nil:
+		c.JSON(http.StatusOK, gin.H{"valid": false, "live_checked": true, "zone": zone, "detail": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"valid": true, "live_checked": true, "zone": zone, "detail": detail})
+	}
+}
+
+// writeRemoteConfigureError maps configure failures to responses; credential,
+// hostname and endpoint problems carry per-field messages in error.details.fields.
+func writeRemoteConfigureError(c *gin.Context, err error) {
+	var credErr *remote.CredentialError
+	var hostErr *remote.HostnameError
+	var endpointErr *remote.EndpointError
+	switch {
+	case errors.Is(err, remote.ErrLocked):
+		writeGinMessage(c, http.StatusLocked, errorCodeLocked, nil)
+	case errors.As(err, &credErr):
+		writeGinMessageDetails(c, http.StatusBadRequest, msgCredentialFields, msgParams{"reason": err.Error()}, gin.H{"fields": credErr.Fields})
+	case errors.As(err, &hostErr):
+		writeGinMessageDetails(c, http.StatusBadRequest, msgHostnameField, msgParams{"reason": err.Error()}, gin.H{"fields": map[string]string{hostErr.Field: hostErr.Reason}})
+	case errors.As(err, &endpointErr):
+		writeGinMessageDetails(c, http.StatusBadRequest, msgEndpointField, msgParams{"reason": err.Error()}, gin.H{"fields": map[string]string{"endpoint": endpointErr.Reason}})
+	default:
+		writeGinMessage(c, http.StatusBadRequest, msgInvalidAction, msgParams{"action": "configure remote access", "reason": err.Error()})
+	}
 }
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/app"
+	"piccolod/internal/health"
+	"piccolod/internal/runtime/supervisor"
+)
+
+const (
+	// containerRuntimeInterval is how often Podman is pinged.
+	containerRuntimeInterval = 30 * time.Second
+	// containerRuntimeErrorAfter is how many failed pings in a row turn the
+	// container-runtime health component from warn to error.
+	containerRuntimeErrorAfter = 3
+)
+
+// newContainerRuntimeMonitor registers a supervisor component that pings the
+// container runtime every interval, starting at once.
+func (s *GinServer) newContainerRuntimeMonitor(interval time.Duration) supervisor.Component {
+	monitor := &containerRuntimeMonitor{s: s, interval: interval}
+	return supervisor.NewComponent("container-runtime", monitor.start, monitor.stop)
+}
+
+type containerRuntimeMonitor struct {
+	s        *GinServer
+	interval time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func (m *containerRuntimeMonitor) start(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.s.checkContainerRuntime(runCtx)
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *containerRuntimeMonitor) stop(context.Context) error {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+	return nil
+}
+
+// checkContainerRuntime pings the runtime and reflects the outcome in the
+// container-runtime health component. A single failed ping only warns:
+// Podman may be restarting.
+func (s *GinServer) checkContainerRuntime(ctx context.Context) app.RuntimeStatus {
+	if s.appManager == nil {
+		return app.RuntimeStatus{}
+	}
+	pctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	st := s.appManager.PingRuntime(pctx)
+	if ctx.Err() != nil || s.healthTracker == nil {
+		return st
+	}
+	status := health.Status{
+		Level:   health.LevelOK,
+		Message: "podman " + st.Version + " reachable",
+		Details: map[string]interface{}{"version": st.Version, "rootless": st.Rootless},
+	}
+	if !st.Reachable {
+		status.Level = health.LevelWarn
+		if st.Failures >= containerRuntimeErrorAfter {
+			status.Level = health.LevelError
+		}
+		status.Message = fmt.Sprintf("podman unreachable (%d failed pings): %s", st.Failures, st.LastError)
+		status.Details = map[string]interface{}{"consecutive_failures": st.Failures}
+	}
+	s.healthTracker.Set("container-runtime", status)
+	return st
+}
+
+// handleSystemRuntime: GET /api/v1/system/runtime
+func (s *GinServer) handleSystemRuntime(c *gin.Context) {
+	if s.appManager == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "app manager unavailable")
+		return
+	}
+	st := s.appManager.RuntimeStatus()
+	if c.Query("refresh") == "1" || st.LastPing == nil {
+		st = s.checkContainerRuntime(c.Request.Context())
+	}
+	c.JSON(http.StatusOK, st)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"piccolod/internal/app"
+	"piccolod/internal/health"
+	"piccolod/internal/runtime/supervisor"
+)
+
+func TestContainerRuntimeHealthFlipsOnPersistentPingFailures(t *testing.T) {
+	mock := &GinMockContainerManager{containers: make(map[string]*MockContainer), nextID: 1}
+	srv := createGinTestServerWithContainers(t, t.TempDir(), mock)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	srv.supervisor = supervisor.New(supervisor.Options{})
+	srv.supervisor.Register(srv.newContainerRuntimeMonitor(5 * time.Millisecond))
+	if err := srv.supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.supervisor.Stop(context.Background())
+
+	waitLevel := func(want health.Level) health.Status {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			st, ok := srv.healthTracker.Status("container-runtime")
+			if ok && st.Level == want {
+				return st
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("container-runtime never reached %s, last %+v", want, st)
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	waitLevel(health.LevelOK)
+
+	mock.setPingError(errors.New("podman info failed: connection refused"))
+	st := waitLevel(health.LevelError)
+	if st.Details["consecutive_failures"].(int) < containerRuntimeErrorAfter {
+		t.Fatalf("flipped to error too early: %+v", st)
+	}
+
+	getRuntime := func() app.RuntimeStatus {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/system/runtime", nil)
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("runtime: %d body=%s", w.Code, w.Body.String())
+		}
+		var out app.RuntimeStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode runtime: %v", err)
+		}
+		return out
+	}
+	down := getRuntime()
+	if down.Reachable || down.LastError == "" || down.Version != "5.0.0-mock" || down.LastPing == nil || down.LastSuccess == nil {
+		t.Fatalf("unexpected runtime while down: %+v", down)
+	}
+
+	mock.setPingError(nil)
+	waitLevel(health.LevelOK)
+	up := getRuntime()
+	if !up.Reachable || up.Failures != 0 || up.SocketPath != "/run/podman/podman.sock" {
+		t.Fatalf("unexpected runtime after recovery: %+v", up)
+	}
+}
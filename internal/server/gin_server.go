@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"piccolod/internal/activity"
 	"piccolod/internal/api"
 	"piccolod/internal/app"
 	authpkg "piccolod/internal/auth"
@@ -21,17 +22,25 @@ import (
 	"piccolod/internal/consensus"
 	"piccolod/internal/container"
 	crypt "piccolod/internal/crypt"
+	"piccolod/internal/diag"
+	"piccolod/internal/doctor"
 	"piccolod/internal/events"
 	"piccolod/internal/health"
+	"piccolod/internal/identity"
+	"piccolod/internal/jobs"
 	"piccolod/internal/mdns"
+	"piccolod/internal/network"
+	"piccolod/internal/notify"
 	"piccolod/internal/persistence"
 	"piccolod/internal/remote"
 	"piccolod/internal/remote/nexusclient"
 	"piccolod/internal/router"
 	"piccolod/internal/runtime/commands"
 	"piccolod/internal/runtime/supervisor"
+	"piccolod/internal/runtime/watchdog"
 	"piccolod/internal/services"
 	"piccolod/internal/state/paths"
+	"piccolod/internal/update"
 
 	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/gin-contrib/gzip"
@@ -45,12 +54,27 @@ const (
 	maxStaticAssetPathLen = 4 * 1024 // guard against path-based DoS
 )
 
+// remoteCloseTimeout bounds how long shutdown waits for in-flight
+// certificate issuance.
+const remoteCloseTimeout = 10 * time.Second
+
 var errInvalidStaticPath = errors.New("invalid static asset path")
 
 type unlockReloader interface {
 	ReloadFromStorage() error
 }
 
+// unlockReloaderFunc adapts a function into an unlockReloader.
+type unlockReloaderFunc func() error
+
+func (f unlockReloaderFunc) ReloadFromStorage() error { return f() }
+
+// namedReloader is an unlockReloader with the name its unlock step shows.
+type namedReloader struct {
+	name string
+	unlockReloader
+}
+
 // GinServer holds all the core components for our application using Gin framework.
 type GinServer struct {
 	appManager     *app.AppManager
@@ -61,6 +85,8 @@ type GinServer struct {
 	remoteManager  *remote.Manager
 	router         *gin.Engine
 	version        string
+	buildCommit    string
+	buildDate      string
 	events         *events.Bus
 	leadership     *cluster.Registry
 	supervisor     *supervisor.Supervisor
@@ -69,13 +95,33 @@ type GinServer struct {
 	tlsMux         *services.TlsMux
 	remoteResolver *serviceRemoteResolver
 
+	servicesViewOnce sync.Once
+	servicesView     *servicesView
+
+	// jobRegistry tracks background work such as image pulls and exports.
+	jobsOnce    sync.Once
+	jobRegistry *jobs.Registry
+
 	secureSrv      *http.Server
 	secureListener net.Listener
 	securePort     int
+	secureActive   bool
+	// secureSocket serves the secure handler on a Unix socket in runtimeDir
+	// while the loopback listener runs.
+	secureSocket     net.Listener
+	secureSocketPath string
+	// runtimeDir receives the loopback port, CLI token and socket files;
+	// empty disables CLI access.
+	runtimeDir string
+	cliToken   string
 
 	// Optional OpenAPI request validation (Phase 0)
 	apiValidator *openAPIValidator
 
+	// capabilities is built once the routes are set up; see
+	// buildCapabilities.
+	capabilities map[string]any
+
 	// Auth & sessions (Phase 1)
 	authManager *authpkg.Manager
 	sessions    *authpkg.SessionStore
@@ -86,15 +132,96 @@ type GinServer struct {
 	// Crypto manager for lock/unlock of app data volumes
 	cryptoManager *crypt.Manager
 	healthTracker *health.Tracker
+	// coreVolumes tracks the control and bootstrap volumes; see
+	// wireCoreVolumes.
+	coreVolumes coreVolumes
 
 	reloadersMu     sync.RWMutex
-	unlockReloaders []unlockReloader
+	unlockReloaders []namedReloader
+	unlockProgress  *unlockTracker
+
+	activity      *activity.Service
+	osUpdates     *update.Manager
+	selfUpdate    *update.SelfUpdater
+	notifications *notify.Manager
+
+	// identity owns the device name; nameAdvertiser publishes it on the
+	// local network and is nil when mDNS is disabled.
+	identity       *identity.Manager
+	nameAdvertiser deviceNameAdvertiser
+	// mdnsAddresses reports the advertised addresses; nil when mDNS is
+	// disabled.
+	mdnsAddresses mdnsAddressReporter
+
+	// sessionPolicies overrides the control-store session policy repository.
+	sessionPolicies persistence.SessionPolicyRepo
+	// apiTokens overrides the control-store API token repository.
+	apiTokens persistence.APITokenRepo
+
+	// subscriptions release the bus observers registered by subscribe.
+	subscriptionsMu sync.Mutex
+	subscriptions   []func()
+
+	// listeners holds the admin HTTP sockets once Start runs; networkMu
+	// guards the settings they were planned from.
+	networkMu       sync.Mutex
+	listeners       *httpListenerSet
+	listenPort      string
+	listenSettings  network.ListenSettings
+	listenSource    string
+	networkSettings persistence.NetworkSettingsRepo
+	// acmePort is where HTTP-01 challenges arrive; acmeListenErr is why
+	// the dedicated listener there could not be bound, if it could not.
+	acmePort      string
+	acmeListenErr error
+
+	// corsMu guards the active CORS policy; corsPolicies overrides the
+	// control-store repository.
+	corsMu       sync.RWMutex
+	corsActive   corsPolicy
+	corsPatterns []originPattern
+	corsSource   string
+	corsPolicies persistence.CORSPolicyRepo
+
+	// portPolicyMu guards portPolicySource; portPolicies overrides the
+	// control-store repository.
+	portPolicyMu     sync.Mutex
+	portPolicySource string
+	portPolicies     persistence.PortPolicyRepo
+
+	// mountAllowlists overrides the control-store repository.
+	mountAllowlists persistence.MountAllowlistRepo
+	// appPolicies overrides the control-store repository.
+	appPolicies persistence.AppPolicyRepo
+
+	// staticAssets serves the embedded portal UI.
+	staticAssets *staticAssets
+
+	// trustedProxies gates which peers may set X-Forwarded-* headers.
+	trustedProxies *network.TrustedProxies
+
+	// logRing holds recent log lines for debug bundles; nil when the daemon
+	// log is not captured.
+	logRing *diag.LogRing
+
+	debugBundleMu   sync.Mutex
+	lastDebugBundle time.Time
+
+	// doctor runs the environment checks; nil in tests that do not need it.
+	doctor *doctor.Runner
+
+	// watchdog notifies systemd while the liveness probes pass; nil when
+	// systemd runs no watchdog for us.
+	watchdog *watchdog.Watchdog
 }
 
 type secureContextKey struct{}
 
 var secureContextKeyInstance = secureContextKey{}
 
+// unixSocketContextKey marks connections accepted on the secure Unix socket.
+type unixSocketContextKey struct{}
+
 // portUnpublisherFunc adapts a function into services.PortUnpublisher.
 type portUnpublisherFunc func(int)
 
@@ -105,6 +232,52 @@ type portPublisherFunc func(int)
 
 func (f portPublisherFunc) Publish(p int) { f(p) }
 
+// serviceStatsStore adapts the control-store stats repo to services.StatsStore.
+type serviceStatsStore struct{ repo persistence.ServiceStatsRepo }
+
+func (s serviceStatsStore) LoadServiceStats(ctx context.Context) ([]services.EndpointStats, error) {
+	records, err := s.repo.LoadServiceStats(ctx)
+	if err != nil {
+		return nil, translateStatsErr(err)
+	}
+	out := make([]services.EndpointStats, 0, len(records))
+	for _, rec := range records {
+		out = append(out, services.EndpointStats{
+			App:              rec.App,
+			Listener:         rec.Listener,
+			BytesIn:          rec.BytesIn,
+			BytesOut:         rec.BytesOut,
+			TotalConnections: rec.TotalConnections,
+			LastActivity:     rec.LastActivity,
+		})
+	}
+	return out, nil
+}
+
+func (s serviceStatsStore) SaveServiceStats(ctx context.Context, stats []services.EndpointStats) error {
+	records := make([]persistence.ServiceStatsRecord, 0, len(stats))
+	for _, st := range stats {
+		records = append(records, persistence.ServiceStatsRecord{
+			App:              st.App,
+			Listener:         st.Listener,
+			BytesIn:          st.BytesIn,
+			BytesOut:         st.BytesOut,
+			TotalConnections: st.TotalConnections,
+			LastActivity:     st.LastActivity,
+		})
+	}
+	return translateStatsErr(s.repo.SaveServiceStats(ctx, records))
+}
+
+// translateStatsErr maps transient persistence states onto the services
+// sentinel so the snapshot loop retries quietly.
+func translateStatsErr(err error) error {
+	if errors.Is(err, persistence.ErrLocked) || errors.Is(err, persistence.ErrNotLeader) || errors.Is(err, persistence.ErrNotImplemented) {
+		return services.ErrStatsStoreUnavailable
+	}
+	return err
+}
+
 type serviceRemoteResolver struct {
 	services   *services.ServiceManager
 	mu         sync.RWMutex
@@ -112,6 +285,9 @@ type serviceRemoteResolver struct {
 	portal     string
 	port       int
 	tlsMuxPort int
+	aliases    map[string]string // custom hostname → listener
+	redirects  map[string]string // custom hostname → redirect target
+	advertised map[int]int       // remote→local ports last handed to the nexus adapter
 }
 
 func newServiceRemoteResolver(svc *services.ServiceManager) *serviceRemoteResolver {
@@ -137,16 +313,70 @@ func (r *serviceRemoteResolver) UpdateConfig(cfg nexusclient.Config) {
 	r.mu.Unlock()
 }
 
+// UpdateAliases replaces the custom hostname table from the remote alias
+// inventory.
+func (r *serviceRemoteResolver) UpdateAliases(aliases []remote.Alias) {
+	table := aliasTable(aliases)
+	redirects := aliasRedirects(aliases)
+	r.mu.Lock()
+	r.aliases = table
+	r.redirects = redirects
+	r.mu.Unlock()
+}
+
+// aliasTable maps every alias name to its listener. Names that redirect
+// route to the portal, where the redirect is answered.
+func aliasTable(aliases []remote.Alias) map[string]string {
+	table := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		for _, name := range a.Names() {
+			host := strings.TrimSuffix(strings.ToLower(name), ".")
+			if host == "" || a.Listener == "" {
+				continue
+			}
+			if a.RedirectFor(name) != "" {
+				table[host] = "portal"
+			} else {
+				table[host] = a.Listener
+			}
+		}
+	}
+	return table
+}
+
+// aliasRedirects maps alias names that redirect to their target hostname.
+func aliasRedirects(aliases []remote.Alias) map[string]string {
+	table := make(map[string]string)
+	for _, a := range aliases {
+		for _, name := range a.Names() {
+			if target := a.RedirectFor(name); target != "" {
+				table[strings.TrimSuffix(strings.ToLower(name), ".")] = target
+			}
+		}
+	}
+	return table
+}
+
+// RedirectTarget returns the hostname requests for host are redirected to,
+// or "" when host is not a redirecting alias.
+func (r *serviceRemoteResolver) RedirectTarget(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.redirects[host]
+}
+
 func (r *serviceRemoteResolver) IsRemoteHostname(host string) bool {
 	host = strings.TrimSuffix(strings.ToLower(host), ".")
 	r.mu.RLock()
 	portal := r.portal
 	domain := r.domain
+	_, isAlias := r.aliases[host]
 	r.mu.RUnlock()
 	if host == "" {
 		return false
 	}
-	if portal != "" && host == portal {
+	if (portal != "" && host == portal) || isAlias {
 		return true
 	}
 	if domain != "" {
@@ -160,16 +390,28 @@ func (r *serviceRemoteResolver) IsRemoteHostname(host string) bool {
 	return false
 }
 
+// PortalHostname returns the remote portal hostname, or "" before remote
+// access is configured.
+func (r *serviceRemoteResolver) PortalHostname() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.portal
+}
+
 func (r *serviceRemoteResolver) SetTlsMuxPort(p int) { r.mu.Lock(); r.tlsMuxPort = p; r.mu.Unlock() }
 
-func (r *serviceRemoteResolver) RecordConnectionHint(localPort, sourcePort, remotePort int, isTLS bool) {
+func (r *serviceRemoteResolver) RecordConnectionHint(localPort, sourcePort, remotePort int, isTLS bool, clientIP string) {
 	if r.services == nil || sourcePort <= 0 {
 		return
 	}
-	if localPort == r.port {
+	r.services.RegisterProxyHint(localPort, sourcePort, remotePort, isTLS, clientIP)
+}
+
+func (r *serviceRemoteResolver) ForgetConnectionHint(localPort, sourcePort int) {
+	if r.services == nil {
 		return
 	}
-	r.services.RegisterProxyHint(localPort, sourcePort, remotePort, isTLS)
+	r.services.ForgetProxyHint(localPort, sourcePort)
 }
 
 func (r *serviceRemoteResolver) Resolve(hostname string, remotePort int, isTLS bool) (int, bool) {
@@ -179,6 +421,7 @@ func (r *serviceRemoteResolver) Resolve(hostname string, remotePort int, isTLS b
 	domain := r.domain
 	portalPort := r.port
 	tlsMuxPort := r.tlsMuxPort
+	alias, isAlias := r.aliases[h]
 	r.mu.RUnlock()
 
 	normPort := remotePort
@@ -187,7 +430,10 @@ func (r *serviceRemoteResolver) Resolve(hostname string, remotePort int, isTLS b
 	}
 
 	// Portal host: treat as flow=tcp (device-terminated TLS when not 80)
-	if portal != "" && h == portal {
+	if (portal != "" && h == portal) || (isAlias && alias == "portal") {
+		// Tunnelled port-80 traffic goes to the admin port even when PORT is
+		// not 80: its router answers challenges and redirects like the
+		// dedicated HTTP-01 listener, which only serves direct traffic.
 		if normPort == 80 {
 			return portalPort, true
 		}
@@ -199,6 +445,13 @@ func (r *serviceRemoteResolver) Resolve(hostname string, remotePort int, isTLS b
 	}
 
 	listener := ""
+	if isAlias {
+		// Custom domains route only to the listener they were bound to.
+		if ep, ok := r.services.ResolveListener(alias, normPort); ok {
+			return endpointPort(ep, normPort, isTLS, tlsMuxPort)
+		}
+		return 0, false
+	}
 	if domain != "" {
 		suffix := "." + domain
 		if strings.HasSuffix(h, suffix) {
@@ -214,37 +467,87 @@ func (r *serviceRemoteResolver) Resolve(hostname string, remotePort int, isTLS b
 
 	// Listener host
 	if listener != "" {
-		if ep, ok := r.services.ResolveListener(listener, normPort); ok {
-			if ep.Flow == api.FlowTLS {
-				return ep.PublicPort, true
-			}
-			if normPort == 80 {
-				return ep.PublicPort, true
-			}
-			if isTLS && tlsMuxPort > 0 {
-				return tlsMuxPort, true
-			}
-			return ep.PublicPort, true
+		if ep, ok := r.services.ResolveRemoteLabel(listener, normPort); ok {
+			return endpointPort(ep, normPort, isTLS, tlsMuxPort)
 		}
 	}
 
 	// Fallback by port only (rare): apply same flow policy when we find an ep
 	if ep, ok := r.services.ResolveByRemotePort(normPort); ok {
-		if ep.Flow == api.FlowTLS {
-			return ep.PublicPort, true
-		}
-		if normPort == 80 {
-			return ep.PublicPort, true
-		}
-		if isTLS && tlsMuxPort > 0 {
-			return tlsMuxPort, true
-		}
-		return ep.PublicPort, true
+		return endpointPort(ep, normPort, isTLS, tlsMuxPort)
 	}
 
 	return 0, false
 }
 
+// endpointPort applies a listener's flow policy: flow=tls and plain HTTP go
+// straight to the proxy, other TLS connections terminate at the TLS mux.
+func endpointPort(ep services.ServiceEndpoint, normPort int, isTLS bool, tlsMuxPort int) (int, bool) {
+	if ep.Protocol.Passthrough() {
+		return passthroughPort(ep)
+	}
+	if ep.Flow == api.FlowTLS {
+		return ep.PublicPort, true
+	}
+	if normPort == 80 {
+		return ep.PublicPort, true
+	}
+	if isTLS && tlsMuxPort > 0 {
+		return tlsMuxPort, true
+	}
+	return ep.PublicPort, true
+}
+
+// passthroughPort routes raw tcp listeners straight to their proxy, never via
+// the TLS mux. Nexus only carries streams, so udp listeners are not reachable.
+func passthroughPort(ep services.ServiceEndpoint) (int, bool) {
+	if ep.Protocol == api.ListenerProtocolUDP {
+		return 0, false
+	}
+	return ep.PublicPort, true
+}
+
+// RemotePortMappings lists the extra remote ports requested by raw tcp
+// listeners so the nexus backend can advertise them alongside 80/443.
+func (r *serviceRemoteResolver) RemotePortMappings() map[int]int {
+	out := r.currentPortMappings()
+	r.mu.Lock()
+	r.advertised = out
+	r.mu.Unlock()
+	return out
+}
+
+func (r *serviceRemoteResolver) currentPortMappings() map[int]int {
+	out := make(map[int]int)
+	if r.services == nil {
+		return out
+	}
+	for remotePort, ep := range r.services.PassthroughRemotePorts() {
+		if ep.Protocol == api.ListenerProtocolUDP {
+			continue
+		}
+		out[remotePort] = ep.PublicPort
+	}
+	return out
+}
+
+// PortMappingsStale reports whether listener changes have altered the remote
+// ports since the adapter last read them.
+func (r *serviceRemoteResolver) PortMappingsStale() bool {
+	current := r.currentPortMappings()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(current) != len(r.advertised) {
+		return true
+	}
+	for remotePort, local := range current {
+		if r.advertised[remotePort] != local {
+			return true
+		}
+	}
+	return false
+}
+
 // GinServerOption is a function that configures a GinServer.
 type GinServerOption func(*GinServer)
 
@@ -263,7 +566,7 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 	// Initialize shared infrastructure
 	eventsBus := events.NewBus()
 	leadershipReg := cluster.NewRegistry()
-	sup := supervisor.New()
+	sup := supervisor.New(supervisor.Options{})
 	dispatch := commands.NewDispatcher()
 	consensusMgr := consensus.NewStub(leadershipReg, eventsBus)
 	stateDir := paths.Root()
@@ -272,6 +575,11 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 		return nil, fmt.Errorf("crypto manager init: %w", err)
 	}
 	healthTracker := health.NewTracker()
+	if os.Getenv("PICCOLO_HEALTH_FLAP_BLOCKS_READY") == "1" {
+		policy := health.DefaultFlapPolicy()
+		policy.BlocksReadiness = true
+		healthTracker.SetFlapPolicy(policy)
+	}
 
 	// Initialize app manager with filesystem state management
 	svcMgr := services.NewServiceManager()
@@ -286,7 +594,9 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 		return nil, fmt.Errorf("failed to init app manager: %w", err)
 	}
 	appMgr.ObserveRuntimeEvents(eventsBus)
+	appMgr.StartTaskScheduler()
 	appMgr.SetRouter(routeMgr)
+	svcMgr.SetRouteResolver(routeMgr)
 
 	// Initialize persistence module (skeleton; concrete components wired later)
 	persist, err := persistence.NewService(persistence.Options{
@@ -301,16 +611,14 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 		return nil, fmt.Errorf("failed to init persistence module: %w", err)
 	}
 
-	controlDir := persist.ControlVolume().MountDir
-	if strings.TrimSpace(controlDir) == "" {
-		return nil, fmt.Errorf("control volume mount unavailable")
-	}
-	// NOTE: Today we do not migrate existing app state into the control volume because we have
-	// no pre-existing deployments. If that assumption changes we must add a migration path,
-	// otherwise legacy installations would appear empty after upgrade.
-	appMgr.SetStateBaseDir(controlDir)
 	appMgr.SetLockReader(persist)
 	svcMgr.SetLockReader(persist)
+	trustedProxies, err := network.TrustedProxiesFromEnv()
+	if err != nil {
+		log.Printf("WARN: ignoring %s: %v", network.TrustedProxiesEnv, err)
+		trustedProxies = network.DefaultTrustedProxies()
+	}
+	svcMgr.ProxyManager().SetTrustedProxies(trustedProxies)
 
 	// Set Gin to release mode for production (can be overridden by GIN_MODE env var)
 	gin.SetMode(gin.ReleaseMode)
@@ -338,7 +646,18 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 		dispatcher:     dispatch,
 		cryptoManager:  cmgr,
 		healthTracker:  healthTracker,
-	}
+		trustedProxies: trustedProxies,
+		runtimeDir:     paths.RunDir(),
+		unlockProgress: newUnlockTracker(persist.ControlVolume().ID, persist.BootstrapVolume().ID),
+	}
+	if mdnsMgr != nil {
+		s.nameAdvertiser = mdnsMgr
+		s.mdnsAddresses = mdnsMgr
+		mdnsMgr.SetReannounceHook(s.reportMDNSAddresses)
+	}
+	appMgr.SetVolumePurger(s.purgeAppVolume)
+	appMgr.SetUnlockObserver(s.unlockProgress.observeApp)
+	registerWatchdogPing(dispatch)
 	// Seed baseline health statuses
 	healthTracker.Setf("http", health.LevelOK, "HTTP server initialized")
 	healthTracker.Setf("app-manager", health.LevelWarn, "app manager gated by lock state")
@@ -350,28 +669,57 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 	}
 	healthTracker.Setf("remote", health.LevelWarn, "remote manager initializing")
 	healthTracker.Setf("persistence", health.LevelWarn, "control store locked")
+	healthTracker.Setf("os-update", health.LevelOK, "no os update pending")
+	healthTracker.Setf("container-runtime", health.LevelWarn, "container runtime not checked yet")
+	// A missing or read-only core volume degrades the server rather than
+	// stopping it; the storage component stays in error until it mounts.
+	if err := s.wireCoreVolumes(); err != nil {
+		return nil, err
+	}
 
 	if !mdnsDisabled {
 		s.supervisor.Register(supervisor.NewComponent("mdns", func(ctx context.Context) error {
-			return s.mdnsManager.Start()
+			if err := s.mdnsManager.Start(); err != nil {
+				return err
+			}
+			s.reportMDNSAddresses(s.mdnsManager.Addresses())
+			return nil
 		}, func(ctx context.Context) error {
 			return s.mdnsManager.Stop()
 		}))
 	}
 
-	s.supervisor.Register(supervisor.NewComponent("service-manager", func(ctx context.Context) error {
+	// Stop tears down every proxy and event observer, so the service manager
+	// only restarts with the daemon.
+	s.supervisor.Register(supervisor.Once(supervisor.NewComponent("service-manager", func(ctx context.Context) error {
 		s.serviceManager.StartBackground()
+		s.serviceManager.StartStatsPersistence(serviceStatsStore{repo: s.persistence.Control().ServiceStats()}, services.DefaultStatsSnapshotInterval)
 		return nil
 	}, func(ctx context.Context) error {
 		s.serviceManager.Stop()
 		return nil
-	}))
+	}, supervisor.Critical())))
+	// Rehydrate proxies for containers that survived restarts; without the
+	// control volume this waits for coreVolumeMounted.
+	s.supervisor.Register(supervisor.Once(supervisor.NewComponent("app-services", func(ctx context.Context) error {
+		if len(s.coreVolumes.problems()) == 0 {
+			s.appManager.RestoreServices(ctx)
+		}
+		return nil
+	}, nil, supervisor.DependsOn("service-manager"))))
 
-	s.supervisor.Register(supervisor.NewComponent("consensus", consensusMgr.Start, consensusMgr.Stop))
+	s.supervisor.Register(s.newContainerRuntimeMonitor(containerRuntimeInterval))
+	s.supervisor.Register(supervisor.NewComponent("consensus", consensusMgr.Start, consensusMgr.Stop, supervisor.Critical()))
 	s.supervisor.Register(newLeadershipObserver(eventsBus))
 	s.observeLockState(eventsBus)
+	s.observeUnlockVolumes(eventsBus)
 	s.observeLeadership(eventsBus)
 	s.observeRemoteConfig(eventsBus)
+	s.observeServiceChanges(eventsBus)
+	s.observeOSUpdates(eventsBus)
+	s.observeStorageSpace(eventsBus)
+	s.observeControlHealth(eventsBus)
+	s.observeCoreVolumes(eventsBus)
 
 	for _, opt := range opts {
 		opt(s)
@@ -392,31 +740,59 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 	s.authManager = am
 	s.sessions = authpkg.NewSessionStore()
 	s.authRepo = authRepo
-
-	// Remote manager
-	bootstrapDir := persist.BootstrapVolume().MountDir
-	if strings.TrimSpace(bootstrapDir) == "" {
-		return nil, fmt.Errorf("bootstrap volume mount unavailable")
-	}
-	remoteStorage := newBootstrapRemoteStorage(persist.Control().Remote(), bootstrapDir)
-	var rm *remote.Manager
-	if remoteStorage != nil {
-		rm, err = remote.NewManagerWithStorage(remoteStorage, bootstrapDir)
-	} else {
-		rm, err = remote.NewManager(bootstrapDir)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("remote manager init: %w", err)
-	}
-	s.remoteManager = rm
-	s.registerUnlockReloader(rm)
+	if err := s.reloadSessionPolicy(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: session policy load failed: %v", err)
+	}
+	s.registerUnlockReloader("session-policy", unlockReloaderFunc(s.reloadSessionPolicy))
+	s.initListenSettings()
+	if err := s.reloadNetworkSettings(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: network settings load failed: %v", err)
+	}
+	s.registerUnlockReloader("network-settings", unlockReloaderFunc(s.reloadNetworkSettings))
+	s.doctor = s.newDoctor()
+	if err := s.reloadCORSPolicy(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: cors policy load failed: %v", err)
+	}
+	s.registerUnlockReloader("cors-policy", unlockReloaderFunc(s.reloadCORSPolicy))
+	s.serviceManager.SetOccupiedPortStore(occupiedPortStore{s: s})
+	if err := s.reloadPortPolicy(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: port policy load failed: %v", err)
+	}
+	s.registerUnlockReloader("port-policy", unlockReloaderFunc(s.reloadPortPolicy))
+	if err := s.reloadMountAllowlist(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: mount allowlist load failed: %v", err)
+	}
+	s.registerUnlockReloader("mount-allowlist", unlockReloaderFunc(s.reloadMountAllowlist))
+	if err := s.reloadAppPolicy(); err != nil && !errors.Is(err, persistence.ErrLocked) {
+		log.Printf("WARN: app policy load failed: %v", err)
+	}
+	s.registerUnlockReloader("app-policy", unlockReloaderFunc(s.reloadAppPolicy))
+
+	// Remote manager, started by wireCoreVolumes. Without a bootstrap
+	// volume the device name is not mirrored for pre-unlock use.
+	s.identity = identity.NewManager(persist.Control().Identity(), s.coreVolumes.dir(volumeBootstrap))
+	s.registerUnlockReloader("identity", unlockReloaderFunc(s.reloadIdentity))
+	s.advertiseDeviceName()
+	rm := s.remoteManager
+	s.registerUnlockReloader("remote", rm)
+	rm.SetListenerLookup(svcMgr)
+	rm.SetKeySealer(cmgr)
 	rm.SetEventsBus(eventsBus)
+	rm.SetDefaultPortalLabel(s.deviceName)
+	rm.SetHTTP01ListenerCheck(s.acmeListenerCheck)
 	// Now that remote manager exists, wire ACME challenge handler and cert provider
 	if rm != nil && svcMgr != nil {
 		svcMgr.ProxyManager().SetAcmeHandler(rm.HTTPChallengeHandler())
 		certProv := remote.NewFileCertProvider(rm.CertDirectory())
+		certProv.SetKeySealer(cmgr)
 		tlsMux.SetCertProvider(certProv)
+		rm.AttachCertProvider(certProv)
 	}
+	// Certificates start out on the bootstrap volume and move into the
+	// control volume the first time it is unlocked.
+	s.registerUnlockReloader("cert-storage", unlockReloaderFunc(func() error {
+		return rm.SetEncryptedRoot(s.coreVolumes.dir(volumeControl))
+	}))
 	var nexusAdapter nexusclient.Adapter
 	if os.Getenv("PICCOLO_NEXUS_USE_STUB") == "1" {
 		nexusAdapter = nexusclient.NewStub()
@@ -425,15 +801,50 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 	}
 	rm.SetNexusAdapter(nexusAdapter)
 	remote.RegisterHandlers(dispatch, rm)
-	s.healthTracker.Setf("remote", health.LevelOK, "remote manager ready")
+	s.attachActivityLog(activity.NewService(persist.Control().Activity()))
+	s.osUpdates = update.NewManager(update.TransactionalUpdate{}, persist.Control().OSUpdates(), eventsBus)
+	s.registerUnlockReloader("os-updates", s.osUpdates)
+	// Self-update stays disabled unless a manifest URL is configured and the
+	// build embeds a release key.
+	s.selfUpdate = update.NewSelfUpdater(update.SelfUpdaterOptions{
+		ManifestURL: os.Getenv("PICCOLO_UPDATE_MANIFEST_URL"),
+		PublicKey:   update.EmbeddedReleaseKey(),
+		Binary:      update.BinaryPath(),
+		Current:     s.version,
+		Restarter:   update.SystemdRestarter{},
+		Repo:        persist.Control().SelfUpdate(),
+		Bus:         eventsBus,
+	})
+	s.registerUnlockReloader("self-update", s.selfUpdate)
+	s.notifications = notify.NewManager(persist.Control().Notifications())
+	s.registerUnlockReloader("notifications", s.notifications)
+	s.notifications.Observe(eventsBus)
+	s.supervisor.Register(supervisor.Once(supervisor.NewComponent("notifications", func(ctx context.Context) error {
+		s.notifications.Start()
+		return nil
+	}, func(ctx context.Context) error {
+		s.notifications.Stop()
+		return nil
+	})))
+	// Registered last so it stops first, before storage goes away.
+	s.supervisor.Register(supervisor.Once(supervisor.NewComponent("remote", func(ctx context.Context) error {
+		return nil
+	}, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, remoteCloseTimeout)
+		defer cancel()
+		return rm.Close(ctx)
+	})))
+	if s.coreVolumes.pending(volumeBootstrap) {
+		s.healthTracker.Setf("remote", health.LevelError, "remote manager waiting for the bootstrap volume")
+	} else {
+		s.healthTracker.Setf("remote", health.LevelOK, "remote manager ready")
+	}
 	s.refreshRemoteRuntime()
 
 	// (Simplified) No dynamic port publish/unpublish wiring; allow dial to fail gracefully.
 
-	// Rehydrate proxies for containers that survived restarts
-	appMgr.RestoreServices(context.Background())
-
 	s.setupGinRoutes()
+	s.capabilities = s.buildCapabilities()
 	if err := s.initSecureLoopback(); err != nil {
 		return nil, fmt.Errorf("secure loopback init: %w", err)
 	}
@@ -442,18 +853,26 @@ func NewGinServer(opts ...GinServerOption) (*GinServer, error) {
 
 // Start runs the Gin HTTP server and starts mDNS advertising.
 func (s *GinServer) Start() error {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "80"
-	}
-
-	if err := s.supervisor.Start(context.Background()); err != nil {
+	err := s.supervisor.Start(context.Background())
+	s.reportRuntimeStartup()
+	if err != nil {
 		return fmt.Errorf("failed to start runtime components: %w", err)
 	}
 
 	s.startSecureLoopback()
+	go s.runStartupDoctor()
+
+	s.networkMu.Lock()
+	s.listeners = newHTTPListenerSet(s.router, acmeOnlyHandler(s.remoteManager.HTTPChallengeHandler())).
+		withRedirect(acmeRedirectHandler(s.remoteManager.HTTPChallengeHandler(), s.httpsRedirectHost)).
+		withConnContext(s.portalConnContext)
+	err = s.applyListenSettingsLocked()
+	s.networkMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to bind HTTP listeners: %w", err)
+	}
 
-	log.Printf("INFO: Starting piccolod server with Gin on http://localhost:%s", port)
+	log.Printf("INFO: Starting piccolod server with Gin on http://localhost:%s", s.listenPort)
 
 	// Notify systemd that we're ready (for Type=notify services)
 	// This enables proper health checking and rollback functionality in MicroOS
@@ -462,31 +881,76 @@ func (s *GinServer) Start() error {
 	} else if sent {
 		log.Printf("INFO: Notified systemd that service is ready")
 	}
+	// Reaching readiness means a freshly swapped binary is good; drop the
+	// rollback marker so the next restart does not restore the old one.
+	update.ConfirmStartup(update.BinaryPath())
+	s.startWatchdog()
 
-	return s.router.Run(":" + port)
+	return s.listeners.Wait()
 }
 
 // Stop gracefully shuts down the server and all its components.
 func (s *GinServer) Stop() error {
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+	}
+	s.unsubscribeAll()
 	if s.appManager != nil {
 		s.appManager.StopRuntimeEvents()
+		s.appManager.StopTaskScheduler()
+		s.appManager.StopLogCapture()
+	}
+	s.jobs().Close()
+	if s.listeners != nil {
+		s.listeners.Close()
 	}
 	s.stopSecureLoopback()
-	if err := s.supervisor.Stop(context.Background()); err != nil {
+	err := s.supervisor.Stop(context.Background())
+	if err != nil {
 		log.Printf("WARN: Failed to stop components cleanly: %v", err)
-		return err
 	}
-	return nil
+	// Persistence goes last: the components above may still write to the
+	// control store while stopping.
+	if s.persistence != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), persistenceCloseTimeout)
+		defer cancel()
+		if cerr := s.persistence.Close(ctx); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
+// persistenceCloseTimeout bounds the control store checkpoint and volume
+// detach on shutdown.
+const persistenceCloseTimeout = 30 * time.Second
+
 // setupGinRoutes defines all API endpoints using Gin router.
 func (s *GinServer) setupGinRoutes() {
 	r := gin.New()
+	// API paths are exact; a stray trailing slash is a 404 envelope, not a
+	// redirect.
+	r.RedirectTrailingSlash = false
+	if err := r.SetTrustedProxies(s.trustedProxies.CIDRs()); err != nil {
+		log.Printf("WARN: gin trusted proxies: %v", err)
+	}
 
 	// Add basic middleware
+	r.Use(requestIDMiddleware())
+	r.Use(s.clientContextMiddleware())
+	r.Use(s.cliAccessMiddleware())
 	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	r.Use(errorMiddleware())
+	if s.staticAssets == nil {
+		if web, err := fs.Sub(webassets.FS, "web"); err != nil {
+			log.Printf("WARN: embedded web assets unavailable: %v", err)
+		} else if assets, err := newStaticAssets(web); err != nil {
+			log.Printf("WARN: embedded web assets unavailable: %v", err)
+		} else {
+			s.staticAssets = assets
+		}
+	}
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithCustomShouldCompressFn(s.shouldGzip)))
 	r.Use(s.corsMiddleware())
 	r.Use(s.httpsRedirectMiddleware())
 	r.Use(s.securityHeadersMiddleware())
@@ -529,7 +993,7 @@ func (s *GinServer) setupGinRoutes() {
 			if b, err := loadOpenAPISpec(); err == nil {
 				c.Data(http.StatusOK, "application/yaml; charset=utf-8", b)
 			} else {
-				c.JSON(http.StatusNotFound, gin.H{"error": "spec not found"})
+				writeGinError(c, http.StatusNotFound, "spec not found")
 			}
 		})
 
@@ -539,13 +1003,16 @@ func (s *GinServer) setupGinRoutes() {
 		v1.POST("/auth/login", s.handleAuthLogin)
 		v1.POST("/auth/setup", s.handleAuthSetup)
 
-		// Selected read-only status endpoints remain public
-		v1.GET("/updates/os", s.handleOSUpdateStatus)
-		v1.GET("/remote/status", s.handleRemoteStatus)
-		v1.GET("/storage/disks", s.handleStorageDisks)
+		// First-boot wizard progress is public so the installer can resume.
+		v1.GET("/setup/status", s.handleSetupStatus)
+
+		// LAN discovery; see discoveryInfo for what may be exposed here.
+		v1.GET("/discovery", s.handleDiscovery)
+		v1.GET("/capabilities", s.handleCapabilities)
 		v1.GET("/health/live", s.handleHealthLive)
 		v1.GET("/health/ready", s.handleGinReadinessCheck)
 		v1.GET("/health/detail", s.handleHealthDetail)
+		v1.GET("/health/history", s.handleHealthHistory)
 
 		// Allow unlocking without a session to break the initial lock/setup cycle.
 		// Crypto: expose status/setup/unlock publicly to break circular dependency with sessions.
@@ -560,38 +1027,95 @@ func (s *GinServer) setupGinRoutes() {
 		authed.Use(s.requireSession())
 		authed.Use(s.csrfMiddleware())
 
-		// Crypto endpoints (session required for lock/recovery management)
-		authed.POST("/crypto/lock", s.handleCryptoLock)
-		authed.POST("/crypto/recovery-key/generate", s.handleCryptoRecoveryGenerate)
+		// Crypto endpoints (session required for lock/recovery management).
+		// A new recovery key can reset the admin password and a lock needs
+		// the password to undo, so neither is open to API tokens.
+		authed.POST("/crypto/lock", s.requireBrowserSession(), s.handleCryptoLock)
+		authed.GET("/crypto/unlock/status", s.handleCryptoUnlockStatus)
+		authed.POST("/crypto/recovery-key/generate", s.requireBrowserSession(), s.handleCryptoRecoveryGenerate)
 
 		// App management endpoints
 		apps := authed.Group("/apps")
+		apps.Use(s.requireStorage())
 		{
 			apps.POST("", s.requireUnlocked(), s.handleGinAppInstall)           // POST /api/v1/apps
 			apps.POST("/validate", s.handleGinAppValidate)                      // POST /api/v1/apps/validate
+			apps.POST("/start", s.requireUnlocked(), s.handleGinAppStartBatch)  // POST /api/v1/apps/start
+			apps.POST("/import", s.requireUnlocked(), s.handleGinAppImport)     // POST /api/v1/apps/import
 			apps.GET("", s.handleGinAppList)                                    // GET /api/v1/apps
 			apps.GET("/:name", s.handleGinAppGet)                               // GET /api/v1/apps/:name
 			apps.DELETE("/:name", s.requireUnlocked(), s.handleGinAppUninstall) // DELETE /api/v1/apps/:name
+			apps.GET("/:name/export", s.handleGinAppExport)                     // GET /api/v1/apps/:name/export
+			apps.POST("/:name/diff", s.handleGinAppDiff)                        // POST /api/v1/apps/:name/diff
+			apps.GET("/:name/history", s.handleGinAppHistory)                   // GET /api/v1/apps/:name/history
+			apps.GET("/:name/logs", s.handleGinAppLogs)                         // GET /api/v1/apps/:name/logs
 
 			// App actions
-			apps.POST("/:name/start", s.requireUnlocked(), s.handleGinAppStart) // POST /api/v1/apps/:name/start
-			apps.POST("/:name/stop", s.requireUnlocked(), s.handleGinAppStop)   // POST /api/v1/apps/:name/stop
+			apps.POST("/:name/start", s.requireUnlocked(), s.handleGinAppStart)       // POST /api/v1/apps/:name/start
+			apps.POST("/:name/stop", s.requireUnlocked(), s.handleGinAppStop)         // POST /api/v1/apps/:name/stop
+			apps.POST("/:name/pause", s.requireUnlocked(), s.handleGinAppPause)       // POST /api/v1/apps/:name/pause
+			apps.POST("/:name/unpause", s.requireUnlocked(), s.handleGinAppUnpause)   // POST /api/v1/apps/:name/unpause
+			apps.POST("/:name/recreate", s.requireUnlocked(), s.handleGinAppRecreate) // POST /api/v1/apps/:name/recreate
+			apps.PATCH("/:name/env", s.requireUnlocked(), s.handleGinAppEnv)          // PATCH /api/v1/apps/:name/env
+			apps.POST("/:name/enable", s.requireUnlocked(), s.handleGinAppEnable)     // POST /api/v1/apps/:name/enable
+			apps.POST("/:name/disable", s.requireUnlocked(), s.handleGinAppDisable)   // POST /api/v1/apps/:name/disable
+
+			// Scheduled tasks
+			apps.GET("/:name/tasks", s.handleGinAppTasks)                                   // GET /api/v1/apps/:name/tasks
+			apps.POST("/:name/tasks/:task/run", s.requireUnlocked(), s.handleGinAppTaskRun) // POST /api/v1/apps/:name/tasks/:task/run
+		}
+
+		// OS updates: mutating calls are limited to the kernel leader
+		osUpdates := authed.Group("/updates/os")
+		{
+			osUpdates.GET("", s.handleOSUpdateStatus)
+			osUpdates.POST("/check", s.requireKernelLeader(), s.handleOSUpdateCheck)
+			osUpdates.POST("/apply", s.requireUnlocked(), s.requireKernelLeader(), s.handleOSUpdateApply)
+			osUpdates.GET("/snapshots", s.handleOSUpdateSnapshots)
+			osUpdates.POST("/rollback/:snapshot", s.requireUnlocked(), s.requireKernelLeader(), s.handleOSUpdateRollback)
+		}
+		selfUpdate := authed.Group("/updates/piccolod")
+		{
+			selfUpdate.GET("", s.handleSelfUpdateStatus)
+			selfUpdate.POST("/channel", s.requireKernelLeader(), s.handleSelfUpdateChannel)
+			selfUpdate.POST("/apply", s.requireUnlocked(), s.requireKernelLeader(), s.handleSelfUpdateApply)
 		}
 
 		// Remote config endpoints require auth
-		authed.POST("/remote/configure", s.handleRemoteConfigure)
-		authed.POST("/remote/disable", s.handleRemoteDisable)
-		authed.POST("/remote/rotate", s.handleRemoteRotate)
-		authed.POST("/remote/preflight", s.handleRemotePreflight)
+		authed.GET("/remote/status", s.handleRemoteStatus)
+		authed.POST("/remote/configure", s.requireStorage(), s.handleRemoteConfigure)
+		authed.POST("/remote/disable", s.requireStorage(), s.handleRemoteDisable)
+		authed.POST("/remote/rotate", s.requireStorage(), s.handleRemoteRotate)
+		authed.POST("/remote/preflight", s.requireStorage(), s.handleRemotePreflight)
+		authed.POST("/remote/probe", s.requireStorage(), s.handleRemoteProbe)
+		authed.POST("/remote/reconnect", s.requireStorage(), s.handleRemoteReconnect)
+		authed.GET("/remote/tlsmux/connections", s.handleRemoteTlsMuxConnections)
 		authed.GET("/remote/aliases", s.handleRemoteAliasesList)
-		authed.POST("/remote/aliases", s.handleRemoteAliasesCreate)
-		authed.DELETE("/remote/aliases/:id", s.handleRemoteAliasesDelete)
+		authed.POST("/remote/aliases", s.requireStorage(), s.handleRemoteAliasesCreate)
+		authed.DELETE("/remote/aliases/:id", s.requireStorage(), s.handleRemoteAliasesDelete)
 		authed.GET("/remote/certificates", s.handleRemoteCertificatesList)
-		authed.POST("/remote/certificates/:id/renew", s.handleRemoteCertificateRenew)
+		authed.POST("/remote/certificates/renew-all", s.requireStorage(), s.handleRemoteCertificatesRenewAll)
+		authed.PUT("/remote/certificates/renewal-window", s.requireStorage(), s.handleRemoteRenewalWindow)
+		authed.POST("/remote/certificates/:id/renew", s.requireStorage(), s.handleRemoteCertificateRenew)
+		authed.POST("/remote/certificates/:id/forget", s.requireStorage(), s.handleRemoteCertificateForget)
+		authed.GET("/remote/certificates/:id/download", s.handleRemoteCertificateDownload)
+		authed.POST("/remote/certificates/:id/download", s.handleRemoteCertificateDownload)
+		authed.PUT("/remote/certificates/:id/export", s.requireStorage(), s.handleRemoteCertificateExport)
+		authed.GET("/remote/acme/account", s.handleRemoteACMEAccount)
+		authed.POST("/remote/acme/account/rotate", s.requireStorage(), s.handleRemoteACMEAccountRotate)
 		authed.GET("/remote/events", s.handleRemoteEvents)
 		authed.GET("/remote/dns/providers", s.handleRemoteDNSProviders)
+		authed.POST("/remote/dns/validate", s.handleRemoteDNSValidate)
 		authed.GET("/remote/nexus-guide", s.handleRemoteGuideInfo)
-		authed.POST("/remote/nexus-guide/verify", s.handleRemoteGuideVerify)
+		authed.POST("/remote/nexus-guide/verify", s.requireStorage(), s.handleRemoteGuideVerify)
+
+		// Background jobs (image pulls, exports)
+		authed.GET("/jobs/:id", s.handleJobGet)
+		authed.POST("/jobs/:id/cancel", s.handleJobCancel)
+
+		// Storage
+		authed.GET("/storage/disks", s.handleStorageDisks)
+		authed.GET("/storage/usage", s.handleStorageUsage)
 
 		// Persistence exports (prototype)
 		authed.POST("/exports/control", s.requireUnlocked(), s.handlePersistenceControlExport)
@@ -599,33 +1123,72 @@ func (s *GinServer) setupGinRoutes() {
 
 		// Auth-only endpoints
 		authed.POST("/auth/logout", s.handleAuthLogout)
-		authed.POST("/auth/password", s.handleAuthPassword)
+		authed.POST("/auth/password", s.requireBrowserSession(), s.handleAuthPassword)
 		authed.POST("/auth/staleness/ack", s.handleAuthStalenessAck)
 		authed.GET("/auth/csrf", s.handleAuthCSRF)
+		authed.GET("/auth/sessions", s.requireBrowserSession(), s.handleSessionList)
+		authed.DELETE("/auth/sessions", s.requireBrowserSession(), s.handleSessionDeleteOthers)
+		authed.DELETE("/auth/sessions/:id", s.requireBrowserSession(), s.handleSessionDelete)
+		authed.GET("/auth/session-policy", s.handleSessionPolicyGet)
+		authed.PUT("/auth/session-policy", s.requireUnlocked(), s.handleSessionPolicyUpdate)
+		authed.GET("/auth/tokens", s.requireBrowserSession(), s.handleAPITokenList)
+		authed.POST("/auth/tokens", s.requireBrowserSession(), s.requireUnlocked(), s.handleAPITokenCreate)
+		authed.DELETE("/auth/tokens/:id", s.requireBrowserSession(), s.requireUnlocked(), s.handleAPITokenDelete)
+		authed.POST("/setup/complete", s.handleSetupComplete)
+		authed.GET("/activity", s.handleActivityList)
+		authed.GET("/debug/bundle", s.requireCSRFToken(), s.handleDebugBundle)
+		authed.GET("/doctor", s.handleDoctor)
+		authed.GET("/system/identity", s.handleSystemIdentityGet)
+		authed.PUT("/system/identity", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemIdentityUpdate)
+		authed.GET("/system/network", s.handleSystemNetworkGet)
+		authed.PUT("/system/network", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemNetworkUpdate)
+		authed.GET("/system/cors", s.handleSystemCORSGet)
+		authed.PUT("/system/cors", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemCORSUpdate)
+		authed.GET("/system/ports", s.handleSystemPortsGet)
+		authed.GET("/system/runtime", s.handleSystemRuntime)
+		authed.GET("/system/loopback", s.handleSystemLoopback)
+		authed.PUT("/system/ports", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemPortsUpdate)
+		authed.GET("/system/mount-allowlist", s.handleSystemMountAllowlistGet)
+		authed.PUT("/system/mount-allowlist", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemMountAllowlistUpdate)
+		authed.GET("/system/app-policy", s.handleSystemAppPolicyGet)
+		authed.PUT("/system/app-policy", s.requireUnlocked(), s.requireKernelLeader(), s.handleSystemAppPolicyUpdate)
+		authed.POST("/system/components/:name/restart", s.handleSystemComponentRestart)
+		authed.GET("/system/mdns", s.handleSystemMDNSGet)
+		authed.POST("/system/mdns/reannounce", s.handleSystemMDNSReannounce)
+
+		notifications := authed.Group("/notifications/targets")
+		{
+			notifications.GET("", s.handleNotificationTargetsList)
+			notifications.POST("", s.requireUnlocked(), s.requireKernelLeader(), s.handleNotificationTargetCreate)
+			notifications.GET("/:id", s.handleNotificationTargetGet)
+			notifications.PUT("/:id", s.requireUnlocked(), s.requireKernelLeader(), s.handleNotificationTargetUpdate)
+			notifications.DELETE("/:id", s.requireUnlocked(), s.requireKernelLeader(), s.handleNotificationTargetDelete)
+			notifications.POST("/:id/test", s.requireUnlocked(), s.handleNotificationTargetTest)
+		}
 
 		// Catalog (read-only) and services require auth
 		authed.GET("/catalog", s.handleGinCatalog)
 		authed.GET("/catalog/:name/template", s.handleGinCatalogTemplate)
 		authed.GET("/services", s.handleGinServicesAll)
+		authed.GET("/services/hints", s.handleGinServiceHints)
+		authed.GET("/services/tunnel", s.handleGinServiceTunnel)
 		authed.GET("/apps/:name/services", s.handleGinServicesByApp)
 	}
 
 	// Admin routes
 	r.GET("/version", s.handleGinVersion)
 
-	// Static file serving for web UI and fallback
+	// App listeners served under a path_prefix, then the web UI
 	r.NoRoute(func(c *gin.Context) {
-		if c.Request.Method == http.MethodGet {
-			requestedPath := c.Request.URL.Path
-			if strings.HasSuffix(requestedPath, "/") {
-				requestedPath += "entry.html"
-			}
-
-			fspath := "web" + requestedPath
-			if _, err := fs.Stat(webassets.FS, fspath); err != nil {
-				fspath = "web/entry.html"
-			}
-			c.FileFromFS(fspath, http.FS(webassets.FS))
+		if isAPIPath(c.Request.URL.Path) {
+			writeGinError(c, http.StatusNotFound, "no API route for "+c.Request.Method+" "+c.Request.URL.Path)
+			return
+		}
+		if s.servePortalPath(c) {
+			return
+		}
+		if c.Request.Method == http.MethodGet && s.staticAssets != nil {
+			s.staticAssets.serve(c)
 		} else {
 			c.Status(http.StatusNotFound)
 		}
@@ -636,90 +1199,54 @@ func (s *GinServer) setupGinRoutes() {
 
 // handleGinServicesAll returns all service endpoints across apps
 func (s *GinServer) handleGinServicesAll(c *gin.Context) {
-	eps := s.serviceManager.GetAll()
-	out := make([]gin.H, 0, len(eps))
-	var remoteStatus *remote.Status
-	if s.remoteManager != nil {
-		st := s.remoteManager.Status()
-		remoteStatus = &st
-	}
-	for _, ep := range eps {
-		remoteHost := s.remoteServiceHostname(remoteStatus, ep)
-		var remoteHostValue interface{}
-		if remoteHost != "" {
-			remoteHostValue = remoteHost
+	c.JSON(http.StatusOK, gin.H{"services": s.services().current().all(s.serviceManager)})
+}
+
+// handleGinServiceHints lists outstanding proxy connection hints, labelled
+// with the app listener they target, to help diagnose remote routing.
+func (s *GinServer) handleGinServiceHints(c *gin.Context) {
+	byPort := map[int]services.ServiceEndpoint{}
+	for _, ep := range s.serviceManager.GetAll() {
+		byPort[ep.PublicPort] = ep
+	}
+	hints := s.serviceManager.ProxyHints()
+	out := make([]gin.H, 0, len(hints))
+	for _, h := range hints {
+		entry := gin.H{
+			"listener_port": h.ListenerPort,
+			"source_port":   h.SourcePort,
+			"remote_port":   h.RemotePort,
+			"tls":           h.TLS,
+			"age_ms":        h.Age.Milliseconds(),
 		}
-		out = append(out, gin.H{
-			"app":          ep.App,
-			"name":         ep.Name,
-			"guest_port":   ep.GuestPort,
-			"host_port":    ep.HostBind,
-			"public_port":  ep.PublicPort,
-			"remote_ports": ep.RemotePorts,
-			"remote_host":  remoteHostValue,
-			"flow":         ep.Flow,
-			"protocol":     ep.Protocol,
-			"middleware":   ep.Middleware,
-			"scheme":       determineScheme(ep.Flow, ep.Protocol),
-		})
+		if ep, ok := byPort[h.ListenerPort]; ok {
+			entry["app"] = ep.App
+			entry["listener"] = ep.Name
+		}
+		out = append(out, entry)
 	}
-	c.JSON(http.StatusOK, gin.H{"services": out})
+	c.JSON(http.StatusOK, gin.H{"hints": out})
+}
+
+// handleGinServiceTunnel reports follower tunnel counters and the kernel route.
+func (s *GinServer) handleGinServiceTunnel(c *gin.Context) {
+	resp := gin.H{"stats": s.serviceManager.TunnelStats()}
+	if s.routeManager != nil {
+		route := s.routeManager.KernelRoute()
+		resp["kernel_route"] = gin.H{"mode": route.Mode, "leader": route.LeaderAddr}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // handleGinServicesByApp returns services for a single app
 func (s *GinServer) handleGinServicesByApp(c *gin.Context) {
 	name := c.Param("name")
-	eps, err := s.serviceManager.GetByApp(name)
-	if err != nil {
-		writeGinError(c, http.StatusNotFound, err.Error())
+	entries, ok := s.services().current().app(name, s.serviceManager)
+	if !ok {
+		writeGinError(c, http.StatusNotFound, "app not found: "+name)
 		return
 	}
-	out := make([]gin.H, 0, len(eps))
-	var remoteStatus *remote.Status
-	if s.remoteManager != nil {
-		st := s.remoteManager.Status()
-		remoteStatus = &st
-	}
-	for _, ep := range eps {
-		remoteHost := s.remoteServiceHostname(remoteStatus, ep)
-		var remoteHostValue interface{}
-		if remoteHost != "" {
-			remoteHostValue = remoteHost
-		}
-		out = append(out, gin.H{
-			"app":          ep.App,
-			"name":         ep.Name,
-			"guest_port":   ep.GuestPort,
-			"host_port":    ep.HostBind,
-			"public_port":  ep.PublicPort,
-			"remote_ports": ep.RemotePorts,
-			"remote_host":  remoteHostValue,
-			"flow":         ep.Flow,
-			"protocol":     ep.Protocol,
-			"middleware":   ep.Middleware,
-			"scheme":       determineScheme(ep.Flow, ep.Protocol),
-		})
-	}
-	c.JSON(http.StatusOK, gin.H{"services": out})
-}
-
-func (s *GinServer) remoteServiceHostname(status *remote.Status, ep services.ServiceEndpoint) string {
-	if s == nil || status == nil || !status.Enabled {
-		return ""
-	}
-	tld := strings.Trim(strings.TrimSuffix(strings.ToLower(status.TLD), "."), " ")
-	if tld == "" {
-		return ""
-	}
-	name := strings.TrimSpace(ep.Name)
-	if name == "" {
-		return ""
-	}
-	label := strings.ToLower(name)
-	if !isValidDNSLabel(label) {
-		return ""
-	}
-	return label + "." + tld
+	c.JSON(http.StatusOK, gin.H{"services": entries})
 }
 
 func (s *GinServer) handlePersistenceControlExport(c *gin.Context) {
@@ -731,7 +1258,11 @@ func (s *GinServer) handlePersistenceControlExport(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, persistence.ErrNotImplemented) {
 			writeGinError(c, http.StatusNotImplemented, "control-plane export not implemented yet")
+		} else if errors.Is(err, persistence.ErrNoSpace) {
+			s.jobs().Record(jobKindControlExport, nil, err)
+			writeNoSpaceError(c, err)
 		} else {
+			s.jobs().Record(jobKindControlExport, nil, err)
 			writeGinError(c, http.StatusInternalServerError, "failed to start control export: "+err.Error())
 		}
 		return
@@ -741,7 +1272,8 @@ func (s *GinServer) handlePersistenceControlExport(c *gin.Context) {
 		writeGinError(c, http.StatusInternalServerError, "unexpected response from persistence")
 		return
 	}
-	writeGinSuccess(c, gin.H{"artifact": artifact}, "control-plane export started")
+	job := s.jobs().Record(jobKindControlExport, artifact, nil)
+	writeGinSuccess(c, gin.H{"artifact": artifact, "job": job}, "control-plane export started")
 }
 
 func (s *GinServer) handlePersistenceFullExport(c *gin.Context) {
@@ -753,7 +1285,11 @@ func (s *GinServer) handlePersistenceFullExport(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, persistence.ErrNotImplemented) {
 			writeGinError(c, http.StatusNotImplemented, "full export not implemented yet")
+		} else if errors.Is(err, persistence.ErrNoSpace) {
+			s.jobs().Record(jobKindFullExport, nil, err)
+			writeNoSpaceError(c, err)
 		} else {
+			s.jobs().Record(jobKindFullExport, nil, err)
 			writeGinError(c, http.StatusInternalServerError, "failed to start full export: "+err.Error())
 		}
 		return
@@ -763,39 +1299,45 @@ func (s *GinServer) handlePersistenceFullExport(c *gin.Context) {
 		writeGinError(c, http.StatusInternalServerError, "unexpected response from persistence")
 		return
 	}
-	writeGinSuccess(c, gin.H{"artifact": artifact}, "full export started")
+	job := s.jobs().Record(jobKindFullExport, artifact, nil)
+	writeGinSuccess(c, gin.H{"artifact": artifact, "job": job}, "full export started")
 }
 
-func (s *GinServer) handleGinVersion(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"version": s.version,
-		"service": "piccolod",
-	})
-}
-
-func (s *GinServer) registerUnlockReloader(r unlockReloader) {
+func (s *GinServer) registerUnlockReloader(name string, r unlockReloader) {
 	if s == nil || r == nil {
 		return
 	}
 	s.reloadersMu.Lock()
-	s.unlockReloaders = append(s.unlockReloaders, r)
+	s.unlockReloaders = append(s.unlockReloaders, namedReloader{name: name, unlockReloader: r})
 	s.reloadersMu.Unlock()
 }
 
+// unlockReloaderNames lists the registered reloaders in the order they run.
+func (s *GinServer) unlockReloaderNames() []string {
+	s.reloadersMu.RLock()
+	defer s.reloadersMu.RUnlock()
+	names := make([]string, 0, len(s.unlockReloaders))
+	for _, r := range s.unlockReloaders {
+		names = append(names, r.name)
+	}
+	return names
+}
+
 func (s *GinServer) reloadComponentsAfterUnlock() {
 	if s == nil {
 		return
 	}
 	s.reloadersMu.RLock()
-	reloaders := append([]unlockReloader(nil), s.unlockReloaders...)
+	reloaders := append([]namedReloader(nil), s.unlockReloaders...)
 	s.reloadersMu.RUnlock()
 	for _, r := range reloaders {
-		if r == nil {
-			continue
-		}
-		if err := r.ReloadFromStorage(); err != nil {
-			log.Printf("WARN: unlock reload failed: %v", err)
+		step := unlockReloadStep(r.name)
+		s.unlockProgress.start(step)
+		err := r.ReloadFromStorage()
+		if err != nil {
+			log.Printf("WARN: unlock reload %s failed: %v", r.name, err)
 		}
+		s.unlockProgress.finish(step, err)
 	}
 }
 
@@ -805,19 +1347,31 @@ func (s *GinServer) refreshRemoteRuntime() {
 	}
 	status := s.remoteManager.Status()
 	s.applyRemoteRuntimeFromStatus(status)
+	s.refreshListeners()
 }
 
 func (s *GinServer) applyRemoteRuntimeFromStatus(status remote.Status) {
-	if s == nil || s.tlsMux == nil {
+	if s == nil {
 		return
 	}
+	// The resolver also feeds the CORS device hosts, so it follows the
+	// config even when there is no TLS mux to restart.
 	if s.remoteResolver != nil {
 		s.remoteResolver.UpdateConfig(nexusclient.Config{
 			PortalHostname: status.PortalHostname,
 			TLD:            status.TLD,
 		})
+		s.remoteResolver.UpdateAliases(status.Aliases)
+	}
+	if s.serviceManager != nil {
+		s.serviceManager.SetRemoteLabelsEnforced(status.Enabled)
+	}
+	if s.tlsMux == nil {
+		return
 	}
 	s.tlsMux.UpdateConfig(status.PortalHostname, status.TLD, s.resolvePortalPort())
+	s.tlsMux.UpdateAliases(aliasTable(status.Aliases))
+	s.tlsMux.UpdateRedirects(aliasRedirects(status.Aliases))
 	if status.Enabled && strings.TrimSpace(status.PortalHostname) != "" {
 		if port, err := s.tlsMux.Start(); err == nil {
 			if s.remoteResolver != nil {
@@ -834,11 +1388,31 @@ func (s *GinServer) applyRemoteRuntimeFromStatus(status remote.Status) {
 	}
 }
 
+// subscribe registers an observer channel and remembers it so Stop can
+// release it, which ends the goroutine ranging over it.
+func (s *GinServer) subscribe(bus *events.Bus, topic events.Topic, buffer int) <-chan events.Event {
+	ch := bus.Subscribe(topic, buffer)
+	s.subscriptionsMu.Lock()
+	s.subscriptions = append(s.subscriptions, func() { bus.Unsubscribe(topic, ch) })
+	s.subscriptionsMu.Unlock()
+	return ch
+}
+
+func (s *GinServer) unsubscribeAll() {
+	s.subscriptionsMu.Lock()
+	subs := s.subscriptions
+	s.subscriptions = nil
+	s.subscriptionsMu.Unlock()
+	for _, unsubscribe := range subs {
+		unsubscribe()
+	}
+}
+
 func (s *GinServer) observeLockState(bus *events.Bus) {
 	if bus == nil || s.healthTracker == nil {
 		return
 	}
-	ch := bus.Subscribe(events.TopicLockStateChanged, 8)
+	ch := s.subscribe(bus, events.TopicLockStateChanged, 8)
 	go func() {
 		for evt := range ch {
 			payload, ok := evt.Payload.(events.LockStateChanged)
@@ -861,7 +1435,7 @@ func (s *GinServer) observeLeadership(bus *events.Bus) {
 	if bus == nil || s.healthTracker == nil {
 		return
 	}
-	ch := bus.Subscribe(events.TopicLeadershipRoleChanged, 8)
+	ch := s.subscribe(bus, events.TopicLeadershipRoleChanged, 8)
 	go func() {
 		for evt := range ch {
 			payload, ok := evt.Payload.(events.LeadershipChanged)
@@ -875,10 +1449,12 @@ func (s *GinServer) observeLeadership(bus *events.Bus) {
 			// Reflect role in the message but keep LevelOK.
 			if s.routeManager != nil {
 				mode := router.ModeLocal
+				leader := ""
 				if payload.Role == cluster.RoleFollower {
 					mode = router.ModeTunnel
+					leader = payload.LeaderEndpoint
 				}
-				s.routeManager.RegisterKernelRoute(mode, "")
+				s.routeManager.RegisterKernelRoute(mode, leader)
 			}
 			switch payload.Role {
 			case cluster.RoleLeader:
@@ -890,33 +1466,141 @@ func (s *GinServer) observeLeadership(bus *events.Bus) {
 	}()
 }
 
+// observeOSUpdates mirrors OS update job transitions into the health tracker
+// so a staged-but-unbooted update shows up as "pending reboot".
+func (s *GinServer) observeOSUpdates(bus *events.Bus) {
+	if bus == nil || s.healthTracker == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicOSUpdate, 32)
+	go func() {
+		for evt := range ch {
+			payload, ok := evt.Payload.(events.OSUpdateProgress)
+			if !ok || payload.Message != "" {
+				continue
+			}
+			switch update.JobState(payload.State) {
+			case update.JobRunning:
+				s.healthTracker.Setf("os-update", health.LevelOK, "os "+payload.Kind+" in progress")
+			case update.JobPendingReboot:
+				s.healthTracker.Setf("os-update", health.LevelWarn, "update pending reboot")
+			case update.JobRebooting:
+				s.healthTracker.Setf("os-update", health.LevelWarn, "rebooting into updated snapshot")
+			case update.JobFailed:
+				s.healthTracker.Setf("os-update", health.LevelWarn, "last os "+payload.Kind+" failed")
+			case update.JobSucceeded:
+				s.healthTracker.Setf("os-update", health.LevelOK, "no os update pending")
+			}
+		}
+	}()
+}
+
+// observeStorageSpace turns free-space samples into the storage health
+// component: warn from 85% full, error from 95% or once writes are refused.
+func (s *GinServer) observeStorageSpace(bus *events.Bus) {
+	if bus == nil || s.healthTracker == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicStorageSpace, 8)
+	go func() {
+		for evt := range ch {
+			usage, ok := evt.Payload.(persistence.StorageUsage)
+			if !ok {
+				continue
+			}
+			level := health.LevelOK
+			switch usage.Status {
+			case persistence.SpaceStatusWarn:
+				level = health.LevelWarn
+			case persistence.SpaceStatusError:
+				level = health.LevelError
+			}
+			s.healthTracker.Set("storage", health.Status{
+				Level:     level,
+				Message:   usage.Message,
+				Details:   map[string]interface{}{"refusing_writes": usage.RefusingWrites},
+				UpdatedAt: usage.CheckedAt,
+			})
+		}
+	}()
+}
+
+// observeControlHealth turns control store checks, and a database that stays
+// busy past every retry, into the control-store health component.
+func (s *GinServer) observeControlHealth(bus *events.Bus) {
+	if bus == nil || s.healthTracker == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicControlHealth, 8)
+	go func() {
+		for evt := range ch {
+			report, ok := evt.Payload.(persistence.ControlHealthReport)
+			if !ok {
+				continue
+			}
+			level := health.LevelOK
+			switch report.Status {
+			case persistence.ControlHealthStatusUnknown:
+				continue
+			case persistence.ControlHealthStatusDegraded, persistence.ControlHealthStatusBusy:
+				level = health.LevelWarn
+			case persistence.ControlHealthStatusError:
+				level = health.LevelError
+			}
+			s.healthTracker.Set("control-store", health.Status{
+				Level:     level,
+				Message:   report.Message,
+				Details:   map[string]interface{}{"status": string(report.Status)},
+				UpdatedAt: report.CheckedAt,
+			})
+		}
+	}()
+}
+
 func (s *GinServer) observeRemoteConfig(bus *events.Bus) {
 	if bus == nil {
 		return
 	}
-	ch := bus.Subscribe(events.TopicRemoteConfigChanged, 8)
+	ch := s.subscribe(bus, events.TopicRemoteConfigChanged, 8)
 	go func() {
 		for evt := range ch {
 			status, ok := evt.Payload.(remote.Status)
 			if !ok {
 				continue
 			}
+			s.services().invalidate()
 			s.applyRemoteRuntimeFromStatus(status)
 		}
 	}()
 }
 
+// observeServiceChanges drops the cached service list as soon as the
+// registry changes; reads also compare generations, so this only frees the
+// stale copy early.
+func (s *GinServer) observeServiceChanges(bus *events.Bus) {
+	if bus == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicServicesChanged, 8)
+	go func() {
+		for range ch {
+			s.services().invalidate()
+		}
+	}()
+}
+
 func (s *GinServer) handleGinReadinessCheck(c *gin.Context) {
 	if s.healthTracker == nil {
-		c.JSON(http.StatusOK, gin.H{"ready": true, "status": "unknown"})
+		c.JSON(http.StatusOK, gin.H{"ready": true, "status": "unknown", "device_name": s.deviceName()})
 		return
 	}
-	required := []string{"persistence", "app-manager", "service-manager"}
+	required := []string{"persistence", "app-manager", "service-manager", "storage"}
 	ready, snapshot := s.healthTracker.Ready(required...)
 	payload := gin.H{
-		"ready":      ready,
-		"status":     s.healthTracker.Overall().String(),
-		"components": flattenHealth(snapshot),
+		"ready":       ready,
+		"status":      s.healthTracker.Overall().String(),
+		"components":  flattenHealth(snapshot, s.healthTracker.Stability()),
+		"device_name": s.deviceName(),
 	}
 	// TODO(ballast): once the health tracker distinguishes fatal states (e.g. control
 	// store cannot unlock due to corruption), emit 503 here so MicroOS can roll
@@ -930,30 +1614,94 @@ func (s *GinServer) handleHealthLive(c *gin.Context) {
 	if s.healthTracker != nil {
 		overall = s.healthTracker.Overall().String()
 	}
-	c.JSON(http.StatusOK, gin.H{"status": overall})
+	// The remote prober fetches this endpoint through the public hostname;
+	// echoing its token proves the answer came from this device.
+	if token := c.GetHeader(remote.ProbeTokenHeader); token != "" && s.remoteManager != nil && s.remoteManager.ObserveProbeToken(token) {
+		c.Header(remote.ProbeTokenHeader, token)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": overall, "device_name": s.deviceName()})
 }
 
 func (s *GinServer) handleHealthDetail(c *gin.Context) {
 	if s.healthTracker == nil {
-		c.JSON(http.StatusOK, gin.H{"overall": "unknown", "components": []gin.H{}})
+		c.JSON(http.StatusOK, gin.H{"overall": "unknown", "components": []gin.H{}, "device_name": s.deviceName()})
 		return
 	}
 	snapshot := s.healthTracker.Snapshot()
 	c.JSON(http.StatusOK, gin.H{
-		"overall":    s.healthTracker.Overall().String(),
-		"components": flattenHealth(snapshot),
+		"overall":     s.healthTracker.Overall().String(),
+		"components":  flattenHealth(snapshot, s.healthTracker.Stability()),
+		"device_name": s.deviceName(),
+		"event_bus":   s.eventBusStats(),
+		"storage":     s.storageHealth(c.Request.Context()),
+		"runtime":     s.runtimeComponents(),
 	})
 }
 
-func flattenHealth(snapshot map[string]health.Status) []gin.H {
+// handleHealthHistory lists recent level changes, oldest first, for every
+// component or the one named by ?component=.
+func (s *GinServer) handleHealthHistory(c *gin.Context) {
+	transitions := []gin.H{}
+	if s.healthTracker != nil {
+		for _, tr := range s.healthTracker.History(strings.TrimSpace(c.Query("component"))) {
+			transitions = append(transitions, gin.H{
+				"component": tr.Component,
+				"from":      tr.From.String(),
+				"to":        tr.To.String(),
+				"message":   tr.Message,
+				"at":        tr.At,
+				"flapping":  tr.Flapping,
+			})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"transitions": transitions})
+}
+
+// storageHealth is the free-space summary shown in health detail. The
+// endpoint is public, so per-app volumes are left to /storage/usage.
+func (s *GinServer) storageHealth(ctx context.Context) any {
+	if s.persistence == nil {
+		return nil
+	}
+	usage, err := s.persistence.StorageUsage(ctx)
+	if err != nil {
+		return nil
+	}
+	filesystems := make([]persistence.VolumeUsage, 0, len(usage.Volumes))
+	for _, vol := range usage.Volumes {
+		if vol.Kind != persistence.SpaceKindCiphertext {
+			filesystems = append(filesystems, vol)
+		}
+	}
+	return gin.H{
+		"status":          usage.Status,
+		"refusing_writes": usage.RefusingWrites,
+		"min_free_bytes":  usage.MinFreeBytes,
+		"filesystems":     filesystems,
+		"checked_at":      usage.CheckedAt,
+	}
+}
+
+// eventBusStats is the per-topic subscriber and drop accounting shown in
+// health detail.
+func (s *GinServer) eventBusStats() []events.TopicStats {
+	if s.events == nil {
+		return []events.TopicStats{}
+	}
+	return s.events.Stats()
+}
+
+func flattenHealth(snapshot map[string]health.Status, stability map[string]health.Stability) []gin.H {
 	components := make([]gin.H, 0, len(snapshot))
 	for name, st := range snapshot {
 		components = append(components, gin.H{
-			"name":       name,
-			"level":      st.Level.String(),
-			"message":    st.Message,
-			"details":    st.Details,
-			"updated_at": st.UpdatedAt,
+			"name":        name,
+			"level":       st.Level.String(),
+			"message":     st.Message,
+			"details":     st.Details,
+			"updated_at":  st.UpdatedAt,
+			"flapping":    stability[name].Flapping,
+			"transitions": stability[name].Transitions,
 		})
 	}
 	return components
@@ -976,11 +1724,21 @@ func (s *GinServer) initSecureLoopback() error {
 		s.router.ServeHTTP(w, r.WithContext(ctx))
 	})
 	s.secureSrv = &http.Server{
-		Handler:      handler,
+		Handler: handler,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if _, ok := conn.(*net.UnixConn); ok {
+				return context.WithValue(ctx, unixSocketContextKey{}, true)
+			}
+			return s.portalConnContext(ctx, conn)
+		},
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if err := s.writeLoopbackRuntime(); err != nil {
+		// The daemon works without the CLI; only local tooling is affected.
+		log.Printf("WARN: CLI runtime files not written: %v", err)
+	}
 	return nil
 }
 
@@ -988,12 +1746,32 @@ func (s *GinServer) startSecureLoopback() {
 	if s == nil || s.secureSrv == nil || s.secureListener == nil {
 		return
 	}
+	srv, ln := s.secureSrv, s.secureListener
 	go func() {
-		if err := s.secureSrv.Serve(s.secureListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("WARN: secure loopback server stopped: %v", err)
 		}
 	}()
+	s.secureActive = true
 	log.Printf("INFO: Secure loopback portal listening on 127.0.0.1:%d", s.securePort)
+
+	// The socket is a convenience for local tooling; the daemon runs fine
+	// without it.
+	sock, err := s.listenSecureSocket()
+	if err != nil {
+		log.Printf("WARN: secure loopback socket not bound: %v", err)
+		return
+	}
+	if sock == nil {
+		return
+	}
+	s.secureSocket = sock
+	go func() {
+		if err := srv.Serve(sock); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("WARN: secure loopback socket stopped: %v", err)
+		}
+	}()
+	log.Printf("INFO: Secure loopback portal listening on unix:%s", s.secureSocketPath)
 }
 
 func (s *GinServer) stopSecureLoopback() {
@@ -1005,9 +1783,18 @@ func (s *GinServer) stopSecureLoopback() {
 	if err := s.secureSrv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Printf("WARN: secure loopback shutdown failed: %v", err)
 	}
+	if s.secureSocketPath != "" {
+		if err := os.Remove(s.secureSocketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("WARN: remove secure loopback socket: %v", err)
+		}
+	}
 	s.secureSrv = nil
 	s.secureListener = nil
 	s.securePort = 0
+	s.secureActive = false
+	s.secureSocket = nil
+	s.secureSocketPath = ""
+	s.removeLoopbackRuntime()
 }
 
 func (s *GinServer) httpsRedirectMiddleware() gin.HandlerFunc {
@@ -1036,11 +1823,16 @@ func (s *GinServer) httpsRedirectMiddleware() gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		if target := s.remoteResolver.RedirectTarget(host); target != "" {
+			c.Redirect(http.StatusPermanentRedirect, "https://"+target+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
 		if !s.remoteResolver.IsRemoteHostname(host) {
 			c.Next()
 			return
 		}
-		if s.isSecureRequest(c.Request) {
+		if s.requestSecure(c) {
 			c.Next()
 			return
 		}
@@ -1060,10 +1852,15 @@ func (s *GinServer) isSecureRequest(r *http.Request) bool {
 	if v := r.Context().Value(secureContextKeyInstance); v != nil {
 		return true
 	}
-	if strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
-		return true
+	if _, loopback := loopbackPeer(r); loopback {
+		_, isTLS, _ := s.relayHint(r)
+		return isTLS
 	}
-	return false
+	var trusted *network.TrustedProxies
+	if s != nil {
+		trusted = s.trustedProxies
+	}
+	return trusted.ForwardedProto(r) == "https"
 }
 
 func canonicalHost(v string) string {
@@ -1071,8 +1868,10 @@ func canonicalHost(v string) string {
 	if v == "" {
 		return ""
 	}
-	if i := strings.Index(v, ","); i != -1 {
-		v = v[:i]
+	// A Host header never carries a list; treat one as unusable rather than
+	// picking an entry the client chose.
+	if strings.Contains(v, ",") {
+		return ""
 	}
 	if strings.HasPrefix(v, "[") {
 		if idx := strings.Index(v, "]"); idx != -1 {
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	authpkg "piccolod/internal/auth"
+	"piccolod/internal/persistence"
+)
+
+// Error codes on 401 responses from requireSession, so the UI can say why
+// the user was signed out.
+const (
+	errorCodeSessionIdle    = "session_idle"
+	errorCodeSessionExpired = "session_expired"
+)
+
+// sessionPolicyPayload is the JSON form of authpkg.SessionPolicy.
+type sessionPolicyPayload struct {
+	IdleTimeoutSeconds int64 `json:"idle_timeout_seconds"`
+	MaxLifetimeSeconds int64 `json:"max_lifetime_seconds"`
+}
+
+func newSessionPolicyPayload(p authpkg.SessionPolicy) sessionPolicyPayload {
+	return sessionPolicyPayload{
+		IdleTimeoutSeconds: int64(p.IdleTimeout / time.Second),
+		MaxLifetimeSeconds: int64(p.MaxLifetime / time.Second),
+	}
+}
+
+// sessionPolicyRepo returns the control-store repository for the policy, or
+// nil when persistence is not wired (tests set sessionPolicies directly).
+func (s *GinServer) sessionPolicyRepo() persistence.SessionPolicyRepo {
+	if s.sessionPolicies != nil {
+		return s.sessionPolicies
+	}
+	if s.persistence == nil || s.persistence.Control() == nil {
+		return nil
+	}
+	return s.persistence.Control().SessionPolicy()
+}
+
+// reloadSessionPolicy applies the stored policy once the control store is
+// readable. Until then, and when none was saved, the defaults apply.
+func (s *GinServer) reloadSessionPolicy() error {
+	repo := s.sessionPolicyRepo()
+	if repo == nil || s.sessions == nil {
+		return nil
+	}
+	stored, err := repo.CurrentPolicy(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrNotImplemented):
+		return nil
+	default:
+		return err
+	}
+	policy := authpkg.SessionPolicy{IdleTimeout: stored.IdleTimeout, MaxLifetime: stored.MaxLifetime}
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("stored session policy: %w", err)
+	}
+	s.sessions.SetPolicy(policy)
+	return nil
+}
+
+// isEventStream reports whether the request opens a server-sent event
+// stream. Holding a stream open is not user activity, so it does not renew
+// the idle timeout.
+func isEventStream(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// writeSessionError answers a request whose session cookie no longer maps
+// to a live session.
+func (s *GinServer) writeSessionError(c *gin.Context, err error) {
+	code, message := errorCodeUnauthorized, "Unauthorized"
+	switch {
+	case errors.Is(err, authpkg.ErrSessionIdle):
+		code, message = errorCodeSessionIdle, "signed out after a period of inactivity"
+	case errors.Is(err, authpkg.ErrSessionExpired):
+		code, message = errorCodeSessionExpired, "session reached its maximum lifetime; sign in again"
+	}
+	if code != errorCodeUnauthorized {
+		s.clearSessionCookie(c)
+	}
+	writeGinErrorCode(c, http.StatusUnauthorized, code, message)
+}
+
+// handleSessionPolicyGet: GET /api/v1/auth/session-policy
+func (s *GinServer) handleSessionPolicyGet(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"policy": newSessionPolicyPayload(s.sessions.Policy())})
+}
+
+// handleSessionPolicyUpdate: PUT /api/v1/auth/session-policy
+func (s *GinServer) handleSessionPolicyUpdate(c *gin.Context) {
+	var req sessionPolicyPayload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	policy := authpkg.SessionPolicy{
+		IdleTimeout: time.Duration(req.IdleTimeoutSeconds) * time.Second,
+		MaxLifetime: time.Duration(req.MaxLifetimeSeconds) * time.Second,
+	}
+	if err := policy.Validate(); err != nil {
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	repo := s.sessionPolicyRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "session policy storage unavailable")
+		return
+	}
+	err := repo.SavePolicy(c.Request.Context(), persistence.SessionPolicy{
+		IdleTimeout: policy.IdleTimeout,
+		MaxLifetime: policy.MaxLifetime,
+		UpdatedAt:   time.Now().UTC(),
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case errors.Is(err, persistence.ErrNoSpace):
+		writeNoSpaceError(c, err)
+		return
+	default:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.sessions.SetPolicy(policy)
+	s.recordActivity(c, "auth", activity.LevelInfo, fmt.Sprintf("Session policy changed: idle timeout %s, lifetime %s", policy.IdleTimeout, policy.MaxLifetime))
+	c.JSON(http.StatusOK, gin.H{"policy": newSessionPolicyPayload(policy)})
+}
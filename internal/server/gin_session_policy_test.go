@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	authpkg "piccolod/internal/auth"
+	"piccolod/internal/persistence"
+)
+
+type memorySessionPolicyRepo struct {
+	mu    sync.Mutex
+	saved *persistence.SessionPolicy
+}
+
+func (r *memorySessionPolicyRepo) CurrentPolicy(ctx context.Context) (persistence.SessionPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		return persistence.SessionPolicy{}, persistence.ErrNotFound
+	}
+	return *r.saved, nil
+}
+
+func (r *memorySessionPolicyRepo) SavePolicy(ctx context.Context, policy persistence.SessionPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = &policy
+	return nil
+}
+
+type sessionTestClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *sessionTestClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *sessionTestClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// newSessionPolicyTestServer returns a server whose session store runs on
+// the returned clock, with an admin signed in.
+func newSessionPolicyTestServer(t *testing.T) (*GinServer, *sessionTestClock, *memorySessionPolicyRepo, *http.Cookie, string) {
+	t.Helper()
+	tempDir, err := os.MkdirTemp("", "session-policy")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tempDir) })
+	srv := createGinTestServer(t, tempDir)
+	clock := &sessionTestClock{t: time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC)}
+	srv.sessions.SetClock(clock.now)
+	repo := &memorySessionPolicyRepo{}
+	srv.sessionPolicies = repo
+	cookie, csrf := setupTestAdminSession(t, srv)
+	return srv, clock, repo, cookie, csrf
+}
+
+func sessionErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == nil {
+		t.Fatalf("decode: %v body=%s", err, w.Body.String())
+	}
+	return body.Error.Code
+}
+
+func TestSessionPolicy_GetAndPutPersists(t *testing.T) {
+	srv, _, repo, cookie, csrf := newSessionPolicyTestServer(t)
+
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/session-policy", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get policy: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Policy sessionPolicyPayload `json:"policy"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Policy.IdleTimeoutSeconds != 1800 || resp.Policy.MaxLifetimeSeconds != 12*3600 {
+		t.Fatalf("unexpected default policy %+v", resp.Policy)
+	}
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/auth/session-policy", `{"idle_timeout_seconds":3600,"max_lifetime_seconds":600}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("lifetime shorter than idle timeout: expected 400, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPut, "/api/v1/auth/session-policy", `{"idle_timeout_seconds":600,"max_lifetime_seconds":7200}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put policy: %d body=%s", w.Code, w.Body.String())
+	}
+	if repo.saved == nil || repo.saved.IdleTimeout != 10*time.Minute || repo.saved.MaxLifetime != 2*time.Hour {
+		t.Fatalf("policy not persisted: %+v", repo.saved)
+	}
+
+	// A restarted daemon picks the stored policy up on unlock.
+	srv.sessions = authpkg.NewSessionStore()
+	if err := srv.reloadSessionPolicy(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := srv.sessions.Policy(); got.IdleTimeout != 10*time.Minute || got.MaxLifetime != 2*time.Hour {
+		t.Fatalf("reloaded policy %+v", got)
+	}
+}
+
+func TestSessionPolicy_IdleTimeoutSlidesOnAPICalls(t *testing.T) {
+	srv, clock, _, cookie, csrf := newSessionPolicyTestServer(t)
+	srv.sessions.SetPolicy(authpkg.SessionPolicy{IdleTimeout: 10 * time.Minute, MaxLifetime: 12 * time.Hour})
+
+	for i := 0; i < 3; i++ {
+		clock.advance(9 * time.Minute)
+		if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/session-policy", ""); w.Code != http.StatusOK {
+			t.Fatalf("call %d: %d body=%s", i, w.Code, w.Body.String())
+		}
+	}
+
+	// An event stream request is authorized but is not activity.
+	clock.advance(9 * time.Minute)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/auth/session-policy", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.AddCookie(cookie)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stream request: %d body=%s", w.Code, w.Body.String())
+	}
+
+	clock.advance(2 * time.Minute)
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/session-policy", "")
+	if w.Code != http.StatusUnauthorized || sessionErrorCode(t, w) != errorCodeSessionIdle {
+		t.Fatalf("expected session_idle, got %d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestSessionPolicy_AbsoluteLifetimeEndsActiveSession(t *testing.T) {
+	srv, clock, _, cookie, csrf := newSessionPolicyTestServer(t)
+	srv.sessions.SetPolicy(authpkg.SessionPolicy{IdleTimeout: 10 * time.Minute, MaxLifetime: time.Hour})
+
+	for elapsed := time.Duration(0); elapsed+9*time.Minute <= time.Hour; elapsed += 9 * time.Minute {
+		clock.advance(9 * time.Minute)
+		if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/session-policy", ""); w.Code != http.StatusOK {
+			t.Fatalf("at %s: %d body=%s", elapsed+9*time.Minute, w.Code, w.Body.String())
+		}
+	}
+	clock.advance(9 * time.Minute)
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/auth/session-policy", "")
+	if w.Code != http.StatusUnauthorized || sessionErrorCode(t, w) != errorCodeSessionExpired {
+		t.Fatalf("expected session_expired, got %d body=%s", w.Code, w.Body.String())
+	}
+}
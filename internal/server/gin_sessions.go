@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	authpkg "piccolod/internal/auth"
+)
+
+// sessionPayload describes a signed-in browser session. ID is only the
+// session ID's prefix; the full ID is the cookie secret.
+type sessionPayload struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Current   bool      `json:"current"`
+}
+
+func newSessionPayload(sess authpkg.Session, currentID string) sessionPayload {
+	return sessionPayload{
+		ID:        sess.Prefix(),
+		CreatedAt: sess.CreatedAt.UTC(),
+		LastSeen:  sess.LastSeen.UTC(),
+		ExpiresAt: time.Unix(sess.ExpiresAt, 0).UTC(),
+		ClientIP:  sess.ClientIP,
+		UserAgent: sess.UserAgent,
+		Current:   sess.ID == currentID,
+	}
+}
+
+// describeSession names a session in activity messages.
+func describeSession(sess authpkg.Session) string {
+	desc := "session " + sess.Prefix()
+	if sess.ClientIP != "" {
+		desc += " from " + sess.ClientIP
+	}
+	return desc
+}
+
+// handleSessionList: GET /api/v1/auth/sessions
+func (s *GinServer) handleSessionList(c *gin.Context) {
+	current, _ := s.getSession(c)
+	sessions := s.sessions.List()
+	out := make([]sessionPayload, 0, len(sessions))
+	for _, sess := range sessions {
+		out = append(out, newSessionPayload(sess, current))
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+// handleSessionDelete: DELETE /api/v1/auth/sessions/:id
+// Revoking the caller's own session signs it out.
+func (s *GinServer) handleSessionDelete(c *gin.Context) {
+	sess, ok := s.sessions.RevokePrefix(c.Param("id"))
+	if !ok {
+		writeGinError(c, http.StatusNotFound, "session not found")
+		return
+	}
+	current, _ := s.getSession(c)
+	if sess.ID == current {
+		s.clearSessionCookie(c)
+	}
+	s.recordActivity(c, "auth", activity.LevelWarn, "Signed out "+describeSession(sess))
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// handleSessionDeleteOthers: DELETE /api/v1/auth/sessions?others=true
+func (s *GinServer) handleSessionDeleteOthers(c *gin.Context) {
+	if c.Query("others") != "true" {
+		writeGinError(c, http.StatusBadRequest, "others=true required; revoke single sessions by id")
+		return
+	}
+	current, _ := s.getSession(c)
+	revoked := s.sessions.RevokeAllExcept(current)
+	s.recordActivity(c, "auth", activity.LevelWarn, fmt.Sprintf("Signed out %d other session(s)", revoked))
+	c.JSON(http.StatusOK, gin.H{"message": "sessions revoked", "revoked": revoked})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doSessionsRequest(srv *GinServer, method, path string, cookie *http.Cookie, csrf string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func listSessions(t *testing.T, srv *GinServer, cookie *http.Cookie) []sessionPayload {
+	t.Helper()
+	w := doSessionsRequest(srv, http.MethodGet, "/api/v1/auth/sessions", cookie, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list sessions: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Sessions []sessionPayload `json:"sessions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.Sessions
+}
+
+func TestAuthSessions_ListAndRevoke(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	cookieA, csrfA := setupTestAdminSession(t, srv)
+	cookieB, _ := setupTestAdminSession(t, srv)
+	// The third sign-in comes from a phone on the LAN.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username":"admin","password":"TestPass123!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "phone-browser")
+	req.RemoteAddr = "192.0.2.7:50000"
+	srv.router.ServeHTTP(w, req)
+	var cookieC *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			cookieC = c
+		}
+	}
+	if cookieC == nil {
+		t.Fatalf("login: %d body=%s", w.Code, w.Body.String())
+	}
+
+	sessions := listSessions(t, srv, cookieA)
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %+v", sessions)
+	}
+	var current, phone int
+	for _, sess := range sessions {
+		if sess.ClientIP == "192.0.2.7" && sess.UserAgent == "phone-browser" {
+			phone++
+		}
+		if sess.Current {
+			current++
+			if cookieA.Value[:len(sess.ID)] != sess.ID {
+				t.Fatalf("current marker on the wrong session %+v", sess)
+			}
+		}
+		if len(sess.ID) >= len(cookieA.Value) || sess.CreatedAt.IsZero() || sess.ExpiresAt.IsZero() {
+			t.Fatalf("unexpected session entry %+v", sess)
+		}
+	}
+	if current != 1 || phone != 1 {
+		t.Fatalf("expected one current and one phone session, got %d and %d: %+v", current, phone, sessions)
+	}
+
+	if w := doSessionsRequest(srv, http.MethodDelete, "/api/v1/auth/sessions/unknown", cookieA, csrfA); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown session: expected 404, got %d", w.Code)
+	}
+	prefixB := cookieB.Value[:12]
+	if w := doSessionsRequest(srv, http.MethodDelete, "/api/v1/auth/sessions/"+prefixB, cookieA, csrfA); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doSessionsRequest(srv, http.MethodGet, "/api/v1/auth/sessions", cookieB, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked session still works: %d", w.Code)
+	}
+	if got := listSessions(t, srv, cookieC); len(got) != 2 {
+		t.Fatalf("expected 2 sessions left, got %+v", got)
+	}
+
+	if w := doSessionsRequest(srv, http.MethodDelete, "/api/v1/auth/sessions", cookieA, csrfA); w.Code != http.StatusBadRequest {
+		t.Fatalf("bulk revoke without others=true: expected 400, got %d", w.Code)
+	}
+	if w := doSessionsRequest(srv, http.MethodDelete, "/api/v1/auth/sessions?others=true", cookieA, csrfA); w.Code != http.StatusOK {
+		t.Fatalf("revoke others: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doSessionsRequest(srv, http.MethodGet, "/api/v1/auth/sessions", cookieC, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("other session still works: %d", w.Code)
+	}
+	if got := listSessions(t, srv, cookieA); len(got) != 1 || !got[0].Current {
+		t.Fatalf("caller's session should remain, got %+v", got)
+	}
+}
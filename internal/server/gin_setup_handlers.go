@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+const (
+	setupStepPending  = "pending"
+	setupStepComplete = "complete"
+	setupStepSkipped  = "skipped"
+)
+
+// setupStep describes one stage of the first-boot wizard.
+type setupStep struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	State    string `json:"state"`
+	Required bool   `json:"required"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// setupStatus is the payload served by GET /api/v1/setup/status.
+type setupStatus struct {
+	Steps       []setupStep `json:"steps"`
+	Completed   bool        `json:"completed"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Locked      bool        `json:"locked"`
+	SecurePort  int         `json:"secure_port,omitempty"`
+}
+
+// setupCompletedAt reads the wizard completion timestamp from the control
+// store. A zero time means the wizard has not been finished (or the store is
+// locked and the answer is unknown).
+func (s *GinServer) setupCompletedAt(ctx context.Context) (time.Time, error) {
+	repo := s.authStalenessRepo()
+	if repo == nil {
+		return time.Time{}, errors.New("auth repo unavailable")
+	}
+	return repo.SetupCompletedAt(ctx)
+}
+
+// rejectIfSetupComplete answers 410 Gone once the wizard has been finished so
+// first-run endpoints cannot be replayed from the LAN. Before the encryption
+// keys exist the control store cannot be read and the wizard cannot have run;
+// after that, an unreadable answer refuses the request rather than letting it
+// through.
+func (s *GinServer) rejectIfSetupComplete(c *gin.Context) bool {
+	at, err := s.setupCompletedAt(c.Request.Context())
+	switch {
+	case err == nil && at.IsZero():
+		return false
+	case err == nil:
+		writeGinError(c, http.StatusGone, "setup already completed")
+	case s.cryptoManager == nil || !s.cryptoManager.IsInitialized():
+		return false
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+	default:
+		log.Printf("WARN: setup status unavailable: %v", err)
+		writeGinError(c, http.StatusServiceUnavailable, "setup status unavailable")
+	}
+	return true
+}
+
+func (s *GinServer) buildSetupStatus(ctx context.Context) setupStatus {
+	status := setupStatus{SecurePort: s.securePort}
+
+	cryptoReady := s.cryptoManager != nil && s.cryptoManager.IsInitialized()
+	status.Locked = cryptoReady && s.cryptoManager.IsLocked()
+
+	completedAt, err := s.setupCompletedAt(ctx)
+	if err == nil && !completedAt.IsZero() {
+		status.Completed = true
+		ts := completedAt.UTC()
+		status.CompletedAt = &ts
+	}
+
+	admin := setupStep{ID: "admin_password", Title: "Set admin password", State: setupStepPending, Required: true}
+	if s.authManager != nil {
+		initialized, err := s.authManager.IsInitialized(ctx)
+		switch {
+		case err == nil && initialized:
+			admin.State = setupStepComplete
+		case errors.Is(err, persistence.ErrLocked):
+			admin.Detail = "unlock Piccolo to verify"
+		}
+	}
+
+	encryption := setupStep{ID: "encryption", Title: "Set disk encryption passphrase", State: setupStepPending, Required: true}
+	if cryptoReady {
+		encryption.State = setupStepComplete
+	}
+
+	remoteStep := setupStep{ID: "remote_access", Title: "Configure remote access", State: setupStepPending}
+	if s.remoteManager != nil && s.remoteManager.Status().Enabled {
+		remoteStep.State = setupStepComplete
+	} else if status.Completed {
+		remoteStep.State = setupStepSkipped
+	}
+
+	status.Steps = []setupStep{admin, encryption, remoteStep}
+	return status
+}
+
+// handleSetupStatus: GET /api/v1/setup/status
+func (s *GinServer) handleSetupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.buildSetupStatus(c.Request.Context()))
+}
+
+// handleSetupComplete: POST /api/v1/setup/complete
+func (s *GinServer) handleSetupComplete(c *gin.Context) {
+	ctx := c.Request.Context()
+	status := s.buildSetupStatus(ctx)
+	if status.Completed {
+		c.JSON(http.StatusOK, status)
+		return
+	}
+	for _, step := range status.Steps {
+		if step.Required && step.State != setupStepComplete {
+			writeGinError(c, http.StatusConflict, "setup step incomplete: "+step.ID)
+			return
+		}
+	}
+	repo := s.authStalenessRepo()
+	if repo == nil {
+		writeGinError(c, http.StatusInternalServerError, "auth repo unavailable")
+		return
+	}
+	now := time.Now().UTC()
+	if err := repo.MarkSetupComplete(ctx, now); err != nil {
+		if errors.Is(err, persistence.ErrLocked) {
+			writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+			return
+		}
+		log.Printf("WARN: failed to persist setup completion: %v", err)
+		writeGinError(c, http.StatusInternalServerError, "failed to record setup completion")
+		return
+	}
+	if s.events != nil {
+		s.events.Publish(events.Event{
+			Topic: events.TopicAudit,
+			Payload: events.AuditEvent{
+				Kind:   "setup.complete",
+				Time:   now,
+				Source: requestClientIP(c),
+			},
+		})
+	}
+	c.JSON(http.StatusOK, s.buildSetupStatus(ctx))
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"piccolod/internal/persistence"
+)
+
+func fetchSetupStatus(t *testing.T, srv *GinServer) setupStatus {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/setup/status", nil)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup status: %d body=%s", w.Code, w.Body.String())
+	}
+	var st setupStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode setup status: %v", err)
+	}
+	return st
+}
+
+func setupStepState(t *testing.T, st setupStatus, id string) string {
+	t.Helper()
+	for _, step := range st.Steps {
+		if step.ID == id {
+			return step.State
+		}
+	}
+	t.Fatalf("setup step %q missing from %+v", id, st.Steps)
+	return ""
+}
+
+func TestSetupStatus_StepTransitions(t *testing.T) {
+	srv := setupAuthTestServer(t)
+
+	st := fetchSetupStatus(t, srv)
+	if st.Completed {
+		t.Fatalf("expected wizard incomplete on fresh device")
+	}
+	if len(st.Steps) != 3 || st.Steps[0].ID != "admin_password" || st.Steps[1].ID != "encryption" || st.Steps[2].ID != "remote_access" {
+		t.Fatalf("unexpected step order: %+v", st.Steps)
+	}
+	for _, id := range []string{"admin_password", "encryption", "remote_access"} {
+		if got := setupStepState(t, st, id); got != setupStepPending {
+			t.Fatalf("step %s: expected pending, got %s", id, got)
+		}
+	}
+	if st.SecurePort == 0 {
+		t.Fatalf("expected secure loopback port in status")
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/setup", strings.NewReader(`{"password":"WizardPass1!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("auth setup: %d body=%s", w.Code, w.Body.String())
+	}
+	st = fetchSetupStatus(t, srv)
+	if got := setupStepState(t, st, "admin_password"); got != setupStepComplete {
+		t.Fatalf("admin step: expected complete, got %s", got)
+	}
+	if got := setupStepState(t, st, "encryption"); got != setupStepPending {
+		t.Fatalf("encryption step: expected pending, got %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/crypto/setup", strings.NewReader(`{"password":"WizardPass1!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("crypto setup: %d body=%s", w.Code, w.Body.String())
+	}
+	st = fetchSetupStatus(t, srv)
+	if got := setupStepState(t, st, "encryption"); got != setupStepComplete {
+		t.Fatalf("encryption step: expected complete, got %s", got)
+	}
+	if got := setupStepState(t, st, "remote_access"); got != setupStepPending {
+		t.Fatalf("remote step: expected pending before completion, got %s", got)
+	}
+}
+
+func TestSetupComplete_RequiresSteps(t *testing.T) {
+	srv := setupAuthTestServer(t)
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/setup/complete", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while encryption pending, got %d body=%s", w.Code, w.Body.String())
+	}
+	if st := fetchSetupStatus(t, srv); st.Completed {
+		t.Fatalf("wizard must stay incomplete after rejected completion")
+	}
+}
+
+func TestSetupComplete_LocksDownFirstRunEndpoints(t *testing.T) {
+	srv := setupAuthTestServer(t)
+	cookie, csrf := setupTestAdminSession(t, srv)
+	if err := srv.cryptoManager.Setup("TestPass123!"); err != nil {
+		t.Fatalf("crypto setup: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/setup/complete", nil)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/setup/complete", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("complete: %d body=%s", w.Code, w.Body.String())
+	}
+	var st setupStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !st.Completed || st.CompletedAt == nil {
+		t.Fatalf("expected completed status, got %+v", st)
+	}
+	if got := setupStepState(t, st, "remote_access"); got != setupStepSkipped {
+		t.Fatalf("remote step: expected skipped after completion, got %s", got)
+	}
+
+	for _, path := range []string{"/api/v1/auth/setup", "/api/v1/crypto/setup"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodPost, path, strings.NewReader(`{"password":"Attacker123!"}`))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusGone {
+			t.Fatalf("%s: expected 410 after setup completion, got %d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Completing again is idempotent.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/setup/complete", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("repeat complete: %d", w.Code)
+	}
+}
+
+func TestSetup_FirstRunEndpointsRefusedWhileStoreLocked(t *testing.T) {
+	srv := setupAuthTestServer(t)
+	srv.authRepo = &fakeAuthRepo{loadErr: persistence.ErrLocked}
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(`{"password":"Attacker123!"}`))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Before the keys exist the store is unreadable, but setup cannot have
+	// been completed yet.
+	if w := post("/api/v1/crypto/setup"); w.Code != http.StatusOK {
+		t.Fatalf("first crypto setup: %d body=%s", w.Code, w.Body.String())
+	}
+
+	// Once they do, an unknown answer must not open the first-run endpoints.
+	for _, path := range []string{"/api/v1/auth/setup", "/api/v1/crypto/setup"} {
+		if w := post(path); w.Code != http.StatusLocked {
+			t.Fatalf("%s: expected 423 while the store is locked, got %d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+	if initialized, _ := srv.authManager.IsInitialized(context.Background()); initialized {
+		t.Fatalf("admin password set while setup state was unknown")
+	}
+}
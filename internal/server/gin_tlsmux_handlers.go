@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/services"
+)
+
+// handleRemoteTlsMuxConnections: GET /api/v1/remote/tlsmux/connections
+//
+// Reports the last TLS mux connection attempts for debugging clients that
+// fail to connect remotely. ?failures_only=true drops forwarded connections;
+// ?verbose=true shows full client addresses instead of masked ones.
+func (s *GinServer) handleRemoteTlsMuxConnections(c *gin.Context) {
+	var q services.MuxConnectionQuery
+	for name, dst := range map[string]*bool{"failures_only": &q.FailuresOnly, "verbose": &q.Verbose} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeGinError(c, http.StatusBadRequest, name+" must be a boolean")
+			return
+		}
+		*dst = b
+	}
+	if s.tlsMux == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "tls mux unavailable")
+		return
+	}
+	c.JSON(http.StatusOK, s.tlsMux.Connections(q))
+}
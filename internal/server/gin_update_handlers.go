@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/activity"
+	"piccolod/internal/persistence"
+	"piccolod/internal/update"
+)
+
+type osUpdateApplyRequest struct {
+	Reboot  bool `json:"reboot"`
+	Confirm bool `json:"confirm"`
+}
+
+func (s *GinServer) osUpdatesAvailable(c *gin.Context) bool {
+	if s.osUpdates == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "os updates unavailable")
+		return false
+	}
+	return true
+}
+
+// handleOSUpdateCheck queries the package manager for pending updates.
+func (s *GinServer) handleOSUpdateCheck(c *gin.Context) {
+	if !s.osUpdatesAvailable(c) {
+		return
+	}
+	res, err := s.osUpdates.Check(c.Request.Context())
+	if err != nil {
+		writeGinError(c, http.StatusBadGateway, "update check failed: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// handleOSUpdateApply starts an update job. Rebooting into the new snapshot
+// is opt-in and must be confirmed explicitly.
+func (s *GinServer) handleOSUpdateApply(c *gin.Context) {
+	if !s.osUpdatesAvailable(c) {
+		return
+	}
+	var req osUpdateApplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if req.Reboot && !req.Confirm {
+		writeGinError(c, http.StatusBadRequest, "reboot requires confirm=true")
+		return
+	}
+	job, err := s.osUpdates.Apply(c.Request.Context(), update.ApplyOptions{Reboot: req.Reboot})
+	if errors.Is(err, update.ErrJobInProgress) {
+		writeGinError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordActivity(c, "update", activity.LevelInfo, "OS update started")
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// handleOSUpdateSnapshots lists root filesystem snapshots.
+func (s *GinServer) handleOSUpdateSnapshots(c *gin.Context) {
+	if !s.osUpdatesAvailable(c) {
+		return
+	}
+	snaps, err := s.osUpdates.Snapshots(c.Request.Context())
+	if err != nil {
+		writeGinError(c, http.StatusBadGateway, "snapshot listing failed: "+err.Error())
+		return
+	}
+	if snaps == nil {
+		snaps = []update.Snapshot{}
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": snaps})
+}
+
+// handleOSUpdateRollback makes a snapshot the default for the next boot.
+func (s *GinServer) handleOSUpdateRollback(c *gin.Context) {
+	if !s.osUpdatesAvailable(c) {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("snapshot"))
+	if err != nil || id <= 0 {
+		writeGinError(c, http.StatusBadRequest, "invalid snapshot id")
+		return
+	}
+	job, err := s.osUpdates.Rollback(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, update.ErrSnapshotNotFound):
+		writeGinError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, update.ErrJobInProgress):
+		writeGinError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordActivity(c, "update", activity.LevelWarn, "OS rollback to snapshot "+strconv.Itoa(id)+" staged")
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+type selfUpdateChannelRequest struct {
+	Channel string `json:"channel"`
+}
+
+func (s *GinServer) selfUpdateAvailable(c *gin.Context) bool {
+	if s.selfUpdate == nil {
+		writeGinError(c, http.StatusServiceUnavailable, "self-update unavailable")
+		return false
+	}
+	return true
+}
+
+// handleSelfUpdateStatus reports the running and latest piccolod versions.
+func (s *GinServer) handleSelfUpdateStatus(c *gin.Context) {
+	if !s.selfUpdateAvailable(c) {
+		return
+	}
+	c.JSON(http.StatusOK, s.selfUpdate.Status(c.Request.Context()))
+}
+
+// handleSelfUpdateChannel switches between the stable and beta channels.
+func (s *GinServer) handleSelfUpdateChannel(c *gin.Context) {
+	if !s.selfUpdateAvailable(c) {
+		return
+	}
+	var req selfUpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeGinError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	err := s.selfUpdate.SetChannel(c.Request.Context(), req.Channel)
+	switch {
+	case errors.Is(err, update.ErrInvalidChannel):
+		writeGinError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, update.ErrSelfUpdateInProgress):
+		writeGinError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, persistence.ErrLocked):
+		writeGinError(c, http.StatusLocked, "storage locked; unlock Piccolo to continue")
+		return
+	case err != nil:
+		writeGinError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordActivity(c, "update", activity.LevelInfo, "piccolod release channel set to "+req.Channel)
+	c.JSON(http.StatusOK, s.selfUpdate.Status(c.Request.Context()))
+}
+
+// handleSelfUpdateApply downloads and installs the latest release. The
+// daemon restarts once the new binary is in place.
+func (s *GinServer) handleSelfUpdateApply(c *gin.Context) {
+	if !s.selfUpdateAvailable(c) {
+		return
+	}
+	err := s.selfUpdate.Apply(c.Request.Context())
+	switch {
+	case errors.Is(err, update.ErrSelfUpdateDisabled):
+		writeGinError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	case errors.Is(err, update.ErrSelfUpdateInProgress), errors.Is(err, update.ErrUpToDate):
+		writeGinError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeGinError(c, http.StatusBadGateway, "release check failed: "+err.Error())
+		return
+	}
+	st := s.selfUpdate.Status(c.Request.Context())
+	s.recordActivity(c, "update", activity.LevelInfo, "piccolod update to "+st.Available+" started")
+	c.JSON(http.StatusAccepted, st)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/cluster"
+	"piccolod/internal/health"
+	"piccolod/internal/persistence"
+	"piccolod/internal/update"
+)
+
+type stubUpdateBackend struct {
+	mu        sync.Mutex
+	snapshots []update.Snapshot
+}
+
+func (b *stubUpdateBackend) Check(ctx context.Context) ([]update.Package, error) {
+	return []update.Package{{Name: "podman", Current: "4.9.0", Available: "5.0.1"}}, nil
+}
+
+func (b *stubUpdateBackend) Apply(ctx context.Context, progress func(string)) error {
+	progress("Installing podman")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshots[0].Default = false
+	b.snapshots = append(b.snapshots, update.Snapshot{ID: 2, Default: true})
+	return nil
+}
+
+func (b *stubUpdateBackend) Snapshots(ctx context.Context) ([]update.Snapshot, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]update.Snapshot(nil), b.snapshots...), nil
+}
+
+func (b *stubUpdateBackend) Rollback(ctx context.Context, id int) error { return nil }
+func (b *stubUpdateBackend) Reboot(ctx context.Context) error           { return nil }
+
+type memoryOSUpdateRepo struct {
+	mu  sync.Mutex
+	job []byte
+}
+
+func (r *memoryOSUpdateRepo) CurrentJob(ctx context.Context) (persistence.OSUpdateJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil {
+		return persistence.OSUpdateJob{}, persistence.ErrNotFound
+	}
+	return persistence.OSUpdateJob{Payload: r.job}, nil
+}
+
+func (r *memoryOSUpdateRepo) SaveJob(ctx context.Context, job persistence.OSUpdateJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job = append([]byte(nil), job.Payload...)
+	return nil
+}
+
+type memorySelfUpdateRepo struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+func (r *memorySelfUpdateRepo) CurrentState(ctx context.Context) (persistence.SelfUpdateState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return persistence.SelfUpdateState{}, persistence.ErrNotFound
+	}
+	return persistence.SelfUpdateState{Payload: r.state}, nil
+}
+
+func (r *memorySelfUpdateRepo) SaveState(ctx context.Context, st persistence.SelfUpdateState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = append([]byte(nil), st.Payload...)
+	return nil
+}
+
+func newOSUpdateTestServer(t *testing.T) (*GinServer, *http.Cookie, string) {
+	t.Helper()
+	srv := createGinTestServer(t, t.TempDir())
+	cookie, csrf := setupTestAdminSession(t, srv)
+	srv.leadership = cluster.NewRegistry()
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleLeader)
+	backend := &stubUpdateBackend{snapshots: []update.Snapshot{{ID: 1, Active: true, Default: true}}}
+	srv.osUpdates = update.NewManager(backend, &memoryOSUpdateRepo{}, srv.events)
+	srv.observeOSUpdates(srv.events)
+	srv.selfUpdate = update.NewSelfUpdater(update.SelfUpdaterOptions{Current: "1.0.0", Repo: &memorySelfUpdateRepo{}})
+	return srv, cookie, csrf
+}
+
+func TestOSUpdate_ApplyReportsPendingReboot(t *testing.T) {
+	srv, cookie, csrf := newOSUpdateTestServer(t)
+
+	if w := doAuthedRequest(srv, nil, "", http.MethodPost, "/api/v1/updates/os/check", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/check", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "podman") {
+		t.Fatalf("check: %d body=%s", w.Code, w.Body.String())
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/apply", `{"reboot":true}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected reboot without confirm to be rejected, got %d", w.Code)
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/apply", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("apply: %d body=%s", w.Code, w.Body.String())
+	}
+	srv.osUpdates.Wait()
+
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/updates/os", "")
+	var status struct {
+		RequiresReboot bool        `json:"requires_reboot"`
+		Pending        bool        `json:"pending"`
+		Job            *update.Job `json:"job"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if !status.RequiresReboot || !status.Pending || status.Job == nil || status.Job.State != update.JobPendingReboot {
+		t.Fatalf("unexpected status: %s", w.Body.String())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		st, _ := srv.healthTracker.Status("os-update")
+		if st.Level == health.LevelWarn && st.Message == "update pending reboot" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health tracker never reported pending reboot: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOSUpdate_RequiresKernelLeader(t *testing.T) {
+	srv, cookie, csrf := newOSUpdateTestServer(t)
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleFollower)
+
+	for _, path := range []string{"/api/v1/updates/os/check", "/api/v1/updates/os/apply", "/api/v1/updates/os/rollback/1"} {
+		if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, path, ""); w.Code != http.StatusConflict {
+			t.Fatalf("%s on follower: expected 409, got %d", path, w.Code)
+		}
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/updates/os/snapshots", ""); w.Code != http.StatusOK {
+		t.Fatalf("snapshots should stay readable on followers, got %d", w.Code)
+	}
+}
+
+func TestOSUpdate_RollbackUnknownSnapshot(t *testing.T) {
+	srv, cookie, csrf := newOSUpdateTestServer(t)
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/rollback/42", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown snapshot, got %d", w.Code)
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/rollback/abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed snapshot, got %d", w.Code)
+	}
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/os/rollback/1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pending_reboot"`) {
+		t.Fatalf("rollback: %d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestSelfUpdate_ChannelAndDisabledApply(t *testing.T) {
+	srv, cookie, csrf := newOSUpdateTestServer(t)
+
+	if w := doAuthedRequest(srv, nil, "", http.MethodGet, "/api/v1/updates/piccolod", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/updates/piccolod", "")
+	var st update.SelfUpdateStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status: %d body=%s", w.Code, w.Body.String())
+	}
+	if st.Channel != update.ChannelStable || st.Error == "" {
+		t.Fatalf("expected stable channel and disabled reason without a manifest URL, got %+v", st)
+	}
+
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/piccolod/channel", `{"channel":"nightly"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown channel, got %d", w.Code)
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/piccolod/channel", `{"channel":"beta"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"channel":"beta"`) {
+		t.Fatalf("set channel: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/piccolod/apply", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when self-update is not configured, got %d", w.Code)
+	}
+
+	srv.leadership.Set(cluster.ResourceKernel, cluster.RoleFollower)
+	if w := doAuthedRequest(srv, cookie, csrf, http.MethodPost, "/api/v1/updates/piccolod/apply", ""); w.Code != http.StatusConflict {
+		t.Fatalf("apply on follower: expected 409, got %d", w.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"piccolod/internal/network"
+)
+
+// listenerDrainTimeout bounds how long a dropped listener keeps serving the
+// requests it already accepted.
+const listenerDrainTimeout = 5 * time.Second
+
+// httpListenerSet holds the admin HTTP sockets and rebinds them without a
+// restart.
+type httpListenerSet struct {
+	full        http.Handler
+	acme        http.Handler
+	redirect    http.Handler
+	connContext func(ctx context.Context, c net.Conn) context.Context
+	listen      func(network, address string) (net.Listener, error)
+
+	mu     sync.Mutex
+	active map[network.Listener]*boundListener
+	closed bool
+	failed chan error
+	done   chan struct{}
+}
+
+type boundListener struct {
+	ln  net.Listener
+	srv *http.Server
+	// dropped is set before ln is closed so Serve's accept error is not
+	// reported as a failure.
+	dropped bool
+}
+
+func newHTTPListenerSet(full, acme http.Handler) *httpListenerSet {
+	return &httpListenerSet{
+		full:   full,
+		acme:   acme,
+		listen: net.Listen,
+		active: make(map[network.Listener]*boundListener),
+		failed: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// withConnContext sets the ConnContext of every listener's server.
+func (ls *httpListenerSet) withConnContext(fn func(ctx context.Context, c net.Conn) context.Context) *httpListenerSet {
+	ls.connContext = fn
+	return ls
+}
+
+// withRedirect sets the handler of ACME listeners that redirect to HTTPS;
+// without one they answer like ACME-only listeners.
+func (ls *httpListenerSet) withRedirect(h http.Handler) *httpListenerSet {
+	ls.redirect = h
+	return ls
+}
+
+// acmeOnlyHandler answers HTTP-01 challenges and 404s everything else.
+func acmeOnlyHandler(challenges http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			http.NotFound(w, r)
+			return
+		}
+		challenges.ServeHTTP(w, r)
+	})
+}
+
+// acmeRedirectHandler answers HTTP-01 challenges and sends everything else
+// with a 308 to HTTPS on the host target picks, or 404s when it picks none.
+func acmeRedirectHandler(challenges http.Handler, target func(host string) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			challenges.ServeHTTP(w, r)
+			return
+		}
+		host := target(canonicalHost(r.Host))
+		if host == "" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// Apply moves the set to plan. Sockets no longer wanted stop accepting at
+// once but finish their in-flight requests; when a new socket cannot be
+// bound the previous set is restored and the error returned.
+func (ls *httpListenerSet) Apply(plan []network.Listener) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.closed {
+		return http.ErrServerClosed
+	}
+	want := make(map[network.Listener]bool, len(plan))
+	for _, l := range plan {
+		want[l] = true
+	}
+	var removed []network.Listener
+	var retired []*boundListener
+	for l, b := range ls.active {
+		if !want[l] {
+			removed = append(removed, l)
+			retired = append(retired, b)
+			b.dropped = true
+			b.ln.Close()
+			delete(ls.active, l)
+		}
+	}
+	defer drain(retired)
+
+	bound := make(map[network.Listener]net.Listener)
+	var bindErr error
+	for _, l := range plan {
+		if _, ok := ls.active[l]; ok {
+			continue
+		}
+		ln, err := ls.listen("tcp", l.Addr)
+		if err != nil {
+			bindErr = fmt.Errorf("listen %s: %w", l.Addr, err)
+			break
+		}
+		bound[l] = ln
+	}
+	if bindErr != nil {
+		for _, ln := range bound {
+			ln.Close()
+		}
+		for _, l := range removed {
+			ln, err := ls.listen("tcp", l.Addr)
+			if err != nil {
+				log.Printf("WARN: could not restore listener %s: %v", l.Addr, err)
+				continue
+			}
+			ls.serve(l, ln)
+		}
+		return bindErr
+	}
+	for l, ln := range bound {
+		ls.serve(l, ln)
+	}
+	return nil
+}
+
+// Addrs lists the bound listeners as planned, sorted.
+func (ls *httpListenerSet) Addrs() []network.Listener {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	out := make([]network.Listener, 0, len(ls.active))
+	for l := range ls.active {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out
+}
+
+// Wait blocks until a listener fails or the set is closed.
+func (ls *httpListenerSet) Wait() error {
+	select {
+	case err := <-ls.failed:
+		return err
+	case <-ls.done:
+		return nil
+	}
+}
+
+// Close stops every listener, letting in-flight requests finish.
+func (ls *httpListenerSet) Close() {
+	ls.mu.Lock()
+	if ls.closed {
+		ls.mu.Unlock()
+		return
+	}
+	ls.closed = true
+	retired := make([]*boundListener, 0, len(ls.active))
+	for l, b := range ls.active {
+		retired = append(retired, b)
+		delete(ls.active, l)
+	}
+	ls.mu.Unlock()
+	close(ls.done)
+	ctx, cancel := context.WithTimeout(context.Background(), listenerDrainTimeout)
+	defer cancel()
+	for _, b := range retired {
+		if err := b.srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("WARN: listener %s shutdown: %v", b.ln.Addr(), err)
+		}
+	}
+}
+
+// drain retires the servers of dropped listeners in the background so the
+// request that triggered a rebind can still be answered.
+func drain(retired []*boundListener) {
+	for _, b := range retired {
+		go func(b *boundListener) {
+			ctx, cancel := context.WithTimeout(context.Background(), listenerDrainTimeout)
+			defer cancel()
+			if err := b.srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				b.srv.Close()
+			}
+		}(b)
+	}
+}
+
+func (ls *httpListenerSet) serve(l network.Listener, ln net.Listener) {
+	handler := ls.full
+	if l.ACMEOnly {
+		handler = ls.acme
+		if l.Redirect && ls.redirect != nil {
+			handler = ls.redirect
+		}
+	}
+	b := &boundListener{
+		ln: ln,
+		srv: &http.Server{
+			Handler:           handler,
+			ConnContext:       ls.connContext,
+			ReadHeaderTimeout: 30 * time.Second,
+		},
+	}
+	ls.active[l] = b
+	go func() {
+		err := b.srv.Serve(ln)
+		ls.mu.Lock()
+		dropped := b.dropped || ls.closed
+		ls.mu.Unlock()
+		if dropped || errors.Is(err, http.ErrServerClosed) {
+			return
+		}
+		select {
+		case ls.failed <- fmt.Errorf("listener %s: %w", l.Addr, err):
+		default:
+		}
+	}()
+}
@@ -52,7 +52,8 @@ func (v *openAPIValidator) Middleware() gin.HandlerFunc {
         route, pathParams, err := v.router.FindRoute(c.Request)
         if err != nil {
             // No matching route in spec -> 404/405 at router later; mark as bad request here
-            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Request not in API spec", "detail": err.Error()})
+            writeGinErrorDetails(c, http.StatusBadRequest, errorCodeValidationFailed, "Request not in API spec", gin.H{"detail": err.Error()})
+            c.Abort()
             return
         }
         // Validate request
@@ -73,7 +74,8 @@ func (v *openAPIValidator) Middleware() gin.HandlerFunc {
         }
         input.Options = opts
         if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
-            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Request failed validation", "detail": err.Error()})
+            writeGinErrorDetails(c, http.StatusBadRequest, errorCodeValidationFailed, "Request failed validation", gin.H{"detail": err.Error()})
+            c.Abort()
             return
         }
         c.Next()
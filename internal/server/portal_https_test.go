@@ -10,7 +10,9 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -18,6 +20,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"piccolod/internal/network"
 	"piccolod/internal/remote"
 	"piccolod/internal/remote/nexusclient"
 )
@@ -212,3 +215,156 @@ func mustSelfSignedCert(t *testing.T, host string) *tls.Certificate {
 	}
 	return &pair
 }
+
+func TestForwardedProtoOnlyHonouredFromTrustedProxies(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+	const host = "portal.example.com"
+	srv.applyRemoteRuntimeFromStatus(remote.Status{Enabled: true, PortalHostname: host, TLD: "example.com"})
+	srv.router.GET("/test/client", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ip": requestClientIP(c), "gin_ip": c.ClientIP(), "secure": srv.requestSecure(c)})
+	})
+
+	send := func(remoteAddr, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A LAN client cannot claim https to dodge the redirect or earn HSTS.
+	w := send("192.168.1.50:40000", "/api/v1/health/live")
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected spoofed proto from untrusted peer to be redirected, got %d", w.Code)
+	}
+	w = send("192.168.1.50:40000", "/test/client")
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected redirect for untrusted peer, got %d", w.Code)
+	}
+
+	// Loopback peers are the mux and Nexus relaying raw client bytes, so
+	// without a connection hint their headers are the client's own.
+	w = send("127.0.0.1:40000", "/test/client")
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected spoofed proto over loopback to be redirected, got %d", w.Code)
+	}
+
+	trusted, err := network.ParseTrustedProxies("10.0.0.5")
+	if err != nil {
+		t.Fatalf("trusted proxies: %v", err)
+	}
+	srv.trustedProxies = trusted
+	if err := srv.router.SetTrustedProxies(trusted.CIDRs()); err != nil {
+		t.Fatalf("gin trusted proxies: %v", err)
+	}
+	w = send("10.0.0.5:40000", "/test/client")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected trusted proxy request served, got %d", w.Code)
+	}
+	if w.Header().Get("Strict-Transport-Security") == "" {
+		t.Fatalf("expected HSTS for https forwarded by a trusted proxy")
+	}
+	want := `{"gin_ip":"203.0.113.7","ip":"203.0.113.7","secure":true}`
+	if got := w.Body.String(); got != want {
+		t.Fatalf("client context = %s, want %s", got, want)
+	}
+}
+
+func TestPortalRelayedConnectionsIgnoreSpoofedHeaders(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.tlsMux.Stop()
+	srv.startSecureLoopback()
+	t.Cleanup(srv.stopSecureLoopback)
+
+	const host = "portal.example.com"
+	srv.tlsMux.SetCertProvider(&staticCertProvider{cert: mustSelfSignedCert(t, host)})
+	srv.applyRemoteRuntimeFromStatus(remote.Status{Enabled: true, PortalHostname: host, TLD: "example.com"})
+	srv.router.GET("/test/client", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ip": requestClientIP(c), "secure": srv.requestSecure(c)})
+	})
+	spoofed := "GET /test/client HTTP/1.1\r\nHost: " + host + "\r\nX-Forwarded-For: 203.0.113.7\r\nX-Forwarded-Proto: http\r\nConnection: close\r\n\r\n"
+	read := func(conn net.Conn) (string, error) {
+		if _, err := conn.Write([]byte(spoofed)); err != nil {
+			return "", err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("status %d body=%s", resp.StatusCode, body)
+		}
+		return string(body), nil
+	}
+
+	// Through the TLS mux the portal sees a loopback peer; the client's
+	// headers must not pick its address or scheme. The mux is reapplied
+	// until it routes, as storage attaching in the background resets it
+	// to the stored remote config.
+	var got string
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		srv.applyRemoteRuntimeFromStatus(remote.Status{Enabled: true, PortalHostname: host, TLD: "example.com"})
+		conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", srv.tlsMux.Port()), &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		if err == nil {
+			got, err = read(conn)
+			conn.Close()
+		}
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("request through the mux: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if want := `{"ip":"127.0.0.1","secure":true}`; got != want {
+		t.Fatalf("through the mux: client context = %s, want %s", got, want)
+	}
+
+	// A Nexus connection to the plain listener takes the client from the
+	// hint the adapter registered for it.
+	portal := httptest.NewUnstartedServer(srv.router)
+	portal.Config.ConnContext = srv.portalConnContext
+	portal.Start()
+	defer portal.Close()
+	plain, err := net.Dial("tcp", portal.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial portal: %v", err)
+	}
+	defer plain.Close()
+	portalPort := portal.Listener.Addr().(*net.TCPAddr).Port
+	srv.remoteResolver.RecordConnectionHint(portalPort, plain.LocalAddr().(*net.TCPAddr).Port, 443, true, "198.51.100.7")
+	got, err = read(plain)
+	if err != nil {
+		t.Fatalf("request relayed by nexus: %v", err)
+	}
+	if want := `{"ip":"198.51.100.7","secure":true}`; got != want {
+		t.Fatalf("relayed by nexus: client context = %s, want %s", got, want)
+	}
+}
+
+func TestClientContextIgnoresSpoofedHeadersFromUntrustedPeer(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	srv.router.GET("/test/client", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ip": requestClientIP(c), "gin_ip": c.ClientIP(), "secure": srv.requestSecure(c)})
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://piccolo.local/test/client", nil)
+	req.RemoteAddr = "192.168.1.50:40000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	want := `{"gin_ip":"192.168.1.50","ip":"192.168.1.50","secure":false}`
+	if got := w.Body.String(); got != want {
+		t.Fatalf("client context = %s, want %s", got, want)
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatalf("spoofed proto must not enable HSTS")
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"piccolod/internal/services"
+)
+
+// portalAppsPath is the only namespace app listeners are served under;
+// the rest of the portal, including the login and unlock pages, always
+// stays the web UI's.
+const portalAppsPath = "/apps/"
+
+// portalPathEndpoint returns the app listener whose path_prefix claims the
+// request path, if any.
+func (s *GinServer) portalPathEndpoint(path string) (services.ServiceEndpoint, bool) {
+	if s.serviceManager == nil || !strings.HasPrefix(path, portalAppsPath) {
+		return services.ServiceEndpoint{}, false
+	}
+	return s.serviceManager.ResolvePathPrefix(path)
+}
+
+// servePortalPath proxies a request under an app listener's path_prefix,
+// reporting whether one claimed it. A portal session is required unless
+// the listener is public; the session cookie is not passed to the app.
+func (s *GinServer) servePortalPath(c *gin.Context) bool {
+	ep, ok := s.portalPathEndpoint(c.Request.URL.Path)
+	if !ok {
+		return false
+	}
+	if !ep.PublicPath {
+		id, ok := s.getSession(c)
+		if !ok {
+			writeGinError(c, http.StatusUnauthorized, "Unauthorized")
+			return true
+		}
+		if _, err := s.sessions.Touch(id); err != nil {
+			s.writeSessionError(c, err)
+			return true
+		}
+	}
+	// Relative links in the app's pages resolve against the trailing slash.
+	if c.Request.URL.Path == ep.PathPrefix && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+		target := ep.PathPrefix + "/"
+		if q := c.Request.URL.RawQuery; q != "" {
+			target += "?" + q
+		}
+		c.Redirect(http.StatusMovedPermanently, target)
+		return true
+	}
+	dropSessionCookie(c.Request)
+	s.serviceManager.ProxyManager().ServePath(c.Writer, c.Request, ep, s.requestSecure(c))
+	return true
+}
+
+// dropSessionCookie removes the portal session from the cookies sent on.
+func dropSessionCookie(r *http.Request) {
+	cookies := r.Cookies()
+	kept := make([]string, 0, len(cookies))
+	for _, ck := range cookies {
+		if ck.Name != sessionCookieName {
+			kept = append(kept, ck.Name+"="+ck.Value)
+		}
+	}
+	r.Header.Del("Cookie")
+	if len(kept) > 0 {
+		r.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// portalBackend stands in for an app's web UI on its host bind and
+// remembers the last request it saw.
+type portalBackend struct {
+	mu   sync.Mutex
+	last *http.Request
+}
+
+func (b *portalBackend) lastRequest() *http.Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+func servePortalBackend(t *testing.T, port int) *portalBackend {
+	t.Helper()
+	b := &portalBackend{}
+	self := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/", Domain: "127.0.0.1", HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "pref", Value: "dark"})
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+	})
+	mux.HandleFunc("/absolute", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, self+"/home?tab=1", http.StatusFound)
+	})
+	mux.HandleFunc("/external", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.org/docs", http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("page " + r.URL.Path))
+	})
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("listen on %d: %v", port, err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		b.last = r.Clone(r.Context())
+		b.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return b
+}
+
+func TestPortalPaths_ProxyAppsUnderPrefix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := createGinTestServer(t, t.TempDir())
+	defer srv.serviceManager.StopAll()
+	cookie, csrf := setupTestAdminSession(t, srv)
+	install := func(name, extra string) *httptest.ResponseRecorder {
+		payload := "name: " + name + "\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: " + name + "\n    guest_port: 80\n    flow: tcp\n    protocol: http\n" + extra
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	// Proxied requests go through a real listener: the reverse proxy needs
+	// a response writer that httptest.ResponseRecorder does not provide.
+	portal := httptest.NewServer(srv.router)
+	defer portal.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, portal.URL+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		w := httptest.NewRecorder()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return w
+	}
+	backendFor := func(app string) *portalBackend {
+		eps, err := srv.serviceManager.GetByApp(app)
+		if err != nil || len(eps) != 1 {
+			t.Fatalf("endpoints of %s: %+v (%v)", app, eps, err)
+		}
+		return servePortalBackend(t, eps[0].HostBind)
+	}
+
+	if w := install("sync", "    path_prefix: /apps/sync/\n"); w.Code != http.StatusCreated {
+		t.Fatalf("install sync: %d body=%s", w.Code, w.Body.String())
+	}
+	if w := install("wiki", "    path_prefix: /apps/wiki\n    strip_prefix: false\n    public: true\n"); w.Code != http.StatusCreated {
+		t.Fatalf("install wiki: %d body=%s", w.Code, w.Body.String())
+	}
+	syncApp, wikiApp := backendFor("sync"), backendFor("wiki")
+
+	// A portal session is required by default.
+	checkErrorEnvelope(t, "no session", get("/apps/sync/login"), http.StatusUnauthorized, errorCodeUnauthorized)
+	if syncApp.lastRequest() != nil {
+		t.Fatalf("backend reached without a session")
+	}
+
+	w := get("/apps/sync/login", cookie, &http.Cookie{Name: "theme", Value: "light"})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/apps/sync/dashboard" {
+		t.Fatalf("expected the redirect moved under the prefix, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Header().Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "sid=abc; Path=/apps/sync; HttpOnly" || cookies[1] != "pref=dark" {
+		t.Fatalf("unexpected cookies %q", cookies)
+	}
+	seen := syncApp.lastRequest()
+	if seen.URL.Path != "/login" || seen.Header.Get("X-Forwarded-Prefix") != "/apps/sync" {
+		t.Fatalf("backend saw %s with prefix %q", seen.URL.Path, seen.Header.Get("X-Forwarded-Prefix"))
+	}
+	if _, err := seen.Cookie(sessionCookieName); err == nil {
+		t.Fatalf("portal session passed to the app")
+	}
+	if c, err := seen.Cookie("theme"); err != nil || c.Value != "light" {
+		t.Fatalf("app cookie not passed: %v", err)
+	}
+	if loc := get("/apps/sync/absolute", cookie).Header().Get("Location"); loc != "/apps/sync/home?tab=1" {
+		t.Fatalf("absolute backend redirect not rewritten: %q", loc)
+	}
+	if loc := get("/apps/sync/external", cookie).Header().Get("Location"); loc != "https://example.org/docs" {
+		t.Fatalf("external redirect rewritten: %q", loc)
+	}
+	if w := get("/apps/sync?x=1", cookie); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/apps/sync/?x=1" {
+		t.Fatalf("expected the bare prefix redirected to its slash, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/apps/sync/", cookie); w.Code != http.StatusOK || w.Body.String() != "page /" {
+		t.Fatalf("unexpected app root %d %q", w.Code, w.Body.String())
+	}
+
+	// public opts out of the session; strip_prefix: false passes paths and
+	// redirects through unchanged.
+	if w := get("/apps/wiki/login?to=/dashboard"); w.Code != http.StatusFound || w.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("public prefixed app: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/apps/wiki/page/1"); w.Code != http.StatusOK || w.Body.String() != "page /apps/wiki/page/1" || wikiApp.lastRequest().URL.Path != "/apps/wiki/page/1" {
+		t.Fatalf("expected the full path passed on, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/apps/syncthing/"); w.Code == http.StatusFound || w.Code == http.StatusUnauthorized {
+		t.Fatalf("prefix matched a longer segment: %d", w.Code)
+	}
+
+	// GET /services shows where the portal serves each app.
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/services", nil)
+	attachAuth(req, cookie, csrf)
+	srv.router.ServeHTTP(w, req)
+	var list struct {
+		Services []serviceEntry `json:"services"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode services: %v", err)
+	}
+	paths := map[string]string{}
+	for _, e := range list.Services {
+		paths[e.App] = e.PortalPath
+	}
+	if paths["sync"] != "/apps/sync/" || paths["wiki"] != "/apps/wiki/" {
+		t.Fatalf("unexpected portal paths %v", paths)
+	}
+
+	// Prefixes may not shadow portal routes or another app.
+	checkErrorEnvelope(t, "reserved prefix", install("acme", "    path_prefix: /.well-known/acme-challenge\n"), http.StatusBadRequest, errorCodeValidationFailed)
+	for _, page := range []string{"/login", "/unlock"} {
+		checkErrorEnvelope(t, "portal page "+page, install("phish", "    path_prefix: "+page+"\n    public: true\n"), http.StatusBadRequest, errorCodeValidationFailed)
+	}
+	w = install("syncadmin", "    path_prefix: /apps/sync/admin\n")
+	apiErr := checkErrorEnvelope(t, "overlapping prefix", w, http.StatusConflict, errorCodePathPrefixConflict)
+	if details, _ := apiErr.Details.(map[string]any)["path_prefix_conflict"].(map[string]any); details["conflicting_app"] != "sync" || details["conflicting_prefix"] != "/apps/sync" {
+		t.Fatalf("unexpected conflict details %+v", apiErr.Details)
+	}
+	if _, err := srv.serviceManager.GetByApp("syncadmin"); err == nil {
+		t.Fatalf("rejected app kept its endpoints")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"piccolod/internal/persistence"
 	"piccolod/internal/remote"
@@ -16,6 +17,8 @@ import (
 )
 
 type bootstrapRemoteStorage struct {
+	// mu orders Save's revision check against the writes that follow it.
+	mu   sync.Mutex
 	repo persistence.RemoteRepo
 	path string
 	root string
@@ -32,78 +35,168 @@ func newBootstrapRemoteStorage(repo persistence.RemoteRepo, baseDir string) remo
 	}
 }
 
+// Load returns the remote config. The bootstrap file only holds what the
+// tunnel needs before unlock; credentials come from the encrypted control
+// store and are merged in once it is readable. While it is locked, Load
+// returns the bootstrap half with remote.ErrUnlockRequired.
 func (s *bootstrapRemoteStorage) Load(ctx context.Context) (remote.Config, error) {
 	if s == nil {
 		return remote.Config{}, errors.New("remote storage: unavailable")
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if !s.isMounted() {
 		if s.repo == nil {
 			return remote.Config{}, remote.ErrLocked
 		}
-		repoCfg, err := s.repo.CurrentConfig(ctx)
-		if err != nil {
-			if errors.Is(err, persistence.ErrLocked) {
-				return remote.Config{}, remote.ErrLocked
-			}
-			if errors.Is(err, persistence.ErrNotFound) {
-				return remote.Config{}, nil
-			}
-			return remote.Config{}, err
+		cfg, _, err := s.loadRepo(ctx)
+		return cfg, err
+	}
+	boot, haveBoot, err := s.loadBootstrap()
+	if err != nil {
+		return remote.Config{}, err
+	}
+	if s.repo == nil {
+		return boot.WithoutSecrets(), nil
+	}
+	full, haveRepo, err := s.loadRepo(ctx)
+	if err != nil {
+		if errors.Is(err, remote.ErrLocked) && haveBoot {
+			return boot.WithoutSecrets(), remote.ErrUnlockRequired
+		}
+		return remote.Config{}, err
+	}
+	if !haveBoot {
+		if haveRepo {
+			s.writeBootstrap(full)
+		}
+		return full, nil
+	}
+	cfg := boot.WithoutSecrets()
+	cfg.MergeSecrets(full)
+	if boot.HasSecrets() {
+		// Older releases kept credentials in the bootstrap file. Move them
+		// into the control store and rewrite the file without them.
+		if !full.HasSecrets() {
+			cfg.MergeSecrets(boot)
+		}
+		if err := s.saveRepo(ctx, cfg); err != nil {
+			log.Printf("WARN: failed to migrate remote credentials to control store: %v", err)
+			return cfg, nil
 		}
-		if len(repoCfg.Payload) == 0 {
-			return remote.Config{}, nil
+		s.writeBootstrap(cfg)
+	}
+	return cfg, nil
+}
+
+// Save writes the credentials-bearing config to the control store and the
+// stripped copy to the bootstrap volume. While the control store is locked
+// only the bootstrap half is written and remote.ErrUnlockRequired returned.
+// The stored revision is the newer of the two copies; a config saved over
+// an older one fails with remote.ErrConflict.
+func (s *bootstrapRemoteStorage) Save(ctx context.Context, cfg remote.Config) error {
+	if s == nil {
+		return errors.New("remote storage: unavailable")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isMounted() {
+		return remote.ErrLocked
+	}
+	stored, err := s.storedRevision(ctx)
+	if err != nil {
+		return err
+	}
+	if stored != cfg.Revision {
+		return fmt.Errorf("%w: stored revision %d, saving over %d", remote.ErrConflict, stored, cfg.Revision)
+	}
+	cfg.Revision++
+	var result error
+	if s.repo != nil {
+		if err := s.saveRepo(ctx, cfg); err != nil {
+			if !errors.Is(err, remote.ErrLocked) {
+				return err
+			}
+			result = remote.ErrUnlockRequired
 		}
-		var cfg remote.Config
-		if err := json.Unmarshal(repoCfg.Payload, &cfg); err != nil {
-			return remote.Config{}, err
+	}
+	payload, err := json.MarshalIndent(cfg.WithoutSecrets(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeAtomicJSON(s.path, payload, 0o600); err != nil {
+		return err
+	}
+	return result
+}
+
+// storedRevision returns the newest revision held by the bootstrap file or,
+// when readable, the control store.
+func (s *bootstrapRemoteStorage) storedRevision(ctx context.Context) (uint64, error) {
+	boot, _, err := s.loadBootstrap()
+	if err != nil {
+		return 0, err
+	}
+	rev := boot.Revision
+	if s.repo != nil {
+		full, _, err := s.loadRepo(ctx)
+		if err != nil && !errors.Is(err, remote.ErrLocked) {
+			return 0, err
 		}
-		return cfg, nil
+		rev = max(rev, full.Revision)
 	}
+	return rev, nil
+}
+
+func (s *bootstrapRemoteStorage) loadBootstrap() (remote.Config, bool, error) {
 	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return remote.Config{}, false, nil
+	}
+	if err != nil {
+		return remote.Config{}, false, err
+	}
+	var cfg remote.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		log.Printf("WARN: bootstrap remote config parse failed (%v); falling back to repo", err)
+		_ = os.Remove(s.path)
+		return remote.Config{}, false, nil
+	}
+	return cfg, true, nil
+}
+
+func (s *bootstrapRemoteStorage) writeBootstrap(cfg remote.Config) {
+	payload, err := json.MarshalIndent(cfg.WithoutSecrets(), "", "  ")
 	if err == nil {
-		var cfg remote.Config
-		if parseErr := json.Unmarshal(data, &cfg); parseErr == nil {
-			return cfg, nil
-		} else {
-			log.Printf("WARN: bootstrap remote config parse failed (%v); falling back to repo", parseErr)
-			_ = os.Remove(s.path)
-		}
-	} else if !errors.Is(err, os.ErrNotExist) {
-		return remote.Config{}, err
+		err = writeAtomicJSON(s.path, payload, 0o600)
 	}
-	if s.repo == nil {
-		return remote.Config{}, nil
+	if err != nil {
+		log.Printf("WARN: failed to seed bootstrap remote config: %v", err)
 	}
+}
+
+func (s *bootstrapRemoteStorage) loadRepo(ctx context.Context) (remote.Config, bool, error) {
 	repoCfg, err := s.repo.CurrentConfig(ctx)
 	if err != nil {
 		if errors.Is(err, persistence.ErrLocked) {
-			return remote.Config{}, remote.ErrLocked
+			return remote.Config{}, false, remote.ErrLocked
 		}
 		if errors.Is(err, persistence.ErrNotFound) {
-			return remote.Config{}, nil
+			return remote.Config{}, false, nil
 		}
-		return remote.Config{}, err
+		return remote.Config{}, false, err
 	}
 	if len(repoCfg.Payload) == 0 {
-		return remote.Config{}, nil
+		return remote.Config{}, false, nil
 	}
 	var cfg remote.Config
 	if err := json.Unmarshal(repoCfg.Payload, &cfg); err != nil {
-		return remote.Config{}, err
+		return remote.Config{}, false, err
 	}
-	if err := writeAtomicJSON(s.path, repoCfg.Payload, 0o600); err != nil {
-		log.Printf("WARN: failed to seed bootstrap remote config: %v", err)
-	}
-	return cfg, nil
+	return cfg, true, nil
 }
 
-func (s *bootstrapRemoteStorage) Save(ctx context.Context, cfg remote.Config) error {
-	if s == nil {
-		return errors.New("remote storage: unavailable")
-	}
-	if !s.isMounted() {
-		return remote.ErrLocked
-	}
+func (s *bootstrapRemoteStorage) saveRepo(ctx context.Context, cfg remote.Config) error {
 	if cfg.DNSCredentials == nil {
 		cfg.DNSCredentials = map[string]string{}
 	}
@@ -111,15 +204,10 @@ func (s *bootstrapRemoteStorage) Save(ctx context.Context, cfg remote.Config) er
 	if err != nil {
 		return err
 	}
-	if s.repo != nil {
-		if err := s.repo.SaveConfig(ctx, persistence.RemoteConfig{Payload: payload}); err != nil {
-			if errors.Is(err, persistence.ErrLocked) {
-				return remote.ErrLocked
-			}
-			return err
+	if err := s.repo.SaveConfig(ctx, persistence.RemoteConfig{Payload: payload}); err != nil {
+		if errors.Is(err, persistence.ErrLocked) {
+			return remote.ErrLocked
 		}
-	}
-	if err := writeAtomicJSON(s.path, payload, 0o600); err != nil {
 		return err
 	}
 	return nil
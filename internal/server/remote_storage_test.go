@@ -6,6 +6,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"piccolod/internal/persistence"
@@ -184,17 +185,202 @@ func TestBootstrapRemoteStorage_SaveRepoLocked(t *testing.T) {
 	storage := newBootstrapRemoteStorage(repo, dir)
 	cfg := remote.Config{Endpoint: "wss://nexus.example.com/connect"}
 
+	cfg.DNSCredentials = map[string]string{"api_token": "cf-token"}
+
 	err := storage.Save(context.Background(), cfg)
-	if !errors.Is(err, remote.ErrLocked) {
-		t.Fatalf("expected remote.ErrLocked, got %v", err)
+	if !errors.Is(err, remote.ErrUnlockRequired) || !errors.Is(err, remote.ErrLocked) {
+		t.Fatalf("expected remote.ErrUnlockRequired, got %v", err)
 	}
 	if repo.saveCalls != 1 {
 		t.Fatalf("expected repo save to be attempted once, got %d", repo.saveCalls)
 	}
+	fromFile := readBootstrapFile(t, dir)
+	if fromFile.Endpoint != cfg.Endpoint {
+		t.Fatalf("expected bootstrap half written while locked, got %+v", fromFile)
+	}
+}
+
+func TestBootstrapRemoteStorage_SaveRejectsStaleRevision(t *testing.T) {
+	dir := t.TempDir()
+	prepareBootstrapMount(t, dir)
+	repo := &stubRemoteRepo{}
+	storage := newBootstrapRemoteStorage(repo, dir)
+	ctx := context.Background()
+
+	if err := storage.Save(ctx, remote.Config{Endpoint: "wss://nexus.example.com/connect"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := storage.Save(ctx, remote.Config{Endpoint: "wss://other.example.com/connect"}); !errors.Is(err, remote.ErrConflict) {
+		t.Fatalf("expected remote.ErrConflict, got %v", err)
+	}
+
+	// A write through the control store alone moves the revision too.
+	cfg, err := storage.Load(ctx)
+	if err != nil || cfg.Revision != 1 {
+		t.Fatalf("load: %+v err=%v", cfg, err)
+	}
+	ahead := cfg
+	ahead.Revision = 5
+	payload, _ := json.Marshal(ahead)
+	repo.cfg = persistence.RemoteConfig{Payload: payload}
+	if err := storage.Save(ctx, cfg); !errors.Is(err, remote.ErrConflict) {
+		t.Fatalf("expected remote.ErrConflict behind the control store, got %v", err)
+	}
+	cfg.Revision = 5
+	if err := storage.Save(ctx, cfg); err != nil {
+		t.Fatalf("save at current revision: %v", err)
+	}
+	if got := readBootstrapFile(t, dir); got.Revision != 6 {
+		t.Fatalf("expected revision 6 in bootstrap file, got %d", got.Revision)
+	}
+}
+
+func readBootstrapFile(t *testing.T, dir string) remote.Config {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "remote", "config.json"))
+	if err != nil {
+		t.Fatalf("read bootstrap file: %v", err)
+	}
+	if strings.Contains(string(data), "dns_credentials") || strings.Contains(string(data), "cf-token") {
+		t.Fatalf("bootstrap file contains DNS credentials: %s", data)
+	}
+	var cfg remote.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("unmarshal bootstrap file: %v", err)
+	}
+	return cfg
+}
+
+func TestBootstrapRemoteStorage_CredentialsOnlyInRepo(t *testing.T) {
+	dir := t.TempDir()
+	prepareBootstrapMount(t, dir)
+	repo := &stubRemoteRepo{}
+	storage := newBootstrapRemoteStorage(repo, dir)
+	want := remote.Config{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "device-secret",
+		DNSProvider:    "cloudflare",
+		DNSCredentials: map[string]string{"api_token": "cf-token"},
+	}
+	if err := storage.Save(context.Background(), want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if fromFile := readBootstrapFile(t, dir); fromFile.DeviceSecret != want.DeviceSecret || fromFile.DNSProvider != "cloudflare" {
+		t.Fatalf("bootstrap half missing connection fields: %+v", fromFile)
+	}
+	if !strings.Contains(string(repo.saved.Payload), "cf-token") {
+		t.Fatalf("repo payload missing credentials: %s", repo.saved.Payload)
+	}
+
+	got, err := storage.Load(context.Background())
+	if err != nil || got.DNSCredentials["api_token"] != "cf-token" {
+		t.Fatalf("unlocked load should merge credentials, got %+v err=%v", got, err)
+	}
+
+	repo.err = persistence.ErrLocked
+	got, err = storage.Load(context.Background())
+	if !errors.Is(err, remote.ErrUnlockRequired) {
+		t.Fatalf("expected ErrUnlockRequired while locked, got %v", err)
+	}
+	if got.Endpoint != want.Endpoint || got.DeviceSecret != want.DeviceSecret || len(got.DNSCredentials) != 0 {
+		t.Fatalf("locked load should return the bootstrap half only, got %+v", got)
+	}
+	readBootstrapFile(t, dir)
+}
+
+func TestBootstrapRemoteStorage_MigratesLegacyCredentials(t *testing.T) {
+	dir := t.TempDir()
+	prepareBootstrapMount(t, dir)
+	legacy := remote.Config{Endpoint: "wss://nexus.example.com/connect", DNSCredentials: map[string]string{"api_token": "cf-token"}}
+	data, _ := json.Marshal(legacy)
 	path := filepath.Join(dir, "remote", "config.json")
-	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
-		t.Fatalf("expected bootstrap file absent on locked repo, stat err=%v", err)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	repo := &stubRemoteRepo{err: persistence.ErrLocked}
+	storage := newBootstrapRemoteStorage(repo, dir)
+
+	if got, err := storage.Load(context.Background()); !errors.Is(err, remote.ErrUnlockRequired) || got.HasSecrets() {
+		t.Fatalf("locked load: got %+v err=%v", got, err)
+	}
+
+	repo.err = nil
+	got, err := storage.Load(context.Background())
+	if err != nil || got.DNSCredentials["api_token"] != "cf-token" {
+		t.Fatalf("unlocked load: got %+v err=%v", got, err)
+	}
+	if !strings.Contains(string(repo.saved.Payload), "cf-token") {
+		t.Fatalf("credentials not migrated to repo: %s", repo.saved.Payload)
+	}
+	readBootstrapFile(t, dir)
+}
+
+func TestRemoteManager_CredentialsRequireUnlock(t *testing.T) {
+	dir := t.TempDir()
+	prepareBootstrapMount(t, dir)
+	repo := &stubRemoteRepo{}
+	storage := newBootstrapRemoteStorage(repo, dir)
+	seed := remote.Config{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "device-secret",
+		Solver:         "dns-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+		DNSProvider:    "cloudflare",
+		DNSCredentials: map[string]string{"api_token": "cf-token"},
+		Certificates:   []remote.Certificate{{ID: "wildcard", Domains: []string{"*.example.com"}}},
+	}
+	if err := storage.Save(context.Background(), seed); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	repo.err = persistence.ErrLocked
+	mgr, err := remote.NewManagerWithStorage(storage, dir)
+	if err != nil {
+		t.Fatalf("manager init: %v", err)
+	}
+	if st := mgr.Status(); st.Endpoint != seed.Endpoint {
+		t.Fatalf("connection settings should be available before unlock, got %+v", st)
+	}
+	err = mgr.Configure(remote.ConfigureRequest{
+		Endpoint:       seed.Endpoint,
+		Solver:         "dns-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+		DNSProvider:    "cloudflare",
+		DNSCredentials: map[string]string{"api_token": "new-token"},
+	})
+	if !errors.Is(err, remote.ErrUnlockRequired) {
+		t.Fatalf("configure before unlock: expected ErrUnlockRequired, got %v", err)
+	}
+	if err := mgr.RenewCertificate("wildcard"); !errors.Is(err, remote.ErrUnlockRequired) {
+		t.Fatalf("wildcard renewal before unlock: %v", err)
+	}
+
+	// A save while locked (e.g. preflight) keeps the stored credentials.
+	if _, err := mgr.RunPreflight(context.Background()); err != nil && errors.Is(err, remote.ErrLocked) {
+		t.Fatalf("preflight while locked: %v", err)
+	}
+	readBootstrapFile(t, dir)
+
+	repo.err = nil
+	if err := mgr.ReloadFromStorage(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := mgr.RunPreflight(context.Background()); err != nil && errors.Is(err, remote.ErrLocked) {
+		t.Fatalf("preflight after unlock: %v", err)
+	}
+	var stored remote.Config
+	if err := json.Unmarshal(repo.cfg.Payload, &stored); err != nil {
+		t.Fatalf("repo payload: %v", err)
+	}
+	if stored.DNSCredentials["api_token"] != "cf-token" {
+		t.Fatalf("credentials lost across locked save, repo=%s", repo.cfg.Payload)
 	}
+	readBootstrapFile(t, dir)
 }
 
 func TestBootstrapRemoteStorage_SaveMountNotReady(t *testing.T) {
@@ -65,3 +65,47 @@ func TestServiceRemoteResolver(t *testing.T) {
 
 	svc.Stop()
 }
+
+func TestServiceRemoteResolverPassthroughListeners(t *testing.T) {
+	svc := services.NewServiceManager()
+	defer svc.Stop()
+	resolver := newServiceRemoteResolver(svc)
+
+	eps, err := svc.AllocateForApp("game", []api.AppListener{
+		{Name: "srv", GuestPort: 25565, Flow: api.FlowTCP, Protocol: api.ListenerProtocolTCP, RemotePorts: []int{25565}},
+		{Name: "voice", GuestPort: 9987, Flow: api.FlowTCP, Protocol: api.ListenerProtocolUDP, RemotePorts: []int{9987}},
+	})
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	byName := map[string]services.ServiceEndpoint{}
+	for _, ep := range eps {
+		byName[ep.Name] = ep
+	}
+
+	resolver.UpdateConfig(nexusclient.Config{PortalHostname: "portal.example.com", TLD: "example.com"})
+	resolver.SetTlsMuxPort(9090)
+
+	port, ok := resolver.Resolve("srv.example.com", 25565, true)
+	if !ok || port != byName["srv"].PublicPort {
+		t.Fatalf("expected raw tcp to bypass the tls mux and reach %d, got %d (ok=%v)", byName["srv"].PublicPort, port, ok)
+	}
+	port, ok = resolver.Resolve("", 25565, false)
+	if !ok || port != byName["srv"].PublicPort {
+		t.Fatalf("expected port-only lookup to reach %d, got %d (ok=%v)", byName["srv"].PublicPort, port, ok)
+	}
+	if _, ok := resolver.Resolve("voice.example.com", 9987, false); ok {
+		t.Fatalf("udp listeners cannot be served over nexus streams")
+	}
+
+	if !resolver.PortMappingsStale() {
+		t.Fatalf("expected unadvertised mappings to be stale")
+	}
+	mappings := resolver.RemotePortMappings()
+	if len(mappings) != 1 || mappings[25565] != byName["srv"].PublicPort {
+		t.Fatalf("unexpected remote port mappings: %+v", mappings)
+	}
+	if resolver.PortMappingsStale() {
+		t.Fatalf("expected mappings to be current after advertisement")
+	}
+}
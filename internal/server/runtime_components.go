@@ -11,7 +11,7 @@ import (
 // newLeadershipObserver registers a supervisor component that logs leadership events.
 func newLeadershipObserver(bus *events.Bus) supervisor.Component {
 	observer := &leadershipObserver{bus: bus}
-	return supervisor.NewComponent("leadership-observer", observer.start, observer.stop)
+	return supervisor.NewComponent("leadership-observer", observer.start, observer.stop, supervisor.DependsOn("consensus"))
 }
 
 type leadershipObserver struct {
@@ -27,6 +27,7 @@ func (o *leadershipObserver) start(ctx context.Context) error {
 	runCtx, cancel := context.WithCancel(ctx)
 	o.cancel = cancel
 	go func() {
+		defer o.bus.Unsubscribe(events.TopicLeadershipRoleChanged, ch)
 		for {
 			select {
 			case evt, ok := <-ch:
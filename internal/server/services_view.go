@@ -0,0 +1,304 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"piccolod/internal/api"
+	"piccolod/internal/remote"
+	"piccolod/internal/services"
+)
+
+// serviceEntry is one endpoint as returned by the services and app APIs.
+type serviceEntry struct {
+	App         string  `json:"app"`
+	Name        string  `json:"name"`
+	GuestPort   int     `json:"guest_port"`
+	HostPort    int     `json:"host_port"`
+	PublicPort  int     `json:"public_port"`
+	RemotePorts []int   `json:"remote_ports"`
+	RemoteHost  *string `json:"remote_host"`
+	// PublicURL is where remote clients reach the endpoint; empty when
+	// remote access is off or the endpoint is not published remotely.
+	PublicURL string `json:"public_url"`
+	// AliasURLs are the custom hostnames routed to the endpoint.
+	AliasURLs  []string                    `json:"alias_urls,omitempty"`
+	Flow       api.ListenerFlow            `json:"flow"`
+	Protocol   api.ListenerProtocol        `json:"protocol"`
+	Middleware []api.AppProtocolMiddleware `json:"middleware"`
+	Scheme     string                      `json:"scheme"`
+	Stats      services.EndpointStats      `json:"stats"`
+	// Limits are the connection limits in effect: the listener's own, with
+	// the system defaults filling the rest. UDP relays have none.
+	Limits *services.ConnectionLimits `json:"limits,omitempty"`
+	// OutsidePortRange flags an endpoint holding a port the current port
+	// policy no longer hands out.
+	OutsidePortRange bool `json:"outside_port_range"`
+	// PortalPath is where the portal serves the endpoint from its
+	// path_prefix; PortalURL is that path on the remote portal hostname.
+	PortalPath string `json:"portal_path,omitempty"`
+	PortalURL  string `json:"portal_url,omitempty"`
+	// endpoint is kept to resolve Limits, which follow the system defaults
+	// and so are never cached.
+	endpoint services.ServiceEndpoint
+}
+
+// servicesSnapshot is an immutable build of the service list. Version
+// increases every time the list is rebuilt.
+type servicesSnapshot struct {
+	Version uint64
+	entries []serviceEntry
+	apps    map[string][2]int // app -> [start, end) into entries
+}
+
+// servicesView caches the enriched service list. It is rebuilt when the
+// registry generation moves or a remote config change arrives on the bus;
+// otherwise reads only copy the cached entries.
+type servicesView struct {
+	registry *services.ServiceManager
+	// remoteStatus is read once per rebuild rather than per request.
+	remoteStatus func() *remote.Status
+
+	mu         sync.Mutex
+	snap       *servicesSnapshot
+	generation uint64
+	version    uint64
+}
+
+func newServicesView(registry *services.ServiceManager, remoteStatus func() *remote.Status) *servicesView {
+	return &servicesView{registry: registry, remoteStatus: remoteStatus}
+}
+
+// invalidate drops the cached list; the next read rebuilds it.
+func (v *servicesView) invalidate() {
+	v.mu.Lock()
+	v.snap = nil
+	v.mu.Unlock()
+}
+
+func (v *servicesView) current() *servicesSnapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// The generation check keeps reads consistent with the request that
+	// changed the registry, even before its bus event is delivered.
+	if v.snap != nil && v.registry.Generation() == v.generation {
+		return v.snap
+	}
+	var status *remote.Status
+	if v.remoteStatus != nil {
+		status = v.remoteStatus()
+	}
+	reg := v.registry.Snapshot()
+	v.version++
+	v.generation = reg.Generation
+	v.snap = buildServicesSnapshot(v.version, reg, status, v.registry.PortPolicy())
+	return v.snap
+}
+
+func buildServicesSnapshot(version uint64, reg services.RegistrySnapshot, status *remote.Status, policy services.PortPolicy) *servicesSnapshot {
+	appNames := make([]string, 0, len(reg.Apps))
+	total := 0
+	for app, eps := range reg.Apps {
+		appNames = append(appNames, app)
+		total += len(eps)
+	}
+	sort.Strings(appNames)
+	snap := &servicesSnapshot{
+		Version: version,
+		entries: make([]serviceEntry, 0, total),
+		apps:    make(map[string][2]int, len(appNames)),
+	}
+	aliases := aliasURLsByEndpoint(appNames, reg, status)
+	// Listeners installed while remote access was off may share a label;
+	// the resolver routes it to the app that sorts first.
+	published := make(map[string]bool)
+	for _, app := range appNames {
+		start := len(snap.entries)
+		for _, ep := range reg.Apps[app] {
+			entry := newServiceEntry(ep, status)
+			if entry.RemoteHost != nil {
+				if published[*entry.RemoteHost] {
+					entry.RemoteHost, entry.PublicURL = nil, ""
+				} else {
+					published[*entry.RemoteHost] = true
+				}
+			}
+			entry.OutsidePortRange = policy.OutsidePolicy(ep)
+			entry.AliasURLs = aliases[[2]string{ep.App, ep.Name}]
+			snap.entries = append(snap.entries, entry)
+		}
+		snap.apps[app] = [2]int{start, len(snap.entries)}
+	}
+	return snap
+}
+
+// aliasURLsByEndpoint assigns each custom hostname to the endpoint the TLS
+// mux routes it to: the named listener of the first app, in name order,
+// that serves remote port 443. Redirecting aliases and portal ones are left
+// out.
+func aliasURLsByEndpoint(appNames []string, reg services.RegistrySnapshot, status *remote.Status) map[[2]string][]string {
+	if status == nil || !status.Enabled || len(status.Aliases) == 0 {
+		return nil
+	}
+	out := make(map[[2]string][]string)
+	for _, alias := range status.Aliases {
+		if alias.RedirectTo != "" || alias.Listener == "" || alias.Listener == "portal" {
+			continue
+		}
+		for _, app := range appNames {
+			ep, ok := findEndpoint(reg.Apps[app], alias.Listener)
+			if !ok || !ep.ServesRemotePort(443) {
+				continue
+			}
+			if !ep.Protocol.Passthrough() {
+				key := [2]string{ep.App, ep.Name}
+				out[key] = append(out[key], remoteURL(remoteScheme(ep, true), alias.Hostname, 0))
+			}
+			break
+		}
+	}
+	return out
+}
+
+func findEndpoint(eps []services.ServiceEndpoint, name string) (services.ServiceEndpoint, bool) {
+	for _, ep := range eps {
+		if ep.Name == name {
+			return ep, true
+		}
+	}
+	return services.ServiceEndpoint{}, false
+}
+
+func newServiceEntry(ep services.ServiceEndpoint, status *remote.Status) serviceEntry {
+	entry := serviceEntry{
+		App:         ep.App,
+		Name:        ep.Name,
+		GuestPort:   ep.GuestPort,
+		HostPort:    ep.HostBind,
+		PublicPort:  ep.PublicPort,
+		RemotePorts: ep.RemotePorts,
+		Flow:        ep.Flow,
+		Protocol:    ep.Protocol,
+		Middleware:  ep.Middleware,
+		Scheme:      determineScheme(ep.Flow, ep.Protocol),
+		endpoint:    ep,
+	}
+	if host := remoteServiceHostname(status, ep); host != "" {
+		entry.RemoteHost = &host
+		entry.PublicURL = publicURL(host, ep)
+	}
+	if ep.PathPrefix != "" {
+		entry.PortalPath = ep.PathPrefix + "/"
+		if status != nil && status.Enabled && status.PortalURL != "" {
+			entry.PortalURL = strings.TrimSuffix(status.PortalURL, "/") + entry.PortalPath
+		}
+	}
+	return entry
+}
+
+// publicURL is the remote URL of ep published as host. Raw tcp listeners
+// are reached on their first remote port and udp ones not at all. HTTP
+// listeners are reached over TLS on 443 unless their remote ports leave it
+// out, in which case plain 80 or else their first port is used.
+func publicURL(host string, ep services.ServiceEndpoint) string {
+	if ep.Protocol.Passthrough() {
+		if ep.Protocol == api.ListenerProtocolUDP || len(ep.RemotePorts) == 0 {
+			return ""
+		}
+		return remoteURL(ep.Protocol.String(), host, ep.RemotePorts[0])
+	}
+	switch {
+	case ep.ServesRemotePort(443):
+		return remoteURL(remoteScheme(ep, true), host, 0)
+	case ep.ServesRemotePort(80):
+		return remoteURL(remoteScheme(ep, false), host, 0)
+	case len(ep.RemotePorts) > 0:
+		return remoteURL(remoteScheme(ep, true), host, ep.RemotePorts[0])
+	}
+	return ""
+}
+
+// remoteScheme is the URL scheme remote clients use for an HTTP listener:
+// TLS is terminated by the device, or by the app itself for flow tls, so
+// only the protocol matters.
+func remoteScheme(ep services.ServiceEndpoint, secure bool) string {
+	switch {
+	case ep.Protocol == api.ListenerProtocolWebsocket && secure:
+		return "wss"
+	case ep.Protocol == api.ListenerProtocolWebsocket:
+		return "ws"
+	case secure:
+		return "https"
+	}
+	return "http"
+}
+
+func remoteURL(scheme, host string, port int) string {
+	if port > 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	return scheme + "://" + host
+}
+
+// all returns a copy of every entry with live stats attached.
+func (snap *servicesSnapshot) all(sm *services.ServiceManager) []serviceEntry {
+	return withStats(snap.entries, sm)
+}
+
+// app returns a copy of one app's entries; ok is false for unknown apps.
+func (snap *servicesSnapshot) app(name string, sm *services.ServiceManager) ([]serviceEntry, bool) {
+	bounds, ok := snap.apps[name]
+	if !ok {
+		return nil, false
+	}
+	return withStats(snap.entries[bounds[0]:bounds[1]], sm), true
+}
+
+// withStats copies entries and fills in counters and limits, which change
+// per request and are therefore never cached.
+func withStats(entries []serviceEntry, sm *services.ServiceManager) []serviceEntry {
+	out := make([]serviceEntry, len(entries))
+	copy(out, entries)
+	if sm != nil {
+		for i := range out {
+			out[i].Stats = sm.EndpointStats(out[i].App, out[i].Name)
+			if out[i].Protocol != api.ListenerProtocolUDP {
+				limits := sm.EffectiveConnectionLimits(out[i].endpoint)
+				out[i].Limits = &limits
+			}
+		}
+	}
+	return out
+}
+
+func remoteServiceHostname(status *remote.Status, ep services.ServiceEndpoint) string {
+	if status == nil || !status.Enabled {
+		return ""
+	}
+	tld := strings.Trim(strings.TrimSuffix(strings.ToLower(status.TLD), "."), " ")
+	if tld == "" {
+		return ""
+	}
+	label := ep.RemoteLabel()
+	if !isValidDNSLabel(label) {
+		return ""
+	}
+	return label + "." + tld
+}
+
+// services returns the cached services view, creating it on first use.
+func (s *GinServer) services() *servicesView {
+	s.servicesViewOnce.Do(func() {
+		s.servicesView = newServicesView(s.serviceManager, func() *remote.Status {
+			if s.remoteManager == nil {
+				return nil
+			}
+			st := s.remoteManager.Status()
+			return &st
+		})
+	})
+	return s.servicesView
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"piccolod/internal/api"
+	"piccolod/internal/events"
+	"piccolod/internal/remote"
+	"piccolod/internal/services"
+)
+
+func TestServicesView_InvalidatesOnRemoteConfigChange(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "services-view")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	defer srv.serviceManager.StopAll()
+	cookie, csrf := setupTestAdminSession(t, srv)
+
+	if _, err := srv.serviceManager.AllocateForApp("blog", []api.AppListener{{
+		Name: "web", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP,
+	}}); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+
+	view := srv.services()
+	first := view.current()
+	if again := view.current(); again != first {
+		t.Fatalf("unchanged view should be served from cache (version %d vs %d)", first.Version, again.Version)
+	}
+	w := doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/services", "")
+	var resp struct {
+		Services []serviceEntry `json:"services"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Services) != 1 {
+		t.Fatalf("services: err=%v body=%s", err, w.Body.String())
+	}
+	if resp.Services[0].RemoteHost != nil {
+		t.Fatalf("remote host before remote configured: %q", *resp.Services[0].RemoteHost)
+	}
+
+	if err := srv.remoteManager.Configure(remote.ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret-value",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("remote configure: %v", err)
+	}
+
+	// The remote config event is delivered asynchronously.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		snap := view.current()
+		if entries, _ := snap.app("blog", nil); len(entries) == 1 && entries[0].RemoteHost != nil {
+			if got := *entries[0].RemoteHost; got != "web.example.com" {
+				t.Fatalf("remote host = %q", got)
+			}
+			if snap.Version <= first.Version {
+				t.Fatalf("rebuilt snapshot should have a newer version: %d <= %d", snap.Version, first.Version)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("services view not invalidated by remote config change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Registry changes are visible to the next read without waiting.
+	srv.serviceManager.RemoveApp("blog")
+	if _, ok := view.current().app("blog", nil); ok {
+		t.Fatalf("removed app still listed")
+	}
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/apps/blog/services", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for removed app, got %d", w.Code)
+	}
+}
+
+func TestAppInstall_RemoteHostnameConflict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "remote-label-conflict")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	defer srv.serviceManager.StopAll()
+	cookie, csrf := setupTestAdminSession(t, srv)
+	install := func(name, subdomain string) *httptest.ResponseRecorder {
+		payload := "name: " + name + "\nimage: docker.io/library/nginx:alpine\ntype: user\nlisteners:\n  - name: web\n    guest_port: 80\n    flow: tcp\n    protocol: http\n"
+		if subdomain != "" {
+			payload += "    remote_subdomain: " + subdomain + "\n"
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		attachAuth(req, cookie, csrf)
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Labels are not published while remote access is off, so they may
+	// repeat.
+	for _, app := range []string{"shop", "blog"} {
+		if w := install(app, ""); w.Code != http.StatusCreated {
+			t.Fatalf("install %s: %d body=%s", app, w.Code, w.Body.String())
+		}
+	}
+	if err := srv.remoteManager.Configure(remote.ConfigureRequest{
+		Endpoint:       "wss://nexus.example.com/connect",
+		DeviceSecret:   "secret-value",
+		Solver:         "http-01",
+		TLD:            "example.com",
+		PortalHostname: "portal.example.com",
+	}); err != nil {
+		t.Fatalf("remote configure: %v", err)
+	}
+	srv.refreshRemoteRuntime()
+
+	w := install("news", "")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for clashing listener, got %d body=%s", w.Code, w.Body.String())
+	}
+	var conflict struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Conflict map[string]string `json:"remote_host_conflict"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &conflict); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if conflict.Error.Code != errorCodeRemoteHostConflict || conflict.Error.Details.Conflict["conflicting_app"] != "blog" || conflict.Error.Details.Conflict["remote_label"] != "web" {
+		t.Fatalf("unexpected conflict response %s", w.Body.String())
+	}
+	if _, err := srv.serviceManager.GetByApp("news"); err == nil {
+		t.Fatalf("rejected app kept its endpoints")
+	}
+
+	if w := install("news", "store"); w.Code != http.StatusCreated {
+		t.Fatalf("install news with remote_subdomain: %d body=%s", w.Code, w.Body.String())
+	}
+	srv.services().invalidate()
+	w = doAuthedRequest(srv, cookie, csrf, http.MethodGet, "/api/v1/services", "")
+	var resp struct {
+		Services []serviceEntry `json:"services"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Services) != 3 {
+		t.Fatalf("services: err=%v body=%s", err, w.Body.String())
+	}
+	// shop's label was taken before remote access was enabled; blog sorts
+	// first and serves web.example.com.
+	want := map[string]string{"blog": "web.example.com", "news": "store.example.com", "shop": ""}
+	for _, svc := range resp.Services {
+		got := ""
+		if svc.RemoteHost != nil {
+			got = *svc.RemoteHost
+		}
+		if got != want[svc.App] {
+			t.Fatalf("%s remote_host = %q, want %q", svc.App, got, want[svc.App])
+		}
+	}
+}
+
+// BenchmarkServicesList compares assembling the list per request, as the
+// handlers used to, with serving the cached snapshot.
+func BenchmarkServicesList(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	sm := services.NewServiceManager()
+	defer sm.StopAll()
+	for a := 0; a < 20; a++ {
+		listeners := make([]api.AppListener, 0, 10)
+		for l := 0; l < 10; l++ {
+			listeners = append(listeners, api.AppListener{
+				Name: fmt.Sprintf("l%d", l), GuestPort: 8000 + l, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP,
+			})
+		}
+		if _, err := sm.AllocateForApp(fmt.Sprintf("app%d", a), listeners); err != nil {
+			b.Fatalf("allocate: %v", err)
+		}
+	}
+	dir, err := os.MkdirTemp("", "services-bench")
+	if err != nil {
+		b.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	rm, err := remote.NewManager(dir)
+	if err != nil {
+		b.Fatalf("remote manager: %v", err)
+	}
+	remoteStatus := func() *remote.Status {
+		st := rm.Status()
+		return &st
+	}
+
+	b.Run("per-request", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			status := remoteStatus()
+			eps := sm.GetAll()
+			out := make([]gin.H, 0, len(eps))
+			for _, ep := range eps {
+				var remoteHost interface{}
+				if host := remoteServiceHostname(status, ep); host != "" {
+					remoteHost = host
+				}
+				out = append(out, gin.H{
+					"app":          ep.App,
+					"name":         ep.Name,
+					"guest_port":   ep.GuestPort,
+					"host_port":    ep.HostBind,
+					"public_port":  ep.PublicPort,
+					"remote_ports": ep.RemotePorts,
+					"remote_host":  remoteHost,
+					"flow":         ep.Flow,
+					"protocol":     ep.Protocol,
+					"middleware":   ep.Middleware,
+					"scheme":       determineScheme(ep.Flow, ep.Protocol),
+					"stats":        sm.EndpointStats(ep.App, ep.Name),
+				})
+			}
+			if len(out) != 200 {
+				b.Fatalf("expected 200 entries, got %d", len(out))
+			}
+		}
+	})
+	b.Run("snapshot", func(b *testing.B) {
+		view := newServicesView(sm, remoteStatus)
+		for i := 0; i < b.N; i++ {
+			if out := view.current().all(sm); len(out) != 200 {
+				b.Fatalf("expected 200 entries, got %d", len(out))
+			}
+		}
+	})
+}
+
+func TestHealthDetail_ReportsEventBusAndObserversRelease(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "health-bus")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	srv := createGinTestServer(t, tempDir)
+	defer srv.serviceManager.StopAll()
+	srv.observeServiceChanges(srv.events)
+	w := doAuthedRequest(srv, nil, "", http.MethodGet, "/api/v1/health/detail", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("health detail: %d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		EventBus []events.TopicStats `json:"event_bus"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	subscribers := func(stats []events.TopicStats, topic events.Topic) int {
+		for _, st := range stats {
+			if st.Topic == topic {
+				return st.Subscribers
+			}
+		}
+		return 0
+	}
+	if subscribers(resp.EventBus, events.TopicServicesChanged) == 0 || subscribers(resp.EventBus, events.TopicVolumeStateChanged) == 0 {
+		t.Fatalf("observers missing from %+v", resp.EventBus)
+	}
+
+	srv.unsubscribeAll()
+	srv.appManager.StopRuntimeEvents()
+	stats := srv.events.Stats()
+	if n := subscribers(stats, events.TopicServicesChanged); n != 0 {
+		t.Fatalf("%d services_changed subscribers left after unsubscribe", n)
+	}
+	if n := subscribers(stats, events.TopicVolumeStateChanged); n != 0 {
+		t.Fatalf("app manager left %d volume subscribers after stopping", n)
+	}
+}
+
+func TestServicesView_PublicURLs(t *testing.T) {
+	status := &remote.Status{
+		Enabled: true,
+		TLD:     "example.com",
+		Aliases: []remote.Alias{
+			{Hostname: "blog.example.org", Listener: "web"},
+			{Hostname: "www.example.org", Listener: "web", RedirectTo: "blog.example.org"},
+			{Hostname: "status.example.org", Listener: "portal"},
+		},
+	}
+	reg := services.RegistrySnapshot{Apps: map[string][]services.ServiceEndpoint{
+		"blog": {
+			{App: "blog", Name: "web", Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, RemotePorts: []int{80, 443}},
+			{App: "blog", Name: "secure", Flow: api.FlowTLS, Protocol: api.ListenerProtocolHTTP, RemotePorts: []int{80, 443}},
+			{App: "blog", Name: "live", Flow: api.FlowTCP, Protocol: api.ListenerProtocolWebsocket, RemoteSubdomain: "stream"},
+			{App: "blog", Name: "plain", Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, RemotePorts: []int{80}},
+			{App: "blog", Name: "alt", Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, RemotePorts: []int{8443}},
+			{App: "blog", Name: "ssh", Flow: api.FlowTCP, Protocol: api.ListenerProtocolTCP, RemotePorts: []int{2222}},
+			{App: "blog", Name: "db", Flow: api.FlowTCP, Protocol: api.ListenerProtocolTCP},
+			{App: "blog", Name: "dns", Flow: api.FlowTCP, Protocol: api.ListenerProtocolUDP, RemotePorts: []int{5353}},
+		},
+		// Aliases and remote labels route to the first app, in name order,
+		// with the listener.
+		"wiki": {
+			{App: "wiki", Name: "web", Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, RemotePorts: []int{80, 443}},
+		},
+	}}
+	want := map[string]string{
+		"blog/web":    "https://web.example.com",
+		"blog/secure": "https://secure.example.com",
+		"blog/live":   "wss://stream.example.com",
+		"blog/plain":  "http://plain.example.com",
+		"blog/alt":    "https://alt.example.com:8443",
+		"blog/ssh":    "tcp://ssh.example.com:2222",
+		"blog/db":     "",
+		"blog/dns":    "",
+		// blog sorts first and serves web.example.com.
+		"wiki/web": "",
+	}
+
+	snap := buildServicesSnapshot(1, reg, status, services.PortPolicy{})
+	entries := snap.all(nil)
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(entries))
+	}
+	for _, e := range entries {
+		key := e.App + "/" + e.Name
+		if e.PublicURL != want[key] {
+			t.Errorf("%s: public_url = %q, want %q", key, e.PublicURL, want[key])
+		}
+		wantAliases := 0
+		if key == "blog/web" {
+			wantAliases = 1
+			if e.AliasURLs[0] != "https://blog.example.org" {
+				t.Errorf("%s: alias urls = %v", key, e.AliasURLs)
+			}
+		}
+		if len(e.AliasURLs) != wantAliases {
+			t.Errorf("%s: expected %d alias urls, got %v", key, wantAliases, e.AliasURLs)
+		}
+	}
+
+	status.Enabled = false
+	for _, e := range buildServicesSnapshot(2, reg, status, services.PortPolicy{}).all(nil) {
+		if e.PublicURL != "" || len(e.AliasURLs) != 0 {
+			t.Errorf("%s/%s: urls while remote disabled: %q %v", e.App, e.Name, e.PublicURL, e.AliasURLs)
+		}
+	}
+}
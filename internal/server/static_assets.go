@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	staticEntryPage = "entry.html"
+	// SvelteKit puts content-hashed bundles under _app/immutable; their
+	// names change whenever their content does.
+	staticImmutablePrefix = "_app/immutable/"
+
+	cacheControlImmutable   = "public, max-age=31536000, immutable"
+	cacheControlRevalidate  = "no-cache"
+	precompressedBrotliExt  = ".br"
+	precompressedGzipExt    = ".gz"
+	encodingBrotli          = "br"
+	encodingGzip            = "gzip"
+	headerAcceptEncodingKey = "Accept-Encoding"
+)
+
+// staticAsset is one embedded file plus any precompressed variants the UI
+// build emitted next to it.
+type staticAsset struct {
+	name     string
+	etag     string
+	variants map[string]string // encoding -> path of the compressed file
+}
+
+// staticAssets serves the embedded portal UI. Files are hashed once at
+// startup so every response carries a strong ETag.
+type staticAssets struct {
+	fsys  fs.FS
+	files map[string]*staticAsset
+}
+
+func newStaticAssets(fsys fs.FS) (*staticAssets, error) {
+	a := &staticAssets{fsys: fsys, files: make(map[string]*staticAsset)}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(p, precompressedBrotliExt) || strings.HasSuffix(p, precompressedGzipExt) {
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		asset := &staticAsset{name: p, etag: `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`}
+		for enc, ext := range map[string]string{encodingBrotli: precompressedBrotliExt, encodingGzip: precompressedGzipExt} {
+			if _, err := fs.Stat(fsys, p+ext); err == nil {
+				if asset.variants == nil {
+					asset.variants = make(map[string]string)
+				}
+				asset.variants[enc] = p + ext
+			}
+		}
+		a.files[p] = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// cleanStaticPath maps a request path to an embedded file name. Traversal
+// segments are rejected outright rather than cleaned away.
+func cleanStaticPath(urlPath string) (string, error) {
+	if len(urlPath) > maxStaticAssetPathLen {
+		return "", errInvalidStaticPath
+	}
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", errInvalidStaticPath
+	}
+	for _, seg := range strings.Split(urlPath, "/") {
+		if seg == ".." || seg == "." {
+			return "", errInvalidStaticPath
+		}
+	}
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += staticEntryPage
+	}
+	return name, nil
+}
+
+// lookup resolves a request path. Unknown paths fall back to the SPA entry
+// page; exact reports whether the path named a file.
+func (a *staticAssets) lookup(urlPath string) (asset *staticAsset, exact bool, err error) {
+	name, err := cleanStaticPath(urlPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if asset, ok := a.files[name]; ok {
+		return asset, true, nil
+	}
+	if asset, ok := a.files[staticEntryPage]; ok {
+		return asset, false, nil
+	}
+	return nil, false, fs.ErrNotExist
+}
+
+// negotiate picks the precompressed variant the client accepts, preferring
+// brotli. It returns "" when the plain file should be sent.
+func (asset *staticAsset) negotiate(acceptEncoding string) string {
+	if len(asset.variants) == 0 {
+		return ""
+	}
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(strings.TrimSpace(enc))] = true
+	}
+	for _, enc := range []string{encodingBrotli, encodingGzip} {
+		if _, ok := asset.variants[enc]; ok && accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// precompressed reports whether r will be answered with a precompressed
+// variant, in which case on-the-fly gzip must stay out of the way. The gzip
+// middleware runs before routing, so only exact file paths qualify; SPA
+// fallbacks are served plain and compressed on the fly.
+func (a *staticAssets) precompressed(r *http.Request) bool {
+	if a == nil || r.Method != http.MethodGet {
+		return false
+	}
+	asset, exact, err := a.lookup(r.URL.Path)
+	return err == nil && exact && asset.negotiate(r.Header.Get(headerAcceptEncodingKey)) != ""
+}
+
+func (a *staticAssets) serve(c *gin.Context) {
+	asset, exact, err := a.lookup(c.Request.URL.Path)
+	switch {
+	case errors.Is(err, errInvalidStaticPath):
+		c.Status(http.StatusBadRequest)
+		return
+	case err != nil:
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	h := c.Writer.Header()
+	if strings.HasPrefix(asset.name, staticImmutablePrefix) {
+		h.Set("Cache-Control", cacheControlImmutable)
+	} else {
+		h.Set("Cache-Control", cacheControlRevalidate)
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(asset.name)); ct != "" {
+		h.Set("Content-Type", ct)
+	}
+
+	file, etag := asset.name, asset.etag
+	if exact && len(asset.variants) > 0 {
+		h.Add("Vary", headerAcceptEncodingKey)
+	}
+	if enc := asset.negotiate(c.GetHeader(headerAcceptEncodingKey)); exact && enc != "" {
+		file = asset.variants[enc]
+		etag = strings.TrimSuffix(asset.etag, `"`) + "-" + enc + `"`
+		h.Set("Content-Encoding", enc)
+	}
+	h.Set("ETag", etag)
+
+	f, err := a.fsys.Open(file)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	// ServeContent answers If-None-Match with 304 using the ETag set above.
+	http.ServeContent(c.Writer, c.Request, path.Base(asset.name), time.Time{}, rs)
+}
+
+// shouldGzip mirrors the gzip middleware's default checks and additionally
+// skips responses that will be served from a precompressed variant.
+func (s *GinServer) shouldGzip(c *gin.Context) bool {
+	r := c.Request
+	if !strings.Contains(r.Header.Get(headerAcceptEncodingKey), encodingGzip) ||
+		strings.Contains(r.Header.Get("Connection"), "Upgrade") {
+		return false
+	}
+	if gzip.DefaultExcludedExtentions.Contains(filepath.Ext(r.URL.Path)) {
+		return false
+	}
+	// Apps compress their own responses, and streaming ones need flushing.
+	if _, ok := s.portalPathEndpoint(r.URL.Path); ok {
+		return false
+	}
+	return !s.staticAssets.precompressed(r)
+}
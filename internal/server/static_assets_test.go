@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testBundle = "console.log('piccolo portal bundle');\n"
+
+func gzipBytes(t testing.TB, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newStaticTestServer(t *testing.T) (*GinServer, []byte) {
+	t.Helper()
+	gz := gzipBytes(t, strings.Repeat(testBundle, 64))
+	assets, err := newStaticAssets(fstest.MapFS{
+		"entry.html":                      {Data: []byte("<!doctype html><title>Piccolo</title>")},
+		"favicon.svg":                     {Data: []byte("<svg/>")},
+		"_app/immutable/app.abc123.js":    {Data: []byte(strings.Repeat(testBundle, 64))},
+		"_app/immutable/app.abc123.js.gz": {Data: gz},
+	})
+	if err != nil {
+		t.Fatalf("index assets: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "static_assets_test")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	srv := createGinTestServer(t, dir)
+	srv.staticAssets = assets
+	return srv, gz
+}
+
+func getStatic(srv *GinServer, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestStaticAssets_ETagAnd304(t *testing.T) {
+	srv, _ := newStaticTestServer(t)
+
+	w := getStatic(srv, "/_app/immutable/app.abc123.js", nil)
+	if w.Code != http.StatusOK || w.Body.String() != strings.Repeat(testBundle, 64) {
+		t.Fatalf("bundle: %d body=%q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != cacheControlImmutable {
+		t.Fatalf("hashed bundle Cache-Control = %q", cc)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("expected strong ETag, got %q", etag)
+	}
+
+	w = getStatic(srv, "/_app/immutable/app.abc123.js", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected 304 for matching ETag, got %d body=%q", w.Code, w.Body.String())
+	}
+	w = getStatic(srv, "/_app/immutable/app.abc123.js", map[string]string{"If-None-Match": `"stale"`})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for stale ETag, got %d", w.Code)
+	}
+}
+
+func TestStaticAssets_HTMLFallbackIsNoCache(t *testing.T) {
+	srv, _ := newStaticTestServer(t)
+	for _, path := range []string{"/", "/apps/blog", "/favicon.svg"} {
+		w := getStatic(srv, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, w.Code)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != cacheControlRevalidate {
+			t.Fatalf("%s: Cache-Control = %q, want no-cache", path, cc)
+		}
+	}
+	w := getStatic(srv, "/apps/blog", nil)
+	if !strings.Contains(w.Body.String(), "<title>Piccolo</title>") || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("SPA fallback should serve entry.html, got %q (%s)", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	etag := w.Header().Get("ETag")
+	if w := getStatic(srv, "/settings", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for fallback page, got %d", w.Code)
+	}
+}
+
+func TestStaticAssets_RejectsTraversalAndLongPaths(t *testing.T) {
+	srv, _ := newStaticTestServer(t)
+	for _, path := range []string{"/../go.mod", "/_app/%2e%2e/entry.html", "/a%5c..%5centry.html"} {
+		if w := getStatic(srv, path, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+	long := "/" + strings.Repeat("a", maxStaticAssetPathLen+1)
+	if w := getStatic(srv, long, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("overlong path: expected 400, got %d", w.Code)
+	}
+}
+
+func TestStaticAssets_PrecompressedBypassesGzipMiddleware(t *testing.T) {
+	srv, gz := newStaticTestServer(t)
+
+	w := getStatic(srv, "/_app/immutable/app.abc123.js", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if enc := w.Header().Values("Content-Encoding"); len(enc) != 1 || enc[0] != "gzip" {
+		t.Fatalf("Content-Encoding = %v", enc)
+	}
+	// Byte-identical to the embedded .gz: the middleware did not recompress.
+	if !bytes.Equal(w.Body.Bytes(), gz) {
+		t.Fatalf("body is not the precompressed variant (%d bytes vs %d)", w.Body.Len(), len(gz))
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasSuffix(etag, `-gzip"`) || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("compressed variant ETag = %q", etag)
+	}
+	if w := getStatic(srv, "/_app/immutable/app.abc123.js", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for compressed variant, got %d", w.Code)
+	}
+
+	// Without a precompressed variant the middleware still compresses.
+	w = getStatic(srv, "/apps/blog", map[string]string{"Accept-Encoding": "gzip"})
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("fallback page should be gzipped on the fly: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !strings.Contains(string(body), "<title>Piccolo</title>") {
+		t.Fatalf("unexpected fallback body %q", body)
+	}
+}
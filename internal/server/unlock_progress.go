@@ -0,0 +1,337 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"piccolod/internal/app"
+	"piccolod/internal/events"
+)
+
+// Kinds of work an unlock runs, in the order they happen.
+const (
+	unlockKindVolume    = "volume"
+	unlockKindStore     = "control-store"
+	unlockKindReload    = "reload"
+	unlockKindRestore   = "restore-services"
+	unlockKindAutostart = "autostart"
+)
+
+// Unlock step states.
+const (
+	unlockStepPending = "pending"
+	unlockStepRunning = "running"
+	unlockStepDone    = "done"
+	unlockStepFailed  = "failed"
+	unlockStepSkipped = "skipped"
+)
+
+// Overall unlock phases.
+const (
+	unlockPhaseRunning   = "running"
+	unlockPhaseSucceeded = "succeeded"
+	unlockPhaseFailed    = "failed"
+)
+
+// Budgets after which unfinished unlock steps are marked failed. Starting
+// apps waits on images and dependencies, so it gets longer than the rest.
+const (
+	unlockStepTimeout = 2 * time.Minute
+	unlockAppsTimeout = 10 * time.Minute
+)
+
+// unlockStep is one piece of work in an unlock.
+type unlockStep struct {
+	Name       string    `json:"name"`
+	Kind       string    `json:"kind"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+func (s unlockStep) finished() bool {
+	return s.State == unlockStepDone || s.State == unlockStepFailed || s.State == unlockStepSkipped
+}
+
+// unlockProgress is the pollable record of the most recent unlock.
+type unlockProgress struct {
+	ID         string       `json:"id"`
+	Phase      string       `json:"phase"`
+	Completed  int          `json:"completed"`
+	Total      int          `json:"total"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at,omitzero"`
+	Steps      []unlockStep `json:"steps"`
+}
+
+// unlockTracker follows the work an unlock sets off. Most of it happens
+// after POST /crypto/unlock has answered, driven by volume and lock-state
+// events, so each step is updated as its event or callback arrives and a
+// timer fails whatever is still unfinished once its budget runs out.
+type unlockTracker struct {
+	volumes     []string
+	stepTimeout time.Duration
+	appsTimeout time.Duration
+
+	mu      sync.Mutex
+	current *unlockProgress
+	timers  []*time.Timer
+}
+
+func newUnlockTracker(volumes ...string) *unlockTracker {
+	return &unlockTracker{
+		volumes:     volumes,
+		stepTimeout: unlockStepTimeout,
+		appsTimeout: unlockAppsTimeout,
+	}
+}
+
+func unlockVolumeStep(id string) string { return unlockKindVolume + ":" + id }
+
+func unlockReloadStep(name string) string { return unlockKindReload + ":" + name }
+
+// begin records a new unlock, replacing the previous one, and returns its ID.
+func (t *unlockTracker) begin(reloads []string) string {
+	if t == nil {
+		return ""
+	}
+	now := time.Now().UTC()
+	var steps []unlockStep
+	for _, id := range t.volumes {
+		steps = append(steps, unlockStep{Name: unlockVolumeStep(id), Kind: unlockKindVolume, State: unlockStepPending})
+	}
+	steps = append(steps, unlockStep{Name: unlockKindStore, Kind: unlockKindStore, State: unlockStepRunning, StartedAt: now})
+	for _, name := range reloads {
+		steps = append(steps, unlockStep{Name: unlockReloadStep(name), Kind: unlockKindReload, State: unlockStepPending})
+	}
+	steps = append(steps,
+		unlockStep{Name: unlockKindRestore, Kind: unlockKindRestore, State: unlockStepPending},
+		unlockStep{Name: unlockKindAutostart, Kind: unlockKindAutostart, State: unlockStepPending},
+	)
+	id := newUnlockID()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopTimersLocked()
+	t.current = &unlockProgress{ID: id, Phase: unlockPhaseRunning, StartedAt: now, Steps: steps}
+	t.armLocked(id, t.stepTimeout, unlockKindVolume, unlockKindStore, unlockKindReload)
+	t.armLocked(id, t.appsTimeout, unlockKindRestore, unlockKindAutostart)
+	t.settleLocked()
+	return id
+}
+
+func (t *unlockTracker) armLocked(id string, d time.Duration, kinds ...string) {
+	t.timers = append(t.timers, time.AfterFunc(d, func() { t.expire(id, d, kinds) }))
+}
+
+func (t *unlockTracker) stopTimersLocked() {
+	for _, timer := range t.timers {
+		timer.Stop()
+	}
+	t.timers = nil
+}
+
+// expire fails the steps of the given kinds that have not finished by the
+// time their budget runs out.
+func (t *unlockTracker) expire(id string, d time.Duration, kinds []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil || t.current.ID != id {
+		return
+	}
+	now := time.Now().UTC()
+	for i := range t.current.Steps {
+		step := &t.current.Steps[i]
+		if step.finished() || !slices.Contains(kinds, step.Kind) {
+			continue
+		}
+		step.State = unlockStepFailed
+		step.Error = fmt.Sprintf("timed out after %s", d)
+		step.FinishedAt = now
+	}
+	t.settleLocked()
+}
+
+// settleLocked recomputes the counters and phase, stopping the timers once
+// every step has finished.
+func (t *unlockTracker) settleLocked() {
+	p := t.current
+	p.Total = len(p.Steps)
+	p.Completed = 0
+	failed := false
+	for _, step := range p.Steps {
+		if step.finished() {
+			p.Completed++
+		}
+		if step.State == unlockStepFailed {
+			failed = true
+		}
+	}
+	if p.Completed < p.Total {
+		p.Phase = unlockPhaseRunning
+		return
+	}
+	p.Phase = unlockPhaseSucceeded
+	if failed {
+		p.Phase = unlockPhaseFailed
+	}
+	if p.FinishedAt.IsZero() {
+		p.FinishedAt = time.Now().UTC()
+	}
+	t.stopTimersLocked()
+}
+
+// update moves the named step to state. Finished steps stay as they are
+// unless reopen is set and the step was only skipped; reopening only ever
+// finishes a step, since its timer may already be gone.
+func (t *unlockTracker) update(name, state string, err error, reopen bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return
+	}
+	for i := range t.current.Steps {
+		step := &t.current.Steps[i]
+		if step.Name != name {
+			continue
+		}
+		if step.finished() && !(reopen && step.State == unlockStepSkipped) {
+			return
+		}
+		t.setLocked(step, state, err)
+		t.settleLocked()
+		return
+	}
+}
+
+func (t *unlockTracker) setLocked(step *unlockStep, state string, err error) {
+	now := time.Now().UTC()
+	step.State = state
+	step.Error = ""
+	if err != nil {
+		step.Error = err.Error()
+	}
+	if step.StartedAt.IsZero() && state != unlockStepSkipped {
+		step.StartedAt = now
+	}
+	if step.finished() {
+		step.FinishedAt = now
+	}
+}
+
+func (t *unlockTracker) start(name string) { t.update(name, unlockStepRunning, nil, false) }
+
+func (t *unlockTracker) finish(name string, err error) {
+	state := unlockStepDone
+	if err != nil {
+		state = unlockStepFailed
+	}
+	t.update(name, state, err, false)
+}
+
+// storeUnlocked records the outcome of unlocking persistence. On success
+// volumes that sent no event of their own were attached without one; on
+// failure nothing after the store runs, and volume events still in flight
+// may yet settle the volume steps.
+func (t *unlockTracker) storeUnlocked(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return
+	}
+	for i := range t.current.Steps {
+		step := &t.current.Steps[i]
+		if step.finished() {
+			continue
+		}
+		switch {
+		case step.Kind == unlockKindStore && err == nil:
+			t.setLocked(step, unlockStepDone, nil)
+		case step.Kind == unlockKindStore:
+			t.setLocked(step, unlockStepFailed, err)
+		case step.Kind == unlockKindVolume && err == nil:
+			t.setLocked(step, unlockStepDone, nil)
+		case step.Kind == unlockKindRestore && err == nil:
+			t.setLocked(step, unlockStepRunning, nil)
+		case err != nil:
+			t.setLocked(step, unlockStepSkipped, nil)
+		}
+	}
+	t.settleLocked()
+}
+
+// observeVolume applies a volume state change to its step.
+func (t *unlockTracker) observeVolume(change events.VolumeStateChanged) {
+	name := unlockVolumeStep(change.ID)
+	switch change.Observed {
+	case "pending":
+		t.update(name, unlockStepRunning, nil, false)
+	case "mounted":
+		t.update(name, unlockStepDone, nil, true)
+	case "error":
+		t.update(name, unlockStepFailed, fmt.Errorf("%s", change.LastError), true)
+	}
+}
+
+// observeApp applies a step reported by the app manager. A failed restore
+// means autostart never runs.
+func (t *unlockTracker) observeApp(step string, err error) {
+	switch step {
+	case app.UnlockStepRestore:
+		t.finish(unlockKindRestore, err)
+		if err == nil {
+			t.start(unlockKindAutostart)
+		} else {
+			t.update(unlockKindAutostart, unlockStepSkipped, nil, false)
+		}
+	case app.UnlockStepAutostart:
+		t.finish(unlockKindAutostart, err)
+	}
+}
+
+// snapshot returns a copy of the most recent unlock.
+func (t *unlockTracker) snapshot() (unlockProgress, bool) {
+	if t == nil {
+		return unlockProgress{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return unlockProgress{}, false
+	}
+	p := *t.current
+	p.Steps = append([]unlockStep(nil), t.current.Steps...)
+	return p, true
+}
+
+// observeUnlockVolumes feeds volume state changes into the unlock tracker.
+func (s *GinServer) observeUnlockVolumes(bus *events.Bus) {
+	if bus == nil || s.unlockProgress == nil {
+		return
+	}
+	ch := s.subscribe(bus, events.TopicVolumeStateChanged, 16)
+	go func() {
+		for evt := range ch {
+			if payload, ok := evt.Payload.(events.VolumeStateChanged); ok {
+				s.unlockProgress.observeVolume(payload)
+			}
+		}
+	}()
+}
+
+func newUnlockID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"piccolod/internal/events"
+	"piccolod/internal/runtime/commands"
+	"piccolod/internal/runtime/watchdog"
+)
+
+// commandWatchdogPing is a no-op the watchdog dispatches to prove the
+// dispatcher still routes commands.
+const commandWatchdogPing = "server.watchdog_ping"
+
+type watchdogPingCommand struct{}
+
+func (watchdogPingCommand) Name() string { return commandWatchdogPing }
+
+func registerWatchdogPing(dispatch *commands.Dispatcher) {
+	dispatch.Register(commandWatchdogPing, commands.HandlerFunc(func(context.Context, commands.Command) (commands.Response, error) {
+		return nil, nil
+	}))
+}
+
+// watchdogPings numbers the bus pings so a probe only accepts its own.
+var watchdogPings atomic.Uint64
+
+// startWatchdog begins notifying systemd when the unit sets WatchdogSec.
+func (s *GinServer) startWatchdog() {
+	interval, err := watchdog.Interval()
+	if err != nil {
+		log.Printf("WARN: systemd watchdog disabled: %v", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	s.watchdog = watchdog.New(watchdog.Options{
+		Interval: interval,
+		Notifier: watchdog.SystemdNotifier{},
+		Probes:   s.livenessProbes(),
+	})
+	s.watchdog.Start()
+	log.Printf("INFO: systemd watchdog enabled; notifying every %s while liveness probes pass", interval/2)
+}
+
+// livenessProbes are the checks that must pass for the watchdog to be
+// notified: the HTTP router, the events bus and the command dispatcher.
+func (s *GinServer) livenessProbes() []watchdog.Probe {
+	return []watchdog.Probe{
+		watchdog.NewProbe("http", s.probeHTTP),
+		watchdog.NewProbe("events", s.probeEvents),
+		watchdog.NewProbe("dispatcher", s.probeDispatcher),
+	}
+}
+
+// probeHTTP fetches the liveness endpoint through the first admin listener,
+// over loopback when it is bound to every address. Any answer counts.
+func (s *GinServer) probeHTTP(ctx context.Context) error {
+	if s.listeners == nil {
+		return errors.New("no admin listeners")
+	}
+	addr := ""
+	for _, l := range s.listeners.Addrs() {
+		if !l.ACMEOnly {
+			addr = l.Addr
+			break
+		}
+	}
+	if addr == "" {
+		return errors.New("no admin listener bound")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(host, port)+"/api/v1/health/live", nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// probeEvents publishes a ping on the bus and waits for it to come back.
+func (s *GinServer) probeEvents(ctx context.Context) error {
+	if s.events == nil {
+		return nil
+	}
+	ch := s.events.Subscribe(events.TopicWatchdogPing, 1)
+	defer s.events.Unsubscribe(events.TopicWatchdogPing, ch)
+	seq := watchdogPings.Add(1)
+	s.events.Publish(events.Event{Topic: events.TopicWatchdogPing, Payload: seq})
+	for {
+		select {
+		case evt := <-ch:
+			if evt.Payload == seq {
+				return nil
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("ping %d not delivered: %w", seq, ctx.Err())
+		}
+	}
+}
+
+// probeDispatcher routes the no-op command through the dispatcher and its
+// middleware.
+func (s *GinServer) probeDispatcher(ctx context.Context) error {
+	if s.dispatcher == nil {
+		return nil
+	}
+	_, err := s.dispatcher.Dispatch(ctx, watchdogPingCommand{})
+	return err
+}
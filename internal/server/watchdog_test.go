@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"piccolod/internal/network"
+)
+
+func TestLivenessProbes(t *testing.T) {
+	srv := createGinTestServer(t, t.TempDir())
+	probe := func(name string) error {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		for _, p := range srv.livenessProbes() {
+			if p.Name() == name {
+				return p.Check(ctx)
+			}
+		}
+		t.Fatalf("no %s probe", name)
+		return nil
+	}
+
+	if err := probe("http"); err == nil {
+		t.Fatalf("http probe passed with no listener")
+	}
+	if err := probe("dispatcher"); err == nil {
+		t.Fatalf("dispatcher probe passed without its command")
+	}
+	if err := probe("events"); err != nil {
+		t.Fatalf("events probe: %v", err)
+	}
+
+	registerWatchdogPing(srv.dispatcher)
+	// Bound to every address; the probe goes over loopback.
+	srv.listeners = newHTTPListenerSet(srv.router, acmeOnlyHandler(srv.remoteManager.HTTPChallengeHandler()))
+	defer srv.listeners.Close()
+	if err := srv.listeners.Apply([]network.Listener{{Addr: net.JoinHostPort("", freeLoopbackPort(t))}}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	for _, name := range []string{"http", "events", "dispatcher"} {
+		if err := probe(name); err != nil {
+			t.Fatalf("%s probe: %v", name, err)
+		}
+	}
+}
+
+func TestStartWatchdogWithoutSystemdWatchdog(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	srv := &GinServer{}
+	srv.startWatchdog()
+	if srv.watchdog != nil {
+		t.Fatalf("watchdog started without WATCHDOG_USEC")
+	}
+}
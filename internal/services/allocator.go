@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"maps"
 )
 
 // PortAllocator allocates ephemeral ports within configured ranges (in-memory)
@@ -12,6 +13,8 @@ type PortAllocator struct {
 	nextPublic    int
 	usedHost      map[int]struct{}
 	usedPublic    map[int]struct{}
+	// excluded ports are never handed out, in either range.
+	excluded map[int]struct{}
 }
 
 func NewPortAllocator(hostBind, public PortRange) *PortAllocator {
@@ -22,22 +25,68 @@ func NewPortAllocator(hostBind, public PortRange) *PortAllocator {
 		nextPublic:    public.Start,
 		usedHost:      make(map[int]struct{}),
 		usedPublic:    make(map[int]struct{}),
+		excluded:      make(map[int]struct{}),
 	}
 }
 
+// setRanges replaces the allocatable ranges and excluded ports. Ports already
+// handed out stay reserved wherever they fall.
+func (a *PortAllocator) setRanges(hostBind, public PortRange, excluded []int) {
+	a.hostBindRange = hostBind
+	a.publicRange = public
+	a.excluded = make(map[int]struct{}, len(excluded))
+	for _, p := range excluded {
+		a.excluded[p] = struct{}{}
+	}
+	if a.nextHostBind < hostBind.Start || a.nextHostBind > hostBind.End {
+		a.nextHostBind = hostBind.Start
+	}
+	if a.nextPublic < public.Start || a.nextPublic > public.End {
+		a.nextPublic = public.Start
+	}
+}
+
+func (a *PortAllocator) isExcluded(port int) bool {
+	_, ok := a.excluded[port]
+	return ok
+}
+
 func (a *PortAllocator) nextInRange(current int, r PortRange) int {
-	if current > r.End {
+	if current > r.End || current < r.Start {
 		return r.Start
 	}
 	return current
 }
 
+// mark returns a function that undoes every allocation and release made
+// after the call, for previews that must leave the allocator as they found
+// it.
+func (a *PortAllocator) mark() func() {
+	nextHost, nextPublic := a.nextHostBind, a.nextPublic
+	usedHost, usedPublic := maps.Clone(a.usedHost), maps.Clone(a.usedPublic)
+	return func() {
+		a.nextHostBind, a.nextPublic = nextHost, nextPublic
+		a.usedHost, a.usedPublic = usedHost, usedPublic
+	}
+}
+
 func (a *PortAllocator) AllocatePair() (int, int, error) {
-	hb, err := a.allocateHost()
+	return a.allocatePairChecked(nil, nil)
+}
+
+// portCheck reports whether a candidate port is free on the host. It is
+// advisory: when it rejects every candidate, the first one it rejected is
+// handed out anyway and binding fails where it always did.
+type portCheck func(port int) bool
+
+// allocatePairChecked is AllocatePair with candidates run past the host and
+// public checks; nil checks accept every port.
+func (a *PortAllocator) allocatePairChecked(host, public portCheck) (int, int, error) {
+	hb, err := a.allocateHost(host)
 	if err != nil {
 		return 0, 0, err
 	}
-	pp, err := a.allocatePublic()
+	pp, err := a.allocatePublic(public)
 	if err != nil {
 		a.freeHost(hb)
 		return 0, 0, err
@@ -45,54 +94,77 @@ func (a *PortAllocator) AllocatePair() (int, int, error) {
 	return hb, pp, nil
 }
 
-func (a *PortAllocator) allocateHost() (int, error) {
-	hb := a.nextInRange(a.nextHostBind, a.hostBindRange)
-	startHB := hb
-	for {
-		if _, ok := a.usedHost[hb]; !ok {
-			a.usedHost[hb] = struct{}{}
-			if hb >= a.nextHostBind {
-				a.nextHostBind = hb + 1
-			}
-			return hb, nil
-		}
-		hb++
-		hb = a.nextInRange(hb, a.hostBindRange)
-		if hb == startHB {
-			return 0, fmt.Errorf("no available host-bind ports in range %d-%d", a.hostBindRange.Start, a.hostBindRange.End)
-		}
+// reservePairAt reserves exactly host and allocates a public port for it.
+func (a *PortAllocator) reservePairAt(host int, public portCheck) (int, int, error) {
+	if err := a.ReserveHost(host); err != nil {
+		return 0, 0, err
+	}
+	pp, err := a.allocatePublic(public)
+	if err != nil {
+		a.freeHost(host)
+		return 0, 0, err
 	}
+	return host, pp, nil
 }
 
-func (a *PortAllocator) allocatePublic() (int, error) {
-	pp := a.nextInRange(a.nextPublic, a.publicRange)
-	startPP := pp
+func (a *PortAllocator) allocateHost(check portCheck) (int, error) {
+	hb, ok := a.scan(a.nextHostBind, a.hostBindRange, a.usedHost, check)
+	if !ok {
+		return 0, fmt.Errorf("no available host-bind ports in range %d-%d", a.hostBindRange.Start, a.hostBindRange.End)
+	}
+	a.usedHost[hb] = struct{}{}
+	if hb >= a.nextHostBind {
+		a.nextHostBind = hb + 1
+	}
+	return hb, nil
+}
+
+func (a *PortAllocator) allocatePublic(check portCheck) (int, error) {
+	pp, ok := a.scan(a.nextPublic, a.publicRange, a.usedPublic, check)
+	if !ok {
+		return 0, fmt.Errorf("no available public ports in range %d-%d", a.publicRange.Start, a.publicRange.End)
+	}
+	a.usedPublic[pp] = struct{}{}
+	if pp >= a.nextPublic {
+		a.nextPublic = pp + 1
+	}
+	return pp, nil
+}
+
+// scan walks r once from next, wrapping around, for a port that is neither
+// used nor excluded and passes check.
+func (a *PortAllocator) scan(next int, r PortRange, used map[int]struct{}, check portCheck) (int, bool) {
+	port := a.nextInRange(next, r)
+	start := port
+	fallback := 0
 	for {
-		if _, ok := a.usedPublic[pp]; !ok {
-			a.usedPublic[pp] = struct{}{}
-			if pp >= a.nextPublic {
-				a.nextPublic = pp + 1
+		if _, ok := used[port]; !ok && !a.isExcluded(port) {
+			if check == nil || check(port) {
+				return port, true
+			}
+			if fallback == 0 {
+				fallback = port
 			}
-			return pp, nil
 		}
-		pp++
-		pp = a.nextInRange(pp, a.publicRange)
-		if pp == startPP {
-			return 0, fmt.Errorf("no available public ports in range %d-%d", a.publicRange.Start, a.publicRange.End)
+		port = a.nextInRange(port+1, r)
+		if port == start {
+			return fallback, fallback != 0
 		}
 	}
 }
 
 // ReserveHost reserves an existing host-bind port so it won't be reused.
+// Ports outside the range are accepted: a container keeps the port it was
+// created with after the range moves.
 func (a *PortAllocator) ReserveHost(port int) error {
-	if port < a.hostBindRange.Start || port > a.hostBindRange.End {
-		return fmt.Errorf("host port %d outside allocator range %d-%d", port, a.hostBindRange.Start, a.hostBindRange.End)
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("host port %d out of range", port)
 	}
 	if _, exists := a.usedHost[port]; exists {
 		return fmt.Errorf("host port %d already reserved", port)
 	}
 	a.usedHost[port] = struct{}{}
-	if port >= a.nextHostBind {
+	if port >= a.nextHostBind && port <= a.hostBindRange.End {
 		a.nextHostBind = port + 1
 	}
 	return nil
@@ -100,7 +172,7 @@ func (a *PortAllocator) ReserveHost(port int) error {
 
 // AllocatePublic allocates only a public proxy port.
 func (a *PortAllocator) AllocatePublic() (int, error) {
-	return a.allocatePublic()
+	return a.allocatePublic(nil)
 }
 
 func (a *PortAllocator) freeHost(port int) {
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connection limits in effect until the system settings change them.
+const (
+	DefaultMaxConnections      = 1024
+	DefaultMaxConnectionsPerIP = 128
+	DefaultConnectionIdle      = 15 * time.Minute
+)
+
+// ConnectionLimits bounds the connections a listener proxy holds open. On
+// an endpoint a zero field falls back to the system default; in the
+// defaults themselves a zero field means unlimited.
+type ConnectionLimits struct {
+	MaxConnections      int
+	MaxConnectionsPerIP int
+	// IdleTimeout closes a connection that has carried no traffic in
+	// either direction for this long.
+	IdleTimeout time.Duration
+}
+
+// DefaultConnectionLimits returns the built-in system defaults.
+func DefaultConnectionLimits() ConnectionLimits {
+	return ConnectionLimits{
+		MaxConnections:      DefaultMaxConnections,
+		MaxConnectionsPerIP: DefaultMaxConnectionsPerIP,
+		IdleTimeout:         DefaultConnectionIdle,
+	}
+}
+
+type connectionLimitsJSON struct {
+	MaxConnections      int    `json:"max_connections"`
+	MaxConnectionsPerIP int    `json:"max_connections_per_ip"`
+	IdleTimeout         string `json:"idle_timeout"`
+}
+
+// MarshalJSON writes the idle timeout as a Go duration, the way app.yaml
+// spells it; an unset timeout is written as "0s".
+func (l ConnectionLimits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(connectionLimitsJSON{
+		MaxConnections:      l.MaxConnections,
+		MaxConnectionsPerIP: l.MaxConnectionsPerIP,
+		IdleTimeout:         l.IdleTimeout.String(),
+	})
+}
+
+// UnmarshalJSON reads what MarshalJSON writes; an empty idle timeout is
+// zero.
+func (l *ConnectionLimits) UnmarshalJSON(data []byte) error {
+	var raw connectionLimitsJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	out := ConnectionLimits{MaxConnections: raw.MaxConnections, MaxConnectionsPerIP: raw.MaxConnectionsPerIP}
+	if raw.IdleTimeout != "" {
+		d, err := time.ParseDuration(raw.IdleTimeout)
+		if err != nil {
+			return fmt.Errorf("idle_timeout: %w", err)
+		}
+		out.IdleTimeout = d
+	}
+	*l = out
+	return nil
+}
+
+// Validate reports negative limits and a per-IP cap above the overall one.
+func (l ConnectionLimits) Validate() error {
+	switch {
+	case l.MaxConnections < 0:
+		return fmt.Errorf("max_connections must not be negative")
+	case l.MaxConnectionsPerIP < 0:
+		return fmt.Errorf("max_connections_per_ip must not be negative")
+	case l.IdleTimeout < 0:
+		return fmt.Errorf("idle_timeout must not be negative")
+	case l.MaxConnections > 0 && l.MaxConnectionsPerIP > l.MaxConnections:
+		return fmt.Errorf("max_connections_per_ip %d exceeds max_connections %d", l.MaxConnectionsPerIP, l.MaxConnections)
+	}
+	return nil
+}
+
+// withDefaults fills the unset fields of l from defaults.
+func (l ConnectionLimits) withDefaults(defaults ConnectionLimits) ConnectionLimits {
+	if l.MaxConnections == 0 {
+		l.MaxConnections = defaults.MaxConnections
+	}
+	if l.MaxConnectionsPerIP == 0 {
+		l.MaxConnectionsPerIP = defaults.MaxConnectionsPerIP
+	}
+	if l.IdleTimeout == 0 {
+		l.IdleTimeout = defaults.IdleTimeout
+	}
+	// An endpoint may lower the overall cap below the default per-IP one.
+	if l.MaxConnections > 0 && l.MaxConnectionsPerIP > l.MaxConnections {
+		l.MaxConnectionsPerIP = l.MaxConnections
+	}
+	return l
+}
+
+// connLimiter tracks the open connections of one listener. Limits are read
+// on every accept, so changes to the system defaults reach running proxies.
+type connLimiter struct {
+	limits func() ConnectionLimits
+
+	mu     sync.Mutex
+	active int
+	perIP  map[string]int
+}
+
+func newConnLimiter(limits func() ConnectionLimits) *connLimiter {
+	return &connLimiter{limits: limits, perIP: make(map[string]int)}
+}
+
+// acquire takes a connection slot, and a slot for ip when ip is not empty.
+// It reports false when either cap is reached.
+func (l *connLimiter) acquire(ip string) bool {
+	limits := l.limits()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limits.MaxConnections > 0 && l.active >= limits.MaxConnections {
+		return false
+	}
+	if ip != "" && limits.MaxConnectionsPerIP > 0 && l.perIP[ip] >= limits.MaxConnectionsPerIP {
+		return false
+	}
+	l.active++
+	if ip != "" {
+		l.perIP[ip]++
+	}
+	return true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if ip == "" {
+		return
+	}
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
+
+// acquireIP takes only a per-IP slot, for connections whose overall slot is
+// taken where they reach the listener (the TLS mux).
+func (l *connLimiter) acquireIP(ip string) bool {
+	limits := l.limits()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limits.MaxConnectionsPerIP > 0 && l.perIP[ip] >= limits.MaxConnectionsPerIP {
+		return false
+	}
+	l.perIP[ip]++
+	return true
+}
+
+func (l *connLimiter) releaseIP(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
+
+// limitIP is the address a connection counts against for the per-IP cap.
+// Loopback peers are the TLS mux, Nexus and local tools relaying for other
+// clients; they are only held to the overall cap.
+func limitIP(c net.Conn) string {
+	addr, ok := c.RemoteAddr().(*net.TCPAddr)
+	if !ok || addr.IP.IsLoopback() {
+		return ""
+	}
+	return addr.IP.String()
+}
+
+// limitListener turns away connections over the limits as soon as they are
+// accepted, rather than leaving them queued, and closes idle ones.
+type limitListener struct {
+	net.Listener
+	limiter  *connLimiter
+	counters *endpointCounters
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := limitIP(c)
+		if !l.limiter.acquire(ip) {
+			l.counters.rejected.Add(1)
+			_ = c.Close()
+			continue
+		}
+		lc := &limitedConn{Conn: c, release: func() { l.limiter.release(ip) }}
+		if idle := l.limiter.limits().IdleTimeout; idle > 0 {
+			lc.idle = idle
+			lc.timer = time.AfterFunc(idle, func() { _ = lc.Close() })
+		}
+		return lc, nil
+	}
+}
+
+// limitedConn gives back its slot on Close and is closed by its idle timer
+// when no bytes move either way for the idle timeout.
+type limitedConn struct {
+	net.Conn
+	release   func()
+	idle      time.Duration
+	timer     *time.Timer
+	closed    atomic.Bool
+	closeOnce sync.Once
+}
+
+func (c *limitedConn) active() {
+	if c.timer != nil && !c.closed.Load() {
+		c.timer.Reset(c.idle)
+	}
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.active()
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.active()
+	}
+	return n, err
+}
+
+func (c *limitedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *limitedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.release()
+	})
+	return c.Conn.Close()
+}
+
+// SetConnectionLimits replaces the system default connection limits. Zero
+// fields are unlimited. Running proxies apply them to new connections.
+func (m *ServiceManager) SetConnectionLimits(limits ConnectionLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	m.proxyManager.setDefaultLimits(limits)
+	return nil
+}
+
+// ConnectionLimits returns the system default connection limits.
+func (m *ServiceManager) ConnectionLimits() ConnectionLimits {
+	return m.proxyManager.defaultLimits()
+}
+
+// EffectiveConnectionLimits resolves an endpoint's limits against the
+// system defaults.
+func (m *ServiceManager) EffectiveConnectionLimits(ep ServiceEndpoint) ConnectionLimits {
+	return ep.Limits.withDefaults(m.proxyManager.defaultLimits())
+}
+
+// acquireRemoteClient holds a per-IP slot on the listener serving
+// publicPort for a client whose connection is relayed over loopback. The
+// returned release is nil when the client is over its limit; ok is true
+// with a no-op release when no such listener runs.
+func (m *ServiceManager) acquireRemoteClient(publicPort int, ip string) (release func(), ok bool) {
+	limiter := m.proxyManager.limiterFor(publicPort)
+	if limiter == nil || ip == "" {
+		return func() {}, true
+	}
+	if !limiter.acquireIP(ip) {
+		m.proxyManager.countRejected(publicPort)
+		return nil, false
+	}
+	return func() { limiter.releaseIP(ip) }, true
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+// startLimitedEcho proxies a fresh echo backend with limits on a free port.
+func startLimitedEcho(t *testing.T, pm *ProxyManager, app string, limits ConnectionLimits) ServiceEndpoint {
+	t.Helper()
+	hb, stop := startEchoBackend(t)
+	t.Cleanup(stop)
+	ep := ServiceEndpoint{App: app, Name: "echo", HostBind: hb, PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw, Limits: limits}
+	if err := pm.StartListener(ep); err != nil {
+		t.Fatalf("start listener: %v", err)
+	}
+	return ep
+}
+
+func dialEcho(t *testing.T, ep ServiceEndpoint) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.PublicPort)))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// echoLine sends a line and waits for it to come back.
+func echoLine(conn net.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		return err
+	}
+	buf := make([]byte, 5)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if string(buf[:n]) != "ping\n" {
+		return errors.New("unexpected echo " + string(buf[:n]))
+	}
+	return nil
+}
+
+// expectClosed waits for the proxy to close conn and reports how long that
+// took.
+func expectClosed(t *testing.T, conn net.Conn, within time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	_ = conn.SetReadDeadline(start.Add(within))
+	_, err := conn.Read(make([]byte, 1))
+	var ne net.Error
+	if err == nil || (errors.As(err, &ne) && ne.Timeout()) {
+		t.Fatalf("connection still open after %s (err=%v)", within, err)
+	}
+	return time.Since(start)
+}
+
+func TestProxy_ConnectionCapRejectsImmediately(t *testing.T) {
+	pm := NewProxyManager()
+	t.Cleanup(pm.StopAll)
+	capped := startLimitedEcho(t, pm, "capped", ConnectionLimits{MaxConnections: 2})
+	other := startLimitedEcho(t, pm, "other", ConnectionLimits{})
+
+	first, second := dialEcho(t, capped), dialEcho(t, capped)
+	for _, c := range []net.Conn{first, second} {
+		if err := echoLine(c); err != nil {
+			t.Fatalf("connection under the cap: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		expectClosed(t, dialEcho(t, capped), time.Second)
+	}
+	if st, _ := pm.stats.get("capped", "echo"); st.RejectedConnections != 3 || st.ActiveConnections != 2 {
+		t.Fatalf("expected 3 rejected and 2 active, got %+v", st)
+	}
+
+	// Another app's listener is not held to the capped one's limit.
+	if err := echoLine(dialEcho(t, other)); err != nil {
+		t.Fatalf("other app: %v", err)
+	}
+	if st, _ := pm.stats.get("other", "echo"); st.RejectedConnections != 0 {
+		t.Fatalf("other app rejected connections: %+v", st)
+	}
+
+	// Closing a connection frees its slot.
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(capped.PublicPort)))
+		if err == nil {
+			err = echoLine(conn)
+			conn.Close()
+			if err == nil {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestProxy_IdleTimeoutClosesQuietConnections(t *testing.T) {
+	pm := NewProxyManager()
+	t.Cleanup(pm.StopAll)
+	idle := 300 * time.Millisecond
+	ep := startLimitedEcho(t, pm, "idle", ConnectionLimits{IdleTimeout: idle})
+
+	conn := dialEcho(t, ep)
+	// Traffic keeps resetting the timer well past one timeout.
+	for i := 0; i < 6; i++ {
+		if err := echoLine(conn); err != nil {
+			t.Fatalf("echo %d: %v", i, err)
+		}
+		time.Sleep(idle / 3)
+	}
+	if took := expectClosed(t, conn, 3*time.Second); took < idle/2 {
+		t.Fatalf("closed after %s, before the idle timeout", took)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if st, _ := pm.stats.get("idle", "echo"); st.ActiveConnections == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("idle connection still counted as active")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxy_DefaultLimitsApplyToRunningListeners(t *testing.T) {
+	pm := NewProxyManager()
+	t.Cleanup(pm.StopAll)
+	ep := startLimitedEcho(t, pm, "defaults", ConnectionLimits{})
+	if err := echoLine(dialEcho(t, ep)); err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+	pm.setDefaultLimits(ConnectionLimits{MaxConnections: 1})
+	expectClosed(t, dialEcho(t, ep), time.Second)
+}
+
+func TestConnLimiter_PerIP(t *testing.T) {
+	limiter := newConnLimiter(func() ConnectionLimits { return ConnectionLimits{MaxConnections: 3, MaxConnectionsPerIP: 2} })
+	if !limiter.acquire("192.0.2.1") || !limiter.acquire("192.0.2.1") {
+		t.Fatalf("first two connections from one address should be allowed")
+	}
+	if limiter.acquire("192.0.2.1") {
+		t.Fatalf("third connection from one address should be refused")
+	}
+	if !limiter.acquire("192.0.2.2") {
+		t.Fatalf("another address should be allowed")
+	}
+	if limiter.acquire("192.0.2.3") {
+		t.Fatalf("overall cap should refuse a fourth connection")
+	}
+	limiter.release("192.0.2.1")
+	if !limiter.acquire("192.0.2.3") {
+		t.Fatalf("released slot should be reusable")
+	}
+	if len(limiter.perIP) != 3 || limiter.perIP["192.0.2.1"] != 1 {
+		t.Fatalf("unexpected per-IP counts %v", limiter.perIP)
+	}
+}
+
+func TestProxy_PerIPLimitSkipsLoopbackAndHoldsRemoteClients(t *testing.T) {
+	sm := NewServiceManager()
+	t.Cleanup(sm.proxyManager.StopAll)
+	ep := startLimitedEcho(t, sm.proxyManager, "perip", ConnectionLimits{MaxConnectionsPerIP: 1})
+
+	// Loopback peers relay for other clients and only meet the overall cap.
+	for i := 0; i < 2; i++ {
+		if err := echoLine(dialEcho(t, ep)); err != nil {
+			t.Fatalf("loopback connection %d: %v", i, err)
+		}
+	}
+
+	release, ok := sm.acquireRemoteClient(ep.PublicPort, "203.0.113.5")
+	if !ok {
+		t.Fatalf("first remote connection refused")
+	}
+	if _, ok := sm.acquireRemoteClient(ep.PublicPort, "203.0.113.5"); ok {
+		t.Fatalf("second remote connection from one client allowed")
+	}
+	if r, ok := sm.acquireRemoteClient(ep.PublicPort, "203.0.113.6"); !ok {
+		t.Fatalf("another remote client refused")
+	} else {
+		r()
+	}
+	release()
+	if r, ok := sm.acquireRemoteClient(ep.PublicPort, "203.0.113.5"); !ok {
+		t.Fatalf("released client refused")
+	} else {
+		r()
+	}
+	if st := sm.EndpointStats("perip", "echo"); st.RejectedConnections != 1 {
+		t.Fatalf("expected one rejection, got %+v", st)
+	}
+	if _, ok := sm.acquireRemoteClient(getFreePort(t), "203.0.113.5"); !ok {
+		t.Fatalf("ports without a listener should not refuse")
+	}
+}
+
+func TestConnectionLimits_DefaultsAndValidation(t *testing.T) {
+	sm := NewServiceManager()
+	if got := sm.ConnectionLimits(); got != DefaultConnectionLimits() {
+		t.Fatalf("unexpected defaults %+v", got)
+	}
+	if err := sm.SetConnectionLimits(ConnectionLimits{MaxConnections: 10, MaxConnectionsPerIP: 20}); err == nil {
+		t.Fatalf("per-IP cap above the overall cap accepted")
+	}
+	if err := sm.SetConnectionLimits(ConnectionLimits{MaxConnections: 100, IdleTimeout: time.Minute}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+	ep := ServiceEndpoint{Limits: ConnectionLimits{MaxConnections: 5, MaxConnectionsPerIP: 10}}
+	want := ConnectionLimits{MaxConnections: 5, MaxConnectionsPerIP: 5, IdleTimeout: time.Minute}
+	if got := sm.EffectiveConnectionLimits(ep); got != want {
+		t.Fatalf("effective limits %+v, want %+v", got, want)
+	}
+}
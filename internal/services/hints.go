@@ -0,0 +1,180 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProxyHintTTL bounds how long a connection hint waits for the
+	// proxied connection to arrive. Hints are normally consumed within
+	// milliseconds; anything older belongs to a connection that never showed
+	// up and must not be applied to a later one reusing the source port.
+	DefaultProxyHintTTL = 30 * time.Second
+	// DefaultProxyHintCap caps the number of outstanding hints.
+	DefaultProxyHintCap = 4096
+)
+
+// ProxyHint describes an outstanding connection hint for diagnostics.
+type ProxyHint struct {
+	ListenerPort int           `json:"listener_port"`
+	SourcePort   int           `json:"source_port"`
+	RemotePort   int           `json:"remote_port,omitempty"`
+	TLS          bool          `json:"tls"`
+	Age          time.Duration `json:"-"`
+}
+
+type hintKey struct {
+	listener int
+	source   int
+	created  time.Time
+}
+
+// hintStore holds connection hints keyed by listener and source port. Entries
+// expire after ttl and the oldest are evicted beyond limit.
+type hintStore struct {
+	mu    sync.Mutex
+	byKey map[int]map[int]connectionHint
+	order []hintKey // insertion order; may contain entries already removed
+	count int
+	ttl   time.Duration
+	limit int
+	now   func() time.Time
+}
+
+func newHintStore() *hintStore {
+	return &hintStore{
+		byKey: make(map[int]map[int]connectionHint),
+		ttl:   DefaultProxyHintTTL,
+		limit: DefaultProxyHintCap,
+		now:   time.Now,
+	}
+}
+
+func (s *hintStore) setLimits(ttl time.Duration, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+	if limit > 0 {
+		s.limit = limit
+	}
+	s.pruneLocked(s.now())
+}
+
+func (s *hintStore) put(listenerPort, sourcePort int, hint connectionHint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	hint.created = now
+	m := s.byKey[listenerPort]
+	if m == nil {
+		m = make(map[int]connectionHint)
+		s.byKey[listenerPort] = m
+	}
+	if _, exists := m[sourcePort]; !exists {
+		s.count++
+	}
+	m[sourcePort] = hint
+	s.order = append(s.order, hintKey{listener: listenerPort, source: sourcePort, created: now})
+	s.pruneLocked(now)
+}
+
+// take removes and returns a live hint.
+func (s *hintStore) take(listenerPort, sourcePort int) (connectionHint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hint, ok := s.byKey[listenerPort][sourcePort]
+	if !ok {
+		return connectionHint{}, false
+	}
+	s.deleteLocked(listenerPort, sourcePort)
+	if s.now().Sub(hint.created) > s.ttl {
+		return connectionHint{}, false
+	}
+	return hint, true
+}
+
+func (s *hintStore) remove(listenerPort, sourcePort int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byKey[listenerPort][sourcePort]; ok {
+		s.deleteLocked(listenerPort, sourcePort)
+	}
+}
+
+func (s *hintStore) dropListener(listenerPort int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count -= len(s.byKey[listenerPort])
+	delete(s.byKey, listenerPort)
+}
+
+func (s *hintStore) snapshot() []ProxyHint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.pruneLocked(now)
+	out := make([]ProxyHint, 0, s.count)
+	for listener, m := range s.byKey {
+		for source, hint := range m {
+			out = append(out, ProxyHint{
+				ListenerPort: listener,
+				SourcePort:   source,
+				RemotePort:   hint.remotePort,
+				TLS:          hint.isTLS,
+				Age:          now.Sub(hint.created),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ListenerPort != out[j].ListenerPort {
+			return out[i].ListenerPort < out[j].ListenerPort
+		}
+		return out[i].SourcePort < out[j].SourcePort
+	})
+	return out
+}
+
+func (s *hintStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (s *hintStore) deleteLocked(listenerPort, sourcePort int) {
+	m := s.byKey[listenerPort]
+	delete(m, sourcePort)
+	if len(m) == 0 {
+		delete(s.byKey, listenerPort)
+	}
+	s.count--
+}
+
+// pruneLocked drops expired hints and evicts the oldest beyond the limit.
+func (s *hintStore) pruneLocked(now time.Time) {
+	i := 0
+	for ; i < len(s.order); i++ {
+		k := s.order[i]
+		if s.count <= s.limit && now.Sub(k.created) <= s.ttl {
+			break
+		}
+		if hint, ok := s.byKey[k.listener][k.source]; ok && hint.created.Equal(k.created) {
+			s.deleteLocked(k.listener, k.source)
+		}
+	}
+	s.order = s.order[i:]
+	// Consumed hints leave stale order entries behind; compact once they
+	// dominate so the queue stays proportional to the live set.
+	if len(s.order) > 2*s.limit {
+		live := make([]hintKey, 0, s.count)
+		for _, k := range s.order {
+			if hint, ok := s.byKey[k.listener][k.source]; ok && hint.created.Equal(k.created) {
+				live = append(live, k)
+			}
+		}
+		s.order = live
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func TestHintStore_BoundedUnderChurn(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newHintStore()
+	s.now = clock.now
+	s.setLimits(time.Minute, 512)
+
+	// Simulate days of reconnects: ephemeral source ports cycle and most
+	// connections never reach a proxy that consumes their hint.
+	for i := 0; i < 20000; i++ {
+		listener := 15000 + i%8
+		source := 32768 + i%28000
+		s.put(listener, source, connectionHint{remotePort: 443, isTLS: i%2 == 0})
+		if i%3 == 0 {
+			s.take(listener, source)
+		}
+		clock.advance(time.Millisecond)
+	}
+	if n := s.size(); n > 512 {
+		t.Fatalf("hint count %d exceeds cap", n)
+	}
+	if n := len(s.order); n > 2*512 {
+		t.Fatalf("order queue grew to %d entries", n)
+	}
+	if got := len(s.snapshot()); got != s.size() {
+		t.Fatalf("snapshot lists %d hints, store holds %d", got, s.size())
+	}
+
+	clock.advance(2 * time.Minute)
+	if hints := s.snapshot(); len(hints) != 0 {
+		t.Fatalf("expired hints still listed: %d", len(hints))
+	}
+	if s.size() != 0 {
+		t.Fatalf("expired hints still counted: %d", s.size())
+	}
+}
+
+func TestHintStore_ExpiredHintIsNotApplied(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newHintStore()
+	s.now = clock.now
+	s.setLimits(time.Second, 0)
+
+	s.put(15000, 40000, connectionHint{isTLS: true, remotePort: 8443})
+	clock.advance(2 * time.Second)
+	// A new connection reusing the ephemeral port must not inherit the stale hint.
+	if hint, ok := s.take(15000, 40000); ok {
+		t.Fatalf("expired hint applied: %+v", hint)
+	}
+
+	s.put(15000, 40001, connectionHint{remotePort: 8443})
+	s.remove(15000, 40001)
+	if _, ok := s.take(15000, 40001); ok {
+		t.Fatalf("removed hint still applied")
+	}
+
+	s.put(15000, 40002, connectionHint{remotePort: 8443})
+	if hint, ok := s.take(15000, 40002); !ok || hint.remotePort != 8443 {
+		t.Fatalf("live hint not applied: %+v %v", hint, ok)
+	}
+	if s.size() != 0 {
+		t.Fatalf("expected empty store, got %d", s.size())
+	}
+}
+
+func TestProxy_PassthroughTCPConsumesHint(t *testing.T) {
+	hb, stop := startEchoBackend(t)
+	defer stop()
+
+	pm := NewProxyManager()
+	public := getFreePort(t)
+	ep := ServiceEndpoint{App: "test", Name: "echo", HostBind: hb, PublicPort: public, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw}
+	pm.StartListener(ep)
+	defer pm.StopAll()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(public)))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	pm.registerHint(public, conn.LocalAddr().(*net.TCPAddr).Port, connectionHint{remotePort: 2222})
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for len(pm.Hints()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("passthrough connection left its hint behind: %+v", pm.Hints())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -3,13 +3,16 @@ package services
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"piccolod/internal/api"
@@ -35,6 +38,18 @@ type ServiceManager struct {
 	lockReader     LockStateReader
 	lockOverrideMu sync.RWMutex
 	lockOverride   *bool
+	statsMu        sync.Mutex
+	statsStore     StatsStore
+	statsLoaded    bool
+	// generation counts registry changes; guarded by mu.
+	generation uint64
+	bus        *events.Bus
+	// portPolicy is the allocator's configuration; guarded by mu.
+	portPolicy PortPolicy
+	probe      *portProbe
+	// remoteLabels makes remote hostname labels unique across apps while
+	// remote access publishes them; guarded by mu.
+	remoteLabels bool
 }
 
 // LockStateReader exposes the control lock state for services.
@@ -43,17 +58,17 @@ type LockStateReader interface {
 }
 
 func NewServiceManager() *ServiceManager {
-	allocator := NewPortAllocator(
-		PortRange{Start: 15000, End: 25000},
-		PortRange{Start: 35000, End: 45000},
-	)
+	policy := DefaultPortPolicy()
+	allocator := NewPortAllocator(policy.HostBind, policy.Public)
 	return &ServiceManager{
 		allocator:    allocator,
+		portPolicy:   policy,
 		registry:     make(map[string]map[string]ServiceEndpoint),
 		proxyManager: NewProxyManager(),
 		stopCh:       make(chan struct{}),
 		containerIDs: make(map[string]string),
 		leadership:   make(map[string]cluster.Role),
+		probe:        newPortProbe(),
 	}
 }
 
@@ -79,6 +94,17 @@ func (m *ServiceManager) notifyUnpublish(port int) {
 	}
 }
 
+// SetRouteResolver wires the router so listeners of apps this node follows
+// forward their connections to the leader.
+func (m *ServiceManager) SetRouteResolver(r RouteResolver) {
+	m.proxyManager.SetRouteResolver(r)
+}
+
+// TunnelStats reports connections forwarded to the leader for followed apps.
+func (m *ServiceManager) TunnelStats() TunnelStats {
+	return m.proxyManager.TunnelStats()
+}
+
 // PortPublisher abstracts remote publish notifications (e.g., Nexus re-enable).
 type PortPublisher interface{ Publish(port int) }
 
@@ -110,6 +136,10 @@ func normalizeRemotePort(port int) int {
 
 func defaultRemotePorts(listener api.AppListener) []int {
 	if len(listener.RemotePorts) == 0 {
+		// Raw tcp/udp listeners are only exposed remotely on explicitly requested ports.
+		if listener.Protocol.Passthrough() {
+			return nil
+		}
 		return []int{80, 443}
 	}
 	ports := make([]int, len(listener.RemotePorts))
@@ -130,12 +160,18 @@ func (m *ServiceManager) ObserveRuntimeEvents(bus *events.Bus) {
 	m.eventCancel = cancel
 	m.eventsMu.Unlock()
 
+	m.mu.Lock()
+	m.bus = bus
+	m.mu.Unlock()
+
 	leaders := bus.Subscribe(events.TopicLeadershipRoleChanged, 16)
 	locks := bus.Subscribe(events.TopicLockStateChanged, 8)
 
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
+		defer bus.Unsubscribe(events.TopicLeadershipRoleChanged, leaders)
+		defer bus.Unsubscribe(events.TopicLockStateChanged, locks)
 		for {
 			select {
 			case evt, ok := <-leaders:
@@ -200,11 +236,40 @@ func (m *ServiceManager) StopRuntimeEvents() {
 // ProxyManager returns the underlying ProxyManager.
 func (m *ServiceManager) ProxyManager() *ProxyManager { return m.proxyManager }
 
-func (m *ServiceManager) RegisterProxyHint(listenerPort, sourcePort, remotePort int, isTLS bool) {
+// RegisterProxyHint tells the listener on listenerPort what a connection
+// from sourcePort carries: the remote port and TLS state it arrived with
+// and, for remote traffic, the client address Nexus reported.
+func (m *ServiceManager) RegisterProxyHint(listenerPort, sourcePort, remotePort int, isTLS bool, clientIP string) {
 	if listenerPort <= 0 || sourcePort <= 0 || m.proxyManager == nil {
 		return
 	}
-	m.proxyManager.registerHint(listenerPort, sourcePort, connectionHint{isTLS: isTLS, remotePort: remotePort})
+	m.proxyManager.registerHint(listenerPort, sourcePort, connectionHint{isTLS: isTLS, remotePort: remotePort, clientIP: clientIP})
+}
+
+// ForgetProxyHint drops a hint whose connection closed before the proxy
+// consumed it.
+func (m *ServiceManager) ForgetProxyHint(listenerPort, sourcePort int) {
+	if listenerPort <= 0 || sourcePort <= 0 || m.proxyManager == nil {
+		return
+	}
+	m.proxyManager.forgetHint(listenerPort, sourcePort)
+}
+
+// ProxyHints lists outstanding connection hints for diagnostics.
+func (m *ServiceManager) ProxyHints() []ProxyHint {
+	if m.proxyManager == nil {
+		return nil
+	}
+	return m.proxyManager.Hints()
+}
+
+// ConsumeProxyHint removes the hint for a connection that reached
+// listenerPort from sourcePort and reports the client address and TLS state
+// it was relayed with. Servers outside the proxy manager, such as the portal,
+// use it to identify connections the TLS mux or Nexus relayed over loopback.
+func (m *ServiceManager) ConsumeProxyHint(listenerPort, sourcePort int) (clientIP string, isTLS bool, ok bool) {
+	hint, ok := m.consumeProxyHint(listenerPort, sourcePort)
+	return hint.clientIP, hint.isTLS, ok
 }
 
 func (m *ServiceManager) consumeProxyHint(listenerPort, sourcePort int) (connectionHint, bool) {
@@ -275,6 +340,13 @@ func (m *ServiceManager) RestoreFromPodman(appName string, listeners []api.AppLi
 		return endpoints, nil
 	}
 
+	for _, err := range []error{m.remoteLabelConflictLocked(appName, listeners), m.pathPrefixConflictLocked(appName, listeners)} {
+		if err != nil {
+			// The container is already running; keep serving it locally
+			// and let routing keep preferring the app that sorts first.
+			log.Printf("WARN: restore services: %v", err)
+		}
+	}
 	registry := make(map[string]ServiceEndpoint)
 	for _, l := range listeners {
 		host, ok := hostByGuest[l.GuestPort]
@@ -291,15 +363,22 @@ func (m *ServiceManager) RestoreFromPodman(appName string, listeners []api.AppLi
 		}
 		remotePorts := defaultRemotePorts(l)
 		ep := ServiceEndpoint{
-			App:         appName,
-			Name:        l.Name,
-			GuestPort:   l.GuestPort,
-			HostBind:    host,
-			PublicPort:  public,
-			Flow:        l.Flow,
-			Protocol:    l.Protocol,
-			Middleware:  l.Middleware,
-			RemotePorts: remotePorts,
+			App:             appName,
+			Name:            l.Name,
+			GuestPort:       l.GuestPort,
+			HostBind:        host,
+			PublicPort:      public,
+			Flow:            l.Flow,
+			Protocol:        l.Protocol,
+			Middleware:      l.Middleware,
+			RemotePorts:     remotePorts,
+			RemoteSubdomain: l.RemoteSubdomain,
+			InternalHost:    !l.PreservesHost(),
+			BackendTLS:      l.BackendTLS,
+			Limits:          listenerLimits(l),
+			PathPrefix:      l.PortalPath(),
+			StripPrefix:     l.StripsPrefix(),
+			PublicPath:      l.Public,
 		}
 		registry[l.Name] = ep
 		endpoints = append(endpoints, ep)
@@ -310,50 +389,140 @@ func (m *ServiceManager) RestoreFromPodman(appName string, listeners []api.AppLi
 
 	if len(registry) > 0 {
 		m.registry[appName] = registry
+		m.registryChangedLocked()
 	}
 	return endpoints, nil
 }
 
 // AllocateForApp allocates ports for all listeners of an app and starts proxies
 func (m *ServiceManager) AllocateForApp(appName string, listeners []api.AppListener) ([]ServiceEndpoint, error) {
+	endpoints, err := m.ReserveForApp(appName, listeners)
+	if err != nil {
+		return nil, err
+	}
+	// Bind failures are logged by the proxy manager; the endpoints stay
+	// registered so a later reconcile can retry them.
+	_ = m.PublishApp(appName)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i, ep := range endpoints {
+		endpoints[i] = m.registry[appName][ep.Name]
+	}
+	return endpoints, nil
+}
+
+// ReserveForApp allocates ports for all listeners of an app and registers
+// its endpoints without starting proxies. On error nothing stays allocated.
+func (m *ServiceManager) ReserveForApp(appName string, listeners []api.AppListener) ([]ServiceEndpoint, error) {
+	return m.reserveForApp(appName, listeners, false)
+}
+
+// ReserveOnGuestPorts is ReserveForApp for an app on the host network: it
+// binds its guest ports on the host itself, so each endpoint's host port is
+// its guest port rather than one from the host-bind range.
+func (m *ServiceManager) ReserveOnGuestPorts(appName string, listeners []api.AppListener) ([]ServiceEndpoint, error) {
+	return m.reserveForApp(appName, listeners, true)
+}
+
+func (m *ServiceManager) reserveForApp(appName string, listeners []api.AppListener, onGuestPorts bool) ([]ServiceEndpoint, error) {
+	// Deferred first so it runs after the unlock: saving is a store write.
+	defer m.probe.flush(context.Background())
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if err := m.remoteLabelConflictLocked(appName, listeners); err != nil {
+		return nil, err
+	}
+	if err := m.pathPrefixConflictLocked(appName, listeners); err != nil {
+		return nil, err
+	}
 
 	endpoints := make([]ServiceEndpoint, 0, len(listeners))
 
 	for _, l := range listeners {
-		hb, pp, err := m.allocator.AllocatePair()
+		hostCheck, publicCheck := m.probe.checks(l)
+		var hb, pp int
+		var err error
+		if onGuestPorts {
+			hb, pp, err = m.allocator.reservePairAt(l.GuestPort, publicCheck)
+		} else {
+			hb, pp, err = m.allocator.allocatePairChecked(hostCheck, publicCheck)
+		}
 		if err != nil {
+			for _, ep := range endpoints {
+				m.allocator.Release(ep.HostBind, ep.PublicPort)
+			}
 			return nil, err
 		}
 		remotePorts := defaultRemotePorts(l)
 		ep := ServiceEndpoint{
-			App:         appName,
-			Name:        l.Name,
-			GuestPort:   l.GuestPort,
-			HostBind:    hb,
-			PublicPort:  pp,
-			Flow:        l.Flow,
-			Protocol:    l.Protocol,
-			Middleware:  l.Middleware,
-			RemotePorts: remotePorts,
+			App:             appName,
+			Name:            l.Name,
+			GuestPort:       l.GuestPort,
+			HostBind:        hb,
+			PublicPort:      pp,
+			Flow:            l.Flow,
+			Protocol:        l.Protocol,
+			Middleware:      l.Middleware,
+			RemotePorts:     remotePorts,
+			RemoteSubdomain: l.RemoteSubdomain,
+			InternalHost:    !l.PreservesHost(),
+			BackendTLS:      l.BackendTLS,
+			Limits:          listenerLimits(l),
+			PathPrefix:      l.PortalPath(),
+			StripPrefix:     l.StripsPrefix(),
+			PublicPath:      l.Public,
 		}
 		endpoints = append(endpoints, ep)
-		if _, ok := m.registry[appName]; !ok {
-			m.registry[appName] = make(map[string]ServiceEndpoint)
-		}
-		m.registry[appName][l.Name] = ep
 	}
-
-	// Start proxies after registration
+	if len(endpoints) == 0 {
+		return endpoints, nil
+	}
+	if _, ok := m.registry[appName]; !ok {
+		m.registry[appName] = make(map[string]ServiceEndpoint)
+	}
 	for _, ep := range endpoints {
-		m.proxyManager.StartListener(ep)
-		m.notifyPublish(ep.PublicPort)
+		m.registry[appName][ep.Name] = ep
 	}
-
+	m.registryChangedLocked()
 	return endpoints, nil
 }
 
+// PublishApp starts proxies for every registered endpoint of an app and
+// announces their public ports. A public port another process holds stays
+// reserved and the endpoint moves to the next free one, until the public
+// range runs out; endpoints that cannot be bound are reported, while the
+// others keep serving.
+func (m *ServiceManager) PublishApp(appName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	moved := false
+	for name, ep := range m.registry[appName] {
+		err := m.proxyManager.StartListener(ep)
+		for errors.Is(err, syscall.EADDRINUSE) {
+			pp, aerr := m.allocator.AllocatePublic()
+			if aerr != nil {
+				err = aerr
+				break
+			}
+			log.Printf("WARN: public port %d of %s/%s is taken; moving to %d", ep.PublicPort, appName, name, pp)
+			ep.PublicPort = pp
+			m.registry[appName][name] = ep
+			moved = true
+			err = m.proxyManager.StartListener(ep)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listener %s: %w", name, err))
+			continue
+		}
+		m.notifyPublish(ep.PublicPort)
+	}
+	if moved {
+		m.registryChangedLocked()
+	}
+	return errors.Join(errs...)
+}
+
 // ReserveHostPort permanently reserves a host-bind port to avoid future allocation.
 func (m *ServiceManager) ReserveHostPort(port int) error {
 	m.mu.Lock()
@@ -374,6 +543,50 @@ func (m *ServiceManager) GetAll() []ServiceEndpoint {
 	return out
 }
 
+// RegistrySnapshot is a consistent copy of the endpoint registry.
+type RegistrySnapshot struct {
+	// Generation increases with every registry change.
+	Generation uint64
+	// Apps maps each registered app to its endpoints sorted by name. Apps
+	// whose listeners were all removed by Reconcile are present but empty.
+	Apps map[string][]ServiceEndpoint
+}
+
+// Snapshot copies the registry together with its generation, so callers can
+// cache derived views and cheaply tell when they are stale.
+func (m *ServiceManager) Snapshot() RegistrySnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snap := RegistrySnapshot{Generation: m.generation, Apps: make(map[string][]ServiceEndpoint, len(m.registry))}
+	for app, mapp := range m.registry {
+		eps := make([]ServiceEndpoint, 0, len(mapp))
+		for _, ep := range mapp {
+			eps = append(eps, ep)
+		}
+		sort.Slice(eps, func(i, j int) bool { return eps[i].Name < eps[j].Name })
+		snap.Apps[app] = eps
+	}
+	return snap
+}
+
+// Generation reports the registry generation without copying it.
+func (m *ServiceManager) Generation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generation
+}
+
+// registryChangedLocked bumps the generation and announces it. Callers hold mu.
+func (m *ServiceManager) registryChangedLocked() {
+	m.generation++
+	if m.bus != nil {
+		m.bus.Publish(events.Event{
+			Topic:   events.TopicServicesChanged,
+			Payload: events.ServicesChanged{Generation: m.generation},
+		})
+	}
+}
+
 // GetByApp returns endpoints for a single app
 func (m *ServiceManager) GetByApp(appName string) ([]ServiceEndpoint, error) {
 	m.mu.RLock()
@@ -407,7 +620,7 @@ func (m *ServiceManager) ResolveByRemotePort(port int) (ServiceEndpoint, bool) {
 	defer m.mu.RUnlock()
 	for _, mapp := range m.registry {
 		for _, ep := range mapp {
-			if matchesRemotePort(ep, port) {
+			if ep.ServesRemotePort(port) {
 				return ep, true
 			}
 		}
@@ -415,35 +628,211 @@ func (m *ServiceManager) ResolveByRemotePort(port int) (ServiceEndpoint, bool) {
 	return ServiceEndpoint{}, false
 }
 
-// ResolveListener finds a listener by name and optional remote port.
+// ResolveListener finds a listener by name and optional remote port. When
+// several apps share the name, the first app in name order wins.
 func (m *ServiceManager) ResolveListener(listener string, remotePort int) (ServiceEndpoint, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	for _, mapp := range m.registry {
-		if ep, ok := mapp[listener]; ok && matchesRemotePort(ep, remotePort) {
+	for _, app := range m.sortedAppsLocked() {
+		if ep, ok := m.registry[app][listener]; ok && ep.ServesRemotePort(remotePort) {
 			return ep, true
 		}
 	}
 	return ServiceEndpoint{}, false
 }
 
-func matchesRemotePort(ep ServiceEndpoint, remotePort int) bool {
-	original := remotePort
-	remotePort = normalizeRemotePort(remotePort)
-	if remotePort <= 0 {
-		return true
+// ResolveRemoteLabel finds the listener published as <label>.<tld> that
+// serves remotePort.
+func (m *ServiceManager) ResolveRemoteLabel(label string, remotePort int) (ServiceEndpoint, bool) {
+	label = strings.ToLower(label)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, app := range m.sortedAppsLocked() {
+		for _, ep := range m.registry[app] {
+			if ep.RemoteLabel() == label && ep.ServesRemotePort(remotePort) {
+				return ep, true
+			}
+		}
+	}
+	return ServiceEndpoint{}, false
+}
+
+// SetRemoteLabelsEnforced turns the remote hostname label check on while
+// remote access is enabled and off otherwise, when labels are not
+// published. Listeners that already share a label when it is turned on
+// keep running; the app sorting first serves the hostname and the others
+// are logged.
+func (m *ServiceManager) SetRemoteLabelsEnforced(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.remoteLabels == on {
+		return
+	}
+	m.remoteLabels = on
+	if !on {
+		return
+	}
+	owners := make(map[string]ServiceEndpoint)
+	for _, app := range m.sortedAppsLocked() {
+		names := make([]string, 0, len(m.registry[app]))
+		for name := range m.registry[app] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ep := m.registry[app][name]
+			label := ep.RemoteLabel()
+			owner, taken := owners[label]
+			if !taken {
+				owners[label] = ep
+				continue
+			}
+			if owner.App != app {
+				log.Printf("WARN: remote hostname label %q of listener %s of app %s is served by listener %s of app %s; set remote_subdomain to publish it",
+					label, ep.Name, app, owner.Name, owner.App)
+			}
+		}
+	}
+}
+
+// CheckRemoteLabels reports the first listener of appName whose remote
+// hostname label another app already publishes. Labels are only checked
+// while SetRemoteLabelsEnforced is on.
+func (m *ServiceManager) CheckRemoteLabels(appName string, listeners []api.AppListener) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.remoteLabelConflictLocked(appName, listeners)
+}
+
+func (m *ServiceManager) remoteLabelConflictLocked(appName string, listeners []api.AppListener) error {
+	if !m.remoteLabels {
+		return nil
 	}
-	if len(ep.RemotePorts) == 0 {
-		return remotePort == 80 || remotePort == 443
+	for _, l := range listeners {
+		label := l.RemoteLabel()
+		if label == "" {
+			continue
+		}
+		for _, app := range m.sortedAppsLocked() {
+			if app == appName {
+				continue
+			}
+			for _, ep := range m.registry[app] {
+				if ep.RemoteLabel() == label {
+					return &RemoteHostConflictError{Label: label, App: appName, Listener: l.Name, OtherApp: app, OtherListener: ep.Name}
+				}
+			}
+		}
 	}
-	for _, rp := range ep.RemotePorts {
-		if rp == remotePort || rp == original {
+	return nil
+}
+
+// CheckPathPrefixes reports the first listener of appName whose portal
+// path overlaps one another app is served under.
+func (m *ServiceManager) CheckPathPrefixes(appName string, listeners []api.AppListener) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pathPrefixConflictLocked(appName, listeners)
+}
+
+func (m *ServiceManager) pathPrefixConflictLocked(appName string, listeners []api.AppListener) error {
+	for _, l := range listeners {
+		prefix := l.PortalPath()
+		if prefix == "" {
+			continue
+		}
+		for _, app := range m.sortedAppsLocked() {
+			if app == appName {
+				continue
+			}
+			for _, ep := range m.registry[app] {
+				if ep.PathPrefix != "" && api.PathsOverlap(ep.PathPrefix, prefix) {
+					return &PathPrefixConflictError{Prefix: prefix, App: appName, Listener: l.Name, OtherApp: app, OtherListener: ep.Name, OtherPrefix: ep.PathPrefix}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ResolvePathPrefix returns the endpoint the portal serves path from: the
+// one with the longest path prefix equal to or containing path, the app
+// sorting first winning a tie.
+func (m *ServiceManager) ResolvePathPrefix(path string) (ServiceEndpoint, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var best ServiceEndpoint
+	found := false
+	for _, app := range m.sortedAppsLocked() {
+		for _, ep := range m.registry[app] {
+			if ep.PathPrefix == "" || len(ep.PathPrefix) <= len(best.PathPrefix) {
+				continue
+			}
+			if path == ep.PathPrefix || strings.HasPrefix(path, ep.PathPrefix+"/") {
+				best, found = ep, true
+			}
+		}
+	}
+	return best, found
+}
+
+// sortedAppsLocked lists registered apps in name order. Callers hold mu.
+func (m *ServiceManager) sortedAppsLocked() []string {
+	apps := make([]string, 0, len(m.registry))
+	for app := range m.registry {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+// HasListener reports whether any app exposes a listener with this name.
+func (m *ServiceManager) HasListener(listener string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, mapp := range m.registry {
+		if _, ok := mapp[listener]; ok {
 			return true
 		}
 	}
 	return false
 }
 
+// HasRemoteLabel reports whether any app publishes a listener as
+// <label>.<tld>.
+func (m *ServiceManager) HasRemoteLabel(label string) bool {
+	label = strings.ToLower(label)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, mapp := range m.registry {
+		for _, ep := range mapp {
+			if ep.RemoteLabel() == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PassthroughRemotePorts maps each remote port requested by a raw tcp/udp
+// listener to the endpoint serving it.
+func (m *ServiceManager) PassthroughRemotePorts() map[int]ServiceEndpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[int]ServiceEndpoint)
+	for _, mapp := range m.registry {
+		for _, ep := range mapp {
+			if !ep.Protocol.Passthrough() {
+				continue
+			}
+			for _, rp := range ep.RemotePorts {
+				out[rp] = ep
+			}
+		}
+	}
+	return out
+}
+
 // StopAll stops all proxy listeners
 func (m *ServiceManager) StopAll() {
 	m.proxyManager.StopAll()
@@ -481,8 +870,16 @@ func (m *ServiceManager) checkBackends() {
 	ids := m.snapshotContainerIDs()
 
 	// TCP connectivity check per endpoint
-	for _, mapp := range snap {
+	for app, mapp := range snap {
+		if m.proxyManager.appPaused(app) {
+			// A frozen backend is expected not to answer.
+			continue
+		}
 		for _, ep := range mapp {
+			if ep.Protocol == api.ListenerProtocolUDP {
+				// Connectionless; a dial would always succeed.
+				continue
+			}
 			addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.HostBind))
 			conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
 			if err != nil {
@@ -578,6 +975,87 @@ func (m *ServiceManager) SetAppContainerID(appName, containerID string) {
 	m.mu.Unlock()
 }
 
+// SetAppPaused keeps a paused app's endpoints allocated while its proxies
+// refuse traffic; unpausing serves them again as they were.
+func (m *ServiceManager) SetAppPaused(appName string, paused bool) {
+	m.proxyManager.SetAppPaused(appName, paused)
+}
+
+// ReserveReplacementBinds reserves a fresh host bind for each guest port of
+// appName, for a replacement container to publish while the current one
+// keeps serving on its own. The result maps guest port to host bind.
+func (m *ServiceManager) ReserveReplacementBinds(appName string) (map[int]int, error) {
+	defer m.probe.flush(context.Background())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	binds := make(map[int]int)
+	for _, ep := range m.registry[appName] {
+		if _, ok := binds[ep.GuestPort]; ok {
+			continue
+		}
+		hostCheck, _ := m.probe.checks(api.AppListener{Protocol: ep.Protocol})
+		hb, err := m.allocator.allocateHost(hostCheck)
+		if err != nil {
+			for _, port := range binds {
+				m.allocator.ReleaseHost(port)
+			}
+			return nil, err
+		}
+		binds[ep.GuestPort] = hb
+	}
+	return binds, nil
+}
+
+// ReleaseHostBinds returns host binds to the allocator.
+func (m *ServiceManager) ReleaseHostBinds(ports []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, port := range ports {
+		m.allocator.ReleaseHost(port)
+	}
+}
+
+// RetargetApp points every endpoint of appName at the host bind hostByGuest
+// holds for its guest port and returns the binds it replaced. Public
+// listeners stay bound throughout; the replaced binds stay reserved until
+// ReleaseHostBinds.
+func (m *ServiceManager) RetargetApp(appName string, hostByGuest map[int]int) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	eps := m.registry[appName]
+	for _, ep := range eps {
+		if _, ok := hostByGuest[ep.GuestPort]; !ok {
+			return nil, fmt.Errorf("no host bind for %s/%s (guest port %d)", appName, ep.Name, ep.GuestPort)
+		}
+	}
+	var previous []int
+	seen := make(map[int]bool)
+	for name, ep := range eps {
+		if !seen[ep.HostBind] {
+			seen[ep.HostBind] = true
+			previous = append(previous, ep.HostBind)
+		}
+		ep.HostBind = hostByGuest[ep.GuestPort]
+		eps[name] = ep
+		m.proxyManager.RetargetBackend(ep.PublicPort, ep.HostBind)
+	}
+	if len(eps) > 0 {
+		m.registryChangedLocked()
+	}
+	sort.Ints(previous)
+	return previous, nil
+}
+
+// ActiveBackendConnections counts the proxied connections and requests in
+// flight to the given host binds.
+func (m *ServiceManager) ActiveBackendConnections(ports []int) int {
+	total := 0
+	for _, port := range ports {
+		total += m.proxyManager.ActiveBackendConnections(port)
+	}
+	return total
+}
+
 // GetAppContainerID returns the container ID for an app if known
 func (m *ServiceManager) GetAppContainerID(appName string) (string, bool) {
 	m.mu.RLock()
@@ -597,8 +1075,32 @@ type ReconcileResult struct {
 
 // Reconcile synchronizes listeners for an app in-place. Returns final endpoints and whether container changes are required.
 func (m *ServiceManager) Reconcile(appName string, listeners []api.AppListener) (ReconcileResult, bool, error) {
+	defer m.probe.flush(context.Background())
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.reconcileLocked(appName, listeners, false)
+}
+
+// PlanReconcile reports what Reconcile would do with listeners without doing
+// it: no ports stay reserved and no proxy is started or stopped. Added
+// listeners carry the ports allocation would pick now, unprobed; the real
+// Reconcile may pick others.
+func (m *ServiceManager) PlanReconcile(appName string, listeners []api.AppListener) (ReconcileResult, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reconcileLocked(appName, listeners, true)
+}
+
+func (m *ServiceManager) reconcileLocked(appName string, listeners []api.AppListener, dryRun bool) (ReconcileResult, bool, error) {
+	if err := m.remoteLabelConflictLocked(appName, listeners); err != nil {
+		return ReconcileResult{}, false, err
+	}
+	if err := m.pathPrefixConflictLocked(appName, listeners); err != nil {
+		return ReconcileResult{}, false, err
+	}
+	if dryRun {
+		defer m.allocator.mark()()
+	}
 
 	existing := m.registry[appName]
 	if existing == nil {
@@ -620,70 +1122,103 @@ func (m *ServiceManager) Reconcile(appName string, listeners []api.AppListener)
 				result.GuestPortChanged = append(result.GuestPortChanged, struct{ Old, New ServiceEndpoint }{
 					Old: ep,
 					New: ServiceEndpoint{
-						App:         appName,
-						Name:        l.Name,
-						GuestPort:   l.GuestPort,
-						HostBind:    ep.HostBind,
-						PublicPort:  ep.PublicPort,
-						Flow:        l.Flow,
-						Protocol:    l.Protocol,
-						Middleware:  l.Middleware,
-						RemotePorts: defaultRemotePorts(l),
+						App:             appName,
+						Name:            l.Name,
+						GuestPort:       l.GuestPort,
+						HostBind:        ep.HostBind,
+						PublicPort:      ep.PublicPort,
+						Flow:            l.Flow,
+						Protocol:        l.Protocol,
+						Middleware:      l.Middleware,
+						RemotePorts:     defaultRemotePorts(l),
+						RemoteSubdomain: l.RemoteSubdomain,
+						InternalHost:    !l.PreservesHost(),
+						BackendTLS:      l.BackendTLS,
+						Limits:          listenerLimits(l),
+						PathPrefix:      l.PortalPath(),
+						StripPrefix:     l.StripsPrefix(),
+						PublicPath:      l.Public,
 					},
 				})
 			}
 			ep.GuestPort = l.GuestPort
 			// Only restart proxy if proxy-related fields changed
-			proxyChanged := ep.Flow != l.Flow || ep.Protocol != l.Protocol || !middlewareEqual(ep.Middleware, l.Middleware)
+			proxyChanged := ep.Flow != l.Flow || ep.Protocol != l.Protocol || !middlewareEqual(ep.Middleware, l.Middleware) || ep.InternalHost != !l.PreservesHost() || !backendTLSEqual(ep.BackendTLS, l.BackendTLS) || ep.Limits != listenerLimits(l)
 			ep.Flow = l.Flow
 			ep.Protocol = l.Protocol
 			ep.Middleware = l.Middleware
 			ep.RemotePorts = defaultRemotePorts(l)
+			ep.RemoteSubdomain = l.RemoteSubdomain
+			ep.InternalHost = !l.PreservesHost()
+			ep.BackendTLS = l.BackendTLS
+			ep.Limits = listenerLimits(l)
+			ep.PathPrefix = l.PortalPath()
+			ep.StripPrefix = l.StripsPrefix()
+			ep.PublicPath = l.Public
 			newMap[l.Name] = ep
 			if proxyChanged {
-				m.proxyManager.StopPort(ep.PublicPort)
-				m.proxyManager.StartListener(ep)
+				if !dryRun {
+					m.proxyManager.StopPort(ep.PublicPort)
+					m.proxyManager.StartListener(ep)
+					m.notifyPublish(ep.PublicPort)
+				}
 				result.ProxyOnlyChanged = append(result.ProxyOnlyChanged, ep)
-				m.notifyPublish(ep.PublicPort)
 			}
 		} else {
 			// New listener: allocate ports, start proxy, mark container change
-			hb, pp, err := m.allocator.AllocatePair()
+			var hostCheck, publicCheck portCheck
+			if !dryRun {
+				hostCheck, publicCheck = m.probe.checks(l)
+			}
+			hb, pp, err := m.allocator.allocatePairChecked(hostCheck, publicCheck)
 			if err != nil {
 				return ReconcileResult{}, false, err
 			}
 			ep := ServiceEndpoint{
-				App:         appName,
-				Name:        l.Name,
-				GuestPort:   l.GuestPort,
-				HostBind:    hb,
-				PublicPort:  pp,
-				Flow:        l.Flow,
-				Protocol:    l.Protocol,
-				Middleware:  l.Middleware,
-				RemotePorts: defaultRemotePorts(l),
+				App:             appName,
+				Name:            l.Name,
+				GuestPort:       l.GuestPort,
+				HostBind:        hb,
+				PublicPort:      pp,
+				Flow:            l.Flow,
+				Protocol:        l.Protocol,
+				Middleware:      l.Middleware,
+				RemotePorts:     defaultRemotePorts(l),
+				RemoteSubdomain: l.RemoteSubdomain,
+				InternalHost:    !l.PreservesHost(),
+				BackendTLS:      l.BackendTLS,
+				Limits:          listenerLimits(l),
+				PathPrefix:      l.PortalPath(),
+				StripPrefix:     l.StripsPrefix(),
+				PublicPath:      l.Public,
 			}
 			newMap[l.Name] = ep
-			m.proxyManager.StartListener(ep)
-			m.notifyPublish(ep.PublicPort)
+			if !dryRun {
+				m.proxyManager.StartListener(ep)
+				m.notifyPublish(ep.PublicPort)
+			}
 			containerChange = true
 			result.Added = append(result.Added, ep)
-			m.notifyPublish(ep.PublicPort)
 		}
 	}
 
 	// Removed listeners
 	for name, ep := range existing {
 		if _, ok := newMap[name]; !ok {
-			m.proxyManager.StopPort(ep.PublicPort)
+			if !dryRun {
+				m.proxyManager.StopPort(ep.PublicPort)
+				m.notifyUnpublish(ep.PublicPort)
+			}
 			containerChange = true
 			result.Removed = append(result.Removed, ep)
-			m.notifyUnpublish(ep.PublicPort)
 		}
 	}
 
 	// Save
-	m.registry[appName] = newMap
+	if !dryRun {
+		m.registry[appName] = newMap
+		m.registryChangedLocked()
+	}
 
 	// Return endpoints slice
 	var eps []ServiceEndpoint
@@ -707,6 +1242,20 @@ func middlewareEqual(a, b []api.AppProtocolMiddleware) bool {
 	return true
 }
 
+// listenerLimits reads a listener's own connection limits. The definition
+// has been validated, so a bad idle timeout does not occur here.
+func listenerLimits(l api.AppListener) ConnectionLimits {
+	idle, _ := l.IdleTimeoutDuration()
+	return ConnectionLimits{MaxConnections: l.MaxConnections, MaxConnectionsPerIP: l.MaxConnectionsPerIP, IdleTimeout: idle}
+}
+
+func backendTLSEqual(a, b *api.ListenerBackendTLS) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // RemoveApp stops and removes all listeners for an app
 func (m *ServiceManager) RemoveApp(appName string) {
 	m.mu.Lock()
@@ -718,6 +1267,8 @@ func (m *ServiceManager) RemoveApp(appName string) {
 			m.notifyUnpublish(ep.PublicPort)
 		}
 		delete(m.registry, appName)
+		m.registryChangedLocked()
 	}
 	delete(m.containerIDs, appName)
+	m.proxyManager.SetAppPaused(appName, false)
 }
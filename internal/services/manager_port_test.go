@@ -1,6 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 
 	"piccolod/internal/api"
@@ -32,3 +40,270 @@ func TestReserveHostPortPreventsReallocation(t *testing.T) {
 		t.Fatalf("expected allocator to skip reserved port %d, got %d", host, eps2[0].HostBind)
 	}
 }
+
+func TestReserveForAppReleasesPartialAllocation(t *testing.T) {
+	manager := NewServiceManager()
+	manager.allocator = NewPortAllocator(PortRange{Start: 15000, End: 15000}, PortRange{Start: 35000, End: 35000})
+
+	if _, err := manager.ReserveForApp("app", []api.AppListener{
+		{Name: "http", GuestPort: 80},
+		{Name: "admin", GuestPort: 8080},
+	}); err == nil {
+		t.Fatalf("expected allocation to run out of ports")
+	}
+	if eps := manager.GetAll(); len(eps) != 0 {
+		t.Fatalf("failed reservation left endpoints: %+v", eps)
+	}
+	eps, err := manager.ReserveForApp("app2", []api.AppListener{{Name: "http", GuestPort: 80}})
+	if err != nil {
+		t.Fatalf("ports of the failed reservation were not released: %v", err)
+	}
+	if eps[0].HostBind != 15000 || eps[0].PublicPort != 35000 {
+		t.Fatalf("unexpected endpoint %+v", eps[0])
+	}
+}
+
+func TestPublishAppMovesOffTakenPublicPort(t *testing.T) {
+	manager := NewServiceManager()
+	defer manager.StopAll()
+	// Find two adjacent free ports and hold the first one.
+	var held net.Listener
+	var public int
+	for i := 0; i < 20 && held == nil; i++ {
+		public = getFreePort(t)
+		ln, err := net.Listen("tcp", net.JoinHostPort("0.0.0.0", strconv.Itoa(public)))
+		if err != nil {
+			continue
+		}
+		probe, err := net.Listen("tcp", net.JoinHostPort("0.0.0.0", strconv.Itoa(public+1)))
+		if err != nil {
+			ln.Close()
+			continue
+		}
+		probe.Close()
+		held = ln
+	}
+	if held == nil {
+		t.Skip("no adjacent free ports")
+	}
+	defer held.Close()
+	hb := getFreePort(t)
+	manager.allocator = NewPortAllocator(PortRange{Start: hb, End: hb}, PortRange{Start: public, End: public + 1})
+
+	if _, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw}}); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := manager.PublishApp("app"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	eps := manager.GetAll()
+	if len(eps) != 1 || eps[0].PublicPort != public+1 {
+		t.Fatalf("endpoint not moved off taken port %d: %+v", public, eps)
+	}
+
+	// With the range used up, the failure is reported.
+	held2, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer held2.Close()
+	taken := held2.Addr().(*net.TCPAddr).Port
+	other := NewServiceManager()
+	defer other.StopAll()
+	other.allocator = NewPortAllocator(PortRange{Start: hb, End: hb}, PortRange{Start: taken, End: taken})
+	if _, err := other.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}}); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := other.PublishApp("app"); err == nil {
+		t.Fatalf("expected publish to fail when no public port can be bound")
+	}
+}
+
+func TestPortPolicyConfinesAllocation(t *testing.T) {
+	manager := NewServiceManager()
+	if err := manager.SetPortPolicy(PortPolicy{HostBind: PortRange{Start: 15000, End: 15010}}); err == nil {
+		t.Fatalf("expected a range below the minimum size to be refused")
+	}
+	if err := manager.SetPortPolicy(PortPolicy{
+		HostBind: PortRange{Start: 20000, End: 20099},
+		Public:   PortRange{Start: 20050, End: 20149},
+	}); err == nil {
+		t.Fatalf("expected overlapping ranges to be refused")
+	}
+	if err := manager.SetPortPolicy(PortPolicy{
+		HostBind: PortRange{Start: 20000, End: 20099},
+		Public:   PortRange{Start: 30000, End: 30099},
+		Excluded: []int{30000, 20000, 20000},
+	}); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	if got := manager.PortPolicy().Excluded; len(got) != 2 || got[0] != 20000 || got[1] != 30000 {
+		t.Fatalf("excluded ports not normalized: %v", got)
+	}
+
+	eps, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}, {Name: "admin", GuestPort: 8080}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	for _, ep := range eps {
+		if ep.HostBind <= 20000 || ep.HostBind > 20099 || ep.PublicPort <= 30000 || ep.PublicPort > 30099 {
+			t.Fatalf("endpoint allocated outside the policy: %+v", ep)
+		}
+	}
+}
+
+func TestCheckPortPolicyRejectsOrphanedPorts(t *testing.T) {
+	manager := NewServiceManager()
+	eps, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	moved := PortPolicy{HostBind: PortRange{Start: 50000, End: 50999}, Public: PortRange{Start: 35000, End: 45000}}
+	err = manager.CheckPortPolicy(moved)
+	var inUse *PortsInUseError
+	if !errors.As(err, &inUse) || len(inUse.Endpoints) != 1 || inUse.Endpoints[0].Name != "http" {
+		t.Fatalf("expected the allocated endpoint to block the change, got %v", err)
+	}
+	excluding := DefaultPortPolicy()
+	excluding.Excluded = []int{eps[0].PublicPort}
+	if err := manager.CheckPortPolicy(excluding); !errors.As(err, &inUse) {
+		t.Fatalf("expected excluding an allocated port to be refused, got %v", err)
+	}
+
+	// Applied regardless, as when a stored policy loads after restore, the
+	// endpoint keeps its port and is reported outside the policy.
+	if err := manager.SetPortPolicy(moved); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	if got := manager.GetAll()[0]; got.HostBind != eps[0].HostBind || !manager.PortPolicy().OutsidePolicy(got) {
+		t.Fatalf("expected endpoint kept and flagged, got %+v", got)
+	}
+	manager.RemoveApp("app")
+	if err := manager.CheckPortPolicy(moved); err != nil {
+		t.Fatalf("policy still blocked after the app was removed: %v", err)
+	}
+}
+
+// holdPortRun binds n consecutive ports on host for the rest of the test and
+// returns the first.
+func holdPortRun(t *testing.T, host string, n int) int {
+	t.Helper()
+	for attempt := 0; attempt < 20; attempt++ {
+		base := getFreePort(t)
+		var held []net.Listener
+		for i := 0; i < n; i++ {
+			ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(base+i)))
+			if err != nil {
+				break
+			}
+			held = append(held, ln)
+		}
+		if len(held) == n {
+			t.Cleanup(func() {
+				for _, ln := range held {
+					ln.Close()
+				}
+			})
+			return base
+		}
+		for _, ln := range held {
+			ln.Close()
+		}
+	}
+	t.Skip("no run of free ports")
+	return 0
+}
+
+type memoryOccupiedStore struct {
+	mu    sync.Mutex
+	saved []OccupiedPort
+}
+
+func (s *memoryOccupiedStore) SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append([]OccupiedPort(nil), ports...)
+	return nil
+}
+
+func TestReserveForAppSkipsPortsBoundOutsidePiccolo(t *testing.T) {
+	hostBase := holdPortRun(t, "127.0.0.1", 2)
+	publicBase := holdPortRun(t, "0.0.0.0", 2)
+	manager := NewServiceManager()
+	manager.SetPortProbe(true)
+	store := &memoryOccupiedStore{}
+	manager.SetOccupiedPortStore(store)
+	manager.allocator = NewPortAllocator(PortRange{Start: hostBase, End: hostBase + 10}, PortRange{Start: publicBase, End: publicBase + 10})
+
+	eps, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if eps[0].HostBind < hostBase+2 || eps[0].PublicPort < publicBase+2 {
+		t.Fatalf("allocation did not skip bound ports: %+v", eps[0])
+	}
+	want := map[int]string{hostBase: PortRangeHostBind, hostBase + 1: PortRangeHostBind, publicBase: PortRangePublic, publicBase + 1: PortRangePublic}
+	got := manager.OccupiedPorts()
+	for _, rec := range got {
+		if want[rec.Port] == rec.Range && rec.Network == "tcp" && !rec.FirstSeen.IsZero() {
+			delete(want, rec.Port)
+		}
+	}
+	if len(want) != 0 {
+		t.Fatalf("bound ports not recorded: missing %v in %+v", want, got)
+	}
+	store.mu.Lock()
+	saved := len(store.saved)
+	store.mu.Unlock()
+	if saved != len(got) {
+		t.Fatalf("saved %d occupied ports, want %d", saved, len(got))
+	}
+}
+
+func TestPortProbeTurnsItselfOffWhenBindingIsRefused(t *testing.T) {
+	manager := NewServiceManager()
+	manager.SetPortProbe(true)
+	probes := 0
+	manager.probe.listen = func(network, addr string) error {
+		probes++
+		return &net.OpError{Op: "listen", Net: network, Err: os.NewSyscallError("bind", syscall.EACCES)}
+	}
+	manager.allocator = NewPortAllocator(PortRange{Start: 15000, End: 15010}, PortRange{Start: 35000, End: 35010})
+
+	eps, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}, {Name: "admin", GuestPort: 8080}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if eps[0].HostBind != 15000 || eps[0].PublicPort != 35000 {
+		t.Fatalf("refused probe should not skip ports: %+v", eps[0])
+	}
+	if probes != 1 {
+		t.Fatalf("probed %d times after the first refusal, want 1", probes)
+	}
+	st := manager.PortProbe()
+	if st.Enabled || !strings.Contains(st.DisabledReason, "permission denied") {
+		t.Fatalf("probe status = %+v", st)
+	}
+	if len(manager.OccupiedPorts()) != 0 {
+		t.Fatalf("refused probes recorded occupied ports: %+v", manager.OccupiedPorts())
+	}
+}
+
+func TestPortProbeGivesUpAfterItsBudget(t *testing.T) {
+	manager := NewServiceManager()
+	manager.SetPortProbe(true)
+	probes := 0
+	manager.probe.listen = func(network, addr string) error {
+		probes++
+		return &net.OpError{Op: "listen", Net: network, Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}
+	}
+	manager.allocator = NewPortAllocator(PortRange{Start: 15000, End: 15999}, PortRange{Start: 35000, End: 35999})
+
+	eps, err := manager.ReserveForApp("app", []api.AppListener{{Name: "http", GuestPort: 80}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if probes != maxPortProbes || eps[0].HostBind != 15000+maxPortProbes || eps[0].PublicPort != 35000 {
+		t.Fatalf("probes = %d, endpoint %+v", probes, eps[0])
+	}
+}
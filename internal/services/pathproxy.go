@@ -0,0 +1,139 @@
+package services
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ServePath proxies a portal request under ep's path prefix to the app's
+// backend. secure tells the backend the portal was reached over TLS.
+// Redirects and cookies of a backend that sees stripped paths are moved
+// under the prefix so the browser stays on it.
+func (p *ProxyManager) ServePath(w http.ResponseWriter, r *http.Request, ep ServiceEndpoint, secure bool) {
+	p.mu.Lock()
+	trusted := p.trusted
+	p.mu.Unlock()
+	dropUntrustedForwardHeaders(r, trusted)
+	if secure {
+		ensureHeader(r, "X-Forwarded-Proto", "https")
+	}
+	applyForwardHeaders(r, ep)
+	if p.appPaused(ep.App) {
+		w.Header().Set("Retry-After", pausedRetryAfter)
+		http.Error(w, "app is paused", http.StatusServiceUnavailable)
+		return
+	}
+	port, release := p.acquireBackend(ep.PublicPort, ep.HostBind)
+	defer release()
+	backend := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: backend})
+			for _, h := range forwardHeaderNames {
+				if v := pr.In.Header.Values(h); len(v) > 0 {
+					pr.Out.Header[h] = v
+				}
+			}
+			pr.Out.Header.Set("X-Forwarded-Prefix", ep.PathPrefix)
+			if ep.StripPrefix {
+				pr.Out.URL.Path = stripPathPrefix(pr.In.URL.Path, ep.PathPrefix)
+				if pr.In.URL.RawPath != "" && strings.HasPrefix(pr.In.URL.RawPath, ep.PathPrefix) {
+					pr.Out.URL.RawPath = stripPathPrefix(pr.In.URL.RawPath, ep.PathPrefix)
+				} else {
+					pr.Out.URL.RawPath = ""
+				}
+			}
+			if !ep.InternalHost {
+				pr.Out.Host = pr.In.Host
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if !ep.StripPrefix {
+				return nil
+			}
+			if loc := resp.Header.Get("Location"); loc != "" {
+				resp.Header.Set("Location", prefixLocation(loc, ep.PathPrefix, backend, r.Host))
+			}
+			if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+				resp.Header.Del("Set-Cookie")
+				for _, c := range cookies {
+					resp.Header.Add("Set-Cookie", prefixCookiePath(c, ep.PathPrefix))
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("WARN: portal path %s → %s (app=%s listener=%s): %v", ep.PathPrefix, backend, ep.App, ep.Name, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// stripPathPrefix removes prefix from path, leaving at least "/".
+func stripPathPrefix(path, prefix string) string {
+	rest := strings.TrimPrefix(path, prefix)
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+	return rest
+}
+
+// prefixLocation moves a redirect of a backend that sees stripped paths
+// under prefix. Absolute URLs naming the backend or the portal become
+// paths; other hosts and relative references are left alone, as are paths
+// already under the prefix.
+func prefixLocation(loc, prefix, backend, host string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if u.Host != "" {
+		if !strings.EqualFold(u.Host, backend) && !strings.EqualFold(u.Host, host) {
+			return loc
+		}
+		u.Scheme, u.Host, u.User = "", "", nil
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return u.String()
+	}
+	if u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+		return u.String()
+	}
+	u.Path = prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = prefix + u.RawPath
+	}
+	return u.String()
+}
+
+// prefixCookiePath moves a cookie's Path under prefix and drops its Domain,
+// since the app is served from the portal's host. Cookies without a Path
+// already default to the prefixed request path.
+func prefixCookiePath(cookie, prefix string) string {
+	parts := strings.Split(cookie, ";")
+	out := []string{parts[0]}
+	for _, attr := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		switch strings.ToLower(name) {
+		case "domain":
+			continue
+		case "path":
+			value = strings.TrimSpace(value)
+			switch {
+			case value == "/":
+				value = prefix
+			case strings.HasPrefix(value, "/") && value != prefix && !strings.HasPrefix(value, prefix+"/"):
+				value = prefix + value
+			}
+			attr = " Path=" + value
+		}
+		out = append(out, attr)
+	}
+	return strings.Join(out, ";")
+}
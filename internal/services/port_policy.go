@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MinPortRangeSize is the smallest allocatable range a PortPolicy accepts,
+// so that a handful of apps cannot exhaust it.
+const MinPortRangeSize = 100
+
+// PortPolicy says where the allocator hands out ports. HostBind ports
+// carry loopback traffic into containers; Public ports are the proxies on
+// every interface. Excluded ports are skipped in both ranges, for ports
+// other software on the host owns.
+type PortPolicy struct {
+	HostBind PortRange
+	Public   PortRange
+	Excluded []int
+}
+
+// DefaultPortPolicy is the policy in effect until one is configured.
+func DefaultPortPolicy() PortPolicy {
+	return PortPolicy{
+		HostBind: PortRange{Start: 15000, End: 25000},
+		Public:   PortRange{Start: 35000, End: 45000},
+		Excluded: []int{},
+	}
+}
+
+// Normalize validates the policy and returns it with Excluded sorted and
+// deduplicated.
+func (p PortPolicy) Normalize() (PortPolicy, error) {
+	for _, r := range []struct {
+		name  string
+		ports PortRange
+	}{{"host_bind", p.HostBind}, {"public", p.Public}} {
+		if r.ports.Start < 1024 || r.ports.End > 65535 || r.ports.Start > r.ports.End {
+			return PortPolicy{}, fmt.Errorf("%s range %d-%d must lie within 1024-65535", r.name, r.ports.Start, r.ports.End)
+		}
+		if size := r.ports.End - r.ports.Start + 1; size < MinPortRangeSize {
+			return PortPolicy{}, fmt.Errorf("%s range %d-%d holds %d ports; at least %d are required", r.name, r.ports.Start, r.ports.End, size, MinPortRangeSize)
+		}
+	}
+	if p.HostBind.Start <= p.Public.End && p.Public.Start <= p.HostBind.End {
+		return PortPolicy{}, fmt.Errorf("host_bind range %d-%d overlaps public range %d-%d", p.HostBind.Start, p.HostBind.End, p.Public.Start, p.Public.End)
+	}
+	out := PortPolicy{HostBind: p.HostBind, Public: p.Public, Excluded: []int{}}
+	seen := make(map[int]bool, len(p.Excluded))
+	for _, port := range p.Excluded {
+		if port < 1 || port > 65535 {
+			return PortPolicy{}, fmt.Errorf("excluded port %d out of range", port)
+		}
+		if !seen[port] {
+			seen[port] = true
+			out.Excluded = append(out.Excluded, port)
+		}
+	}
+	sort.Ints(out.Excluded)
+	return out, nil
+}
+
+func (p PortPolicy) excludes(port int) bool {
+	for _, e := range p.Excluded {
+		if e == port {
+			return true
+		}
+	}
+	return false
+}
+
+// OutsidePolicy reports whether ep holds a host-bind or public port the
+// policy would no longer hand out.
+func (p PortPolicy) OutsidePolicy(ep ServiceEndpoint) bool {
+	inRange := func(port int, r PortRange) bool { return port >= r.Start && port <= r.End }
+	return !inRange(ep.HostBind, p.HostBind) || !inRange(ep.PublicPort, p.Public) ||
+		p.excludes(ep.HostBind) || p.excludes(ep.PublicPort)
+}
+
+// PortsInUseError reports endpoints whose ports a new policy would orphan.
+type PortsInUseError struct {
+	Endpoints []ServiceEndpoint
+}
+
+func (e *PortsInUseError) Error() string {
+	names := make([]string, 0, len(e.Endpoints))
+	for _, ep := range e.Endpoints {
+		names = append(names, fmt.Sprintf("%s/%s (host %d, public %d)", ep.App, ep.Name, ep.HostBind, ep.PublicPort))
+	}
+	return "port policy would orphan ports in use by " + strings.Join(names, ", ")
+}
+
+// PortPolicy returns the policy the allocator follows.
+func (m *ServiceManager) PortPolicy() PortPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.portPolicy
+}
+
+// CheckPortPolicy validates p and fails with a *PortsInUseError when an
+// allocated endpoint holds a port p would no longer hand out.
+func (m *ServiceManager) CheckPortPolicy(p PortPolicy) error {
+	p, err := p.Normalize()
+	if err != nil {
+		return err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var orphaned []ServiceEndpoint
+	for _, app := range m.sortedAppsLocked() {
+		eps := make([]ServiceEndpoint, 0, len(m.registry[app]))
+		for _, ep := range m.registry[app] {
+			if p.OutsidePolicy(ep) {
+				eps = append(eps, ep)
+			}
+		}
+		sort.Slice(eps, func(i, j int) bool { return eps[i].Name < eps[j].Name })
+		orphaned = append(orphaned, eps...)
+	}
+	if len(orphaned) > 0 {
+		return &PortsInUseError{Endpoints: orphaned}
+	}
+	return nil
+}
+
+// SetPortPolicy makes the allocator follow p from its next allocation on.
+// Endpoints already holding ports outside p keep them; CheckPortPolicy is
+// the guard for interactive changes.
+func (m *ServiceManager) SetPortPolicy(p PortPolicy) error {
+	p, err := p.Normalize()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.portPolicy = p
+	m.allocator.setRanges(p.HostBind, p.Public, p.Excluded)
+	// Views derived from the registry flag out-of-policy endpoints.
+	m.registryChangedLocked()
+	return nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+// PortProbeEnv turns the allocation bind probe off when set to 0, false or
+// off, for hosts where test-binding ports is unwelcome.
+const PortProbeEnv = "PICCOLO_PORT_PROBE"
+
+const (
+	// maxPortProbes bounds the bind probes one listener's allocation makes.
+	// Past it candidates are handed out unprobed and the install retry on
+	// port conflicts takes over.
+	maxPortProbes = 32
+	// maxOccupiedPorts bounds the occupied ports remembered; the ones seen
+	// longest ago are dropped first.
+	maxOccupiedPorts = 256
+)
+
+// Ranges an occupied port was found in.
+const (
+	PortRangeHostBind = "host_bind"
+	PortRangePublic   = "public"
+)
+
+// OccupiedPort is a port the allocator skipped because a process outside
+// Piccolo had it bound when probed.
+type OccupiedPort struct {
+	Port      int       `json:"port"`
+	Network   string    `json:"network"`
+	Range     string    `json:"range"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// OccupiedPortStore persists the occupied ports the probe records.
+type OccupiedPortStore interface {
+	SaveOccupiedPorts(ctx context.Context, ports []OccupiedPort) error
+}
+
+// ErrOccupiedPortStoreUnavailable may be returned by OccupiedPortStore
+// implementations while the backing store is locked; the records are saved
+// with the next change.
+var ErrOccupiedPortStoreUnavailable = errors.New("services: occupied port store unavailable")
+
+// PortProbeStatus says whether allocation probes ports, and why not.
+type PortProbeStatus struct {
+	Enabled        bool   `json:"enabled"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+}
+
+type occupiedKey struct {
+	port    int
+	network string
+}
+
+// portProbe test-binds candidate ports before the allocator hands them out
+// and remembers the ones found taken. Its own mutex guards it: allocation
+// runs under the manager lock, readers do not.
+type portProbe struct {
+	mu       sync.Mutex
+	enabled  bool
+	reason   string
+	listen   func(network, addr string) error
+	now      func() time.Time
+	occupied map[occupiedKey]OccupiedPort
+	dirty    bool
+	store    OccupiedPortStore
+	// saveMu serializes saves so an older list never lands last.
+	saveMu sync.Mutex
+}
+
+func newPortProbe() *portProbe {
+	p := &portProbe{
+		enabled:  true,
+		listen:   bindProbe,
+		now:      time.Now,
+		occupied: make(map[occupiedKey]OccupiedPort),
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(PortProbeEnv))) {
+	case "0", "false", "off":
+		p.enabled = false
+		p.reason = "disabled by " + PortProbeEnv
+	}
+	return p
+}
+
+// bindProbe binds addr on network and lets go of it at once.
+func bindProbe(network, addr string) error {
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ln.Close()
+}
+
+// checks returns the host-bind and public checks for allocating listener l,
+// sharing one probe budget. Host-bind ports are probed on loopback, where
+// Podman publishes them; public ports on every interface.
+func (p *portProbe) checks(l api.AppListener) (portCheck, portCheck) {
+	network := "tcp"
+	if l.Protocol == api.ListenerProtocolUDP {
+		network = "udp"
+	}
+	budget := maxPortProbes
+	check := func(host, rangeName string) portCheck {
+		return func(port int) bool {
+			if budget <= 0 {
+				return true
+			}
+			budget--
+			return p.free(network, host, rangeName, port)
+		}
+	}
+	return check("127.0.0.1", PortRangeHostBind), check("0.0.0.0", PortRangePublic)
+}
+
+// free probes one port. A probe failing for any reason other than the port
+// being bound turns probing off: the host does not let us test-bind, and
+// guessing would only skip good ports.
+func (p *portProbe) free(network, host, rangeName string, port int) bool {
+	p.mu.Lock()
+	enabled := p.enabled
+	p.mu.Unlock()
+	if !enabled {
+		return true
+	}
+	err := p.listen(network, net.JoinHostPort(host, strconv.Itoa(port)))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := occupiedKey{port: port, network: network}
+	switch {
+	case err == nil:
+		if _, ok := p.occupied[key]; ok {
+			delete(p.occupied, key)
+			p.dirty = true
+		}
+		return true
+	case errors.Is(err, syscall.EADDRINUSE):
+		now := p.now().UTC()
+		rec, ok := p.occupied[key]
+		if !ok {
+			rec = OccupiedPort{Port: port, Network: network, Range: rangeName, FirstSeen: now}
+			log.Printf("INFO: %s port %d/%s is bound outside Piccolo; skipping it", rangeName, port, network)
+		}
+		rec.LastSeen = now
+		p.occupied[key] = rec
+		p.trimLocked()
+		p.dirty = true
+		return false
+	default:
+		if p.enabled {
+			p.enabled = false
+			p.reason = fmt.Sprintf("probe of %s port %d/%s failed: %v", rangeName, port, network, err)
+			log.Printf("WARN: port probe disabled: %s", p.reason)
+		}
+		return true
+	}
+}
+
+func (p *portProbe) trimLocked() {
+	if len(p.occupied) <= maxOccupiedPorts {
+		return
+	}
+	recs := p.listLocked()
+	sort.Slice(recs, func(i, j int) bool { return recs[i].LastSeen.After(recs[j].LastSeen) })
+	for _, rec := range recs[maxOccupiedPorts:] {
+		delete(p.occupied, occupiedKey{port: rec.Port, network: rec.Network})
+	}
+}
+
+func (p *portProbe) listLocked() []OccupiedPort {
+	out := make([]OccupiedPort, 0, len(p.occupied))
+	for _, rec := range p.occupied {
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Port != out[j].Port {
+			return out[i].Port < out[j].Port
+		}
+		return out[i].Network < out[j].Network
+	})
+	return out
+}
+
+// flush saves the occupied ports when they changed since the last save.
+func (p *portProbe) flush(ctx context.Context) {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	p.mu.Lock()
+	if !p.dirty || p.store == nil {
+		p.mu.Unlock()
+		return
+	}
+	store, recs := p.store, p.listLocked()
+	p.dirty = false
+	p.mu.Unlock()
+	if err := store.SaveOccupiedPorts(ctx, recs); err != nil {
+		p.mu.Lock()
+		p.dirty = true
+		p.mu.Unlock()
+		if !errors.Is(err, ErrOccupiedPortStoreUnavailable) {
+			log.Printf("WARN: saving occupied ports failed: %v", err)
+		}
+	}
+}
+
+// SetPortProbe turns the allocation bind probe on or off. Turning it on
+// clears the reason it was turned off.
+func (m *ServiceManager) SetPortProbe(enabled bool) {
+	m.probe.mu.Lock()
+	defer m.probe.mu.Unlock()
+	m.probe.enabled = enabled
+	m.probe.reason = ""
+	if !enabled {
+		m.probe.reason = "disabled by configuration"
+	}
+}
+
+// PortProbe reports whether allocation probes ports.
+func (m *ServiceManager) PortProbe() PortProbeStatus {
+	m.probe.mu.Lock()
+	defer m.probe.mu.Unlock()
+	return PortProbeStatus{Enabled: m.probe.enabled, DisabledReason: m.probe.reason}
+}
+
+// OccupiedPorts lists the ports allocation skipped because another process
+// held them, by port.
+func (m *ServiceManager) OccupiedPorts() []OccupiedPort {
+	m.probe.mu.Lock()
+	defer m.probe.mu.Unlock()
+	return m.probe.listLocked()
+}
+
+// SetOccupiedPortStore makes the manager save occupied ports to store.
+func (m *ServiceManager) SetOccupiedPortStore(store OccupiedPortStore) {
+	m.probe.mu.Lock()
+	m.probe.store = store
+	m.probe.mu.Unlock()
+}
+
+// RestoreOccupiedPorts merges ports recorded by an earlier run, keeping the
+// later sighting of a port recorded in both. Records found since start-up
+// are saved when there are any.
+func (m *ServiceManager) RestoreOccupiedPorts(ports []OccupiedPort) {
+	m.probe.mu.Lock()
+	dirty := len(m.probe.occupied) > 0
+	for _, rec := range ports {
+		key := occupiedKey{port: rec.Port, network: rec.Network}
+		if cur, ok := m.probe.occupied[key]; ok {
+			if rec.FirstSeen.Before(cur.FirstSeen) {
+				cur.FirstSeen = rec.FirstSeen
+				m.probe.occupied[key] = cur
+			}
+			continue
+		}
+		m.probe.occupied[key] = rec
+	}
+	m.probe.trimLocked()
+	m.probe.dirty = m.probe.dirty || dirty
+	m.probe.mu.Unlock()
+	m.probe.flush(context.Background())
+}
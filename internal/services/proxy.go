@@ -1,7 +1,13 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,103 +18,283 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"piccolod/internal/api"
+	"piccolod/internal/network"
 )
 
 type connectionHint struct {
 	isTLS      bool
 	remotePort int
+	// clientIP is the originating client for connections relayed over
+	// loopback (Nexus, the TLS mux); empty for direct connections.
+	clientIP string
+	created  time.Time
 }
 
 type hintContextKey struct{}
 
+// backendContextKey carries the host bind an HTTP request was assigned to.
+type backendContextKey struct{}
+
 // ProxyManager manages TCP listeners and proxies traffic based on ServiceEndpoint
 type ProxyManager struct {
 	mu        sync.Mutex
 	listeners map[int]net.Listener // by public port
-	hints     map[int]map[int]connectionHint
+	relays    map[int]*udpRelay    // by public port
+	hints     *hintStore
 	wg        sync.WaitGroup
 	acme      http.Handler
+	udpIdle   time.Duration
+	udpMax    int
+	stats     *statsRegistry
+	trusted   *network.TrustedProxies
+	tunnel    *tunnelForwarder
+	// limiters holds the connection limiter of each TCP listener, by public
+	// port; guarded by mu like listeners.
+	limiters map[int]*limitListener
+	limits   atomic.Pointer[ConnectionLimits]
+	// paused holds the apps whose containers are frozen; their listeners
+	// stay bound but refuse traffic. Guarded by mu.
+	paused map[string]bool
+	// backends holds the host bind each TCP listener forwards to, by public
+	// port, and active counts the connections and requests open to each
+	// host bind. Both are guarded by mu.
+	backends map[int]int
+	active   map[int]int
 }
 
 func NewProxyManager() *ProxyManager {
-	return &ProxyManager{listeners: make(map[int]net.Listener)}
+	p := &ProxyManager{
+		listeners: make(map[int]net.Listener),
+		relays:    make(map[int]*udpRelay),
+		hints:     newHintStore(),
+		udpIdle:   DefaultUDPSessionIdleTimeout,
+		udpMax:    DefaultUDPMaxSessions,
+		stats:     newStatsRegistry(),
+		tunnel:    newTunnelForwarder(),
+		limiters:  make(map[int]*limitListener),
+		paused:    make(map[string]bool),
+		backends:  make(map[int]int),
+		active:    make(map[int]int),
+	}
+	defaults := DefaultConnectionLimits()
+	p.limits.Store(&defaults)
+	return p
+}
+
+// SetRouteResolver lets the proxy forward connections for apps this node
+// follows to the leader instead of a local backend.
+func (p *ProxyManager) SetRouteResolver(r RouteResolver) { p.tunnel.setRoutes(r) }
+
+// TunnelStats reports connections forwarded to the leader.
+func (p *ProxyManager) TunnelStats() TunnelStats { return p.tunnel.stats() }
+
+// SetTrustedProxies sets the peers whose forwarding headers are passed on to
+// backends; headers from other peers are replaced.
+func (p *ProxyManager) SetTrustedProxies(t *network.TrustedProxies) {
+	p.mu.Lock()
+	p.trusted = t
+	p.mu.Unlock()
+}
+
+// SetUDPIdleTimeout overrides the idle timeout for UDP relay sessions started afterwards.
+func (p *ProxyManager) SetUDPIdleTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.udpIdle = d
+	p.mu.Unlock()
+}
+
+// SetUDPMaxSessions overrides the per-relay peer session cap for UDP relays
+// started afterwards.
+func (p *ProxyManager) SetUDPMaxSessions(n int) {
+	p.mu.Lock()
+	p.udpMax = n
+	p.mu.Unlock()
 }
 
 func (p *ProxyManager) registerHint(listenerPort, sourcePort int, hint connectionHint) {
 	if sourcePort <= 0 {
 		return
 	}
+	p.hints.put(listenerPort, sourcePort, hint)
+}
+
+func (p *ProxyManager) consumeHint(listenerPort, sourcePort int) (connectionHint, bool) {
+	return p.hints.take(listenerPort, sourcePort)
+}
+
+func (p *ProxyManager) forgetHint(listenerPort, sourcePort int) {
+	p.hints.remove(listenerPort, sourcePort)
+}
+
+func (p *ProxyManager) setDefaultLimits(l ConnectionLimits) { p.limits.Store(&l) }
+
+func (p *ProxyManager) defaultLimits() ConnectionLimits { return *p.limits.Load() }
+
+func (p *ProxyManager) limiterFor(publicPort int) *connLimiter {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.hints == nil {
-		p.hints = make(map[int]map[int]connectionHint)
+	if ll := p.limiters[publicPort]; ll != nil {
+		return ll.limiter
 	}
-	m := p.hints[listenerPort]
-	if m == nil {
-		m = make(map[int]connectionHint)
-		p.hints[listenerPort] = m
+	return nil
+}
+
+func (p *ProxyManager) countRejected(publicPort int) {
+	p.mu.Lock()
+	ll := p.limiters[publicPort]
+	p.mu.Unlock()
+	if ll != nil {
+		ll.counters.rejected.Add(1)
 	}
-	m[sourcePort] = hint
 }
 
-func (p *ProxyManager) consumeHint(listenerPort, sourcePort int) (connectionHint, bool) {
+// SetHintLimits overrides the connection hint TTL and cap; zero keeps the
+// current value.
+func (p *ProxyManager) SetHintLimits(ttl time.Duration, limit int) {
+	p.hints.setLimits(ttl, limit)
+}
+
+// Hints lists outstanding connection hints.
+func (p *ProxyManager) Hints() []ProxyHint { return p.hints.snapshot() }
+
+// pausedRetryAfter is the Retry-After hint, in seconds, sent while an app
+// is paused.
+const pausedRetryAfter = "30"
+
+// SetAppPaused makes app's listeners refuse traffic, or carry it again.
+func (p *ProxyManager) SetAppPaused(app string, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if paused {
+		p.paused[app] = true
+	} else {
+		delete(p.paused, app)
+	}
+}
+
+func (p *ProxyManager) appPaused(app string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused[app]
+}
+
+// RetargetBackend points the TCP listener on publicPort at hostBind without
+// closing it. Connections accepted afterwards go to the new backend; open
+// ones finish on the one they were dialed to.
+func (p *ProxyManager) RetargetBackend(publicPort, hostBind int) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if m := p.hints[listenerPort]; m != nil {
-		if hint, ok := m[sourcePort]; ok {
-			delete(m, sourcePort)
-			if len(m) == 0 {
-				delete(p.hints, listenerPort)
+	if _, ok := p.backends[publicPort]; !ok {
+		return false
+	}
+	p.backends[publicPort] = hostBind
+	return true
+}
+
+// ActiveBackendConnections reports the proxied connections and requests in
+// flight to hostBind.
+func (p *ProxyManager) ActiveBackendConnections(hostBind int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active[hostBind]
+}
+
+// acquireBackend returns the host bind the listener on publicPort forwards
+// to and counts a connection to it until release is called. fallback is
+// used when the listener has no recorded backend.
+func (p *ProxyManager) acquireBackend(publicPort, fallback int) (int, func()) {
+	p.mu.Lock()
+	port, ok := p.backends[publicPort]
+	if !ok {
+		port = fallback
+	}
+	p.active[port]++
+	p.mu.Unlock()
+	var once sync.Once
+	return port, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			if p.active[port]--; p.active[port] <= 0 {
+				delete(p.active, port)
 			}
-			return hint, true
-		}
+			p.mu.Unlock()
+		})
 	}
-	return connectionHint{}, false
 }
 
 // SetAcmeHandler registers a handler to serve HTTP-01 challenges for all HTTP proxies.
 func (p *ProxyManager) SetAcmeHandler(h http.Handler) { p.mu.Lock(); p.acme = h; p.mu.Unlock() }
 
-// StartListener starts a TCP proxy for the given endpoint
-func (p *ProxyManager) StartListener(ep ServiceEndpoint) {
+// StartListener starts a TCP proxy (or UDP relay) for the given endpoint. It
+// reports a public port that cannot be bound; starting an endpoint that is
+// already served is a no-op.
+func (p *ProxyManager) StartListener(ep ServiceEndpoint) error {
 	addr := net.JoinHostPort("0.0.0.0", strconv.Itoa(ep.PublicPort))
 	// Avoid double-start
 	p.mu.Lock()
 	if _, exists := p.listeners[ep.PublicPort]; exists {
 		p.mu.Unlock()
-		return
+		return nil
+	}
+	if _, exists := p.relays[ep.PublicPort]; exists {
+		p.mu.Unlock()
+		return nil
+	}
+	if ep.Protocol == api.ListenerProtocolUDP {
+		err := p.startUDPRelayLocked(addr, ep)
+		p.mu.Unlock()
+		return err
 	}
-	ln, err := net.Listen("tcp", addr)
+	raw, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Printf("WARN: Failed to bind public listener on %s: %v", addr, err)
 		p.mu.Unlock()
-		return
-	}
-	p.listeners[ep.PublicPort] = ln
+		return fmt.Errorf("bind public listener %s: %w", addr, err)
+	}
+	counters := p.stats.counters(ep.App, ep.Name)
+	limited := &limitListener{
+		Listener: raw,
+		limiter:  newConnLimiter(func() ConnectionLimits { return ep.Limits.withDefaults(p.defaultLimits()) }),
+		counters: counters,
+	}
+	counted := &countingListener{Listener: limited, counters: counters}
+	p.listeners[ep.PublicPort] = counted
+	p.limiters[ep.PublicPort] = limited
+	p.backends[ep.PublicPort] = ep.HostBind
 	p.mu.Unlock()
+	ln := &tunnelListener{Listener: counted, p: p, ep: ep}
 
 	switch ep.Flow {
 	case api.FlowTLS:
 		// Raw TCP passthrough
 		p.startTCPProxy(ln, ep)
 	case api.FlowTCP:
-		switch ep.Protocol {
-		case api.ListenerProtocolHTTP, api.ListenerProtocolWebsocket:
+		if ep.Protocol.HTTP() {
 			p.startHTTPProxy(ln, ep)
-		default:
+		} else {
 			p.startTCPProxy(ln, ep)
 		}
 	default:
 		p.startTCPProxy(ln, ep)
 	}
+	return nil
 }
 
 func (p *ProxyManager) handleConn(ep ServiceEndpoint, client net.Conn) {
 	defer client.Close()
-	backendAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.HostBind))
+	// Raw streams have no use for the hint, but it must not outlive the
+	// connection it was recorded for. It may be recorded just after accept.
+	if addr, ok := client.RemoteAddr().(*net.TCPAddr); ok {
+		p.forgetHint(ep.PublicPort, addr.Port)
+		defer p.forgetHint(ep.PublicPort, addr.Port)
+	}
+	port, release := p.acquireBackend(ep.PublicPort, ep.HostBind)
+	defer release()
+	backendAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
 
 	// For v1: passthrough for all flows; framework in place to add protocol handlers
 	backend, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
@@ -118,13 +304,60 @@ func (p *ProxyManager) handleConn(ep ServiceEndpoint, client net.Conn) {
 	}
 	defer backend.Close()
 
-	// Bi-directional copy
+	// Bi-directional copy. Each direction propagates EOF as a half-close and
+	// the connection stays up until both sides have finished writing. Any
+	// other end, such as the idle timer closing the client, tears down both.
 	done := make(chan struct{}, 2)
-	go func() { io.Copy(backend, client); backend.(*net.TCPConn).CloseWrite(); done <- struct{}{} }()
-	go func() { io.Copy(client, backend); client.(*net.TCPConn).CloseWrite(); done <- struct{}{} }()
+	go func() { splice(backend, client); done <- struct{}{} }()
+	go func() { splice(client, backend); done <- struct{}{} }()
+	<-done
 	<-done
 }
 
+// splice copies src to dst. EOF is passed on as a half-close; a failed
+// read or write closes dst outright, so the opposite copy stops as well.
+func splice(dst, src net.Conn) int64 {
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		return n
+	}
+	closeWrite(dst)
+	return n
+}
+
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
+
+func (p *ProxyManager) startUDPRelayLocked(addr string, ep ServiceEndpoint) error {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Printf("WARN: Invalid UDP listener address %s: %v", addr, err)
+		return fmt.Errorf("resolve public UDP listener %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		log.Printf("WARN: Failed to bind public UDP listener on %s: %v", addr, err)
+		return fmt.Errorf("bind public UDP listener %s: %w", addr, err)
+	}
+	backend := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: ep.HostBind}
+	relay := newUDPRelay(conn, backend, p.udpIdle, p.udpMax, fmt.Sprintf("%s/%s", ep.App, ep.Name))
+	relay.counters = p.stats.counters(ep.App, ep.Name)
+	p.relays[ep.PublicPort] = relay
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		log.Printf("INFO: UDP relay %s → %s (app=%s listener=%s)", conn.LocalAddr().String(), backend.String(), ep.App, ep.Name)
+		relay.serve()
+	}()
+	return nil
+}
+
 func (p *ProxyManager) startTCPProxy(ln net.Listener, ep ServiceEndpoint) {
 	p.wg.Add(1)
 	go func() {
@@ -139,6 +372,11 @@ func (p *ProxyManager) startTCPProxy(ln net.Listener, ep ServiceEndpoint) {
 				}
 				return
 			}
+			if p.appPaused(ep.App) {
+				// The frozen backend would hold the connection open.
+				_ = conn.Close()
+				continue
+			}
 			// TODO L0: rate-limit + metrics per IP (stub)
 			p.wg.Add(1)
 			go func(c net.Conn) {
@@ -150,17 +388,57 @@ func (p *ProxyManager) startTCPProxy(ln net.Listener, ep ServiceEndpoint) {
 }
 
 func (p *ProxyManager) startHTTPProxy(ln net.Listener, ep ServiceEndpoint) {
-	target := "http://127.0.0.1:" + strconv.Itoa(ep.HostBind)
-	u, err := url.Parse(target)
-	if err != nil {
-		log.Printf("WARN: invalid reverse proxy target %s: %v", target, err)
-		return
+	scheme := "http"
+	if ep.Protocol == api.ListenerProtocolHTTPS {
+		scheme = "https"
+	}
+	target := scheme + "://127.0.0.1:" + strconv.Itoa(ep.HostBind)
+	counters := p.stats.counters(ep.App, ep.Name)
+	// Rewrite rather than Director: the reverse proxy then leaves
+	// X-Forwarded-For to applyForwardHeaders instead of appending the
+	// loopback peer a second time.
+	rp := &httputil.ReverseProxy{Rewrite: func(pr *httputil.ProxyRequest) {
+		port, ok := pr.In.Context().Value(backendContextKey{}).(int)
+		if !ok {
+			port = ep.HostBind
+		}
+		pr.SetURL(&url.URL{Scheme: scheme, Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))})
+		for _, h := range forwardHeaderNames {
+			if v := pr.In.Header.Values(h); len(v) > 0 {
+				pr.Out.Header[h] = v
+			}
+		}
+		if !ep.InternalHost {
+			pr.Out.Host = pr.In.Host
+		}
+	}}
+	if scheme == "https" {
+		tlsConfig, err := backendTLSConfig(ep.BackendTLS)
+		if err != nil {
+			log.Printf("WARN: backend TLS for app=%s listener=%s: %v", ep.App, ep.Name, err)
+			_ = ln.Close()
+			return
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		rp.Transport = transport
+		rp.ModifyResponse = func(*http.Response) error {
+			counters.setBackendError(nil)
+			return nil
+		}
+		rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("WARN: https backend 127.0.0.1:%v (app=%s listener=%s): %v", r.Context().Value(backendContextKey{}), ep.App, ep.Name, err)
+			counters.setBackendError(err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
 	}
-	rp := httputil.NewSingleHostReverseProxy(u)
-	// Basic transport tuning; defaults are fine for v1
 
 	// Default middleware chain (stubs)
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		trusted := p.trusted
+		p.mu.Unlock()
+		dropUntrustedForwardHeaders(r, trusted)
 		applyForwardHeaders(r, ep)
 		// Intercept ACME HTTP-01 challenges on HTTP proxies only
 		if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
@@ -172,7 +450,16 @@ func (p *ProxyManager) startHTTPProxy(ln net.Listener, ep ServiceEndpoint) {
 				return
 			}
 		}
-		rp.ServeHTTP(w, r)
+		if p.appPaused(ep.App) {
+			w.Header().Set("Retry-After", pausedRetryAfter)
+			http.Error(w, "app is paused", http.StatusServiceUnavailable)
+			return
+		}
+		// The backend is picked per request, so a retarget moves the next
+		// request even on a kept-alive client connection.
+		port, release := p.acquireBackend(ep.PublicPort, ep.HostBind)
+		defer release()
+		rp.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), backendContextKey{}, port)))
 	}))
 	handler = securityHeaders(handler)
 	handler = requestLogging(handler)
@@ -197,6 +484,49 @@ func (p *ProxyManager) startHTTPProxy(ln net.Listener, ep ServiceEndpoint) {
 	}()
 }
 
+// backendTLSConfig builds the client config for an https backend. The
+// backend is dialed on loopback, so its certificate is never matched against
+// a host name: it is accepted as is unless pinned by fingerprint or CA.
+func backendTLSConfig(pin *api.ListenerBackendTLS) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	if pin == nil {
+		return cfg, nil
+	}
+	fingerprint, err := pin.FingerprintBytes()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := pin.CertPool()
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint == nil && roots == nil {
+		return cfg, nil
+	}
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("backend presented no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		if fingerprint != nil {
+			if sum := sha256.Sum256(leaf.Raw); !bytes.Equal(sum[:], fingerprint) {
+				return fmt.Errorf("backend certificate fingerprint %s does not match the pinned fingerprint", hex.EncodeToString(sum[:]))
+			}
+		}
+		if roots != nil {
+			inter := x509.NewCertPool()
+			for _, c := range cs.PeerCertificates[1:] {
+				inter.AddCert(c)
+			}
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: inter}); err != nil {
+				return fmt.Errorf("backend certificate not signed by the pinned CA: %w", err)
+			}
+		}
+		return nil
+	}
+	return cfg, nil
+}
+
 // Middleware stubs
 func securityHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -227,6 +557,26 @@ func hintFromRequest(r *http.Request) (connectionHint, bool) {
 	return connectionHint{}, false
 }
 
+// forwardHeaderNames are the headers httputil.ReverseProxy strips from the
+// outbound request when Rewrite is set.
+var forwardHeaderNames = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// dropUntrustedForwardHeaders discards forwarding headers a client set itself
+// so backends only see the chain vouched for by trusted proxies. Relayed
+// connections arrive from loopback, so their client address is judged
+// instead.
+func dropUntrustedForwardHeaders(r *http.Request, trusted *network.TrustedProxies) {
+	if hint, ok := hintFromRequest(r); ok && hint.clientIP != "" {
+		if !trusted.Contains(net.ParseIP(hint.clientIP)) {
+			network.StripForwardHeaders(r.Header)
+		}
+		return
+	}
+	if !trusted.TrustsPeer(r) {
+		network.StripForwardHeaders(r.Header)
+	}
+}
+
 func applyForwardHeaders(r *http.Request, ep ServiceEndpoint) {
 	host, hostPort := splitHostPortValue(r.Host)
 	if host == "" {
@@ -284,12 +634,7 @@ func shouldRewriteAsHTTPS(ep ServiceEndpoint, r *http.Request) bool {
 	if ep.Flow != api.FlowTCP {
 		return false
 	}
-	switch ep.Protocol {
-	case api.ListenerProtocolHTTP, api.ListenerProtocolWebsocket:
-		return requestArrivedViaTLS(r)
-	default:
-		return false
-	}
+	return ep.Protocol.HTTP() && requestArrivedViaTLS(r)
 }
 
 func requestArrivedViaTLS(r *http.Request) bool {
@@ -323,6 +668,9 @@ func ensureClientIPHeaders(r *http.Request) string {
 	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 		ip = host
 	}
+	if hint, ok := hintFromRequest(r); ok && hint.clientIP != "" {
+		ip = hint.clientIP
+	}
 	if ip == "" {
 		return ""
 	}
@@ -368,9 +716,19 @@ func (p *ProxyManager) StopAll() {
 	for port, ln := range p.listeners {
 		_ = ln.Close()
 		delete(p.listeners, port)
-		delete(p.hints, port)
+		delete(p.limiters, port)
+		delete(p.backends, port)
+		p.hints.dropListener(port)
+	}
+	relays := make([]*udpRelay, 0, len(p.relays))
+	for port, relay := range p.relays {
+		relays = append(relays, relay)
+		delete(p.relays, port)
 	}
 	p.mu.Unlock()
+	for _, relay := range relays {
+		_ = relay.Close()
+	}
 	p.wg.Wait()
 }
 
@@ -380,9 +738,16 @@ func (p *ProxyManager) StopPort(port int) {
 	if ln, ok := p.listeners[port]; ok {
 		_ = ln.Close()
 		delete(p.listeners, port)
+		delete(p.limiters, port)
+		delete(p.backends, port)
 	}
-	delete(p.hints, port)
+	relay := p.relays[port]
+	delete(p.relays, port)
+	p.hints.dropListener(port)
 	p.mu.Unlock()
+	if relay != nil {
+		_ = relay.Close()
+	}
 }
 
 // small int→string helper without strconv to keep deps minimal
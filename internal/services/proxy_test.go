@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"piccolod/internal/api"
+	"piccolod/internal/network"
 )
 
 // startEchoBackend starts a simple TCP echo server on 127.0.0.1:0 and returns its port and a shutdown func
@@ -249,3 +251,407 @@ func TestHTTPProxyForwardHeadersRespectTLSHints(t *testing.T) {
 		t.Fatalf("timeout waiting for backend request (tls hint)")
 	}
 }
+
+func TestForwardHeadersFromUntrustedPeerAreReplaced(t *testing.T) {
+	ep := ServiceEndpoint{Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	spoofed := func(remote string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://web.example.com", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		return req
+	}
+
+	lan := spoofed("192.168.1.50:40000")
+	dropUntrustedForwardHeaders(lan, nil)
+	applyForwardHeaders(lan, ep)
+	if got := lan.Header.Get("X-Forwarded-Proto"); got != "http" {
+		t.Fatalf("expected spoofed proto replaced with http, got %q", got)
+	}
+	if got := lan.Header.Get("X-Forwarded-For"); got != "192.168.1.50" {
+		t.Fatalf("expected X-Forwarded-For to start at the peer, got %q", got)
+	}
+
+	trusted, err := network.ParseTrustedProxies("192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied := spoofed("192.168.1.50:40000")
+	dropUntrustedForwardHeaders(proxied, trusted)
+	applyForwardHeaders(proxied, ep)
+	if got := proxied.Header.Get("X-Forwarded-Proto"); got != "https" {
+		t.Fatalf("expected trusted proxy proto kept, got %q", got)
+	}
+	if got := proxied.Header.Get("X-Forwarded-For"); got != "203.0.113.9, 192.168.1.50" {
+		t.Fatalf("expected trusted chain extended, got %q", got)
+	}
+}
+
+type recordedRequest struct {
+	host   string
+	header http.Header
+}
+
+// startRecordingProxy runs a backend that records each request it gets and
+// an HTTP proxy in front of it. The returned client sends requests with the
+// given hint registered for their connection.
+func startRecordingProxy(t *testing.T, internalHost bool) (ServiceEndpoint, <-chan recordedRequest, func(hint connectionHint, host string, header http.Header)) {
+	t.Helper()
+	seen := make(chan recordedRequest, 4)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- recordedRequest{host: r.Host, header: r.Header.Clone()}
+	}))
+	t.Cleanup(backend.Close)
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	pm := NewProxyManager()
+	ep := ServiceEndpoint{
+		App:          "cloud",
+		Name:         "web",
+		HostBind:     backendPort,
+		PublicPort:   getFreePort(t),
+		Flow:         api.FlowTCP,
+		Protocol:     api.ListenerProtocolHTTP,
+		InternalHost: internalHost,
+	}
+	pm.StartListener(ep)
+	t.Cleanup(pm.StopAll)
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(hint connectionHint, host string, header http.Header) {
+		t.Helper()
+		transport := &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err == nil {
+					pm.registerHint(ep.PublicPort, conn.LocalAddr().(*net.TCPAddr).Port, hint)
+				}
+				return conn, err
+			},
+		}
+		defer transport.CloseIdleConnections()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", ep.PublicPort), nil)
+		req.Host = host
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := (&http.Client{Timeout: 2 * time.Second, Transport: transport}).Do(req)
+		if err != nil {
+			t.Fatalf("proxy request: %v", err)
+		}
+		resp.Body.Close()
+	}
+	return ep, seen, send
+}
+
+func nextRecorded(t *testing.T, seen <-chan recordedRequest) recordedRequest {
+	t.Helper()
+	select {
+	case r := <-seen:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatalf("backend saw no request")
+	}
+	return recordedRequest{}
+}
+
+func TestHTTPProxyPreservesHostAndForwardsClient(t *testing.T) {
+	_, seen, send := startRecordingProxy(t, false)
+
+	// Local request: the peer is the client.
+	send(connectionHint{}, "cloud.lan:8080", nil)
+	got := nextRecorded(t, seen)
+	if got.host != "cloud.lan:8080" {
+		t.Fatalf("Host rewritten to %q", got.host)
+	}
+	if xff := got.header.Values("X-Forwarded-For"); len(xff) != 1 || xff[0] != "127.0.0.1" {
+		t.Fatalf("X-Forwarded-For = %q, want the peer once", xff)
+	}
+	if got.header.Get("X-Forwarded-Proto") != "http" || got.header.Get("X-Forwarded-Host") != "cloud.lan:8080" {
+		t.Fatalf("unexpected forwarding headers %v", got.header)
+	}
+
+	// Remote request relayed by the TLS mux: the hint carries the scheme and
+	// the client Nexus reported, and the client's own headers are dropped.
+	send(connectionHint{isTLS: true, remotePort: 443, clientIP: "203.0.113.10"}, "cloud.example.com", http.Header{
+		"X-Forwarded-For":   {"10.9.9.9"},
+		"X-Forwarded-Proto": {"http"},
+	})
+	got = nextRecorded(t, seen)
+	if got.host != "cloud.example.com" {
+		t.Fatalf("Host rewritten to %q", got.host)
+	}
+	if xff := got.header.Get("X-Forwarded-For"); xff != "203.0.113.10" {
+		t.Fatalf("X-Forwarded-For = %q, want the remote client", xff)
+	}
+	if got.header.Get("X-Real-Ip") != "203.0.113.10" {
+		t.Fatalf("X-Real-Ip = %q", got.header.Get("X-Real-Ip"))
+	}
+	if got.header.Get("X-Forwarded-Proto") != "https" || got.header.Get("X-Forwarded-Host") != "cloud.example.com" || got.header.Get("X-Forwarded-Port") != "443" {
+		t.Fatalf("unexpected forwarding headers %v", got.header)
+	}
+}
+
+func TestHTTPProxyInternalHostOptOut(t *testing.T) {
+	ep, seen, send := startRecordingProxy(t, true)
+
+	send(connectionHint{isTLS: true, clientIP: "203.0.113.10"}, "cloud.example.com", nil)
+	got := nextRecorded(t, seen)
+	if want := fmt.Sprintf("127.0.0.1:%d", ep.HostBind); got.host != want {
+		t.Fatalf("Host = %q, want the backend address %q", got.host, want)
+	}
+	// The original host is still available to the app.
+	if got.header.Get("X-Forwarded-Host") != "cloud.example.com" || got.header.Get("X-Forwarded-Proto") != "https" {
+		t.Fatalf("unexpected forwarding headers %v", got.header)
+	}
+}
+
+// startHTTPSBackendProxy runs a TLS backend with a self-signed certificate
+// and an https listener proxy in front of it.
+func startHTTPSBackendProxy(t *testing.T, pin *api.ListenerBackendTLS) (*ProxyManager, ServiceEndpoint, <-chan recordedRequest) {
+	t.Helper()
+	seen := make(chan recordedRequest, 4)
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- recordedRequest{host: r.Host, header: r.Header.Clone()}
+	}))
+	t.Cleanup(backend.Close)
+
+	pm := NewProxyManager()
+	ep := ServiceEndpoint{
+		App:        "vault",
+		Name:       "web",
+		HostBind:   backend.Listener.Addr().(*net.TCPAddr).Port,
+		PublicPort: getFreePort(t),
+		Flow:       api.FlowTCP,
+		Protocol:   api.ListenerProtocolHTTPS,
+		BackendTLS: pin,
+	}
+	if err := pm.StartListener(ep); err != nil {
+		t.Fatalf("start listener: %v", err)
+	}
+	t.Cleanup(pm.StopAll)
+	time.Sleep(100 * time.Millisecond)
+	return pm, ep, seen
+}
+
+func getVia(t *testing.T, ep ServiceEndpoint, host string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", ep.PublicPort), nil)
+	req.Host = host
+	resp, err := (&http.Client{Timeout: 2 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatalf("proxy request: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHTTPSBackendSelfSignedIsProxied(t *testing.T) {
+	pm, ep, seen := startHTTPSBackendProxy(t, nil)
+
+	if code := getVia(t, ep, "vault.lan"); code != http.StatusOK {
+		t.Fatalf("expected 200 through the proxy, got %d", code)
+	}
+	got := nextRecorded(t, seen)
+	if got.host != "vault.lan" {
+		t.Fatalf("Host rewritten to %q", got.host)
+	}
+	if got.header.Get("X-Forwarded-Proto") != "http" || got.header.Get("X-Forwarded-Host") != "vault.lan" || got.header.Get("X-Forwarded-For") != "127.0.0.1" {
+		t.Fatalf("unexpected forwarding headers %v", got.header)
+	}
+	if st, _ := pm.stats.get(ep.App, ep.Name); st.BackendError != nil {
+		t.Fatalf("unexpected backend error %+v", st.BackendError)
+	}
+}
+
+func TestHTTPSBackendFingerprintMismatchRefusesBackend(t *testing.T) {
+	pin := &api.ListenerBackendTLS{Fingerprint: strings.Repeat("ab:", 31) + "ab"}
+	pm, ep, seen := startHTTPSBackendProxy(t, pin)
+
+	if code := getVia(t, ep, "vault.lan"); code != http.StatusBadGateway {
+		t.Fatalf("expected 502 for a mismatched backend certificate, got %d", code)
+	}
+	select {
+	case r := <-seen:
+		t.Fatalf("backend should not have been reached, got %+v", r)
+	default:
+	}
+	st, _ := pm.stats.get(ep.App, ep.Name)
+	if st.BackendError == nil || !strings.Contains(st.BackendError.Message, "fingerprint") {
+		t.Fatalf("expected a fingerprint backend error, got %+v", st.BackendError)
+	}
+}
+
+func TestProxyPausedAppRefusesTraffic(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	hb := backend.Listener.Addr().(*net.TCPAddr).Port
+	echo, stop := startEchoBackend(t)
+	defer stop()
+
+	pm := NewProxyManager()
+	defer pm.StopAll()
+	web := ServiceEndpoint{App: "wiki", Name: "web", HostBind: hb, PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	raw := ServiceEndpoint{App: "wiki", Name: "sync", HostBind: echo, PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw}
+	for _, ep := range []ServiceEndpoint{web, raw} {
+		if err := pm.StartListener(ep); err != nil {
+			t.Fatalf("start %s: %v", ep.Name, err)
+		}
+	}
+	webURL := "http://127.0.0.1:" + strconv.Itoa(web.PublicPort) + "/"
+	echoOnce := func() error {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(raw.PublicPort)), time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write([]byte("ping\n")); err != nil {
+			return err
+		}
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		return err
+	}
+
+	pm.SetAppPaused("wiki", true)
+	resp, err := http.Get(webURL)
+	if err != nil {
+		t.Fatalf("get while paused: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After while paused, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if err := echoOnce(); err == nil {
+		t.Fatalf("raw listener carried traffic while paused")
+	}
+
+	pm.SetAppPaused("wiki", false)
+	resp, err = http.Get(webURL)
+	if err != nil {
+		t.Fatalf("get after unpause: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after unpause, got %d", resp.StatusCode)
+	}
+	if err := echoOnce(); err != nil {
+		t.Fatalf("raw listener after unpause: %v", err)
+	}
+}
+
+func TestServiceManagerRetargetDrainsOldBackend(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	ep, oldBackend := allocateEcho(t, m)
+
+	held, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.PublicPort)))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer held.Close()
+	reader := bufio.NewReader(held)
+	roundTrip := func(msg string) {
+		t.Helper()
+		_ = held.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := held.Write([]byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got, err := reader.ReadString('\n'); err != nil || got != msg {
+			t.Fatalf("echo %q: got %q (%v)", msg, got, err)
+		}
+	}
+	roundTrip("one\n")
+
+	binds, err := m.ReserveReplacementBinds("blog")
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	next := binds[80]
+	if next == 0 || next == ep.HostBind {
+		t.Fatalf("expected a fresh host bind, got %v", binds)
+	}
+	newBackend := listenEcho(t, next)
+	defer newBackend.Close()
+	previous, err := m.RetargetApp("blog", binds)
+	if err != nil || len(previous) != 1 || previous[0] != ep.HostBind {
+		t.Fatalf("retarget: %v %v", previous, err)
+	}
+	eps, _ := m.GetByApp("blog")
+	if eps[0].HostBind != next || eps[0].PublicPort != ep.PublicPort {
+		t.Fatalf("expected the endpoint moved to %d on the same public port, got %+v", next, eps[0])
+	}
+
+	// New connections reach the replacement even with the old backend no
+	// longer accepting; the open one stays where it was.
+	_ = oldBackend.Close()
+	echoOnce(t, ep.PublicPort, "two\n")
+	roundTrip("three\n")
+	if n := m.ActiveBackendConnections(previous); n != 1 {
+		t.Fatalf("expected the held connection on the old backend, got %d", n)
+	}
+	st := waitForStats(t, m, "blog", "web", func(st EndpointStats) bool {
+		return st.ActiveConnections == 1 && st.TotalConnections == 2
+	})
+	if st.BytesIn != int64(len("one\ntwo\nthree\n")) {
+		t.Fatalf("unexpected stats across the retarget: %+v", st)
+	}
+
+	_ = held.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for m.ActiveBackendConnections(append(previous, next)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections never drained")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitForStats(t, m, "blog", "web", func(st EndpointStats) bool { return st.ActiveConnections == 0 })
+	m.ReleaseHostBinds(previous)
+}
+
+func TestHTTPProxyRetargetMovesNextRequest(t *testing.T) {
+	serve := func(body string) int {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(srv.Close)
+		return srv.Listener.Addr().(*net.TCPAddr).Port
+	}
+	blue, green := serve("blue"), serve("green")
+	pm := NewProxyManager()
+	defer pm.StopAll()
+	ep := ServiceEndpoint{App: "wiki", Name: "web", HostBind: blue, PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	if err := pm.StartListener(ep); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// One client keeps its connection alive across the switch.
+	client := &http.Client{Timeout: 2 * time.Second}
+	get := func() string {
+		t.Helper()
+		resp, err := client.Get("http://127.0.0.1:" + strconv.Itoa(ep.PublicPort) + "/")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if got := get(); got != "blue" {
+		t.Fatalf("expected blue before the retarget, got %q", got)
+	}
+	if !pm.RetargetBackend(ep.PublicPort, green) {
+		t.Fatalf("retarget refused")
+	}
+	if got := get(); got != "green" {
+		t.Fatalf("expected green after the retarget, got %q", got)
+	}
+	if pm.ActiveBackendConnections(blue) != 0 || pm.ActiveBackendConnections(green) != 0 {
+		t.Fatalf("requests left counted as in flight")
+	}
+	if pm.RetargetBackend(getFreePort(t), green) {
+		t.Fatalf("retargeted a port with no listener")
+	}
+}
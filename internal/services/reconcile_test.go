@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"piccolod/internal/api"
 	"testing"
 )
@@ -36,3 +37,178 @@ func TestReconcile_AddRemoveChange(t *testing.T) {
 		t.Fatalf("want 1 added, got %d", len(rec.Added))
 	}
 }
+
+func TestPlanReconcile_LeavesStateAlone(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	eps, err := m.AllocateForApp("app", []api.AppListener{
+		{Name: "a", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw},
+		{Name: "gone", GuestPort: 81, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw},
+	})
+	if err != nil {
+		t.Fatalf("alloc: %v", err)
+	}
+	before, _ := m.GetByApp("app")
+
+	next := []api.AppListener{
+		{Name: "a", GuestPort: 8080, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw},
+		{Name: "b", GuestPort: 22, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw},
+	}
+	plan, containerChange, err := m.PlanReconcile("app", next)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if !containerChange || len(plan.Added) != 1 || len(plan.Removed) != 1 || len(plan.GuestPortChanged) != 1 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.Removed[0].Name != "gone" || plan.Added[0].PublicPort == 0 {
+		t.Fatalf("plan missing port consequences: %+v", plan)
+	}
+	for _, ep := range eps {
+		if ep.PublicPort == plan.Added[0].PublicPort || ep.HostBind == plan.Added[0].HostBind {
+			t.Fatalf("planned ports %+v collide with %+v", plan.Added[0], ep)
+		}
+	}
+	after, _ := m.GetByApp("app")
+	if len(after) != len(before) {
+		t.Fatalf("plan changed the registry: before=%+v after=%+v", before, after)
+	}
+	if ep, ok := m.GetAppListener("app", "a"); !ok || ep.GuestPort != 80 {
+		t.Fatalf("plan changed listener a: %+v", ep)
+	}
+
+	// Applying allocates exactly the ports the plan predicted.
+	rec, _, err := m.Reconcile("app", next)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if rec.Added[0].PublicPort != plan.Added[0].PublicPort || rec.Added[0].HostBind != plan.Added[0].HostBind {
+		t.Fatalf("reconcile picked %+v, plan predicted %+v", rec.Added[0], plan.Added[0])
+	}
+}
+
+func TestRemoteLabelConflictsAcrossApps(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	m.SetRemoteLabelsEnforced(true)
+	web := api.AppListener{Name: "web", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	if _, err := m.AllocateForApp("blog", []api.AppListener{web}); err != nil {
+		t.Fatalf("alloc blog: %v", err)
+	}
+
+	_, err := m.AllocateForApp("shop", []api.AppListener{web})
+	var conflict *RemoteHostConflictError
+	if !errors.As(err, &conflict) || conflict.OtherApp != "blog" || conflict.Label != "web" {
+		t.Fatalf("expected conflict with blog, got %v", err)
+	}
+	if _, err := m.GetByApp("shop"); err == nil {
+		t.Fatalf("conflicting app was registered")
+	}
+
+	store := web
+	store.RemoteSubdomain = "store"
+	if _, err := m.AllocateForApp("shop", []api.AppListener{store}); err != nil {
+		t.Fatalf("alloc shop with remote_subdomain: %v", err)
+	}
+	for label, app := range map[string]string{"web": "blog", "store": "shop", "STORE": "shop"} {
+		for i := 0; i < 20; i++ {
+			if ep, ok := m.ResolveRemoteLabel(label, 443); !ok || ep.App != app {
+				t.Fatalf("label %s resolved to %+v, want %s", label, ep, app)
+			}
+		}
+	}
+	// Both apps still call the listener "web"; name lookups pick the first
+	// app every time.
+	for i := 0; i < 20; i++ {
+		if ep, ok := m.ResolveListener("web", 443); !ok || ep.App != "blog" {
+			t.Fatalf("listener web resolved to %+v", ep)
+		}
+	}
+
+	// Moving the subdomain back onto blog's label is refused and leaves the
+	// registry alone.
+	if _, _, err := m.Reconcile("shop", []api.AppListener{web}); !errors.As(err, &conflict) {
+		t.Fatalf("reconcile: expected conflict, got %v", err)
+	}
+	if ep, ok := m.GetAppListener("shop", "web"); !ok || ep.RemoteLabel() != "store" {
+		t.Fatalf("shop listener changed by refused reconcile: %+v", ep)
+	}
+	// Apps may keep reusing their own labels.
+	if _, _, err := m.Reconcile("blog", []api.AppListener{web}); err != nil {
+		t.Fatalf("reconcile blog: %v", err)
+	}
+}
+
+func TestRemoteLabelsCheckedOnlyWhileEnforced(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	web := api.AppListener{Name: "web", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+
+	// Without remote access nothing is published, so labels may repeat.
+	for _, app := range []string{"shop", "blog"} {
+		if _, err := m.AllocateForApp(app, []api.AppListener{web}); err != nil {
+			t.Fatalf("alloc %s: %v", app, err)
+		}
+	}
+
+	// Enabling keeps both; the app sorting first serves the hostname and
+	// new clashes are refused.
+	m.SetRemoteLabelsEnforced(true)
+	if ep, ok := m.ResolveRemoteLabel("web", 443); !ok || ep.App != "blog" {
+		t.Fatalf("label web resolved to %+v, want blog", ep)
+	}
+	var conflict *RemoteHostConflictError
+	if err := m.CheckRemoteLabels("news", []api.AppListener{web}); !errors.As(err, &conflict) || conflict.OtherApp != "blog" {
+		t.Fatalf("expected conflict with blog, got %v", err)
+	}
+
+	m.SetRemoteLabelsEnforced(false)
+	if err := m.CheckRemoteLabels("news", []api.AppListener{web}); err != nil {
+		t.Fatalf("label checked with remote access off: %v", err)
+	}
+}
+
+func TestPathPrefixConflictsAndResolution(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	syncUI := api.AppListener{Name: "web", GuestPort: 8384, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/sync/"}
+	if _, err := m.AllocateForApp("syncthing", []api.AppListener{syncUI}); err != nil {
+		t.Fatalf("alloc syncthing: %v", err)
+	}
+
+	nested := api.AppListener{Name: "ui", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP, PathPrefix: "/apps/sync/admin"}
+	_, err := m.AllocateForApp("other", []api.AppListener{nested})
+	var conflict *PathPrefixConflictError
+	if !errors.As(err, &conflict) || conflict.OtherApp != "syncthing" || conflict.OtherPrefix != "/apps/sync" || conflict.Prefix != "/apps/sync/admin" {
+		t.Fatalf("expected conflict with syncthing, got %v", err)
+	}
+	if err := m.CheckPathPrefixes("syncthing", []api.AppListener{syncUI}); err != nil {
+		t.Fatalf("apps may keep their own prefix: %v", err)
+	}
+
+	nested.PathPrefix = "/apps/syncer"
+	if _, err := m.AllocateForApp("other", []api.AppListener{nested}); err != nil {
+		t.Fatalf("alloc other: %v", err)
+	}
+	for path, want := range map[string]string{"/apps/sync": "syncthing", "/apps/sync/rest/db": "syncthing", "/apps/syncer/": "other", "/apps/syncx": "", "/apps": ""} {
+		ep, ok := m.ResolvePathPrefix(path)
+		if (want == "") == ok || (ok && ep.App != want) {
+			t.Fatalf("path %s resolved to %+v (%v), want %q", path, ep, ok, want)
+		}
+	}
+	if ep, _ := m.ResolvePathPrefix("/apps/sync/"); !ep.StripPrefix || ep.PublicPath {
+		t.Fatalf("expected the defaults carried onto the endpoint: %+v", ep)
+	}
+
+	// Moving the prefix changes the route in place.
+	syncUI.PathPrefix = "/tools/sync"
+	if _, _, err := m.Reconcile("syncthing", []api.AppListener{syncUI}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if _, ok := m.ResolvePathPrefix("/apps/sync/"); ok {
+		t.Fatalf("old prefix still routed")
+	}
+	if ep, ok := m.ResolvePathPrefix("/tools/sync/x"); !ok || ep.App != "syncthing" {
+		t.Fatalf("new prefix not routed: %+v", ep)
+	}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStatsSnapshotInterval is how often endpoint counters are persisted.
+const DefaultStatsSnapshotInterval = time.Minute
+
+// EndpointStats is a point-in-time view of a listener's traffic counters.
+//
+// Counters are keyed by app and listener name rather than by port, so they
+// accumulate across stop/start (RemoveApp followed by AllocateForApp) and
+// across restarts once a snapshot has been restored. Uninstalling an app
+// discards its history via ForgetAppStats. BytesIn counts client→app
+// traffic, BytesOut app→client. Remote traffic arriving through Nexus or the
+// TLS mux is counted when it reaches the listener proxy (after TLS
+// termination for flow=tcp listeners).
+type EndpointStats struct {
+	App               string `json:"-"`
+	Listener          string `json:"-"`
+	BytesIn           int64  `json:"bytes_in"`
+	BytesOut          int64  `json:"bytes_out"`
+	ActiveConnections int64  `json:"active_connections"`
+	TotalConnections  int64  `json:"total_connections"`
+	// RejectedConnections counts connections turned away at the listener's
+	// connection limits; for udp listeners, datagrams from new peers dropped
+	// while the relay is at its session cap.
+	RejectedConnections int64     `json:"rejected_connections"`
+	LastActivity        time.Time `json:"last_activity,omitzero"`
+	// BackendError is the last failure reaching the backend of an https
+	// listener; it clears once a request gets through. It is not persisted.
+	BackendError *BackendError `json:"backend_error,omitempty"`
+}
+
+// BackendError records why the proxy could not reach a listener's backend.
+type BackendError struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// StatsStore persists endpoint counter snapshots across restarts.
+type StatsStore interface {
+	LoadServiceStats(ctx context.Context) ([]EndpointStats, error)
+	SaveServiceStats(ctx context.Context, stats []EndpointStats) error
+}
+
+// ErrStatsStoreUnavailable may be returned by StatsStore implementations when
+// the backing store is temporarily unreadable (e.g. locked); the snapshot loop
+// retries on the next tick.
+var ErrStatsStoreUnavailable = errors.New("services: stats store unavailable")
+
+// endpointCounters holds the live counters for one listener. Every field is
+// updated with atomic adds from the proxy copy loops.
+type endpointCounters struct {
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	active       atomic.Int64
+	total        atomic.Int64
+	rejected     atomic.Int64
+	lastActivity atomic.Int64 // unix nanos
+	backendErr   atomic.Pointer[BackendError]
+}
+
+func (c *endpointCounters) touch() { c.lastActivity.Store(time.Now().UnixNano()) }
+
+func (c *endpointCounters) addIn(n int) {
+	if n > 0 {
+		c.bytesIn.Add(int64(n))
+		c.touch()
+	}
+}
+
+func (c *endpointCounters) addOut(n int) {
+	if n > 0 {
+		c.bytesOut.Add(int64(n))
+		c.touch()
+	}
+}
+
+func (c *endpointCounters) opened() {
+	c.active.Add(1)
+	c.total.Add(1)
+	c.touch()
+}
+
+func (c *endpointCounters) closed() { c.active.Add(-1) }
+
+func (c *endpointCounters) setBackendError(err error) {
+	if err == nil {
+		if c.backendErr.Load() != nil {
+			c.backendErr.Store(nil)
+		}
+		return
+	}
+	c.backendErr.Store(&BackendError{Message: err.Error(), At: time.Now().UTC()})
+}
+
+func (c *endpointCounters) snapshot(app, listener string) EndpointStats {
+	st := EndpointStats{
+		App:                 app,
+		Listener:            listener,
+		BytesIn:             c.bytesIn.Load(),
+		BytesOut:            c.bytesOut.Load(),
+		ActiveConnections:   c.active.Load(),
+		TotalConnections:    c.total.Load(),
+		RejectedConnections: c.rejected.Load(),
+		BackendError:        c.backendErr.Load(),
+	}
+	if ts := c.lastActivity.Load(); ts > 0 {
+		st.LastActivity = time.Unix(0, ts).UTC()
+	}
+	return st
+}
+
+// statsRegistry maps app/listener to live counters.
+type statsRegistry struct {
+	mu    sync.RWMutex
+	byKey map[statsKey]*endpointCounters
+}
+
+type statsKey struct{ app, listener string }
+
+func newStatsRegistry() *statsRegistry {
+	return &statsRegistry{byKey: make(map[statsKey]*endpointCounters)}
+}
+
+func (r *statsRegistry) counters(app, listener string) *endpointCounters {
+	key := statsKey{app, listener}
+	r.mu.RLock()
+	c := r.byKey[key]
+	r.mu.RUnlock()
+	if c != nil {
+		return c
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c = r.byKey[key]; c == nil {
+		c = &endpointCounters{}
+		r.byKey[key] = c
+	}
+	return c
+}
+
+func (r *statsRegistry) get(app, listener string) (EndpointStats, bool) {
+	r.mu.RLock()
+	c := r.byKey[statsKey{app, listener}]
+	r.mu.RUnlock()
+	if c == nil {
+		return EndpointStats{App: app, Listener: listener}, false
+	}
+	return c.snapshot(app, listener), true
+}
+
+func (r *statsRegistry) all() []EndpointStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]EndpointStats, 0, len(r.byKey))
+	for key, c := range r.byKey {
+		out = append(out, c.snapshot(key.app, key.listener))
+	}
+	return out
+}
+
+func (r *statsRegistry) forgetApp(app string) {
+	r.mu.Lock()
+	for key := range r.byKey {
+		if key.app == app {
+			delete(r.byKey, key)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// restore adds persisted cumulative totals to the live counters. Active
+// connections are a gauge and are never restored.
+func (r *statsRegistry) restore(stats []EndpointStats) {
+	for _, st := range stats {
+		c := r.counters(st.App, st.Listener)
+		c.bytesIn.Add(st.BytesIn)
+		c.bytesOut.Add(st.BytesOut)
+		c.total.Add(st.TotalConnections)
+		c.rejected.Add(st.RejectedConnections)
+		if !st.LastActivity.IsZero() {
+			ts := st.LastActivity.UnixNano()
+			for {
+				cur := c.lastActivity.Load()
+				if cur >= ts || c.lastActivity.CompareAndSwap(cur, ts) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// countingListener wraps accepted connections so bytes and connection counts
+// are attributed to an endpoint.
+type countingListener struct {
+	net.Listener
+	counters *endpointCounters
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.counters.opened()
+	return &countingConn{Conn: c, counters: l.counters}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	counters  *endpointCounters
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.counters.addIn(n)
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.counters.addOut(n)
+	return n, err
+}
+
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *countingConn) Close() error {
+	c.closeOnce.Do(c.counters.closed)
+	return c.Conn.Close()
+}
+
+// EndpointStats returns the counters for a listener; zero values are returned
+// for listeners that have not seen traffic yet.
+func (m *ServiceManager) EndpointStats(app, listener string) EndpointStats {
+	st, _ := m.proxyManager.stats.get(app, listener)
+	return st
+}
+
+// AllStats returns counters for every tracked listener, including listeners of
+// stopped apps whose history is retained.
+func (m *ServiceManager) AllStats() []EndpointStats {
+	return m.proxyManager.stats.all()
+}
+
+// ForgetAppStats discards counter history for an app (used on uninstall) and
+// persists the reduced snapshot when a store is attached.
+func (m *ServiceManager) ForgetAppStats(app string) {
+	m.proxyManager.stats.forgetApp(app)
+	m.saveStats(context.Background())
+}
+
+// StartStatsPersistence restores the last snapshot from store and then saves
+// a fresh snapshot every interval until Stop. Loading is retried on each tick
+// while the store is unavailable; nothing is saved until a load succeeds so a
+// locked boot cannot overwrite history with zeros.
+func (m *ServiceManager) StartStatsPersistence(store StatsStore, interval time.Duration) {
+	if store == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultStatsSnapshotInterval
+	}
+	m.statsMu.Lock()
+	m.statsStore = store
+	m.statsLoaded = false
+	m.statsMu.Unlock()
+	m.loadStats(context.Background())
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopCh:
+				m.saveStats(context.Background())
+				return
+			case <-ticker.C:
+				if !m.loadStats(context.Background()) {
+					continue
+				}
+				m.saveStats(context.Background())
+			}
+		}
+	}()
+}
+
+// loadStats restores the persisted snapshot once; it reports whether the
+// snapshot has been loaded.
+func (m *ServiceManager) loadStats(ctx context.Context) bool {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.statsStore == nil {
+		return false
+	}
+	if m.statsLoaded {
+		return true
+	}
+	stats, err := m.statsStore.LoadServiceStats(ctx)
+	if err != nil {
+		if !errors.Is(err, ErrStatsStoreUnavailable) {
+			log.Printf("WARN: service stats load failed: %v", err)
+		}
+		return false
+	}
+	m.proxyManager.stats.restore(stats)
+	m.statsLoaded = true
+	return true
+}
+
+func (m *ServiceManager) saveStats(ctx context.Context) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.statsStore == nil || !m.statsLoaded {
+		return
+	}
+	if err := m.statsStore.SaveServiceStats(ctx, m.proxyManager.stats.all()); err != nil && !errors.Is(err, ErrStatsStoreUnavailable) {
+		log.Printf("WARN: service stats snapshot failed: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+// listenEcho serves a line echo backend on the given loopback port.
+func listenEcho(t *testing.T, port int) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("listen backend on %d: %v", port, err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					if _, err := c.Write(line); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+	return ln
+}
+
+func echoOnce(t *testing.T, port int, msg string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, len(msg))
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+func waitForStats(t *testing.T, m *ServiceManager, app, listener string, ok func(EndpointStats) bool) EndpointStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := m.EndpointStats(app, listener)
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats for %s/%s never settled: %+v", app, listener, st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func allocateEcho(t *testing.T, m *ServiceManager) (ServiceEndpoint, net.Listener) {
+	t.Helper()
+	eps, err := m.AllocateForApp("blog", []api.AppListener{{Name: "web", GuestPort: 80, Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw}})
+	if err != nil {
+		t.Fatalf("alloc: %v", err)
+	}
+	ln := listenEcho(t, eps[0].HostBind)
+	t.Cleanup(func() { _ = ln.Close() })
+	return eps[0], ln
+}
+
+func TestServiceStatsSurviveRemoveAndReallocate(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	// Pin the allocator to probed ports; other tests leave listeners bound
+	// in the default ranges.
+	hb, pp := getFreePort(t), getFreePort(t)
+	m.allocator = NewPortAllocator(PortRange{Start: hb, End: hb}, PortRange{Start: pp, End: pp})
+
+	ep, backend := allocateEcho(t, m)
+	msg := "hello\n"
+	echoOnce(t, ep.PublicPort, msg)
+	first := waitForStats(t, m, "blog", "web", func(st EndpointStats) bool {
+		return st.ActiveConnections == 0 && st.BytesOut == int64(len(msg))
+	})
+	if first.BytesIn != int64(len(msg)) || first.TotalConnections != 1 || first.LastActivity.IsZero() {
+		t.Fatalf("unexpected stats after first connection: %+v", first)
+	}
+
+	m.RemoveApp("blog")
+	_ = backend.Close()
+	if st := m.EndpointStats("blog", "web"); st.TotalConnections != 1 {
+		t.Fatalf("expected stats retained after RemoveApp, got %+v", st)
+	}
+
+	ep, _ = allocateEcho(t, m)
+	echoOnce(t, ep.PublicPort, msg)
+	second := waitForStats(t, m, "blog", "web", func(st EndpointStats) bool {
+		return st.ActiveConnections == 0 && st.BytesOut == int64(2*len(msg))
+	})
+	if second.BytesIn != int64(2*len(msg)) || second.TotalConnections != 2 {
+		t.Fatalf("expected counters to accumulate across reallocation, got %+v", second)
+	}
+
+	m.RemoveApp("blog")
+	m.ForgetAppStats("blog")
+	if st := m.EndpointStats("blog", "web"); st.TotalConnections != 0 || st.BytesIn != 0 {
+		t.Fatalf("expected stats reset after forget, got %+v", st)
+	}
+}
+
+type memoryStatsStore struct {
+	mu          sync.Mutex
+	unavailable bool
+	saved       []EndpointStats
+	saves       int
+}
+
+func (s *memoryStatsStore) LoadServiceStats(ctx context.Context) ([]EndpointStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unavailable {
+		return nil, ErrStatsStoreUnavailable
+	}
+	return append([]EndpointStats(nil), s.saved...), nil
+}
+
+func (s *memoryStatsStore) SaveServiceStats(ctx context.Context, stats []EndpointStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unavailable {
+		return ErrStatsStoreUnavailable
+	}
+	s.saved = append([]EndpointStats(nil), stats...)
+	s.saves++
+	return nil
+}
+
+func (s *memoryStatsStore) setUnavailable(v bool) {
+	s.mu.Lock()
+	s.unavailable = v
+	s.mu.Unlock()
+}
+
+func (s *memoryStatsStore) saveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestServiceStatsPersistenceWaitsForLoad(t *testing.T) {
+	last := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStatsStore{unavailable: true, saved: []EndpointStats{
+		{App: "blog", Listener: "web", BytesIn: 10, BytesOut: 20, TotalConnections: 3, LastActivity: last},
+	}}
+	m := NewServiceManager()
+	m.proxyManager.stats.counters("blog", "web").addIn(5)
+	m.StartStatsPersistence(store, 20*time.Millisecond)
+	defer m.Stop()
+
+	time.Sleep(80 * time.Millisecond)
+	if n := store.saveCount(); n != 0 {
+		t.Fatalf("expected no saves before the snapshot was loaded, got %d", n)
+	}
+
+	store.setUnavailable(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for store.saveCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshot was never saved after the store became available")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := m.EndpointStats("blog", "web")
+	if st.BytesIn != 15 || st.BytesOut != 20 || st.TotalConnections != 3 {
+		t.Fatalf("expected persisted totals merged with live counters, got %+v", st)
+	}
+	if st.LastActivity.Before(last) {
+		t.Fatalf("expected last activity to be at least the persisted value, got %v", st.LastActivity)
+	}
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"bufio"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,10 +38,15 @@ type TlsMux struct {
 	// Routing config
 	portalHost string
 	portalPort int
-	domain     string // e.g., example.com (no trailing dot)
+	domain     string            // e.g., example.com (no trailing dot)
+	aliases    map[string]string // custom hostname → listener
+	redirects  map[string]string // custom hostname → redirect target
 
 	services *ServiceManager
 	certs    CertProvider
+
+	// connLog keeps recent connection attempts for debugging SNI routing.
+	connLog muxConnLog
 }
 
 func NewTlsMux(svc *ServiceManager) *TlsMux {
@@ -57,6 +65,23 @@ func (m *TlsMux) UpdateConfig(portalHost, domain string, portalPort int) {
 	m.mu.Unlock()
 }
 
+// UpdateAliases replaces the custom hostname → listener table. The listener
+// "portal" routes to the portal upstream.
+func (m *TlsMux) UpdateAliases(aliases map[string]string) {
+	m.mu.Lock()
+	m.aliases = aliases
+	m.mu.Unlock()
+}
+
+// UpdateRedirects replaces the custom hostname → redirect target table.
+// Connections for those hostnames are answered with a 308 to the target
+// rather than forwarded upstream.
+func (m *TlsMux) UpdateRedirects(redirects map[string]string) {
+	m.mu.Lock()
+	m.redirects = redirects
+	m.mu.Unlock()
+}
+
 func (m *TlsMux) SetCertProvider(p CertProvider) { m.mu.Lock(); m.certs = p; m.mu.Unlock() }
 
 // Start binds on 127.0.0.1:0 (ephemeral) unless already running. Returns the selected port.
@@ -150,13 +175,22 @@ func (m *TlsMux) serveTLSConn(c net.Conn, services *ServiceManager) {
 		c.Close()
 		return
 	}
+	trace := muxConnTrace{start: time.Now()}
+	defer m.connLog.record(&trace)
+	if addr, ok := tlsConn.RemoteAddr().(*net.TCPAddr); ok {
+		trace.client = addr.AddrPort().Addr().Unmap()
+	}
 	// Ensure handshake is complete so SNI is available.
 	if err := tlsConn.Handshake(); err != nil {
 		log.Printf("WARN: tlsmux handshake failed: %v", err)
+		// The server name is known once the client hello has been read.
+		trace.handshake(tlsConn.ConnectionState().ServerName, "")
+		trace.fail(MuxFailHandshake, err.Error())
 		_ = tlsConn.Close()
 		return
 	}
 	state := tlsConn.ConnectionState()
+	trace.handshake(state.ServerName, state.NegotiatedProtocol)
 	host := ""
 	if state.ServerName != "" {
 		host = strings.TrimSuffix(strings.ToLower(state.ServerName), ".")
@@ -170,48 +204,108 @@ func (m *TlsMux) serveTLSConn(c net.Conn, services *ServiceManager) {
 			hint, haveHint = services.consumeProxyHint(m.Port(), addr.Port)
 		}
 	}
+	if client, err := netip.ParseAddr(remoteClientIP(tlsConn, hint)); err == nil {
+		trace.client = client.Unmap()
+	}
 	if host == "" {
 		m.mu.RLock()
 		host = m.portalHost
 		m.mu.RUnlock()
 	}
+	m.mu.RLock()
+	target := m.redirects[host]
+	m.mu.RUnlock()
+	if target != "" {
+		trace.redirect = target
+		serveRedirect(tlsConn, target)
+		return
+	}
 	upstream := m.resolveUpstream(host)
 	if upstream == 0 {
 		log.Printf("WARN: tlsmux: unknown host %q", host)
+		trace.fail(MuxFailUnknownHost, "no route for "+strconv.Quote(host))
 		c.Close()
 		return
 	}
-backendAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(upstream))
-backend, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
-if err != nil {
-	log.Printf("WARN: tlsmux upstream dial %s failed: %v", backendAddr, err)
-	// Hint already consumed; nothing further to clean up on failure.
-	c.Close()
-	return
-}
-if services != nil {
-	if addr, ok := backend.LocalAddr().(*net.TCPAddr); ok {
-		remotePort := 0
-		if haveHint && hint.remotePort > 0 {
-			remotePort = hint.remotePort
+	trace.resolved(upstream)
+	// The listener sees the mux's loopback address, so the per-IP limit of
+	// remote clients is held here, against the client the mux is serving.
+	if services != nil {
+		release, ok := services.acquireRemoteClient(upstream, remoteClientIP(tlsConn, hint))
+		if !ok {
+			trace.fail(MuxFailClientLimit, "per-client connection limit reached")
+			c.Close()
+			return
 		}
-		isTLS := true
-		if haveHint {
-			isTLS = hint.isTLS || isTLS
+		defer release()
+	}
+	backendAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(upstream))
+	backend, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
+	if err != nil {
+		log.Printf("WARN: tlsmux upstream dial %s failed: %v", backendAddr, err)
+		trace.fail(MuxFailUpstreamDial, err.Error())
+		// Hint already consumed; nothing further to clean up on failure.
+		c.Close()
+		return
+	}
+	if services != nil {
+		if addr, ok := backend.LocalAddr().(*net.TCPAddr); ok {
+			remotePort := 0
+			if haveHint && hint.remotePort > 0 {
+				remotePort = hint.remotePort
+			}
+			isTLS := true
+			if haveHint {
+				isTLS = hint.isTLS || isTLS
+			}
+			services.RegisterProxyHint(upstream, addr.Port, remotePort, isTLS, remoteClientIP(tlsConn, hint))
+			defer services.ForgetProxyHint(upstream, addr.Port)
 		}
-		services.RegisterProxyHint(upstream, addr.Port, remotePort, isTLS)
 	}
-}
 	// Bi-directional copy: cleartext HTTP over TLS to upstream HTTP
+	copiedIn := make(chan int64, 1)
 	go func() {
-		io.Copy(backend, tlsConn)
+		n, _ := io.Copy(backend, tlsConn)
 		if tc, ok := backend.(*net.TCPConn); ok {
 			tc.CloseWrite()
 		}
+		copiedIn <- n
 	}()
-	io.Copy(tlsConn, backend)
+	trace.bytesOut, _ = io.Copy(tlsConn, backend)
 	_ = tlsConn.Close()
 	_ = backend.Close()
+	trace.bytesIn = <-copiedIn
+}
+
+// redirectIdleTimeout bounds how long a redirect connection waits for the
+// next request.
+const redirectIdleTimeout = 30 * time.Second
+
+// serveRedirect answers every request on c with a 308 to the same path and
+// query on target.
+func serveRedirect(c net.Conn, target string) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		_ = c.SetReadDeadline(time.Now().Add(redirectIdleTimeout))
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+		resp := &http.Response{
+			StatusCode: http.StatusPermanentRedirect,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Location": {"https://" + target + req.URL.RequestURI()}},
+			Close:      req.Close,
+			Request:    req,
+		}
+		if err := resp.Write(c); err != nil || req.Close {
+			return
+		}
+	}
 }
 
 func (m *TlsMux) resolveUpstream(host string) int {
@@ -219,14 +313,24 @@ func (m *TlsMux) resolveUpstream(host string) int {
 	portal := m.portalHost
 	domain := m.domain
 	portalPort := m.portalPort
+	alias, isAlias := m.aliases[host]
 	m.mu.RUnlock()
 
 	if host == "" {
 		return 0
 	}
-	if host == portal {
+	if host == portal || (isAlias && alias == "portal") {
 		return portalPort
 	}
+	if isAlias {
+		if m.services == nil {
+			return 0
+		}
+		if ep, ok := m.services.ResolveListener(alias, 443); ok && !ep.Protocol.Passthrough() {
+			return ep.PublicPort
+		}
+		return 0
+	}
 	// listener.<domain> → map to ServiceManager public_port
 	if domain != "" && strings.HasSuffix(host, "."+domain) {
 		label := strings.TrimSuffix(host, "."+domain)
@@ -234,7 +338,9 @@ func (m *TlsMux) resolveUpstream(host string) int {
 			label = label[:i]
 		}
 		if label != "" && m.services != nil {
-			if ep, ok := m.services.ResolveListener(label, 443); ok {
+			// Raw tcp/udp listeners carry their own protocol end to end;
+			// never terminate TLS on their behalf.
+			if ep, ok := m.services.ResolveRemoteLabel(label, 443); ok && !ep.Protocol.Passthrough() {
 				return ep.PublicPort
 			}
 		}
@@ -244,3 +350,12 @@ func (m *TlsMux) resolveUpstream(host string) int {
 
 // ErrNoCert is returned by a CertProvider when no certificate is available.
 var ErrNoCert = fmt.Errorf("no certificate available")
+
+// remoteClientIP is the client a mux connection serves: its peer, or for
+// connections relayed over loopback by Nexus the client the hint names.
+func remoteClientIP(c net.Conn, hint connectionHint) string {
+	if ip := limitIP(c); ip != "" {
+		return ip
+	}
+	return hint.clientIP
+}
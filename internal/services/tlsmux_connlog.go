@@ -0,0 +1,201 @@
+package services
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// muxConnLogSize is how many TLS mux connection attempts are kept.
+const muxConnLogSize = 200
+
+// MuxFailure classifies why a TLS mux connection was not forwarded.
+type MuxFailure uint8
+
+const (
+	MuxOK MuxFailure = iota
+	// MuxFailHandshake: the TLS handshake failed, e.g. no shared cipher
+	// suite or no certificate for the requested name.
+	MuxFailHandshake
+	// MuxFailUnknownHost: the SNI (or the portal fallback) routes nowhere.
+	MuxFailUnknownHost
+	// MuxFailClientLimit: the listener's per-client limit turned it away.
+	MuxFailClientLimit
+	// MuxFailUpstreamDial: the listener's local port did not accept.
+	MuxFailUpstreamDial
+	muxFailureCount
+)
+
+var muxFailureNames = [muxFailureCount]string{
+	MuxOK:               "",
+	MuxFailHandshake:    "handshake",
+	MuxFailUnknownHost:  "unknown_host",
+	MuxFailClientLimit:  "client_limit",
+	MuxFailUpstreamDial: "upstream_dial",
+}
+
+func (f MuxFailure) String() string {
+	if f < muxFailureCount {
+		return muxFailureNames[f]
+	}
+	return "unknown"
+}
+
+// MuxConnection is one TLS mux connection attempt.
+type MuxConnection struct {
+	At time.Time `json:"at"`
+	// SNI is the requested server name, "none" when the client sent none.
+	SNI  string `json:"sni"`
+	ALPN string `json:"alpn,omitempty"`
+	// Client is the remote client; outside verbose views the last octet
+	// (IPv4) or everything past the /64 (IPv6) is masked.
+	Client string `json:"client,omitempty"`
+	// Upstream is the local port the connection was forwarded to.
+	Upstream int    `json:"upstream,omitempty"`
+	Redirect string `json:"redirect,omitempty"`
+	Failure  string `json:"failure,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// MuxConnectionQuery selects what MuxConnections returns.
+type MuxConnectionQuery struct {
+	FailuresOnly bool
+	// Verbose reports full client addresses.
+	Verbose bool
+}
+
+// MuxConnections is the TLS mux connection log, newest first.
+type MuxConnections struct {
+	Connections []MuxConnection `json:"connections"`
+	// Failures counts failed attempts per class since startup, including
+	// those that have left the log.
+	Failures map[string]uint64 `json:"failures"`
+	Total    uint64            `json:"total"`
+	Capacity int               `json:"capacity"`
+}
+
+// muxConnTrace accumulates one connection's record as it is served. It
+// lives on the serving goroutine's stack and is copied into the ring when
+// the connection closes.
+type muxConnTrace struct {
+	start    time.Time
+	sni      string
+	alpn     string
+	client   netip.Addr
+	upstream int
+	redirect string
+	failure  MuxFailure
+	reason   string
+	bytesIn  int64
+	bytesOut int64
+	end      time.Time
+}
+
+// handshake records what the client asked for.
+func (t *muxConnTrace) handshake(sni, alpn string) {
+	t.sni = sni
+	t.alpn = alpn
+}
+
+// resolved records the upstream the connection is forwarded to.
+func (t *muxConnTrace) resolved(port int) { t.upstream = port }
+
+func (t *muxConnTrace) fail(f MuxFailure, reason string) {
+	t.failure = f
+	t.reason = reason
+}
+
+// muxConnLog is a fixed ring of connection traces plus failure counters.
+type muxConnLog struct {
+	mu       sync.Mutex
+	entries  [muxConnLogSize]muxConnTrace
+	next     int
+	total    uint64
+	failures [muxFailureCount]atomic.Uint64
+}
+
+// record stores t when its connection closes.
+func (l *muxConnLog) record(t *muxConnTrace) {
+	t.end = time.Now()
+	l.failures[t.failure].Add(1)
+	l.mu.Lock()
+	l.entries[l.next] = *t
+	l.next = (l.next + 1) % muxConnLogSize
+	l.total++
+	l.mu.Unlock()
+}
+
+func (l *muxConnLog) snapshot(q MuxConnectionQuery) MuxConnections {
+	out := MuxConnections{
+		Connections: []MuxConnection{},
+		Failures:    make(map[string]uint64, muxFailureCount-1),
+		Capacity:    muxConnLogSize,
+	}
+	for f := MuxFailHandshake; f < muxFailureCount; f++ {
+		out.Failures[f.String()] = l.failures[f].Load()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out.Total = l.total
+	n := muxConnLogSize
+	if l.total < muxConnLogSize {
+		n = int(l.total)
+	}
+	for i := 1; i <= n; i++ {
+		t := &l.entries[(l.next-i+muxConnLogSize)%muxConnLogSize]
+		if q.FailuresOnly && t.failure == MuxOK {
+			continue
+		}
+		out.Connections = append(out.Connections, t.view(q.Verbose))
+	}
+	return out
+}
+
+func (t *muxConnTrace) view(verbose bool) MuxConnection {
+	c := MuxConnection{
+		At:       t.start.UTC(),
+		SNI:      t.sni,
+		ALPN:     t.alpn,
+		Upstream: t.upstream,
+		Redirect: t.redirect,
+		Failure:  t.failure.String(),
+		Reason:   t.reason,
+		BytesIn:  t.bytesIn,
+		BytesOut: t.bytesOut,
+		Duration: t.end.Sub(t.start).Milliseconds(),
+	}
+	if c.SNI == "" {
+		c.SNI = "none"
+	}
+	if t.client.IsValid() {
+		c.Client = maskClient(t.client, verbose)
+	}
+	return c
+}
+
+// maskClient hides the host part of a client address: the last octet of an
+// IPv4 address, everything past the /64 of an IPv6 one.
+func maskClient(addr netip.Addr, verbose bool) string {
+	if verbose {
+		return addr.String()
+	}
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
+
+// Connections reports recent connection attempts and failure counters.
+func (m *TlsMux) Connections(q MuxConnectionQuery) MuxConnections {
+	return m.connLog.snapshot(q)
+}
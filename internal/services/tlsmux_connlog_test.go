@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testCertProvider struct{ cert *tls.Certificate }
+
+func (p testCertProvider) GetCertificate(string) (*tls.Certificate, error) { return p.cert, nil }
+
+func selfSignedCert(t *testing.T) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"portal.example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// muxClient opens a TLS connection through the mux, sends a line and reads
+// the echo back when the connection is forwarded.
+func muxClient(t *testing.T, port int, sni string, expectEcho bool) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), &tls.Config{
+		ServerName:         sni,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("dial mux (sni %q): %v", sni, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		if expectEcho {
+			t.Fatalf("write: %v", err)
+		}
+		return
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if expectEcho && (err != nil || line != "ping\n") {
+		t.Fatalf("echo through mux: %q, %v", line, err)
+	}
+}
+
+func waitForConnections(t *testing.T, mux *TlsMux, total uint64) MuxConnections {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := mux.Connections(MuxConnectionQuery{})
+		if got.Total >= total {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mux logged %d connections, want %d", got.Total, total)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTlsMuxLogsConnectionAttempts(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen backend: %v", err)
+	}
+	backend.Close()
+	backendPort := backend.Addr().(*net.TCPAddr).Port
+	ln := listenEcho(t, backendPort)
+	defer ln.Close()
+
+	mux := NewTlsMux(nil)
+	mux.SetCertProvider(testCertProvider{cert: selfSignedCert(t)})
+	mux.UpdateConfig("portal.example.com", "example.com", backendPort)
+	port, err := mux.Start()
+	if err != nil {
+		t.Fatalf("start mux: %v", err)
+	}
+	defer mux.Stop()
+
+	muxClient(t, port, "portal.example.com", true)
+	waitForConnections(t, mux, 1)
+	// Without SNI the mux falls back to the portal.
+	muxClient(t, port, "", true)
+	waitForConnections(t, mux, 2)
+	muxClient(t, port, "nope.example.com", false)
+	waitForConnections(t, mux, 3)
+	// Not TLS at all.
+	raw, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("dial raw: %v", err)
+	}
+	_, _ = raw.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	raw.Close()
+
+	got := waitForConnections(t, mux, 4)
+	if got.Capacity != muxConnLogSize || len(got.Connections) != 4 {
+		t.Fatalf("unexpected log: %+v", got)
+	}
+	// Newest first.
+	handshake, unknown, noSNI, portal := got.Connections[0], got.Connections[1], got.Connections[2], got.Connections[3]
+	if portal.SNI != "portal.example.com" || portal.Upstream != backendPort || portal.Failure != "" {
+		t.Fatalf("portal entry: %+v", portal)
+	}
+	if portal.BytesIn != 5 || portal.BytesOut != 5 {
+		t.Fatalf("portal bytes: in %d out %d", portal.BytesIn, portal.BytesOut)
+	}
+	if portal.Client != "127.0.0.0/24" {
+		t.Fatalf("client not masked: %q", portal.Client)
+	}
+	if noSNI.SNI != "none" || noSNI.Upstream != backendPort {
+		t.Fatalf("no-SNI entry: %+v", noSNI)
+	}
+	if unknown.SNI != "nope.example.com" || unknown.Failure != "unknown_host" || unknown.Upstream != 0 {
+		t.Fatalf("unknown host entry: %+v", unknown)
+	}
+	if handshake.Failure != "handshake" || handshake.Reason == "" {
+		t.Fatalf("handshake entry: %+v", handshake)
+	}
+	if got.Failures["unknown_host"] != 1 || got.Failures["handshake"] != 1 || got.Failures["upstream_dial"] != 0 {
+		t.Fatalf("failure counters: %+v", got.Failures)
+	}
+
+	failures := mux.Connections(MuxConnectionQuery{FailuresOnly: true, Verbose: true})
+	if len(failures.Connections) != 2 || failures.Total != 4 {
+		t.Fatalf("failures only: %+v", failures)
+	}
+	if failures.Connections[1].Client != "127.0.0.1" {
+		t.Fatalf("verbose client: %q", failures.Connections[1].Client)
+	}
+}
+
+func TestMuxConnLogWrapsAndCounts(t *testing.T) {
+	var l muxConnLog
+	for i := 0; i < muxConnLogSize+5; i++ {
+		tr := muxConnTrace{start: time.Now(), upstream: i}
+		if i%2 == 0 {
+			tr.fail(MuxFailUpstreamDial, "connection refused")
+		}
+		l.record(&tr)
+	}
+	got := l.snapshot(MuxConnectionQuery{})
+	if len(got.Connections) != muxConnLogSize || got.Total != muxConnLogSize+5 {
+		t.Fatalf("ring size %d total %d", len(got.Connections), got.Total)
+	}
+	if got.Connections[0].Upstream != muxConnLogSize+4 || got.Connections[muxConnLogSize-1].Upstream != 5 {
+		t.Fatalf("ring order: newest %d oldest %d", got.Connections[0].Upstream, got.Connections[muxConnLogSize-1].Upstream)
+	}
+	if got.Failures["upstream_dial"] != (muxConnLogSize+5+1)/2 {
+		t.Fatalf("counter kept only ring contents: %+v", got.Failures)
+	}
+}
+
+func TestMaskClient(t *testing.T) {
+	for in, want := range map[string]string{
+		"203.0.113.77":         "203.0.113.0/24",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+	} {
+		if got := maskClient(netip.MustParseAddr(in), false); got != want {
+			t.Fatalf("mask %s: %q, want %q", in, got, want)
+		}
+		if got := maskClient(netip.MustParseAddr(in), true); got != in {
+			t.Fatalf("verbose %s: %q", in, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"piccolod/internal/router"
+)
+
+// DefaultTunnelDialTimeout bounds how long a follower waits to reach the
+// leader before dropping a tunneled connection.
+const DefaultTunnelDialTimeout = 5 * time.Second
+
+// RouteResolver reports where traffic for an app is served. The router
+// manager satisfies it.
+type RouteResolver interface {
+	AppRoute(app string) router.Route
+}
+
+// TunnelStats counts connections a follower forwarded to the leader.
+type TunnelStats struct {
+	Connections   int64 `json:"connections"`
+	Active        int64 `json:"active"`
+	DialFailures  int64 `json:"dial_failures"`
+	LoopsRejected int64 `json:"loops_rejected"`
+	BytesIn       int64 `json:"bytes_in"`
+	BytesOut      int64 `json:"bytes_out"`
+}
+
+// tunnelForwarder splices connections for follower-held apps to the same
+// listener on the leader. Apps without a tunnel route are left alone.
+type tunnelForwarder struct {
+	mu          sync.RWMutex
+	routes      RouteResolver
+	dialTimeout time.Duration
+	// target maps an endpoint to the leader address serving it. By default
+	// the leader exposes the listener on the same public port.
+	target func(ep ServiceEndpoint, leader string) string
+
+	// sources marks the local addresses of our own outbound tunnel
+	// connections so one that comes back to us is recognised as a loop.
+	sourcesMu sync.Mutex
+	sources   map[string]struct{}
+
+	connections   atomic.Int64
+	active        atomic.Int64
+	dialFailures  atomic.Int64
+	loopsRejected atomic.Int64
+	bytesIn       atomic.Int64
+	bytesOut      atomic.Int64
+}
+
+func newTunnelForwarder() *tunnelForwarder {
+	return &tunnelForwarder{
+		dialTimeout: DefaultTunnelDialTimeout,
+		target:      leaderPublicAddr,
+		sources:     make(map[string]struct{}),
+	}
+}
+
+func leaderPublicAddr(ep ServiceEndpoint, leader string) string {
+	host := leader
+	if h, _, err := net.SplitHostPort(leader); err == nil {
+		host = h
+	}
+	return net.JoinHostPort(host, strconv.Itoa(ep.PublicPort))
+}
+
+func (t *tunnelForwarder) setRoutes(r RouteResolver) {
+	t.mu.Lock()
+	t.routes = r
+	t.mu.Unlock()
+}
+
+// leaderFor returns the leader address when ep's app is routed through a
+// tunnel.
+func (t *tunnelForwarder) leaderFor(ep ServiceEndpoint) (string, bool) {
+	t.mu.RLock()
+	routes := t.routes
+	t.mu.RUnlock()
+	if routes == nil || ep.App == "" {
+		return "", false
+	}
+	route := routes.AppRoute(ep.App)
+	if route.Mode != router.ModeTunnel || route.LeaderAddr == "" {
+		return "", false
+	}
+	return route.LeaderAddr, true
+}
+
+// isLoop reports whether forwarding client to leader would send it around
+// in a circle: either it is one of our own tunnel connections, or it came
+// from the leader itself.
+func (t *tunnelForwarder) isLoop(client net.Conn, leader string) bool {
+	remote, ok := client.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	t.sourcesMu.Lock()
+	_, own := t.sources[remote.String()]
+	t.sourcesMu.Unlock()
+	if own {
+		return true
+	}
+	host := leader
+	if h, _, err := net.SplitHostPort(leader); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsLoopback() && ip.Equal(remote.IP) {
+		return true
+	}
+	return false
+}
+
+func (t *tunnelForwarder) markSource(addr net.Addr, on bool) {
+	if addr == nil {
+		return
+	}
+	t.sourcesMu.Lock()
+	if on {
+		t.sources[addr.String()] = struct{}{}
+	} else {
+		delete(t.sources, addr.String())
+	}
+	t.sourcesMu.Unlock()
+}
+
+// forward splices client to the leader. It owns client and closes it.
+func (t *tunnelForwarder) forward(ep ServiceEndpoint, client net.Conn, leader string) {
+	defer client.Close()
+	if t.isLoop(client, leader) {
+		t.loopsRejected.Add(1)
+		log.Printf("WARN: tunnel loop detected for app=%s listener=%s from %s; dropping", ep.App, ep.Name, client.RemoteAddr())
+		return
+	}
+	t.mu.RLock()
+	target := t.target(ep, leader)
+	timeout := t.dialTimeout
+	t.mu.RUnlock()
+	upstream, err := net.DialTimeout("tcp", target, timeout)
+	if err != nil {
+		t.dialFailures.Add(1)
+		log.Printf("WARN: tunnel dial %s for app=%s listener=%s failed: %v", target, ep.App, ep.Name, err)
+		return
+	}
+	defer upstream.Close()
+	t.markSource(upstream.LocalAddr(), true)
+	defer t.markSource(upstream.LocalAddr(), false)
+	t.connections.Add(1)
+	t.active.Add(1)
+	defer t.active.Add(-1)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		t.bytesIn.Add(splice(upstream, client))
+		done <- struct{}{}
+	}()
+	go func() {
+		t.bytesOut.Add(splice(client, upstream))
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func (t *tunnelForwarder) stats() TunnelStats {
+	return TunnelStats{
+		Connections:   t.connections.Load(),
+		Active:        t.active.Load(),
+		DialFailures:  t.dialFailures.Load(),
+		LoopsRejected: t.loopsRejected.Load(),
+		BytesIn:       t.bytesIn.Load(),
+		BytesOut:      t.bytesOut.Load(),
+	}
+}
+
+// tunnelListener hands connections for follower-held apps to the tunnel and
+// returns the rest to the local proxy.
+type tunnelListener struct {
+	net.Listener
+	p  *ProxyManager
+	ep ServiceEndpoint
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		leader, ok := l.p.tunnel.leaderFor(l.ep)
+		if !ok {
+			return conn, nil
+		}
+		l.p.wg.Add(1)
+		go func(c net.Conn) {
+			defer l.p.wg.Done()
+			// The hint recorded for this connection means nothing to the
+			// leader; drop it like a raw passthrough does.
+			if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+				l.p.forgetHint(l.ep.PublicPort, addr.Port)
+				defer l.p.forgetHint(l.ep.PublicPort, addr.Port)
+			}
+			l.p.tunnel.forward(l.ep, c, leader)
+		}(conn)
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+	"piccolod/internal/router"
+)
+
+func TestTunnel_FollowerForwardsToLeaderBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "leader")
+		io.WriteString(w, "hello from leader "+r.URL.Path)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	backendPort, _ := strconv.Atoi(backendURL.Port())
+
+	// Leader node: serves the app from its local backend.
+	leader := NewServiceManager()
+	leaderRoutes := router.NewManager()
+	leader.SetRouteResolver(leaderRoutes)
+	leaderEP := ServiceEndpoint{App: "notes", Name: "web", HostBind: backendPort, PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	leader.ProxyManager().StartListener(leaderEP)
+	defer leader.ProxyManager().StopAll()
+
+	// Follower node: same listener, but nothing runs locally. Both nodes
+	// share a host here, so point the tunnel at the leader's port.
+	follower := NewServiceManager()
+	followerRoutes := router.NewManager()
+	followerRoutes.RegisterAppRoute("notes", router.ModeTunnel, "127.0.0.1")
+	follower.SetRouteResolver(followerRoutes)
+	follower.proxyManager.tunnel.target = func(ep ServiceEndpoint, leaderAddr string) string {
+		return net.JoinHostPort(leaderAddr, strconv.Itoa(leaderEP.PublicPort))
+	}
+	followerEP := ServiceEndpoint{App: "notes", Name: "web", HostBind: getFreePort(t), PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP}
+	follower.ProxyManager().StartListener(followerEP)
+	defer follower.ProxyManager().StopAll()
+
+	// Give the proxies time to bind
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://127.0.0.1:" + strconv.Itoa(followerEP.PublicPort) + "/docs")
+	if err != nil {
+		t.Fatalf("request via follower: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from leader /docs" || resp.Header.Get("X-Served-By") != "leader" {
+		t.Fatalf("unexpected response %d %q headers=%v", resp.StatusCode, body, resp.Header)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		st := follower.TunnelStats()
+		if st.Connections == 1 && st.Active == 0 && st.BytesIn > 0 && st.BytesOut > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected follower tunnel stats %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := leader.TunnelStats(); st.Connections != 0 {
+		t.Fatalf("leader should serve locally, tunnel stats %+v", st)
+	}
+}
+
+func TestTunnel_RejectsLoopAndCountsDialFailures(t *testing.T) {
+	pm := NewProxyManager()
+	routes := router.NewManager()
+	routes.RegisterAppRoute("notes", router.ModeTunnel, "127.0.0.1")
+	pm.SetRouteResolver(routes)
+	ep := ServiceEndpoint{App: "notes", Name: "ssh", HostBind: getFreePort(t), PublicPort: getFreePort(t), Flow: api.FlowTCP, Protocol: api.ListenerProtocolRaw}
+	pm.StartListener(ep)
+	defer pm.StopAll()
+	time.Sleep(100 * time.Millisecond)
+
+	// The leader address points back at this node: the tunnel must notice
+	// its own connection arriving instead of forwarding forever.
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.PublicPort)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected looping connection to be closed")
+	}
+	conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for pm.TunnelStats().LoopsRejected == 0 || pm.TunnelStats().Active != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("loop not detected: %+v", pm.TunnelStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// An unreachable leader is counted and the client is dropped.
+	unreachable := net.JoinHostPort("127.0.0.1", strconv.Itoa(getFreePort(t)))
+	pm.tunnel.mu.Lock()
+	pm.tunnel.target = func(ServiceEndpoint, string) string { return unreachable }
+	pm.tunnel.mu.Unlock()
+	conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(ep.PublicPort)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected connection to be closed when leader is unreachable")
+	}
+	if st := pm.TunnelStats(); st.DialFailures == 0 {
+		t.Fatalf("dial failure not counted: %+v", st)
+	}
+}
@@ -1,6 +1,10 @@
 package services
 
-import "piccolod/internal/api"
+import (
+	"fmt"
+
+	"piccolod/internal/api"
+)
 
 // PortRange defines an inclusive range of ports
 type PortRange struct {
@@ -19,4 +23,82 @@ type ServiceEndpoint struct {
 	Protocol    api.ListenerProtocol
 	Middleware  []api.AppProtocolMiddleware
 	RemotePorts []int
+	// RemoteSubdomain is the listener's explicit remote label, if any.
+	RemoteSubdomain string
+	// InternalHost sends the backend its own address as Host instead of the
+	// client's (preserve_host: false).
+	InternalHost bool
+	// BackendTLS pins the backend certificate of an https listener; nil
+	// accepts any certificate.
+	BackendTLS *api.ListenerBackendTLS
+	// Limits are the listener's own connection limits; zero fields fall
+	// back to the system defaults.
+	Limits ConnectionLimits
+	// PathPrefix is the portal path the listener is also served under, if
+	// any. StripPrefix removes it from the paths the backend sees and
+	// PublicPath serves it without a portal session.
+	PathPrefix  string
+	StripPrefix bool
+	PublicPath  bool
+}
+
+// RemoteLabel is the DNS label the endpoint is published under remotely:
+// the listener's remote_subdomain, or its name.
+func (ep ServiceEndpoint) RemoteLabel() string {
+	return api.AppListener{Name: ep.Name, RemoteSubdomain: ep.RemoteSubdomain}.RemoteLabel()
+}
+
+// ServesRemotePort reports whether the endpoint is reachable on remotePort
+// through Nexus. HTTP listeners without explicit remote ports serve 80 and
+// 443; raw ones serve only the ports they ask for. A port of zero or less
+// matches every endpoint.
+func (ep ServiceEndpoint) ServesRemotePort(remotePort int) bool {
+	original := remotePort
+	remotePort = normalizeRemotePort(remotePort)
+	if remotePort <= 0 {
+		return true
+	}
+	if len(ep.RemotePorts) == 0 {
+		if ep.Protocol.Passthrough() {
+			return false
+		}
+		return remotePort == 80 || remotePort == 443
+	}
+	for _, rp := range ep.RemotePorts {
+		if rp == remotePort || rp == original {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteHostConflictError reports a listener whose remote hostname label is
+// already published by another app.
+type RemoteHostConflictError struct {
+	Label         string
+	App           string
+	Listener      string
+	OtherApp      string
+	OtherListener string
+}
+
+func (e *RemoteHostConflictError) Error() string {
+	return fmt.Sprintf("listener %s of app %s would publish remote hostname label %q, already used by listener %s of app %s; set remote_subdomain to pick another",
+		e.Listener, e.App, e.Label, e.OtherListener, e.OtherApp)
+}
+
+// PathPrefixConflictError reports a listener whose path_prefix overlaps the
+// portal path of another app's listener.
+type PathPrefixConflictError struct {
+	Prefix        string
+	App           string
+	Listener      string
+	OtherApp      string
+	OtherListener string
+	OtherPrefix   string
+}
+
+func (e *PathPrefixConflictError) Error() string {
+	return fmt.Sprintf("listener %s of app %s would be served under %s, which overlaps %s of listener %s of app %s; set another path_prefix",
+		e.Listener, e.App, e.Prefix, e.OtherPrefix, e.OtherListener, e.OtherApp)
 }
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultUDPSessionIdleTimeout bounds how long a UDP peer mapping survives
+// without traffic in either direction.
+const DefaultUDPSessionIdleTimeout = 2 * time.Minute
+
+// DefaultUDPMaxSessions caps the peer sessions of one relay. Each session
+// holds a backend socket and a goroutine, so a flood of spoofed sources must
+// not be able to open them without bound.
+const DefaultUDPMaxSessions = 1024
+
+// errUDPSessionLimit is returned for a new peer while the relay is full.
+var errUDPSessionLimit = errors.New("udp session limit reached")
+
+const udpMaxDatagram = 64 * 1024
+
+// udpRelay forwards datagrams between a public UDP socket and a loopback
+// backend. Each remote peer gets its own upstream socket so replies can be
+// routed back NAT-style; sessions expire after the idle timeout. Once
+// maxSessions peers are live, datagrams from new peers are dropped and
+// counted as rejected until a session expires.
+type udpRelay struct {
+	conn        *net.UDPConn
+	backend     *net.UDPAddr
+	idle        time.Duration
+	maxSessions int
+	label       string
+	counters    *endpointCounters
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+	full     bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type udpSession struct {
+	peer     *net.UDPAddr
+	upstream *net.UDPConn
+
+	mu       sync.Mutex
+	lastSeen time.Time
+}
+
+func (s *udpSession) touch() {
+	s.mu.Lock()
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *udpSession) idleFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastSeen)
+}
+
+func newUDPRelay(conn *net.UDPConn, backend *net.UDPAddr, idle time.Duration, maxSessions int, label string) *udpRelay {
+	if idle <= 0 {
+		idle = DefaultUDPSessionIdleTimeout
+	}
+	if maxSessions <= 0 {
+		maxSessions = DefaultUDPMaxSessions
+	}
+	return &udpRelay{
+		conn:        conn,
+		backend:     backend,
+		idle:        idle,
+		maxSessions: maxSessions,
+		label:       label,
+		counters:    &endpointCounters{},
+		sessions:    make(map[string]*udpSession),
+	}
+}
+
+// serve reads client datagrams until the public socket is closed.
+func (r *udpRelay) serve() {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		n, peer, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			log.Printf("WARN: UDP relay %s read failed: %v", r.label, err)
+			return
+		}
+		sess, err := r.session(peer)
+		if errors.Is(err, errUDPSessionLimit) {
+			r.counters.rejected.Add(1)
+			continue
+		}
+		if err != nil {
+			log.Printf("WARN: UDP relay %s backend dial failed: %v", r.label, err)
+			continue
+		}
+		sess.touch()
+		r.counters.addIn(n)
+		if _, err := sess.upstream.Write(buf[:n]); err != nil {
+			log.Printf("WARN: UDP relay %s forward to backend failed: %v", r.label, err)
+		}
+	}
+}
+
+func (r *udpRelay) session(peer *net.UDPAddr) (*udpSession, error) {
+	key := peer.String()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, net.ErrClosed
+	}
+	if sess, ok := r.sessions[key]; ok {
+		return sess, nil
+	}
+	if len(r.sessions) >= r.maxSessions {
+		if !r.full {
+			r.full = true
+			log.Printf("WARN: UDP relay %s has %d peer sessions; dropping datagrams from new peers", r.label, len(r.sessions))
+		}
+		return nil, errUDPSessionLimit
+	}
+	r.full = false
+	upstream, err := net.DialUDP("udp", nil, r.backend)
+	if err != nil {
+		return nil, err
+	}
+	sess := &udpSession{peer: peer, upstream: upstream, lastSeen: time.Now()}
+	r.sessions[key] = sess
+	r.counters.opened()
+	r.wg.Add(1)
+	go r.pump(key, sess)
+	return sess, nil
+}
+
+// pump copies backend replies to the peer and retires the session once it
+// has been idle for longer than the timeout.
+func (r *udpRelay) pump(key string, sess *udpSession) {
+	defer r.wg.Done()
+	defer r.drop(key, sess)
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		_ = sess.upstream.SetReadDeadline(time.Now().Add(r.idle))
+		n, err := sess.upstream.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if sess.idleFor() >= r.idle {
+					return
+				}
+				continue
+			}
+			// ECONNREFUSED surfaces here when the backend is not listening;
+			// keep the session so the peer can retry once it comes up.
+			if !errors.Is(err, net.ErrClosed) && sess.idleFor() < r.idle {
+				continue
+			}
+			return
+		}
+		sess.touch()
+		r.counters.addOut(n)
+		if _, err := r.conn.WriteToUDP(buf[:n], sess.peer); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("WARN: UDP relay %s reply to %s failed: %v", r.label, sess.peer, err)
+		}
+	}
+}
+
+func (r *udpRelay) drop(key string, sess *udpSession) {
+	r.mu.Lock()
+	if r.sessions[key] == sess {
+		delete(r.sessions, key)
+		r.counters.closed()
+	}
+	r.mu.Unlock()
+	_ = sess.upstream.Close()
+}
+
+// sessionCount reports the number of live peer sessions.
+func (r *udpRelay) sessionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+// Close stops the relay and tears down all peer sessions.
+func (r *udpRelay) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	sessions := make([]*udpSession, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		sessions = append(sessions, sess)
+	}
+	r.mu.Unlock()
+
+	err := r.conn.Close()
+	for _, sess := range sessions {
+		_ = sess.upstream.Close()
+	}
+	r.wg.Wait()
+	return err
+}
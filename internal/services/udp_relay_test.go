@@ -0,0 +1,237 @@
+package services
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"piccolod/internal/api"
+)
+
+// startUDPEchoBackend starts a UDP echo server on 127.0.0.1:0 and returns its port.
+func startUDPEchoBackend(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to start udp backend: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, peer, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteToUDP(buf[:n], peer)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func getFreeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatalf("failed to get free udp port: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	_ = conn.Close()
+	return port
+}
+
+func udpRoundTrip(t *testing.T, conn *net.UDPConn, msg string) string {
+	t.Helper()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("udp write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("udp read: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestProxy_UDPEchoThroughRelay(t *testing.T) {
+	hb := startUDPEchoBackend(t)
+	pm := NewProxyManager()
+	pm.SetUDPIdleTimeout(200 * time.Millisecond)
+	public := getFreeUDPPort(t)
+	ep := ServiceEndpoint{App: "vpn", Name: "wg", HostBind: hb, PublicPort: public, Flow: api.FlowTCP, Protocol: api.ListenerProtocolUDP}
+	pm.StartListener(ep)
+	defer pm.StopAll()
+
+	target := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: public}
+	a, err := net.DialUDP("udp", nil, target)
+	if err != nil {
+		t.Fatalf("dial a: %v", err)
+	}
+	defer a.Close()
+	b, err := net.DialUDP("udp", nil, target)
+	if err != nil {
+		t.Fatalf("dial b: %v", err)
+	}
+	defer b.Close()
+
+	if got := udpRoundTrip(t, a, "ping-a"); got != "ping-a" {
+		t.Fatalf("peer a got %q", got)
+	}
+	if got := udpRoundTrip(t, b, "ping-b"); got != "ping-b" {
+		t.Fatalf("peer b got %q", got)
+	}
+
+	pm.mu.Lock()
+	relay := pm.relays[public]
+	pm.mu.Unlock()
+	if relay == nil {
+		t.Fatalf("expected relay registered for port %d", public)
+	}
+	if n := relay.sessionCount(); n != 2 {
+		t.Fatalf("expected a session per peer, got %d", n)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for relay.sessionCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle sessions were not reaped")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// A fresh datagram after expiry re-establishes the mapping.
+	if got := udpRoundTrip(t, a, "again"); got != "again" {
+		t.Fatalf("peer a after idle got %q", got)
+	}
+
+	pm.StopPort(public)
+	if relay.sessionCount() != 0 {
+		t.Fatalf("expected sessions torn down on stop")
+	}
+}
+
+func TestProxy_UDPRelayCapsPeerSessions(t *testing.T) {
+	hb := startUDPEchoBackend(t)
+	pm := NewProxyManager()
+	pm.SetUDPMaxSessions(2)
+	public := getFreeUDPPort(t)
+	ep := ServiceEndpoint{App: "vpn", Name: "wg", HostBind: hb, PublicPort: public, Flow: api.FlowTCP, Protocol: api.ListenerProtocolUDP}
+	pm.StartListener(ep)
+	defer pm.StopAll()
+
+	target := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: public}
+	peers := make([]*net.UDPConn, 3)
+	for i := range peers {
+		conn, err := net.DialUDP("udp", nil, target)
+		if err != nil {
+			t.Fatalf("dial peer %d: %v", i, err)
+		}
+		defer conn.Close()
+		peers[i] = conn
+	}
+	for i, conn := range peers[:2] {
+		if got := udpRoundTrip(t, conn, "ping"); got != "ping" {
+			t.Fatalf("peer %d got %q", i, got)
+		}
+	}
+
+	// The third peer is over the cap: its datagrams are dropped, not relayed.
+	for range 2 {
+		if _, err := peers[2].Write([]byte("flood")); err != nil {
+			t.Fatalf("udp write: %v", err)
+		}
+	}
+	_ = peers[2].SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if n, err := peers[2].Read(make([]byte, 64)); err == nil {
+		t.Fatalf("peer over the cap got a reply of %d bytes", n)
+	}
+
+	pm.mu.Lock()
+	relay := pm.relays[public]
+	pm.mu.Unlock()
+	if n := relay.sessionCount(); n != 2 {
+		t.Fatalf("expected the session count capped at 2, got %d", n)
+	}
+	if st := relay.counters.snapshot("vpn", "wg"); st.RejectedConnections != 2 || st.TotalConnections != 2 {
+		t.Fatalf("expected 2 rejected datagrams and 2 sessions opened, got %+v", st)
+	}
+	// Peers with a session keep working while the relay is full.
+	if got := udpRoundTrip(t, peers[0], "still"); got != "still" {
+		t.Fatalf("peer 0 at cap got %q", got)
+	}
+}
+
+func TestProxy_TCPPassthroughHalfClose(t *testing.T) {
+	// Backend reads until EOF, then replies and closes: only works if the
+	// proxy forwards the client's half-close and keeps the return path open.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		data, _ := io.ReadAll(c)
+		_, _ = c.Write([]byte("got:" + string(data)))
+	}()
+
+	pm := NewProxyManager()
+	public := getFreePort(t)
+	ep := ServiceEndpoint{App: "game", Name: "srv", HostBind: ln.Addr().(*net.TCPAddr).Port, PublicPort: public, Flow: api.FlowTCP, Protocol: api.ListenerProtocolTCP}
+	pm.StartListener(ep)
+	defer pm.StopAll()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(public)))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("close write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if string(reply) != "got:hello" {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+}
+
+func TestServiceManagerPassthroughRemotePorts(t *testing.T) {
+	m := NewServiceManager()
+	defer m.StopAll()
+	eps, err := m.AllocateForApp("game", []api.AppListener{
+		{Name: "web", GuestPort: 8080, Flow: api.FlowTCP, Protocol: api.ListenerProtocolHTTP},
+		{Name: "srv", GuestPort: 25565, Flow: api.FlowTCP, Protocol: api.ListenerProtocolTCP, RemotePorts: []int{25565}},
+		{Name: "voice", GuestPort: 9987, Flow: api.FlowTCP, Protocol: api.ListenerProtocolUDP},
+	})
+	if err != nil {
+		t.Fatalf("alloc: %v", err)
+	}
+	for _, ep := range eps {
+		if ep.Name == "voice" && len(ep.RemotePorts) != 0 {
+			t.Fatalf("udp listener without requested ports must not default to 80/443: %v", ep.RemotePorts)
+		}
+	}
+	if _, ok := m.ResolveListener("voice", 443); ok {
+		t.Fatalf("raw listener must not resolve on web ports")
+	}
+	ports := m.PassthroughRemotePorts()
+	if len(ports) != 1 || ports[25565].Name != "srv" {
+		t.Fatalf("unexpected passthrough ports: %+v", ports)
+	}
+	if ep, ok := m.ResolveByRemotePort(25565); !ok || ep.Name != "srv" {
+		t.Fatalf("expected remote port 25565 to resolve to srv, got %+v ok=%v", ep, ok)
+	}
+}
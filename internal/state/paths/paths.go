@@ -38,6 +38,7 @@ func ControlDir() string   { return Join("control") }
 func ExportsDir() string   { return Join("exports") }
 func BootstrapDir() string { return Join("bootstrap") }
 func VolumesDir() string   { return Join("volumes") }
+func RunDir() string       { return Join("run") }
 
 // SetRootForTest resets the cached root so tests can override PICCOLO_STATE_DIR.
 func SetRootForTest(dir string) {
@@ -0,0 +1,165 @@
+package update
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Package describes a pending package update reported by Check.
+type Package struct {
+	Name      string `json:"name"`
+	Current   string `json:"current_version"`
+	Available string `json:"available_version"`
+	Repo      string `json:"repository,omitempty"`
+}
+
+// Snapshot is a root filesystem snapshot managed by snapper.
+type Snapshot struct {
+	ID          int       `json:"id"`
+	Date        time.Time `json:"date,omitzero"`
+	Description string    `json:"description"`
+	// Active marks the snapshot the system is currently booted into.
+	Active bool `json:"active"`
+	// Default marks the snapshot that will be booted next.
+	Default bool `json:"default"`
+}
+
+// Backend abstracts the transactional-update tooling so the manager can be
+// exercised without touching the host.
+type Backend interface {
+	Check(ctx context.Context) ([]Package, error)
+	// Apply installs updates into a new snapshot, streaming output lines to
+	// progress. The new snapshot only takes effect after a reboot.
+	Apply(ctx context.Context, progress func(line string)) error
+	Snapshots(ctx context.Context) ([]Snapshot, error)
+	Rollback(ctx context.Context, id int) error
+	Reboot(ctx context.Context) error
+}
+
+// TransactionalUpdate drives MicroOS updates through the host CLIs.
+// transactional-update has no read-only check mode, so Check asks zypper
+// directly; snapshots are listed via snapper.
+type TransactionalUpdate struct{}
+
+func (TransactionalUpdate) Check(ctx context.Context) ([]Package, error) {
+	out, err := exec.CommandContext(ctx, "zypper", "--non-interactive", "--quiet", "list-updates").Output()
+	if err != nil {
+		return nil, commandError("zypper list-updates", err)
+	}
+	return parseZypperUpdates(string(out)), nil
+}
+
+func (TransactionalUpdate) Apply(ctx context.Context, progress func(line string)) error {
+	cmd := exec.CommandContext(ctx, "transactional-update", "--non-interactive", "--drop-if-no-change", "dup")
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && progress != nil {
+				progress(line)
+			}
+		}
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Wait()
+	_ = pw.Close()
+	wg.Wait()
+	if err != nil {
+		return commandError("transactional-update dup", err)
+	}
+	return nil
+}
+
+func (TransactionalUpdate) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	out, err := exec.CommandContext(ctx, "snapper", "--jsonout", "list").Output()
+	if err != nil {
+		return nil, commandError("snapper list", err)
+	}
+	return parseSnapperList(out)
+}
+
+func (TransactionalUpdate) Rollback(ctx context.Context, id int) error {
+	out, err := exec.CommandContext(ctx, "transactional-update", "--non-interactive", "rollback", strconv.Itoa(id)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("transactional-update rollback: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (TransactionalUpdate) Reboot(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "transactional-update", "reboot").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("transactional-update reboot: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func commandError(what string, err error) error {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return fmt.Errorf("%s: %w: %s", what, err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// parseZypperUpdates reads the table printed by `zypper list-updates`:
+//
+//	S | Repository | Name | Current Version | Available Version | Arch
+func parseZypperUpdates(out string) []Package {
+	var pkgs []Package
+	for _, line := range strings.Split(out, "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) < 6 {
+			continue
+		}
+		for i := range cols {
+			cols[i] = strings.TrimSpace(cols[i])
+		}
+		if cols[0] != "v" {
+			continue
+		}
+		pkgs = append(pkgs, Package{Repo: cols[1], Name: cols[2], Current: cols[3], Available: cols[4]})
+	}
+	return pkgs
+}
+
+// parseSnapperList decodes `snapper --jsonout list` for the root config.
+func parseSnapperList(data []byte) ([]Snapshot, error) {
+	var doc map[string][]struct {
+		Number      int    `json:"number"`
+		Default     bool   `json:"default"`
+		Active      bool   `json:"active"`
+		Date        string `json:"date"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode snapper output: %w", err)
+	}
+	var out []Snapshot
+	for _, s := range doc["root"] {
+		if s.Number == 0 {
+			continue // snapshot 0 is snapper's placeholder for the live system
+		}
+		snap := Snapshot{ID: s.Number, Description: s.Description, Active: s.Active, Default: s.Default}
+		if ts, err := time.ParseInLocation("2006-01-02 15:04:05", s.Date, time.Local); err == nil {
+			snap.Date = ts.UTC()
+		}
+		out = append(out, snap)
+	}
+	return out, nil
+}
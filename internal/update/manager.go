@@ -1,13 +1,428 @@
 package update
 
-import "log"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
 
-type Manager struct{}
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
 
-func NewManager() *Manager {
-	log.Println("INFO: Update Manager initialized (placeholder)")
-	return &Manager{}
+const (
+	KindApply    = "apply"
+	KindRollback = "rollback"
+)
+
+// JobState tracks an OS update job from start to the reboot that activates it.
+type JobState string
+
+const (
+	JobRunning       JobState = "running"
+	JobPendingReboot JobState = "pending_reboot"
+	JobRebooting     JobState = "rebooting"
+	JobSucceeded     JobState = "succeeded"
+	JobFailed        JobState = "failed"
+)
+
+const (
+	StepInstall  = "install"
+	StepRollback = "rollback"
+	StepReboot   = "reboot"
+)
+
+const maxJobLog = 50
+
+var (
+	ErrJobInProgress    = errors.New("update: another update job is in progress")
+	ErrSnapshotNotFound = errors.New("update: snapshot not found")
+)
+
+// Job is the persisted record of the most recent apply or rollback.
+type Job struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	State      JobState  `json:"state"`
+	Step       string    `json:"step"`
+	Reboot     bool      `json:"reboot"`
+	Snapshot   int       `json:"snapshot,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Log        []string  `json:"log,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+func (j Job) active() bool { return j.State == JobRunning || j.State == JobRebooting }
+
+// CheckResult is the outcome of the most recent update check.
+type CheckResult struct {
+	Packages  []Package `json:"packages"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Status summarises the update state for the API.
+type Status struct {
+	PendingReboot bool         `json:"pending_reboot"`
+	LastCheck     *CheckResult `json:"last_check,omitempty"`
+	Job           *Job         `json:"job,omitempty"`
+}
+
+// ApplyOptions controls whether a successful apply reboots straight away.
+type ApplyOptions struct {
+	Reboot bool
+}
+
+// Manager runs OS update jobs one at a time and records them in the control
+// store. The persisted job is reconciled against the booted snapshot the
+// first time the store is readable, so an update interrupted by a reboot (or
+// completed by one) reports what happened.
+type Manager struct {
+	backend Backend
+	repo    persistence.OSUpdateRepo
+	bus     *events.Bus
+	now     func() time.Time
+
+	mu        sync.Mutex
+	job       *Job
+	loaded    bool
+	lastCheck *CheckResult
+	wg        sync.WaitGroup
+}
+
+// NewManager constructs an update manager; bus may be nil.
+func NewManager(backend Backend, repo persistence.OSUpdateRepo, bus *events.Bus) *Manager {
+	return &Manager{backend: backend, repo: repo, bus: bus, now: time.Now}
+}
+
+// Status reports the current job and whether a reboot is pending.
+func (m *Manager) Status(ctx context.Context) Status {
+	m.load(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{LastCheck: m.lastCheck}
+	if m.job != nil {
+		job := cloneJob(*m.job)
+		st.Job = &job
+		st.PendingReboot = job.State == JobPendingReboot
+	}
+	return st
+}
+
+// Check lists available package updates.
+func (m *Manager) Check(ctx context.Context) (CheckResult, error) {
+	pkgs, err := m.backend.Check(ctx)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	res := CheckResult{Packages: pkgs, CheckedAt: m.now().UTC()}
+	if res.Packages == nil {
+		res.Packages = []Package{}
+	}
+	m.mu.Lock()
+	m.lastCheck = &res
+	m.mu.Unlock()
+	return res, nil
+}
+
+// Snapshots lists root filesystem snapshots.
+func (m *Manager) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	return m.backend.Snapshots(ctx)
+}
+
+// Apply starts an asynchronous update job. With opts.Reboot the job reboots
+// into the new snapshot once installation succeeds; otherwise it stops at
+// pending_reboot.
+func (m *Manager) Apply(ctx context.Context, opts ApplyOptions) (Job, error) {
+	m.load(ctx)
+	job, err := m.begin(KindApply, StepInstall, opts.Reboot)
+	if err != nil {
+		return Job{}, err
+	}
+	m.wg.Add(1)
+	go m.runApply(job.ID, opts.Reboot)
+	return job, nil
+}
+
+// Rollback makes snapshot id the default for the next boot. The job stays at
+// pending_reboot until the device restarts into it.
+func (m *Manager) Rollback(ctx context.Context, id int) (Job, error) {
+	m.load(ctx)
+	snaps, err := m.backend.Snapshots(ctx)
+	if err != nil {
+		return Job{}, err
+	}
+	found := false
+	for _, s := range snaps {
+		if s.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return Job{}, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+	}
+	job, err := m.begin(KindRollback, StepRollback, false)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := m.backend.Rollback(ctx, id); err != nil {
+		m.finish(job.ID, JobFailed, 0, err)
+		return m.current(), err
+	}
+	m.finish(job.ID, JobPendingReboot, id, nil)
+	return m.current(), nil
+}
+
+// ReloadFromStorage loads and settles the persisted job after the control
+// store unlocks.
+func (m *Manager) ReloadFromStorage() error {
+	m.load(context.Background())
+	return nil
+}
+
+// Wait blocks until running jobs return; used by tests and shutdown.
+func (m *Manager) Wait() { m.wg.Wait() }
+
+func (m *Manager) runApply(id string, reboot bool) {
+	defer m.wg.Done()
+	ctx := context.Background()
+	err := m.backend.Apply(ctx, func(line string) { m.progress(id, line) })
+	if err != nil {
+		m.finish(id, JobFailed, 0, err)
+		return
+	}
+	snap, changed, err := m.nextSnapshot(ctx)
+	if err != nil {
+		m.finish(id, JobFailed, 0, err)
+		return
+	}
+	if !changed {
+		m.progress(id, "system already up to date")
+		m.finish(id, JobSucceeded, 0, nil)
+		return
+	}
+	if !reboot {
+		m.finish(id, JobPendingReboot, snap, nil)
+		return
+	}
+	m.update(id, func(j *Job) {
+		j.State = JobRebooting
+		j.Step = StepReboot
+		j.Snapshot = snap
+	})
+	if err := m.backend.Reboot(ctx); err != nil {
+		m.finish(id, JobFailed, snap, fmt.Errorf("reboot: %w", err))
+	}
+}
+
+// nextSnapshot returns the default snapshot and whether it differs from the
+// one currently booted.
+func (m *Manager) nextSnapshot(ctx context.Context) (int, bool, error) {
+	snaps, err := m.backend.Snapshots(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	var active, def int
+	for _, s := range snaps {
+		if s.Active {
+			active = s.ID
+		}
+		if s.Default {
+			def = s.ID
+		}
+	}
+	return def, def != 0 && def != active, nil
+}
+
+func (m *Manager) begin(kind, step string, reboot bool) (Job, error) {
+	m.mu.Lock()
+	if m.job != nil && m.job.active() {
+		m.mu.Unlock()
+		return Job{}, ErrJobInProgress
+	}
+	now := m.now().UTC()
+	job := &Job{
+		ID:        newJobID(),
+		Kind:      kind,
+		State:     JobRunning,
+		Step:      step,
+		Reboot:    reboot,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	m.job = job
+	snapshot := cloneJob(*job)
+	m.mu.Unlock()
+	m.persist(snapshot)
+	m.publish(snapshot, "")
+	return snapshot, nil
 }
 
-func (m *Manager) CheckForOSUpdate() (string, error) { return "v0.0.0", nil }
-func (m *Manager) ApplyOSUpdate() error { return nil }
+func (m *Manager) progress(id, line string) {
+	m.mu.Lock()
+	if m.job == nil || m.job.ID != id {
+		m.mu.Unlock()
+		return
+	}
+	m.job.Log = append(m.job.Log, line)
+	if len(m.job.Log) > maxJobLog {
+		m.job.Log = m.job.Log[len(m.job.Log)-maxJobLog:]
+	}
+	m.job.UpdatedAt = m.now().UTC()
+	snapshot := cloneJob(*m.job)
+	m.mu.Unlock()
+	// Output lines are streamed on the bus only; the job is persisted on
+	// state transitions so a long install doesn't churn the control store.
+	m.publish(snapshot, line)
+}
+
+func (m *Manager) finish(id string, state JobState, snap int, cause error) {
+	m.update(id, func(j *Job) {
+		j.State = state
+		if snap != 0 {
+			j.Snapshot = snap
+		}
+		if cause != nil {
+			j.Error = cause.Error()
+		}
+		if state != JobPendingReboot {
+			j.FinishedAt = m.now().UTC()
+		}
+	})
+}
+
+func (m *Manager) update(id string, mutate func(*Job)) {
+	m.mu.Lock()
+	if m.job == nil || m.job.ID != id {
+		m.mu.Unlock()
+		return
+	}
+	mutate(m.job)
+	m.job.UpdatedAt = m.now().UTC()
+	snapshot := cloneJob(*m.job)
+	m.mu.Unlock()
+	m.persist(snapshot)
+	m.publish(snapshot, "")
+}
+
+func (m *Manager) current() Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job == nil {
+		return Job{}
+	}
+	return cloneJob(*m.job)
+}
+
+// load restores the persisted job once the control store is readable and
+// settles jobs that a reboot or crash left unfinished.
+func (m *Manager) load(ctx context.Context) {
+	m.mu.Lock()
+	if m.loaded || m.repo == nil {
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	rec, err := m.repo.CurrentJob(ctx)
+	if err != nil && !errors.Is(err, persistence.ErrNotFound) {
+		return // locked or unavailable; retry on the next call
+	}
+	var stored *Job
+	if err == nil {
+		var job Job
+		if err := json.Unmarshal(rec.Payload, &job); err != nil {
+			log.Printf("WARN: os update job decode failed: %v", err)
+		} else {
+			stored = &job
+		}
+	}
+
+	m.mu.Lock()
+	if m.loaded {
+		m.mu.Unlock()
+		return
+	}
+	m.loaded = true
+	if m.job != nil || stored == nil {
+		m.mu.Unlock()
+		return
+	}
+	m.job = stored
+	m.mu.Unlock()
+	m.reconcile(ctx, *stored)
+	// Announce the restored state so observers (health) catch up after boot.
+	m.publish(m.current(), "")
+}
+
+func (m *Manager) reconcile(ctx context.Context, job Job) {
+	switch job.State {
+	case JobRunning:
+		m.finish(job.ID, JobFailed, 0, errors.New("interrupted before the update finished"))
+	case JobPendingReboot, JobRebooting:
+		snaps, err := m.backend.Snapshots(ctx)
+		if err != nil {
+			log.Printf("WARN: os update reconcile: %v", err)
+			return
+		}
+		var active int
+		for _, s := range snaps {
+			if s.Active {
+				active = s.ID
+			}
+		}
+		switch {
+		case job.Snapshot != 0 && active == job.Snapshot:
+			m.finish(job.ID, JobSucceeded, 0, nil)
+		case job.State == JobRebooting:
+			m.finish(job.ID, JobFailed, 0, fmt.Errorf("booted snapshot %d instead of %d", active, job.Snapshot))
+		}
+	}
+}
+
+func (m *Manager) persist(job Job) {
+	if m.repo == nil {
+		return
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("WARN: os update job encode failed: %v", err)
+		return
+	}
+	if err := m.repo.SaveJob(context.Background(), persistence.OSUpdateJob{Payload: data}); err != nil {
+		log.Printf("WARN: os update job %s not persisted: %v", job.ID, err)
+	}
+}
+
+func (m *Manager) publish(job Job, message string) {
+	if m.bus == nil {
+		return
+	}
+	m.bus.Publish(events.Event{Topic: events.TopicOSUpdate, Payload: events.OSUpdateProgress{
+		JobID:   job.ID,
+		Kind:    job.Kind,
+		State:   string(job.State),
+		Step:    job.Step,
+		Message: message,
+	}})
+}
+
+func cloneJob(j Job) Job {
+	if j.Log != nil {
+		j.Log = append([]string(nil), j.Log...)
+	}
+	return j
+}
+
+func newJobID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,254 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+type fakeBackend struct {
+	mu        sync.Mutex
+	snapshots []Snapshot
+	output    []string
+	applyErr  error
+	release   chan struct{}
+	reboots   int
+	rollbacks []int
+}
+
+func (f *fakeBackend) Check(ctx context.Context) ([]Package, error) {
+	return []Package{{Name: "kernel-default", Current: "6.1", Available: "6.2"}}, nil
+}
+
+func (f *fakeBackend) Apply(ctx context.Context, progress func(string)) error {
+	if f.release != nil {
+		<-f.release
+	}
+	for _, line := range f.output {
+		progress(line)
+	}
+	if f.applyErr != nil {
+		return f.applyErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := 0
+	for i := range f.snapshots {
+		f.snapshots[i].Default = false
+		if f.snapshots[i].ID > next {
+			next = f.snapshots[i].ID
+		}
+	}
+	f.snapshots = append(f.snapshots, Snapshot{ID: next + 1, Default: true})
+	return nil
+}
+
+func (f *fakeBackend) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Snapshot(nil), f.snapshots...), nil
+}
+
+func (f *fakeBackend) Rollback(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rollbacks = append(f.rollbacks, id)
+	for i := range f.snapshots {
+		f.snapshots[i].Default = f.snapshots[i].ID == id
+	}
+	return nil
+}
+
+func (f *fakeBackend) Reboot(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reboots++
+	return nil
+}
+
+// boot simulates restarting into the default snapshot.
+func (f *fakeBackend) boot() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.snapshots {
+		f.snapshots[i].Active = f.snapshots[i].Default
+	}
+}
+
+type memoryRepo struct {
+	mu     sync.Mutex
+	locked bool
+	job    []byte
+}
+
+func (r *memoryRepo) CurrentJob(ctx context.Context) (persistence.OSUpdateJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locked {
+		return persistence.OSUpdateJob{}, persistence.ErrLocked
+	}
+	if r.job == nil {
+		return persistence.OSUpdateJob{}, persistence.ErrNotFound
+	}
+	return persistence.OSUpdateJob{Payload: append([]byte(nil), r.job...)}, nil
+}
+
+func (r *memoryRepo) SaveJob(ctx context.Context, job persistence.OSUpdateJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locked {
+		return persistence.ErrLocked
+	}
+	r.job = append([]byte(nil), job.Payload...)
+	return nil
+}
+
+func (r *memoryRepo) stored(t *testing.T) Job {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var job Job
+	if err := json.Unmarshal(r.job, &job); err != nil {
+		t.Fatalf("decode stored job: %v", err)
+	}
+	return job
+}
+
+func bootedBackend() *fakeBackend {
+	return &fakeBackend{snapshots: []Snapshot{{ID: 1, Active: true, Default: true}}}
+}
+
+func TestApplyStopsAtPendingRebootAndStreamsProgress(t *testing.T) {
+	backend := bootedBackend()
+	backend.output = []string{"Retrieving packages", "Installing kernel-default"}
+	backend.release = make(chan struct{})
+	repo := &memoryRepo{}
+	bus := events.NewBus()
+	defer bus.Close()
+	ch := bus.Subscribe(events.TopicOSUpdate, 16)
+	m := NewManager(backend, repo, bus)
+
+	job, err := m.Apply(context.Background(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if job.State != JobRunning || repo.stored(t).State != JobRunning {
+		t.Fatalf("expected running job persisted before install, got %+v", job)
+	}
+	if _, err := m.Apply(context.Background(), ApplyOptions{}); !errors.Is(err, ErrJobInProgress) {
+		t.Fatalf("expected ErrJobInProgress, got %v", err)
+	}
+	close(backend.release)
+	m.Wait()
+
+	st := m.Status(context.Background())
+	if !st.PendingReboot || st.Job.State != JobPendingReboot || st.Job.Snapshot != 2 {
+		t.Fatalf("expected pending reboot into snapshot 2, got %+v", st.Job)
+	}
+	if backend.reboots != 0 {
+		t.Fatalf("apply without reboot must not reboot")
+	}
+	if len(st.Job.Log) != 2 {
+		t.Fatalf("expected progress captured in job log, got %v", st.Job.Log)
+	}
+
+	var lines []string
+	deadline := time.After(time.Second)
+	for len(lines) < 2 {
+		select {
+		case evt := <-ch:
+			if p := evt.Payload.(events.OSUpdateProgress); p.Message != "" {
+				lines = append(lines, p.Message)
+			}
+		case <-deadline:
+			t.Fatalf("expected progress events, got %v", lines)
+		}
+	}
+}
+
+func TestApplyWithRebootReportsOutcomeAfterRestart(t *testing.T) {
+	backend := bootedBackend()
+	repo := &memoryRepo{}
+	m := NewManager(backend, repo, nil)
+	if _, err := m.Apply(context.Background(), ApplyOptions{Reboot: true}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	m.Wait()
+	if backend.reboots != 1 {
+		t.Fatalf("expected one reboot, got %d", backend.reboots)
+	}
+	if got := repo.stored(t); got.State != JobRebooting || got.Step != StepReboot {
+		t.Fatalf("expected rebooting job persisted, got %+v", got)
+	}
+
+	backend.boot()
+	restarted := NewManager(backend, repo, nil)
+	st := restarted.Status(context.Background())
+	if st.Job == nil || st.Job.State != JobSucceeded || st.PendingReboot {
+		t.Fatalf("expected job to settle as succeeded after reboot, got %+v", st.Job)
+	}
+	if repo.stored(t).State != JobSucceeded {
+		t.Fatalf("expected settled state persisted")
+	}
+}
+
+func TestRestartDuringInstallMarksJobFailed(t *testing.T) {
+	backend := bootedBackend()
+	repo := &memoryRepo{}
+	data, _ := json.Marshal(Job{ID: "abc", Kind: KindApply, State: JobRunning, Step: StepInstall})
+	repo.job = data
+	repo.locked = true
+
+	m := NewManager(backend, repo, nil)
+	if st := m.Status(context.Background()); st.Job != nil {
+		t.Fatalf("expected no job while the control store is locked, got %+v", st.Job)
+	}
+	repo.mu.Lock()
+	repo.locked = false
+	repo.mu.Unlock()
+
+	st := m.Status(context.Background())
+	if st.Job == nil || st.Job.State != JobFailed || st.Job.Error == "" {
+		t.Fatalf("expected interrupted job reported as failed, got %+v", st.Job)
+	}
+}
+
+func TestRollbackValidatesSnapshot(t *testing.T) {
+	backend := bootedBackend()
+	backend.snapshots = append(backend.snapshots, Snapshot{ID: 2})
+	m := NewManager(backend, &memoryRepo{}, nil)
+
+	if _, err := m.Rollback(context.Background(), 9); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("expected ErrSnapshotNotFound, got %v", err)
+	}
+	job, err := m.Rollback(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if job.Kind != KindRollback || job.State != JobPendingReboot || job.Snapshot != 2 {
+		t.Fatalf("unexpected rollback job %+v", job)
+	}
+	if len(backend.rollbacks) != 1 || backend.rollbacks[0] != 2 {
+		t.Fatalf("expected backend rollback to snapshot 2, got %v", backend.rollbacks)
+	}
+}
+
+func TestParseBackendOutput(t *testing.T) {
+	pkgs := parseZypperUpdates("S | Repository | Name | Current Version | Available Version | Arch\n--+---+---+---+---+---\nv | repo-oss | podman | 4.9.0 | 5.0.1 | x86_64\n")
+	if len(pkgs) != 1 || pkgs[0].Name != "podman" || pkgs[0].Available != "5.0.1" {
+		t.Fatalf("unexpected packages %+v", pkgs)
+	}
+	snaps, err := parseSnapperList([]byte(`{"root":[{"number":0,"description":"current"},{"number":3,"default":true,"active":true,"date":"2025-05-01 10:00:00","description":"Snapshot Update of #2"}]}`))
+	if err != nil {
+		t.Fatalf("parseSnapperList: %v", err)
+	}
+	if len(snaps) != 1 || snaps[0].ID != 3 || !snaps[0].Active || snaps[0].Date.IsZero() {
+		t.Fatalf("unexpected snapshots %+v", snaps)
+	}
+}
@@ -0,0 +1,229 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+const maxManifestSize = 1 << 20
+
+var (
+	ErrBadSignature   = errors.New("update: release manifest signature invalid")
+	ErrNoArtifact     = errors.New("update: release has no artifact for this platform")
+	ErrInvalidChannel = errors.New("update: unknown release channel")
+)
+
+// ValidChannel reports whether ch is a supported release channel.
+func ValidChannel(ch string) bool { return ch == ChannelStable || ch == ChannelBeta }
+
+// ReleaseArtifact is a downloadable piccolod binary for one platform.
+type ReleaseArtifact struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// ReleaseManifest describes the latest piccolod release on a channel.
+type ReleaseManifest struct {
+	Version    string    `json:"version"`
+	Channel    string    `json:"channel"`
+	ReleasedAt time.Time `json:"released_at,omitzero"`
+	Notes      string    `json:"notes,omitempty"`
+	// RolloutPercent limits the release to a stable subset of devices;
+	// omitted means everyone.
+	RolloutPercent *int `json:"rollout_percent,omitempty"`
+	// Artifacts are keyed by "<goos>-<goarch>", e.g. "linux-amd64".
+	Artifacts map[string]ReleaseArtifact `json:"artifacts"`
+}
+
+// signedManifest is the document served at the manifest URL. Signature is
+// an ed25519 signature over the exact bytes of the decoded Manifest field, so
+// verification never depends on JSON re-encoding.
+type signedManifest struct {
+	Manifest  string `json:"manifest"`
+	Signature string `json:"signature"`
+}
+
+// SignManifest produces the signed document for m; used by release tooling
+// and tests.
+func SignManifest(m ReleaseManifest, key ed25519.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedManifest{
+		Manifest:  base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	})
+}
+
+// VerifyManifest checks the signature on a signed manifest document and
+// decodes it. The channel must match the one requested so a stable device
+// cannot be served a beta manifest signed for another channel.
+func VerifyManifest(data []byte, pub ed25519.PublicKey, channel string) (ReleaseManifest, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return ReleaseManifest{}, errors.New("update: release public key not configured")
+	}
+	var doc signedManifest
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ReleaseManifest{}, fmt.Errorf("update: decode manifest envelope: %w", err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(doc.Manifest)
+	if err != nil {
+		return ReleaseManifest{}, fmt.Errorf("update: decode manifest payload: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(doc.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ReleaseManifest{}, ErrBadSignature
+	}
+	if !ed25519.Verify(pub, payload, sig) {
+		return ReleaseManifest{}, ErrBadSignature
+	}
+	var m ReleaseManifest
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return ReleaseManifest{}, fmt.Errorf("update: decode manifest: %w", err)
+	}
+	if strings.TrimSpace(m.Version) == "" {
+		return ReleaseManifest{}, errors.New("update: manifest missing version")
+	}
+	if m.Channel != channel {
+		return ReleaseManifest{}, fmt.Errorf("update: manifest is for channel %q, want %q", m.Channel, channel)
+	}
+	return m, nil
+}
+
+// FetchManifest downloads and verifies the manifest for channel. A
+// "{channel}" placeholder in rawURL is substituted.
+func FetchManifest(ctx context.Context, client *http.Client, rawURL, channel string, pub ed25519.PublicKey) (ReleaseManifest, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	target := manifestURL(rawURL, channel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return ReleaseManifest{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ReleaseManifest{}, fmt.Errorf("update: fetch manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ReleaseManifest{}, fmt.Errorf("update: fetch manifest: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return ReleaseManifest{}, fmt.Errorf("update: read manifest: %w", err)
+	}
+	if len(data) > maxManifestSize {
+		return ReleaseManifest{}, errors.New("update: manifest too large")
+	}
+	m, err := VerifyManifest(data, pub, channel)
+	if err != nil {
+		return ReleaseManifest{}, err
+	}
+	// Resolve relative artifact URLs against the manifest location.
+	base, err := url.Parse(target)
+	if err == nil {
+		for key, art := range m.Artifacts {
+			if ref, err := url.Parse(art.URL); err == nil {
+				art.URL = base.ResolveReference(ref).String()
+				m.Artifacts[key] = art
+			}
+		}
+	}
+	return m, nil
+}
+
+func manifestURL(raw, channel string) string {
+	return strings.ReplaceAll(raw, "{channel}", url.PathEscape(channel))
+}
+
+// Artifact returns the artifact for the running platform.
+func (m ReleaseManifest) Artifact() (ReleaseArtifact, error) {
+	art, ok := m.Artifacts[runtime.GOOS+"-"+runtime.GOARCH]
+	if !ok || art.URL == "" || art.SHA256 == "" {
+		return ReleaseArtifact{}, ErrNoArtifact
+	}
+	return art, nil
+}
+
+// InRollout reports whether deviceID falls inside the release's rollout
+// percentage. Buckets are derived from the device and version so each
+// release samples a different subset of devices.
+func (m ReleaseManifest) InRollout(deviceID string) bool {
+	if m.RolloutPercent == nil || *m.RolloutPercent >= 100 {
+		return true
+	}
+	if *m.RolloutPercent <= 0 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(deviceID + ":" + m.Version))
+	return int(binary.BigEndian.Uint16(sum[:2])%100) < *m.RolloutPercent
+}
+
+// newerVersion reports whether candidate is newer than current. Versions
+// are compared as dotted numbers after an optional "v"; a current version
+// that does not parse (e.g. "dev") is only considered older when it differs.
+func newerVersion(candidate, current string) bool {
+	c, okC := parseVersion(candidate)
+	r, okR := parseVersion(current)
+	if !okC {
+		return false
+	}
+	if !okR {
+		return strings.TrimPrefix(candidate, "v") != strings.TrimPrefix(current, "v")
+	}
+	for i := 0; i < len(c) || i < len(r); i++ {
+		var a, b int
+		if i < len(c) {
+			a = c[i]
+		}
+		if i < len(r) {
+			b = r[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	// Ignore pre-release/build suffixes ("1.2.3-4-gabc", "1.2.3+dirty").
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	parts := strings.Split(v, ".")
+	out := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, true
+}
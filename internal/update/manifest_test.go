@@ -0,0 +1,186 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newReleaseKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return pub, priv
+}
+
+func platformKey() string { return runtime.GOOS + "-" + runtime.GOARCH }
+
+func testManifest(version, channel string) ReleaseManifest {
+	return ReleaseManifest{
+		Version: version,
+		Channel: channel,
+		Artifacts: map[string]ReleaseArtifact{
+			platformKey(): {URL: "piccolod-" + version, SHA256: strings.Repeat("ab", 32)},
+		},
+	}
+}
+
+func signed(t *testing.T, m ReleaseManifest, priv ed25519.PrivateKey) []byte {
+	t.Helper()
+	data, err := SignManifest(m, priv)
+	if err != nil {
+		t.Fatalf("SignManifest: %v", err)
+	}
+	return data
+}
+
+func TestFetchManifestVerifiesAndResolvesArtifacts(t *testing.T) {
+	pub, priv := newReleaseKey(t)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, _ = w.Write(signed(t, testManifest("1.4.0", ChannelBeta), priv))
+	}))
+	defer srv.Close()
+
+	m, err := FetchManifest(context.Background(), srv.Client(), srv.URL+"/releases/{channel}/manifest.json", ChannelBeta, pub)
+	if err != nil {
+		t.Fatalf("FetchManifest: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/releases/beta/manifest.json" {
+		t.Fatalf("expected channel substituted into URL, got %v", paths)
+	}
+	art, err := m.Artifact()
+	if err != nil {
+		t.Fatalf("Artifact: %v", err)
+	}
+	if want := srv.URL + "/releases/beta/piccolod-1.4.0"; art.URL != want {
+		t.Fatalf("expected relative artifact URL resolved to %s, got %s", want, art.URL)
+	}
+}
+
+func TestVerifyManifestRejectsTampering(t *testing.T) {
+	pub, priv := newReleaseKey(t)
+	otherPub, _ := newReleaseKey(t)
+	good := signed(t, testManifest("1.4.0", ChannelStable), priv)
+
+	var doc signedManifest
+	if err := json.Unmarshal(good, &doc); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(doc.Manifest)
+	tampered := doc
+	tampered.Manifest = base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(payload), "1.4.0", "9.9.9", 1)))
+	tamperedData, _ := json.Marshal(tampered)
+	truncated := doc
+	truncated.Signature = doc.Signature[:20]
+	truncatedData, _ := json.Marshal(truncated)
+
+	cases := []struct {
+		name string
+		data []byte
+		key  ed25519.PublicKey
+		want error
+	}{
+		{"tampered payload", tamperedData, pub, ErrBadSignature},
+		{"wrong key", good, otherPub, ErrBadSignature},
+		{"short signature", truncatedData, pub, ErrBadSignature},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := VerifyManifest(tc.data, tc.key, ChannelStable); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	if _, err := VerifyManifest([]byte(`{"manifest":"%%%","signature":""}`), pub, ChannelStable); err == nil {
+		t.Fatalf("expected malformed payload encoding rejected")
+	}
+	if _, err := VerifyManifest(good, nil, ChannelStable); err == nil {
+		t.Fatalf("expected missing key rejected")
+	}
+	if _, err := VerifyManifest(good, pub, ChannelBeta); err == nil || !strings.Contains(err.Error(), "channel") {
+		t.Fatalf("expected channel mismatch rejected, got %v", err)
+	}
+	if _, err := VerifyManifest(good, pub, ChannelStable); err != nil {
+		t.Fatalf("expected untouched manifest to verify, got %v", err)
+	}
+}
+
+func TestFetchManifestHTTPErrors(t *testing.T) {
+	pub, _ := newReleaseKey(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/huge" {
+			_, _ = w.Write([]byte(strings.Repeat("x", maxManifestSize+10)))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	if _, err := FetchManifest(context.Background(), srv.Client(), srv.URL+"/missing", ChannelStable, pub); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 surfaced, got %v", err)
+	}
+	if _, err := FetchManifest(context.Background(), srv.Client(), srv.URL+"/huge", ChannelStable, pub); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("expected oversized manifest rejected, got %v", err)
+	}
+}
+
+func TestInRolloutBuckets(t *testing.T) {
+	pct := func(n int) *int { return &n }
+	m := testManifest("2.0.0", ChannelStable)
+	if !m.InRollout("device") {
+		t.Fatalf("manifest without rollout must include every device")
+	}
+	m.RolloutPercent = pct(0)
+	if m.InRollout("device") {
+		t.Fatalf("0%% rollout must exclude every device")
+	}
+	m.RolloutPercent = pct(30)
+	in := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		first := m.InRollout(id)
+		if first != m.InRollout(id) {
+			t.Fatalf("rollout bucket must be deterministic for %s", id)
+		}
+		if first {
+			in++
+		}
+	}
+	if in < 200 || in > 400 {
+		t.Fatalf("expected roughly 30%% of devices in rollout, got %d/1000", in)
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	cases := []struct {
+		candidate, current string
+		want               bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"v1.10.0", "1.9.0", true},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2.0-5-gabc", false},
+		{"1.1.0", "1.2.0", false},
+		{"1.0.0", "dev", true},
+		{"garbage", "1.0.0", false},
+	}
+	for _, tc := range cases {
+		if got := newerVersion(tc.candidate, tc.current); got != tc.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tc.candidate, tc.current, got, tc.want)
+		}
+	}
+}
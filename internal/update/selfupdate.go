@@ -0,0 +1,635 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+// ReleasePublicKey is the base64 ed25519 key that signs release manifests.
+// It is injected at build time:
+//
+//	-ldflags "-X piccolod/internal/update.ReleasePublicKey=<base64>"
+var ReleasePublicKey string
+
+// EmbeddedReleaseKey decodes ReleasePublicKey; nil disables self-update.
+func EmbeddedReleaseKey() ed25519.PublicKey {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ReleasePublicKey))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil
+	}
+	return ed25519.PublicKey(raw)
+}
+
+// Self-update stages published on the bus and reported in status.
+const (
+	StageChecking    = "checking"
+	StageDownloading = "downloading"
+	StageVerifying   = "verifying"
+	StageSwapping    = "swapping"
+	StageRestarting  = "restarting"
+	StageSucceeded   = "succeeded"
+	StageRolledBack  = "rolled_back"
+	StageFailed      = "failed"
+)
+
+const (
+	defaultSelfCheckTTL = 15 * time.Minute
+	maxBinarySize       = 512 << 20
+
+	stagedSuffix   = ".staged"
+	previousSuffix = ".previous"
+	pendingSuffix  = ".update-pending"
+)
+
+var (
+	ErrSelfUpdateDisabled   = errors.New("update: self-update not configured")
+	ErrSelfUpdateInProgress = errors.New("update: self-update already in progress")
+	ErrUpToDate             = errors.New("update: no newer release available for this device")
+)
+
+// Restarter restarts the daemon after the binary has been swapped.
+type Restarter interface {
+	Restart(ctx context.Context) error
+}
+
+// SystemdRestarter restarts the piccolod unit without waiting for the job,
+// since the caller is the process being restarted.
+type SystemdRestarter struct{ Unit string }
+
+func (r SystemdRestarter) Restart(ctx context.Context) error {
+	unit := r.Unit
+	if unit == "" {
+		unit = "piccolod.service"
+	}
+	out, err := exec.CommandContext(ctx, "systemctl", "--no-block", "restart", unit).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl restart %s: %w: %s", unit, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SelfUpdateResult records the outcome of the last binary swap.
+type SelfUpdateResult struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// SelfUpdateStatus is the API view of the self-updater.
+type SelfUpdateStatus struct {
+	Current         string            `json:"current"`
+	Available       string            `json:"available,omitempty"`
+	Channel         string            `json:"channel"`
+	UpdateAvailable bool              `json:"update_available"`
+	Stage           string            `json:"stage,omitempty"`
+	CheckedAt       time.Time         `json:"checked_at,omitzero"`
+	Error           string            `json:"error,omitempty"`
+	Last            *SelfUpdateResult `json:"last,omitempty"`
+}
+
+// SelfUpdaterOptions configures NewSelfUpdater.
+type SelfUpdaterOptions struct {
+	// ManifestURL may contain a "{channel}" placeholder.
+	ManifestURL string
+	PublicKey   ed25519.PublicKey
+	// Binary is the path swapped on apply; its directory must be writable.
+	Binary    string
+	Current   string
+	DeviceID  string
+	Client    *http.Client
+	Restarter Restarter
+	Repo      persistence.SelfUpdateRepo
+	Bus       *events.Bus
+}
+
+type selfUpdateRecord struct {
+	Channel string            `json:"channel"`
+	Last    *SelfUpdateResult `json:"last,omitempty"`
+}
+
+// SelfUpdater checks a signed release manifest and replaces the running
+// binary. The swap is confirmed in two places: ConfirmStartup clears the
+// on-disk rollback marker once the new process has notified systemd, and
+// the control-store record is settled after the next unlock.
+type SelfUpdater struct {
+	opts SelfUpdaterOptions
+	now  func() time.Time
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	loaded    bool
+	record    selfUpdateRecord
+	manifest  *ReleaseManifest
+	checkedAt time.Time
+	checkErr  error
+	stage     string
+	wg        sync.WaitGroup
+}
+
+// NewSelfUpdater constructs a self-updater. Updates stay disabled until both
+// a manifest URL and a release key are configured.
+func NewSelfUpdater(opts SelfUpdaterOptions) *SelfUpdater {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	if opts.DeviceID == "" {
+		opts.DeviceID = machineID()
+	}
+	return &SelfUpdater{
+		opts:   opts,
+		now:    time.Now,
+		ttl:    defaultSelfCheckTTL,
+		record: selfUpdateRecord{Channel: ChannelStable},
+	}
+}
+
+// Enabled reports whether a manifest URL and a release key are configured.
+func (u *SelfUpdater) Enabled() bool {
+	return strings.TrimSpace(u.opts.ManifestURL) != "" && len(u.opts.PublicKey) == ed25519.PublicKeySize
+}
+
+// Status reports the current and available versions, refreshing the
+// manifest when the cached copy is older than the check TTL.
+func (u *SelfUpdater) Status(ctx context.Context) SelfUpdateStatus {
+	u.load(ctx)
+	u.mu.Lock()
+	stale := u.now().Sub(u.checkedAt) > u.ttl && u.stage == ""
+	u.mu.Unlock()
+	if stale && u.Enabled() {
+		_, _ = u.Check(ctx)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st := SelfUpdateStatus{
+		Current:   u.opts.Current,
+		Channel:   u.record.Channel,
+		Stage:     u.stage,
+		CheckedAt: u.checkedAt,
+	}
+	if !u.Enabled() {
+		st.Error = ErrSelfUpdateDisabled.Error()
+	} else if u.checkErr != nil {
+		st.Error = u.checkErr.Error()
+	}
+	if u.manifest != nil {
+		st.Available = u.manifest.Version
+		st.UpdateAvailable = u.offered(*u.manifest)
+	}
+	if u.record.Last != nil {
+		last := *u.record.Last
+		st.Last = &last
+	}
+	return st
+}
+
+// offered reports whether m should be installed on this device.
+func (u *SelfUpdater) offered(m ReleaseManifest) bool {
+	if !newerVersion(m.Version, u.opts.Current) || !m.InRollout(u.opts.DeviceID) {
+		return false
+	}
+	_, err := m.Artifact()
+	return err == nil
+}
+
+// Check fetches and verifies the manifest for the configured channel.
+func (u *SelfUpdater) Check(ctx context.Context) (ReleaseManifest, error) {
+	if !u.Enabled() {
+		return ReleaseManifest{}, ErrSelfUpdateDisabled
+	}
+	u.mu.Lock()
+	channel := u.record.Channel
+	u.mu.Unlock()
+	m, err := FetchManifest(ctx, u.opts.Client, u.opts.ManifestURL, channel, u.opts.PublicKey)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.checkedAt = u.now().UTC()
+	u.checkErr = err
+	if err != nil {
+		return ReleaseManifest{}, err
+	}
+	u.manifest = &m
+	return m, nil
+}
+
+// SetChannel switches the release channel and persists the choice.
+func (u *SelfUpdater) SetChannel(ctx context.Context, channel string) error {
+	if !ValidChannel(channel) {
+		return ErrInvalidChannel
+	}
+	u.load(ctx)
+	u.mu.Lock()
+	if u.stage != "" {
+		u.mu.Unlock()
+		return ErrSelfUpdateInProgress
+	}
+	rec := u.record
+	rec.Channel = channel
+	u.mu.Unlock()
+	if err := u.save(ctx, rec); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	changed := u.record.Channel != channel
+	u.record.Channel = channel
+	if changed {
+		u.manifest = nil
+		u.checkedAt = time.Time{}
+		u.checkErr = nil
+	}
+	u.mu.Unlock()
+	return nil
+}
+
+// Apply downloads, verifies and swaps in the release from a fresh manifest,
+// then restarts the daemon. The work continues in the background; progress
+// is published on the bus and reflected in Status.
+func (u *SelfUpdater) Apply(ctx context.Context) error {
+	if !u.Enabled() {
+		return ErrSelfUpdateDisabled
+	}
+	u.load(ctx)
+	u.mu.Lock()
+	if u.stage != "" {
+		u.mu.Unlock()
+		return ErrSelfUpdateInProgress
+	}
+	u.stage = StageChecking
+	u.mu.Unlock()
+	u.publish(StageChecking, "", "")
+
+	m, err := u.Check(ctx)
+	if err == nil && !u.offered(m) {
+		err = ErrUpToDate
+	}
+	if err != nil {
+		u.setStage("")
+		return err
+	}
+	u.wg.Add(1)
+	go u.run(m)
+	return nil
+}
+
+// Wait blocks until a background apply returns; used by tests.
+func (u *SelfUpdater) Wait() { u.wg.Wait() }
+
+func (u *SelfUpdater) run(m ReleaseManifest) {
+	defer u.wg.Done()
+	ctx := context.Background()
+	result := SelfUpdateResult{From: u.opts.Current, To: m.Version, StartedAt: u.now().UTC()}
+	fail := func(err error) {
+		os.Remove(u.opts.Binary + stagedSuffix)
+		result.State = StageFailed
+		result.Error = err.Error()
+		result.FinishedAt = u.now().UTC()
+		u.recordResult(ctx, result)
+		u.setStage("")
+		u.publish(StageFailed, m.Version, err.Error())
+	}
+
+	art, err := m.Artifact()
+	if err != nil {
+		fail(err)
+		return
+	}
+	u.setStage(StageDownloading)
+	u.publish(StageDownloading, m.Version, art.URL)
+	staged := u.opts.Binary + stagedSuffix
+	sum, err := u.download(ctx, art, staged)
+	if err != nil {
+		fail(err)
+		return
+	}
+	u.setStage(StageVerifying)
+	u.publish(StageVerifying, m.Version, "")
+	if !strings.EqualFold(sum, art.SHA256) {
+		fail(fmt.Errorf("checksum mismatch: got %s, manifest %s", sum, art.SHA256))
+		return
+	}
+
+	u.setStage(StageSwapping)
+	u.publish(StageSwapping, m.Version, "")
+	if err := swapBinary(u.opts.Binary, staged, pendingMarker{From: u.opts.Current, To: m.Version}); err != nil {
+		fail(err)
+		return
+	}
+
+	// Record the in-flight swap before restarting; the new process settles
+	// it after unlock.
+	result.State = StageRestarting
+	u.recordResult(ctx, result)
+	u.setStage(StageRestarting)
+	u.publish(StageRestarting, m.Version, "")
+	if u.opts.Restarter == nil {
+		return
+	}
+	if err := u.opts.Restarter.Restart(ctx); err != nil {
+		// The new binary is in place and will run on the next restart.
+		log.Printf("WARN: self-update restart failed: %v", err)
+		u.publish(StageRestarting, m.Version, "restart failed: "+err.Error())
+	}
+}
+
+func (u *SelfUpdater) download(ctx context.Context, art ReleaseArtifact, dest string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, art.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := u.opts.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download release: unexpected status %s", resp.Status)
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxBinarySize+1))
+	if err == nil && n > maxBinarySize {
+		err = errors.New("download release: artifact too large")
+	}
+	if err == nil && art.Size > 0 && n != art.Size {
+		err = fmt.Errorf("download release: got %d bytes, manifest %d", n, art.Size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (u *SelfUpdater) setStage(stage string) {
+	u.mu.Lock()
+	u.stage = stage
+	u.mu.Unlock()
+}
+
+func (u *SelfUpdater) recordResult(ctx context.Context, result SelfUpdateResult) {
+	u.mu.Lock()
+	rec := u.record
+	u.mu.Unlock()
+	rec.Last = &result
+	if err := u.save(ctx, rec); err != nil {
+		log.Printf("WARN: self-update result not persisted: %v", err)
+	}
+	u.mu.Lock()
+	u.record.Last = &result
+	u.mu.Unlock()
+}
+
+func (u *SelfUpdater) save(ctx context.Context, rec selfUpdateRecord) error {
+	if u.opts.Repo == nil {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return u.opts.Repo.SaveState(ctx, persistence.SelfUpdateState{Payload: data})
+}
+
+// ReloadFromStorage loads the persisted channel after unlock and settles a
+// swap that restarted this process: running the target version means the
+// new binary came up and can write to the control store, so the update is
+// recorded as succeeded; running the old version means the startup guard
+// restored it.
+func (u *SelfUpdater) ReloadFromStorage() error {
+	u.load(context.Background())
+	return nil
+}
+
+func (u *SelfUpdater) load(ctx context.Context) {
+	u.mu.Lock()
+	if u.loaded || u.opts.Repo == nil {
+		u.mu.Unlock()
+		return
+	}
+	u.mu.Unlock()
+	state, err := u.opts.Repo.CurrentState(ctx)
+	if err != nil && !errors.Is(err, persistence.ErrNotFound) {
+		return
+	}
+	rec := selfUpdateRecord{Channel: ChannelStable}
+	if err == nil {
+		if err := json.Unmarshal(state.Payload, &rec); err != nil {
+			log.Printf("WARN: self-update state decode failed: %v", err)
+		}
+		if !ValidChannel(rec.Channel) {
+			rec.Channel = ChannelStable
+		}
+	}
+	u.mu.Lock()
+	if u.loaded {
+		u.mu.Unlock()
+		return
+	}
+	u.loaded = true
+	u.record = rec
+	u.mu.Unlock()
+
+	last := rec.Last
+	if last == nil || last.State != StageRestarting {
+		return
+	}
+	settled := *last
+	settled.FinishedAt = u.now().UTC()
+	switch u.opts.Current {
+	case last.To:
+		settled.State = StageSucceeded
+	case last.From:
+		settled.State = StageRolledBack
+		settled.Error = "new version did not become ready; previous binary restored"
+	default:
+		settled.State = StageFailed
+		settled.Error = fmt.Sprintf("running %s after updating %s to %s", u.opts.Current, last.From, last.To)
+	}
+	u.recordResult(ctx, settled)
+	u.publish(settled.State, settled.To, settled.Error)
+}
+
+func (u *SelfUpdater) publish(stage, to, message string) {
+	if u.opts.Bus == nil {
+		return
+	}
+	u.opts.Bus.Publish(events.Event{Topic: events.TopicSelfUpdate, Payload: events.SelfUpdateStage{
+		Stage:   stage,
+		From:    u.opts.Current,
+		To:      to,
+		Message: message,
+	}})
+}
+
+// Startup guard ---------------------------------------------------------------
+
+// pendingMarker sits next to the binary between a swap and the first
+// successful start of the new version. It is plain JSON outside the state
+// directory because it must be readable before the control store unlocks.
+type pendingMarker struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Attempts int    `json:"attempts"`
+}
+
+// swapBinary keeps a hard link (or copy) of the current binary as the
+// rollback target, writes the pending marker and atomically renames the
+// staged file over the binary.
+func swapBinary(binary, staged string, marker pendingMarker) error {
+	previous := binary + previousSuffix
+	_ = os.Remove(previous)
+	if err := os.Link(binary, previous); err != nil {
+		if err := copyFile(binary, previous); err != nil {
+			return fmt.Errorf("preserve previous binary: %w", err)
+		}
+	}
+	if err := writeMarker(binary+pendingSuffix, marker); err != nil {
+		return err
+	}
+	if err := os.Rename(staged, binary); err != nil {
+		_ = os.Remove(binary + pendingSuffix)
+		return fmt.Errorf("swap binary: %w", err)
+	}
+	syncDir(filepath.Dir(binary))
+	return nil
+}
+
+// GuardStartup runs before the server starts. The first start after a swap
+// is counted; if the binary is started again without ConfirmStartup having
+// run (systemd gave up waiting for READY, or the process crashed), the
+// previous binary is restored and restored=true tells the caller to exit so
+// systemd restarts into it.
+func GuardStartup(binary string) (restored bool, err error) {
+	if binary == "" {
+		return false, nil
+	}
+	markerPath := binary + pendingSuffix
+	data, err := os.ReadFile(markerPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var marker pendingMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		_ = os.Remove(markerPath)
+		return false, fmt.Errorf("decode self-update marker: %w", err)
+	}
+	if marker.Attempts == 0 {
+		marker.Attempts++
+		return false, writeMarker(markerPath, marker)
+	}
+	previous := binary + previousSuffix
+	if err := os.Rename(previous, binary); err != nil {
+		return false, fmt.Errorf("restore previous binary: %w", err)
+	}
+	_ = os.Remove(markerPath)
+	syncDir(filepath.Dir(binary))
+	return true, nil
+}
+
+// ConfirmStartup clears the rollback marker once the new binary is ready.
+func ConfirmStartup(binary string) {
+	if binary == "" {
+		return
+	}
+	if _, err := os.Stat(binary + pendingSuffix); err != nil {
+		return
+	}
+	_ = os.Remove(binary + pendingSuffix)
+	_ = os.Remove(binary + previousSuffix)
+}
+
+// BinaryPath returns the path self-update replaces: PICCOLO_SELF_UPDATE_BINARY
+// when set, otherwise the resolved path of the running executable.
+func BinaryPath() string {
+	if p := strings.TrimSpace(os.Getenv("PICCOLO_SELF_UPDATE_BINARY")); p != "" {
+		return p
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		return resolved
+	}
+	return exe
+}
+
+func writeMarker(path string, marker pendingMarker) error {
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+func machineID() string {
+	for _, p := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(p); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	host, _ := os.Hostname()
+	return host
+}
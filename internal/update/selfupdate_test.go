@@ -0,0 +1,302 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"piccolod/internal/events"
+	"piccolod/internal/persistence"
+)
+
+type fakeRestarter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeRestarter) Restart(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return nil
+}
+
+type memorySelfUpdateRepo struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+func (r *memorySelfUpdateRepo) CurrentState(ctx context.Context) (persistence.SelfUpdateState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return persistence.SelfUpdateState{}, persistence.ErrNotFound
+	}
+	return persistence.SelfUpdateState{Payload: append([]byte(nil), r.state...)}, nil
+}
+
+func (r *memorySelfUpdateRepo) SaveState(ctx context.Context, st persistence.SelfUpdateState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = append([]byte(nil), st.Payload...)
+	return nil
+}
+
+func (r *memorySelfUpdateRepo) stored(t *testing.T) selfUpdateRecord {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rec selfUpdateRecord
+	if err := json.Unmarshal(r.state, &rec); err != nil {
+		t.Fatalf("decode stored record: %v", err)
+	}
+	return rec
+}
+
+// releaseServer serves a signed manifest for version whose artifact is
+// payload; the manifest checksum can be overridden to simulate corruption.
+func releaseServer(t *testing.T, priv ed25519.PrivateKey, version string, payload []byte, checksum string) *httptest.Server {
+	t.Helper()
+	if checksum == "" {
+		sum := sha256.Sum256(payload)
+		checksum = hex.EncodeToString(sum[:])
+	}
+	m := ReleaseManifest{
+		Version:   version,
+		Channel:   ChannelStable,
+		Artifacts: map[string]ReleaseArtifact{platformKey(): {URL: "bin", SHA256: checksum, Size: int64(len(payload))}},
+	}
+	doc := signed(t, m, priv)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stable/manifest.json":
+			_, _ = w.Write(doc)
+		case "/stable/bin":
+			_, _ = w.Write(payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func installedBinary(t *testing.T, content string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "piccolod")
+	if err := os.WriteFile(bin, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestSelfUpdateApplySwapsBinaryAndRestarts(t *testing.T) {
+	pub, priv := newReleaseKey(t)
+	srv := releaseServer(t, priv, "1.1.0", []byte("new-binary"), "")
+	bin := installedBinary(t, "old-binary")
+	repo := &memorySelfUpdateRepo{}
+	restarter := &fakeRestarter{}
+	bus := events.NewBus()
+	defer bus.Close()
+	ch := bus.Subscribe(events.TopicSelfUpdate, 16)
+
+	u := NewSelfUpdater(SelfUpdaterOptions{
+		ManifestURL: srv.URL + "/{channel}/manifest.json",
+		PublicKey:   pub,
+		Binary:      bin,
+		Current:     "1.0.0",
+		DeviceID:    "device",
+		Client:      srv.Client(),
+		Restarter:   restarter,
+		Repo:        repo,
+		Bus:         bus,
+	})
+	st := u.Status(context.Background())
+	if st.Available != "1.1.0" || !st.UpdateAvailable || st.Channel != ChannelStable {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if err := u.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	u.Wait()
+
+	if got := readFile(t, bin); got != "new-binary" {
+		t.Fatalf("expected binary swapped, got %q", got)
+	}
+	if got := readFile(t, bin+previousSuffix); got != "old-binary" {
+		t.Fatalf("expected previous binary kept for rollback, got %q", got)
+	}
+	if _, err := os.Stat(bin + pendingSuffix); err != nil {
+		t.Fatalf("expected pending marker written: %v", err)
+	}
+	if restarter.calls != 1 {
+		t.Fatalf("expected one restart, got %d", restarter.calls)
+	}
+	if rec := repo.stored(t); rec.Last == nil || rec.Last.State != StageRestarting || rec.Last.To != "1.1.0" {
+		t.Fatalf("expected restarting record persisted, got %+v", rec.Last)
+	}
+
+	var stages []string
+	deadline := time.After(time.Second)
+	for len(stages) < 5 {
+		select {
+		case evt := <-ch:
+			stages = append(stages, evt.Payload.(events.SelfUpdateStage).Stage)
+		case <-deadline:
+			t.Fatalf("expected stage events, got %v", stages)
+		}
+	}
+	want := []string{StageChecking, StageDownloading, StageVerifying, StageSwapping, StageRestarting}
+	if strings.Join(stages, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected stages %v, got %v", want, stages)
+	}
+
+	// The new process starts, confirms readiness and settles the record.
+	if restored, err := GuardStartup(bin); err != nil || restored {
+		t.Fatalf("first start after swap must run the new binary: restored=%v err=%v", restored, err)
+	}
+	ConfirmStartup(bin)
+	if _, err := os.Stat(bin + pendingSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected marker cleared after confirm")
+	}
+	restarted := NewSelfUpdater(SelfUpdaterOptions{Binary: bin, Current: "1.1.0", Repo: repo})
+	if err := restarted.ReloadFromStorage(); err != nil {
+		t.Fatal(err)
+	}
+	if last := restarted.Status(context.Background()).Last; last == nil || last.State != StageSucceeded {
+		t.Fatalf("expected update recorded as succeeded, got %+v", last)
+	}
+}
+
+func TestSelfUpdateChecksumMismatchLeavesBinary(t *testing.T) {
+	pub, priv := newReleaseKey(t)
+	srv := releaseServer(t, priv, "1.1.0", []byte("new-binary"), strings.Repeat("00", 32))
+	bin := installedBinary(t, "old-binary")
+	repo := &memorySelfUpdateRepo{}
+	restarter := &fakeRestarter{}
+	u := NewSelfUpdater(SelfUpdaterOptions{
+		ManifestURL: srv.URL + "/{channel}/manifest.json",
+		PublicKey:   pub,
+		Binary:      bin,
+		Current:     "1.0.0",
+		Client:      srv.Client(),
+		Restarter:   restarter,
+		Repo:        repo,
+	})
+	if err := u.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	u.Wait()
+
+	if got := readFile(t, bin); got != "old-binary" {
+		t.Fatalf("binary must be untouched on checksum mismatch, got %q", got)
+	}
+	for _, suffix := range []string{stagedSuffix, pendingSuffix} {
+		if _, err := os.Stat(bin + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s cleaned up", suffix)
+		}
+	}
+	if restarter.calls != 0 {
+		t.Fatalf("must not restart after a failed download")
+	}
+	if rec := repo.stored(t); rec.Last == nil || rec.Last.State != StageFailed || !strings.Contains(rec.Last.Error, "checksum") {
+		t.Fatalf("expected failure recorded, got %+v", rec.Last)
+	}
+}
+
+func TestSelfUpdateApplyRejectsWhenUpToDateOrDisabled(t *testing.T) {
+	pub, priv := newReleaseKey(t)
+	srv := releaseServer(t, priv, "1.0.0", []byte("same"), "")
+	u := NewSelfUpdater(SelfUpdaterOptions{
+		ManifestURL: srv.URL + "/{channel}/manifest.json",
+		PublicKey:   pub,
+		Binary:      installedBinary(t, "same"),
+		Current:     "1.0.0",
+		Client:      srv.Client(),
+	})
+	if err := u.Apply(context.Background()); !errors.Is(err, ErrUpToDate) {
+		t.Fatalf("expected ErrUpToDate, got %v", err)
+	}
+	if st := u.Status(context.Background()); st.Stage != "" || st.UpdateAvailable {
+		t.Fatalf("expected idle status, got %+v", st)
+	}
+
+	disabled := NewSelfUpdater(SelfUpdaterOptions{Current: "1.0.0"})
+	if err := disabled.Apply(context.Background()); !errors.Is(err, ErrSelfUpdateDisabled) {
+		t.Fatalf("expected ErrSelfUpdateDisabled, got %v", err)
+	}
+	if st := disabled.Status(context.Background()); st.Error == "" {
+		t.Fatalf("expected disabled reason in status")
+	}
+}
+
+func TestSelfUpdateChannelPersists(t *testing.T) {
+	repo := &memorySelfUpdateRepo{}
+	u := NewSelfUpdater(SelfUpdaterOptions{Current: "1.0.0", Repo: repo})
+	if err := u.SetChannel(context.Background(), "nightly"); !errors.Is(err, ErrInvalidChannel) {
+		t.Fatalf("expected ErrInvalidChannel, got %v", err)
+	}
+	if err := u.SetChannel(context.Background(), ChannelBeta); err != nil {
+		t.Fatalf("SetChannel: %v", err)
+	}
+	reloaded := NewSelfUpdater(SelfUpdaterOptions{Current: "1.0.0", Repo: repo})
+	if st := reloaded.Status(context.Background()); st.Channel != ChannelBeta {
+		t.Fatalf("expected beta channel restored, got %q", st.Channel)
+	}
+}
+
+func TestGuardStartupRestoresPreviousBinary(t *testing.T) {
+	bin := installedBinary(t, "old-binary")
+	staged := bin + stagedSuffix
+	if err := os.WriteFile(staged, []byte("broken-binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := swapBinary(bin, staged, pendingMarker{From: "1.0.0", To: "1.1.0"}); err != nil {
+		t.Fatalf("swapBinary: %v", err)
+	}
+	if restored, err := GuardStartup(bin); err != nil || restored {
+		t.Fatalf("first start must try the new binary: restored=%v err=%v", restored, err)
+	}
+	// The new binary never confirmed readiness; systemd starts it again.
+	restored, err := GuardStartup(bin)
+	if err != nil || !restored {
+		t.Fatalf("expected previous binary restored: restored=%v err=%v", restored, err)
+	}
+	if got := readFile(t, bin); got != "old-binary" {
+		t.Fatalf("expected old binary back in place, got %q", got)
+	}
+	if _, err := os.Stat(bin + pendingSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected marker removed after restore")
+	}
+
+	// The old binary comes back up and records the rollback.
+	data, _ := json.Marshal(selfUpdateRecord{Channel: ChannelStable, Last: &SelfUpdateResult{From: "1.0.0", To: "1.1.0", State: StageRestarting}})
+	repo := &memorySelfUpdateRepo{state: data}
+	u := NewSelfUpdater(SelfUpdaterOptions{Binary: bin, Current: "1.0.0", Repo: repo})
+	if last := u.Status(context.Background()).Last; last == nil || last.State != StageRolledBack {
+		t.Fatalf("expected rollback recorded, got %+v", last)
+	}
+	if rec := repo.stored(t); rec.Last.State != StageRolledBack {
+		t.Fatalf("expected rollback persisted, got %+v", rec.Last)
+	}
+}
@@ -3,6 +3,9 @@ import { API_BASE_URL } from '$lib/config';
 export type ApiError = {
   message: string;
   code?: number;
+  /** Stable machine-readable code from the error envelope, e.g. "locked". */
+  errorCode?: string;
+  requestId?: string;
   retryAfter?: number;
   details?: unknown;
 };
@@ -85,17 +88,30 @@ export async function http<T = unknown>(path: string, options: RequestOptions =
 
   if (!response.ok) {
     let message = response.statusText || 'Request failed';
+    let errorCode: string | undefined;
+    let requestId = response.headers.get('X-Request-ID') ?? undefined;
     let details: unknown;
     try {
+      // Errors arrive as {error: {code, message, details?, request_id}}.
       const data = await response.json();
-      if (typeof data?.message === 'string') message = data.message;
-      details = data;
+      const body = data?.error;
+      if (typeof body?.message === 'string' && body.message) message = body.message;
+      if (typeof body?.code === 'string') errorCode = body.code;
+      if (typeof body?.request_id === 'string') requestId = body.request_id;
+      details = body?.details;
     } catch {
       // ignore
     }
     const retryAfterHeader = response.headers.get('Retry-After');
     const retryAfter = retryAfterHeader ? Number(retryAfterHeader) : undefined;
-    const error: ApiError = { message, code: response.status, details, retryAfter: Number.isFinite(retryAfter) ? retryAfter : undefined };
+    const error: ApiError = {
+      message,
+      code: response.status,
+      errorCode,
+      requestId,
+      details,
+      retryAfter: Number.isFinite(retryAfter) ? retryAfter : undefined
+    };
     throw error;
   }
 
@@ -11,7 +11,8 @@ const config = {
 		adapter: adapter({
 			pages: '../web',
 			assets: '../web',
-			fallback: 'entry.html'
+			fallback: 'entry.html',
+			precompress: true
 		})
 	}
 };